@@ -32,8 +32,10 @@ import (
 	kubenamespace "github.com/argoproj-labs/argocd-agent/internal/backend/kubernetes/namespace"
 	kuberepository "github.com/argoproj-labs/argocd-agent/internal/backend/kubernetes/repository"
 	"github.com/argoproj-labs/argocd-agent/internal/cache"
+	"github.com/argoproj-labs/argocd-agent/internal/certmanager"
 	"github.com/argoproj-labs/argocd-agent/internal/config"
 	"github.com/argoproj-labs/argocd-agent/internal/event"
+	"github.com/argoproj-labs/argocd-agent/internal/event/targets"
 	"github.com/argoproj-labs/argocd-agent/internal/informer"
 	"github.com/argoproj-labs/argocd-agent/internal/kube"
 	"github.com/argoproj-labs/argocd-agent/internal/logging"
@@ -50,6 +52,7 @@ import (
 	"github.com/argoproj-labs/argocd-agent/pkg/client"
 	"github.com/argoproj-labs/argocd-agent/pkg/types"
 	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/health"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -67,7 +70,10 @@ import (
 type Agent struct {
 	context  context.Context
 	cancelFn context.CancelFunc
-	options  AgentOptions
+	// stopErr is the reason the agent stopped on its own, if any. It is set
+	// before the agent's context is canceled.
+	stopErr error
+	options AgentOptions
 	// namespace is the namespace to manage applications in
 	namespace string
 	// allowedNamespaces is the list of namespaces that the agent is allowed to manage applications in
@@ -75,6 +81,9 @@ type Agent struct {
 	// infStopCh is not currently used
 	infStopCh chan struct{}
 	connected atomic.Bool
+	// healthSrv reports the connection state through the gRPC health
+	// checking protocol
+	healthSrv *health.Server
 	// syncCh is not currently used
 	syncCh           chan bool
 	remote           *client.Remote
@@ -91,8 +100,17 @@ type Agent struct {
 	watchLock sync.RWMutex
 
 	eventWriter *event.EventWriter
-	version     *version.Version
-	kubeClient  *kube.KubernetesClient
+	// sequences tracks the sequence numbers of the events received from the
+	// principal, so that an event is not applied after a later one for the
+	// same resource
+	sequences *event.SequenceTracker
+	// watermarks tracks the resource versions of the principal's
+	// Applications the agent has applied, for incremental resyncs
+	watermarks *appWatermarks
+	// deltas resolves the deltas received from the principal
+	deltas     *event.DeltaReceiver
+	version    *version.Version
+	kubeClient *kube.KubernetesClient
 
 	// metrics holds agent side metrics
 	metrics *metrics.AgentMetrics
@@ -149,6 +167,15 @@ type Agent struct {
 	// will be silently skipped during resync instead of causing errors.
 	ignoreUnmanagedApps bool
 
+	// reportInclude and reportExclude are the rules selecting the
+	// applications an autonomous agent reports to the principal.
+	reportInclude []appReportRule
+	reportExclude []appReportRule
+
+	// appNamespaceRules place the Applications received from the principal
+	// in namespaces other than the agent's own, by their name
+	appNamespaceRules []appNamespaceRule
+
 	// createNamespace when true, the agent will create namespaces that
 	// don't exist before creating applications. This is used in combination with
 	// destination-based mapping.
@@ -189,6 +216,53 @@ type AgentOptions struct {
 	// the connection alive through service meshes like Istio that have idle timeouts.
 	// A value of 0 disables heartbeats.
 	heartbeatInterval time.Duration
+
+	// prioritizedStreams makes the agent open a stream of its own for each
+	// lane of events the principal supports
+	prioritizedStreams bool
+
+	// chunkSize is the size of the chunks large events are sent to the
+	// principal in
+	chunkSize int
+
+	// batchSize is the maximum number of events sent to the principal in a
+	// single message
+	batchSize int
+
+	// batchWindow is how long updates to an Application are held back to
+	// coalesce successive updates into one event
+	batchWindow time.Duration
+
+	// deltaEvents is whether Application events are sent to the principal as
+	// deltas, if the principal can resolve them
+	deltaEvents bool
+
+	// payloadTransferThreshold is the size in bytes above which the payload
+	// of events is transferred to the principal out of band. 0 disables it.
+	payloadTransferThreshold int
+
+	// stateDigestInterval is the interval at which a managed agent sends a
+	// digest of its resources to the principal. A value of 0 disables it.
+	stateDigestInterval time.Duration
+
+	// clientCertSecret is the TLS secret holding the agent's client
+	// certificate, which is renewed through the principal when set.
+	clientCertSecret string
+	// clientCertKeyOptions configures the private keys generated for
+	// renewed client certificates
+	clientCertKeyOptions tlsutil.KeyGenOptions
+
+	// customEventHandlers process the custom events received from the
+	// principal, by their target
+	customEventHandlers map[targets.EventTarget]CustomEventHandler
+
+	// repoCipher decrypts the credentials in repository secrets received
+	// from the principal
+	repoCipher *repository.FieldCipher
+
+	// appFilter strips fields from Applications before they are sent to the
+	// principal. If nil, Applications are sent as they are.
+	appFilter *event.ApplicationFilter
 }
 
 // AgentOption is a functional option type used to configure an Agent instance during initialization.
@@ -206,6 +280,7 @@ func NewAgent(ctx context.Context, client *kube.KubernetesClient, namespace stri
 		sourceCache:      cache.NewSourceCache(),
 		inflightLogs:     make(map[string]struct{}),
 		inflightTerminal: make(map[string]struct{}),
+		healthSrv:        newHealthServer(),
 	}
 	a.infStopCh = make(chan struct{})
 	a.namespace = namespace
@@ -267,6 +342,10 @@ func NewAgent(ctx context.Context, client *kube.KubernetesClient, namespace stri
 	// Initial state of the agent is disconnected
 	a.connected.Store(false)
 
+	a.sequences = event.NewSequenceTracker()
+	a.watermarks = newAppWatermarks()
+	a.deltas = event.NewDeltaReceiver()
+
 	// We have one queue in the agent, named default
 	a.queues = queue.NewSendRecvQueues()
 	if err := a.queues.Create(defaultQueueName); err != nil {
@@ -287,10 +366,20 @@ func NewAgent(ctx context.Context, client *kube.KubernetesClient, namespace stri
 		return nil, fmt.Errorf("destination-based mapping is not supported for autonomous agents")
 	}
 
+	if len(a.appNamespaceRules) > 0 {
+		if a.mode != types.AgentModeManaged {
+			return nil, fmt.Errorf("application namespace mapping is only supported for managed agents")
+		}
+		if a.destinationBasedMapping {
+			return nil, fmt.Errorf("application namespace mapping cannot be used with destination-based mapping")
+		}
+	}
+
 	// Determine the namespace(s) to watch for applications
 	appNamespace := a.namespace
-	if a.destinationBasedMapping {
-		// Watch all namespaces when destination-based mapping is enabled
+	if a.destinationBasedMapping || len(a.appNamespaceRules) > 0 {
+		// Watch all namespaces when applications may be placed in any
+		// namespace. The filter chain admits only the permitted ones.
 		appNamespace = ""
 	}
 
@@ -517,10 +606,12 @@ func (a *Agent) Start(ctx context.Context) error {
 	}
 
 	if a.options.metricsPort > 0 {
-		metrics.StartMetricsServer(metrics.WithListener("", a.options.metricsPort))
+		metrics.StartMetricsServer(metrics.WithListener("", a.options.metricsPort),
+			metrics.WithGRPCHandler(a.healthGRPCServer()))
 	}
 
 	a.emitter = event.NewEventSource(fmt.Sprintf("agent://%s", "agent-managed"))
+	a.emitter.SetApplicationFilter(a.options.appFilter)
 
 	if a.labelSelector != "" {
 		log().Infof("Agent informers are using the label selector: %s", a.labelSelector)
@@ -644,6 +735,9 @@ func (a *Agent) Start(ctx context.Context) error {
 		// TODO: Right now, maintainConnection always returns nil. Revisit
 		// this.
 		_ = a.maintainConnection()
+		if a.options.clientCertSecret != "" {
+			go a.maintainClientCertificate(certmanager.DefaultRenewInterval)
+		}
 	}
 
 	return nil
@@ -678,6 +772,20 @@ func (a *Agent) Stop() error {
 	return nil
 }
 
+// Done returns a channel that is closed when the agent has stopped, either
+// because Stop was called or because it gave up connecting to the principal.
+// It must only be called after Start.
+func (a *Agent) Done() <-chan struct{} {
+	return a.context.Done()
+}
+
+// Err returns the reason the agent stopped on its own, or nil if it was
+// stopped by Stop or is still running. It is only valid once the channel
+// returned by Done is closed.
+func (a *Agent) Err() error {
+	return a.stopErr
+}
+
 // IsConnected returns whether the agent is connected to the principal
 func (a *Agent) IsConnected() bool {
 	return a.remote != nil && a.connected.Load()
@@ -686,6 +794,7 @@ func (a *Agent) IsConnected() bool {
 // SetConnected sets the connection state of the agent
 func (a *Agent) SetConnected(connected bool) {
 	a.connected.Store(connected)
+	a.updateServingStatus()
 }
 
 func log() *logrus.Entry {
@@ -719,7 +828,7 @@ func (a *Agent) populateSourceCache(ctx context.Context) error {
 	// so we need to list from all namespaces
 	var namespaces []string
 	if !a.destinationBasedMapping {
-		namespaces = []string{a.namespace}
+		namespaces = a.appNamespaces()
 	}
 	appList, err := a.appManager.List(ctx, backend.ApplicationSelector{Namespaces: namespaces})
 	if err != nil {
@@ -22,6 +22,7 @@ import (
 	"time"
 
 	"github.com/sirupsen/logrus"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"k8s.io/apimachinery/pkg/runtime"
 
 	"github.com/argoproj-labs/argocd-agent/internal/kube"
@@ -37,6 +38,8 @@ func newAgent(t *testing.T, apps ...runtime.Object) (*Agent, *kube.KubernetesCli
 	require.NoError(t, err)
 	agent, err := NewAgent(context.TODO(), kubec, "argocd", WithRemote(remote), WithCacheRefreshInterval(10*time.Second), WithInformerSyncTimeout(10*time.Second))
 	require.NoError(t, err)
+	// The context is set when the agent is started
+	agent.context = context.TODO()
 	return agent, kubec
 }
 
@@ -47,6 +50,8 @@ func newAgentManaged(t *testing.T, apps ...runtime.Object) (*Agent, *kube.Kubern
 	require.NoError(t, err)
 	agent, err := NewAgent(context.TODO(), kubec, "argocd", WithRemote(remote), WithMode("managed"), WithCacheRefreshInterval(10*time.Second), WithInformerSyncTimeout(10*time.Second))
 	require.NoError(t, err)
+	// The context is set when the agent is started
+	agent.context = context.TODO()
 	return agent, kubec
 }
 
@@ -252,7 +257,32 @@ func Test_Healthz(t *testing.T) {
 		require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
 		defer resp.Body.Close()
 	})
+}
+
+func Test_GRPCHealth(t *testing.T) {
+	agent, _ := newAgent(t)
+	require.NotNil(t, agent)
+	req := &healthpb.HealthCheckRequest{}
+
+	t.Run("Not serving before the agent has connected", func(t *testing.T) {
+		resp, err := agent.healthSrv.Check(context.Background(), req)
+		require.NoError(t, err)
+		require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, resp.Status)
+	})
 
+	t.Run("Serving when agent is connected", func(t *testing.T) {
+		agent.SetConnected(true)
+		resp, err := agent.healthSrv.Check(context.Background(), req)
+		require.NoError(t, err)
+		require.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+	})
+
+	t.Run("Not serving when agent is not connected", func(t *testing.T) {
+		agent.SetConnected(false)
+		resp, err := agent.healthSrv.Check(context.Background(), req)
+		require.NoError(t, err)
+		require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, resp.Status)
+	})
 }
 
 func init() {
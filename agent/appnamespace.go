@@ -0,0 +1,125 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package agent
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/argoproj/argo-cd/v3/util/glob"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// appNamespaceRule places the Applications of the agent's namespace on the
+// principal whose names match a glob pattern in another namespace on the
+// workload cluster.
+type appNamespaceRule struct {
+	pattern   string
+	namespace string
+}
+
+// parseAppNamespaceRule parses a rule in the form <glob>=<namespace>.
+func parseAppNamespaceRule(rule string) (appNamespaceRule, error) {
+	pattern, namespace, ok := strings.Cut(strings.TrimSpace(rule), "=")
+	if !ok || pattern == "" || namespace == "" {
+		return appNamespaceRule{}, fmt.Errorf("invalid rule %q: must be in the form <glob>=<namespace>", rule)
+	}
+	if _, err := glob.MatchWithError(pattern, ""); err != nil {
+		return appNamespaceRule{}, fmt.Errorf("invalid pattern in rule %q: %w", rule, err)
+	}
+	if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+		return appNamespaceRule{}, fmt.Errorf("invalid namespace in rule %q: %s", rule, strings.Join(errs, ", "))
+	}
+	return appNamespaceRule{pattern: pattern, namespace: namespace}, nil
+}
+
+func parseAppNamespaceRules(rules []string) ([]appNamespaceRule, error) {
+	parsed := make([]appNamespaceRule, 0, len(rules))
+	for _, r := range rules {
+		rule, err := parseAppNamespaceRule(r)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, rule)
+	}
+	return parsed, nil
+}
+
+// appNamespaceFor returns the namespace on the workload cluster for the
+// Application name of the agent's namespace on the principal. This is the
+// namespace of the first rule matching name, or the agent's namespace if no
+// rule matches.
+func (a *Agent) appNamespaceFor(name string) string {
+	for _, r := range a.appNamespaceRules {
+		if glob.Match(r.pattern, name) {
+			return r.namespace
+		}
+	}
+	return a.namespace
+}
+
+// appNamespaces returns the namespaces on the workload cluster the agent
+// places Applications in, starting with the agent's namespace.
+func (a *Agent) appNamespaces() []string {
+	namespaces := []string{a.namespace}
+	for _, r := range a.appNamespaceRules {
+		if !slices.Contains(namespaces, r.namespace) {
+			namespaces = append(namespaces, r.namespace)
+		}
+	}
+	return namespaces
+}
+
+// allowMappedSourceNamespaces adds the namespaces other than the agent's own
+// that Applications are placed in to the source namespaces of project, as
+// Argo CD only reconciles Applications outside of its own namespace if their
+// AppProject permits it.
+func (a *Agent) allowMappedSourceNamespaces(project *v1alpha1.AppProject) {
+	for _, ns := range a.appNamespaces()[1:] {
+		if !slices.Contains(project.Spec.SourceNamespaces, ns) {
+			project.Spec.SourceNamespaces = append(project.Spec.SourceNamespaces, ns)
+		}
+	}
+}
+
+// resyncAppNamespace returns the function resolving the namespace of the
+// Applications the principal refers to during resync, or nil if there are no
+// application namespace mapping rules.
+func (a *Agent) resyncAppNamespace() func(name string) string {
+	if len(a.appNamespaceRules) == 0 {
+		return nil
+	}
+	return a.appNamespaceFor
+}
+
+// qualifyRedisKey returns the key Argo CD on the workload cluster uses for the
+// Application in key, which the namespace was already stripped from. Argo CD
+// qualifies the names of Applications outside of its own namespace with their
+// namespace.
+func (a *Agent) qualifyRedisKey(key string) string {
+	if len(a.appNamespaceRules) == 0 || !strings.HasPrefix(key, "app|") {
+		return key
+	}
+	components := strings.Split(key, "|")
+	if len(components) != 4 {
+		return key
+	}
+	if ns := a.appNamespaceFor(components[2]); ns != a.namespace {
+		components[2] = ns + "_" + components[2]
+	}
+	return strings.Join(components, "|")
+}
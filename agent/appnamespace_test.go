@@ -0,0 +1,99 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/pkg/client"
+	fakekube "github.com/argoproj-labs/argocd-agent/test/fake/kube"
+	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_parseAppNamespaceRules(t *testing.T) {
+	t.Run("Valid rules", func(t *testing.T) {
+		rules, err := parseAppNamespaceRules([]string{"team-a-*=team-a", " guestbook=demo"})
+		require.NoError(t, err)
+		assert.Equal(t, []appNamespaceRule{{pattern: "team-a-*", namespace: "team-a"}, {pattern: "guestbook", namespace: "demo"}}, rules)
+	})
+	t.Run("Invalid rules", func(t *testing.T) {
+		for _, rule := range []string{
+			"team-a",
+			"=team-a",
+			"team-a-*=",
+			"team-a-*=Team_A",
+			"[=team-a",
+		} {
+			_, err := parseAppNamespaceRules([]string{rule})
+			assert.Error(t, err, rule)
+		}
+	})
+}
+
+func Test_AppNamespaceMapping(t *testing.T) {
+	a, _ := newAgentManaged(t)
+	require.NoError(t, WithAppNamespaceMapping("team-a-*=team-a", "team-*=teams", "team-a-legacy=legacy")(a))
+
+	t.Run("First matching rule applies", func(t *testing.T) {
+		assert.Equal(t, "team-a", a.appNamespaceFor("team-a-frontend"))
+		assert.Equal(t, "team-a", a.appNamespaceFor("team-a-legacy"))
+		assert.Equal(t, "teams", a.appNamespaceFor("team-b-frontend"))
+		assert.Equal(t, "argocd", a.appNamespaceFor("guestbook"))
+		assert.Equal(t, []string{"argocd", "team-a", "teams", "legacy"}, a.appNamespaces())
+	})
+
+	t.Run("Incoming applications are placed by their name", func(t *testing.T) {
+		app := &v1alpha1.Application{ObjectMeta: metav1.ObjectMeta{Name: "team-a-frontend", Namespace: "agent-managed"}}
+		assert.Equal(t, "team-a", a.getTargetNamespaceForApp(app))
+		app.Name = "guestbook"
+		assert.Equal(t, "argocd", a.getTargetNamespaceForApp(app))
+	})
+
+	t.Run("Only mapped namespaces are admitted", func(t *testing.T) {
+		fc := a.DefaultAppFilterChain()
+		assert.True(t, fc.Admit(&v1alpha1.Application{ObjectMeta: metav1.ObjectMeta{Name: "team-a-frontend", Namespace: "team-a"}}))
+		assert.True(t, fc.Admit(&v1alpha1.Application{ObjectMeta: metav1.ObjectMeta{Name: "guestbook", Namespace: "argocd"}}))
+		assert.False(t, fc.Admit(&v1alpha1.Application{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "other"}}))
+	})
+
+	t.Run("AppProjects allow the mapped namespaces", func(t *testing.T) {
+		project := &v1alpha1.AppProject{Spec: v1alpha1.AppProjectSpec{SourceNamespaces: []string{"teams"}}}
+		a.allowMappedSourceNamespaces(project)
+		assert.Equal(t, []string{"teams", "team-a", "legacy"}, project.Spec.SourceNamespaces)
+	})
+
+	t.Run("Redis keys are qualified with the mapped namespace", func(t *testing.T) {
+		assert.Equal(t, "app|managed-resources|team-a_team-a-frontend|1.8.3", a.qualifyRedisKey("app|managed-resources|team-a-frontend|1.8.3"))
+		assert.Equal(t, "app|resources-tree|guestbook|1.8.3", a.qualifyRedisKey("app|resources-tree|guestbook|1.8.3"))
+		assert.Equal(t, "git-refs|https://example.com", a.qualifyRedisKey("git-refs|https://example.com"))
+	})
+}
+
+func Test_NewAgentWithAppNamespaceMapping(t *testing.T) {
+	newAgent := func(opts ...AgentOption) error {
+		kubec := fakekube.NewKubernetesFakeClientWithApps("argocd")
+		opts = append(opts, WithRemote(&client.Remote{}), WithCacheRefreshInterval(10*time.Second), WithInformerSyncTimeout(10*time.Second), WithAppNamespaceMapping("team-a-*=team-a"))
+		_, err := NewAgent(context.TODO(), kubec, "argocd", opts...)
+		return err
+	}
+	assert.NoError(t, newAgent(WithMode("managed")))
+	assert.ErrorContains(t, newAgent(), "only supported for managed agents")
+	assert.ErrorContains(t, newAgent(WithMode("managed"), WithDestinationBasedMapping(true)), "destination-based mapping")
+}
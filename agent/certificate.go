@@ -0,0 +1,125 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package agent
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/internal/certmanager"
+	"github.com/argoproj-labs/argocd-agent/internal/tlsutil"
+	"github.com/argoproj-labs/argocd-agent/pkg/api/grpc/certificateapi"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// caCertFieldName is the field in the client certificate's TLS secret that
+// holds the certificate of the issuing CA
+const caCertFieldName = "ca.crt"
+
+// maintainClientCertificate checks the agent's client certificate every
+// interval and has it renewed by the principal once it is due for renewal.
+// It returns when the agent's context is done.
+func (a *Agent) maintainClientCertificate(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if a.IsConnected() {
+			if err := a.renewClientCertificate(a.context, time.Now()); err != nil {
+				log().WithError(err).Errorf("Could not renew client certificate in secret %s/%s", a.namespace, a.options.clientCertSecret)
+			}
+		}
+		select {
+		case <-a.context.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// renewClientCertificate requests a new client certificate from the
+// principal if the one in the agent's TLS secret is missing, invalid or due
+// for renewal at now. The new certificate and its key are written to the
+// secret, from where they are picked up for new connections.
+func (a *Agent) renewClientCertificate(ctx context.Context, now time.Time) error {
+	name := a.options.clientCertSecret
+	secrets := a.kubeClient.Clientset.CoreV1().Secrets(a.namespace)
+	secret, err := secrets.Get(ctx, name, v1.GetOptions{})
+	exists := err == nil
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("could not read secret: %w", err)
+	}
+	if exists {
+		if certs := tlsutil.X509CertsFromPEM(secret.Data[corev1.TLSCertKey]); len(certs) > 0 && !certmanager.NeedsRenewal(certs[0], now) {
+			return nil
+		}
+	}
+
+	agentName := a.remote.ClientID()
+	if agentName == "" {
+		return errors.New("agent name is not known yet")
+	}
+	key, err := tlsutil.GeneratePrivateKey(a.options.clientCertKeyOptions.WithDefaults())
+	if err != nil {
+		return fmt.Errorf("could not generate private key: %w", err)
+	}
+	keyPEM, err := tlsutil.PrivateKeyToPEM(key)
+	if err != nil {
+		return err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: agentName},
+	}, key)
+	if err != nil {
+		return fmt.Errorf("could not create certificate request: %w", err)
+	}
+
+	resp, err := certificateapi.NewCertificatesClient(a.remote.Conn()).IssueClientCertificate(ctx, &certificateapi.CertificateSigningRequest{
+		Csr: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr}),
+	})
+	if err != nil {
+		return fmt.Errorf("principal did not issue certificate: %w", err)
+	}
+	data := map[string][]byte{
+		corev1.TLSCertKey:       resp.GetCertificate(),
+		corev1.TLSPrivateKeyKey: []byte(keyPEM),
+	}
+	if len(resp.GetCaCertificate()) > 0 {
+		data[caCertFieldName] = resp.GetCaCertificate()
+	}
+	if !exists {
+		secret = &corev1.Secret{
+			ObjectMeta: v1.ObjectMeta{Name: name, Namespace: a.namespace},
+			Type:       corev1.SecretTypeTLS,
+			Data:       data,
+		}
+		_, err = secrets.Create(ctx, secret, v1.CreateOptions{})
+	} else {
+		secret.Data = data
+		_, err = secrets.Update(ctx, secret, v1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("could not write secret: %w", err)
+	}
+	log().Infof("Stored client certificate issued by the principal in secret %s/%s", a.namespace, name)
+	return nil
+}
@@ -0,0 +1,58 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/internal/tlsutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_RenewClientCertificate(t *testing.T) {
+	certPEM, keyPEM, err := tlsutil.GenerateCaCertificate("agent", 3, tlsutil.KeyGenOptions{Algorithm: "ecdsa-p256"})
+	require.NoError(t, err)
+	a, kubec := newAgent(t)
+	require.NoError(t, WithClientCertificateRenewal("agent-tls", tlsutil.KeyGenOptions{Algorithm: "ecdsa-p256"})(a))
+	secret := &corev1.Secret{
+		ObjectMeta: v1.ObjectMeta{Name: "agent-tls", Namespace: "argocd"},
+		Type:       corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       []byte(certPEM),
+			corev1.TLSPrivateKeyKey: []byte(keyPEM),
+		},
+	}
+	_, err = kubec.Clientset.CoreV1().Secrets("argocd").Create(context.TODO(), secret, v1.CreateOptions{})
+	require.NoError(t, err)
+
+	t.Run("Valid certificate is kept", func(t *testing.T) {
+		err := a.renewClientCertificate(context.TODO(), time.Now())
+		assert.NoError(t, err)
+	})
+	t.Run("Renewal requires an authenticated remote", func(t *testing.T) {
+		// The remote has not authenticated, so renewal stops before
+		// contacting the principal.
+		err := a.renewClientCertificate(context.TODO(), time.Now().Add(48*time.Hour))
+		assert.ErrorContains(t, err, "agent name is not known yet")
+		stored, err := kubec.Clientset.CoreV1().Secrets("argocd").Get(context.TODO(), "agent-tls", v1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, []byte(certPEM), stored.Data[corev1.TLSCertKey])
+	})
+}
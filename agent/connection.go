@@ -16,7 +16,9 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"time"
 
 	"github.com/argoproj-labs/argocd-agent/internal/event"
@@ -28,8 +30,10 @@ import (
 	"github.com/argoproj-labs/argocd-agent/internal/manager"
 	"github.com/argoproj-labs/argocd-agent/internal/resync"
 	"github.com/argoproj-labs/argocd-agent/pkg/api/grpc/eventstreamapi"
+	"github.com/argoproj-labs/argocd-agent/pkg/client"
 	"github.com/argoproj-labs/argocd-agent/pkg/types"
 	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/metadata"
 	"k8s.io/client-go/dynamic"
 
 	format "github.com/cloudevents/sdk-go/binding/format/protobuf/v2"
@@ -41,6 +45,12 @@ func (a *Agent) maintainConnection() error {
 		for {
 			if !a.IsConnected() {
 				err = a.remote.Connect(a.context, false)
+				if errors.Is(err, client.ErrRetryBudgetExhausted) {
+					log().Errorf("Giving up connecting to %s: %v", a.remote.Addr(), err)
+					a.stopErr = err
+					a.cancelFn()
+					return
+				}
 				if err != nil {
 					log().Warnf("Could not connect to %s: %v", a.remote.Addr(), err)
 				} else {
@@ -95,11 +105,18 @@ func (a *Agent) sender(stream eventstreamapi.EventStream_SubscribeClient) error
 	}
 	defer q.Done(ev)
 	logCtx = logCtx.WithFields(logrus.Fields{
-		"event_target": ev.DataSchema(),
-		"event_type":   ev.Type(),
-		"resource_id":  event.ResourceID(ev),
-		"event_id":     event.EventID(ev),
+		"event_target":   ev.DataSchema(),
+		"event_type":     ev.Type(),
+		"resource_id":    event.ResourceID(ev),
+		"event_id":       event.EventID(ev),
+		"correlation_id": event.CorrelationID(ev),
 	})
+	// Events that do not conform to the protocol would be rejected by the
+	// principal anyway
+	if err := event.Validate(ev); err != nil {
+		logCtx.WithError(err).Error("Discarding invalid event")
+		return nil
+	}
 	logCtx.Trace("Adding an event to the event writer")
 	a.eventWriter.Add(ev)
 	logging.LogEventSent(logCtx, ev)
@@ -129,11 +146,24 @@ func (a *Agent) receiver(stream eventstreamapi.EventStream_SubscribeClient) erro
 		logCtx.Errorf("Could not unwrap event: %v", err)
 		return nil
 	}
+	if event.TransferHandle(ev.CloudEvent()) != "" {
+		if err := a.payloadTransfer(0).Resolve(ev.CloudEvent()); err != nil {
+			logCtx.WithError(err).Error("Dropping event")
+			return nil
+		}
+	}
+	if payload := a.payloadCipher(); payload != nil {
+		if err := payload.Decrypt(ev.CloudEvent()); err != nil {
+			logCtx.WithError(err).Error("Dropping event")
+			return nil
+		}
+	}
 
 	logCtx = logCtx.WithFields(logrus.Fields{
-		"resource_id": ev.ResourceID(),
-		"event_id":    ev.EventID(),
-		"type":        ev.Type(),
+		"resource_id":    ev.ResourceID(),
+		"event_id":       ev.EventID(),
+		"correlation_id": ev.CorrelationID(),
+		"type":           ev.Type(),
 	})
 
 	logging.LogEventReceived(logCtx, ev.CloudEvent())
@@ -144,8 +174,44 @@ func (a *Agent) receiver(stream eventstreamapi.EventStream_SubscribeClient) erro
 		if err != nil {
 			return err
 		}
+		if event.IsDeltaRejection(rawEvent) {
+			logCtx.Debug("Principal could not resolve delta, resending full object")
+		} else if reason := event.RejectionReason(rawEvent); reason != "" {
+			logCtx.WithField("reason", reason).Warn("Principal rejected event")
+		}
 		a.eventWriter.Remove(rawEvent)
 		logCtx.Trace("Removed an event from the event writer")
+		a.processEventOutcome(rawEvent)
+		return nil
+	}
+
+	// Control events are not acknowledged
+	if ev.Target() == targets.Control {
+		if ev.Type() == event.GoAway {
+			logCtx.Info("Principal is shutting down, will reconnect once the stream is closed")
+		} else {
+			logCtx.Debugf("Ignoring unknown control event")
+		}
+		return nil
+	}
+
+	// Heartbeats are answered with a pong, but not acknowledged
+	if ev.Target() == targets.Heartbeat {
+		if ev.Type() == event.Ping {
+			logCtx.Trace("Received heartbeat ping, sending pong")
+			a.eventWriter.Add(a.emitter.HeartbeatEvent(event.Pong))
+		}
+		return nil
+	}
+
+	sendQ := a.queues.SendQ(defaultQueueName)
+	if sendQ == nil {
+		return fmt.Errorf("no send queue found for the default queue pair")
+	}
+
+	if err := a.deltas.Resolve(ev.CloudEvent()); err != nil {
+		logCtx.WithError(err).Debug("Requesting full object from principal")
+		sendQ.Add(a.emitter.DeltaRejectedEvent(ev.CloudEvent()))
 		return nil
 	}
 
@@ -160,11 +226,10 @@ func (a *Agent) receiver(stream eventstreamapi.EventStream_SubscribeClient) erro
 	}
 
 	// Send an ACK if the event is processed successfully.
-	sendQ := a.queues.SendQ(defaultQueueName)
-	if sendQ == nil {
-		return fmt.Errorf("no send queue found for the default queue pair")
-	}
-	sendQ.Add(a.emitter.ProcessedEvent(event.EventProcessed, ev))
+	ack := a.emitter.ProcessedEvent(event.EventProcessed, ev)
+	// Let the principal know whether its event was applied, and why not
+	event.SetOutcome(ack, err)
+	sendQ.Add(ack)
 	logCtx.Trace("Sent an ACK for an event")
 
 	return nil
@@ -173,10 +238,23 @@ func (a *Agent) receiver(stream eventstreamapi.EventStream_SubscribeClient) erro
 func (a *Agent) handleStreamEvents() error {
 	conn := a.remote.Conn()
 	client := eventstreamapi.NewEventStreamClient(conn)
-	stream, err := client.Subscribe(a.context)
+	// Tell the principal that we understand events in the CloudEvents wire
+	// format, deltas and payloads transferred out of band
+	md := []string{
+		event.WireFormatHeader, string(event.WireFormatCloudEvents),
+		event.DeltaEncodingHeader, event.ContentTypeMergePatch,
+		event.DeltaEncodingHeader, event.ContentTypeJSONPatch,
+		event.PayloadTransferHeader, event.PayloadTransferVersion,
+	}
+	payload := a.payloadCipher()
+	if payload != nil {
+		md = append(md, event.PayloadKeyIDHeader, payload.ID())
+	}
+	stream, err := client.Subscribe(metadata.AppendToOutgoingContext(a.context, md...))
 	if err != nil {
 		return err
 	}
+	stream = a.chunked(stream)
 
 	// Per-stream context: cancelled when this stream dies so all child
 	// goroutines (recv, send, heartbeat) exit and don't leak across reconnects.
@@ -191,6 +269,8 @@ func (a *Agent) handleStreamEvents() error {
 
 	if a.eventWriter == nil {
 		a.eventWriter = event.NewEventWriter("", stream, logging.GetDefaultLogger().ModuleLogger("EventWriter"))
+		a.eventWriter.SetBatchSize(a.options.batchSize)
+		a.eventWriter.SetBatchWindow(a.options.batchWindow)
 		if a.metrics != nil {
 			// set function to call when an event is discarded
 			a.eventWriter.SetOnDiscard(func(eventType, resourceType string) {
@@ -200,6 +280,12 @@ func (a *Agent) handleStreamEvents() error {
 	} else {
 		a.eventWriter.UpdateTarget(stream)
 	}
+	// Until the principal tells us otherwise, it may not understand any but
+	// the legacy wire format, nor deltas or payloads transferred out of band
+	a.eventWriter.SetWireFormat(event.WireFormatLegacy)
+	a.eventWriter.SetDeltaEncoding(false)
+	a.eventWriter.SetPayloadTransfer(nil)
+	a.eventWriter.SetPayloadCipher(payload)
 	go a.eventWriter.SendWaitingEvents(streamCtx)
 
 	logCtx := log().WithFields(logrus.Fields{
@@ -261,6 +347,8 @@ func (a *Agent) handleStreamEvents() error {
 		}
 	}()
 
+	go a.negotiateStream(streamCtx, client, stream, logCtx)
+
 	// Send heartbeat (ping) events at regular intervals to keep the stream alive.
 	// This is necessary for service meshes like Istio that timeout idle connections.
 	// Heartbeats are routed through EventWriter to ensure thread-safe stream access.
@@ -288,6 +376,10 @@ func (a *Agent) handleStreamEvents() error {
 		}()
 	}
 
+	if a.mode == types.AgentModeManaged && a.options.stateDigestInterval > 0 {
+		go a.sendStateDigests(streamCtx, logCtx)
+	}
+
 	for a.IsConnected() {
 		select {
 		case <-a.context.Done():
@@ -303,6 +395,204 @@ func (a *Agent) handleStreamEvents() error {
 	return nil
 }
 
+// payloadCipher returns the cipher the payload of events is encrypted with,
+// or nil if payload encryption is not enabled.
+func (a *Agent) payloadCipher() *event.PayloadCipher {
+	if a.remote == nil {
+		return nil
+	}
+	return a.remote.PayloadCipher()
+}
+
+// payloadTransfer returns the transfer that offloads the payloads larger than
+// threshold bytes of the events sent to the principal, and resolves the
+// payloads the principal transferred out of band.
+func (a *Agent) payloadTransfer(threshold int) *event.PayloadTransfer {
+	client := eventstreamapi.NewEventStreamClient(a.remote.Conn())
+	return event.NewPayloadTransfer(threshold, func(data []byte) (string, error) {
+		return uploadPayload(a.context, client, data)
+	}, func(handle string) ([]byte, error) {
+		return downloadPayload(a.context, client, handle)
+	})
+}
+
+// uploadPayload transfers data to the principal out of band, and returns the
+// handle the principal knows it by.
+func uploadPayload(ctx context.Context, client eventstreamapi.EventStreamClient, data []byte) (string, error) {
+	stream, err := client.UploadPayload(ctx)
+	if err != nil {
+		return "", err
+	}
+	for off := 0; off < len(data); off += event.PayloadTransferChunkSize {
+		end := min(off+event.PayloadTransferChunkSize, len(data))
+		if err := stream.Send(&eventstreamapi.PayloadChunk{Data: data[off:end]}); err != nil {
+			return "", err
+		}
+	}
+	ref, err := stream.CloseAndRecv()
+	if err != nil {
+		return "", err
+	}
+	if ref.Size != int64(len(data)) {
+		return "", fmt.Errorf("principal received %d of %d bytes", ref.Size, len(data))
+	}
+	return ref.Handle, nil
+}
+
+// downloadPayload fetches the payload with the given handle the principal
+// transferred out of band.
+func downloadPayload(ctx context.Context, client eventstreamapi.EventStreamClient, handle string) ([]byte, error) {
+	stream, err := client.DownloadPayload(ctx, &eventstreamapi.PayloadRef{Handle: handle})
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return data, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, chunk.Data...)
+	}
+}
+
+// negotiateStream applies what the principal advertises in the header of the
+// primary stream: events are sent in the wire format the principal
+// understands, and lanes get streams of their own if enabled.
+func (a *Agent) negotiateStream(ctx context.Context, client eventstreamapi.EventStreamClient, primary eventstreamapi.EventStream_SubscribeClient, logCtx *logrus.Entry) {
+	// Header blocks until the principal has accepted the primary stream
+	hdr, err := primary.Header()
+	if err != nil {
+		logCtx.WithError(err).Debug("Could not read header of event stream")
+		return
+	}
+	format := event.ParseWireFormat(hdr.Get(event.WireFormatHeader))
+	a.eventWriter.SetWireFormat(format)
+	if format == event.WireFormatCloudEvents {
+		logCtx.Debug("Sending events in the CloudEvents wire format")
+	}
+	if a.options.deltaEvents && event.ParseDeltaEncoding(hdr.Get(event.DeltaEncodingHeader)) {
+		a.eventWriter.SetDeltaEncoding(true)
+		logCtx.Debug("Sending application events as deltas")
+	}
+	if a.options.payloadTransferThreshold > 0 && event.ParsePayloadTransfer(hdr.Get(event.PayloadTransferHeader)) {
+		a.eventWriter.SetPayloadTransfer(a.payloadTransfer(a.options.payloadTransferThreshold))
+		logCtx.Debug("Transferring large payloads out of band")
+	}
+	if a.options.prioritizedStreams {
+		a.openLaneStreams(ctx, client, hdr, logCtx)
+	}
+}
+
+// openLaneStreams opens a stream of its own for each lane of events the
+// principal advertises in hdr, the header of the primary stream. Lanes that
+// cannot be opened keep using the primary stream.
+func (a *Agent) openLaneStreams(ctx context.Context, client eventstreamapi.EventStreamClient, hdr metadata.MD, logCtx *logrus.Entry) {
+	names := hdr.Get(event.LanesHeader)
+	if len(names) == 0 {
+		logCtx.Info("Principal does not support prioritized streams, using a single stream")
+		return
+	}
+	for _, name := range names {
+		lane, err := event.ParseLane(name)
+		if err != nil {
+			logCtx.Debugf("Ignoring unknown lane %s", name)
+			continue
+		}
+		stream, err := client.Subscribe(metadata.AppendToOutgoingContext(ctx, event.LaneHeader, string(lane)))
+		if err != nil {
+			logCtx.WithError(err).Warnf("Could not open stream for lane %s", lane)
+			continue
+		}
+		go a.handleLaneStream(ctx, lane, a.chunked(stream), logCtx.WithField("lane", lane))
+	}
+}
+
+// handleLaneStream sends the events of lane on stream, and processes the
+// events received on it, until the stream is closed. The lane's events are
+// then sent on the primary stream again.
+func (a *Agent) handleLaneStream(ctx context.Context, lane event.Lane, stream eventstreamapi.EventStream_SubscribeClient, logCtx *logrus.Entry) {
+	laneCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	a.eventWriter.SetLaneTarget(lane, stream)
+	defer a.eventWriter.RemoveLaneTarget(lane, stream)
+	go a.eventWriter.SendWaitingLaneEvents(laneCtx, lane)
+
+	logCtx.Info("Starting to exchange events on lane stream")
+	for a.IsConnected() {
+		err := a.receiver(stream)
+		// The receiver only reports errors that require a reconnect, but
+		// any error ends a lane stream.
+		if err == nil && stream.Context().Err() == nil {
+			if a.metrics != nil {
+				a.metrics.EventReceived.Inc()
+			}
+			continue
+		}
+		logCtx.Infof("Lane stream closed: %v", err)
+		return
+	}
+}
+
+// chunkedSubscribeClient sends and receives events in chunks
+type chunkedSubscribeClient struct {
+	eventstreamapi.EventStream_SubscribeClient
+	chunked *event.ChunkedStream
+}
+
+func (c *chunkedSubscribeClient) Send(ev *eventstreamapi.Event) error {
+	return c.chunked.Send(ev)
+}
+
+func (c *chunkedSubscribeClient) Recv() (*eventstreamapi.Event, error) {
+	return c.chunked.Recv()
+}
+
+// chunked returns stream sending events larger than the configured chunk
+// size in chunks. Chunks received from the principal are reassembled even if
+// the agent does not send chunks itself.
+func (a *Agent) chunked(stream eventstreamapi.EventStream_SubscribeClient) eventstreamapi.EventStream_SubscribeClient {
+	return &chunkedSubscribeClient{
+		EventStream_SubscribeClient: stream,
+		chunked:                     event.NewChunkedStream(stream, a.options.chunkSize, log().WithField(logfields.Module, "StreamEvent")),
+	}
+}
+
+// sendStateDigests sends a digest of the agent's resources to the principal at
+// the configured interval until ctx is done, so that the principal can resend
+// the resources that drifted while the agent was connected.
+func (a *Agent) sendStateDigests(ctx context.Context, logCtx *logrus.Entry) {
+	logCtx = logCtx.WithField("direction", "digest")
+	dynClient, err := dynamic.NewForConfig(a.kubeClient.RestConfig)
+	if err != nil {
+		logCtx.WithError(err).Error("Not sending state digests")
+		return
+	}
+	resyncHandler := resync.NewRequestHandler(dynClient, a.queues.SendQ(defaultQueueName), a.emitter, a.resources, logCtx, manager.ManagerRoleAgent, a.namespace).
+		WithDestinationBasedMapping(a.destinationBasedMapping).
+		WithApplicationNamespaces(a.resyncAppNamespace()).
+		WithIgnoreUnmanagedApps(a.ignoreUnmanagedApps).
+		WithPeerNamespace(a.principalNS())
+
+	logCtx.Infof("Sending state digests with interval %v", a.options.stateDigestInterval)
+	ticker := time.NewTicker(a.options.stateDigestInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := resyncHandler.SendStateDigest(ctx); err != nil {
+				logCtx.WithError(err).Error("Failed to send state digest")
+			}
+		}
+	}
+}
+
 func (a *Agent) resyncOnStart(logCtx *logrus.Entry) error {
 	if a.resyncedOnStart {
 		return nil
@@ -335,6 +625,7 @@ func (a *Agent) resyncOnStart(logCtx *logrus.Entry) error {
 
 		resyncHandler := resync.NewRequestHandler(dynClient, sendQ, a.emitter, a.resources, logCtx, manager.ManagerRoleAgent, a.namespace).
 			WithDestinationBasedMapping(a.destinationBasedMapping).
+			WithApplicationNamespaces(a.resyncAppNamespace()).
 			WithIgnoreUnmanagedApps(a.ignoreUnmanagedApps).
 			WithPeerNamespace(a.principalNS())
 		go resyncHandler.SendRequestUpdates(a.context)
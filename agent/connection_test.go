@@ -15,11 +15,17 @@
 package agent
 
 import (
+	"bytes"
+	"context"
+	"io"
 	"testing"
 
 	"github.com/argoproj-labs/argocd-agent/internal/event"
+	"github.com/argoproj-labs/argocd-agent/pkg/api/grpc/eventstreamapi"
 	"github.com/argoproj-labs/argocd-agent/pkg/types"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
 	"k8s.io/client-go/rest"
 )
 
@@ -70,3 +76,64 @@ func TestResyncOnStart(t *testing.T) {
 		assert.True(t, a.resyncedOnStart)
 	})
 }
+
+// fakeTransferClient keeps the payloads uploaded to it, and serves them for
+// download
+type fakeTransferClient struct {
+	eventstreamapi.EventStreamClient
+	payloads map[string][]byte
+}
+
+type fakeUploadClient struct {
+	grpc.ClientStream
+	client *fakeTransferClient
+	data   []byte
+}
+
+func (c *fakeUploadClient) Send(chunk *eventstreamapi.PayloadChunk) error {
+	c.data = append(c.data, chunk.Data...)
+	return nil
+}
+
+func (c *fakeUploadClient) CloseAndRecv() (*eventstreamapi.PayloadRef, error) {
+	c.client.payloads["handle"] = c.data
+	return &eventstreamapi.PayloadRef{Handle: "handle", Size: int64(len(c.data))}, nil
+}
+
+type fakeDownloadClient struct {
+	grpc.ClientStream
+	chunks [][]byte
+}
+
+func (c *fakeDownloadClient) Recv() (*eventstreamapi.PayloadChunk, error) {
+	if len(c.chunks) == 0 {
+		return nil, io.EOF
+	}
+	chunk := c.chunks[0]
+	c.chunks = c.chunks[1:]
+	return &eventstreamapi.PayloadChunk{Data: chunk}, nil
+}
+
+func (c *fakeTransferClient) UploadPayload(ctx context.Context, opts ...grpc.CallOption) (eventstreamapi.EventStream_UploadPayloadClient, error) {
+	return &fakeUploadClient{client: c}, nil
+}
+
+func (c *fakeTransferClient) DownloadPayload(ctx context.Context, in *eventstreamapi.PayloadRef, opts ...grpc.CallOption) (eventstreamapi.EventStream_DownloadPayloadClient, error) {
+	data := c.payloads[in.Handle]
+	half := len(data) / 2
+	return &fakeDownloadClient{chunks: [][]byte{data[:half], data[half:]}}, nil
+}
+
+func TestPayloadTransfer(t *testing.T) {
+	client := &fakeTransferClient{payloads: map[string][]byte{}}
+	payload := bytes.Repeat([]byte("x"), 2*event.PayloadTransferChunkSize+1)
+
+	handle, err := uploadPayload(context.TODO(), client, payload)
+	require.NoError(t, err)
+	assert.Equal(t, "handle", handle)
+	assert.Equal(t, payload, client.payloads[handle])
+
+	data, err := downloadPayload(context.TODO(), client, handle)
+	require.NoError(t, err)
+	assert.Equal(t, payload, data)
+}
@@ -0,0 +1,60 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package agent
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/argoproj-labs/argocd-agent/internal/event"
+	"github.com/argoproj-labs/argocd-agent/internal/event/targets"
+	"github.com/argoproj-labs/argocd-agent/internal/tracing"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+// CustomEventHandler processes a custom event received from the principal.
+// The event is acknowledged to the principal once the handler returns, and
+// is rejected if the handler returns an error.
+type CustomEventHandler func(ctx context.Context, ev *cloudevents.Event) error
+
+// SendCustomEvent queues a custom event of type eventType for target, which
+// carries the JSON encoding of data, to be sent to the principal. The target
+// must be registered with WithCustomEvents, and the agent must be started.
+func (a *Agent) SendCustomEvent(ctx context.Context, target, eventType string, data any) error {
+	if a.emitter == nil {
+		return fmt.Errorf("agent is not started")
+	}
+	ev, err := a.emitter.CustomEvent(targets.EventTarget(target), eventType, data)
+	if err != nil {
+		return err
+	}
+	q := a.queues.SendQ(defaultQueueName)
+	if q == nil {
+		return fmt.Errorf("no send queue found for the default queue pair")
+	}
+	tracing.InjectTraceContext(ctx, ev)
+	q.Add(ev)
+	return nil
+}
+
+// processIncomingCustomEvent passes a custom event received from the
+// principal to the handler registered for its target
+func (a *Agent) processIncomingCustomEvent(ctx context.Context, ev *event.Event) error {
+	handler, ok := a.options.customEventHandlers[ev.Target()]
+	if !ok {
+		return fmt.Errorf("no handler for custom event target %s", ev.Target())
+	}
+	return handler(ctx, ev.CloudEvent())
+}
@@ -0,0 +1,72 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/argoproj-labs/argocd-agent/internal/event"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_CustomEvents(t *testing.T) {
+	a, _ := newAgent(t)
+	require.Error(t, a.SendCustomEvent(context.TODO(), "config.example.com", "push", nil))
+	a.emitter = event.NewEventSource("test")
+
+	var received []*cloudevents.Event
+	require.NoError(t, WithCustomEvents("config.example.com", func(ctx context.Context, ev *cloudevents.Event) error {
+		received = append(received, ev)
+		if ev.Type() == "fail" {
+			return errors.New("cannot apply config")
+		}
+		return nil
+	})(a))
+	require.NoError(t, WithCustomEvents("telemetry.example.com", nil)(a))
+	assert.Error(t, WithCustomEvents("telemetry", nil)(a))
+
+	t.Run("Custom events are queued for the principal", func(t *testing.T) {
+		require.NoError(t, a.SendCustomEvent(context.TODO(), "telemetry.example.com", "sample", map[string]int{"cpu": 4}))
+		assert.Error(t, a.SendCustomEvent(context.TODO(), "unknown.example.com", "sample", nil))
+		sendQ := a.queues.SendQ(defaultQueueName)
+		require.Equal(t, 1, sendQ.Len())
+		ev, _ := sendQ.Get()
+		assert.Equal(t, "telemetry.example.com", ev.DataSchema())
+		assert.Equal(t, "sample", ev.Type())
+	})
+
+	t.Run("Custom events are passed to their handler", func(t *testing.T) {
+		es := event.NewEventSource("principal")
+		ev, err := es.CustomEvent("config.example.com", "push", map[string]string{"level": "debug"})
+		require.NoError(t, err)
+		require.NoError(t, a.processIncomingEvent(event.New(ev, event.Target(ev))))
+		require.Len(t, received, 1)
+		assert.Equal(t, event.EventID(ev), event.EventID(received[0]))
+
+		ev, err = es.CustomEvent("config.example.com", "fail", nil)
+		require.NoError(t, err)
+		assert.Error(t, a.processIncomingEvent(event.New(ev, event.Target(ev))))
+
+		// Events without a handler are rejected
+		ev, err = es.CustomEvent("telemetry.example.com", "sample", nil)
+		require.NoError(t, err)
+		assert.Error(t, a.processIncomingEvent(event.New(ev, event.Target(ev))))
+		assert.Len(t, received, 2)
+	})
+}
@@ -15,13 +15,84 @@
 package agent
 
 import (
+	"fmt"
+	"slices"
+	"strings"
+
 	"github.com/argoproj-labs/argocd-agent/internal/config"
 	"github.com/argoproj-labs/argocd-agent/internal/filter"
 	"github.com/argoproj-labs/argocd-agent/internal/manager"
+	"github.com/argoproj-labs/argocd-agent/pkg/types"
 	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
 	"github.com/argoproj/argo-cd/v3/util/glob"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
+// appReportRule matches the Applications an autonomous agent includes in or
+// excludes from reporting to the principal.
+type appReportRule struct {
+	// name and project are glob patterns, empty if not part of the rule
+	name     string
+	project  string
+	selector labels.Selector
+}
+
+// parseAppReportRule parses a rule in the form name=<glob>, project=<glob>
+// or label=<selector>.
+func parseAppReportRule(rule string) (appReportRule, error) {
+	kind, value, ok := strings.Cut(rule, "=")
+	if !ok || value == "" {
+		return appReportRule{}, fmt.Errorf("invalid rule %q: must be in the form name=<glob>, project=<glob> or label=<selector>", rule)
+	}
+	switch kind {
+	case "name":
+		return appReportRule{name: value}, nil
+	case "project":
+		return appReportRule{project: value}, nil
+	case "label":
+		sel, err := labels.Parse(value)
+		if err != nil {
+			return appReportRule{}, fmt.Errorf("invalid label selector in rule %q: %w", rule, err)
+		}
+		return appReportRule{selector: sel}, nil
+	default:
+		return appReportRule{}, fmt.Errorf("invalid rule %q: unknown kind %q", rule, kind)
+	}
+}
+
+func parseAppReportRules(rules []string) ([]appReportRule, error) {
+	parsed := make([]appReportRule, 0, len(rules))
+	for _, r := range rules {
+		rule, err := parseAppReportRule(r)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, rule)
+	}
+	return parsed, nil
+}
+
+func (r appReportRule) matches(app *v1alpha1.Application) bool {
+	switch {
+	case r.name != "":
+		return glob.Match(r.name, app.Name)
+	case r.project != "":
+		return glob.Match(r.project, app.Spec.Project)
+	case r.selector != nil:
+		return r.selector.Matches(labels.Set(app.Labels))
+	}
+	return false
+}
+
+func matchesAnyAppReportRule(rules []appReportRule, app *v1alpha1.Application) bool {
+	for _, r := range rules {
+		if r.matches(app) {
+			return true
+		}
+	}
+	return false
+}
+
 // DefaultAppFilterChain returns a FilterChain for Application resources.
 // This chain contains a set of default filters that the agent will
 // evaluate for every change.
@@ -30,7 +101,7 @@ func (a *Agent) DefaultAppFilterChain() *filter.Chain[*v1alpha1.Application] {
 
 	// Admit based on namespace of the application
 	fc.AppendAdmitFilter(func(app *v1alpha1.Application) bool {
-		if !glob.MatchStringInList(append([]string{a.namespace}, a.allowedNamespaces...), app.Namespace, glob.REGEXP) {
+		if !slices.Contains(a.appNamespaces(), app.Namespace) && !glob.MatchStringInList(a.allowedNamespaces, app.Namespace, glob.REGEXP) {
 			log().Warnf("namespace not allowed: %s", app.QualifiedName())
 			return false
 		}
@@ -60,6 +131,18 @@ func (a *Agent) DefaultAppFilterChain() *filter.Chain[*v1alpha1.Application] {
 		})
 	}
 
+	// In autonomous mode, only report the applications matching any of the
+	// include rules, if there are any, and none of the exclude rules. The
+	// principal gets a deletion for applications that stop matching.
+	if a.mode == types.AgentModeAutonomous && (len(a.reportInclude) > 0 || len(a.reportExclude) > 0) {
+		fc.AppendAdmitFilter(func(app *v1alpha1.Application) bool {
+			if len(a.reportInclude) > 0 && !matchesAnyAppReportRule(a.reportInclude, app) {
+				return false
+			}
+			return !matchesAnyAppReportRule(a.reportExclude, app)
+		})
+	}
+
 	return fc
 }
 
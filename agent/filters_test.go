@@ -321,6 +321,51 @@ func TestDefaultAppFilterChain_IgnoreUnmanagedApps(t *testing.T) {
 	})
 }
 
+func TestDefaultAppFilterChain_ReportRules(t *testing.T) {
+	newAgent := func(t *testing.T, mode string, opts ...AgentOption) *Agent {
+		t.Helper()
+		kubec := fakekube.NewKubernetesFakeClientWithApps("argocd")
+		remote, err := client.NewRemote("127.0.0.1", 8080)
+		require.NoError(t, err)
+		opts = append([]AgentOption{WithRemote(remote), WithMode(mode), WithCacheRefreshInterval(10 * time.Second), WithInformerSyncTimeout(10 * time.Second)}, opts...)
+		agent, err := NewAgent(context.TODO(), kubec, "argocd", opts...)
+		require.NoError(t, err)
+		return agent
+	}
+	app := func(name, project string, lbls map[string]string) *v1alpha1.Application {
+		return &v1alpha1.Application{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "argocd", Labels: lbls},
+			Spec:       v1alpha1.ApplicationSpec{Project: project},
+		}
+	}
+
+	t.Run("Invalid rules are rejected", func(t *testing.T) {
+		for _, rule := range []string{"name", "name=", "owner=me", "label=team in ("} {
+			_, err := parseAppReportRule(rule)
+			assert.Error(t, err, rule)
+		}
+	})
+
+	t.Run("Excluded applications are not admitted", func(t *testing.T) {
+		fc := newAgent(t, "autonomous", WithReportExcludeRules("name=internal-*", "label=team in (infra,platform)")).DefaultAppFilterChain()
+		assert.False(t, fc.Admit(app("internal-app", "default", nil)))
+		assert.False(t, fc.Admit(app("app", "default", map[string]string{"team": "infra"})))
+		assert.True(t, fc.Admit(app("app", "default", map[string]string{"team": "web"})))
+	})
+
+	t.Run("Only included applications are admitted", func(t *testing.T) {
+		fc := newAgent(t, "autonomous", WithReportIncludeRules("project=prod-*"), WithReportExcludeRules("name=tmp-*")).DefaultAppFilterChain()
+		assert.True(t, fc.Admit(app("app", "prod-eu", nil)))
+		assert.False(t, fc.Admit(app("tmp-app", "prod-eu", nil)))
+		assert.False(t, fc.Admit(app("app", "default", nil)))
+	})
+
+	t.Run("Rules are ignored in managed mode", func(t *testing.T) {
+		fc := newAgent(t, "managed", WithReportExcludeRules("name=*")).DefaultAppFilterChain()
+		assert.True(t, fc.Admit(app("app", "default", nil)))
+	})
+}
+
 func init() {
 	logrus.SetLevel(logrus.TraceLevel)
 }
@@ -0,0 +1,51 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package agent
+
+import (
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// newHealthServer returns a health server that reports the agent as not
+// serving until it is connected to the principal.
+func newHealthServer() *health.Server {
+	srv := health.NewServer()
+	srv.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	return srv
+}
+
+// updateServingStatus reports the agent as serving through the gRPC health
+// checking protocol for as long as it is connected to the principal, just
+// like the healthz endpoint does.
+func (a *Agent) updateServingStatus() {
+	if a.healthSrv == nil {
+		return
+	}
+	if a.IsConnected() {
+		a.healthSrv.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	} else {
+		a.healthSrv.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	}
+}
+
+// healthGRPCServer returns a gRPC server that serves nothing but the health
+// checking protocol, to be served next to the metrics endpoint.
+func (a *Agent) healthGRPCServer() *grpc.Server {
+	srv := grpc.NewServer()
+	healthpb.RegisterHealthServer(srv, a.healthSrv)
+	return srv
+}
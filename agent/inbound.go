@@ -15,19 +15,24 @@
 package agent
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/argoproj-labs/argocd-agent/internal/argocd/settings"
 	"github.com/argoproj-labs/argocd-agent/internal/auth"
 	"github.com/argoproj-labs/argocd-agent/internal/backend"
 	"github.com/argoproj-labs/argocd-agent/internal/checkpoint"
 	"github.com/argoproj-labs/argocd-agent/internal/event"
 	"github.com/argoproj-labs/argocd-agent/internal/event/targets"
+	"github.com/argoproj-labs/argocd-agent/internal/kube"
 	"github.com/argoproj-labs/argocd-agent/internal/logging"
 	"github.com/argoproj-labs/argocd-agent/internal/logging/logfields"
 	"github.com/argoproj-labs/argocd-agent/internal/manager"
 	"github.com/argoproj-labs/argocd-agent/internal/manager/application"
+	"github.com/argoproj-labs/argocd-agent/internal/manager/repository"
 	"github.com/argoproj-labs/argocd-agent/internal/metrics"
 	"github.com/argoproj-labs/argocd-agent/internal/resync"
 	"github.com/argoproj-labs/argocd-agent/internal/tracing"
@@ -41,6 +46,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	ktypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/util/retry"
 )
 
 /*
@@ -75,10 +81,35 @@ func (a *Agent) processIncomingEvent(ev *event.Event) error {
 
 	if a.metrics != nil {
 		if sentAt := event.SentAt(ev.CloudEvent()); sentAt != nil {
-			a.metrics.PropagationLatency.WithLabelValues(ev.Target().String()).Observe(time.Since(*sentAt).Seconds())
+			metrics.ObserveWithCorrelationID(a.metrics.PropagationLatency.WithLabelValues(ev.Target().String()), time.Since(*sentAt).Seconds(), ev.CorrelationID())
 		}
 	}
 
+	// An event that does not conform to the protocol is rejected before it
+	// can reach any of the managers.
+	if err := event.Validate(ev.CloudEvent()); err != nil {
+		a.logGrpcEvent().WithError(err).Warn("Rejecting invalid event")
+		return err
+	}
+
+	// An event that was redelivered because its ACK got lost must not be
+	// applied twice, but it is acknowledged again.
+	if a.sequences.Duplicate(ev.CloudEvent()) {
+		if a.metrics != nil {
+			a.metrics.EventsDuplicate.WithLabelValues(ev.Target().String()).Inc()
+		}
+		return event.NewEventDiscardedErr("event %s was already applied", ev.EventID())
+	}
+
+	// An event must not undo a later change to the same resource, e.g. after
+	// it was redelivered.
+	if a.sequences.Stale(ev.CloudEvent()) {
+		if a.metrics != nil {
+			a.metrics.EventsOutOfOrder.WithLabelValues(ev.Target().String()).Inc()
+		}
+		return event.NewEventDiscardedErr("a later event for resource %s was already applied", ev.ResourceID())
+	}
+
 	status := metrics.EventProcessingSuccess
 
 	// Start checkpoint step
@@ -94,6 +125,10 @@ func (a *Agent) processIncomingEvent(ev *event.Event) error {
 		err = a.processIncomingRepository(ev)
 	case targets.GPGKey:
 		err = a.processIncomingGPGKey(ev)
+	case targets.ArgoCDConfig:
+		err = a.processIncomingArgoCDConfig(ev)
+	case targets.ArgoCDSecret:
+		err = a.processIncomingArgoCDSecret(ev)
 	case targets.Resource:
 		err = a.processIncomingResourceRequest(ev)
 	case targets.ResourceResync:
@@ -121,11 +156,26 @@ func (a *Agent) processIncomingEvent(ev *event.Event) error {
 			}
 		}()
 	default:
-		err = fmt.Errorf("unknown event target - processIncomingEvent: %s", ev.Target())
+		if event.IsCustomTarget(ev.Target()) {
+			err = a.processIncomingCustomEvent(ctx, ev)
+		} else {
+			err = fmt.Errorf("unknown event target - processIncomingEvent: %s", ev.Target())
+		}
 	}
 
 	cp.End()
 
+	// Events that failed with a retryable error will be sent again, and have
+	// not been applied yet.
+	if err == nil || !kube.IsRetryableError(err) {
+		if a.sequences.Applied(ev.CloudEvent()) {
+			a.logGrpcEvent().WithField("resource_id", ev.ResourceID()).Warn("Earlier events for resource were lost")
+			if a.metrics != nil {
+				a.metrics.EventSequenceGaps.WithLabelValues(ev.Target().String()).Inc()
+			}
+		}
+	}
+
 	if err != nil {
 		tracing.RecordError(span, err)
 	} else {
@@ -144,22 +194,26 @@ func (a *Agent) processIncomingEvent(ev *event.Event) error {
 		}
 
 		// store time taken by agent to process event in metrics
-		a.metrics.EventProcessingTime.WithLabelValues(string(status), string(a.mode), ev.Target().String()).Observe(cp.Duration().Seconds())
+		metrics.ObserveWithCorrelationID(a.metrics.EventProcessingTime.WithLabelValues(string(status), string(a.mode), ev.Target().String()), cp.Duration().Seconds(), ev.CorrelationID())
 	}
 
 	return err
 }
 
 func (a *Agent) processIncomingApplication(ev *event.Event) error {
+	// Changes made because of the event are logged with its correlation ID
+	ctx := event.ContextWithCorrelationID(a.context, ev.CorrelationID())
 	logCtx := a.logGrpcEvent().WithFields(logrus.Fields{
-		"method":      "processIncomingApplication",
-		"event_id":    ev.EventID(),
-		"resource_id": ev.ResourceID(),
+		"method":         "processIncomingApplication",
+		"event_id":       ev.EventID(),
+		"correlation_id": ev.CorrelationID(),
+		"resource_id":    ev.ResourceID(),
 	})
 	incomingApp, err := ev.Application()
 	if err != nil {
 		return err
 	}
+	principalNamespace := incomingApp.Namespace
 
 	// Determine the target namespace for the application.
 	// When destination-based mapping is enabled and the agent is in a different
@@ -184,7 +238,7 @@ func (a *Agent) processIncomingApplication(ev *event.Event) error {
 			incomingApp.Annotations[manager.PrincipalUIDAnnotation] = principalUID
 		}
 
-		identity, err = a.appManager.CompareIdentity(a.context, incomingApp, principalUID)
+		identity, err = a.appManager.CompareIdentity(ctx, incomingApp, principalUID)
 		if err != nil {
 			return fmt.Errorf("failed to compare identity of app: %w", err)
 		}
@@ -201,18 +255,18 @@ func (a *Agent) processIncomingApplication(ev *event.Event) error {
 	switch ev.Type() {
 	case event.Create:
 		if a.mode == types.AgentModeManaged {
-			err = a.syncManagedApplication(logCtx, incomingApp, identity, principalUID)
+			err = a.syncManagedApplication(ctx, logCtx, incomingApp, identity, principalUID)
 		} else {
-			_, err = a.createApplication(incomingApp, principalUID)
+			_, err = a.createApplication(ctx, incomingApp, principalUID)
 			if err != nil {
 				logging.LogActionError(logCtx, "application", "create", incomingApp, err)
 			}
 		}
 	case event.SpecUpdate:
 		if a.mode == types.AgentModeManaged {
-			err = a.syncManagedApplication(logCtx, incomingApp, identity, principalUID)
+			err = a.syncManagedApplication(ctx, logCtx, incomingApp, identity, principalUID)
 		} else {
-			_, err = a.updateApplication(incomingApp)
+			_, err = a.updateApplication(ctx, incomingApp)
 			if err != nil {
 				logging.LogActionError(logCtx, "application", "update", incomingApp, err)
 			}
@@ -228,18 +282,18 @@ func (a *Agent) processIncomingApplication(ev *event.Event) error {
 			}
 		}
 
-		_, err = a.appManager.SetOperation(a.context, incomingApp)
+		_, err = a.appManager.SetOperation(ctx, incomingApp)
 		if err != nil {
 			logging.LogActionError(logCtx, "application", "set-operation", incomingApp, err)
 		}
 	case event.TerminateOperation:
 		logCtx.Trace("Received a TerminateOperation event")
-		_, err = a.appManager.TerminateOperation(a.context, incomingApp)
+		_, err = a.appManager.TerminateOperation(ctx, incomingApp)
 		if err != nil {
 			logging.LogActionError(logCtx, "application", "terminate-operation", incomingApp, err)
 		}
 	case event.Delete:
-		err = a.deleteApplication(incomingApp)
+		err = a.deleteApplication(ctx, incomingApp)
 		if err != nil {
 			logging.LogActionError(logCtx, "application", "delete", incomingApp, err)
 		}
@@ -247,6 +301,13 @@ func (a *Agent) processIncomingApplication(ev *event.Event) error {
 		logCtx.Warnf("Received an unknown event: %s. Protocol mismatch?", ev.Type())
 	}
 
+	if err == nil && a.mode == types.AgentModeManaged {
+		switch ev.Type() {
+		case event.Create, event.SpecUpdate, event.Delete:
+			a.watermarks.observe(principalNamespace, incomingApp.ResourceVersion)
+		}
+	}
+
 	return err
 }
 
@@ -267,10 +328,10 @@ func sourceUIDForApp(app *v1alpha1.Application) ktypes.UID {
 	return app.UID
 }
 
-func (a *Agent) updateManagedApplicationIdentity(incomingApp *v1alpha1.Application, principalUID string) error {
+func (a *Agent) updateManagedApplicationIdentity(ctx context.Context, incomingApp *v1alpha1.Application, principalUID string) error {
 	resolvedSourceUID := sourceUIDForApp(incomingApp)
 	a.rewriteDestinationForManagedAgent(incomingApp)
-	_, err := a.appManager.UpdateManagedApp(a.context, incomingApp, application.ManagedIdentity{
+	_, err := a.appManager.UpdateManagedApp(ctx, incomingApp, application.ManagedIdentity{
 		SourceUID:    string(resolvedSourceUID),
 		PrincipalUID: principalUID,
 	})
@@ -281,10 +342,10 @@ func (a *Agent) updateManagedApplicationIdentity(incomingApp *v1alpha1.Applicati
 	return nil
 }
 
-func (a *Agent) syncManagedApplication(logCtx *logrus.Entry, incomingApp *v1alpha1.Application, identity *application.IdentityCompareResult, principalUID string) error {
+func (a *Agent) syncManagedApplication(ctx context.Context, logCtx *logrus.Entry, incomingApp *v1alpha1.Application, identity *application.IdentityCompareResult, principalUID string) error {
 	if identity == nil || !identity.Exists {
 		logCtx.Debug("Application does not exist locally. Creating")
-		if _, err := a.createApplication(incomingApp, principalUID); err != nil {
+		if _, err := a.createApplication(ctx, incomingApp, principalUID); err != nil {
 			return fmt.Errorf("could not create incoming app: %w", err)
 		}
 		return nil
@@ -294,20 +355,20 @@ func (a *Agent) syncManagedApplication(logCtx *logrus.Entry, incomingApp *v1alph
 	switch action {
 	case identityActionUpdate:
 		logCtx.Debug("Application identity matches. Updating")
-		_, err := a.updateApplication(incomingApp)
+		_, err := a.updateApplication(ctx, incomingApp)
 		if err != nil {
 			return fmt.Errorf("could not update existing app: %w", err)
 		}
 		return nil
 	case identityActionTransition:
 		logCtx.Info("Principal transition detected. Transitioning in-place")
-		if err := a.updateManagedApplicationIdentity(incomingApp, principalUID); err != nil {
+		if err := a.updateManagedApplicationIdentity(ctx, incomingApp, principalUID); err != nil {
 			return fmt.Errorf("could not transition app: %w", err)
 		}
 		return nil
 	case identityActionUpdateStampUID:
 		logCtx.Info("Source-uid missing (AppSet wipe). Updating + stamping")
-		if err := a.updateManagedApplicationIdentity(incomingApp, principalUID); err != nil {
+		if err := a.updateManagedApplicationIdentity(ctx, incomingApp, principalUID); err != nil {
 			return fmt.Errorf("could not update app after source-uid wipe: %w", err)
 		}
 		return nil
@@ -315,17 +376,17 @@ func (a *Agent) syncManagedApplication(logCtx *logrus.Entry, incomingApp *v1alph
 		switch a.effectiveMismatchPolicy(incomingApp) {
 		case manager.MismatchPolicyUpsert:
 			logCtx.Info("Source UID mismatch, upsert policy: updating in-place")
-			if err := a.updateManagedApplicationIdentity(incomingApp, principalUID); err != nil {
+			if err := a.updateManagedApplicationIdentity(ctx, incomingApp, principalUID); err != nil {
 				return fmt.Errorf("could not upsert app on source-uid mismatch: %w", err)
 			}
 			return nil
 		default:
 			logCtx.Debug("Source UID mismatch. Deleting existing app")
-			if err := a.deleteApplication(incomingApp); err != nil {
+			if err := a.deleteApplication(ctx, incomingApp); err != nil {
 				return fmt.Errorf("could not delete existing app: %w", err)
 			}
 			logCtx.Debug("Creating incoming app after deleting existing app")
-			if _, err := a.createApplication(incomingApp, principalUID); err != nil {
+			if _, err := a.createApplication(ctx, incomingApp, principalUID); err != nil {
 				return fmt.Errorf("could not create incoming app: %w", err)
 			}
 			return nil
@@ -335,7 +396,7 @@ func (a *Agent) syncManagedApplication(logCtx *logrus.Entry, incomingApp *v1alph
 		switch a.effectiveAdoptionPolicy(incomingApp) {
 		case manager.AdoptionPolicyAlways:
 			logCtx.WithField(logfields.Application, incomingApp.GetName()).Info("Adopting existing application")
-			if err := a.updateManagedApplicationIdentity(incomingApp, principalUID); err != nil {
+			if err := a.updateManagedApplicationIdentity(ctx, incomingApp, principalUID); err != nil {
 				return fmt.Errorf("could not adopt app: %w", err)
 			}
 		case manager.AdoptionPolicyNever:
@@ -428,9 +489,10 @@ func identityAction(r *application.IdentityCompareResult) identityActionType {
 
 func (a *Agent) processIncomingAppProject(ev *event.Event) error {
 	logCtx := a.logGrpcEvent().WithFields(logrus.Fields{
-		"method":      "processIncomingAppProject",
-		"event_id":    ev.EventID(),
-		"resource_id": ev.ResourceID(),
+		"method":         "processIncomingAppProject",
+		"event_id":       ev.EventID(),
+		"correlation_id": ev.CorrelationID(),
+		"resource_id":    ev.ResourceID(),
 	})
 	incomingAppProject, err := ev.AppProject()
 	if err != nil {
@@ -527,9 +589,10 @@ func (a *Agent) processIncomingAppProject(ev *event.Event) error {
 
 func (a *Agent) processIncomingRepository(ev *event.Event) error {
 	logCtx := a.logGrpcEvent().WithFields(logrus.Fields{
-		"method":      "processIncomingRepository",
-		"event_id":    ev.EventID(),
-		"resource_id": ev.ResourceID(),
+		"method":         "processIncomingRepository",
+		"event_id":       ev.EventID(),
+		"correlation_id": ev.CorrelationID(),
+		"resource_id":    ev.ResourceID(),
 	})
 
 	incomingRepo, err := ev.Repository()
@@ -537,6 +600,15 @@ func (a *Agent) processIncomingRepository(ev *event.Event) error {
 		return err
 	}
 
+	if len(repository.EncryptedFields(incomingRepo)) > 0 {
+		if a.options.repoCipher == nil {
+			return fmt.Errorf("repository %s is encrypted, but no repository encryption key is configured", incomingRepo.Name)
+		}
+		if err := a.options.repoCipher.Decrypt(incomingRepo); err != nil {
+			return err
+		}
+	}
+
 	// Repository secrets must exist in the same namespace as the agent
 	incomingRepo.SetNamespace(a.namespace)
 
@@ -649,6 +721,7 @@ func (a *Agent) processIncomingResourceResyncEvent(ev *event.Event) error {
 
 	resyncHandler := resync.NewRequestHandler(dynClient, sendQ, a.emitter, a.resources, logCtx, manager.ManagerRoleAgent, a.namespace).
 		WithDestinationBasedMapping(a.destinationBasedMapping).
+		WithApplicationNamespaces(a.resyncAppNamespace()).
 		WithIgnoreUnmanagedApps(a.ignoreUnmanagedApps).
 		WithPeerNamespace(a.principalNS())
 	subject := &auth.AuthSubject{}
@@ -703,11 +776,47 @@ func (a *Agent) processIncomingResourceResyncEvent(ev *event.Event) error {
 		}
 
 		return resyncHandler.ProcessRequestUpdateEvent(a.context, agentName, incoming)
+	case event.StateDigestExchange:
+		if a.mode != types.AgentModeAutonomous {
+			return fmt.Errorf("agent can only handle StateDigest in the autonomous mode")
+		}
+
+		digest, err := ev.StateDigest()
+		if err != nil {
+			return err
+		}
+
+		// The principal uses prefixed AppProject names, as in RequestUpdate
+		prefix := agentName + "-"
+		for i := range digest.Resources {
+			if digest.Resources[i].Kind == "AppProject" {
+				digest.Resources[i].Name = strings.TrimPrefix(digest.Resources[i].Name, prefix)
+			}
+		}
+
+		return resyncHandler.ProcessStateDigest(a.context, agentName, digest)
 	case event.EventRequestResourceResync:
 		if a.mode != types.AgentModeManaged {
 			return fmt.Errorf("agent can only handle ResourceResync request in the managed mode")
 		}
 
+		req, err := ev.RequestResourceResync()
+		if err != nil {
+			return err
+		}
+
+		// If the principal accepts it, tell it which changes have been
+		// applied already instead of requesting an update of every resource.
+		if watermarks := a.watermarks.snapshot(); req.Incremental && watermarks != nil {
+			resyncEv, err := a.emitter.RequestIncrementalResyncEvent(watermarks)
+			if err != nil {
+				return fmt.Errorf("failed to create incremental resync event: %w", err)
+			}
+			sendQ.Add(resyncEv)
+			logCtx.WithField("watermarks", watermarks).Debug("Requested an incremental resync")
+			return nil
+		}
+
 		return resyncHandler.ProcessIncomingResourceResyncRequest(a.context, agentName)
 	default:
 		return fmt.Errorf("invalid type of resource resync: %s", ev.Type())
@@ -716,7 +825,7 @@ func (a *Agent) processIncomingResourceResyncEvent(ev *event.Event) error {
 
 // createApplication creates an Application upon an event in the agent's work
 // queue. principalUID is stamped on the resource if non-empty.
-func (a *Agent) createApplication(incoming *v1alpha1.Application, principalUID string) (*v1alpha1.Application, error) {
+func (a *Agent) createApplication(ctx context.Context, incoming *v1alpha1.Application, principalUID string) (*v1alpha1.Application, error) {
 	// Determine the target namespace for the application
 	targetNamespace := a.getTargetNamespaceForApp(incoming)
 	incoming.SetNamespace(targetNamespace)
@@ -771,7 +880,7 @@ func (a *Agent) createApplication(incoming *v1alpha1.Application, principalUID s
 		a.sourceCache.Application.Set(sourceUIDForApp(incoming), incoming.Spec)
 	}
 
-	created, err := a.appManager.CreateWithPrincipalUID(a.context, incoming, principalUID)
+	created, err := a.appManager.CreateWithPrincipalUID(ctx, incoming, principalUID)
 	if apierrors.IsAlreadyExists(err) {
 		logCtx.Debug("application already exists")
 		return created, nil
@@ -780,7 +889,7 @@ func (a *Agent) createApplication(incoming *v1alpha1.Application, principalUID s
 	return created, err
 }
 
-func (a *Agent) updateApplication(incoming *v1alpha1.Application) (*v1alpha1.Application, error) {
+func (a *Agent) updateApplication(ctx context.Context, incoming *v1alpha1.Application) (*v1alpha1.Application, error) {
 	// Determine the target namespace for the application
 	targetNamespace := a.getTargetNamespaceForApp(incoming)
 	incoming.SetNamespace(targetNamespace)
@@ -825,17 +934,17 @@ func (a *Agent) updateApplication(incoming *v1alpha1.Application) (*v1alpha1.App
 		logCtx.Tracef("Calling update spec for this event")
 		a.sourceCache.Application.Set(sourceUIDForApp(incoming), incoming.Spec)
 
-		napp, err = a.appManager.UpdateManagedApp(a.context, incoming, application.ManagedIdentity{})
+		napp, err = a.appManager.UpdateManagedApp(ctx, incoming, application.ManagedIdentity{})
 	case types.AgentModeAutonomous:
 		logCtx.Tracef("Calling update operation for this event")
-		napp, err = a.appManager.UpdateOperation(a.context, incoming)
+		napp, err = a.appManager.UpdateOperation(ctx, incoming)
 	default:
 		err = fmt.Errorf("unknown operation mode: %s", a.mode)
 	}
 	return napp, err
 }
 
-func (a *Agent) deleteApplication(app *v1alpha1.Application) error {
+func (a *Agent) deleteApplication(ctx context.Context, app *v1alpha1.Application) error {
 	// Determine the target namespace for the application
 	targetNamespace := a.getTargetNamespaceForApp(app)
 	app.SetNamespace(targetNamespace)
@@ -854,7 +963,7 @@ func (a *Agent) deleteApplication(app *v1alpha1.Application) error {
 	}
 
 	// Fetch the source UID of the existing app to mark it as expected deletion.
-	app, err := a.appManager.Get(a.context, app.Name, app.Namespace)
+	app, err := a.appManager.Get(ctx, app.Name, app.Namespace)
 	if err != nil {
 		return err
 	}
@@ -863,7 +972,7 @@ func (a *Agent) deleteApplication(app *v1alpha1.Application) error {
 	a.deletions.MarkExpected(ktypes.UID(sourceUID))
 
 	deletionPropagation := backend.DeletePropagationBackground
-	err = a.appManager.Delete(a.context, a.namespace, app, &deletionPropagation)
+	err = a.appManager.Delete(ctx, a.namespace, app, &deletionPropagation)
 	if err != nil {
 		if apierrors.IsNotFound(err) {
 			logCtx.Debug("application is not found, perhaps it is already deleted")
@@ -891,6 +1000,7 @@ func (a *Agent) deleteApplication(app *v1alpha1.Application) error {
 func (a *Agent) createAppProject(incoming *v1alpha1.AppProject) (*v1alpha1.AppProject, error) {
 	// AppProjects must exist in the same namespace as the agent
 	incoming.SetNamespace(a.namespace)
+	a.allowMappedSourceNamespaces(incoming)
 
 	logCtx := a.logGrpcEvent().WithFields(logrus.Fields{
 		"method":     "CreateAppProject",
@@ -931,6 +1041,7 @@ func (a *Agent) createAppProject(incoming *v1alpha1.AppProject) (*v1alpha1.AppPr
 func (a *Agent) updateAppProject(incoming *v1alpha1.AppProject) (*v1alpha1.AppProject, error) {
 	// AppProjects must exist in the same namespace as the agent
 	incoming.SetNamespace(a.namespace)
+	a.allowMappedSourceNamespaces(incoming)
 
 	logCtx := a.logGrpcEvent().WithFields(logrus.Fields{
 		"method":          "UpdateAppProject",
@@ -1117,9 +1228,10 @@ func (a *Agent) deleteRepository(repo *corev1.Secret) error {
 // processIncomingGPGKey processes an incoming GPG key event.
 func (a *Agent) processIncomingGPGKey(ev *event.Event) error {
 	logCtx := a.logGrpcEvent().WithFields(logrus.Fields{
-		"method":      "processIncomingGPGKey",
-		"event_id":    ev.EventID(),
-		"resource_id": ev.ResourceID(),
+		"method":         "processIncomingGPGKey",
+		"event_id":       ev.EventID(),
+		"correlation_id": ev.CorrelationID(),
+		"resource_id":    ev.ResourceID(),
 	})
 
 	incomingCM, err := ev.GPGKey()
@@ -1314,11 +1426,141 @@ func (a *Agent) deleteGPGKey(cm *corev1.ConfigMap) error {
 	return nil
 }
 
+// processIncomingArgoCDConfig merges the keys of an Argo CD configuration
+// ConfigMap synced by the principal into the ConfigMap of the same name in the
+// agent's namespace. The ConfigMap is created if it does not exist, but never
+// deleted, since it may hold local configuration.
+func (a *Agent) processIncomingArgoCDConfig(ev *event.Event) error {
+	logCtx := a.logGrpcEvent().WithFields(logrus.Fields{
+		"method":         "processIncomingArgoCDConfig",
+		"event_id":       ev.EventID(),
+		"correlation_id": ev.CorrelationID(),
+		"resource_id":    ev.ResourceID(),
+	})
+
+	incomingCM, err := ev.ArgoCDConfig()
+	if err != nil {
+		return err
+	}
+
+	if a.mode != types.AgentModeManaged {
+		return event.NewEventDiscardedErr("cannot process Argo CD configuration, agent is not in managed mode")
+	}
+
+	if !settings.IsSyncable(incomingCM.Name) {
+		return event.NewEventDiscardedErr("keys of ConfigMap %s cannot be synced", incomingCM.Name)
+	}
+
+	switch ev.Type() {
+	case event.Create, event.SpecUpdate, event.Delete:
+	default:
+		logCtx.Warnf("Received an unknown event: %s. Protocol mismatch?", ev.Type())
+		return nil
+	}
+
+	logCtx = logCtx.WithField("configmap", incomingCM.Name)
+	cms := a.kubeClient.Clientset.CoreV1().ConfigMaps(a.namespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		existing, err := cms.Get(a.context, incomingCM.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			if len(incomingCM.Data) == 0 {
+				return nil
+			}
+			_, err = cms.Create(a.context, settings.NewConfigMap(incomingCM, a.namespace), metav1.CreateOptions{})
+			if err == nil {
+				logCtx.Info("Created Argo CD configuration ConfigMap with synced keys")
+			}
+			return err
+		} else if err != nil {
+			return err
+		}
+		if !settings.Apply(existing, incomingCM) {
+			logCtx.Trace("Synced keys of Argo CD configuration ConfigMap are up to date")
+			return nil
+		}
+		_, err = cms.Update(a.context, existing, metav1.UpdateOptions{})
+		if err == nil {
+			logCtx.Info("Updated synced keys of Argo CD configuration ConfigMap")
+		}
+		return err
+	})
+}
+
+// processIncomingArgoCDSecret merges the keys of an Argo CD Secret synced by
+// the principal into the Secret of the same name in the agent's namespace,
+// like processIncomingArgoCDConfig does for ConfigMaps. Encrypted keys are
+// decrypted with the repository encryption key.
+func (a *Agent) processIncomingArgoCDSecret(ev *event.Event) error {
+	logCtx := a.logGrpcEvent().WithFields(logrus.Fields{
+		"method":         "processIncomingArgoCDSecret",
+		"event_id":       ev.EventID(),
+		"correlation_id": ev.CorrelationID(),
+		"resource_id":    ev.ResourceID(),
+	})
+
+	incomingSecret, err := ev.ArgoCDSecret()
+	if err != nil {
+		return err
+	}
+
+	if a.mode != types.AgentModeManaged {
+		return event.NewEventDiscardedErr("cannot process Argo CD Secret, agent is not in managed mode")
+	}
+
+	if !settings.IsSyncableSecret(incomingSecret.Name) {
+		return event.NewEventDiscardedErr("keys of Secret %s cannot be synced", incomingSecret.Name)
+	}
+
+	switch ev.Type() {
+	case event.Create, event.SpecUpdate, event.Delete:
+	default:
+		logCtx.Warnf("Received an unknown event: %s. Protocol mismatch?", ev.Type())
+		return nil
+	}
+
+	if len(repository.EncryptedFields(incomingSecret)) > 0 {
+		if a.options.repoCipher == nil {
+			return fmt.Errorf("secret %s is encrypted, but no repository encryption key is configured", incomingSecret.Name)
+		}
+		if err := a.options.repoCipher.Decrypt(incomingSecret); err != nil {
+			return err
+		}
+	}
+
+	logCtx = logCtx.WithField("secret", incomingSecret.Name)
+	secrets := a.kubeClient.Clientset.CoreV1().Secrets(a.namespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		existing, err := secrets.Get(a.context, incomingSecret.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			if len(incomingSecret.Data) == 0 {
+				return nil
+			}
+			_, err = secrets.Create(a.context, settings.NewSecret(incomingSecret, a.namespace), metav1.CreateOptions{})
+			if err == nil {
+				logCtx.Info("Created Argo CD Secret with synced keys")
+			}
+			return err
+		} else if err != nil {
+			return err
+		}
+		if !settings.ApplySecret(existing, incomingSecret) {
+			logCtx.Trace("Synced keys of Argo CD Secret are up to date")
+			return nil
+		}
+		_, err = secrets.Update(a.context, existing, metav1.UpdateOptions{})
+		if err == nil {
+			logCtx.Info("Updated synced keys of Argo CD Secret")
+		}
+		return err
+	})
+}
+
 // getTargetNamespaceForApp returns the namespace where the application should
 // be created on the agent. In destination-based mapping + managed mode, apps
 // whose namespace matches the principal's namespace are remapped to the agent's
 // own namespace. When remapping occurs a boolean annotation is stamped so that
-// the principal can unambiguously identify the app as remapped.
+// the principal can unambiguously identify the app as remapped. Otherwise, the
+// application namespace mapping rules determine the namespace.
 func (a *Agent) getTargetNamespaceForApp(app *v1alpha1.Application) string {
 	if a.destinationBasedMapping && a.mode == types.AgentModeManaged {
 		principalNS := a.principalNS()
@@ -1335,7 +1577,7 @@ func (a *Agent) getTargetNamespaceForApp(app *v1alpha1.Application) string {
 		}
 		return app.Namespace
 	}
-	return a.namespace
+	return a.appNamespaceFor(app.Name)
 }
 
 // isNamespaceAllowed checks if the given namespace is in the agent's allowed namespaces list.
@@ -87,6 +87,7 @@ func (a *Agent) processIncomingRedisRequest(ev *event.Event) error {
 		"method":         "processIncomingRedisRequest",
 		"uuid":           rreq.UUID,
 		"connectionUUID": rreq.ConnectionUUID,
+		"correlation_id": ev.CorrelationID(),
 	})
 
 	logCtx.Tracef("Start processing incoming redis request %v", rreq)
@@ -153,7 +154,9 @@ func (a *Agent) processIncomingRedisRequest(ev *event.Event) error {
 		logCtx.Error("Remote queue disappeared")
 		return nil
 	}
-	q.Add(a.emitter.NewRedisResponseEvent(rreq.UUID, rreq.ConnectionUUID, *responseBody))
+	resp := a.emitter.NewRedisResponseEvent(rreq.UUID, rreq.ConnectionUUID, *responseBody)
+	event.SetCorrelationID(resp, ev.CorrelationID())
+	q.Add(resp)
 	logCtx.Trace("Emitted redis resource response")
 
 	return nil
@@ -173,6 +176,7 @@ func (a *Agent) handleRedisSubscribeMessage(logCtx *logrus.Entry, rreq *event.Re
 		if err != nil {
 			return nil, fmt.Errorf("unable to transform SUBSCRIBE key for agent: %w", err)
 		}
+		channelName = a.qualifyRedisKey(channelName)
 	}
 
 	// Subscribe to the argo cd redis channel via redis client
@@ -287,6 +291,7 @@ func (a *Agent) handleRedisGetMessage(logCtx *logrus.Entry, rreq *event.RedisReq
 		if err != nil {
 			return nil, fmt.Errorf("unable to transform GET key for agent: %w", err)
 		}
+		key = a.qualifyRedisKey(key)
 	}
 
 	// Connect to local redis to GET key/value, and store response
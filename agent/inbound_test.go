@@ -28,6 +28,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/rest"
 
+	"github.com/argoproj-labs/argocd-agent/internal/argocd/settings"
 	"github.com/argoproj-labs/argocd-agent/internal/auth"
 	backend_mocks "github.com/argoproj-labs/argocd-agent/internal/backend/mocks"
 	"github.com/argoproj-labs/argocd-agent/internal/event"
@@ -64,7 +65,7 @@ func Test_CreateApplication(t *testing.T) {
 		},
 	}}
 	t.Run("Discard event in unmanaged mode", func(t *testing.T) {
-		napp, err := a.createApplication(app, "")
+		napp, err := a.createApplication(context.TODO(), app, "")
 		require.Nil(t, napp)
 		require.ErrorContains(t, err, "not in managed mode")
 	})
@@ -73,7 +74,7 @@ func Test_CreateApplication(t *testing.T) {
 		defer a.appManager.Unmanage(app.QualifiedName())
 		a.mode = types.AgentModeManaged
 		a.appManager.Manage(app.QualifiedName())
-		napp, err := a.createApplication(app, "")
+		napp, err := a.createApplication(context.TODO(), app, "")
 		require.ErrorContains(t, err, "is already managed")
 		require.Nil(t, napp)
 	})
@@ -83,7 +84,7 @@ func Test_CreateApplication(t *testing.T) {
 		a.mode = types.AgentModeManaged
 		createMock := be.On("Create", mock.Anything, mock.Anything).Return(&v1alpha1.Application{}, nil)
 		defer createMock.Unset()
-		napp, err := a.createApplication(app, "")
+		napp, err := a.createApplication(context.TODO(), app, "")
 		require.NoError(t, err)
 		require.NotNil(t, napp)
 		require.Empty(t, napp.OwnerReferences, "OwnerReferences should not be applied on managed app")
@@ -108,7 +109,7 @@ func Test_CreateApplication(t *testing.T) {
 
 		createMock := be.On("Create", mock.Anything, mock.Anything).Return(newApp, nil)
 		defer createMock.Unset()
-		napp, err := a.createApplication(newApp, "")
+		napp, err := a.createApplication(context.TODO(), newApp, "")
 		require.NoError(t, err)
 		require.NotNil(t, napp)
 
@@ -1047,7 +1048,7 @@ func Test_UpdateApplication(t *testing.T) {
 	t.Run("Discard event because version has been seen already", func(t *testing.T) {
 		defer a.appManager.ClearIgnored()
 		a.appManager.IgnoreChange(fmt.Sprintf("%s/test", a.namespace), "12345")
-		napp, err := a.updateApplication(app)
+		napp, err := a.updateApplication(context.TODO(), app)
 		require.Nil(t, napp)
 		require.ErrorContains(t, err, "has already been seen")
 	})
@@ -1061,7 +1062,7 @@ func Test_UpdateApplication(t *testing.T) {
 		defer supportsPatchEvent.Unset()
 		patchEvent := be.On("Patch", mock.Anything, "test", "argocd", mock.Anything).Return(&v1alpha1.Application{}, nil)
 		defer patchEvent.Unset()
-		napp, err := a.updateApplication(app)
+		napp, err := a.updateApplication(context.TODO(), app)
 		require.NoError(t, err)
 		require.NotNil(t, napp)
 		require.Empty(t, napp.OwnerReferences, "OwnerReferences should not be applied on managed app")
@@ -1076,7 +1077,7 @@ func Test_UpdateApplication(t *testing.T) {
 		defer supportsPatchEvent.Unset()
 		patchEvent := be.On("Update", mock.Anything, mock.Anything).Return(&v1alpha1.Application{}, nil)
 		defer patchEvent.Unset()
-		napp, err := a.updateApplication(app)
+		napp, err := a.updateApplication(context.TODO(), app)
 		require.NoError(t, err)
 		require.NotNil(t, napp)
 		require.Empty(t, napp.OwnerReferences, "OwnerReferences should not be applied on managed app")
@@ -1103,7 +1104,7 @@ func Test_UpdateApplication(t *testing.T) {
 		updateEvent := be.On("Update", mock.Anything, mock.Anything).Return(&v1alpha1.Application{}, nil)
 		defer updateEvent.Unset()
 
-		napp, err := a.updateApplication(appWithInheritedSourceUID)
+		napp, err := a.updateApplication(context.TODO(), appWithInheritedSourceUID)
 		require.NoError(t, err)
 		require.NotNil(t, napp)
 
@@ -1125,7 +1126,7 @@ func Test_UpdateApplication(t *testing.T) {
 		defer supportsPatchEvent.Unset()
 		patchEvent := be.On("Patch", mock.Anything, "test", "argocd", mock.Anything).Return(&v1alpha1.Application{}, nil)
 		defer patchEvent.Unset()
-		napp, err := a.updateApplication(app)
+		napp, err := a.updateApplication(context.TODO(), app)
 		require.NoError(t, err)
 		require.NotNil(t, napp)
 	})
@@ -1140,7 +1141,7 @@ func Test_UpdateApplication(t *testing.T) {
 		defer supportsPatchEvent.Unset()
 		patchEvent := be.On("Update", mock.Anything, mock.Anything).Return(&v1alpha1.Application{}, nil)
 		defer patchEvent.Unset()
-		napp, err := a.updateApplication(app)
+		napp, err := a.updateApplication(context.TODO(), app)
 		require.NoError(t, err)
 		require.NotNil(t, napp)
 	})
@@ -1766,6 +1767,163 @@ func Test_ProcessIncomingRepositoryWithUIDMismatch(t *testing.T) {
 	})
 }
 
+func Test_ProcessIncomingEncryptedRepository(t *testing.T) {
+	evs := event.NewEventSource("test")
+	cipher, err := repository.NewFieldCipher([]byte("a shared key"))
+	require.NoError(t, err)
+
+	plain := &corev1.Secret{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      "private-repo",
+			Namespace: "argocd",
+			UID:       ktypes.UID("repo_uid"),
+		},
+		Data: map[string][]byte{
+			"url":      []byte("https://github.com/test/private"),
+			"password": []byte("s3cr3t"),
+		},
+	}
+	encrypted, err := cipher.Encrypt(plain)
+	require.NoError(t, err)
+
+	t.Run("Credentials are decrypted before the repository is created", func(t *testing.T) {
+		a, _ := newAgent(t)
+		a.mode = types.AgentModeManaged
+		a.options.repoCipher = cipher
+		be := backend_mocks.NewRepository(t)
+		a.repoManager = repository.NewManager(be, "argocd", true)
+
+		be.On("Get", mock.Anything, mock.Anything, mock.Anything).Return(nil, kerrors.NewNotFound(schema.GroupResource{Resource: "secrets"}, plain.Name))
+		be.On("Create", mock.Anything, mock.Anything).Return(plain, nil)
+
+		ev := event.New(evs.RepositoryEvent(event.Create, encrypted), targets.Repository)
+		require.NoError(t, a.processIncomingRepository(ev))
+
+		created, ok := be.Calls[1].Arguments[1].(*corev1.Secret)
+		require.True(t, ok)
+		assert.Equal(t, []byte("s3cr3t"), created.Data["password"])
+		assert.NotContains(t, created.Annotations, repository.EncryptedFieldsAnnotation)
+	})
+
+	t.Run("Encrypted repository is rejected without a key", func(t *testing.T) {
+		a, _ := newAgent(t)
+		a.mode = types.AgentModeManaged
+		be := backend_mocks.NewRepository(t)
+		a.repoManager = repository.NewManager(be, "argocd", true)
+
+		ev := event.New(evs.RepositoryEvent(event.Create, encrypted), targets.Repository)
+		assert.ErrorContains(t, a.processIncomingRepository(ev), "no repository encryption key")
+		be.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+}
+
+func Test_ProcessIncomingArgoCDConfig(t *testing.T) {
+	evs := event.NewEventSource("test")
+	incoming := &corev1.ConfigMap{
+		ObjectMeta: v1.ObjectMeta{Name: "argocd-cm", Namespace: "principal", UID: ktypes.UID("cm_uid"), ResourceVersion: "1"},
+		Data:       map[string]string{"resource.exclusions": "- kinds: [Event]"},
+	}
+
+	t.Run("ConfigMap is created with the synced keys", func(t *testing.T) {
+		a, kubec := newAgentManaged(t)
+		ev := event.New(evs.ArgoCDConfigEvent(event.SpecUpdate, incoming), targets.ArgoCDConfig)
+		require.NoError(t, a.processIncomingArgoCDConfig(ev))
+
+		cm, err := kubec.Clientset.CoreV1().ConfigMaps("argocd").Get(context.TODO(), "argocd-cm", v1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, incoming.Data, cm.Data)
+		assert.Equal(t, "argocd", cm.Labels["app.kubernetes.io/part-of"])
+		assert.Equal(t, "resource.exclusions", cm.Annotations[settings.SyncedKeysAnnotation])
+	})
+
+	t.Run("Synced keys are merged and removed without touching local keys", func(t *testing.T) {
+		a, kubec := newAgentManaged(t)
+		_, err := kubec.Clientset.CoreV1().ConfigMaps("argocd").Create(context.TODO(), &corev1.ConfigMap{
+			ObjectMeta: v1.ObjectMeta{Name: "argocd-cm", Namespace: "argocd"},
+			Data:       map[string]string{"url": "https://agent.example.com"},
+		}, v1.CreateOptions{})
+		require.NoError(t, err)
+
+		ev := event.New(evs.ArgoCDConfigEvent(event.SpecUpdate, incoming), targets.ArgoCDConfig)
+		require.NoError(t, a.processIncomingArgoCDConfig(ev))
+		cm, err := kubec.Clientset.CoreV1().ConfigMaps("argocd").Get(context.TODO(), "argocd-cm", v1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"url": "https://agent.example.com", "resource.exclusions": "- kinds: [Event]"}, cm.Data)
+
+		deleted := incoming.DeepCopy()
+		deleted.Data = nil
+		ev = event.New(evs.ArgoCDConfigEvent(event.Delete, deleted), targets.ArgoCDConfig)
+		require.NoError(t, a.processIncomingArgoCDConfig(ev))
+		cm, err = kubec.Clientset.CoreV1().ConfigMaps("argocd").Get(context.TODO(), "argocd-cm", v1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"url": "https://agent.example.com"}, cm.Data)
+		assert.NotContains(t, cm.Annotations, settings.SyncedKeysAnnotation)
+	})
+
+	t.Run("Other ConfigMaps are rejected", func(t *testing.T) {
+		a, kubec := newAgentManaged(t)
+		otherCM := incoming.DeepCopy()
+		otherCM.Name = "other-cm"
+		ev := event.New(evs.ArgoCDConfigEvent(event.SpecUpdate, otherCM), targets.ArgoCDConfig)
+		assert.True(t, event.IsEventDiscarded(a.processIncomingArgoCDConfig(ev)))
+		_, err := kubec.Clientset.CoreV1().ConfigMaps("argocd").Get(context.TODO(), "other-cm", v1.GetOptions{})
+		assert.True(t, kerrors.IsNotFound(err))
+	})
+
+	t.Run("Autonomous agents discard the event", func(t *testing.T) {
+		a, _ := newAgent(t)
+		a.mode = types.AgentModeAutonomous
+		ev := event.New(evs.ArgoCDConfigEvent(event.SpecUpdate, incoming), targets.ArgoCDConfig)
+		assert.True(t, event.IsEventDiscarded(a.processIncomingArgoCDConfig(ev)))
+	})
+}
+
+func Test_ProcessIncomingArgoCDSecret(t *testing.T) {
+	evs := event.NewEventSource("test")
+	cipher, err := repository.NewFieldCipher([]byte("a shared key"))
+	require.NoError(t, err)
+	incoming := &corev1.Secret{
+		ObjectMeta: v1.ObjectMeta{Name: "argocd-notifications-secret", Namespace: "principal", UID: ktypes.UID("secret_uid"), ResourceVersion: "1"},
+		Data:       map[string][]byte{"slack-token": []byte("xoxb")},
+	}
+	encrypted, err := cipher.Encrypt(incoming)
+	require.NoError(t, err)
+
+	t.Run("Encrypted keys are decrypted and merged", func(t *testing.T) {
+		a, kubec := newAgentManaged(t)
+		a.options.repoCipher = cipher
+		_, err := kubec.Clientset.CoreV1().Secrets("argocd").Create(context.TODO(), &corev1.Secret{
+			ObjectMeta: v1.ObjectMeta{Name: "argocd-notifications-secret", Namespace: "argocd"},
+			Data:       map[string][]byte{"email-password": []byte("local")},
+		}, v1.CreateOptions{})
+		require.NoError(t, err)
+
+		ev := event.New(evs.ArgoCDSecretEvent(event.SpecUpdate, encrypted), targets.ArgoCDSecret)
+		require.NoError(t, a.processIncomingArgoCDSecret(ev))
+		secret, err := kubec.Clientset.CoreV1().Secrets("argocd").Get(context.TODO(), "argocd-notifications-secret", v1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, map[string][]byte{"slack-token": []byte("xoxb"), "email-password": []byte("local")}, secret.Data)
+		assert.NotContains(t, secret.Annotations, repository.EncryptedFieldsAnnotation)
+		assert.Equal(t, "slack-token", secret.Annotations[settings.SyncedKeysAnnotation])
+	})
+
+	t.Run("Encrypted keys are rejected without a key", func(t *testing.T) {
+		a, kubec := newAgentManaged(t)
+		ev := event.New(evs.ArgoCDSecretEvent(event.SpecUpdate, encrypted), targets.ArgoCDSecret)
+		assert.ErrorContains(t, a.processIncomingArgoCDSecret(ev), "no repository encryption key")
+		_, err := kubec.Clientset.CoreV1().Secrets("argocd").Get(context.TODO(), "argocd-notifications-secret", v1.GetOptions{})
+		assert.True(t, kerrors.IsNotFound(err))
+	})
+
+	t.Run("Other Secrets are rejected", func(t *testing.T) {
+		a, _ := newAgentManaged(t)
+		other := incoming.DeepCopy()
+		other.Name = "argocd-secret"
+		ev := event.New(evs.ArgoCDSecretEvent(event.SpecUpdate, other), targets.ArgoCDSecret)
+		assert.True(t, event.IsEventDiscarded(a.processIncomingArgoCDSecret(ev)))
+	})
+}
+
 func Test_CreateRepository(t *testing.T) {
 	a, _ := newAgent(t)
 	be := backend_mocks.NewRepository(t)
@@ -1984,6 +2142,29 @@ func Test_processIncomingResourceResyncEvent(t *testing.T) {
 		assert.Nil(t, err)
 	})
 
+	t.Run("request incremental resync in managed mode if the principal accepts it", func(t *testing.T) {
+		a.mode = types.AgentModeManaged
+		a.watermarks.observe("agent-ns", "42")
+		sendQ := a.queues.SendQ(defaultQueueName)
+		for sendQ.Len() > 0 {
+			ev, _ := sendQ.Get()
+			sendQ.Done(ev)
+		}
+
+		ev, err := a.emitter.IncrementalResourceResyncEvent()
+		require.NoError(t, err)
+
+		err = a.processIncomingResourceResyncEvent(event.New(ev, targets.ResourceResync))
+		require.NoError(t, err)
+		require.Equal(t, 1, sendQ.Len())
+
+		sent, _ := sendQ.Get()
+		assert.Equal(t, event.EventIncrementalResync.String(), sent.Type())
+		req, err := event.New(sent, targets.ResourceResync).RequestIncrementalResync()
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"agent-ns": "42"}, req.Watermarks)
+	})
+
 	t.Run("discard RequestResourceResync in autonomous mode", func(t *testing.T) {
 		a.mode = types.AgentModeAutonomous
 
@@ -2758,3 +2939,33 @@ func Test_processIncomingApplication_AdoptsExistingApplications(t *testing.T) {
 		require.Equal(t, expectedPrincipalUID, principalUID)
 	})
 }
+
+func Test_processIncomingEvent_DiscardsStaleEvents(t *testing.T) {
+	a, _ := newAgent(t)
+	a.context = context.Background()
+	evs := event.NewEventSource("test")
+	app := &v1alpha1.Application{ObjectMeta: v1.ObjectMeta{Name: "test", Namespace: "argocd", UID: "1234"}}
+
+	older := evs.ApplicationEvent(event.SpecUpdate, app)
+	event.SetSequence(older, event.Sequence{Epoch: "epoch", Number: 1})
+	newer := evs.ApplicationEvent(event.SpecUpdate, app)
+	event.SetSequence(newer, event.Sequence{Epoch: "epoch", Number: 2, Previous: 1})
+	a.sequences.Applied(newer)
+
+	err := a.processIncomingEvent(event.New(older, targets.Application))
+	assert.True(t, event.IsEventDiscarded(err))
+}
+
+func Test_processIncomingEvent_DiscardsDuplicateEvents(t *testing.T) {
+	a, _ := newAgent(t)
+	a.context = context.Background()
+	evs := event.NewEventSource("test")
+
+	ev, err := evs.NewResourceRequestEvent(v1.GroupVersionResource{Version: "v1", Resource: "pods"}, "default", "pod-1", "", "DELETE", nil, nil)
+	require.NoError(t, err)
+	event.SetSequence(ev, event.Sequence{Epoch: "epoch", Number: 1})
+	a.sequences.Applied(ev)
+
+	err = a.processIncomingEvent(event.New(ev, targets.Resource))
+	assert.True(t, event.IsEventDiscarded(err))
+}
@@ -19,8 +19,11 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/argoproj-labs/argocd-agent/internal/event"
+	"github.com/argoproj-labs/argocd-agent/internal/event/targets"
 	"github.com/argoproj-labs/argocd-agent/internal/logging"
 	"github.com/argoproj-labs/argocd-agent/internal/manager"
+	"github.com/argoproj-labs/argocd-agent/internal/manager/repository"
 	"github.com/argoproj-labs/argocd-agent/internal/tlsutil"
 	"k8s.io/client-go/kubernetes"
 
@@ -129,6 +132,133 @@ func WithHeartbeatInterval(interval time.Duration) AgentOption {
 	}
 }
 
+// WithStateDigestInterval configures a managed agent to send a digest of the
+// spec checksums of its resources to the principal at the given interval
+// while it is connected. The principal answers with updates for the resources
+// that drifted only. A value of 0 disables the digest.
+func WithStateDigestInterval(interval time.Duration) AgentOption {
+	return func(o *Agent) error {
+		if interval < 0 {
+			return fmt.Errorf("state digest interval must not be negative")
+		}
+		o.options.stateDigestInterval = interval
+		return nil
+	}
+}
+
+// WithPrioritizedStreams configures the agent to exchange spec and status
+// events with the principal on gRPC streams of their own, so that a flood of
+// events of one kind cannot delay those of the other.
+func WithPrioritizedStreams(enabled bool) AgentOption {
+	return func(o *Agent) error {
+		o.options.prioritizedStreams = enabled
+		return nil
+	}
+}
+
+// WithEventBatchSize configures the agent to send up to size events waiting
+// to be sent to the principal in a single message, which reduces the overhead
+// of sending a large backlog of events. A size of 1 disables batching. The
+// principal must be able to unpack batches.
+func WithEventBatchSize(size int) AgentOption {
+	return func(o *Agent) error {
+		if size < 1 || size > event.MaxBatchSize {
+			return fmt.Errorf("event batch size must be between 1 and %d", event.MaxBatchSize)
+		}
+		o.options.batchSize = size
+		return nil
+	}
+}
+
+// WithEventBatchWindow configures the agent to hold back updates to a
+// resource for window after the first one, so that rapid successive updates,
+// e.g. during a sync, are sent to the principal as a single event. A window
+// of 0 disables it.
+func WithEventBatchWindow(window time.Duration) AgentOption {
+	return func(o *Agent) error {
+		if window < 0 {
+			return fmt.Errorf("event batch window must not be negative")
+		}
+		o.options.batchWindow = window
+		return nil
+	}
+}
+
+// WithDeltaEvents configures the agent to send Application events to the
+// principal as patches against the version the principal acknowledged last,
+// instead of the full object. The agent falls back to the full object for
+// principals that cannot resolve the patch.
+func WithDeltaEvents(enabled bool) AgentOption {
+	return func(o *Agent) error {
+		o.options.deltaEvents = enabled
+		return nil
+	}
+}
+
+// WithEventChunkSize configures the agent to send events larger than size
+// bytes to the principal in chunks of that size. This is required for agents
+// behind middleboxes that limit the size of HTTP/2 frames or messages. A size
+// of 0 disables chunking.
+func WithEventChunkSize(size int) AgentOption {
+	return func(o *Agent) error {
+		if size < 0 || (size > 0 && size < event.MinChunkSize) {
+			return fmt.Errorf("event chunk size must be 0 or at least %d bytes", event.MinChunkSize)
+		}
+		o.options.chunkSize = size
+		return nil
+	}
+}
+
+// WithPayloadTransferThreshold configures the agent to transfer the payload of
+// events larger than size bytes to the principal out of band, on a stream of
+// its own, so that bulk data does not hold up the events behind it. Payloads
+// are only transferred out of band if the principal supports it. A size of 0
+// sends all payloads on the event stream.
+func WithPayloadTransferThreshold(size int) AgentOption {
+	return func(o *Agent) error {
+		if size < 0 {
+			return fmt.Errorf("payload transfer threshold must not be negative")
+		}
+		o.options.payloadTransferThreshold = size
+		return nil
+	}
+}
+
+// WithRepositoryEncryptionKeyFile configures the agent to decrypt the
+// credentials in repository and repo-creds secrets received from the
+// principal with a key derived from the contents of the file at path. The
+// principal must be configured with the same key.
+func WithRepositoryEncryptionKeyFile(path string) AgentOption {
+	return func(o *Agent) error {
+		if path == "" {
+			return nil
+		}
+		c, err := repository.NewFieldCipherFromFile(path)
+		if err != nil {
+			return err
+		}
+		o.options.repoCipher = c
+		return nil
+	}
+}
+
+// WithApplicationFieldFilters strips the annotations, labels and info entries
+// of Applications selected by specs before they are sent to the principal.
+// Each spec has the form <field>:<pattern>, see event.ParseApplicationFilter.
+func WithApplicationFieldFilters(specs []string) AgentOption {
+	return func(o *Agent) error {
+		if len(specs) == 0 {
+			return nil
+		}
+		f, err := event.ParseApplicationFilter(specs)
+		if err != nil {
+			return err
+		}
+		o.options.appFilter = f
+		return nil
+	}
+}
+
 func WithSubsystemLoggers(resourceProxy, redisProxy, grpcEvent *logrus.Logger) AgentOption {
 	return func(o *Agent) error {
 		if resourceProxy != nil {
@@ -169,6 +299,22 @@ func WithDestinationBasedMapping(enabled bool) AgentOption {
 	}
 }
 
+// WithAppNamespaceMapping sets the rules placing the Applications received
+// from the principal in namespaces on the workload cluster, by their name.
+// Each rule is in the form <glob>=<namespace>, and the first rule matching
+// the name of an Application applies. Applications matching no rule are
+// placed in the agent's namespace. This is only supported in managed mode.
+func WithAppNamespaceMapping(rules ...string) AgentOption {
+	return func(o *Agent) error {
+		parsed, err := parseAppNamespaceRules(rules)
+		if err != nil {
+			return fmt.Errorf("invalid application namespace mapping: %w", err)
+		}
+		o.appNamespaceRules = parsed
+		return nil
+	}
+}
+
 // WithIgnoreUnmanagedApps enables ignoring resources without the source UID annotation
 // during resync. When enabled, unmanaged resources will be silently skipped instead of
 // causing errors.
@@ -179,6 +325,34 @@ func WithIgnoreUnmanagedApps(enabled bool) AgentOption {
 	}
 }
 
+// WithReportIncludeRules sets the rules an application must match any of to
+// be reported to the principal in autonomous mode. Each rule is in the form
+// name=<glob>, project=<glob> or label=<selector>.
+func WithReportIncludeRules(rules ...string) AgentOption {
+	return func(o *Agent) error {
+		parsed, err := parseAppReportRules(rules)
+		if err != nil {
+			return fmt.Errorf("invalid report include rules: %w", err)
+		}
+		o.reportInclude = parsed
+		return nil
+	}
+}
+
+// WithReportExcludeRules sets the rules an application must match none of to
+// be reported to the principal in autonomous mode. Each rule is in the form
+// name=<glob>, project=<glob> or label=<selector>.
+func WithReportExcludeRules(rules ...string) AgentOption {
+	return func(o *Agent) error {
+		parsed, err := parseAppReportRules(rules)
+		if err != nil {
+			return fmt.Errorf("invalid report exclude rules: %w", err)
+		}
+		o.reportExclude = parsed
+		return nil
+	}
+}
+
 // WithLabelSelector sets an optional Kubernetes label selector that restricts
 // which resources the agent watches. Only resources matching this selector
 // will be listed, watched, and processed by the agent.
@@ -259,3 +433,37 @@ func WithAdoptionPolicy(policy string) AgentOption {
 		return nil
 	}
 }
+
+// WithClientCertificateRenewal has the agent renew its client certificate in
+// the TLS secret name through the principal, before it expires. New keys are
+// generated according to keyOpts.
+func WithClientCertificateRenewal(name string, keyOpts tlsutil.KeyGenOptions) AgentOption {
+	return func(a *Agent) error {
+		a.options.clientCertSecret = name
+		a.options.clientCertKeyOptions = keyOpts
+		return nil
+	}
+}
+
+// WithCustomEvents registers target as the target of custom events exchanged
+// with the principal, and handler as the function processing the events for
+// target received from the principal. The name of target must be a domain
+// qualified name, such as telemetry.example.com, and the principal must
+// register the same target. A nil handler allows sending events for target
+// with SendCustomEvent only.
+func WithCustomEvents(target string, handler CustomEventHandler) AgentOption {
+	return func(a *Agent) error {
+		t := targets.EventTarget(target)
+		if err := event.RegisterCustomTarget(t); err != nil {
+			return err
+		}
+		if handler == nil {
+			return nil
+		}
+		if a.options.customEventHandlers == nil {
+			a.options.customEventHandlers = make(map[targets.EventTarget]CustomEventHandler)
+		}
+		a.options.customEventHandlers[t] = handler
+		return nil
+	}
+}
@@ -195,3 +195,28 @@ func Test_WithInformerSyncTimeout(t *testing.T) {
 		assert.Contains(t, err.Error(), "informer sync timeout must be greater than 0")
 	})
 }
+
+func Test_WithEventChunkSize(t *testing.T) {
+	a := &Agent{}
+	require.NoError(t, WithEventChunkSize(64*1024)(a))
+	assert.Equal(t, 64*1024, a.options.chunkSize)
+	require.NoError(t, WithEventChunkSize(0)(a))
+	assert.Equal(t, 0, a.options.chunkSize)
+	assert.Error(t, WithEventChunkSize(100)(a))
+	assert.Error(t, WithEventChunkSize(-1)(a))
+}
+
+func Test_WithPayloadTransferThreshold(t *testing.T) {
+	a := &Agent{}
+	require.NoError(t, WithPayloadTransferThreshold(1024*1024)(a))
+	assert.Equal(t, 1024*1024, a.options.payloadTransferThreshold)
+	assert.Error(t, WithPayloadTransferThreshold(-1)(a))
+}
+
+func Test_WithEventBatchSize(t *testing.T) {
+	a := &Agent{}
+	require.NoError(t, WithEventBatchSize(100)(a))
+	assert.Equal(t, 100, a.options.batchSize)
+	assert.Error(t, WithEventBatchSize(0)(a))
+	assert.Error(t, WithEventBatchSize(1001)(a))
+}
@@ -27,6 +27,7 @@ import (
 	"github.com/argoproj-labs/argocd-agent/pkg/types"
 	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
 	cacheutil "github.com/argoproj/argo-cd/v3/util/cache"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
 	"github.com/sirupsen/logrus"
 	"go.opentelemetry.io/otel/trace"
 	corev1 "k8s.io/api/core/v1"
@@ -613,3 +614,24 @@ func (a *Agent) startSpan(operation, resourceKind string, obj metav1.Object) (co
 		),
 	)
 }
+
+// processEventOutcome records the outcome of an event for an Application,
+// which the principal reported on the ACK for the event, as a condition of
+// the Application. The condition is removed once the principal applies an
+// event for the Application again.
+func (a *Agent) processEventOutcome(ack *cloudevents.Event) {
+	namespace, name, ok := event.AcknowledgedApplication(ack)
+	if !ok || a.appManager == nil {
+		return
+	}
+	message := ""
+	switch outcome := event.OutcomeOf(ack); {
+	case outcome.IsFailure():
+		message = fmt.Sprintf("Principal could not apply the last change (%s): %s", outcome, event.RejectionReason(ack))
+	case outcome != event.OutcomeApplied:
+		return
+	}
+	if err := a.appManager.SetPropagationCondition(a.context, namespace, name, message); err != nil {
+		a.logGrpcEvent().WithError(err).WithField(logfields.Application, namespace+"/"+name).Warn("Could not record outcome of event on application")
+	}
+}
@@ -8,13 +8,16 @@ import (
 	"github.com/alicebob/miniredis/v2"
 	"github.com/argoproj-labs/argocd-agent/internal/argocd/cluster"
 	"github.com/argoproj-labs/argocd-agent/internal/event"
+	"github.com/argoproj-labs/argocd-agent/internal/event/targets"
 	"github.com/argoproj-labs/argocd-agent/internal/manager"
+	"github.com/argoproj-labs/argocd-agent/internal/manager/application"
 	"github.com/argoproj-labs/argocd-agent/internal/resources"
 	"github.com/argoproj-labs/argocd-agent/pkg/client"
 	"github.com/argoproj-labs/argocd-agent/pkg/types"
 	"github.com/argoproj-labs/argocd-agent/test/fake/kube"
 	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
 	cacheutil "github.com/argoproj/argo-cd/v3/util/cache"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
@@ -983,3 +986,28 @@ func Test_handleGPGKeyDeletion(t *testing.T) {
 		assert.False(t, a.gpgKeyManager.IsManaged("argocd-gpg-keys-cm"))
 	})
 }
+
+func Test_processEventOutcome(t *testing.T) {
+	app := &v1alpha1.Application{ObjectMeta: v1.ObjectMeta{Name: "guestbook", Namespace: "argocd", UID: "uid"}}
+	a, kubec := newAgent(t, app)
+	evs := event.NewEventSource("agent")
+	ackFor := func(err error) *cloudevents.Event {
+		ack := evs.ProcessedEvent(event.EventProcessed, event.New(evs.ApplicationEvent(event.SpecUpdate, app), targets.Application))
+		event.SetOutcome(ack, err)
+		return ack
+	}
+	conditions := func() []v1alpha1.ApplicationCondition {
+		got, err := kubec.ApplicationsClientset.ArgoprojV1alpha1().Applications("argocd").Get(context.TODO(), "guestbook", v1.GetOptions{})
+		require.NoError(t, err)
+		return got.Status.Conditions
+	}
+
+	a.processEventOutcome(ackFor(event.NewEventNotAllowedErr("destination not allowed")))
+	got := conditions()
+	require.Len(t, got, 1)
+	assert.Equal(t, application.ApplicationConditionPrincipalPropagationError, got[0].Type)
+	assert.Contains(t, got[0].Message, "destination not allowed")
+
+	a.processEventOutcome(ackFor(nil))
+	assert.Empty(t, conditions())
+}
@@ -49,9 +49,10 @@ func (a *Agent) processIncomingResourceRequest(ev *event.Event) error {
 		return err
 	}
 	logCtx := a.logResourceProxy().WithFields(logrus.Fields{
-		"method":      "processIncomingResourceRequest",
-		"uuid":        rreq.UUID,
-		"http_method": rreq.Method,
+		"method":         "processIncomingResourceRequest",
+		"uuid":           rreq.UUID,
+		"http_method":    rreq.Method,
+		"correlation_id": ev.CorrelationID(),
 	})
 
 	logCtx.Tracef("Start processing %v", rreq)
@@ -139,7 +140,9 @@ func (a *Agent) processIncomingResourceRequest(ev *event.Event) error {
 		logCtx.Error("Remote queue disappeared")
 		return nil
 	}
-	q.Add(a.emitter.NewResourceResponseEvent(rreq.UUID, event.HTTPStatusFromError(status), string(jsonres)))
+	resp := a.emitter.NewResourceResponseEvent(rreq.UUID, event.HTTPStatusFromError(status), string(jsonres))
+	event.SetCorrelationID(resp, ev.CorrelationID())
+	q.Add(resp)
 	logCtx.Tracef("Emitted resource response")
 
 	return nil
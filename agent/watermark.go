@@ -0,0 +1,62 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package agent
+
+import (
+	"strconv"
+	"sync"
+)
+
+// appWatermarks tracks the highest resource version of the principal's
+// Applications a managed agent has applied, per namespace on the principal.
+// The principal uses the watermarks to resync the agent incrementally.
+type appWatermarks struct {
+	mu          sync.Mutex
+	byNamespace map[string]uint64
+}
+
+func newAppWatermarks() *appWatermarks {
+	return &appWatermarks{byNamespace: map[string]uint64{}}
+}
+
+// observe records that the agent applied the given resource version of an
+// Application in namespace on the principal. Resource versions that are not
+// numeric are ignored.
+func (w *appWatermarks) observe(namespace, resourceVersion string) {
+	rv, err := strconv.ParseUint(resourceVersion, 10, 64)
+	if err != nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if rv > w.byNamespace[namespace] {
+		w.byNamespace[namespace] = rv
+	}
+}
+
+// snapshot returns the watermarks by namespace, or nil if the agent has not
+// applied any Application yet.
+func (w *appWatermarks) snapshot() map[string]string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.byNamespace) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(w.byNamespace))
+	for ns, rv := range w.byNamespace {
+		out[ns] = strconv.FormatUint(rv, 10)
+	}
+	return out
+}
@@ -0,0 +1,32 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package agent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_appWatermarks(t *testing.T) {
+	w := newAppWatermarks()
+	assert.Nil(t, w.snapshot())
+
+	w.observe("ns-a", "10")
+	w.observe("ns-a", "7")
+	w.observe("ns-b", "3")
+	w.observe("ns-b", "not-a-number")
+	assert.Equal(t, map[string]string{"ns-a": "10", "ns-b": "3"}, w.snapshot())
+}
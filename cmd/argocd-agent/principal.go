@@ -17,32 +17,55 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"math"
 	"net/http"
 	_ "net/http/pprof"
+	"os"
+	"os/signal"
 	"regexp"
 	"runtime"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/argoproj-labs/argocd-agent/cmd/cmdutil"
+	"github.com/argoproj-labs/argocd-agent/internal/audit"
 	"github.com/argoproj-labs/argocd-agent/internal/auth"
 	"github.com/argoproj-labs/argocd-agent/internal/auth/header"
 	"github.com/argoproj-labs/argocd-agent/internal/auth/mtls"
+	"github.com/argoproj-labs/argocd-agent/internal/auth/oidc"
+	"github.com/argoproj-labs/argocd-agent/internal/auth/psk"
+	"github.com/argoproj-labs/argocd-agent/internal/auth/serviceaccount"
 	"github.com/argoproj-labs/argocd-agent/internal/auth/userpass"
+	"github.com/argoproj-labs/argocd-agent/internal/auth/webhook"
+	"github.com/argoproj-labs/argocd-agent/internal/certmanager"
 	"github.com/argoproj-labs/argocd-agent/internal/config"
+	"github.com/argoproj-labs/argocd-agent/internal/connlimit"
 	"github.com/argoproj-labs/argocd-agent/internal/env"
+	"github.com/argoproj-labs/argocd-agent/internal/envelope"
+	"github.com/argoproj-labs/argocd-agent/internal/event"
 	"github.com/argoproj-labs/argocd-agent/internal/grpcutil"
+	"github.com/argoproj-labs/argocd-agent/internal/issuer"
+	"github.com/argoproj-labs/argocd-agent/internal/issuer/vault"
 	"github.com/argoproj-labs/argocd-agent/internal/kube"
 	"github.com/argoproj-labs/argocd-agent/internal/labels"
+	"github.com/argoproj-labs/argocd-agent/internal/pki"
+	"github.com/argoproj-labs/argocd-agent/internal/queue"
 	"github.com/argoproj-labs/argocd-agent/internal/tlsutil"
 	"github.com/argoproj-labs/argocd-agent/internal/tracing"
 	"github.com/argoproj-labs/argocd-agent/pkg/ha"
 	"github.com/argoproj-labs/argocd-agent/principal"
+	"github.com/argoproj-labs/argocd-agent/principal/admission"
+	authserver "github.com/argoproj-labs/argocd-agent/principal/apis/auth"
+	"github.com/argoproj-labs/argocd-agent/principal/apis/certificate"
+	"github.com/argoproj-labs/argocd-agent/principal/apis/eventstream"
 	cacheutil "github.com/argoproj/argo-cd/v3/util/cache"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"golang.org/x/crypto/acme"
 )
 
 // NewPrincipalRunCommand returns a new principal run command.
@@ -50,6 +73,8 @@ func NewPrincipalRunCommand() *cobra.Command {
 	var (
 		listenHost                string
 		listenPort                int
+		additionalListeners       []string
+		quicPort                  int
 		logLevels                 []string
 		logFormat                 string
 		fullDetailCategories      []string
@@ -61,14 +86,79 @@ func NewPrincipalRunCommand() *cobra.Command {
 		tlsSecretName             string
 		tlsCert                   string
 		tlsKey                    string
+		acmeHosts                 []string
+		acmeEmail                 string
+		acmeDirectoryURL          string
+		acmeSecretName            string
+		pkiBootstrap              bool
+		pkiBootstrapAgents        []string
+		pkiDNSNames               []string
+		pkiIPAddresses            []string
+		sniSecretNames            []string
+		sniKeyPairs               []string
+		certManagerIssuer         string
+		certManagerIssuerKind     string
+		certManagerIssuerGroup    string
+		certManagerDNSNames       []string
+		certManagerIPAddresses    []string
 		jwtSecretName             string
 		jwtKey                    string
+		jwtPreviousKeys           string
+		jwtVaultAddress           string
+		jwtVaultKey               string
+		jwtVaultMount             string
+		jwtVaultTokenPath         string
+		jwtVaultCAPath            string
 		allowTLSGenerate          bool
 		allowJwtGenerate          bool
+		requireSigningKey         bool
 		insecurePlaintext         bool
+		insecurePlaintextForce    bool
 		authMethod                string
+		saTokenAudiences          []string
+		userpassSecretSelector    string
+		oidcJWKSURL               string
+		oidcAudience              string
+		oidcAgentClaim            string
+		authWebhookCAPath         string
+		authWebhookTimeout        time.Duration
+		authRateLimit             int
+		connectionStormWindow     time.Duration
+		connectionStormRate       float64
+		authMaxFailures           int
+		authLockout               time.Duration
+		authMaxLockout            time.Duration
+		accessTokenValidity       time.Duration
+		tokenScopes               []string
+		refreshTokenValidity      time.Duration
+		agentCertIssuer           string
+		agentCertValidity         time.Duration
+		tokenRevocationConfigMap  string
+		agentPolicyConfigMap      string
+		agentApprovalConfigMap    string
+		agentStoreSecret          string
+		agentStoreKeyPath         string
+		ipAllow                   []string
+		ipDeny                    []string
+		ipFilterConfigMap         string
+		proxyProtocol             bool
+		proxyProtocolTrusted      []string
+		appAdmissionSchema        bool
+		appAdmissionDestinations  []string
+		appAdmissionProjects      []string
+		appAdmissionWebhook       string
+		appAdmissionWebhookCAPath string
+		appAdmissionTimeout       time.Duration
+		auditLogFile              string
+		auditLogWebhook           string
+		auditLogWebhookCAPath     string
 		rootCaSecretName          string
 		rootCaPath                string
+		clientCAPath              string
+		clientCertCRLs            []string
+		clientCertCRLRefresh      time.Duration
+		clientCertOCSP            bool
+		revocationSoftFail        bool
 		requireClientCerts        bool
 		clientCertSubjectMatch    bool
 		autoNamespaceAllow        bool
@@ -78,6 +168,7 @@ func NewPrincipalRunCommand() *cobra.Command {
 		enableResourceProxy       bool
 		resourceProxyAddress      string
 		pprofPort                 int
+		enableReflection          bool
 		resourceProxySecretName   string
 		resourceProxyCertPath     string
 		resourceProxyKeyPath      string
@@ -92,6 +183,16 @@ func NewPrincipalRunCommand() *cobra.Command {
 		// if agent sends ping more often than specified interval then connection will be dropped
 		// Ex: "30m", "1h" or "1h20m10s". Valid time units are "s", "m", "h".
 		keepAliveMinimumInterval time.Duration
+		// Allow agents to send keepalive pings without an active stream
+		keepAlivePermitWithoutStream bool
+		// Interval after which the principal pings an idle agent connection,
+		// and how long to wait for the ping ack before closing the connection
+		keepAliveTime    time.Duration
+		keepAliveTimeout time.Duration
+		// Deadline of unary gRPC calls, and how long sending a single event
+		// to an agent may take
+		unaryTimeout time.Duration
+		sendTimeout  time.Duration
 
 		redisAddress         string
 		redisPassword        string
@@ -100,9 +201,49 @@ func NewPrincipalRunCommand() *cobra.Command {
 		disableRedisProxy    bool
 		healthzPort          int
 
-		maxGRPCMessageSize int
-
-		numEventProcessors int
+		maxGRPCMessageSize         int
+		eventPayloadLimits         []string
+		agentBandwidthLimits       []string
+		eventChunkSize             string
+		payloadTransferThreshold   string
+		eventBatchSize             int
+		deltaEvents                bool
+		payloadEncryption          bool
+		payloadEncryptionPSKPath   string
+		repoExcludedFields         []string
+		argoCDConfigKeys           []string
+		appFieldFilters            []string
+		argoCDResourceFilters      bool
+		argoCDNotifications        bool
+		repoEncryptionKeyPath      string
+		eventBatchWindow           time.Duration
+		queueStorageDir            string
+		queueBackend               string
+		orphanedAppPolicy          string
+		orphanedAppGracePeriod     time.Duration
+		appDeletionPolicies        []string
+		queueAdminPort             int
+		eventJournalSize           int
+		agentQueueLimits           []string
+		agentQueueEventTTLs        []string
+		coalesceUpdates            bool
+		http2MaxConcurrentStreams  int
+		maxAgentConnections        int
+		connectionLimitPolicy      string
+		http2InitialWindowSize     int
+		http2InitialConnWindowSize int
+		alpnProtocols              []string
+		grpcCompression            string
+
+		numEventProcessors  int
+		shutdownGracePeriod time.Duration
+
+		heartbeatInterval    time.Duration
+		agentLivenessTimeout time.Duration
+		stateDigestInterval  time.Duration
+
+		// Named bundle of keepalive and heartbeat settings
+		transportPreset string
 
 		// OpenTelemetry configuration
 		otlpAddress  string
@@ -110,9 +251,11 @@ func NewPrincipalRunCommand() *cobra.Command {
 
 		destinationBasedMapping bool
 		labelSelector           string
+		syncLabelSelector       string
 
 		enableSelfClusterRegistration bool
 		selfRegClientCertSecretName   string
+		selfRegAllowedLabels          []string
 		// Redis TLS configuration
 		redisTLSEnabled               bool
 		redisProxyServerTLSCertPath   string
@@ -138,6 +281,10 @@ func NewPrincipalRunCommand() *cobra.Command {
 			ctx, cancelFn := context.WithCancel(context.Background())
 			defer cancelFn()
 
+			if err := principalTransportPresets.apply(c, transportPreset); err != nil {
+				cmdutil.Fatal("%v", err)
+			}
+
 			// Initialize OpenTelemetry tracing if enabled
 			if otlpAddress != "" {
 				shutdownTracer, err := tracing.InitTracer(ctx, "principal", otlpAddress, otlpInsecure)
@@ -194,6 +341,21 @@ func NewPrincipalRunCommand() *cobra.Command {
 
 			opts = append(opts, principal.WithListenerAddress(listenHost))
 			opts = append(opts, principal.WithListenerPort(listenPort))
+			opts = append(opts, principal.WithQUICListener(quicPort))
+			for _, l := range additionalListeners {
+				if l == "" {
+					continue
+				}
+				var certPath, keyPath string
+				addr, kp, hasKeyPair := strings.Cut(l, "=")
+				if hasKeyPair {
+					certPath, keyPath, err = tlsutil.ParseKeyPairPaths(kp)
+					if err != nil {
+						cmdutil.Fatal("Invalid additional listener %s: %v", l, err)
+					}
+				}
+				opts = append(opts, principal.WithAdditionalListener(addr, certPath, keyPath))
+			}
 			opts = append(opts, principal.WithGRPC(true))
 			nsLabels := make(map[string]string)
 			if len(autoNamespaceLabels) > 0 &&
@@ -211,23 +373,105 @@ func NewPrincipalRunCommand() *cobra.Command {
 
 			opts = append(opts, principal.WithNamespaces(allowedNamespaces...))
 
+			// Generate a PKI into the secrets the TLS configuration is loaded
+			// from below, unless they exist already.
+			if pkiBootstrap {
+				if insecurePlaintext || allowTLSGenerate || len(acmeHosts) > 0 || tlsCert != "" || tlsKey != "" || rootCaPath != "" {
+					cmdutil.Fatal("--pki-bootstrap requires the TLS certificate and root CA to be loaded from secrets")
+				}
+				logrus.Warn("INSECURE: Bootstrapping a self-signed PKI, which is not meant to be used in production")
+				bootstrapper, err := pki.NewBootstrapper(kubeConfig.Clientset, namespace, pki.Config{
+					CASecretName:       rootCaSecretName,
+					ServerSecretName:   tlsSecretName,
+					ClientSecretPrefix: config.SecretNameAgentClientCert,
+					DNSNames:           pkiDNSNames,
+					IPAddresses:        pkiIPAddresses,
+				})
+				if err != nil {
+					cmdutil.Fatal("Could not bootstrap PKI: %v", err)
+				}
+				caPEM, err := bootstrapper.Bootstrap(ctx, pkiBootstrapAgents...)
+				if err != nil {
+					cmdutil.Fatal("Could not bootstrap PKI: %v", err)
+				}
+				opts = append(opts, principal.WithCACertEndpoint(caPEM))
+			}
+
 			// Configure TLS or plaintext mode
 			if insecurePlaintext {
 				logrus.Warn("INSECURE: Running in plaintext mode - ensure Istio or similar service mesh provides mTLS")
 				opts = append(opts, principal.WithInsecurePlaintext())
+				if insecurePlaintextForce {
+					logrus.Warn("INSECURE: Plaintext mode is forced, the gRPC server may be reachable without TLS from outside the cluster")
+					opts = append(opts, principal.WithInsecurePlaintextForce())
+				}
 			} else if allowTLSGenerate {
 				logrus.Info("Using one-time generated TLS certificate for gRPC")
 				opts = append(opts, principal.WithGeneratedTLS("argocd-agent-principal--generated"))
+			} else if len(acmeHosts) > 0 {
+				logrus.Infof("Obtaining gRPC TLS certificates via ACME for %v", acmeHosts)
+				opts = append(opts, principal.WithACME(kubeConfig.Clientset, tlsutil.ACMEConfig{
+					Hosts:           acmeHosts,
+					Email:           acmeEmail,
+					DirectoryURL:    acmeDirectoryURL,
+					SecretNamespace: namespace,
+					SecretName:      acmeSecretName,
+				}))
 			} else if tlsCert != "" && tlsKey != "" {
 				logrus.Infof("Loading gRPC TLS configuration from files cert=%s and key=%s", tlsCert, tlsKey)
 				opts = append(opts, principal.WithTLSKeyPairFromPath(tlsCert, tlsKey))
 			} else if (tlsCert != "" && tlsKey == "") || (tlsCert == "" && tlsKey != "") {
 				cmdutil.Fatal("Both --tls-cert and --tls-key have to be given")
 			} else {
+				if certManagerIssuer != "" {
+					// The certificate is renewed in the secret, from where
+					// the server reloads it.
+					requester := certmanager.NewRequester(kubeConfig.DynamicClient, namespace, certmanager.IssuerRef{
+						Name:  certManagerIssuer,
+						Kind:  certManagerIssuerKind,
+						Group: certManagerIssuerGroup,
+					})
+					spec := certmanager.CertificateSpec{
+						DNSNames:    certManagerDNSNames,
+						IPAddresses: certManagerIPAddresses,
+						Usages:      []string{certmanager.UsageServerAuth, certmanager.UsageClientAuth},
+					}
+					if len(certManagerDNSNames) > 0 {
+						spec.CommonName = certManagerDNSNames[0]
+					}
+					logrus.Infof("Requesting gRPC TLS certificate from cert-manager %s %s", certManagerIssuerKind, certManagerIssuer)
+					if _, err := requester.EnsureSecret(ctx, kubeConfig.Clientset, tlsSecretName, spec); err != nil {
+						cmdutil.Fatal("Could not obtain TLS certificate from cert-manager: %v", err)
+					}
+					go requester.RenewSecret(ctx, kubeConfig.Clientset, tlsSecretName, spec, certmanager.DefaultRenewInterval)
+				}
 				logrus.Infof("Loading gRPC TLS certificate from secret %s/%s", namespace, tlsSecretName)
 				opts = append(opts, principal.WithTLSKeyPairFromSecret(kubeConfig.Clientset, namespace, tlsSecretName))
 			}
 
+			// Additional certificates served by SNI complement a configured
+			// keypair, but not a generated or ACME one.
+			if !insecurePlaintext && !allowTLSGenerate && len(acmeHosts) == 0 {
+				for _, name := range sniSecretNames {
+					if name == "" {
+						continue
+					}
+					logrus.Infof("Loading SNI TLS certificate from secret %s/%s", namespace, name)
+					opts = append(opts, principal.WithSNIKeyPairFromSecret(kubeConfig.Clientset, namespace, name))
+				}
+				for _, kp := range sniKeyPairs {
+					if kp == "" {
+						continue
+					}
+					certPath, keyPath, err := tlsutil.ParseKeyPairPaths(kp)
+					if err != nil {
+						cmdutil.Fatal("%v", err)
+					}
+					logrus.Infof("Loading SNI TLS configuration from files cert=%s and key=%s", certPath, keyPath)
+					opts = append(opts, principal.WithSNIKeyPairFromPath(certPath, keyPath))
+				}
+			}
+
 			// Only load root CA if not in plaintext mode
 			if !insecurePlaintext {
 				if rootCaPath != "" {
@@ -237,6 +481,18 @@ func NewPrincipalRunCommand() *cobra.Command {
 					logrus.Infof("Loading root CA certificate from secret %s/%s", namespace, rootCaSecretName)
 					opts = append(opts, principal.WithTLSRootCaFromSecret(kubeConfig.Clientset, namespace, rootCaSecretName, "tls.crt", "ca.crt"))
 				}
+				if clientCAPath != "" {
+					logrus.Infof("Loading client CA certificates from file %s", clientCAPath)
+					opts = append(opts, principal.WithClientCACert(clientCAPath))
+				}
+				if len(clientCertCRLs) > 0 || clientCertOCSP {
+					opts = append(opts, principal.WithClientCertRevocation(tlsutil.RevocationConfig{
+						CRLs:               clientCertCRLs,
+						CRLRefreshInterval: clientCertCRLRefresh,
+						OCSP:               clientCertOCSP,
+						SoftFail:           revocationSoftFail,
+					}))
+				}
 			}
 
 			opts = append(opts, principal.WithRequireClientCerts(requireClientCerts))
@@ -280,7 +536,30 @@ func NewPrincipalRunCommand() *cobra.Command {
 				opts = append(opts, principal.WithResourceProxyAddress(resourceProxyAddress))
 			}
 
-			if jwtKey != "" {
+			if jwtVaultKey != "" {
+				vaultConfig := vault.Config{
+					Address:   jwtVaultAddress,
+					KeyName:   jwtVaultKey,
+					MountPath: jwtVaultMount,
+				}
+				token, err := os.ReadFile(jwtVaultTokenPath)
+				if err != nil {
+					cmdutil.Fatal("Could not read Vault token: %v", err)
+				}
+				vaultConfig.Token = strings.TrimSpace(string(token))
+				if jwtVaultCAPath != "" {
+					vaultConfig.RootCAs, err = tlsutil.X509CertPoolFromFile(jwtVaultCAPath)
+					if err != nil {
+						cmdutil.Fatal("Could not load Vault CA: %v", err)
+					}
+				}
+				signer, err := vault.NewTransitSigner(ctx, vaultConfig)
+				if err != nil {
+					cmdutil.Fatal("Could not set up Vault Transit signer: %v", err)
+				}
+				logrus.Infof("Signing JWTs with Vault Transit key %s at %s", jwtVaultKey, jwtVaultAddress)
+				opts = append(opts, principal.WithTokenSigner(signer))
+			} else if jwtKey != "" {
 				logrus.Infof("Loading JWT signing key from file %s", jwtKey)
 				opts = append(opts, principal.WithTokenSigningKeyFromFile(jwtKey))
 			} else if allowJwtGenerate {
@@ -290,6 +569,11 @@ func NewPrincipalRunCommand() *cobra.Command {
 				logrus.Infof("Loading JWT signing key from secret %s/%s", namespace, jwtSecretName)
 				opts = append(opts, principal.WithTokenSigningKeyFromSecret(kubeConfig.Clientset, namespace, jwtSecretName))
 			}
+			opts = append(opts, principal.WithStrictKeyPolicy(requireSigningKey))
+			if jwtPreviousKeys != "" {
+				logrus.Infof("Loading previous JWT signing keys from file %s", jwtPreviousKeys)
+				opts = append(opts, principal.WithTokenVerificationKeysFromFile(jwtPreviousKeys))
+			}
 
 			authMethods := auth.NewMethods()
 			authMethod, authConfig, err := parseAuth(authMethod)
@@ -324,8 +608,14 @@ func NewPrincipalRunCommand() *cobra.Command {
 					opts = append(opts, principal.WithRequireClientCerts(true))
 				}
 			case "userpass":
+				// Credentials are read from a file if a path is given, and
+				// from labeled Secrets otherwise. Format: userpass:[<path>]
 				userauth := userpass.NewUserPassAuthentication(authConfig)
-				err = userauth.LoadAuthDataFromFile(authConfig)
+				if authConfig != "" {
+					err = userauth.LoadAuthDataFromFile(authConfig)
+				} else {
+					err = userauth.WatchSecrets(ctx, kubeConfig.Clientset, namespace, userpassSecretSelector)
+				}
 				if err != nil {
 					cmdutil.Fatal("Could not load user database: %v", err)
 				}
@@ -349,11 +639,214 @@ func NewPrincipalRunCommand() *cobra.Command {
 					cmdutil.Fatal("Could not register header auth method: %v", err)
 				}
 				logrus.Infof("Using header-based authentication (header: %s, pattern: %s)", headerName, extractionRegex.String())
+			case "serviceaccount":
+				// ServiceAccount token authentication validates projected tokens
+				// using the TokenReview API. Format: serviceaccount:[<regex>]
+				var regex *regexp.Regexp
+				if authConfig != "" {
+					regex, err = regexp.Compile(authConfig)
+					if err != nil {
+						cmdutil.Fatal("Error compiling serviceaccount agent id regex: %v", err)
+					}
+				}
+				saAuth := serviceaccount.NewServiceAccountAuthentication(kubeConfig.Clientset, saTokenAudiences, regex)
+				if err := saAuth.Init(); err != nil {
+					cmdutil.Fatal("Error initializing serviceaccount auth: %v", err)
+				}
+				err = authMethods.RegisterMethod("serviceaccount", saAuth)
+				if err != nil {
+					cmdutil.Fatal("Could not register serviceaccount auth method: %v", err)
+				}
+				logrus.Infof("Using ServiceAccount token authentication (audiences: %v, pattern: %s)", saTokenAudiences, authConfig)
+			case "oidc":
+				// OIDC authentication validates JWTs issued by an external
+				// identity provider. Format: oidc:<issuer-url>
+				opts = append(opts, principal.WithOIDCAuthentication(oidc.Config{
+					IssuerURL:  authConfig,
+					JWKSURL:    oidcJWKSURL,
+					Audience:   oidcAudience,
+					AgentClaim: oidcAgentClaim,
+				}))
+				logrus.Infof("Using OIDC authentication (issuer: %s, audience: %s, claim: %s)", authConfig, oidcAudience, oidcAgentClaim)
+			case "webhook":
+				// Webhook authentication delegates the decision to an external
+				// HTTPS endpoint. Format: webhook:<url>
+				var rootCAs *x509.CertPool
+				if authWebhookCAPath != "" {
+					rootCAs, err = tlsutil.X509CertPoolFromFile(authWebhookCAPath)
+					if err != nil {
+						cmdutil.Fatal("Could not load auth webhook CA: %v", err)
+					}
+				}
+				webhookAuth := webhook.NewWebhookAuthentication(authConfig, rootCAs, authWebhookTimeout)
+				if err := webhookAuth.Init(); err != nil {
+					cmdutil.Fatal("Error initializing webhook auth: %v", err)
+				}
+				err = authMethods.RegisterMethod("webhook", webhookAuth)
+				if err != nil {
+					cmdutil.Fatal("Could not register webhook auth method: %v", err)
+				}
+				logrus.Infof("Using webhook authentication (url: %s)", authConfig)
+			case "psk":
+				// Pre-shared key authentication verifies an HMAC using per-agent
+				// keys stored in Secrets. Format: psk:[<secret-prefix>]
+				pskAuth := psk.NewPSKAuthentication(kubeConfig.Clientset, namespace, authConfig)
+				if err := pskAuth.Init(); err != nil {
+					cmdutil.Fatal("Error initializing psk auth: %v", err)
+				}
+				err = authMethods.RegisterMethod("psk", pskAuth)
+				if err != nil {
+					cmdutil.Fatal("Could not register psk auth method: %v", err)
+				}
+				logrus.Infof("Using pre-shared key authentication (secret prefix: %s)", authConfig)
+			case "bootstrap":
+				// Bootstrap authentication onboards agents using one-time
+				// tokens and hands out pre-shared keys, which agents use with
+				// the psk auth method afterwards. Format: bootstrap:[<secret-prefix>]
+				opts = append(opts, principal.WithBootstrapAuthentication(authConfig))
+				logrus.Infof("Using bootstrap token onboarding (secret prefix: %s)", authConfig)
 			default:
 				cmdutil.Fatal("Unknown auth method: %s", authMethod)
 			}
 			opts = append(opts, principal.WithAuthMethods(authMethods))
 
+			opts = append(opts, principal.WithTokenValidity(accessTokenValidity, refreshTokenValidity))
+			opts = append(opts, principal.WithTokenScopes(tokenScopes))
+
+			// Agents can renew their client certificates through the
+			// principal, which either signs them with the root CA or has
+			// them issued by cert-manager.
+			switch agentCertIssuer {
+			case "":
+			case "ca":
+				ca, err := tlsutil.TLSCertFromSecret(ctx, kubeConfig.Clientset, namespace, rootCaSecretName)
+				if err != nil {
+					cmdutil.Fatal("Could not load CA for issuing agent certificates: %v", err)
+				}
+				signer, err := certificate.NewCASigner(ca)
+				if err != nil {
+					cmdutil.Fatal("Could not use CA for issuing agent certificates: %v", err)
+				}
+				logrus.Infof("Issuing agent client certificates with CA from secret %s/%s", namespace, rootCaSecretName)
+				opts = append(opts, principal.WithAgentCertificateSigner(signer, agentCertValidity))
+			case "cert-manager":
+				if certManagerIssuer == "" {
+					cmdutil.Fatal("--cert-manager-issuer is required when issuing agent certificates through cert-manager")
+				}
+				requester := certmanager.NewRequester(kubeConfig.DynamicClient, namespace, certmanager.IssuerRef{
+					Name:  certManagerIssuer,
+					Kind:  certManagerIssuerKind,
+					Group: certManagerIssuerGroup,
+				})
+				logrus.Infof("Issuing agent client certificates through cert-manager %s %s", certManagerIssuerKind, certManagerIssuer)
+				opts = append(opts, principal.WithAgentCertificateSigner(certificate.NewCertManagerSigner(requester), agentCertValidity))
+			default:
+				cmdutil.Fatal("Unknown agent certificate issuer: %s. Must be one of: ca, cert-manager", agentCertIssuer)
+			}
+
+			if authRateLimit > 0 || authMaxFailures > 0 {
+				opts = append(opts, principal.WithAuthRateLimit(authserver.RateLimitConfig{
+					MaxAttempts: authRateLimit,
+					MaxFailures: authMaxFailures,
+					Lockout:     authLockout,
+					MaxLockout:  authMaxLockout,
+				}))
+			}
+
+			if connectionStormWindow > 0 {
+				opts = append(opts, principal.WithConnectionStormProtection(connectionStormWindow, connectionStormRate))
+			}
+
+			if tokenRevocationConfigMap != "" {
+				opts = append(opts, principal.WithTokenRevocationConfigMap(tokenRevocationConfigMap))
+			}
+
+			if agentPolicyConfigMap != "" {
+				opts = append(opts, principal.WithAgentPolicyConfigMap(agentPolicyConfigMap))
+			}
+
+			if agentApprovalConfigMap != "" {
+				opts = append(opts, principal.WithAgentApprovalConfigMap(agentApprovalConfigMap))
+			}
+
+			if agentStoreSecret != "" {
+				var wrapper envelope.KeyWrapper
+				if agentStoreKeyPath != "" {
+					kw, err := envelope.NewAESKeyWrapperFromFile(agentStoreKeyPath)
+					if err != nil {
+						cmdutil.Fatal("Could not load agent store encryption key: %v", err)
+					}
+					wrapper = kw
+				}
+				opts = append(opts, principal.WithAgentStore(agentStoreSecret, wrapper))
+			} else if agentStoreKeyPath != "" {
+				cmdutil.Fatal("--agent-store-encryption-key-path requires --agent-store-secret")
+			}
+
+			if len(ipAllow) > 0 || len(ipDeny) > 0 {
+				opts = append(opts, principal.WithIPFilter(ipAllow, ipDeny))
+			}
+			if ipFilterConfigMap != "" {
+				opts = append(opts, principal.WithIPFilterConfigMap(ipFilterConfigMap))
+			}
+			if proxyProtocol {
+				opts = append(opts, principal.WithProxyProtocol(proxyProtocolTrusted))
+			}
+
+			var validators []admission.Validator
+			if appAdmissionSchema {
+				validators = append(validators, admission.SchemaValidator())
+			}
+			if len(appAdmissionDestinations) > 0 {
+				validators = append(validators, admission.DestinationAllowlist(appAdmissionDestinations))
+			}
+			if len(appAdmissionProjects) > 0 {
+				validators = append(validators, admission.ProjectAllowlist(appAdmissionProjects))
+			}
+			if appAdmissionWebhook != "" {
+				var rootCAs *x509.CertPool
+				if appAdmissionWebhookCAPath != "" {
+					rootCAs, err = tlsutil.X509CertPoolFromFile(appAdmissionWebhookCAPath)
+					if err != nil {
+						cmdutil.Fatal("Could not load admission webhook CA: %v", err)
+					}
+				}
+				webhookValidator, err := admission.NewWebhookValidator(appAdmissionWebhook, rootCAs, appAdmissionTimeout)
+				if err != nil {
+					cmdutil.Fatal("Could not set up admission webhook: %v", err)
+				}
+				validators = append(validators, webhookValidator)
+			}
+			if len(validators) > 0 {
+				opts = append(opts, principal.WithAppAdmission(admission.NewController(validators...)))
+			}
+
+			var auditSinks []audit.Sink
+			if auditLogFile != "" {
+				sink, err := audit.NewFileSink(auditLogFile)
+				if err != nil {
+					cmdutil.Fatal("Could not set up audit log: %v", err)
+				}
+				auditSinks = append(auditSinks, sink)
+			}
+			if auditLogWebhook != "" {
+				var rootCAs *x509.CertPool
+				if auditLogWebhookCAPath != "" {
+					rootCAs, err = tlsutil.X509CertPoolFromFile(auditLogWebhookCAPath)
+					if err != nil {
+						cmdutil.Fatal("Could not load audit webhook CA: %v", err)
+					}
+				}
+				sink, err := audit.NewWebhookSink(auditLogWebhook, rootCAs, 0)
+				if err != nil {
+					cmdutil.Fatal("Could not set up audit log webhook: %v", err)
+				}
+				auditSinks = append(auditSinks, sink)
+			}
+			if len(auditSinks) > 0 {
+				opts = append(opts, principal.WithAuditLogger(audit.NewLogger(auditSinks...)))
+			}
+
 			// In debug or higher log level, we start a little observer routine
 			// to get some insights.
 			if logrus.GetLevel() >= logrus.DebugLevel {
@@ -362,7 +855,11 @@ func NewPrincipalRunCommand() *cobra.Command {
 			}
 
 			opts = append(opts, principal.WithWebSocket(enableWebSocket))
+			opts = append(opts, principal.WithReflection(enableReflection))
 			opts = append(opts, principal.WithKeepAliveMinimumInterval(keepAliveMinimumInterval))
+			opts = append(opts, principal.WithKeepAlivePermitWithoutStream(keepAlivePermitWithoutStream))
+			opts = append(opts, principal.WithKeepAlive(keepAliveTime, keepAliveTimeout))
+			opts = append(opts, principal.WithRPCTimeouts(unaryTimeout, sendTimeout))
 			_, redisPassword, err := redisCreds(redisCredsDirPath, "", redisPassword)
 			if err != nil {
 				cmdutil.Fatal("Failed loading Redis credentials: %s", err.Error())
@@ -374,8 +871,98 @@ func NewPrincipalRunCommand() *cobra.Command {
 			opts = append(opts, principal.WithHealthzPort(healthzPort))
 			opts = append(opts, principal.WithDestinationBasedMapping(destinationBasedMapping))
 			opts = append(opts, principal.WithLabelSelector(labelSelector))
+			opts = append(opts, principal.WithSyncLabelSelector(syncLabelSelector))
 			opts = append(opts, principal.WithMaxGRPCMessageSize(maxGRPCMessageSize))
+			if http2MaxConcurrentStreams < 0 || int64(http2MaxConcurrentStreams) > math.MaxUint32 {
+				cmdutil.Fatal("Invalid HTTP/2 max concurrent streams: %d", http2MaxConcurrentStreams)
+			}
+			if http2InitialWindowSize < 0 || http2InitialWindowSize > math.MaxInt32 || http2InitialConnWindowSize < 0 || http2InitialConnWindowSize > math.MaxInt32 {
+				cmdutil.Fatal("HTTP/2 window sizes must be between 0 and %d", math.MaxInt32)
+			}
+			opts = append(opts, principal.WithHTTP2MaxConcurrentStreams(uint32(http2MaxConcurrentStreams)))
+			opts = append(opts, principal.WithHTTP2InitialWindowSizes(int32(http2InitialWindowSize), int32(http2InitialConnWindowSize)))
+			limitPolicy, err := connlimit.ParsePolicy(connectionLimitPolicy)
+			if err != nil {
+				cmdutil.Fatal("Invalid connection limit policy: %v", err)
+			}
+			opts = append(opts, principal.WithConnectionLimits(maxAgentConnections, limitPolicy))
+			if len(alpnProtocols) > 0 && (len(alpnProtocols) != 1 || alpnProtocols[0] != "") {
+				opts = append(opts, principal.WithALPNProtocols(alpnProtocols))
+			}
+			opts = append(opts, principal.WithCompression(grpcCompression))
+
+			if len(eventPayloadLimits) > 0 {
+				limits, err := event.ParsePayloadLimits(eventPayloadLimits)
+				if err != nil {
+					cmdutil.Fatal("Invalid event payload limits: %v", err)
+				}
+				opts = append(opts, principal.WithEventPayloadLimits(limits))
+			}
+
+			if len(agentBandwidthLimits) > 0 {
+				limits, err := eventstream.ParseBandwidthLimits(agentBandwidthLimits)
+				if err != nil {
+					cmdutil.Fatal("Invalid agent bandwidth limits: %v", err)
+				}
+				opts = append(opts, principal.WithAgentBandwidthLimits(limits))
+			}
+
+			if eventChunkSize != "" {
+				size, err := event.ParseChunkSize(eventChunkSize)
+				if err != nil {
+					cmdutil.Fatal("Invalid event chunk size: %v", err)
+				}
+				opts = append(opts, principal.WithEventChunkSize(size))
+			}
+			if payloadTransferThreshold != "" {
+				size, err := event.ParseTransferThreshold(payloadTransferThreshold)
+				if err != nil {
+					cmdutil.Fatal("Invalid payload transfer threshold: %v", err)
+				}
+				opts = append(opts, principal.WithPayloadTransferThreshold(size))
+			}
+			opts = append(opts, principal.WithEventBatchSize(eventBatchSize))
+			opts = append(opts, principal.WithEventBatchWindow(eventBatchWindow))
+			opts = append(opts, principal.WithDeltaEvents(deltaEvents))
+			opts = append(opts, principal.WithPayloadEncryption(payloadEncryption))
+			opts = append(opts, principal.WithPayloadEncryptionPSKFile(payloadEncryptionPSKPath))
+			opts = append(opts, principal.WithRepositoryFieldFilter(repoExcludedFields))
+			opts = append(opts, principal.WithRepositoryEncryptionKeyFile(repoEncryptionKeyPath))
+			opts = append(opts, principal.WithApplicationFieldFilters(appFieldFilters))
+			opts = append(opts, principal.WithArgoCDConfigKeys(argoCDConfigKeys))
+			opts = append(opts, principal.WithArgoCDResourceFilterSync(argoCDResourceFilters))
+			opts = append(opts, principal.WithArgoCDNotificationsSync(argoCDNotifications))
+			opts = append(opts, principal.WithOrphanedAppCleanup(orphanedAppPolicy, orphanedAppGracePeriod))
+			opts = append(opts, principal.WithAppDeletionPolicies(appDeletionPolicies))
+
+			if queueStorageDir != "" {
+				opts = append(opts, principal.WithQueueStorageDir(queueStorageDir))
+			}
+			opts = append(opts, principal.WithQueueAdminPort(queueAdminPort))
+			opts = append(opts, principal.WithEventJournalSize(eventJournalSize))
+			opts = append(opts, principal.WithQueueBackend(queueBackend))
+
+			if len(agentQueueLimits) > 0 {
+				limits, err := queue.ParseLimits(agentQueueLimits)
+				if err != nil {
+					cmdutil.Fatal("Invalid agent queue limits: %v", err)
+				}
+				opts = append(opts, principal.WithAgentQueueLimits(limits))
+			}
+			if len(agentQueueEventTTLs) > 0 {
+				ttls, err := queue.ParseTTLs(agentQueueEventTTLs)
+				if err != nil {
+					cmdutil.Fatal("Invalid agent queue event TTLs: %v", err)
+				}
+				opts = append(opts, principal.WithAgentQueueTTLs(ttls))
+			}
+			opts = append(opts, principal.WithUpdateCoalescing(coalesceUpdates))
+
 			opts = append(opts, principal.WithEventProcessors(int64(numEventProcessors)))
+			opts = append(opts, principal.WithShutDownGracePeriod(shutdownGracePeriod))
+			opts = append(opts, principal.WithHeartbeatInterval(heartbeatInterval))
+			opts = append(opts, principal.WithAgentLivenessTimeout(agentLivenessTimeout))
+			opts = append(opts, principal.WithStateDigestInterval(stateDigestInterval))
 
 			// Self agent registration validation and options
 			if enableSelfClusterRegistration {
@@ -390,6 +977,7 @@ func NewPrincipalRunCommand() *cobra.Command {
 			if selfRegClientCertSecretName != "" {
 				opts = append(opts, principal.WithClientCertSecretName(selfRegClientCertSecretName))
 			}
+			opts = append(opts, principal.WithSelfRegistrationAllowedLabels(selfRegAllowedLabels))
 
 			// Configure Redis TLS
 			opts = append(opts, principal.WithRedisTLSEnabled(redisTLSEnabled))
@@ -469,7 +1057,17 @@ func NewPrincipalRunCommand() *cobra.Command {
 			if err != nil {
 				cmdutil.Fatal("Could not start server: %v", err)
 			}
-			<-ctx.Done()
+
+			sigCh := make(chan os.Signal, 1)
+			signal.Notify(sigCh, syscall.SIGTERM, os.Interrupt)
+			select {
+			case <-ctx.Done():
+			case sig := <-sigCh:
+				logrus.Infof("Received %s, shutting down", sig)
+				if err := s.Shutdown(); err != nil {
+					logrus.WithError(err).Error("Error during shutdown")
+				}
+			}
 		},
 	}
 	command.Flags().StringVar(&listenHost, "listen-host",
@@ -478,6 +1076,12 @@ func NewPrincipalRunCommand() *cobra.Command {
 	command.Flags().IntVar(&listenPort, "listen-port",
 		env.NumWithDefault("ARGOCD_PRINCIPAL_LISTEN_PORT", cmdutil.ValidPort, 8443),
 		"Port the gRPC server will listen on")
+	command.Flags().StringSliceVar(&additionalListeners, "additional-listeners",
+		env.StringSliceWithDefault("ARGOCD_PRINCIPAL_ADDITIONAL_LISTENERS", nil, []string{}),
+		"Additional addresses the gRPC server will listen on, as <host>:<port>, optionally followed by =<cert path>:<key path> to serve a different TLS certificate")
+	command.Flags().IntVar(&quicPort, "quic-port",
+		env.NumWithDefault("ARGOCD_PRINCIPAL_QUIC_PORT", cmdutil.ValidPort, 0),
+		"EXPERIMENTAL: UDP port the gRPC server will accept agents connecting over QUIC on. Disabled if 0")
 
 	command.Flags().StringSliceVar(&logLevels, "log-level",
 		env.StringSliceWithDefault("ARGOCD_PRINCIPAL_LOG_LEVEL", nil, []string{"info"}),
@@ -518,18 +1122,81 @@ func NewPrincipalRunCommand() *cobra.Command {
 	command.Flags().StringVar(&tlsKey, "tls-key",
 		env.StringWithDefault("ARGOCD_PRINCIPAL_TLS_SERVER_KEY_PATH", nil, ""),
 		"Use TLS private key from path")
+	command.Flags().BoolVar(&pkiBootstrap, "pki-bootstrap",
+		env.BoolWithDefault("ARGOCD_PRINCIPAL_PKI_BOOTSTRAP", false),
+		"INSECURE: Generate a self-signed CA and certificates into the TLS secrets if they do not exist, and publish the CA on the healthz server")
+	command.Flags().StringSliceVar(&pkiBootstrapAgents, "pki-bootstrap-agents",
+		env.StringSliceWithDefault("ARGOCD_PRINCIPAL_PKI_BOOTSTRAP_AGENTS", nil, []string{}),
+		"Names of agents to generate client certificates for when bootstrapping the PKI")
+	command.Flags().StringSliceVar(&pkiDNSNames, "pki-dns-names",
+		env.StringSliceWithDefault("ARGOCD_PRINCIPAL_PKI_DNS_NAMES", nil, []string{}),
+		"DNS names of the server certificate generated when bootstrapping the PKI")
+	command.Flags().StringSliceVar(&pkiIPAddresses, "pki-ip-addresses",
+		env.StringSliceWithDefault("ARGOCD_PRINCIPAL_PKI_IP_ADDRESSES", nil, []string{}),
+		"IP addresses of the server certificate generated when bootstrapping the PKI")
+	command.Flags().StringSliceVar(&sniSecretNames, "tls-sni-secret-names",
+		env.StringSliceWithDefault("ARGOCD_PRINCIPAL_TLS_SNI_SECRET_NAMES", nil, []string{}),
+		"Names of secrets with additional TLS certificates, served to agents requesting one of their names via SNI")
+	command.Flags().StringSliceVar(&sniKeyPairs, "tls-sni-keypairs",
+		env.StringSliceWithDefault("ARGOCD_PRINCIPAL_TLS_SNI_KEYPAIRS", nil, []string{}),
+		"Additional TLS certificates as <cert path>:<key path>, served to agents requesting one of their names via SNI")
+	command.Flags().StringVar(&certManagerIssuer, "cert-manager-issuer",
+		env.StringWithDefault("ARGOCD_PRINCIPAL_CERT_MANAGER_ISSUER", nil, ""),
+		"Request the TLS certificate from this cert-manager issuer and renew it in the TLS secret")
+	command.Flags().StringVar(&certManagerIssuerKind, "cert-manager-issuer-kind",
+		env.StringWithDefault("ARGOCD_PRINCIPAL_CERT_MANAGER_ISSUER_KIND", nil, certmanager.DefaultIssuerKind),
+		"Kind of the cert-manager issuer, e.g. Issuer or ClusterIssuer")
+	command.Flags().StringVar(&certManagerIssuerGroup, "cert-manager-issuer-group",
+		env.StringWithDefault("ARGOCD_PRINCIPAL_CERT_MANAGER_ISSUER_GROUP", nil, certmanager.DefaultIssuerGroup),
+		"API group of the cert-manager issuer")
+	command.Flags().StringSliceVar(&certManagerDNSNames, "cert-manager-dns-names",
+		env.StringSliceWithDefault("ARGOCD_PRINCIPAL_CERT_MANAGER_DNS_NAMES", nil, []string{}),
+		"DNS names to request the TLS certificate from cert-manager for")
+	command.Flags().StringSliceVar(&certManagerIPAddresses, "cert-manager-ip-addresses",
+		env.StringSliceWithDefault("ARGOCD_PRINCIPAL_CERT_MANAGER_IP_ADDRESSES", nil, []string{}),
+		"IP addresses to request the TLS certificate from cert-manager for")
+	command.Flags().StringSliceVar(&acmeHosts, "acme-hosts",
+		env.StringSliceWithDefault("ARGOCD_PRINCIPAL_ACME_HOSTS", nil, []string{}),
+		"Obtain TLS certificates for these host names via ACME instead of using a TLS secret or files")
+	command.Flags().StringVar(&acmeEmail, "acme-email",
+		env.StringWithDefault("ARGOCD_PRINCIPAL_ACME_EMAIL", nil, ""),
+		"Contact email address for the ACME account")
+	command.Flags().StringVar(&acmeDirectoryURL, "acme-directory-url",
+		env.StringWithDefault("ARGOCD_PRINCIPAL_ACME_DIRECTORY_URL", nil, acme.LetsEncryptURL),
+		"URL of the ACME directory to obtain certificates from")
+	command.Flags().StringVar(&acmeSecretName, "acme-secret-name",
+		env.StringWithDefault("ARGOCD_PRINCIPAL_ACME_SECRET_NAME", nil, config.SecretNamePrincipalACME),
+		"Secret name to store the ACME account key and certificates in")
 	command.Flags().BoolVar(&allowTLSGenerate, "insecure-tls-generate",
 		env.BoolWithDefault("ARGOCD_PRINCIPAL_TLS_SERVER_ALLOW_GENERATE", false),
 		"INSECURE: Generate and use temporary TLS cert and key")
 	command.Flags().BoolVar(&insecurePlaintext, "insecure-plaintext",
 		env.BoolWithDefault("ARGOCD_PRINCIPAL_INSECURE_PLAINTEXT", false),
 		"INSECURE: Run gRPC server without TLS (use with Istio or similar service mesh)")
+	command.Flags().BoolVar(&insecurePlaintextForce, "insecure-plaintext-force",
+		env.BoolWithDefault("ARGOCD_PRINCIPAL_INSECURE_PLAINTEXT_FORCE", false),
+		"INSECURE: Allow the plaintext gRPC server to listen on addresses other than loopback and private addresses")
 	command.Flags().StringVar(&rootCaSecretName, "tls-ca-secret-name",
 		env.StringWithDefault("ARGOCD_PRINCIPAL_TLS_SERVER_ROOT_CA_SECRET_NAME", nil, config.SecretNamePrincipalCA),
 		"Secret name of TLS CA certificate")
 	command.Flags().StringVar(&rootCaPath, "root-ca-path",
 		env.StringWithDefault("ARGOCD_PRINCIPAL_TLS_SERVER_ROOT_CA_PATH", nil, ""),
 		"Path to a file containing the root CA certificate for verifying client certs of agents")
+	command.Flags().StringVar(&clientCAPath, "client-ca-path",
+		env.StringWithDefault("ARGOCD_PRINCIPAL_TLS_CLIENT_CA_PATH", nil, ""),
+		"Path to a file containing a dedicated CA bundle for verifying client certs of agents, reloaded on change")
+	command.Flags().StringSliceVar(&clientCertCRLs, "client-cert-crl",
+		env.StringSliceWithDefault("ARGOCD_PRINCIPAL_TLS_CLIENT_CERT_CRL", nil, []string{}),
+		"Paths or URLs of certificate revocation lists to check client certs of agents against")
+	command.Flags().DurationVar(&clientCertCRLRefresh, "client-cert-crl-refresh-interval",
+		env.DurationWithDefault("ARGOCD_PRINCIPAL_TLS_CLIENT_CERT_CRL_REFRESH_INTERVAL", nil, tlsutil.DefaultCRLRefreshInterval),
+		"Interval in which the certificate revocation lists are reloaded")
+	command.Flags().BoolVar(&clientCertOCSP, "client-cert-ocsp",
+		env.BoolWithDefault("ARGOCD_PRINCIPAL_TLS_CLIENT_CERT_OCSP", false),
+		"Whether to check client certs of agents against the OCSP responder named in the cert")
+	command.Flags().BoolVar(&revocationSoftFail, "client-cert-revocation-soft-fail",
+		env.BoolWithDefault("ARGOCD_PRINCIPAL_TLS_CLIENT_CERT_REVOCATION_SOFT_FAIL", false),
+		"Whether to accept client certs whose revocation status cannot be determined")
 	command.Flags().BoolVar(&requireClientCerts, "require-client-certs",
 		env.BoolWithDefault("ARGOCD_PRINCIPAL_TLS_CLIENT_CERT_REQUIRE", false),
 		"Whether to require agents to present a client certificate")
@@ -569,13 +1236,145 @@ func NewPrincipalRunCommand() *cobra.Command {
 	command.Flags().StringVar(&jwtKey, "jwt-key",
 		env.StringWithDefault("ARGOCD_PRINCIPAL_JWT_KEY_PATH", nil, ""),
 		"Use JWT signing key from path")
+	command.Flags().StringVar(&jwtPreviousKeys, "jwt-previous-keys",
+		env.StringWithDefault("ARGOCD_PRINCIPAL_JWT_PREVIOUS_KEYS_PATH", nil, ""),
+		"Path to a PEM file with previous JWT signing keys that are still accepted for token validation")
+	command.Flags().StringVar(&jwtVaultAddress, "jwt-vault-address",
+		env.StringWithDefault("ARGOCD_PRINCIPAL_JWT_VAULT_ADDRESS", nil, ""),
+		"Address of the Vault server to sign JWTs with")
+	command.Flags().StringVar(&jwtVaultKey, "jwt-vault-key",
+		env.StringWithDefault("ARGOCD_PRINCIPAL_JWT_VAULT_KEY", nil, ""),
+		"Name of the Vault Transit key to sign JWTs with. If set, no local signing key is used")
+	command.Flags().StringVar(&jwtVaultMount, "jwt-vault-mount",
+		env.StringWithDefault("ARGOCD_PRINCIPAL_JWT_VAULT_MOUNT", nil, vault.DefaultMountPath),
+		"Path the Vault Transit secrets engine is mounted at")
+	command.Flags().StringVar(&jwtVaultTokenPath, "jwt-vault-token-path",
+		env.StringWithDefault("ARGOCD_PRINCIPAL_JWT_VAULT_TOKEN_PATH", nil, ""),
+		"Path to a file containing the token to authenticate to Vault with")
+	command.Flags().StringVar(&jwtVaultCAPath, "jwt-vault-ca-path",
+		env.StringWithDefault("ARGOCD_PRINCIPAL_JWT_VAULT_CA_PATH", nil, ""),
+		"Path to a file containing the CA certificate(s) to verify Vault with. Uses system roots if empty")
 	command.Flags().BoolVar(&allowJwtGenerate, "insecure-jwt-generate",
 		env.BoolWithDefault("ARGOCD_PRINCIPAL_JWT_ALLOW_GENERATE", false),
 		"INSECURE: Generate and use temporary JWT signing key")
+	command.Flags().BoolVar(&requireSigningKey, "require-signing-key",
+		env.BoolWithDefault("ARGOCD_PRINCIPAL_REQUIRE_SIGNING_KEY", false),
+		"Refuse to start with a temporary JWT signing key")
 
 	command.Flags().StringVar(&authMethod, "auth",
 		env.StringWithDefault("ARGOCD_PRINCIPAL_AUTH", nil, ""),
 		"Authentication method and the corresponding configuration")
+	command.Flags().StringSliceVar(&saTokenAudiences, "auth-token-audiences",
+		env.StringSliceWithDefault("ARGOCD_PRINCIPAL_AUTH_TOKEN_AUDIENCES", nil, []string{}),
+		"Audiences a ServiceAccount token presented by an agent must be valid for")
+	command.Flags().StringVar(&userpassSecretSelector, "auth-userpass-secret-selector",
+		env.StringWithDefault("ARGOCD_PRINCIPAL_AUTH_USERPASS_SECRET_SELECTOR", nil, userpass.DefaultSecretSelector),
+		"Label selector of the Secrets holding credentials for the userpass auth method, if no path is given")
+	command.Flags().StringVar(&oidcJWKSURL, "oidc-jwks-url",
+		env.StringWithDefault("ARGOCD_PRINCIPAL_OIDC_JWKS_URL", nil, ""),
+		"URL of the OIDC identity provider's JWKS. If empty, it is discovered from the issuer")
+	command.Flags().StringVar(&oidcAudience, "oidc-audience",
+		env.StringWithDefault("ARGOCD_PRINCIPAL_OIDC_AUDIENCE", nil, ""),
+		"Audience an OIDC token presented by an agent must be issued for")
+	command.Flags().StringVar(&oidcAgentClaim, "oidc-agent-claim",
+		env.StringWithDefault("ARGOCD_PRINCIPAL_OIDC_AGENT_CLAIM", nil, oidc.DefaultAgentClaim),
+		"Name of the OIDC token claim holding the agent's name")
+	command.Flags().StringVar(&authWebhookCAPath, "auth-webhook-ca-path",
+		env.StringWithDefault("ARGOCD_PRINCIPAL_AUTH_WEBHOOK_CA_PATH", nil, ""),
+		"Path to a file containing the CA certificate(s) to verify the auth webhook with. Uses system roots if empty")
+	command.Flags().DurationVar(&authWebhookTimeout, "auth-webhook-timeout",
+		env.DurationWithDefault("ARGOCD_PRINCIPAL_AUTH_WEBHOOK_TIMEOUT", nil, webhook.DefaultTimeout),
+		"Timeout for requests to the auth webhook")
+	command.Flags().IntVar(&authRateLimit, "auth-rate-limit",
+		env.NumWithDefault("ARGOCD_PRINCIPAL_AUTH_RATE_LIMIT", nil, 0),
+		"Maximum number of authentication attempts per minute per source address and client ID. Disabled if 0")
+	command.Flags().IntVar(&authMaxFailures, "auth-max-failures",
+		env.NumWithDefault("ARGOCD_PRINCIPAL_AUTH_MAX_FAILURES", nil, 0),
+		"Number of consecutive failed authentication attempts after which the source address or client ID is locked out. Disabled if 0")
+	command.Flags().DurationVar(&authLockout, "auth-lockout",
+		env.DurationWithDefault("ARGOCD_PRINCIPAL_AUTH_LOCKOUT", nil, 30*time.Second),
+		"Duration of the first lockout after too many failed authentication attempts. Doubles with each subsequent lockout")
+	command.Flags().DurationVar(&authMaxLockout, "auth-max-lockout",
+		env.DurationWithDefault("ARGOCD_PRINCIPAL_AUTH_MAX_LOCKOUT", nil, 15*time.Minute),
+		"Maximum duration of a lockout after too many failed authentication attempts")
+	command.Flags().DurationVar(&connectionStormWindow, "connection-storm-window",
+		env.DurationWithDefault("ARGOCD_PRINCIPAL_CONNECTION_STORM_WINDOW", nil, 0),
+		"How long after startup the rate of agent connections is limited. Disabled if 0")
+	command.Flags().Float64Var(&connectionStormRate, "connection-storm-rate",
+		env.FloatWithDefault("ARGOCD_PRINCIPAL_CONNECTION_STORM_RATE", nil, 10),
+		"Maximum number of agent authentication attempts per second during the connection storm window")
+	command.Flags().DurationVar(&accessTokenValidity, "access-token-validity",
+		env.DurationWithDefault("ARGOCD_PRINCIPAL_ACCESS_TOKEN_VALIDITY", nil, authserver.DefaultAccessTokenValidity),
+		"Lifetime of the access tokens issued to agents")
+	command.Flags().DurationVar(&refreshTokenValidity, "refresh-token-validity",
+		env.DurationWithDefault("ARGOCD_PRINCIPAL_REFRESH_TOKEN_VALIDITY", nil, authserver.DefaultRefreshTokenValidity),
+		"Lifetime of the refresh tokens issued to agents. Must be longer than the access token validity")
+	command.Flags().StringSliceVar(&tokenScopes, "token-scopes",
+		env.StringSliceWithDefault("ARGOCD_PRINCIPAL_TOKEN_SCOPES", nil, issuer.DefaultScopes),
+		"Capability scopes granted to agents in their tokens ("+strings.Join(issuer.DefaultScopes, ", ")+")")
+	command.Flags().StringVar(&agentCertIssuer, "agent-cert-issuer",
+		env.StringWithDefault("ARGOCD_PRINCIPAL_AGENT_CERT_ISSUER", nil, ""),
+		"Issue client certificates to agents from their CSRs, signed by the root CA (ca) or through cert-manager (cert-manager). Disabled if empty")
+	command.Flags().DurationVar(&agentCertValidity, "agent-cert-validity",
+		env.DurationWithDefault("ARGOCD_PRINCIPAL_AGENT_CERT_VALIDITY", nil, certificate.DefaultValidity),
+		"Lifetime of the client certificates issued to agents")
+	command.Flags().StringVar(&tokenRevocationConfigMap, "token-revocation-configmap",
+		env.StringWithDefault("ARGOCD_PRINCIPAL_TOKEN_REVOCATION_CONFIGMAP", nil, ""),
+		"Name of the ConfigMap holding the list of revoked agent tokens. Revocation is disabled if empty")
+	command.Flags().StringVar(&agentPolicyConfigMap, "agent-policy-configmap",
+		env.StringWithDefault("ARGOCD_PRINCIPAL_AGENT_POLICY_CONFIGMAP", nil, ""),
+		"Name of the ConfigMap holding policies that restrict the events each agent may send and receive. All events are allowed if empty")
+	command.Flags().StringVar(&agentApprovalConfigMap, "agent-approval-configmap",
+		env.StringWithDefault("ARGOCD_PRINCIPAL_AGENT_APPROVAL_CONFIGMAP", nil, ""),
+		"Name of the ConfigMap recording the registration state of agents. If set, new agents must be approved before they may connect")
+	command.Flags().StringVar(&agentStoreSecret, "agent-store-secret",
+		env.StringWithDefault("ARGOCD_PRINCIPAL_AGENT_STORE_SECRET", nil, ""),
+		"Name of the Secret persisting the agents known to the principal across restarts. Agents are only kept in memory if empty")
+	command.Flags().StringVar(&agentStoreKeyPath, "agent-store-encryption-key-path",
+		env.StringWithDefault("ARGOCD_PRINCIPAL_AGENT_STORE_ENCRYPTION_KEY_PATH", nil, ""),
+		"Path to a file holding a base64 encoded 32 byte key used to encrypt the agent store")
+	command.Flags().StringSliceVar(&ipAllow, "allowed-source-ranges",
+		env.StringSliceWithDefault("ARGOCD_PRINCIPAL_ALLOWED_SOURCE_RANGES", nil, []string{}),
+		"CIDRs or IP addresses agents may connect from. Connections from all addresses are accepted if empty")
+	command.Flags().StringSliceVar(&ipDeny, "denied-source-ranges",
+		env.StringSliceWithDefault("ARGOCD_PRINCIPAL_DENIED_SOURCE_RANGES", nil, []string{}),
+		"CIDRs or IP addresses agents may not connect from. Takes precedence over the allowed ranges")
+	command.Flags().StringVar(&ipFilterConfigMap, "source-ranges-configmap",
+		env.StringWithDefault("ARGOCD_PRINCIPAL_SOURCE_RANGES_CONFIGMAP", nil, ""),
+		"Name of a ConfigMap that, while it exists, replaces the allowed and denied source ranges at runtime")
+	command.Flags().BoolVar(&proxyProtocol, "proxy-protocol",
+		env.BoolWithDefault("ARGOCD_PRINCIPAL_PROXY_PROTOCOL", false),
+		"Whether to read the agent's address from a PROXY protocol header sent by a load balancer")
+	command.Flags().StringSliceVar(&proxyProtocolTrusted, "proxy-protocol-trusted-ranges",
+		env.StringSliceWithDefault("ARGOCD_PRINCIPAL_PROXY_PROTOCOL_TRUSTED_RANGES", nil, []string{}),
+		"CIDRs or IP addresses of load balancers trusted to send PROXY protocol headers. All connections must send a header if empty")
+	command.Flags().BoolVar(&appAdmissionSchema, "app-admission-schema",
+		env.BoolWithDefault("ARGOCD_PRINCIPAL_APP_ADMISSION_SCHEMA", false),
+		"Reject malformed Applications received from autonomous agents")
+	command.Flags().StringSliceVar(&appAdmissionDestinations, "app-admission-allowed-destinations",
+		env.StringSliceWithDefault("ARGOCD_PRINCIPAL_APP_ADMISSION_ALLOWED_DESTINATIONS", nil, []string{}),
+		"Destinations (<server-or-name>/<namespace>) Applications from autonomous agents may deploy to. All destinations are allowed if empty")
+	command.Flags().StringSliceVar(&appAdmissionProjects, "app-admission-allowed-projects",
+		env.StringSliceWithDefault("ARGOCD_PRINCIPAL_APP_ADMISSION_ALLOWED_PROJECTS", nil, []string{}),
+		"Projects Applications from autonomous agents may belong to. All projects are allowed if empty")
+	command.Flags().StringVar(&appAdmissionWebhook, "app-admission-webhook",
+		env.StringWithDefault("ARGOCD_PRINCIPAL_APP_ADMISSION_WEBHOOK", nil, ""),
+		"HTTPS URL of a webhook that decides whether Applications from autonomous agents are admitted")
+	command.Flags().StringVar(&appAdmissionWebhookCAPath, "app-admission-webhook-ca-path",
+		env.StringWithDefault("ARGOCD_PRINCIPAL_APP_ADMISSION_WEBHOOK_CA_PATH", nil, ""),
+		"Path to a CA certificate used to verify the admission webhook's certificate")
+	command.Flags().DurationVar(&appAdmissionTimeout, "app-admission-webhook-timeout",
+		env.DurationWithDefault("ARGOCD_PRINCIPAL_APP_ADMISSION_WEBHOOK_TIMEOUT", nil, admission.DefaultWebhookTimeout),
+		"Timeout for requests to the admission webhook")
+	command.Flags().StringVar(&auditLogFile, "audit-log-file",
+		env.StringWithDefault("ARGOCD_PRINCIPAL_AUDIT_LOG_FILE", nil, ""),
+		"Path of the file to write the audit log to, or - for stdout")
+	command.Flags().StringVar(&auditLogWebhook, "audit-log-webhook",
+		env.StringWithDefault("ARGOCD_PRINCIPAL_AUDIT_LOG_WEBHOOK", nil, ""),
+		"URL of a webhook to send audit events to")
+	command.Flags().StringVar(&auditLogWebhookCAPath, "audit-log-webhook-ca-path",
+		env.StringWithDefault("ARGOCD_PRINCIPAL_AUDIT_LOG_WEBHOOK_CA_PATH", nil, ""),
+		"Path to a CA certificate used to verify the audit log webhook's certificate")
 
 	command.Flags().BoolVar(&enableWebSocket, "enable-websocket",
 		env.BoolWithDefault("ARGOCD_PRINCIPAL_ENABLE_WEBSOCKET", false),
@@ -591,6 +1390,21 @@ func NewPrincipalRunCommand() *cobra.Command {
 	command.Flags().DurationVar(&keepAliveMinimumInterval, "keepalive-min-interval",
 		env.DurationWithDefault("ARGOCD_PRINCIPAL_KEEP_ALIVE_MIN_INTERVAL", nil, 0),
 		"Drop agent connections that send keepalive pings more often than the specified interval") // It should be less than "keep-alive-ping-interval" of agent
+	command.Flags().BoolVar(&keepAlivePermitWithoutStream, "keepalive-permit-without-stream",
+		env.BoolWithDefault("ARGOCD_PRINCIPAL_KEEP_ALIVE_PERMIT_WITHOUT_STREAM", false),
+		"Allow agents to send keepalive pings even when there are no active streams")
+	command.Flags().DurationVar(&keepAliveTime, "keepalive-time",
+		env.DurationWithDefault("ARGOCD_PRINCIPAL_KEEP_ALIVE_TIME", nil, 0),
+		"Ping agent connections that have been idle for the specified interval (0 to disable)")
+	command.Flags().DurationVar(&keepAliveTimeout, "keepalive-timeout",
+		env.DurationWithDefault("ARGOCD_PRINCIPAL_KEEP_ALIVE_TIMEOUT", nil, 0),
+		"Close agent connections that do not acknowledge a keepalive ping within the specified duration (0 for the default of 20s)")
+	command.Flags().DurationVar(&unaryTimeout, "grpc-unary-timeout",
+		env.DurationWithDefault("ARGOCD_PRINCIPAL_GRPC_UNARY_TIMEOUT", nil, principal.DefaultUnaryTimeout),
+		"Deadline of unary gRPC calls such as Authenticate and Version (0 to disable)")
+	command.Flags().DurationVar(&sendTimeout, "event-send-timeout",
+		env.DurationWithDefault("ARGOCD_PRINCIPAL_EVENT_SEND_TIMEOUT", nil, principal.DefaultSendTimeout),
+		"Disconnect agents that do not accept an event within the specified duration (0 to disable)")
 
 	command.Flags().StringVar(&redisAddress, "redis-server-address",
 		env.StringWithDefault("ARGOCD_PRINCIPAL_REDIS_SERVER_ADDRESS", nil, "argocd-redis:6379"),
@@ -612,6 +1426,9 @@ func NewPrincipalRunCommand() *cobra.Command {
 	command.Flags().IntVar(&pprofPort, "pprof-port",
 		env.NumWithDefault("ARGOCD_PRINCIPAL_PPROF_PORT", cmdutil.ValidPort, 0),
 		"Port the pprof server will listen on")
+	command.Flags().BoolVar(&enableReflection, "enable-reflection",
+		env.BoolWithDefault("ARGOCD_PRINCIPAL_ENABLE_REFLECTION", false),
+		"Register the gRPC reflection service for debugging with tools like grpcurl")
 	command.Flags().IntVar(&healthzPort, "healthz-port",
 		env.NumWithDefault("ARGOCD_PRINCIPAL_HEALTH_CHECK_PORT", cmdutil.ValidPort, 8003),
 		"Port the health check server will listen on")
@@ -619,6 +1436,117 @@ func NewPrincipalRunCommand() *cobra.Command {
 	command.Flags().IntVar(&maxGRPCMessageSize, "grpc-max-message-size",
 		env.NumWithDefault("ARGOCD_PRINCIPAL_GRPC_MAX_MESSAGE_SIZE", nil, grpcutil.DefaultGRPCMaxMessageSize),
 		"Maximum gRPC message size in bytes for send and receive (default: 200MB)")
+	command.Flags().StringSliceVar(&eventPayloadLimits, "event-payload-limits",
+		env.StringSliceWithDefault("ARGOCD_PRINCIPAL_EVENT_PAYLOAD_LIMITS", nil, []string{}),
+		"Maximum event payload sizes per event target, e.g. default=4Mi,application=1Mi. Payloads are unlimited if empty")
+	command.Flags().StringSliceVar(&agentBandwidthLimits, "agent-bandwidth-limits",
+		env.StringSliceWithDefault("ARGOCD_PRINCIPAL_AGENT_BANDWIDTH_LIMITS", nil, []string{}),
+		"Maximum bytes per second sent to each agent, e.g. default=10Mi,agent-a=1Mi. Bandwidth is unlimited if empty")
+	command.Flags().StringVar(&eventChunkSize, "event-chunk-size",
+		env.StringWithDefault("ARGOCD_PRINCIPAL_EVENT_CHUNK_SIZE", nil, "0"),
+		"Send events larger than this size to agents in chunks of this size, e.g. 64Ki. Set to 0 to disable chunking")
+	command.Flags().StringVar(&payloadTransferThreshold, "payload-transfer-threshold",
+		env.StringWithDefault("ARGOCD_PRINCIPAL_PAYLOAD_TRANSFER_THRESHOLD", nil, "0"),
+		"Transfer event payloads larger than this size, e.g. 1Mi, to agents out of band instead of on the event stream. Set to 0 to disable")
+	command.Flags().IntVar(&eventBatchSize, "event-batch-size",
+		env.NumWithDefault("ARGOCD_PRINCIPAL_EVENT_BATCH_SIZE", nil, 1),
+		"Maximum number of events sent to an agent in a single message. Set to 1 to disable batching")
+	command.Flags().DurationVar(&eventBatchWindow, "event-batch-window",
+		env.DurationWithDefault("ARGOCD_PRINCIPAL_EVENT_BATCH_WINDOW", nil, 0),
+		"Hold back updates to an application for this long, e.g. 200ms, to send successive updates to an agent as a single event. Set to 0 to disable")
+	command.Flags().BoolVar(&deltaEvents, "delta-events",
+		env.BoolWithDefault("ARGOCD_PRINCIPAL_DELTA_EVENTS", false),
+		"Send application events to agents as patches against the version they acknowledged last, instead of the full object")
+	command.Flags().BoolVar(&payloadEncryption, "payload-encryption",
+		env.BoolWithDefault("ARGOCD_PRINCIPAL_PAYLOAD_ENCRYPTION", false),
+		"Require agents to encrypt the payload of events with a key negotiated during authentication")
+	command.Flags().StringVar(&payloadEncryptionPSKPath, "payload-encryption-psk-path",
+		env.StringWithDefault("ARGOCD_PRINCIPAL_PAYLOAD_ENCRYPTION_PSK_PATH", nil, ""),
+		"Path to a pre-shared key mixed into the payload encryption keys, which must match the agents'")
+	command.Flags().StringSliceVar(&repoExcludedFields, "repository-excluded-fields",
+		env.StringSliceWithDefault("ARGOCD_PRINCIPAL_REPOSITORY_EXCLUDED_FIELDS", nil, []string{}),
+		"Data fields to strip from repository and repo-creds secrets before they are sent to agents")
+	command.Flags().StringVar(&repoEncryptionKeyPath, "repository-encryption-key-path",
+		env.StringWithDefault("ARGOCD_PRINCIPAL_REPOSITORY_ENCRYPTION_KEY_PATH", nil, ""),
+		"Path to a key to encrypt the credentials in repository and repo-creds secrets sent to agents with, which must match the agents'")
+	command.Flags().StringSliceVar(&appFieldFilters, "application-field-filters",
+		env.StringSliceWithDefault("ARGOCD_PRINCIPAL_APPLICATION_FIELD_FILTERS", nil, []string{}),
+		"Annotations, labels and info entries to strip from Applications before they are sent to agents, in the form <field>:<pattern>, e.g. annotation:notifications.argoproj.io/*")
+	command.Flags().StringSliceVar(&argoCDConfigKeys, "argocd-config-keys",
+		env.StringSliceWithDefault("ARGOCD_PRINCIPAL_ARGOCD_CONFIG_KEYS", nil, []string{}),
+		"Keys of argocd-cm, argocd-rbac-cm, argocd-cmd-params-cm, argocd-notifications-cm or argocd-notifications-secret to push to managed agents, in the form <name>:<key>, e.g. argocd-cm:resource.customizations.*")
+	command.Flags().BoolVar(&argoCDNotifications, "argocd-config-notifications",
+		env.BoolWithDefault("ARGOCD_PRINCIPAL_ARGOCD_CONFIG_NOTIFICATIONS", false),
+		"Push all keys of argocd-notifications-cm and argocd-notifications-secret to managed agents")
+	command.Flags().BoolVar(&argoCDResourceFilters, "argocd-config-resource-filters",
+		env.BoolWithDefault("ARGOCD_PRINCIPAL_ARGOCD_CONFIG_RESOURCE_FILTERS", false),
+		"Push the resource inclusions and exclusions of argocd-cm to managed agents, replacing those configured on the agents")
+	command.Flags().StringSliceVar(&appDeletionPolicies, "application-deletion-policy",
+		env.StringSliceWithDefault("ARGOCD_PRINCIPAL_APPLICATION_DELETION_POLICY", nil, []string{}),
+		"What happens to the resources of the Applications of managed agents when the Applications are deleted, in the form <agent>=<policy>, where agent may be default and policy is one of foreground, background or orphan, e.g. default=foreground,agent-a=orphan")
+	command.Flags().StringVar(&orphanedAppPolicy, "orphaned-app-policy",
+		env.StringWithDefault("ARGOCD_PRINCIPAL_ORPHANED_APP_POLICY", nil, principal.OrphanedAppPolicyNone),
+		"What to do with the applications of agents whose cluster mapping was removed: none, label to label them as orphaned, or delete")
+	command.Flags().DurationVar(&orphanedAppGracePeriod, "orphaned-app-grace-period",
+		env.DurationWithDefault("ARGOCD_PRINCIPAL_ORPHANED_APP_GRACE_PERIOD", nil, time.Hour),
+		"Time to wait after the cluster mapping of an agent was removed before its applications are labeled or deleted")
+	command.Flags().StringSliceVar(&agentQueueLimits, "agent-queue-limits",
+		env.StringSliceWithDefault("ARGOCD_PRINCIPAL_AGENT_QUEUE_LIMITS", nil, []string{}),
+		"Maximum number of events and optionally bytes queued for each agent, and the policy when the queue is full (block, drop-oldest, drop-newest, coalesce, disconnect or alert), e.g. default=1000/64Mi:drop-oldest,agent-a=5000:coalesce")
+	command.Flags().StringSliceVar(&agentQueueEventTTLs, "agent-queue-event-ttls",
+		env.StringSliceWithDefault("ARGOCD_PRINCIPAL_AGENT_QUEUE_EVENT_TTLS", nil, []string{}),
+		"Maximum time events of each type stay queued for an agent before they are dropped, e.g. status-update=10m,default=1h. Events never expire if empty")
+	command.Flags().BoolVar(&coalesceUpdates, "coalesce-queued-updates",
+		env.BoolWithDefault("ARGOCD_PRINCIPAL_COALESCE_QUEUED_UPDATES", true),
+		"Replace spec and status updates queued for an agent by later updates of the same resource, so that agents receive only the latest update after a disconnect")
+	command.Flags().StringVar(&queueStorageDir, "queue-storage-dir",
+		env.StringWithDefault("ARGOCD_PRINCIPAL_QUEUE_STORAGE_DIR", nil, ""),
+		"Directory to persist queued events in, so that undelivered events survive a restart. Events are only kept in memory if empty")
+	command.Flags().StringVar(&queueBackend, "queue-backend",
+		env.StringWithDefault("ARGOCD_PRINCIPAL_QUEUE_BACKEND", nil, principal.QueueBackendMemory),
+		"Where to keep the queues of events to send to agents: memory, or redis to share them between principal replicas via the principal's Redis")
+	command.Flags().IntVar(&queueAdminPort, "queue-admin-port",
+		env.NumWithDefault("ARGOCD_PRINCIPAL_QUEUE_ADMIN_PORT", cmdutil.ValidPort, 0),
+		"Port on localhost to serve the queue admin gRPC API on, to inspect and purge the queues of agents. Disabled if 0")
+	command.Flags().IntVar(&eventJournalSize, "event-journal-size",
+		env.NumWithDefault("ARGOCD_PRINCIPAL_EVENT_JOURNAL_SIZE", nil, 0),
+		"Number of events exchanged with each agent to record in the event journal, which is read through the queue admin API. Disabled if 0")
+	command.Flags().IntVar(&http2MaxConcurrentStreams, "http2-max-concurrent-streams",
+		env.NumWithDefault("ARGOCD_PRINCIPAL_HTTP2_MAX_CONCURRENT_STREAMS", nil, 0),
+		"Maximum number of concurrent streams per agent connection. Unlimited if 0")
+	command.Flags().IntVar(&maxAgentConnections, "max-agent-connections",
+		env.NumWithDefault("ARGOCD_PRINCIPAL_MAX_AGENT_CONNECTIONS", nil, 0),
+		"Maximum number of agent connections open at the same time across all listeners. Unlimited if 0")
+	command.Flags().StringVar(&connectionLimitPolicy, "connection-limit-policy",
+		env.StringWithDefault("ARGOCD_PRINCIPAL_CONNECTION_LIMIT_POLICY", nil, string(connlimit.PolicyQueue)),
+		"What to do with connections and streams beyond their limits: queue to make them wait, or reject to close them")
+	command.Flags().IntVar(&http2InitialWindowSize, "http2-initial-window-size",
+		env.NumWithDefault("ARGOCD_PRINCIPAL_HTTP2_INITIAL_WINDOW_SIZE", nil, 0),
+		"Initial HTTP/2 flow control window size per stream in bytes. Sized dynamically if 0")
+	command.Flags().IntVar(&http2InitialConnWindowSize, "http2-initial-conn-window-size",
+		env.NumWithDefault("ARGOCD_PRINCIPAL_HTTP2_INITIAL_CONN_WINDOW_SIZE", nil, 0),
+		"Initial HTTP/2 flow control window size per connection in bytes. Sized dynamically if 0")
+	command.Flags().StringSliceVar(&alpnProtocols, "tls-alpn-protocols",
+		env.StringSliceWithDefault("ARGOCD_PRINCIPAL_TLS_ALPN_PROTOCOLS", nil, []string{}),
+		"Application protocols offered via ALPN in order of preference, e.g. h2,http/1.1. h2 is always offered")
+	command.Flags().StringVar(&grpcCompression, "grpc-compression",
+		env.StringWithDefault("ARGOCD_PRINCIPAL_GRPC_COMPRESSION", nil, grpcutil.CompressionAuto),
+		"Compression of messages sent to agents on streams (possible values: auto, none, gzip, zstd). auto uses the compressor of the agent")
+	command.Flags().DurationVar(&shutdownGracePeriod, "shutdown-grace-period",
+		env.DurationWithDefault("ARGOCD_PRINCIPAL_SHUTDOWN_GRACE_PERIOD", nil, 10*time.Second),
+		"How long to wait on shutdown for queued events to be delivered to agents, after telling them to reconnect. 0 stops immediately")
+	command.Flags().DurationVar(&heartbeatInterval, "heartbeat-interval",
+		env.DurationWithDefault("ARGOCD_PRINCIPAL_HEARTBEAT_INTERVAL", nil, 0),
+		"Interval for sending heartbeat pings to agents over the event stream. 0 disables heartbeats")
+	command.Flags().DurationVar(&agentLivenessTimeout, "agent-liveness-timeout",
+		env.DurationWithDefault("ARGOCD_PRINCIPAL_AGENT_LIVENESS_TIMEOUT", nil, 0),
+		"Time without any event from an agent after which it is reported offline. 0 uses three times the heartbeat interval")
+	command.Flags().DurationVar(&stateDigestInterval, "state-digest-interval",
+		env.DurationWithDefault("ARGOCD_PRINCIPAL_STATE_DIGEST_INTERVAL", nil, 0),
+		"Interval for sending a digest of the resources of autonomous agents to them, so that drifted resources are resent (e.g., 10m). 0 disables digests")
+	command.Flags().StringVar(&transportPreset, "transport-preset",
+		env.StringWithDefault("ARGOCD_PRINCIPAL_TRANSPORT_PRESET", nil, ""),
+		"Apply a named bundle of keepalive and heartbeat settings (one of: "+strings.Join(principalTransportPresets.names(), ", ")+"). Settings configured explicitly take precedence")
 	command.Flags().IntVar(&numEventProcessors, "event-processors",
 		env.NumWithDefault("ARGOCD_PRINCIPAL_EVENT_PROCESSORS", nil, 10),
 		"Number of concurrent event processors")
@@ -659,6 +1587,9 @@ func NewPrincipalRunCommand() *cobra.Command {
 	command.Flags().StringVar(&labelSelector, "label-selector",
 		env.StringWithDefault("ARGOCD_PRINCIPAL_LABEL_SELECTOR", nil, ""),
 		"Kubernetes label selector to restrict which resources the principal watches")
+	command.Flags().StringVar(&syncLabelSelector, "sync-label-selector",
+		env.StringWithDefault("ARGOCD_PRINCIPAL_SYNC_LABEL_SELECTOR", nil, ""),
+		"Kubernetes label selector to restrict which applications are propagated to managed agents. Agents may override it in their cluster secret")
 
 	command.Flags().StringVar(&kubeConfig, "kubeconfig", "", "Path to a kubeconfig file to use")
 	command.Flags().StringVar(&kubeContext, "kubecontext", "", "Override the default kube context")
@@ -669,6 +1600,9 @@ func NewPrincipalRunCommand() *cobra.Command {
 	command.Flags().StringVar(&selfRegClientCertSecretName, "self-registration-client-cert-secret",
 		env.StringWithDefault("ARGOCD_PRINCIPAL_SELF_REGISTRATION_CLIENT_CERT_SECRET", nil, ""),
 		"TLS secret containing shared client cert for self-registered cluster secrets (must have tls.crt, tls.key, ca.crt)")
+	command.Flags().StringSliceVar(&selfRegAllowedLabels, "self-registration-allowed-labels",
+		env.StringSliceWithDefault("ARGOCD_PRINCIPAL_SELF_REGISTRATION_ALLOWED_LABELS", nil, []string{}),
+		"Label keys (glob patterns allowed) that agents may request on their self-registered cluster secrets")
 
 	command.Flags().BoolVar(&haEnabled, "ha-enabled",
 		env.BoolWithDefault("ARGOCD_PRINCIPAL_HA_ENABLED", false),
@@ -778,6 +1712,16 @@ func parseAuth(authStr string) (string, string, error) {
 		return "mtls", p[1], nil
 	case "header":
 		return "header", p[1], nil
+	case "serviceaccount":
+		return "serviceaccount", p[1], nil
+	case "oidc":
+		return "oidc", p[1], nil
+	case "webhook":
+		return "webhook", p[1], nil
+	case "psk":
+		return "psk", p[1], nil
+	case "bootstrap":
+		return "bootstrap", p[1], nil
 	default:
 		return "", "", fmt.Errorf("unknown auth method: %s", p[0])
 	}
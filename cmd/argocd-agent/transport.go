@@ -0,0 +1,155 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/pkg/client"
+	"github.com/spf13/cobra"
+)
+
+// transportPresets holds named bundles of flag values that configure the
+// transport between agent and principal.
+type transportPresets struct {
+	// defaults holds the built-in default of each flag covered by the presets
+	defaults map[string]any
+	// presets maps the name of each preset to its flag values
+	presets map[string]map[string]string
+}
+
+// Transport presets bundle the keepalive, reconnect backoff and heartbeat
+// settings for commonly encountered network environments:
+//
+//   - cloud-lb: behind cloud load balancers, which drop connections idle for
+//     a minute or more
+//   - strict-firewall: through firewalls or NAT gateways that aggressively
+//     expire idle connections
+//   - lan: within a low-latency network without middleboxes
+//
+// The agent's keepalive ping interval in each preset is not shorter than the
+// principal's minimum keepalive interval of the same preset, so that agents
+// and principal using the same preset are compatible.
+var principalTransportPresets = transportPresets{
+	defaults: map[string]any{
+		"keepalive-min-interval":          time.Duration(0),
+		"keepalive-permit-without-stream": false,
+		"keepalive-time":                  time.Duration(0),
+		"keepalive-timeout":               time.Duration(0),
+		"heartbeat-interval":              time.Duration(0),
+		"agent-liveness-timeout":          time.Duration(0),
+	},
+	presets: map[string]map[string]string{
+		"cloud-lb": {
+			"keepalive-min-interval":          "20s",
+			"keepalive-permit-without-stream": "true",
+			"keepalive-time":                  "30s",
+			"keepalive-timeout":               "10s",
+			"heartbeat-interval":              "30s",
+			"agent-liveness-timeout":          "2m",
+		},
+		"strict-firewall": {
+			"keepalive-min-interval":          "10s",
+			"keepalive-permit-without-stream": "true",
+			"keepalive-time":                  "15s",
+			"keepalive-timeout":               "5s",
+			"heartbeat-interval":              "10s",
+			"agent-liveness-timeout":          "45s",
+		},
+		"lan": {
+			"keepalive-min-interval": "1m",
+			"keepalive-time":         "2m",
+			"keepalive-timeout":      "20s",
+		},
+	},
+}
+
+var agentTransportPresets = transportPresets{
+	defaults: map[string]any{
+		"keep-alive-ping-interval":  time.Duration(0),
+		"keep-alive-timeout":        time.Duration(0),
+		"reconnect-backoff-initial": client.DefaultReconnectBackoffInitial,
+		"reconnect-backoff-max":     client.DefaultReconnectBackoffMax,
+		"reconnect-backoff-factor":  client.DefaultReconnectBackoffFactor,
+		"reconnect-backoff-jitter":  client.DefaultReconnectBackoffJitter,
+		"heartbeat-interval":        time.Duration(0),
+	},
+	presets: map[string]map[string]string{
+		"cloud-lb": {
+			"keep-alive-ping-interval":  "30s",
+			"keep-alive-timeout":        "10s",
+			"reconnect-backoff-initial": "2s",
+			"reconnect-backoff-max":     "1m",
+			"reconnect-backoff-jitter":  "0.2",
+			"heartbeat-interval":        "30s",
+		},
+		"strict-firewall": {
+			"keep-alive-ping-interval":  "15s",
+			"keep-alive-timeout":        "5s",
+			"reconnect-backoff-initial": "1s",
+			"reconnect-backoff-max":     "30s",
+			"reconnect-backoff-factor":  "1.5",
+			"reconnect-backoff-jitter":  "0.3",
+			"heartbeat-interval":        "10s",
+		},
+		"lan": {
+			"keep-alive-ping-interval":  "2m",
+			"keep-alive-timeout":        "20s",
+			"reconnect-backoff-initial": "500ms",
+			"reconnect-backoff-max":     "10s",
+			"reconnect-backoff-jitter":  "0.1",
+		},
+	},
+}
+
+// names returns the sorted names of all presets.
+func (p transportPresets) names() []string {
+	names := make([]string, 0, len(p.presets))
+	for name := range p.presets {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// apply sets the flags of cmd to the values of the preset with the given
+// name. Only flags still at their built-in default are changed, so that
+// settings configured explicitly, either on the command line or via their
+// environment variable, take precedence. An empty name is a no-op.
+func (p transportPresets) apply(cmd *cobra.Command, name string) error {
+	if name == "" {
+		return nil
+	}
+	values, ok := p.presets[name]
+	if !ok {
+		return fmt.Errorf("unknown transport preset %q, must be one of: %s", name, strings.Join(p.names(), ", "))
+	}
+	for flag, value := range values {
+		f := cmd.Flags().Lookup(flag)
+		if f == nil {
+			return fmt.Errorf("transport preset %s: unknown flag %s", name, flag)
+		}
+		if f.Changed || f.Value.String() != fmt.Sprint(p.defaults[flag]) {
+			continue
+		}
+		if err := cmd.Flags().Set(flag, value); err != nil {
+			return fmt.Errorf("could not apply transport preset %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_TransportPresets(t *testing.T) {
+	newCmd := func(interval time.Duration) (*cobra.Command, *time.Duration, *time.Duration) {
+		var pingInterval, timeout time.Duration
+		cmd := &cobra.Command{}
+		cmd.Flags().DurationVar(&pingInterval, "keep-alive-ping-interval", interval, "")
+		cmd.Flags().DurationVar(&timeout, "keep-alive-timeout", 0, "")
+		return cmd, &pingInterval, &timeout
+	}
+	presets := transportPresets{
+		defaults: map[string]any{
+			"keep-alive-ping-interval": time.Duration(0),
+			"keep-alive-timeout":       time.Duration(0),
+		},
+		presets: map[string]map[string]string{
+			"test": {
+				"keep-alive-ping-interval": "30s",
+				"keep-alive-timeout":       "10s",
+			},
+		},
+	}
+
+	t.Run("Preset sets flags at their default", func(t *testing.T) {
+		cmd, interval, timeout := newCmd(0)
+		require.NoError(t, presets.apply(cmd, "test"))
+		assert.Equal(t, 30*time.Second, *interval)
+		assert.Equal(t, 10*time.Second, *timeout)
+	})
+	t.Run("Flags set on the command line take precedence", func(t *testing.T) {
+		cmd, interval, timeout := newCmd(0)
+		require.NoError(t, cmd.Flags().Parse([]string{"--keep-alive-timeout=0s"}))
+		require.NoError(t, presets.apply(cmd, "test"))
+		assert.Equal(t, 30*time.Second, *interval)
+		assert.Equal(t, time.Duration(0), *timeout)
+	})
+	t.Run("Flags set from the environment take precedence", func(t *testing.T) {
+		cmd, interval, timeout := newCmd(time.Minute)
+		require.NoError(t, presets.apply(cmd, "test"))
+		assert.Equal(t, time.Minute, *interval)
+		assert.Equal(t, 10*time.Second, *timeout)
+	})
+	t.Run("No preset", func(t *testing.T) {
+		cmd, interval, _ := newCmd(0)
+		require.NoError(t, presets.apply(cmd, ""))
+		assert.Equal(t, time.Duration(0), *interval)
+	})
+	t.Run("Unknown preset", func(t *testing.T) {
+		cmd, _, _ := newCmd(0)
+		assert.ErrorContains(t, presets.apply(cmd, "wan"), "must be one of: test")
+	})
+}
+
+func Test_BuiltinTransportPresets(t *testing.T) {
+	for _, presets := range []transportPresets{principalTransportPresets, agentTransportPresets} {
+		assert.ElementsMatch(t, []string{"cloud-lb", "lan", "strict-firewall"}, presets.names())
+		for name, values := range presets.presets {
+			for flag := range values {
+				assert.Contains(t, presets.defaults, flag, "preset %s", name)
+			}
+		}
+	}
+	// Agents must not ping more often than the principal allows
+	for name, values := range agentTransportPresets.presets {
+		ping, err := time.ParseDuration(values["keep-alive-ping-interval"])
+		require.NoError(t, err)
+		minInterval, err := time.ParseDuration(principalTransportPresets.presets[name]["keepalive-min-interval"])
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, ping, minInterval, "preset %s", name)
+	}
+}
@@ -31,6 +31,7 @@ import (
 	"github.com/argoproj-labs/argocd-agent/cmd/cmdutil"
 	"github.com/argoproj-labs/argocd-agent/internal/argocd/cluster"
 	"github.com/argoproj-labs/argocd-agent/internal/config"
+	"github.com/argoproj-labs/argocd-agent/internal/issuer"
 	"github.com/argoproj-labs/argocd-agent/internal/kube"
 	"github.com/argoproj-labs/argocd-agent/internal/session"
 	"github.com/argoproj-labs/argocd-agent/internal/tlsutil"
@@ -43,6 +44,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/validation"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8slabels "k8s.io/apimachinery/pkg/labels"
 )
 
 func NewAgentCommand() *cobra.Command {
@@ -61,6 +63,8 @@ func NewAgentCommand() *cobra.Command {
 	command.AddCommand(NewAgentInspectCommand())
 	command.AddCommand(NewAgentPrintTLSCommand())
 	command.AddCommand(NewAgentReconfigureCommand())
+	command.AddCommand(NewAgentBootstrapTokenCommand())
+	command.AddCommand(NewAgentRegistrationCommand())
 	return command
 }
 
@@ -180,6 +184,7 @@ func NewAgentCreateCommand() *cobra.Command {
 		days          int
 		keyAlgorithm  string
 		keySize       int
+		syncSelector  string
 	)
 	command := &cobra.Command{
 		Short: "Create a new agent configuration",
@@ -200,6 +205,10 @@ func NewAgentCreateCommand() *cobra.Command {
 			usingExistingTLS := tlsFromSecret != "" && caFromSecret != ""
 			rejectUnusedKeyGenFlags(c, !usingExistingTLS, "are only used when generating certificates from the PKI")
 
+			if _, err := k8slabels.Parse(syncSelector); err != nil {
+				cmdutil.Fatal("Invalid sync label selector: %v", err)
+			}
+
 			// A set of labels for the cluster secret
 			labels := make(map[string]string)
 			if len(addLabels) > 0 {
@@ -266,6 +275,9 @@ func NewAgentCreateCommand() *cobra.Command {
 					},
 				},
 			}
+			if syncSelector != "" {
+				clus.Annotations[cluster.AnnotationKeySyncLabelSelector] = syncSelector
+			}
 
 			// Then, store this cluster configuration in a secret.
 			sec := &v1.Secret{
@@ -290,6 +302,7 @@ func NewAgentCreateCommand() *cobra.Command {
 	command.Flags().StringVar(&tlsFromSecret, "tls-from-secret", "", "Name of an existing secret containing TLS certificate and key (keys: tls.crt, tls.key). Format: [namespace/]name")
 	command.Flags().StringVar(&caFromSecret, "ca-from-secret", "", "Name of an existing secret containing CA certificate (key: ca.crt). Format: [namespace/]name")
 	command.Flags().IntVar(&days, "days", tlsutil.DefaultLeafCertValidityDays, "Number of days the client certificate is valid for (only used when generating from PKI)")
+	command.Flags().StringVar(&syncSelector, "sync-label-selector", "", "Only propagate Applications matching this label selector to the agent, overriding the principal's --sync-label-selector")
 	addKeyGenFlags(command, &keyAlgorithm, &keySize, "only used when generating from PKI")
 	return command
 }
@@ -418,6 +431,50 @@ func NewAgentPrintTLSCommand() *cobra.Command {
 	return command
 }
 
+func NewAgentBootstrapTokenCommand() *cobra.Command {
+	var ttl time.Duration
+	command := &cobra.Command{
+		Short: "Create a one-time bootstrap token for onboarding an agent",
+		Use:   "bootstrap-token <agent-name>",
+		Long: `Creates a one-time bootstrap token for the given agent, signed with the
+principal's JWT signing key. The agent uses the token to onboard itself on its
+first connection, after which the principal hands out a pre-shared key to the
+agent. The principal must be started with --auth=bootstrap.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) != 1 {
+				_ = cmd.Help()
+				os.Exit(1)
+			}
+			agentName := args[0]
+			if errs := validation.NameIsDNSLabel(agentName, false); len(errs) > 0 {
+				cmdutil.Fatal("Agent name not valid: %s", errs[0])
+			}
+
+			ctx := context.TODO()
+			clt, err := kube.NewKubernetesClientFromConfig(ctx, principalCfg.Namespace, "", principalCfg.KubeContext)
+			if err != nil {
+				cmdutil.Fatal("Error creating Kubernetes client: %v", err)
+			}
+			key, err := tlsutil.JWTSigningKeyFromSecret(ctx, clt.Clientset, principalCfg.Namespace, config.SecretNameJWT)
+			if err != nil {
+				cmdutil.Fatal("Could not read JWT signing key from secret: %v", err)
+			}
+			iss, err := issuer.NewIssuer(issuer.PrincipalIssuerName, issuer.WithPrivateKey(key))
+			if err != nil {
+				cmdutil.Fatal("Could not create token issuer: %v", err)
+			}
+			token, err := iss.IssueBootstrapToken(agentName, ttl)
+			if err != nil {
+				cmdutil.Fatal("Could not issue bootstrap token: %v", err)
+			}
+			fmt.Println(token)
+		},
+	}
+
+	command.Flags().DurationVar(&ttl, "ttl", 24*time.Hour, "Duration the bootstrap token is valid for")
+	return command
+}
+
 func clusterTLSAsset(clus *v1alpha1.Cluster, assetType string) ([]byte, error) {
 	switch strings.ToLower(assetType) {
 	case "cert":
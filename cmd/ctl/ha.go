@@ -207,7 +207,7 @@ func getHAAdminClient(ctx context.Context, address string) (haadminapi.HAAdminCl
 		return client, func() { conn.Close() }, nil
 	}
 
-	localPort, stopCh, err := portForwardToPrincipal(ctx)
+	localPort, stopCh, err := portForwardToPrincipal(ctx, haAdminPort)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -237,8 +237,9 @@ func dialHAAdmin(address string) (haadminapi.HAAdminClient, *grpc.ClientConn, er
 }
 
 // portForwardToPrincipal finds the principal pod via --principal-context and
-// sets up a port-forward to port 8405. Returns the local port and a stop channel.
-func portForwardToPrincipal(ctx context.Context) (uint16, chan struct{}, error) {
+// sets up a port-forward to the given port. Returns the local port and a stop
+// channel.
+func portForwardToPrincipal(ctx context.Context, port int) (uint16, chan struct{}, error) {
 	kubeClient, err := kube.NewKubernetesClientFromConfig(
 		ctx,
 		globalOpts.principalNamespace,
@@ -279,7 +280,7 @@ func portForwardToPrincipal(ctx context.Context) (uint16, chan struct{}, error)
 	stopCh := make(chan struct{})
 	readyCh := make(chan struct{})
 
-	fw, err := portforward.New(dialer, []string{fmt.Sprintf("0:%d", haAdminPort)}, stopCh, readyCh, io.Discard, io.Discard)
+	fw, err := portforward.New(dialer, []string{fmt.Sprintf("0:%d", port)}, stopCh, readyCh, io.Discard, io.Discard)
 	if err != nil {
 		return 0, nil, fmt.Errorf("failed to create port-forwarder: %w", err)
 	}
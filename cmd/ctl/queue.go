@@ -0,0 +1,391 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/pkg/api/grpc/queueadminapi"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"gopkg.in/yaml.v3"
+)
+
+const defaultQueueAdminPort = 8406
+
+// queueAdminFlags are the flags shared by all queue commands
+type queueAdminFlags struct {
+	address string
+	port    int
+	timeout time.Duration
+}
+
+func (f *queueAdminFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&f.address, "address", "a", "", "Direct gRPC address (bypasses kube port-forward)")
+	cmd.Flags().IntVar(&f.port, "port", defaultQueueAdminPort, "Queue admin port of the principal to port-forward to")
+	cmd.Flags().DurationVarP(&f.timeout, "timeout", "t", 10*time.Second, "Timeout for the operation")
+}
+
+func NewQueueCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "queue",
+		Short: "Inspect and manage the event queues of agents on the principal",
+		Long: `Inspect and manage the event queues of agents on the principal.
+
+Requires the principal to serve the queue admin API, which is enabled with
+the --queue-admin-port option of the principal.`,
+	}
+
+	cmd.AddCommand(NewQueueListCommand())
+	cmd.AddCommand(NewQueueEventsCommand())
+	cmd.AddCommand(NewQueueJournalCommand())
+	cmd.AddCommand(NewQueuePurgeCommand())
+	cmd.AddCommand(NewQueueRequeueCommand())
+	cmd.AddCommand(NewQueuePauseCommand())
+	cmd.AddCommand(NewQueueResumeCommand())
+
+	return cmd
+}
+
+func NewQueueListCommand() *cobra.Command {
+	var (
+		flags        queueAdminFlags
+		outputFormat string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the queues of all agents",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var resp *queueadminapi.ListQueuesResponse
+			err := withQueueAdminClient(flags, func(ctx context.Context, client queueadminapi.QueueAdminClient) error {
+				var err error
+				resp, err = client.ListQueues(ctx, &queueadminapi.ListQueuesRequest{})
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("failed to list queues: %w", err)
+			}
+			if outputFormat != "text" {
+				return printQueueAdminResponse(resp, outputFormat)
+			}
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "AGENT\tSEND\tRECV\tDEAD LETTERS\tPAUSED")
+			for _, q := range resp.Queues {
+				fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%t\n", q.Agent, q.SendLen, q.RecvLen, q.DeadLetters, q.Paused)
+			}
+			return tw.Flush()
+		},
+	}
+
+	flags.register(cmd)
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "text", "Output format: text, yaml, json")
+
+	return cmd
+}
+
+func NewQueueEventsCommand() *cobra.Command {
+	var (
+		flags        queueAdminFlags
+		outputFormat string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "events <agent>",
+		Short: "List the events queued for and received from an agent",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var resp *queueadminapi.ListEventsResponse
+			err := withQueueAdminClient(flags, func(ctx context.Context, client queueadminapi.QueueAdminClient) error {
+				var err error
+				resp, err = client.ListEvents(ctx, &queueadminapi.ListEventsRequest{Agent: args[0]})
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("failed to list events: %w", err)
+			}
+			if outputFormat != "text" {
+				return printQueueAdminResponse(resp, outputFormat)
+			}
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "QUEUE\tID\tTYPE\tTARGET\tRESOURCE\tAGE\tREASON")
+			printEvents := func(queue string, events []*queueadminapi.QueuedEvent) {
+				for _, ev := range events {
+					fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", queue, ev.Id, shortEventType(ev.Type),
+						ev.Target, ev.ResourceId, time.Duration(ev.AgeSeconds)*time.Second, ev.Reason)
+				}
+			}
+			printEvents("send", resp.Send)
+			printEvents("recv", resp.Recv)
+			printEvents("dead", resp.DeadLetters)
+			return tw.Flush()
+		},
+	}
+
+	flags.register(cmd)
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "text", "Output format: text, yaml, json")
+
+	return cmd
+}
+
+func NewQueueJournalCommand() *cobra.Command {
+	var (
+		flags        queueAdminFlags
+		outputFormat string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "journal <agent>",
+		Short: "Show the last events exchanged with an agent and their outcome",
+		Long: "Show the last events exchanged with an agent and their outcome, oldest first. " +
+			"The principal must be started with a non-zero event journal size.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var resp *queueadminapi.GetJournalResponse
+			err := withQueueAdminClient(flags, func(ctx context.Context, client queueadminapi.QueueAdminClient) error {
+				var err error
+				resp, err = client.GetJournal(ctx, &queueadminapi.GetJournalRequest{Agent: args[0]})
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("failed to get event journal: %w", err)
+			}
+			if outputFormat != "text" {
+				return printQueueAdminResponse(resp, outputFormat)
+			}
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "TIME\tDIR\tTYPE\tTARGET\tSUBJECT\tOUTCOME\tCORRELATION\tREASON")
+			for _, e := range resp.Entries {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", time.UnixMilli(e.Time).Format(time.RFC3339),
+					e.Direction, shortEventType(e.Type), e.Target, e.Subject, e.Outcome, e.CorrelationId, e.Reason)
+			}
+			return tw.Flush()
+		},
+	}
+
+	flags.register(cmd)
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "text", "Output format: text, yaml, json")
+
+	return cmd
+}
+
+func NewQueuePurgeCommand() *cobra.Command {
+	var (
+		flags queueAdminFlags
+		force bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "purge <agent>",
+		Short: "Drop all events waiting to be sent to an agent",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !force {
+				fmt.Printf("WARNING: This will drop all events waiting to be sent to agent %s.\n", args[0])
+				fmt.Print("\nProceed? [y/N]: ")
+
+				var response string
+				fmt.Scanln(&response) //nolint:errcheck
+				if response != "y" && response != "Y" {
+					fmt.Println("Operation cancelled.")
+					return nil
+				}
+			}
+
+			var resp *queueadminapi.PurgeQueueResponse
+			err := withQueueAdminClient(flags, func(ctx context.Context, client queueadminapi.QueueAdminClient) error {
+				var err error
+				resp, err = client.PurgeQueue(ctx, &queueadminapi.PurgeQueueRequest{Agent: args[0]})
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("purge failed: %w", err)
+			}
+
+			fmt.Printf("Purged %d events.\n", resp.Purged)
+			return nil
+		},
+	}
+
+	flags.register(cmd)
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "Skip confirmation prompt")
+
+	return cmd
+}
+
+func NewQueueRequeueCommand() *cobra.Command {
+	var flags queueAdminFlags
+
+	cmd := &cobra.Command{
+		Use:   "requeue <agent> [<event-id>...]",
+		Short: "Send dead letters to an agent again",
+		Long: `Add events that could not be sent to an agent back to its send queue.
+
+Only the dead letters with the given event IDs are requeued. If no IDs are
+given, all dead letters of the agent are requeued.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var resp *queueadminapi.RequeueDeadLettersResponse
+			err := withQueueAdminClient(flags, func(ctx context.Context, client queueadminapi.QueueAdminClient) error {
+				var err error
+				resp, err = client.RequeueDeadLetters(ctx, &queueadminapi.RequeueDeadLettersRequest{Agent: args[0], Ids: args[1:]})
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("requeue failed: %w", err)
+			}
+
+			fmt.Printf("Requeued %d events.\n", resp.Requeued)
+			return nil
+		},
+	}
+
+	flags.register(cmd)
+
+	return cmd
+}
+
+func NewQueuePauseCommand() *cobra.Command {
+	var flags queueAdminFlags
+
+	cmd := &cobra.Command{
+		Use:   "pause <agent>",
+		Short: "Stop sending events to an agent until it is resumed",
+		Long: `Stop sending events to an agent until it is resumed, e.g. while its
+cluster is under maintenance.
+
+Events for the agent keep being queued while delivery is paused, and updates
+of the same resource are coalesced if update coalescing is enabled. Events
+that are already being delivered are not held back.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var resp *queueadminapi.PauseQueueResponse
+			err := withQueueAdminClient(flags, func(ctx context.Context, client queueadminapi.QueueAdminClient) error {
+				var err error
+				resp, err = client.PauseQueue(ctx, &queueadminapi.PauseQueueRequest{Agent: args[0]})
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("pause failed: %w", err)
+			}
+
+			if resp.Paused {
+				fmt.Printf("Paused delivery to agent %s.\n", args[0])
+			} else {
+				fmt.Printf("Delivery to agent %s is paused already.\n", args[0])
+			}
+			return nil
+		},
+	}
+
+	flags.register(cmd)
+
+	return cmd
+}
+
+func NewQueueResumeCommand() *cobra.Command {
+	var flags queueAdminFlags
+
+	cmd := &cobra.Command{
+		Use:   "resume <agent>",
+		Short: "Resume sending events to a paused agent",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var resp *queueadminapi.ResumeQueueResponse
+			err := withQueueAdminClient(flags, func(ctx context.Context, client queueadminapi.QueueAdminClient) error {
+				var err error
+				resp, err = client.ResumeQueue(ctx, &queueadminapi.ResumeQueueRequest{Agent: args[0]})
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("resume failed: %w", err)
+			}
+
+			if resp.Resumed {
+				fmt.Printf("Resumed delivery of %d events to agent %s.\n", resp.SendLen, args[0])
+			} else {
+				fmt.Printf("Delivery to agent %s is not paused.\n", args[0])
+			}
+			return nil
+		},
+	}
+
+	flags.register(cmd)
+
+	return cmd
+}
+
+// withQueueAdminClient calls fn with a queue admin gRPC client. If an address
+// is set, it dials directly. Otherwise it uses --principal-context to
+// port-forward to the principal pod.
+func withQueueAdminClient(flags queueAdminFlags, fn func(context.Context, queueadminapi.QueueAdminClient) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), flags.timeout)
+	defer cancel()
+
+	address := flags.address
+	if address == "" {
+		localPort, stopCh, err := portForwardToPrincipal(ctx, flags.port)
+		if err != nil {
+			return err
+		}
+		defer close(stopCh)
+		address = fmt.Sprintf("localhost:%d", localPort)
+	}
+
+	conn, err := grpc.NewClient(address,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", address, err)
+	}
+	defer conn.Close()
+
+	return fn(ctx, queueadminapi.NewQueueAdminClient(conn))
+}
+
+// shortEventType strips the common prefix from an event type
+func shortEventType(t string) string {
+	if i := strings.LastIndex(t, "."); i >= 0 {
+		return t[i+1:]
+	}
+	return t
+}
+
+func printQueueAdminResponse(resp any, format string) error {
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(resp, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	case "yaml":
+		data, err := yaml.Marshal(resp)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(data))
+	default:
+		return fmt.Errorf("unknown output format: %s", format)
+	}
+	return nil
+}
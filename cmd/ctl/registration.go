@@ -0,0 +1,129 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/cmd/cmdutil"
+	"github.com/argoproj-labs/argocd-agent/internal/kube"
+	"github.com/argoproj-labs/argocd-agent/principal/registration"
+	"github.com/spf13/cobra"
+)
+
+func NewAgentRegistrationCommand() *cobra.Command {
+	var configMapName string
+	command := &cobra.Command{
+		Short:   "Approve or deny the registration of agents",
+		Use:     "registration",
+		Aliases: []string{"registrations"},
+		Run: func(cmd *cobra.Command, args []string) {
+			_ = cmd.Help()
+			os.Exit(1)
+		},
+	}
+	command.PersistentFlags().StringVar(&configMapName, "configmap", registration.DefaultApprovalConfigMapName,
+		"Name of the ConfigMap recording the registration state of agents, as configured on the principal")
+	command.AddCommand(NewAgentRegistrationListCommand(&configMapName))
+	command.AddCommand(NewAgentRegistrationDecideCommand(&configMapName, registration.ApprovalApproved))
+	command.AddCommand(NewAgentRegistrationDecideCommand(&configMapName, registration.ApprovalDenied))
+	return command
+}
+
+func NewAgentRegistrationListCommand(configMapName *string) *cobra.Command {
+	var pendingOnly bool
+	command := &cobra.Command{
+		Short: "List the registration state of agents",
+		Use:   "list",
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := context.TODO()
+			store := approvalStore(ctx, *configMapName)
+			regs, err := store.List(ctx)
+			if err != nil {
+				cmdutil.Fatal("Could not list registrations: %v", err)
+			}
+			names := make([]string, 0, len(regs))
+			for name, reg := range regs {
+				if pendingOnly && reg.State != registration.ApprovalPending {
+					continue
+				}
+				names = append(names, name)
+			}
+			if len(names) == 0 {
+				fmt.Printf("No registrations found.\n")
+				return
+			}
+			sort.Strings(names)
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintf(tw, "AGENT\tSTATE\tREQUESTED\tADDRESS\n")
+			for _, name := range names {
+				reg := regs[name]
+				requested := "-"
+				if !reg.RequestedAt.IsZero() {
+					requested = reg.RequestedAt.Format(time.RFC3339)
+				}
+				address := reg.Address
+				if address == "" {
+					address = "-"
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", name, reg.State, requested, address)
+			}
+			tw.Flush()
+		},
+	}
+	command.Flags().BoolVar(&pendingOnly, "pending", false, "Only list agents waiting for approval")
+	return command
+}
+
+func NewAgentRegistrationDecideCommand(configMapName *string, state registration.ApprovalState) *cobra.Command {
+	use, short := "approve", "Allow an agent to connect"
+	if state == registration.ApprovalDenied {
+		use, short = "deny", "Prevent an agent from connecting"
+	}
+	command := &cobra.Command{
+		Short: short,
+		Use:   use + " <agent-name>",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) != 1 {
+				_ = cmd.Help()
+				os.Exit(1)
+			}
+			ctx := context.TODO()
+			store := approvalStore(ctx, *configMapName)
+			decide := store.Approve
+			if state == registration.ApprovalDenied {
+				decide = store.Deny
+			}
+			if err := decide(ctx, args[0]); err != nil {
+				cmdutil.Fatal("Could not %s agent %s: %v", use, args[0], err)
+			}
+			fmt.Printf("Agent %s %s.\n", args[0], state)
+		},
+	}
+	return command
+}
+
+func approvalStore(ctx context.Context, configMapName string) *registration.ApprovalStore {
+	clt, err := kube.NewKubernetesClientFromConfig(ctx, principalCfg.Namespace, "", principalCfg.KubeContext)
+	if err != nil {
+		cmdutil.Fatal("Could not create Kubernetes client: %v", err)
+	}
+	return registration.NewApprovalStore(clt.Clientset, principalCfg.Namespace, configMapName)
+}
@@ -27,6 +27,8 @@ GENERATE_PATHS="
 	${PROJECT_ROOT}/principal/apis/terminalstream;terminalstreamapi
 	${PROJECT_ROOT}/principal/apis/replication;replicationapi
 	${PROJECT_ROOT}/principal/apis/haadmin;haadminapi
+	${PROJECT_ROOT}/principal/apis/certificate;certificateapi
+	${PROJECT_ROOT}/principal/apis/queueadmin;queueadminapi
 "
 
 for p in ${GENERATE_PATHS}; do
@@ -18,8 +18,12 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/argoproj-labs/argocd-agent/internal/event"
@@ -36,11 +40,46 @@ import (
 	v1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 )
 
 const LabelKeySelfRegisteredCluster = "argocd-agent.argoproj-labs.io/self-registered-cluster"
 
+// AnnotationKeySyncLabelSelector is the annotation on an agent's cluster
+// secret that holds the label selector Applications must match to be
+// propagated to the agent. It takes precedence over the principal's selector.
+const AnnotationKeySyncLabelSelector = "argocd-agent.argoproj-labs.io/sync-label-selector"
+
+// AnnotationKeyAgentLabels is the annotation on a self-registered cluster
+// secret that lists the keys of the labels requested by its agent, so that
+// they can be removed once the agent no longer requests them
+const AnnotationKeyAgentLabels = "argocd-agent.argoproj-labs.io/agent-labels"
+
+// AnnotationKeyConnectionState and AnnotationKeyConnectionStateModifiedAt are
+// the annotations on a self-registered cluster secret that tell whether its
+// agent is connected to the principal, and since when
+const (
+	AnnotationKeyConnectionState           = "argocd-agent.argoproj-labs.io/connection-state"
+	AnnotationKeyConnectionStateModifiedAt = "argocd-agent.argoproj-labs.io/connection-state-modified-at"
+)
+
+// reservedLabelPrefixes are the prefixes of label keys that have a meaning to
+// Argo CD or argocd-agent, and that agents therefore cannot set on their
+// cluster secrets
+var reservedLabelPrefixes = []string{"argocd.argoproj.io/", "argocd-agent.argoproj-labs.io/"}
+
+// IsReservedLabel returns whether the label key is reserved for Argo CD and
+// argocd-agent
+func IsReservedLabel(key string) bool {
+	for _, prefix := range reservedLabelPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 // SetAgentConnectionStatus updates cluster info with connection state and time in mapped cluster at principal.
 // This is called when the agent is connected or disconnected with the principal.
 func (m *Manager) SetAgentConnectionStatus(agentName, status appv1.ConnectionStatus, modifiedAt time.Time) {
@@ -72,9 +111,36 @@ func (m *Manager) SetAgentConnectionStatus(agentName, status appv1.ConnectionSta
 		return
 	}
 
+	// Self-registered cluster secrets are owned by the principal, so the
+	// connection state is recorded on them, too, where it can be used by
+	// e.g. ApplicationSet generators.
+	if cluster.Labels[LabelKeySelfRegisteredCluster] == "true" {
+		if err := m.annotateConnectionState(agentName, state, modifiedAt); err != nil {
+			log().Warnf("failed to record connection state on cluster secret of agent '%s'. Error: %v", agentName, err)
+		}
+	}
+
 	log().Infof("Updated connection status to '%s' in Cluster: '%s' mapped with Agent: '%s'", status, cluster.Name, agentName)
 }
 
+// annotateConnectionState records the connection state of the agent in the
+// annotations of its self-registered cluster secret
+func (m *Manager) annotateConnectionState(agentName, state string, modifiedAt time.Time) error {
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{
+			"annotations": map[string]string{
+				AnnotationKeyConnectionState:           state,
+				AnnotationKeyConnectionStateModifiedAt: modifiedAt.UTC().Format(time.RFC3339),
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = m.kubeclient.CoreV1().Secrets(m.namespace).Patch(m.ctx, GetClusterSecretName(agentName), types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
 // refreshClusterInfo gets latest cluster info from cache and re-saves it to avoid deletion of info
 // by Argo CD after cache expiration time duration (i.e. 10 minutes)
 func (m *Manager) refreshClusterInfo() {
@@ -197,8 +263,9 @@ func NewClusterCacheInstance(redisAddress, redisPassword string, redisCompressio
 // CreateClusterWithBearerToken creates a cluster secret (if it doesn't already exist) for an agent using both mTLS and JWT bearer token authentication.
 // - The shared client certificate (mTLS) proves the request comes from a trusted Argo CD server
 // - The JWT bearer token identifies which specific agent is being accessed
+// The agentLabels requested by the agent are added to the labels of the secret; reserved labels are ignored.
 func CreateClusterWithBearerToken(ctx context.Context, kubeclient kubernetes.Interface,
-	namespace, agentName, resourceProxyAddress string, tokenIssuer issuer.Issuer, clientCertSecretName string) error {
+	namespace, agentName, resourceProxyAddress string, tokenIssuer issuer.Issuer, clientCertSecretName string, agentLabels map[string]string) error {
 
 	logCtx := log().WithField("agent", agentName).WithField("process", "self-agent-registration")
 	logCtx.Info("Creating self-registered cluster secret with shared client cert and bearer token")
@@ -239,6 +306,7 @@ func CreateClusterWithBearerToken(ctx context.Context, kubeclient kubernetes.Int
 			},
 		},
 	}
+	setAgentLabels(cluster.Labels, cluster.Annotations, agentLabels)
 
 	// Convert the cluster to a secret
 	secret := &v1.Secret{
@@ -346,6 +414,70 @@ func UpdateClusterTLSFromSecret(ctx context.Context, kubeclient kubernetes.Inter
 	return true, nil
 }
 
+// UpdateClusterAgentLabelsFromSecret sets the labels requested by the agent on its self-registered cluster secret,
+// and removes the labels it requested before but no longer does. Reserved labels are ignored.
+// It returns true only when the cluster secret was updated.
+func UpdateClusterAgentLabelsFromSecret(ctx context.Context, kubeclient kubernetes.Interface,
+	namespace, agentName string, secret *v1.Secret, agentLabels map[string]string) (bool, error) {
+
+	logCtx := log().WithField("agent", agentName).WithField("process", "self-agent-registration")
+
+	updated := secret.DeepCopy()
+	if updated.Labels == nil {
+		updated.Labels = map[string]string{}
+	}
+	if updated.Annotations == nil {
+		updated.Annotations = map[string]string{}
+	}
+	for _, k := range agentLabelKeys(secret) {
+		if _, ok := agentLabels[k]; !ok && !IsReservedLabel(k) {
+			delete(updated.Labels, k)
+		}
+	}
+	setAgentLabels(updated.Labels, updated.Annotations, agentLabels)
+
+	if maps.Equal(updated.Labels, secret.Labels) &&
+		updated.Annotations[AnnotationKeyAgentLabels] == secret.Annotations[AnnotationKeyAgentLabels] {
+		return false, nil
+	}
+
+	if _, err := kubeclient.CoreV1().Secrets(namespace).Update(ctx, updated, metav1.UpdateOptions{}); err != nil {
+		return false, fmt.Errorf("could not update cluster secret: %w", err)
+	}
+
+	logCtx.Info("Successfully updated cluster secret labels")
+	return true, nil
+}
+
+// setAgentLabels adds the agentLabels that are not reserved to labels, and
+// records their keys in annotations
+func setAgentLabels(labels, annotations map[string]string, agentLabels map[string]string) {
+	var keys []string
+	for k, v := range agentLabels {
+		if IsReservedLabel(k) {
+			continue
+		}
+		labels[k] = v
+		keys = append(keys, k)
+	}
+	if len(keys) == 0 {
+		delete(annotations, AnnotationKeyAgentLabels)
+		return
+	}
+	slices.Sort(keys)
+	annotations[AnnotationKeyAgentLabels] = strings.Join(keys, ",")
+}
+
+// agentLabelKeys returns the keys of the labels on secret that were requested
+// by its agent
+func agentLabelKeys(secret *v1.Secret) []string {
+	v := secret.Annotations[AnnotationKeyAgentLabels]
+	if v == "" {
+		return nil
+	}
+	return strings.Split(v, ",")
+}
+
 // readClientCertFromSecret reads TLS credentials from an existing Kubernetes TLS secret.
 // The secret should contain tls.crt, tls.key, and ca.crt keys.
 func readClientCertFromSecret(ctx context.Context, kubeclient kubernetes.Interface, namespace, secretName string) (clientCert, clientKey, caData string, err error) {
@@ -350,7 +350,7 @@ func Test_CreateClusterWithBearerToken(t *testing.T) {
 		mockIssuer := issuermocks.NewIssuer(t)
 		mockIssuer.On("IssueResourceProxyToken", "test-agent").Return("test-bearer-token", nil)
 
-		err := CreateClusterWithBearerToken(context.Background(), kubeclient, testNamespace, "test-agent", testResourceProxyAddr, mockIssuer, testClientCertSecretName)
+		err := CreateClusterWithBearerToken(context.Background(), kubeclient, testNamespace, "test-agent", testResourceProxyAddr, mockIssuer, testClientCertSecretName, nil)
 		require.NoError(t, err)
 
 		// Verify secret was created
@@ -367,7 +367,7 @@ func Test_CreateClusterWithBearerToken(t *testing.T) {
 		mockIssuer := issuermocks.NewIssuer(t)
 		mockIssuer.On("IssueResourceProxyToken", mock.Anything).Return("test-bearer-token", nil).Maybe()
 
-		err := CreateClusterWithBearerToken(context.Background(), kubeclient, testNamespace, "test-agent", testResourceProxyAddr, mockIssuer, "nonexistent-secret")
+		err := CreateClusterWithBearerToken(context.Background(), kubeclient, testNamespace, "test-agent", testResourceProxyAddr, mockIssuer, "nonexistent-secret", nil)
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "could not read client certificate from secret")
 	})
@@ -379,7 +379,7 @@ func Test_CreateClusterWithBearerToken(t *testing.T) {
 		mockIssuer := issuermocks.NewIssuer(t)
 		mockIssuer.On("IssueResourceProxyToken", "test-agent").Return("", fmt.Errorf("issuer error"))
 
-		err := CreateClusterWithBearerToken(context.Background(), kubeclient, testNamespace, "test-agent", testResourceProxyAddr, mockIssuer, testClientCertSecretName)
+		err := CreateClusterWithBearerToken(context.Background(), kubeclient, testNamespace, "test-agent", testResourceProxyAddr, mockIssuer, testClientCertSecretName, nil)
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "could not issue resource proxy token")
 	})
@@ -399,7 +399,7 @@ func Test_CreateClusterWithBearerToken(t *testing.T) {
 		// Token is issued before checking if secret exists
 		mockIssuer.On("IssueResourceProxyToken", "test-agent").Return("test-bearer-token", nil)
 
-		err := CreateClusterWithBearerToken(context.Background(), kubeclient, testNamespace, "test-agent", testResourceProxyAddr, mockIssuer, testClientCertSecretName)
+		err := CreateClusterWithBearerToken(context.Background(), kubeclient, testNamespace, "test-agent", testResourceProxyAddr, mockIssuer, testClientCertSecretName, nil)
 		require.NoError(t, err)
 	})
 }
@@ -655,3 +655,37 @@ func Test_UpdateClusterBearerTokenFromSecret(t *testing.T) {
 		require.Contains(t, err.Error(), "could not issue resource proxy token")
 	})
 }
+
+func Test_SetAgentConnectionStatusAnnotations(t *testing.T) {
+	miniRedis, err := miniredis.Run()
+	require.NoError(t, err)
+	defer miniRedis.Close()
+
+	kubeclient := kube.NewFakeClientsetWithResources(
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: GetClusterSecretName("self"), Namespace: "default"}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: GetClusterSecretName("manual"), Namespace: "default"}},
+	)
+	m, err := NewManager(context.Background(), "default", miniRedis.Addr(), "", cacheutil.RedisCompressionNone, kubeclient, nil)
+	require.NoError(t, err)
+	require.NoError(t, m.MapCluster("self", &appv1.Cluster{
+		Name: "self", Server: "https://self", Labels: map[string]string{LabelKeySelfRegisteredCluster: "true"},
+	}))
+	require.NoError(t, m.MapCluster("manual", &appv1.Cluster{Name: "manual", Server: "https://manual"}))
+
+	getAnnotations := func(agentName string) map[string]string {
+		secret, err := kubeclient.CoreV1().Secrets("default").Get(context.Background(), GetClusterSecretName(agentName), metav1.GetOptions{})
+		require.NoError(t, err)
+		return secret.Annotations
+	}
+
+	connectedAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	m.SetAgentConnectionStatus("self", appv1.ConnectionStatusSuccessful, connectedAt)
+	m.SetAgentConnectionStatus("manual", appv1.ConnectionStatusSuccessful, connectedAt)
+	require.Equal(t, "connected", getAnnotations("self")[AnnotationKeyConnectionState])
+	require.Equal(t, "2025-03-01T12:00:00Z", getAnnotations("self")[AnnotationKeyConnectionStateModifiedAt])
+	require.Empty(t, getAnnotations("manual"), "manually created cluster secrets must not be modified")
+
+	m.SetAgentConnectionStatus("self", appv1.ConnectionStatusFailed, connectedAt.Add(time.Minute))
+	require.Equal(t, "disconnected", getAnnotations("self")[AnnotationKeyConnectionState])
+	require.Equal(t, "2025-03-01T12:01:00Z", getAnnotations("self")[AnnotationKeyConnectionStateModifiedAt])
+}
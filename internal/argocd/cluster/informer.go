@@ -57,6 +57,9 @@ func (m *Manager) onClusterAdded(res *v1.Secret) {
 	}
 
 	log().Infof("Mapped cluster %s to agent %s", cluster.Name, agent)
+	if m.onMapped != nil {
+		m.onMapped(agent)
+	}
 }
 
 // onClusterUpdated is called by the informer whenever there is a change to a
@@ -95,10 +98,12 @@ func (m *Manager) onClusterUpdated(old *v1.Secret, new *v1.Secret) {
 	// can happen if onClusterAdded found a malformed secret), we treat the
 	// operation as upsert instead of unmapping the old cluster.
 	log().Tracef("Unmapping cluster %s from agent %s", c.Name, oldAgent)
-	if err = m.unmapCluster(oldAgent); err != nil && err != ErrNotMapped {
+	err = m.unmapCluster(oldAgent)
+	if err != nil && err != ErrNotMapped {
 		log().WithError(err).Errorf("Could not unmap cluster %s from agent %s", c.Name, oldAgent)
 		return
 	}
+	upsert := err == ErrNotMapped
 
 	// Map cluster to new agent
 	log().Tracef("Mapping cluster %s to agent %s", c.Name, newAgent)
@@ -108,6 +113,12 @@ func (m *Manager) onClusterUpdated(old *v1.Secret, new *v1.Secret) {
 	}
 
 	log().Infof("Updated cluster mapping for agent %s", newAgent)
+	if oldAgent != newAgent && !upsert && m.onUnmapped != nil {
+		m.onUnmapped(oldAgent)
+	}
+	if (oldAgent != newAgent || upsert) && m.onMapped != nil {
+		m.onMapped(newAgent)
+	}
 }
 
 // onClusterDeleted will be called by the informer on certain occasions when a
@@ -142,4 +153,7 @@ func (m *Manager) onClusterDeleted(res *v1.Secret) {
 	}
 
 	log().Infof("Unmapped cluster from agent %s", agent)
+	if m.onUnmapped != nil {
+		m.onUnmapped(agent)
+	}
 }
@@ -185,3 +185,42 @@ func Test_onClusterUpdated(t *testing.T) {
 
 	})
 }
+
+func Test_MappingHandlers(t *testing.T) {
+	secret := func(agent string) *v1.Secret {
+		return &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels: map[string]string{
+					LabelKeyClusterAgentMapping: agent,
+					common.LabelKeySecretType:   common.LabelValueSecretTypeCluster,
+				},
+				Name: "cluster",
+			},
+		}
+	}
+	m, err := NewManager(context.TODO(), "argocd", "", "", cacheutil.RedisCompressionGZip, kube.NewFakeKubeClient("argocd"), nil)
+	require.NoError(t, err)
+	var mapped, unmapped []string
+	m.SetMappingHandlers(func(agent string) {
+		mapped = append(mapped, agent)
+	}, func(agent string) {
+		unmapped = append(unmapped, agent)
+	})
+
+	m.onClusterAdded(secret("agent1"))
+	assert.Equal(t, []string{"agent1"}, mapped)
+	assert.Empty(t, unmapped)
+
+	// Updates without a change of the agent do not change the mapping
+	m.onClusterUpdated(secret("agent1"), secret("agent1"))
+	assert.Equal(t, []string{"agent1"}, mapped)
+	assert.Empty(t, unmapped)
+
+	m.onClusterUpdated(secret("agent1"), secret("agent2"))
+	assert.Equal(t, []string{"agent1", "agent2"}, mapped)
+	assert.Equal(t, []string{"agent1"}, unmapped)
+
+	m.onClusterDeleted(secret("agent2"))
+	assert.Equal(t, []string{"agent1", "agent2"}, mapped)
+	assert.Equal(t, []string{"agent1", "agent2"}, unmapped)
+}
@@ -66,6 +66,11 @@ type Manager struct {
 	filters *filter.Chain[*v1.Secret]
 
 	clusterCache *appstatecache.Cache
+
+	// onMapped and onUnmapped are called after the informer mapped a cluster
+	// to an agent, or removed the mapping of an agent, respectively
+	onMapped   func(agent string)
+	onUnmapped func(agent string)
 }
 
 // NewManager instantiates and initializes a new Manager.
@@ -119,6 +124,16 @@ func NewManager(ctx context.Context, namespace, redisAddress, redisPassword stri
 	return m, nil
 }
 
+// SetMappingHandlers sets the functions called after the informer mapped a
+// cluster to an agent, or removed the mapping of an agent. They are called
+// with the manager's mutex held, so they must neither block nor call back
+// into the manager. Either may be nil. SetMappingHandlers must be called
+// before the manager is started.
+func (m *Manager) SetMappingHandlers(onMapped, onUnmapped func(agent string)) {
+	m.onMapped = onMapped
+	m.onUnmapped = onUnmapped
+}
+
 // Start starts the manager m and its informer. Start waits for the informer
 // to be synced before returning. If the informer could not sync before the
 // timeout expires, Start will return an error.
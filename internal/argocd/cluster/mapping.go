@@ -2,6 +2,7 @@ package cluster
 
 import (
 	"errors"
+	"strings"
 
 	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
 )
@@ -33,6 +34,24 @@ func (m *Manager) mapping(agent string) *v1alpha1.Cluster {
 	return c
 }
 
+// AgentForServer returns the name of the agent whose mapped cluster has the
+// given server URL. If no agent's cluster has it, AgentForServer returns the
+// empty string.
+func (m *Manager) AgentForServer(server string) string {
+	server = strings.TrimRight(server, "/")
+	if server == "" {
+		return ""
+	}
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	for agent, c := range m.clusters {
+		if strings.TrimRight(c.Server, "/") == server {
+			return agent
+		}
+	}
+	return ""
+}
+
 // HasMapping returns true when the manager has a cluster mapping for an agent
 // with the given name.
 func (m *Manager) HasMapping(agent string) bool {
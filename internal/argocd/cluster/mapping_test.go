@@ -24,6 +24,13 @@ func Test_ClusterMappings(t *testing.T) {
 		err := m.MapCluster("agent", &v1alpha1.Cluster{})
 		require.ErrorIs(t, err, ErrAlreadyMapped)
 	})
+	t.Run("Agent is found by server URL", func(t *testing.T) {
+		require.NoError(t, m.MapCluster("other", &v1alpha1.Cluster{Name: "other", Server: "https://proxy:8443?agentName=other"}))
+		require.Equal(t, "other", m.AgentForServer("https://proxy:8443?agentName=other"))
+		require.Equal(t, "", m.AgentForServer("https://proxy:8443?agentName=unknown"))
+		require.Equal(t, "", m.AgentForServer(""))
+		require.NoError(t, m.UnmapCluster("other"))
+	})
 	t.Run("Mapping can be deleted", func(t *testing.T) {
 		err := m.UnmapCluster("agent")
 		require.NoError(t, err)
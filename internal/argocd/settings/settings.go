@@ -0,0 +1,326 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package settings implements the propagation of selected keys of the Argo CD
+configuration ConfigMaps from the principal to managed agents.
+
+The principal sends only the selected keys of argocd-cm, argocd-rbac-cm,
+argocd-cmd-params-cm, argocd-notifications-cm and argocd-notifications-secret.
+The agent merges them into the ConfigMaps and Secrets of the same name in its
+own namespace and records the keys it has written, so that keys removed on the
+principal are removed on the agent as well, while keys the agent's Argo CD is
+configured with locally are left untouched.
+*/
+package settings
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/argoproj/argo-cd/v3/common"
+	"github.com/argoproj/argo-cd/v3/util/glob"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SyncedKeysAnnotation lists the data keys of a ConfigMap on the agent that
+// were synced from the principal, separated by commas
+const SyncedKeysAnnotation = "argocd-agent.argoproj.io/synced-keys"
+
+// OwnedKeysAnnotation lists the data keys of a ConfigMap sent by the principal
+// that the principal owns, separated by commas. Owned keys that the principal
+// does not send are removed on the agent, even if they were configured
+// locally.
+const OwnedKeysAnnotation = "argocd-agent.argoproj.io/owned-keys"
+
+// partOfLabel is the label Argo CD uses to select its configuration
+// ConfigMaps
+const partOfLabel = "app.kubernetes.io/part-of"
+
+// ConfigMaps are the names of the Argo CD ConfigMaps whose keys can be synced
+var ConfigMaps = []string{
+	common.ArgoCDConfigMapName,
+	common.ArgoCDRBACConfigMapName,
+	common.ArgoCDCmdParamsConfigMapName,
+	common.ArgoCDNotificationsConfigMapName,
+}
+
+// Secrets are the names of the Argo CD Secrets whose keys can be synced
+var Secrets = []string{
+	common.ArgoCDNotificationsSecretName,
+}
+
+// ResourceFilterKeys are the keys of argocd-cm that configure which resources
+// Argo CD tracks
+var ResourceFilterKeys = []string{"resource.inclusions", "resource.exclusions"}
+
+// IsSyncable returns whether keys of the ConfigMap name can be synced
+func IsSyncable(name string) bool {
+	return slices.Contains(ConfigMaps, name)
+}
+
+// IsSyncableSecret returns whether keys of the Secret name can be synced
+func IsSyncableSecret(name string) bool {
+	return slices.Contains(Secrets, name)
+}
+
+// KeySelector selects the keys of the Argo CD configuration ConfigMaps that
+// are synced to managed agents
+type KeySelector struct {
+	// key: name of the ConfigMap
+	// value: glob patterns matching the keys to sync
+	patterns map[string][]string
+	// key: name of the ConfigMap
+	// value: keys owned by the principal
+	owned map[string][]string
+}
+
+// NewKeySelector returns a KeySelector that selects no keys
+func NewKeySelector() *KeySelector {
+	return &KeySelector{patterns: map[string][]string{}, owned: map[string][]string{}}
+}
+
+// ParseKeySelector returns a KeySelector for specs, each of which has the form
+// <name>:<key>, where name is one of ConfigMaps or Secrets. The key may contain
+// glob patterns, e.g. argocd-cm:resource.customizations.* selects all resource
+// customizations.
+func ParseKeySelector(specs []string) (*KeySelector, error) {
+	s := NewKeySelector()
+	if err := s.Select(specs); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Select adds the keys given by specs to the selected keys. See
+// ParseKeySelector for the form of specs.
+func (s *KeySelector) Select(specs []string) error {
+	for _, spec := range specs {
+		name, key, ok := strings.Cut(strings.TrimSpace(spec), ":")
+		if !ok || key == "" {
+			return fmt.Errorf("argocd config key %q is not of the form <name>:<key>", spec)
+		}
+		if !IsSyncable(name) && !IsSyncableSecret(name) {
+			return fmt.Errorf("keys of %s cannot be synced, must be one of %s", name, strings.Join(slices.Concat(ConfigMaps, Secrets), ", "))
+		}
+		s.add(name, key)
+	}
+	return nil
+}
+
+// Own selects keys of the ConfigMap or Secret name and makes the principal their owner,
+// so that they are removed on the agent while they do not exist on the
+// principal
+func (s *KeySelector) Own(name string, keys ...string) {
+	for _, k := range keys {
+		s.add(name, k)
+		if !slices.Contains(s.owned[name], k) {
+			s.owned[name] = append(s.owned[name], k)
+		}
+	}
+}
+
+func (s *KeySelector) add(name, key string) {
+	if !slices.Contains(s.patterns[name], key) {
+		s.patterns[name] = append(s.patterns[name], key)
+	}
+}
+
+// ConfigMaps returns the sorted names of the ConfigMaps with selected keys
+func (s *KeySelector) ConfigMaps() []string {
+	return s.names(IsSyncable)
+}
+
+// Secrets returns the sorted names of the Secrets with selected keys
+func (s *KeySelector) Secrets() []string {
+	return s.names(IsSyncableSecret)
+}
+
+func (s *KeySelector) names(kind func(string) bool) []string {
+	if s == nil {
+		return nil
+	}
+	var names []string
+	for name := range s.patterns {
+		if kind(name) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Selects returns whether key of the ConfigMap or Secret name is selected
+func (s *KeySelector) Selects(name, key string) bool {
+	if s == nil {
+		return false
+	}
+	return glob.MatchStringInList(s.patterns[name], key, glob.GLOB)
+}
+
+// Filter returns a copy of cm that only has the selected data keys, and only
+// the metadata required to identify it and the keys owned by the principal
+func (s *KeySelector) Filter(cm *corev1.ConfigMap) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		TypeMeta:   cm.TypeMeta,
+		ObjectMeta: s.filterMeta(&cm.ObjectMeta),
+		Data:       filterData(s, cm.Name, cm.Data),
+	}
+}
+
+// FilterSecret returns a copy of secret that only has the selected data keys,
+// and only the metadata required to identify it and the keys owned by the
+// principal
+func (s *KeySelector) FilterSecret(secret *corev1.Secret) *corev1.Secret {
+	data := filterData(s, secret.Name, secret.Data)
+	for k, v := range secret.StringData {
+		if s.Selects(secret.Name, k) {
+			if data == nil {
+				data = map[string][]byte{}
+			}
+			data[k] = []byte(v)
+		}
+	}
+	return &corev1.Secret{
+		TypeMeta:   secret.TypeMeta,
+		ObjectMeta: s.filterMeta(&secret.ObjectMeta),
+		Type:       secret.Type,
+		Data:       data,
+	}
+}
+
+func (s *KeySelector) filterMeta(meta *metav1.ObjectMeta) metav1.ObjectMeta {
+	filtered := metav1.ObjectMeta{
+		Name:            meta.Name,
+		Namespace:       meta.Namespace,
+		UID:             meta.UID,
+		ResourceVersion: meta.ResourceVersion,
+	}
+	if owned := s.ownedKeys(meta.Name); len(owned) > 0 {
+		filtered.Annotations = map[string]string{OwnedKeysAnnotation: strings.Join(owned, ",")}
+	}
+	return filtered
+}
+
+func filterData[V any](s *KeySelector, name string, data map[string]V) map[string]V {
+	var filtered map[string]V
+	for k, v := range data {
+		if s.Selects(name, k) {
+			if filtered == nil {
+				filtered = map[string]V{}
+			}
+			filtered[k] = v
+		}
+	}
+	return filtered
+}
+
+func (s *KeySelector) ownedKeys(name string) []string {
+	if s == nil || len(s.owned[name]) == 0 {
+		return nil
+	}
+	return slices.Sorted(slices.Values(s.owned[name]))
+}
+
+// NewConfigMap returns a ConfigMap in namespace holding the keys synced in
+// incoming. It is labeled so that Argo CD picks it up.
+func NewConfigMap(incoming *corev1.ConfigMap, namespace string) *corev1.ConfigMap {
+	cm := &corev1.ConfigMap{ObjectMeta: newMeta(incoming.Name, namespace)}
+	Apply(cm, incoming)
+	return cm
+}
+
+// NewSecret returns a Secret in namespace holding the keys synced in incoming.
+// It is labeled so that Argo CD picks it up.
+func NewSecret(incoming *corev1.Secret, namespace string) *corev1.Secret {
+	secret := &corev1.Secret{ObjectMeta: newMeta(incoming.Name, namespace), Type: incoming.Type}
+	ApplySecret(secret, incoming)
+	return secret
+}
+
+func newMeta(name, namespace string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:      name,
+		Namespace: namespace,
+		Labels:    map[string]string{partOfLabel: "argocd"},
+	}
+}
+
+// Apply merges the keys synced in incoming into existing. Keys that were
+// synced before, or are owned by the principal, but are no longer part of
+// incoming are removed from existing. Returns whether existing was changed.
+func Apply(existing, incoming *corev1.ConfigMap) bool {
+	return apply(&existing.ObjectMeta, &existing.Data, &incoming.ObjectMeta, incoming.Data, func(a, b string) bool { return a == b })
+}
+
+// ApplySecret merges the keys synced in incoming into existing like Apply.
+// The keys of incoming must already be decrypted.
+func ApplySecret(existing, incoming *corev1.Secret) bool {
+	return apply(&existing.ObjectMeta, &existing.Data, &incoming.ObjectMeta, incoming.Data, bytes.Equal)
+}
+
+func apply[V any](existing *metav1.ObjectMeta, data *map[string]V, incoming *metav1.ObjectMeta, incomingData map[string]V, equal func(a, b V) bool) bool {
+	changed := false
+	for _, k := range slices.Concat(listAnnotation(existing, SyncedKeysAnnotation), listAnnotation(incoming, OwnedKeysAnnotation)) {
+		if _, ok := incomingData[k]; ok {
+			continue
+		}
+		if _, ok := (*data)[k]; ok {
+			delete(*data, k)
+			changed = true
+		}
+	}
+	for k, v := range incomingData {
+		if cur, ok := (*data)[k]; ok && equal(cur, v) {
+			continue
+		}
+		if *data == nil {
+			*data = map[string]V{}
+		}
+		(*data)[k] = v
+		changed = true
+	}
+
+	synced := strings.Join(slices.Sorted(maps.Keys(incomingData)), ",")
+	if existing.Annotations[SyncedKeysAnnotation] != synced {
+		if existing.Annotations == nil {
+			existing.Annotations = map[string]string{}
+		}
+		if synced == "" {
+			delete(existing.Annotations, SyncedKeysAnnotation)
+		} else {
+			existing.Annotations[SyncedKeysAnnotation] = synced
+		}
+		changed = true
+	}
+	return changed
+}
+
+// SyncedKeys returns the keys of the ConfigMap or Secret with the metadata meta
+// that were synced from the principal
+func SyncedKeys(meta metav1.Object) []string {
+	return listAnnotation(meta, SyncedKeysAnnotation)
+}
+
+func listAnnotation(meta metav1.Object, annotation string) []string {
+	v := meta.GetAnnotations()[annotation]
+	if v == "" {
+		return nil
+	}
+	return strings.Split(v, ",")
+}
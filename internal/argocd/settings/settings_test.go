@@ -0,0 +1,199 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package settings
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_ParseKeySelector(t *testing.T) {
+	t.Run("Valid keys", func(t *testing.T) {
+		s, err := ParseKeySelector([]string{
+			"argocd-cm:resource.customizations.*",
+			"argocd-cm:timeout.reconciliation",
+			" argocd-rbac-cm:policy.csv",
+			"argocd-cm:timeout.reconciliation",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"argocd-cm", "argocd-rbac-cm"}, s.ConfigMaps())
+		assert.True(t, s.Selects("argocd-cm", "resource.customizations.health.apps_Deployment"))
+		assert.True(t, s.Selects("argocd-cm", "timeout.reconciliation"))
+		assert.True(t, s.Selects("argocd-rbac-cm", "policy.csv"))
+		assert.False(t, s.Selects("argocd-cm", "policy.csv"))
+		assert.False(t, s.Selects("argocd-cmd-params-cm", "timeout.reconciliation"))
+	})
+	t.Run("Invalid keys", func(t *testing.T) {
+		for _, spec := range []string{
+			"argocd-cm",
+			"argocd-cm:",
+			"argocd-secret:admin.password",
+			":policy.csv",
+		} {
+			_, err := ParseKeySelector([]string{spec})
+			assert.Error(t, err, spec)
+		}
+	})
+	t.Run("Nil selector selects nothing", func(t *testing.T) {
+		var s *KeySelector
+		assert.Empty(t, s.ConfigMaps())
+		assert.False(t, s.Selects("argocd-cm", "url"))
+	})
+}
+
+func Test_Filter(t *testing.T) {
+	s, err := ParseKeySelector([]string{"argocd-cm:resource.*"})
+	require.NoError(t, err)
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "argocd-cm",
+			Namespace:       "argocd",
+			UID:             "1234",
+			ResourceVersion: "42",
+			Labels:          map[string]string{"app.kubernetes.io/part-of": "argocd"},
+			Annotations:     map[string]string{"foo": "bar"},
+		},
+		Data: map[string]string{
+			"resource.exclusions": "- kinds: [Event]",
+			"url":                 "https://argocd.example.com",
+		},
+	}
+	filtered := s.Filter(cm)
+	assert.Equal(t, map[string]string{"resource.exclusions": "- kinds: [Event]"}, filtered.Data)
+	assert.Equal(t, "argocd-cm", filtered.Name)
+	assert.Equal(t, "argocd", filtered.Namespace)
+	assert.Equal(t, "1234", string(filtered.UID))
+	assert.Equal(t, "42", filtered.ResourceVersion)
+	assert.Empty(t, filtered.Labels)
+	assert.Empty(t, filtered.Annotations)
+	assert.Len(t, cm.Data, 2)
+}
+
+func Test_Apply(t *testing.T) {
+	incoming := func(data map[string]string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "argocd-cm"}, Data: data}
+	}
+
+	t.Run("Synced keys are merged with local keys", func(t *testing.T) {
+		existing := &corev1.ConfigMap{Data: map[string]string{"url": "https://agent.example.com", "timeout.reconciliation": "60s"}}
+		assert.True(t, Apply(existing, incoming(map[string]string{"timeout.reconciliation": "180s", "resource.exclusions": "[]"})))
+		assert.Equal(t, map[string]string{
+			"url":                    "https://agent.example.com",
+			"timeout.reconciliation": "180s",
+			"resource.exclusions":    "[]",
+		}, existing.Data)
+		assert.Equal(t, []string{"resource.exclusions", "timeout.reconciliation"}, SyncedKeys(existing))
+	})
+
+	t.Run("Keys no longer synced are removed", func(t *testing.T) {
+		existing := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{SyncedKeysAnnotation: "resource.exclusions,timeout.reconciliation"}},
+			Data:       map[string]string{"url": "https://agent.example.com", "timeout.reconciliation": "180s", "resource.exclusions": "[]"},
+		}
+		assert.True(t, Apply(existing, incoming(map[string]string{"timeout.reconciliation": "180s"})))
+		assert.Equal(t, map[string]string{"url": "https://agent.example.com", "timeout.reconciliation": "180s"}, existing.Data)
+		assert.Equal(t, []string{"timeout.reconciliation"}, SyncedKeys(existing))
+
+		assert.True(t, Apply(existing, incoming(nil)))
+		assert.Equal(t, map[string]string{"url": "https://agent.example.com"}, existing.Data)
+		assert.NotContains(t, existing.Annotations, SyncedKeysAnnotation)
+	})
+
+	t.Run("Unchanged keys are not applied again", func(t *testing.T) {
+		existing := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{SyncedKeysAnnotation: "timeout.reconciliation"}},
+			Data:       map[string]string{"timeout.reconciliation": "180s"},
+		}
+		assert.False(t, Apply(existing, incoming(map[string]string{"timeout.reconciliation": "180s"})))
+		assert.False(t, Apply(&corev1.ConfigMap{}, incoming(nil)))
+	})
+}
+
+func Test_OwnedKeys(t *testing.T) {
+	s := NewKeySelector()
+	s.Own("argocd-cm", ResourceFilterKeys...)
+	assert.Equal(t, []string{"argocd-cm"}, s.ConfigMaps())
+	assert.True(t, s.Selects("argocd-cm", "resource.inclusions"))
+	assert.False(t, s.Selects("argocd-cm", "resource.customizations"))
+
+	filtered := s.Filter(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "argocd-cm"},
+		Data:       map[string]string{"resource.exclusions": "- kinds: [Event]"},
+	})
+	assert.Equal(t, "resource.exclusions,resource.inclusions", filtered.Annotations[OwnedKeysAnnotation])
+
+	t.Run("Owned keys override local keys", func(t *testing.T) {
+		existing := &corev1.ConfigMap{Data: map[string]string{
+			"resource.inclusions": "- kinds: [Deployment]",
+			"resource.exclusions": "[]",
+			"url":                 "https://agent.example.com",
+		}}
+		assert.True(t, Apply(existing, filtered))
+		assert.Equal(t, map[string]string{
+			"resource.exclusions": "- kinds: [Event]",
+			"url":                 "https://agent.example.com",
+		}, existing.Data)
+		assert.False(t, Apply(existing, filtered))
+	})
+
+	t.Run("ConfigMaps without owned keys carry no annotation", func(t *testing.T) {
+		assert.Empty(t, s.Filter(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "argocd-rbac-cm"}}).Annotations)
+	})
+}
+
+func Test_Secrets(t *testing.T) {
+	s, err := ParseKeySelector([]string{"argocd-notifications-secret:slack-*", "argocd-notifications-cm:*"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"argocd-notifications-cm"}, s.ConfigMaps())
+	assert.Equal(t, []string{"argocd-notifications-secret"}, s.Secrets())
+
+	filtered := s.FilterSecret(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "argocd-notifications-secret", UID: "1234"},
+		Type:       corev1.SecretTypeOpaque,
+		Data:       map[string][]byte{"slack-token": []byte("xoxb"), "email-password": []byte("s3cr3t")},
+		StringData: map[string]string{"slack-signing-secret": "abc"},
+	})
+	assert.Equal(t, map[string][]byte{"slack-token": []byte("xoxb"), "slack-signing-secret": []byte("abc")}, filtered.Data)
+	assert.Empty(t, filtered.StringData)
+	assert.Equal(t, corev1.SecretTypeOpaque, filtered.Type)
+
+	secret := NewSecret(filtered, "agent-managed")
+	assert.Equal(t, "agent-managed", secret.Namespace)
+	assert.Equal(t, filtered.Data, secret.Data)
+	assert.Equal(t, []string{"slack-signing-secret", "slack-token"}, SyncedKeys(secret))
+
+	secret.Data["email-password"] = []byte("local")
+	delete(filtered.Data, "slack-signing-secret")
+	assert.True(t, ApplySecret(secret, filtered))
+	assert.Equal(t, map[string][]byte{"slack-token": []byte("xoxb"), "email-password": []byte("local")}, secret.Data)
+	assert.False(t, ApplySecret(secret, filtered))
+}
+
+func Test_NewConfigMap(t *testing.T) {
+	cm := NewConfigMap(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "argocd-rbac-cm", Namespace: "argocd", UID: "1234"},
+		Data:       map[string]string{"policy.default": "role:readonly"},
+	}, "agent-managed")
+	assert.Equal(t, "argocd-rbac-cm", cm.Name)
+	assert.Equal(t, "agent-managed", cm.Namespace)
+	assert.Empty(t, cm.UID)
+	assert.Equal(t, "argocd", cm.Labels["app.kubernetes.io/part-of"])
+	assert.Equal(t, map[string]string{"policy.default": "role:readonly"}, cm.Data)
+	assert.Equal(t, []string{"policy.default"}, SyncedKeys(cm))
+}
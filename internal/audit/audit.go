@@ -0,0 +1,127 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package audit implements an audit log for security relevant events on the
+// principal, such as authentication attempts, token issuance, agent
+// connections and changes to resources made on behalf of agents. Audit events
+// are written to one or more sinks, e.g. a file or a webhook.
+package audit
+
+import (
+	"errors"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/internal/logging"
+	"github.com/sirupsen/logrus"
+)
+
+// EventType is the type of an audit event
+type EventType string
+
+const (
+	// EventAuthentication is recorded for each authentication attempt
+	EventAuthentication EventType = "authentication"
+	// EventTokenIssued is recorded whenever tokens are issued to an agent
+	EventTokenIssued EventType = "token_issued"
+	// EventAgentConnected is recorded when an agent opens an event stream
+	EventAgentConnected EventType = "agent_connected"
+	// EventAgentDisconnected is recorded when an agent's event stream ends
+	EventAgentDisconnected EventType = "agent_disconnected"
+	// EventResourceMutation is recorded when an agent's event changes a
+	// resource on the principal
+	EventResourceMutation EventType = "resource_mutation"
+)
+
+// Outcome is the outcome of an audited action
+type Outcome string
+
+const (
+	OutcomeSuccess Outcome = "success"
+	OutcomeFailure Outcome = "failure"
+	OutcomeDenied  Outcome = "denied"
+)
+
+// Event is a single entry in the audit log
+type Event struct {
+	// Time is the time the event occurred. Set by the Logger if empty.
+	Time time.Time `json:"time"`
+	// Type is the type of the event
+	Type EventType `json:"type"`
+	// Actor is the name of the agent that performed the action. It may be
+	// the name claimed by the agent for failed authentication attempts.
+	Actor string `json:"actor,omitempty"`
+	// Namespace is the namespace on the principal the action relates to
+	Namespace string `json:"namespace,omitempty"`
+	// Outcome is the outcome of the action
+	Outcome Outcome `json:"outcome"`
+	// Reason describes why the action failed or was denied
+	Reason string `json:"reason,omitempty"`
+	// SourceAddress is the network address the action originated from
+	SourceAddress string `json:"sourceAddress,omitempty"`
+	// Details holds additional information specific to the event type
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// Sink receives audit events. Implementations must be safe for concurrent
+// use.
+type Sink interface {
+	// Write records a single audit event
+	Write(ev *Event) error
+	// Close releases any resources held by the sink
+	Close() error
+}
+
+// Logger writes audit events to a set of sinks. A nil Logger discards all
+// events, so callers do not need to check whether auditing is enabled.
+type Logger struct {
+	sinks []Sink
+	now   func() time.Time
+}
+
+// NewLogger returns a new Logger writing to the given sinks.
+func NewLogger(sinks ...Sink) *Logger {
+	return &Logger{sinks: sinks, now: time.Now}
+}
+
+// Log records ev in all sinks. Failure to write to a sink is logged, but does
+// not prevent writing to the other sinks.
+func (l *Logger) Log(ev Event) {
+	if l == nil {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = l.now()
+	}
+	for _, s := range l.sinks {
+		if err := s.Write(&ev); err != nil {
+			log().WithError(err).WithField("type", ev.Type).Error("Could not write audit event")
+		}
+	}
+}
+
+// Close closes all sinks of the Logger.
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	var errs []error
+	for _, s := range l.sinks {
+		errs = append(errs, s.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func log() *logrus.Entry {
+	return logging.GetDefaultLogger().ComponentLogger("AuditLog")
+}
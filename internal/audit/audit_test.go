@@ -0,0 +1,122 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Logger(t *testing.T) {
+	t.Run("Nil logger discards events", func(t *testing.T) {
+		var l *Logger
+		assert.NotPanics(t, func() {
+			l.Log(Event{Type: EventAuthentication})
+		})
+		assert.NoError(t, l.Close())
+	})
+
+	t.Run("Events are written to all sinks", func(t *testing.T) {
+		var b1, b2 bytes.Buffer
+		now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+		l := NewLogger(NewWriterSink(&b1), NewWriterSink(&b2))
+		l.now = func() time.Time { return now }
+		l.Log(Event{Type: EventAuthentication, Actor: "agent-1", Outcome: OutcomeSuccess, Details: map[string]string{"method": "mtls"}})
+
+		for _, b := range []*bytes.Buffer{&b1, &b2} {
+			ev := Event{}
+			require.NoError(t, json.Unmarshal(b.Bytes(), &ev))
+			assert.Equal(t, now, ev.Time)
+			assert.Equal(t, EventAuthentication, ev.Type)
+			assert.Equal(t, "agent-1", ev.Actor)
+			assert.Equal(t, OutcomeSuccess, ev.Outcome)
+			assert.Equal(t, "mtls", ev.Details["method"])
+		}
+	})
+}
+
+func Test_FileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	for i := 0; i < 2; i++ {
+		s, err := NewFileSink(path)
+		require.NoError(t, err)
+		NewLogger(s).Log(Event{Type: EventAgentConnected, Actor: "agent-1", Outcome: OutcomeSuccess})
+		require.NoError(t, s.Close())
+	}
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	lines := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		ev := Event{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &ev))
+		assert.Equal(t, EventAgentConnected, ev.Type)
+		lines++
+	}
+	assert.Equal(t, 2, lines)
+
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+}
+
+func Test_WebhookSink(t *testing.T) {
+	t.Run("Events are delivered", func(t *testing.T) {
+		var mu sync.Mutex
+		var received []Event
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ev := Event{}
+			if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			mu.Lock()
+			received = append(received, ev)
+			mu.Unlock()
+		}))
+		defer srv.Close()
+
+		s, err := NewWebhookSink(srv.URL, nil, 0)
+		require.NoError(t, err)
+		l := NewLogger(s)
+		l.Log(Event{Type: EventTokenIssued, Actor: "agent-1", Outcome: OutcomeSuccess})
+		l.Log(Event{Type: EventAgentDisconnected, Actor: "agent-1", Outcome: OutcomeSuccess})
+		require.NoError(t, l.Close())
+
+		mu.Lock()
+		defer mu.Unlock()
+		require.Len(t, received, 2)
+		assert.Equal(t, EventTokenIssued, received[0].Type)
+		assert.Equal(t, EventAgentDisconnected, received[1].Type)
+	})
+
+	t.Run("Invalid URL", func(t *testing.T) {
+		_, err := NewWebhookSink("ftp://example.com", nil, 0)
+		assert.ErrorContains(t, err, "http or https")
+	})
+}
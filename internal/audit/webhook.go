@@ -0,0 +1,134 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+var _ Sink = &WebhookSink{}
+
+// DefaultWebhookTimeout is the default timeout for requests to the webhook
+const DefaultWebhookTimeout = 10 * time.Second
+
+// webhookBufferSize is the number of events buffered for delivery
+const webhookBufferSize = 1000
+
+// WebhookSink delivers audit events to an HTTP(S) endpoint, POSTing each
+// event as a JSON document.
+//
+// Events are delivered asynchronously, so that a slow or unavailable webhook
+// does not block the principal. If the buffer of pending events is full, new
+// events are dropped and an error is returned from Write.
+type WebhookSink struct {
+	url    string
+	client *http.Client
+	events chan *Event
+	done   chan struct{}
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewWebhookSink returns a sink delivering events to the webhook at
+// webhookURL. If rootCAs is nil, the system's root CAs are used to verify
+// the webhook's certificate. If timeout is 0, DefaultWebhookTimeout is used.
+func NewWebhookSink(webhookURL string, rootCAs *x509.CertPool, timeout time.Duration) (*WebhookSink, error) {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid audit webhook URL: %w", err)
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return nil, fmt.Errorf("audit webhook URL must use http or https")
+	}
+	if timeout == 0 {
+		timeout = DefaultWebhookTimeout
+	}
+	s := &WebhookSink{
+		url: webhookURL,
+		client: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					RootCAs:    rootCAs,
+					MinVersion: tls.VersionTLS12,
+				},
+			},
+		},
+		events: make(chan *Event, webhookBufferSize),
+		done:   make(chan struct{}),
+	}
+	go s.deliver()
+	return s, nil
+}
+
+// Write queues ev for delivery.
+func (s *WebhookSink) Write(ev *Event) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return fmt.Errorf("audit webhook sink is closed")
+	}
+	select {
+	case s.events <- ev:
+		return nil
+	default:
+		return fmt.Errorf("audit webhook buffer is full, dropping event")
+	}
+}
+
+// Close stops delivery after all pending events have been delivered.
+func (s *WebhookSink) Close() error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.events)
+	}
+	s.mu.Unlock()
+	<-s.done
+	return nil
+}
+
+func (s *WebhookSink) deliver() {
+	defer close(s.done)
+	for ev := range s.events {
+		if err := s.post(ev); err != nil {
+			log().WithError(err).WithField("type", ev.Type).Error("Could not deliver audit event to webhook")
+		}
+	}
+}
+
+func (s *WebhookSink) post(ev *Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package bootstrap implements onboarding of new agents using one-time
+// bootstrap tokens. On first connect, an agent presents a bootstrap token
+// minted by an operator. The principal then creates the agent's namespace and
+// a long-lived pre-shared key, which is handed to the agent in the response
+// header of the authentication request.
+package bootstrap
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	"github.com/argoproj-labs/argocd-agent/internal/auth"
+	"github.com/argoproj-labs/argocd-agent/internal/auth/psk"
+	"github.com/argoproj-labs/argocd-agent/internal/issuer"
+	"github.com/argoproj-labs/argocd-agent/internal/logging"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/validation"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+var _ auth.Method = &BootstrapAuthentication{}
+
+// TokenField is the name of the field in the Credentials containing the
+// bootstrap token
+const TokenField = "token"
+
+// CredentialsHeader is the name of the gRPC response header the pre-shared
+// key issued to a newly onboarded agent is returned in
+const CredentialsHeader = "x-argocd-agent-psk"
+
+// LabelKeyBootstrapped is set on Secrets created during onboarding
+const LabelKeyBootstrapped = "argocd-agent.argoproj-labs.io/bootstrapped"
+
+// keySize is the size in bytes of pre-shared keys issued during onboarding
+const keySize = 32
+
+// TokenValidator validates bootstrap tokens
+type TokenValidator interface {
+	ValidateBootstrapToken(token string) (issuer.Claims, error)
+}
+
+// BootstrapAuthentication implements onboarding of agents using bootstrap
+// tokens.
+//
+// A bootstrap token can only be used once: the pre-shared key Secret created
+// for the agent serves as the record of a completed onboarding, and any
+// further attempt to onboard the same agent will be rejected. Afterwards, the
+// agent must authenticate using the psk auth method.
+type BootstrapAuthentication struct {
+	validator    TokenValidator
+	kubeclient   kubernetes.Interface
+	namespace    string
+	secretPrefix string
+
+	mu   sync.Mutex
+	used map[string]bool
+}
+
+// NewBootstrapAuthentication creates a new instance of BootstrapAuthentication.
+// Pre-shared keys for onboarded agents are stored in Secrets in namespace,
+// named secretPrefix followed by the agent's name. If secretPrefix is empty,
+// psk.DefaultSecretPrefix is used.
+func NewBootstrapAuthentication(validator TokenValidator, kubeclient kubernetes.Interface, namespace, secretPrefix string) *BootstrapAuthentication {
+	if secretPrefix == "" {
+		secretPrefix = psk.DefaultSecretPrefix
+	}
+	return &BootstrapAuthentication{
+		validator:    validator,
+		kubeclient:   kubeclient,
+		namespace:    namespace,
+		secretPrefix: secretPrefix,
+		used:         make(map[string]bool),
+	}
+}
+
+// Init validates the configuration of the auth method.
+func (a *BootstrapAuthentication) Init() error {
+	if a.validator == nil {
+		return fmt.Errorf("token validator cannot be nil")
+	}
+	if a.kubeclient == nil {
+		return fmt.Errorf("kubernetes client cannot be nil")
+	}
+	if a.namespace == "" {
+		return fmt.Errorf("namespace cannot be empty")
+	}
+	return nil
+}
+
+// Authenticate validates the bootstrap token in creds and onboards the agent
+// it was issued for. On success, the agent's name is returned and its new
+// pre-shared key is set in the response header of the request.
+func (a *BootstrapAuthentication) Authenticate(ctx context.Context, creds auth.Credentials) (string, error) {
+	token, ok := creds[TokenField]
+	if !ok || token == "" {
+		return "", fmt.Errorf("token is missing from credentials")
+	}
+	claims, err := a.validator.ValidateBootstrapToken(token)
+	if err != nil {
+		return "", fmt.Errorf("could not validate bootstrap token: %w", err)
+	}
+	agentID, err := claims.GetSubject()
+	if err != nil {
+		return "", fmt.Errorf("could not get subject from bootstrap token: %w", err)
+	}
+	if errs := validation.NameIsDNSLabel(agentID, false); len(errs) > 0 {
+		return "", fmt.Errorf("invalid agent ID '%s': %v", agentID, errs)
+	}
+	logCtx := log().WithField("agent_id", agentID)
+
+	tokenID := issuer.TokenID(claims)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.used[tokenID] {
+		return "", fmt.Errorf("bootstrap token has already been used")
+	}
+
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("could not generate pre-shared key: %w", err)
+	}
+	encodedKey := hex.EncodeToString(key)
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      a.secretPrefix + agentID,
+			Namespace: a.namespace,
+			Labels:    map[string]string{LabelKeyBootstrapped: "true"},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{psk.SecretKeyField: []byte(encodedKey)},
+	}
+	_, err = a.kubeclient.CoreV1().Secrets(a.namespace).Create(ctx, secret, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		return "", fmt.Errorf("agent %s has already been onboarded", agentID)
+	} else if err != nil {
+		return "", fmt.Errorf("could not store pre-shared key: %w", err)
+	}
+	a.used[tokenID] = true
+
+	if err := a.ensureNamespace(ctx, agentID); err != nil {
+		return "", err
+	}
+
+	if err := grpc.SetHeader(ctx, metadata.Pairs(CredentialsHeader, encodedKey)); err != nil {
+		// Without its key, the agent would not be able to connect anymore,
+		// so allow onboarding to be retried with a new token.
+		if derr := a.kubeclient.CoreV1().Secrets(a.namespace).Delete(ctx, secret.Name, metav1.DeleteOptions{}); derr != nil {
+			logCtx.WithError(derr).Error("Could not clean up pre-shared key")
+		}
+		return "", fmt.Errorf("could not send credentials to agent: %w", err)
+	}
+
+	logCtx.Info("Agent onboarded using bootstrap token")
+	return agentID, nil
+}
+
+// AgentFromToken returns the name of the agent the bootstrap token was issued
+// for, without validating the token. It is meant to be used by agents, which
+// cannot validate tokens issued by the principal.
+func AgentFromToken(token string) (string, error) {
+	claims := jwt.RegisteredClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, &claims); err != nil {
+		return "", fmt.Errorf("could not parse bootstrap token: %w", err)
+	}
+	if claims.Subject == "" {
+		return "", fmt.Errorf("bootstrap token has no subject")
+	}
+	return claims.Subject, nil
+}
+
+// ensureNamespace creates the namespace for the agent on the principal if it
+// does not exist yet.
+func (a *BootstrapAuthentication) ensureNamespace(ctx context.Context, agentID string) error {
+	ns := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   agentID,
+			Labels: map[string]string{LabelKeyBootstrapped: "true"},
+		},
+	}
+	_, err := a.kubeclient.CoreV1().Namespaces().Create(ctx, ns, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("could not create namespace for agent %s: %w", agentID, err)
+	}
+	return nil
+}
+
+func log() *logrus.Entry {
+	return logging.GetDefaultLogger().ComponentLogger("AuthBootstrap")
+}
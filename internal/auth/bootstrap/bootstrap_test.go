@@ -0,0 +1,188 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/internal/auth"
+	"github.com/argoproj-labs/argocd-agent/internal/auth/psk"
+	"github.com/argoproj-labs/argocd-agent/internal/issuer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// fakeTransportStream captures the headers set by the auth method
+type fakeTransportStream struct {
+	header metadata.MD
+	err    error
+}
+
+func (f *fakeTransportStream) Method() string {
+	return "/authapi.Authentication/Authenticate"
+}
+
+func (f *fakeTransportStream) SetHeader(md metadata.MD) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.header = metadata.Join(f.header, md)
+	return nil
+}
+
+func (f *fakeTransportStream) SendHeader(md metadata.MD) error {
+	return f.SetHeader(md)
+}
+
+func (f *fakeTransportStream) SetTrailer(md metadata.MD) error {
+	return nil
+}
+
+func newIssuer(t *testing.T) *issuer.JwtIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	i, err := issuer.NewIssuer(issuer.PrincipalIssuerName, issuer.WithRSAPrivateKey(key))
+	require.NoError(t, err)
+	return i
+}
+
+func Test_Authenticate(t *testing.T) {
+	iss := newIssuer(t)
+
+	t.Run("Successful onboarding", func(t *testing.T) {
+		client := fake.NewSimpleClientset()
+		a := NewBootstrapAuthentication(iss, client, "argocd", "")
+		require.NoError(t, a.Init())
+		tok, err := iss.IssueBootstrapToken("agent-1", time.Minute)
+		require.NoError(t, err)
+
+		stream := &fakeTransportStream{}
+		ctx := grpc.NewContextWithServerTransportStream(context.TODO(), stream)
+		agent, err := a.Authenticate(ctx, auth.Credentials{TokenField: tok})
+		require.NoError(t, err)
+		assert.Equal(t, "agent-1", agent)
+
+		keys := stream.header.Get(CredentialsHeader)
+		require.Len(t, keys, 1)
+		secret, err := client.CoreV1().Secrets("argocd").Get(context.TODO(), psk.DefaultSecretPrefix+"agent-1", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, keys[0], string(secret.Data[psk.SecretKeyField]))
+		assert.Equal(t, "true", secret.Labels[LabelKeyBootstrapped])
+		_, err = client.CoreV1().Namespaces().Get(context.TODO(), "agent-1", metav1.GetOptions{})
+		assert.NoError(t, err)
+
+		// The issued key must be usable with the psk auth method
+		pskAuth := psk.NewPSKAuthentication(client, "argocd", "")
+		agent, err = pskAuth.Authenticate(context.TODO(), psk.NewCredentials("agent-1", []byte(keys[0]), time.Now()))
+		require.NoError(t, err)
+		assert.Equal(t, "agent-1", agent)
+
+		t.Run("Token cannot be reused", func(t *testing.T) {
+			_, err := a.Authenticate(ctx, auth.Credentials{TokenField: tok})
+			assert.ErrorContains(t, err, "already been used")
+		})
+
+		t.Run("Agent cannot be onboarded twice", func(t *testing.T) {
+			tok, err := iss.IssueBootstrapToken("agent-1", time.Minute)
+			require.NoError(t, err)
+			_, err = a.Authenticate(ctx, auth.Credentials{TokenField: tok})
+			assert.ErrorContains(t, err, "already been onboarded")
+		})
+	})
+
+	t.Run("Custom secret prefix", func(t *testing.T) {
+		client := fake.NewSimpleClientset()
+		a := NewBootstrapAuthentication(iss, client, "argocd", "custom-")
+		tok, err := iss.IssueBootstrapToken("agent-1", time.Minute)
+		require.NoError(t, err)
+		ctx := grpc.NewContextWithServerTransportStream(context.TODO(), &fakeTransportStream{})
+		_, err = a.Authenticate(ctx, auth.Credentials{TokenField: tok})
+		require.NoError(t, err)
+		_, err = client.CoreV1().Secrets("argocd").Get(context.TODO(), "custom-agent-1", metav1.GetOptions{})
+		assert.NoError(t, err)
+	})
+
+	t.Run("Key cannot be sent to agent", func(t *testing.T) {
+		client := fake.NewSimpleClientset()
+		a := NewBootstrapAuthentication(iss, client, "argocd", "")
+		tok, err := iss.IssueBootstrapToken("agent-1", time.Minute)
+		require.NoError(t, err)
+		ctx := grpc.NewContextWithServerTransportStream(context.TODO(), &fakeTransportStream{err: fmt.Errorf("stream closed")})
+		_, err = a.Authenticate(ctx, auth.Credentials{TokenField: tok})
+		assert.ErrorContains(t, err, "could not send credentials")
+		_, err = client.CoreV1().Secrets("argocd").Get(context.TODO(), psk.DefaultSecretPrefix+"agent-1", metav1.GetOptions{})
+		assert.Error(t, err)
+	})
+
+	t.Run("Invalid tokens", func(t *testing.T) {
+		a := NewBootstrapAuthentication(iss, fake.NewSimpleClientset(), "argocd", "")
+		ctx := grpc.NewContextWithServerTransportStream(context.TODO(), &fakeTransportStream{})
+
+		_, err := a.Authenticate(ctx, auth.Credentials{})
+		assert.ErrorContains(t, err, "token is missing")
+
+		_, err = a.Authenticate(ctx, auth.Credentials{TokenField: "invalid"})
+		assert.ErrorContains(t, err, "could not validate bootstrap token")
+
+		at, err := iss.IssueAccessToken("agent-1", time.Minute)
+		require.NoError(t, err)
+		_, err = a.Authenticate(ctx, auth.Credentials{TokenField: at})
+		assert.ErrorContains(t, err, "could not validate bootstrap token")
+
+		expired, err := iss.IssueBootstrapToken("agent-1", -time.Minute)
+		require.NoError(t, err)
+		_, err = a.Authenticate(ctx, auth.Credentials{TokenField: expired})
+		assert.ErrorContains(t, err, "could not validate bootstrap token")
+
+		other, err := newIssuer(t).IssueBootstrapToken("agent-1", time.Minute)
+		require.NoError(t, err)
+		_, err = a.Authenticate(ctx, auth.Credentials{TokenField: other})
+		assert.ErrorContains(t, err, "could not validate bootstrap token")
+
+		invalidName, err := iss.IssueBootstrapToken("Agent_1", time.Minute)
+		require.NoError(t, err)
+		_, err = a.Authenticate(ctx, auth.Credentials{TokenField: invalidName})
+		assert.ErrorContains(t, err, "invalid agent ID")
+	})
+}
+
+func Test_Init(t *testing.T) {
+	iss := newIssuer(t)
+	assert.Error(t, NewBootstrapAuthentication(nil, fake.NewSimpleClientset(), "argocd", "").Init())
+	assert.Error(t, NewBootstrapAuthentication(iss, nil, "argocd", "").Init())
+	assert.Error(t, NewBootstrapAuthentication(iss, fake.NewSimpleClientset(), "", "").Init())
+	assert.NoError(t, NewBootstrapAuthentication(iss, fake.NewSimpleClientset(), "argocd", "").Init())
+}
+
+func Test_AgentFromToken(t *testing.T) {
+	tok, err := newIssuer(t).IssueBootstrapToken("agent-1", time.Minute)
+	require.NoError(t, err)
+	agent, err := AgentFromToken(tok)
+	require.NoError(t, err)
+	assert.Equal(t, "agent-1", agent)
+
+	_, err = AgentFromToken("invalid")
+	assert.Error(t, err)
+}
@@ -0,0 +1,64 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// ClusterLabelsHeader is the name of the gRPC metadata in which an agent
+// declares the labels it wants on its cluster secret when it authenticates
+const ClusterLabelsHeader = "x-argocd-agent-cluster-labels"
+
+// EncodeClusterLabels returns labels in the form sent in ClusterLabelsHeader,
+// i.e. as key=value pairs sorted by key and separated by commas
+func EncodeClusterLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	slices.Sort(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// ParseClusterLabels parses labels in the form sent in ClusterLabelsHeader.
+// It returns an error if any key or value is not a valid Kubernetes label.
+func ParseClusterLabels(s string) (map[string]string, error) {
+	labels := map[string]string{}
+	if strings.TrimSpace(s) == "" {
+		return labels, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("cluster label %q is not of the form key=value", pair)
+		}
+		if errs := validation.IsQualifiedName(k); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid cluster label key %q: %s", k, strings.Join(errs, "; "))
+		}
+		if errs := validation.IsValidLabelValue(v); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid value for cluster label %s: %s", k, strings.Join(errs, "; "))
+		}
+		if _, dup := labels[k]; dup {
+			return nil, fmt.Errorf("cluster label %s is given more than once", k)
+		}
+		labels[k] = v
+	}
+	return labels, nil
+}
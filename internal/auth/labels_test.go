@@ -0,0 +1,51 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ClusterLabels(t *testing.T) {
+	t.Run("Round trip", func(t *testing.T) {
+		labels := map[string]string{"region": "eu-west-1", "example.com/tier": "prod", "empty": ""}
+		encoded := EncodeClusterLabels(labels)
+		assert.Equal(t, "empty=,example.com/tier=prod,region=eu-west-1", encoded)
+		parsed, err := ParseClusterLabels(encoded)
+		require.NoError(t, err)
+		assert.Equal(t, labels, parsed)
+	})
+	t.Run("No labels", func(t *testing.T) {
+		assert.Equal(t, "", EncodeClusterLabels(nil))
+		parsed, err := ParseClusterLabels("")
+		require.NoError(t, err)
+		assert.Empty(t, parsed)
+	})
+	t.Run("Invalid labels", func(t *testing.T) {
+		for _, s := range []string{
+			"region",
+			"=eu",
+			"region=eu west",
+			"in valid=eu",
+			"region=eu,region=us",
+		} {
+			_, err := ParseClusterLabels(s)
+			assert.Error(t, err, s)
+		}
+	})
+}
@@ -0,0 +1,153 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package oidc implements authentication of agents using JWTs issued by an
+// external OpenID Connect identity provider.
+package oidc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/argoproj-labs/argocd-agent/internal/auth"
+	"github.com/argoproj-labs/argocd-agent/internal/logging"
+	gooidc "github.com/coreos/go-oidc/v3/oidc"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/validation"
+)
+
+var _ auth.Method = &OIDCAuthentication{}
+
+// TokenField is the name of the field in the Credentials containing the JWT
+const TokenField = "token"
+
+// DefaultAgentClaim is the claim used to map a token to an agent, unless
+// configured otherwise.
+const DefaultAgentClaim = "sub"
+
+// Config holds the configuration for the OIDC authentication method.
+type Config struct {
+	// IssuerURL is the URL of the identity provider. It must match the iss
+	// claim of incoming tokens exactly.
+	IssuerURL string
+	// JWKSURL is the URL to fetch the identity provider's signing keys from.
+	// If empty, the URL will be discovered from the issuer's
+	// .well-known/openid-configuration endpoint.
+	JWKSURL string
+	// Audience is the expected value of the aud claim of incoming tokens.
+	Audience string
+	// AgentClaim is the name of the claim holding the agent's name. Defaults
+	// to DefaultAgentClaim. The value of the claim must be a string.
+	AgentClaim string
+}
+
+// OIDCAuthentication implements authentication using JWTs issued by an
+// external OIDC identity provider.
+//
+// The token's signature is verified against the signing keys published by the
+// identity provider, and the token's issuer, audience and expiry are
+// validated. The agent's name is taken from the configured claim.
+//
+// Needs to be initialized properly before being used.
+type OIDCAuthentication struct {
+	config   Config
+	verifier *gooidc.IDTokenVerifier
+}
+
+// NewOIDCAuthentication creates a new instance of OIDCAuthentication with the
+// given configuration.
+func NewOIDCAuthentication(config Config) *OIDCAuthentication {
+	if config.AgentClaim == "" {
+		config.AgentClaim = DefaultAgentClaim
+	}
+	return &OIDCAuthentication{config: config}
+}
+
+// Init validates the configuration and sets up the token verifier. Unless a
+// JWKS URL is configured, Init will perform OIDC discovery against the issuer.
+func (a *OIDCAuthentication) Init() error {
+	if a.config.IssuerURL == "" {
+		return fmt.Errorf("issuer URL cannot be empty")
+	}
+	if a.config.Audience == "" {
+		return fmt.Errorf("audience cannot be empty")
+	}
+	ctx := context.Background()
+	cfg := &gooidc.Config{ClientID: a.config.Audience}
+	if a.config.JWKSURL != "" {
+		keySet := gooidc.NewRemoteKeySet(ctx, a.config.JWKSURL)
+		a.verifier = gooidc.NewVerifier(a.config.IssuerURL, keySet, cfg)
+		return nil
+	}
+	provider, err := gooidc.NewProvider(ctx, a.config.IssuerURL)
+	if err != nil {
+		return fmt.Errorf("could not discover OIDC provider %s: %w", a.config.IssuerURL, err)
+	}
+	a.verifier = provider.Verifier(cfg)
+	return nil
+}
+
+// Authenticate verifies the JWT in creds and returns the agent name taken from
+// the configured claim.
+func (a *OIDCAuthentication) Authenticate(ctx context.Context, creds auth.Credentials) (string, error) {
+	if a.verifier == nil {
+		return "", fmt.Errorf("oidc authentication is not initialized")
+	}
+	rawToken, ok := creds[TokenField]
+	if !ok || rawToken == "" {
+		return "", fmt.Errorf("token is missing from credentials")
+	}
+
+	token, err := a.verifier.Verify(ctx, rawToken)
+	if err != nil {
+		return "", fmt.Errorf("could not verify token: %w", err)
+	}
+
+	var agentID string
+	if a.config.AgentClaim == DefaultAgentClaim {
+		agentID = token.Subject
+	} else {
+		claims := map[string]any{}
+		if err := token.Claims(&claims); err != nil {
+			return "", fmt.Errorf("could not decode claims: %w", err)
+		}
+		v, ok := claims[a.config.AgentClaim]
+		if !ok {
+			return "", fmt.Errorf("claim '%s' not found in token", a.config.AgentClaim)
+		}
+		agentID, ok = v.(string)
+		if !ok {
+			return "", fmt.Errorf("claim '%s' is not a string", a.config.AgentClaim)
+		}
+	}
+	if agentID == "" {
+		return "", fmt.Errorf("claim '%s' is empty", a.config.AgentClaim)
+	}
+
+	errs := validation.NameIsDNSLabel(agentID, false)
+	if len(errs) > 0 {
+		return "", fmt.Errorf("invalid agent ID '%s' in claim '%s': %v", agentID, a.config.AgentClaim, errs)
+	}
+
+	log().WithFields(logrus.Fields{
+		"issuer":   token.Issuer,
+		"claim":    a.config.AgentClaim,
+		"agent_id": agentID,
+	}).Info("Extracted agent identity from OIDC token")
+	return agentID, nil
+}
+
+func log() *logrus.Entry {
+	return logging.GetDefaultLogger().ComponentLogger("AuthOIDC")
+}
@@ -0,0 +1,179 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/internal/auth"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testKeyID = "test-key"
+
+// jwksServer starts a HTTP server publishing the public part of key as JWKS
+func jwksServer(t *testing.T, key *rsa.PrivateKey) *httptest.Server {
+	t.Helper()
+	jwks := map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": testKeyID,
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(jwks)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func signToken(t *testing.T, key *rsa.PrivateKey, claims jwt.MapClaims) string {
+	t.Helper()
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	tok.Header["kid"] = testKeyID
+	s, err := tok.SignedString(key)
+	require.NoError(t, err)
+	return s
+}
+
+func Test_Authenticate(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	srv := jwksServer(t, key)
+	issuer := "https://idp.example.com"
+
+	claims := func(mod func(c jwt.MapClaims)) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"iss":   issuer,
+			"aud":   "argocd-agent",
+			"sub":   "agent-1",
+			"agent": "agent-2",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"iat":   time.Now().Unix(),
+		}
+		if mod != nil {
+			mod(c)
+		}
+		return c
+	}
+
+	newAuth := func(t *testing.T, claim string) *OIDCAuthentication {
+		a := NewOIDCAuthentication(Config{IssuerURL: issuer, JWKSURL: srv.URL, Audience: "argocd-agent", AgentClaim: claim})
+		require.NoError(t, a.Init())
+		return a
+	}
+
+	t.Run("Successful authentication using sub claim", func(t *testing.T) {
+		a := newAuth(t, "")
+		id, err := a.Authenticate(context.TODO(), auth.Credentials{TokenField: signToken(t, key, claims(nil))})
+		require.NoError(t, err)
+		assert.Equal(t, "agent-1", id)
+	})
+
+	t.Run("Successful authentication using custom claim", func(t *testing.T) {
+		a := newAuth(t, "agent")
+		id, err := a.Authenticate(context.TODO(), auth.Credentials{TokenField: signToken(t, key, claims(nil))})
+		require.NoError(t, err)
+		assert.Equal(t, "agent-2", id)
+	})
+
+	t.Run("Custom claim missing", func(t *testing.T) {
+		a := newAuth(t, "agent")
+		tok := signToken(t, key, claims(func(c jwt.MapClaims) { delete(c, "agent") }))
+		_, err := a.Authenticate(context.TODO(), auth.Credentials{TokenField: tok})
+		assert.ErrorContains(t, err, "not found")
+	})
+
+	t.Run("Custom claim not a string", func(t *testing.T) {
+		a := newAuth(t, "agent")
+		tok := signToken(t, key, claims(func(c jwt.MapClaims) { c["agent"] = 42 }))
+		_, err := a.Authenticate(context.TODO(), auth.Credentials{TokenField: tok})
+		assert.ErrorContains(t, err, "not a string")
+	})
+
+	t.Run("Wrong audience", func(t *testing.T) {
+		a := newAuth(t, "")
+		tok := signToken(t, key, claims(func(c jwt.MapClaims) { c["aud"] = "other" }))
+		_, err := a.Authenticate(context.TODO(), auth.Credentials{TokenField: tok})
+		assert.ErrorContains(t, err, "could not verify token")
+	})
+
+	t.Run("Wrong issuer", func(t *testing.T) {
+		a := newAuth(t, "")
+		tok := signToken(t, key, claims(func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }))
+		_, err := a.Authenticate(context.TODO(), auth.Credentials{TokenField: tok})
+		assert.ErrorContains(t, err, "could not verify token")
+	})
+
+	t.Run("Expired token", func(t *testing.T) {
+		a := newAuth(t, "")
+		tok := signToken(t, key, claims(func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }))
+		_, err := a.Authenticate(context.TODO(), auth.Credentials{TokenField: tok})
+		assert.ErrorContains(t, err, "could not verify token")
+	})
+
+	t.Run("Signed with unknown key", func(t *testing.T) {
+		a := newAuth(t, "")
+		_, err := a.Authenticate(context.TODO(), auth.Credentials{TokenField: signToken(t, otherKey, claims(nil))})
+		assert.ErrorContains(t, err, "could not verify token")
+	})
+
+	t.Run("Invalid agent name", func(t *testing.T) {
+		a := newAuth(t, "")
+		tok := signToken(t, key, claims(func(c jwt.MapClaims) { c["sub"] = "Not_A_Label" }))
+		_, err := a.Authenticate(context.TODO(), auth.Credentials{TokenField: tok})
+		assert.ErrorContains(t, err, "invalid agent ID")
+	})
+
+	t.Run("Missing token", func(t *testing.T) {
+		a := newAuth(t, "")
+		_, err := a.Authenticate(context.TODO(), auth.Credentials{})
+		assert.ErrorContains(t, err, "token is missing")
+	})
+}
+
+func Test_Init(t *testing.T) {
+	t.Run("Missing issuer", func(t *testing.T) {
+		a := NewOIDCAuthentication(Config{Audience: "argocd-agent"})
+		assert.ErrorContains(t, a.Init(), "issuer URL")
+	})
+	t.Run("Missing audience", func(t *testing.T) {
+		a := NewOIDCAuthentication(Config{IssuerURL: "https://idp.example.com"})
+		assert.ErrorContains(t, a.Init(), "audience")
+	})
+	t.Run("Not initialized", func(t *testing.T) {
+		a := NewOIDCAuthentication(Config{})
+		_, err := a.Authenticate(context.TODO(), auth.Credentials{TokenField: "x"})
+		assert.ErrorContains(t, err, "not initialized")
+	})
+}
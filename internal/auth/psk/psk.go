@@ -0,0 +1,183 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package psk implements authentication of agents using per-agent pre-shared
+// keys. Instead of sending the key itself, the agent proves possession of the
+// key by sending an HMAC over its name and the current time.
+package psk
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/internal/auth"
+	"github.com/argoproj-labs/argocd-agent/internal/logging"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/validation"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+var _ auth.Method = &PSKAuthentication{}
+
+const (
+	// AgentIDField is the name of the field in the Credentials containing
+	// the agent's name
+	AgentIDField = "agentid"
+	// TimestampField is the name of the field in the Credentials containing
+	// the time the credentials were created, in seconds since the epoch
+	TimestampField = "timestamp"
+	// SignatureField is the name of the field in the Credentials containing
+	// the hex encoded HMAC
+	SignatureField = "signature"
+)
+
+const (
+	// SecretKeyField is the field in an agent's Secret holding the current
+	// pre-shared key
+	SecretKeyField = "psk"
+	// PreviousSecretKeyField is the field in an agent's Secret holding the
+	// previous pre-shared key, which is still accepted during rotation
+	PreviousSecretKeyField = "psk.previous"
+)
+
+// DefaultSecretPrefix is the default prefix of the names of the Secrets
+// holding the agents' pre-shared keys. The name of the agent is appended to
+// the prefix.
+const DefaultSecretPrefix = "argocd-agent-psk-"
+
+// DefaultMaxClockSkew is the default maximum difference between the
+// timestamp in the credentials and the principal's clock.
+const DefaultMaxClockSkew = 5 * time.Minute
+
+var errAuthFailed = errors.New("authentication failed")
+
+// PSKAuthentication implements authentication using per-agent pre-shared
+// keys, which are stored in one Kubernetes Secret per agent in the
+// principal's namespace.
+//
+// Keys are looked up on each authentication attempt, so that they can be
+// rotated without restarting the principal. To rotate a key without downtime,
+// move the current key to the PreviousSecretKeyField, set a new key and
+// remove the previous key after all agents have been updated.
+type PSKAuthentication struct {
+	kubeclient   kubernetes.Interface
+	namespace    string
+	secretPrefix string
+	maxClockSkew time.Duration
+	now          func() time.Time
+}
+
+// NewPSKAuthentication creates a new instance of PSKAuthentication, reading
+// keys from Secrets in namespace named secretPrefix followed by the agent's
+// name. If secretPrefix is empty, DefaultSecretPrefix is used.
+func NewPSKAuthentication(kubeclient kubernetes.Interface, namespace, secretPrefix string) *PSKAuthentication {
+	if secretPrefix == "" {
+		secretPrefix = DefaultSecretPrefix
+	}
+	return &PSKAuthentication{
+		kubeclient:   kubeclient,
+		namespace:    namespace,
+		secretPrefix: secretPrefix,
+		maxClockSkew: DefaultMaxClockSkew,
+		now:          time.Now,
+	}
+}
+
+// Init validates the configuration of the auth method.
+func (a *PSKAuthentication) Init() error {
+	if a.kubeclient == nil {
+		return fmt.Errorf("kubernetes client cannot be nil")
+	}
+	if a.namespace == "" {
+		return fmt.Errorf("namespace cannot be empty")
+	}
+	return nil
+}
+
+// Authenticate verifies the HMAC in creds against the pre-shared key of the
+// agent, and returns the agent's name on success.
+func (a *PSKAuthentication) Authenticate(ctx context.Context, creds auth.Credentials) (string, error) {
+	agentID, ok := creds[AgentIDField]
+	if !ok || agentID == "" {
+		return "", fmt.Errorf("agent ID is missing from credentials")
+	}
+	if errs := validation.NameIsDNSLabel(agentID, false); len(errs) > 0 {
+		return "", fmt.Errorf("invalid agent ID '%s': %v", agentID, errs)
+	}
+	ts, err := strconv.ParseInt(creds[TimestampField], 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid timestamp in credentials")
+	}
+	signature, err := hex.DecodeString(creds[SignatureField])
+	if err != nil || len(signature) == 0 {
+		return "", fmt.Errorf("invalid signature in credentials")
+	}
+
+	skew := a.now().Sub(time.Unix(ts, 0))
+	if skew > a.maxClockSkew || skew < -a.maxClockSkew {
+		log().WithField("agent_id", agentID).Warnf("Credentials timestamp is off by %v", skew)
+		return "", errAuthFailed
+	}
+
+	secret, err := a.kubeclient.CoreV1().Secrets(a.namespace).Get(ctx, a.secretPrefix+agentID, metav1.GetOptions{})
+	if err != nil {
+		log().WithField("agent_id", agentID).WithError(err).Warn("Could not get pre-shared key")
+		return "", errAuthFailed
+	}
+
+	for _, field := range []string{SecretKeyField, PreviousSecretKeyField} {
+		key := secret.Data[field]
+		if len(key) == 0 {
+			continue
+		}
+		if hmac.Equal(signature, mac(key, agentID, ts)) {
+			log().WithFields(logrus.Fields{
+				"agent_id": agentID,
+				"field":    field,
+			}).Info("Successful pre-shared key authentication")
+			return agentID, nil
+		}
+	}
+
+	return "", errAuthFailed
+}
+
+// NewCredentials creates credentials for the agent agentID, signed with the
+// given pre-shared key at time now.
+func NewCredentials(agentID string, key []byte, now time.Time) auth.Credentials {
+	ts := now.Unix()
+	return auth.Credentials{
+		AgentIDField:   agentID,
+		TimestampField: strconv.FormatInt(ts, 10),
+		SignatureField: hex.EncodeToString(mac(key, agentID, ts)),
+	}
+}
+
+// mac returns the HMAC-SHA256 over agentID and ts using key
+func mac(key []byte, agentID string, ts int64) []byte {
+	h := hmac.New(sha256.New, key)
+	fmt.Fprintf(h, "%s\n%d", agentID, ts)
+	return h.Sum(nil)
+}
+
+func log() *logrus.Entry {
+	return logging.GetDefaultLogger().ComponentLogger("AuthPSK")
+}
@@ -0,0 +1,95 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package psk
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/internal/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func pskSecret(agent string, data map[string]string) *corev1.Secret {
+	s := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: DefaultSecretPrefix + agent, Namespace: "argocd"},
+		Data:       map[string][]byte{},
+	}
+	for k, v := range data {
+		s.Data[k] = []byte(v)
+	}
+	return s
+}
+
+func Test_Authenticate(t *testing.T) {
+	now := time.Now()
+	client := fake.NewSimpleClientset(
+		pskSecret("agent-1", map[string]string{SecretKeyField: "current"}),
+		pskSecret("agent-2", map[string]string{SecretKeyField: "new", PreviousSecretKeyField: "old"}),
+	)
+	a := NewPSKAuthentication(client, "argocd", "")
+	require.NoError(t, a.Init())
+
+	tests := []struct {
+		name          string
+		creds         auth.Credentials
+		expectedAgent string
+		errorContains string
+	}{
+		{"Valid key", NewCredentials("agent-1", []byte("current"), now), "agent-1", ""},
+		{"Valid key within clock skew", NewCredentials("agent-1", []byte("current"), now.Add(-time.Minute)), "agent-1", ""},
+		{"Current key during rotation", NewCredentials("agent-2", []byte("new"), now), "agent-2", ""},
+		{"Previous key during rotation", NewCredentials("agent-2", []byte("old"), now), "agent-2", ""},
+		{"Wrong key", NewCredentials("agent-1", []byte("wrong"), now), "", "authentication failed"},
+		{"Key of another agent", NewCredentials("agent-2", []byte("current"), now), "", "authentication failed"},
+		{"Unknown agent", NewCredentials("agent-3", []byte("current"), now), "", "authentication failed"},
+		{"Expired timestamp", NewCredentials("agent-1", []byte("current"), now.Add(-time.Hour)), "", "authentication failed"},
+		{"Future timestamp", NewCredentials("agent-1", []byte("current"), now.Add(time.Hour)), "", "authentication failed"},
+		{"Missing agent ID", auth.Credentials{}, "", "agent ID is missing"},
+		{"Invalid agent ID", NewCredentials("Agent_1", []byte("current"), now), "", "invalid agent ID"},
+		{"Invalid timestamp", auth.Credentials{AgentIDField: "agent-1", TimestampField: "yesterday"}, "", "invalid timestamp"},
+		{"Invalid signature", auth.Credentials{AgentIDField: "agent-1", TimestampField: "1", SignatureField: "zz"}, "", "invalid signature"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agent, err := a.Authenticate(context.TODO(), tt.creds)
+			if tt.errorContains != "" {
+				assert.ErrorContains(t, err, tt.errorContains)
+				assert.Empty(t, agent)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedAgent, agent)
+			}
+		})
+	}
+
+	t.Run("Signature is bound to the agent ID", func(t *testing.T) {
+		creds := NewCredentials("agent-1", []byte("current"), now)
+		creds[AgentIDField] = "agent-2"
+		_, err := a.Authenticate(context.TODO(), creds)
+		assert.ErrorContains(t, err, "authentication failed")
+	})
+}
+
+func Test_Init(t *testing.T) {
+	assert.Error(t, NewPSKAuthentication(nil, "argocd", "").Init())
+	assert.Error(t, NewPSKAuthentication(fake.NewSimpleClientset(), "", "").Init())
+	assert.NoError(t, NewPSKAuthentication(fake.NewSimpleClientset(), "argocd", "").Init())
+}
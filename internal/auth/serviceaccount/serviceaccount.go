@@ -0,0 +1,155 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package serviceaccount implements authentication of agents using projected
+// Kubernetes ServiceAccount tokens. Tokens presented by the agent are
+// validated by the Kubernetes API using the TokenReview API.
+package serviceaccount
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/argoproj-labs/argocd-agent/internal/auth"
+	"github.com/argoproj-labs/argocd-agent/internal/logging"
+	"github.com/sirupsen/logrus"
+	authv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/api/validation"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+var _ auth.Method = &ServiceAccountAuthentication{}
+
+// TokenField is the name of the field in the Credentials containing the
+// ServiceAccount token
+const TokenField = "token"
+
+// DefaultAgentIDRegex extracts the name of the ServiceAccount from the user
+// name returned by the TokenReview API. It matches ServiceAccounts in any
+// namespace, which is why tokens must be issued for a dedicated audience.
+var DefaultAgentIDRegex = regexp.MustCompile(`^system:serviceaccount:[^:]+:([^:]+)$`)
+
+// ServiceAccountAuthentication implements authentication using projected
+// ServiceAccount tokens.
+//
+// The token is sent to the Kubernetes API of the principal's cluster for
+// review. Tokens of ServiceAccounts in other clusters are only accepted if the
+// principal's API server trusts their issuer. On success, the agent ID is
+// extracted from the authenticated user name using the configured agent ID
+// regex.
+//
+// Every ServiceAccount's automounted token is valid for the API server's
+// default audiences. To keep workloads from authenticating as agents with
+// those tokens, agent tokens must be issued for at least one audience that
+// is dedicated to argocd-agent.
+type ServiceAccountAuthentication struct {
+	kubeClient   kubernetes.Interface
+	audiences    []string
+	agentIDRegex *regexp.Regexp
+}
+
+// NewServiceAccountAuthentication creates a new instance of
+// ServiceAccountAuthentication. Tokens must be issued for at least one of the
+// given audiences, which must not be empty. If regex is nil, the
+// DefaultAgentIDRegex is used.
+func NewServiceAccountAuthentication(kubeClient kubernetes.Interface, audiences []string, regex *regexp.Regexp) *ServiceAccountAuthentication {
+	if regex == nil {
+		regex = DefaultAgentIDRegex
+	}
+	return &ServiceAccountAuthentication{
+		kubeClient:   kubeClient,
+		audiences:    audiences,
+		agentIDRegex: regex,
+	}
+}
+
+// Authenticate reviews the token in creds and returns the agent ID extracted
+// from the authenticated user name.
+func (a *ServiceAccountAuthentication) Authenticate(ctx context.Context, creds auth.Credentials) (string, error) {
+	token, ok := creds[TokenField]
+	if !ok || token == "" {
+		return "", fmt.Errorf("token is missing from credentials")
+	}
+	if len(a.audiences) == 0 {
+		return "", fmt.Errorf("no token audiences configured")
+	}
+
+	review := &authv1.TokenReview{
+		Spec: authv1.TokenReviewSpec{
+			Token:     token,
+			Audiences: a.audiences,
+		},
+	}
+	result, err := a.kubeClient.AuthenticationV1().TokenReviews().Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		return "", fmt.Errorf("could not review token: %w", err)
+	}
+	if !result.Status.Authenticated {
+		if result.Status.Error != "" {
+			return "", fmt.Errorf("token not authenticated: %s", result.Status.Error)
+		}
+		return "", fmt.Errorf("token not authenticated")
+	}
+	if !audiencesIntersect(a.audiences, result.Status.Audiences) {
+		return "", fmt.Errorf("token is not valid for any of the expected audiences")
+	}
+
+	username := result.Status.User.Username
+	matches := a.agentIDRegex.FindStringSubmatch(username)
+	if len(matches) < 2 || matches[1] == "" {
+		return "", fmt.Errorf("user '%s' does not match the agent ID regex pattern", username)
+	}
+	agentID := matches[1]
+
+	errs := validation.NameIsDNSLabel(agentID, false)
+	if len(errs) > 0 {
+		return "", fmt.Errorf("invalid agent ID '%s' extracted from token: %v", agentID, errs)
+	}
+
+	log().WithFields(logrus.Fields{
+		"user":     username,
+		"agent_id": agentID,
+	}).Info("Extracted agent identity from ServiceAccount token")
+	return agentID, nil
+}
+
+// Init initializes the authentication method.
+func (a *ServiceAccountAuthentication) Init() error {
+	if a.kubeClient == nil {
+		return fmt.Errorf("kubernetes client cannot be nil")
+	}
+	if len(a.audiences) == 0 {
+		return fmt.Errorf("at least one token audience is required, since any ServiceAccount token is valid for the default audiences")
+	}
+	return nil
+}
+
+// audiencesIntersect returns true if at least one of the audiences in want
+// is also contained in have.
+func audiencesIntersect(want, have []string) bool {
+	for _, w := range want {
+		for _, h := range have {
+			if w == h {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func log() *logrus.Entry {
+	return logging.GetDefaultLogger().ComponentLogger("AuthServiceAccount")
+}
@@ -0,0 +1,136 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package serviceaccount
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/argoproj-labs/argocd-agent/internal/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	authv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	kubetesting "k8s.io/client-go/testing"
+)
+
+// fakeReviewer returns a fake clientset that answers TokenReviews for the
+// token "valid" with the given status.
+func fakeReviewer(status authv1.TokenReviewStatus) *fake.Clientset {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "tokenreviews", func(action kubetesting.Action) (bool, runtime.Object, error) {
+		review := action.(kubetesting.CreateAction).GetObject().(*authv1.TokenReview)
+		if review.Spec.Token == "error" {
+			return true, nil, errors.New("api unavailable")
+		}
+		if review.Spec.Token != "valid" {
+			return true, &authv1.TokenReview{Status: authv1.TokenReviewStatus{Authenticated: false, Error: "invalid token"}}, nil
+		}
+		return true, &authv1.TokenReview{Status: status}, nil
+	})
+	return client
+}
+
+func Test_Authenticate(t *testing.T) {
+	saStatus := authv1.TokenReviewStatus{
+		Authenticated: true,
+		User:          authv1.UserInfo{Username: "system:serviceaccount:argocd:agent-1"},
+		Audiences:     []string{"argocd-agent"},
+	}
+	audiences := []string{"argocd-agent"}
+
+	t.Run("Successful authentication with default regex", func(t *testing.T) {
+		a := NewServiceAccountAuthentication(fakeReviewer(saStatus), audiences, nil)
+		require.NoError(t, a.Init())
+		id, err := a.Authenticate(context.TODO(), auth.Credentials{TokenField: "valid"})
+		require.NoError(t, err)
+		assert.Equal(t, "agent-1", id)
+	})
+
+	t.Run("Successful authentication with custom regex", func(t *testing.T) {
+		a := NewServiceAccountAuthentication(fakeReviewer(saStatus), audiences, regexp.MustCompile(`^system:serviceaccount:([^:]+):`))
+		id, err := a.Authenticate(context.TODO(), auth.Credentials{TokenField: "valid"})
+		require.NoError(t, err)
+		assert.Equal(t, "argocd", id)
+	})
+
+	t.Run("Audience matches", func(t *testing.T) {
+		a := NewServiceAccountAuthentication(fakeReviewer(saStatus), []string{"other", "argocd-agent"}, nil)
+		id, err := a.Authenticate(context.TODO(), auth.Credentials{TokenField: "valid"})
+		require.NoError(t, err)
+		assert.Equal(t, "agent-1", id)
+	})
+
+	t.Run("Audience mismatch", func(t *testing.T) {
+		a := NewServiceAccountAuthentication(fakeReviewer(saStatus), []string{"other"}, nil)
+		_, err := a.Authenticate(context.TODO(), auth.Credentials{TokenField: "valid"})
+		assert.ErrorContains(t, err, "expected audiences")
+	})
+
+	t.Run("Missing audiences", func(t *testing.T) {
+		a := NewServiceAccountAuthentication(fakeReviewer(saStatus), nil, nil)
+		_, err := a.Authenticate(context.TODO(), auth.Credentials{TokenField: "valid"})
+		assert.ErrorContains(t, err, "no token audiences")
+	})
+
+	t.Run("Missing token", func(t *testing.T) {
+		a := NewServiceAccountAuthentication(fakeReviewer(saStatus), audiences, nil)
+		_, err := a.Authenticate(context.TODO(), auth.Credentials{})
+		assert.ErrorContains(t, err, "token is missing")
+	})
+
+	t.Run("Token not authenticated", func(t *testing.T) {
+		a := NewServiceAccountAuthentication(fakeReviewer(saStatus), audiences, nil)
+		_, err := a.Authenticate(context.TODO(), auth.Credentials{TokenField: "invalid"})
+		assert.ErrorContains(t, err, "invalid token")
+	})
+
+	t.Run("TokenReview API error", func(t *testing.T) {
+		a := NewServiceAccountAuthentication(fakeReviewer(saStatus), audiences, nil)
+		_, err := a.Authenticate(context.TODO(), auth.Credentials{TokenField: "error"})
+		assert.ErrorContains(t, err, "could not review token")
+	})
+
+	t.Run("User is not a ServiceAccount", func(t *testing.T) {
+		st := saStatus
+		st.User = authv1.UserInfo{Username: "admin"}
+		a := NewServiceAccountAuthentication(fakeReviewer(st), audiences, nil)
+		_, err := a.Authenticate(context.TODO(), auth.Credentials{TokenField: "valid"})
+		assert.ErrorContains(t, err, "does not match")
+	})
+
+	t.Run("Invalid agent ID", func(t *testing.T) {
+		st := saStatus
+		st.User = authv1.UserInfo{Username: "system:serviceaccount:argocd:Agent_1"}
+		a := NewServiceAccountAuthentication(fakeReviewer(st), audiences, nil)
+		_, err := a.Authenticate(context.TODO(), auth.Credentials{TokenField: "valid"})
+		assert.ErrorContains(t, err, "invalid agent ID")
+	})
+}
+
+func Test_Init(t *testing.T) {
+	t.Run("Missing client", func(t *testing.T) {
+		a := NewServiceAccountAuthentication(nil, []string{"argocd-agent"}, nil)
+		assert.Error(t, a.Init())
+	})
+
+	t.Run("Missing audiences", func(t *testing.T) {
+		a := NewServiceAccountAuthentication(fake.NewSimpleClientset(), nil, nil)
+		assert.ErrorContains(t, a.Init(), "audience")
+	})
+}
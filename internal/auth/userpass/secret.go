@@ -0,0 +1,165 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package userpass
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/internal/informer"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+// CredentialsLabel is the label identifying Secrets that hold credentials
+// for the userpass authentication method. Its value must be
+// CredentialsLabelValue.
+const CredentialsLabel = "argocd-agent.argoproj-labs.io/credentials"
+
+// CredentialsLabelValue is the value of CredentialsLabel on Secrets holding
+// userpass credentials.
+const CredentialsLabelValue = "userpass"
+
+// DefaultSecretSelector selects the Secrets holding userpass credentials
+const DefaultSecretSelector = CredentialsLabel + "=" + CredentialsLabelValue
+
+// syncTimeout is the time to wait for the informer to sync before giving up
+const syncTimeout = 30 * time.Second
+
+// secretDB keeps the entries of all credentials Secrets, keyed by the name of
+// the Secret, and merges them into the user database on each change.
+type secretDB struct {
+	mu      sync.Mutex
+	secrets map[string]map[string]string
+}
+
+// WatchSecrets keeps the user database in sync with the Secrets in namespace
+// matched by the label selector. Each key of such a Secret is a client ID,
+// and its value is the bcrypt hash of the client's password. Entries of all
+// matched Secrets are merged, and invalid entries are ignored. Any data
+// loaded before, e.g. from a file, is replaced.
+//
+// WatchSecrets starts an informer in the background, which is stopped when
+// ctx is done, and waits for the initial sync before returning.
+func (a *UserPassAuthentication) WatchSecrets(ctx context.Context, kubeclient kubernetes.Interface, namespace, selector string) error {
+	if selector == "" {
+		selector = DefaultSecretSelector
+	}
+	sel, err := labels.Parse(selector)
+	if err != nil {
+		return fmt.Errorf("invalid credentials secret selector: %w", err)
+	}
+	db := &secretDB{secrets: make(map[string]map[string]string)}
+	update := func(secret *corev1.Secret, deleted bool) {
+		db.mu.Lock()
+		defer db.mu.Unlock()
+		if deleted || !sel.Matches(labels.Set(secret.Labels)) {
+			delete(db.secrets, secret.Name)
+		} else {
+			db.secrets[secret.Name] = entriesFromSecret(secret)
+		}
+		a.setUserDB(db.merge())
+	}
+
+	inf, err := informer.NewInformer[*corev1.Secret](ctx,
+		informer.WithListHandler[*corev1.Secret](func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+			opts.LabelSelector = selector
+			return kubeclient.CoreV1().Secrets(namespace).List(ctx, opts)
+		}),
+		informer.WithWatchHandler[*corev1.Secret](func(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+			opts.LabelSelector = selector
+			return kubeclient.CoreV1().Secrets(namespace).Watch(ctx, opts)
+		}),
+		informer.WithAddHandler(func(secret *corev1.Secret) {
+			update(secret, false)
+		}),
+		informer.WithUpdateHandler(func(_ *corev1.Secret, secret *corev1.Secret) {
+			update(secret, false)
+		}),
+		informer.WithDeleteHandler(func(secret *corev1.Secret) {
+			update(secret, true)
+		}),
+		informer.WithGroupResource[*corev1.Secret]("", "secrets"),
+	)
+	if err != nil {
+		return fmt.Errorf("could not create credentials informer: %w", err)
+	}
+
+	// Until the informer has synced, no client can authenticate
+	a.setUserDB(make(map[string]string))
+
+	go func() {
+		if err := inf.Start(ctx); err != nil {
+			log().WithError(err).Error("Could not start credentials informer")
+		}
+	}()
+
+	syncCtx, cancel := context.WithTimeout(ctx, syncTimeout)
+	defer cancel()
+	if err := inf.WaitForSync(syncCtx); err != nil {
+		return fmt.Errorf("credentials informer did not sync: %w", err)
+	}
+	log().Infof("Watching Secrets in namespace %s matching %s for credentials", namespace, selector)
+	return nil
+}
+
+// entriesFromSecret returns the valid entries of a credentials Secret
+func entriesFromSecret(secret *corev1.Secret) map[string]string {
+	entries := make(map[string]string, len(secret.Data))
+	for clientID, hash := range secret.Data {
+		if err := validateEntry(clientID, string(hash)); err != nil {
+			log().WithFields(logrus.Fields{
+				"secret":    secret.Name,
+				"client_id": clientID,
+			}).Warnf("Ignoring invalid entry: %v", err)
+			continue
+		}
+		entries[clientID] = string(hash)
+	}
+	return entries
+}
+
+// merge merges the entries of all Secrets into a new user database. If a
+// client ID appears in more than one Secret, the entry from the Secret whose
+// name sorts first wins. Must be called with mu held.
+func (db *secretDB) merge() map[string]string {
+	userdb := make(map[string]string)
+	for _, name := range slices.Sorted(maps.Keys(db.secrets)) {
+		for clientID, hash := range db.secrets[name] {
+			if _, ok := userdb[clientID]; ok {
+				log().WithField("secret", name).Warnf("Client ID '%s' specified more than once", clientID)
+				continue
+			}
+			userdb[clientID] = hash
+		}
+	}
+	return userdb
+}
+
+// setUserDB replaces the user database
+func (a *UserPassAuthentication) setUserDB(userdb map[string]string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.userdb = userdb
+}
@@ -0,0 +1,94 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package userpass
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/internal/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+func credentialsSecret(t *testing.T, name string, labels map[string]string, passwords map[string]string) *corev1.Secret {
+	t.Helper()
+	data := make(map[string][]byte, len(passwords))
+	for clientID, password := range passwords {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+		require.NoError(t, err)
+		data[clientID] = hash
+	}
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "argocd", Labels: labels},
+		Data:       data,
+	}
+}
+
+func Test_WatchSecrets(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	labels := map[string]string{CredentialsLabel: CredentialsLabelValue}
+
+	authenticates := func(a *UserPassAuthentication, clientID, password string) bool {
+		id, err := a.Authenticate(ctx, auth.Credentials{ClientIDField: clientID, ClientSecretField: password})
+		return err == nil && id == clientID
+	}
+
+	first := credentialsSecret(t, "creds-1", labels, map[string]string{"agent-1": "password1", "Invalid_ID": "password"})
+	first.Data["agent-3"] = []byte("not-a-hash")
+	kubeclient := kubefake.NewSimpleClientset(
+		first,
+		credentialsSecret(t, "creds-2", labels, map[string]string{"agent-2": "password2"}),
+		credentialsSecret(t, "unlabeled", nil, map[string]string{"agent-4": "password4"}),
+	)
+
+	a := NewUserPassAuthentication("")
+	a.UpsertUser("legacy", "password")
+	require.NoError(t, a.WatchSecrets(ctx, kubeclient, "argocd", ""))
+
+	t.Run("Credentials are loaded from labeled Secrets", func(t *testing.T) {
+		assert.True(t, authenticates(a, "agent-1", "password1"))
+		assert.True(t, authenticates(a, "agent-2", "password2"))
+		assert.False(t, authenticates(a, "agent-1", "password2"))
+		assert.False(t, authenticates(a, "agent-4", "password4"))
+		assert.False(t, authenticates(a, "legacy", "password"))
+		assert.Len(t, a.userdb, 2)
+	})
+
+	t.Run("Changed credentials are picked up", func(t *testing.T) {
+		updated := credentialsSecret(t, "creds-2", labels, map[string]string{"agent-2": "newpassword"})
+		_, err := kubeclient.CoreV1().Secrets("argocd").Update(ctx, updated, metav1.UpdateOptions{})
+		require.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			return authenticates(a, "agent-2", "newpassword")
+		}, 2*time.Second, 10*time.Millisecond)
+		assert.False(t, authenticates(a, "agent-2", "password2"))
+	})
+
+	t.Run("Deleted credentials are removed", func(t *testing.T) {
+		err := kubeclient.CoreV1().Secrets("argocd").Delete(ctx, "creds-1", metav1.DeleteOptions{})
+		require.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			return !authenticates(a, "agent-1", "password1")
+		}, 2*time.Second, 10*time.Millisecond)
+		assert.True(t, authenticates(a, "agent-2", "newpassword"))
+	})
+}
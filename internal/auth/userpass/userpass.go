@@ -120,6 +120,18 @@ func (a *UserPassAuthentication) UpsertUser(username, password string) {
 // We actually support all current bcrypt variants
 var clientSecretRe = regexp.MustCompile(`^\$2[abxy]\$[0-9]{2}.*`)
 
+// validateEntry checks whether clientID and secret make up a valid entry of
+// the user database.
+func validateEntry(clientID, secret string) error {
+	if errs := validation.IsDNS1123Label(clientID); len(errs) > 0 {
+		return fmt.Errorf("client ID isn't valid")
+	}
+	if !clientSecretRe.MatchString(secret) {
+		return fmt.Errorf("client secret isn't valid")
+	}
+	return nil
+}
+
 // LoadAuthDataFromFile loads the authentication data from the file at path.
 // File must contain username/password pairs, where both tokens must be
 // separated by colon. Usernames must be strings of length 32, containing
@@ -151,12 +163,8 @@ func (a *UserPassAuthentication) LoadAuthDataFromFile(path string) error {
 			log().Warnf("Ignoring invalid entry: %s:%d", path, lno)
 			continue
 		}
-		if errs := validation.IsDNS1123Label(tok[0]); len(errs) > 0 {
-			log().Warnf("Client ID isn't valid: %s:%d", path, lno)
-			continue
-		}
-		if !clientSecretRe.MatchString(tok[1]) {
-			log().Warnf("Client secret isn't valid: %s:%d", path, lno)
+		if err := validateEntry(tok[0], tok[1]); err != nil {
+			log().Warnf("%v: %s:%d", err, path, lno)
 			continue
 		}
 		if _, ok := newUserDB[tok[0]]; ok {
@@ -0,0 +1,166 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package webhook implements an authentication method that delegates the
+// decision whether an agent is allowed to connect to an external HTTPS
+// webhook provided by the operator.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/internal/auth"
+	"github.com/argoproj-labs/argocd-agent/internal/grpcutil"
+	"github.com/argoproj-labs/argocd-agent/internal/logging"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/validation"
+)
+
+var _ auth.Method = &WebhookAuthentication{}
+
+// DefaultTimeout is the default timeout for requests to the webhook
+const DefaultTimeout = 10 * time.Second
+
+// maxResponseSize is the maximum size of a response we read from the webhook
+const maxResponseSize = 64 * 1024
+
+// Request is the payload POSTed to the webhook.
+type Request struct {
+	// Credentials are the credentials presented by the agent
+	Credentials auth.Credentials `json:"credentials"`
+	// ClientAddress is the network address the agent connects from
+	ClientAddress string `json:"clientAddress,omitempty"`
+}
+
+// Response is the payload the webhook is expected to respond with.
+type Response struct {
+	// Allowed indicates whether the agent is allowed to connect
+	Allowed bool `json:"allowed"`
+	// Namespace is the namespace on the principal the agent is mapped to.
+	// This also becomes the agent's name.
+	Namespace string `json:"namespace"`
+	// Reason is an optional, human readable reason for the decision
+	Reason string `json:"reason,omitempty"`
+}
+
+// WebhookAuthentication implements authentication by POSTing the credentials
+// presented by an agent to an HTTPS webhook.
+//
+// The webhook must respond with HTTP status 200 and a JSON encoded Response.
+// Any other status code, or a response that cannot be decoded, is treated as
+// a denial.
+type WebhookAuthentication struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookAuthentication creates a new instance of WebhookAuthentication
+// that sends requests to webhookURL. If rootCAs is nil, the system's root CAs
+// are used to verify the webhook's certificate. If timeout is 0, the
+// DefaultTimeout is used. Redirects are not followed, since following them
+// would send the agent's credentials to wherever the webhook points to.
+func NewWebhookAuthentication(webhookURL string, rootCAs *x509.CertPool, timeout time.Duration) *WebhookAuthentication {
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	return &WebhookAuthentication{
+		url: webhookURL,
+		client: &http.Client{
+			Timeout: timeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					RootCAs:    rootCAs,
+					MinVersion: tls.VersionTLS12,
+				},
+			},
+		},
+	}
+}
+
+// Init validates the configuration of the webhook.
+func (a *WebhookAuthentication) Init() error {
+	u, err := url.Parse(a.url)
+	if err != nil {
+		return fmt.Errorf("invalid webhook URL: %w", err)
+	}
+	if u.Scheme != "https" {
+		return fmt.Errorf("webhook URL must use https scheme")
+	}
+	if u.Host == "" {
+		return fmt.Errorf("webhook URL must have a host")
+	}
+	return nil
+}
+
+// Authenticate sends the credentials to the webhook and returns the namespace
+// the agent is mapped to if the webhook allows the connection.
+func (a *WebhookAuthentication) Authenticate(ctx context.Context, creds auth.Credentials) (string, error) {
+	payload, err := json.Marshal(&Request{
+		Credentials:   creds,
+		ClientAddress: grpcutil.AddressFromContext(ctx),
+	})
+	if err != nil {
+		return "", fmt.Errorf("could not marshal webhook request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url, bytes.NewReader(payload))
+	if err != nil {
+		return "", fmt.Errorf("could not create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("webhook returned unexpected status %d", resp.StatusCode)
+	}
+
+	var result Response
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&result); err != nil {
+		return "", fmt.Errorf("could not decode webhook response: %w", err)
+	}
+	if !result.Allowed {
+		return "", fmt.Errorf("webhook denied authentication: %s", result.Reason)
+	}
+	if result.Namespace == "" {
+		return "", fmt.Errorf("webhook allowed authentication but returned no namespace")
+	}
+
+	errs := validation.NameIsDNSLabel(result.Namespace, false)
+	if len(errs) > 0 {
+		return "", fmt.Errorf("invalid namespace '%s' returned by webhook: %v", result.Namespace, errs)
+	}
+
+	log().WithField("agent_id", result.Namespace).Info("Webhook allowed authentication")
+	return result.Namespace, nil
+}
+
+func log() *logrus.Entry {
+	return logging.GetDefaultLogger().ComponentLogger("AuthWebhook")
+}
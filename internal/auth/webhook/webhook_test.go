@@ -0,0 +1,133 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/internal/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// webhookServer starts a TLS server that decodes incoming requests and
+// responds using the given handler function.
+func webhookServer(t *testing.T, fn func(req Request) (int, any)) (*httptest.Server, *x509.CertPool) {
+	t.Helper()
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		code, body := fn(req)
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(body)
+	}))
+	t.Cleanup(srv.Close)
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	return srv, pool
+}
+
+func Test_Authenticate(t *testing.T) {
+	handler := func(req Request) (int, any) {
+		switch req.Credentials["token"] {
+		case "allow":
+			return http.StatusOK, Response{Allowed: true, Namespace: "agent-1"}
+		case "deny":
+			return http.StatusOK, Response{Allowed: false, Reason: "unknown token"}
+		case "no-namespace":
+			return http.StatusOK, Response{Allowed: true}
+		case "invalid-namespace":
+			return http.StatusOK, Response{Allowed: true, Namespace: "Agent_1"}
+		case "garbage":
+			return http.StatusOK, "not an object"
+		default:
+			return http.StatusInternalServerError, nil
+		}
+	}
+	srv, pool := webhookServer(t, handler)
+
+	tests := []struct {
+		name          string
+		token         string
+		expectedAgent string
+		errorContains string
+	}{
+		{"Allowed", "allow", "agent-1", ""},
+		{"Denied", "deny", "", "unknown token"},
+		{"Allowed without namespace", "no-namespace", "", "no namespace"},
+		{"Invalid namespace", "invalid-namespace", "", "invalid namespace"},
+		{"Malformed response", "garbage", "", "could not decode"},
+		{"Unexpected status", "error", "", "unexpected status 500"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewWebhookAuthentication(srv.URL, pool, 0)
+			require.NoError(t, a.Init())
+			agent, err := a.Authenticate(context.TODO(), auth.Credentials{"token": tt.token})
+			if tt.errorContains != "" {
+				assert.ErrorContains(t, err, tt.errorContains)
+				assert.Empty(t, agent)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedAgent, agent)
+			}
+		})
+	}
+
+	t.Run("Redirects are not followed", func(t *testing.T) {
+		var called atomic.Bool
+		target, _ := webhookServer(t, func(req Request) (int, any) {
+			called.Store(true)
+			return http.StatusOK, Response{Allowed: true, Namespace: "agent-1"}
+		})
+		redirect := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, target.URL, http.StatusTemporaryRedirect)
+		}))
+		t.Cleanup(redirect.Close)
+		rpool := x509.NewCertPool()
+		rpool.AddCert(redirect.Certificate())
+		rpool.AddCert(target.Certificate())
+		a := NewWebhookAuthentication(redirect.URL, rpool, time.Second)
+		agent, err := a.Authenticate(context.TODO(), auth.Credentials{"token": "allow"})
+		assert.ErrorContains(t, err, "unexpected status 307")
+		assert.Empty(t, agent)
+		assert.False(t, called.Load())
+	})
+
+	t.Run("Untrusted webhook certificate", func(t *testing.T) {
+		a := NewWebhookAuthentication(srv.URL, x509.NewCertPool(), time.Second)
+		_, err := a.Authenticate(context.TODO(), auth.Credentials{"token": "allow"})
+		assert.ErrorContains(t, err, "webhook request failed")
+	})
+}
+
+func Test_Init(t *testing.T) {
+	for _, u := range []string{"http://example.com/auth", "https://", "://"} {
+		a := NewWebhookAuthentication(u, nil, 0)
+		assert.Errorf(t, a.Init(), "URL %s should be invalid", u)
+	}
+	a := NewWebhookAuthentication("https://example.com/auth", nil, 0)
+	assert.NoError(t, a.Init())
+}
@@ -0,0 +1,377 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package certmanager requests TLS certificates from cert-manager through
+CertificateRequest resources, and keeps Kubernetes TLS secrets holding such
+certificates renewed.
+
+The cert-manager API is accessed through the dynamic client, so cert-manager
+is only required at runtime when this package is used.
+*/
+package certmanager
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/internal/logging"
+	"github.com/argoproj-labs/argocd-agent/internal/tlsutil"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// CertificateRequestGVR is the resource of cert-manager's CertificateRequest
+var CertificateRequestGVR = schema.GroupVersionResource{
+	Group:    "cert-manager.io",
+	Version:  "v1",
+	Resource: "certificaterequests",
+}
+
+const (
+	// DefaultIssuerKind is the kind of issuer used unless configured
+	// otherwise
+	DefaultIssuerKind = "Issuer"
+	// DefaultIssuerGroup is the API group of the issuer used unless
+	// configured otherwise
+	DefaultIssuerGroup = "cert-manager.io"
+
+	// Key usages as understood by cert-manager
+	UsageServerAuth       = "server auth"
+	UsageClientAuth       = "client auth"
+	UsageDigitalSignature = "digital signature"
+	UsageKeyEncipherment  = "key encipherment"
+
+	// DefaultRenewInterval is the interval in which secrets are checked for
+	// certificates that need to be renewed
+	DefaultRenewInterval = 10 * time.Minute
+
+	// caCertFieldName is the field in a TLS secret holding the CA certificate
+	caCertFieldName = "ca.crt"
+	// managedByLabel is set on CertificateRequests created by this package
+	managedByLabel = "app.kubernetes.io/managed-by"
+	managedByValue = "argocd-agent"
+)
+
+// IssuerRef refers to the cert-manager issuer signing the certificates
+type IssuerRef struct {
+	Name  string
+	Kind  string
+	Group string
+}
+
+// CertificateSpec describes a certificate to request
+type CertificateSpec struct {
+	CommonName  string
+	DNSNames    []string
+	IPAddresses []string
+	// Usages are the key usages of the certificate, e.g. UsageServerAuth
+	Usages []string
+	// Duration is the requested lifetime of the certificate. If zero, the
+	// issuer's default is used.
+	Duration time.Duration
+	// KeyOptions configures the private key generated for the certificate
+	KeyOptions tlsutil.KeyGenOptions
+}
+
+// Certificate is a certificate issued by cert-manager along with its key
+type Certificate struct {
+	CertPEM []byte
+	KeyPEM  []byte
+	// CAPEM is the certificate of the issuing CA, if known to the issuer
+	CAPEM []byte
+}
+
+// Requester requests certificates from a cert-manager issuer
+type Requester struct {
+	dynamic      dynamic.Interface
+	namespace    string
+	issuer       IssuerRef
+	pollInterval time.Duration
+	timeout      time.Duration
+}
+
+// NewRequester returns a Requester creating CertificateRequests in namespace,
+// which are to be signed by issuer.
+func NewRequester(client dynamic.Interface, namespace string, issuer IssuerRef) *Requester {
+	if issuer.Kind == "" {
+		issuer.Kind = DefaultIssuerKind
+	}
+	if issuer.Group == "" {
+		issuer.Group = DefaultIssuerGroup
+	}
+	return &Requester{
+		dynamic:      client,
+		namespace:    namespace,
+		issuer:       issuer,
+		pollInterval: 2 * time.Second,
+		timeout:      2 * time.Minute,
+	}
+}
+
+// Request generates a private key and requests a certificate for it as
+// described by spec. It creates a CertificateRequest named after name and
+// waits until it has been issued or failed. The CertificateRequest is
+// deleted afterwards.
+func (r *Requester) Request(ctx context.Context, name string, spec CertificateSpec) (*Certificate, error) {
+	key, err := tlsutil.GeneratePrivateKey(spec.KeyOptions.WithDefaults())
+	if err != nil {
+		return nil, fmt.Errorf("could not generate private key: %w", err)
+	}
+	keyPEM, err := tlsutil.PrivateKeyToPEM(key)
+	if err != nil {
+		return nil, err
+	}
+	csrPEM, err := createCSR(spec, key)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := r.RequestForCSR(ctx, name, spec, csrPEM)
+	if err != nil {
+		return nil, err
+	}
+	cert.KeyPEM = []byte(keyPEM)
+	return cert, nil
+}
+
+// RequestForCSR requests a certificate for the PEM encoded certificate
+// signing request csrPEM, whose private key is held by the caller. The
+// usages and duration are taken from spec, the subject and names from the
+// CSR. It creates a CertificateRequest named after name and waits until it
+// has been issued or failed. The CertificateRequest is deleted afterwards.
+func (r *Requester) RequestForCSR(ctx context.Context, name string, spec CertificateSpec, csrPEM []byte) (*Certificate, error) {
+	crs := r.dynamic.Resource(CertificateRequestGVR).Namespace(r.namespace)
+	cr, err := crs.Create(ctx, r.certificateRequest(name, spec, csrPEM), metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("could not create CertificateRequest: %w", err)
+	}
+	crName := cr.GetName()
+	defer func() {
+		if err := crs.Delete(context.Background(), crName, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			log().WithError(err).Warnf("Could not delete CertificateRequest %s/%s", r.namespace, crName)
+		}
+	}()
+
+	log().Infof("Waiting for CertificateRequest %s/%s to be issued by %s %s", r.namespace, crName, r.issuer.Kind, r.issuer.Name)
+	var cert *Certificate
+	err = wait.PollUntilContextTimeout(ctx, r.pollInterval, r.timeout, true, func(ctx context.Context) (bool, error) {
+		cr, err := crs.Get(ctx, crName, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		cert, err = issuedCertificate(cr)
+		return cert != nil, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("CertificateRequest %s/%s was not issued: %w", r.namespace, crName, err)
+	}
+	return cert, nil
+}
+
+// EnsureSecret makes sure the TLS secret name holds a certificate as
+// described by spec that does not need renewal yet. If the secret does not
+// exist, or its certificate is invalid or due for renewal, a new certificate
+// is requested and written to the secret. Returns true if the secret was
+// written.
+func (r *Requester) EnsureSecret(ctx context.Context, kube kubernetes.Interface, name string, spec CertificateSpec) (bool, error) {
+	secrets := kube.CoreV1().Secrets(r.namespace)
+	secret, err := secrets.Get(ctx, name, metav1.GetOptions{})
+	exists := err == nil
+	if err != nil && !apierrors.IsNotFound(err) {
+		return false, fmt.Errorf("could not read secret %s/%s: %w", r.namespace, name, err)
+	}
+	if exists {
+		cert, perr := parseCertificate(secret.Data[corev1.TLSCertKey])
+		if perr == nil && !NeedsRenewal(cert, time.Now()) {
+			return false, nil
+		}
+	}
+
+	cert, err := r.Request(ctx, name, spec)
+	if err != nil {
+		return false, err
+	}
+	data := map[string][]byte{
+		corev1.TLSCertKey:       cert.CertPEM,
+		corev1.TLSPrivateKeyKey: cert.KeyPEM,
+	}
+	if len(cert.CAPEM) > 0 {
+		data[caCertFieldName] = cert.CAPEM
+	}
+	if !exists {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: r.namespace},
+			Type:       corev1.SecretTypeTLS,
+			Data:       data,
+		}
+		_, err = secrets.Create(ctx, secret, metav1.CreateOptions{})
+	} else {
+		secret.Data = data
+		_, err = secrets.Update(ctx, secret, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return false, fmt.Errorf("could not write secret %s/%s: %w", r.namespace, name, err)
+	}
+	log().Infof("Stored certificate issued by cert-manager in secret %s/%s", r.namespace, name)
+	return true, nil
+}
+
+// RenewSecret checks the TLS secret name every interval and requests a new
+// certificate once the current one is due for renewal. It returns when ctx
+// is done.
+func (r *Requester) RenewSecret(ctx context.Context, kube kubernetes.Interface, name string, spec CertificateSpec, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultRenewInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := r.EnsureSecret(ctx, kube, name, spec); err != nil {
+			log().WithError(err).Errorf("Could not renew certificate in secret %s/%s", r.namespace, name)
+		}
+	}
+}
+
+// NeedsRenewal returns true if less than a third of cert's lifetime is left
+// at now, which is also cert-manager's default for renewing certificates.
+func NeedsRenewal(cert *x509.Certificate, now time.Time) bool {
+	lifetime := cert.NotAfter.Sub(cert.NotBefore)
+	return !now.Before(cert.NotAfter.Add(-lifetime / 3))
+}
+
+// certificateRequest returns the CertificateRequest resource for csrPEM
+func (r *Requester) certificateRequest(name string, spec CertificateSpec, csrPEM []byte) *unstructured.Unstructured {
+	usages := make([]any, 0, len(spec.Usages))
+	for _, u := range spec.Usages {
+		usages = append(usages, u)
+	}
+	crSpec := map[string]any{
+		"request": base64.StdEncoding.EncodeToString(csrPEM),
+		"issuerRef": map[string]any{
+			"name":  r.issuer.Name,
+			"kind":  r.issuer.Kind,
+			"group": r.issuer.Group,
+		},
+		"usages": usages,
+	}
+	if spec.Duration > 0 {
+		crSpec["duration"] = spec.Duration.String()
+	}
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": CertificateRequestGVR.GroupVersion().String(),
+		"kind":       "CertificateRequest",
+		"metadata": map[string]any{
+			"generateName": name + "-",
+			"namespace":    r.namespace,
+			"labels": map[string]any{
+				managedByLabel: managedByValue,
+			},
+		},
+		"spec": crSpec,
+	}}
+}
+
+// issuedCertificate returns the certificate of cr once it has been issued,
+// nil if it is still pending, or an error if it was denied or has failed.
+func issuedCertificate(cr *unstructured.Unstructured) (*Certificate, error) {
+	conditions, _, _ := unstructured.NestedSlice(cr.Object, "status", "conditions")
+	for _, c := range conditions {
+		cond, ok := c.(map[string]any)
+		if !ok {
+			continue
+		}
+		condType, _, _ := unstructured.NestedString(cond, "type")
+		status, _, _ := unstructured.NestedString(cond, "status")
+		reason, _, _ := unstructured.NestedString(cond, "reason")
+		message, _, _ := unstructured.NestedString(cond, "message")
+		switch {
+		case condType == "Denied" && status == "True":
+			return nil, fmt.Errorf("request was denied: %s", message)
+		case condType == "InvalidRequest" && status == "True":
+			return nil, fmt.Errorf("request is invalid: %s", message)
+		case condType == "Ready" && status == "False" && reason == "Failed":
+			return nil, fmt.Errorf("request has failed: %s", message)
+		}
+	}
+
+	certData, _, _ := unstructured.NestedString(cr.Object, "status", "certificate")
+	if certData == "" {
+		return nil, nil
+	}
+	certPEM, err := base64.StdEncoding.DecodeString(certData)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate data: %w", err)
+	}
+	cert := &Certificate{CertPEM: certPEM}
+	if caData, _, _ := unstructured.NestedString(cr.Object, "status", "ca"); caData != "" {
+		if cert.CAPEM, err = base64.StdEncoding.DecodeString(caData); err != nil {
+			return nil, fmt.Errorf("invalid CA data: %w", err)
+		}
+	}
+	return cert, nil
+}
+
+// createCSR returns a PEM encoded certificate signing request for spec
+func createCSR(spec CertificateSpec, key any) ([]byte, error) {
+	templ := &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: spec.CommonName},
+		DNSNames: spec.DNSNames,
+	}
+	for _, ip := range spec.IPAddresses {
+		parsed := net.ParseIP(ip)
+		if parsed == nil {
+			return nil, fmt.Errorf("invalid IP address: %s", ip)
+		}
+		templ.IPAddresses = append(templ.IPAddresses, parsed)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, templ, key)
+	if err != nil {
+		return nil, fmt.Errorf("could not create certificate request: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}), nil
+}
+
+// parseCertificate parses the first certificate in PEM data
+func parseCertificate(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("no certificate found")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func log() *logrus.Entry {
+	return logging.GetDefaultLogger().ComponentLogger("CertManager")
+}
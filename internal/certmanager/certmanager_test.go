@@ -0,0 +1,182 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package certmanager
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/internal/tlsutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynfake "k8s.io/client-go/dynamic/fake"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+// fakeIssuer returns a fake dynamic client which signs CertificateRequests
+// with a test CA as they are created, or denies them if deny is set.
+func fakeIssuer(t *testing.T, lifetime time.Duration, deny bool) (*dynfake.FakeDynamicClient, *x509.Certificate) {
+	t.Helper()
+	caPEM, caKeyPEM, err := tlsutil.GenerateCaCertificate("test-ca", tlsutil.DefaultCACertValidityDays, tlsutil.KeyGenOptions{RSABits: 2048})
+	require.NoError(t, err)
+	ca, err := tls.X509KeyPair([]byte(caPEM), []byte(caKeyPEM))
+	require.NoError(t, err)
+
+	client := dynfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{CertificateRequestGVR: "CertificateRequestList"})
+	serial := int64(0)
+	client.PrependReactor("create", "certificaterequests", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		cr := action.(clienttesting.CreateAction).GetObject().(*unstructured.Unstructured)
+		serial++
+		cr.SetName(cr.GetGenerateName() + big.NewInt(serial).String())
+		if deny {
+			_ = unstructured.SetNestedSlice(cr.Object, []any{
+				map[string]any{"type": "Denied", "status": "True", "message": "not allowed"},
+			}, "status", "conditions")
+			return false, nil, nil
+		}
+		request, _, _ := unstructured.NestedString(cr.Object, "spec", "request")
+		csrPEM, err := base64.StdEncoding.DecodeString(request)
+		require.NoError(t, err)
+		block, _ := pem.Decode(csrPEM)
+		csr, err := x509.ParseCertificateRequest(block.Bytes)
+		require.NoError(t, err)
+		templ := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      csr.Subject,
+			DNSNames:     csr.DNSNames,
+			IPAddresses:  csr.IPAddresses,
+			NotBefore:    time.Now().Add(-time.Minute),
+			NotAfter:     time.Now().Add(lifetime),
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, templ, ca.Leaf, csr.PublicKey, ca.PrivateKey)
+		require.NoError(t, err)
+		certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+		_ = unstructured.SetNestedField(cr.Object, base64.StdEncoding.EncodeToString(certPEM), "status", "certificate")
+		_ = unstructured.SetNestedField(cr.Object, base64.StdEncoding.EncodeToString([]byte(caPEM)), "status", "ca")
+		return false, nil, nil
+	})
+	return client, ca.Leaf
+}
+
+func Test_Request(t *testing.T) {
+	spec := CertificateSpec{
+		CommonName:  "principal",
+		DNSNames:    []string{"principal.example.com"},
+		IPAddresses: []string{"127.0.0.1"},
+		Usages:      []string{UsageServerAuth},
+		KeyOptions:  tlsutil.KeyGenOptions{RSABits: 2048},
+	}
+
+	t.Run("Issued certificate is returned", func(t *testing.T) {
+		client, ca := fakeIssuer(t, time.Hour, false)
+		r := NewRequester(client, "argocd", IssuerRef{Name: "agent-ca"})
+		cert, err := r.Request(context.Background(), "principal-tls", spec)
+		require.NoError(t, err)
+
+		kp, err := tls.X509KeyPair(cert.CertPEM, cert.KeyPEM)
+		require.NoError(t, err)
+		assert.Equal(t, "principal", kp.Leaf.Subject.CommonName)
+		assert.Equal(t, []string{"principal.example.com"}, kp.Leaf.DNSNames)
+		assert.NoError(t, kp.Leaf.CheckSignatureFrom(ca))
+		assert.NotEmpty(t, cert.CAPEM)
+
+		// The CertificateRequest is cleaned up
+		crs, err := client.Resource(CertificateRequestGVR).Namespace("argocd").List(context.Background(), metav1.ListOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, crs.Items)
+	})
+
+	t.Run("Denied request", func(t *testing.T) {
+		client, _ := fakeIssuer(t, time.Hour, true)
+		r := NewRequester(client, "argocd", IssuerRef{Name: "agent-ca"})
+		_, err := r.Request(context.Background(), "principal-tls", spec)
+		assert.ErrorContains(t, err, "denied")
+	})
+
+	t.Run("Invalid IP address", func(t *testing.T) {
+		client, _ := fakeIssuer(t, time.Hour, false)
+		r := NewRequester(client, "argocd", IssuerRef{Name: "agent-ca"})
+		_, err := r.Request(context.Background(), "principal-tls", CertificateSpec{IPAddresses: []string{"invalid"}, KeyOptions: spec.KeyOptions})
+		assert.ErrorContains(t, err, "invalid IP address")
+	})
+}
+
+func Test_EnsureSecret(t *testing.T) {
+	ctx := context.Background()
+	spec := CertificateSpec{CommonName: "agent", Usages: []string{UsageClientAuth}, KeyOptions: tlsutil.KeyGenOptions{RSABits: 2048}}
+	readCert := func(t *testing.T, kube *kubefake.Clientset) *x509.Certificate {
+		t.Helper()
+		secret, err := kube.CoreV1().Secrets("argocd").Get(ctx, "client-tls", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, corev1.SecretTypeTLS, secret.Type)
+		assert.NotEmpty(t, secret.Data["ca.crt"])
+		cert, err := parseCertificate(secret.Data[corev1.TLSCertKey])
+		require.NoError(t, err)
+		return cert
+	}
+
+	t.Run("Missing secret is created", func(t *testing.T) {
+		client, _ := fakeIssuer(t, time.Hour, false)
+		kube := kubefake.NewClientset()
+		r := NewRequester(client, "argocd", IssuerRef{Name: "agent-ca"})
+		written, err := r.EnsureSecret(ctx, kube, "client-tls", spec)
+		require.NoError(t, err)
+		assert.True(t, written)
+		first := readCert(t, kube)
+
+		// A valid certificate is kept
+		written, err = r.EnsureSecret(ctx, kube, "client-tls", spec)
+		require.NoError(t, err)
+		assert.False(t, written)
+		assert.Equal(t, first.SerialNumber, readCert(t, kube).SerialNumber)
+	})
+
+	t.Run("Expiring certificate is renewed", func(t *testing.T) {
+		client, _ := fakeIssuer(t, time.Second, false)
+		kube := kubefake.NewClientset()
+		r := NewRequester(client, "argocd", IssuerRef{Name: "agent-ca"})
+		_, err := r.EnsureSecret(ctx, kube, "client-tls", spec)
+		require.NoError(t, err)
+		first := readCert(t, kube)
+
+		written, err := r.EnsureSecret(ctx, kube, "client-tls", spec)
+		require.NoError(t, err)
+		assert.True(t, written)
+		assert.NotEqual(t, first.SerialNumber, readCert(t, kube).SerialNumber)
+	})
+}
+
+func Test_NeedsRenewal(t *testing.T) {
+	now := time.Now()
+	cert := &x509.Certificate{NotBefore: now.Add(-60 * time.Minute), NotAfter: now.Add(31 * time.Minute)}
+	assert.False(t, NeedsRenewal(cert, now))
+	assert.True(t, NeedsRenewal(cert, now.Add(1*time.Minute)))
+	assert.True(t, NeedsRenewal(cert, now.Add(time.Hour)))
+}
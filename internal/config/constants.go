@@ -16,6 +16,10 @@ const SecretNameAgentCA = "argocd-agent-ca"
 // configuration for the principal's gRPC service.
 const SecretNamePrincipalTLS = "argocd-agent-principal-tls"
 
+// SecretNamePrincipalACME is the name of the secret the principal stores
+// its ACME account key and certificates in
+const SecretNamePrincipalACME = "argocd-agent-principal-acme"
+
 // SecretNameProxyTLS is the name of the secret containing the TLS
 // configuration for the principal's resource proxy.
 const SecretNameProxyTLS = "argocd-agent-resource-proxy-tls"
@@ -31,6 +35,15 @@ const SecretNameJWT = "argocd-agent-jwt"
 // SkipSyncLabel is the label used to skip sync for an application.
 const SkipSyncLabel = "argocd-agent.argoproj-labs.io/ignore-sync"
 
+// OrphanedLabel is the label the principal sets on the applications of an
+// agent whose cluster mapping was removed.
+const OrphanedLabel = "argocd-agent.argoproj-labs.io/orphaned"
+
+// OrphanedSinceAnnotation is the annotation the principal sets on the
+// applications of an agent whose cluster mapping was removed, holding the
+// time of the removal in RFC 3339 format.
+const OrphanedSinceAnnotation = "argocd-agent.argoproj-labs.io/orphaned-since"
+
 // EnvKubeQPS is the name of the environment variable for setting the Kubernetes API QPS.
 const EnvKubeQPS = "ARGOCD_AGENT_KUBE_QPS"
 
@@ -0,0 +1,255 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package connlimit limits the number of connections and streams the
+// principal serves concurrently.
+package connlimit
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/argoproj-labs/argocd-agent/internal/logging"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Policy decides what happens to connections and streams beyond a limit
+type Policy string
+
+const (
+	// PolicyQueue makes connections and streams beyond the limit wait until
+	// others have been closed
+	PolicyQueue Policy = "queue"
+	// PolicyReject closes connections and fails streams beyond the limit
+	PolicyReject Policy = "reject"
+)
+
+// ParsePolicy returns the policy of the given name
+func ParsePolicy(name string) (Policy, error) {
+	switch Policy(name) {
+	case PolicyQueue, PolicyReject:
+		return Policy(name), nil
+	}
+	return "", fmt.Errorf("unknown limit policy %q: must be one of %s, %s", name, PolicyQueue, PolicyReject)
+}
+
+// Observer is notified about changes of the connections and streams served
+type Observer interface {
+	// Open is called with the number of open connections whenever it changes
+	Open(connections int)
+	// Rejected is called for each connection or stream rejected, with kind
+	// being either "connection" or "stream"
+	Rejected(kind string)
+}
+
+// Limiter limits the number of connections open at the same time across
+// all listeners it is applied to.
+type Limiter struct {
+	policy   Policy
+	sem      chan struct{}
+	observer Observer
+}
+
+// NewLimiter returns a limiter allowing up to max open connections, or nil
+// if max is 0.
+func NewLimiter(max int, policy Policy, observer Observer) *Limiter {
+	if max <= 0 {
+		return nil
+	}
+	return &Limiter{policy: policy, sem: make(chan struct{}, max), observer: observer}
+}
+
+// Listener returns a net.Listener that applies the limiter's policy to the
+// connections accepted from l. With PolicyQueue, no connections are accepted
+// while the limit is reached, so they wait in the listen backlog. With
+// PolicyReject, connections beyond the limit are closed right after
+// accepting them.
+func (lim *Limiter) Listener(l net.Listener) net.Listener {
+	return &listener{Listener: l, limiter: lim, done: make(chan struct{})}
+}
+
+// acquire takes a slot without waiting, and returns whether one was free
+func (lim *Limiter) acquire() bool {
+	select {
+	case lim.sem <- struct{}{}:
+		lim.notify()
+		return true
+	default:
+		return false
+	}
+}
+
+func (lim *Limiter) release() {
+	<-lim.sem
+	lim.notify()
+}
+
+func (lim *Limiter) notify() {
+	if lim.observer != nil {
+		lim.observer.Open(len(lim.sem))
+	}
+}
+
+type listener struct {
+	net.Listener
+	limiter   *Limiter
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	lim := l.limiter
+	for {
+		if lim.policy == PolicyQueue {
+			select {
+			case lim.sem <- struct{}{}:
+				lim.notify()
+			case <-l.done:
+				return nil, net.ErrClosed
+			}
+			c, err := l.Listener.Accept()
+			if err != nil {
+				lim.release()
+				return nil, err
+			}
+			return &conn{Conn: c, release: lim.release}, nil
+		}
+
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if lim.acquire() {
+			return &conn{Conn: c, release: lim.release}, nil
+		}
+		log().WithField("address", c.RemoteAddr().String()).Warn("Rejecting connection: too many open connections")
+		if lim.observer != nil {
+			lim.observer.Rejected("connection")
+		}
+		_ = c.Close()
+	}
+}
+
+func (l *listener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+// conn gives back its slot to the limiter when it is closed
+type conn struct {
+	net.Conn
+	releaseOnce sync.Once
+	release     func()
+}
+
+func (c *conn) Close() error {
+	err := c.Conn.Close()
+	c.releaseOnce.Do(c.release)
+	return err
+}
+
+// NetConn returns the connection wrapped by c
+func (c *conn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// StreamLimiter fails streams beyond a limit per connection. It is used to
+// reject streams, since HTTP/2 already makes clients wait for streams beyond
+// the limit they have been told by the server.
+type StreamLimiter struct {
+	max      int
+	observer Observer
+
+	mu      sync.Mutex
+	streams map[string]int
+}
+
+// NewStreamLimiter returns a limiter allowing up to max concurrent streams
+// per connection, or nil if max is 0.
+func NewStreamLimiter(max int, observer Observer) *StreamLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return &StreamLimiter{max: max, observer: observer, streams: make(map[string]int)}
+}
+
+// StreamServerInterceptor returns an interceptor failing streams beyond the
+// limit with codes.ResourceExhausted
+func (sl *StreamLimiter) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		key, ok := sl.acquire(ss.Context())
+		if !ok {
+			return status.Errorf(codes.ResourceExhausted, "too many concurrent streams on this connection")
+		}
+		defer sl.release(key)
+		return handler(srv, ss)
+	}
+}
+
+// UnaryServerInterceptor returns an interceptor failing unary calls beyond
+// the limit with codes.ResourceExhausted. Unary calls occupy a stream while
+// they are in progress.
+func (sl *StreamLimiter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		key, ok := sl.acquire(ctx)
+		if !ok {
+			return nil, status.Errorf(codes.ResourceExhausted, "too many concurrent streams on this connection")
+		}
+		defer sl.release(key)
+		return handler(ctx, req)
+	}
+}
+
+// acquire counts a stream on the connection of ctx. The connection is
+// identified by the address of its peer.
+func (sl *StreamLimiter) acquire(ctx context.Context) (string, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return "", true
+	}
+	key := p.Addr.String()
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	if sl.streams[key] >= sl.max {
+		log().WithField("address", key).Warn("Rejecting stream: too many concurrent streams on connection")
+		if sl.observer != nil {
+			sl.observer.Rejected("stream")
+		}
+		return "", false
+	}
+	sl.streams[key]++
+	return key, true
+}
+
+func (sl *StreamLimiter) release(key string) {
+	if key == "" {
+		return
+	}
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	sl.streams[key]--
+	if sl.streams[key] <= 0 {
+		delete(sl.streams, key)
+	}
+}
+
+func log() *logrus.Entry {
+	return logging.GetDefaultLogger().ComponentLogger("ConnLimit")
+}
@@ -0,0 +1,207 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connlimit
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type fakeObserver struct {
+	mu       sync.Mutex
+	open     int
+	rejected map[string]int
+}
+
+func (o *fakeObserver) Open(connections int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.open = connections
+}
+
+func (o *fakeObserver) Rejected(kind string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.rejected == nil {
+		o.rejected = map[string]int{}
+	}
+	o.rejected[kind]++
+}
+
+func (o *fakeObserver) get() (int, map[string]int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.open, o.rejected
+}
+
+// acceptAll accepts connections from l until it is closed
+func acceptAll(l net.Listener) chan net.Conn {
+	accepted := make(chan net.Conn, 10)
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				close(accepted)
+				return
+			}
+			accepted <- c
+		}
+	}()
+	return accepted
+}
+
+func Test_ParsePolicy(t *testing.T) {
+	p, err := ParsePolicy("reject")
+	require.NoError(t, err)
+	assert.Equal(t, PolicyReject, p)
+	_, err = ParsePolicy("drop")
+	assert.Error(t, err)
+}
+
+func Test_NewLimiter(t *testing.T) {
+	assert.Nil(t, NewLimiter(0, PolicyQueue, nil))
+	assert.Nil(t, NewStreamLimiter(0, nil))
+}
+
+func Test_Listener(t *testing.T) {
+	t.Run("Queue policy", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		obs := &fakeObserver{}
+		ll := NewLimiter(1, PolicyQueue, obs).Listener(l)
+		defer ll.Close()
+		accepted := acceptAll(ll)
+
+		c1, err := net.Dial("tcp", l.Addr().String())
+		require.NoError(t, err)
+		defer c1.Close()
+		ac1 := <-accepted
+		open, _ := obs.get()
+		assert.Equal(t, 1, open)
+
+		// The second connection waits until the first has been closed
+		c2, err := net.Dial("tcp", l.Addr().String())
+		require.NoError(t, err)
+		defer c2.Close()
+		select {
+		case <-accepted:
+			t.Fatal("connection should not have been accepted")
+		case <-time.After(200 * time.Millisecond):
+		}
+		require.NoError(t, ac1.Close())
+		select {
+		case ac2 := <-accepted:
+			ac2.Close()
+		case <-time.After(2 * time.Second):
+			t.Fatal("connection should have been accepted")
+		}
+	})
+
+	t.Run("Reject policy", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		obs := &fakeObserver{}
+		ll := NewLimiter(1, PolicyReject, obs).Listener(l)
+		defer ll.Close()
+		accepted := acceptAll(ll)
+
+		c1, err := net.Dial("tcp", l.Addr().String())
+		require.NoError(t, err)
+		defer c1.Close()
+		ac1 := <-accepted
+		defer ac1.Close()
+
+		// The second connection is closed right away
+		c2, err := net.Dial("tcp", l.Addr().String())
+		require.NoError(t, err)
+		defer c2.Close()
+		_ = c2.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, err = c2.Read(make([]byte, 1))
+		assert.Error(t, err)
+		require.Eventually(t, func() bool {
+			_, rejected := obs.get()
+			return rejected["connection"] == 1
+		}, 2*time.Second, 10*time.Millisecond)
+		open, _ := obs.get()
+		assert.Equal(t, 1, open)
+	})
+
+	t.Run("Closing the listener stops a waiting Accept", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		ll := NewLimiter(1, PolicyQueue, nil).Listener(l)
+		accepted := acceptAll(ll)
+
+		c1, err := net.Dial("tcp", l.Addr().String())
+		require.NoError(t, err)
+		defer c1.Close()
+		ac1 := <-accepted
+		defer ac1.Close()
+
+		require.NoError(t, ll.Close())
+		select {
+		case _, ok := <-accepted:
+			assert.False(t, ok)
+		case <-time.After(2 * time.Second):
+			t.Fatal("Accept should have returned")
+		}
+	})
+}
+
+func Test_StreamLimiter(t *testing.T) {
+	obs := &fakeObserver{}
+	sl := NewStreamLimiter(1, obs)
+	interceptor := sl.UnaryServerInterceptor()
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1234}})
+	other := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1235}})
+
+	inHandler := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{}, func(context.Context, any) (any, error) {
+			close(inHandler)
+			<-release
+			return nil, nil
+		})
+		done <- err
+	}()
+	<-inHandler
+
+	noop := func(context.Context, any) (any, error) { return nil, nil }
+	_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{}, noop)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	_, rejected := obs.get()
+	assert.Equal(t, 1, rejected["stream"])
+
+	// Other connections have streams of their own
+	_, err = interceptor(other, nil, &grpc.UnaryServerInfo{}, noop)
+	assert.NoError(t, err)
+
+	close(release)
+	require.NoError(t, <-done)
+	_, err = interceptor(ctx, nil, &grpc.UnaryServerInfo{}, noop)
+	assert.NoError(t, err)
+}
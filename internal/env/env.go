@@ -175,3 +175,37 @@ func DurationWithDefault(key string, validator func(time.Duration) error, def ti
 	}
 	return d
 }
+
+func Float(key string, validator func(f float64) error) (float64, error) {
+	ev, ok := os.LookupEnv(key)
+	if !ok {
+		return 0, os.ErrNotExist
+	}
+	f, err := strconv.ParseFloat(ev, 64)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing float '%s': %w", key, err)
+	}
+	if validator != nil {
+		if err := validator(f); err != nil {
+			return 0, fmt.Errorf("error validating environment '%s': %w", key, err)
+		}
+	}
+	return f, nil
+}
+
+// FloatWithDefault parses the contents of the environment variable referred
+// to by key into a floating point number. If the validator function is
+// non-nil, it will be called with the parsed number as argument. If the
+// validator returns an error or if the environment variable was not set, the
+// default value will be returned. Otherwise, the environment variable's value
+// will be returned.
+func FloatWithDefault(key string, validator func(float64) error, def float64) float64 {
+	f, err := Float(key, validator)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Print(err)
+		}
+		return def
+	}
+	return f
+}
@@ -223,3 +223,40 @@ func Test_Duration(t *testing.T) {
 		assert.Equal(t, time.Duration(5*time.Minute), n)
 	})
 }
+
+func Test_Float(t *testing.T) {
+	t.Run("Test float value from env", func(t *testing.T) {
+		t.Setenv("FOO", "1.5")
+		f, err := Float("FOO", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 1.5, f)
+
+		t.Setenv("FOO", "2")
+		f = FloatWithDefault("FOO", nil, 0.5)
+		assert.Equal(t, 2.0, f)
+	})
+
+	t.Run("Test invalid float value from env", func(t *testing.T) {
+		t.Setenv("FOO", "one")
+		_, err := Float("FOO", nil)
+		assert.ErrorContains(t, err, "error parsing float 'FOO'")
+		assert.Equal(t, 0.5, FloatWithDefault("FOO", nil, 0.5))
+	})
+
+	t.Run("Test validated float value from env", func(t *testing.T) {
+		v := func(f float64) error {
+			if f < 0 {
+				return fmt.Errorf("invalid float")
+			}
+			return nil
+		}
+		t.Setenv("FOO", "-1")
+		_, err := Float("FOO", v)
+		assert.ErrorContains(t, err, "error validating environment 'FOO': invalid float")
+		assert.Equal(t, 0.5, FloatWithDefault("FOO", v, 0.5))
+	})
+
+	t.Run("Test default float value", func(t *testing.T) {
+		assert.Equal(t, 0.5, FloatWithDefault("NOT_SET_FOO", nil, 0.5))
+	})
+}
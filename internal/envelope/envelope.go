@@ -0,0 +1,198 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package envelope implements envelope encryption of data at rest.
+//
+// Each piece of data is encrypted with a fresh data encryption key (DEK)
+// using AES-256-GCM. The DEK is in turn encrypted ("wrapped") by a
+// KeyWrapper holding the key encryption key (KEK), and stored alongside the
+// ciphertext. The KEK itself never leaves the KeyWrapper, which allows it to
+// be kept in an external key management service (KMS).
+package envelope
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// dekSize is the size of data encryption keys in bytes
+const dekSize = 32
+
+// ErrNotSealed is returned by Open if the data is not an envelope
+var ErrNotSealed = errors.New("data is not an encrypted envelope")
+
+// KeyWrapper encrypts and decrypts data encryption keys with a key
+// encryption key. Implementations backed by a KMS must be safe for
+// concurrent use.
+type KeyWrapper interface {
+	// KeyID returns an identifier of the key encryption key, which is stored
+	// with each envelope.
+	KeyID() string
+	// WrapKey encrypts dek
+	WrapKey(ctx context.Context, dek []byte) ([]byte, error)
+	// UnwrapKey decrypts a key previously encrypted by WrapKey with the key
+	// encryption key identified by keyID.
+	UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// sealed is the serialized form of an envelope
+type sealed struct {
+	KeyID      string `json:"kid"`
+	WrappedKey []byte `json:"wrappedKey"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// Seal encrypts plaintext with a new data encryption key, which is wrapped
+// using kw, and returns the serialized envelope.
+func Seal(ctx context.Context, kw KeyWrapper, plaintext []byte) ([]byte, error) {
+	dek := make([]byte, dekSize)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, fmt.Errorf("could not generate data encryption key: %w", err)
+	}
+	ciphertext, err := encrypt(dek, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := kw.WrapKey(ctx, dek)
+	if err != nil {
+		return nil, fmt.Errorf("could not wrap data encryption key: %w", err)
+	}
+	return json.Marshal(&sealed{KeyID: kw.KeyID(), WrappedKey: wrapped, Ciphertext: ciphertext})
+}
+
+// Open decrypts an envelope created by Seal. If data is not an envelope,
+// ErrNotSealed is returned.
+func Open(ctx context.Context, kw KeyWrapper, data []byte) ([]byte, error) {
+	env := parse(data)
+	if env == nil {
+		return nil, ErrNotSealed
+	}
+	dek, err := kw.UnwrapKey(ctx, env.KeyID, env.WrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("could not unwrap data encryption key: %w", err)
+	}
+	return decrypt(dek, env.Ciphertext)
+}
+
+// IsSealed returns true if data is an envelope created by Seal
+func IsSealed(data []byte) bool {
+	return parse(data) != nil
+}
+
+func parse(data []byte) *sealed {
+	env := &sealed{}
+	if err := json.Unmarshal(data, env); err != nil || env.KeyID == "" || len(env.Ciphertext) == 0 {
+		return nil
+	}
+	return env
+}
+
+// AESKeyWrapper wraps data encryption keys locally with an AES-256 key
+// encryption key.
+type AESKeyWrapper struct {
+	keyID string
+	kek   []byte
+}
+
+var _ KeyWrapper = &AESKeyWrapper{}
+
+// NewAESKeyWrapper returns a KeyWrapper using kek, which must be 32 bytes
+// long. The key ID is derived from the key.
+func NewAESKeyWrapper(kek []byte) (*AESKeyWrapper, error) {
+	if len(kek) != 32 {
+		return nil, fmt.Errorf("key encryption key must be 32 bytes, got %d", len(kek))
+	}
+	sum := sha256.Sum256(kek)
+	return &AESKeyWrapper{keyID: "aes:" + hex.EncodeToString(sum[:8]), kek: kek}, nil
+}
+
+// NewAESKeyWrapperFromFile returns a KeyWrapper using the base64 encoded key
+// encryption key read from path.
+func NewAESKeyWrapperFromFile(path string) (*AESKeyWrapper, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read key encryption key: %w", err)
+	}
+	kek, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("could not decode key encryption key: %w", err)
+	}
+	return NewAESKeyWrapper(kek)
+}
+
+// KeyID returns the ID of the key encryption key
+func (w *AESKeyWrapper) KeyID() string {
+	return w.keyID
+}
+
+// WrapKey encrypts dek with the key encryption key
+func (w *AESKeyWrapper) WrapKey(_ context.Context, dek []byte) ([]byte, error) {
+	return encrypt(w.kek, dek)
+}
+
+// UnwrapKey decrypts wrapped with the key encryption key
+func (w *AESKeyWrapper) UnwrapKey(_ context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	if keyID != w.keyID {
+		return nil, fmt.Errorf("data was encrypted with key %s, but key %s is configured", keyID, w.keyID)
+	}
+	return decrypt(w.kek, wrapped)
+}
+
+// encrypt encrypts plaintext with AES-GCM, prepending the nonce
+func encrypt(key, plaintext []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("could not generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// decrypt decrypts ciphertext created by encrypt
+func decrypt(key, ciphertext []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	nonce, ciphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not decrypt: %w", err)
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("could not create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
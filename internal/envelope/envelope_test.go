@@ -0,0 +1,106 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envelope
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_SealOpen(t *testing.T) {
+	ctx := context.Background()
+	kw, err := NewAESKeyWrapper(bytes.Repeat([]byte{1}, 32))
+	require.NoError(t, err)
+
+	t.Run("Round trip", func(t *testing.T) {
+		data, err := Seal(ctx, kw, []byte("secret"))
+		require.NoError(t, err)
+		assert.NotContains(t, string(data), "secret")
+		plain, err := Open(ctx, kw, data)
+		require.NoError(t, err)
+		assert.Equal(t, "secret", string(plain))
+	})
+
+	t.Run("Each seal uses a new key", func(t *testing.T) {
+		a, err := Seal(ctx, kw, []byte("secret"))
+		require.NoError(t, err)
+		b, err := Seal(ctx, kw, []byte("secret"))
+		require.NoError(t, err)
+		assert.NotEqual(t, a, b)
+	})
+
+	t.Run("Plain data is not sealed", func(t *testing.T) {
+		_, err := Open(ctx, kw, []byte(`{"mode":"managed"}`))
+		assert.ErrorIs(t, err, ErrNotSealed)
+		assert.False(t, IsSealed([]byte(`{"mode":"managed"}`)))
+		data, err := Seal(ctx, kw, []byte(`{"mode":"managed"}`))
+		require.NoError(t, err)
+		assert.True(t, IsSealed(data))
+	})
+
+	t.Run("Wrong key cannot open", func(t *testing.T) {
+		data, err := Seal(ctx, kw, []byte("secret"))
+		require.NoError(t, err)
+		other, err := NewAESKeyWrapper(bytes.Repeat([]byte{2}, 32))
+		require.NoError(t, err)
+		_, err = Open(ctx, other, data)
+		assert.ErrorContains(t, err, "was encrypted with key")
+	})
+
+	t.Run("Tampered data cannot be opened", func(t *testing.T) {
+		data, err := Seal(ctx, kw, []byte("secret"))
+		require.NoError(t, err)
+		env := &sealed{}
+		require.NoError(t, json.Unmarshal(data, env))
+		env.Ciphertext[len(env.Ciphertext)-1] ^= 0xff
+		data, err = json.Marshal(env)
+		require.NoError(t, err)
+		_, err = Open(ctx, kw, data)
+		assert.ErrorContains(t, err, "could not decrypt")
+	})
+}
+
+func Test_NewAESKeyWrapper(t *testing.T) {
+	t.Run("Invalid key size", func(t *testing.T) {
+		_, err := NewAESKeyWrapper([]byte("short"))
+		assert.Error(t, err)
+	})
+
+	t.Run("From file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "kek")
+		key := bytes.Repeat([]byte{3}, 32)
+		require.NoError(t, os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0600))
+		kw, err := NewAESKeyWrapperFromFile(path)
+		require.NoError(t, err)
+		expected, err := NewAESKeyWrapper(key)
+		require.NoError(t, err)
+		assert.Equal(t, expected.KeyID(), kw.KeyID())
+	})
+
+	t.Run("File with invalid encoding", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "kek")
+		require.NoError(t, os.WriteFile(path, []byte("not base64!"), 0600))
+		_, err := NewAESKeyWrapperFromFile(path)
+		assert.Error(t, err)
+	})
+}
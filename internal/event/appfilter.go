@@ -0,0 +1,155 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/argoproj-labs/argocd-agent/internal/manager"
+	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/argoproj/argo-cd/v3/util/glob"
+)
+
+// reservedKeyPrefixes are the prefixes of annotations and labels the agent
+// and the principal rely on, which are never stripped
+var reservedKeyPrefixes = []string{
+	"argocd-agent.argoproj.io/",
+	"argocd-agent.argoproj-labs.io/",
+}
+
+// reservedKeys are the annotations the agent and the principal rely on, which
+// are never stripped
+var reservedKeys = []string{
+	manager.SourceUIDAnnotation,
+	manager.PrincipalUIDAnnotation,
+	manager.NamespaceRemappedAnnotation,
+	manager.MismatchPolicyAnnotation,
+	manager.AdoptionPolicyAnnotation,
+	v1alpha1.AnnotationKeyRefresh,
+	v1alpha1.AnnotationKeyHydrate,
+}
+
+// ApplicationFilter strips annotations, labels and info entries that must not
+// leave the cluster from Applications before they are sent to the peer, e.g.
+// annotations of tools that only run on the principal. It is applied by the
+// EventSource to all Application events, in whichever direction they are sent.
+type ApplicationFilter struct {
+	annotations []string
+	labels      []string
+	info        []string
+}
+
+// ParseApplicationFilter returns an ApplicationFilter for specs, each of which
+// has the form <field>:<pattern>. Field is one of annotation, label or info,
+// and pattern is a glob matched against the annotation or label keys, or the
+// names of the info entries, to strip.
+func ParseApplicationFilter(specs []string) (*ApplicationFilter, error) {
+	f := &ApplicationFilter{}
+	for _, spec := range specs {
+		field, pattern, ok := strings.Cut(strings.TrimSpace(spec), ":")
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("application filter %q is not of the form <field>:<pattern>", spec)
+		}
+		if _, err := glob.MatchWithError(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern in application filter %q: %w", spec, err)
+		}
+		switch field {
+		case "annotation":
+			f.annotations = append(f.annotations, pattern)
+		case "label":
+			f.labels = append(f.labels, pattern)
+		case "info":
+			f.info = append(f.info, pattern)
+		default:
+			return nil, fmt.Errorf("unknown field %q in application filter, must be one of annotation, label or info", field)
+		}
+	}
+	return f, nil
+}
+
+// Apply returns app without the fields stripped by f. If there is nothing to
+// strip, app itself is returned. Otherwise, app is not modified.
+func (f *ApplicationFilter) Apply(app *v1alpha1.Application) *v1alpha1.Application {
+	if f == nil || app == nil || !f.strips(app) {
+		return app
+	}
+	out := app.DeepCopy()
+	maps := []struct {
+		m        map[string]string
+		patterns []string
+	}{
+		{out.Annotations, f.annotations},
+		{out.Labels, f.labels},
+	}
+	for _, s := range maps {
+		for k := range s.m {
+			if stripsKey(s.patterns, k) {
+				delete(s.m, k)
+			}
+		}
+	}
+	out.Spec.Info = slices.DeleteFunc(out.Spec.Info, func(i v1alpha1.Info) bool {
+		return f.StripsInfo(i.Name)
+	})
+	return out
+}
+
+// StripsInfo returns whether f strips the info entry name
+func (f *ApplicationFilter) StripsInfo(name string) bool {
+	return f != nil && glob.MatchStringInList(f.info, name, glob.GLOB)
+}
+
+// strips returns whether f strips any field of app
+func (f *ApplicationFilter) strips(app *v1alpha1.Application) bool {
+	for k := range app.Annotations {
+		if stripsKey(f.annotations, k) {
+			return true
+		}
+	}
+	for k := range app.Labels {
+		if stripsKey(f.labels, k) {
+			return true
+		}
+	}
+	return slices.ContainsFunc(app.Spec.Info, func(i v1alpha1.Info) bool {
+		return f.StripsInfo(i.Name)
+	})
+}
+
+func stripsKey(patterns []string, key string) bool {
+	if slices.Contains(reservedKeys, key) {
+		return false
+	}
+	for _, p := range reservedKeyPrefixes {
+		if strings.HasPrefix(key, p) {
+			return false
+		}
+	}
+	return glob.MatchStringInList(patterns, key, glob.GLOB)
+}
+
+// SetApplicationFilter makes evs strip the fields filtered by f from all
+// Applications it creates events for. It must be called before evs is used.
+func (evs *EventSource) SetApplicationFilter(f *ApplicationFilter) {
+	evs.appFilter = f
+}
+
+// ApplicationFilter returns the filter evs applies to Applications, or nil
+// if there is none
+func (evs *EventSource) ApplicationFilter() *ApplicationFilter {
+	return evs.appFilter
+}
@@ -0,0 +1,104 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"testing"
+
+	"github.com/argoproj-labs/argocd-agent/internal/event/targets"
+	"github.com/argoproj-labs/argocd-agent/internal/manager"
+	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_ParseApplicationFilter(t *testing.T) {
+	t.Run("Valid filters", func(t *testing.T) {
+		f, err := ParseApplicationFilter([]string{"annotation:notifications.argoproj.io/*", " label:team", "info:Owner"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"notifications.argoproj.io/*"}, f.annotations)
+		assert.Equal(t, []string{"team"}, f.labels)
+		assert.Equal(t, []string{"Owner"}, f.info)
+	})
+	t.Run("Invalid filters", func(t *testing.T) {
+		for _, spec := range []string{
+			"annotation",
+			"label:",
+			"spec:project",
+			"annotation:[",
+		} {
+			_, err := ParseApplicationFilter([]string{spec})
+			assert.Error(t, err, spec)
+		}
+	})
+}
+
+func Test_ApplicationFilter(t *testing.T) {
+	newApp := func() *v1alpha1.Application {
+		return &v1alpha1.Application{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "guestbook",
+				Annotations: map[string]string{
+					"notifications.argoproj.io/subscribe.on-sync-succeeded.slack": "channel",
+					manager.SourceUIDAnnotation:                                   "1234",
+					v1alpha1.AnnotationKeyRefresh:                                 "normal",
+					"argocd-agent.argoproj.io/last-updated":                       "now",
+				},
+				Labels: map[string]string{"team": "a", "env": "prod"},
+			},
+			Spec: v1alpha1.ApplicationSpec{
+				Project: "default",
+				Info:    []v1alpha1.Info{{Name: "Owner", Value: "team-a"}, {Name: "Docs", Value: "https://example.com"}},
+			},
+		}
+	}
+	f, err := ParseApplicationFilter([]string{"annotation:*", "label:team", "info:Owner"})
+	require.NoError(t, err)
+
+	t.Run("Filtered fields are stripped", func(t *testing.T) {
+		app := newApp()
+		out := f.Apply(app)
+		assert.Equal(t, map[string]string{
+			manager.SourceUIDAnnotation:             "1234",
+			v1alpha1.AnnotationKeyRefresh:           "normal",
+			"argocd-agent.argoproj.io/last-updated": "now",
+		}, out.Annotations)
+		assert.Equal(t, map[string]string{"env": "prod"}, out.Labels)
+		assert.Equal(t, []v1alpha1.Info{{Name: "Docs", Value: "https://example.com"}}, out.Spec.Info)
+		assert.Equal(t, newApp(), app)
+	})
+
+	t.Run("Applications without filtered fields are not copied", func(t *testing.T) {
+		app := &v1alpha1.Application{ObjectMeta: metav1.ObjectMeta{Name: "guestbook", Labels: map[string]string{"env": "prod"}}}
+		assert.Same(t, app, f.Apply(app))
+	})
+
+	t.Run("Nil filter strips nothing", func(t *testing.T) {
+		var f *ApplicationFilter
+		app := newApp()
+		assert.Same(t, app, f.Apply(app))
+		assert.False(t, f.StripsInfo("Owner"))
+	})
+
+	t.Run("Application events are filtered", func(t *testing.T) {
+		evs := NewEventSource("test")
+		evs.SetApplicationFilter(f)
+		app, err := New(evs.ApplicationEvent(SpecUpdate, newApp()), targets.Application).Application()
+		require.NoError(t, err)
+		assert.NotContains(t, app.Labels, "team")
+		assert.Len(t, app.Spec.Info, 1)
+	})
+}
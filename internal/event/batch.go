@@ -0,0 +1,160 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cloudevents/sdk-go/binding/format/protobuf/v2/pb"
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/argoproj-labs/argocd-agent/internal/event/targets"
+	"github.com/argoproj-labs/argocd-agent/pkg/api/grpc/eventstreamapi"
+)
+
+// Batch is the type of events that carry several other events, which are
+// sent in a single message to reduce the overhead of sending many small
+// events.
+const Batch EventType = targets.TypePrefix + ".batch"
+
+const batchCount string = "batchcount"
+
+// MaxBatchSize is the largest number of events that can be sent in a batch
+const MaxBatchSize = 1000
+
+// batchEventsField is the field number of the events in the data of a batch,
+// which is encoded like the CloudEventBatch message of the CloudEvents
+// protobuf format.
+const batchEventsField protowire.Number = 1
+
+// IsBatch returns whether pev carries a batch of other events
+func IsBatch(pev *pb.CloudEvent) bool {
+	return pev != nil && pev.GetType() == string(Batch)
+}
+
+// PackBatch packs events into a single batch event. A single event is
+// returned as is.
+func PackBatch(events []*pb.CloudEvent) (*pb.CloudEvent, error) {
+	if len(events) == 1 {
+		return events[0], nil
+	}
+	if len(events) == 0 || len(events) > MaxBatchSize {
+		return nil, fmt.Errorf("batch must hold between 1 and %d events", MaxBatchSize)
+	}
+	var data []byte
+	for _, pev := range events {
+		b, err := proto.Marshal(pev)
+		if err != nil {
+			return nil, fmt.Errorf("could not serialize event: %w", err)
+		}
+		data = protowire.AppendTag(data, batchEventsField, protowire.BytesType)
+		data = protowire.AppendBytes(data, b)
+	}
+	return &pb.CloudEvent{
+		Id:          uuid.NewString(),
+		Source:      events[0].GetSource(),
+		SpecVersion: cloudEventSpecVersion,
+		Type:        string(Batch),
+		Attributes: map[string]*pb.CloudEventAttributeValue{
+			batchCount:          {Attr: &pb.CloudEventAttributeValue_CeInteger{CeInteger: int32(len(events))}},
+			attrDataContentType: {Attr: &pb.CloudEventAttributeValue_CeString{CeString: contentTypeBatch}},
+		},
+		Data: &pb.CloudEvent_BinaryData{BinaryData: data},
+	}, nil
+}
+
+// errInvalidBatch is returned when the data of a batch cannot be decoded
+var errInvalidBatch = errors.New("invalid batch")
+
+// UnpackBatch returns the events carried by the batch event pev, in the order
+// they were packed.
+func UnpackBatch(pev *pb.CloudEvent) ([]*pb.CloudEvent, error) {
+	count := pev.GetAttributes()[batchCount].GetCeInteger()
+	if count <= 0 || count > MaxBatchSize {
+		return nil, fmt.Errorf("%w: batch of %d events", errInvalidBatch, count)
+	}
+	data := pev.GetBinaryData()
+	events := make([]*pb.CloudEvent, 0, count)
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 || num != batchEventsField || typ != protowire.BytesType {
+			return nil, errInvalidBatch
+		}
+		data = data[n:]
+		b, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return nil, errInvalidBatch
+		}
+		data = data[n:]
+		ev := &pb.CloudEvent{}
+		if err := proto.Unmarshal(b, ev); err != nil {
+			return nil, fmt.Errorf("%w: %w", errInvalidBatch, err)
+		}
+		events = append(events, ev)
+	}
+	if len(events) != int(count) {
+		return nil, fmt.Errorf("%w: expected %d events, got %d", errInvalidBatch, count, len(events))
+	}
+	return events, nil
+}
+
+// frameBatch collects the events sent by an iteration of an EventWriter's
+// send loop, and sends them in batches of up to size events. A size of 1 or
+// less sends each event on its own right away.
+type frameBatch struct {
+	size int
+	// format is the wire format the events are sent in
+	format WireFormat
+	target streamWriter
+	events []*pb.CloudEvent
+}
+
+// send sends pev on target, or adds it to the batch. Adding an event for
+// another target sends the batch for the previous one first.
+func (b *frameBatch) send(target streamWriter, pev *pb.CloudEvent) error {
+	if b != nil && b.format == WireFormatCloudEvents {
+		pev = ToCloudEvents(pev)
+	}
+	if b == nil || b.size <= 1 {
+		return target.Send(&eventstreamapi.Event{Event: pev})
+	}
+	var err error
+	if b.target != target {
+		err = b.flush()
+		b.target = target
+	}
+	b.events = append(b.events, pev)
+	if len(b.events) >= b.size {
+		return errors.Join(err, b.flush())
+	}
+	return err
+}
+
+// flush sends the events added to the batch.
+func (b *frameBatch) flush() error {
+	if b == nil || len(b.events) == 0 {
+		return nil
+	}
+	events := b.events
+	b.events = nil
+	frame, err := PackBatch(events)
+	if err != nil {
+		return err
+	}
+	return b.target.Send(&eventstreamapi.Event{Event: frame})
+}
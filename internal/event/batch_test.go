@@ -0,0 +1,211 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/cloudevents/sdk-go/binding/format/protobuf/v2/pb"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/argoproj-labs/argocd-agent/pkg/api/grpc/eventstreamapi"
+)
+
+// contextPipeStream is a pipeStream that can be the target of an EventWriter
+type contextPipeStream struct {
+	pipeStream
+}
+
+func (p *contextPipeStream) Context() context.Context {
+	return context.Background()
+}
+
+func newWireEvents(t *testing.T, n int) []*pb.CloudEvent {
+	t.Helper()
+	events := make([]*pb.CloudEvent, 0, n)
+	for i := 0; i < n; i++ {
+		ev := newWireEvent(t, 10).Event
+		ev.Id = fmt.Sprintf("event-%d", i)
+		events = append(events, ev)
+	}
+	return events
+}
+
+func Test_PackBatch(t *testing.T) {
+	t.Run("Batches are unpacked in order", func(t *testing.T) {
+		events := newWireEvents(t, 3)
+		batch, err := PackBatch(events)
+		require.NoError(t, err)
+		assert.True(t, IsBatch(batch))
+		unpacked, err := UnpackBatch(batch)
+		require.NoError(t, err)
+		require.Len(t, unpacked, 3)
+		for i := range events {
+			assert.True(t, proto.Equal(events[i], unpacked[i]))
+		}
+	})
+
+	t.Run("A single event is not packed", func(t *testing.T) {
+		events := newWireEvents(t, 1)
+		batch, err := PackBatch(events)
+		require.NoError(t, err)
+		assert.False(t, IsBatch(batch))
+		assert.Same(t, events[0], batch)
+	})
+
+	t.Run("Batches are limited in size", func(t *testing.T) {
+		_, err := PackBatch(nil)
+		assert.Error(t, err)
+		_, err = PackBatch(newWireEvents(t, MaxBatchSize+1))
+		assert.Error(t, err)
+	})
+
+	t.Run("Invalid batches are rejected", func(t *testing.T) {
+		batch, err := PackBatch(newWireEvents(t, 2))
+		require.NoError(t, err)
+		batch.Attributes[batchCount] = &pb.CloudEventAttributeValue{Attr: &pb.CloudEventAttributeValue_CeInteger{CeInteger: 3}}
+		_, err = UnpackBatch(batch)
+		assert.ErrorIs(t, err, errInvalidBatch)
+
+		batch.Attributes[batchCount] = &pb.CloudEventAttributeValue{Attr: &pb.CloudEventAttributeValue_CeInteger{CeInteger: 2}}
+		batch.Data = &pb.CloudEvent_BinaryData{BinaryData: []byte("garbage")}
+		_, err = UnpackBatch(batch)
+		assert.ErrorIs(t, err, errInvalidBatch)
+	})
+}
+
+func Test_BatchedStream(t *testing.T) {
+	log := logrus.NewEntry(logrus.StandardLogger())
+
+	t.Run("Batches are unpacked on receipt", func(t *testing.T) {
+		p := &pipeStream{}
+		events := newWireEvents(t, 3)
+		batch, err := PackBatch(events[:2])
+		require.NoError(t, err)
+		require.NoError(t, p.Send(&eventstreamapi.Event{Event: batch}))
+		require.NoError(t, p.Send(&eventstreamapi.Event{Event: events[2]}))
+
+		cs := NewChunkedStream(p, 0, log)
+		for _, want := range events {
+			ev, err := cs.Recv()
+			require.NoError(t, err)
+			assert.True(t, proto.Equal(want, ev.Event))
+		}
+		_, err = cs.Recv()
+		assert.ErrorIs(t, err, io.EOF)
+	})
+
+	t.Run("Large batches are sent in chunks", func(t *testing.T) {
+		p := &pipeStream{}
+		events := newWireEvents(t, 200)
+		batch, err := PackBatch(events)
+		require.NoError(t, err)
+		require.NoError(t, NewChunkedStream(p, MinChunkSize, log).Send(&eventstreamapi.Event{Event: batch}))
+		assert.Greater(t, len(p.events), 1)
+
+		cs := NewChunkedStream(p, 0, log)
+		for _, want := range events {
+			ev, err := cs.Recv()
+			require.NoError(t, err)
+			assert.True(t, proto.Equal(want, ev.Event))
+		}
+	})
+
+	t.Run("Invalid batches are discarded", func(t *testing.T) {
+		p := &pipeStream{}
+		events := newWireEvents(t, 3)
+		batch, err := PackBatch(events[:2])
+		require.NoError(t, err)
+		batch.Data = &pb.CloudEvent_BinaryData{BinaryData: []byte("garbage")}
+		require.NoError(t, p.Send(&eventstreamapi.Event{Event: batch}))
+		require.NoError(t, p.Send(&eventstreamapi.Event{Event: events[2]}))
+
+		ev, err := NewChunkedStream(p, 0, log).Recv()
+		require.NoError(t, err)
+		assert.True(t, proto.Equal(events[2], ev.Event))
+	})
+}
+
+func Test_EventWriterBatches(t *testing.T) {
+	es := NewEventSource("test")
+	newApps := func(n int) []*v1alpha1.Application {
+		apps := make([]*v1alpha1.Application, 0, n)
+		for i := 0; i < n; i++ {
+			apps = append(apps, &v1alpha1.Application{ObjectMeta: metav1.ObjectMeta{
+				Name: fmt.Sprintf("app-%d", i), Namespace: "argocd", UID: types.UID(fmt.Sprintf("uid-%d", i)),
+			}})
+		}
+		return apps
+	}
+
+	t.Run("Waiting events are sent in batches", func(t *testing.T) {
+		p := &contextPipeStream{}
+		ew := NewEventWriter("test", p, logrus.NewEntry(logrus.StandardLogger()))
+		ew.SetBatchSize(2)
+		apps := newApps(5)
+		for _, app := range apps {
+			ew.Add(es.ApplicationEvent(Create, app))
+		}
+		batch := &frameBatch{size: ew.batchSize}
+		for _, app := range apps {
+			ew.sendEvent(createResourceID(app.ObjectMeta), LaneControl, batch)
+		}
+		require.NoError(t, batch.flush())
+
+		// Two batches of two events, and a single event
+		require.Len(t, p.events, 3)
+		assert.True(t, IsBatch(p.events[0].Event))
+		assert.True(t, IsBatch(p.events[1].Event))
+		assert.False(t, IsBatch(p.events[2].Event))
+
+		cs := NewChunkedStream(&p.pipeStream, 0, logrus.NewEntry(logrus.StandardLogger()))
+		received := 0
+		for {
+			_, err := cs.Recv()
+			if err != nil {
+				break
+			}
+			received++
+		}
+		assert.Equal(t, 5, received)
+	})
+
+	t.Run("Events are sent on their own without a batch size", func(t *testing.T) {
+		p := &contextPipeStream{}
+		ew := NewEventWriter("test", p, logrus.NewEntry(logrus.StandardLogger()))
+		apps := newApps(3)
+		for _, app := range apps {
+			ew.Add(es.ApplicationEvent(Create, app))
+		}
+		batch := &frameBatch{size: ew.batchSize}
+		for _, app := range apps {
+			ew.sendEvent(createResourceID(app.ObjectMeta), LaneControl, batch)
+		}
+		require.NoError(t, batch.flush())
+		require.Len(t, p.events, 3)
+		for _, ev := range p.events {
+			assert.False(t, IsBatch(ev.Event))
+		}
+	})
+}
@@ -0,0 +1,256 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/cloudevents/sdk-go/binding/format/protobuf/v2/pb"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/argoproj-labs/argocd-agent/internal/event/targets"
+	"github.com/argoproj-labs/argocd-agent/internal/grpcutil"
+	"github.com/argoproj-labs/argocd-agent/pkg/api/grpc/eventstreamapi"
+)
+
+// Chunk is the type of events that carry a fragment of another event, which
+// was too large to be sent in one piece.
+const Chunk EventType = targets.TypePrefix + ".chunk"
+
+const (
+	chunkID    string = "chunkid"
+	chunkIndex string = "chunkindex"
+	chunkCount string = "chunkcount"
+)
+
+// MinChunkSize is the smallest chunk size that can be configured. Smaller
+// chunks would mostly consist of the envelope.
+const MinChunkSize = 1024
+
+// maxReassembledSize is the maximum size of an event reassembled from chunks
+const maxReassembledSize = grpcutil.DefaultGRPCMaxMessageSize
+
+// ParseChunkSize parses a chunk size given as a quantity, e.g. 64Ki. The size
+// must be 0, which disables chunking, or at least MinChunkSize.
+func ParseChunkSize(size string) (int, error) {
+	q, err := resource.ParseQuantity(size)
+	if err != nil {
+		return 0, fmt.Errorf("invalid chunk size %q: %w", size, err)
+	}
+	n := q.Value()
+	if n != 0 && (n < MinChunkSize || n > maxReassembledSize) {
+		return 0, fmt.Errorf("chunk size must be 0 or between %d and %d bytes", MinChunkSize, maxReassembledSize)
+	}
+	return int(n), nil
+}
+
+// IsChunk returns whether pev carries a fragment of another event
+func IsChunk(pev *pb.CloudEvent) bool {
+	return pev != nil && pev.GetType() == string(Chunk)
+}
+
+// SplitEvent splits ev into chunk events carrying at most size bytes of the
+// serialized event each. If the serialized event is not larger than size, or
+// size is 0, ev is returned as is.
+func SplitEvent(ev *eventstreamapi.Event, size int) ([]*eventstreamapi.Event, error) {
+	if size <= 0 || ev.GetEvent() == nil {
+		return []*eventstreamapi.Event{ev}, nil
+	}
+	data, err := proto.Marshal(ev.GetEvent())
+	if err != nil {
+		return nil, fmt.Errorf("could not serialize event: %w", err)
+	}
+	if len(data) <= size {
+		return []*eventstreamapi.Event{ev}, nil
+	}
+	id := uuid.NewString()
+	count := (len(data) + size - 1) / size
+	chunks := make([]*eventstreamapi.Event, 0, count)
+	for i := 0; i < count; i++ {
+		end := min((i+1)*size, len(data))
+		chunks = append(chunks, &eventstreamapi.Event{Event: &pb.CloudEvent{
+			Id:          fmt.Sprintf("%s-%d", id, i),
+			Source:      ev.GetEvent().GetSource(),
+			SpecVersion: cloudEventSpecVersion,
+			Type:        string(Chunk),
+			Attributes: map[string]*pb.CloudEventAttributeValue{
+				chunkID:             {Attr: &pb.CloudEventAttributeValue_CeString{CeString: id}},
+				chunkIndex:          {Attr: &pb.CloudEventAttributeValue_CeInteger{CeInteger: int32(i)}},
+				chunkCount:          {Attr: &pb.CloudEventAttributeValue_CeInteger{CeInteger: int32(count)}},
+				attrDataContentType: {Attr: &pb.CloudEventAttributeValue_CeString{CeString: contentTypeChunk}},
+			},
+			Data: &pb.CloudEvent_BinaryData{BinaryData: data[i*size : end]},
+		}})
+	}
+	return chunks, nil
+}
+
+// Reassembler puts events back together from their chunks. Chunks of an
+// event must be received in order, and without chunks of other events in
+// between, which is how a ChunkedStream sends them.
+type Reassembler struct {
+	id    string
+	next  int32
+	count int32
+	data  []byte
+}
+
+// errIncompleteChunks is returned when the chunks of an event are interrupted
+var errIncompleteChunks = errors.New("chunks of an event are incomplete")
+
+func (r *Reassembler) reset() {
+	r.id, r.next, r.count, r.data = "", 0, 0, nil
+}
+
+// Add adds pev to the event being reassembled. It returns the reassembled
+// event once its last chunk has been added, pev itself if it is not a chunk,
+// and nil otherwise. An error is returned together with any event if the
+// chunks of a previous event were incomplete, in which case that event has
+// been discarded.
+func (r *Reassembler) Add(pev *pb.CloudEvent) (*pb.CloudEvent, error) {
+	if !IsChunk(pev) {
+		if r.id != "" {
+			r.reset()
+			return pev, errIncompleteChunks
+		}
+		return pev, nil
+	}
+	attrs := pev.GetAttributes()
+	id := attrs[chunkID].GetCeString()
+	index := attrs[chunkIndex].GetCeInteger()
+	count := attrs[chunkCount].GetCeInteger()
+	if id == "" || count <= 0 || index < 0 || index >= count {
+		r.reset()
+		return nil, fmt.Errorf("invalid chunk %d/%d of event %q", index, count, id)
+	}
+
+	// A first chunk starts a new event, even if the previous one is not
+	// complete, e.g. because it is being resent.
+	var err error
+	if index == 0 {
+		if r.id != "" {
+			err = errIncompleteChunks
+		}
+		r.id, r.next, r.count, r.data = id, 0, count, nil
+	} else if id != r.id || count != r.count || index != r.next {
+		r.reset()
+		return nil, fmt.Errorf("unexpected chunk %d/%d of event %q", index, count, id)
+	}
+
+	r.data = append(r.data, pev.GetBinaryData()...)
+	if len(r.data) > maxReassembledSize {
+		r.reset()
+		return nil, fmt.Errorf("event %q exceeds maximum size of %d bytes", id, maxReassembledSize)
+	}
+	if index < count-1 {
+		r.next = index + 1
+		return nil, err
+	}
+
+	data := r.data
+	r.reset()
+	full := &pb.CloudEvent{}
+	if uerr := proto.Unmarshal(data, full); uerr != nil {
+		return nil, fmt.Errorf("could not deserialize event %q from chunks: %w", id, uerr)
+	}
+	return full, err
+}
+
+// EventStream is the part of an event stream's client and server side that a
+// ChunkedStream needs.
+type EventStream interface {
+	Send(*eventstreamapi.Event) error
+	Recv() (*eventstreamapi.Event, error)
+}
+
+// ChunkedStream sends events larger than its chunk size on a stream in
+// chunks, and reassembles chunked events received on the stream. A chunk
+// size of 0 disables sending chunks, but chunks are reassembled regardless.
+// Batches of events received on the stream are unpacked.
+type ChunkedStream struct {
+	stream EventStream
+	size   int
+	// sendMu keeps the chunks of different events from being interleaved
+	sendMu      sync.Mutex
+	reassembler Reassembler
+	// unpacked holds the events of a received batch that have not been
+	// returned by Recv yet
+	unpacked []*pb.CloudEvent
+	log      *logrus.Entry
+}
+
+// NewChunkedStream returns a ChunkedStream sending events on stream in chunks
+// of size bytes.
+func NewChunkedStream(stream EventStream, size int, log *logrus.Entry) *ChunkedStream {
+	return &ChunkedStream{stream: stream, size: size, log: log}
+}
+
+// Send sends ev on the stream, in chunks if it is larger than the chunk size
+func (cs *ChunkedStream) Send(ev *eventstreamapi.Event) error {
+	chunks, err := SplitEvent(ev, cs.size)
+	if err != nil {
+		return err
+	}
+	cs.sendMu.Lock()
+	defer cs.sendMu.Unlock()
+	for _, chunk := range chunks {
+		if err := cs.stream.Send(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Recv receives the next event from the stream, reassembling it from chunks
+// or unpacking it from a batch if required. Events whose chunks are
+// incomplete or invalid, and invalid batches, are discarded; since they are
+// never acknowledged, their sender will resend them. Events received in the
+// CloudEvents wire format are returned in the legacy one.
+//
+// Recv must not be called concurrently.
+func (cs *ChunkedStream) Recv() (*eventstreamapi.Event, error) {
+	for {
+		if len(cs.unpacked) > 0 {
+			next := cs.unpacked[0]
+			cs.unpacked = cs.unpacked[1:]
+			FromCloudEvents(next)
+			return &eventstreamapi.Event{Event: next}, nil
+		}
+		ev, err := cs.stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		full, err := cs.reassembler.Add(ev.GetEvent())
+		if err != nil {
+			cs.log.WithError(err).Warn("Discarding chunked event")
+		}
+		if IsBatch(full) {
+			cs.unpacked, err = UnpackBatch(full)
+			if err != nil {
+				cs.log.WithError(err).Warn("Discarding batch of events")
+			}
+			continue
+		}
+		if full != nil {
+			FromCloudEvents(full)
+			return &eventstreamapi.Event{Event: full}, nil
+		}
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/cloudevents/sdk-go/binding/format/protobuf/v2/pb"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/argoproj-labs/argocd-agent/pkg/api/grpc/eventstreamapi"
+)
+
+// pipeStream is an EventStream that receives the events sent on it
+type pipeStream struct {
+	events []*eventstreamapi.Event
+}
+
+func (p *pipeStream) Send(ev *eventstreamapi.Event) error {
+	p.events = append(p.events, ev)
+	return nil
+}
+
+func (p *pipeStream) Recv() (*eventstreamapi.Event, error) {
+	if len(p.events) == 0 {
+		return nil, io.EOF
+	}
+	ev := p.events[0]
+	p.events = p.events[1:]
+	return ev, nil
+}
+
+func newWireEvent(t *testing.T, size int) *eventstreamapi.Event {
+	t.Helper()
+	return &eventstreamapi.Event{Event: &pb.CloudEvent{
+		Id:          "event-1",
+		Source:      "test",
+		SpecVersion: cloudEventSpecVersion,
+		Type:        string(SpecUpdate),
+		Data:        &pb.CloudEvent_TextData{TextData: strings.Repeat("x", size)},
+	}}
+}
+
+func Test_ParseChunkSize(t *testing.T) {
+	size, err := ParseChunkSize("64Ki")
+	require.NoError(t, err)
+	assert.Equal(t, 64*1024, size)
+	size, err = ParseChunkSize("0")
+	require.NoError(t, err)
+	assert.Equal(t, 0, size)
+	_, err = ParseChunkSize("100")
+	assert.Error(t, err)
+	_, err = ParseChunkSize("lots")
+	assert.Error(t, err)
+}
+
+func Test_SplitEvent(t *testing.T) {
+	t.Run("Small events are not split", func(t *testing.T) {
+		ev := newWireEvent(t, 100)
+		chunks, err := SplitEvent(ev, MinChunkSize)
+		require.NoError(t, err)
+		require.Len(t, chunks, 1)
+		assert.Same(t, ev, chunks[0])
+	})
+
+	t.Run("Events are not split with a chunk size of 0", func(t *testing.T) {
+		chunks, err := SplitEvent(newWireEvent(t, 10*MinChunkSize), 0)
+		require.NoError(t, err)
+		assert.Len(t, chunks, 1)
+	})
+
+	t.Run("Large events are split", func(t *testing.T) {
+		ev := newWireEvent(t, 3*MinChunkSize)
+		chunks, err := SplitEvent(ev, MinChunkSize)
+		require.NoError(t, err)
+		require.Len(t, chunks, 4)
+		for _, c := range chunks {
+			assert.True(t, IsChunk(c.Event))
+			assert.LessOrEqual(t, len(c.Event.GetBinaryData()), MinChunkSize)
+		}
+	})
+}
+
+func Test_ChunkedStream(t *testing.T) {
+	log := logrus.NewEntry(logrus.StandardLogger())
+
+	t.Run("Events are reassembled", func(t *testing.T) {
+		p := &pipeStream{}
+		cs := NewChunkedStream(p, MinChunkSize, log)
+		small := newWireEvent(t, 10)
+		large := newWireEvent(t, 5*MinChunkSize)
+		require.NoError(t, cs.Send(large))
+		require.NoError(t, cs.Send(small))
+		assert.Greater(t, len(p.events), 2)
+
+		ev, err := cs.Recv()
+		require.NoError(t, err)
+		assert.True(t, proto.Equal(large.Event, ev.Event))
+		ev, err = cs.Recv()
+		require.NoError(t, err)
+		assert.True(t, proto.Equal(small.Event, ev.Event))
+		_, err = cs.Recv()
+		assert.ErrorIs(t, err, io.EOF)
+	})
+
+	t.Run("Chunks are reassembled without a chunk size", func(t *testing.T) {
+		p := &pipeStream{}
+		large := newWireEvent(t, 5*MinChunkSize)
+		require.NoError(t, NewChunkedStream(p, MinChunkSize, log).Send(large))
+		ev, err := NewChunkedStream(p, 0, log).Recv()
+		require.NoError(t, err)
+		assert.True(t, proto.Equal(large.Event, ev.Event))
+	})
+
+	t.Run("Incomplete events are discarded", func(t *testing.T) {
+		p := &pipeStream{}
+		cs := NewChunkedStream(p, MinChunkSize, log)
+		require.NoError(t, cs.Send(newWireEvent(t, 5*MinChunkSize)))
+		// Drop the last chunk, as if the event was interrupted
+		p.events = p.events[:len(p.events)-1]
+		small := newWireEvent(t, 10)
+		require.NoError(t, cs.Send(small))
+
+		ev, err := cs.Recv()
+		require.NoError(t, err)
+		assert.True(t, proto.Equal(small.Event, ev.Event))
+	})
+
+	t.Run("Resent events are reassembled", func(t *testing.T) {
+		p := &pipeStream{}
+		cs := NewChunkedStream(p, MinChunkSize, log)
+		large := newWireEvent(t, 5*MinChunkSize)
+		require.NoError(t, cs.Send(large))
+		p.events = p.events[:2]
+		require.NoError(t, cs.Send(large))
+
+		ev, err := cs.Recv()
+		require.NoError(t, err)
+		assert.True(t, proto.Equal(large.Event, ev.Event))
+	})
+
+	t.Run("Chunks out of order are discarded", func(t *testing.T) {
+		p := &pipeStream{}
+		cs := NewChunkedStream(p, MinChunkSize, log)
+		require.NoError(t, cs.Send(newWireEvent(t, 5*MinChunkSize)))
+		p.events[1], p.events[2] = p.events[2], p.events[1]
+
+		_, err := cs.Recv()
+		assert.ErrorIs(t, err, io.EOF)
+	})
+}
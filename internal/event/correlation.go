@@ -0,0 +1,88 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"context"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"github.com/argoproj-labs/argocd-agent/internal/logging/logfields"
+)
+
+// Every event is assigned a correlation ID when it is emitted. Unlike the
+// event ID, which identifies a version of a resource, the correlation ID
+// identifies a single emission, and is kept by everything that is caused by
+// the event: the ACK sent for it, responses to requests, and the changes the
+// receiving side applies because of it. It is included in the log lines of
+// both sides and in the exemplars of the event metrics, so that a single
+// change can be followed from one side to the other.
+
+const correlationID string = "correlationid"
+
+// NewCorrelationID returns a new, unique correlation ID
+func NewCorrelationID() string {
+	return uuid.NewString()
+}
+
+// SetCorrelationID stamps the correlation ID id on an event. An empty id
+// leaves the event unchanged.
+func SetCorrelationID(ev *cloudevents.Event, id string) {
+	if id == "" {
+		return
+	}
+	ev.SetExtension(correlationID, id)
+}
+
+// CorrelationID returns the correlation ID of an event, or the empty string
+// if the event has none, e.g. because it was sent by an older peer.
+func CorrelationID(ev *cloudevents.Event) string {
+	id, _ := ev.Extensions()[correlationID].(string)
+	return id
+}
+
+func (ev Event) CorrelationID() string {
+	return CorrelationID(ev.event)
+}
+
+type correlationIDKey struct{}
+
+// ContextWithCorrelationID returns a copy of ctx carrying the correlation ID
+// id, so that it can be passed on to the code processing an event. An empty
+// id returns ctx as it is.
+func ContextWithCorrelationID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+// CorrelationIDFromContext returns the correlation ID carried by ctx, or the
+// empty string if there is none.
+func CorrelationIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
+
+// WithCorrelationID adds the correlation ID carried by ctx to the log entry
+// logCtx, if there is one.
+func WithCorrelationID(ctx context.Context, logCtx *logrus.Entry) *logrus.Entry {
+	if id := CorrelationIDFromContext(ctx); id != "" {
+		return logCtx.WithField(logfields.CorrelationID, id)
+	}
+	return logCtx
+}
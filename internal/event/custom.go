@@ -0,0 +1,98 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/argoproj-labs/argocd-agent/internal/event/targets"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/google/uuid"
+)
+
+// Projects embedding the principal or the agent can exchange events of their
+// own, for example to push configuration or to collect telemetry, without
+// changing the protocol. Their targets are registered with
+// RegisterCustomTarget on both ends, and their events are created with
+// EventSource.CustomEvent. Custom events go through the same queues, ACKs
+// and validation as the built-in events, but their types and data are opaque
+// to argocd-agent and left to the handlers registered for their target.
+
+var (
+	customTargetsLock sync.RWMutex
+	// key: event target
+	// value: unused
+	customTargets = map[targets.EventTarget]struct{}{}
+)
+
+// customTargetPattern matches domain qualified target names, such as
+// telemetry.example.com, which cannot clash with the built-in targets
+var customTargetPattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)+$`)
+
+// RegisterCustomTarget registers target as the target of custom events. The
+// name of target must be qualified by a domain owned by the registering
+// project, e.g. telemetry.example.com. It is meant to be called during
+// initialization, and returns an error if the name is invalid or is already
+// in use by a built-in or resource target. Registering a custom target more
+// than once is not an error.
+func RegisterCustomTarget(target targets.EventTarget) error {
+	if !customTargetPattern.MatchString(target.String()) {
+		return fmt.Errorf("invalid custom event target %q: must be a lowercase, domain qualified name", target)
+	}
+	if builtin := targetFromString(target.String()); builtin != "" && !IsCustomTarget(builtin) {
+		return fmt.Errorf("event target %s is already in use", target)
+	}
+	customTargetsLock.Lock()
+	defer customTargetsLock.Unlock()
+	customTargets[target] = struct{}{}
+	return nil
+}
+
+// IsCustomTarget returns whether target was registered as a custom target
+func IsCustomTarget(target targets.EventTarget) bool {
+	customTargetsLock.RLock()
+	defer customTargetsLock.RUnlock()
+	_, ok := customTargets[target]
+	return ok
+}
+
+// CustomEvent returns an event of type evType for the custom target target,
+// carrying the JSON encoding of data. The target must be registered with
+// RegisterCustomTarget. Each custom event is unique, and is not superseded by
+// later events of the same type.
+func (evs EventSource) CustomEvent(target targets.EventTarget, evType string, data any) (*cloudevents.Event, error) {
+	if !IsCustomTarget(target) {
+		return nil, fmt.Errorf("event target %s is not a custom target", target)
+	}
+	if evType == "" {
+		return nil, fmt.Errorf("custom event for %s requires a type", target)
+	}
+	reqUUID := uuid.NewString()
+	cev := cloudevents.NewEvent()
+	cev.SetSource(evs.source)
+	cev.SetSpecVersion(cloudEventSpecVersion)
+	cev.SetExtension(correlationID, NewCorrelationID())
+	cev.SetType(evType)
+	SetPriority(&cev, PriorityNormal)
+	cev.SetExtension(eventID, reqUUID)
+	cev.SetExtension(resourceID, reqUUID)
+	cev.SetDataSchema(target.String())
+	if err := cev.SetData(cloudevents.ApplicationJSON, data); err != nil {
+		return nil, fmt.Errorf("could not encode custom event for %s: %w", target, err)
+	}
+	return &cev, nil
+}
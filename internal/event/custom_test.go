@@ -0,0 +1,69 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"testing"
+
+	"github.com/argoproj-labs/argocd-agent/internal/event/targets"
+	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_CustomEvents(t *testing.T) {
+	es := NewEventSource("test")
+	target := targets.EventTarget("telemetry.example.com")
+
+	t.Run("Targets must be domain qualified and unused", func(t *testing.T) {
+		for _, name := range []string{"telemetry", "Telemetry.example.com", "telemetry..example.com", "-x.example.com", "", targets.Application.String()} {
+			assert.Error(t, RegisterCustomTarget(targets.EventTarget(name)), name)
+		}
+		require.NoError(t, RegisterResourceTarget("widgets.example.com", v1alpha1.ApplicationSchemaGroupVersionKind))
+		assert.Error(t, RegisterCustomTarget("widgets.example.com"))
+		assert.False(t, IsCustomTarget("widgets.example.com"))
+		require.NoError(t, RegisterCustomTarget(target))
+		require.NoError(t, RegisterCustomTarget(target))
+		assert.True(t, IsCustomTarget(target))
+	})
+
+	t.Run("Custom events are unique and carry their data", func(t *testing.T) {
+		require.NoError(t, RegisterCustomTarget(target))
+		ev, err := es.CustomEvent(target, "sample", map[string]int{"cpu": 4})
+		require.NoError(t, err)
+		assert.Equal(t, target, Target(ev))
+		assert.Equal(t, "sample", ev.Type())
+		assert.NoError(t, Validate(ev))
+		data := map[string]int{}
+		require.NoError(t, ev.DataAs(&data))
+		assert.Equal(t, 4, data["cpu"])
+
+		other, err := es.CustomEvent(target, "sample", nil)
+		require.NoError(t, err)
+		assert.NotEqual(t, ResourceID(ev), ResourceID(other))
+		assert.NotEqual(t, EventID(ev), EventID(other))
+	})
+
+	t.Run("Custom events require a registered target and a type", func(t *testing.T) {
+		_, err := es.CustomEvent("unknown.example.com", "sample", nil)
+		assert.Error(t, err)
+		_, err = es.CustomEvent(target, "", nil)
+		assert.Error(t, err)
+
+		ev := es.HeartbeatEvent(Ping)
+		ev.SetDataSchema("unknown.example.com")
+		assert.True(t, IsInvalidEvent(Validate(ev)))
+	})
+}
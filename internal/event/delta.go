@@ -0,0 +1,225 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	jsonpatch "github.com/evanphx/json-patch/v5"
+
+	"github.com/argoproj-labs/argocd-agent/internal/event/targets"
+)
+
+// Delta events carry a patch against the last version of an Application the
+// receiver acknowledged instead of the full object. The sender stamps each
+// Application event with the digest of its full data, so that the receiver
+// can remember it as the base of later deltas. A delta additionally names the
+// digest of its base. If the receiver does not know the base, it rejects the
+// delta and the sender resends the full object.
+
+const (
+	// ContentTypeMergePatch is the content type of deltas in the JSON Merge
+	// Patch format of RFC 7386
+	ContentTypeMergePatch = "application/merge-patch+json"
+	// ContentTypeJSONPatch is the content type of deltas in the JSON Patch
+	// format of RFC 6902
+	ContentTypeJSONPatch = "application/json-patch+json"
+)
+
+// DeltaEncodingHeader is the name of the gRPC metadata a peer announces the
+// content types of the deltas it can resolve in. The agent sends it in the
+// request metadata of its event stream, the principal in the response header.
+const DeltaEncodingHeader = "x-argocd-agent-delta-encoding"
+
+const (
+	deltaBase   string = "deltabase"
+	deltaDigest string = "deltadigest"
+)
+
+// maxDeltaBases is the number of versions of a resource a receiver resolves
+// deltas against. The sender may not have received the ACK for the latest
+// version yet, and patch against the one before.
+const maxDeltaBases = 2
+
+// ErrDeltaUnresolvable is returned for deltas whose base is not known to the
+// receiver, or which cannot be applied to it.
+var ErrDeltaUnresolvable error = errors.New("delta cannot be resolved")
+
+// ParseDeltaEncoding returns whether a DeltaEncodingHeader announces that the
+// peer can resolve deltas in the JSON Merge Patch format.
+func ParseDeltaEncoding(values []string) bool {
+	for _, v := range values {
+		if v == ContentTypeMergePatch {
+			return true
+		}
+	}
+	return false
+}
+
+// IsDeltaRejection returns whether ack tells that the acknowledged event was
+// a delta the receiver could not resolve.
+func IsDeltaRejection(ack *cloudevents.Event) bool {
+	return RejectionReason(ack) == ErrDeltaUnresolvable.Error()
+}
+
+// DeltaRejectedEvent returns the ACK that tells the sender of ev that the
+// delta could not be resolved, so that it resends the full object.
+func (evs EventSource) DeltaRejectedEvent(ev *cloudevents.Event) *cloudevents.Event {
+	ack := evs.ProcessedEvent(EventProcessed, New(ev, targets.EventAck))
+	for _, ext := range []string{deltaBase, deltaDigest} {
+		ack.SetExtension(ext, nil)
+	}
+	SetRejectionReason(ack, ErrDeltaUnresolvable.Error())
+	return ack
+}
+
+// deltaState is a version of a resource deltas are computed against
+type deltaState struct {
+	digest string
+	data   []byte
+}
+
+func dataDigest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16])
+}
+
+// deltaCandidate returns whether ev may be sent as a delta, or be the base of
+// one.
+func deltaCandidate(ev *cloudevents.Event) bool {
+	if Target(ev) != targets.Application {
+		return false
+	}
+	switch ev.Type() {
+	case Create.String(), SpecUpdate.String(), StatusUpdate.String():
+	default:
+		return false
+	}
+	ct := ev.DataContentType()
+	return ct == "" || ct == cloudevents.ApplicationJSON
+}
+
+// encodeDelta returns a copy of ev stamped with the digest of its data. If
+// base is not nil, and a patch against it is smaller than the data, the copy
+// carries the patch instead of the data.
+func encodeDelta(ev *cloudevents.Event, base *deltaState) *cloudevents.Event {
+	out := ev.Clone()
+	data := ev.Data()
+	out.SetExtension(deltaDigest, dataDigest(data))
+	if base == nil {
+		return &out
+	}
+	patch, err := jsonpatch.CreateMergePatch(base.data, data)
+	if err != nil || len(patch) >= len(data) {
+		return &out
+	}
+	out.DataEncoded = patch
+	out.SetDataContentType(ContentTypeMergePatch)
+	out.SetExtension(deltaBase, base.digest)
+	return &out
+}
+
+// DeltaReceiver resolves the deltas received from a peer. It is safe for
+// concurrent use.
+type DeltaReceiver struct {
+	mu sync.Mutex
+	// key: resource ID
+	// value: the versions of the resource, latest last
+	bases map[string][]deltaState
+}
+
+func NewDeltaReceiver() *DeltaReceiver {
+	return &DeltaReceiver{bases: map[string][]deltaState{}}
+}
+
+// Resolve replaces the patch carried by ev with the full object in place, if
+// ev is a delta. Events stamped by a sender that encodes deltas are
+// remembered as the base of later deltas. It returns ErrDeltaUnresolvable if
+// the delta cannot be resolved, in which case the sender must be sent a
+// DeltaRejectedEvent.
+func (d *DeltaReceiver) Resolve(ev *cloudevents.Event) error {
+	resID := ResourceID(ev)
+	if ev.Type() == Delete.String() {
+		d.mu.Lock()
+		delete(d.bases, resID)
+		d.mu.Unlock()
+		return nil
+	}
+
+	data := ev.Data()
+	switch ct := ev.DataContentType(); ct {
+	case ContentTypeMergePatch, ContentTypeJSONPatch:
+		digest, _ := ev.Extensions()[deltaBase].(string)
+		base := d.base(resID, digest)
+		if base == nil {
+			return fmt.Errorf("%w: base %q of resource %s is unknown", ErrDeltaUnresolvable, digest, resID)
+		}
+		resolved, err := applyDelta(ct, base, data)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrDeltaUnresolvable, err)
+		}
+		data = resolved
+		ev.DataEncoded = resolved
+		ev.SetDataContentType(cloudevents.ApplicationJSON)
+		ev.SetExtension(deltaBase, nil)
+	}
+
+	if digest, ok := ev.Extensions()[deltaDigest].(string); ok {
+		ev.SetExtension(deltaDigest, nil)
+		d.remember(resID, deltaState{digest: digest, data: data})
+	}
+	return nil
+}
+
+func applyDelta(contentType string, base, patch []byte) ([]byte, error) {
+	if contentType == ContentTypeMergePatch {
+		return jsonpatch.MergePatch(base, patch)
+	}
+	p, err := jsonpatch.DecodePatch(patch)
+	if err != nil {
+		return nil, err
+	}
+	return p.Apply(base)
+}
+
+func (d *DeltaReceiver) base(resID, digest string) []byte {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, s := range d.bases[resID] {
+		if s.digest == digest {
+			return s.data
+		}
+	}
+	return nil
+}
+
+func (d *DeltaReceiver) remember(resID string, s deltaState) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	states := d.bases[resID]
+	if n := len(states); n > 0 && states[n-1].digest == s.digest {
+		return
+	}
+	states = append(states, s)
+	if len(states) > maxDeltaBases {
+		states = states[len(states)-maxDeltaBases:]
+	}
+	d.bases[resID] = states
+}
@@ -0,0 +1,159 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	format "github.com/cloudevents/sdk-go/binding/format/protobuf/v2"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/argoproj-labs/argocd-agent/internal/event/targets"
+)
+
+func Test_DeltaEvents(t *testing.T) {
+	es := NewEventSource("test")
+	app := &v1alpha1.Application{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "argocd", UID: "uid", ResourceVersion: "1"},
+		Spec:       v1alpha1.ApplicationSpec{Project: "default"},
+		Status:     v1alpha1.ApplicationStatus{Health: v1alpha1.AppHealthStatus{Status: "Progressing", Message: strings.Repeat("x", 1024)}},
+	}
+
+	// send sends the next event waiting in ew and returns it as received
+	send := func(t *testing.T, ew *EventWriter, p *contextPipeStream, resID string) *cloudevents.Event {
+		t.Helper()
+		sent := len(p.events)
+		batch := &frameBatch{}
+		ew.sendEvent(resID, LaneControl, batch)
+		require.NoError(t, batch.flush())
+		require.Len(t, p.events, sent+1)
+		raw, err := format.FromProto(p.events[sent].Event)
+		require.NoError(t, err)
+		return raw
+	}
+
+	t.Run("Updates after an ACK are sent as deltas", func(t *testing.T) {
+		p := &contextPipeStream{}
+		ew := NewEventWriter("test", p, logrus.NewEntry(logrus.StandardLogger()))
+		ew.SetDeltaEncoding(true)
+		receiver := NewDeltaReceiver()
+
+		ev := es.ApplicationEvent(Create, app)
+		ew.Add(ev)
+		received := send(t, ew, p, ResourceID(ev))
+		assert.Equal(t, cloudevents.ApplicationJSON, received.DataContentType())
+		require.NoError(t, receiver.Resolve(received))
+		ew.Remove(es.ProcessedEvent(EventProcessed, New(received, targets.EventAck)))
+
+		updated := app.DeepCopy()
+		updated.ResourceVersion = "2"
+		updated.Status.Health.Status = "Healthy"
+		ev = es.ApplicationEvent(StatusUpdate, updated)
+		ew.Add(ev)
+		received = send(t, ew, p, ResourceID(ev))
+		assert.Equal(t, ContentTypeMergePatch, received.DataContentType())
+		assert.Less(t, len(received.Data()), len(ev.Data()))
+
+		require.NoError(t, receiver.Resolve(received))
+		assert.Equal(t, cloudevents.ApplicationJSON, received.DataContentType())
+		assert.Empty(t, received.Extensions()[deltaBase])
+		assert.Empty(t, received.Extensions()[deltaDigest])
+		got := &v1alpha1.Application{}
+		require.NoError(t, received.DataAs(got))
+		assert.Equal(t, updated, got)
+	})
+
+	t.Run("Deltas with an unknown base are resent in full", func(t *testing.T) {
+		p := &contextPipeStream{}
+		ew := NewEventWriter("test", p, logrus.NewEntry(logrus.StandardLogger()))
+		ew.SetDeltaEncoding(true)
+
+		ev := es.ApplicationEvent(Create, app)
+		ew.Add(ev)
+		received := send(t, ew, p, ResourceID(ev))
+		ew.Remove(es.ProcessedEvent(EventProcessed, New(received, targets.EventAck)))
+
+		updated := app.DeepCopy()
+		updated.ResourceVersion = "2"
+		updated.Spec.Project = "other"
+		ev = es.ApplicationEvent(SpecUpdate, updated)
+		ew.Add(ev)
+		received = send(t, ew, p, ResourceID(ev))
+		require.Equal(t, ContentTypeMergePatch, received.DataContentType())
+
+		// The receiver has restarted in the meantime
+		receiver := NewDeltaReceiver()
+		err := receiver.Resolve(received)
+		require.ErrorIs(t, err, ErrDeltaUnresolvable)
+		ew.Remove(es.DeltaRejectedEvent(received))
+		assert.Equal(t, 1, ew.Pending())
+
+		received = send(t, ew, p, ResourceID(ev))
+		assert.Equal(t, cloudevents.ApplicationJSON, received.DataContentType())
+		require.NoError(t, receiver.Resolve(received))
+		got := &v1alpha1.Application{}
+		require.NoError(t, received.DataAs(got))
+		assert.Equal(t, "other", got.Spec.Project)
+	})
+
+	t.Run("Events are sent in full without delta encoding", func(t *testing.T) {
+		p := &contextPipeStream{}
+		ew := NewEventWriter("test", p, logrus.NewEntry(logrus.StandardLogger()))
+
+		ev := es.ApplicationEvent(Create, app)
+		ew.Add(ev)
+		received := send(t, ew, p, ResourceID(ev))
+		assert.Empty(t, received.Extensions()[deltaDigest])
+		ew.Remove(es.ProcessedEvent(EventProcessed, New(received, targets.EventAck)))
+
+		ev = es.ApplicationEvent(SpecUpdate, app)
+		ew.Add(ev)
+		received = send(t, ew, p, ResourceID(ev))
+		assert.Equal(t, cloudevents.ApplicationJSON, received.DataContentType())
+	})
+}
+
+func Test_DeltaReceiverJSONPatch(t *testing.T) {
+	receiver := NewDeltaReceiver()
+	full := cloudevents.NewEvent()
+	full.SetType(SpecUpdate.String())
+	full.SetExtension(resourceID, "app_uid")
+	require.NoError(t, full.SetData(cloudevents.ApplicationJSON, []byte(`{"spec":{"project":"default"}}`)))
+	full.SetExtension(deltaDigest, "base")
+	require.NoError(t, receiver.Resolve(&full))
+
+	delta := cloudevents.NewEvent()
+	delta.SetType(SpecUpdate.String())
+	delta.SetExtension(resourceID, "app_uid")
+	require.NoError(t, delta.SetData(ContentTypeJSONPatch, []byte(`[{"op":"replace","path":"/spec/project","value":"other"}]`)))
+	delta.SetExtension(deltaBase, "base")
+	require.NoError(t, receiver.Resolve(&delta))
+	assert.JSONEq(t, `{"spec":{"project":"other"}}`, string(delta.Data()))
+
+	// Deletions forget the bases of the resource
+	deleted := cloudevents.NewEvent()
+	deleted.SetType(Delete.String())
+	deleted.SetExtension(resourceID, "app_uid")
+	require.NoError(t, receiver.Resolve(&deleted))
+	delta.SetExtension(deltaBase, "base")
+	require.NoError(t, delta.SetData(ContentTypeJSONPatch, []byte(`[]`)))
+	assert.ErrorIs(t, receiver.Resolve(&delta), ErrDeltaUnresolvable)
+}
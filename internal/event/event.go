@@ -59,8 +59,11 @@ const (
 	ResponseSyncedResource     EventType = targets.TypePrefix + ".response-synced-resource"
 	EventRequestUpdate         EventType = targets.TypePrefix + ".request-update"
 	EventRequestResourceResync EventType = targets.TypePrefix + ".request-resource-resync"
+	StateDigestExchange        EventType = targets.TypePrefix + ".state-digest"
+	EventIncrementalResync     EventType = targets.TypePrefix + ".request-incremental-resync"
 	ClusterCacheInfoUpdate     EventType = targets.TypePrefix + ".cluster-cache-info-update"
 	TerminalRequest            EventType = targets.TypePrefix + ".terminal-request"
+	GoAway                     EventType = targets.TypePrefix + ".goaway"
 )
 
 const (
@@ -68,6 +71,8 @@ const (
 	eventID      string = "eventid"
 	sentAt       string = "sentat"
 	principalUID string = "principaluid"
+
+	rejectionReason string = "rejectionreason"
 )
 
 // SetSentAt stamps the current time on an event as the send time.
@@ -102,6 +107,22 @@ func PrincipalUID(ev *cloudevents.Event) string {
 	return val
 }
 
+// SetRejectionReason records on an ACK why the acknowledged event was not
+// allowed, so that the sender can learn about it.
+func SetRejectionReason(ev *cloudevents.Event, reason string) {
+	ev.SetExtension(rejectionReason, reason)
+}
+
+// RejectionReason returns the reason the event acknowledged by ev was not
+// allowed, or empty string if it was not rejected.
+func RejectionReason(ev *cloudevents.Event) string {
+	val, ok := ev.Extensions()[rejectionReason].(string)
+	if !ok {
+		return ""
+	}
+	return val
+}
+
 var (
 	ErrEventDiscarded    error = errors.New("event discarded")
 	ErrEventNotAllowed   error = errors.New("event not allowed in this agent mode")
@@ -113,9 +134,22 @@ func (t EventType) String() string {
 	return string(t)
 }
 
+// EventTypes returns all supported event types. Keep this in sync with the
+// list of EventType constants above.
+func EventTypes() []EventType {
+	return []EventType{
+		Ping, Pong, Create, Delete, SpecUpdate, StatusUpdate, SetOperation,
+		TerminateOperation, EventProcessed, GetRequest, GetResponse,
+		RedisGenericRequest, RedisGenericResponse, SyncedResourceList,
+		ResponseSyncedResource, EventRequestUpdate, EventRequestResourceResync,
+		StateDigestExchange, EventIncrementalResync, ClusterCacheInfoUpdate, TerminalRequest, GoAway,
+	}
+}
+
 // EventSource is a utility to construct new 'cloudevents.Event' events for a given 'source'
 type EventSource struct {
-	source string
+	source    string
+	appFilter *ApplicationFilter
 }
 
 // Event is the 'on the wire' representation of an event, and is parsed by from protobuf via FromWire
@@ -158,17 +192,9 @@ func NewEventDiscardedErr(format string, a ...any) error {
 }
 
 func (evs EventSource) ApplicationEvent(evType EventType, app *v1alpha1.Application) *cloudevents.Event {
-	cev := cloudevents.NewEvent()
-	cev.SetSource(evs.source)
-	cev.SetSpecVersion(cloudEventSpecVersion)
-	cev.SetType(evType.String())
-	cev.SetExtension(eventID, createEventID(app.ObjectMeta))
-	cev.SetExtension(resourceID, createResourceID(app.ObjectMeta))
-	cev.SetDataSchema(targets.Application.String())
-	cev.SetSubject(fmt.Sprintf("%s/%s", app.Namespace, app.Name))
-	// TODO: Handle this error situation?
-	_ = cev.SetData(cloudevents.ApplicationJSON, app)
-	return &cev
+	// Built-in resources always encode, and their targets are registered
+	cev, _ := evs.ResourceEvent(evType, targets.Application, evs.appFilter.Apply(app))
+	return cev
 }
 
 func createResourceID(res v1.ObjectMeta) string {
@@ -180,30 +206,13 @@ func createEventID(res v1.ObjectMeta) string {
 }
 
 func (evs EventSource) AppProjectEvent(evType EventType, appProject *v1alpha1.AppProject) *cloudevents.Event {
-	cev := cloudevents.NewEvent()
-	cev.SetSource(evs.source)
-	cev.SetSpecVersion(cloudEventSpecVersion)
-	cev.SetType(evType.String())
-	cev.SetExtension(eventID, createEventID(appProject.ObjectMeta))
-	cev.SetExtension(resourceID, createResourceID(appProject.ObjectMeta))
-	cev.SetDataSchema(targets.AppProject.String())
-	cev.SetSubject(fmt.Sprintf("%s/%s", appProject.Namespace, appProject.Name))
-	// TODO: Handle this error situation?
-	_ = cev.SetData(cloudevents.ApplicationJSON, appProject)
-	return &cev
+	cev, _ := evs.ResourceEvent(evType, targets.AppProject, appProject)
+	return cev
 }
 
 func (evs EventSource) ApplicationSetEvent(evType EventType, appSet *v1alpha1.ApplicationSet) *cloudevents.Event {
-	cev := cloudevents.NewEvent()
-	cev.SetSource(evs.source)
-	cev.SetSpecVersion(cloudEventSpecVersion)
-	cev.SetType(evType.String())
-	cev.SetExtension(eventID, createEventID(appSet.ObjectMeta))
-	cev.SetExtension(resourceID, createResourceID(appSet.ObjectMeta))
-	cev.SetDataSchema(targets.ApplicationSet.String())
-	cev.SetSubject(fmt.Sprintf("%s/%s", appSet.Namespace, appSet.Name))
-	_ = cev.SetData(cloudevents.ApplicationJSON, appSet)
-	return &cev
+	cev, _ := evs.ResourceEvent(evType, targets.ApplicationSet, appSet)
+	return cev
 }
 
 type ClusterCacheInfo struct {
@@ -217,7 +226,9 @@ func (evs EventSource) ClusterCacheInfoUpdateEvent(evType EventType, clusterInfo
 	cev := cloudevents.NewEvent()
 	cev.SetSource(evs.source)
 	cev.SetSpecVersion(cloudEventSpecVersion)
+	cev.SetExtension(correlationID, NewCorrelationID())
 	cev.SetType(evType.String())
+	SetPriority(&cev, PriorityFor(evType))
 	cev.SetExtension(eventID, reqUUID)
 	cev.SetExtension(resourceID, reqUUID)
 	cev.SetDataSchema(targets.ClusterCacheInfoUpdate.String())
@@ -226,29 +237,27 @@ func (evs EventSource) ClusterCacheInfoUpdateEvent(evType EventType, clusterInfo
 }
 
 func (evs EventSource) RepositoryEvent(evType EventType, repository *corev1.Secret) *cloudevents.Event {
-	cev := cloudevents.NewEvent()
-	cev.SetSource(evs.source)
-	cev.SetSpecVersion(cloudEventSpecVersion)
-	cev.SetType(evType.String())
-	cev.SetExtension(eventID, createEventID(repository.ObjectMeta))
-	cev.SetExtension(resourceID, createResourceID(repository.ObjectMeta))
-	cev.SetDataSchema(targets.Repository.String())
-	cev.SetSubject(fmt.Sprintf("%s/%s", repository.Namespace, repository.Name))
-	_ = cev.SetData(cloudevents.ApplicationJSON, repository)
-	return &cev
+	cev, _ := evs.ResourceEvent(evType, targets.Repository, repository)
+	return cev
 }
 
 func (evs EventSource) GPGKeyEvent(evType EventType, cm *corev1.ConfigMap) *cloudevents.Event {
-	cev := cloudevents.NewEvent()
-	cev.SetSource(evs.source)
-	cev.SetSpecVersion(cloudEventSpecVersion)
-	cev.SetType(evType.String())
-	cev.SetExtension(eventID, createEventID(cm.ObjectMeta))
-	cev.SetExtension(resourceID, createResourceID(cm.ObjectMeta))
-	cev.SetDataSchema(targets.GPGKey.String())
-	cev.SetSubject(fmt.Sprintf("%s/%s", cm.Namespace, cm.Name))
-	_ = cev.SetData(cloudevents.ApplicationJSON, cm)
-	return &cev
+	cev, _ := evs.ResourceEvent(evType, targets.GPGKey, cm)
+	return cev
+}
+
+// ArgoCDConfigEvent returns an event carrying the synced keys of an Argo CD
+// configuration ConfigMap
+func (evs EventSource) ArgoCDConfigEvent(evType EventType, cm *corev1.ConfigMap) *cloudevents.Event {
+	cev, _ := evs.ResourceEvent(evType, targets.ArgoCDConfig, cm)
+	return cev
+}
+
+// ArgoCDSecretEvent returns an event carrying the synced keys of an Argo CD
+// Secret
+func (evs EventSource) ArgoCDSecretEvent(evType EventType, secret *corev1.Secret) *cloudevents.Event {
+	cev, _ := evs.ResourceEvent(evType, targets.ArgoCDSecret, secret)
+	return cev
 }
 
 // HeartbeatEvent creates a ping or pong event for keepalive purposes.
@@ -259,6 +268,7 @@ func (evs EventSource) HeartbeatEvent(evType EventType) *cloudevents.Event {
 	cev := cloudevents.NewEvent()
 	cev.SetSource(evs.source)
 	cev.SetSpecVersion(cloudEventSpecVersion)
+	cev.SetExtension(correlationID, NewCorrelationID())
 	cev.SetType(evType.String())
 	cev.SetExtension(eventID, reqUUID)
 	cev.SetExtension(resourceID, reqUUID)
@@ -267,6 +277,22 @@ func (evs EventSource) HeartbeatEvent(evType EventType) *cloudevents.Event {
 	return &cev
 }
 
+// GoAwayEvent creates an event that tells the receiver that the sender is
+// shutting down. The receiver should expect the stream to be closed, and
+// reconnect once it is.
+func (evs EventSource) GoAwayEvent() *cloudevents.Event {
+	reqUUID := uuid.NewString()
+	cev := cloudevents.NewEvent()
+	cev.SetSource(evs.source)
+	cev.SetSpecVersion(cloudEventSpecVersion)
+	cev.SetExtension(correlationID, NewCorrelationID())
+	cev.SetType(GoAway.String())
+	cev.SetExtension(eventID, reqUUID)
+	cev.SetExtension(resourceID, reqUUID)
+	cev.SetDataSchema(targets.Control.String())
+	return &cev
+}
+
 type RedisRequest struct {
 	UUID           string           `json:"uuid"`
 	ConnectionUUID string           `json:"connectionUuid"`
@@ -409,6 +435,7 @@ func (evs EventSource) NewRedisRequestEvent(connectionUUID string, body RedisCom
 	cev := cloudevents.NewEvent()
 	cev.SetSource(evs.source)
 	cev.SetSpecVersion(cloudEventSpecVersion)
+	cev.SetExtension(correlationID, NewCorrelationID())
 	cev.SetType(RedisGenericRequest.String())
 	cev.SetDataSchema(targets.Redis.String())
 	cev.SetExtension(resourceID, reqUUID)
@@ -427,6 +454,7 @@ func (evs EventSource) NewRedisResponseEvent(reqUUID string, connectionUUID stri
 	cev := cloudevents.NewEvent()
 	cev.SetSource(evs.source)
 	cev.SetSpecVersion(cloudEventSpecVersion)
+	cev.SetExtension(correlationID, NewCorrelationID())
 	cev.SetType(RedisGenericResponse.String())
 	cev.SetDataSchema(targets.Redis.String())
 	cev.SetExtension(resourceID, resUUID)
@@ -458,10 +486,16 @@ func (evs EventSource) NewResourceRequestEvent(gvr v1.GroupVersionResource, name
 	cev := cloudevents.NewEvent()
 	cev.SetSource(evs.source)
 	cev.SetSpecVersion(cloudEventSpecVersion)
+	cev.SetExtension(correlationID, NewCorrelationID())
 	cev.SetType(method)
 	cev.SetExtension(resourceID, reqUUID)
 	cev.SetExtension(eventID, reqUUID)
 	cev.SetDataSchema(targets.Resource.String())
+	if name != "" && namespace != "" {
+		cev.SetSubject(fmt.Sprintf("%s/%s", namespace, name))
+	} else if name != "" {
+		cev.SetSubject(name)
+	}
 	err := cev.SetData(cloudevents.ApplicationJSON, rr)
 	return &cev, err
 }
@@ -476,6 +510,7 @@ func (evs EventSource) NewResourceResponseEvent(reqUUID string, status int, data
 	cev := cloudevents.NewEvent()
 	cev.SetSource(evs.source)
 	cev.SetSpecVersion(cloudEventSpecVersion)
+	cev.SetExtension(correlationID, NewCorrelationID())
 	cev.SetType(GetResponse.String())
 	cev.SetDataSchema(targets.Resource.String())
 	cev.SetExtension(resourceID, resUUID)
@@ -491,9 +526,13 @@ func (evs EventSource) ProcessedEvent(evType EventType, ev *Event) *cloudevents.
 	cev.SetSpecVersion(cloudEventSpecVersion)
 	cev.SetType(evType.String())
 
+	// The ACK keeps the correlation ID along with all other extensions
 	for k, v := range ev.event.Extensions() {
 		cev.SetExtension(k, v)
 	}
+	if subject := ev.event.Subject(); subject != "" {
+		cev.SetSubject(subject)
+	}
 
 	cev.SetDataSchema(targets.EventAck.String())
 	return &cev
@@ -517,6 +556,7 @@ func (evs EventSource) RequestSyncedResourceListEvent(checksum []byte) (*cloudev
 	cev := cloudevents.NewEvent()
 	cev.SetSource(evs.source)
 	cev.SetSpecVersion(cloudEventSpecVersion)
+	cev.SetExtension(correlationID, NewCorrelationID())
 	cev.SetType(SyncedResourceList.String())
 	cev.SetDataSchema(targets.ResourceResync.String())
 	cev.SetExtension(resourceID, reqUUID)
@@ -548,6 +588,7 @@ func (evs EventSource) SyncedResourceEvent(resourceKey resources.ResourceKey) (*
 	cev := cloudevents.NewEvent()
 	cev.SetSource(evs.source)
 	cev.SetSpecVersion(cloudEventSpecVersion)
+	cev.SetExtension(correlationID, NewCorrelationID())
 	cev.SetType(ResponseSyncedResource.String())
 	cev.SetDataSchema(targets.ResourceResync.String())
 	cev.SetExtension(resourceID, reqUUID)
@@ -584,6 +625,7 @@ func (evs EventSource) RequestUpdateEvent(reqUpdate *RequestUpdate) (*cloudevent
 	cev := cloudevents.NewEvent()
 	cev.SetSource(evs.source)
 	cev.SetSpecVersion(cloudEventSpecVersion)
+	cev.SetExtension(correlationID, NewCorrelationID())
 	cev.SetType(EventRequestUpdate.String())
 	cev.SetDataSchema(targets.ResourceResync.String())
 	cev.SetExtension(resourceID, reqUUID)
@@ -595,15 +637,28 @@ func (evs EventSource) RequestUpdateEvent(reqUpdate *RequestUpdate) (*cloudevent
 
 // RequestResourceResync is sent by the source to a peer when the source process restarts.
 // It informs the peer that the source process restarted and it might be out of sync with the source.
-type RequestResourceResync struct{}
+type RequestResourceResync struct {
+	// Incremental is set by sources that accept a RequestIncrementalResync
+	// in response, instead of a RequestUpdate for every resource.
+	Incremental bool `json:"incremental,omitempty"`
+}
 
 func (evs EventSource) RequestResourceResyncEvent() (*cloudevents.Event, error) {
-	reqUUID := uuid.NewString()
-	req := &RequestResourceResync{}
+	return evs.resourceResyncEvent(&RequestResourceResync{})
+}
 
+// IncrementalResourceResyncEvent returns a RequestResourceResync that allows
+// the peer to answer with a RequestIncrementalResync.
+func (evs EventSource) IncrementalResourceResyncEvent() (*cloudevents.Event, error) {
+	return evs.resourceResyncEvent(&RequestResourceResync{Incremental: true})
+}
+
+func (evs EventSource) resourceResyncEvent(req *RequestResourceResync) (*cloudevents.Event, error) {
+	reqUUID := uuid.NewString()
 	cev := cloudevents.NewEvent()
 	cev.SetSource(evs.source)
 	cev.SetSpecVersion(cloudEventSpecVersion)
+	cev.SetExtension(correlationID, NewCorrelationID())
 	cev.SetType(EventRequestResourceResync.String())
 	cev.SetDataSchema(targets.ResourceResync.String())
 	cev.SetExtension(resourceID, reqUUID)
@@ -613,6 +668,55 @@ func (evs EventSource) RequestResourceResyncEvent() (*cloudevents.Event, error)
 	return &cev, err
 }
 
+// RequestIncrementalResync is sent by a managed agent in response to an
+// incremental RequestResourceResync. It carries the highest resource version
+// of the principal's Applications the agent has applied, per namespace on the
+// principal, so that the principal only needs to send the changes made after
+// that point.
+type RequestIncrementalResync struct {
+	Watermarks map[string]string `json:"watermarks"`
+}
+
+func (evs EventSource) RequestIncrementalResyncEvent(watermarks map[string]string) (*cloudevents.Event, error) {
+	reqUUID := uuid.NewString()
+	cev := cloudevents.NewEvent()
+	cev.SetSource(evs.source)
+	cev.SetSpecVersion(cloudEventSpecVersion)
+	cev.SetExtension(correlationID, NewCorrelationID())
+	cev.SetType(EventIncrementalResync.String())
+	cev.SetDataSchema(targets.ResourceResync.String())
+	cev.SetExtension(resourceID, reqUUID)
+	cev.SetExtension(eventID, reqUUID)
+
+	err := cev.SetData(cloudevents.ApplicationJSON, &RequestIncrementalResync{Watermarks: watermarks})
+	return &cev, err
+}
+
+// StateDigest is sent periodically by a peer to the source of truth while
+// they are connected. It carries one RequestUpdate per resource the peer
+// holds, so that the source can send updates for the resources whose spec
+// checksums differ, and the resources the peer is missing, in one go.
+// Managed mode: Sent from Agent to Principal
+// Autonomous mode: Sent from Principal to Agent
+type StateDigest struct {
+	Resources []RequestUpdate `json:"resources"`
+}
+
+func (evs EventSource) StateDigestEvent(digest *StateDigest) (*cloudevents.Event, error) {
+	reqUUID := uuid.NewString()
+	cev := cloudevents.NewEvent()
+	cev.SetSource(evs.source)
+	cev.SetSpecVersion(cloudEventSpecVersion)
+	cev.SetExtension(correlationID, NewCorrelationID())
+	cev.SetType(StateDigestExchange.String())
+	cev.SetDataSchema(targets.ResourceResync.String())
+	cev.SetExtension(resourceID, reqUUID)
+	cev.SetExtension(eventID, reqUUID)
+
+	err := cev.SetData(cloudevents.ApplicationJSON, digest)
+	return &cev, err
+}
+
 // FromWire validates an event from the wire in protobuf format, converts it
 // into an Event object and returns it. If the event on the wire is invalid,
 // or could not be converted for another reason, FromWire returns an error.
@@ -639,6 +743,10 @@ func Target(raw *cloudevents.Event) targets.EventTarget {
 		return targets.Repository
 	case targets.GPGKey.String():
 		return targets.GPGKey
+	case targets.ArgoCDConfig.String():
+		return targets.ArgoCDConfig
+	case targets.ArgoCDSecret.String():
+		return targets.ArgoCDSecret
 	case targets.Resource.String():
 		return targets.Resource
 	case targets.EventAck.String():
@@ -657,6 +765,14 @@ func Target(raw *cloudevents.Event) targets.EventTarget {
 		return targets.Terminal
 	case targets.ApplicationSet.String():
 		return targets.ApplicationSet
+	case targets.Control.String():
+		return targets.Control
+	}
+	if _, ok := ResourceTargetGVK(targets.EventTarget(raw.DataSchema())); ok {
+		return targets.EventTarget(raw.DataSchema())
+	}
+	if IsCustomTarget(targets.EventTarget(raw.DataSchema())) {
+		return targets.EventTarget(raw.DataSchema())
 	}
 	return ""
 }
@@ -729,6 +845,18 @@ func (ev Event) GPGKey() (*corev1.ConfigMap, error) {
 	return cm, err
 }
 
+func (ev Event) ArgoCDConfig() (*corev1.ConfigMap, error) {
+	cm := &corev1.ConfigMap{}
+	err := ev.event.DataAs(cm)
+	return cm, err
+}
+
+func (ev Event) ArgoCDSecret() (*corev1.Secret, error) {
+	secret := &corev1.Secret{}
+	err := ev.event.DataAs(secret)
+	return secret, err
+}
+
 // ResourceRequest gets the resource request payload from an event
 func (ev Event) RedisRequest() (*RedisRequest, error) {
 	req := &RedisRequest{}
@@ -768,6 +896,18 @@ func (ev Event) RequestResourceResync() (*RequestResourceResync, error) {
 	return resResync, err
 }
 
+func (ev Event) RequestIncrementalResync() (*RequestIncrementalResync, error) {
+	req := &RequestIncrementalResync{}
+	err := ev.event.DataAs(req)
+	return req, err
+}
+
+func (ev Event) StateDigest() (*StateDigest, error) {
+	digest := &StateDigest{}
+	err := ev.event.DataAs(digest)
+	return digest, err
+}
+
 func (ev Event) RequestUpdate() (*RequestUpdate, error) {
 	reqUpdate := &RequestUpdate{}
 	err := ev.event.DataAs(reqUpdate)
@@ -847,6 +987,7 @@ func (evs EventSource) NewLogRequestEvent(namespace, podName, method string, par
 	cev := cloudevents.NewEvent()
 	cev.SetSource(evs.source)
 	cev.SetSpecVersion(cloudEventSpecVersion)
+	cev.SetExtension(correlationID, NewCorrelationID())
 	cev.SetType(method) // HTTP method
 	cev.SetDataSchema(targets.ContainerLog.String())
 	cev.SetExtension(resourceID, reqUUID)
@@ -879,6 +1020,7 @@ func (evs EventSource) NewTerminalRequestEvent(terminalReq *ContainerTerminalReq
 	cev := cloudevents.NewEvent()
 	cev.SetSource(evs.source)
 	cev.SetSpecVersion(cloudEventSpecVersion)
+	cev.SetExtension(correlationID, NewCorrelationID())
 	cev.SetType(TerminalRequest.String())
 	cev.SetDataSchema(targets.Terminal.String())
 	cev.SetExtension(resourceID, terminalReq.UUID)
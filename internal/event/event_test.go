@@ -15,6 +15,7 @@
 package event
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -530,6 +531,17 @@ func TestSentAt(t *testing.T) {
 	})
 }
 
+func TestRejectionReason(t *testing.T) {
+	es := NewEventSource("test-source")
+	ev := cloudevents.NewEvent()
+	ev.SetDataSchema(targets.Application.String())
+	ack := es.ProcessedEvent(EventProcessed, New(&ev, targets.EventAck))
+	require.Empty(t, RejectionReason(ack))
+
+	SetRejectionReason(ack, "destination not allowed")
+	require.Equal(t, "destination not allowed", RejectionReason(ack))
+}
+
 func TestApplicationSetEventRoundtrip(t *testing.T) {
 	es := NewEventSource("test-source")
 	appSet := &v1alpha1.ApplicationSet{
@@ -617,3 +629,42 @@ func TestPrincipalUID(t *testing.T) {
 		require.Equal(t, "", PrincipalUID(&ev))
 	})
 }
+
+func TestCorrelationID(t *testing.T) {
+	es := NewEventSource("test")
+	app := &v1alpha1.Application{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "argocd", UID: "uid", ResourceVersion: "1"}}
+
+	t.Run("Every emitted event has its own correlation ID", func(t *testing.T) {
+		ev1 := es.ApplicationEvent(SpecUpdate, app)
+		ev2 := es.ApplicationEvent(SpecUpdate, app)
+		require.NotEmpty(t, CorrelationID(ev1))
+		require.NotEqual(t, CorrelationID(ev1), CorrelationID(ev2))
+		require.Equal(t, EventID(ev1), EventID(ev2))
+	})
+
+	t.Run("Correlation ID is kept on the wire and by the ACK", func(t *testing.T) {
+		ev := es.ApplicationEvent(SpecUpdate, app)
+		pev, err := toWire(ev, false, nil, nil, nil)
+		require.NoError(t, err)
+		received, err := FromWire(pev)
+		require.NoError(t, err)
+		require.Equal(t, CorrelationID(ev), received.CorrelationID())
+
+		ack := es.ProcessedEvent(EventProcessed, received)
+		require.Equal(t, CorrelationID(ev), CorrelationID(ack))
+	})
+
+	t.Run("Empty correlation IDs are not set", func(t *testing.T) {
+		ev := cloudevents.NewEvent()
+		SetCorrelationID(&ev, "")
+		require.Empty(t, CorrelationID(&ev))
+		require.NotContains(t, ev.Extensions(), correlationID)
+	})
+
+	t.Run("Correlation ID is carried by the context", func(t *testing.T) {
+		ctx := ContextWithCorrelationID(context.Background(), "abc")
+		require.Equal(t, "abc", CorrelationIDFromContext(ctx))
+		require.Empty(t, CorrelationIDFromContext(context.Background()))
+		require.Equal(t, context.Background(), ContextWithCorrelationID(context.Background(), ""))
+	})
+}
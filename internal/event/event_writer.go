@@ -4,6 +4,7 @@ import (
 	"context"
 	"math"
 	"math/rand/v2"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -13,6 +14,7 @@ import (
 	"github.com/argoproj-labs/argocd-agent/internal/logging/logfields"
 	"github.com/argoproj-labs/argocd-agent/pkg/api/grpc/eventstreamapi"
 	format "github.com/cloudevents/sdk-go/binding/format/protobuf/v2"
+	"github.com/cloudevents/sdk-go/binding/format/protobuf/v2/pb"
 	cloudevents "github.com/cloudevents/sdk-go/v2"
 	"github.com/sirupsen/logrus"
 	"k8s.io/apimachinery/pkg/util/wait"
@@ -46,12 +48,48 @@ type EventWriter struct {
 	// target refers to the specified gRPC stream.
 	target streamWriter
 
+	// laneTargets holds the streams of lanes that have one of their own. The
+	// events of all other lanes are sent on target.
+	// - acquire 'lock' before accessing
+	laneTargets map[Lane]streamWriter
+
 	// agentName is the name of the agent for which this EventWriter is responsible.
 	agentName string
 
 	// onDiscard is called when an event is discarded after exhausting retries.
 	onDiscard func(eventType, resourceType string)
 
+	// batchSize is the maximum number of events sent in a single message.
+	// - acquire 'lock' before accessing
+	batchSize int
+
+	// batchWindow is how long updates to a resource are held back, so that
+	// rapid successive updates are coalesced into one event
+	// - acquire 'lock' before accessing
+	batchWindow time.Duration
+
+	// wireFormat is the format events are sent in
+	// - acquire 'lock' before accessing
+	wireFormat WireFormat
+
+	// deltaEncoding is whether Application events are sent as deltas against
+	// the last version the receiver acknowledged
+	// - acquire 'lock' before accessing
+	deltaEncoding bool
+
+	// key: resource name + UID
+	// value: last acknowledged version of the resource
+	// - acquire 'lock' before accessing
+	deltaBases map[string]*deltaState
+
+	// payload encrypts the data of the events sent, if not nil
+	// - acquire 'lock' before accessing
+	payload *PayloadCipher
+
+	// transfer offloads the data of large events, if not nil
+	// - acquire 'lock' before accessing
+	transfer *PayloadTransfer
+
 	log *logrus.Entry
 
 	// baseLog is log Entry but without target field; baseLog is used to regenerate the 'log' field when the target changes via 'UpdateTarget'
@@ -70,6 +108,9 @@ type eventMessage struct {
 	// retry sending the event after this time
 	retryAfter *time.Time
 
+	// do not send the event for the first time before this time
+	notBefore time.Time
+
 	// config for exponential backoff
 	backoff *wait.Backoff
 
@@ -85,6 +126,8 @@ func NewEventWriter(agentName string, target streamWriter, baseLog *logrus.Entry
 		unsentEvents: map[string]*eventQueue{},
 		sentEvents:   map[string]*eventMessage{},
 		target:       target,
+		laneTargets:  map[Lane]streamWriter{},
+		deltaBases:   map[string]*deltaState{},
 		agentName:    agentName,
 		baseLog:      baseLog,
 		log:          baseLog.WithField(logfields.ClientAddr, grpcutil.AddressFromContext(target.Context())).WithField(logfields.Agent, agentName),
@@ -110,6 +153,118 @@ func (ew *EventWriter) UpdateTarget(target streamWriter) {
 	}
 }
 
+// SetLaneTarget configures the events of lane to be sent on target instead of
+// the primary target. The lane's events are only sent by a loop started with
+// SendWaitingLaneEvents.
+func (ew *EventWriter) SetLaneTarget(lane Lane, target streamWriter) {
+	ew.mu.Lock()
+	defer ew.mu.Unlock()
+	ew.laneTargets[lane] = target
+	ew.resetRetries(lane)
+}
+
+// RemoveLaneTarget configures the events of lane to be sent on the primary
+// target again, unless the lane's target has been replaced by another one
+// in the meantime.
+func (ew *EventWriter) RemoveLaneTarget(lane Lane, target streamWriter) {
+	ew.mu.Lock()
+	defer ew.mu.Unlock()
+	if ew.laneTargets[lane] != target {
+		return
+	}
+	delete(ew.laneTargets, lane)
+	ew.resetRetries(lane)
+}
+
+// resetRetries makes the sent events of lane to be retried immediately, as
+// their ACKs will never arrive if the lane's stream has gone away. The
+// caller must own ew.mu.
+func (ew *EventWriter) resetRetries(lane Lane) {
+	now := time.Now()
+	for _, msg := range ew.sentEvents {
+		msg.mu.Lock()
+		if LaneOf(msg.event) == lane {
+			msg.retryAfter = &now
+		}
+		msg.mu.Unlock()
+	}
+}
+
+// laneOf returns the lane whose loop sends ev. Events of lanes without a
+// target of their own are sent in the LaneControl loop. The caller must own
+// ew.mu.
+func (ew *EventWriter) laneOf(ev *cloudevents.Event) Lane {
+	lane := LaneOf(ev)
+	if _, ok := ew.laneTargets[lane]; ok {
+		return lane
+	}
+	return LaneControl
+}
+
+// targetOf returns the target of lane. The caller must own ew.mu.
+func (ew *EventWriter) targetOf(lane Lane) streamWriter {
+	if lane == LaneControl {
+		return ew.target
+	}
+	return ew.laneTargets[lane]
+}
+
+// SetBatchSize configures the EventWriter to send up to size of the events
+// waiting to be sent in a single message. The receiver must be able to unpack
+// batches. A size of 1 or less sends every event in a message of its own.
+func (ew *EventWriter) SetBatchSize(size int) {
+	ew.mu.Lock()
+	defer ew.mu.Unlock()
+	ew.batchSize = min(size, MaxBatchSize)
+}
+
+// SetBatchWindow configures the EventWriter to hold back spec and status
+// updates to a resource for window after the first one, so that successive
+// updates within the window are sent as a single event. A window of 0 sends
+// updates as soon as possible.
+func (ew *EventWriter) SetBatchWindow(window time.Duration) {
+	ew.mu.Lock()
+	defer ew.mu.Unlock()
+	ew.batchWindow = max(window, 0)
+}
+
+// SetWireFormat configures the format the EventWriter sends events in. The
+// receiver must have announced that it understands the format.
+func (ew *EventWriter) SetWireFormat(format WireFormat) {
+	ew.mu.Lock()
+	defer ew.mu.Unlock()
+	ew.wireFormat = format
+}
+
+// SetDeltaEncoding configures the EventWriter to send Application events as
+// deltas against the last version the receiver acknowledged. The receiver
+// must have announced that it can resolve deltas.
+func (ew *EventWriter) SetDeltaEncoding(enabled bool) {
+	ew.mu.Lock()
+	defer ew.mu.Unlock()
+	ew.deltaEncoding = enabled
+	if !enabled {
+		ew.deltaBases = map[string]*deltaState{}
+	}
+}
+
+// SetPayloadCipher configures the EventWriter to encrypt the data of the
+// events it sends with c. A nil cipher sends the data in plain.
+func (ew *EventWriter) SetPayloadCipher(c *PayloadCipher) {
+	ew.mu.Lock()
+	defer ew.mu.Unlock()
+	ew.payload = c
+}
+
+// SetPayloadTransfer configures the EventWriter to offload the data of large
+// events with t. The receiver must have announced that it can resolve
+// offloaded payloads. A nil transfer sends all data inline.
+func (ew *EventWriter) SetPayloadTransfer(t *PayloadTransfer) {
+	ew.mu.Lock()
+	defer ew.mu.Unlock()
+	ew.transfer = t
+}
+
 func (ew *EventWriter) SetOnDiscard(fn func(eventType, resourceType string)) {
 	ew.mu.Lock()
 	defer ew.mu.Unlock()
@@ -122,9 +277,10 @@ func (ew *EventWriter) Add(ev *cloudevents.Event) {
 	defer ew.mu.Unlock()
 
 	logCtx := ew.log.WithFields(logrus.Fields{
-		"resource_id": ResourceID(ev),
-		"event_id":    EventID(ev),
-		"type":        ev.Type(),
+		"resource_id":    ResourceID(ev),
+		"event_id":       EventID(ev),
+		"correlation_id": CorrelationID(ev),
+		"type":           ev.Type(),
 	})
 
 	defaultBackoff := wait.Backoff{
@@ -143,6 +299,7 @@ func (ew *EventWriter) Add(ev *cloudevents.Event) {
 	// Once an app is being deleted, no other updates matter
 	if ev.Type() == Delete.String() {
 		delete(ew.sentEvents, resID)
+		delete(ew.deltaBases, resID)
 		// Clear any existing unsent events and add only the DELETE event
 		eq := newEventQueue()
 		eq.add(&eventMessage{
@@ -154,13 +311,19 @@ func (ew *EventWriter) Add(ev *cloudevents.Event) {
 		return
 	}
 
+	var notBefore time.Time
+	if ew.batchWindow > 0 && coalescable(ev) {
+		notBefore = time.Now().Add(ew.batchWindow)
+	}
+
 	// Add to unsent queue with coalescing logic
 	eq, exists := ew.unsentEvents[resID]
 	if !exists {
 		eq = newEventQueue()
 		eq.add(&eventMessage{
-			event:   ev,
-			backoff: &defaultBackoff,
+			event:     ev,
+			backoff:   &defaultBackoff,
+			notBefore: notBefore,
 		})
 		ew.unsentEvents[resID] = eq
 		logCtx.Trace("added a new event to the event writer")
@@ -172,6 +335,7 @@ func (ew *EventWriter) Add(ev *cloudevents.Event) {
 		event:      ev,
 		backoff:    &defaultBackoff,
 		retryAfter: nil,
+		notBefore:  notBefore,
 	})
 
 	logCtx.Trace("updated an existing event in the event writer")
@@ -201,10 +365,28 @@ func (ew *EventWriter) Remove(ev *cloudevents.Event) {
 	resourceID := ResourceID(ev)
 	incomingEventID := EventID(ev)
 
+	// The receiver could not resolve the delta, so the full object is resent
+	if IsDeltaRejection(ev) {
+		delete(ew.deltaBases, resourceID)
+		if sent, exists := ew.sentEvents[resourceID]; exists {
+			sent.mu.Lock()
+			if EventID(sent.event) == incomingEventID {
+				now := time.Now()
+				sent.retryAfter = &now
+			}
+			sent.mu.Unlock()
+		}
+		return
+	}
+
 	// First, check and remove from sent events
 	if sent, exists := ew.sentEvents[resourceID]; exists {
 		sent.mu.RLock()
 		sentEventID := EventID(sent.event)
+		if sentEventID == incomingEventID && ew.deltaEncoding && deltaCandidate(sent.event) {
+			data := sent.event.Data()
+			ew.deltaBases[resourceID] = &deltaState{digest: dataDigest(data), data: data}
+		}
 		sent.mu.RUnlock()
 
 		if sentEventID == incomingEventID {
@@ -236,13 +418,80 @@ func (ew *EventWriter) Remove(ev *cloudevents.Event) {
 	}
 }
 
+// Undelivered returns the events that have either not been sent yet, or have
+// been sent but not been acknowledged, ordered by resource. Fire-and-forget
+// events are not included, since they are never acknowledged.
+func (ew *EventWriter) Undelivered() []*cloudevents.Event {
+	ew.mu.RLock()
+	defer ew.mu.RUnlock()
+	resIDs := make([]string, 0, len(ew.sentEvents)+len(ew.unsentEvents))
+	for resID := range ew.sentEvents {
+		resIDs = append(resIDs, resID)
+	}
+	for resID := range ew.unsentEvents {
+		if _, ok := ew.sentEvents[resID]; !ok {
+			resIDs = append(resIDs, resID)
+		}
+	}
+	sort.Strings(resIDs)
+
+	var events []*cloudevents.Event
+	add := func(msg *eventMessage) {
+		msg.mu.RLock()
+		defer msg.mu.RUnlock()
+		if !FireAndForget(msg.event) {
+			events = append(events, msg.event)
+		}
+	}
+	for _, resID := range resIDs {
+		if sent, ok := ew.sentEvents[resID]; ok {
+			add(sent)
+		}
+		if eq, ok := ew.unsentEvents[resID]; ok {
+			eq.mu.RLock()
+			for _, msg := range eq.items {
+				add(msg)
+			}
+			eq.mu.RUnlock()
+		}
+	}
+	return events
+}
+
 // SendWaitingEvents will periodically send the events waiting in the EventWriter.
+// Pending returns the number of events that have either not been sent yet, or
+// have been sent but not been acknowledged.
+func (ew *EventWriter) Pending() int {
+	ew.mu.RLock()
+	defer ew.mu.RUnlock()
+	n := len(ew.sentEvents)
+	for _, eq := range ew.unsentEvents {
+		eq.mu.RLock()
+		n += len(eq.items)
+		eq.mu.RUnlock()
+	}
+	return n
+}
+
 // Note: This function will never return unless the context is done, and therefore
 // should be started in a separate goroutine.
 func (ew *EventWriter) SendWaitingEvents(ctx context.Context) {
+	ew.sendWaitingEvents(ctx, LaneControl)
+}
+
+// SendWaitingLaneEvents is like SendWaitingEvents, but only sends the events
+// of a lane that has been given a target of its own using SetLaneTarget.
+func (ew *EventWriter) SendWaitingLaneEvents(ctx context.Context, lane Lane) {
+	ew.sendWaitingEvents(ctx, lane)
+}
+
+func (ew *EventWriter) sendWaitingEvents(ctx context.Context, lane Lane) {
 	ew.mu.RLock()
 	logCtx := ew.log
 	ew.mu.RUnlock()
+	if lane != LaneControl {
+		logCtx = logCtx.WithField("lane", lane)
+	}
 
 	logCtx.Info("Starting event writer")
 	for {
@@ -263,6 +512,7 @@ func (ew *EventWriter) SendWaitingEvents(ctx context.Context) {
 					resourceIDs = append(resourceIDs, resID)
 				}
 			}
+			batch := &frameBatch{size: ew.batchSize, format: ew.wireFormat}
 			ew.mu.RUnlock()
 
 			// Shuffle so no resource is systematically starved
@@ -271,29 +521,35 @@ func (ew *EventWriter) SendWaitingEvents(ctx context.Context) {
 			})
 
 			for _, resourceID := range resourceIDs {
-				ew.sendEvent(resourceID)
+				ew.sendEvent(resourceID, lane, batch)
+			}
+			// Events that were not sent will be retried
+			if err := batch.flush(); err != nil {
+				logCtx.Errorf("Error while sending: %v\n", err)
 			}
 		}
 		time.Sleep(100 * time.Millisecond)
 	}
 }
 
-// sendEvent determines whether to retry a sent event or send a new unsent event
-func (ew *EventWriter) sendEvent(resID string) {
+// sendEvent determines whether to retry a sent event or send a new unsent
+// event. Events not belonging to lane are skipped. The event is added to
+// batch, unless batch is nil.
+func (ew *EventWriter) sendEvent(resID string, lane Lane, batch *frameBatch) {
 	// Check if there's a sent event awaiting retry
 	ew.mu.RLock()
 	sentMsg, hasSent := ew.sentEvents[resID]
 	ew.mu.RUnlock()
 
 	if hasSent {
-		ew.retrySentEvent(resID, sentMsg)
+		ew.retrySentEvent(resID, sentMsg, lane, batch)
 	} else {
-		ew.sendUnsentEvent(resID)
+		ew.sendUnsentEvent(resID, lane, batch)
 	}
 }
 
 // retrySentEvent handles retrying an event that was already sent but not yet acknowledged
-func (ew *EventWriter) retrySentEvent(resID string, sentMsg *eventMessage) {
+func (ew *EventWriter) retrySentEvent(resID string, sentMsg *eventMessage, lane Lane, batch *frameBatch) {
 	ew.mu.RLock()
 	logCtx := ew.log.WithFields(logrus.Fields{
 		"method":      "retrySentEvent",
@@ -302,12 +558,16 @@ func (ew *EventWriter) retrySentEvent(resID string, sentMsg *eventMessage) {
 
 	// Re-verify the event is still in sentEvents
 	currentSent, stillExists := ew.sentEvents[resID]
+	sentMsg.mu.RLock()
+	inLane := ew.laneOf(sentMsg.event) == lane
+	sentMsg.mu.RUnlock()
 	// Create thread local copy of target under lock to avoid a data race with UpdateTarget.
-	target := ew.target
+	target := ew.targetOf(lane)
+	delta, base, payload, transfer := ew.deltaEncoding, ew.deltaBases[resID], ew.payload, ew.transfer
 	ew.mu.RUnlock()
 
 	// If event was ACK'd between check and use, skip retry
-	if !stillExists || currentSent != sentMsg {
+	if !stillExists || currentSent != sentMsg || !inLane {
 		return
 	}
 
@@ -320,10 +580,11 @@ func (ew *EventWriter) retrySentEvent(resID string, sentMsg *eventMessage) {
 	}
 
 	logCtx = logCtx.WithFields(logrus.Fields{
-		"event_id":     EventID(sentMsg.event),
-		"event_target": sentMsg.event.DataSchema(),
-		"event_type":   sentMsg.event.Type(),
-		"retry_count":  sentMsg.retryCount,
+		"event_id":       EventID(sentMsg.event),
+		"correlation_id": CorrelationID(sentMsg.event),
+		"event_target":   sentMsg.event.DataSchema(),
+		"event_type":     sentMsg.event.Type(),
+		"retry_count":    sentMsg.retryCount,
 	})
 
 	// Check if we've exhausted retries
@@ -355,14 +616,14 @@ func (ew *EventWriter) retrySentEvent(resID string, sentMsg *eventMessage) {
 	sentMsg.retryAfter = &retryAfter
 
 	// Resend the event
-	pev, err := format.ToProto(sentMsg.event)
+	pev, err := toWire(sentMsg.event, delta, base, payload, transfer)
 	if err != nil {
 		logCtx.Errorf("Could not wire event: %v\n", err)
 		sentMsg.mu.Unlock()
 		return
 	}
 
-	err = target.Send(&eventstreamapi.Event{Event: pev})
+	err = batch.send(target, pev)
 	sentMsg.mu.Unlock()
 
 	if err != nil {
@@ -382,7 +643,7 @@ func (ew *EventWriter) scheduleRetry(eventMsg *eventMessage) {
 }
 
 // sendUnsentEvent pops an event from the unsent queue and sends it for the first time
-func (ew *EventWriter) sendUnsentEvent(resID string) {
+func (ew *EventWriter) sendUnsentEvent(resID string, lane Lane, batch *frameBatch) {
 	ew.mu.Lock()
 	logCtx := ew.log.WithFields(logrus.Fields{
 		"method":      "sendUnsentEvent",
@@ -396,6 +657,17 @@ func (ew *EventWriter) sendUnsentEvent(resID string) {
 		return
 	}
 
+	// Events are sent in order per resource, so the resource has to wait
+	// until its next event's lane gets to send it.
+	if next := eq.peek(); next == nil || ew.laneOf(next.event) != lane {
+		ew.mu.Unlock()
+		return
+	} else if next.notBefore.After(time.Now()) {
+		// Wait for more updates to coalesce within the batch window
+		ew.mu.Unlock()
+		return
+	}
+
 	eventMsg := eq.pop()
 	if eq.isEmpty() {
 		delete(ew.unsentEvents, resID)
@@ -406,8 +678,7 @@ func (ew *EventWriter) sendUnsentEvent(resID string) {
 		return
 	}
 
-	target := Target(eventMsg.event)
-	isFireAndForget := target == targets.EventAck || target == targets.Heartbeat
+	isFireAndForget := FireAndForget(eventMsg.event)
 	if !isFireAndForget {
 		// IMPORTANT: Set retryAfter *before* publishing into sentEvents.
 		// We can have concurrent SendWaitingEvents loops (e.g. brief overlap during reconnect),
@@ -421,22 +692,24 @@ func (ew *EventWriter) sendUnsentEvent(resID string) {
 		ew.sentEvents[resID] = eventMsg
 	}
 	// Create thread local copy of target under lock to avoid a data race with UpdateTarget.
-	sendTarget := ew.target
+	sendTarget := ew.targetOf(lane)
+	delta, base, payload, transfer := ew.deltaEncoding, ew.deltaBases[resID], ew.payload, ew.transfer
 	ew.mu.Unlock()
 
 	// Send the event
 	eventMsg.mu.Lock()
 	logCtx = logCtx.WithFields(logrus.Fields{
-		"event_id":     EventID(eventMsg.event),
-		"event_target": eventMsg.event.DataSchema(),
-		"event_type":   eventMsg.event.Type(),
+		"event_id":       EventID(eventMsg.event),
+		"correlation_id": CorrelationID(eventMsg.event),
+		"event_target":   eventMsg.event.DataSchema(),
+		"event_type":     eventMsg.event.Type(),
 	})
 
 	if !isFireAndForget {
 		SetSentAt(eventMsg.event)
 	}
 
-	pev, err := format.ToProto(eventMsg.event)
+	pev, err := toWire(eventMsg.event, delta, base, payload, transfer)
 	eventMsg.mu.Unlock()
 
 	if err != nil {
@@ -445,7 +718,7 @@ func (ew *EventWriter) sendUnsentEvent(resID string) {
 	}
 
 	// A Send() on the stream is actually not blocking.
-	err = sendTarget.Send(&eventstreamapi.Event{Event: pev})
+	err = batch.send(sendTarget, pev)
 	if err != nil {
 		logCtx.Errorf("Error while sending: %v\n", err)
 		return
@@ -458,6 +731,35 @@ func (ew *EventWriter) sendUnsentEvent(resID string) {
 	}
 }
 
+// toWire converts ev into its protobuf representation. If delta is true,
+// Application events are encoded as deltas against base. If payload is not
+// nil, the data is encrypted with it. If transfer is not nil, large data is
+// offloaded with it.
+func toWire(ev *cloudevents.Event, delta bool, base *deltaState, payload *PayloadCipher, transfer *PayloadTransfer) (*pb.CloudEvent, error) {
+	if delta && deltaCandidate(ev) {
+		ev = encodeDelta(ev, base)
+	}
+	var err error
+	if payload != nil {
+		if ev, err = payload.Encrypt(ev); err != nil {
+			return nil, err
+		}
+	}
+	if transfer != nil {
+		if ev, err = transfer.Offload(ev); err != nil {
+			return nil, err
+		}
+	}
+	return format.ToProto(ev)
+}
+
+// FireAndForget returns whether ev is sent without waiting for it to be
+// acknowledged.
+func FireAndForget(ev *cloudevents.Event) bool {
+	target := Target(ev)
+	return target == targets.EventAck || target == targets.Heartbeat || target == targets.Control
+}
+
 // eventWritersMap provides a thread-safe way to manage event writers.
 type EventWritersMap struct {
 	mu sync.RWMutex
@@ -518,6 +820,17 @@ func (eq *eventQueue) add(ev *eventMessage) {
 	eq.mu.Lock()
 	defer eq.mu.Unlock()
 
+	// An update coalesced into a waiting one is held back no longer than the
+	// waiting one, so that updates in rapid succession are not held forever.
+	for i := len(eq.items) - 1; i >= 0; i-- {
+		if item := eq.items[i]; item.event.Type() == ev.event.Type() && coalescable(ev.event) {
+			if !ev.notBefore.IsZero() && item.notBefore.Before(ev.notBefore) {
+				ev.notBefore = item.notBefore
+			}
+			break
+		}
+	}
+
 	eq.items = append(eq.items, ev)
 
 	deduplicateEventMessageItems(&eq.items)
@@ -541,7 +854,7 @@ func deduplicateEventMessageItems(items *[]*eventMessage) {
 		myType := item.event.Type()
 
 		// No de-duplication of events we can't guarantee are safe to de-duplicate
-		if myType != StatusUpdate.String() && myType != SpecUpdate.String() {
+		if !coalescable(item.event) {
 			continue
 		}
 
@@ -557,6 +870,12 @@ func deduplicateEventMessageItems(items *[]*eventMessage) {
 
 }
 
+// coalescable returns whether ev may replace a waiting event of the same type
+// for the same resource.
+func coalescable(ev *cloudevents.Event) bool {
+	return ev.Type() == StatusUpdate.String() || ev.Type() == SpecUpdate.String()
+}
+
 // peek the first item from the queue.
 func (eq *eventQueue) peek() *eventMessage {
 	eq.mu.RLock()
@@ -133,7 +133,7 @@ func TestEventWriter(t *testing.T) {
 		evSender.Add(ev)
 
 		// shouldn't send an event that is not being tracked
-		evSender.sendEvent("random-id")
+		evSender.sendEvent("random-id", LaneControl, nil)
 		require.Len(t, fs.events, 0)
 
 		// shouldn't send an event that isn't past the retryAfter time.
@@ -142,13 +142,13 @@ func TestEventWriter(t *testing.T) {
 		retryAfter := time.Now().Add(1 * time.Hour)
 		latestEvent.retryAfter = &retryAfter
 
-		evSender.retrySentEvent(resID, latestEvent)
+		evSender.retrySentEvent(resID, latestEvent, LaneControl, nil)
 		require.Len(t, fs.events, 0)
 
 		// should send a valid event to the stream
 		retryAfter = time.Now().Add(-10 * time.Second)
 		latestEvent.retryAfter = &retryAfter
-		evSender.sendEvent(resID)
+		evSender.sendEvent(resID, LaneControl, nil)
 		require.Len(t, fs.events, 1)
 		require.Equal(t, []string{createEventID(app1.ObjectMeta)}, fs.events[resID])
 	})
@@ -252,7 +252,7 @@ func TestEventWriter(t *testing.T) {
 		require.NotContains(t, evSender.sentEvents, resID)
 
 		// Send the event
-		evSender.sendEvent(resID)
+		evSender.sendEvent(resID, LaneControl, nil)
 
 		// Event should now be in sent map and removed from unsent
 		require.NotContains(t, evSender.unsentEvents, resID)
@@ -268,7 +268,7 @@ func TestEventWriter(t *testing.T) {
 		evSender.Add(ev)
 
 		// Send the event once
-		evSender.sendEvent(resID)
+		evSender.sendEvent(resID, LaneControl, nil)
 		require.Len(t, fs.events[resID], 1)
 
 		// Get the sent event
@@ -278,7 +278,7 @@ func TestEventWriter(t *testing.T) {
 		require.Equal(t, 0, sentMsg.retryCount)
 
 		// Try to retry immediately - should not send
-		evSender.retrySentEvent(resID, sentMsg)
+		evSender.retrySentEvent(resID, sentMsg, LaneControl, nil)
 		require.Len(t, fs.events[resID], 1)
 
 		// Set retryAfter to past time
@@ -286,7 +286,7 @@ func TestEventWriter(t *testing.T) {
 		sentMsg.retryAfter = &pastTime
 
 		// Now retry should work
-		evSender.retrySentEvent(resID, sentMsg)
+		evSender.retrySentEvent(resID, sentMsg, LaneControl, nil)
 		require.Len(t, fs.events[resID], 2)
 		require.Equal(t, 1, sentMsg.retryCount)
 	})
@@ -307,7 +307,7 @@ func TestEventWriter(t *testing.T) {
 		resID := "test-resource"
 
 		// Send the ACK event
-		evSender.sendEvent(resID)
+		evSender.sendEvent(resID, LaneControl, nil)
 
 		// ACK should not be in sentEvents (doesn't need ACK confirmation)
 		require.NotContains(t, evSender.sentEvents, resID)
@@ -325,7 +325,7 @@ func TestEventWriter(t *testing.T) {
 		evSender.Add(heartbeatEv)
 
 		// Send the heartbeat event
-		evSender.sendEvent(resID)
+		evSender.sendEvent(resID, LaneControl, nil)
 
 		// Heartbeat should not be in sentEvents (fire-and-forget, no ACK tracking)
 		require.NotContains(t, evSender.sentEvents, resID)
@@ -342,13 +342,29 @@ func TestEventWriter(t *testing.T) {
 			heartbeatEv := es.HeartbeatEvent(Ping)
 			resID := ResourceID(heartbeatEv)
 			evSender.Add(heartbeatEv)
-			evSender.sendEvent(resID)
+			evSender.sendEvent(resID, LaneControl, nil)
 		}
 
 		// sentEvents should be empty - no heartbeats should accumulate
 		require.Empty(t, evSender.sentEvents, "Heartbeat events should not accumulate in sentEvents")
 	})
 
+	t.Run("should not send go away events to sentEvents (fire-and-forget)", func(t *testing.T) {
+		fs := &fakeStream{}
+		evSender := NewEventWriter("test", fs, eventWriterLogger)
+
+		goAwayEv := es.GoAwayEvent()
+		resID := ResourceID(goAwayEv)
+		evSender.Add(goAwayEv)
+		require.Equal(t, 1, evSender.Pending())
+
+		evSender.sendEvent(resID, LaneControl, nil)
+
+		require.NotContains(t, evSender.sentEvents, resID)
+		require.Len(t, fs.events[resID], 1)
+		require.Equal(t, 0, evSender.Pending())
+	})
+
 	t.Run("should handle empty resource ID gracefully", func(t *testing.T) {
 		fs := &fakeStream{}
 		evSender := NewEventWriter("test", fs, eventWriterLogger)
@@ -387,7 +403,7 @@ func TestEventWriter(t *testing.T) {
 		evSender.Add(ev)
 
 		// Send the event (moves to sentEvents)
-		evSender.sendEvent(resID)
+		evSender.sendEvent(resID, LaneControl, nil)
 
 		// Verify the sent event has version 1
 		sentEventID := EventID(ev)
@@ -456,6 +472,107 @@ func TestEventWriter(t *testing.T) {
 		eventID := EventID(latestEvent.event)
 		require.Contains(t, eventID, "_5") // Should be version 5
 	})
+
+	t.Run("should send events on the stream of their lane", func(t *testing.T) {
+		primary := &fakeStream{}
+		status := &fakeStream{}
+		evSender := NewEventWriter("test", primary, eventWriterLogger)
+		evSender.SetLaneTarget(LaneStatus, status)
+
+		app1.ResourceVersion = "1"
+		statusEv := es.ApplicationEvent(StatusUpdate, app1)
+		app2.ResourceVersion = "1"
+		specEv := es.ApplicationEvent(SpecUpdate, app2)
+		evSender.Add(statusEv)
+		evSender.Add(specEv)
+
+		// The loop of the primary stream does not send status events
+		evSender.sendEvent(ResourceID(statusEv), LaneControl, nil)
+		evSender.sendEvent(ResourceID(specEv), LaneControl, nil)
+		require.Empty(t, primary.events[ResourceID(statusEv)])
+		require.Equal(t, []string{EventID(specEv)}, primary.events[ResourceID(specEv)])
+
+		evSender.sendEvent(ResourceID(statusEv), LaneStatus, nil)
+		require.Equal(t, []string{EventID(statusEv)}, status.events[ResourceID(statusEv)])
+
+		// Once the lane's stream is gone, its events are retried on the
+		// primary stream.
+		evSender.RemoveLaneTarget(LaneStatus, &fakeStream{})
+		evSender.sendEvent(ResourceID(statusEv), LaneControl, nil)
+		require.Empty(t, primary.events[ResourceID(statusEv)])
+		evSender.RemoveLaneTarget(LaneStatus, status)
+		evSender.sendEvent(ResourceID(statusEv), LaneStatus, nil)
+		evSender.sendEvent(ResourceID(statusEv), LaneControl, nil)
+		require.Equal(t, []string{EventID(statusEv)}, primary.events[ResourceID(statusEv)])
+		require.Len(t, status.events[ResourceID(statusEv)], 1)
+	})
+
+	t.Run("should return sent and unsent events as undelivered", func(t *testing.T) {
+		fs := &fakeStream{}
+		evSender := NewEventWriter("test", fs, eventWriterLogger)
+
+		createEv := es.ApplicationEvent(Create, app1)
+		evSender.Add(createEv)
+		evSender.sendEvent(ResourceID(createEv), LaneControl, nil)
+		require.Contains(t, evSender.sentEvents, ResourceID(createEv))
+
+		app1.ResourceVersion = "10"
+		specEv := es.ApplicationEvent(SpecUpdate, app1)
+		evSender.Add(specEv)
+		evSender.Add(es.GoAwayEvent())
+
+		require.Equal(t, []*cloudevents.Event{createEv, specEv}, evSender.Undelivered())
+
+		evSender.Remove(createEv)
+		require.Equal(t, []*cloudevents.Event{specEv}, evSender.Undelivered())
+	})
+
+	t.Run("should coalesce updates within the batch window", func(t *testing.T) {
+		fs := &fakeStream{}
+		evSender := NewEventWriter("test", fs, eventWriterLogger)
+		evSender.SetBatchWindow(time.Hour)
+		app := app1.DeepCopy()
+		app.UID = "batch-window"
+
+		// Creations are not held back
+		createEv := es.ApplicationEvent(Create, app)
+		resID := ResourceID(createEv)
+		evSender.Add(createEv)
+		evSender.sendEvent(resID, LaneControl, nil)
+		require.Equal(t, []string{EventID(createEv)}, fs.events[resID])
+		evSender.Remove(createEv)
+
+		var last *cloudevents.Event
+		for rv := 20; rv < 25; rv++ {
+			app.ResourceVersion = fmt.Sprintf("%d", rv)
+			last = es.ApplicationEvent(SpecUpdate, app)
+			evSender.Add(last)
+			evSender.sendEvent(resID, LaneControl, nil)
+		}
+		require.Len(t, fs.events[resID], 1)
+		require.Len(t, evSender.unsentEvents[resID].items, 1)
+
+		// The window of the first update has passed
+		evSender.unsentEvents[resID].items[0].notBefore = time.Now()
+		evSender.sendEvent(resID, LaneControl, nil)
+		require.Equal(t, []string{EventID(createEv), EventID(last)}, fs.events[resID])
+	})
+}
+
+func TestLaneOf(t *testing.T) {
+	es := NewEventSource("test")
+	app := &v1alpha1.Application{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "test", UID: "1234"}}
+	require.Equal(t, LaneSpec, LaneOf(es.ApplicationEvent(Create, app)))
+	require.Equal(t, LaneSpec, LaneOf(es.ApplicationEvent(SpecUpdate, app)))
+	require.Equal(t, LaneSpec, LaneOf(es.ApplicationEvent(Delete, app)))
+	require.Equal(t, LaneStatus, LaneOf(es.ApplicationEvent(StatusUpdate, app)))
+	require.Equal(t, LaneControl, LaneOf(es.HeartbeatEvent(Ping)))
+
+	lane, err := ParseLane("status")
+	require.NoError(t, err)
+	require.Equal(t, LaneStatus, lane)
+	_, err = ParseLane("control")
+	require.Error(t, err)
 }
 
 func TestDeduplicateEventMessageItems(t *testing.T) {
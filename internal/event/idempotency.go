@@ -0,0 +1,99 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+// Events that change resources carry an idempotency key, which is derived
+// from the type, target, resource and event IDs, and correlation ID of the
+// event. The key is the same for every delivery of an event, be it retried
+// after a lost ACK, redelivered from a persisted queue after the sender
+// restarted, or duplicated on the way. Unlike sequence numbers, it does not
+// depend on the epoch of the sender's queue. Receivers remember the keys of
+// the events they applied recently, and discard events whose key they know.
+//
+// Emitting the same change again, e.g. during a resync, results in a new
+// correlation ID and therefore in a new key, so that it is applied again.
+
+const idempotencyKey string = "idempotencykey"
+
+// IsMutation returns whether events of type evType change resources
+func IsMutation(evType EventType) bool {
+	switch evType {
+	case Create, Delete, SpecUpdate, StatusUpdate, SetOperation, TerminateOperation:
+		return true
+	}
+	return false
+}
+
+// SetIdempotencyKey stamps the idempotency key on ev, if ev changes a
+// resource. It must be called after all attributes the key is derived from
+// are set.
+func SetIdempotencyKey(ev *cloudevents.Event) {
+	if !IsMutation(EventType(ev.Type())) {
+		return
+	}
+	h := sha256.New()
+	for _, v := range []string{ev.Type(), ev.DataSchema(), ResourceID(ev), EventID(ev), CorrelationID(ev)} {
+		h.Write([]byte(v))
+		h.Write([]byte{0})
+	}
+	ev.SetExtension(idempotencyKey, hex.EncodeToString(h.Sum(nil)[:16]))
+}
+
+// IdempotencyKey returns the idempotency key of ev, or the empty string if
+// ev has none, e.g. because it does not change a resource or was sent by an
+// older peer.
+func IdempotencyKey(ev *cloudevents.Event) string {
+	key, _ := ev.Extensions()[idempotencyKey].(string)
+	return key
+}
+
+// appliedKeys remembers the idempotency keys of the last DedupWindow events
+// that were applied. It is not safe for concurrent use.
+type appliedKeys struct {
+	keys map[string]struct{}
+	// recent holds the keys in the order they were applied, and is used as a
+	// ring buffer of DedupWindow entries
+	recent []string
+	next   int
+}
+
+func (k *appliedKeys) contains(key string) bool {
+	_, ok := k.keys[key]
+	return ok
+}
+
+func (k *appliedKeys) add(key string) {
+	if k.keys == nil {
+		k.keys = make(map[string]struct{})
+	}
+	if _, ok := k.keys[key]; ok {
+		return
+	}
+	if len(k.recent) < DedupWindow {
+		k.recent = append(k.recent, key)
+	} else {
+		delete(k.keys, k.recent[k.next])
+		k.recent[k.next] = key
+		k.next = (k.next + 1) % DedupWindow
+	}
+	k.keys[key] = struct{}{}
+}
@@ -0,0 +1,90 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_IdempotencyKey(t *testing.T) {
+	es := NewEventSource("test")
+	app := &v1alpha1.Application{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "argocd", UID: "1234", ResourceVersion: "1"}}
+
+	t.Run("Only changes of resources have a key", func(t *testing.T) {
+		assert.NotEmpty(t, IdempotencyKey(es.ApplicationEvent(SpecUpdate, app)))
+		assert.NotEmpty(t, IdempotencyKey(es.AppProjectEvent(Delete, &v1alpha1.AppProject{})))
+		assert.Empty(t, IdempotencyKey(es.HeartbeatEvent(Ping)))
+	})
+
+	t.Run("Key is kept on the wire", func(t *testing.T) {
+		ev := es.ApplicationEvent(SpecUpdate, app)
+		pev, err := toWire(ev, true, nil, nil, nil)
+		require.NoError(t, err)
+		got, err := FromWire(pev)
+		require.NoError(t, err)
+		assert.Equal(t, IdempotencyKey(ev), IdempotencyKey(got.CloudEvent()))
+	})
+
+	t.Run("Key is deterministic", func(t *testing.T) {
+		ev := es.ApplicationEvent(SpecUpdate, app)
+		key := IdempotencyKey(ev)
+		SetIdempotencyKey(ev)
+		assert.Equal(t, key, IdempotencyKey(ev))
+
+		// Emitting the same change again results in a new key
+		assert.NotEqual(t, key, IdempotencyKey(es.ApplicationEvent(SpecUpdate, app)))
+		// The key differs per event type
+		other := ev.Clone()
+		other.SetType(StatusUpdate.String())
+		SetIdempotencyKey(&other)
+		assert.NotEqual(t, key, IdempotencyKey(&other))
+	})
+
+	t.Run("Applied keys are duplicates across epochs", func(t *testing.T) {
+		tr := NewSequenceTracker()
+		ev := es.ApplicationEvent(SpecUpdate, app)
+		SetSequence(ev, Sequence{Epoch: "epoch-1", Number: 1})
+		assert.False(t, tr.Duplicate(ev))
+		tr.Applied(ev)
+		assert.True(t, tr.Duplicate(ev))
+
+		// The sender restarted and resent the event from its persisted queue
+		SetSequence(ev, Sequence{Epoch: "epoch-2", Number: 1})
+		assert.True(t, tr.Duplicate(ev))
+
+		// Events without a sequence are recognized by their key alone
+		unsequenced := es.ApplicationEvent(SpecUpdate, app)
+		assert.False(t, tr.Duplicate(unsequenced))
+		tr.Applied(unsequenced)
+		assert.True(t, tr.Duplicate(unsequenced))
+	})
+
+	t.Run("Only the most recent keys are remembered", func(t *testing.T) {
+		k := appliedKeys{}
+		for i := range DedupWindow + 1 {
+			k.add(fmt.Sprintf("key-%d", i))
+		}
+		assert.False(t, k.contains("key-0"))
+		assert.True(t, k.contains("key-1"))
+		assert.True(t, k.contains(fmt.Sprintf("key-%d", DedupWindow)))
+		assert.Len(t, k.keys, DedupWindow)
+	})
+}
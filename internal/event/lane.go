@@ -0,0 +1,73 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"fmt"
+
+	"github.com/argoproj-labs/argocd-agent/internal/event/targets"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+// Lane is a class of events that can be sent on a gRPC stream of its own, so
+// that a flood of events in one lane cannot delay the events in another.
+type Lane string
+
+const (
+	// LaneControl holds control events, heartbeats and acknowledgements. It
+	// is always sent on the primary stream, which also carries the events of
+	// every lane without a stream of its own.
+	LaneControl Lane = "control"
+	// LaneSpec holds events that change resources, such as spec updates or
+	// deletions, and resource requests
+	LaneSpec Lane = "spec"
+	// LaneStatus holds status updates
+	LaneStatus Lane = "status"
+)
+
+// SecondaryLanes are the lanes that may be sent on streams of their own
+var SecondaryLanes = []Lane{LaneSpec, LaneStatus}
+
+// LaneHeader is the name of the gRPC request metadata an agent uses to
+// subscribe to a lane's stream. A stream without it is the primary stream.
+const LaneHeader = "x-argocd-agent-lane"
+
+// LanesHeader is the name of the gRPC response header the principal
+// advertises the lanes it accepts separate streams for in
+const LanesHeader = "x-argocd-agent-lanes"
+
+// ParseLane returns the secondary lane with the given name
+func ParseLane(name string) (Lane, error) {
+	for _, l := range SecondaryLanes {
+		if string(l) == name {
+			return l, nil
+		}
+	}
+	return "", fmt.Errorf("unknown event lane: %s", name)
+}
+
+// LaneOf returns the lane ev belongs to
+func LaneOf(ev *cloudevents.Event) Lane {
+	switch Target(ev) {
+	case targets.EventAck, targets.Heartbeat, targets.Control:
+		return LaneControl
+	case targets.ClusterCacheInfoUpdate:
+		return LaneStatus
+	}
+	if ev.Type() == StatusUpdate.String() {
+		return LaneStatus
+	}
+	return LaneSpec
+}
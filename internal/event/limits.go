@@ -0,0 +1,118 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/argoproj-labs/argocd-agent/internal/event/targets"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// DefaultPayloadLimitKey is the key used in ParsePayloadLimits to set the
+// limit for all targets without a limit of their own.
+const DefaultPayloadLimitKey = "default"
+
+var ErrPayloadTooLarge error = errors.New("event payload too large")
+
+// PayloadLimits holds the maximum size in bytes of the payload (the data) of
+// events, per event target. A limit of 0 means no limit.
+type PayloadLimits struct {
+	// Default applies to all targets not in ByTarget
+	Default int
+	// ByTarget holds limits for specific targets
+	ByTarget map[targets.EventTarget]int
+}
+
+// ParsePayloadLimits parses limits of the form <target>=<size>, where target
+// is the name of an event target (e.g. application) or "default", and size
+// is a quantity such as 512Ki or 4Mi.
+func ParsePayloadLimits(specs []string) (*PayloadLimits, error) {
+	l := &PayloadLimits{ByTarget: make(map[targets.EventTarget]int)}
+	for _, spec := range specs {
+		name, size, ok := strings.Cut(spec, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid payload limit %q: must be of the form <target>=<size>", spec)
+		}
+		q, err := resource.ParseQuantity(size)
+		if err != nil {
+			return nil, fmt.Errorf("invalid payload limit %q: %w", spec, err)
+		}
+		bytes, ok := q.AsInt64()
+		if !ok || bytes < 0 || int64(int(bytes)) != bytes {
+			return nil, fmt.Errorf("invalid payload limit %q: size out of range", spec)
+		}
+		if name == DefaultPayloadLimitKey {
+			l.Default = int(bytes)
+			continue
+		}
+		target := targetFromString(name)
+		if target == "" {
+			return nil, fmt.Errorf("invalid payload limit %q: unknown event target %s", spec, name)
+		}
+		l.ByTarget[target] = int(bytes)
+	}
+	return l, nil
+}
+
+// Limit returns the payload limit for target, or 0 if there is none.
+func (l *PayloadLimits) Limit(target targets.EventTarget) int {
+	if l == nil {
+		return 0
+	}
+	if limit, ok := l.ByTarget[target]; ok {
+		return limit
+	}
+	return l.Default
+}
+
+// Max returns the largest limit configured, or 0 if there is none.
+func (l *PayloadLimits) Max() int {
+	if l == nil {
+		return 0
+	}
+	m := l.Default
+	for _, limit := range l.ByTarget {
+		m = max(m, limit)
+	}
+	return m
+}
+
+// Check returns an error if the payload of ev exceeds the limit for its
+// target. The returned error wraps both ErrPayloadTooLarge and
+// ErrEventNotAllowed.
+func (l *PayloadLimits) Check(ev *cloudevents.Event) error {
+	target := Target(ev)
+	limit := l.Limit(target)
+	if limit == 0 {
+		return nil
+	}
+	if size := len(ev.Data()); size > limit {
+		return NewEventNotAllowedErr("%w: %s event of %d bytes exceeds the limit of %d bytes for %s",
+			ErrPayloadTooLarge, ev.Type(), size, limit, target)
+	}
+	return nil
+}
+
+// targetFromString returns the event target with the given name, or the
+// empty string if there is no such target.
+func targetFromString(name string) targets.EventTarget {
+	ev := cloudevents.NewEvent()
+	ev.SetDataSchema(name)
+	return Target(&ev)
+}
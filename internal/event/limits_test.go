@@ -0,0 +1,69 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/argoproj-labs/argocd-agent/internal/event/targets"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParsePayloadLimits(t *testing.T) {
+	t.Run("Valid limits", func(t *testing.T) {
+		l, err := ParsePayloadLimits([]string{"default=1Mi", "application=512Ki", "resource=10Mi"})
+		require.NoError(t, err)
+		assert.Equal(t, 1024*1024, l.Default)
+		assert.Equal(t, 512*1024, l.Limit(targets.Application))
+		assert.Equal(t, 1024*1024, l.Limit(targets.AppProject))
+		assert.Equal(t, 10*1024*1024, l.Max())
+	})
+	t.Run("Unlimited", func(t *testing.T) {
+		l, err := ParsePayloadLimits([]string{"application=512Ki"})
+		require.NoError(t, err)
+		assert.Equal(t, 0, l.Limit(targets.Resource))
+		assert.Equal(t, 512*1024, l.Max())
+		var nl *PayloadLimits
+		assert.Equal(t, 0, nl.Limit(targets.Application))
+	})
+	t.Run("Invalid limits", func(t *testing.T) {
+		for _, spec := range []string{"application", "application=lots", "foo=1Mi", "application=-1"} {
+			_, err := ParsePayloadLimits([]string{spec})
+			assert.Error(t, err, spec)
+		}
+	})
+}
+
+func Test_PayloadLimits_Check(t *testing.T) {
+	l := &PayloadLimits{ByTarget: map[targets.EventTarget]int{targets.Application: 100}}
+	ev := cloudevents.NewEvent()
+	ev.SetDataSchema(targets.Application.String())
+	ev.SetType(SpecUpdate.String())
+
+	require.NoError(t, ev.SetData(cloudevents.ApplicationJSON, map[string]string{"small": "yes"}))
+	assert.NoError(t, l.Check(&ev))
+
+	require.NoError(t, ev.SetData(cloudevents.ApplicationJSON, map[string]string{"large": strings.Repeat("x", 100)}))
+	err := l.Check(&ev)
+	assert.ErrorIs(t, err, ErrPayloadTooLarge)
+	assert.True(t, IsEventNotAllowed(err))
+	assert.ErrorContains(t, err, "exceeds the limit of 100 bytes for application")
+
+	ev.SetDataSchema(targets.AppProject.String())
+	assert.NoError(t, l.Check(&ev))
+}
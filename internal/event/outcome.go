@@ -0,0 +1,118 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"strings"
+
+	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// Outcome is the result of processing an event, which the receiver reports
+// back to the sender of the event on its ACK.
+type Outcome string
+
+const (
+	// OutcomeApplied is reported for events that were processed successfully
+	OutcomeApplied Outcome = "applied"
+	// OutcomeDiscarded is reported for events that had no effect on purpose,
+	// e.g. because they were received twice or were superseded
+	OutcomeDiscarded Outcome = "discarded"
+	// OutcomeRejected is reported for events that were not allowed or did
+	// not conform to the protocol
+	OutcomeRejected Outcome = "rejected"
+	// OutcomeConflict is reported for events that conflicted with the state
+	// of the resource on the receiving side
+	OutcomeConflict Outcome = "conflict"
+	// OutcomeFailed is reported for events that could not be applied for any
+	// other reason, e.g. an error returned by the Kubernetes API
+	OutcomeFailed Outcome = "failed"
+)
+
+const outcome string = "outcome"
+
+// maxOutcomeReasonLength is the maximum length in bytes of the reason
+// reported along with a failed outcome
+const maxOutcomeReasonLength = 1024
+
+// IsFailure returns whether o tells that the event could not be applied
+func (o Outcome) IsFailure() bool {
+	return o == OutcomeRejected || o == OutcomeConflict || o == OutcomeFailed
+}
+
+// OutcomeFor returns the outcome of an event whose processing returned err
+func OutcomeFor(err error) Outcome {
+	switch {
+	case err == nil:
+		return OutcomeApplied
+	case IsEventDiscarded(err):
+		return OutcomeDiscarded
+	case IsEventNotAllowed(err):
+		return OutcomeRejected
+	case apierrors.IsConflict(err), apierrors.IsAlreadyExists(err):
+		return OutcomeConflict
+	default:
+		return OutcomeFailed
+	}
+}
+
+// SetOutcome records on ack the outcome of processing the acknowledged event,
+// which returned err. The reason of failed outcomes is recorded as the
+// rejection reason, so that older peers still learn about it.
+func SetOutcome(ack *cloudevents.Event, err error) {
+	o := OutcomeFor(err)
+	ack.SetExtension(outcome, string(o))
+	if o.IsFailure() {
+		reason := err.Error()
+		if len(reason) > maxOutcomeReasonLength {
+			reason = strings.ToValidUTF8(reason[:maxOutcomeReasonLength], "")
+		}
+		SetRejectionReason(ack, reason)
+	}
+}
+
+// OutcomeOf returns the outcome reported on ack. ACKs of older peers, which
+// do not report an outcome, are considered rejections if they carry a
+// rejection reason, and successful otherwise.
+func OutcomeOf(ack *cloudevents.Event) Outcome {
+	if IsDeltaRejection(ack) {
+		// The event is resent in full
+		return OutcomeDiscarded
+	}
+	if o, ok := ack.Extensions()[outcome].(string); ok && o != "" {
+		return Outcome(o)
+	}
+	if RejectionReason(ack) != "" {
+		return OutcomeRejected
+	}
+	return OutcomeApplied
+}
+
+// AcknowledgedApplication returns the namespace and name of the Application
+// the event acknowledged by ack was about. The last return value is false if
+// the event was not about an Application.
+func AcknowledgedApplication(ack *cloudevents.Event) (string, string, bool) {
+	gvk, ok := ResourceGVK(ack)
+	if !ok || gvk != v1alpha1.ApplicationSchemaGroupVersionKind {
+		return "", "", false
+	}
+	namespace, name, ok := strings.Cut(ack.Subject(), "/")
+	if !ok || name == "" {
+		return "", "", false
+	}
+	return namespace, name, true
+}
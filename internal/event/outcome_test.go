@@ -0,0 +1,97 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/argoproj-labs/argocd-agent/internal/event/targets"
+)
+
+func Test_Outcome(t *testing.T) {
+	es := NewEventSource("test")
+	app := &v1alpha1.Application{ObjectMeta: metav1.ObjectMeta{Name: "guestbook", Namespace: "argocd", UID: "uid"}}
+	ackFor := func(err error) *Event {
+		ev := es.ApplicationEvent(SpecUpdate, app)
+		ack := es.ProcessedEvent(EventProcessed, New(ev, targets.Application))
+		SetOutcome(ack, err)
+		return New(ack, targets.EventAck)
+	}
+
+	t.Run("Errors are classified", func(t *testing.T) {
+		gr := schema.GroupResource{Group: "argoproj.io", Resource: "applications"}
+		for err, want := range map[error]Outcome{
+			nil:                                  OutcomeApplied,
+			NewEventDiscardedErr("duplicate"):    OutcomeDiscarded,
+			NewEventNotAllowedErr("denied"):      OutcomeRejected,
+			&ValidationError{Field: "type"}:      OutcomeRejected,
+			apierrors.NewConflict(gr, "x", nil):  OutcomeConflict,
+			apierrors.NewAlreadyExists(gr, "x"):  OutcomeConflict,
+			errors.New("connection reset"):       OutcomeFailed,
+			apierrors.NewForbidden(gr, "x", nil): OutcomeFailed,
+		} {
+			assert.Equal(t, want, OutcomeFor(err), "%v", err)
+		}
+	})
+
+	t.Run("ACKs report the outcome and the reason of failures", func(t *testing.T) {
+		ack := ackFor(nil).CloudEvent()
+		assert.Equal(t, OutcomeApplied, OutcomeOf(ack))
+		assert.Empty(t, RejectionReason(ack))
+
+		ack = ackFor(errors.New("connection reset")).CloudEvent()
+		assert.Equal(t, OutcomeFailed, OutcomeOf(ack))
+		assert.True(t, OutcomeOf(ack).IsFailure())
+		assert.Equal(t, "connection reset", RejectionReason(ack))
+
+		ack = ackFor(NewEventDiscardedErr("duplicate")).CloudEvent()
+		assert.Equal(t, OutcomeDiscarded, OutcomeOf(ack))
+		assert.Empty(t, RejectionReason(ack))
+
+		ack = ackFor(errors.New(strings.Repeat("é", maxOutcomeReasonLength))).CloudEvent()
+		assert.LessOrEqual(t, len(RejectionReason(ack)), maxOutcomeReasonLength)
+		assert.NoError(t, Validate(ack))
+	})
+
+	t.Run("ACKs of older peers report rejections only", func(t *testing.T) {
+		ack := es.ProcessedEvent(EventProcessed, New(es.ApplicationEvent(SpecUpdate, app), targets.Application))
+		assert.Equal(t, OutcomeApplied, OutcomeOf(ack))
+		SetRejectionReason(ack, "denied by policy")
+		assert.Equal(t, OutcomeRejected, OutcomeOf(ack))
+
+		delta := es.DeltaRejectedEvent(es.ApplicationEvent(SpecUpdate, app))
+		assert.Equal(t, OutcomeDiscarded, OutcomeOf(delta))
+	})
+
+	t.Run("ACKs tell the Application they are about", func(t *testing.T) {
+		namespace, name, ok := AcknowledgedApplication(ackFor(nil).CloudEvent())
+		assert.True(t, ok)
+		assert.Equal(t, "argocd", namespace)
+		assert.Equal(t, "guestbook", name)
+
+		proj := &v1alpha1.AppProject{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "argocd"}}
+		ack := es.ProcessedEvent(EventProcessed, New(es.AppProjectEvent(SpecUpdate, proj), targets.AppProject))
+		_, _, ok = AcknowledgedApplication(ack)
+		assert.False(t, ok)
+	})
+}
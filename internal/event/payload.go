@@ -0,0 +1,238 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+// Payload encryption protects the data of events from intermediaries that
+// terminate TLS between agent and principal. Both peers exchange ephemeral
+// X25519 public keys along with the authentication of the agent, and derive
+// a key for each direction from the shared secret. The principal passes its
+// public key in the response header of the authentication, the agent names
+// the resulting key in the metadata of its event streams.
+//
+// The exchange itself only protects against intermediaries that read the
+// traffic. If both peers are configured with the same pre-shared key, it is
+// mixed into the derivation, so that intermediaries that replace the public
+// keys cannot derive the keys either.
+
+const (
+	// PayloadKeyHeader is the name of the gRPC metadata the peers exchange
+	// their public keys in
+	PayloadKeyHeader = "x-argocd-agent-payload-key"
+	// PayloadKeyIDHeader is the name of the gRPC metadata the agent names the
+	// key the events of a stream are encrypted with in
+	PayloadKeyIDHeader = "x-argocd-agent-payload-key-id"
+)
+
+// ContentTypeEncrypted is the content type of encrypted event data. The
+// content type of the plain data is kept in an extension.
+const ContentTypeEncrypted = "application/vnd.argocd-agent.encrypted"
+
+const encryptedContentType string = "encct"
+
+// ErrPayloadUndecryptable is returned for events whose data cannot be
+// decrypted, or which are not encrypted although they must be.
+var ErrPayloadUndecryptable error = errors.New("event payload cannot be decrypted")
+
+// maxPayloadKeys is the number of keys the principal remembers per agent. An
+// agent may still use its previous key while it authenticates again.
+const maxPayloadKeys = 2
+
+// PayloadKeyPair is the ephemeral key pair of one side of a key exchange
+type PayloadKeyPair struct {
+	private *ecdh.PrivateKey
+}
+
+// NewPayloadKeyPair generates a new ephemeral key pair
+func NewPayloadKeyPair() (*PayloadKeyPair, error) {
+	k, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate payload key: %w", err)
+	}
+	return &PayloadKeyPair{private: k}, nil
+}
+
+// PublicKey returns the encoded public key to send to the peer
+func (k *PayloadKeyPair) PublicKey() string {
+	return base64.StdEncoding.EncodeToString(k.private.PublicKey().Bytes())
+}
+
+// Derive returns the cipher shared with the peer whose encoded public key is
+// peerKey. psk is the optional pre-shared key, which must be the same on both
+// sides. agent tells which side of the exchange k is.
+func (k *PayloadKeyPair) Derive(peerKey string, psk []byte, agent bool) (*PayloadCipher, error) {
+	raw, err := base64.StdEncoding.DecodeString(peerKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid payload key of peer: %w", err)
+	}
+	peer, err := ecdh.X25519().NewPublicKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid payload key of peer: %w", err)
+	}
+	secret, err := k.private.ECDH(peer)
+	if err != nil {
+		return nil, fmt.Errorf("could not derive payload key: %w", err)
+	}
+
+	// Both public keys, the agent's first, bind the keys to this exchange
+	own := k.private.PublicKey().Bytes()
+	agentKey, principalKey := own, peer.Bytes()
+	if !agent {
+		agentKey, principalKey = principalKey, agentKey
+	}
+	salt := sha256.Sum256(append(append([]byte{}, agentKey...), principalKey...))
+	ikm := append(append([]byte{}, secret...), psk...)
+
+	toPrincipal, err := newPayloadAEAD(ikm, salt[:], "agent to principal")
+	if err != nil {
+		return nil, err
+	}
+	toAgent, err := newPayloadAEAD(ikm, salt[:], "principal to agent")
+	if err != nil {
+		return nil, err
+	}
+	c := &PayloadCipher{id: hex.EncodeToString(salt[:8]), seal: toPrincipal, open: toAgent}
+	if !agent {
+		c.seal, c.open = toAgent, toPrincipal
+	}
+	return c, nil
+}
+
+func newPayloadAEAD(ikm, salt []byte, info string) (cipher.AEAD, error) {
+	key, err := hkdf.Key(sha256.New, ikm, salt, "argocd-agent payload "+info, 32)
+	if err != nil {
+		return nil, fmt.Errorf("could not derive payload key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// PayloadCipher encrypts the data of the events sent to a peer, and decrypts
+// the data of the events received from it. It is safe for concurrent use.
+type PayloadCipher struct {
+	id   string
+	seal cipher.AEAD
+	open cipher.AEAD
+}
+
+// ID returns the identifier of the key, which is the same on both sides
+func (c *PayloadCipher) ID() string {
+	return c.id
+}
+
+// payloadAAD returns the attributes of ev the encryption of its data is
+// bound to, so that the data cannot be moved to other events.
+func payloadAAD(ev *cloudevents.Event) []byte {
+	return []byte(ev.Type() + "\x00" + ResourceID(ev) + "\x00" + EventID(ev))
+}
+
+// Encrypt returns a copy of ev whose data is encrypted. Events without data
+// are returned as they are.
+func (c *PayloadCipher) Encrypt(ev *cloudevents.Event) (*cloudevents.Event, error) {
+	data := ev.Data()
+	if len(data) == 0 {
+		return ev, nil
+	}
+	nonce := make([]byte, c.seal.NonceSize(), c.seal.NonceSize()+len(data)+c.seal.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("could not generate nonce: %w", err)
+	}
+	out := ev.Clone()
+	out.DataEncoded = c.seal.Seal(nonce, nonce, data, payloadAAD(ev))
+	out.SetExtension(encryptedContentType, ev.DataContentType())
+	out.SetDataContentType(ContentTypeEncrypted)
+	return &out, nil
+}
+
+// Decrypt replaces the encrypted data of ev with the plain data in place. It
+// returns ErrPayloadUndecryptable if the data cannot be decrypted, or if ev
+// carries data that is not encrypted.
+func (c *PayloadCipher) Decrypt(ev *cloudevents.Event) error {
+	data := ev.Data()
+	if len(data) == 0 {
+		return nil
+	}
+	if ev.DataContentType() != ContentTypeEncrypted {
+		return fmt.Errorf("%w: data is not encrypted", ErrPayloadUndecryptable)
+	}
+	ns := c.open.NonceSize()
+	if len(data) < ns {
+		return fmt.Errorf("%w: data is too short", ErrPayloadUndecryptable)
+	}
+	plain, err := c.open.Open(nil, data[:ns], data[ns:], payloadAAD(ev))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrPayloadUndecryptable, err)
+	}
+	ct, _ := ev.Extensions()[encryptedContentType].(string)
+	ev.DataEncoded = plain
+	ev.SetDataContentType(ct)
+	ev.SetExtension(encryptedContentType, nil)
+	return nil
+}
+
+// PayloadKeyring holds the payload ciphers the principal negotiated with its
+// agents. It is safe for concurrent use.
+type PayloadKeyring struct {
+	mu sync.Mutex
+	// key: agent name
+	// value: the ciphers of the agent, latest last
+	ciphers map[string][]*PayloadCipher
+}
+
+func NewPayloadKeyring() *PayloadKeyring {
+	return &PayloadKeyring{ciphers: map[string][]*PayloadCipher{}}
+}
+
+// Add remembers c as the latest cipher negotiated with agent
+func (k *PayloadKeyring) Add(agent string, c *PayloadCipher) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	ciphers := append(k.ciphers[agent], c)
+	if len(ciphers) > maxPayloadKeys {
+		ciphers = ciphers[len(ciphers)-maxPayloadKeys:]
+	}
+	k.ciphers[agent] = ciphers
+}
+
+// Get returns the cipher with the given ID negotiated with agent, or nil if
+// there is none.
+func (k *PayloadKeyring) Get(agent, id string) *PayloadCipher {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for _, c := range k.ciphers[agent] {
+		if c.id == id {
+			return c
+		}
+	}
+	return nil
+}
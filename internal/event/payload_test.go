@@ -0,0 +1,116 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"testing"
+
+	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	format "github.com/cloudevents/sdk-go/binding/format/protobuf/v2"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_PayloadEncryption(t *testing.T) {
+	es := NewEventSource("test")
+	app := &v1alpha1.Application{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "argocd", UID: "uid", ResourceVersion: "1"},
+		Spec:       v1alpha1.ApplicationSpec{Project: "secret-project"},
+	}
+
+	// negotiate returns the ciphers of agent and principal
+	negotiate := func(t *testing.T, agentPSK, principalPSK []byte) (*PayloadCipher, *PayloadCipher) {
+		t.Helper()
+		agentKey, err := NewPayloadKeyPair()
+		require.NoError(t, err)
+		principalKey, err := NewPayloadKeyPair()
+		require.NoError(t, err)
+		principal, err := principalKey.Derive(agentKey.PublicKey(), principalPSK, false)
+		require.NoError(t, err)
+		agent, err := agentKey.Derive(principalKey.PublicKey(), agentPSK, true)
+		require.NoError(t, err)
+		require.Equal(t, agent.ID(), principal.ID())
+		return agent, principal
+	}
+
+	t.Run("Payloads are decrypted by the peer", func(t *testing.T) {
+		agent, principal := negotiate(t, []byte("psk"), []byte("psk"))
+		ev := es.ApplicationEvent(SpecUpdate, app)
+
+		pev, err := toWire(ev, false, nil, principal, nil)
+		require.NoError(t, err)
+		received, err := format.FromProto(pev)
+		require.NoError(t, err)
+		assert.Equal(t, ContentTypeEncrypted, received.DataContentType())
+		assert.NotContains(t, string(received.Data()), "secret-project")
+
+		require.NoError(t, agent.Decrypt(received))
+		assert.Equal(t, cloudevents.ApplicationJSON, received.DataContentType())
+		assert.Empty(t, received.Extensions()[encryptedContentType])
+		got := &v1alpha1.Application{}
+		require.NoError(t, received.DataAs(got))
+		assert.Equal(t, app, got)
+
+		// Both directions use keys of their own
+		encrypted, err := principal.Encrypt(ev)
+		require.NoError(t, err)
+		assert.ErrorIs(t, principal.Decrypt(encrypted), ErrPayloadUndecryptable)
+	})
+
+	t.Run("Payloads cannot be decrypted with a different pre-shared key", func(t *testing.T) {
+		agent, principal := negotiate(t, []byte("psk"), []byte("other"))
+		encrypted, err := agent.Encrypt(es.ApplicationEvent(SpecUpdate, app))
+		require.NoError(t, err)
+		assert.ErrorIs(t, principal.Decrypt(encrypted), ErrPayloadUndecryptable)
+	})
+
+	t.Run("Payloads cannot be moved to other events", func(t *testing.T) {
+		agent, principal := negotiate(t, nil, nil)
+		encrypted, err := agent.Encrypt(es.ApplicationEvent(SpecUpdate, app))
+		require.NoError(t, err)
+		other := es.ApplicationEvent(Delete, app)
+		other.DataEncoded = encrypted.Data()
+		other.SetDataContentType(ContentTypeEncrypted)
+		assert.ErrorIs(t, principal.Decrypt(other), ErrPayloadUndecryptable)
+	})
+
+	t.Run("Plain payloads are rejected", func(t *testing.T) {
+		_, principal := negotiate(t, nil, nil)
+		assert.ErrorIs(t, principal.Decrypt(es.ApplicationEvent(SpecUpdate, app)), ErrPayloadUndecryptable)
+		// Events without data are not encrypted
+		assert.NoError(t, principal.Decrypt(es.HeartbeatEvent(Ping)))
+	})
+}
+
+func Test_PayloadKeyring(t *testing.T) {
+	keys := NewPayloadKeyring()
+	ciphers := make([]*PayloadCipher, 0, maxPayloadKeys+1)
+	for range maxPayloadKeys + 1 {
+		agentKey, err := NewPayloadKeyPair()
+		require.NoError(t, err)
+		principalKey, err := NewPayloadKeyPair()
+		require.NoError(t, err)
+		c, err := principalKey.Derive(agentKey.PublicKey(), nil, false)
+		require.NoError(t, err)
+		keys.Add("agent", c)
+		ciphers = append(ciphers, c)
+	}
+	assert.Nil(t, keys.Get("agent", ciphers[0].ID()))
+	assert.Same(t, ciphers[1], keys.Get("agent", ciphers[1].ID()))
+	assert.Same(t, ciphers[2], keys.Get("agent", ciphers[2].ID()))
+	assert.Nil(t, keys.Get("other-agent", ciphers[2].ID()))
+}
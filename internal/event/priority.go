@@ -0,0 +1,80 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+// Priority determines the order in which queued events are sent. Queued
+// events of a higher priority are sent before those of a lower priority.
+type Priority int
+
+const (
+	// PriorityLow is the priority of bulk updates, such as status updates
+	PriorityLow Priority = iota
+	// PriorityNormal is the priority of events without explicit priority,
+	// such as spec changes
+	PriorityNormal
+	// PriorityHigh is the priority of deletions
+	PriorityHigh
+)
+
+// NumPriorities is the number of priority levels
+const NumPriorities = int(PriorityHigh) + 1
+
+const priority = "priority"
+
+var priorityNames = map[Priority]string{
+	PriorityLow:    "low",
+	PriorityNormal: "normal",
+	PriorityHigh:   "high",
+}
+
+func (p Priority) String() string {
+	return priorityNames[p]
+}
+
+// PriorityFor returns the priority of events of type evType
+func PriorityFor(evType EventType) Priority {
+	switch evType {
+	case Delete:
+		return PriorityHigh
+	case StatusUpdate, ClusterCacheInfoUpdate:
+		return PriorityLow
+	default:
+		return PriorityNormal
+	}
+}
+
+// SetPriority sets the priority of ev
+func SetPriority(ev *cloudevents.Event, p Priority) {
+	ev.SetExtension(priority, p.String())
+}
+
+// PriorityOf returns the priority of ev. Events without a priority, for
+// example those sent by older versions, are of normal priority.
+func PriorityOf(ev *cloudevents.Event) Priority {
+	name, ok := ev.Extensions()[priority].(string)
+	if !ok {
+		return PriorityNormal
+	}
+	for p, n := range priorityNames {
+		if n == name {
+			return p
+		}
+	}
+	return PriorityNormal
+}
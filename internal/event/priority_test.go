@@ -0,0 +1,44 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"testing"
+
+	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_Priority(t *testing.T) {
+	es := NewEventSource("test")
+	app := &v1alpha1.Application{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "argocd", UID: "1234"}}
+
+	t.Run("Emitted events carry the priority of their type", func(t *testing.T) {
+		assert.Equal(t, PriorityHigh, PriorityOf(es.ApplicationEvent(Delete, app)))
+		assert.Equal(t, PriorityNormal, PriorityOf(es.ApplicationEvent(SpecUpdate, app)))
+		assert.Equal(t, PriorityNormal, PriorityOf(es.ApplicationEvent(Create, app)))
+		assert.Equal(t, PriorityLow, PriorityOf(es.ApplicationEvent(StatusUpdate, app)))
+		assert.Equal(t, PriorityLow, PriorityOf(es.ClusterCacheInfoUpdateEvent(ClusterCacheInfoUpdate, &ClusterCacheInfo{})))
+	})
+
+	t.Run("Events without a known priority are of normal priority", func(t *testing.T) {
+		ev := cloudevents.NewEvent()
+		assert.Equal(t, PriorityNormal, PriorityOf(&ev))
+		ev.SetExtension(priority, "urgent")
+		assert.Equal(t, PriorityNormal, PriorityOf(&ev))
+	})
+}
@@ -0,0 +1,152 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/argoproj-labs/argocd-agent/internal/event/targets"
+)
+
+// Events for Kubernetes resources share the same envelope, regardless of the
+// kind of resource they carry: the resource and event IDs are derived from
+// the resource's metadata, the subject is its namespace and name, and the
+// data is the JSON encoded resource. The GroupVersionKind of the resource is
+// carried in an extension, so that the receiving side can tell what it got
+// without knowing the target in advance.
+//
+// To propagate a new kind of resource, register its target with
+// RegisterResourceTarget and create its events with EventSource.ResourceEvent.
+// The events then go through the same queues, ACKs and resyncs as those of
+// Applications.
+
+const resourceGVK string = "resourcegvk"
+
+var (
+	resourceTargetsLock sync.RWMutex
+	// key: event target
+	// value: the GroupVersionKind of the resources of the target
+	resourceTargets = map[targets.EventTarget]schema.GroupVersionKind{
+		targets.Application:    v1alpha1.ApplicationSchemaGroupVersionKind,
+		targets.AppProject:     v1alpha1.AppProjectSchemaGroupVersionKind,
+		targets.ApplicationSet: v1alpha1.ApplicationSetSchemaGroupVersionKind,
+		targets.Repository:     corev1.SchemeGroupVersion.WithKind("Secret"),
+		targets.GPGKey:         corev1.SchemeGroupVersion.WithKind("ConfigMap"),
+		targets.ArgoCDConfig:   corev1.SchemeGroupVersion.WithKind("ConfigMap"),
+		targets.ArgoCDSecret:   corev1.SchemeGroupVersion.WithKind("Secret"),
+	}
+)
+
+// RegisterResourceTarget registers target as the event target for resources
+// of the kind gvk. It is meant to be called during initialization, and
+// returns an error if target is already registered for another kind.
+func RegisterResourceTarget(target targets.EventTarget, gvk schema.GroupVersionKind) error {
+	resourceTargetsLock.Lock()
+	defer resourceTargetsLock.Unlock()
+	if existing, ok := resourceTargets[target]; ok && existing != gvk {
+		return fmt.Errorf("event target %s is already registered for %s", target, existing)
+	}
+	resourceTargets[target] = gvk
+	return nil
+}
+
+// ResourceTargetGVK returns the GroupVersionKind of the resources of target,
+// and whether target is a resource target at all.
+func ResourceTargetGVK(target targets.EventTarget) (schema.GroupVersionKind, bool) {
+	resourceTargetsLock.RLock()
+	defer resourceTargetsLock.RUnlock()
+	gvk, ok := resourceTargets[target]
+	return gvk, ok
+}
+
+// ResourceEvent returns an event of type evType for the Kubernetes resource
+// res, whose events are sent to target. The target must be registered with
+// RegisterResourceTarget, or be one of the built-in resource targets. If res
+// cannot be encoded, the event is returned without data along with the error.
+func (evs EventSource) ResourceEvent(evType EventType, target targets.EventTarget, res v1.Object) (*cloudevents.Event, error) {
+	gvk, ok := ResourceTargetGVK(target)
+	if !ok {
+		return nil, fmt.Errorf("event target %s is not a resource target", target)
+	}
+	meta := v1.ObjectMeta{
+		Name:            res.GetName(),
+		UID:             res.GetUID(),
+		ResourceVersion: res.GetResourceVersion(),
+	}
+	cev := cloudevents.NewEvent()
+	cev.SetSource(evs.source)
+	cev.SetSpecVersion(cloudEventSpecVersion)
+	cev.SetExtension(correlationID, NewCorrelationID())
+	cev.SetType(evType.String())
+	SetPriority(&cev, PriorityFor(evType))
+	cev.SetExtension(eventID, createEventID(meta))
+	cev.SetExtension(resourceID, createResourceID(meta))
+	cev.SetExtension(resourceGVK, formatGVK(gvk))
+	cev.SetDataSchema(target.String())
+	cev.SetSubject(fmt.Sprintf("%s/%s", res.GetNamespace(), res.GetName()))
+	SetIdempotencyKey(&cev)
+	if err := cev.SetData(cloudevents.ApplicationJSON, res); err != nil {
+		return &cev, fmt.Errorf("could not encode %s %s/%s: %w", gvk.Kind, res.GetNamespace(), res.GetName(), err)
+	}
+	return &cev, nil
+}
+
+// ResourceGVK returns the GroupVersionKind of the resource carried by ev. For
+// events sent by older peers, which do not carry it, the GroupVersionKind
+// registered for the event's target is returned. The second return value is
+// false if ev does not carry a resource.
+func ResourceGVK(ev *cloudevents.Event) (schema.GroupVersionKind, bool) {
+	if s, ok := ev.Extensions()[resourceGVK].(string); ok {
+		if gvk, err := parseGVK(s); err == nil {
+			return gvk, true
+		}
+	}
+	return ResourceTargetGVK(targets.EventTarget(ev.DataSchema()))
+}
+
+// Resource decodes the resource carried by the event into res. It returns an
+// error if the event does not carry a resource of the kind gvk.
+func (ev Event) Resource(gvk schema.GroupVersionKind, res any) error {
+	got, ok := ResourceGVK(ev.event)
+	if !ok {
+		return fmt.Errorf("event of target %s does not carry a resource", ev.target)
+	}
+	if got != gvk {
+		return fmt.Errorf("event carries %s, not %s", got, gvk)
+	}
+	return ev.event.DataAs(res)
+}
+
+// formatGVK formats gvk as group/version/kind. The group of the core API is
+// empty.
+func formatGVK(gvk schema.GroupVersionKind) string {
+	return gvk.Group + "/" + gvk.Version + "/" + gvk.Kind
+}
+
+func parseGVK(s string) (schema.GroupVersionKind, error) {
+	parts := strings.SplitN(s, "/", 3)
+	if len(parts) != 3 || parts[1] == "" || parts[2] == "" {
+		return schema.GroupVersionKind{}, fmt.Errorf("invalid GroupVersionKind: %q", s)
+	}
+	return schema.GroupVersionKind{Group: parts[0], Version: parts[1], Kind: parts[2]}, nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"testing"
+
+	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/argoproj-labs/argocd-agent/internal/event/targets"
+)
+
+func Test_ResourceEvent(t *testing.T) {
+	es := NewEventSource("test")
+
+	t.Run("Built-in resources carry their GroupVersionKind", func(t *testing.T) {
+		app := &v1alpha1.Application{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "argocd", UID: "uid", ResourceVersion: "1"}}
+		ev := es.ApplicationEvent(SpecUpdate, app)
+		gvk, ok := ResourceGVK(ev)
+		require.True(t, ok)
+		assert.Equal(t, v1alpha1.ApplicationSchemaGroupVersionKind, gvk)
+		assert.Equal(t, "app_uid_1", EventID(ev))
+		assert.Equal(t, "app_uid", ResourceID(ev))
+		assert.Equal(t, "argocd/app", ev.Subject())
+
+		cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "gpg", Namespace: "argocd"}}
+		gvk, ok = ResourceGVK(es.GPGKeyEvent(Create, cm))
+		require.True(t, ok)
+		assert.Equal(t, corev1.SchemeGroupVersion.WithKind("ConfigMap"), gvk)
+	})
+
+	t.Run("Registered targets are resource targets", func(t *testing.T) {
+		target := targets.EventTarget("test-namespace")
+		nsGVK := corev1.SchemeGroupVersion.WithKind("Namespace")
+		require.NoError(t, RegisterResourceTarget(target, nsGVK))
+		require.NoError(t, RegisterResourceTarget(target, nsGVK))
+		assert.Error(t, RegisterResourceTarget(target, corev1.SchemeGroupVersion.WithKind("Secret")))
+
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns", UID: "uid", ResourceVersion: "2"}}
+		ev, err := es.ResourceEvent(Create, target, ns)
+		require.NoError(t, err)
+		assert.Equal(t, target, Target(ev))
+
+		pev, err := toWire(ev, false, nil, nil, nil)
+		require.NoError(t, err)
+		received, err := FromWire(pev)
+		require.NoError(t, err)
+		assert.Equal(t, target, received.Target())
+		got := &corev1.Namespace{}
+		require.NoError(t, received.Resource(nsGVK, got))
+		assert.Equal(t, ns, got)
+		assert.Error(t, received.Resource(corev1.SchemeGroupVersion.WithKind("Secret"), &corev1.Secret{}))
+	})
+
+	t.Run("Unregistered targets are rejected", func(t *testing.T) {
+		_, err := es.ResourceEvent(Create, targets.Heartbeat, &corev1.Namespace{})
+		assert.Error(t, err)
+	})
+
+	t.Run("Events without GroupVersionKind use the one of their target", func(t *testing.T) {
+		ev := es.AppProjectEvent(Create, &v1alpha1.AppProject{})
+		ev.SetExtension(resourceGVK, nil)
+		gvk, ok := ResourceGVK(ev)
+		require.True(t, ok)
+		assert.Equal(t, v1alpha1.AppProjectSchemaGroupVersionKind, gvk)
+
+		_, ok = ResourceGVK(es.HeartbeatEvent(Ping))
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,229 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"strconv"
+	"sync"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+const (
+	sequenceEpoch    string = "sequenceepoch"
+	sequenceNumber   string = "sequence"
+	sequencePrevious string = "prevsequence"
+)
+
+// Sequence is the position of an event in the stream of events sent to a
+// single peer. Numbers increase monotonically within an epoch, which starts
+// whenever the sender's queue for the peer is created, e.g. after a restart
+// or a failover to another principal replica.
+type Sequence struct {
+	Epoch string
+	// Number is the sequence number of the event
+	Number uint64
+	// Previous is the sequence number of the previous event sent in the same
+	// epoch for the same ordering key, or 0 if there is none
+	Previous uint64
+}
+
+// SetSequence stamps seq on an event.
+func SetSequence(ev *cloudevents.Event, seq Sequence) {
+	ev.SetExtension(sequenceEpoch, seq.Epoch)
+	ev.SetExtension(sequenceNumber, strconv.FormatUint(seq.Number, 10))
+	ev.SetExtension(sequencePrevious, strconv.FormatUint(seq.Previous, 10))
+}
+
+// GetSequence returns the sequence stamped on an event. Returns false if the
+// event has no or an invalid sequence.
+func GetSequence(ev *cloudevents.Event) (Sequence, bool) {
+	epoch, ok := ev.Extensions()[sequenceEpoch].(string)
+	if !ok || epoch == "" {
+		return Sequence{}, false
+	}
+	number, err := parseSequenceNumber(ev, sequenceNumber)
+	if err != nil || number == 0 {
+		return Sequence{}, false
+	}
+	previous, err := parseSequenceNumber(ev, sequencePrevious)
+	if err != nil || previous >= number {
+		return Sequence{}, false
+	}
+	return Sequence{Epoch: epoch, Number: number, Previous: previous}, true
+}
+
+func parseSequenceNumber(ev *cloudevents.Event, name string) (uint64, error) {
+	val, _ := ev.Extensions()[name].(string)
+	return strconv.ParseUint(val, 10, 64)
+}
+
+// OrderingKey returns the key of the events that must be applied in the order
+// they were sent, or the empty string if ev may be applied in any order.
+// Events that change the same resource are ordered within their lane, as
+// events in different lanes may overtake each other by design.
+func OrderingKey(ev *cloudevents.Event) string {
+	id := ResourceID(ev)
+	if id == "" {
+		return ""
+	}
+	if !IsMutation(EventType(ev.Type())) {
+		return ""
+	}
+	return string(LaneOf(ev)) + "/" + ev.DataSchema() + "/" + id
+}
+
+// DedupWindow is the number of events applied most recently that a
+// SequenceTracker recognizes when they are delivered again
+const DedupWindow = 4096
+
+// SequenceTracker tracks the sequence numbers of the events received from a
+// single peer, to detect events that were lost, that are delivered again
+// after they were applied, or that arrive after a later event for the same
+// ordering key was applied.
+type SequenceTracker struct {
+	lock  sync.Mutex
+	epoch string
+	// last maps each ordering key to the sequence number of the last event
+	// applied for it in the current epoch
+	last map[string]uint64
+	// applied holds the sequence numbers of the events applied most recently
+	// in the current epoch
+	applied map[uint64]struct{}
+	// recent holds the keys of applied in the order they were applied, and
+	// is used as a ring buffer of DedupWindow entries
+	recent []uint64
+	next   int
+
+	// keys holds the idempotency keys of the events applied most recently,
+	// regardless of their epoch
+	keys appliedKeys
+}
+
+func NewSequenceTracker() *SequenceTracker {
+	return &SequenceTracker{
+		last:    make(map[string]uint64),
+		applied: make(map[uint64]struct{}),
+	}
+}
+
+// Duplicate returns whether ev was applied already, i.e. it was delivered
+// again because its acknowledgement got lost. A duplicate must not be applied
+// again, but must be acknowledged. Events are recognized by their sequence
+// number within the current epoch, or by their idempotency key across epochs.
+// Events with neither are never duplicates.
+func (t *SequenceTracker) Duplicate(ev *cloudevents.Event) bool {
+	if t == nil {
+		return false
+	}
+	idemKey := IdempotencyKey(ev)
+	seq, ok := GetSequence(ev)
+	if !ok && idemKey == "" {
+		return false
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if idemKey != "" && t.keys.contains(idemKey) {
+		return true
+	}
+	if !ok || seq.Epoch != t.epoch {
+		return false
+	}
+	_, ok = t.applied[seq.Number]
+	return ok
+}
+
+// remember records that the event with the sequence number n was applied.
+// The caller must own t.lock.
+func (t *SequenceTracker) remember(n uint64) {
+	if _, ok := t.applied[n]; ok {
+		return
+	}
+	if len(t.recent) < DedupWindow {
+		t.recent = append(t.recent, n)
+	} else {
+		delete(t.applied, t.recent[t.next])
+		t.recent[t.next] = n
+		t.next = (t.next + 1) % DedupWindow
+	}
+	t.applied[n] = struct{}{}
+}
+
+// Stale returns whether ev is older than an event that was already applied
+// for the same ordering key, in which case it must not be applied. Events
+// without a sequence or ordering key are never stale.
+func (t *SequenceTracker) Stale(ev *cloudevents.Event) bool {
+	if t == nil {
+		return false
+	}
+	key := OrderingKey(ev)
+	seq, ok := GetSequence(ev)
+	if key == "" || !ok {
+		return false
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if seq.Epoch != t.epoch {
+		return false
+	}
+	last, ok := t.last[key]
+	return ok && seq.Number <= last
+}
+
+// Applied records that ev was applied. Returns true if an earlier event for
+// the same ordering key was never applied, i.e. there is a gap in the
+// sequence. A new epoch forgets the sequence numbers of the previous one, but
+// not the idempotency keys.
+func (t *SequenceTracker) Applied(ev *cloudevents.Event) bool {
+	if t == nil {
+		return false
+	}
+	idemKey := IdempotencyKey(ev)
+	seq, ok := GetSequence(ev)
+	if !ok && idemKey == "" {
+		return false
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if idemKey != "" {
+		t.keys.add(idemKey)
+	}
+	if !ok {
+		return false
+	}
+	if seq.Epoch != t.epoch {
+		t.epoch = seq.Epoch
+		clear(t.last)
+		clear(t.applied)
+		t.recent, t.next = t.recent[:0], 0
+	}
+	t.remember(seq.Number)
+	key := OrderingKey(ev)
+	if key == "" {
+		return false
+	}
+	last, known := t.last[key]
+	if known && seq.Number <= last {
+		return false
+	}
+	if EventType(ev.Type()) == Delete {
+		delete(t.last, key)
+	} else {
+		t.last[key] = seq.Number
+	}
+	// Without a record of the key, we can't tell whether an earlier event
+	// went missing, e.g. because we started in the middle of the epoch.
+	return known && seq.Previous != last
+}
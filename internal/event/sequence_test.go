@@ -0,0 +1,136 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"testing"
+
+	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	format "github.com/cloudevents/sdk-go/binding/format/protobuf/v2"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_Sequence(t *testing.T) {
+	es := NewEventSource("test")
+	appA := &v1alpha1.Application{ObjectMeta: metav1.ObjectMeta{Name: "app-a", Namespace: "argocd", UID: "1234"}}
+	appB := &v1alpha1.Application{ObjectMeta: metav1.ObjectMeta{Name: "app-b", Namespace: "argocd", UID: "5678"}}
+	sequenced := func(ev *cloudevents.Event, epoch string, number, previous uint64) *cloudevents.Event {
+		SetSequence(ev, Sequence{Epoch: epoch, Number: number, Previous: previous})
+		return ev
+	}
+
+	t.Run("Sequence survives the wire format", func(t *testing.T) {
+		ev := sequenced(es.ApplicationEvent(SpecUpdate, appA), "epoch", 7, 3)
+		pev, err := format.ToProto(ev)
+		require.NoError(t, err)
+		got, err := FromWire(pev)
+		require.NoError(t, err)
+		seq, ok := GetSequence(got.CloudEvent())
+		require.True(t, ok)
+		assert.Equal(t, Sequence{Epoch: "epoch", Number: 7, Previous: 3}, seq)
+	})
+
+	t.Run("Invalid sequences are ignored", func(t *testing.T) {
+		ev := es.ApplicationEvent(SpecUpdate, appA)
+		_, ok := GetSequence(ev)
+		assert.False(t, ok)
+		ev.SetExtension(sequenceEpoch, "epoch")
+		ev.SetExtension(sequenceNumber, "3")
+		ev.SetExtension(sequencePrevious, "3")
+		_, ok = GetSequence(ev)
+		assert.False(t, ok)
+	})
+
+	t.Run("Only changes of resources are ordered", func(t *testing.T) {
+		assert.NotEmpty(t, OrderingKey(es.ApplicationEvent(SpecUpdate, appA)))
+		assert.NotEqual(t, OrderingKey(es.ApplicationEvent(SpecUpdate, appA)), OrderingKey(es.ApplicationEvent(SpecUpdate, appB)))
+		assert.NotEqual(t, OrderingKey(es.ApplicationEvent(SpecUpdate, appA)), OrderingKey(es.ApplicationEvent(StatusUpdate, appA)))
+		assert.Equal(t, OrderingKey(es.ApplicationEvent(SpecUpdate, appA)), OrderingKey(es.ApplicationEvent(Delete, appA)))
+		assert.Empty(t, OrderingKey(es.HeartbeatEvent(Ping)))
+	})
+
+	t.Run("Older events of a resource are stale", func(t *testing.T) {
+		tr := NewSequenceTracker()
+		first := sequenced(es.ApplicationEvent(SpecUpdate, appA), "epoch", 1, 0)
+		second := sequenced(es.ApplicationEvent(SpecUpdate, appA), "epoch", 3, 1)
+		other := sequenced(es.ApplicationEvent(SpecUpdate, appB), "epoch", 2, 0)
+		assert.False(t, tr.Stale(second))
+		assert.False(t, tr.Applied(second))
+		assert.True(t, tr.Stale(first))
+		assert.True(t, tr.Stale(second))
+		assert.False(t, tr.Stale(other))
+	})
+
+	t.Run("Lost events are detected", func(t *testing.T) {
+		tr := NewSequenceTracker()
+		assert.False(t, tr.Applied(sequenced(es.ApplicationEvent(SpecUpdate, appA), "epoch", 1, 0)))
+		assert.False(t, tr.Applied(sequenced(es.ApplicationEvent(SpecUpdate, appA), "epoch", 2, 1)))
+		assert.True(t, tr.Applied(sequenced(es.ApplicationEvent(SpecUpdate, appA), "epoch", 5, 4)))
+	})
+
+	t.Run("Deleted resources are forgotten", func(t *testing.T) {
+		tr := NewSequenceTracker()
+		assert.False(t, tr.Applied(sequenced(es.ApplicationEvent(SpecUpdate, appA), "epoch", 1, 0)))
+		assert.False(t, tr.Applied(sequenced(es.ApplicationEvent(Delete, appA), "epoch", 2, 1)))
+		assert.False(t, tr.Applied(sequenced(es.ApplicationEvent(Create, appA), "epoch", 3, 0)))
+	})
+
+	t.Run("A new epoch starts over", func(t *testing.T) {
+		tr := NewSequenceTracker()
+		assert.False(t, tr.Applied(sequenced(es.ApplicationEvent(SpecUpdate, appA), "epoch1", 9, 0)))
+		ev := sequenced(es.ApplicationEvent(SpecUpdate, appA), "epoch2", 1, 0)
+		assert.False(t, tr.Stale(ev))
+		assert.False(t, tr.Applied(ev))
+	})
+
+	t.Run("Events without a sequence are never stale", func(t *testing.T) {
+		tr := NewSequenceTracker()
+		assert.False(t, tr.Applied(sequenced(es.ApplicationEvent(SpecUpdate, appA), "epoch", 9, 0)))
+		ev := es.ApplicationEvent(SpecUpdate, appA)
+		assert.False(t, tr.Stale(ev))
+		assert.False(t, tr.Applied(ev))
+	})
+
+	t.Run("Applied events are duplicates", func(t *testing.T) {
+		tr := NewSequenceTracker()
+		ev := sequenced(es.ApplicationEvent(SpecUpdate, appA), "epoch", 1, 0)
+		assert.False(t, tr.Duplicate(ev))
+		tr.Applied(ev)
+		assert.True(t, tr.Duplicate(ev))
+
+		// Events that are not ordered are recognized as well
+		ping := sequenced(es.HeartbeatEvent(Ping), "epoch", 2, 0)
+		tr.Applied(ping)
+		assert.True(t, tr.Duplicate(ping))
+
+		// A new epoch starts over
+		assert.False(t, tr.Duplicate(sequenced(es.ApplicationEvent(SpecUpdate, appA), "epoch2", 1, 0)))
+		assert.False(t, tr.Duplicate(es.ApplicationEvent(SpecUpdate, appA)))
+	})
+
+	t.Run("Only the most recent events are remembered", func(t *testing.T) {
+		tr := NewSequenceTracker()
+		for n := uint64(1); n <= DedupWindow+10; n++ {
+			tr.Applied(sequenced(es.HeartbeatEvent(Ping), "epoch", n, 0))
+		}
+		assert.False(t, tr.Duplicate(sequenced(es.HeartbeatEvent(Ping), "epoch", 10, 0)))
+		assert.True(t, tr.Duplicate(sequenced(es.HeartbeatEvent(Ping), "epoch", 11, 0)))
+		assert.True(t, tr.Duplicate(sequenced(es.HeartbeatEvent(Ping), "epoch", DedupWindow+10, 0)))
+		assert.Len(t, tr.applied, DedupWindow)
+	})
+}
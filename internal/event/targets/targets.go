@@ -36,8 +36,11 @@ const (
 	ClusterCacheInfoUpdate EventTarget = "clusterCacheInfoUpdate"
 	Repository             EventTarget = "repository"
 	GPGKey                 EventTarget = "gpgkey"
+	ArgoCDConfig           EventTarget = "argocdconfig"
+	ArgoCDSecret           EventTarget = "argocdsecret"
 	ContainerLog           EventTarget = "containerlog"
 	Heartbeat              EventTarget = "heartbeat"
 	Terminal               EventTarget = "terminal"
 	ApplicationSet         EventTarget = "applicationset"
+	Control                EventTarget = "control"
 )
@@ -0,0 +1,224 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// The data of events larger than a threshold can be transferred out of band,
+// so that bulk data does not hold up the events behind it on the event
+// stream. The sender hands the data over to a transfer channel, which
+// returns a handle for it, and sends the event with the handle instead of
+// the data. The receiver fetches the data by its handle before it processes
+// the event. Data is offloaded after it was delta encoded and encrypted, and
+// is resolved before it is decrypted and the delta is resolved.
+
+// PayloadTransferHeader is the name of the gRPC metadata a peer announces
+// that it can resolve payloads transferred out of band with. The agent sends
+// it in the request metadata of its event stream, the principal in the
+// response header.
+const PayloadTransferHeader = "x-argocd-agent-payload-transfer"
+
+// PayloadTransferVersion is the version of the out of band transfer announced
+// in a PayloadTransferHeader
+const PayloadTransferVersion = "v1"
+
+// PayloadTransferChunkSize is the size of the chunks offloaded payloads are
+// streamed in
+const PayloadTransferChunkSize = 256 * 1024
+
+const (
+	transferHandle string = "transferhandle"
+	transferDigest string = "transferdigest"
+)
+
+// ErrPayloadUnresolvable is returned for events whose offloaded payload
+// cannot be fetched, or does not match the event.
+var ErrPayloadUnresolvable error = errors.New("event payload cannot be resolved")
+
+// ParsePayloadTransfer returns whether a PayloadTransferHeader announces that
+// the peer can resolve offloaded payloads.
+func ParsePayloadTransfer(values []string) bool {
+	for _, v := range values {
+		if v == PayloadTransferVersion {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTransferThreshold parses the size above which payloads are transferred
+// out of band, which is a quantity such as 1Mi. A size of 0 disables the
+// transfer.
+func ParseTransferThreshold(size string) (int, error) {
+	q, err := resource.ParseQuantity(size)
+	if err != nil {
+		return 0, fmt.Errorf("invalid payload transfer threshold %q: %w", size, err)
+	}
+	n, ok := q.AsInt64()
+	if !ok || n < 0 || int64(int(n)) != n {
+		return 0, fmt.Errorf("invalid payload transfer threshold %q: size out of range", size)
+	}
+	return int(n), nil
+}
+
+// TransferHandle returns the handle of the offloaded payload of ev, or the
+// empty string if the payload of ev is sent inline.
+func TransferHandle(ev *cloudevents.Event) string {
+	handle, _ := ev.Extensions()[transferHandle].(string)
+	return handle
+}
+
+// PayloadTransfer offloads the data of the events sent to a peer, and
+// resolves the offloaded data of the events received from it.
+type PayloadTransfer struct {
+	// threshold is the size in bytes above which data is offloaded. A
+	// threshold of 0 never offloads data.
+	threshold int
+	// put hands data over to the transfer channel and returns its handle
+	put func(data []byte) (string, error)
+	// get returns the data with the given handle from the transfer channel
+	get func(handle string) ([]byte, error)
+}
+
+// NewPayloadTransfer returns a PayloadTransfer that offloads data larger than
+// threshold bytes with put, and fetches offloaded data with get. Either
+// function may be nil, if the transfer is used in one direction only.
+func NewPayloadTransfer(threshold int, put func(data []byte) (string, error), get func(handle string) ([]byte, error)) *PayloadTransfer {
+	return &PayloadTransfer{threshold: threshold, put: put, get: get}
+}
+
+// Offload returns a copy of ev whose data is replaced by a handle to it, if
+// the data is larger than the threshold. Other events are returned as they
+// are.
+func (t *PayloadTransfer) Offload(ev *cloudevents.Event) (*cloudevents.Event, error) {
+	data := ev.Data()
+	if t.put == nil || t.threshold <= 0 || len(data) <= t.threshold {
+		return ev, nil
+	}
+	handle, err := t.put(data)
+	if err != nil {
+		return nil, fmt.Errorf("could not offload payload: %w", err)
+	}
+	out := ev.Clone()
+	out.DataEncoded = nil
+	out.SetExtension(transferHandle, handle)
+	out.SetExtension(transferDigest, dataDigest(data))
+	return &out, nil
+}
+
+// Resolve replaces the handle of the offloaded data of ev with the data in
+// place. Events whose data is sent inline are left as they are. It returns
+// ErrPayloadUnresolvable if the data cannot be fetched, or does not match the
+// digest the sender stamped on ev.
+func (t *PayloadTransfer) Resolve(ev *cloudevents.Event) error {
+	handle := TransferHandle(ev)
+	if handle == "" {
+		return nil
+	}
+	if t.get == nil {
+		return fmt.Errorf("%w: out of band transfer is not enabled", ErrPayloadUnresolvable)
+	}
+	data, err := t.get(handle)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrPayloadUnresolvable, err)
+	}
+	if digest, _ := ev.Extensions()[transferDigest].(string); digest != dataDigest(data) {
+		return fmt.Errorf("%w: digest mismatch", ErrPayloadUnresolvable)
+	}
+	ev.DataEncoded = data
+	ev.SetExtension(transferHandle, nil)
+	ev.SetExtension(transferDigest, nil)
+	return nil
+}
+
+// PayloadStore holds payloads that were transferred out of band until they
+// are fetched, on behalf of their owners. Payloads that are not fetched
+// within the store's TTL are discarded. It is safe for concurrent use.
+type PayloadStore struct {
+	mu  sync.Mutex
+	ttl time.Duration
+	// key: owner + handle
+	// value: the payload
+	// - acquire 'mu' before accessing
+	payloads map[string]storedPayload
+}
+
+type storedPayload struct {
+	data    []byte
+	expires time.Time
+}
+
+// NewPayloadStore returns a PayloadStore that keeps payloads for ttl
+func NewPayloadStore(ttl time.Duration) *PayloadStore {
+	return &PayloadStore{ttl: ttl, payloads: map[string]storedPayload{}}
+}
+
+func payloadStoreKey(owner, handle string) string {
+	return owner + "/" + handle
+}
+
+// Put stores data on behalf of owner and returns its handle
+func (s *PayloadStore) Put(owner string, data []byte) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("could not generate payload handle: %w", err)
+	}
+	handle := hex.EncodeToString(b)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for key, p := range s.payloads {
+		if now.After(p.expires) {
+			delete(s.payloads, key)
+		}
+	}
+	s.payloads[payloadStoreKey(owner, handle)] = storedPayload{data: data, expires: now.Add(s.ttl)}
+	return handle, nil
+}
+
+// Take removes the payload with the given handle stored on behalf of owner
+// from the store, and returns it. Payloads can be taken once only.
+func (s *PayloadStore) Take(owner, handle string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := payloadStoreKey(owner, handle)
+	p, ok := s.payloads[key]
+	if !ok {
+		return nil, fmt.Errorf("unknown payload handle %s", handle)
+	}
+	delete(s.payloads, key)
+	if time.Now().After(p.expires) {
+		return nil, fmt.Errorf("payload %s expired", handle)
+	}
+	return p.data, nil
+}
+
+// Len returns the number of payloads in the store
+func (s *PayloadStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.payloads)
+}
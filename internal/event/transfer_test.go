@@ -0,0 +1,142 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_PayloadTransfer(t *testing.T) {
+	es := NewEventSource("test")
+	app := &v1alpha1.Application{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "argocd", UID: "uid", ResourceVersion: "1"},
+		Spec:       v1alpha1.ApplicationSpec{Project: strings.Repeat("p", 1024)},
+	}
+
+	// newTransfer returns the transfers of sender and receiver, which share
+	// a store
+	newTransfer := func(threshold int) (*PayloadTransfer, *PayloadTransfer, *PayloadStore) {
+		store := NewPayloadStore(time.Minute)
+		sender := NewPayloadTransfer(threshold, func(data []byte) (string, error) {
+			return store.Put("agent", data)
+		}, nil)
+		receiver := NewPayloadTransfer(0, nil, func(handle string) ([]byte, error) {
+			return store.Take("agent", handle)
+		})
+		return sender, receiver, store
+	}
+
+	t.Run("Large payloads are transferred out of band", func(t *testing.T) {
+		sender, receiver, store := newTransfer(512)
+		ev := es.ApplicationEvent(SpecUpdate, app)
+
+		pev, err := toWire(ev, false, nil, nil, sender)
+		require.NoError(t, err)
+		received, err := FromWire(pev)
+		require.NoError(t, err)
+		assert.Empty(t, received.CloudEvent().Data())
+		assert.NotEmpty(t, TransferHandle(received.CloudEvent()))
+		assert.Equal(t, 1, store.Len())
+		again := received.CloudEvent().Clone()
+
+		require.NoError(t, receiver.Resolve(received.CloudEvent()))
+		assert.Empty(t, TransferHandle(received.CloudEvent()))
+		got := &v1alpha1.Application{}
+		require.NoError(t, received.CloudEvent().DataAs(got))
+		assert.Equal(t, app, got)
+		assert.Equal(t, 0, store.Len())
+
+		// The payload can be fetched once only
+		assert.ErrorIs(t, receiver.Resolve(&again), ErrPayloadUnresolvable)
+	})
+
+	t.Run("Small payloads are sent inline", func(t *testing.T) {
+		sender, _, store := newTransfer(1 << 20)
+		ev := es.ApplicationEvent(SpecUpdate, app)
+		out, err := sender.Offload(ev)
+		require.NoError(t, err)
+		assert.Equal(t, ev, out)
+		assert.Equal(t, 0, store.Len())
+
+		disabled, _, _ := newTransfer(0)
+		out, err = disabled.Offload(ev)
+		require.NoError(t, err)
+		assert.Equal(t, ev, out)
+	})
+
+	t.Run("Payloads that do not match the event are rejected", func(t *testing.T) {
+		sender, receiver, store := newTransfer(512)
+		offloaded, err := sender.Offload(es.ApplicationEvent(SpecUpdate, app))
+		require.NoError(t, err)
+		other, err := sender.Offload(es.ApplicationEvent(StatusUpdate, app))
+		require.NoError(t, err)
+		offloaded.SetExtension(transferHandle, TransferHandle(other))
+		other.SetExtension(transferDigest, "0000")
+
+		_, err = store.Take("agent", "unknown")
+		assert.Error(t, err)
+		assert.ErrorIs(t, receiver.Resolve(other), ErrPayloadUnresolvable)
+		// The payload of other was taken already
+		assert.ErrorIs(t, receiver.Resolve(offloaded), ErrPayloadUnresolvable)
+	})
+
+	t.Run("Payloads are only resolved if the transfer is enabled", func(t *testing.T) {
+		sender, _, _ := newTransfer(512)
+		offloaded, err := sender.Offload(es.ApplicationEvent(SpecUpdate, app))
+		require.NoError(t, err)
+		assert.ErrorIs(t, sender.Resolve(offloaded), ErrPayloadUnresolvable)
+		assert.NoError(t, sender.Resolve(es.HeartbeatEvent(Ping)))
+	})
+
+	t.Run("Payloads are stored per owner until they expire", func(t *testing.T) {
+		store := NewPayloadStore(time.Millisecond)
+		handle, err := store.Put("agent", []byte("data"))
+		require.NoError(t, err)
+		_, err = store.Take("other", handle)
+		assert.Error(t, err)
+		time.Sleep(5 * time.Millisecond)
+		_, err = store.Take("agent", handle)
+		assert.Error(t, err)
+
+		_, err = store.Put("agent", []byte("data"))
+		require.NoError(t, err)
+		time.Sleep(5 * time.Millisecond)
+		_, err = store.Put("agent", []byte("data"))
+		require.NoError(t, err)
+		assert.Equal(t, 1, store.Len())
+	})
+
+	t.Run("Thresholds are quantities", func(t *testing.T) {
+		n, err := ParseTransferThreshold("1Mi")
+		require.NoError(t, err)
+		assert.Equal(t, 1<<20, n)
+		_, err = ParseTransferThreshold("-1")
+		assert.Error(t, err)
+		_, err = ParseTransferThreshold("lots")
+		assert.Error(t, err)
+	})
+
+	t.Run("Peers announce the transfer", func(t *testing.T) {
+		assert.True(t, ParsePayloadTransfer([]string{"v0", PayloadTransferVersion}))
+		assert.False(t, ParsePayloadTransfer(nil))
+	})
+}
@@ -0,0 +1,162 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+
+	"github.com/argoproj-labs/argocd-agent/internal/event/targets"
+)
+
+// ErrInvalidEvent is wrapped by the errors of events that do not conform to
+// the protocol
+var ErrInvalidEvent error = errors.New("invalid event")
+
+// maxAttributeLength is the maximum length in bytes of the value of a single
+// attribute or extension of an event. Payloads are subject to the payload
+// limits instead.
+const maxAttributeLength = 4096
+
+// requestMethods are the types of resource and log requests, which carry the
+// HTTP method of the request as their type
+var requestMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodPatch, http.MethodDelete, http.MethodOptions,
+}
+
+// ValidationError is returned for events that do not conform to the
+// protocol. It wraps both ErrInvalidEvent and ErrEventNotAllowed, so that
+// invalid events are rejected like events that are not allowed.
+type ValidationError struct {
+	// Type and Target are those of the invalid event, as far as known
+	Type   string
+	Target string
+	// Field is the attribute, extension or part of the data that is invalid,
+	// e.g. subject or data.metadata.name
+	Field string
+	// Reason describes what is wrong with the field
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%v: %s event for %s: %s %s", ErrInvalidEvent, e.Type, e.Target, e.Field, e.Reason)
+}
+
+func (e *ValidationError) Unwrap() []error {
+	return []error{ErrInvalidEvent, ErrEventNotAllowed}
+}
+
+// IsInvalidEvent returns whether err was returned for an event that does not
+// conform to the protocol
+func IsInvalidEvent(err error) bool {
+	return errors.Is(err, ErrInvalidEvent)
+}
+
+// Validate checks that ev conforms to the protocol before it is sent or
+// processed: its required attributes are set, all attributes are valid UTF-8
+// and not excessively long, its type is known for its target, and the data of
+// events that change resources is the resource they are about. Only the
+// attributes of custom events are validated. It returns a
+// *ValidationError describing the first violation found.
+func Validate(ev *cloudevents.Event) error {
+	invalid := func(field, format string, a ...any) error {
+		return &ValidationError{Type: ev.Type(), Target: ev.DataSchema(), Field: field, Reason: fmt.Sprintf(format, a...)}
+	}
+
+	attrs := map[string]string{
+		"specversion": ev.SpecVersion(),
+		"source":      ev.Source(),
+		"type":        ev.Type(),
+		"dataschema":  ev.DataSchema(),
+		"subject":     ev.Subject(),
+	}
+	for name, val := range ev.Extensions() {
+		if s, ok := val.(string); ok {
+			attrs[name] = s
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(attrs)) {
+		val := attrs[name]
+		if !utf8.ValidString(val) {
+			return invalid(name, "is not valid UTF-8")
+		}
+		if len(val) > maxAttributeLength {
+			return invalid(name, "is longer than %d bytes", maxAttributeLength)
+		}
+	}
+	for _, name := range []string{"type", "dataschema"} {
+		if attrs[name] == "" {
+			return invalid(name, "is required")
+		}
+	}
+
+	target := Target(ev)
+	if target == "" {
+		return invalid("dataschema", "is not a known event target")
+	}
+	evType := EventType(ev.Type())
+	if IsCustomTarget(target) {
+		// The types of custom events are defined by their handlers
+		return nil
+	}
+	switch target {
+	case targets.Resource, targets.ContainerLog:
+		if !slices.Contains(requestMethods, ev.Type()) && !slices.Contains(EventTypes(), evType) {
+			return invalid("type", "is neither a known event type nor a request method")
+		}
+	default:
+		if !slices.Contains(EventTypes(), evType) {
+			return invalid("type", "is not a known event type")
+		}
+	}
+
+	if _, ok := ResourceTargetGVK(target); !ok || !IsMutation(evType) {
+		return nil
+	}
+	if len(ev.Data()) == 0 {
+		return nil
+	}
+	if ct := ev.DataContentType(); ct != "" && ct != cloudevents.ApplicationJSON {
+		// Deltas and encrypted data are validated once they are resolved
+		return nil
+	}
+	obj := struct {
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+	}{}
+	if err := json.Unmarshal(ev.Data(), &obj); err != nil {
+		return invalid("data", "is not a JSON encoded resource: %v", err)
+	}
+	if obj.Metadata.Name == "" {
+		return invalid("data.metadata.name", "is required")
+	}
+	if ev.Subject() == "" {
+		return nil
+	}
+	if _, name, ok := strings.Cut(ev.Subject(), "/"); !ok || name != obj.Metadata.Name {
+		return invalid("subject", "%q does not match the resource %q", ev.Subject(), obj.Metadata.Name)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/argoproj-labs/argocd-agent/internal/event/targets"
+)
+
+func Test_Validate(t *testing.T) {
+	es := NewEventSource("test")
+	app := &v1alpha1.Application{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "argocd", UID: "uid", ResourceVersion: "1"}}
+
+	t.Run("Events of the event source are valid", func(t *testing.T) {
+		assert.NoError(t, Validate(es.ApplicationEvent(SpecUpdate, app)))
+		assert.NoError(t, Validate(es.ApplicationEvent(Delete, app)))
+		assert.NoError(t, Validate(es.HeartbeatEvent(Ping)))
+		assert.NoError(t, Validate(es.ProcessedEvent(EventProcessed, New(es.ApplicationEvent(SpecUpdate, app), targets.EventAck))))
+		req, err := es.NewResourceRequestEvent(metav1.GroupVersionResource{Version: "v1", Resource: "pods"}, "ns", "pod", "", "GET", nil, nil)
+		require.NoError(t, err)
+		assert.NoError(t, Validate(req))
+		// Events without data are left to the processor
+		ev := es.ApplicationEvent(Delete, app)
+		ev.DataEncoded = nil
+		assert.NoError(t, Validate(ev))
+	})
+
+	tests := []struct {
+		name   string
+		modify func(ev *cloudevents.Event)
+		field  string
+	}{
+		{"Missing type", func(ev *cloudevents.Event) { ev.SetType("") }, "type"},
+		{"Unknown target", func(ev *cloudevents.Event) { ev.SetDataSchema("something") }, "dataschema"},
+		{"Unknown type", func(ev *cloudevents.Event) { ev.SetType("something") }, "type"},
+		{"Request method for resources", func(ev *cloudevents.Event) { ev.SetType("GET") }, "type"},
+		{"Invalid UTF-8", func(ev *cloudevents.Event) { ev.SetSubject("argocd/\xff") }, "subject"},
+		{"Long extension", func(ev *cloudevents.Event) { ev.SetExtension("custom", strings.Repeat("a", maxAttributeLength+1)) }, "custom"},
+		{"Data is not a resource", func(ev *cloudevents.Event) { ev.DataEncoded = []byte("[1, 2]") }, "data"},
+		{"Data without name", func(ev *cloudevents.Event) { ev.DataEncoded = []byte(`{"metadata":{}}`) }, "data.metadata.name"},
+		{"Subject without name", func(ev *cloudevents.Event) { ev.SetSubject("argocd") }, "subject"},
+		{"Data of another resource", func(ev *cloudevents.Event) { ev.SetSubject("argocd/other") }, "subject"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ev := es.ApplicationEvent(SpecUpdate, app)
+			tt.modify(ev)
+			err := Validate(ev)
+			var verr *ValidationError
+			require.True(t, errors.As(err, &verr), "expected a validation error, got %v", err)
+			assert.Equal(t, tt.field, verr.Field)
+			assert.True(t, IsInvalidEvent(err))
+			assert.True(t, IsEventNotAllowed(err))
+		})
+	}
+
+	t.Run("Resource events of registered targets are validated", func(t *testing.T) {
+		require.NoError(t, RegisterResourceTarget("test-validate", corev1.SchemeGroupVersion.WithKind("ConfigMap")))
+		ev, err := es.ResourceEvent(Create, "test-validate", &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"}})
+		require.NoError(t, err)
+		assert.NoError(t, Validate(ev))
+		ev.DataEncoded = []byte(`{"metadata":{"name":""}}`)
+		assert.True(t, IsInvalidEvent(Validate(ev)))
+	})
+}
@@ -0,0 +1,148 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"strings"
+
+	"github.com/cloudevents/sdk-go/binding/format/protobuf/v2/pb"
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/argoproj-labs/argocd-agent/internal/event/targets"
+)
+
+// WireFormat is the format events are encoded in when they are sent to a peer
+type WireFormat string
+
+const (
+	// WireFormatLegacy is understood by peers of all versions. Its envelopes
+	// carry the event target as a plain name in the dataschema attribute, and
+	// the HTTP method as the type of resource requests, which does not
+	// conform to the CloudEvents specification.
+	WireFormatLegacy WireFormat = ""
+	// WireFormatCloudEvents encodes events as envelopes that conform to the
+	// CloudEvents 1.0 specification, so that they can be understood and
+	// routed by third-party tooling and brokers.
+	WireFormatCloudEvents WireFormat = "cloudevents"
+)
+
+// WireFormatHeader is the name of the gRPC metadata a peer announces the wire
+// formats it can receive in, in addition to the legacy one. The agent sends
+// it in the request metadata of its event stream, the principal in the
+// response header.
+const WireFormatHeader = "x-argocd-agent-wire-format"
+
+// DataSchemaPrefix is the prefix of the dataschema URI of events in the
+// CloudEvents wire format. It is followed by the name of the event target,
+// e.g. urn:argocd-agent:target:application.
+const DataSchemaPrefix = "urn:argocd-agent:target:"
+
+// resourceRequestType is the type of resource requests in the CloudEvents
+// wire format. The HTTP method of the request is carried in the
+// requestmethod attribute.
+const resourceRequestType = targets.TypePrefix + ".resource-request"
+
+const requestMethod string = "requestmethod"
+
+const (
+	contentTypeBatch = "application/cloudevents-batch+protobuf"
+	contentTypeChunk = "application/octet-stream"
+)
+
+const (
+	attrDataSchema      = "dataschema"
+	attrDataContentType = "datacontenttype"
+)
+
+// ParseWireFormat returns the wire format announced in a WireFormatHeader.
+// Unknown formats are reported as WireFormatLegacy.
+func ParseWireFormat(values []string) WireFormat {
+	for _, v := range values {
+		if WireFormat(v) == WireFormatCloudEvents {
+			return WireFormatCloudEvents
+		}
+	}
+	return WireFormatLegacy
+}
+
+// ToCloudEvents returns a copy of pev whose envelope conforms to the
+// CloudEvents 1.0 specification: it has an id, the dataschema attribute is an
+// absolute URI, and the type is prefixed with the reverse-DNS name of
+// argocd-agent. The changes other than the id are undone by FromCloudEvents.
+func ToCloudEvents(pev *pb.CloudEvent) *pb.CloudEvent {
+	if pev == nil {
+		return nil
+	}
+	out := proto.Clone(pev).(*pb.CloudEvent)
+	if out.Attributes == nil {
+		out.Attributes = map[string]*pb.CloudEventAttributeValue{}
+	}
+	if out.Id == "" {
+		// The event ID identifies the version of a resource, which events of
+		// different types may share. A resent event keeps its id.
+		if id := attrString(out.Attributes[eventID]); id != "" {
+			out.Id = id + "." + strings.TrimPrefix(out.Type, targets.TypePrefix+".")
+		} else {
+			out.Id = uuid.NewString()
+		}
+	}
+	if schema, ok := out.Attributes[attrDataSchema]; ok && !strings.Contains(attrString(schema), ":") {
+		out.Attributes[attrDataSchema] = &pb.CloudEventAttributeValue{
+			Attr: &pb.CloudEventAttributeValue_CeUri{CeUri: DataSchemaPrefix + attrString(schema)},
+		}
+	}
+	if !strings.HasPrefix(out.Type, targets.TypePrefix+".") {
+		out.Attributes[requestMethod] = &pb.CloudEventAttributeValue{
+			Attr: &pb.CloudEventAttributeValue_CeString{CeString: out.Type},
+		}
+		out.Type = resourceRequestType
+	}
+	return out
+}
+
+// FromCloudEvents undoes the changes ToCloudEvents made to the envelope of
+// pev in place. Events in the legacy wire format are left untouched.
+func FromCloudEvents(pev *pb.CloudEvent) {
+	if pev == nil {
+		return
+	}
+	if schema, ok := pev.Attributes[attrDataSchema]; ok {
+		if name, found := strings.CutPrefix(attrString(schema), DataSchemaPrefix); found {
+			pev.Attributes[attrDataSchema] = &pb.CloudEventAttributeValue{
+				Attr: &pb.CloudEventAttributeValue_CeUri{CeUri: name},
+			}
+		}
+	}
+	if pev.Type == resourceRequestType {
+		if method := attrString(pev.Attributes[requestMethod]); method != "" {
+			pev.Type = method
+			delete(pev.Attributes, requestMethod)
+		}
+	}
+}
+
+// attrString returns the value of a string or URI attribute
+func attrString(attr *pb.CloudEventAttributeValue) string {
+	switch v := attr.GetAttr().(type) {
+	case *pb.CloudEventAttributeValue_CeString:
+		return v.CeString
+	case *pb.CloudEventAttributeValue_CeUri:
+		return v.CeUri
+	case *pb.CloudEventAttributeValue_CeUriRef:
+		return v.CeUriRef
+	}
+	return ""
+}
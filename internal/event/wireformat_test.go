@@ -0,0 +1,119 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"testing"
+
+	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	format "github.com/cloudevents/sdk-go/binding/format/protobuf/v2"
+	"github.com/cloudevents/sdk-go/binding/format/protobuf/v2/pb"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/argoproj-labs/argocd-agent/internal/event/targets"
+)
+
+func Test_ParseWireFormat(t *testing.T) {
+	assert.Equal(t, WireFormatCloudEvents, ParseWireFormat([]string{"unknown", "cloudevents"}))
+	assert.Equal(t, WireFormatLegacy, ParseWireFormat([]string{"unknown"}))
+	assert.Equal(t, WireFormatLegacy, ParseWireFormat(nil))
+}
+
+func Test_CloudEventsWireFormat(t *testing.T) {
+	es := NewEventSource("agent-1")
+	app := &v1alpha1.Application{ObjectMeta: metav1.ObjectMeta{Name: "guestbook", Namespace: "argocd", UID: "uid-1"}}
+
+	t.Run("Envelopes conform to the CloudEvents specification", func(t *testing.T) {
+		pev, err := format.ToProto(es.ApplicationEvent(SpecUpdate, app))
+		require.NoError(t, err)
+		legacy, err := format.FromProto(pev)
+		require.NoError(t, err)
+		// A plain target name is not an absolute URI
+		assert.Error(t, legacy.Validate())
+
+		compliant, err := format.FromProto(ToCloudEvents(pev))
+		require.NoError(t, err)
+		require.NoError(t, compliant.Validate())
+		assert.Equal(t, createEventID(app.ObjectMeta)+".spec-update", compliant.ID())
+		assert.Equal(t, DataSchemaPrefix+"application", compliant.DataSchema())
+		assert.Equal(t, SpecUpdate.String(), compliant.Type())
+		assert.Equal(t, "argocd/guestbook", compliant.Subject())
+		assert.Equal(t, "application/json", compliant.DataContentType())
+	})
+
+	t.Run("Resource requests get a prefixed type", func(t *testing.T) {
+		ev, err := es.NewResourceRequestEvent(metav1.GroupVersionResource{Version: "v1", Resource: "pods"}, "default", "pod-1", "", "GET", nil, nil)
+		require.NoError(t, err)
+		pev, err := format.ToProto(ev)
+		require.NoError(t, err)
+
+		compliant, err := format.FromProto(ToCloudEvents(pev))
+		require.NoError(t, err)
+		require.NoError(t, compliant.Validate())
+		assert.Equal(t, resourceRequestType, compliant.Type())
+		assert.Equal(t, "default/pod-1", compliant.Subject())
+	})
+
+	t.Run("Conversion is undone on receipt", func(t *testing.T) {
+		ev, err := es.NewResourceRequestEvent(metav1.GroupVersionResource{Version: "v1", Resource: "pods"}, "default", "pod-1", "", "GET", nil, nil)
+		require.NoError(t, err)
+		for _, cev := range []*Event{New(es.ApplicationEvent(Create, app), targets.Application), New(ev, targets.Resource)} {
+			pev, err := format.ToProto(cev.CloudEvent())
+			require.NoError(t, err)
+			compliant := ToCloudEvents(pev)
+			assert.NotEmpty(t, compliant.Id)
+			assert.False(t, proto.Equal(pev, compliant))
+			FromCloudEvents(compliant)
+			compliant.Id = ""
+			assert.True(t, proto.Equal(pev, compliant))
+		}
+	})
+
+	t.Run("Legacy envelopes are left untouched on receipt", func(t *testing.T) {
+		pev, err := format.ToProto(es.ApplicationEvent(Create, app))
+		require.NoError(t, err)
+		received := proto.Clone(pev)
+		FromCloudEvents(received.(*pb.CloudEvent))
+		assert.True(t, proto.Equal(pev, received))
+	})
+
+	t.Run("EventWriter sends in the configured wire format", func(t *testing.T) {
+		p := &contextPipeStream{}
+		ew := NewEventWriter("test", p, logrus.NewEntry(logrus.StandardLogger()))
+		ew.SetWireFormat(WireFormatCloudEvents)
+		ew.Add(es.ApplicationEvent(Create, app))
+		ew.sendEvent(createResourceID(app.ObjectMeta), LaneControl, &frameBatch{size: ew.batchSize, format: ew.wireFormat})
+		require.Len(t, p.events, 1)
+		sent, err := format.FromProto(p.events[0].Event)
+		require.NoError(t, err)
+		assert.NoError(t, sent.Validate())
+
+		received, err := NewChunkedStream(&p.pipeStream, 0, logrus.NewEntry(logrus.StandardLogger())).Recv()
+		require.NoError(t, err)
+		assert.Equal(t, targets.Application, Target(mustFromProto(t, received.Event)))
+	})
+}
+
+func mustFromProto(t *testing.T, pev *pb.CloudEvent) *cloudevents.Event {
+	t.Helper()
+	ev, err := format.FromProto(pev)
+	require.NoError(t, err)
+	return ev
+}
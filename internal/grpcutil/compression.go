@@ -0,0 +1,151 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcutil
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/encoding/gzip"
+)
+
+const (
+	// CompressionAuto replies using whatever compressor the peer used for its
+	// request, which is the default behavior of gRPC.
+	CompressionAuto = "auto"
+	// CompressionNone disables compression of outbound messages.
+	CompressionNone = "none"
+	// CompressionGzip compresses outbound messages with gzip.
+	CompressionGzip = gzip.Name
+	// CompressionZstd compresses outbound messages with zstd.
+	CompressionZstd = "zstd"
+)
+
+func init() {
+	// The gzip compressor registers itself when its package is imported, but
+	// zstd is not shipped with gRPC, so we register our own implementation.
+	encoding.RegisterCompressor(&zstdCompressor{})
+}
+
+// ParseCompression validates the compression mode given as name and returns
+// its canonical form. An empty name is treated as CompressionAuto.
+func ParseCompression(name string) (string, error) {
+	switch name {
+	case "", CompressionAuto:
+		return CompressionAuto, nil
+	case CompressionNone, CompressionGzip, CompressionZstd:
+		return name, nil
+	default:
+		return "", fmt.Errorf("unknown compression %q, must be one of: %s, %s, %s, %s", name, CompressionAuto, CompressionNone, CompressionGzip, CompressionZstd)
+	}
+}
+
+// StreamServerCompressionInterceptor returns a gRPC stream server interceptor
+// that sets the compressor used for messages sent on each stream according
+// to mode. If the client did not advertise support for the requested
+// compressor, the stream falls back to the compressor the client used.
+func StreamServerCompressionInterceptor(mode string) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		var name string
+		switch mode {
+		case CompressionGzip, CompressionZstd:
+			name = mode
+		case CompressionNone:
+			name = encoding.Identity
+		}
+		if name != "" {
+			if err := grpc.SetSendCompressor(ss.Context(), name); err != nil {
+				logrus.WithField("method", info.FullMethod).Debugf("Could not set stream compressor: %v", err)
+			}
+		}
+		return handler(srv, ss)
+	}
+}
+
+// zstdCompressor implements encoding.Compressor using zstd. Encoders and
+// decoders are pooled, because they are expensive to create.
+type zstdCompressor struct {
+	encoders sync.Pool
+	decoders sync.Pool
+}
+
+type zstdWriter struct {
+	*zstd.Encoder
+	pool *sync.Pool
+}
+
+type zstdReader struct {
+	dec  *zstd.Decoder
+	pool *sync.Pool
+}
+
+func (c *zstdCompressor) Name() string {
+	return CompressionZstd
+}
+
+func (c *zstdCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	enc, ok := c.encoders.Get().(*zstd.Encoder)
+	if !ok {
+		var err error
+		enc, err = zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		enc.Reset(w)
+	}
+	return &zstdWriter{Encoder: enc, pool: &c.encoders}, nil
+}
+
+func (c *zstdCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	dec, ok := c.decoders.Get().(*zstd.Decoder)
+	if !ok {
+		var err error
+		dec, err = zstd.NewReader(r, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(DefaultGRPCMaxMessageSize))
+		if err != nil {
+			return nil, err
+		}
+	} else if err := dec.Reset(r); err != nil {
+		c.decoders.Put(dec)
+		return nil, err
+	}
+	return &zstdReader{dec: dec, pool: &c.decoders}, nil
+}
+
+// Close flushes the compressed data and returns the encoder to the pool.
+func (w *zstdWriter) Close() error {
+	err := w.Encoder.Close()
+	w.pool.Put(w.Encoder)
+	return err
+}
+
+// Read reads decompressed data and returns the decoder to the pool once the
+// end of the compressed stream has been reached.
+func (r *zstdReader) Read(p []byte) (int, error) {
+	if r.dec == nil {
+		return 0, io.EOF
+	}
+	n, err := r.dec.Read(p)
+	if err == io.EOF {
+		r.pool.Put(r.dec)
+		r.dec = nil
+	}
+	return n, err
+}
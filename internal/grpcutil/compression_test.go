@@ -0,0 +1,66 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcutil
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/encoding"
+)
+
+func Test_ParseCompression(t *testing.T) {
+	for in, out := range map[string]string{
+		"":     CompressionAuto,
+		"auto": CompressionAuto,
+		"none": CompressionNone,
+		"gzip": CompressionGzip,
+		"zstd": CompressionZstd,
+	} {
+		c, err := ParseCompression(in)
+		assert.NoError(t, err)
+		assert.Equal(t, out, c)
+	}
+	_, err := ParseCompression("brotli")
+	assert.Error(t, err)
+}
+
+func Test_zstdCompressor(t *testing.T) {
+	c := encoding.GetCompressor(CompressionZstd)
+	require.NotNil(t, c, "zstd compressor should be registered")
+	require.NotNil(t, encoding.GetCompressor(CompressionGzip), "gzip compressor should be registered")
+
+	payload := []byte(strings.Repeat("apiVersion: v1\nkind: ConfigMap\n", 1000))
+	// Run several times so that pooled encoders and decoders are reused
+	for range 3 {
+		var buf bytes.Buffer
+		w, err := c.Compress(&buf)
+		require.NoError(t, err)
+		_, err = w.Write(payload)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		assert.Less(t, buf.Len(), len(payload))
+
+		r, err := c.Decompress(&buf)
+		require.NoError(t, err)
+		out, err := io.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, payload, out)
+	}
+}
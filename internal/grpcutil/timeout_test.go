@@ -0,0 +1,64 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcutil
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+func Test_UnaryServerTimeoutInterceptor(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/versionapi.Version/Version"}
+	deadline := func(ctx context.Context, req interface{}) (interface{}, error) {
+		d, ok := ctx.Deadline()
+		if !ok {
+			return nil, nil
+		}
+		return time.Until(d), nil
+	}
+
+	t.Run("Sets a deadline", func(t *testing.T) {
+		resp, err := UnaryServerTimeoutInterceptor(time.Minute, nil)(context.Background(), nil, info, deadline)
+		require.NoError(t, err)
+		require.NotNil(t, resp)
+		assert.InDelta(t, time.Minute, resp.(time.Duration), float64(time.Second))
+	})
+
+	t.Run("Keeps an earlier deadline of the client", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		resp, err := UnaryServerTimeoutInterceptor(time.Minute, nil)(ctx, nil, info, deadline)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, resp.(time.Duration), time.Second)
+	})
+
+	t.Run("No deadline when disabled", func(t *testing.T) {
+		resp, err := UnaryServerTimeoutInterceptor(0, nil)(context.Background(), nil, info, deadline)
+		require.NoError(t, err)
+		assert.Nil(t, resp)
+	})
+
+	t.Run("No deadline for exempt methods", func(t *testing.T) {
+		exempt := func(fullMethod string) bool { return fullMethod == info.FullMethod }
+		resp, err := UnaryServerTimeoutInterceptor(time.Minute, exempt)(context.Background(), nil, info, deadline)
+		require.NoError(t, err)
+		assert.Nil(t, resp)
+	})
+}
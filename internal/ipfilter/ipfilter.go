@@ -0,0 +1,263 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ipfilter implements filtering of incoming connections by the
+// source IP address, using lists of allowed and denied CIDR ranges.
+package ipfilter
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/internal/informer"
+	"github.com/argoproj-labs/argocd-agent/internal/logging"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// AllowKey is the key in the filter ConfigMap holding the allowed ranges
+	AllowKey = "allow"
+	// DenyKey is the key in the filter ConfigMap holding the denied ranges
+	DenyKey = "deny"
+)
+
+// syncTimeout is the time to wait for the informer to sync before giving up
+const syncTimeout = 30 * time.Second
+
+// Rules is a set of allowed and denied address ranges
+type Rules struct {
+	Allow []netip.Prefix
+	Deny  []netip.Prefix
+}
+
+// ParseRules parses lists of allowed and denied ranges. Each range is either
+// a CIDR, such as 10.0.0.0/8, or a single IP address.
+func ParseRules(allow, deny []string) (*Rules, error) {
+	r := &Rules{}
+	var err error
+	if r.Allow, err = parsePrefixes(allow); err != nil {
+		return nil, fmt.Errorf("invalid allowed range: %w", err)
+	}
+	if r.Deny, err = parsePrefixes(deny); err != nil {
+		return nil, fmt.Errorf("invalid denied range: %w", err)
+	}
+	return r, nil
+}
+
+func parsePrefixes(ranges []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(ranges))
+	for _, s := range ranges {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, err
+		}
+		if p.Addr().Is4In6() && p.Bits() >= 96 {
+			p = netip.PrefixFrom(p.Addr().Unmap(), p.Bits()-96)
+		}
+		prefixes = append(prefixes, p.Masked())
+	}
+	return prefixes, nil
+}
+
+// Allows returns true if addr is not in any denied range and, if there are
+// allowed ranges, in at least one of them.
+func (r *Rules) Allows(addr netip.Addr) bool {
+	addr = addr.Unmap().WithZone("")
+	for _, p := range r.Deny {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+	if len(r.Allow) == 0 {
+		return true
+	}
+	for _, p := range r.Allow {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter decides whether connections are accepted. Its rules can be replaced
+// at runtime from a ConfigMap using WatchConfigMap. The zero value is not
+// usable, use NewFilter.
+type Filter struct {
+	base    *Rules
+	current atomic.Pointer[Rules]
+}
+
+// NewFilter returns a Filter using base as its rules, until they are
+// replaced by the rules from a ConfigMap.
+func NewFilter(base *Rules) *Filter {
+	if base == nil {
+		base = &Rules{}
+	}
+	f := &Filter{base: base}
+	f.current.Store(base)
+	return f
+}
+
+// Allows returns true if a connection from addr is allowed. Connections from
+// addresses that are not IP addresses are allowed, because they cannot come
+// in over the network.
+func (f *Filter) Allows(addr net.Addr) bool {
+	ap, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		return true
+	}
+	return f.current.Load().Allows(ap.Addr())
+}
+
+// Load replaces the rules of the filter with those parsed from data, which is
+// expected to be the data of a filter ConfigMap. Both keys hold ranges
+// separated by commas or newlines. If data is nil, the base rules are
+// restored. If data cannot be parsed, the current rules are kept.
+func (f *Filter) Load(data map[string]string) {
+	if data == nil {
+		f.current.Store(f.base)
+		log().Info("Restored IP filter rules from configuration")
+		return
+	}
+	r, err := ParseRules(splitRanges(data[AllowKey]), splitRanges(data[DenyKey]))
+	if err != nil {
+		log().WithError(err).Error("Keeping current IP filter rules due to invalid ConfigMap")
+		return
+	}
+	f.current.Store(r)
+	log().WithFields(logrus.Fields{
+		"allow": len(r.Allow),
+		"deny":  len(r.Deny),
+	}).Info("Loaded IP filter rules")
+}
+
+func splitRanges(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == '\n'
+	})
+}
+
+// Listener returns a net.Listener that closes connections which are not
+// allowed by the filter right after accepting them.
+func (f *Filter) Listener(l net.Listener) net.Listener {
+	return &listener{Listener: l, filter: f}
+}
+
+type listener struct {
+	net.Listener
+	filter *Filter
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if l.filter.Allows(c.RemoteAddr()) {
+			return c, nil
+		}
+		log().WithField("address", c.RemoteAddr().String()).Debug("Rejecting connection")
+		_ = c.Close()
+	}
+}
+
+// WatchConfigMap keeps the rules of the filter in sync with the ConfigMap of
+// the given name in namespace. It starts an informer in the background, which
+// is stopped when ctx is done, and waits for the initial sync before
+// returning.
+//
+// While the ConfigMap does not exist, the base rules are used.
+func (f *Filter) WatchConfigMap(ctx context.Context, kubeclient kubernetes.Interface, namespace, name string) error {
+	selector := fields.OneTermEqualSelector("metadata.name", name).String()
+	inf, err := informer.NewInformer[*corev1.ConfigMap](ctx,
+		informer.WithListHandler[*corev1.ConfigMap](func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+			opts.FieldSelector = selector
+			return kubeclient.CoreV1().ConfigMaps(namespace).List(ctx, opts)
+		}),
+		informer.WithWatchHandler[*corev1.ConfigMap](func(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+			opts.FieldSelector = selector
+			return kubeclient.CoreV1().ConfigMaps(namespace).Watch(ctx, opts)
+		}),
+		informer.WithAddHandler(func(cm *corev1.ConfigMap) {
+			if cm.Name == name {
+				f.Load(nonNil(cm.Data))
+			}
+		}),
+		informer.WithUpdateHandler(func(_ *corev1.ConfigMap, cm *corev1.ConfigMap) {
+			if cm.Name == name {
+				f.Load(nonNil(cm.Data))
+			}
+		}),
+		informer.WithDeleteHandler(func(cm *corev1.ConfigMap) {
+			if cm.Name == name {
+				f.Load(nil)
+			}
+		}),
+		informer.WithGroupResource[*corev1.ConfigMap]("", "configmaps"),
+	)
+	if err != nil {
+		return fmt.Errorf("could not create IP filter informer: %w", err)
+	}
+
+	go func() {
+		if err := inf.Start(ctx); err != nil {
+			log().WithError(err).Error("Could not start IP filter informer")
+		}
+	}()
+
+	syncCtx, cancel := context.WithTimeout(ctx, syncTimeout)
+	defer cancel()
+	if err := inf.WaitForSync(syncCtx); err != nil {
+		return fmt.Errorf("IP filter informer did not sync: %w", err)
+	}
+	log().Infof("Watching ConfigMap %s/%s for IP filter rules", namespace, name)
+	return nil
+}
+
+// nonNil returns data, or an empty map if data is nil, so that an existing
+// but empty ConfigMap is not mistaken for a deleted one.
+func nonNil(data map[string]string) map[string]string {
+	if data == nil {
+		return map[string]string{}
+	}
+	return data
+}
+
+func log() *logrus.Entry {
+	return logging.GetDefaultLogger().ComponentLogger("IPFilter")
+}
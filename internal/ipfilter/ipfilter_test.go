@@ -0,0 +1,176 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipfilter
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+func tcpAddr(s string) net.Addr {
+	return net.TCPAddrFromAddrPort(netip.MustParseAddrPort(s))
+}
+
+func Test_ParseRules(t *testing.T) {
+	t.Run("CIDRs and single addresses", func(t *testing.T) {
+		r, err := ParseRules([]string{"10.0.0.0/8", " 192.0.2.1 ", "2001:db8::/32", ""}, []string{"10.1.0.0/16"})
+		require.NoError(t, err)
+		assert.Equal(t, []netip.Prefix{
+			netip.MustParsePrefix("10.0.0.0/8"),
+			netip.MustParsePrefix("192.0.2.1/32"),
+			netip.MustParsePrefix("2001:db8::/32"),
+		}, r.Allow)
+		assert.Equal(t, []netip.Prefix{netip.MustParsePrefix("10.1.0.0/16")}, r.Deny)
+	})
+
+	t.Run("Invalid ranges", func(t *testing.T) {
+		_, err := ParseRules([]string{"10.0.0.0/33"}, nil)
+		assert.ErrorContains(t, err, "invalid allowed range")
+		_, err = ParseRules(nil, []string{"not-an-ip"})
+		assert.ErrorContains(t, err, "invalid denied range")
+	})
+}
+
+func Test_Allows(t *testing.T) {
+	r, err := ParseRules([]string{"10.0.0.0/8", "2001:db8::/32"}, []string{"10.1.0.0/16"})
+	require.NoError(t, err)
+	f := NewFilter(r)
+
+	for _, tt := range []struct {
+		addr    string
+		allowed bool
+	}{
+		{"10.0.0.1:1234", true},
+		{"10.1.0.1:1234", false},
+		{"192.0.2.1:1234", false},
+		{"[::ffff:10.0.0.1]:1234", true},
+		{"[2001:db8::1]:1234", true},
+		{"[2001:db9::1]:1234", false},
+	} {
+		assert.Equal(t, tt.allowed, f.Allows(tcpAddr(tt.addr)), tt.addr)
+	}
+
+	t.Run("No rules allow everything", func(t *testing.T) {
+		assert.True(t, NewFilter(nil).Allows(tcpAddr("192.0.2.1:1234")))
+	})
+
+	t.Run("Deny only", func(t *testing.T) {
+		r, err := ParseRules(nil, []string{"192.0.2.0/24"})
+		require.NoError(t, err)
+		f := NewFilter(r)
+		assert.False(t, f.Allows(tcpAddr("192.0.2.1:1234")))
+		assert.True(t, f.Allows(tcpAddr("198.51.100.1:1234")))
+	})
+
+	t.Run("Non IP addresses are allowed", func(t *testing.T) {
+		assert.True(t, f.Allows(&net.UnixAddr{Name: "/tmp/sock", Net: "unix"}))
+	})
+}
+
+func Test_Load(t *testing.T) {
+	base, err := ParseRules([]string{"10.0.0.0/8"}, nil)
+	require.NoError(t, err)
+	f := NewFilter(base)
+	assert.False(t, f.Allows(tcpAddr("192.0.2.1:1234")))
+
+	f.Load(map[string]string{AllowKey: "192.0.2.0/24,\n198.51.100.0/24\n"})
+	assert.True(t, f.Allows(tcpAddr("192.0.2.1:1234")))
+	assert.False(t, f.Allows(tcpAddr("10.0.0.1:1234")))
+
+	// Invalid data keeps the current rules
+	f.Load(map[string]string{DenyKey: "invalid"})
+	assert.True(t, f.Allows(tcpAddr("192.0.2.1:1234")))
+
+	// An empty ConfigMap allows everything
+	f.Load(map[string]string{})
+	assert.True(t, f.Allows(tcpAddr("10.0.0.1:1234")))
+	assert.True(t, f.Allows(tcpAddr("203.0.113.1:1234")))
+
+	// Nil restores the base rules
+	f.Load(nil)
+	assert.True(t, f.Allows(tcpAddr("10.0.0.1:1234")))
+	assert.False(t, f.Allows(tcpAddr("192.0.2.1:1234")))
+}
+
+func Test_Listener(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	r, err := ParseRules(nil, []string{"127.0.0.1"})
+	require.NoError(t, err)
+	f := NewFilter(r)
+	fl := f.Listener(l)
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, err := fl.Accept()
+		if err == nil {
+			accepted <- c
+		}
+	}()
+
+	c, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer c.Close()
+	// The connection is closed by the listener without being accepted
+	_ = c.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = c.Read(make([]byte, 1))
+	assert.Error(t, err)
+	select {
+	case <-accepted:
+		t.Fatal("connection should not have been accepted")
+	default:
+	}
+
+	// Once allowed, connections are accepted
+	f.Load(map[string]string{})
+	c2, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer c2.Close()
+	select {
+	case ac := <-accepted:
+		ac.Close()
+	case <-time.After(2 * time.Second):
+		t.Fatal("connection should have been accepted")
+	}
+}
+
+func Test_WatchConfigMap(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	kubeclient := kubefake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "ipfilter", Namespace: "argocd"},
+		Data:       map[string]string{DenyKey: "192.0.2.0/24"},
+	})
+	f := NewFilter(nil)
+	require.NoError(t, f.WatchConfigMap(ctx, kubeclient, "argocd", "ipfilter"))
+	assert.False(t, f.Allows(tcpAddr("192.0.2.1:1234")))
+
+	err := kubeclient.CoreV1().ConfigMaps("argocd").Delete(ctx, "ipfilter", metav1.DeleteOptions{})
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return f.Allows(tcpAddr("192.0.2.1:1234"))
+	}, 2*time.Second, 10*time.Millisecond)
+}
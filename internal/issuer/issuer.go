@@ -20,13 +20,17 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// PrincipalIssuerName is the name of the issuer of tokens handed out by the
+// principal.
+const PrincipalIssuerName = "argocd-agent-server"
+
 type Claims interface {
 	jwt.Claims
 }
 
 type Issuer interface {
-	IssueAccessToken(client string, exp time.Duration) (string, error)
-	IssueRefreshToken(client string, exp time.Duration) (string, error)
+	IssueAccessToken(client string, exp time.Duration, opts ...TokenOption) (string, error)
+	IssueRefreshToken(client string, exp time.Duration, opts ...TokenOption) (string, error)
 	ValidateAccessToken(token string) (Claims, error)
 	ValidateRefreshToken(token string) (Claims, error)
 	IssueResourceProxyToken(agentName string) (string, error)
@@ -0,0 +1,131 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package issuer
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"sort"
+)
+
+// JSONWebKey is the JWK representation of a public key as defined in
+// RFC 7517 and RFC 8037.
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	// N and E are set for RSA keys
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Curve and X are set for ECDSA and Ed25519 keys, Y for ECDSA keys only
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+	Y     string `json:"y,omitempty"`
+}
+
+// JSONWebKeySet is a set of JSONWebKeys as defined in RFC 7517.
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// KeySetProvider is implemented by issuers that can publish the public keys
+// used to validate their tokens.
+type KeySetProvider interface {
+	JWKS() JSONWebKeySet
+}
+
+var _ KeySetProvider = &JwtIssuer{}
+
+// KeyID returns the ID of the given public key, which is its JWK thumbprint
+// as defined in RFC 7638. For unsupported key types, the empty string is
+// returned.
+func KeyID(key crypto.PublicKey) string {
+	jwk, ok := toJSONWebKey(key)
+	if !ok {
+		return ""
+	}
+	// Members must be in lexicographical order and without whitespace
+	var canonical string
+	switch jwk.KeyType {
+	case "RSA":
+		canonical = fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, jwk.E, jwk.N)
+	case "EC":
+		canonical = fmt.Sprintf(`{"crv":"%s","kty":"EC","x":"%s","y":"%s"}`, jwk.Curve, jwk.X, jwk.Y)
+	case "OKP":
+		canonical = fmt.Sprintf(`{"crv":"%s","kty":"OKP","x":"%s"}`, jwk.Curve, jwk.X)
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// toJSONWebKey returns the key type specific members of the JWK for key
+func toJSONWebKey(key crypto.PublicKey) (JSONWebKey, bool) {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return JSONWebKey{KeyType: "RSA", N: encodeBigInt(k.N), E: encodeExponent(k.E)}, true
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		return JSONWebKey{
+			KeyType: "EC",
+			Curve:   k.Curve.Params().Name,
+			X:       base64.RawURLEncoding.EncodeToString(k.X.FillBytes(make([]byte, size))),
+			Y:       base64.RawURLEncoding.EncodeToString(k.Y.FillBytes(make([]byte, size))),
+		}, true
+	case ed25519.PublicKey:
+		return JSONWebKey{KeyType: "OKP", Curve: "Ed25519", X: base64.RawURLEncoding.EncodeToString(k)}, true
+	default:
+		return JSONWebKey{}, false
+	}
+}
+
+// JWKS returns the set of public keys accepted by the issuer, including any
+// verification keys of previous signing keys.
+func (i *JwtIssuer) JWKS() JSONWebKeySet {
+	ks := JSONWebKeySet{Keys: make([]JSONWebKey, 0, len(i.keys))}
+	for kid, key := range i.keys {
+		jwk, ok := toJSONWebKey(key)
+		method, err := signingMethodForKey(key)
+		if !ok || err != nil {
+			continue
+		}
+		jwk.Use = "sig"
+		jwk.Algorithm = method.Alg()
+		jwk.KeyID = kid
+		ks.Keys = append(ks.Keys, jwk)
+	}
+	// Keep the output stable, with the current key first
+	sort.Slice(ks.Keys, func(a, b int) bool {
+		if ks.Keys[a].KeyID == i.keyID || ks.Keys[b].KeyID == i.keyID {
+			return ks.Keys[a].KeyID == i.keyID
+		}
+		return ks.Keys[a].KeyID < ks.Keys[b].KeyID
+	})
+	return ks
+}
+
+func encodeBigInt(n *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(n.Bytes())
+}
+
+func encodeExponent(e int) string {
+	return encodeBigInt(big.NewInt(int64(e)))
+}
@@ -0,0 +1,149 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package issuer
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_KeyRotation(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	oldIssuer, err := NewIssuer("server", WithRSAPrivateKey(oldKey))
+	require.NoError(t, err)
+	oldTok, err := oldIssuer.IssueAccessToken("agent", time.Minute)
+	require.NoError(t, err)
+
+	t.Run("Token carries kid header", func(t *testing.T) {
+		tok, _, err := jwt.NewParser().ParseUnverified(oldTok, jwt.MapClaims{})
+		require.NoError(t, err)
+		assert.Equal(t, KeyID(&oldKey.PublicKey), tok.Header["kid"])
+	})
+
+	t.Run("Old token is valid after rotation", func(t *testing.T) {
+		i, err := NewIssuer("server", WithRSAPrivateKey(newKey), WithVerificationKeys(&oldKey.PublicKey))
+		require.NoError(t, err)
+		_, err = i.ValidateAccessToken(oldTok)
+		assert.NoError(t, err)
+		newTok, err := i.IssueAccessToken("agent", time.Minute)
+		require.NoError(t, err)
+		_, err = i.ValidateAccessToken(newTok)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Old token is invalid once old key is removed", func(t *testing.T) {
+		i, err := NewIssuer("server", WithRSAPrivateKey(newKey))
+		require.NoError(t, err)
+		_, err = i.ValidateAccessToken(oldTok)
+		assert.ErrorContains(t, err, jwt.ErrSignatureInvalid.Error())
+	})
+
+	t.Run("Token without kid is validated against current key", func(t *testing.T) {
+		tok, err := signedTokenWithClaims(jwt.SigningMethodRS512, newKey, jwt.RegisteredClaims{
+			Issuer:    "server",
+			Subject:   "agent",
+			Audience:  jwt.ClaimStrings{"server-access"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		})
+		require.NoError(t, err)
+		i, err := NewIssuer("server", WithRSAPrivateKey(newKey), WithVerificationKeys(&oldKey.PublicKey))
+		require.NoError(t, err)
+		_, err = i.ValidateAccessToken(tok)
+		assert.NoError(t, err)
+	})
+
+	t.Run("ECDSA verification key", func(t *testing.T) {
+		ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		_, err = NewIssuer("server", WithRSAPrivateKey(newKey), WithVerificationKeys(&ecKey.PublicKey))
+		assert.NoError(t, err)
+	})
+
+	t.Run("Unsupported verification key", func(t *testing.T) {
+		ecKey, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+		require.NoError(t, err)
+		_, err = NewIssuer("server", WithRSAPrivateKey(newKey), WithVerificationKeys(&ecKey.PublicKey))
+		assert.ErrorContains(t, err, "unsupported elliptic curve P-224")
+	})
+}
+
+func Test_JWKS(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	i, err := NewIssuer("server", WithRSAPrivateKey(newKey), WithVerificationKeys(&oldKey.PublicKey))
+	require.NoError(t, err)
+
+	ks := i.JWKS()
+	require.Len(t, ks.Keys, 2)
+	assert.Equal(t, KeyID(&newKey.PublicKey), ks.Keys[0].KeyID)
+	assert.Equal(t, KeyID(&oldKey.PublicKey), ks.Keys[1].KeyID)
+	for _, k := range ks.Keys {
+		assert.Equal(t, "RSA", k.KeyType)
+		assert.Equal(t, "RS512", k.Algorithm)
+		assert.Equal(t, "AQAB", k.E)
+	}
+	assert.NotEqual(t, KeyID(&oldKey.PublicKey), KeyID(&newKey.PublicKey))
+}
+
+func Test_JWKS_KeyTypes(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	i, err := NewIssuer("server", WithPrivateKey(ecKey), WithVerificationKeys(edPub))
+	require.NoError(t, err)
+
+	ks := i.JWKS()
+	require.Len(t, ks.Keys, 2)
+	ec := ks.Keys[0]
+	assert.Equal(t, KeyID(&ecKey.PublicKey), ec.KeyID)
+	assert.Equal(t, "EC", ec.KeyType)
+	assert.Equal(t, "ES384", ec.Algorithm)
+	assert.Equal(t, "P-384", ec.Curve)
+	assert.Len(t, ec.X, 64)
+	assert.Len(t, ec.Y, 64)
+	assert.Empty(t, ec.N)
+
+	ed := ks.Keys[1]
+	assert.Equal(t, KeyID(edKey.Public()), ed.KeyID)
+	assert.Equal(t, "OKP", ed.KeyType)
+	assert.Equal(t, "EdDSA", ed.Algorithm)
+	assert.Equal(t, "Ed25519", ed.Curve)
+	assert.Empty(t, ed.Y)
+}
+
+func Test_KeyID(t *testing.T) {
+	// Test vector from RFC 8037, appendix A.3
+	x, err := base64.RawURLEncoding.DecodeString("11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo")
+	require.NoError(t, err)
+	assert.Equal(t, "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k", KeyID(ed25519.PublicKey(x)))
+	assert.Empty(t, KeyID("not a key"))
+}
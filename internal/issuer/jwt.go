@@ -16,6 +16,8 @@ package issuer
 
 import (
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
@@ -37,6 +39,13 @@ var _ Issuer = &JwtIssuer{}
 // should not be configured with both, a private and a public key. For Issuers
 // with a private key, the public key for validation will be derived from the
 // private key.
+//
+// Keys may be RSA, ECDSA (P-256, P-384 or P-521) or Ed25519 keys, and tokens
+// are signed with RS512, ES256, ES384, ES512 or EdDSA respectively.
+//
+// To support rotation of the signing key, issued tokens carry the ID of the
+// signing key in their kid header, and the JwtIssuer can be configured with
+// additional keys that are only used for validation.
 type JwtIssuer struct {
 	name       string
 	privateKey crypto.PrivateKey
@@ -44,20 +53,37 @@ type JwtIssuer struct {
 	atAudience string
 	rtAudience string
 	rpAudience string
+	btAudience string
 	clock      clock.Clock
+	// keyID is the ID of the current key
+	keyID string
+	// method is the signing method of the current key
+	method jwt.SigningMethod
+	// verificationKeys are additional public keys that are accepted for
+	// validation of tokens, e.g. keys that have been rotated out.
+	verificationKeys []crypto.PublicKey
+	// keys maps key IDs to all public keys known to this issuer
+	keys map[string]crypto.PublicKey
 }
 
 // JwtIssuerOption is a function to set options for the Issuer
 type JwtIssuerOption func(i *JwtIssuer) error
 
-// WithRSAPrivateKey sets the private RSA for the Issuer
-func WithRSAPrivateKey(key crypto.PrivateKey) JwtIssuerOption {
+// WithPrivateKey sets the private key for the Issuer, which may be an RSA,
+// ECDSA or Ed25519 key
+func WithPrivateKey(key crypto.PrivateKey) JwtIssuerOption {
 	return func(i *JwtIssuer) error {
 		i.privateKey = key
 		return nil
 	}
 }
 
+// WithRSAPrivateKey sets the private RSA for the Issuer. It is kept for
+// compatibility, and behaves the same as WithPrivateKey.
+func WithRSAPrivateKey(key crypto.PrivateKey) JwtIssuerOption {
+	return WithPrivateKey(key)
+}
+
 func WithRSAPublicKey(key crypto.PublicKey) JwtIssuerOption {
 	return func(i *JwtIssuer) error {
 		i.publicKey = key
@@ -65,6 +91,26 @@ func WithRSAPublicKey(key crypto.PublicKey) JwtIssuerOption {
 	}
 }
 
+// WithVerificationKeys adds public keys that are accepted when validating
+// tokens, but never used for signing. This allows tokens signed with a
+// previous key to stay valid after the signing key has been rotated.
+func WithVerificationKeys(keys ...crypto.PublicKey) JwtIssuerOption {
+	return func(i *JwtIssuer) error {
+		i.verificationKeys = append(i.verificationKeys, keys...)
+		return nil
+	}
+}
+
+// WithSigner configures the Issuer to sign tokens using signer instead of
+// holding a private key in memory. The signer may use an RSA, ECDSA or
+// Ed25519 key, and is typically backed by an external key management system.
+func WithSigner(signer crypto.Signer) JwtIssuerOption {
+	return func(i *JwtIssuer) error {
+		i.privateKey = signer
+		return nil
+	}
+}
+
 // WithRSAPrivateKeyFromFile loads a PEM-encoded RSA private key from path and
 // sets it as the private RSA key for the Issuer
 func WithRSAPrivateKeyFromFile(path string) JwtIssuerOption {
@@ -115,6 +161,7 @@ func NewIssuer(name string, opts ...JwtIssuerOption) (*JwtIssuer, error) {
 		atAudience: name + "-access",
 		rtAudience: name + "-refresh",
 		rpAudience: name + "-resource-proxy",
+		btAudience: name + "-bootstrap",
 		clock:      clock.StandardClock(),
 	}
 	for _, o := range opts {
@@ -122,20 +169,124 @@ func NewIssuer(name string, opts ...JwtIssuerOption) (*JwtIssuer, error) {
 			return nil, err
 		}
 	}
+	if err := iss.initKeys(); err != nil {
+		return nil, err
+	}
 	return iss, nil
 }
 
+// initKeys computes the IDs of the current key and all verification keys,
+// and determines the signing method of the current key.
+func (i *JwtIssuer) initKeys() error {
+	i.keys = make(map[string]crypto.PublicKey)
+	var current crypto.PublicKey
+	if i.publicKey != nil {
+		current = i.publicKey
+	} else if i.privateKey != nil {
+		signer, ok := i.privateKey.(crypto.Signer)
+		if !ok {
+			return fmt.Errorf("private key of type %T cannot be used for signing", i.privateKey)
+		}
+		current = signer.Public()
+	}
+	if current != nil {
+		method, err := signingMethodForKey(current)
+		if err != nil {
+			return fmt.Errorf("signing key: %w", err)
+		}
+		i.method = method
+		i.keyID = KeyID(current)
+		i.keys[i.keyID] = current
+	}
+	for _, k := range i.verificationKeys {
+		if _, err := signingMethodForKey(k); err != nil {
+			return fmt.Errorf("verification key: %w", err)
+		}
+		i.keys[KeyID(k)] = k
+	}
+	return nil
+}
+
+// signingMethodForKey returns the method tokens signed by the private key
+// belonging to pub are signed with.
+func signingMethodForKey(pub crypto.PublicKey) (jwt.SigningMethod, error) {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS512, nil
+	case *ecdsa.PublicKey:
+		switch k.Curve.Params().Name {
+		case "P-256":
+			return jwt.SigningMethodES256, nil
+		case "P-384":
+			return jwt.SigningMethodES384, nil
+		case "P-521":
+			return jwt.SigningMethodES512, nil
+		}
+		return nil, fmt.Errorf("unsupported elliptic curve %s", k.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", pub)
+	}
+}
+
+// validMethods are the signing methods accepted for tokens. Which method is
+// accepted for a particular token depends on the key it was signed with.
+var validMethods = []string{
+	jwt.SigningMethodRS512.Alg(),
+	jwt.SigningMethodES256.Alg(),
+	jwt.SigningMethodES384.Alg(),
+	jwt.SigningMethodES512.Alg(),
+	jwt.SigningMethodEdDSA.Alg(),
+}
+
+// sign signs a token with the given claims using the current key, and stamps
+// the key's ID into the token's kid header.
+func (i *JwtIssuer) sign(claims jwt.Claims) (string, error) {
+	if i.privateKey == nil || i.method == nil {
+		return "", fmt.Errorf("issuer has no signing key")
+	}
+	method := i.method
+	switch i.privateKey.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey:
+	default:
+		// The key is held outside the process and only available as a
+		// crypto.Signer
+		method = signerSigningMethodFor(method)
+	}
+	t := jwt.NewWithClaims(method, claims)
+	if i.keyID != "" {
+		t.Header["kid"] = i.keyID
+	}
+	return t.SignedString(i.privateKey)
+}
+
 func (i *JwtIssuer) validationKey(t *jwt.Token) (interface{}, error) {
+	// Tokens issued before key IDs were introduced have no kid header.
+	// These, and tokens with a kid we don't know, are validated against
+	// the current key.
 	var pubKey crypto.PublicKey
-	switch t.Method {
-	case jwt.SigningMethodRS512:
+	if kid, ok := t.Header["kid"].(string); ok {
+		pubKey = i.keys[kid]
+	}
+	if pubKey == nil {
 		if i.publicKey != nil {
 			pubKey = i.publicKey
 		} else {
-			pubKey = &i.privateKey.(*rsa.PrivateKey).PublicKey
+			pubKey = i.keys[i.keyID]
 		}
-	default:
-		return nil, fmt.Errorf("token isn't signed with %s method", jwt.SigningMethodRS512)
+	}
+	if pubKey == nil {
+		return nil, fmt.Errorf("no key to validate token")
+	}
+	// A key is only accepted for the method it is used with, so that a
+	// token cannot choose a different algorithm for the same key.
+	method, err := signingMethodForKey(pubKey)
+	if err != nil {
+		return nil, err
+	}
+	if t.Method.Alg() != method.Alg() {
+		return nil, fmt.Errorf("token isn't signed with %s method", method.Alg())
 	}
 
 	return pubKey, nil
@@ -145,7 +296,7 @@ func (i *JwtIssuer) validateToken(token string, aud string) (jwt.Claims, error)
 	t, err := jwt.Parse(token, i.validationKey,
 		jwt.WithAudience(aud),
 		jwt.WithIssuer(i.name),
-		jwt.WithValidMethods([]string{jwt.SigningMethodRS512.Name}),
+		jwt.WithValidMethods(validMethods),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("could not validate token: %w", err)
@@ -154,11 +305,12 @@ func (i *JwtIssuer) validateToken(token string, aud string) (jwt.Claims, error)
 	return t.Claims, nil
 }
 
-// IssueAccessToken creates and signs a new refresh token for client, which is
-// valid for the duration specified as exp. The result is returned as a string.
-func (i *JwtIssuer) IssueAccessToken(client string, exp time.Duration) (string, error) {
+// IssueAccessToken creates and signs a new access token for client, which is
+// valid for the duration specified as exp. Additional audiences and scopes
+// can be set using opts. The result is returned as a string.
+func (i *JwtIssuer) IssueAccessToken(client string, exp time.Duration, opts ...TokenOption) (string, error) {
 	now := i.clock.Now()
-	t := jwt.NewWithClaims(jwt.SigningMethodRS512, jwt.RegisteredClaims{
+	claims := &tokenClaims{RegisteredClaims: jwt.RegisteredClaims{
 		ID:        uuid.New().String(),
 		Issuer:    i.name,
 		Subject:   client,
@@ -166,15 +318,19 @@ func (i *JwtIssuer) IssueAccessToken(client string, exp time.Duration) (string,
 		NotBefore: jwt.NewNumericDate(now),
 		IssuedAt:  jwt.NewNumericDate(now),
 		ExpiresAt: jwt.NewNumericDate(now.Add(exp)),
-	})
-	return t.SignedString(i.privateKey)
+	}}
+	for _, o := range opts {
+		o(claims)
+	}
+	return i.sign(claims)
 }
 
 // IssueRefreshToken creates and signs a new refresh token for client, which is
-// valid for the duration specified as exp. The result is returned as a string.
-func (i *JwtIssuer) IssueRefreshToken(client string, exp time.Duration) (string, error) {
+// valid for the duration specified as exp. Additional audiences and scopes
+// can be set using opts. The result is returned as a string.
+func (i *JwtIssuer) IssueRefreshToken(client string, exp time.Duration, opts ...TokenOption) (string, error) {
 	now := i.clock.Now()
-	t := jwt.NewWithClaims(jwt.SigningMethodRS512, jwt.RegisteredClaims{
+	claims := &tokenClaims{RegisteredClaims: jwt.RegisteredClaims{
 		ID:        uuid.New().String(),
 		Issuer:    i.name,
 		Subject:   client,
@@ -182,8 +338,11 @@ func (i *JwtIssuer) IssueRefreshToken(client string, exp time.Duration) (string,
 		NotBefore: jwt.NewNumericDate(now),
 		IssuedAt:  jwt.NewNumericDate(now),
 		ExpiresAt: jwt.NewNumericDate(now.Add(exp)),
-	})
-	return t.SignedString(i.privateKey)
+	}}
+	for _, o := range opts {
+		o(claims)
+	}
+	return i.sign(claims)
 }
 
 // ValidateAccessToken validates an access token. On successful validation,
@@ -205,7 +364,7 @@ func (i *JwtIssuer) ValidateRefreshToken(token string) (Claims, error) {
 // The agent name is stored in the Subject claim.
 func (i *JwtIssuer) IssueResourceProxyToken(agentName string) (string, error) {
 	now := i.clock.Now()
-	t := jwt.NewWithClaims(jwt.SigningMethodRS512, jwt.RegisteredClaims{
+	return i.sign(jwt.RegisteredClaims{
 		ID:        uuid.New().String(),
 		Issuer:    i.name,
 		Subject:   agentName,
@@ -213,7 +372,6 @@ func (i *JwtIssuer) IssueResourceProxyToken(agentName string) (string, error) {
 		NotBefore: jwt.NewNumericDate(now),
 		IssuedAt:  jwt.NewNumericDate(now),
 	})
-	return t.SignedString(i.privateKey)
 }
 
 // ValidateResourceProxyToken validates a resource proxy token. On successful validation,
@@ -222,3 +380,27 @@ func (i *JwtIssuer) IssueResourceProxyToken(agentName string) (string, error) {
 func (i *JwtIssuer) ValidateResourceProxyToken(token string) (Claims, error) {
 	return i.validateToken(token, i.rpAudience)
 }
+
+// IssueBootstrapToken creates and signs a one-time token that allows the agent
+// agentName to onboard itself. The token is valid for the duration specified
+// as exp. The agent name is stored in the Subject claim.
+func (i *JwtIssuer) IssueBootstrapToken(agentName string, exp time.Duration) (string, error) {
+	now := i.clock.Now()
+	return i.sign(jwt.RegisteredClaims{
+		ID:        uuid.New().String(),
+		Issuer:    i.name,
+		Subject:   agentName,
+		Audience:  jwt.ClaimStrings{i.btAudience},
+		NotBefore: jwt.NewNumericDate(now),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(exp)),
+	})
+}
+
+// ValidateBootstrapToken validates a bootstrap token. On successful
+// validation, it returns the claims from the token containing the agent name
+// in the Subject. If validation fails, an error with the failure reason is
+// returned.
+func (i *JwtIssuer) ValidateBootstrapToken(token string) (Claims, error) {
+	return i.validateToken(token, i.btAudience)
+}
@@ -15,6 +15,10 @@
 package issuer
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
@@ -304,3 +308,77 @@ func Test_ResourceProxyToken(t *testing.T) {
 		assert.Nil(t, c)
 	})
 }
+
+// opaqueSigner hides the type of the key behind it, like signers backed by
+// an external key management system do.
+type opaqueSigner struct {
+	crypto.Signer
+}
+
+func Test_KeyTypes(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	p521Key, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		key  crypto.Signer
+		alg  string
+	}{
+		{"RSA", rsaKey, "RS512"},
+		{"ECDSA P-256", p256Key, "ES256"},
+		{"ECDSA P-384", p384Key, "ES384"},
+		{"ECDSA P-521", p521Key, "ES512"},
+		{"Ed25519", edKey, "EdDSA"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, opt := range []JwtIssuerOption{WithPrivateKey(tt.key), WithSigner(opaqueSigner{tt.key})} {
+				i, err := NewIssuer("server", opt)
+				require.NoError(t, err)
+				tok, err := i.IssueAccessToken("agent", time.Minute)
+				require.NoError(t, err)
+				parsed, _, err := jwt.NewParser().ParseUnverified(tok, jwt.MapClaims{})
+				require.NoError(t, err)
+				assert.Equal(t, tt.alg, parsed.Header["alg"])
+
+				// Tokens are validated with the public key only
+				v, err := NewIssuer("server", WithRSAPublicKey(tt.key.Public()))
+				require.NoError(t, err)
+				c, err := v.ValidateAccessToken(tok)
+				require.NoError(t, err)
+				sub, err := c.GetSubject()
+				require.NoError(t, err)
+				assert.Equal(t, "agent", sub)
+			}
+		})
+	}
+
+	t.Run("Token signed with another method is rejected", func(t *testing.T) {
+		tok, err := signedTokenWithClaims(jwt.SigningMethodRS512, rsaKey, jwt.RegisteredClaims{
+			Issuer:    "server",
+			Subject:   "agent",
+			Audience:  jwt.ClaimStrings{"server-access"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		})
+		require.NoError(t, err)
+		i, err := NewIssuer("server", WithPrivateKey(p256Key))
+		require.NoError(t, err)
+		_, err = i.ValidateAccessToken(tok)
+		assert.ErrorContains(t, err, "isn't signed with ES256 method")
+	})
+
+	t.Run("Public key only issuer cannot sign", func(t *testing.T) {
+		i, err := NewIssuer("server", WithRSAPublicKey(p256Key.Public()))
+		require.NoError(t, err)
+		_, err = i.IssueAccessToken("agent", time.Minute)
+		assert.ErrorContains(t, err, "no signing key")
+	})
+}
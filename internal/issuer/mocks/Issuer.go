@@ -22,9 +22,16 @@ func (_m *Issuer) EXPECT() *Issuer_Expecter {
 	return &Issuer_Expecter{mock: &_m.Mock}
 }
 
-// IssueAccessToken provides a mock function with given fields: client, exp
-func (_m *Issuer) IssueAccessToken(client string, exp time.Duration) (string, error) {
-	ret := _m.Called(client, exp)
+// IssueAccessToken provides a mock function with given fields: client, exp, opts
+func (_m *Issuer) IssueAccessToken(client string, exp time.Duration, opts ...issuer.TokenOption) (string, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, client, exp)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
 
 	if len(ret) == 0 {
 		panic("no return value specified for IssueAccessToken")
@@ -32,17 +39,17 @@ func (_m *Issuer) IssueAccessToken(client string, exp time.Duration) (string, er
 
 	var r0 string
 	var r1 error
-	if rf, ok := ret.Get(0).(func(string, time.Duration) (string, error)); ok {
-		return rf(client, exp)
+	if rf, ok := ret.Get(0).(func(string, time.Duration, ...issuer.TokenOption) (string, error)); ok {
+		return rf(client, exp, opts...)
 	}
-	if rf, ok := ret.Get(0).(func(string, time.Duration) string); ok {
-		r0 = rf(client, exp)
+	if rf, ok := ret.Get(0).(func(string, time.Duration, ...issuer.TokenOption) string); ok {
+		r0 = rf(client, exp, opts...)
 	} else {
 		r0 = ret.Get(0).(string)
 	}
 
-	if rf, ok := ret.Get(1).(func(string, time.Duration) error); ok {
-		r1 = rf(client, exp)
+	if rf, ok := ret.Get(1).(func(string, time.Duration, ...issuer.TokenOption) error); ok {
+		r1 = rf(client, exp, opts...)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -58,13 +65,21 @@ type Issuer_IssueAccessToken_Call struct {
 // IssueAccessToken is a helper method to define mock.On call
 //   - client string
 //   - exp time.Duration
-func (_e *Issuer_Expecter) IssueAccessToken(client interface{}, exp interface{}) *Issuer_IssueAccessToken_Call {
-	return &Issuer_IssueAccessToken_Call{Call: _e.mock.On("IssueAccessToken", client, exp)}
+//   - opts ...issuer.TokenOption
+func (_e *Issuer_Expecter) IssueAccessToken(client interface{}, exp interface{}, opts ...interface{}) *Issuer_IssueAccessToken_Call {
+	return &Issuer_IssueAccessToken_Call{Call: _e.mock.On("IssueAccessToken",
+		append([]interface{}{client, exp}, opts...)...)}
 }
 
-func (_c *Issuer_IssueAccessToken_Call) Run(run func(client string, exp time.Duration)) *Issuer_IssueAccessToken_Call {
+func (_c *Issuer_IssueAccessToken_Call) Run(run func(client string, exp time.Duration, opts ...issuer.TokenOption)) *Issuer_IssueAccessToken_Call {
 	_c.Call.Run(func(args mock.Arguments) {
-		run(args[0].(string), args[1].(time.Duration))
+		variadicArgs := make([]issuer.TokenOption, len(args)-2)
+		for i, a := range args[2:] {
+			if a != nil {
+				variadicArgs[i] = a.(issuer.TokenOption)
+			}
+		}
+		run(args[0].(string), args[1].(time.Duration), variadicArgs...)
 	})
 	return _c
 }
@@ -74,14 +89,21 @@ func (_c *Issuer_IssueAccessToken_Call) Return(_a0 string, _a1 error) *Issuer_Is
 	return _c
 }
 
-func (_c *Issuer_IssueAccessToken_Call) RunAndReturn(run func(string, time.Duration) (string, error)) *Issuer_IssueAccessToken_Call {
+func (_c *Issuer_IssueAccessToken_Call) RunAndReturn(run func(string, time.Duration, ...issuer.TokenOption) (string, error)) *Issuer_IssueAccessToken_Call {
 	_c.Call.Return(run)
 	return _c
 }
 
-// IssueRefreshToken provides a mock function with given fields: client, exp
-func (_m *Issuer) IssueRefreshToken(client string, exp time.Duration) (string, error) {
-	ret := _m.Called(client, exp)
+// IssueRefreshToken provides a mock function with given fields: client, exp, opts
+func (_m *Issuer) IssueRefreshToken(client string, exp time.Duration, opts ...issuer.TokenOption) (string, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, client, exp)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
 
 	if len(ret) == 0 {
 		panic("no return value specified for IssueRefreshToken")
@@ -89,17 +111,17 @@ func (_m *Issuer) IssueRefreshToken(client string, exp time.Duration) (string, e
 
 	var r0 string
 	var r1 error
-	if rf, ok := ret.Get(0).(func(string, time.Duration) (string, error)); ok {
-		return rf(client, exp)
+	if rf, ok := ret.Get(0).(func(string, time.Duration, ...issuer.TokenOption) (string, error)); ok {
+		return rf(client, exp, opts...)
 	}
-	if rf, ok := ret.Get(0).(func(string, time.Duration) string); ok {
-		r0 = rf(client, exp)
+	if rf, ok := ret.Get(0).(func(string, time.Duration, ...issuer.TokenOption) string); ok {
+		r0 = rf(client, exp, opts...)
 	} else {
 		r0 = ret.Get(0).(string)
 	}
 
-	if rf, ok := ret.Get(1).(func(string, time.Duration) error); ok {
-		r1 = rf(client, exp)
+	if rf, ok := ret.Get(1).(func(string, time.Duration, ...issuer.TokenOption) error); ok {
+		r1 = rf(client, exp, opts...)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -115,13 +137,21 @@ type Issuer_IssueRefreshToken_Call struct {
 // IssueRefreshToken is a helper method to define mock.On call
 //   - client string
 //   - exp time.Duration
-func (_e *Issuer_Expecter) IssueRefreshToken(client interface{}, exp interface{}) *Issuer_IssueRefreshToken_Call {
-	return &Issuer_IssueRefreshToken_Call{Call: _e.mock.On("IssueRefreshToken", client, exp)}
+//   - opts ...issuer.TokenOption
+func (_e *Issuer_Expecter) IssueRefreshToken(client interface{}, exp interface{}, opts ...interface{}) *Issuer_IssueRefreshToken_Call {
+	return &Issuer_IssueRefreshToken_Call{Call: _e.mock.On("IssueRefreshToken",
+		append([]interface{}{client, exp}, opts...)...)}
 }
 
-func (_c *Issuer_IssueRefreshToken_Call) Run(run func(client string, exp time.Duration)) *Issuer_IssueRefreshToken_Call {
+func (_c *Issuer_IssueRefreshToken_Call) Run(run func(client string, exp time.Duration, opts ...issuer.TokenOption)) *Issuer_IssueRefreshToken_Call {
 	_c.Call.Run(func(args mock.Arguments) {
-		run(args[0].(string), args[1].(time.Duration))
+		variadicArgs := make([]issuer.TokenOption, len(args)-2)
+		for i, a := range args[2:] {
+			if a != nil {
+				variadicArgs[i] = a.(issuer.TokenOption)
+			}
+		}
+		run(args[0].(string), args[1].(time.Duration), variadicArgs...)
 	})
 	return _c
 }
@@ -131,7 +161,7 @@ func (_c *Issuer_IssueRefreshToken_Call) Return(_a0 string, _a1 error) *Issuer_I
 	return _c
 }
 
-func (_c *Issuer_IssueRefreshToken_Call) RunAndReturn(run func(string, time.Duration) (string, error)) *Issuer_IssueRefreshToken_Call {
+func (_c *Issuer_IssueRefreshToken_Call) RunAndReturn(run func(string, time.Duration, ...issuer.TokenOption) (string, error)) *Issuer_IssueRefreshToken_Call {
 	_c.Call.Return(run)
 	return _c
 }
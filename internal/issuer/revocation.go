@@ -0,0 +1,220 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package issuer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/internal/informer"
+	"github.com/argoproj-labs/argocd-agent/internal/logging"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// RevokedTokenPrefix is the prefix of keys in the revocation ConfigMap
+	// that revoke a single token by its ID (the jti claim). The value of
+	// such keys is ignored.
+	RevokedTokenPrefix = "token."
+	// RevokedAgentPrefix is the prefix of keys in the revocation ConfigMap
+	// that revoke all tokens of an agent issued before a given point in time.
+	// The value must be a timestamp in RFC 3339 format.
+	RevokedAgentPrefix = "agent."
+)
+
+// revocationSyncTimeout is the time to wait for the revocation informer to
+// sync before giving up.
+const revocationSyncTimeout = 30 * time.Second
+
+// RevocationStore is consulted to find out whether a token that is otherwise
+// valid has been revoked before its expiry.
+type RevocationStore interface {
+	IsRevoked(tokenID string, agent string, issuedAt time.Time) bool
+}
+
+var _ RevocationStore = &RevocationList{}
+
+// RevocationList holds the set of revoked tokens. Tokens can either be
+// revoked individually by their ID, or per agent, in which case all tokens
+// for the agent issued before a given time are considered revoked.
+//
+// A RevocationList can be kept in sync with a ConfigMap at runtime using
+// WatchConfigMap. The zero value is not usable, use NewRevocationList.
+type RevocationList struct {
+	mu     sync.RWMutex
+	tokens map[string]bool
+	agents map[string]time.Time
+}
+
+// NewRevocationList returns a new, empty RevocationList.
+func NewRevocationList() *RevocationList {
+	return &RevocationList{
+		tokens: make(map[string]bool),
+		agents: make(map[string]time.Time),
+	}
+}
+
+// RevokeToken revokes the token with the given ID.
+func (r *RevocationList) RevokeToken(tokenID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tokens[tokenID] = true
+}
+
+// RevokeAgent revokes all tokens for the given agent that were issued before
+// the given time.
+func (r *RevocationList) RevokeAgent(agent string, before time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.agents[agent] = before
+}
+
+// IsRevoked returns true if the token with the given ID, issued to agent at
+// issuedAt, has been revoked. Tokens without an ID can only be revoked
+// through their agent.
+func (r *RevocationList) IsRevoked(tokenID string, agent string, issuedAt time.Time) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if tokenID != "" && r.tokens[tokenID] {
+		return true
+	}
+	if before, ok := r.agents[agent]; ok {
+		// A token without issue date cannot prove it was issued after the
+		// cut-off, so we treat it as revoked.
+		if issuedAt.IsZero() || issuedAt.Before(before) {
+			return true
+		}
+	}
+	return false
+}
+
+// Load replaces the contents of the revocation list with the entries parsed
+// from data, which is expected to be the data of a revocation ConfigMap.
+// Invalid entries are logged and skipped.
+func (r *RevocationList) Load(data map[string]string) {
+	tokens := make(map[string]bool)
+	agents := make(map[string]time.Time)
+	for k, v := range data {
+		switch {
+		case strings.HasPrefix(k, RevokedTokenPrefix):
+			id := strings.TrimPrefix(k, RevokedTokenPrefix)
+			if id == "" {
+				log().Warnf("Ignoring revocation entry %s: empty token ID", k)
+				continue
+			}
+			tokens[id] = true
+		case strings.HasPrefix(k, RevokedAgentPrefix):
+			agent := strings.TrimPrefix(k, RevokedAgentPrefix)
+			before, err := time.Parse(time.RFC3339, strings.TrimSpace(v))
+			if agent == "" || err != nil {
+				log().Warnf("Ignoring revocation entry %s: invalid agent name or timestamp", k)
+				continue
+			}
+			agents[agent] = before
+		default:
+			log().Warnf("Ignoring unknown revocation entry %s", k)
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tokens = tokens
+	r.agents = agents
+	log().WithFields(logrus.Fields{
+		"tokens": len(tokens),
+		"agents": len(agents),
+	}).Info("Loaded token revocation list")
+}
+
+// WatchConfigMap keeps the revocation list in sync with the ConfigMap of the
+// given name in namespace. It starts an informer in the background, which is
+// stopped when ctx is done, and waits for the initial sync before returning.
+//
+// A ConfigMap that does not exist, or is deleted, results in an empty list.
+func (r *RevocationList) WatchConfigMap(ctx context.Context, kubeclient kubernetes.Interface, namespace, name string) error {
+	selector := fields.OneTermEqualSelector("metadata.name", name).String()
+	inf, err := informer.NewInformer[*corev1.ConfigMap](ctx,
+		informer.WithListHandler[*corev1.ConfigMap](func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+			opts.FieldSelector = selector
+			return kubeclient.CoreV1().ConfigMaps(namespace).List(ctx, opts)
+		}),
+		informer.WithWatchHandler[*corev1.ConfigMap](func(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+			opts.FieldSelector = selector
+			return kubeclient.CoreV1().ConfigMaps(namespace).Watch(ctx, opts)
+		}),
+		informer.WithAddHandler(func(cm *corev1.ConfigMap) {
+			if cm.Name == name {
+				r.Load(cm.Data)
+			}
+		}),
+		informer.WithUpdateHandler(func(_ *corev1.ConfigMap, cm *corev1.ConfigMap) {
+			if cm.Name == name {
+				r.Load(cm.Data)
+			}
+		}),
+		informer.WithDeleteHandler(func(cm *corev1.ConfigMap) {
+			if cm.Name == name {
+				r.Load(nil)
+			}
+		}),
+		informer.WithGroupResource[*corev1.ConfigMap]("", "configmaps"),
+	)
+	if err != nil {
+		return fmt.Errorf("could not create revocation informer: %w", err)
+	}
+
+	go func() {
+		if err := inf.Start(ctx); err != nil {
+			log().WithError(err).Error("Could not start revocation informer")
+		}
+	}()
+
+	syncCtx, cancel := context.WithTimeout(ctx, revocationSyncTimeout)
+	defer cancel()
+	if err := inf.WaitForSync(syncCtx); err != nil {
+		return fmt.Errorf("revocation informer did not sync: %w", err)
+	}
+	log().Infof("Watching ConfigMap %s/%s for revoked tokens", namespace, name)
+	return nil
+}
+
+// TokenID returns the ID (jti claim) of the token the claims belong to, or
+// the empty string if the token has no ID.
+func TokenID(c Claims) string {
+	switch cl := c.(type) {
+	case jwt.MapClaims:
+		id, _ := cl["jti"].(string)
+		return id
+	case *jwt.MapClaims:
+		id, _ := (*cl)["jti"].(string)
+		return id
+	case *jwt.RegisteredClaims:
+		return cl.ID
+	}
+	return ""
+}
+
+func log() *logrus.Entry {
+	return logging.GetDefaultLogger().ComponentLogger("TokenRevocation")
+}
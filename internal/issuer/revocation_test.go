@@ -0,0 +1,115 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package issuer
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_RevocationList(t *testing.T) {
+	now := time.Now()
+	t.Run("Empty list revokes nothing", func(t *testing.T) {
+		r := NewRevocationList()
+		assert.False(t, r.IsRevoked("abc", "agent", now))
+	})
+	t.Run("Revoke single token", func(t *testing.T) {
+		r := NewRevocationList()
+		r.RevokeToken("abc")
+		assert.True(t, r.IsRevoked("abc", "agent", now))
+		assert.False(t, r.IsRevoked("def", "agent", now))
+		assert.False(t, r.IsRevoked("", "agent", now))
+	})
+	t.Run("Revoke tokens of agent", func(t *testing.T) {
+		r := NewRevocationList()
+		r.RevokeAgent("agent", now)
+		assert.True(t, r.IsRevoked("abc", "agent", now.Add(-time.Minute)))
+		assert.True(t, r.IsRevoked("abc", "agent", time.Time{}))
+		assert.False(t, r.IsRevoked("abc", "agent", now.Add(time.Minute)))
+		assert.False(t, r.IsRevoked("abc", "other", now.Add(-time.Minute)))
+	})
+	t.Run("Load from ConfigMap data", func(t *testing.T) {
+		r := NewRevocationList()
+		r.RevokeToken("stale")
+		r.Load(map[string]string{
+			"token.abc":     "",
+			"agent.agent-1": now.Format(time.RFC3339),
+			"agent.agent-2": "not a timestamp",
+			"token.":        "",
+			"unknown":       "",
+		})
+		assert.False(t, r.IsRevoked("stale", "agent", now))
+		assert.True(t, r.IsRevoked("abc", "agent", now))
+		assert.True(t, r.IsRevoked("", "agent-1", now.Add(-time.Hour)))
+		assert.False(t, r.IsRevoked("", "agent-2", now.Add(-time.Hour)))
+	})
+}
+
+func Test_TokenID(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	i, err := NewIssuer("server", WithRSAPrivateKey(key))
+	require.NoError(t, err)
+	tok, err := i.IssueAccessToken("agent", time.Minute)
+	require.NoError(t, err)
+	c, err := i.ValidateAccessToken(tok)
+	require.NoError(t, err)
+	assert.NotEmpty(t, TokenID(c))
+
+	assert.Equal(t, "abc", TokenID(&jwt.RegisteredClaims{ID: "abc"}))
+	assert.Equal(t, "abc", TokenID(&jwt.MapClaims{"jti": "abc"}))
+	assert.Empty(t, TokenID(jwt.MapClaims{}))
+}
+
+func Test_WatchConfigMap(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	kubeclient := kubefake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "revoked", Namespace: "argocd"},
+		Data:       map[string]string{"token.abc": ""},
+	})
+	r := NewRevocationList()
+	require.NoError(t, r.WatchConfigMap(ctx, kubeclient, "argocd", "revoked"))
+	assert.True(t, r.IsRevoked("abc", "agent", time.Now()))
+
+	t.Run("Update is picked up", func(t *testing.T) {
+		_, err := kubeclient.CoreV1().ConfigMaps("argocd").Update(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "revoked", Namespace: "argocd"},
+			Data:       map[string]string{"token.def": ""},
+		}, metav1.UpdateOptions{})
+		require.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			return r.IsRevoked("def", "agent", time.Now()) && !r.IsRevoked("abc", "agent", time.Now())
+		}, 2*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Delete clears the list", func(t *testing.T) {
+		err := kubeclient.CoreV1().ConfigMaps("argocd").Delete(ctx, "revoked", metav1.DeleteOptions{})
+		require.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			return !r.IsRevoked("def", "agent", time.Now())
+		}, 2*time.Second, 10*time.Millisecond)
+	})
+}
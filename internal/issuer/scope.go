@@ -0,0 +1,130 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package issuer
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// ScopeEventStream allows an agent to use the event stream
+	ScopeEventStream = "stream:events"
+	// ScopeLogStream allows an agent to stream logs to the principal
+	ScopeLogStream = "stream:logs"
+	// ScopeTerminalStream allows an agent to stream terminal sessions to the
+	// principal
+	ScopeTerminalStream = "stream:terminal"
+
+	// modeScopePrefix is the prefix of the scope naming the agent's mode
+	modeScopePrefix = "mode:"
+	// agentAudiencePrefix is the prefix of the audience naming the agent a
+	// token was issued to
+	agentAudiencePrefix = "agent:"
+)
+
+// DefaultScopes are the capability scopes granted to agents unless
+// configured otherwise.
+var DefaultScopes = []string{ScopeEventStream, ScopeLogStream, ScopeTerminalStream}
+
+// ModeScope returns the scope binding a token to the given agent mode
+func ModeScope(mode string) string {
+	return modeScopePrefix + mode
+}
+
+// AgentAudience returns the audience binding a token to the given agent
+func AgentAudience(agent string) string {
+	return agentAudiencePrefix + agent
+}
+
+// tokenClaims are the claims of access and refresh tokens
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	// Scope is a space-separated list of scopes, as in RFC 8693
+	Scope string `json:"scope,omitempty"`
+}
+
+// TokenOption sets additional claims on an issued token
+type TokenOption func(c *tokenClaims)
+
+// WithAudience adds aud to the audiences of the token
+func WithAudience(aud ...string) TokenOption {
+	return func(c *tokenClaims) {
+		c.Audience = append(c.Audience, aud...)
+	}
+}
+
+// WithScopes adds scopes to the scope claim of the token
+func WithScopes(scopes ...string) TokenOption {
+	return func(c *tokenClaims) {
+		c.Scope = strings.Join(append(strings.Fields(c.Scope), scopes...), " ")
+	}
+}
+
+// Scopes returns the scopes of the token the claims belong to, and whether
+// the token has a scope claim at all. Tokens issued before scopes were
+// introduced have no scope claim.
+func Scopes(c Claims) ([]string, bool) {
+	var scope any
+	switch cl := c.(type) {
+	case jwt.MapClaims:
+		scope = cl["scope"]
+	case *jwt.MapClaims:
+		scope = (*cl)["scope"]
+	case *tokenClaims:
+		return strings.Fields(cl.Scope), cl.Scope != ""
+	}
+	s, ok := scope.(string)
+	if !ok {
+		return nil, false
+	}
+	return strings.Fields(s), true
+}
+
+// HasScope returns true if the token the claims belong to carries scope
+func HasScope(c Claims, scope string) bool {
+	scopes, _ := Scopes(c)
+	return slices.Contains(scopes, scope)
+}
+
+// ModeFromScopes returns the agent mode the token the claims belong to is
+// bound to, or the empty string if it is not bound to a mode.
+func ModeFromScopes(c Claims) string {
+	scopes, _ := Scopes(c)
+	for _, s := range scopes {
+		if mode, ok := strings.CutPrefix(s, modeScopePrefix); ok {
+			return mode
+		}
+	}
+	return ""
+}
+
+// AgentFromAudience returns the agent the token the claims belong to is
+// bound to by its audience, or the empty string if it is not bound to an
+// agent.
+func AgentFromAudience(c Claims) string {
+	aud, err := c.GetAudience()
+	if err != nil {
+		return ""
+	}
+	for _, a := range aud {
+		if agent, ok := strings.CutPrefix(a, agentAudiencePrefix); ok {
+			return agent
+		}
+	}
+	return ""
+}
@@ -0,0 +1,68 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package issuer
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_TokenScopes(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	i, err := NewIssuer("server", WithRSAPrivateKey(key))
+	require.NoError(t, err)
+
+	t.Run("Audience and scopes are stamped into tokens", func(t *testing.T) {
+		tok, err := i.IssueAccessToken("agent", time.Minute,
+			WithAudience(AgentAudience("agent-1")),
+			WithScopes(ModeScope("managed"), ScopeEventStream),
+			WithScopes(ScopeLogStream))
+		require.NoError(t, err)
+		c, err := i.ValidateAccessToken(tok)
+		require.NoError(t, err)
+
+		scopes, ok := Scopes(c)
+		require.True(t, ok)
+		assert.Equal(t, []string{"mode:managed", ScopeEventStream, ScopeLogStream}, scopes)
+		assert.True(t, HasScope(c, ScopeEventStream))
+		assert.False(t, HasScope(c, ScopeTerminalStream))
+		assert.Equal(t, "managed", ModeFromScopes(c))
+		assert.Equal(t, "agent-1", AgentFromAudience(c))
+
+		aud, err := c.GetAudience()
+		require.NoError(t, err)
+		assert.Equal(t, jwt.ClaimStrings{"server-access", "agent:agent-1"}, aud)
+	})
+
+	t.Run("Tokens without scopes", func(t *testing.T) {
+		tok, err := i.IssueRefreshToken("agent", time.Minute)
+		require.NoError(t, err)
+		c, err := i.ValidateRefreshToken(tok)
+		require.NoError(t, err)
+
+		scopes, ok := Scopes(c)
+		assert.False(t, ok)
+		assert.Empty(t, scopes)
+		assert.Equal(t, "", ModeFromScopes(c))
+		assert.Equal(t, "", AgentFromAudience(c))
+	})
+}
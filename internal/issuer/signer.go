@@ -0,0 +1,95 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package issuer
+
+import (
+	"crypto"
+	"crypto/rand"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// The signing methods below produce signatures using a crypto.Signer, which
+// allows the private key to live outside the process, e.g. in Vault or a
+// cloud KMS. They are not registered with the jwt library, so that parsing
+// of tokens always uses the standard implementations for verification.
+var (
+	signingMethodRS512Signer jwt.SigningMethod = &signerSigningMethod{method: jwt.SigningMethodRS512, hash: crypto.SHA512}
+	signingMethodES256Signer jwt.SigningMethod = &signerSigningMethod{method: jwt.SigningMethodES256, hash: crypto.SHA256, keySize: 32}
+	signingMethodES384Signer jwt.SigningMethod = &signerSigningMethod{method: jwt.SigningMethodES384, hash: crypto.SHA384, keySize: 48}
+	signingMethodES512Signer jwt.SigningMethod = &signerSigningMethod{method: jwt.SigningMethodES512, hash: crypto.SHA512, keySize: 66}
+)
+
+// signerSigningMethodFor returns the signing method producing signatures of
+// method using a crypto.Signer. The EdDSA method of the jwt library supports
+// crypto.Signer already.
+func signerSigningMethodFor(method jwt.SigningMethod) jwt.SigningMethod {
+	switch method {
+	case jwt.SigningMethodRS512:
+		return signingMethodRS512Signer
+	case jwt.SigningMethodES256:
+		return signingMethodES256Signer
+	case jwt.SigningMethodES384:
+		return signingMethodES384Signer
+	case jwt.SigningMethodES512:
+		return signingMethodES512Signer
+	default:
+		return method
+	}
+}
+
+type signerSigningMethod struct {
+	method jwt.SigningMethod
+	hash   crypto.Hash
+	// keySize is the size of the r and s values of ECDSA signatures in
+	// bytes, and zero for RSA
+	keySize int
+}
+
+func (m *signerSigningMethod) Alg() string {
+	return m.method.Alg()
+}
+
+func (m *signerSigningMethod) Verify(signingString string, sig []byte, key interface{}) error {
+	return m.method.Verify(signingString, sig, key)
+}
+
+func (m *signerSigningMethod) Sign(signingString string, key interface{}) ([]byte, error) {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("key of type %T is not a crypto.Signer", key)
+	}
+	h := m.hash.New()
+	h.Write([]byte(signingString))
+	sig, err := signer.Sign(rand.Reader, h.Sum(nil), m.hash)
+	if err != nil || m.keySize == 0 {
+		return sig, err
+	}
+	// ECDSA signers return ASN.1 encoded signatures, while JWS requires the
+	// concatenation of r and s as defined in RFC 7518, section 3.4.
+	var rs struct {
+		R, S *big.Int
+	}
+	if _, err := asn1.Unmarshal(sig, &rs); err != nil {
+		return nil, fmt.Errorf("could not parse ECDSA signature: %w", err)
+	}
+	out := make([]byte, 2*m.keySize)
+	rs.R.FillBytes(out[:m.keySize])
+	rs.S.FillBytes(out[m.keySize:])
+	return out, nil
+}
@@ -0,0 +1,249 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package vault implements a crypto.Signer that delegates signing operations
+// to the Transit secrets engine of HashiCorp Vault, so that the token signing
+// key never has to leave Vault.
+package vault
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/internal/logging"
+	"github.com/sirupsen/logrus"
+)
+
+var _ crypto.Signer = &TransitSigner{}
+
+// DefaultMountPath is the default path the Transit engine is mounted at
+const DefaultMountPath = "transit"
+
+// DefaultTimeout is the default timeout for requests to Vault
+const DefaultTimeout = 10 * time.Second
+
+// maxResponseSize is the maximum size of a response we read from Vault
+const maxResponseSize = 1024 * 1024
+
+// Config holds the configuration for the TransitSigner.
+type Config struct {
+	// Address is the URL of the Vault server
+	Address string
+	// Token is the Vault token used to authenticate
+	Token string
+	// MountPath is the path the Transit engine is mounted at. Defaults to
+	// DefaultMountPath.
+	MountPath string
+	// KeyName is the name of the Transit key to sign with. The key must be
+	// of type rsa-2048, rsa-3072 or rsa-4096.
+	KeyName string
+	// RootCAs are used to verify Vault's certificate. If nil, the system's
+	// root CAs are used.
+	RootCAs *x509.CertPool
+	// Timeout is the timeout for requests to Vault. Defaults to
+	// DefaultTimeout.
+	Timeout time.Duration
+}
+
+// TransitSigner signs digests using a key held by Vault's Transit engine.
+//
+// The signer is pinned to the latest version of the key at the time it was
+// created. Rotating the key in Vault therefore requires a restart of the
+// principal, so that the public key used to validate tokens stays in sync
+// with the key used to sign them.
+type TransitSigner struct {
+	config    Config
+	client    *http.Client
+	publicKey *rsa.PublicKey
+	version   int
+}
+
+type keyResponse struct {
+	Data struct {
+		Type          string `json:"type"`
+		LatestVersion int    `json:"latest_version"`
+		Keys          map[string]struct {
+			PublicKey string `json:"public_key"`
+		} `json:"keys"`
+	} `json:"data"`
+}
+
+type signRequest struct {
+	Input              string `json:"input"`
+	Prehashed          bool   `json:"prehashed"`
+	SignatureAlgorithm string `json:"signature_algorithm"`
+	KeyVersion         int    `json:"key_version"`
+}
+
+type signResponse struct {
+	Data struct {
+		Signature string `json:"signature"`
+	} `json:"data"`
+}
+
+// NewTransitSigner creates a new TransitSigner and fetches the public part
+// of the configured key from Vault.
+func NewTransitSigner(ctx context.Context, config Config) (*TransitSigner, error) {
+	if config.Address == "" {
+		return nil, fmt.Errorf("vault address cannot be empty")
+	}
+	if config.KeyName == "" {
+		return nil, fmt.Errorf("vault transit key name cannot be empty")
+	}
+	if config.MountPath == "" {
+		config.MountPath = DefaultMountPath
+	}
+	if config.Timeout == 0 {
+		config.Timeout = DefaultTimeout
+	}
+	s := &TransitSigner{
+		config: config,
+		client: &http.Client{
+			Timeout: config.Timeout,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					RootCAs:    config.RootCAs,
+					MinVersion: tls.VersionTLS12,
+				},
+			},
+		},
+	}
+	if err := s.loadPublicKey(ctx); err != nil {
+		return nil, err
+	}
+	log().WithFields(logrus.Fields{
+		"key":     config.KeyName,
+		"version": s.version,
+	}).Info("Using Vault Transit key for token signing")
+	return s, nil
+}
+
+// Public returns the public part of the Transit key.
+func (s *TransitSigner) Public() crypto.PublicKey {
+	return s.publicKey
+}
+
+// Sign signs the given digest using the Transit key. Only SHA-256 and
+// SHA-512 with PKCS #1 v1.5 padding are supported.
+func (s *TransitSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	var hashAlgorithm string
+	switch opts.HashFunc() {
+	case crypto.SHA256:
+		hashAlgorithm = "sha2-256"
+	case crypto.SHA512:
+		hashAlgorithm = "sha2-512"
+	default:
+		return nil, fmt.Errorf("unsupported hash function %v", opts.HashFunc())
+	}
+	if _, ok := opts.(*rsa.PSSOptions); ok {
+		return nil, fmt.Errorf("PSS signatures are not supported")
+	}
+
+	var resp signResponse
+	err := s.do(context.Background(), http.MethodPost, fmt.Sprintf("sign/%s/%s", url.PathEscape(s.config.KeyName), hashAlgorithm), &signRequest{
+		Input:              base64.StdEncoding.EncodeToString(digest),
+		Prehashed:          true,
+		SignatureAlgorithm: "pkcs1v15",
+		KeyVersion:         s.version,
+	}, &resp)
+	if err != nil {
+		return nil, fmt.Errorf("could not sign with vault: %w", err)
+	}
+
+	// Signatures are returned in the format vault:v<version>:<base64>
+	parts := strings.SplitN(resp.Data.Signature, ":", 3)
+	if len(parts) != 3 || parts[0] != "vault" {
+		return nil, fmt.Errorf("unexpected signature format returned by vault")
+	}
+	return base64.StdEncoding.DecodeString(parts[2])
+}
+
+// loadPublicKey fetches the latest version of the Transit key from Vault
+func (s *TransitSigner) loadPublicKey(ctx context.Context) error {
+	var resp keyResponse
+	if err := s.do(ctx, http.MethodGet, "keys/"+url.PathEscape(s.config.KeyName), nil, &resp); err != nil {
+		return fmt.Errorf("could not read vault transit key %s: %w", s.config.KeyName, err)
+	}
+	if !strings.HasPrefix(resp.Data.Type, "rsa-") {
+		return fmt.Errorf("vault transit key %s has type %s, but an RSA key is required", s.config.KeyName, resp.Data.Type)
+	}
+	key, ok := resp.Data.Keys[strconv.Itoa(resp.Data.LatestVersion)]
+	if !ok {
+		return fmt.Errorf("vault transit key %s has no version %d", s.config.KeyName, resp.Data.LatestVersion)
+	}
+	block, _ := pem.Decode([]byte(key.PublicKey))
+	if block == nil {
+		return fmt.Errorf("vault transit key %s has no valid PEM data", s.config.KeyName)
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("could not parse public key of vault transit key %s: %w", s.config.KeyName, err)
+	}
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("vault transit key %s is not an RSA key", s.config.KeyName)
+	}
+	s.publicKey = rsaPub
+	s.version = resp.Data.LatestVersion
+	return nil
+}
+
+// do performs a request against the Transit engine's API at path, and
+// decodes the JSON response into out.
+func (s *TransitSigner) do(ctx context.Context, method, path string, in any, out any) error {
+	var body io.Reader
+	if in != nil {
+		payload, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(payload)
+	}
+	u := fmt.Sprintf("%s/v1/%s/%s", strings.TrimSuffix(s.config.Address, "/"), strings.Trim(s.config.MountPath, "/"), path)
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", s.config.Token)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("vault returned unexpected status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(out)
+}
+
+func log() *logrus.Entry {
+	return logging.GetDefaultLogger().ComponentLogger("VaultTransitSigner")
+}
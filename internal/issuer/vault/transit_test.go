@@ -0,0 +1,142 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/internal/issuer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testToken = "s.test"
+
+// transitServer emulates the parts of Vault's Transit API used by the
+// TransitSigner, backed by key.
+func transitServer(t *testing.T, key *rsa.PrivateKey, keyType string) *httptest.Server {
+	t.Helper()
+	pubDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/transit/keys/agent-jwt", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"data": map[string]any{
+				"type":           keyType,
+				"latest_version": 2,
+				"keys": map[string]any{
+					"2": map[string]string{"public_key": string(pubPEM)},
+				},
+			},
+		})
+	})
+	mux.HandleFunc("/v1/transit/sign/agent-jwt/sha2-512", func(w http.ResponseWriter, r *http.Request) {
+		var req signRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !req.Prehashed || req.KeyVersion != 2 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		digest, err := base64.StdEncoding.DecodeString(req.Input)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA512, digest)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"data": map[string]string{"signature": "vault:v2:" + base64.StdEncoding.EncodeToString(sig)},
+		})
+	})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != testToken {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func Test_TransitSigner(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	t.Run("Issue and validate tokens", func(t *testing.T) {
+		srv := transitServer(t, key, "rsa-2048")
+		signer, err := NewTransitSigner(context.TODO(), Config{Address: srv.URL, Token: testToken, KeyName: "agent-jwt"})
+		require.NoError(t, err)
+		assert.True(t, key.PublicKey.Equal(signer.Public()))
+
+		i, err := issuer.NewIssuer("server", issuer.WithSigner(signer))
+		require.NoError(t, err)
+		tok, err := i.IssueAccessToken("agent", time.Minute)
+		require.NoError(t, err)
+		c, err := i.ValidateAccessToken(tok)
+		require.NoError(t, err)
+		sub, err := c.GetSubject()
+		require.NoError(t, err)
+		assert.Equal(t, "agent", sub)
+
+		// Tokens must also be valid for anyone holding just the public key
+		v, err := issuer.NewIssuer("server", issuer.WithRSAPublicKey(&key.PublicKey))
+		require.NoError(t, err)
+		_, err = v.ValidateAccessToken(tok)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Invalid token", func(t *testing.T) {
+		srv := transitServer(t, key, "rsa-2048")
+		_, err := NewTransitSigner(context.TODO(), Config{Address: srv.URL, Token: "invalid", KeyName: "agent-jwt"})
+		assert.ErrorContains(t, err, "unexpected status 403")
+	})
+
+	t.Run("Non-RSA key", func(t *testing.T) {
+		srv := transitServer(t, key, "ecdsa-p256")
+		_, err := NewTransitSigner(context.TODO(), Config{Address: srv.URL, Token: testToken, KeyName: "agent-jwt"})
+		assert.ErrorContains(t, err, "RSA key is required")
+	})
+
+	t.Run("Unsupported hash", func(t *testing.T) {
+		srv := transitServer(t, key, "rsa-2048")
+		signer, err := NewTransitSigner(context.TODO(), Config{Address: srv.URL, Token: testToken, KeyName: "agent-jwt"})
+		require.NoError(t, err)
+		_, err = signer.Sign(rand.Reader, []byte("digest"), crypto.SHA1)
+		assert.ErrorContains(t, err, "unsupported hash")
+	})
+
+	t.Run("Missing configuration", func(t *testing.T) {
+		_, err := NewTransitSigner(context.TODO(), Config{KeyName: "agent-jwt"})
+		assert.ErrorContains(t, err, "address")
+		_, err = NewTransitSigner(context.TODO(), Config{Address: "https://vault"})
+		assert.ErrorContains(t, err, "key name")
+	})
+}
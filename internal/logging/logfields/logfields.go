@@ -32,6 +32,7 @@ const (
 	ConnectionUUID = "connectionUUID"
 	EventID        = "eventId"
 	Event          = "event"
+	CorrelationID  = "correlation_id"
 
 	// Client and agent
 	Client = "client"
@@ -28,6 +28,7 @@ import (
 
 	"github.com/argoproj-labs/argocd-agent/internal/backend"
 	"github.com/argoproj-labs/argocd-agent/internal/cache"
+	"github.com/argoproj-labs/argocd-agent/internal/event"
 	"github.com/argoproj-labs/argocd-agent/internal/logging"
 	"github.com/argoproj-labs/argocd-agent/internal/logging/logfields"
 	"github.com/argoproj-labs/argocd-agent/internal/manager"
@@ -168,12 +169,12 @@ func (m *ApplicationManager) Create(ctx context.Context, app *v1alpha1.Applicati
 
 	created, err := m.applicationBackend.Create(ctx, app)
 	if err == nil {
-		logging.LogActionCreate(log().WithField("application", app.QualifiedName()), "application", created)
+		logging.LogActionCreate(logFor(ctx).WithField("application", app.QualifiedName()), "application", created)
 		if err := m.Manage(created.QualifiedName()); err != nil {
-			log().Warnf("Could not manage app %s: %v", created.QualifiedName(), err)
+			logFor(ctx).Warnf("Could not manage app %s: %v", created.QualifiedName(), err)
 		}
 		if err := m.IgnoreChange(created.QualifiedName(), created.ResourceVersion); err != nil {
-			log().Warnf("Could not ignore change %s for app %s: %v", created.ResourceVersion, created.QualifiedName(), err)
+			logFor(ctx).Warnf("Could not ignore change %s for app %s: %v", created.ResourceVersion, created.QualifiedName(), err)
 		}
 	}
 
@@ -229,9 +230,9 @@ func (m *ApplicationManager) Upsert(ctx context.Context, app *v1alpha1.Applicati
 	if err != nil {
 		return nil, err
 	}
-	logging.LogActionUpdate(log().WithField("application", updated.QualifiedName()), "application", app, updated)
+	logging.LogActionUpdate(logFor(ctx).WithField("application", updated.QualifiedName()), "application", app, updated)
 	if err := m.IgnoreChange(updated.QualifiedName(), updated.ResourceVersion); err != nil {
-		log().Warnf("Could not ignore change %s for app %s: %v", updated.ResourceVersion, updated.QualifiedName(), err)
+		logFor(ctx).Warnf("Could not ignore change %s for app %s: %v", updated.ResourceVersion, updated.QualifiedName(), err)
 	}
 	return updated, nil
 }
@@ -293,7 +294,7 @@ func applyManagedIdentity(existing, incoming *v1alpha1.Application, identity Man
 // refresh annotation on the agent's app will be retained, because it will be
 // removed by the agent's application controller.
 func (m *ApplicationManager) UpdateManagedApp(ctx context.Context, incoming *v1alpha1.Application, identity ManagedIdentity) (*v1alpha1.Application, error) {
-	logCtx := log().WithFields(logrus.Fields{
+	logCtx := logFor(ctx).WithFields(logrus.Fields{
 		"component":       "UpdateManaged",
 		"application":     incoming.QualifiedName(),
 		"resourceVersion": incoming.ResourceVersion,
@@ -470,7 +471,7 @@ func (m *ApplicationManager) CompareSourceUID(ctx context.Context, incoming *v1a
 // This method is usually only executed by the control plane for updates that
 // are received by agents in autonomous mode.
 func (m *ApplicationManager) UpdateAutonomousApp(ctx context.Context, namespace string, incoming *v1alpha1.Application) (*v1alpha1.Application, error) {
-	logCtx := log().WithFields(logrus.Fields{
+	logCtx := logFor(ctx).WithFields(logrus.Fields{
 		"component":       "UpdateAutonomous",
 		"application":     incoming.QualifiedName(),
 		"resourceVersion": incoming.ResourceVersion,
@@ -503,6 +504,7 @@ func (m *ApplicationManager) UpdateAutonomousApp(ctx context.Context, namespace
 		}
 		existing.Finalizers = incoming.Finalizers
 		existing.Spec = incoming.Spec
+		keepPropagationCondition(existing, incoming)
 		existing.Status = *incoming.Status.DeepCopy()
 		existing.Operation = incoming.Operation.DeepCopy()
 		logCtx.Infof("Updating")
@@ -513,6 +515,7 @@ func (m *ApplicationManager) UpdateAutonomousApp(ctx context.Context, namespace
 			}
 			incoming.Annotations[manager.SourceUIDAnnotation] = v
 		}
+		keepPropagationCondition(existing, incoming)
 
 		target := &v1alpha1.Application{
 			ObjectMeta: v1.ObjectMeta{
@@ -556,12 +559,16 @@ func (m *ApplicationManager) UpdateAutonomousApp(ctx context.Context, namespace
 // UpdateStatus updates the application on the server for updates sent by an
 // agent that operates in managed mode.
 //
-// The app on the server will inherit the status field of the incoming app.
+// The app on the server will inherit the status field of the incoming app,
+// except for the condition recording failures of the agent to apply events.
 // Additionally, if a refresh annotation exists on the app on the app of the
-// server, but not in the incoming app, the annotation will be removed. Any
-// operation field on the existing resource will be removed as well.
+// server, but not in the incoming app, the annotation will be removed. The
+// operation field of the incoming app is recorded as well, except that an
+// operation requested on the server is kept until the agent reports to have
+// started an operation. Otherwise, status updates the agent sent before it
+// received the operation would remove it.
 func (m *ApplicationManager) UpdateStatus(ctx context.Context, namespace string, incoming *v1alpha1.Application) (*v1alpha1.Application, error) {
-	logCtx := log().WithFields(logrus.Fields{
+	logCtx := logFor(ctx).WithFields(logrus.Fields{
 		"component":       "UpdateStatus",
 		"application":     incoming.QualifiedName(),
 		"resourceVersion": incoming.ResourceVersion,
@@ -579,16 +586,18 @@ func (m *ApplicationManager) UpdateStatus(ctx context.Context, namespace string,
 	}
 
 	updated, err = m.update(ctx, false, incoming, func(existing, incoming *v1alpha1.Application) {
+		keepPropagationCondition(existing, incoming)
 		existing.Annotations = incoming.Annotations
 		existing.Labels = incoming.Labels
+		existing.Operation = statusOperation(existing, incoming)
 		existing.Status = *incoming.Status.DeepCopy()
-		existing.Operation = incoming.Operation
 	}, func(existing, incoming *v1alpha1.Application) (jsondiff.Patch, error) {
+		keepPropagationCondition(existing, incoming)
 		refresh, incomingRefresh := incoming.Annotations["argocd.argoproj.io/refresh"]
 		_, existingRefresh := existing.Annotations["argocd.argoproj.io/refresh"]
 		target := &v1alpha1.Application{
 			Status:    incoming.Status,
-			Operation: incoming.Operation,
+			Operation: statusOperation(existing, incoming),
 		}
 		source := &v1alpha1.Application{
 			Status:    existing.Status,
@@ -626,6 +635,25 @@ func (m *ApplicationManager) UpdateStatus(ctx context.Context, namespace string,
 	return updated, err
 }
 
+// statusOperation returns the operation to record on the server's app for a
+// status update from a managed agent. The application controller removes the
+// operation once it starts it, so an operation missing on the incoming app is
+// only removed on the server when the incoming app reports an operation state
+// the server has not seen yet.
+func statusOperation(existing, incoming *v1alpha1.Application) *v1alpha1.Operation {
+	if incoming.Operation != nil || existing.Operation == nil {
+		return incoming.Operation
+	}
+	started := incoming.Status.OperationState
+	if started == nil {
+		return existing.Operation
+	}
+	if seen := existing.Status.OperationState; seen != nil && seen.StartedAt.Equal(&started.StartedAt) {
+		return existing.Operation
+	}
+	return nil
+}
+
 // UpdateOperation is used to update the .operation field of the application
 // resource to initiate a sync. Additionally, any labels and annotations that
 // are used to trigger an action (such as, refresh) will be set on the target
@@ -635,7 +663,7 @@ func (m *ApplicationManager) UpdateStatus(ctx context.Context, namespace string,
 // it has the leading version of the resource and we are not supposed to change
 // its Application manifests.
 func (m *ApplicationManager) UpdateOperation(ctx context.Context, incoming *v1alpha1.Application) (*v1alpha1.Application, error) {
-	logCtx := log().WithFields(logrus.Fields{
+	logCtx := logFor(ctx).WithFields(logrus.Fields{
 		"component":       "UpdateOperation",
 		"application":     incoming.QualifiedName(),
 		"resourceVersion": incoming.ResourceVersion,
@@ -687,7 +715,7 @@ func (m *ApplicationManager) UpdateOperation(ctx context.Context, incoming *v1al
 // SetOperation sets the .operation field on an agent's Application without touching spec or status.
 // It is used to deliver principal-initiated sync operations to the agent as an independent event.
 func (m *ApplicationManager) SetOperation(ctx context.Context, incoming *v1alpha1.Application) (*v1alpha1.Application, error) {
-	logCtx := log().WithFields(logrus.Fields{
+	logCtx := logFor(ctx).WithFields(logrus.Fields{
 		"component":   "SetOperation",
 		"application": incoming.QualifiedName(),
 	})
@@ -741,7 +769,7 @@ func (m *ApplicationManager) TerminateOperation(ctx context.Context, incoming *v
 	if !m.destinationBasedMapping {
 		incoming.SetNamespace(m.namespace)
 	}
-	logCtx := log().WithFields(logrus.Fields{
+	logCtx := logFor(ctx).WithFields(logrus.Fields{
 		"component":       "TerminateOperation",
 		"application":     incoming.QualifiedName(),
 		"resourceVersion": incoming.ResourceVersion,
@@ -789,7 +817,7 @@ func (m *ApplicationManager) TerminateOperation(ctx context.Context, incoming *v
 // 'deletionPropagation' follows the corresponding K8s behaviour, defaulting to Foreground if nil.
 func (m *ApplicationManager) Delete(ctx context.Context, namespace string, incoming *v1alpha1.Application, deletionPropagation *backend.DeletionPropagation) error {
 	removeFinalizer := false
-	logCtx := log().WithFields(logrus.Fields{
+	logCtx := logFor(ctx).WithFields(logrus.Fields{
 		"component":       "DeleteOperation",
 		"application":     incoming.QualifiedName(),
 		"resourceVersion": incoming.ResourceVersion,
@@ -890,7 +918,7 @@ func (m *ApplicationManager) RemoveFinalizers(ctx context.Context, incoming *v1a
 		return patch, err
 	})
 	if err == nil {
-		logging.LogActionUpdate(log().WithField("application", incoming.QualifiedName()), "application", incoming, updated)
+		logging.LogActionUpdate(logFor(ctx).WithField("application", incoming.QualifiedName()), "application", incoming, updated)
 	}
 	return updated, err
 }
@@ -901,7 +929,7 @@ func (m *ApplicationManager) List(ctx context.Context, selector backend.Applicat
 
 // ClearOperationState removes the operationState from an application's status.
 func (m *ApplicationManager) ClearOperationState(ctx context.Context, app *v1alpha1.Application) error {
-	logCtx := log().WithFields(logrus.Fields{
+	logCtx := logFor(ctx).WithFields(logrus.Fields{
 		"component":   "ClearOperationState",
 		"application": app.Namespace + "/" + app.Name,
 	})
@@ -918,7 +946,7 @@ func (m *ApplicationManager) ClearOperationState(ctx context.Context, app *v1alp
 // RevertManagedAppChanges compares the actual spec with expected spec stored in cache,
 // if actual spec doesn't match with cache, then it is reverted to be in sync with cache, which is same as principal.
 func (m *ApplicationManager) RevertManagedAppChanges(ctx context.Context, app *v1alpha1.Application, appCache *cache.ResourceCache[v1alpha1.ApplicationSpec]) bool {
-	logCtx := log().WithFields(logrus.Fields{
+	logCtx := logFor(ctx).WithFields(logrus.Fields{
 		"component":       "RevertManagedAppChanges",
 		"application":     app.QualifiedName(),
 		"resourceVersion": app.ResourceVersion,
@@ -948,7 +976,7 @@ func (m *ApplicationManager) RevertManagedAppChanges(ctx context.Context, app *v
 // RevertAutonomousAppChanges compares the actual spec with expected spec stored in cache,
 // if actual spec doesn't match with cache, then it is reverted to be in sync with cache, which is same as agent cluster.
 func (m *ApplicationManager) RevertAutonomousAppChanges(ctx context.Context, app *v1alpha1.Application, appCache *cache.ResourceCache[v1alpha1.ApplicationSpec]) bool {
-	logCtx := log().WithFields(logrus.Fields{
+	logCtx := logFor(ctx).WithFields(logrus.Fields{
 		"component":       "RevertAutonomousAppChanges",
 		"application":     app.QualifiedName(),
 		"resourceVersion": app.ResourceVersion,
@@ -981,3 +1009,9 @@ func (m *ApplicationManager) RevertAutonomousAppChanges(ctx context.Context, app
 func log() *logrus.Entry {
 	return logrus.WithField("component", "AppManager")
 }
+
+// logFor returns the logger for an operation carried out on behalf of ctx,
+// which includes the correlation ID of the event that caused the operation.
+func logFor(ctx context.Context) *logrus.Entry {
+	return event.WithCorrelationID(ctx, log())
+}
@@ -19,6 +19,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/argoproj-labs/argocd-agent/internal/backend"
 	"github.com/argoproj-labs/argocd-agent/internal/backend/kubernetes/application"
@@ -440,6 +441,51 @@ func Test_ManagerUpdateStatus(t *testing.T) {
 		require.NotNil(t, updated.Operation)
 		require.Equal(t, incoming.Operation, updated.Operation)
 	})
+
+	startedAt := v1.NewTime(time.Now().Add(-time.Minute).Truncate(time.Second))
+	statusUpdate := func(t *testing.T, existing, incoming *v1alpha1.Application) *v1alpha1.Application {
+		t.Helper()
+		appC, ai := fakeInformer(t, "", existing)
+		be := application.NewKubernetesBackend(appC, "", ai, true)
+		mgr, err := NewApplicationManager(be, "argocd")
+		require.NoError(t, err)
+		mgr.mode = manager.ManagerModeManaged
+		mgr.role = manager.ManagerRolePrincipal
+		updated, err := mgr.UpdateStatus(context.Background(), "cluster-1", incoming)
+		require.NoError(t, err)
+		return updated
+	}
+	app := func(op *v1alpha1.Operation, state *v1alpha1.OperationState) *v1alpha1.Application {
+		return &v1alpha1.Application{
+			ObjectMeta: v1.ObjectMeta{Name: "foobar", Namespace: "cluster-1"},
+			Operation:  op,
+			Status:     v1alpha1.ApplicationStatus{OperationState: state},
+		}
+	}
+	requested := &v1alpha1.Operation{
+		InitiatedBy: v1alpha1.OperationInitiator{Username: "admin"},
+		Sync:        &v1alpha1.SyncOperation{Revision: "HEAD"},
+	}
+
+	t.Run("Operation not yet started by the agent is kept", func(t *testing.T) {
+		previous := &v1alpha1.OperationState{Phase: synccommon.OperationSucceeded, StartedAt: startedAt}
+		updated := statusUpdate(t, app(requested, previous), app(nil, previous.DeepCopy()))
+		require.Equal(t, requested, updated.Operation)
+
+		updated = statusUpdate(t, app(requested, nil), app(nil, nil))
+		require.Equal(t, requested, updated.Operation)
+	})
+
+	t.Run("Operation started by the agent is removed", func(t *testing.T) {
+		previous := &v1alpha1.OperationState{Phase: synccommon.OperationSucceeded, StartedAt: startedAt}
+		running := &v1alpha1.OperationState{Operation: *requested, Phase: synccommon.OperationRunning, StartedAt: v1.NewTime(startedAt.Add(time.Minute))}
+		updated := statusUpdate(t, app(requested, previous), app(nil, running))
+		require.Nil(t, updated.Operation)
+		require.Equal(t, synccommon.OperationRunning, updated.Status.OperationState.Phase)
+
+		updated = statusUpdate(t, app(requested, nil), app(nil, running.DeepCopy()))
+		require.Nil(t, updated.Operation)
+	})
 }
 
 func Test_ManagerUpdateAutonomous(t *testing.T) {
@@ -510,6 +556,44 @@ func Test_ManagerUpdateAutonomous(t *testing.T) {
 		require.NotContains(t, updated.ObjectMeta.Annotations, "argocd.argoproj.io/refresh")
 		require.Equal(t, map[string]string{"foo": "bar"}, updated.Labels)
 	})
+
+	t.Run("Operation history is taken from the agent", func(t *testing.T) {
+		deployedAt := v1.NewTime(time.Now().Add(-time.Hour).Truncate(time.Second))
+		existing := &v1alpha1.Application{
+			ObjectMeta: v1.ObjectMeta{Name: "foobar", Namespace: "cluster-1"},
+			Status: v1alpha1.ApplicationStatus{
+				History: v1alpha1.RevisionHistories{{ID: 1, Revision: "abc123", DeployedAt: deployedAt}},
+			},
+		}
+		incoming := existing.DeepCopy()
+		incoming.Status.History = append(incoming.Status.History, v1alpha1.RevisionHistory{
+			ID: 2, Revision: "def456", DeployedAt: v1.NewTime(deployedAt.Add(time.Minute)),
+			InitiatedBy: v1alpha1.OperationInitiator{Username: "admin"},
+		})
+		incoming.Status.OperationState = &v1alpha1.OperationState{
+			Operation: v1alpha1.Operation{Sync: &v1alpha1.SyncOperation{Revision: "def456"}},
+			Phase:     synccommon.OperationSucceeded,
+			StartedAt: v1.NewTime(deployedAt.Add(time.Minute)),
+			SyncResult: &v1alpha1.SyncOperationResult{
+				Revision: "def456",
+				Resources: v1alpha1.ResourceResults{{
+					Group: "apps", Version: "v1", Kind: "Deployment", Namespace: "guestbook", Name: "guestbook",
+					Status: synccommon.ResultCodeSynced, Message: "deployment.apps/guestbook configured",
+				}},
+			},
+		}
+
+		appC, ai := fakeInformer(t, "", existing)
+		be := application.NewKubernetesBackend(appC, "", ai, true)
+		mgr, err := NewApplicationManager(be, "argocd")
+		require.NoError(t, err)
+		mgr.role = manager.ManagerRolePrincipal
+		updated, err := mgr.UpdateAutonomousApp(context.TODO(), "cluster-1", incoming)
+		require.NoError(t, err)
+		assert.Equal(t, incoming.Status.History, updated.Status.History)
+		require.NotNil(t, updated.Status.OperationState)
+		assert.Equal(t, incoming.Status.OperationState.SyncResult, updated.Status.OperationState.SyncResult)
+	})
 }
 
 func Test_ManagerUpdateOperation(t *testing.T) {
@@ -0,0 +1,138 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package application
+
+import (
+	"context"
+
+	"github.com/argoproj-labs/argocd-agent/internal/manager"
+	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/sirupsen/logrus"
+	"github.com/wI2L/jsondiff"
+	"k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// ApplicationConditionAgentPropagationError is the condition set on an
+	// Application on the principal when the agent could not apply the last
+	// event the principal sent for it
+	ApplicationConditionAgentPropagationError v1alpha1.ApplicationConditionType = "AgentPropagationError"
+	// ApplicationConditionPrincipalPropagationError is the condition set on
+	// an Application on the agent when the principal could not apply the
+	// last event the agent sent for it
+	ApplicationConditionPrincipalPropagationError v1alpha1.ApplicationConditionType = "PrincipalPropagationError"
+)
+
+// propagationConditionType returns the type of the condition the manager
+// records failures of the peer to apply events with
+func (m *ApplicationManager) propagationConditionType() v1alpha1.ApplicationConditionType {
+	if m.role == manager.ManagerRolePrincipal {
+		return ApplicationConditionAgentPropagationError
+	}
+	return ApplicationConditionPrincipalPropagationError
+}
+
+// SetPropagationCondition records on the Application namespace/name that the
+// peer could not apply the last event sent for it, as a condition with the
+// given message. An empty message removes the condition. Applications that do
+// not exist are ignored.
+func (m *ApplicationManager) SetPropagationCondition(ctx context.Context, namespace, name, message string) error {
+	logCtx := logFor(ctx).WithFields(logrus.Fields{
+		"component":   "SetPropagationCondition",
+		"application": namespace + "/" + name,
+	})
+	condType := m.propagationConditionType()
+
+	// Most events are applied without error, so check the cached version
+	// of the Application before updating it. Should the cache lag behind,
+	// the condition is updated with the outcome of the next event.
+	app, err := m.applicationBackend.Get(ctx, name, namespace)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if _, changed := setCondition(app.Status.Conditions, condType, message); !changed {
+		return nil
+	}
+
+	updated, err := m.update(ctx, false, app, func(existing, incoming *v1alpha1.Application) {
+		existing.Status.Conditions, _ = setCondition(existing.Status.Conditions, condType, message)
+	}, func(existing, incoming *v1alpha1.Application) (jsondiff.Patch, error) {
+		conditions, _ := setCondition(existing.Status.Conditions, condType, message)
+		return jsondiff.Patch{{Type: "add", Path: "/status/conditions", Value: conditions}}, nil
+	})
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if m.role == manager.ManagerRolePrincipal {
+		if err := m.IgnoreChange(updated.QualifiedName(), updated.ResourceVersion); err != nil {
+			logCtx.Warnf("Could not ignore change %s for app %s: %v", updated.ResourceVersion, updated.QualifiedName(), err)
+		}
+	}
+	logCtx.WithField("message", message).Debug("Updated propagation condition")
+	return nil
+}
+
+// setCondition returns conditions with the condition of type condType set to
+// message, or removed if message is empty, and whether anything changed.
+func setCondition(conditions []v1alpha1.ApplicationCondition, condType v1alpha1.ApplicationConditionType, message string) ([]v1alpha1.ApplicationCondition, bool) {
+	out := make([]v1alpha1.ApplicationCondition, 0, len(conditions)+1)
+	found := false
+	for _, c := range conditions {
+		if c.Type != condType {
+			out = append(out, c)
+		} else if message != "" && c.Message == message && !found {
+			out = append(out, c)
+			found = true
+		}
+	}
+	if message != "" && !found {
+		now := v1.Now()
+		out = append(out, v1alpha1.ApplicationCondition{Type: condType, Message: message, LastTransitionTime: &now})
+	}
+	return out, found != (message != "") || len(out) != len(conditions)
+}
+
+// keepPropagationCondition carries the condition the principal records
+// failures of the agent to apply its events with over from existing to the
+// status of incoming, which was sent by the agent and does not know about it.
+func keepPropagationCondition(existing, incoming *v1alpha1.Application) {
+	message := ""
+	for _, c := range existing.Status.Conditions {
+		if c.Type == ApplicationConditionAgentPropagationError {
+			message = c.Message
+		}
+	}
+	conditions, changed := setCondition(incoming.Status.Conditions, ApplicationConditionAgentPropagationError, message)
+	if !changed {
+		return
+	}
+	// Keep the time the condition was first recorded
+	for i, c := range conditions {
+		if c.Type != ApplicationConditionAgentPropagationError {
+			continue
+		}
+		for _, e := range existing.Status.Conditions {
+			if e.Type == c.Type {
+				conditions[i] = e
+			}
+		}
+	}
+	incoming.Status.Conditions = conditions
+}
@@ -0,0 +1,112 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package application
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/internal/manager"
+	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_PropagationCondition(t *testing.T) {
+	newApp := func(conditions ...v1alpha1.ApplicationCondition) *v1alpha1.Application {
+		return &v1alpha1.Application{
+			ObjectMeta: v1.ObjectMeta{Name: "guestbook", Namespace: "cluster-1"},
+			Status: v1alpha1.ApplicationStatus{
+				Sync:       v1alpha1.SyncStatus{Status: v1alpha1.SyncStatusCodeSynced},
+				Conditions: conditions,
+			},
+		}
+	}
+	syncError := v1alpha1.ApplicationCondition{Type: v1alpha1.ApplicationConditionSyncError, Message: "sync failed"}
+
+	t.Run("Failures are recorded and cleared on the principal", func(t *testing.T) {
+		appC, mgr := fakeAppManager(t, newApp(syncError))
+		mgr.role = manager.ManagerRolePrincipal
+
+		require.NoError(t, mgr.SetPropagationCondition(context.TODO(), "cluster-1", "guestbook", "rejected"))
+		app, err := appC.ArgoprojV1alpha1().Applications("cluster-1").Get(context.TODO(), "guestbook", v1.GetOptions{})
+		require.NoError(t, err)
+		require.Len(t, app.Status.Conditions, 2)
+		assert.Equal(t, syncError, app.Status.Conditions[0])
+		assert.Equal(t, ApplicationConditionAgentPropagationError, app.Status.Conditions[1].Type)
+		assert.Equal(t, "rejected", app.Status.Conditions[1].Message)
+		assert.NotNil(t, app.Status.Conditions[1].LastTransitionTime)
+		assert.Equal(t, v1alpha1.SyncStatusCodeSynced, app.Status.Sync.Status)
+
+		// Wait for the cache to see the condition
+		require.Eventually(t, func() bool {
+			cached, err := mgr.applicationBackend.Get(context.TODO(), "guestbook", "cluster-1")
+			return err == nil && len(cached.Status.Conditions) == 2
+		}, 5*time.Second, 10*time.Millisecond)
+		require.NoError(t, mgr.SetPropagationCondition(context.TODO(), "cluster-1", "guestbook", ""))
+		app, err = appC.ArgoprojV1alpha1().Applications("cluster-1").Get(context.TODO(), "guestbook", v1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, []v1alpha1.ApplicationCondition{syncError}, app.Status.Conditions)
+	})
+
+	t.Run("Failures are recorded with their own type on the agent", func(t *testing.T) {
+		appC, mgr := fakeAppManager(t, newApp())
+		mgr.role = manager.ManagerRoleAgent
+
+		require.NoError(t, mgr.SetPropagationCondition(context.TODO(), "cluster-1", "guestbook", "rejected"))
+		app, err := appC.ArgoprojV1alpha1().Applications("cluster-1").Get(context.TODO(), "guestbook", v1.GetOptions{})
+		require.NoError(t, err)
+		require.Len(t, app.Status.Conditions, 1)
+		assert.Equal(t, ApplicationConditionPrincipalPropagationError, app.Status.Conditions[0].Type)
+	})
+
+	t.Run("Unknown applications are ignored", func(t *testing.T) {
+		_, mgr := fakeAppManager(t)
+		assert.NoError(t, mgr.SetPropagationCondition(context.TODO(), "cluster-1", "guestbook", "rejected"))
+	})
+
+	t.Run("Conditions are only changed when needed", func(t *testing.T) {
+		recorded := v1alpha1.ApplicationCondition{Type: ApplicationConditionAgentPropagationError, Message: "rejected", LastTransitionTime: &v1.Time{}}
+		conditions, changed := setCondition([]v1alpha1.ApplicationCondition{syncError, recorded}, recorded.Type, "rejected")
+		assert.False(t, changed)
+		assert.Equal(t, []v1alpha1.ApplicationCondition{syncError, recorded}, conditions)
+
+		conditions, changed = setCondition([]v1alpha1.ApplicationCondition{syncError, recorded}, recorded.Type, "failed")
+		assert.True(t, changed)
+		require.Len(t, conditions, 2)
+		assert.Equal(t, "failed", conditions[1].Message)
+
+		_, changed = setCondition([]v1alpha1.ApplicationCondition{syncError}, recorded.Type, "")
+		assert.False(t, changed)
+	})
+
+	t.Run("Status updates from the agent keep the condition", func(t *testing.T) {
+		recorded := v1alpha1.ApplicationCondition{Type: ApplicationConditionAgentPropagationError, Message: "rejected"}
+		appC, mgr := fakeAppManager(t, newApp(recorded))
+		mgr.role = manager.ManagerRolePrincipal
+
+		incoming := newApp(syncError)
+		incoming.Namespace = "argocd"
+		incoming.Status.Sync.Status = v1alpha1.SyncStatusCodeOutOfSync
+		_, err := mgr.UpdateStatus(context.TODO(), "cluster-1", incoming)
+		require.NoError(t, err)
+		app, err := appC.ArgoprojV1alpha1().Applications("cluster-1").Get(context.TODO(), "guestbook", v1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, v1alpha1.SyncStatusCodeOutOfSync, app.Status.Sync.Status)
+		assert.Equal(t, []v1alpha1.ApplicationCondition{syncError, recorded}, app.Status.Conditions)
+	})
+}
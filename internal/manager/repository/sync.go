@@ -0,0 +1,199 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repository
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// The principal may strip fields from repository secrets and encrypt the
+// remaining credentials before it sends them to managed agents. Encrypted
+// credentials stay unreadable in the send queues of the principal, which may
+// be persisted on disk or in Redis, and in the event journal. The agent
+// decrypts them with the same key before it writes the secret.
+
+// EncryptedFieldsAnnotation lists the data fields of a repository secret that
+// are encrypted with the repository key, separated by commas
+const EncryptedFieldsAnnotation = "argocd-agent.argoproj.io/encrypted-fields"
+
+// ErrRepositoryUndecryptable is returned for repository secrets whose fields
+// cannot be decrypted
+var ErrRepositoryUndecryptable = errors.New("repository secret cannot be decrypted")
+
+// plainFields are the fields that are never encrypted, since they tell which
+// repository a secret is for rather than how to access it
+var plainFields = []string{"name", "project", "type", "url"}
+
+// requiredFields are the fields that must not be filtered, since agents
+// cannot use a repository secret without them
+var requiredFields = []string{"url"}
+
+// ValidateFieldFilter returns an error if the repository secret fields
+// fields may not be excluded from synchronization
+func ValidateFieldFilter(fields []string) error {
+	for _, f := range fields {
+		if f == "" {
+			return fmt.Errorf("repository field name must not be empty")
+		}
+		if slices.Contains(requiredFields, f) {
+			return fmt.Errorf("repository field %s cannot be excluded", f)
+		}
+	}
+	return nil
+}
+
+// FilterFields returns a copy of repo without the data fields in exclude. It
+// returns repo itself if there is nothing to exclude.
+func FilterFields(repo *corev1.Secret, exclude []string) *corev1.Secret {
+	if len(exclude) == 0 {
+		return repo
+	}
+	filtered := repo.DeepCopy()
+	for _, f := range exclude {
+		delete(filtered.Data, f)
+		delete(filtered.StringData, f)
+	}
+	return filtered
+}
+
+// FieldCipher encrypts and decrypts the credentials in repository secrets
+// with a key shared by the principal and its agents. It is safe for
+// concurrent use.
+type FieldCipher struct {
+	aead cipher.AEAD
+}
+
+// NewFieldCipher returns a FieldCipher using a key derived from secret
+func NewFieldCipher(secret []byte) (*FieldCipher, error) {
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("repository encryption key must not be empty")
+	}
+	key, err := hkdf.Key(sha256.New, secret, nil, "argocd-agent repository fields", 32)
+	if err != nil {
+		return nil, fmt.Errorf("could not derive repository encryption key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &FieldCipher{aead: aead}, nil
+}
+
+// NewFieldCipherFromFile returns a FieldCipher using the key read from path.
+// Leading and trailing whitespace of the key is ignored.
+func NewFieldCipherFromFile(path string) (*FieldCipher, error) {
+	secret, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read repository encryption key: %w", err)
+	}
+	secret = bytes.TrimSpace(secret)
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("repository encryption key in %s is empty", path)
+	}
+	return NewFieldCipher(secret)
+}
+
+// fieldAAD returns what the encryption of field is bound to, so that its
+// value cannot be moved to another field or secret
+func fieldAAD(repo *corev1.Secret, field string) []byte {
+	return []byte(repo.Name + "\x00" + field)
+}
+
+// Encrypt returns a copy of repo whose data fields, other than those that
+// identify the repository, are encrypted. The encrypted fields are listed in
+// the EncryptedFieldsAnnotation of the copy.
+func (c *FieldCipher) Encrypt(repo *corev1.Secret) (*corev1.Secret, error) {
+	encrypted := repo.DeepCopy()
+	// The API server merges stringData into data, but secrets that were not
+	// read from it may still carry both
+	for f, v := range encrypted.StringData {
+		if encrypted.Data == nil {
+			encrypted.Data = map[string][]byte{}
+		}
+		encrypted.Data[f] = []byte(v)
+	}
+	encrypted.StringData = nil
+
+	var fields []string
+	for f, v := range encrypted.Data {
+		if slices.Contains(plainFields, f) {
+			continue
+		}
+		nonce := make([]byte, c.aead.NonceSize(), c.aead.NonceSize()+len(v)+c.aead.Overhead())
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, fmt.Errorf("could not generate nonce: %w", err)
+		}
+		encrypted.Data[f] = c.aead.Seal(nonce, nonce, v, fieldAAD(repo, f))
+		fields = append(fields, f)
+	}
+	if len(fields) == 0 {
+		return encrypted, nil
+	}
+	slices.Sort(fields)
+	if encrypted.Annotations == nil {
+		encrypted.Annotations = map[string]string{}
+	}
+	encrypted.Annotations[EncryptedFieldsAnnotation] = strings.Join(fields, ",")
+	return encrypted, nil
+}
+
+// Decrypt replaces the encrypted fields of repo with their plain values in
+// place, and removes the EncryptedFieldsAnnotation. It returns
+// ErrRepositoryUndecryptable if a field cannot be decrypted.
+func (c *FieldCipher) Decrypt(repo *corev1.Secret) error {
+	for _, f := range EncryptedFields(repo) {
+		v, ok := repo.Data[f]
+		if !ok {
+			return fmt.Errorf("%w: field %s is missing", ErrRepositoryUndecryptable, f)
+		}
+		ns := c.aead.NonceSize()
+		if len(v) < ns {
+			return fmt.Errorf("%w: field %s is too short", ErrRepositoryUndecryptable, f)
+		}
+		plain, err := c.aead.Open(nil, v[:ns], v[ns:], fieldAAD(repo, f))
+		if err != nil {
+			return fmt.Errorf("%w: field %s: %v", ErrRepositoryUndecryptable, f, err)
+		}
+		repo.Data[f] = plain
+	}
+	delete(repo.Annotations, EncryptedFieldsAnnotation)
+	return nil
+}
+
+// EncryptedFields returns the names of the data fields of repo that are
+// encrypted, or nil if there are none
+func EncryptedFields(repo *corev1.Secret) []string {
+	v := repo.Annotations[EncryptedFieldsAnnotation]
+	if v == "" {
+		return nil
+	}
+	return strings.Split(v, ",")
+}
@@ -0,0 +1,158 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testRepository() *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "private-repo",
+			Namespace: "argocd",
+		},
+		Data: map[string][]byte{
+			"type":     []byte("git"),
+			"url":      []byte("https://github.com/example/private.git"),
+			"project":  []byte("default"),
+			"username": []byte("deploy"),
+			"password": []byte("s3cr3t"),
+		},
+	}
+}
+
+func Test_ValidateFieldFilter(t *testing.T) {
+	assert.NoError(t, ValidateFieldFilter(nil))
+	assert.NoError(t, ValidateFieldFilter([]string{"password", "project"}))
+	assert.Error(t, ValidateFieldFilter([]string{"password", "url"}))
+	assert.Error(t, ValidateFieldFilter([]string{""}))
+}
+
+func Test_FilterFields(t *testing.T) {
+	t.Run("Nothing to exclude", func(t *testing.T) {
+		repo := testRepository()
+		assert.Same(t, repo, FilterFields(repo, nil))
+	})
+	t.Run("Excluded fields are stripped from a copy", func(t *testing.T) {
+		repo := testRepository()
+		repo.StringData = map[string]string{"password": "s3cr3t"}
+		filtered := FilterFields(repo, []string{"password", "missing"})
+		assert.NotContains(t, filtered.Data, "password")
+		assert.NotContains(t, filtered.StringData, "password")
+		assert.Equal(t, []byte("deploy"), filtered.Data["username"])
+		assert.Contains(t, repo.Data, "password", "original must not be modified")
+	})
+}
+
+func Test_FieldCipher(t *testing.T) {
+	c, err := NewFieldCipher([]byte("a shared key"))
+	require.NoError(t, err)
+
+	t.Run("Round trip", func(t *testing.T) {
+		repo := testRepository()
+		encrypted, err := c.Encrypt(repo)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"password", "username"}, EncryptedFields(encrypted))
+		assert.NotEqual(t, []byte("s3cr3t"), encrypted.Data["password"])
+		assert.NotEqual(t, []byte("deploy"), encrypted.Data["username"])
+		for _, f := range plainFields {
+			assert.Equal(t, repo.Data[f], encrypted.Data[f])
+		}
+		assert.Equal(t, []byte("s3cr3t"), repo.Data["password"], "original must not be modified")
+		assert.Empty(t, EncryptedFields(repo))
+
+		require.NoError(t, c.Decrypt(encrypted))
+		assert.Equal(t, repo.Data, encrypted.Data)
+		assert.NotContains(t, encrypted.Annotations, EncryptedFieldsAnnotation)
+	})
+
+	t.Run("String data is encrypted", func(t *testing.T) {
+		repo := testRepository()
+		repo.StringData = map[string]string{"bearerToken": "token"}
+		encrypted, err := c.Encrypt(repo)
+		require.NoError(t, err)
+		assert.Nil(t, encrypted.StringData)
+		assert.Contains(t, EncryptedFields(encrypted), "bearerToken")
+		require.NoError(t, c.Decrypt(encrypted))
+		assert.Equal(t, []byte("token"), encrypted.Data["bearerToken"])
+	})
+
+	t.Run("Nothing to encrypt", func(t *testing.T) {
+		repo := testRepository()
+		delete(repo.Data, "username")
+		delete(repo.Data, "password")
+		encrypted, err := c.Encrypt(repo)
+		require.NoError(t, err)
+		assert.NotContains(t, encrypted.Annotations, EncryptedFieldsAnnotation)
+		require.NoError(t, c.Decrypt(encrypted))
+	})
+
+	t.Run("Wrong key", func(t *testing.T) {
+		other, err := NewFieldCipher([]byte("another key"))
+		require.NoError(t, err)
+		encrypted, err := c.Encrypt(testRepository())
+		require.NoError(t, err)
+		assert.ErrorIs(t, other.Decrypt(encrypted), ErrRepositoryUndecryptable)
+	})
+
+	t.Run("Fields cannot be swapped", func(t *testing.T) {
+		encrypted, err := c.Encrypt(testRepository())
+		require.NoError(t, err)
+		encrypted.Data["password"], encrypted.Data["username"] = encrypted.Data["username"], encrypted.Data["password"]
+		assert.ErrorIs(t, c.Decrypt(encrypted), ErrRepositoryUndecryptable)
+	})
+
+	t.Run("Missing field", func(t *testing.T) {
+		encrypted, err := c.Encrypt(testRepository())
+		require.NoError(t, err)
+		delete(encrypted.Data, "password")
+		assert.ErrorIs(t, c.Decrypt(encrypted), ErrRepositoryUndecryptable)
+	})
+
+	t.Run("Empty key", func(t *testing.T) {
+		_, err := NewFieldCipher(nil)
+		assert.Error(t, err)
+	})
+}
+
+func Test_NewFieldCipherFromFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "key")
+	require.NoError(t, os.WriteFile(path, []byte("a shared key\n"), 0600))
+	fromFile, err := NewFieldCipherFromFile(path)
+	require.NoError(t, err)
+	c, err := NewFieldCipher([]byte("a shared key"))
+	require.NoError(t, err)
+
+	// Trailing whitespace is not part of the key
+	encrypted, err := fromFile.Encrypt(testRepository())
+	require.NoError(t, err)
+	require.NoError(t, c.Decrypt(encrypted))
+
+	empty := filepath.Join(dir, "empty")
+	require.NoError(t, os.WriteFile(empty, []byte(" \n"), 0600))
+	_, err = NewFieldCipherFromFile(empty)
+	assert.Error(t, err)
+	_, err = NewFieldCipherFromFile(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
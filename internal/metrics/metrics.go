@@ -30,6 +30,7 @@ const (
 	EventProcessingSuccess    EventProcessingStatus = "success"
 	EventProcessingDiscarded  EventProcessingStatus = "discarded"
 	EventProcessingNotAllowed EventProcessingStatus = "not-allowed"
+	EventProcessingInvalid    EventProcessingStatus = "invalid"
 )
 
 type InformerMetrics struct {
@@ -63,6 +64,8 @@ type PrincipalMetrics struct {
 
 	GPGKeyCount prometheus.Gauge
 
+	VolatileSigningKey prometheus.Gauge
+
 	EventReceived prometheus.Counter
 	EventSent     prometheus.Counter
 
@@ -73,6 +76,25 @@ type PrincipalMetrics struct {
 	PrincipalErrors *prometheus.CounterVec
 
 	AgentConnectionCount *prometheus.CounterVec
+	AgentLastSeen        *prometheus.GaugeVec
+	AuthAttemptsRejected *prometheus.CounterVec
+
+	AgentBandwidthThrottled *prometheus.CounterVec
+	AgentQueueOverflows     *prometheus.CounterVec
+	AgentQueueExpired       *prometheus.CounterVec
+	AgentQueues             *AgentQueueMetrics
+
+	EventSequenceGaps *prometheus.CounterVec
+	EventsOutOfOrder  *prometheus.CounterVec
+	EventsDuplicate   *prometheus.CounterVec
+
+	OpenConnections     prometheus.Gauge
+	ConnectionsRejected *prometheus.CounterVec
+
+	ClientCertsRevoked    *prometheus.CounterVec
+	RevocationCheckErrors *prometheus.CounterVec
+
+	CertificateExpiryDays *prometheus.GaugeVec
 
 	ResourceProxyRequests *prometheus.CounterVec
 	ResourceProxyErrors   *prometheus.CounterVec
@@ -98,6 +120,10 @@ type AgentMetrics struct {
 	ResourceProxyErrors   prometheus.Counter
 	RedisProxyRequests    *prometheus.CounterVec
 	RedisProxyErrors      *prometheus.CounterVec
+
+	EventSequenceGaps *prometheus.CounterVec
+	EventsOutOfOrder  *prometheus.CounterVec
+	EventsDuplicate   *prometheus.CounterVec
 }
 
 func NewInformerMetrics(label string) *InformerMetrics {
@@ -181,6 +207,11 @@ func NewPrincipalMetrics() *PrincipalMetrics {
 			Help: "The current number of GPG keys on the control plane",
 		}),
 
+		VolatileSigningKey: promauto.NewGauge(prometheus.GaugeOpts{
+			Name: "argocd_principal_volatile_signing_key",
+			Help: "Whether the principal uses a JWT signing key generated at startup (1 = volatile, 0 = persistent)",
+		}),
+
 		EventReceived: promauto.NewCounter(prometheus.CounterOpts{
 			Name: "principal_events_received",
 			Help: "The total number of events received by principal",
@@ -215,6 +246,67 @@ func NewPrincipalMetrics() *PrincipalMetrics {
 			Help: "The total number of successful connections from each agent to the principal",
 		}, []string{"agent_name"}),
 
+		AgentLastSeen: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "argocd_principal_agent_last_seen_timestamp_seconds",
+			Help: "The Unix time at which the principal last received an event from each agent",
+		}, []string{"agent_name"}),
+
+		AgentBandwidthThrottled: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "argocd_principal_agent_bandwidth_throttled_seconds_total",
+			Help: "The total time sending events to each agent was delayed by its bandwidth limit",
+		}, []string{"agent_name"}),
+		AgentQueueOverflows: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "argocd_principal_agent_queue_overflows_total",
+			Help: "The total number of events added to the full send queue of each agent, by overflow policy",
+		}, []string{"agent_name", "policy"}),
+		AgentQueueExpired: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "argocd_principal_agent_queue_expired_total",
+			Help: "The total number of events dropped from the send queue of each agent because they expired, by event type",
+		}, []string{"agent_name", "event_type"}),
+		AgentQueues: NewAgentQueueMetrics("argocd_principal"),
+
+		EventSequenceGaps: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "argocd_principal_event_sequence_gaps_total",
+			Help: "The total number of events received from each agent after an earlier event for the same resource was lost",
+		}, []string{"agent_name", "resource_type"}),
+		EventsOutOfOrder: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "argocd_principal_events_out_of_order_total",
+			Help: "The total number of events received from each agent and discarded because a later event for the same resource was already applied",
+		}, []string{"agent_name", "resource_type"}),
+		EventsDuplicate: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "argocd_principal_events_duplicate_total",
+			Help: "The total number of events received from each agent and discarded because they were already applied",
+		}, []string{"agent_name", "resource_type"}),
+
+		OpenConnections: promauto.NewGauge(prometheus.GaugeOpts{
+			Name: "argocd_principal_open_connections",
+			Help: "The number of agent connections currently open, if connections are limited",
+		}),
+
+		ConnectionsRejected: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "argocd_principal_connections_rejected_total",
+			Help: "The total number of connections and streams rejected because of connection limits",
+		}, []string{"kind"}),
+
+		AuthAttemptsRejected: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "argocd_principal_auth_attempts_rejected_total",
+			Help: "The total number of authentication attempts rejected by rate limiting or lockouts",
+		}, []string{"reason"}),
+
+		ClientCertsRevoked: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "argocd_principal_client_certs_revoked_total",
+			Help: "The total number of TLS handshakes rejected because the agent's client certificate was revoked",
+		}, []string{"source"}),
+		RevocationCheckErrors: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "argocd_principal_revocation_check_errors_total",
+			Help: "The total number of client certificate revocation checks that could not be completed",
+		}, []string{"source"}),
+
+		CertificateExpiryDays: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "argocd_principal_certificate_expiry_days",
+			Help: "The number of days until the soonest expiring certificate of each kind used by the principal expires",
+		}, []string{"certificate"}),
+
 		ResourceProxyRequests: promauto.NewCounterVec(prometheus.CounterOpts{
 			Name: "argocd_principal_resource_proxy_requests_total",
 			Help: "The total number of resource proxy requests received",
@@ -300,6 +392,19 @@ func NewAgentMetrics() *AgentMetrics {
 			Name: "argocd_agent_redis_proxy_errors_total",
 			Help: "The total number of Redis proxy request failures on the agent",
 		}, []string{"command"}),
+
+		EventSequenceGaps: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "argocd_agent_event_sequence_gaps_total",
+			Help: "The total number of events received from the principal after an earlier event for the same resource was lost",
+		}, []string{"resource_type"}),
+		EventsOutOfOrder: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "argocd_agent_events_out_of_order_total",
+			Help: "The total number of events received from the principal and discarded because a later event for the same resource was already applied",
+		}, []string{"resource_type"}),
+		EventsDuplicate: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "argocd_agent_events_duplicate_total",
+			Help: "The total number of events received from the principal and discarded because they were already applied",
+		}, []string{"resource_type"}),
 	}
 }
 
@@ -367,3 +472,14 @@ func GetAvgAgentConnectionTime(metrics *PrincipalMetrics) {
 		metrics.AvgAgentConnectionTime.Set(float64(0))
 	}
 }
+
+// ObserveWithCorrelationID records v with o. If correlationID is not empty,
+// it is attached to the observation as exemplar, so that the event behind an
+// outlier can be looked up in the logs of agent and principal.
+func ObserveWithCorrelationID(o prometheus.Observer, v float64, correlationID string) {
+	if eo, ok := o.(prometheus.ExemplarObserver); ok && correlationID != "" {
+		eo.ObserveWithExemplar(v, prometheus.Labels{"correlation_id": correlationID})
+		return
+	}
+	o.Observe(v)
+}
@@ -15,7 +15,10 @@
 package metrics
 
 import (
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"k8s.io/client-go/util/workqueue"
 )
 
@@ -142,3 +145,61 @@ func RegisterQueueMetrics(prefix string) {
 	)
 	workqueue.SetProvider(provider)
 }
+
+// AgentQueueMetrics holds metrics of the send and receive queues of each
+// agent. It receives its measurements from the queues as their observer.
+type AgentQueueMetrics struct {
+	Depth    *prometheus.GaugeVec
+	Enqueues *prometheus.CounterVec
+	Dequeues *prometheus.CounterVec
+	WaitTime *prometheus.HistogramVec
+}
+
+// NewAgentQueueMetrics returns the agent queue metrics with the given prefix,
+// registered with the default registry.
+func NewAgentQueueMetrics(prefix string) *AgentQueueMetrics {
+	labels := []string{"agent_name", "direction"}
+	return &AgentQueueMetrics{
+		Depth: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Name: prefix + "_agent_queue_depth",
+			Help: "The current number of events in the queues of each agent",
+		}, labels),
+		Enqueues: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: prefix + "_agent_queue_enqueued_total",
+			Help: "The total number of events added to the queues of each agent",
+		}, labels),
+		Dequeues: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: prefix + "_agent_queue_dequeued_total",
+			Help: "The total number of events taken from the queues of each agent",
+		}, labels),
+		WaitTime: promauto.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    prefix + "_agent_queue_wait_seconds",
+			Help:    "Histogram of the time events spent in the queues of each agent (in seconds)",
+			Buckets: prometheus.ExponentialBuckets(0.001, 4, 10),
+		}, labels),
+	}
+}
+
+// Enqueued records an event added to the queue of the given agent and
+// direction.
+func (m *AgentQueueMetrics) Enqueued(agentName, direction string, depth int) {
+	m.Enqueues.WithLabelValues(agentName, direction).Inc()
+	m.Depth.WithLabelValues(agentName, direction).Set(float64(depth))
+}
+
+// Dequeued records an event taken from the queue of the given agent and
+// direction after it has been waiting in the queue for wait.
+func (m *AgentQueueMetrics) Dequeued(agentName, direction string, depth int, wait time.Duration) {
+	m.Dequeues.WithLabelValues(agentName, direction).Inc()
+	m.Depth.WithLabelValues(agentName, direction).Set(float64(depth))
+	m.WaitTime.WithLabelValues(agentName, direction).Observe(wait.Seconds())
+}
+
+// Deleted removes the metrics of the queues of the given agent.
+func (m *AgentQueueMetrics) Deleted(agentName string) {
+	labels := prometheus.Labels{"agent_name": agentName}
+	m.Depth.DeletePartialMatch(labels)
+	m.Enqueues.DeletePartialMatch(labels)
+	m.Dequeues.DeletePartialMatch(labels)
+	m.WaitTime.DeletePartialMatch(labels)
+}
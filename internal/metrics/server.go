@@ -18,15 +18,23 @@ import (
 	"fmt"
 	"net/http"
 	neturl "net/url"
+	"strings"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 type MetricsServerOptions struct {
 	host string
 	port int
 	path string
+	// handlers are additional handlers served next to the metrics endpoint
+	handlers map[string]http.Handler
+	// grpcHandler serves gRPC requests over cleartext HTTP/2 on the same port
+	grpcHandler http.Handler
 }
 
 type MetricsServerOption func(*MetricsServerOptions)
@@ -65,6 +73,37 @@ func WithListener(hostname string, port int) MetricsServerOption {
 	}
 }
 
+// WithHandler serves handler at path in addition to the metrics endpoint
+func WithHandler(path string, handler http.Handler) MetricsServerOption {
+	return func(o *MetricsServerOptions) {
+		if o.handlers == nil {
+			o.handlers = make(map[string]http.Handler)
+		}
+		o.handlers[path] = handler
+	}
+}
+
+// WithGRPCHandler serves gRPC requests received over cleartext HTTP/2 with
+// handler, which usually is a *grpc.Server. All other requests are served by
+// the metrics server as usual.
+func WithGRPCHandler(handler http.Handler) MetricsServerOption {
+	return func(o *MetricsServerOptions) {
+		o.grpcHandler = handler
+	}
+}
+
+// grpcMux returns a handler that routes gRPC requests to grpcHandler and all
+// other requests to handler.
+func grpcMux(handler, grpcHandler http.Handler) http.Handler {
+	return h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			grpcHandler.ServeHTTP(w, r)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}), &http2.Server{})
+}
+
 // StartMetricsServer starts the metrics server in a separate go routine and
 // returns an error channel.
 func StartMetricsServer(opts ...MetricsServerOption) chan error {
@@ -80,8 +119,17 @@ func StartMetricsServer(opts ...MetricsServerOption) chan error {
 	logrus.Infof("Starting metrics server on %s", url(config))
 	go func() {
 		sm := http.NewServeMux()
-		sm.Handle(config.path, promhttp.Handler())
-		errCh <- http.ListenAndServe(listener(config), sm)
+		// Exemplars are only exposed in the OpenMetrics format
+		sm.Handle(config.path, promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+			promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true})))
+		for path, handler := range config.handlers {
+			sm.Handle(path, handler)
+		}
+		var handler http.Handler = sm
+		if config.grpcHandler != nil {
+			handler = grpcMux(sm, config.grpcHandler)
+		}
+		errCh <- http.ListenAndServe(listener(config), handler)
 	}()
 	return errCh
 }
@@ -15,6 +15,7 @@
 package metrics
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"testing"
@@ -22,6 +23,10 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 func fetchMetricsOutput(t *testing.T) string {
@@ -48,3 +53,35 @@ func Test_MetricsServer(t *testing.T) {
 		}
 	})
 }
+
+func Test_MetricsServerWithGRPCHandler(t *testing.T) {
+	grpcSrv := grpc.NewServer()
+	healthpb.RegisterHealthServer(grpcSrv, health.NewServer())
+	errCh := StartMetricsServer(WithListener("127.0.0.1", 31338), WithGRPCHandler(grpcSrv))
+
+	conn, err := grpc.NewClient("127.0.0.1:31338", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	t.Run("Serve gRPC health checks", func(t *testing.T) {
+		var resp *healthpb.HealthCheckResponse
+		require.Eventually(t, func() bool {
+			resp, err = healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+			return err == nil
+		}, 5*time.Second, 100*time.Millisecond)
+		assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+	})
+
+	t.Run("Serve metrics on the same port", func(t *testing.T) {
+		r, err := http.Get("http://127.0.0.1:31338/metrics")
+		require.NoError(t, err)
+		r.Body.Close()
+		assert.Equal(t, http.StatusOK, r.StatusCode)
+	})
+
+	select {
+	case err := <-errCh:
+		assert.NoError(t, err)
+	default:
+	}
+}
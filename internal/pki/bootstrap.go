@@ -0,0 +1,206 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pki bootstraps a self-signed PKI for development and proof of
+// concept deployments. It generates a CA, a server certificate for the
+// principal and client certificates for agents, and persists them to
+// Secrets, from where they are picked up by the principal and can be copied
+// to the agents' clusters.
+//
+// Certificates generated this way are not meant to be used in production.
+package pki
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/argoproj-labs/argocd-agent/internal/logging"
+	"github.com/argoproj-labs/argocd-agent/internal/tlsutil"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// LabelKeyAgentName is set on the Secrets holding the client certificates
+// of agents, with the name of the agent as value
+const LabelKeyAgentName = "argocd-agent.argoproj-labs.io/agent-name"
+
+// LabelKeyGenerated is set on all Secrets created by the Bootstrapper
+const LabelKeyGenerated = "argocd-agent.argoproj-labs.io/generated-pki"
+
+// caCertField is the name of the field the CA certificate is stored in
+const caCertField = "ca.crt"
+
+// Config configures the PKI generated by the Bootstrapper
+type Config struct {
+	// CASecretName is the name of the Secret holding the CA certificate and
+	// key
+	CASecretName string
+	// ServerSecretName is the name of the Secret holding the principal's
+	// server certificate and key
+	ServerSecretName string
+	// ClientSecretPrefix is the prefix of the names of the Secrets holding
+	// the agents' client certificates. The name of the agent is appended to
+	// it.
+	ClientSecretPrefix string
+	// DNSNames and IPAddresses are the subject alternative names of the
+	// principal's server certificate
+	DNSNames    []string
+	IPAddresses []string
+	// KeyOptions configures the type of the keys generated
+	KeyOptions tlsutil.KeyGenOptions
+}
+
+// Bootstrapper generates the PKI and persists it to Secrets in a namespace.
+// Existing Secrets are never overwritten, so certificates which have been
+// replaced by the operator are kept.
+type Bootstrapper struct {
+	kube      kubernetes.Interface
+	namespace string
+	config    Config
+}
+
+// NewBootstrapper returns a Bootstrapper persisting the PKI to Secrets in
+// namespace
+func NewBootstrapper(kube kubernetes.Interface, namespace string, config Config) (*Bootstrapper, error) {
+	if config.CASecretName == "" || config.ServerSecretName == "" || config.ClientSecretPrefix == "" {
+		return nil, fmt.Errorf("secret names must not be empty")
+	}
+	return &Bootstrapper{kube: kube, namespace: namespace, config: config}, nil
+}
+
+// EnsureCA returns the CA from its Secret, and generates it if the Secret
+// does not exist yet.
+func (b *Bootstrapper) EnsureCA(ctx context.Context) (tls.Certificate, error) {
+	cert, err := tlsutil.TLSCertFromSecret(ctx, b.kube, b.namespace, b.config.CASecretName)
+	if err == nil {
+		return cert, nil
+	} else if !apierrors.IsNotFound(err) {
+		return tls.Certificate{}, fmt.Errorf("could not read CA: %w", err)
+	}
+	certPEM, keyPEM, err := tlsutil.GenerateCaCertificate("argocd-agent-ca", tlsutil.DefaultCACertValidityDays, b.config.KeyOptions)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("could not generate CA: %w", err)
+	}
+	created, err := b.createSecret(ctx, b.config.CASecretName, "", []byte(certPEM), []byte(keyPEM), nil)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if !created {
+		// Somebody else created the CA in the meantime
+		return tlsutil.TLSCertFromSecret(ctx, b.kube, b.namespace, b.config.CASecretName)
+	}
+	log().Infof("Generated CA in secret %s/%s", b.namespace, b.config.CASecretName)
+	return tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+}
+
+// EnsureServerCertificate generates the principal's server certificate,
+// signed by ca, unless its Secret already exists.
+func (b *Bootstrapper) EnsureServerCertificate(ctx context.Context, ca tls.Certificate) error {
+	certPEM, keyPEM, err := tlsutil.GenerateServerCertificate("argocd-agent-principal", ca.Leaf, ca.PrivateKey, b.config.IPAddresses, b.config.DNSNames, tlsutil.DefaultLeafCertValidityDays, b.config.KeyOptions)
+	if err != nil {
+		return fmt.Errorf("could not generate server certificate: %w", err)
+	}
+	created, err := b.createSecret(ctx, b.config.ServerSecretName, "", []byte(certPEM), []byte(keyPEM), ca.Certificate[0])
+	if err != nil {
+		return err
+	}
+	if created {
+		log().Infof("Generated server certificate in secret %s/%s", b.namespace, b.config.ServerSecretName)
+	}
+	return nil
+}
+
+// EnsureClientCertificate generates a client certificate for the agent
+// with the given name, signed by ca, unless its Secret already exists. It
+// returns the name of the Secret.
+func (b *Bootstrapper) EnsureClientCertificate(ctx context.Context, ca tls.Certificate, agentName string) (string, error) {
+	name := b.ClientSecretName(agentName)
+	certPEM, keyPEM, err := tlsutil.GenerateClientCertificate(agentName, ca.Leaf, ca.PrivateKey, tlsutil.DefaultLeafCertValidityDays, b.config.KeyOptions)
+	if err != nil {
+		return "", fmt.Errorf("could not generate client certificate for agent %s: %w", agentName, err)
+	}
+	created, err := b.createSecret(ctx, name, agentName, []byte(certPEM), []byte(keyPEM), ca.Certificate[0])
+	if err != nil {
+		return "", err
+	}
+	if created {
+		log().Infof("Generated client certificate for agent %s in secret %s/%s", agentName, b.namespace, name)
+	}
+	return name, nil
+}
+
+// ClientSecretName returns the name of the Secret holding the client
+// certificate of the agent with the given name
+func (b *Bootstrapper) ClientSecretName(agentName string) string {
+	return b.config.ClientSecretPrefix + "-" + agentName
+}
+
+// Bootstrap generates the CA and the server certificate, as well as client
+// certificates for the given agents, where they do not exist yet. It
+// returns the CA certificate in PEM format.
+func (b *Bootstrapper) Bootstrap(ctx context.Context, agentNames ...string) ([]byte, error) {
+	ca, err := b.EnsureCA(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.EnsureServerCertificate(ctx, ca); err != nil {
+		return nil, err
+	}
+	for _, agentName := range agentNames {
+		if _, err := b.EnsureClientCertificate(ctx, ca, agentName); err != nil {
+			return nil, err
+		}
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Certificate[0]}), nil
+}
+
+// createSecret creates a TLS Secret with the given certificate and key, and
+// the CA certificate if given. It returns false if the Secret already
+// exists.
+func (b *Bootstrapper) createSecret(ctx context.Context, name, agentName string, certPEM, keyPEM, caDER []byte) (bool, error) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: b.namespace,
+			Labels:    map[string]string{LabelKeyGenerated: "true"},
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       certPEM,
+			corev1.TLSPrivateKeyKey: keyPEM,
+		},
+	}
+	if agentName != "" {
+		secret.Labels[LabelKeyAgentName] = agentName
+	}
+	if caDER != nil {
+		secret.Data[caCertField] = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})
+	}
+	_, err := b.kube.CoreV1().Secrets(b.namespace).Create(ctx, secret, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("could not create secret %s/%s: %w", b.namespace, name, err)
+	}
+	return true, nil
+}
+
+func log() *logrus.Entry {
+	return logging.GetDefaultLogger().ComponentLogger("PKI")
+}
@@ -0,0 +1,107 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pki
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/argoproj-labs/argocd-agent/internal/tlsutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+var testConfig = Config{
+	CASecretName:       "argocd-agent-ca",
+	ServerSecretName:   "argocd-agent-principal-tls",
+	ClientSecretPrefix: "argocd-agent-client-tls",
+	DNSNames:           []string{"principal.example.com"},
+	IPAddresses:        []string{"127.0.0.1"},
+	KeyOptions:         tlsutil.KeyGenOptions{RSABits: 2048},
+}
+
+func Test_Bootstrap(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("PKI is generated", func(t *testing.T) {
+		kube := kubefake.NewClientset()
+		b, err := NewBootstrapper(kube, "argocd", testConfig)
+		require.NoError(t, err)
+		caPEM, err := b.Bootstrap(ctx, "agent-1")
+		require.NoError(t, err)
+
+		block, _ := pem.Decode(caPEM)
+		require.NotNil(t, block)
+		ca, err := x509.ParseCertificate(block.Bytes)
+		require.NoError(t, err)
+		assert.True(t, ca.IsCA)
+
+		server, err := tlsutil.TLSCertFromSecret(ctx, kube, "argocd", "argocd-agent-principal-tls")
+		require.NoError(t, err)
+		assert.NoError(t, server.Leaf.CheckSignatureFrom(ca))
+		assert.Equal(t, []string{"principal.example.com"}, server.Leaf.DNSNames)
+
+		client, err := tlsutil.TLSCertFromSecret(ctx, kube, "argocd", "argocd-agent-client-tls-agent-1")
+		require.NoError(t, err)
+		assert.NoError(t, client.Leaf.CheckSignatureFrom(ca))
+		assert.Equal(t, "agent-1", client.Leaf.Subject.CommonName)
+
+		secret, err := kube.CoreV1().Secrets("argocd").Get(ctx, "argocd-agent-client-tls-agent-1", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "agent-1", secret.Labels[LabelKeyAgentName])
+		assert.Equal(t, caPEM, secret.Data["ca.crt"])
+	})
+
+	t.Run("Existing secrets are kept", func(t *testing.T) {
+		kube := kubefake.NewClientset()
+		b, err := NewBootstrapper(kube, "argocd", testConfig)
+		require.NoError(t, err)
+		first, err := b.Bootstrap(ctx, "agent-1")
+		require.NoError(t, err)
+		server, err := kube.CoreV1().Secrets("argocd").Get(ctx, "argocd-agent-principal-tls", metav1.GetOptions{})
+		require.NoError(t, err)
+
+		second, err := b.Bootstrap(ctx, "agent-1", "agent-2")
+		require.NoError(t, err)
+		assert.Equal(t, first, second)
+		unchanged, err := kube.CoreV1().Secrets("argocd").Get(ctx, "argocd-agent-principal-tls", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, server.Data, unchanged.Data)
+		_, err = kube.CoreV1().Secrets("argocd").Get(ctx, "argocd-agent-client-tls-agent-2", metav1.GetOptions{})
+		assert.NoError(t, err)
+	})
+
+	t.Run("Invalid CA secret", func(t *testing.T) {
+		kube := kubefake.NewClientset(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "argocd-agent-ca", Namespace: "argocd"},
+			Type:       corev1.SecretTypeOpaque,
+			Data:       map[string][]byte{"foo": []byte("bar")},
+		})
+		b, err := NewBootstrapper(kube, "argocd", testConfig)
+		require.NoError(t, err)
+		_, err = b.Bootstrap(ctx)
+		assert.ErrorContains(t, err, "could not read CA")
+	})
+
+	t.Run("Secret names are required", func(t *testing.T) {
+		_, err := NewBootstrapper(kubefake.NewClientset(), "argocd", Config{})
+		assert.Error(t, err)
+	})
+}
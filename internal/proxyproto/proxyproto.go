@@ -0,0 +1,306 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package proxyproto implements the server side of the PROXY protocol in
+// versions 1 and 2, as specified by HAProxy. Load balancers operating on
+// layer 4 send a PROXY header at the start of each connection, carrying the
+// address of the client that originally connected to them.
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/internal/ipfilter"
+	"github.com/argoproj-labs/argocd-agent/internal/logging"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultHeaderTimeout is the default time a connection has to send its
+// PROXY header after being accepted
+const DefaultHeaderTimeout = 10 * time.Second
+
+const (
+	// v1Prefix is the start of a version 1 header
+	v1Prefix = "PROXY "
+	// v1MaxLength is the maximum length of a version 1 header, including
+	// the trailing CRLF
+	v1MaxLength = 107
+)
+
+// v2Signature is the start of a version 2 header
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+const (
+	v2CmdLocal = 0x0
+	v2CmdProxy = 0x1
+
+	v2FamTCP4 = 0x11
+	v2FamTCP6 = 0x21
+)
+
+// ErrNoHeader is returned when a connection did not start with a PROXY
+// header
+var ErrNoHeader = errors.New("no PROXY protocol header")
+
+// ReadHeader reads a PROXY protocol header of version 1 or 2 from r and
+// returns the source address it carries. If the header does not carry a
+// source address, e.g. for health checks of the load balancer, nil is
+// returned. Only the header is consumed from r.
+func ReadHeader(r *bufio.Reader) (net.Addr, error) {
+	sig, err := r.Peek(len(v2Signature))
+	if err == nil && bytes.Equal(sig, v2Signature) {
+		return readV2Header(r)
+	}
+	prefix, err := r.Peek(len(v1Prefix))
+	if err == nil && string(prefix) == v1Prefix {
+		return readV1Header(r)
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return nil, ErrNoHeader
+}
+
+// readV1Header reads a header in the human-readable format of version 1,
+// e.g. "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n"
+func readV1Header(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("could not read PROXY header: %w", err)
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+		if len(line) >= v1MaxLength {
+			return nil, fmt.Errorf("PROXY header exceeds %d bytes", v1MaxLength)
+		}
+	}
+	header, ok := strings.CutSuffix(string(line), "\r\n")
+	if !ok {
+		return nil, fmt.Errorf("PROXY header not terminated by CRLF")
+	}
+	fields := strings.Split(header, " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("malformed PROXY header %q", header)
+	}
+	addr, err := netip.ParseAddr(fields[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid source address in PROXY header: %w", err)
+	}
+	if (fields[1] == "TCP4") != addr.Is4() {
+		return nil, fmt.Errorf("source address %s does not match protocol %s", addr, fields[1])
+	}
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source port in PROXY header: %w", err)
+	}
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(addr, uint16(port))), nil
+}
+
+// readV2Header reads a header in the binary format of version 2
+func readV2Header(r *bufio.Reader) (net.Addr, error) {
+	hdr := make([]byte, len(v2Signature)+4)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, fmt.Errorf("could not read PROXY header: %w", err)
+	}
+	verCmd, fam := hdr[12], hdr[13]
+	length := binary.BigEndian.Uint16(hdr[14:16])
+	if verCmd>>4 != 2 {
+		return nil, fmt.Errorf("unsupported PROXY protocol version %d", verCmd>>4)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, fmt.Errorf("could not read PROXY header: %w", err)
+	}
+	switch verCmd & 0xf {
+	case v2CmdLocal:
+		return nil, nil
+	case v2CmdProxy:
+	default:
+		return nil, fmt.Errorf("unsupported PROXY command %d", verCmd&0xf)
+	}
+	switch fam {
+	case v2FamTCP4:
+		if len(payload) < 12 {
+			return nil, fmt.Errorf("PROXY header too short for IPv4 addresses")
+		}
+		addr := netip.AddrFrom4([4]byte(payload[0:4]))
+		return net.TCPAddrFromAddrPort(netip.AddrPortFrom(addr, binary.BigEndian.Uint16(payload[8:10]))), nil
+	case v2FamTCP6:
+		if len(payload) < 36 {
+			return nil, fmt.Errorf("PROXY header too short for IPv6 addresses")
+		}
+		addr := netip.AddrFrom16([16]byte(payload[0:16]))
+		return net.TCPAddrFromAddrPort(netip.AddrPortFrom(addr, binary.BigEndian.Uint16(payload[32:34]))), nil
+	default:
+		// Other address families, such as UNIX sockets, carry no address
+		// we could make use of.
+		return nil, nil
+	}
+}
+
+// Listener is a net.Listener reading the PROXY header of connections from
+// trusted load balancers. The RemoteAddr of such connections reports the
+// source address from the header.
+//
+// Headers are read in the background, so that a slow or malicious client
+// cannot block accepting other connections.
+type Listener struct {
+	net.Listener
+	trusted       *ipfilter.Rules
+	headerTimeout time.Duration
+
+	conns     chan net.Conn
+	errs      chan error
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewListener returns a Listener reading PROXY headers from connections
+// accepted by l. Connections from addresses allowed by trusted must start
+// with a PROXY header and are closed otherwise. Connections from other
+// addresses are passed on unchanged. If trusted is nil, all connections
+// must start with a PROXY header. If headerTimeout is not positive,
+// DefaultHeaderTimeout is used.
+func NewListener(l net.Listener, trusted *ipfilter.Rules, headerTimeout time.Duration) *Listener {
+	if trusted == nil {
+		trusted = &ipfilter.Rules{}
+	}
+	if headerTimeout <= 0 {
+		headerTimeout = DefaultHeaderTimeout
+	}
+	pl := &Listener{
+		Listener:      l,
+		trusted:       trusted,
+		headerTimeout: headerTimeout,
+		conns:         make(chan net.Conn),
+		errs:          make(chan error),
+		done:          make(chan struct{}),
+	}
+	go pl.acceptLoop()
+	return pl
+}
+
+// Accept returns the next connection whose PROXY header has been read
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case err := <-l.errs:
+		return nil, err
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close closes the listener
+func (l *Listener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.done)
+	})
+	return l.Listener.Close()
+}
+
+func (l *Listener) acceptLoop() {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			select {
+			case l.errs <- err:
+			case <-l.done:
+				return
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		go l.handle(c)
+	}
+}
+
+func (l *Listener) handle(c net.Conn) {
+	pc, err := l.readHeader(c)
+	if err != nil {
+		log().WithError(err).WithField("address", c.RemoteAddr().String()).Debug("Rejecting connection")
+		_ = c.Close()
+		return
+	}
+	select {
+	case l.conns <- pc:
+	case <-l.done:
+		_ = c.Close()
+	}
+}
+
+// readHeader reads the PROXY header from c if it is from a trusted address
+func (l *Listener) readHeader(c net.Conn) (net.Conn, error) {
+	ap, err := netip.ParseAddrPort(c.RemoteAddr().String())
+	if err == nil && !l.trusted.Allows(ap.Addr()) {
+		return c, nil
+	}
+	if err := c.SetReadDeadline(time.Now().Add(l.headerTimeout)); err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(c)
+	src, err := ReadHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.SetReadDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+	if src == nil {
+		src = c.RemoteAddr()
+	}
+	return &conn{Conn: c, r: r, remote: src}, nil
+}
+
+// conn is a connection whose PROXY header has been read
+type conn struct {
+	net.Conn
+	// r holds any data read past the header
+	r      *bufio.Reader
+	remote net.Addr
+}
+
+func (c *conn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// RemoteAddr returns the source address from the PROXY header
+func (c *conn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+func log() *logrus.Entry {
+	return logging.GetDefaultLogger().ComponentLogger("ProxyProtocol")
+}
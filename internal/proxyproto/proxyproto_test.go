@@ -0,0 +1,163 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/internal/ipfilter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func v2Header(cmd, fam byte, addrs []byte) []byte {
+	b := bytes.NewBuffer(nil)
+	b.Write(v2Signature)
+	b.WriteByte(0x20 | cmd)
+	b.WriteByte(fam)
+	_ = binary.Write(b, binary.BigEndian, uint16(len(addrs)))
+	b.Write(addrs)
+	return b.Bytes()
+}
+
+func Test_ReadHeader(t *testing.T) {
+	ipv4 := []byte{192, 0, 2, 1, 192, 0, 2, 2, 0xdc, 0x04, 0x01, 0xbb}
+	ipv6 := append(append(net.ParseIP("2001:db8::1").To16(), net.ParseIP("2001:db8::2").To16()...), 0xdc, 0x04, 0x01, 0xbb)
+	tests := []struct {
+		name    string
+		input   []byte
+		addr    string
+		wantErr string
+	}{
+		{"v1 TCP4", []byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n"), "192.0.2.1:56324", ""},
+		{"v1 TCP6", []byte("PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n"), "[2001:db8::1]:56324", ""},
+		{"v1 UNKNOWN", []byte("PROXY UNKNOWN\r\n"), "", ""},
+		{"v1 mismatching family", []byte("PROXY TCP4 2001:db8::1 2001:db8::2 56324 443\r\n"), "", "does not match"},
+		{"v1 malformed", []byte("PROXY TCP4 192.0.2.1\r\n"), "", "malformed"},
+		{"v1 too long", []byte("PROXY " + strings.Repeat("x", 200)), "", "exceeds"},
+		{"v2 TCP4", v2Header(v2CmdProxy, v2FamTCP4, ipv4), "192.0.2.1:56324", ""},
+		{"v2 TCP6", v2Header(v2CmdProxy, v2FamTCP6, ipv6), "[2001:db8::1]:56324", ""},
+		{"v2 TCP4 with TLVs", v2Header(v2CmdProxy, v2FamTCP4, append(ipv4, 0x04, 0x00, 0x01, 0x00)), "192.0.2.1:56324", ""},
+		{"v2 LOCAL", v2Header(v2CmdLocal, 0, nil), "", ""},
+		{"v2 truncated", v2Header(v2CmdProxy, v2FamTCP6, ipv4), "", "too short"},
+		{"No header", []byte("\x16\x03\x01\x02\x00\x01\x00\x01\xfc\x03\x03"), "", "no PROXY protocol header"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReader(io.MultiReader(bytes.NewReader(tt.input), strings.NewReader("payload")))
+			addr, err := ReadHeader(r)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			if tt.addr == "" {
+				assert.Nil(t, addr)
+			} else {
+				require.NotNil(t, addr)
+				assert.Equal(t, tt.addr, addr.String())
+			}
+			// Data following the header is left in the reader
+			rest, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, "payload", string(rest))
+		})
+	}
+}
+
+func Test_Listener(t *testing.T) {
+	listen := func(t *testing.T, trusted *ipfilter.Rules) *Listener {
+		t.Helper()
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		pl := NewListener(l, trusted, time.Second)
+		t.Cleanup(func() { _ = pl.Close() })
+		return pl
+	}
+	dial := func(t *testing.T, l net.Listener, data string) net.Conn {
+		t.Helper()
+		c, err := net.Dial("tcp", l.Addr().String())
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = c.Close() })
+		_, err = c.Write([]byte(data))
+		require.NoError(t, err)
+		return c
+	}
+	accept := func(t *testing.T, l net.Listener) net.Conn {
+		t.Helper()
+		type result struct {
+			c   net.Conn
+			err error
+		}
+		ch := make(chan result, 1)
+		go func() {
+			c, err := l.Accept()
+			ch <- result{c, err}
+		}()
+		select {
+		case r := <-ch:
+			require.NoError(t, r.err)
+			t.Cleanup(func() { _ = r.c.Close() })
+			return r.c
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for connection")
+			return nil
+		}
+	}
+
+	t.Run("Source address is taken from the header", func(t *testing.T) {
+		l := listen(t, nil)
+		dial(t, l, "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\nhello")
+		c := accept(t, l)
+		assert.Equal(t, "192.0.2.1:56324", c.RemoteAddr().String())
+		buf := make([]byte, 5)
+		_, err := io.ReadFull(c, buf)
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(buf))
+	})
+
+	t.Run("Connection without header is rejected", func(t *testing.T) {
+		l := listen(t, nil)
+		dial(t, l, "hello, this is not a PROXY header\r\n")
+		// A stalled client does not block other connections
+		dial(t, l, "PROX")
+		dial(t, l, "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n")
+		c := accept(t, l)
+		assert.Equal(t, "192.0.2.1:56324", c.RemoteAddr().String())
+	})
+
+	t.Run("Untrusted connection is passed on unchanged", func(t *testing.T) {
+		trusted, err := ipfilter.ParseRules([]string{"10.0.0.0/8"}, nil)
+		require.NoError(t, err)
+		l := listen(t, trusted)
+		client := dial(t, l, "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n")
+		c := accept(t, l)
+		assert.Equal(t, client.LocalAddr().String(), c.RemoteAddr().String())
+	})
+
+	t.Run("Accept fails after Close", func(t *testing.T) {
+		l := listen(t, nil)
+		require.NoError(t, l.Close())
+		_, err := l.Accept()
+		assert.ErrorIs(t, err, net.ErrClosed)
+	})
+}
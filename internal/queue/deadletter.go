@@ -0,0 +1,101 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+)
+
+// ErrQueueNotFound is returned when a queue pair does not exist.
+var ErrQueueNotFound = errors.New("queue does not exist")
+
+// maxDeadLetters is the number of dead letters kept for each queue pair. The
+// oldest dead letter is dropped when another one is added to a full list.
+const maxDeadLetters = 100
+
+// QueuedEvent is an event held by a queue pair.
+type QueuedEvent struct {
+	Event *event.Event
+	// Queued is the time the event was added to the queue, or recorded as a
+	// dead letter
+	Queued time.Time
+	// Reason is why a dead letter could not be sent. It is empty for events
+	// in the send and receive queues.
+	Reason string
+}
+
+// deadLetters holds the events that could not be sent to an agent. They are
+// kept in memory only, until they are requeued or the queue pair is deleted.
+type deadLetters struct {
+	lock   sync.Mutex
+	events []QueuedEvent
+}
+
+// DeadLetter records ev as an event taken from the send queue of the queue
+// pair name that could not be sent for the given reason. Dead letters can be
+// inspected with DeadLetters, and sent again with RequeueDeadLetters.
+func (q *SendRecvQueues) DeadLetter(name string, ev *event.Event, reason string) {
+	qp, err := q.pair(name)
+	if err != nil {
+		return
+	}
+	qp.dead.lock.Lock()
+	defer qp.dead.lock.Unlock()
+	if len(qp.dead.events) >= maxDeadLetters {
+		qp.dead.events = slices.Delete(qp.dead.events, 0, len(qp.dead.events)-maxDeadLetters+1)
+	}
+	qp.dead.events = append(qp.dead.events, QueuedEvent{Event: ev, Queued: time.Now(), Reason: reason})
+}
+
+// DeadLetters returns the dead letters of the queue pair name, oldest first.
+func (q *SendRecvQueues) DeadLetters(name string) ([]QueuedEvent, error) {
+	qp, err := q.pair(name)
+	if err != nil {
+		return nil, err
+	}
+	qp.dead.lock.Lock()
+	defer qp.dead.lock.Unlock()
+	return slices.Clone(qp.dead.events), nil
+}
+
+// RequeueDeadLetters adds the dead letters of the queue pair name with the
+// given event IDs back to its send queue, or all of them if no IDs are given.
+// Returns the number of requeued events.
+func (q *SendRecvQueues) RequeueDeadLetters(name string, ids ...string) (int, error) {
+	qp, err := q.pair(name)
+	if err != nil {
+		return 0, err
+	}
+	qp.dead.lock.Lock()
+	var requeue []*event.Event
+	qp.dead.events = slices.DeleteFunc(qp.dead.events, func(dl QueuedEvent) bool {
+		if len(ids) > 0 && !slices.Contains(ids, dl.Event.ID()) {
+			return false
+		}
+		requeue = append(requeue, dl.Event)
+		return true
+	})
+	qp.dead.lock.Unlock()
+
+	for _, ev := range requeue {
+		qp.sendq.Add(ev)
+	}
+	return len(requeue), nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_DeadLetters(t *testing.T) {
+	newEvent := func(id string) *event.Event {
+		ev := event.New()
+		ev.SetID(id)
+		ev.SetSource("test")
+		ev.SetType("test")
+		return &ev
+	}
+	ids := func(events []QueuedEvent) []string {
+		var ids []string
+		for _, ev := range events {
+			ids = append(ids, ev.Event.ID())
+		}
+		return ids
+	}
+
+	t.Run("Dead letters are recorded with their reason", func(t *testing.T) {
+		q := NewSendRecvQueues()
+		require.NoError(t, q.Create("agent1"))
+		q.DeadLetter("agent1", newEvent("1"), "denied by policy")
+		q.DeadLetter("unknown", newEvent("2"), "denied by policy")
+		dead, err := q.DeadLetters("agent1")
+		require.NoError(t, err)
+		require.Len(t, dead, 1)
+		assert.Equal(t, "1", dead[0].Event.ID())
+		assert.Equal(t, "denied by policy", dead[0].Reason)
+		assert.False(t, dead[0].Queued.IsZero())
+	})
+
+	t.Run("Only the most recent dead letters are kept", func(t *testing.T) {
+		q := NewSendRecvQueues()
+		require.NoError(t, q.Create("agent1"))
+		for i := 0; i < maxDeadLetters+5; i++ {
+			q.DeadLetter("agent1", newEvent(strconv.Itoa(i)), "reason")
+		}
+		dead, err := q.DeadLetters("agent1")
+		require.NoError(t, err)
+		require.Len(t, dead, maxDeadLetters)
+		assert.Equal(t, "5", dead[0].Event.ID())
+	})
+
+	t.Run("Dead letters are requeued by ID", func(t *testing.T) {
+		q := NewSendRecvQueues()
+		require.NoError(t, q.Create("agent1"))
+		q.DeadLetter("agent1", newEvent("1"), "reason")
+		q.DeadLetter("agent1", newEvent("2"), "reason")
+		q.DeadLetter("agent1", newEvent("3"), "reason")
+
+		n, err := q.RequeueDeadLetters("agent1", "2")
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+		dead, _ := q.DeadLetters("agent1")
+		assert.Equal(t, []string{"1", "3"}, ids(dead))
+		require.Equal(t, 1, q.SendQ("agent1").Len())
+
+		n, err = q.RequeueDeadLetters("agent1")
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+		dead, _ = q.DeadLetters("agent1")
+		assert.Empty(t, dead)
+		send, _, err := q.Events("agent1")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"2", "1", "3"}, ids(send))
+	})
+
+	t.Run("Unknown queue pairs return an error", func(t *testing.T) {
+		q := NewSendRecvQueues()
+		_, err := q.DeadLetters("agent1")
+		assert.ErrorIs(t, err, ErrQueueNotFound)
+		_, err = q.RequeueDeadLetters("agent1")
+		assert.ErrorIs(t, err, ErrQueueNotFound)
+	})
+}
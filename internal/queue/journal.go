@@ -0,0 +1,277 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	agentevent "github.com/argoproj-labs/argocd-agent/internal/event"
+	"github.com/cloudevents/sdk-go/v2/event"
+)
+
+// journal records the events handed over for delivery to an agent until the
+// agent acknowledges them. Each recorded event gets a sequence number, and
+// the cursor is the sequence number up to which all events have been
+// acknowledged. If the journal is persistent, the events after the cursor
+// are replayed after a restart, so that the agent receives exactly the
+// events it missed.
+type journal struct {
+	lock sync.Mutex
+	// dir is the directory the journal is persisted in. It is empty if the
+	// journal is not persistent.
+	dir     string
+	maxSize int
+	// next is the sequence number of the next recorded event
+	next uint64
+	// cursor is the sequence number of the last event that was acknowledged
+	// together with all events before it
+	cursor uint64
+	// entries are the recorded events after the cursor, in order
+	entries []*journalEntry
+	// complete is false once unacknowledged events were dropped from the
+	// journal because it was full
+	complete bool
+	// resumed is true if the cursor was restored from a previous run, and
+	// no events were dropped in that run
+	resumed bool
+}
+
+type journalEntry struct {
+	seq   uint64
+	event *event.Event
+	acked bool
+}
+
+// journalState is the persisted state of a journal
+type journalState struct {
+	Cursor   uint64 `json:"cursor"`
+	Complete bool   `json:"complete"`
+}
+
+const journalStateFile = "cursor.json"
+
+func newJournal(maxSize int) *journal {
+	return &journal{
+		maxSize:  maxSize,
+		next:     1,
+		complete: true,
+	}
+}
+
+// restore makes the journal persistent in dir, and returns the events that
+// were recorded in dir previously but have not been acknowledged, in the
+// order they were recorded. The returned events are removed from the
+// journal, since they are recorded again when they are delivered anew.
+func (j *journal) restore(dir string) ([]*event.Event, error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("could not create journal directory: %w", err)
+	}
+	j.dir = dir
+
+	var state journalState
+	data, err := os.ReadFile(filepath.Join(dir, journalStateFile))
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &state); err != nil {
+			log().WithError(err).WithField("path", dir).Warn("Discarding unreadable delivery cursor")
+		} else {
+			j.resumed = state.Complete
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, fmt.Errorf("could not read delivery cursor: %w", err)
+	}
+	j.cursor = state.Cursor
+	j.next = state.Cursor + 1
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read journal directory: %w", err)
+	}
+	seqs := make([]uint64, 0, len(entries))
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, storedEventSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, storedEventSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(a, b int) bool { return seqs[a] < seqs[b] })
+
+	var events []*event.Event
+	for _, seq := range seqs {
+		path := j.path(seq)
+		if seq >= j.next {
+			j.next = seq + 1
+		}
+		if seq > j.cursor {
+			ev := &event.Event{}
+			data, err := os.ReadFile(path)
+			if err == nil {
+				err = json.Unmarshal(data, ev)
+			}
+			if err == nil {
+				events = append(events, ev)
+			} else {
+				log().WithError(err).WithField("path", path).Warn("Discarding unreadable journaled event")
+			}
+		}
+		_ = os.Remove(path)
+	}
+
+	// The cursor only moves forward, so that events recorded from now on are
+	// never mistaken for acknowledged ones.
+	j.cursor = j.next - 1
+	j.complete = true
+	if err := j.save(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// record adds ev to the journal. Fire-and-forget events are not recorded,
+// since they are never acknowledged.
+func (j *journal) record(ev *event.Event) {
+	if agentevent.FireAndForget(ev) {
+		return
+	}
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	entry := &journalEntry{seq: j.next, event: ev}
+	j.next++
+	j.entries = append(j.entries, entry)
+	if j.dir != "" {
+		if data, err := json.Marshal(ev); err != nil {
+			log().WithError(err).Error("Could not marshal journaled event")
+		} else if err := writeFileAtomic(j.path(entry.seq), data); err != nil {
+			log().WithError(err).Error("Could not persist journaled event")
+		}
+	}
+	if len(j.entries) > j.maxSize {
+		// The agent does not acknowledge events anymore. Drop the oldest
+		// event, which means the journal can no longer replay everything the
+		// agent missed.
+		if !j.entries[0].acked {
+			j.complete = false
+		}
+		j.entries[0].acked = true
+	}
+	j.advance()
+}
+
+// ack marks the recorded event acknowledged by the agent in ack as delivered,
+// along with all events for the same resource recorded before it, which the
+// agent no longer needs.
+func (j *journal) ack(ack *event.Event) {
+	resID := agentevent.ResourceID(ack)
+	eventID := agentevent.EventID(ack)
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	found := false
+	for i := len(j.entries) - 1; i >= 0; i-- {
+		entry := j.entries[i]
+		if agentevent.ResourceID(entry.event) != resID {
+			continue
+		}
+		if !found && agentevent.EventID(entry.event) != eventID {
+			continue
+		}
+		found = true
+		entry.acked = true
+	}
+	if found {
+		j.advance()
+	}
+}
+
+// advance moves the cursor past all acknowledged events at the start of the
+// journal. The caller must hold j.lock.
+func (j *journal) advance() {
+	n := 0
+	for n < len(j.entries) && j.entries[n].acked {
+		j.cursor = j.entries[n].seq
+		if j.dir != "" {
+			if err := os.Remove(j.path(j.entries[n].seq)); err != nil && !os.IsNotExist(err) {
+				log().WithError(err).Warn("Could not remove journaled event")
+			}
+		}
+		n++
+	}
+	if n == 0 {
+		return
+	}
+	j.entries = j.entries[n:]
+	if err := j.save(); err != nil {
+		log().WithError(err).Error("Could not persist delivery cursor")
+	}
+}
+
+// save persists the cursor of the journal. The caller must hold j.lock.
+func (j *journal) save() error {
+	if j.dir == "" {
+		return nil
+	}
+	data, err := json.Marshal(journalState{Cursor: j.cursor, Complete: j.complete})
+	if err != nil {
+		return fmt.Errorf("could not marshal delivery cursor: %w", err)
+	}
+	return writeFileAtomic(filepath.Join(j.dir, journalStateFile), data)
+}
+
+func (j *journal) path(seq uint64) string {
+	return filepath.Join(j.dir, fmt.Sprintf("%020d%s", seq, storedEventSuffix))
+}
+
+// lost records that events meant for the agent were dropped before they were
+// delivered, so that they can't be replayed.
+func (j *journal) lost() {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	if !j.complete && !j.resumed {
+		return
+	}
+	j.complete = false
+	j.resumed = false
+	if err := j.save(); err != nil {
+		log().WithError(err).Error("Could not persist delivery cursor")
+	}
+}
+
+// position returns the cursor of the journal, and whether the cursor was
+// restored from a previous run in which no unacknowledged events were
+// dropped.
+func (j *journal) position() (uint64, bool) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return j.cursor, j.resumed
+}
+
+// eventKey identifies an event by its resource and event ID
+func eventKey(ev *event.Event) string {
+	return agentevent.ResourceID(ev) + "/" + agentevent.EventID(ev)
+}
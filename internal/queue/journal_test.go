@@ -0,0 +1,162 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/argoproj-labs/argocd-agent/internal/config"
+	agentevent "github.com/argoproj-labs/argocd-agent/internal/event"
+	"github.com/argoproj-labs/argocd-agent/internal/event/targets"
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Journal(t *testing.T) {
+	newEvent := func(resourceID, eventID string) *event.Event {
+		ev := event.New()
+		ev.SetID(resourceID + "-" + eventID)
+		ev.SetType(agentevent.SpecUpdate.String())
+		ev.SetSource("test")
+		ev.SetExtension("resourceid", resourceID)
+		ev.SetExtension("eventid", eventID)
+		return &ev
+	}
+	cursor := func(t *testing.T, q *SendRecvQueues) (uint64, bool) {
+		t.Helper()
+		c, resumed, err := q.Cursor("agent1")
+		require.NoError(t, err)
+		return c, resumed
+	}
+
+	t.Run("Acknowledgements move the cursor forward", func(t *testing.T) {
+		q := NewSendRecvQueues()
+		require.NoError(t, q.Create("agent1"))
+		q.Delivered("agent1", newEvent("a", "1"))
+		q.Delivered("agent1", newEvent("b", "1"))
+		q.Delivered("agent1", newEvent("c", "1"))
+
+		// Out of order acknowledgements do not move the cursor past
+		// unacknowledged events
+		q.Acknowledged("agent1", newEvent("b", "1"))
+		c, _ := cursor(t, q)
+		assert.Equal(t, uint64(0), c)
+		q.Acknowledged("agent1", newEvent("a", "1"))
+		c, _ = cursor(t, q)
+		assert.Equal(t, uint64(2), c)
+		q.Acknowledged("agent1", newEvent("c", "2"))
+		c, _ = cursor(t, q)
+		assert.Equal(t, uint64(2), c)
+		q.Acknowledged("agent1", newEvent("c", "1"))
+		c, resumed := cursor(t, q)
+		assert.Equal(t, uint64(3), c)
+		assert.False(t, resumed)
+	})
+
+	t.Run("Acknowledging an event settles earlier events of the resource", func(t *testing.T) {
+		q := NewSendRecvQueues()
+		require.NoError(t, q.Create("agent1"))
+		q.Delivered("agent1", newEvent("a", "1"))
+		q.Delivered("agent1", newEvent("a", "2"))
+		q.Acknowledged("agent1", newEvent("a", "2"))
+		c, _ := cursor(t, q)
+		assert.Equal(t, uint64(2), c)
+	})
+
+	t.Run("Fire-and-forget events are not journaled", func(t *testing.T) {
+		q := NewSendRecvQueues()
+		require.NoError(t, q.Create("agent1"))
+		ev := newEvent("a", "1")
+		ev.SetDataSchema(targets.Heartbeat.String())
+		q.Delivered("agent1", ev)
+		q.Delivered("agent1", newEvent("b", "1"))
+		q.Acknowledged("agent1", newEvent("b", "1"))
+		c, _ := cursor(t, q)
+		assert.Equal(t, uint64(1), c)
+	})
+
+	t.Run("Unacknowledged events are replayed after a restart", func(t *testing.T) {
+		dir := t.TempDir()
+		q := NewSendRecvQueues(WithStorageDir(dir))
+		require.NoError(t, q.Create("agent1"))
+		q.Delivered("agent1", newEvent("a", "1"))
+		q.Delivered("agent1", newEvent("b", "1"))
+		q.Delivered("agent1", newEvent("c", "1"))
+		q.Acknowledged("agent1", newEvent("a", "1"))
+		// The event for c was checkpointed on shutdown, and must not be
+		// queued twice
+		q.Close()
+		q.SendQ("agent1").Add(newEvent("c", "1"))
+
+		q = NewSendRecvQueues(WithStorageDir(dir))
+		require.NoError(t, q.Create("agent1"))
+		_, resumed := cursor(t, q)
+		assert.True(t, resumed)
+		sendq := q.SendQ("agent1")
+		require.Equal(t, 2, sendq.Len())
+		ev, _ := sendq.Get()
+		assert.Equal(t, "c-1", ev.ID())
+		ev, _ = sendq.Get()
+		assert.Equal(t, "b-1", ev.ID())
+
+		// Replayed events are persisted in the send queue, and not replayed
+		// from the journal again
+		q = NewSendRecvQueues(WithStorageDir(dir))
+		require.NoError(t, q.Create("agent1"))
+		assert.Equal(t, 2, q.SendQ("agent1").Len())
+	})
+
+	t.Run("Cursor is not resumed when unacknowledged events were dropped", func(t *testing.T) {
+		t.Setenv(config.EnvSendQueueSize, "2")
+		dir := t.TempDir()
+		q := NewSendRecvQueues(WithStorageDir(dir))
+		require.NoError(t, q.Create("agent1"))
+		q.Delivered("agent1", newEvent("a", "1"))
+		q.Delivered("agent1", newEvent("b", "1"))
+		q.Delivered("agent1", newEvent("c", "1"))
+		c, _ := cursor(t, q)
+		assert.Equal(t, uint64(1), c)
+
+		q = NewSendRecvQueues(WithStorageDir(dir))
+		require.NoError(t, q.Create("agent1"))
+		_, resumed := cursor(t, q)
+		assert.False(t, resumed)
+		assert.Equal(t, 2, q.SendQ("agent1").Len())
+	})
+
+	t.Run("Acknowledged events are removed from storage", func(t *testing.T) {
+		dir := t.TempDir()
+		q := NewSendRecvQueues(WithStorageDir(dir))
+		require.NoError(t, q.Create("agent1"))
+		q.Delivered("agent1", newEvent("a", "1"))
+		entries, err := os.ReadDir(filepath.Join(dir, "agent1", "journal"))
+		require.NoError(t, err)
+		assert.Len(t, entries, 2)
+		q.Acknowledged("agent1", newEvent("a", "1"))
+		entries, err = os.ReadDir(filepath.Join(dir, "agent1", "journal"))
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+		assert.Equal(t, journalStateFile, entries[0].Name())
+	})
+
+	t.Run("Unknown queue pairs have no cursor", func(t *testing.T) {
+		q := NewSendRecvQueues()
+		_, _, err := q.Cursor("agent1")
+		assert.ErrorIs(t, err, ErrQueueNotFound)
+	})
+}
@@ -0,0 +1,156 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// OverflowPolicy determines what happens when an event is added to a queue
+// that is full.
+type OverflowPolicy string
+
+const (
+	// OverflowBlock blocks the caller until there is space in the queue.
+	OverflowBlock OverflowPolicy = "block"
+	// OverflowDropOldest drops the oldest queued event to make space for the
+	// new one.
+	OverflowDropOldest OverflowPolicy = "drop-oldest"
+	// OverflowDropNewest discards the new event.
+	OverflowDropNewest OverflowPolicy = "drop-newest"
+	// OverflowCoalesce replaces a queued event of the same type for the same
+	// resource with the new event. If there is none, the oldest queued event
+	// is dropped.
+	OverflowCoalesce OverflowPolicy = "coalesce"
+	// OverflowDisconnect discards the new event and disconnects the agent,
+	// which is resynced when it reconnects.
+	OverflowDisconnect OverflowPolicy = "disconnect"
+	// OverflowAlert queues the new event regardless of the limit, and only
+	// reports that the queue exceeds its limit.
+	OverflowAlert OverflowPolicy = "alert"
+)
+
+// DefaultOverflowPolicy is the overflow policy of queues without an explicit
+// policy.
+const DefaultOverflowPolicy = OverflowDropOldest
+
+// DefaultLimitKey is the key used in ParseLimits to set the limit for all
+// queue pairs without a limit of their own.
+const DefaultLimitKey = "default"
+
+// ParseOverflowPolicy returns the overflow policy named s.
+func ParseOverflowPolicy(s string) (OverflowPolicy, error) {
+	switch p := OverflowPolicy(s); p {
+	case OverflowBlock, OverflowDropOldest, OverflowDropNewest, OverflowCoalesce, OverflowDisconnect, OverflowAlert:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown overflow policy %q, must be one of: %s, %s, %s, %s, %s, %s",
+			s, OverflowBlock, OverflowDropOldest, OverflowDropNewest, OverflowCoalesce, OverflowDisconnect, OverflowAlert)
+	}
+}
+
+// Limit configures the capacity of a send queue and what happens when it
+// overflows.
+type Limit struct {
+	// Size is the maximum number of events in the queue. A size of 0 uses the
+	// size configured in the environment, or the default size.
+	Size int
+	// Bytes is the maximum total size of the data of the events in the
+	// queue. A value of 0 means the size of the data is not limited.
+	Bytes int64
+	// Policy is the overflow policy of the queue. If empty, the default
+	// overflow policy is used.
+	Policy OverflowPolicy
+}
+
+// Limits holds the limits of the send queues of each queue pair.
+type Limits struct {
+	// Default applies to all queue pairs not in ByName
+	Default Limit
+	// ByName holds the limits of specific queue pairs
+	ByName map[string]Limit
+}
+
+// ParseLimits parses limits of the form <name>=<size>[/<bytes>][:<policy>],
+// where name is the name of a queue pair or "default", size is the maximum
+// number of events in the queue, bytes is the maximum total size of their data
+// as a quantity such as 64Mi, and policy is the queue's overflow policy. Any of
+// size, bytes and policy may be empty, in which case the respective default is
+// used.
+func ParseLimits(specs []string) (*Limits, error) {
+	l := &Limits{ByName: make(map[string]Limit)}
+	for _, spec := range specs {
+		name, value, ok := strings.Cut(spec, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid queue limit %q: must be of the form <agent>=<size>[/<bytes>][:<policy>]", spec)
+		}
+		size, policy, _ := strings.Cut(value, ":")
+		size, bytes, _ := strings.Cut(size, "/")
+		limit := Limit{}
+		if bytes != "" {
+			q, err := resource.ParseQuantity(bytes)
+			if err != nil || q.Value() <= 0 {
+				return nil, fmt.Errorf("invalid queue limit %q: bytes must be a positive quantity", spec)
+			}
+			limit.Bytes = q.Value()
+		}
+		if size != "" {
+			n, err := strconv.Atoi(size)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid queue limit %q: size must be a positive number", spec)
+			}
+			limit.Size = n
+		}
+		if policy != "" {
+			p, err := ParseOverflowPolicy(policy)
+			if err != nil {
+				return nil, fmt.Errorf("invalid queue limit %q: %w", spec, err)
+			}
+			limit.Policy = p
+		}
+		if name == DefaultLimitKey {
+			l.Default = limit
+			continue
+		}
+		l.ByName[name] = limit
+	}
+	return l, nil
+}
+
+// For returns the limit of the queue pair with the given name. Fields not set
+// for the queue pair specifically are taken from the default limit.
+func (l *Limits) For(name string) Limit {
+	if l == nil {
+		return Limit{}
+	}
+	limit, ok := l.ByName[name]
+	if !ok {
+		return l.Default
+	}
+	if limit.Size == 0 {
+		limit.Size = l.Default.Size
+	}
+	if limit.Bytes == 0 {
+		limit.Bytes = l.Default.Bytes
+	}
+	if limit.Policy == "" {
+		limit.Policy = l.Default.Policy
+	}
+	return limit
+}
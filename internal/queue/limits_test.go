@@ -0,0 +1,49 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParseLimits(t *testing.T) {
+	t.Run("Valid limits", func(t *testing.T) {
+		l, err := ParseLimits([]string{"default=500", "agent-a=100:coalesce", "agent-b=:block"})
+		require.NoError(t, err)
+		assert.Equal(t, Limit{Size: 500}, l.For("agent-c"))
+		assert.Equal(t, Limit{Size: 100, Policy: OverflowCoalesce}, l.For("agent-a"))
+		assert.Equal(t, Limit{Size: 500, Policy: OverflowBlock}, l.For("agent-b"))
+	})
+	t.Run("Byte limits", func(t *testing.T) {
+		l, err := ParseLimits([]string{"default=/64Mi", "agent-a=100/1Ki:disconnect", "agent-b=:alert"})
+		require.NoError(t, err)
+		assert.Equal(t, Limit{Bytes: 64 * 1024 * 1024}, l.For("agent-c"))
+		assert.Equal(t, Limit{Size: 100, Bytes: 1024, Policy: OverflowDisconnect}, l.For("agent-a"))
+		assert.Equal(t, Limit{Bytes: 64 * 1024 * 1024, Policy: OverflowAlert}, l.For("agent-b"))
+	})
+	t.Run("No limits", func(t *testing.T) {
+		var l *Limits
+		assert.Equal(t, Limit{}, l.For("agent-a"))
+	})
+	t.Run("Invalid limits", func(t *testing.T) {
+		for _, spec := range []string{"agent-a", "=100", "agent-a=-1", "agent-a=ten", "agent-a=100:discard", "agent-a=100/-1", "agent-a=100/lots"} {
+			_, err := ParseLimits([]string{spec})
+			assert.Error(t, err, spec)
+		}
+	})
+}
@@ -0,0 +1,82 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue
+
+// pause stops GetWithContext from taking items from the queue until resume is
+// called. Items can still be added to the paused queue, and are coalesced,
+// evicted and expired as usual. Returns false if the queue was paused
+// already.
+func (bq *boundedQueue) pause() bool {
+	bq.lock.Lock()
+	defer bq.lock.Unlock()
+	if bq.resumed != nil {
+		return false
+	}
+	bq.resumed = make(chan struct{})
+	return true
+}
+
+// resume lets GetWithContext take items from the queue again. Returns false
+// if the queue was not paused.
+func (bq *boundedQueue) resume() bool {
+	bq.lock.Lock()
+	defer bq.lock.Unlock()
+	if bq.resumed == nil {
+		return false
+	}
+	close(bq.resumed)
+	bq.resumed = nil
+	return true
+}
+
+// pausedUntil returns a channel that is closed when the queue is resumed, or
+// nil if the queue is not paused.
+func (bq *boundedQueue) pausedUntil() <-chan struct{} {
+	bq.lock.Lock()
+	defer bq.lock.Unlock()
+	return bq.resumed
+}
+
+// Pause holds back the events in the send queue of the queue pair name from
+// delivery until Resume is called, e.g. while the agent's cluster is under
+// maintenance. Events keep being added to the paused queue, where updates of
+// the same resource are coalesced if coalescing is enabled. Returns false if
+// the queue was paused already.
+func (q *SendRecvQueues) Pause(name string) (bool, error) {
+	qp, err := q.pair(name)
+	if err != nil {
+		return false, err
+	}
+	return qp.sendq.pause(), nil
+}
+
+// Resume releases the events held back by Pause for delivery. Returns false if
+// the send queue of the queue pair name was not paused.
+func (q *SendRecvQueues) Resume(name string) (bool, error) {
+	qp, err := q.pair(name)
+	if err != nil {
+		return false, err
+	}
+	return qp.sendq.resume(), nil
+}
+
+// Paused returns whether the send queue of the queue pair name is paused.
+func (q *SendRecvQueues) Paused(name string) (bool, error) {
+	qp, err := q.pair(name)
+	if err != nil {
+		return false, err
+	}
+	return qp.sendq.pausedUntil() != nil, nil
+}
@@ -0,0 +1,190 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue
+
+import (
+	"sync"
+
+	"github.com/argoproj-labs/argocd-agent/internal/event"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+// priorityQueue is the storage of a workqueue that pops queued events in
+// the order of their priority, and in the order they were queued within the
+// same priority.
+//
+// An event never overtakes an event for the same resource that was queued
+// before it: such an event is queued at the lowest priority of the events
+// already queued for the resource. Otherwise, a deletion could for example
+// be sent before the creation of the same resource.
+type priorityQueue struct {
+	mu sync.Mutex
+	// levels holds the queued events of each priority
+	levels [event.NumPriorities][]*cloudevents.Event
+	// resources counts the queued events of each resource by priority
+	resources map[string]*[event.NumPriorities]int
+	// evictNext makes the next Pop return the oldest event of the lowest
+	// priority instead, which is then recorded in evicted
+	evictNext bool
+	evicted   map[*cloudevents.Event]struct{}
+	// purged holds the queued events that were purged. They are no longer
+	// counted, and are recorded in evicted once they are popped.
+	purged map[*cloudevents.Event]struct{}
+}
+
+func newPriorityQueue() *priorityQueue {
+	return &priorityQueue{
+		resources: make(map[string]*[event.NumPriorities]int),
+		evicted:   make(map[*cloudevents.Event]struct{}),
+		purged:    make(map[*cloudevents.Event]struct{}),
+	}
+}
+
+// Touch is called when a queued event is added again. The event keeps its
+// position.
+func (q *priorityQueue) Touch(ev *cloudevents.Event) {}
+
+// Push queues ev.
+func (q *priorityQueue) Push(ev *cloudevents.Event) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	level := int(event.PriorityOf(ev))
+	if id := event.ResourceID(ev); id != "" {
+		counts, ok := q.resources[id]
+		if !ok {
+			counts = &[event.NumPriorities]int{}
+			q.resources[id] = counts
+		}
+		for l := 0; l < level; l++ {
+			if counts[l] > 0 {
+				level = l
+				break
+			}
+		}
+		counts[level]++
+	}
+	q.levels[level] = append(q.levels[level], ev)
+}
+
+// Len returns the number of queued events.
+func (q *priorityQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := -len(q.purged)
+	for _, l := range q.levels {
+		n += len(l)
+	}
+	return n
+}
+
+// Pop removes and returns the oldest event of the highest priority. If an
+// eviction was requested, it returns the oldest event of the lowest priority
+// instead.
+func (q *priorityQueue) Pop() *cloudevents.Event {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	evict := q.evictNext
+	q.evictNext = false
+	for i := range q.levels {
+		level := len(q.levels) - 1 - i
+		if evict {
+			level = i
+		}
+		if len(q.levels[level]) == 0 {
+			continue
+		}
+		ev := q.levels[level][0]
+		q.levels[level][0] = nil
+		q.levels[level] = q.levels[level][1:]
+		if _, ok := q.purged[ev]; ok {
+			delete(q.purged, ev)
+			q.evicted[ev] = struct{}{}
+			return ev
+		}
+		q.uncount(ev, level)
+		if evict {
+			q.evicted[ev] = struct{}{}
+		}
+		return ev
+	}
+	return nil
+}
+
+// uncount removes ev, which was queued at level, from the counts of its
+// resource.
+func (q *priorityQueue) uncount(ev *cloudevents.Event, level int) {
+	id := event.ResourceID(ev)
+	if id == "" {
+		return
+	}
+	if counts, ok := q.resources[id]; ok {
+		counts[level]--
+		if *counts == [event.NumPriorities]int{} {
+			delete(q.resources, id)
+		}
+	}
+}
+
+// items returns the queued events in the order they will be popped.
+func (q *priorityQueue) items() []*cloudevents.Event {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var items []*cloudevents.Event
+	for i := range q.levels {
+		for _, ev := range q.levels[len(q.levels)-1-i] {
+			if _, ok := q.purged[ev]; !ok {
+				items = append(items, ev)
+			}
+		}
+	}
+	return items
+}
+
+// purge marks all queued events as purged and returns them. Purged events
+// stay in the queue until they are popped, which is when they are recorded
+// as evicted, but are no longer counted.
+func (q *priorityQueue) purge() []*cloudevents.Event {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var items []*cloudevents.Event
+	for level, evs := range q.levels {
+		for _, ev := range evs {
+			if _, ok := q.purged[ev]; ok {
+				continue
+			}
+			q.purged[ev] = struct{}{}
+			q.uncount(ev, level)
+			items = append(items, ev)
+		}
+	}
+	return items
+}
+
+// requestEviction makes the next Pop return the event to evict from the full
+// queue.
+func (q *priorityQueue) requestEviction() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.evictNext = true
+}
+
+// wasEvicted returns whether ev was popped for eviction, and forgets about it.
+func (q *priorityQueue) wasEvicted(ev *cloudevents.Event) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	_, ok := q.evicted[ev]
+	delete(q.evicted, ev)
+	return ok
+}
@@ -0,0 +1,124 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue
+
+import (
+	"testing"
+
+	"github.com/argoproj-labs/argocd-agent/internal/config"
+	"github.com/argoproj-labs/argocd-agent/internal/event"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newPriorityEvent(id, resourceID string, p event.Priority) *cloudevents.Event {
+	ev := cloudevents.NewEvent()
+	ev.SetID(id)
+	ev.SetType("test")
+	ev.SetSource("test")
+	if resourceID != "" {
+		ev.SetExtension("resourceid", resourceID)
+	}
+	event.SetPriority(&ev, p)
+	return &ev
+}
+
+func popAll(q *priorityQueue) []string {
+	var ids []string
+	for q.Len() > 0 {
+		ids = append(ids, q.Pop().ID())
+	}
+	return ids
+}
+
+func Test_priorityQueue(t *testing.T) {
+	t.Run("Events are popped by priority", func(t *testing.T) {
+		q := newPriorityQueue()
+		q.Push(newPriorityEvent("status-1", "app-a", event.PriorityLow))
+		q.Push(newPriorityEvent("spec-1", "app-b", event.PriorityNormal))
+		q.Push(newPriorityEvent("status-2", "app-c", event.PriorityLow))
+		q.Push(newPriorityEvent("delete-1", "app-d", event.PriorityHigh))
+		q.Push(newPriorityEvent("spec-2", "app-e", event.PriorityNormal))
+		assert.Equal(t, []string{"delete-1", "spec-1", "spec-2", "status-1", "status-2"}, popAll(q))
+	})
+
+	t.Run("Events do not overtake earlier events for the same resource", func(t *testing.T) {
+		q := newPriorityQueue()
+		q.Push(newPriorityEvent("create-a", "app-a", event.PriorityNormal))
+		q.Push(newPriorityEvent("status-b", "app-b", event.PriorityLow))
+		q.Push(newPriorityEvent("delete-a", "app-a", event.PriorityHigh))
+		q.Push(newPriorityEvent("delete-b", "app-b", event.PriorityHigh))
+		q.Push(newPriorityEvent("delete-c", "app-c", event.PriorityHigh))
+		assert.Equal(t, []string{"delete-c", "create-a", "delete-a", "status-b", "delete-b"}, popAll(q))
+		assert.Empty(t, q.resources)
+	})
+
+	t.Run("Events without priority are of normal priority", func(t *testing.T) {
+		q := newPriorityQueue()
+		ev := cloudevents.NewEvent()
+		ev.SetID("none")
+		q.Push(newPriorityEvent("status", "", event.PriorityLow))
+		q.Push(&ev)
+		q.Push(newPriorityEvent("delete", "", event.PriorityHigh))
+		assert.Equal(t, []string{"delete", "none", "status"}, popAll(q))
+	})
+
+	t.Run("Eviction pops the oldest event of the lowest priority", func(t *testing.T) {
+		q := newPriorityQueue()
+		q.Push(newPriorityEvent("delete-1", "app-a", event.PriorityHigh))
+		q.Push(newPriorityEvent("status-1", "app-b", event.PriorityLow))
+		q.Push(newPriorityEvent("status-2", "app-c", event.PriorityLow))
+		q.requestEviction()
+		ev := q.Pop()
+		require.NotNil(t, ev)
+		assert.Equal(t, "status-1", ev.ID())
+		assert.True(t, q.wasEvicted(ev))
+		assert.False(t, q.wasEvicted(ev))
+		assert.Equal(t, []string{"delete-1", "status-2"}, popAll(q))
+	})
+}
+
+func Test_PriorityQueueing(t *testing.T) {
+	t.Run("Deletions are sent before status updates", func(t *testing.T) {
+		q := NewSendRecvQueues()
+		require.NoError(t, q.Create("agent1"))
+		sendq := q.SendQ("agent1")
+		for _, id := range []string{"status-1", "status-2", "status-3"} {
+			sendq.Add(newPriorityEvent(id, id, event.PriorityLow))
+		}
+		sendq.Add(newPriorityEvent("delete-1", "app-a", event.PriorityHigh))
+		ev, _ := sendq.Get()
+		assert.Equal(t, "delete-1", ev.ID())
+		sendq.Done(ev)
+	})
+
+	t.Run("A full queue drops status updates first", func(t *testing.T) {
+		t.Setenv(config.EnvSendQueueSize, "2")
+		q := NewSendRecvQueues()
+		require.NoError(t, q.Create("agent1"))
+		sendq := q.SendQ("agent1")
+		sendq.Add(newPriorityEvent("delete-1", "app-a", event.PriorityHigh))
+		sendq.Add(newPriorityEvent("status-1", "app-b", event.PriorityLow))
+		sendq.Add(newPriorityEvent("spec-1", "app-c", event.PriorityNormal))
+		var ids []string
+		for sendq.Len() > 0 {
+			ev, _ := sendq.Get()
+			ids = append(ids, ev.ID())
+			sendq.Done(ev)
+		}
+		assert.Equal(t, []string{"delete-1", "spec-1"}, ids)
+	})
+}
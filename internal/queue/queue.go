@@ -17,11 +17,21 @@ package queue
 import (
 	"context"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/argoproj-labs/argocd-agent/internal/clock"
 	"github.com/argoproj-labs/argocd-agent/internal/config"
 	"github.com/argoproj-labs/argocd-agent/internal/env"
+	agentevent "github.com/argoproj-labs/argocd-agent/internal/event"
+	"github.com/argoproj-labs/argocd-agent/internal/logging"
 	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
 	"k8s.io/client-go/util/workqueue"
 )
 
@@ -46,33 +56,213 @@ const (
 type queuepair struct {
 	recvq *boundedQueue
 	sendq *boundedQueue
+	// dead holds the events that could not be sent
+	dead deadLetters
+	// journal holds the events handed over for delivery until they are
+	// acknowledged
+	journal *journal
 }
 
 type boundedQueue struct {
 	workqueue.TypedRateLimitingInterface[*event.Event]
 	maxSize int
-	notify  chan struct{}
-	name    string
+	// maxBytes is the maximum total size of the data of the queued items, or
+	// 0 if it is not limited
+	maxBytes int64
+	policy   OverflowPolicy
+	notify   chan struct{}
+	name     string
+	// store persists the items of the queue. It is nil if the queue is not
+	// persistent.
+	store *eventStore
+	// onOverflow is called whenever an item is added to the full queue. With
+	// OverflowAlert, it is only called when the queue becomes full.
+	onOverflow func()
+	// onDrop is called whenever a queued item, or an item added to the full
+	// queue, is dropped
+	onDrop func()
+	// overflowing is true while items are added to the full queue with
+	// OverflowAlert
+	overflowing atomic.Bool
+	// onEnqueue is called with the depth of the queue whenever an item is
+	// added to the queue
+	onEnqueue func(depth int)
+	// onDequeue is called with the depth of the queue and the time the item
+	// spent in the queue whenever an item is taken from the queue
+	onDequeue func(depth int, wait time.Duration)
+	// pq stores the queued items in the order of their priority
+	pq *priorityQueue
+
+	// lock guards queued, and is the lock of space
+	lock sync.Mutex
+	// space is signalled whenever an item is taken from the queue
+	space *sync.Cond
+	// queued maps the coalescing key of each event that is queued, but not
+	// yet taken from the queue, to that event. Only used if events may be
+	// coalesced.
+	queued map[string]*event.Event
+	// latest maps the resource ID of each queued event to the most recently
+	// queued event for that resource. Only used if events may be coalesced.
+	latest map[string]*event.Event
+	// coalesceUpdates makes spec and status updates replace a queued update
+	// of the same resource, regardless of the overflow policy.
+	coalesceUpdates bool
+	// enqueued maps each queued event to the time it was added to the queue
+	// and the size of its data
+	enqueued map[*event.Event]queuedItem
+	// bytes is the total size of the data of the queued events
+	bytes int64
+	// closed makes the queue persist new items instead of queueing them
+	closed atomic.Bool
+	// ttls is the time-to-live of the queued items by event type
+	ttls *TTLs
+	// onExpire is called whenever an item is dropped because it expired
+	onExpire func(item *event.Event)
+	// clock is the clock the time items spend in the queue is measured with
+	clock clock.Clock
+	// rateLimiter is the rate limiter of the queue
+	rateLimiter workqueue.TypedRateLimiter[*event.Event]
+	// stream shares the items of the queue with other principal replicas.
+	// It is nil if the queue is local to this replica.
+	stream *redisStream
+	// seq stamps sequence numbers on the items added to the queue. It is nil
+	// if items are not sequenced.
+	seq *sequencer
+	// resumed is closed when the paused queue is resumed. It is nil if the
+	// queue is not paused.
+	resumed chan struct{}
+}
+
+// queuedItem records when an item was added to a queue, when its data was
+// last replaced by a coalesced event, and the size of its data
+type queuedItem struct {
+	since   time.Time
+	updated time.Time
+	size    int64
 }
 
 func newBoundedQueue(maxSize int, name string) *boundedQueue {
 	rateLimiter := workqueue.DefaultTypedControllerRateLimiter[*event.Event]()
-	return &boundedQueue{
+	pq := newPriorityQueue()
+	bq := &boundedQueue{
 		TypedRateLimitingInterface: workqueue.NewTypedRateLimitingQueueWithConfig(rateLimiter,
-			workqueue.TypedRateLimitingQueueConfig[*event.Event]{Name: name}),
-		maxSize: maxSize,
-		notify:  make(chan struct{}, 10),
-		name:    name,
+			workqueue.TypedRateLimitingQueueConfig[*event.Event]{
+				Name: name,
+				DelayingQueue: workqueue.NewTypedDelayingQueueWithConfig(workqueue.TypedDelayingQueueConfig[*event.Event]{
+					Name: name,
+					Queue: workqueue.NewTypedWithConfig(workqueue.TypedQueueConfig[*event.Event]{
+						Name:  name,
+						Queue: pq,
+					}),
+				}),
+			}),
+		pq:          pq,
+		rateLimiter: rateLimiter,
+		maxSize:     maxSize,
+		policy:      DefaultOverflowPolicy,
+		notify:      make(chan struct{}, 10),
+		name:        name,
+		queued:      make(map[string]*event.Event),
+		latest:      make(map[string]*event.Event),
+		enqueued:    make(map[*event.Event]queuedItem),
+		clock:       clock.StandardClock(),
 	}
+	bq.space = sync.NewCond(&bq.lock)
+	return bq
 }
 
 func (bq *boundedQueue) Add(item *event.Event) {
-	// We pop the oldest item if the size is going to exceed maxSize.
-	if bq.Len() == bq.maxSize {
-		old, _ := bq.Get()
-		bq.Done(old)
+	if bq.stream != nil {
+		bq.publish(item)
+		return
+	}
+	if bq.closed.Load() {
+		bq.checkpoint(item)
+		return
+	}
+	if bq.coalesceUpdates && isUpdate(item) && bq.coalesce(item) {
+		return
+	}
+	if bq.full(item) {
+		if bq.onOverflow != nil && (bq.policy != OverflowAlert || !bq.overflowing.Swap(true)) {
+			bq.onOverflow()
+		}
+		switch bq.policy {
+		case OverflowDropNewest, OverflowDisconnect:
+			bq.dropped()
+			return
+		case OverflowCoalesce:
+			if bq.coalesce(item) {
+				return
+			}
+		case OverflowBlock:
+			if !bq.waitForSpace(item) {
+				return
+			}
+		}
+	} else {
+		bq.overflowing.Store(false)
+	}
+	bq.persist(item)
+	bq.add(item, time.Time{})
+}
+
+// full returns whether adding item would exceed the limits of the queue.
+func (bq *boundedQueue) full(item *event.Event) bool {
+	bq.lock.Lock()
+	defer bq.lock.Unlock()
+	return bq.fullLocked(item)
+}
+
+// fullLocked is like full, but the caller must hold bq.lock. A single item
+// exceeding the byte limit can always be added to the empty queue.
+func (bq *boundedQueue) fullLocked(item *event.Event) bool {
+	if bq.Len() >= bq.maxSize {
+		return true
+	}
+	return bq.maxBytes > 0 && bq.bytes > 0 && bq.bytes+eventSize(item) > bq.maxBytes
+}
+
+// dropped reports that an item was dropped from the queue.
+func (bq *boundedQueue) dropped() {
+	if bq.onDrop != nil {
+		bq.onDrop()
 	}
+}
+
+// eventSize returns the size of the data of ev
+func eventSize(ev *event.Event) int64 {
+	return int64(len(ev.Data()))
+}
+
+// add queues item, which was queued at queued, or now if queued is zero.
+func (bq *boundedQueue) add(item *event.Event, queued time.Time) {
+	if bq.seq != nil {
+		bq.seq.stamp(item)
+	}
+	// We drop the oldest items of the lowest priority if the queue is going
+	// to exceed its limits, unless the limits only raise alerts.
+	for bq.policy != OverflowAlert && bq.Len() > 0 && bq.full(item) {
+		n := bq.Len()
+		bq.evict()
+		if bq.Len() >= n {
+			// A concurrent Get made space instead
+			break
+		}
+	}
+	if bq.policy == OverflowCoalesce || bq.coalesceUpdates {
+		if key := coalescingKey(item); key != "" {
+			bq.lock.Lock()
+			bq.queued[key] = item
+			bq.latest[agentevent.ResourceID(item)] = item
+			bq.lock.Unlock()
+		}
+	}
+	bq.markEnqueued(item, queued)
 	bq.TypedRateLimitingInterface.Add(item)
+	if bq.onEnqueue != nil {
+		bq.onEnqueue(bq.Len())
+	}
 
 	// Notify any waiting goroutines that an item has been added to the queue.
 	select {
@@ -83,15 +273,504 @@ func (bq *boundedQueue) Add(item *event.Event) {
 	}
 }
 
+// evict drops the oldest item of the lowest priority from the queue.
+func (bq *boundedQueue) evict() {
+	bq.pq.requestEviction()
+	old, _ := bq.get()
+	if old == nil {
+		return
+	}
+	if !bq.pq.wasEvicted(old) {
+		// A concurrent Get took the item chosen for eviction and dropped it,
+		// which made space in the queue. Requeue the item we got instead.
+		bq.persist(old)
+		bq.TypedRateLimitingInterface.Add(old)
+	} else {
+		bq.dequeued(old, false)
+		bq.dropped()
+	}
+	bq.Done(old)
+}
+
+// Get returns the next item from the queue, blocking until one is available.
+func (bq *boundedQueue) Get() (*event.Event, bool) {
+	for bq.stream != nil && bq.Len() == 0 && !bq.ShuttingDown() {
+		bq.fetch(context.Background())
+	}
+	for {
+		item, shutdown := bq.get()
+		if item == nil {
+			return item, shutdown
+		}
+		if !bq.pq.wasEvicted(item) && !bq.expire(item) {
+			bq.dequeued(item, true)
+			return item, shutdown
+		}
+		bq.dequeued(item, false)
+		bq.Done(item)
+	}
+}
+
+// expire returns whether item has been queued for longer than its
+// time-to-live, in which case it must be dropped. Coalescing an event into
+// item restarts its time-to-live.
+func (bq *boundedQueue) expire(item *event.Event) bool {
+	ttl := bq.ttls.For(item)
+	if ttl <= 0 {
+		return false
+	}
+	bq.lock.Lock()
+	queued, ok := bq.enqueued[item]
+	bq.lock.Unlock()
+	if !ok || bq.clock.Since(queued.updated) <= ttl {
+		return false
+	}
+	log().WithFields(logrus.Fields{
+		"queue":      bq.name,
+		"event_type": item.Type(),
+		"ttl":        ttl,
+	}).Debug("Dropping expired event")
+	if bq.onExpire != nil {
+		bq.onExpire(item)
+	}
+	return true
+}
+
+// get takes the next item from the queue, which may have been chosen for
+// eviction.
+func (bq *boundedQueue) get() (*event.Event, bool) {
+	item, shutdown := bq.TypedRateLimitingInterface.Get()
+	if item != nil {
+		bq.lock.Lock()
+		// The item can no longer be coalesced once it's been taken, since it
+		// is being processed.
+		bq.forget(item)
+		bq.space.Broadcast()
+		bq.lock.Unlock()
+	}
+	if bq.store != nil && item != nil {
+		bq.store.taken(item)
+	}
+	return item, shutdown
+}
+
+// markEnqueued records the time item was added to the queue, unless the item
+// is queued already. If queued is zero, the item was added now.
+func (bq *boundedQueue) markEnqueued(item *event.Event, queued time.Time) {
+	bq.lock.Lock()
+	defer bq.lock.Unlock()
+	if _, ok := bq.enqueued[item]; !ok {
+		size := eventSize(item)
+		if queued.IsZero() {
+			queued = bq.clock.Now()
+		}
+		bq.enqueued[item] = queuedItem{since: queued, updated: queued, size: size}
+		bq.bytes += size
+	}
+}
+
+// dequeued forgets the time item was added to the queue. If delivered is
+// true, the item was handed to a consumer and onDequeue is called.
+func (bq *boundedQueue) dequeued(item *event.Event, delivered bool) {
+	bq.lock.Lock()
+	queued, ok := bq.enqueued[item]
+	delete(bq.enqueued, item)
+	bq.bytes -= queued.size
+	bq.lock.Unlock()
+	if !delivered || bq.onDequeue == nil {
+		return
+	}
+	var wait time.Duration
+	if ok {
+		wait = bq.clock.Since(queued.since)
+	}
+	bq.onDequeue(bq.Len(), wait)
+}
+
+// forget removes item from the events that may be coalesced. The caller must
+// hold bq.lock.
+func (bq *boundedQueue) forget(item *event.Event) {
+	if key := coalescingKey(item); key != "" && bq.queued[key] == item {
+		delete(bq.queued, key)
+	}
+	if id := agentevent.ResourceID(item); id != "" && bq.latest[id] == item {
+		delete(bq.latest, id)
+	}
+}
+
+// purge drops all items from the queue that have not been taken yet, and
+// returns their number.
+func (bq *boundedQueue) purge() int {
+	items := bq.pq.purge()
+	bq.lock.Lock()
+	for _, item := range items {
+		bq.forget(item)
+		bq.bytes -= bq.enqueued[item].size
+		delete(bq.enqueued, item)
+	}
+	bq.space.Broadcast()
+	bq.lock.Unlock()
+	if bq.store != nil {
+		for _, item := range items {
+			bq.store.taken(item)
+			if err := bq.store.done(item); err != nil {
+				log().WithError(err).WithField("queue", bq.name).Warn("Could not remove event from queue storage")
+			}
+		}
+	}
+	purged := len(items)
+	if bq.stream != nil {
+		for _, item := range items {
+			bq.stream.ack(context.Background(), item)
+		}
+		n, err := bq.stream.purge(context.Background())
+		if err != nil {
+			log().WithError(err).WithField("queue", bq.name).Warn("Could not purge queued events")
+		}
+		purged += n
+	}
+	if purged > 0 {
+		bq.dropped()
+	}
+	return purged
+}
+
+// snapshot returns the items in the queue that have not been taken yet, in
+// the order they will be taken.
+func (bq *boundedQueue) snapshot() []QueuedEvent {
+	items := bq.pq.items()
+	bq.lock.Lock()
+	defer bq.lock.Unlock()
+	events := make([]QueuedEvent, 0, len(items))
+	for _, item := range items {
+		events = append(events, QueuedEvent{Event: item, Queued: bq.enqueued[item].since})
+	}
+	return events
+}
+
+// ShutDown shuts down the queue, and wakes up callers waiting for space in
+// the queue.
+func (bq *boundedQueue) ShutDown() {
+	bq.TypedRateLimitingInterface.ShutDown()
+	bq.resume()
+	bq.lock.Lock()
+	bq.space.Broadcast()
+	bq.lock.Unlock()
+}
+
+// ShutDownWithDrain shuts down the queue once all items have been processed,
+// and wakes up callers waiting for space in the queue.
+func (bq *boundedQueue) ShutDownWithDrain() {
+	bq.lock.Lock()
+	bq.space.Broadcast()
+	bq.lock.Unlock()
+	bq.TypedRateLimitingInterface.ShutDownWithDrain()
+}
+
+// waitForSpace blocks until item can be added to the queue without exceeding
+// its limits. Returns false if the queue was shut down while waiting.
+func (bq *boundedQueue) waitForSpace(item *event.Event) bool {
+	bq.lock.Lock()
+	defer bq.lock.Unlock()
+	for bq.fullLocked(item) {
+		if bq.ShuttingDown() {
+			return false
+		}
+		bq.space.Wait()
+	}
+	return !bq.ShuttingDown()
+}
+
+// coalesce replaces the queued event of the same type for the same resource
+// as item with item. The replaced event keeps its position in the queue.
+// Returns false if there is no such event, or if another event for the same
+// resource was queued after it, which item must not overtake.
+func (bq *boundedQueue) coalesce(item *event.Event) bool {
+	key := coalescingKey(item)
+	if key == "" {
+		return false
+	}
+	bq.lock.Lock()
+	defer bq.lock.Unlock()
+	queued, ok := bq.queued[key]
+	if !ok || bq.latest[agentevent.ResourceID(item)] != queued {
+		return false
+	}
+	// The coalesced event takes the place of the queued one in the sequence
+	seq, sequenced := agentevent.GetSequence(queued)
+	*queued = item.Clone()
+	if sequenced {
+		agentevent.SetSequence(queued, seq)
+	}
+	now := bq.clock.Now()
+	if q, ok := bq.enqueued[queued]; ok {
+		size := eventSize(queued)
+		bq.bytes += size - q.size
+		q.size = size
+		q.updated = now
+		bq.enqueued[queued] = q
+	}
+	if bq.store != nil {
+		if err := bq.store.update(queued, now); err != nil {
+			log().WithError(err).WithField("queue", bq.name).Error("Could not persist coalesced event")
+		}
+	}
+	return true
+}
+
+// coalescingKey returns the key identifying events that may replace each
+// other in a queue, or the empty string if ev cannot be coalesced.
+func coalescingKey(ev *event.Event) string {
+	resourceID := agentevent.ResourceID(ev)
+	if resourceID == "" {
+		return ""
+	}
+	return ev.Type() + "/" + ev.DataSchema() + "/" + resourceID
+}
+
+// isUpdate returns whether ev is a spec or status update, which carries the
+// complete state of its resource and thus supersedes earlier updates.
+func isUpdate(ev *event.Event) bool {
+	return ev.Type() == agentevent.SpecUpdate.String() || ev.Type() == agentevent.StatusUpdate.String()
+}
+
+// Done marks the processing of item as finished. A persisted item is removed
+// from the queue's storage, unless it was requeued while being processed. An
+// item read from a stream is acknowledged.
+func (bq *boundedQueue) Done(item *event.Event) {
+	bq.TypedRateLimitingInterface.Done(item)
+	if bq.stream != nil {
+		bq.stream.ack(context.Background(), item)
+	}
+	if bq.store != nil {
+		if err := bq.store.done(item); err != nil {
+			log().WithError(err).WithField("queue", bq.name).Warn("Could not remove event from queue storage")
+		}
+	}
+}
+
+// AddRateLimited adds item to the queue after the rate limiter says it's ok.
+func (bq *boundedQueue) AddRateLimited(item *event.Event) {
+	if bq.stream != nil {
+		bq.AddAfter(item, bq.rateLimiter.When(item))
+		return
+	}
+	if bq.closed.Load() {
+		bq.checkpoint(item)
+		return
+	}
+	bq.persist(item)
+	bq.markEnqueued(item, time.Time{})
+	bq.TypedRateLimitingInterface.AddRateLimited(item)
+	if bq.onEnqueue != nil {
+		bq.onEnqueue(bq.Len())
+	}
+}
+
+// AddAfter adds item to the queue after the given duration has passed.
+func (bq *boundedQueue) AddAfter(item *event.Event, duration time.Duration) {
+	if bq.stream != nil {
+		if duration <= 0 {
+			bq.publish(item)
+		} else {
+			time.AfterFunc(duration, func() { bq.publish(item) })
+		}
+		return
+	}
+	if bq.closed.Load() {
+		bq.checkpoint(item)
+		return
+	}
+	bq.persist(item)
+	bq.markEnqueued(item, time.Time{})
+	bq.TypedRateLimitingInterface.AddAfter(item, duration)
+	if bq.onEnqueue != nil {
+		bq.onEnqueue(bq.Len())
+	}
+}
+
+// publish appends item to the queue's stream. Items cannot be queued if the
+// stream is not available.
+func (bq *boundedQueue) publish(item *event.Event) {
+	if err := bq.stream.publish(context.Background(), item, bq.clock.Now()); err != nil {
+		log().WithError(err).WithField("queue", bq.name).WithField("event_type", item.Type()).Error("Could not queue event")
+	}
+}
+
+// fetch reads the next items from the queue's stream and queues them, waiting
+// for up to redisReadTimeout if there are none.
+func (bq *boundedQueue) fetch(ctx context.Context) {
+	items, err := bq.stream.read(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		log().WithError(err).WithField("queue", bq.name).Error("Could not read queued events")
+		select {
+		case <-ctx.Done():
+		case <-time.After(redisRetryInterval):
+		}
+		return
+	}
+	for _, item := range items {
+		bq.add(item.ev, item.queued)
+	}
+}
+
+// persist writes item to the queue's storage, if the queue is persistent.
+// Items that cannot be persisted are still queued in memory.
+func (bq *boundedQueue) persist(item *event.Event) {
+	if bq.store == nil {
+		return
+	}
+	if err := bq.store.put(item, bq.clock.Now()); err != nil {
+		log().WithError(err).WithField("queue", bq.name).Error("Could not persist queued event")
+	}
+}
+
 type SendRecvQueues struct {
 	queues    map[string]*queuepair
 	queuelock sync.RWMutex
+	// storageDir is the directory queued events are persisted in. If empty,
+	// events are only kept in memory.
+	storageDir string
+	// limits configures the size and overflow policy of the send queues
+	limits *Limits
+	// onOverflow is called whenever an event is added to a full send queue
+	onOverflow func(name string, policy OverflowPolicy)
+	// coalesceUpdates makes the send queues coalesce updates of a resource
+	coalesceUpdates bool
+	// observer is notified about events added to and taken from the queues
+	observer Observer
+	// closed is true once the send queues stopped accepting new events
+	closed bool
+	// redis shares the send queues with other principal replicas. It is nil
+	// if the send queues are local to this replica.
+	redis *redisBackend
+	// ttls is the time-to-live of the events in the send queues
+	ttls *TTLs
+	// onExpire is called whenever an event expired in a send queue
+	onExpire func(name string, ev *event.Event)
+	// clock is the clock the time events spend in the queues is measured with
+	clock clock.Clock
+}
+
+// redisBackend configures the Redis streams backing the send queues
+type redisBackend struct {
+	client    redis.UniversalClient
+	keyPrefix string
+	consumer  string
+}
+
+// checkpoint persists an item added to the closed queue, so that it is queued
+// again after a restart. The item is dropped if the queue is not persistent.
+func (bq *boundedQueue) checkpoint(item *event.Event) {
+	if bq.store == nil {
+		log().WithField("queue", bq.name).WithField("event_type", item.Type()).Debug("Dropping event added to closed queue")
+		return
+	}
+	bq.persist(item)
 }
 
-func NewSendRecvQueues() *SendRecvQueues {
-	return &SendRecvQueues{
+// SendRecvQueuesOption configures a SendRecvQueues instance.
+type SendRecvQueuesOption func(q *SendRecvQueues)
+
+// WithStorageDir makes the queues persist their events in dir, so that they
+// survive a restart. Events persisted for a queue pair are queued again when
+// a queue pair of the same name is created.
+func WithStorageDir(dir string) SendRecvQueuesOption {
+	return func(q *SendRecvQueues) {
+		q.storageDir = dir
+	}
+}
+
+// WithRedis makes the send queues keep their events in Redis streams, which
+// are shared by all principal replicas using the same key prefix. Each send
+// queue is a stream named after the prefix and the name of its queue pair.
+// Events added to a send queue on any replica are taken from it by the
+// replica that serves the agent. The consumer name must be unique for each
+// replica, and stable across restarts.
+func WithRedis(client redis.UniversalClient, keyPrefix, consumer string) SendRecvQueuesOption {
+	return func(q *SendRecvQueues) {
+		q.redis = &redisBackend{client: client, keyPrefix: keyPrefix, consumer: consumer}
+	}
+}
+
+// WithTTLs configures the time-to-live of the events in the send queues by
+// event type. Events that have been queued for longer than their time-to-live
+// are dropped when they are taken from the queue.
+func WithTTLs(ttls *TTLs) SendRecvQueuesOption {
+	return func(q *SendRecvQueues) {
+		q.ttls = ttls
+	}
+}
+
+// WithExpiryHandler sets a function that is called with the name of the queue
+// pair and the event whenever an event expired in a send queue.
+func WithExpiryHandler(fn func(name string, ev *event.Event)) SendRecvQueuesOption {
+	return func(q *SendRecvQueues) {
+		q.onExpire = fn
+	}
+}
+
+// WithLimits configures the size and overflow policy of the send queue of
+// each queue pair.
+func WithLimits(limits *Limits) SendRecvQueuesOption {
+	return func(q *SendRecvQueues) {
+		q.limits = limits
+	}
+}
+
+// WithOverflowHandler sets a function that is called with the name of the
+// queue pair and the overflow policy of its send queue whenever an event is
+// added to a full send queue.
+func WithOverflowHandler(fn func(name string, policy OverflowPolicy)) SendRecvQueuesOption {
+	return func(q *SendRecvQueues) {
+		q.onOverflow = fn
+	}
+}
+
+// Observer receives measurements of the queues of each queue pair. The
+// direction is either "send" or "recv".
+type Observer interface {
+	// Enqueued is called whenever an event is added to a queue, with the
+	// resulting number of events in that queue.
+	Enqueued(name, direction string, depth int)
+	// Dequeued is called whenever an event is taken from a queue, with the
+	// resulting number of events in that queue and the time the event spent
+	// in the queue.
+	Dequeued(name, direction string, depth int, wait time.Duration)
+	// Deleted is called when the queue pair is deleted.
+	Deleted(name string)
+}
+
+// WithObserver sets an observer that is notified about events added to and
+// taken from the queues.
+func WithObserver(o Observer) SendRecvQueuesOption {
+	return func(q *SendRecvQueues) {
+		q.observer = o
+	}
+}
+
+// WithUpdateCoalescing makes a spec or status update added to a send queue
+// replace a queued update of the same kind for the same resource, if no other
+// event for that resource was queued after it. An agent that has been offline
+// for a while then receives only the latest update of each resource.
+func WithUpdateCoalescing(enabled bool) SendRecvQueuesOption {
+	return func(q *SendRecvQueues) {
+		q.coalesceUpdates = enabled
+	}
+}
+
+func NewSendRecvQueues(opts ...SendRecvQueuesOption) *SendRecvQueues {
+	q := &SendRecvQueues{
 		queues: make(map[string]*queuepair),
+		clock:  clock.StandardClock(),
 	}
+	for _, o := range opts {
+		o(q)
+	}
+	return q
 }
 
 // Names returns the names of all currently existing queues.
@@ -123,6 +802,70 @@ func (q *SendRecvQueues) Len() int {
 	return len(q.queues)
 }
 
+// Events returns the events in the send and receive queues of the queue pair
+// name that have not been taken from the queues yet, in the order they will
+// be taken.
+func (q *SendRecvQueues) Events(name string) (send, recv []QueuedEvent, err error) {
+	qp, err := q.pair(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return qp.sendq.snapshot(), qp.recvq.snapshot(), nil
+}
+
+// Purge drops the events in the send queue of the queue pair name that have
+// not been taken from the queue yet. Returns the number of dropped events.
+func (q *SendRecvQueues) Purge(name string) (int, error) {
+	qp, err := q.pair(name)
+	if err != nil {
+		return 0, err
+	}
+	return qp.sendq.purge(), nil
+}
+
+// Delivered records that ev was taken from the send queue of the queue pair
+// name to be delivered to its agent. The event is kept in the journal of the
+// queue pair until the agent acknowledges it. Delivered must be called before
+// the event can possibly be acknowledged.
+func (q *SendRecvQueues) Delivered(name string, ev *event.Event) {
+	if qp, err := q.pair(name); err == nil {
+		qp.journal.record(ev)
+	}
+}
+
+// Acknowledged records that the agent of the queue pair name acknowledged the
+// event referenced by ack, and moves the delivery cursor of the queue pair
+// forward as far as possible.
+func (q *SendRecvQueues) Acknowledged(name string, ack *event.Event) {
+	if qp, err := q.pair(name); err == nil {
+		qp.journal.ack(ack)
+	}
+}
+
+// Cursor returns the delivery cursor of the queue pair name, which is the
+// sequence number up to which the agent acknowledged all events delivered to
+// it. resumed is true if the cursor was restored from storage, and all events
+// the agent had not acknowledged before the restart have been queued again.
+func (q *SendRecvQueues) Cursor(name string) (cursor uint64, resumed bool, err error) {
+	qp, err := q.pair(name)
+	if err != nil {
+		return 0, false, err
+	}
+	cursor, resumed = qp.journal.position()
+	return cursor, resumed, nil
+}
+
+// pair returns the queue pair name, or ErrQueueNotFound if it doesn't exist.
+func (q *SendRecvQueues) pair(name string) (*queuepair, error) {
+	q.queuelock.RLock()
+	defer q.queuelock.RUnlock()
+	qp, ok := q.queues[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrQueueNotFound, name)
+	}
+	return qp, nil
+}
+
 // SendQ will return the send queue from the queue pair named name. If no such
 // queue pair exists, returns nil
 func (q *SendRecvQueues) SendQ(name string) workqueue.TypedRateLimitingInterface[*event.Event] {
@@ -169,15 +912,72 @@ func (q *SendRecvQueues) Create(name string) error {
 		}
 		return nil
 	}, defaultMaxQueueSize)
+	limit := q.limits.For(name)
+	if limit.Size > 0 {
+		sendQueueSize = limit.Size
+	}
 	qp := &queuepair{}
 
 	qp.sendq = newBoundedQueue(sendQueueSize, name+"-send")
+	qp.sendq.maxBytes = limit.Bytes
+	if limit.Policy != "" {
+		qp.sendq.policy = limit.Policy
+	}
+	qp.sendq.coalesceUpdates = q.coalesceUpdates
+	qp.sendq.seq = newSequencer()
+	qp.sendq.ttls = q.ttls
+	qp.sendq.clock = q.clock
+	if q.onExpire != nil {
+		qp.sendq.onExpire = func(ev *event.Event) { q.onExpire(name, ev) }
+	}
+	qp.sendq.closed.Store(q.closed)
+	if q.onOverflow != nil {
+		policy := qp.sendq.policy
+		qp.sendq.onOverflow = func() { q.onOverflow(name, policy) }
+	}
+	if q.redis != nil {
+		qp.sendq.stream = newRedisStream(q.redis.client, q.redis.keyPrefix+":"+name+":send", q.redis.consumer, sendQueueSize)
+	}
 	qp.recvq = newBoundedQueue(recvQueueSize, name+"-recv")
+	qp.recvq.clock = q.clock
+	qp.journal = newJournal(sendQueueSize)
+	// Dropped events can't be replayed, so the agent must be resynced
+	qp.sendq.onDrop = qp.journal.lost
+	if q.observer != nil {
+		q.observe(name, "send", qp.sendq)
+		q.observe(name, "recv", qp.recvq)
+	}
+	log().WithField("queue", name).Debugf("Send queue holds up to %d events with overflow policy %s", sendQueueSize, qp.sendq.policy)
+	if q.storageDir != "" {
+		if err := q.restore(name, "send", qp.sendq); err != nil {
+			return fmt.Errorf("cannot initialize queue for %s: %w", name, err)
+		}
+		if err := q.restore(name, "recv", qp.recvq); err != nil {
+			return fmt.Errorf("cannot initialize queue for %s: %w", name, err)
+		}
+		if err := q.replay(name, qp); err != nil {
+			return fmt.Errorf("cannot initialize queue for %s: %w", name, err)
+		}
+	}
 	q.queues[name] = qp
 
 	return nil
 }
 
+// Close makes the send queues of all queue pairs, including those created
+// later, stop accepting new events. Events that are already queued can still
+// be taken from the queues. Events added to a closed send queue are persisted
+// if the queues are persistent, so that they are sent after a restart, and
+// are dropped otherwise.
+func (q *SendRecvQueues) Close() {
+	q.queuelock.Lock()
+	defer q.queuelock.Unlock()
+	q.closed = true
+	for _, qp := range q.queues {
+		qp.sendq.closed.Store(true)
+	}
+}
+
 // Delete will delete the named queue pair from the list of available queue.
 // pairs. If shutdown is true, the Shutdown function will be called on both
 // send and receive queues. If the named queue does not exist, Delete will
@@ -194,11 +994,91 @@ func (q *SendRecvQueues) Delete(name string, shutdown bool) error {
 		queue.sendq.ShutDown()
 	}
 	delete(q.queues, name)
+	if q.observer != nil {
+		q.observer.Deleted(name)
+	}
+	if q.storageDir != "" {
+		if err := os.RemoveAll(filepath.Join(q.storageDir, name)); err != nil {
+			log().WithError(err).WithField("queue", name).Warn("Could not remove queue storage")
+		}
+	}
+	if queue.sendq.stream != nil {
+		if err := queue.sendq.stream.delete(context.Background()); err != nil {
+			log().WithError(err).WithField("queue", name).Warn("Could not remove queue stream")
+		}
+	}
+	return nil
+}
+
+// observe reports the events added to and taken from the queue bq of the
+// queue pair name to the observer.
+func (q *SendRecvQueues) observe(name, direction string, bq *boundedQueue) {
+	bq.onEnqueue = func(depth int) {
+		q.observer.Enqueued(name, direction, depth)
+	}
+	bq.onDequeue = func(depth int, wait time.Duration) {
+		q.observer.Dequeued(name, direction, depth, wait)
+	}
+}
+
+// restore attaches persistent storage to the queue bq of the queue pair name,
+// and queues all events persisted for it previously.
+func (q *SendRecvQueues) restore(name, kind string, bq *boundedQueue) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("%q is not a valid name for a persistent queue", name)
+	}
+	store, err := newEventStore(filepath.Join(q.storageDir, name, kind))
+	if err != nil {
+		return err
+	}
+	events, err := store.load()
+	if err != nil {
+		return err
+	}
+	bq.store = store
+	for _, ev := range events {
+		bq.add(ev.ev, ev.queued)
+	}
+	if len(events) > 0 {
+		log().WithField("queue", bq.name).Infof("Restored %d persisted events", len(events))
+	}
 	return nil
 }
 
+// replay attaches persistent storage to the journal of the queue pair name,
+// and queues the events its agent had not acknowledged before the restart
+// again. Events that were restored to the send queue already are skipped.
+func (q *SendRecvQueues) replay(name string, qp *queuepair) error {
+	events, err := qp.journal.restore(filepath.Join(q.storageDir, name, "journal"))
+	if err != nil {
+		return err
+	}
+	queued := make(map[string]bool)
+	for _, ev := range qp.sendq.pq.items() {
+		queued[eventKey(ev)] = true
+	}
+	replayed := 0
+	for _, ev := range events {
+		if queued[eventKey(ev)] {
+			continue
+		}
+		qp.sendq.persist(ev)
+		qp.sendq.add(ev, time.Time{})
+		replayed++
+	}
+	if replayed > 0 {
+		log().WithField("queue", name).Infof("Replaying %d events not acknowledged before the restart", replayed)
+	}
+	return nil
+}
+
+func log() *logrus.Entry {
+	return logging.GetDefaultLogger().ComponentLogger("Queue")
+}
+
 // GetWithContext is a wrapper around the workqueue's Get method.
-// It waits until an item is available in the queue or the context is Done
+// It waits until an item is available in the queue or the context is Done.
+// While the queue is paused, it waits for the queue to be resumed first.
 func GetWithContext(q workqueue.TypedRateLimitingInterface[*event.Event], ctx context.Context) (*event.Event, bool) {
 	bq, ok := q.(*boundedQueue)
 	if !ok {
@@ -206,8 +1086,37 @@ func GetWithContext(q workqueue.TypedRateLimitingInterface[*event.Event], ctx co
 	}
 
 	for {
+		if resumed := bq.pausedUntil(); resumed != nil {
+			select {
+			case <-ctx.Done():
+				return nil, false
+			case <-resumed:
+				continue
+			}
+		}
+
 		if bq.Len() > 0 {
-			return bq.Get()
+			item, shutdown := bq.get()
+			if item != nil && (bq.pq.wasEvicted(item) || bq.expire(item)) {
+				bq.dequeued(item, false)
+				bq.Done(item)
+				continue
+			}
+			if item != nil {
+				bq.dequeued(item, true)
+			}
+			return item, shutdown
+		}
+
+		if bq.stream != nil {
+			if ctx.Err() != nil {
+				return nil, false
+			}
+			if bq.ShuttingDown() {
+				return nil, true
+			}
+			bq.fetch(ctx)
+			continue
 		}
 
 		// Suspend until an item is available or context is cancelled
@@ -15,12 +15,22 @@
 package queue
 
 import (
+	"context"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/argoproj-labs/argocd-agent/internal/clock"
 	"github.com/argoproj-labs/argocd-agent/internal/config"
+	agentevent "github.com/argoproj-labs/argocd-agent/internal/event"
 	"github.com/cloudevents/sdk-go/v2/event"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/util/workqueue"
 )
 
 func Test_Queue(t *testing.T) {
@@ -112,3 +122,816 @@ func Test_Queue(t *testing.T) {
 	})
 
 }
+
+func Test_PersistentQueue(t *testing.T) {
+	newEvent := func(id string) *event.Event {
+		ev := event.New()
+		ev.SetID(id)
+		ev.SetType("test")
+		ev.SetSource("test")
+		return &ev
+	}
+	persisted := func(t *testing.T, dir string) int {
+		t.Helper()
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		return len(entries)
+	}
+
+	t.Run("Queued events survive a restart", func(t *testing.T) {
+		dir := t.TempDir()
+		q := NewSendRecvQueues(WithStorageDir(dir))
+		require.NoError(t, q.Create("agent1"))
+		q.SendQ("agent1").Add(newEvent("1"))
+		q.SendQ("agent1").Add(newEvent("2"))
+		q.RecvQ("agent1").Add(newEvent("3"))
+
+		q = NewSendRecvQueues(WithStorageDir(dir))
+		require.NoError(t, q.Create("agent1"))
+		require.Equal(t, 2, q.SendQ("agent1").Len())
+		ev, _ := q.SendQ("agent1").Get()
+		assert.Equal(t, "1", ev.ID())
+		ev, _ = q.SendQ("agent1").Get()
+		assert.Equal(t, "2", ev.ID())
+		require.Equal(t, 1, q.RecvQ("agent1").Len())
+		ev, _ = q.RecvQ("agent1").Get()
+		assert.Equal(t, "3", ev.ID())
+	})
+
+	t.Run("Processed events are removed from storage", func(t *testing.T) {
+		dir := t.TempDir()
+		q := NewSendRecvQueues(WithStorageDir(dir))
+		require.NoError(t, q.Create("agent1"))
+		sendq := q.SendQ("agent1")
+		sendq.Add(newEvent("1"))
+		assert.Equal(t, 1, persisted(t, filepath.Join(dir, "agent1", "send")))
+		ev, _ := sendq.Get()
+		assert.Equal(t, 1, persisted(t, filepath.Join(dir, "agent1", "send")))
+		sendq.Done(ev)
+		assert.Equal(t, 0, persisted(t, filepath.Join(dir, "agent1", "send")))
+	})
+
+	t.Run("Requeued events are kept in storage", func(t *testing.T) {
+		dir := t.TempDir()
+		q := NewSendRecvQueues(WithStorageDir(dir))
+		require.NoError(t, q.Create("agent1"))
+		sendq := q.SendQ("agent1")
+		sendq.Add(newEvent("1"))
+		ev, _ := sendq.Get()
+		sendq.AddAfter(ev, time.Hour)
+		sendq.Done(ev)
+		assert.Equal(t, 1, persisted(t, filepath.Join(dir, "agent1", "send")))
+	})
+
+	t.Run("Events dropped from a full queue are removed from storage", func(t *testing.T) {
+		t.Setenv(config.EnvSendQueueSize, "2")
+		dir := t.TempDir()
+		q := NewSendRecvQueues(WithStorageDir(dir))
+		require.NoError(t, q.Create("agent1"))
+		for i := 1; i <= 3; i++ {
+			q.SendQ("agent1").Add(newEvent(strconv.Itoa(i)))
+		}
+		assert.Equal(t, 2, persisted(t, filepath.Join(dir, "agent1", "send")))
+	})
+
+	t.Run("Deleting a queue pair removes its storage", func(t *testing.T) {
+		dir := t.TempDir()
+		q := NewSendRecvQueues(WithStorageDir(dir))
+		require.NoError(t, q.Create("agent1"))
+		q.SendQ("agent1").Add(newEvent("1"))
+		require.NoError(t, q.Delete("agent1", true))
+		assert.NoDirExists(t, filepath.Join(dir, "agent1"))
+	})
+
+	t.Run("Unreadable events are discarded", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "agent1", "send"), 0700))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "agent1", "send", "00000000000000000001.json"), []byte("{"), 0600))
+		q := NewSendRecvQueues(WithStorageDir(dir))
+		require.NoError(t, q.Create("agent1"))
+		assert.Equal(t, 0, q.SendQ("agent1").Len())
+		assert.Equal(t, 0, persisted(t, filepath.Join(dir, "agent1", "send")))
+	})
+
+	t.Run("Invalid queue names are rejected", func(t *testing.T) {
+		q := NewSendRecvQueues(WithStorageDir(t.TempDir()))
+		assert.Error(t, q.Create("../agent1"))
+		assert.False(t, q.HasQueuePair("../agent1"))
+	})
+}
+
+func Test_OverflowPolicy(t *testing.T) {
+	newEvent := func(id, resourceID string) *event.Event {
+		ev := event.New()
+		ev.SetID(id)
+		ev.SetType("update")
+		ev.SetSource("test")
+		if resourceID != "" {
+			ev.SetExtension("resourceid", resourceID)
+		}
+		return &ev
+	}
+	newQueues := func(t *testing.T, spec string, overflows *atomic.Int32) *SendRecvQueues {
+		t.Helper()
+		limits, err := ParseLimits([]string{spec})
+		require.NoError(t, err)
+		q := NewSendRecvQueues(WithLimits(limits), WithOverflowHandler(func(name string, policy OverflowPolicy) {
+			overflows.Add(1)
+		}))
+		require.NoError(t, q.Create("agent1"))
+		return q
+	}
+	ids := func(q workqueue.TypedRateLimitingInterface[*event.Event]) []string {
+		var ids []string
+		for q.Len() > 0 {
+			ev, _ := q.Get()
+			ids = append(ids, ev.ID())
+			q.Done(ev)
+		}
+		return ids
+	}
+
+	t.Run("Drop oldest", func(t *testing.T) {
+		var overflows atomic.Int32
+		sendq := newQueues(t, "agent1=2:drop-oldest", &overflows).SendQ("agent1")
+		for i := 1; i <= 3; i++ {
+			sendq.Add(newEvent(strconv.Itoa(i), ""))
+		}
+		assert.Equal(t, []string{"2", "3"}, ids(sendq))
+		assert.Equal(t, int32(1), overflows.Load())
+	})
+
+	t.Run("Drop newest", func(t *testing.T) {
+		var overflows atomic.Int32
+		sendq := newQueues(t, "agent1=2:drop-newest", &overflows).SendQ("agent1")
+		for i := 1; i <= 3; i++ {
+			sendq.Add(newEvent(strconv.Itoa(i), ""))
+		}
+		assert.Equal(t, []string{"1", "2"}, ids(sendq))
+		assert.Equal(t, int32(1), overflows.Load())
+	})
+
+	t.Run("Coalesce", func(t *testing.T) {
+		var overflows atomic.Int32
+		sendq := newQueues(t, "agent1=2:coalesce", &overflows).SendQ("agent1")
+		sendq.Add(newEvent("1", "app-a"))
+		sendq.Add(newEvent("2", "app-b"))
+		// Replaces event 1, which keeps its position in the queue
+		sendq.Add(newEvent("3", "app-a"))
+		assert.Equal(t, 2, sendq.Len())
+		// Nothing to coalesce with, so the oldest event is dropped
+		sendq.Add(newEvent("4", "app-c"))
+		assert.Equal(t, []string{"2", "4"}, ids(sendq))
+		assert.Equal(t, int32(2), overflows.Load())
+	})
+
+	t.Run("Coalesce keeps order", func(t *testing.T) {
+		var overflows atomic.Int32
+		sendq := newQueues(t, "agent1=2:coalesce", &overflows).SendQ("agent1")
+		sendq.Add(newEvent("1", "app-a"))
+		sendq.Add(newEvent("2", "app-b"))
+		sendq.Add(newEvent("3", "app-a"))
+		assert.Equal(t, []string{"3", "2"}, ids(sendq))
+	})
+
+	t.Run("Block", func(t *testing.T) {
+		var overflows atomic.Int32
+		sendq := newQueues(t, "agent1=1:block", &overflows).SendQ("agent1")
+		sendq.Add(newEvent("1", ""))
+		added := make(chan struct{})
+		go func() {
+			sendq.Add(newEvent("2", ""))
+			close(added)
+		}()
+		select {
+		case <-added:
+			t.Fatal("Add did not block on a full queue")
+		case <-time.After(100 * time.Millisecond):
+		}
+		ev, _ := sendq.Get()
+		assert.Equal(t, "1", ev.ID())
+		sendq.Done(ev)
+		select {
+		case <-added:
+		case <-time.After(time.Second):
+			t.Fatal("Add did not return once there was space in the queue")
+		}
+		assert.Equal(t, []string{"2"}, ids(sendq))
+	})
+
+	t.Run("Block returns on shutdown", func(t *testing.T) {
+		var overflows atomic.Int32
+		q := newQueues(t, "agent1=1:block", &overflows)
+		sendq := q.SendQ("agent1")
+		sendq.Add(newEvent("1", ""))
+		added := make(chan struct{})
+		go func() {
+			sendq.Add(newEvent("2", ""))
+			close(added)
+		}()
+		time.Sleep(50 * time.Millisecond)
+		require.NoError(t, q.Delete("agent1", true))
+		select {
+		case <-added:
+		case <-time.After(time.Second):
+			t.Fatal("Add did not return on shutdown")
+		}
+	})
+
+	t.Run("Byte limit", func(t *testing.T) {
+		var overflows atomic.Int32
+		sendq := newQueues(t, "agent1=10/250:drop-oldest", &overflows).SendQ("agent1")
+		for i := 1; i <= 3; i++ {
+			ev := newEvent(strconv.Itoa(i), "")
+			require.NoError(t, ev.SetData("text/plain", strings.Repeat("x", 100)))
+			sendq.Add(ev)
+		}
+		assert.Equal(t, []string{"2", "3"}, ids(sendq))
+		assert.Equal(t, int32(1), overflows.Load())
+	})
+
+	t.Run("Event larger than the byte limit", func(t *testing.T) {
+		var overflows atomic.Int32
+		sendq := newQueues(t, "agent1=10/50:drop-newest", &overflows).SendQ("agent1")
+		ev := newEvent("1", "")
+		require.NoError(t, ev.SetData("text/plain", strings.Repeat("x", 100)))
+		sendq.Add(ev)
+		assert.Equal(t, []string{"1"}, ids(sendq))
+		assert.Equal(t, int32(0), overflows.Load())
+	})
+
+	t.Run("Disconnect", func(t *testing.T) {
+		var overflows atomic.Int32
+		sendq := newQueues(t, "agent1=2:disconnect", &overflows).SendQ("agent1")
+		for i := 1; i <= 4; i++ {
+			sendq.Add(newEvent(strconv.Itoa(i), ""))
+		}
+		assert.Equal(t, []string{"1", "2"}, ids(sendq))
+		assert.Equal(t, int32(2), overflows.Load())
+	})
+
+	t.Run("Alert", func(t *testing.T) {
+		var overflows atomic.Int32
+		sendq := newQueues(t, "agent1=2:alert", &overflows).SendQ("agent1")
+		for i := 1; i <= 4; i++ {
+			sendq.Add(newEvent(strconv.Itoa(i), ""))
+		}
+		// Reported once when the queue exceeds its limit
+		assert.Equal(t, int32(1), overflows.Load())
+		assert.Equal(t, []string{"1", "2", "3", "4"}, ids(sendq))
+		sendq.Add(newEvent("5", ""))
+		sendq.Add(newEvent("6", ""))
+		sendq.Add(newEvent("7", ""))
+		assert.Equal(t, int32(2), overflows.Load())
+	})
+
+	t.Run("Dropped events require a resync", func(t *testing.T) {
+		limits, err := ParseLimits([]string{"agent1=1:drop-newest"})
+		require.NoError(t, err)
+		dir := t.TempDir()
+		require.NoError(t, NewSendRecvQueues(WithStorageDir(dir)).Create("agent1"))
+		q := NewSendRecvQueues(WithStorageDir(dir), WithLimits(limits))
+		require.NoError(t, q.Create("agent1"))
+		_, resumed, err := q.Cursor("agent1")
+		require.NoError(t, err)
+		require.True(t, resumed)
+		q.SendQ("agent1").Add(newEvent("1", ""))
+		q.SendQ("agent1").Add(newEvent("2", ""))
+		_, resumed, err = q.Cursor("agent1")
+		require.NoError(t, err)
+		assert.False(t, resumed)
+	})
+
+	t.Run("Receive queue is not affected", func(t *testing.T) {
+		var overflows atomic.Int32
+		recvq := newQueues(t, "agent1=1:drop-newest", &overflows).RecvQ("agent1")
+		recvq.Add(newEvent("1", ""))
+		recvq.Add(newEvent("2", ""))
+		assert.Equal(t, 2, recvq.Len())
+		assert.Equal(t, int32(0), overflows.Load())
+	})
+}
+
+func Test_UpdateCoalescing(t *testing.T) {
+	newEvent := func(id string, evType agentevent.EventType, resourceID string) *event.Event {
+		ev := event.New()
+		ev.SetID(id)
+		ev.SetType(evType.String())
+		ev.SetSource("test")
+		ev.SetExtension("resourceid", resourceID)
+		return &ev
+	}
+	drain := func(q workqueue.TypedRateLimitingInterface[*event.Event]) []string {
+		var ids []string
+		for q.Len() > 0 {
+			ev, _ := q.Get()
+			ids = append(ids, ev.ID())
+			q.Done(ev)
+		}
+		return ids
+	}
+
+	t.Run("Updates replace queued updates of the same resource", func(t *testing.T) {
+		q := NewSendRecvQueues(WithUpdateCoalescing(true))
+		require.NoError(t, q.Create("agent1"))
+		sendq := q.SendQ("agent1")
+		sendq.Add(newEvent("spec-a1", agentevent.SpecUpdate, "app-a"))
+		sendq.Add(newEvent("spec-b1", agentevent.SpecUpdate, "app-b"))
+		sendq.Add(newEvent("spec-a2", agentevent.SpecUpdate, "app-a"))
+		sendq.Add(newEvent("spec-a3", agentevent.SpecUpdate, "app-a"))
+		assert.Equal(t, []string{"spec-a3", "spec-b1"}, drain(sendq))
+	})
+
+	t.Run("Updates do not overtake later events of the same resource", func(t *testing.T) {
+		q := NewSendRecvQueues(WithUpdateCoalescing(true))
+		require.NoError(t, q.Create("agent1"))
+		sendq := q.SendQ("agent1")
+		sendq.Add(newEvent("spec-a1", agentevent.SpecUpdate, "app-a"))
+		sendq.Add(newEvent("op-a", agentevent.SetOperation, "app-a"))
+		sendq.Add(newEvent("spec-a2", agentevent.SpecUpdate, "app-a"))
+		assert.Equal(t, []string{"spec-a1", "op-a", "spec-a2"}, drain(sendq))
+	})
+
+	t.Run("Updates taken from the queue are not replaced", func(t *testing.T) {
+		q := NewSendRecvQueues(WithUpdateCoalescing(true))
+		require.NoError(t, q.Create("agent1"))
+		sendq := q.SendQ("agent1")
+		sendq.Add(newEvent("spec-a1", agentevent.SpecUpdate, "app-a"))
+		ev, _ := sendq.Get()
+		sendq.Add(newEvent("spec-a2", agentevent.SpecUpdate, "app-a"))
+		assert.Equal(t, "spec-a1", ev.ID())
+		sendq.Done(ev)
+		assert.Equal(t, []string{"spec-a2"}, drain(sendq))
+	})
+
+	t.Run("Other events are not coalesced", func(t *testing.T) {
+		q := NewSendRecvQueues(WithUpdateCoalescing(true))
+		require.NoError(t, q.Create("agent1"))
+		sendq := q.SendQ("agent1")
+		sendq.Add(newEvent("op-a1", agentevent.SetOperation, "app-a"))
+		sendq.Add(newEvent("op-a2", agentevent.SetOperation, "app-a"))
+		assert.Equal(t, 2, sendq.Len())
+	})
+
+	t.Run("Coalescing is disabled by default", func(t *testing.T) {
+		q := NewSendRecvQueues()
+		require.NoError(t, q.Create("agent1"))
+		sendq := q.SendQ("agent1")
+		sendq.Add(newEvent("status-a1", agentevent.StatusUpdate, "app-a"))
+		sendq.Add(newEvent("status-a2", agentevent.StatusUpdate, "app-a"))
+		assert.Equal(t, 2, sendq.Len())
+	})
+}
+
+func Test_Sequence(t *testing.T) {
+	newEvent := func(id string, evType agentevent.EventType, resourceID string) *event.Event {
+		ev := event.New()
+		ev.SetID(id)
+		ev.SetType(evType.String())
+		ev.SetSource("test")
+		ev.SetExtension("resourceid", resourceID)
+		return &ev
+	}
+	drain := func(q workqueue.TypedRateLimitingInterface[*event.Event]) []agentevent.Sequence {
+		var seqs []agentevent.Sequence
+		for q.Len() > 0 {
+			ev, _ := q.Get()
+			seq, ok := agentevent.GetSequence(ev)
+			require.True(t, ok)
+			seqs = append(seqs, seq)
+			q.Done(ev)
+		}
+		return seqs
+	}
+
+	t.Run("Events are numbered in the order they are queued", func(t *testing.T) {
+		q := NewSendRecvQueues()
+		require.NoError(t, q.Create("agent1"))
+		sendq := q.SendQ("agent1")
+		sendq.Add(newEvent("spec-a1", agentevent.SpecUpdate, "app-a"))
+		sendq.Add(newEvent("spec-b1", agentevent.SpecUpdate, "app-b"))
+		sendq.Add(newEvent("spec-a2", agentevent.SpecUpdate, "app-a"))
+		sendq.Add(newEvent("delete-a", agentevent.Delete, "app-a"))
+		sendq.Add(newEvent("create-a", agentevent.Create, "app-a"))
+		seqs := drain(sendq)
+		require.Len(t, seqs, 5)
+		epoch := seqs[0].Epoch
+		assert.NotEmpty(t, epoch)
+		assert.Equal(t, []agentevent.Sequence{
+			{Epoch: epoch, Number: 1, Previous: 0},
+			{Epoch: epoch, Number: 2, Previous: 0},
+			{Epoch: epoch, Number: 3, Previous: 1},
+			{Epoch: epoch, Number: 4, Previous: 3},
+			{Epoch: epoch, Number: 5, Previous: 0},
+		}, seqs)
+	})
+
+	t.Run("Each queue pair has its own sequence", func(t *testing.T) {
+		q := NewSendRecvQueues()
+		require.NoError(t, q.Create("agent1"))
+		require.NoError(t, q.Create("agent2"))
+		q.SendQ("agent1").Add(newEvent("spec-a1", agentevent.SpecUpdate, "app-a"))
+		q.SendQ("agent2").Add(newEvent("spec-a1", agentevent.SpecUpdate, "app-a"))
+		seq1 := drain(q.SendQ("agent1"))
+		seq2 := drain(q.SendQ("agent2"))
+		require.Len(t, seq1, 1)
+		require.Len(t, seq2, 1)
+		assert.Equal(t, uint64(1), seq1[0].Number)
+		assert.Equal(t, uint64(1), seq2[0].Number)
+		assert.NotEqual(t, seq1[0].Epoch, seq2[0].Epoch)
+	})
+
+	t.Run("Coalesced updates keep the number of the queued update", func(t *testing.T) {
+		q := NewSendRecvQueues(WithUpdateCoalescing(true))
+		require.NoError(t, q.Create("agent1"))
+		sendq := q.SendQ("agent1")
+		sendq.Add(newEvent("spec-a1", agentevent.SpecUpdate, "app-a"))
+		sendq.Add(newEvent("spec-b1", agentevent.SpecUpdate, "app-b"))
+		sendq.Add(newEvent("spec-a2", agentevent.SpecUpdate, "app-a"))
+		sendq.Add(newEvent("spec-b2", agentevent.SpecUpdate, "app-b"))
+		seqs := drain(sendq)
+		require.Len(t, seqs, 2)
+		assert.Equal(t, uint64(1), seqs[0].Number)
+		assert.Equal(t, uint64(2), seqs[1].Number)
+	})
+
+	t.Run("Received events are not numbered", func(t *testing.T) {
+		q := NewSendRecvQueues()
+		require.NoError(t, q.Create("agent1"))
+		recvq := q.RecvQ("agent1")
+		recvq.Add(newEvent("spec-a1", agentevent.SpecUpdate, "app-a"))
+		ev, _ := recvq.Get()
+		_, ok := agentevent.GetSequence(ev)
+		assert.False(t, ok)
+	})
+}
+
+func Test_EventTTL(t *testing.T) {
+	newEvent := func(id string, evType agentevent.EventType, resourceID string) *event.Event {
+		ev := event.New()
+		ev.SetID(id)
+		ev.SetType(evType.String())
+		ev.SetSource("test")
+		ev.SetExtension("resourceid", resourceID)
+		return &ev
+	}
+	// drain takes all items from q that did not expire
+	drain := func(t *testing.T, q workqueue.TypedRateLimitingInterface[*event.Event]) []string {
+		t.Helper()
+		var ids []string
+		for q.Len() > 0 {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			ev, _ := GetWithContext(q, ctx)
+			cancel()
+			if ev == nil {
+				break
+			}
+			ids = append(ids, ev.ID())
+			q.Done(ev)
+		}
+		return ids
+	}
+	newQueues := func(t *testing.T, cl clock.Clock, expired *[]string, opts ...SendRecvQueuesOption) *SendRecvQueues {
+		t.Helper()
+		ttls, err := ParseTTLs([]string{"status-update=10m"})
+		require.NoError(t, err)
+		opts = append(opts, WithTTLs(ttls), WithExpiryHandler(func(name string, ev *event.Event) {
+			*expired = append(*expired, name+"/"+ev.ID())
+		}))
+		q := NewSendRecvQueues(opts...)
+		q.clock = cl
+		require.NoError(t, q.Create("agent1"))
+		return q
+	}
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("Expired events are dropped", func(t *testing.T) {
+		var expired []string
+		cl := clock.SeededClock(start)
+		sendq := newQueues(t, cl, &expired).SendQ("agent1")
+		sendq.Add(newEvent("status-a", agentevent.StatusUpdate, "app-a"))
+		sendq.Add(newEvent("spec-a", agentevent.SpecUpdate, "app-a"))
+		cl.At(start.Add(11 * time.Minute))
+		sendq.Add(newEvent("status-b", agentevent.StatusUpdate, "app-b"))
+		assert.Equal(t, []string{"spec-a", "status-b"}, drain(t, sendq))
+		assert.Equal(t, []string{"agent1/status-a"}, expired)
+	})
+
+	t.Run("Expired events are dropped by Get", func(t *testing.T) {
+		var expired []string
+		cl := clock.SeededClock(start)
+		sendq := newQueues(t, cl, &expired).SendQ("agent1")
+		sendq.Add(newEvent("status-a", agentevent.StatusUpdate, "app-a"))
+		sendq.Add(newEvent("spec-a", agentevent.SpecUpdate, "app-a"))
+		cl.At(start.Add(11 * time.Minute))
+		ev, _ := sendq.Get()
+		assert.Equal(t, "spec-a", ev.ID())
+		assert.Equal(t, []string{"agent1/status-a"}, expired)
+	})
+
+	t.Run("The last queued event may expire", func(t *testing.T) {
+		var expired []string
+		cl := clock.SeededClock(start)
+		sendq := newQueues(t, cl, &expired).SendQ("agent1")
+		sendq.Add(newEvent("status-a", agentevent.StatusUpdate, "app-a"))
+		cl.At(start.Add(11 * time.Minute))
+		assert.Empty(t, drain(t, sendq))
+		assert.Equal(t, []string{"agent1/status-a"}, expired)
+	})
+
+	t.Run("Coalescing restarts the time-to-live", func(t *testing.T) {
+		var expired []string
+		cl := clock.SeededClock(start)
+		sendq := newQueues(t, cl, &expired, WithUpdateCoalescing(true)).SendQ("agent1")
+		sendq.Add(newEvent("status-a1", agentevent.StatusUpdate, "app-a"))
+		cl.At(start.Add(6 * time.Minute))
+		sendq.Add(newEvent("status-a2", agentevent.StatusUpdate, "app-a"))
+		cl.At(start.Add(12 * time.Minute))
+		assert.Equal(t, []string{"status-a2"}, drain(t, sendq))
+		assert.Empty(t, expired)
+	})
+
+	t.Run("Restored events keep the time they were queued at", func(t *testing.T) {
+		var expired []string
+		dir := t.TempDir()
+		cl := clock.SeededClock(start)
+		sendq := newQueues(t, cl, &expired, WithStorageDir(dir)).SendQ("agent1")
+		sendq.Add(newEvent("status-a", agentevent.StatusUpdate, "app-a"))
+		sendq.Add(newEvent("spec-a", agentevent.SpecUpdate, "app-a"))
+
+		cl.At(start.Add(11 * time.Minute))
+		sendq = newQueues(t, cl, &expired, WithStorageDir(dir)).SendQ("agent1")
+		assert.Equal(t, []string{"spec-a"}, drain(t, sendq))
+		assert.Equal(t, []string{"agent1/status-a"}, expired)
+	})
+
+	t.Run("Events do not carry the time they were queued at", func(t *testing.T) {
+		var expired []string
+		dir := t.TempDir()
+		cl := clock.SeededClock(start)
+		sendq := newQueues(t, cl, &expired, WithStorageDir(dir)).SendQ("agent1")
+		sendq.Add(newEvent("spec-a", agentevent.SpecUpdate, "app-a"))
+		sendq = newQueues(t, cl, &expired, WithStorageDir(dir)).SendQ("agent1")
+		ev, _ := sendq.Get()
+		assert.NotContains(t, ev.Extensions(), queuedAtExtension)
+	})
+}
+
+type fakeObserver struct {
+	enqueued map[string]int
+	dequeued map[string]int
+	depth    map[string]int
+	waits    []time.Duration
+	deleted  []string
+}
+
+func newFakeObserver() *fakeObserver {
+	return &fakeObserver{
+		enqueued: make(map[string]int),
+		dequeued: make(map[string]int),
+		depth:    make(map[string]int),
+	}
+}
+
+func (o *fakeObserver) Enqueued(name, direction string, depth int) {
+	o.enqueued[name+"/"+direction]++
+	o.depth[name+"/"+direction] = depth
+}
+
+func (o *fakeObserver) Dequeued(name, direction string, depth int, wait time.Duration) {
+	o.dequeued[name+"/"+direction]++
+	o.depth[name+"/"+direction] = depth
+	o.waits = append(o.waits, wait)
+}
+
+func (o *fakeObserver) Deleted(name string) {
+	o.deleted = append(o.deleted, name)
+}
+
+func Test_Observer(t *testing.T) {
+	newEvent := func(id string) *event.Event {
+		ev := event.New()
+		ev.SetID(id)
+		ev.SetSource("test")
+		ev.SetType("test")
+		return &ev
+	}
+
+	t.Run("Events added and taken are observed", func(t *testing.T) {
+		o := newFakeObserver()
+		q := NewSendRecvQueues(WithObserver(o))
+		require.NoError(t, q.Create("agent1"))
+		q.SendQ("agent1").Add(newEvent("1"))
+		q.SendQ("agent1").Add(newEvent("2"))
+		q.RecvQ("agent1").Add(newEvent("3"))
+		assert.Equal(t, 2, o.enqueued["agent1/send"])
+		assert.Equal(t, 1, o.enqueued["agent1/recv"])
+		assert.Equal(t, 2, o.depth["agent1/send"])
+
+		time.Sleep(10 * time.Millisecond)
+		ev, _ := q.SendQ("agent1").Get()
+		q.SendQ("agent1").Done(ev)
+		assert.Equal(t, 1, o.dequeued["agent1/send"])
+		assert.Equal(t, 1, o.depth["agent1/send"])
+		require.Len(t, o.waits, 1)
+		assert.GreaterOrEqual(t, o.waits[0], 10*time.Millisecond)
+
+		ev, _ = GetWithContext(q.RecvQ("agent1"), context.Background())
+		q.RecvQ("agent1").Done(ev)
+		assert.Equal(t, 1, o.dequeued["agent1/recv"])
+		assert.Equal(t, 0, o.depth["agent1/recv"])
+	})
+
+	t.Run("Evicted events are not observed as taken", func(t *testing.T) {
+		t.Setenv(config.EnvSendQueueSize, "1")
+		o := newFakeObserver()
+		q := NewSendRecvQueues(WithObserver(o))
+		require.NoError(t, q.Create("agent1"))
+		q.SendQ("agent1").Add(newEvent("1"))
+		q.SendQ("agent1").Add(newEvent("2"))
+		assert.Equal(t, 2, o.enqueued["agent1/send"])
+		assert.Equal(t, 0, o.dequeued["agent1/send"])
+		ev, _ := q.SendQ("agent1").Get()
+		assert.Equal(t, "2", ev.ID())
+		assert.Equal(t, 1, o.dequeued["agent1/send"])
+	})
+
+	t.Run("Deleting a queue pair is observed", func(t *testing.T) {
+		o := newFakeObserver()
+		q := NewSendRecvQueues(WithObserver(o))
+		require.NoError(t, q.Create("agent1"))
+		require.NoError(t, q.Delete("agent1", true))
+		assert.Equal(t, []string{"agent1"}, o.deleted)
+	})
+}
+
+func Test_Close(t *testing.T) {
+	newEvent := func(id string) *event.Event {
+		ev := event.New()
+		ev.SetID(id)
+		ev.SetSource("test")
+		ev.SetType("test")
+		return &ev
+	}
+
+	t.Run("Closed send queues do not accept new events", func(t *testing.T) {
+		q := NewSendRecvQueues()
+		require.NoError(t, q.Create("agent1"))
+		q.SendQ("agent1").Add(newEvent("1"))
+		q.Close()
+		q.SendQ("agent1").Add(newEvent("2"))
+		q.SendQ("agent1").AddAfter(newEvent("3"), time.Millisecond)
+		q.SendQ("agent1").AddRateLimited(newEvent("4"))
+		q.RecvQ("agent1").Add(newEvent("5"))
+		require.NoError(t, q.Create("agent2"))
+		q.SendQ("agent2").Add(newEvent("6"))
+
+		time.Sleep(10 * time.Millisecond)
+		assert.Equal(t, 1, q.SendQ("agent1").Len())
+		assert.Equal(t, 1, q.RecvQ("agent1").Len())
+		assert.Equal(t, 0, q.SendQ("agent2").Len())
+		ev, _ := q.SendQ("agent1").Get()
+		assert.Equal(t, "1", ev.ID())
+	})
+
+	t.Run("Events added to closed send queues are persisted", func(t *testing.T) {
+		dir := t.TempDir()
+		q := NewSendRecvQueues(WithStorageDir(dir))
+		require.NoError(t, q.Create("agent1"))
+		q.SendQ("agent1").Add(newEvent("1"))
+		q.Close()
+		q.SendQ("agent1").Add(newEvent("2"))
+		assert.Equal(t, 1, q.SendQ("agent1").Len())
+
+		restarted := NewSendRecvQueues(WithStorageDir(dir))
+		require.NoError(t, restarted.Create("agent1"))
+		sendq := restarted.SendQ("agent1")
+		require.Equal(t, 2, sendq.Len())
+		ev, _ := sendq.Get()
+		assert.Equal(t, "1", ev.ID())
+		ev, _ = sendq.Get()
+		assert.Equal(t, "2", ev.ID())
+	})
+}
+
+func Test_EventsAndPurge(t *testing.T) {
+	newEvent := func(id string, resourceID string) *event.Event {
+		ev := event.New()
+		ev.SetID(id)
+		ev.SetSource("test")
+		ev.SetType(agentevent.SpecUpdate.String())
+		ev.SetExtension("resourceid", resourceID)
+		return &ev
+	}
+	ids := func(events []QueuedEvent) []string {
+		var ids []string
+		for _, ev := range events {
+			ids = append(ids, ev.Event.ID())
+		}
+		return ids
+	}
+
+	t.Run("Events lists queued events in order", func(t *testing.T) {
+		q := NewSendRecvQueues()
+		require.NoError(t, q.Create("agent1"))
+		q.SendQ("agent1").Add(newEvent("1", "app-a"))
+		q.SendQ("agent1").Add(newEvent("2", "app-b"))
+		q.RecvQ("agent1").Add(newEvent("3", "app-c"))
+		ev, _ := q.SendQ("agent1").Get()
+		require.Equal(t, "1", ev.ID())
+
+		send, recv, err := q.Events("agent1")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"2"}, ids(send))
+		assert.Equal(t, []string{"3"}, ids(recv))
+		assert.False(t, send[0].Queued.IsZero())
+
+		_, _, err = q.Events("unknown")
+		assert.ErrorIs(t, err, ErrQueueNotFound)
+	})
+
+	t.Run("Purge drops queued events", func(t *testing.T) {
+		dir := t.TempDir()
+		q := NewSendRecvQueues(WithStorageDir(dir), WithUpdateCoalescing(true))
+		require.NoError(t, q.Create("agent1"))
+		sendq := q.SendQ("agent1")
+		sendq.Add(newEvent("1", "app-a"))
+		sendq.Add(newEvent("2", "app-b"))
+
+		n, err := q.Purge("agent1")
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+		assert.Equal(t, 0, sendq.Len())
+		send, _, _ := q.Events("agent1")
+		assert.Empty(t, send)
+
+		// An update for a purged event's resource is queued on its own
+		sendq.Add(newEvent("3", "app-a"))
+		require.Equal(t, 1, sendq.Len())
+		ev, _ := GetWithContext(sendq, context.Background())
+		assert.Equal(t, "3", ev.ID())
+		sendq.Done(ev)
+
+		// Purged events are removed from storage
+		restarted := NewSendRecvQueues(WithStorageDir(dir))
+		require.NoError(t, restarted.Create("agent1"))
+		assert.Equal(t, 0, restarted.SendQ("agent1").Len())
+	})
+}
+
+func Test_Pause(t *testing.T) {
+	newEvent := func(id string, resourceID string) *event.Event {
+		ev := event.New()
+		ev.SetID(id)
+		ev.SetSource("test")
+		ev.SetType(agentevent.SpecUpdate.String())
+		ev.SetExtension("resourceid", resourceID)
+		return &ev
+	}
+
+	q := NewSendRecvQueues(WithUpdateCoalescing(true))
+	require.NoError(t, q.Create("agent1"))
+	sendq := q.SendQ("agent1")
+
+	paused, err := q.Pause("agent1")
+	require.NoError(t, err)
+	assert.True(t, paused)
+	paused, err = q.Pause("agent1")
+	require.NoError(t, err)
+	assert.False(t, paused)
+	paused, err = q.Paused("agent1")
+	require.NoError(t, err)
+	assert.True(t, paused)
+
+	// Events are queued and coalesced, but not taken from the paused queue
+	sendq.Add(newEvent("1", "app-a"))
+	sendq.Add(newEvent("2", "app-a"))
+	assert.Equal(t, 1, sendq.Len())
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	ev, _ := GetWithContext(sendq, ctx)
+	assert.Nil(t, ev)
+
+	// Resuming wakes up waiting callers
+	got := make(chan *event.Event)
+	go func() {
+		ev, _ := GetWithContext(sendq, context.Background())
+		got <- ev
+	}()
+	resumed, err := q.Resume("agent1")
+	require.NoError(t, err)
+	assert.True(t, resumed)
+	select {
+	case ev := <-got:
+		require.NotNil(t, ev)
+		assert.Equal(t, "2", ev.ID())
+	case <-time.After(5 * time.Second):
+		t.Fatal("event was not taken from the resumed queue")
+	}
+
+	resumed, err = q.Resume("agent1")
+	require.NoError(t, err)
+	assert.False(t, resumed)
+	_, err = q.Pause("unknown")
+	assert.ErrorIs(t, err, ErrQueueNotFound)
+}
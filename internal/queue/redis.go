@@ -0,0 +1,242 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// redisConsumerGroup is the consumer group all principal replicas read
+	// the streams of the send queues with
+	redisConsumerGroup = "principal"
+	// redisReadCount is the maximum number of entries read from a stream
+	// at once
+	redisReadCount = 10
+	// redisReadTimeout is how long a read blocks waiting for new entries
+	redisReadTimeout = time.Second
+	// redisClaimIdleTime is how long an entry read by another replica must
+	// have been pending before it is taken over. The replica that read it
+	// most likely no longer serves the agent, or is gone.
+	redisClaimIdleTime = time.Minute
+	// redisRetryInterval is how long to wait before reading from Redis again
+	// after an error
+	redisRetryInterval = time.Second
+	// redisEventField is the field of a stream entry holding the event
+	redisEventField = "event"
+)
+
+// redisStream shares the items of a queue between principal replicas through
+// a Redis stream. Items added to the queue on any replica are appended to the
+// stream. The replica serving the agent reads them from the stream whenever it
+// takes an item from the empty queue, and acknowledges each entry once its
+// item has been processed. Entries that were read but never acknowledged are
+// read again after a restart, or are taken over by another replica.
+type redisStream struct {
+	client   redis.UniversalClient
+	key      string
+	consumer string
+	// maxLen is the approximate maximum length the stream is trimmed to
+	maxLen int64
+
+	lock sync.Mutex
+	// ids maps each item read from the stream to the ID of its entry
+	ids map[*event.Event]string
+	// inFlight holds the IDs of the entries read, but not acknowledged yet
+	inFlight map[string]bool
+	// ready is true once the consumer group of the stream exists
+	ready bool
+	// recoverFrom is the ID after which to read the entries that this
+	// consumer read, but did not acknowledge before a restart. It is empty
+	// once all of them have been read again.
+	recoverFrom string
+}
+
+func newRedisStream(client redis.UniversalClient, key, consumer string, maxLen int) *redisStream {
+	return &redisStream{
+		client:   client,
+		key:      key,
+		consumer: consumer,
+		maxLen:   int64(maxLen),
+		ids:      make(map[*event.Event]string),
+		inFlight: make(map[string]bool),
+		// ID 0 is before all entries
+		recoverFrom: "0",
+	}
+}
+
+// publish appends ev, which was queued at queued, to the stream.
+func (s *redisStream) publish(ctx context.Context, ev *event.Event, queued time.Time) error {
+	data, err := marshalQueued(ev, queued)
+	if err != nil {
+		return fmt.Errorf("could not marshal event: %w", err)
+	}
+	err = s.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: s.key,
+		MaxLen: s.maxLen,
+		Approx: true,
+		Values: map[string]interface{}{redisEventField: data},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("could not add event to stream %s: %w", s.key, err)
+	}
+	return nil
+}
+
+// read returns the next entries of the stream for this consumer. It blocks
+// for up to redisReadTimeout if there are no entries, in which case no
+// events and no error are returned.
+func (s *redisStream) read(ctx context.Context) ([]persistedEvent, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.ready {
+		err := s.client.XGroupCreateMkStream(ctx, s.key, redisConsumerGroup, "0").Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return nil, fmt.Errorf("could not create consumer group for stream %s: %w", s.key, err)
+		}
+		s.ready = true
+	}
+
+	if s.recoverFrom != "" {
+		// Reading from an ID other than ">" returns the entries that are
+		// pending for this consumer
+		messages, err := s.readGroup(ctx, s.recoverFrom, -1)
+		if err != nil || len(messages) > 0 {
+			if len(messages) > 0 {
+				s.recoverFrom = messages[len(messages)-1].ID
+			}
+			return s.decode(ctx, messages), err
+		}
+		s.recoverFrom = ""
+	}
+
+	messages, _, err := s.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   s.key,
+		Group:    redisConsumerGroup,
+		Consumer: s.consumer,
+		MinIdle:  redisClaimIdleTime,
+		Start:    "0-0",
+		Count:    redisReadCount,
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("could not claim entries of stream %s: %w", s.key, err)
+	}
+	if len(messages) > 0 {
+		log().WithField("stream", s.key).Infof("Took over %d events from another replica", len(messages))
+		return s.decode(ctx, messages), nil
+	}
+
+	// Don't hold the lock while blocking, so that processed items can be
+	// acknowledged in the meantime.
+	s.lock.Unlock()
+	messages, err = s.readGroup(ctx, ">", redisReadTimeout)
+	s.lock.Lock()
+	return s.decode(ctx, messages), err
+}
+
+// readGroup reads the entries after id from the stream. A negative block
+// duration makes the read return immediately.
+func (s *redisStream) readGroup(ctx context.Context, id string, block time.Duration) ([]redis.XMessage, error) {
+	streams, err := s.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    redisConsumerGroup,
+		Consumer: s.consumer,
+		Streams:  []string{s.key, id},
+		Count:    redisReadCount,
+		Block:    block,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read from stream %s: %w", s.key, err)
+	}
+	var messages []redis.XMessage
+	for _, stream := range streams {
+		messages = append(messages, stream.Messages...)
+	}
+	return messages, nil
+}
+
+// decode returns the events in messages, and records the ID of the entry of
+// each. Entries that cannot be decoded are removed from the stream. The caller
+// must hold s.lock.
+func (s *redisStream) decode(ctx context.Context, messages []redis.XMessage) []persistedEvent {
+	events := make([]persistedEvent, 0, len(messages))
+	for _, msg := range messages {
+		if s.inFlight[msg.ID] {
+			// An entry of this consumer that is still being processed
+			continue
+		}
+		data, _ := msg.Values[redisEventField].(string)
+		ev, queued, err := unmarshalQueued([]byte(data))
+		if err != nil {
+			log().WithError(err).WithField("stream", s.key).WithField("id", msg.ID).Warn("Discarding unreadable queued event")
+			s.remove(ctx, msg.ID)
+			continue
+		}
+		s.ids[ev] = msg.ID
+		s.inFlight[msg.ID] = true
+		events = append(events, persistedEvent{ev: ev, queued: queued})
+	}
+	return events
+}
+
+// ack acknowledges the entry of ev and removes it from the stream.
+func (s *redisStream) ack(ctx context.Context, ev *event.Event) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	id, ok := s.ids[ev]
+	if !ok {
+		return
+	}
+	delete(s.ids, ev)
+	delete(s.inFlight, id)
+	s.remove(ctx, id)
+}
+
+// remove acknowledges and deletes the entry id. The caller must hold s.lock.
+func (s *redisStream) remove(ctx context.Context, id string) {
+	pipe := s.client.TxPipeline()
+	pipe.XAck(ctx, s.key, redisConsumerGroup, id)
+	pipe.XDel(ctx, s.key, id)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log().WithError(err).WithField("stream", s.key).WithField("id", id).Warn("Could not remove event from stream")
+	}
+}
+
+// purge removes all entries from the stream, and returns their number.
+func (s *redisStream) purge(ctx context.Context) (int, error) {
+	n, err := s.client.XTrimMaxLen(ctx, s.key, 0).Result()
+	if err != nil {
+		return 0, fmt.Errorf("could not purge stream %s: %w", s.key, err)
+	}
+	return int(n), nil
+}
+
+// delete removes the stream.
+func (s *redisStream) delete(ctx context.Context) error {
+	if err := s.client.Del(ctx, s.key).Err(); err != nil {
+		return fmt.Errorf("could not delete stream %s: %w", s.key, err)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_RedisQueue(t *testing.T) {
+	newEvent := func(id string) *event.Event {
+		ev := event.New()
+		ev.SetID(id)
+		ev.SetType("test")
+		ev.SetSource("test")
+		return &ev
+	}
+	setup := func(t *testing.T) (*miniredis.Miniredis, *redis.Client, func(consumer string) *SendRecvQueues) {
+		t.Helper()
+		mr := miniredis.RunT(t)
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		t.Cleanup(func() { _ = client.Close() })
+		return mr, client, func(consumer string) *SendRecvQueues {
+			q := NewSendRecvQueues(WithRedis(client, "test", consumer))
+			require.NoError(t, q.Create("agent1"))
+			return q
+		}
+	}
+	get := func(t *testing.T, q *SendRecvQueues) *event.Event {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		ev, shutdown := GetWithContext(q.SendQ("agent1"), ctx)
+		require.False(t, shutdown)
+		require.NotNil(t, ev)
+		return ev
+	}
+
+	t.Run("Events added on one replica are taken on another", func(t *testing.T) {
+		_, client, newQueues := setup(t)
+		q1 := newQueues("replica1")
+		q2 := newQueues("replica2")
+		q1.SendQ("agent1").Add(newEvent("1"))
+		q1.SendQ("agent1").Add(newEvent("2"))
+		assert.Zero(t, q1.SendQ("agent1").Len())
+
+		ev := get(t, q2)
+		assert.Equal(t, "1", ev.ID())
+		q2.SendQ("agent1").Done(ev)
+		ev = get(t, q2)
+		assert.Equal(t, "2", ev.ID())
+		q2.SendQ("agent1").Done(ev)
+
+		n, err := client.XLen(context.Background(), "test:agent1:send").Result()
+		require.NoError(t, err)
+		assert.Zero(t, n)
+	})
+
+	t.Run("Unacknowledged events are read again after a restart", func(t *testing.T) {
+		_, _, newQueues := setup(t)
+		q := newQueues("replica1")
+		q.SendQ("agent1").Add(newEvent("1"))
+		assert.Equal(t, "1", get(t, q).ID())
+
+		q = newQueues("replica1")
+		assert.Equal(t, "1", get(t, q).ID())
+	})
+
+	t.Run("Requeued events are added to the stream again", func(t *testing.T) {
+		_, _, newQueues := setup(t)
+		q := newQueues("replica1")
+		q.SendQ("agent1").Add(newEvent("1"))
+		ev := get(t, q)
+		q.SendQ("agent1").AddAfter(ev, 0)
+		q.SendQ("agent1").Done(ev)
+		assert.Equal(t, "1", get(t, q).ID())
+	})
+
+	t.Run("Purge removes events from the stream", func(t *testing.T) {
+		_, client, newQueues := setup(t)
+		q := newQueues("replica1")
+		q.SendQ("agent1").Add(newEvent("1"))
+		q.SendQ("agent1").Add(newEvent("2"))
+		n, err := q.Purge("agent1")
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+		l, err := client.XLen(context.Background(), "test:agent1:send").Result()
+		require.NoError(t, err)
+		assert.Zero(t, l)
+	})
+
+	t.Run("Deleting a queue pair removes its stream", func(t *testing.T) {
+		mr, _, newQueues := setup(t)
+		q := newQueues("replica1")
+		q.SendQ("agent1").Add(newEvent("1"))
+		require.NoError(t, q.Delete("agent1", true))
+		assert.False(t, mr.Exists("test:agent1:send"))
+	})
+
+	t.Run("Receive queues are local", func(t *testing.T) {
+		mr, _, newQueues := setup(t)
+		q := newQueues("replica1")
+		q.RecvQ("agent1").Add(newEvent("1"))
+		assert.Equal(t, 1, q.RecvQ("agent1").Len())
+		assert.False(t, mr.Exists("test:agent1:recv"))
+	})
+
+	t.Run("Get returns once the context is done", func(t *testing.T) {
+		_, _, newQueues := setup(t)
+		q := newQueues("replica1")
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		ev, shutdown := GetWithContext(q.SendQ("agent1"), ctx)
+		assert.Nil(t, ev)
+		assert.False(t, shutdown)
+	})
+}
@@ -0,0 +1,60 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue
+
+import (
+	"sync"
+
+	agentevent "github.com/argoproj-labs/argocd-agent/internal/event"
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/google/uuid"
+)
+
+// sequencer stamps the events added to a send queue with monotonically
+// increasing sequence numbers, so that the receiver can detect lost events
+// and refuse to apply an event after a later one for the same resource.
+type sequencer struct {
+	lock  sync.Mutex
+	epoch string
+	next  uint64
+	// last maps each ordering key to the sequence number of the last event
+	// stamped for it
+	last map[string]uint64
+}
+
+func newSequencer() *sequencer {
+	return &sequencer{
+		epoch: uuid.NewString(),
+		next:  1,
+		last:  make(map[string]uint64),
+	}
+}
+
+// stamp assigns the next sequence number to ev.
+func (s *sequencer) stamp(ev *event.Event) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	seq := agentevent.Sequence{Epoch: s.epoch, Number: s.next}
+	s.next++
+	if key := agentevent.OrderingKey(ev); key != "" {
+		seq.Previous = s.last[key]
+		if ev.Type() == agentevent.Delete.String() {
+			delete(s.last, key)
+		} else {
+			s.last[key] = seq.Number
+		}
+	}
+	agentevent.SetSequence(ev, seq)
+}
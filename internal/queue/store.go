@@ -0,0 +1,193 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+)
+
+// eventStore persists the items of a single queue as files in a directory,
+// one file per event, so that they survive a restart. Files are named after
+// a sequence number, which preserves the order the events were queued in.
+type eventStore struct {
+	dir   string
+	seq   uint64
+	items map[*event.Event]*storedEvent
+	lock  sync.Mutex
+}
+
+// storedEvent tracks the file an event is persisted in.
+type storedEvent struct {
+	path string
+	// requeued is set when the event was added to the queue again while it
+	// was being processed, in which case its file must be kept when the
+	// processing is done.
+	requeued bool
+}
+
+const storedEventSuffix = ".json"
+
+// persistedEvent is an event read back from storage, along with the time it
+// was queued at. The time is zero if it was not recorded.
+type persistedEvent struct {
+	ev     *event.Event
+	queued time.Time
+}
+
+// newEventStore returns a store persisting events in dir, creating dir if it
+// does not exist yet.
+func newEventStore(dir string) (*eventStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("could not create queue storage directory: %w", err)
+	}
+	return &eventStore{
+		dir:   dir,
+		items: make(map[*event.Event]*storedEvent),
+	}, nil
+}
+
+// load reads all events persisted in the store, in the order they were
+// queued. Files that cannot be read or parsed are removed.
+func (s *eventStore) load() ([]persistedEvent, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read queue storage directory: %w", err)
+	}
+	type file struct {
+		seq  uint64
+		path string
+	}
+	files := make([]file, 0, len(entries))
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, storedEventSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, storedEventSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		files = append(files, file{seq: seq, path: filepath.Join(s.dir, name)})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].seq < files[j].seq })
+
+	events := make([]persistedEvent, 0, len(files))
+	for _, f := range files {
+		if f.seq >= s.seq {
+			s.seq = f.seq + 1
+		}
+		data, err := os.ReadFile(f.path)
+		if err == nil {
+			var ev *event.Event
+			var queued time.Time
+			if ev, queued, err = unmarshalQueued(data); err == nil {
+				s.items[ev] = &storedEvent{path: f.path}
+				events = append(events, persistedEvent{ev: ev, queued: queued})
+				continue
+			}
+		}
+		log().WithError(err).WithField("path", f.path).Warn("Discarding unreadable queued event")
+		_ = os.Remove(f.path)
+	}
+	return events, nil
+}
+
+// put persists ev, which was queued at queued, unless it is persisted
+// already. In the latter case, ev is marked as requeued.
+func (s *eventStore) put(ev *event.Event, queued time.Time) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if item, ok := s.items[ev]; ok {
+		item.requeued = true
+		return nil
+	}
+	data, err := marshalQueued(ev, queued)
+	if err != nil {
+		return fmt.Errorf("could not marshal event: %w", err)
+	}
+	path := filepath.Join(s.dir, fmt.Sprintf("%020d%s", s.seq, storedEventSuffix))
+	s.seq++
+	if err := writeFileAtomic(path, data); err != nil {
+		return err
+	}
+	s.items[ev] = &storedEvent{path: path}
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file first and then renames it
+// to path, so that a crash never leaves a partially written event behind.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("could not persist event: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("could not persist event: %w", err)
+	}
+	return nil
+}
+
+// update writes the current content of ev, which was last updated at
+// queued, to its file, if ev is persisted.
+func (s *eventStore) update(ev *event.Event, queued time.Time) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	item, ok := s.items[ev]
+	if !ok {
+		return nil
+	}
+	data, err := marshalQueued(ev, queued)
+	if err != nil {
+		return fmt.Errorf("could not marshal event: %w", err)
+	}
+	return writeFileAtomic(item.path, data)
+}
+
+// taken records that ev was taken from the queue for processing.
+func (s *eventStore) taken(ev *event.Event) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if item, ok := s.items[ev]; ok {
+		item.requeued = false
+	}
+}
+
+// done removes the persisted copy of ev, unless ev was requeued while it was
+// being processed.
+func (s *eventStore) done(ev *event.Event) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	item, ok := s.items[ev]
+	if !ok || item.requeued {
+		return nil
+	}
+	delete(s.items, ev)
+	if err := os.Remove(item.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("could not remove persisted event: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	agentevent "github.com/argoproj-labs/argocd-agent/internal/event"
+	"github.com/argoproj-labs/argocd-agent/internal/event/targets"
+	"github.com/cloudevents/sdk-go/v2/event"
+)
+
+// DefaultTTLKey is the key used in ParseTTLs to set the time-to-live of all
+// event types without a time-to-live of their own.
+const DefaultTTLKey = "default"
+
+// TTLs holds the time-to-live of queued events by event type. Events that
+// have been queued for longer than their time-to-live are dropped instead of
+// being taken from the queue.
+type TTLs struct {
+	// Default applies to all event types not in ByType
+	Default time.Duration
+	// ByType holds the time-to-live of specific event types, by the name of
+	// the type without the common prefix, e.g. status-update
+	ByType map[string]time.Duration
+}
+
+// ParseTTLs parses times-to-live of the form <type>=<duration>, where type is
+// the name of an event type without the common prefix, e.g. status-update, or
+// "default", and duration is a duration such as 10m. A duration of 0 means
+// events of the type never expire.
+func ParseTTLs(specs []string) (*TTLs, error) {
+	t := &TTLs{ByType: make(map[string]time.Duration)}
+	for _, spec := range specs {
+		name, value, ok := strings.Cut(spec, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid event TTL %q: must be of the form <type>=<duration>", spec)
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid event TTL %q: duration must not be negative", spec)
+		}
+		if name == DefaultTTLKey {
+			t.Default = d
+			continue
+		}
+		if !validTTLEventType(name) {
+			return nil, fmt.Errorf("invalid event TTL %q: unknown event type %s", spec, name)
+		}
+		t.ByType[name] = d
+	}
+	return t, nil
+}
+
+func validTTLEventType(name string) bool {
+	for _, typ := range agentevent.EventTypes() {
+		if typ.String() == targets.TypePrefix+"."+name {
+			return true
+		}
+	}
+	return false
+}
+
+// For returns the time-to-live of ev, or 0 if ev never expires.
+func (t *TTLs) For(ev *event.Event) time.Duration {
+	if t == nil {
+		return 0
+	}
+	if d, ok := t.ByType[strings.TrimPrefix(ev.Type(), targets.TypePrefix+".")]; ok {
+		return d
+	}
+	return t.Default
+}
+
+// queuedAtExtension is the extension that records when an event was queued in
+// the persisted form of queued events, so that its time-to-live does not
+// start over when it is read back from storage or from Redis.
+const queuedAtExtension = "queuedat"
+
+// marshalQueued returns the persisted form of ev, which was queued at queued.
+func marshalQueued(ev *event.Event, queued time.Time) ([]byte, error) {
+	stamped := ev.Clone()
+	stamped.SetExtension(queuedAtExtension, queued.UTC().Format(time.RFC3339Nano))
+	return json.Marshal(stamped)
+}
+
+// unmarshalQueued parses the persisted form of a queued event, and returns
+// the event and the time it was queued at. The time is zero if it was not
+// recorded.
+func unmarshalQueued(data []byte) (*event.Event, time.Time, error) {
+	ev := &event.Event{}
+	if err := json.Unmarshal(data, ev); err != nil {
+		return nil, time.Time{}, err
+	}
+	var queued time.Time
+	if val, ok := ev.Extensions()[queuedAtExtension].(string); ok {
+		queued, _ = time.Parse(time.RFC3339Nano, val)
+		ev.SetExtension(queuedAtExtension, nil)
+	}
+	return ev, queued, nil
+}
@@ -0,0 +1,51 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue
+
+import (
+	"testing"
+	"time"
+
+	agentevent "github.com/argoproj-labs/argocd-agent/internal/event"
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParseTTLs(t *testing.T) {
+	newEvent := func(evType agentevent.EventType) *event.Event {
+		ev := event.New()
+		ev.SetType(evType.String())
+		return &ev
+	}
+
+	t.Run("Valid TTLs", func(t *testing.T) {
+		ttls, err := ParseTTLs([]string{"default=1h", "status-update=10m", "create=0"})
+		require.NoError(t, err)
+		assert.Equal(t, 10*time.Minute, ttls.For(newEvent(agentevent.StatusUpdate)))
+		assert.Equal(t, time.Duration(0), ttls.For(newEvent(agentevent.Create)))
+		assert.Equal(t, time.Hour, ttls.For(newEvent(agentevent.SpecUpdate)))
+	})
+	t.Run("No TTLs", func(t *testing.T) {
+		var ttls *TTLs
+		assert.Equal(t, time.Duration(0), ttls.For(newEvent(agentevent.StatusUpdate)))
+	})
+	t.Run("Invalid TTLs", func(t *testing.T) {
+		for _, spec := range []string{"status-update", "=10m", "status-update=-1m", "status-update=soon", "status=10m", "unknown=10m"} {
+			_, err := ParseTTLs([]string{spec})
+			assert.Error(t, err, spec)
+		}
+	})
+}
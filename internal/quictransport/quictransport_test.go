@@ -0,0 +1,115 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quictransport
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/internal/connlimit"
+	"github.com/argoproj-labs/argocd-agent/test/fake/testcerts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+)
+
+func testTLSConfigs(t *testing.T) (server *tls.Config, client *tls.Config) {
+	t.Helper()
+	templ := testcerts.DefaultCertTempl
+	templ.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+	certPEM, keyPEM := testcerts.CreateSelfSignedCert(t, "rsa", templ)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	require.True(t, pool.AppendCertsFromPEM(certPEM))
+	return &tls.Config{Certificates: []tls.Certificate{cert}}, &tls.Config{RootCAs: pool}
+}
+
+func Test_GRPCOverQUIC(t *testing.T) {
+	serverTLS, clientTLS := testTLSConfigs(t)
+	ql, err := Listen("127.0.0.1:0", serverTLS)
+	require.NoError(t, err)
+	// Connections are wrapped by the principal's connection limiter
+	l := connlimit.NewLimiter(10, connlimit.PolicyReject, nil).Listener(ql)
+
+	var authInfo credentials.AuthInfo
+	gs := grpc.NewServer(
+		grpc.Creds(NewServerCredentials(credentials.NewTLS(serverTLS))),
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if p, ok := peer.FromContext(ctx); ok {
+				authInfo = p.AuthInfo
+			}
+			return handler(ctx, req)
+		}),
+	)
+	healthpb.RegisterHealthServer(gs, health.NewServer())
+	go func() { _ = gs.Serve(l) }()
+	defer gs.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///"+ql.Addr().String(),
+		grpc.WithTransportCredentials(NewClientCredentials()),
+		grpc.WithContextDialer(Dialer(clientTLS)),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+
+	// Authentication by client certificate relies on the TLS state
+	tlsInfo, ok := authInfo.(credentials.TLSInfo)
+	require.True(t, ok, "auth info is %T", authInfo)
+	assert.Equal(t, uint16(tls.VersionTLS13), tlsInfo.State.Version)
+	assert.Equal(t, ALPN, tlsInfo.State.NegotiatedProtocol)
+}
+
+func Test_Dial(t *testing.T) {
+	t.Run("Untrusted certificate", func(t *testing.T) {
+		serverTLS, _ := testTLSConfigs(t)
+		_, otherClientTLS := testTLSConfigs(t)
+		ql, err := Listen("127.0.0.1:0", serverTLS)
+		require.NoError(t, err)
+		defer ql.Close()
+		_, err = Dial(context.Background(), ql.Addr().String(), otherClientTLS)
+		assert.Error(t, err)
+	})
+	t.Run("Closed listener", func(t *testing.T) {
+		serverTLS, _ := testTLSConfigs(t)
+		ql, err := Listen("127.0.0.1:0", serverTLS)
+		require.NoError(t, err)
+		require.NoError(t, ql.Close())
+		_, err = ql.Accept()
+		assert.ErrorIs(t, err, net.ErrClosed)
+	})
+}
+
+func Test_clientCredentials(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	_, _, err := NewClientCredentials().ClientHandshake(context.Background(), "localhost", c1)
+	assert.Error(t, err)
+}
@@ -0,0 +1,91 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resync
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/argoproj-labs/argocd-agent/internal/event"
+)
+
+// SendStateDigest sends a state digest with the spec checksums of all the
+// resources known to this peer to the source of truth. Resources that cannot
+// be read are left out of the digest, so the source will send them again.
+func (r *RequestHandler) SendStateDigest(ctx context.Context) error {
+	digest := &event.StateDigest{Resources: []event.RequestUpdate{}}
+	if r.resources != nil {
+		for _, resource := range r.resources.GetAll() {
+			if _, err := getGroupVersionResource(resource.Kind); err != nil {
+				continue
+			}
+			reqUpdate, err := r.requestUpdateFor(ctx, resource)
+			if err != nil {
+				logCtxForResourceKey(r.log, resource).WithError(err).Warn("Leaving resource out of the state digest")
+				continue
+			}
+			if reqUpdate != nil {
+				digest.Resources = append(digest.Resources, *reqUpdate)
+			}
+		}
+	}
+
+	ev, err := r.events.StateDigestEvent(digest)
+	if err != nil {
+		return fmt.Errorf("failed to create state digest event: %w", err)
+	}
+
+	r.sendQ.Add(ev)
+	r.log.WithField("resources", len(digest.Resources)).Debug("Sent a state digest")
+	return nil
+}
+
+// ProcessStateDigest compares the state digest of a peer with the local
+// resources. It sends an update for every resource whose checksum does not
+// match the local copy, and for every local resource missing from the digest,
+// and a delete for every resource in the digest that does not exist locally.
+// Resources that are in sync are not sent.
+func (r *RequestHandler) ProcessStateDigest(ctx context.Context, agentName string, digest *event.StateDigest) error {
+	r.log.WithField("resources", len(digest.Resources)).Trace("Received a state digest")
+
+	seen := make(map[string]bool, len(digest.Resources))
+	for i := range digest.Resources {
+		reqUpdate := &digest.Resources[i]
+		seen[reqUpdate.UID] = true
+		if err := r.ProcessRequestUpdateEvent(ctx, agentName, reqUpdate); err != nil {
+			logCtxForRequestUpdate(r.log, reqUpdate).WithError(err).Error("Failed to process state digest entry")
+		}
+	}
+
+	if r.resources == nil {
+		return nil
+	}
+
+	for _, resource := range r.resources.GetAll() {
+		if seen[resource.UID] {
+			continue
+		}
+		if _, err := getGroupVersionResource(resource.Kind); err != nil {
+			continue
+		}
+		// Without a checksum, the local copy is always sent
+		reqUpdate := event.NewRequestUpdate(resource.Name, resource.Namespace, resource.Kind, resource.UID, nil)
+		if err := r.ProcessRequestUpdateEvent(ctx, agentName, reqUpdate); err != nil {
+			logCtxForResourceKey(r.log, resource).WithError(err).Error("Failed to send resource missing from the state digest")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resync
+
+import (
+	"context"
+	"testing"
+
+	"github.com/argoproj-labs/argocd-agent/internal/event"
+	"github.com/argoproj-labs/argocd-agent/internal/manager"
+	"github.com/argoproj-labs/argocd-agent/internal/resources"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_SendStateDigest(t *testing.T) {
+	ctx := context.Background()
+	handler := createFakeHandler(t)
+
+	resource := fakeUnresApp()
+	resource.SetAnnotations(map[string]string{
+		manager.SourceUIDAnnotation: "source-uid",
+	})
+	gvr, err := getGroupVersionResource("Application")
+	require.NoError(t, err)
+	_, err = handler.dynClient.Resource(gvr).Namespace("default").Create(ctx, resource, v1.CreateOptions{})
+	require.NoError(t, err)
+
+	handler.resources.Add(resources.ResourceKey{Name: "test-app", Namespace: "default", Kind: "Application", UID: "test-uid"})
+	handler.resources.Add(resources.ResourceKey{Name: "deleted-app", Namespace: "default", Kind: "Application", UID: "deleted-uid"})
+
+	err = handler.SendStateDigest(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, handler.sendQ.Len())
+
+	ev, shutdown := handler.sendQ.Get()
+	require.False(t, shutdown)
+	assert.Equal(t, event.StateDigestExchange.String(), ev.Type())
+
+	digest, err := event.New(ev, event.Target(ev)).StateDigest()
+	require.NoError(t, err)
+	require.Len(t, digest.Resources, 1)
+	checksum, err := generateSpecChecksum(resource)
+	require.NoError(t, err)
+	assert.Equal(t, "test-app", digest.Resources[0].Name)
+	assert.Equal(t, "source-uid", digest.Resources[0].UID)
+	assert.Equal(t, checksum, digest.Resources[0].Checksum)
+}
+
+func Test_ProcessStateDigest(t *testing.T) {
+	ctx := context.Background()
+	handler := createFakeHandler(t)
+	handler.namespace = "default"
+
+	gvr, err := getGroupVersionResource("Application")
+	require.NoError(t, err)
+	inSync := fakeUnresApp()
+	_, err = handler.dynClient.Resource(gvr).Namespace("default").Create(ctx, inSync, v1.CreateOptions{})
+	require.NoError(t, err)
+	missing := fakeUnresApp()
+	missing.SetName("missing-app")
+	missing.SetUID("missing-uid")
+	_, err = handler.dynClient.Resource(gvr).Namespace("default").Create(ctx, missing, v1.CreateOptions{})
+	require.NoError(t, err)
+
+	handler.resources.Add(resources.ResourceKey{Name: "test-app", Namespace: "default", Kind: "Application", UID: "test-uid"})
+	handler.resources.Add(resources.ResourceKey{Name: "missing-app", Namespace: "default", Kind: "Application", UID: "missing-uid"})
+
+	checksum, err := generateSpecChecksum(inSync)
+	require.NoError(t, err)
+	digest := &event.StateDigest{Resources: []event.RequestUpdate{
+		{Name: "test-app", Namespace: "default", Kind: "Application", UID: "test-uid", Checksum: checksum},
+		{Name: "orphaned-app", Namespace: "default", Kind: "Application", UID: "orphaned-uid", Checksum: checksum},
+	}}
+
+	err = handler.ProcessStateDigest(ctx, testAgentName, digest)
+	require.NoError(t, err)
+
+	// Only the orphaned and the missing resource are sent
+	require.Equal(t, 2, handler.sendQ.Len())
+	sent := map[string]string{}
+	for handler.sendQ.Len() > 0 {
+		ev, shutdown := handler.sendQ.Get()
+		require.False(t, shutdown)
+		handler.sendQ.Done(ev)
+		app, err := event.New(ev, event.Target(ev)).Application()
+		require.NoError(t, err)
+		sent[app.Name] = ev.Type()
+	}
+	assert.Equal(t, map[string]string{
+		"orphaned-app": event.Delete.String(),
+		"missing-app":  event.SpecUpdate.String(),
+	}, sent)
+}
@@ -26,6 +26,7 @@ import (
 	"github.com/argoproj-labs/argocd-agent/internal/logging/logfields"
 	"github.com/argoproj-labs/argocd-agent/internal/manager"
 	"github.com/argoproj-labs/argocd-agent/internal/manager/appproject"
+	"github.com/argoproj-labs/argocd-agent/internal/manager/repository"
 	"github.com/argoproj-labs/argocd-agent/internal/resources"
 	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
 	cloudevent "github.com/cloudevents/sdk-go/v2/event"
@@ -34,6 +35,8 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	ktypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/dynamic"
@@ -78,6 +81,24 @@ type RequestHandler struct {
 	// is installed. Used with destinationBasedMapping to remap namespaces
 	// during resync lookups when agent and principal are in different namespaces.
 	peerNamespace string
+
+	// appNamespace returns the local namespace of the Application name of
+	// the peer. If nil, Applications are looked up in the peer's namespace.
+	appNamespace func(name string) string
+
+	// appSelector is the label selector Applications must match to be
+	// propagated to the peer. If nil, all Applications are propagated.
+	appSelector labels.Selector
+
+	// appTransform is applied to Applications before they are sent to the
+	// peer in SpecUpdate events. If nil, they are sent as they are.
+	appTransform func(app *v1alpha1.Application) *v1alpha1.Application
+
+	// repoExcludedFields are the data fields stripped from repository
+	// secrets, and repoCipher encrypts the credentials in repository secrets
+	// sent to the peer, if not nil
+	repoExcludedFields []string
+	repoCipher         *repository.FieldCipher
 }
 
 func NewRequestHandler(dynClient dynamic.Interface, queue workqueue.TypedRateLimitingInterface[*cloudevent.Event], events *event.EventSource, resources *resources.Resources, log *logrus.Entry, role manager.ManagerRole, namespace string) *RequestHandler {
@@ -120,6 +141,39 @@ func (r *RequestHandler) WithIgnoreUnmanagedApps(enabled bool) *RequestHandler {
 	return r
 }
 
+// WithRepositorySync sets the data fields stripped from repository secrets
+// before they are compared with or sent to the peer, and the cipher their
+// credentials are encrypted with before they are sent. c may be nil.
+func (r *RequestHandler) WithRepositorySync(excludedFields []string, c *repository.FieldCipher) *RequestHandler {
+	r.repoExcludedFields = excludedFields
+	r.repoCipher = c
+	return r
+}
+
+// WithApplicationNamespaces sets the function returning the local namespace
+// of an Application of the peer by its name, for agents that place
+// Applications in several namespaces. f may be nil.
+func (r *RequestHandler) WithApplicationNamespaces(f func(name string) string) *RequestHandler {
+	r.appNamespace = f
+	return r
+}
+
+// WithApplicationSelector sets the label selector Applications must match to
+// be propagated to the peer. Applications that do not match it are treated
+// as if they did not exist.
+func (r *RequestHandler) WithApplicationSelector(sel labels.Selector) *RequestHandler {
+	r.appSelector = sel
+	return r
+}
+
+// WithApplicationTransform sets the function applied to Applications before
+// they are sent to the peer in SpecUpdate events, e.g. to set the finalizers
+// the peer expects. f may be nil.
+func (r *RequestHandler) WithApplicationTransform(f func(app *v1alpha1.Application) *v1alpha1.Application) *RequestHandler {
+	r.appTransform = f
+	return r
+}
+
 func (r *RequestHandler) ProcessSyncedResourceListRequest(agentName string, req *event.RequestSyncedResourceList) error {
 	r.log.Trace("Received a request for synced resource list event")
 
@@ -187,6 +241,8 @@ func (r *RequestHandler) ProcessIncomingSyncedResource(ctx context.Context, inco
 			if incoming.Namespace == r.peerNamespace {
 				lookupNamespace = r.namespace
 			}
+		} else if r.appNamespace != nil {
+			lookupNamespace = r.appNamespace(incoming.Name)
 		}
 	}
 
@@ -201,7 +257,7 @@ func (r *RequestHandler) ProcessIncomingSyncedResource(ctx context.Context, inco
 		// The incoming app is not found locally
 		reqUpdate = event.NewRequestUpdate(incoming.Name, incoming.Namespace, incoming.Kind, "", nil)
 	} else {
-		reqUpdate, err = newRequestUpdateFromObject(res, incoming.Kind, r.peerNamespace)
+		reqUpdate, err = newRequestUpdateFromObject(res, incoming.Kind, r.peerNamespace, r.agentIsSource(true))
 		if err != nil {
 			if errors.Is(err, ErrSourceUIDNotFound) && r.ignoreUnmanagedApps {
 				logCtx.WithField(logfields.Name, res.GetName()).Debug("skipping resource without source UID annotation")
@@ -250,34 +306,45 @@ func (r *RequestHandler) SendRequestUpdates(ctx context.Context) {
 }
 
 func (r *RequestHandler) sendRequestUpdate(ctx context.Context, resource resources.ResourceKey) error {
+	logCtx := logCtxForResourceKey(r.log, resource)
+	reqUpdate, err := r.requestUpdateFor(ctx, resource)
+	if err != nil || reqUpdate == nil {
+		return err
+	}
+
+	ev, err := r.events.RequestUpdateEvent(reqUpdate)
+	if err != nil {
+		return fmt.Errorf("failed to create request update event: %w", err)
+	}
+
+	r.sendQ.Add(ev)
+	logCtx.Trace("Sent a request update event")
+	return nil
+}
+
+// requestUpdateFor returns the request update for the local copy of resource.
+// It returns nil if the resource is not managed by the agent and unmanaged
+// resources are ignored.
+func (r *RequestHandler) requestUpdateFor(ctx context.Context, resource resources.ResourceKey) (*event.RequestUpdate, error) {
 	gvr, err := getGroupVersionResource(resource.Kind)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	resClient := r.dynClient.Resource(gvr)
 	res, err := resClient.Namespace(resource.Namespace).Get(ctx, resource.Name, v1.GetOptions{})
 	if err != nil {
-		return fmt.Errorf("failed to get resource: %w", err)
+		return nil, fmt.Errorf("failed to get resource: %w", err)
 	}
-	logCtx := logCtxForResourceKey(r.log, resource)
-	reqUpdate, err := newRequestUpdateFromObject(res, resource.Kind, r.peerNamespace)
+	reqUpdate, err := newRequestUpdateFromObject(res, resource.Kind, r.peerNamespace, r.agentIsSource(true))
 	if err != nil {
 		if errors.Is(err, ErrSourceUIDNotFound) && r.ignoreUnmanagedApps {
-			logCtx.Debug("skipping resource without source UID annotation")
-			return nil
+			logCtxForResourceKey(r.log, resource).Debug("skipping resource without source UID annotation")
+			return nil, nil
 		}
-		return fmt.Errorf("failed to construct a request update from resource %s: %w", resource.Name, err)
+		return nil, fmt.Errorf("failed to construct a request update from resource %s: %w", resource.Name, err)
 	}
-
-	ev, err := r.events.RequestUpdateEvent(reqUpdate)
-	if err != nil {
-		return fmt.Errorf("failed to create request update event: %w", err)
-	}
-
-	r.sendQ.Add(ev)
-	logCtx.Trace("Sent a request update event")
-	return nil
+	return reqUpdate, nil
 }
 
 func (r *RequestHandler) ProcessRequestUpdateEvent(ctx context.Context, agentName string, reqUpdate *event.RequestUpdate) error {
@@ -329,6 +396,11 @@ func (r *RequestHandler) ProcessRequestUpdateEvent(ctx context.Context, agentNam
 		return r.handleDeletedResource(logCtx, reqUpdate)
 	}
 
+	if reqUpdate.Kind == "Application" && r.appSelector != nil && !r.appSelector.Matches(labels.Set(res.GetLabels())) {
+		logCtx.Trace("Application does not match the selector of the peer")
+		return r.handleDeletedResource(logCtx, reqUpdate)
+	}
+
 	// If the resource is AppProject/Repository, we need to ensure that it is still relevant with the current AppProject rules.
 	if r.role == manager.ManagerRolePrincipal && (reqUpdate.Kind == "AppProject" || reqUpdate.Kind == "Repository") {
 		err, isRelevant := r.isAppProjectRelevant(ctx, logCtx, agentName, reqUpdate, res)
@@ -342,8 +414,22 @@ func (r *RequestHandler) ProcessRequestUpdateEvent(ctx context.Context, agentNam
 		}
 	}
 
+	// The peer never receives the fields stripped from repository secrets
+	if reqUpdate.Kind == "Repository" {
+		for _, f := range r.repoExcludedFields {
+			unstructured.RemoveNestedField(res.Object, "data", f)
+		}
+	}
+
+	// The peer never receives the info entries stripped from Applications
+	if reqUpdate.Kind == "Application" && r.events != nil {
+		if err := stripInfo(res, r.events.ApplicationFilter()); err != nil {
+			return err
+		}
+	}
+
 	// The resource exists on the source. Compare the checksum and check if we need to send a SpecUpdate event.
-	checksum, err := generateSpecChecksum(res)
+	checksum, err := generateChecksum(res, r.agentIsSource(false))
 	if err != nil {
 		return fmt.Errorf("failed to generate checksum for resource %s/%s: %w", res.GetKind(), res.GetName(), err)
 	}
@@ -373,6 +459,9 @@ func (r *RequestHandler) handleUpdatedResource(logCtx *logrus.Entry, reqUpdate *
 			return err
 		}
 
+		if r.appTransform != nil {
+			app = r.appTransform(app)
+		}
 		ev := r.events.ApplicationEvent(event.SpecUpdate, app)
 		r.stampPrincipalUID(ev)
 		logCtx.Trace("Sending a request to update the application")
@@ -390,6 +479,20 @@ func (r *RequestHandler) handleUpdatedResource(logCtx *logrus.Entry, reqUpdate *
 		logCtx.Trace("Sending a request to update the appProject")
 		r.sendQ.Add(ev)
 
+	case "Repository":
+		repo := &corev1.Secret{}
+		err := json.Unmarshal(resBytes, repo)
+		if err != nil {
+			return err
+		}
+
+		ev, err := r.repositoryEvent(event.SpecUpdate, repo)
+		if err != nil {
+			return err
+		}
+		logCtx.Trace("Sending a request to update the repository")
+		r.sendQ.Add(ev)
+
 	case "GPGKey":
 		cm := &corev1.ConfigMap{}
 		err := json.Unmarshal(resBytes, cm)
@@ -407,6 +510,20 @@ func (r *RequestHandler) handleUpdatedResource(logCtx *logrus.Entry, reqUpdate *
 	return nil
 }
 
+// repositoryEvent returns an event of type evType for repo as it is sent to
+// the peer, i.e. without the excluded fields and with its credentials
+// encrypted if configured
+func (r *RequestHandler) repositoryEvent(evType event.EventType, repo *corev1.Secret) (*cloudevent.Event, error) {
+	out := repository.FilterFields(repo, r.repoExcludedFields)
+	if r.repoCipher != nil {
+		var err error
+		if out, err = r.repoCipher.Encrypt(out); err != nil {
+			return nil, fmt.Errorf("could not encrypt repository %s: %w", repo.Name, err)
+		}
+	}
+	return r.events.RepositoryEvent(evType, out), nil
+}
+
 func (r *RequestHandler) stampPrincipalUID(ev *cloudevent.Event) {
 	if r.principalUID != "" {
 		event.SetPrincipalUID(ev, r.principalUID)
@@ -483,7 +600,10 @@ func (r *RequestHandler) isAppProjectRelevant(ctx context.Context, logCtx *logru
 		}
 
 		// The Repository is no longer relevant to the agent. Send a delete event to remove the orphaned resource from the peer.
-		ev := r.events.RepositoryEvent(event.Delete, repository)
+		ev, err := r.repositoryEvent(event.Delete, repository)
+		if err != nil {
+			return err, false
+		}
 		logCtx.Trace("Sending a request to delete the orphaned repository")
 		r.sendQ.Add(ev)
 		return nil, false
@@ -540,7 +660,29 @@ func (r *RequestHandler) handleDeletedResource(logCtx *logrus.Entry, reqUpdate *
 	}
 }
 
-func newRequestUpdateFromObject(res *unstructured.Unstructured, kind string, peerNamespace string) (*event.RequestUpdate, error) {
+// stripInfo removes the info entries stripped by f from the Application res
+func stripInfo(res *unstructured.Unstructured, f *event.ApplicationFilter) error {
+	info, found, err := unstructured.NestedSlice(res.Object, "spec", "info")
+	if err != nil || !found {
+		return err
+	}
+	kept := info[:0]
+	for _, i := range info {
+		if m, ok := i.(map[string]interface{}); ok {
+			if name, _ := m["name"].(string); f.StripsInfo(name) {
+				continue
+			}
+		}
+		kept = append(kept, i)
+	}
+	if len(kept) == 0 {
+		unstructured.RemoveNestedField(res.Object, "spec", "info")
+		return nil
+	}
+	return unstructured.SetNestedSlice(res.Object, kept, "spec", "info")
+}
+
+func newRequestUpdateFromObject(res *unstructured.Unstructured, kind string, peerNamespace string, withHistory bool) (*event.RequestUpdate, error) {
 	// RequestUpdate is always sent by the peer. So, the object must have the source UID annotation
 	annotations := res.GetAnnotations()
 	sourceUID, ok := annotations[manager.SourceUIDAnnotation]
@@ -548,7 +690,7 @@ func newRequestUpdateFromObject(res *unstructured.Unstructured, kind string, pee
 		return nil, ErrSourceUIDNotFound
 	}
 
-	checksum, err := generateSpecChecksum(res)
+	checksum, err := generateChecksum(res, withHistory)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate checksum for resource %s/%s: %w", res.GetKind(), res.GetName(), err)
 	}
@@ -596,6 +738,47 @@ func getGroupVersionResource(kind string) (schema.GroupVersionResource, error) {
 	}
 }
 
+// agentIsSource returns whether the agent is the source of truth for the
+// Applications compared by this handler, i.e. whether it operates in
+// autonomous mode. Update requests are always sent by the peer of the source,
+// so this is the case when the principal requests an update, or the agent
+// processes a request.
+func (r *RequestHandler) agentIsSource(requesting bool) bool {
+	return r.role.IsPrincipal() == requesting
+}
+
+// generateChecksum returns the checksum of res that is compared during
+// resync. If withHistory is true, the checksum of an Application covers its
+// operation history, i.e. status.history and status.operationState, as well.
+// This makes syncs an autonomous agent performed while it was disconnected
+// reach the principal, even if the spec did not change. The checksum of an
+// Application without operation history is its spec checksum either way.
+func generateChecksum(res *unstructured.Unstructured, withHistory bool) ([]byte, error) {
+	checksum, err := generateSpecChecksum(res)
+	if err != nil || !withHistory || res.GetKind() != "Application" {
+		return checksum, err
+	}
+
+	// The fields are compared as known to this version of the Application
+	// type, so that fields only one side knows of do not cause a mismatch
+	app := &v1alpha1.Application{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(res.Object, app); err != nil {
+		return nil, fmt.Errorf("failed to convert application %s: %w", res.GetName(), err)
+	}
+	if len(app.Status.History) == 0 && app.Status.OperationState == nil {
+		return checksum, nil
+	}
+	historyBytes, err := json.Marshal([]interface{}{app.Status.History, app.Status.OperationState})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal operation history: %w", err)
+	}
+
+	h := sha256.New()
+	h.Write(checksum)
+	h.Write(historyBytes)
+	return h.Sum(nil), nil
+}
+
 func generateSpecChecksum(resObj *unstructured.Unstructured) ([]byte, error) {
 	res := resObj.DeepCopy()
 
@@ -16,13 +16,17 @@ package resync
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
 	"testing"
 
 	"github.com/argoproj-labs/argocd-agent/internal/event"
+	"github.com/argoproj-labs/argocd-agent/internal/event/targets"
 	"github.com/argoproj-labs/argocd-agent/internal/manager"
+	"github.com/argoproj-labs/argocd-agent/internal/manager/repository"
 	"github.com/argoproj-labs/argocd-agent/internal/queue"
 	"github.com/argoproj-labs/argocd-agent/internal/resources"
+	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -304,7 +308,7 @@ func Test_newRequestUpdateFromObject(t *testing.T) {
 	t.Run("return ErrSourceUIDNotFound when annotation missing", func(t *testing.T) {
 		resource := fakeUnresApp()
 
-		_, err := newRequestUpdateFromObject(resource, "Application", "argocd")
+		_, err := newRequestUpdateFromObject(resource, "Application", "argocd", false)
 		assert.ErrorIs(t, err, ErrSourceUIDNotFound)
 	})
 
@@ -312,7 +316,7 @@ func Test_newRequestUpdateFromObject(t *testing.T) {
 		resource := fakeUnresApp()
 		resource.SetAnnotations(nil)
 
-		_, err := newRequestUpdateFromObject(resource, "Application", "argocd")
+		_, err := newRequestUpdateFromObject(resource, "Application", "argocd", false)
 		assert.ErrorIs(t, err, ErrSourceUIDNotFound)
 	})
 
@@ -322,7 +326,7 @@ func Test_newRequestUpdateFromObject(t *testing.T) {
 			manager.SourceUIDAnnotation: "source-uid-123",
 		})
 
-		reqUpdate, err := newRequestUpdateFromObject(resource, "Application", "argocd")
+		reqUpdate, err := newRequestUpdateFromObject(resource, "Application", "argocd", false)
 		assert.Nil(t, err)
 		assert.NotNil(t, reqUpdate)
 		assert.Equal(t, "test-app", reqUpdate.Name)
@@ -340,7 +344,7 @@ func Test_newRequestUpdateFromObject(t *testing.T) {
 			manager.NamespaceRemappedAnnotation: "true",
 		})
 
-		reqUpdate, err := newRequestUpdateFromObject(resource, "Application", "")
+		reqUpdate, err := newRequestUpdateFromObject(resource, "Application", "", false)
 		assert.NotNil(t, err)
 		assert.Nil(t, reqUpdate)
 		assert.Contains(t, err.Error(), "peer namespace is not set, cannot remap application test-app")
@@ -354,7 +358,7 @@ func Test_newRequestUpdateFromObject(t *testing.T) {
 			manager.NamespaceRemappedAnnotation: "true",
 		})
 
-		reqUpdate, err := newRequestUpdateFromObject(resource, "Application", "argocd")
+		reqUpdate, err := newRequestUpdateFromObject(resource, "Application", "argocd", false)
 		assert.Nil(t, err)
 		assert.NotNil(t, reqUpdate)
 		assert.Equal(t, "argocd", reqUpdate.Namespace, "should remap to peerNamespace")
@@ -368,7 +372,7 @@ func Test_newRequestUpdateFromObject(t *testing.T) {
 			manager.NamespaceRemappedAnnotation: "true",
 		})
 
-		reqUpdate, err := newRequestUpdateFromObject(resource, "AppProject", "argocd")
+		reqUpdate, err := newRequestUpdateFromObject(resource, "AppProject", "argocd", false)
 		assert.Nil(t, err)
 		assert.NotNil(t, reqUpdate)
 		assert.Equal(t, "argocd-agent", reqUpdate.Namespace, "non-Application kinds should not be remapped")
@@ -620,6 +624,100 @@ func Test_ProcessRequestUpdateEvent(t *testing.T) {
 		err = handler.dynClient.Resource(gvr).Namespace("default").Delete(ctx, resource.GetName(), v1.DeleteOptions{})
 		assert.Nil(t, err)
 	})
+
+	t.Run("send spec update event if only the operation history does not match", func(t *testing.T) {
+		resource := fakeUnresAppWithHistory()
+
+		gvr, err := getGroupVersionResource("Application")
+		assert.Nil(t, err)
+
+		_, err = handler.dynClient.Resource(gvr).Namespace("default").Create(ctx, resource, v1.CreateOptions{})
+		assert.Nil(t, err)
+
+		specChecksum, err := generateSpecChecksum(resource)
+		assert.Nil(t, err)
+
+		reqUpdate := &event.RequestUpdate{
+			Name:      "test-app",
+			Namespace: "default",
+			Kind:      "Application",
+			Checksum:  specChecksum,
+		}
+
+		err = handler.ProcessRequestUpdateEvent(ctx, testAgentName, reqUpdate)
+		assert.Nil(t, err)
+
+		assert.Equal(t, 1, handler.sendQ.Len())
+		ev, shutdown := handler.sendQ.Get()
+		assert.False(t, shutdown)
+		assert.Equal(t, event.SpecUpdate.String(), ev.Type())
+		handler.sendQ.Done(ev)
+
+		// The principal requesting the update with the operation history it
+		// knows is up to date
+		checksum, err := generateChecksum(resource, true)
+		assert.Nil(t, err)
+		reqUpdate.Checksum = checksum
+		err = handler.ProcessRequestUpdateEvent(ctx, testAgentName, reqUpdate)
+		assert.Nil(t, err)
+		assert.Zero(t, handler.sendQ.Len())
+
+		err = handler.dynClient.Resource(gvr).Namespace("default").Delete(ctx, resource.GetName(), v1.DeleteOptions{})
+		assert.Nil(t, err)
+	})
+}
+
+func Test_generateChecksum(t *testing.T) {
+	t.Run("Operation history is only compared if requested", func(t *testing.T) {
+		resource := fakeUnresAppWithHistory()
+		specChecksum, err := generateSpecChecksum(resource)
+		require.NoError(t, err)
+
+		checksum, err := generateChecksum(resource, false)
+		require.NoError(t, err)
+		assert.Equal(t, specChecksum, checksum)
+
+		checksum, err = generateChecksum(resource, true)
+		require.NoError(t, err)
+		assert.NotEqual(t, specChecksum, checksum)
+	})
+
+	t.Run("Application without operation history has its spec checksum", func(t *testing.T) {
+		resource := fakeUnresApp()
+		specChecksum, err := generateSpecChecksum(resource)
+		require.NoError(t, err)
+		checksum, err := generateChecksum(resource, true)
+		require.NoError(t, err)
+		assert.Equal(t, specChecksum, checksum)
+	})
+
+	t.Run("New sync changes the checksum", func(t *testing.T) {
+		resource := fakeUnresAppWithHistory()
+		before, err := generateChecksum(resource, true)
+		require.NoError(t, err)
+
+		history, _, _ := unstructured.NestedSlice(resource.Object, "status", "history")
+		history = append(history, map[string]interface{}{
+			"id":         int64(2),
+			"revision":   "def456",
+			"deployedAt": "2025-05-01T13:00:00Z",
+		})
+		require.NoError(t, unstructured.SetNestedSlice(resource.Object, history, "status", "history"))
+		after, err := generateChecksum(resource, true)
+		require.NoError(t, err)
+		assert.NotEqual(t, before, after)
+	})
+
+	t.Run("Fields unknown to the Application type are not compared", func(t *testing.T) {
+		resource := fakeUnresAppWithHistory()
+		before, err := generateChecksum(resource, true)
+		require.NoError(t, err)
+
+		require.NoError(t, unstructured.SetNestedField(resource.Object, "value", "status", "operationState", "unknownField"))
+		after, err := generateChecksum(resource, true)
+		require.NoError(t, err)
+		assert.Equal(t, before, after)
+	})
 }
 
 func Test_generateSpecChecksum_ConfigMap(t *testing.T) {
@@ -764,6 +862,110 @@ func Test_ProcessRequestUpdateEvent_GPGKey(t *testing.T) {
 	})
 }
 
+func Test_ProcessRequestUpdateEvent_Repository(t *testing.T) {
+	ctx := context.Background()
+	gvr, err := getGroupVersionResource("Repository")
+	require.NoError(t, err)
+	cipher, err := repository.NewFieldCipher([]byte("a shared key"))
+	require.NoError(t, err)
+
+	newHandler := func(t *testing.T) *RequestHandler {
+		handler := createFakeHandler(t).WithRepositorySync([]string{"githubAppPrivateKey"}, cipher)
+		_, err := handler.dynClient.Resource(gvr).Namespace("argocd").Create(ctx, fakeUnresRepository(), v1.CreateOptions{})
+		require.NoError(t, err)
+		return handler
+	}
+
+	t.Run("excluded fields are ignored when comparing checksums", func(t *testing.T) {
+		handler := newHandler(t)
+		peer := fakeUnresRepository()
+		unstructured.RemoveNestedField(peer.Object, "data", "githubAppPrivateKey")
+		checksum, err := generateSpecChecksum(peer)
+		require.NoError(t, err)
+
+		reqUpdate := &event.RequestUpdate{Name: "private-repo", Namespace: "argocd", Kind: "Repository", Checksum: checksum}
+		require.NoError(t, handler.ProcessRequestUpdateEvent(ctx, testAgentName, reqUpdate))
+		assert.Zero(t, handler.sendQ.Len())
+	})
+
+	t.Run("send filtered and encrypted spec update if checksum does not match", func(t *testing.T) {
+		handler := newHandler(t)
+		reqUpdate := &event.RequestUpdate{Name: "private-repo", Namespace: "argocd", Kind: "Repository", Checksum: []byte("invalid-checksum")}
+		require.NoError(t, handler.ProcessRequestUpdateEvent(ctx, testAgentName, reqUpdate))
+
+		ev, shutdown := handler.sendQ.Get()
+		require.False(t, shutdown)
+		assert.Equal(t, event.SpecUpdate.String(), ev.Type())
+		repo, err := event.New(ev, targets.Repository).Repository()
+		require.NoError(t, err)
+		assert.NotContains(t, repo.Data, "githubAppPrivateKey")
+		assert.Equal(t, []string{"password"}, repository.EncryptedFields(repo))
+		require.NoError(t, cipher.Decrypt(repo))
+		assert.Equal(t, []byte("s3cr3t"), repo.Data["password"])
+	})
+}
+
+func Test_ProcessRequestUpdateEvent_ApplicationFilter(t *testing.T) {
+	ctx := context.Background()
+	gvr, err := getGroupVersionResource("Application")
+	require.NoError(t, err)
+	f, err := event.ParseApplicationFilter([]string{"info:Owner"})
+	require.NoError(t, err)
+
+	handler := createFakeHandler(t)
+	handler.namespace = "default"
+	handler.events.SetApplicationFilter(f)
+	resource := fakeUnresApp()
+	peer := resource.DeepCopy()
+	require.NoError(t, unstructured.SetNestedSlice(resource.Object, []interface{}{
+		map[string]interface{}{"name": "Owner", "value": "team-a"},
+	}, "spec", "info"))
+	_, err = handler.dynClient.Resource(gvr).Namespace("default").Create(ctx, resource, v1.CreateOptions{})
+	require.NoError(t, err)
+
+	t.Run("stripped info entries are ignored when comparing checksums", func(t *testing.T) {
+		checksum, err := generateSpecChecksum(peer)
+		require.NoError(t, err)
+		reqUpdate := &event.RequestUpdate{Name: "test-app", Namespace: "default", Kind: "Application", Checksum: checksum}
+		require.NoError(t, handler.ProcessRequestUpdateEvent(ctx, testAgentName, reqUpdate))
+		assert.Zero(t, handler.sendQ.Len())
+	})
+
+	t.Run("send filtered spec update if checksum does not match", func(t *testing.T) {
+		reqUpdate := &event.RequestUpdate{Name: "test-app", Namespace: "default", Kind: "Application", Checksum: []byte("invalid-checksum")}
+		require.NoError(t, handler.ProcessRequestUpdateEvent(ctx, testAgentName, reqUpdate))
+
+		ev, shutdown := handler.sendQ.Get()
+		require.False(t, shutdown)
+		app, err := event.New(ev, targets.Application).Application()
+		require.NoError(t, err)
+		assert.Empty(t, app.Spec.Info)
+	})
+}
+
+func Test_ProcessRequestUpdateEvent_ApplicationTransform(t *testing.T) {
+	ctx := context.Background()
+	gvr, err := getGroupVersionResource("Application")
+	require.NoError(t, err)
+
+	handler := createFakeHandler(t).WithApplicationTransform(func(app *v1alpha1.Application) *v1alpha1.Application {
+		app.Finalizers = []string{v1alpha1.ResourcesFinalizerName}
+		return app
+	})
+	handler.namespace = "default"
+	_, err = handler.dynClient.Resource(gvr).Namespace("default").Create(ctx, fakeUnresApp(), v1.CreateOptions{})
+	require.NoError(t, err)
+
+	reqUpdate := &event.RequestUpdate{Name: "test-app", Namespace: "default", Kind: "Application", Checksum: []byte("invalid-checksum")}
+	require.NoError(t, handler.ProcessRequestUpdateEvent(ctx, testAgentName, reqUpdate))
+
+	ev, shutdown := handler.sendQ.Get()
+	require.False(t, shutdown)
+	app, err := event.New(ev, targets.Application).Application()
+	require.NoError(t, err)
+	assert.Equal(t, []string{v1alpha1.ResourcesFinalizerName}, app.Finalizers)
+}
+
 func Test_ProcessRequestUpdateEvent_PeerNamespaceRemap(t *testing.T) {
 	ctx := context.Background()
 	gvr, err := getGroupVersionResource("Application")
@@ -1035,6 +1237,60 @@ func fakeUnresApp() *unstructured.Unstructured {
 	return resource
 }
 
+func fakeUnresAppWithHistory() *unstructured.Unstructured {
+	resource := fakeUnresApp()
+	resource.Object["status"] = map[string]interface{}{
+		"history": []interface{}{
+			map[string]interface{}{
+				"id":         int64(1),
+				"revision":   "abc123",
+				"deployedAt": "2025-05-01T12:00:00Z",
+			},
+		},
+		"operationState": map[string]interface{}{
+			"operation": map[string]interface{}{
+				"sync": map[string]interface{}{"revision": "abc123"},
+			},
+			"phase":      "Succeeded",
+			"startedAt":  "2025-05-01T11:59:00Z",
+			"finishedAt": "2025-05-01T12:00:00Z",
+			"syncResult": map[string]interface{}{
+				"revision": "abc123",
+				"resources": []interface{}{
+					map[string]interface{}{
+						"group":     "apps",
+						"version":   "v1",
+						"kind":      "Deployment",
+						"namespace": "default",
+						"name":      "guestbook",
+						"status":    "Synced",
+						"message":   "deployment.apps/guestbook configured",
+					},
+				},
+			},
+		},
+	}
+	return resource
+}
+
+func fakeUnresRepository() *unstructured.Unstructured {
+	resource := &unstructured.Unstructured{}
+	resource.SetGroupVersionKind(schema.GroupVersionKind{
+		Group:   "",
+		Version: "v1",
+		Kind:    "Secret",
+	})
+	resource.SetName("private-repo")
+	resource.SetNamespace("argocd")
+	resource.SetUID("repo-uid")
+	resource.Object["data"] = map[string]interface{}{
+		"url":                 base64.StdEncoding.EncodeToString([]byte("https://github.com/example/private.git")),
+		"password":            base64.StdEncoding.EncodeToString([]byte("s3cr3t")),
+		"githubAppPrivateKey": base64.StdEncoding.EncodeToString([]byte("private key")),
+	}
+	return resource
+}
+
 func fakeUnresGPGKey() *unstructured.Unstructured {
 	resource := &unstructured.Unstructured{}
 	resource.SetGroupVersionKind(schema.GroupVersionKind{
@@ -1050,3 +1306,36 @@ func fakeUnresGPGKey() *unstructured.Unstructured {
 	}
 	return resource
 }
+
+func Test_ProcessIncomingSyncedResource_ApplicationNamespaces(t *testing.T) {
+	ctx := context.Background()
+	gvr, err := getGroupVersionResource("Application")
+	require.Nil(t, err)
+
+	handler := createFakeHandler(t).WithApplicationNamespaces(func(name string) string {
+		return "team-a"
+	})
+	resource := fakeUnresApp()
+	resource.SetNamespace("team-a")
+	resource.SetAnnotations(map[string]string{
+		manager.SourceUIDAnnotation: "source-uid",
+	})
+	_, err = handler.dynClient.Resource(gvr).Namespace("team-a").Create(ctx, resource, v1.CreateOptions{})
+	require.Nil(t, err)
+
+	// The principal reports the application under the agent's namespace, but
+	// the agent placed it in the namespace the mapping returns
+	incoming := &event.SyncedResource{
+		Name:      "test-app",
+		Namespace: "agent-managed",
+		Kind:      "Application",
+		UID:       "test-uid",
+	}
+	require.NoError(t, handler.ProcessIncomingSyncedResource(ctx, incoming, testAgentName))
+
+	ev, shutdown := handler.sendQ.Get()
+	require.False(t, shutdown)
+	got := &event.RequestUpdate{}
+	require.NoError(t, ev.DataAs(got))
+	assert.NotEmpty(t, got.Checksum, "should have checksum because app was found in the mapped namespace")
+}
@@ -0,0 +1,152 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tlsutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// ACMEConfig configures obtaining certificates from an ACME server, such as
+// Let's Encrypt, using the TLS-ALPN-01 challenge.
+type ACMEConfig struct {
+	// Hosts are the host names to obtain certificates for. Certificates are
+	// only requested for these host names.
+	Hosts []string
+	// Email is the optional contact address of the ACME account
+	Email string
+	// DirectoryURL is the URL of the ACME directory. Defaults to the Let's
+	// Encrypt production directory.
+	DirectoryURL string
+	// SecretNamespace and SecretName refer to the Secret that the ACME
+	// account key and the obtained certificates are stored in.
+	SecretNamespace string
+	SecretName      string
+}
+
+// NewACMEManager returns a certificate manager for the given configuration.
+// Its GetCertificate method obtains certificates on demand, answers
+// TLS-ALPN-01 challenges and renews certificates before they expire. The
+// tls.Config using it must include acme.ALPNProto in its NextProtos.
+//
+// Creating the manager implies acceptance of the ACME server's terms of
+// service.
+func NewACMEManager(kube kubernetes.Interface, config ACMEConfig) (*autocert.Manager, error) {
+	if len(config.Hosts) == 0 {
+		return nil, errors.New("at least one host name is required for ACME")
+	}
+	if config.SecretName == "" {
+		return nil, errors.New("a secret name is required for ACME")
+	}
+	directoryURL := config.DirectoryURL
+	if directoryURL == "" {
+		directoryURL = acme.LetsEncryptURL
+	}
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      NewSecretCache(kube, config.SecretNamespace, config.SecretName),
+		HostPolicy: autocert.HostWhitelist(config.Hosts...),
+		Email:      config.Email,
+		Client:     &acme.Client{DirectoryURL: directoryURL},
+	}, nil
+}
+
+// secretCacheKeys maps autocert's cache keys to valid Secret data keys
+var secretCacheKeys = strings.NewReplacer("+", "_")
+
+// SecretCache is an autocert.Cache storing its data in a single Kubernetes
+// Secret, which is created when data is first put into the cache.
+type SecretCache struct {
+	kube      kubernetes.Interface
+	namespace string
+	name      string
+}
+
+var _ autocert.Cache = &SecretCache{}
+
+// NewSecretCache returns a SecretCache using the Secret name in namespace
+func NewSecretCache(kube kubernetes.Interface, namespace, name string) *SecretCache {
+	return &SecretCache{kube: kube, namespace: namespace, name: name}
+}
+
+// Get returns the data stored for key, or autocert.ErrCacheMiss if there is
+// none.
+func (c *SecretCache) Get(ctx context.Context, key string) ([]byte, error) {
+	secret, err := c.kube.CoreV1().Secrets(c.namespace).Get(ctx, c.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, autocert.ErrCacheMiss
+	} else if err != nil {
+		return nil, fmt.Errorf("could not read ACME secret %s/%s: %w", c.namespace, c.name, err)
+	}
+	data, ok := secret.Data[secretCacheKeys.Replace(key)]
+	if !ok {
+		return nil, autocert.ErrCacheMiss
+	}
+	return data, nil
+}
+
+// Put stores data for key
+func (c *SecretCache) Put(ctx context.Context, key string, data []byte) error {
+	return c.update(ctx, func(secret *v1.Secret) {
+		if secret.Data == nil {
+			secret.Data = make(map[string][]byte)
+		}
+		secret.Data[secretCacheKeys.Replace(key)] = data
+	})
+}
+
+// Delete removes the data stored for key
+func (c *SecretCache) Delete(ctx context.Context, key string) error {
+	return c.update(ctx, func(secret *v1.Secret) {
+		delete(secret.Data, secretCacheKeys.Replace(key))
+	})
+}
+
+// update applies mutate to the Secret, creating it if it does not exist yet
+func (c *SecretCache) update(ctx context.Context, mutate func(secret *v1.Secret)) error {
+	secrets := c.kube.CoreV1().Secrets(c.namespace)
+	err := retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		secret, err := secrets.Get(ctx, c.name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			secret = &v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: c.name, Namespace: c.namespace}}
+			mutate(secret)
+			_, err = secrets.Create(ctx, secret, metav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(err) {
+				// Let RetryOnConflict try again with the existing Secret
+				return apierrors.NewConflict(v1.Resource("secrets"), c.name, err)
+			}
+			return err
+		} else if err != nil {
+			return err
+		}
+		mutate(secret)
+		_, err = secrets.Update(ctx, secret, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("could not update ACME secret %s/%s: %w", c.namespace, c.name, err)
+	}
+	return nil
+}
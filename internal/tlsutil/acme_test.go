@@ -0,0 +1,81 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tlsutil
+
+import (
+	"context"
+	"testing"
+
+	"github.com/argoproj-labs/argocd-agent/test/fake/kube"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_SecretCache(t *testing.T) {
+	ctx := context.Background()
+	kcl := kube.NewFakeClientsetWithResources()
+	c := NewSecretCache(kcl, "argocd", "acme")
+
+	t.Run("Missing secret is a cache miss", func(t *testing.T) {
+		_, err := c.Get(ctx, "acme_account+key")
+		assert.ErrorIs(t, err, autocert.ErrCacheMiss)
+	})
+
+	t.Run("Put creates and updates the secret", func(t *testing.T) {
+		require.NoError(t, c.Put(ctx, "acme_account+key", []byte("key")))
+		require.NoError(t, c.Put(ctx, "principal.example.com", []byte("cert")))
+
+		secret, err := kcl.CoreV1().Secrets("argocd").Get(ctx, "acme", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, []byte("key"), secret.Data["acme_account_key"])
+
+		data, err := c.Get(ctx, "acme_account+key")
+		require.NoError(t, err)
+		assert.Equal(t, []byte("key"), data)
+		data, err = c.Get(ctx, "principal.example.com")
+		require.NoError(t, err)
+		assert.Equal(t, []byte("cert"), data)
+	})
+
+	t.Run("Delete removes the key", func(t *testing.T) {
+		require.NoError(t, c.Delete(ctx, "principal.example.com"))
+		_, err := c.Get(ctx, "principal.example.com")
+		assert.ErrorIs(t, err, autocert.ErrCacheMiss)
+		_, err = c.Get(ctx, "acme_account+key")
+		assert.NoError(t, err)
+	})
+}
+
+func Test_NewACMEManager(t *testing.T) {
+	kcl := kube.NewFakeClientsetWithResources()
+	t.Run("Defaults to Let's Encrypt", func(t *testing.T) {
+		m, err := NewACMEManager(kcl, ACMEConfig{Hosts: []string{"principal.example.com"}, SecretNamespace: "argocd", SecretName: "acme"})
+		require.NoError(t, err)
+		assert.Equal(t, acme.LetsEncryptURL, m.Client.DirectoryURL)
+		assert.NoError(t, m.HostPolicy(context.Background(), "principal.example.com"))
+		assert.Error(t, m.HostPolicy(context.Background(), "other.example.com"))
+	})
+	t.Run("Host names are required", func(t *testing.T) {
+		_, err := NewACMEManager(kcl, ACMEConfig{SecretName: "acme"})
+		assert.ErrorContains(t, err, "host name")
+	})
+	t.Run("Secret name is required", func(t *testing.T) {
+		_, err := NewACMEManager(kcl, ACMEConfig{Hosts: []string{"principal.example.com"}})
+		assert.ErrorContains(t, err, "secret name")
+	})
+}
@@ -0,0 +1,171 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tlsutil
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/internal/logging"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultExpiryCheckInterval is the default interval in which the
+// ExpiryMonitor checks certificates
+const DefaultExpiryCheckInterval = time.Hour
+
+// DefaultExpiryWarningThresholds are the remaining validity periods at which
+// the ExpiryMonitor logs a warning about a certificate expiring
+var DefaultExpiryWarningThresholds = []time.Duration{
+	30 * 24 * time.Hour,
+	14 * 24 * time.Hour,
+	7 * 24 * time.Hour,
+	24 * time.Hour,
+}
+
+// ExpirySource returns the certificates currently in use for one purpose,
+// e.g. the server certificate or a CA bundle
+type ExpirySource func() ([]*x509.Certificate, error)
+
+// ExpiryReporter is called by the ExpiryMonitor with the remaining validity
+// of the soonest expiring certificate of each source
+type ExpiryReporter func(name string, remaining time.Duration)
+
+// ExpiryMonitor periodically checks the certificates returned by its sources
+// for their expiry. Each time a certificate falls below another of the
+// warning thresholds, a warning is logged, and expired certificates are
+// logged as errors on every check.
+type ExpiryMonitor struct {
+	thresholds []time.Duration
+	report     ExpiryReporter
+
+	mu      sync.Mutex
+	names   []string
+	sources map[string]ExpirySource
+	// warned holds the lowest threshold already warned about per certificate
+	warned map[string]time.Duration
+}
+
+// NewExpiryMonitor returns an ExpiryMonitor passing the remaining validity
+// of certificates to report, which may be nil. If no thresholds are given,
+// DefaultExpiryWarningThresholds are used.
+func NewExpiryMonitor(report ExpiryReporter, thresholds ...time.Duration) *ExpiryMonitor {
+	if len(thresholds) == 0 {
+		thresholds = DefaultExpiryWarningThresholds
+	}
+	thresholds = slices.Clone(thresholds)
+	slices.Sort(thresholds)
+	return &ExpiryMonitor{
+		thresholds: thresholds,
+		report:     report,
+		sources:    make(map[string]ExpirySource),
+		warned:     make(map[string]time.Duration),
+	}
+}
+
+// AddSource adds a source of certificates to be checked under the given
+// name, replacing any existing source of the same name
+func (m *ExpiryMonitor) AddSource(name string, source ExpirySource) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.sources[name]; !ok {
+		m.names = append(m.names, name)
+	}
+	m.sources[name] = source
+}
+
+// Check checks the certificates of all sources against now
+func (m *ExpiryMonitor) Check(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, name := range m.names {
+		logCtx := expiryLog().WithField("certificate", name)
+		certs, err := m.sources[name]()
+		if err != nil {
+			logCtx.WithError(err).Warn("Could not check certificate expiry")
+			continue
+		}
+		var soonest *x509.Certificate
+		for _, cert := range certs {
+			if cert == nil {
+				continue
+			}
+			m.checkCertificate(logCtx, name, cert, now)
+			if soonest == nil || cert.NotAfter.Before(soonest.NotAfter) {
+				soonest = cert
+			}
+		}
+		if soonest != nil && m.report != nil {
+			m.report(name, soonest.NotAfter.Sub(now))
+		}
+	}
+}
+
+// checkCertificate logs a warning if cert has fallen below a threshold it
+// has not been warned about yet, or an error if it has expired.
+func (m *ExpiryMonitor) checkCertificate(logCtx *logrus.Entry, name string, cert *x509.Certificate, now time.Time) {
+	remaining := cert.NotAfter.Sub(now)
+	logCtx = logCtx.WithFields(logrus.Fields{
+		"subject":  cert.Subject.String(),
+		"serial":   cert.SerialNumber.String(),
+		"notAfter": cert.NotAfter.UTC().Format(time.RFC3339),
+	})
+	if remaining <= 0 {
+		logCtx.Errorf("Certificate has expired %s ago", remaining.Abs().Round(time.Minute))
+		return
+	}
+	key := fmt.Sprintf("%s/%s/%s", name, cert.Issuer.String(), cert.SerialNumber.String())
+	for _, threshold := range m.thresholds {
+		if remaining > threshold {
+			continue
+		}
+		if last, ok := m.warned[key]; ok && last <= threshold {
+			return
+		}
+		m.warned[key] = threshold
+		logCtx.Warnf("Certificate expires in %s, it should be renewed", remaining.Round(time.Minute))
+		return
+	}
+}
+
+// Run checks the certificates immediately and then every interval, until
+// ctx is done. Run returns immediately, the checks are performed in the
+// background.
+func (m *ExpiryMonitor) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultExpiryCheckInterval
+	}
+	m.Check(time.Now())
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.Check(time.Now())
+			}
+		}
+	}()
+}
+
+func expiryLog() *logrus.Entry {
+	return logging.GetDefaultLogger().ComponentLogger("CertificateExpiry")
+}
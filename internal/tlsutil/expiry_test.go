@@ -0,0 +1,94 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tlsutil
+
+import (
+	"crypto/x509"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ExpiryMonitor(t *testing.T) {
+	now := time.Now()
+	day := 24 * time.Hour
+	cert := &x509.Certificate{SerialNumber: big.NewInt(1), NotAfter: now.Add(20 * day)}
+	other := &x509.Certificate{SerialNumber: big.NewInt(2), NotAfter: now.Add(60 * day)}
+
+	reported := map[string]time.Duration{}
+	m := NewExpiryMonitor(func(name string, remaining time.Duration) {
+		reported[name] = remaining
+	})
+	m.AddSource("serving", func() ([]*x509.Certificate, error) {
+		return []*x509.Certificate{other, cert}, nil
+	})
+	m.AddSource("broken", func() ([]*x509.Certificate, error) {
+		return nil, errors.New("broken")
+	})
+
+	// warned returns the lowest threshold warned about for cert
+	warned := func() time.Duration {
+		return m.warned["serving//1"]
+	}
+
+	t.Run("Soonest expiry is reported", func(t *testing.T) {
+		m.Check(now)
+		assert.Equal(t, 20*day, reported["serving"])
+		assert.NotContains(t, reported, "broken")
+		assert.Equal(t, 30*day, warned())
+		assert.Len(t, m.warned, 1)
+	})
+	t.Run("Warning is not repeated within a threshold", func(t *testing.T) {
+		m.Check(now.Add(day))
+		assert.Equal(t, 30*day, warned())
+	})
+	t.Run("Warning escalates at the next threshold", func(t *testing.T) {
+		m.Check(now.Add(7 * day))
+		assert.Equal(t, 14*day, warned())
+		m.Check(now.Add(19*day + time.Hour))
+		assert.Equal(t, day, warned())
+	})
+	t.Run("Expired certificate is reported", func(t *testing.T) {
+		m.Check(now.Add(21 * day))
+		assert.Equal(t, -day, reported["serving"])
+	})
+}
+
+func Test_X509CertsFromFile(t *testing.T) {
+	certPEM, _, err := GenerateCaCertificate("test-ca", DefaultCACertValidityDays, KeyGenOptions{RSABits: 2048})
+	require.NoError(t, err)
+	dir := t.TempDir()
+
+	t.Run("Certificates are parsed", func(t *testing.T) {
+		path := filepath.Join(dir, "ca.crt")
+		require.NoError(t, os.WriteFile(path, []byte(certPEM+certPEM), 0600))
+		certs, err := X509CertsFromFile(path)
+		require.NoError(t, err)
+		require.Len(t, certs, 2)
+		assert.Equal(t, "test-ca", certs[0].Subject.CommonName)
+	})
+	t.Run("Invalid data", func(t *testing.T) {
+		path := filepath.Join(dir, "invalid.crt")
+		require.NoError(t, os.WriteFile(path, []byte("invalid"), 0600))
+		_, err := X509CertsFromFile(path)
+		assert.ErrorContains(t, err, "invalid PEM data")
+	})
+}
@@ -121,6 +121,42 @@ func ParsePrivateKeyFromPEM(data []byte) (crypto.PrivateKey, error) {
 	}
 }
 
+// ParsePublicKeysFromPEM parses all PEM blocks in data and returns the public
+// keys they contain. Blocks may contain public keys in PKIX or PKCS#1 format,
+// or private keys, in which case the corresponding public key is returned.
+func ParsePublicKeysFromPEM(data []byte) ([]crypto.PublicKey, error) {
+	var keys []crypto.PublicKey
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		var pub crypto.PublicKey
+		var err error
+		switch block.Type {
+		case "PUBLIC KEY":
+			pub, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "RSA PUBLIC KEY":
+			pub, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		default:
+			var priv crypto.PrivateKey
+			priv, err = ParsePrivateKeyFromPEM(pem.EncodeToMemory(block))
+			if err == nil {
+				pub, err = publicKey(priv)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not parse %s: %w", block.Type, err)
+		}
+		keys = append(keys, pub)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no valid PEM data found")
+	}
+	return keys, nil
+}
+
 // PublicKey returns the public key for a private key.
 func publicKey(key crypto.PrivateKey) (crypto.PublicKey, error) {
 	switch k := key.(type) {
@@ -54,6 +54,36 @@ func Test_ParsePrivateKeyFromPEM(t *testing.T) {
 	})
 }
 
+func Test_ParsePublicKeysFromPEM(t *testing.T) {
+	t.Run("Mixed private and public keys", func(t *testing.T) {
+		key1, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		key2, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		privPEM, err := PrivateKeyToPEM(key1)
+		require.NoError(t, err)
+		pubDER, err := x509.MarshalPKIXPublicKey(&key2.PublicKey)
+		require.NoError(t, err)
+		pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+
+		keys, err := ParsePublicKeysFromPEM(append([]byte(privPEM), pubPEM...))
+		require.NoError(t, err)
+		require.Len(t, keys, 2)
+		assert.True(t, key1.PublicKey.Equal(keys[0]))
+		assert.True(t, key2.PublicKey.Equal(keys[1]))
+	})
+
+	t.Run("No PEM data", func(t *testing.T) {
+		_, err := ParsePublicKeysFromPEM([]byte("not a key"))
+		assert.ErrorContains(t, err, "no valid PEM data")
+	})
+
+	t.Run("Unsupported block", func(t *testing.T) {
+		_, err := ParsePublicKeysFromPEM(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte{1}}))
+		assert.Error(t, err)
+	})
+}
+
 func Test_ParseKeyAlgorithm(t *testing.T) {
 	t.Run("defaults for empty values", func(t *testing.T) {
 		opts, err := ParseKeyAlgorithm("", 0)
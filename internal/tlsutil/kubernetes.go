@@ -40,6 +40,9 @@ const (
 	tlsKeyFieldName   = "tls.key"
 	tlsTypeLabelValue = "kubernetes.io/tls"
 	jwtKeyFieldName   = "jwt.key"
+	// jwtPreviousKeysFieldName holds keys that have been rotated out, but are
+	// still accepted for token validation.
+	jwtPreviousKeysFieldName = "jwt.previous-keys"
 )
 
 // TLSCertFromSecret reads a Kubernetes TLS secrets, and parses its data into
@@ -49,11 +52,17 @@ func TLSCertFromSecret(ctx context.Context, kube kubernetes.Interface, namespace
 	if err != nil {
 		return tls.Certificate{}, fmt.Errorf("could not read TLS secret %s/%s: %w", namespace, name, err)
 	}
+	return tlsCertFromSecret(secret)
+}
+
+// tlsCertFromSecret parses the data of the Kubernetes TLS secret into a
+// tls.Certificate.
+func tlsCertFromSecret(secret *v1.Secret) (tls.Certificate, error) {
 	if secret.Type != tlsTypeLabelValue {
-		return tls.Certificate{}, fmt.Errorf("%s/%s: not a TLS secret", namespace, name)
+		return tls.Certificate{}, fmt.Errorf("%s/%s: not a TLS secret", secret.Namespace, secret.Name)
 	}
 	if len(secret.Data) == 0 {
-		return tls.Certificate{}, fmt.Errorf("%s/%s: empty secret", namespace, name)
+		return tls.Certificate{}, fmt.Errorf("%s/%s: empty secret", secret.Namespace, secret.Name)
 	}
 	crt := secret.Data[tlsCertFieldName]
 	key := secret.Data[tlsKeyFieldName]
@@ -107,6 +116,21 @@ func TLSCertToSecret(ctx context.Context, kube kubernetes.Interface, namespace,
 // fields is the empty string, all fields in the secret are expected to have
 // valid certificate data and will be parsed.
 func X509CertPoolFromSecret(ctx context.Context, kube kubernetes.Interface, namespace, name string, fields ...string) (*x509.CertPool, error) {
+	certs, err := X509CertsFromSecret(ctx, kube, namespace, name, fields...)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	for _, cert := range certs {
+		pool.AddCert(cert)
+	}
+	return pool, nil
+}
+
+// X509CertsFromSecret reads certificate data from a Kubernetes secret and
+// returns the parsed certificates. The fields are handled the same way as
+// for X509CertPoolFromSecret.
+func X509CertsFromSecret(ctx context.Context, kube kubernetes.Interface, namespace, name string, fields ...string) ([]*x509.Certificate, error) {
 	secret, err := kube.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("could not read secret: %w", err)
@@ -117,29 +141,25 @@ func X509CertPoolFromSecret(ctx context.Context, kube kubernetes.Interface, name
 
 	readAll := len(fields) == 0 || (len(fields) == 1 && fields[0] == "")
 
-	pool := x509.NewCertPool()
-	certsInPool := 0
+	var certs []*x509.Certificate
+	fieldsRead := 0
 	for f, crtBytes := range secret.Data {
-		if readAll {
-			ok := pool.AppendCertsFromPEM(crtBytes)
-			if !ok {
-				return nil, fmt.Errorf("%s/%s: field %s does not hold valid certificate data", namespace, name, f)
-			}
-			certsInPool++
-		} else if slices.Contains(fields, f) {
-			ok := pool.AppendCertsFromPEM(crtBytes)
-			if !ok {
-				return nil, fmt.Errorf("%s/%s: field %s does not hold valid certificate data", namespace, name, f)
-			}
-			certsInPool++
+		if !readAll && !slices.Contains(fields, f) {
+			continue
+		}
+		parsed := X509CertsFromPEM(crtBytes)
+		if len(parsed) == 0 {
+			return nil, fmt.Errorf("%s/%s: field %s does not hold valid certificate data", namespace, name, f)
 		}
+		certs = append(certs, parsed...)
+		fieldsRead++
 	}
 
-	if certsInPool == 0 {
+	if fieldsRead == 0 {
 		return nil, fmt.Errorf("%s/%s: none of the requested fields %v were found in secret", namespace, name, fields)
 	}
 
-	return pool, nil
+	return certs, nil
 }
 
 // TransportFromConfig creates an HTTP transport that is configured to use the
@@ -204,3 +224,23 @@ func JWTSigningKeyFromSecret(ctx context.Context, kube kubernetes.Interface, nam
 
 	return key, nil
 }
+
+// JWTVerificationKeysFromSecret reads the previous JWT signing keys from the
+// secret referred to by namespace and name. The keys are expected in the
+// "jwt.previous-keys" field as a sequence of PEM blocks. If the field does
+// not exist, no keys and no error are returned.
+func JWTVerificationKeysFromSecret(ctx context.Context, kube kubernetes.Interface, namespace, name string) ([]crypto.PublicKey, error) {
+	secret, err := kube.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("could not read JWT secret %s/%s: %w", namespace, name, err)
+	}
+	keyData, ok := secret.Data[jwtPreviousKeysFieldName]
+	if !ok {
+		return nil, nil
+	}
+	keys, err := ParsePublicKeysFromPEM(keyData)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse previous JWT keys from secret %s/%s: %w", namespace, name, err)
+	}
+	return keys, nil
+}
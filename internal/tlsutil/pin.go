@@ -0,0 +1,123 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tlsutil
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+const (
+	// spkiPinPrefix is the prefix of a pin on the SHA-256 hash of a
+	// certificate's public key, as used by HPKP (RFC 7469).
+	spkiPinPrefix = "sha256/"
+	// fingerprintPinPrefix is the optional prefix of a pin on the SHA-256
+	// fingerprint of a certificate.
+	fingerprintPinPrefix = "sha256:"
+)
+
+// CertificatePins is a set of pinned certificates and public keys
+type CertificatePins struct {
+	spki         map[[sha256.Size]byte]bool
+	fingerprints map[[sha256.Size]byte]bool
+}
+
+// ParseCertificatePins parses a list of pins. Each pin is either
+//
+//   - the base64 encoded SHA-256 hash of a certificate's SubjectPublicKeyInfo,
+//     prefixed with "sha256/", or
+//   - the hex encoded SHA-256 fingerprint of a certificate, optionally
+//     prefixed with "sha256:" and optionally separated by colons, as printed
+//     by "openssl x509 -fingerprint -sha256".
+//
+// Empty entries are ignored.
+func ParseCertificatePins(pins []string) (*CertificatePins, error) {
+	p := &CertificatePins{
+		spki:         make(map[[sha256.Size]byte]bool),
+		fingerprints: make(map[[sha256.Size]byte]bool),
+	}
+	for _, pin := range pins {
+		pin = strings.TrimSpace(pin)
+		if pin == "" {
+			continue
+		}
+		var sum [sha256.Size]byte
+		if enc, ok := strings.CutPrefix(pin, spkiPinPrefix); ok {
+			b, err := base64.StdEncoding.DecodeString(enc)
+			if err != nil || len(b) != sha256.Size {
+				return nil, fmt.Errorf("invalid public key pin %q", pin)
+			}
+			copy(sum[:], b)
+			p.spki[sum] = true
+			continue
+		}
+		enc := strings.ReplaceAll(strings.TrimPrefix(strings.ToLower(pin), fingerprintPinPrefix), ":", "")
+		b, err := hex.DecodeString(enc)
+		if err != nil || len(b) != sha256.Size {
+			return nil, fmt.Errorf("invalid certificate fingerprint pin %q", pin)
+		}
+		copy(sum[:], b)
+		p.fingerprints[sum] = true
+	}
+	if p.Len() == 0 {
+		return nil, fmt.Errorf("no certificate pins given")
+	}
+	return p, nil
+}
+
+// Len returns the number of pins in the set
+func (p *CertificatePins) Len() int {
+	return len(p.spki) + len(p.fingerprints)
+}
+
+// Matches returns true if cert matches any of the pins
+func (p *CertificatePins) Matches(cert *x509.Certificate) bool {
+	if p.fingerprints[sha256.Sum256(cert.Raw)] {
+		return true
+	}
+	return p.spki[sha256.Sum256(cert.RawSubjectPublicKeyInfo)]
+}
+
+// VerifyConnection is meant to be used as tls.Config.VerifyConnection. It
+// runs after the regular certificate verification and fails the handshake
+// unless a certificate in the verified chain matches one of the pins. When
+// certificate verification is disabled, the certificates presented by the
+// peer are checked instead.
+func (p *CertificatePins) VerifyConnection(cs tls.ConnectionState) error {
+	chains := cs.VerifiedChains
+	if len(chains) == 0 {
+		chains = [][]*x509.Certificate{cs.PeerCertificates}
+	}
+	for _, chain := range chains {
+		for _, cert := range chain {
+			if p.Matches(cert) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("certificate presented by %s does not match any pinned certificate or public key", cs.ServerName)
+}
+
+// SPKIPin returns the public key pin of cert in the format understood by
+// ParseCertificatePins.
+func SPKIPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return spkiPinPrefix + base64.StdEncoding.EncodeToString(sum[:])
+}
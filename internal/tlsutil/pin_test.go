@@ -0,0 +1,95 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tlsutil
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func generatePinTestCerts(t *testing.T) (ca *x509.Certificate, leaf *x509.Certificate) {
+	t.Helper()
+	caData, caKeyData, err := GenerateCaCertificate("test", DefaultCACertValidityDays, KeyGenOptions{})
+	require.NoError(t, err)
+	caCert, err := tls.X509KeyPair([]byte(caData), []byte(caKeyData))
+	require.NoError(t, err)
+	certData, keyData, err := GenerateServerCertificate("server", caCert.Leaf, caCert.PrivateKey, []string{"127.0.0.1"}, nil, DefaultCACertValidityDays, KeyGenOptions{})
+	require.NoError(t, err)
+	cert, err := tls.X509KeyPair([]byte(certData), []byte(keyData))
+	require.NoError(t, err)
+	return caCert.Leaf, cert.Leaf
+}
+
+func Test_ParseCertificatePins(t *testing.T) {
+	_, leaf := generatePinTestCerts(t)
+	sum := sha256.Sum256(leaf.Raw)
+	fingerprint := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	t.Run("Valid pins", func(t *testing.T) {
+		colons := make([]string, 0, len(sum))
+		for _, b := range sum {
+			colons = append(colons, hex.EncodeToString([]byte{b}))
+		}
+		p, err := ParseCertificatePins([]string{SPKIPin(leaf), fingerprint, "sha256:" + strings.Join(colons, ":"), " "})
+		require.NoError(t, err)
+		// Both fingerprint notations refer to the same certificate
+		assert.Equal(t, 2, p.Len())
+		assert.True(t, p.Matches(leaf))
+	})
+
+	t.Run("Invalid pins", func(t *testing.T) {
+		_, err := ParseCertificatePins([]string{"sha256/not-base64"})
+		assert.ErrorContains(t, err, "invalid public key pin")
+		_, err = ParseCertificatePins([]string{"sha256/AAAA"})
+		assert.ErrorContains(t, err, "invalid public key pin")
+		_, err = ParseCertificatePins([]string{"abcdef"})
+		assert.ErrorContains(t, err, "invalid certificate fingerprint pin")
+		_, err = ParseCertificatePins([]string{""})
+		assert.ErrorContains(t, err, "no certificate pins")
+	})
+}
+
+func Test_VerifyConnection(t *testing.T) {
+	ca, leaf := generatePinTestCerts(t)
+	_, otherLeaf := generatePinTestCerts(t)
+
+	t.Run("Leaf public key pinned", func(t *testing.T) {
+		p, err := ParseCertificatePins([]string{SPKIPin(leaf)})
+		require.NoError(t, err)
+		assert.NoError(t, p.VerifyConnection(tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{leaf, ca}}}))
+		assert.Error(t, p.VerifyConnection(tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{otherLeaf, ca}}}))
+	})
+
+	t.Run("CA public key pinned", func(t *testing.T) {
+		p, err := ParseCertificatePins([]string{SPKIPin(ca)})
+		require.NoError(t, err)
+		assert.NoError(t, p.VerifyConnection(tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{leaf, ca}}}))
+	})
+
+	t.Run("Peer certificates are checked without verified chains", func(t *testing.T) {
+		p, err := ParseCertificatePins([]string{SPKIPin(leaf)})
+		require.NoError(t, err)
+		assert.NoError(t, p.VerifyConnection(tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf}}))
+		assert.Error(t, p.VerifyConnection(tls.ConnectionState{PeerCertificates: []*x509.Certificate{otherLeaf}}))
+		assert.Error(t, p.VerifyConnection(tls.ConnectionState{}))
+	})
+}
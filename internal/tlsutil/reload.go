@@ -0,0 +1,255 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tlsutil
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/internal/informer"
+	"github.com/argoproj-labs/argocd-agent/internal/logging"
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+// DefaultReloadInterval is the default interval in which certificate files
+// are checked for changes.
+const DefaultReloadInterval = 30 * time.Second
+
+// reloadSyncTimeout is the time to wait for the Secret informer to sync
+const reloadSyncTimeout = 30 * time.Second
+
+// CertificateReloader holds a TLS certificate that can be replaced while it
+// is in use. Its GetCertificate and GetClientCertificate methods are meant to
+// be used in a tls.Config, so that new connections pick up a renewed
+// certificate without restarting the server. Existing connections are not
+// affected.
+type CertificateReloader struct {
+	cert atomic.Pointer[tls.Certificate]
+}
+
+// NewCertificateReloader returns a CertificateReloader serving cert until it
+// is replaced.
+func NewCertificateReloader(cert tls.Certificate) *CertificateReloader {
+	r := &CertificateReloader{}
+	r.cert.Store(&cert)
+	return r
+}
+
+// Set replaces the certificate
+func (r *CertificateReloader) Set(cert tls.Certificate) {
+	r.cert.Store(&cert)
+}
+
+// Certificate returns the current certificate
+func (r *CertificateReloader) Certificate() *tls.Certificate {
+	return r.cert.Load()
+}
+
+// GetCertificate returns the current certificate. It can be used as
+// tls.Config.GetCertificate.
+func (r *CertificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.cert.Load(), nil
+}
+
+// GetClientCertificate returns the current certificate. It can be used as
+// tls.Config.GetClientCertificate.
+func (r *CertificateReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.cert.Load(), nil
+}
+
+// WatchFiles checks the certificate and key files for changes every interval
+// and loads the new key pair when they have changed. Files that cannot be
+// loaded, e.g. because only one of them has been written yet, are retried on
+// the next check while the current certificate is kept. Watching stops when
+// ctx is done.
+func (r *CertificateReloader) WatchFiles(ctx context.Context, certPath, keyPath string, interval time.Duration) {
+	logCtx := reloadLog().WithFields(logrus.Fields{"cert": certPath, "key": keyPath})
+	watchFiles(ctx, logCtx, interval, []string{certPath, keyPath}, func() error {
+		cert, err := TLSCertFromFile(certPath, keyPath, false)
+		if err != nil {
+			return err
+		}
+		r.Set(cert)
+		logCtx.WithField("not_after", cert.Leaf.NotAfter).Info("Reloaded TLS certificate")
+		return nil
+	})
+}
+
+// WatchSecret keeps the certificate in sync with the TLS Secret of the given
+// name in namespace. It starts an informer in the background, which is
+// stopped when ctx is done, and waits for the initial sync before returning.
+// Secrets with invalid data are ignored, and a deleted Secret keeps the
+// current certificate.
+func (r *CertificateReloader) WatchSecret(ctx context.Context, kube kubernetes.Interface, namespace, name string) error {
+	logCtx := reloadLog().WithField("secret", namespace+"/"+name)
+	load := func(secret *v1.Secret) {
+		if secret.Name != name {
+			return
+		}
+		cert, err := tlsCertFromSecret(secret)
+		if err != nil {
+			logCtx.WithError(err).Warn("Keeping current TLS certificate, new one could not be loaded")
+			return
+		}
+		// Resyncs and updates of other fields deliver the same certificate
+		if c := r.cert.Load(); c != nil && len(c.Certificate) > 0 && bytes.Equal(c.Certificate[0], cert.Certificate[0]) {
+			return
+		}
+		r.Set(cert)
+		logCtx.WithField("not_after", cert.Leaf.NotAfter).Info("Reloaded TLS certificate")
+	}
+
+	selector := fields.OneTermEqualSelector("metadata.name", name).String()
+	inf, err := informer.NewInformer[*v1.Secret](ctx,
+		informer.WithListHandler[*v1.Secret](func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+			opts.FieldSelector = selector
+			return kube.CoreV1().Secrets(namespace).List(ctx, opts)
+		}),
+		informer.WithWatchHandler[*v1.Secret](func(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+			opts.FieldSelector = selector
+			return kube.CoreV1().Secrets(namespace).Watch(ctx, opts)
+		}),
+		informer.WithAddHandler(load),
+		informer.WithUpdateHandler(func(_ *v1.Secret, secret *v1.Secret) {
+			load(secret)
+		}),
+		informer.WithDeleteHandler(func(secret *v1.Secret) {
+			if secret.Name == name {
+				logCtx.Warn("TLS secret was deleted, keeping current certificate")
+			}
+		}),
+		informer.WithGroupResource[*v1.Secret]("", "secrets"),
+	)
+	if err != nil {
+		return fmt.Errorf("could not create TLS secret informer: %w", err)
+	}
+
+	go func() {
+		if err := inf.Start(ctx); err != nil {
+			logCtx.WithError(err).Error("Could not start TLS secret informer")
+		}
+	}()
+
+	syncCtx, cancel := context.WithTimeout(ctx, reloadSyncTimeout)
+	defer cancel()
+	if err := inf.WaitForSync(syncCtx); err != nil {
+		return fmt.Errorf("TLS secret informer did not sync: %w", err)
+	}
+	logCtx.Info("Watching TLS secret for changes")
+	return nil
+}
+
+// CertPoolReloader holds a pool of CA certificates that can be replaced while
+// it is in use.
+type CertPoolReloader struct {
+	pool atomic.Pointer[x509.CertPool]
+}
+
+// NewCertPoolReloader returns a CertPoolReloader holding pool until it is
+// replaced.
+func NewCertPoolReloader(pool *x509.CertPool) *CertPoolReloader {
+	r := &CertPoolReloader{}
+	r.pool.Store(pool)
+	return r
+}
+
+// Set replaces the pool
+func (r *CertPoolReloader) Set(pool *x509.CertPool) {
+	r.pool.Store(pool)
+}
+
+// Pool returns the current pool
+func (r *CertPoolReloader) Pool() *x509.CertPool {
+	return r.pool.Load()
+}
+
+// WatchFile checks the CA bundle at path for changes every interval and
+// loads the new pool when it has changed. A bundle that cannot be loaded is
+// retried on the next check while the current pool is kept. Watching stops
+// when ctx is done.
+func (r *CertPoolReloader) WatchFile(ctx context.Context, path string, interval time.Duration) {
+	logCtx := reloadLog().WithField("ca", path)
+	watchFiles(ctx, logCtx, interval, []string{path}, func() error {
+		pool, err := X509CertPoolFromFile(path)
+		if err != nil {
+			return err
+		}
+		r.Set(pool)
+		logCtx.Info("Reloaded CA certificates")
+		return nil
+	})
+}
+
+// watchFiles calls load every interval in which the contents of any of the
+// files at paths have changed, until ctx is done. The files are assumed to be
+// loaded already when watchFiles is called. If load returns an error, it is
+// called again on the next check.
+func watchFiles(ctx context.Context, logCtx *logrus.Entry, interval time.Duration, paths []string, load func() error) {
+	if interval <= 0 {
+		interval = DefaultReloadInterval
+	}
+	logCtx.Infof("Watching files for changes every %v", interval)
+	last := make([][]byte, len(paths))
+	for i, path := range paths {
+		last[i], _ = os.ReadFile(path)
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			current := make([][]byte, len(paths))
+			var err error
+			for i, path := range paths {
+				if current[i], err = os.ReadFile(path); err != nil {
+					break
+				}
+			}
+			if err != nil {
+				logCtx.WithError(err).Warn("Could not read file")
+				continue
+			}
+			if slices.EqualFunc(current, last, bytes.Equal) {
+				continue
+			}
+			if err := load(); err != nil {
+				logCtx.WithError(err).Warn("Keeping current data, files could not be loaded")
+				continue
+			}
+			last = current
+		}
+	}()
+}
+
+func reloadLog() *logrus.Entry {
+	return logging.GetDefaultLogger().ComponentLogger("TLSReloader")
+}
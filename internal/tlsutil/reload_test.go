@@ -0,0 +1,159 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tlsutil
+
+import (
+	"context"
+	"crypto/tls"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/test/fake/kube"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func generateReloadTestKeyPair(t *testing.T, name string) (certData []byte, keyData []byte) {
+	t.Helper()
+	crt, key, err := GenerateCaCertificate(name, DefaultCACertValidityDays, KeyGenOptions{})
+	require.NoError(t, err)
+	return []byte(crt), []byte(key)
+}
+
+func currentCommonName(t *testing.T, r *CertificateReloader) string {
+	t.Helper()
+	cert, err := r.GetCertificate(&tls.ClientHelloInfo{})
+	require.NoError(t, err)
+	require.NotNil(t, cert.Leaf)
+	return cert.Leaf.Subject.CommonName
+}
+
+func Test_CertificateReloaderWatchFiles(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "tls.crt")
+	keyPath := filepath.Join(dir, "tls.key")
+	crt, key := generateReloadTestKeyPair(t, "first")
+	require.NoError(t, os.WriteFile(certPath, crt, 0600))
+	require.NoError(t, os.WriteFile(keyPath, key, 0600))
+
+	cert, err := TLSCertFromFile(certPath, keyPath, false)
+	require.NoError(t, err)
+	r := NewCertificateReloader(cert)
+	r.WatchFiles(ctx, certPath, keyPath, 10*time.Millisecond)
+	assert.Equal(t, "first", currentCommonName(t, r))
+
+	t.Run("Invalid files keep the current certificate", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(certPath, []byte("invalid"), 0600))
+		time.Sleep(50 * time.Millisecond)
+		assert.Equal(t, "first", currentCommonName(t, r))
+	})
+
+	t.Run("Renewed certificate is loaded", func(t *testing.T) {
+		crt, key := generateReloadTestKeyPair(t, "second")
+		require.NoError(t, os.WriteFile(keyPath, key, 0600))
+		require.NoError(t, os.WriteFile(certPath, crt, 0600))
+		assert.Eventually(t, func() bool {
+			return currentCommonName(t, r) == "second"
+		}, 2*time.Second, 10*time.Millisecond)
+		cc, err := r.GetClientCertificate(&tls.CertificateRequestInfo{})
+		require.NoError(t, err)
+		assert.Equal(t, "second", cc.Leaf.Subject.CommonName)
+	})
+}
+
+func Test_CertificateReloaderWatchSecret(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tlsSecret := func(name string, crt, key []byte) *v1.Secret {
+		return &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "argocd"},
+			Type:       tlsTypeLabelValue,
+			Data:       map[string][]byte{tlsCertFieldName: crt, tlsKeyFieldName: key},
+		}
+	}
+	crt, key := generateReloadTestKeyPair(t, "first")
+	otherCrt, otherKey := generateReloadTestKeyPair(t, "other")
+	kcl := kube.NewFakeClientsetWithResources(tlsSecret("tls-one", crt, key), tlsSecret("tls-two", otherCrt, otherKey))
+
+	cert, err := TLSCertFromSecret(ctx, kcl, "argocd", "tls-one")
+	require.NoError(t, err)
+	r := NewCertificateReloader(cert)
+	require.NoError(t, r.WatchSecret(ctx, kcl, "argocd", "tls-one"))
+	assert.Equal(t, "first", currentCommonName(t, r))
+
+	t.Run("Invalid secret keeps the current certificate", func(t *testing.T) {
+		_, err := kcl.CoreV1().Secrets("argocd").Update(ctx, tlsSecret("tls-one", []byte("invalid"), key), metav1.UpdateOptions{})
+		require.NoError(t, err)
+		time.Sleep(50 * time.Millisecond)
+		assert.Equal(t, "first", currentCommonName(t, r))
+	})
+
+	t.Run("Renewed certificate is loaded", func(t *testing.T) {
+		crt, key := generateReloadTestKeyPair(t, "second")
+		_, err := kcl.CoreV1().Secrets("argocd").Update(ctx, tlsSecret("tls-one", crt, key), metav1.UpdateOptions{})
+		require.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			return currentCommonName(t, r) == "second"
+		}, 2*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Other secrets are ignored", func(t *testing.T) {
+		crt, key := generateReloadTestKeyPair(t, "third")
+		_, err := kcl.CoreV1().Secrets("argocd").Update(ctx, tlsSecret("tls-two", crt, key), metav1.UpdateOptions{})
+		require.NoError(t, err)
+		time.Sleep(50 * time.Millisecond)
+		assert.Equal(t, "second", currentCommonName(t, r))
+	})
+}
+
+func Test_CertPoolReloaderWatchFile(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	caPath := filepath.Join(dir, "ca.crt")
+	first, _ := generateReloadTestKeyPair(t, "first")
+	require.NoError(t, os.WriteFile(caPath, first, 0600))
+
+	pool, err := X509CertPoolFromFile(caPath)
+	require.NoError(t, err)
+	r := NewCertPoolReloader(pool)
+	r.WatchFile(ctx, caPath, 10*time.Millisecond)
+	assert.Same(t, pool, r.Pool())
+
+	t.Run("Invalid bundle keeps the current pool", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(caPath, []byte("invalid"), 0600))
+		time.Sleep(50 * time.Millisecond)
+		assert.Same(t, pool, r.Pool())
+	})
+
+	t.Run("Updated bundle is loaded", func(t *testing.T) {
+		second, _ := generateReloadTestKeyPair(t, "second")
+		require.NoError(t, os.WriteFile(caPath, append(first, second...), 0600))
+		expected, err := X509CertPoolFromFile(caPath)
+		require.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			return r.Pool().Equal(expected)
+		}, 2*time.Second, 10*time.Millisecond)
+	})
+}
@@ -0,0 +1,374 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tlsutil
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/internal/logging"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ocsp"
+)
+
+const (
+	// RevocationSourceCRL denotes a check against a certificate revocation
+	// list
+	RevocationSourceCRL = "crl"
+	// RevocationSourceOCSP denotes a check against an OCSP responder
+	RevocationSourceOCSP = "ocsp"
+)
+
+const (
+	// DefaultCRLRefreshInterval is the default interval in which the
+	// configured CRLs are reloaded
+	DefaultCRLRefreshInterval = 5 * time.Minute
+	// DefaultOCSPTimeout is the default timeout for requests to OCSP
+	// responders
+	DefaultOCSPTimeout = 5 * time.Second
+	// defaultOCSPCacheDuration is how long an OCSP response without a next
+	// update time is cached
+	defaultOCSPCacheDuration = time.Hour
+	// maxRevocationResponseSize limits the size of CRLs and OCSP responses
+	// fetched over HTTP
+	maxRevocationResponseSize = 32 << 20
+)
+
+// RevocationConfig configures the revocation checks for client certificates
+type RevocationConfig struct {
+	// CRLs is a list of certificate revocation lists to check against,
+	// each given as a path to a local file or an HTTP(S) URL. The lists can
+	// be in DER or PEM format.
+	CRLs []string
+	// CRLRefreshInterval is the interval in which the CRLs are reloaded. If
+	// not set, DefaultCRLRefreshInterval is used.
+	CRLRefreshInterval time.Duration
+	// OCSP enables checking certificates against the OCSP responders named
+	// in the certificates.
+	OCSP bool
+	// OCSPTimeout is the timeout for requests to OCSP responders. If not
+	// set, DefaultOCSPTimeout is used.
+	OCSPTimeout time.Duration
+	// SoftFail accepts certificates whose revocation status could not be
+	// determined, e.g. because an OCSP responder is unreachable.
+	SoftFail bool
+}
+
+// RevokedError is returned when a certificate has been revoked
+type RevokedError struct {
+	// Source is the source which reported the certificate as revoked, one
+	// of RevocationSourceCRL or RevocationSourceOCSP.
+	Source string
+	Cert   *x509.Certificate
+}
+
+func (e *RevokedError) Error() string {
+	return fmt.Sprintf("certificate %s with serial %s has been revoked (%s)", e.Cert.Subject.CommonName, e.Cert.SerialNumber.String(), e.Source)
+}
+
+// RevocationCheckError is returned when the revocation status of a
+// certificate could not be determined.
+type RevocationCheckError struct {
+	Source string
+	Err    error
+}
+
+func (e *RevocationCheckError) Error() string {
+	return fmt.Sprintf("could not check revocation status (%s): %v", e.Source, e.Err)
+}
+
+func (e *RevocationCheckError) Unwrap() error {
+	return e.Err
+}
+
+// revocationList is a parsed CRL with an index of the revoked serials
+type revocationList struct {
+	source  string
+	crl     *x509.RevocationList
+	revoked map[string]bool
+}
+
+type ocspCacheEntry struct {
+	revoked bool
+	expires time.Time
+}
+
+// RevocationChecker checks client certificates against CRLs and OCSP
+// responders during the TLS handshake.
+type RevocationChecker struct {
+	config RevocationConfig
+	client *http.Client
+
+	mu   sync.RWMutex
+	crls []*revocationList
+
+	ocspMu    sync.Mutex
+	ocspCache map[string]ocspCacheEntry
+
+	// now is used to determine the current time and can be replaced in
+	// tests
+	now func() time.Time
+}
+
+// NewRevocationChecker returns a RevocationChecker for config and loads the
+// configured CRLs. An error is returned if any CRL cannot be loaded.
+func NewRevocationChecker(ctx context.Context, config RevocationConfig) (*RevocationChecker, error) {
+	if len(config.CRLs) == 0 && !config.OCSP {
+		return nil, fmt.Errorf("neither CRLs nor OCSP configured")
+	}
+	if config.CRLRefreshInterval <= 0 {
+		config.CRLRefreshInterval = DefaultCRLRefreshInterval
+	}
+	if config.OCSPTimeout <= 0 {
+		config.OCSPTimeout = DefaultOCSPTimeout
+	}
+	c := &RevocationChecker{
+		config:    config,
+		client:    &http.Client{Timeout: config.OCSPTimeout},
+		ocspCache: make(map[string]ocspCacheEntry),
+		now:       time.Now,
+	}
+	if err := c.LoadCRLs(ctx); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// LoadCRLs (re)loads all configured CRLs. The current CRLs are only
+// replaced when all of them could be loaded.
+func (c *RevocationChecker) LoadCRLs(ctx context.Context) error {
+	crls := make([]*revocationList, 0, len(c.config.CRLs))
+	for _, source := range c.config.CRLs {
+		data, err := c.readCRL(ctx, source)
+		if err != nil {
+			return fmt.Errorf("could not read CRL %s: %w", source, err)
+		}
+		crl, err := parseRevocationList(data)
+		if err != nil {
+			return fmt.Errorf("could not parse CRL %s: %w", source, err)
+		}
+		rl := &revocationList{source: source, crl: crl, revoked: make(map[string]bool, len(crl.RevokedCertificateEntries))}
+		for _, entry := range crl.RevokedCertificateEntries {
+			rl.revoked[entry.SerialNumber.String()] = true
+		}
+		crls = append(crls, rl)
+	}
+	c.mu.Lock()
+	c.crls = crls
+	c.mu.Unlock()
+	return nil
+}
+
+// WatchCRLs reloads the configured CRLs in the configured refresh interval
+// until ctx is done. If a CRL cannot be loaded, the previous ones are kept.
+func (c *RevocationChecker) WatchCRLs(ctx context.Context) {
+	if len(c.config.CRLs) == 0 {
+		return
+	}
+	logCtx := revocationLog()
+	logCtx.Infof("Refreshing CRLs every %v", c.config.CRLRefreshInterval)
+	go func() {
+		ticker := time.NewTicker(c.config.CRLRefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if err := c.LoadCRLs(ctx); err != nil {
+				logCtx.WithError(err).Warn("Keeping current CRLs")
+			}
+		}
+	}()
+}
+
+// VerifyConnection is meant to be used as tls.Config.VerifyConnection. It
+// runs after the regular certificate verification and fails the handshake
+// when the client's certificate has been revoked. The error is either a
+// *RevokedError or, if the status could not be determined and SoftFail is
+// not set, a *RevocationCheckError.
+func (c *RevocationChecker) VerifyConnection(cs tls.ConnectionState) error {
+	for _, chain := range cs.VerifiedChains {
+		if len(chain) < 2 {
+			continue
+		}
+		if err := c.Check(chain[0], chain[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Check checks whether cert, which has been issued by issuer, has been
+// revoked.
+func (c *RevocationChecker) Check(cert, issuer *x509.Certificate) error {
+	if err := c.checkCRLs(cert, issuer); err != nil {
+		return err
+	}
+	if c.config.OCSP {
+		if err := c.checkOCSP(cert, issuer); err != nil {
+			var checkErr *RevocationCheckError
+			if c.config.SoftFail && errors.As(err, &checkErr) {
+				revocationLog().WithError(err).Warnf("Accepting certificate %s", cert.Subject.CommonName)
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// checkCRLs checks cert against all CRLs issued by issuer
+func (c *RevocationChecker) checkCRLs(cert, issuer *x509.Certificate) error {
+	c.mu.RLock()
+	crls := c.crls
+	c.mu.RUnlock()
+	for _, rl := range crls {
+		if !bytes.Equal(rl.crl.RawIssuer, cert.RawIssuer) {
+			continue
+		}
+		if err := rl.crl.CheckSignatureFrom(issuer); err != nil {
+			continue
+		}
+		if !rl.crl.NextUpdate.IsZero() && c.now().After(rl.crl.NextUpdate) {
+			revocationLog().Warnf("CRL %s is out of date since %v", rl.source, rl.crl.NextUpdate)
+		}
+		if rl.revoked[cert.SerialNumber.String()] {
+			return &RevokedError{Source: RevocationSourceCRL, Cert: cert}
+		}
+	}
+	return nil
+}
+
+// checkOCSP checks cert against the OCSP responders named in it. Responses
+// are cached until their next update.
+func (c *RevocationChecker) checkOCSP(cert, issuer *x509.Certificate) error {
+	if len(cert.OCSPServer) == 0 {
+		return nil
+	}
+	key := string(issuer.RawSubjectPublicKeyInfo) + "/" + cert.SerialNumber.String()
+	c.ocspMu.Lock()
+	entry, ok := c.ocspCache[key]
+	c.ocspMu.Unlock()
+	if !ok || c.now().After(entry.expires) {
+		resp, err := c.queryOCSP(cert, issuer)
+		if err != nil {
+			return &RevocationCheckError{Source: RevocationSourceOCSP, Err: err}
+		}
+		switch resp.Status {
+		case ocsp.Good, ocsp.Revoked:
+		default:
+			return &RevocationCheckError{Source: RevocationSourceOCSP, Err: fmt.Errorf("status of certificate %s is unknown", cert.Subject.CommonName)}
+		}
+		entry = ocspCacheEntry{revoked: resp.Status == ocsp.Revoked, expires: resp.NextUpdate}
+		if entry.expires.IsZero() {
+			entry.expires = c.now().Add(defaultOCSPCacheDuration)
+		}
+		c.ocspMu.Lock()
+		c.ocspCache[key] = entry
+		c.ocspMu.Unlock()
+	}
+	if entry.revoked {
+		return &RevokedError{Source: RevocationSourceOCSP, Cert: cert}
+	}
+	return nil
+}
+
+// queryOCSP queries the OCSP responders of cert in order and returns the
+// first valid response.
+func (c *RevocationChecker) queryOCSP(cert, issuer *x509.Certificate) (*ocsp.Response, error) {
+	req, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not create OCSP request: %w", err)
+	}
+	var lastErr error
+	for _, server := range cert.OCSPServer {
+		ctx, cancel := context.WithTimeout(context.Background(), c.config.OCSPTimeout)
+		data, err := c.post(ctx, server, req)
+		cancel()
+		if err != nil {
+			lastErr = fmt.Errorf("OCSP request to %s failed: %w", server, err)
+			continue
+		}
+		resp, err := ocsp.ParseResponseForCert(data, cert, issuer)
+		if err != nil {
+			lastErr = fmt.Errorf("invalid OCSP response from %s: %w", server, err)
+			continue
+		}
+		return resp, nil
+	}
+	return nil, lastErr
+}
+
+func (c *RevocationChecker) post(ctx context.Context, url string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/ocsp-request")
+	req.Header.Set("Accept", "application/ocsp-response")
+	return c.do(req)
+}
+
+func (c *RevocationChecker) do(req *http.Request) ([]byte, error) {
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxRevocationResponseSize))
+}
+
+// readCRL reads the CRL from source, which is either a URL or a file path
+func (c *RevocationChecker) readCRL(ctx context.Context, source string) ([]byte, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return os.ReadFile(source)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(req)
+}
+
+// parseRevocationList parses a CRL in either PEM or DER format
+func parseRevocationList(data []byte) (*x509.RevocationList, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		if block.Type != "X509 CRL" {
+			return nil, fmt.Errorf("unexpected PEM block of type %s", block.Type)
+		}
+		data = block.Bytes
+	}
+	return x509.ParseRevocationList(data)
+}
+
+func revocationLog() *logrus.Entry {
+	return logging.GetDefaultLogger().ComponentLogger("RevocationChecker")
+}
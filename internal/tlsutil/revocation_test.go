@@ -0,0 +1,223 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tlsutil
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ocsp"
+)
+
+type revocationTestCA struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+func newRevocationTestCA(t *testing.T) *revocationTestCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	templ := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, templ, templ, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &revocationTestCA{cert: cert, key: key}
+}
+
+func (ca *revocationTestCA) issue(t *testing.T, serial int64, ocspServer string) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	templ := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "agent"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if ocspServer != "" {
+		templ.OCSPServer = []string{ocspServer}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, templ, ca.cert, key.Public(), ca.key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+func (ca *revocationTestCA) crl(t *testing.T, revoked ...int64) []byte {
+	t.Helper()
+	templ := &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now().Add(-time.Minute),
+		NextUpdate: time.Now().Add(time.Hour),
+	}
+	for _, serial := range revoked {
+		templ.RevokedCertificateEntries = append(templ.RevokedCertificateEntries, x509.RevocationListEntry{
+			SerialNumber:   big.NewInt(serial),
+			RevocationTime: time.Now().Add(-time.Minute),
+		})
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, templ, ca.cert, ca.key)
+	require.NoError(t, err)
+	return der
+}
+
+// ocspResponder returns a test OCSP responder reporting the serials in
+// revoked as revoked, and all others as good.
+func (ca *revocationTestCA) ocspResponder(t *testing.T, requests *atomic.Int32, revoked ...int64) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		req, err := ocsp.ParseRequest(body)
+		require.NoError(t, err)
+		templ := ocsp.Response{
+			Status:       ocsp.Good,
+			SerialNumber: req.SerialNumber,
+			ThisUpdate:   time.Now().Add(-time.Minute),
+			NextUpdate:   time.Now().Add(time.Hour),
+		}
+		for _, serial := range revoked {
+			if req.SerialNumber.Int64() == serial {
+				templ.Status = ocsp.Revoked
+				templ.RevokedAt = time.Now().Add(-time.Minute)
+			}
+		}
+		resp, err := ocsp.CreateResponse(ca.cert, ca.cert, templ, ca.key)
+		require.NoError(t, err)
+		_, _ = w.Write(resp)
+	}))
+}
+
+func Test_RevocationChecker_CRL(t *testing.T) {
+	ca := newRevocationTestCA(t)
+	other := newRevocationTestCA(t)
+	dir := t.TempDir()
+	crlPath := filepath.Join(dir, "ca.crl")
+	require.NoError(t, os.WriteFile(crlPath, ca.crl(t, 2), 0600))
+	// A CRL of another CA must not affect certificates of ca
+	otherPath := filepath.Join(dir, "other.crl")
+	require.NoError(t, os.WriteFile(otherPath, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: other.crl(t, 3)}), 0600))
+
+	c, err := NewRevocationChecker(context.Background(), RevocationConfig{CRLs: []string{crlPath, otherPath}})
+	require.NoError(t, err)
+
+	t.Run("Valid certificate is accepted", func(t *testing.T) {
+		assert.NoError(t, c.Check(ca.issue(t, 3, ""), ca.cert))
+	})
+	t.Run("Revoked certificate is rejected", func(t *testing.T) {
+		err := c.VerifyConnection(tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{ca.issue(t, 2, ""), ca.cert}}})
+		var revokedErr *RevokedError
+		require.ErrorAs(t, err, &revokedErr)
+		assert.Equal(t, RevocationSourceCRL, revokedErr.Source)
+	})
+	t.Run("Reloaded CRL is used", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(crlPath, ca.crl(t, 2, 3), 0600))
+		require.NoError(t, c.LoadCRLs(context.Background()))
+		assert.Error(t, c.Check(ca.issue(t, 3, ""), ca.cert))
+	})
+	t.Run("Invalid CRL keeps the current ones", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(crlPath, []byte("invalid"), 0600))
+		assert.Error(t, c.LoadCRLs(context.Background()))
+		assert.Error(t, c.Check(ca.issue(t, 2, ""), ca.cert))
+	})
+	t.Run("Missing CRL", func(t *testing.T) {
+		_, err := NewRevocationChecker(context.Background(), RevocationConfig{CRLs: []string{filepath.Join(dir, "missing")}})
+		assert.ErrorContains(t, err, "could not read CRL")
+	})
+	t.Run("CRL from URL", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write(ca.crl(t, 4))
+		}))
+		defer srv.Close()
+		c, err := NewRevocationChecker(context.Background(), RevocationConfig{CRLs: []string{srv.URL}})
+		require.NoError(t, err)
+		assert.Error(t, c.Check(ca.issue(t, 4, ""), ca.cert))
+		assert.NoError(t, c.Check(ca.issue(t, 5, ""), ca.cert))
+	})
+}
+
+func Test_RevocationChecker_OCSP(t *testing.T) {
+	ca := newRevocationTestCA(t)
+	requests := &atomic.Int32{}
+	srv := ca.ocspResponder(t, requests, 2)
+	defer srv.Close()
+
+	c, err := NewRevocationChecker(context.Background(), RevocationConfig{OCSP: true})
+	require.NoError(t, err)
+
+	t.Run("Good certificate is accepted and cached", func(t *testing.T) {
+		cert := ca.issue(t, 3, srv.URL)
+		assert.NoError(t, c.Check(cert, ca.cert))
+		assert.NoError(t, c.Check(cert, ca.cert))
+		assert.Equal(t, int32(1), requests.Load())
+	})
+	t.Run("Revoked certificate is rejected", func(t *testing.T) {
+		err := c.Check(ca.issue(t, 2, srv.URL), ca.cert)
+		var revokedErr *RevokedError
+		require.ErrorAs(t, err, &revokedErr)
+		assert.Equal(t, RevocationSourceOCSP, revokedErr.Source)
+	})
+	t.Run("Certificate without responder is accepted", func(t *testing.T) {
+		assert.NoError(t, c.Check(ca.issue(t, 2, ""), ca.cert))
+	})
+	t.Run("Unreachable responder", func(t *testing.T) {
+		unreachable := httptest.NewServer(http.NotFoundHandler())
+		unreachable.Close()
+		cert := ca.issue(t, 4, unreachable.URL)
+
+		var checkErr *RevocationCheckError
+		assert.ErrorAs(t, c.Check(cert, ca.cert), &checkErr)
+
+		soft, err := NewRevocationChecker(context.Background(), RevocationConfig{OCSP: true, SoftFail: true})
+		require.NoError(t, err)
+		assert.NoError(t, soft.Check(cert, ca.cert))
+	})
+}
+
+func Test_NewRevocationChecker(t *testing.T) {
+	_, err := NewRevocationChecker(context.Background(), RevocationConfig{})
+	assert.ErrorContains(t, err, "neither CRLs nor OCSP")
+}
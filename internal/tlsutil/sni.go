@@ -0,0 +1,58 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tlsutil
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+)
+
+// CertificateSelector selects the certificate to serve by the server name
+// the client requested using SNI. The certificates are held by reloaders, so
+// each of them can be renewed independently.
+type CertificateSelector struct {
+	def *CertificateReloader
+	sni []*CertificateReloader
+}
+
+// NewCertificateSelector returns a CertificateSelector serving the first of
+// the sni certificates that is valid for the requested server name, or def
+// if there is none or the client did not request a server name.
+func NewCertificateSelector(def *CertificateReloader, sni ...*CertificateReloader) *CertificateSelector {
+	return &CertificateSelector{def: def, sni: sni}
+}
+
+// GetCertificate returns the certificate for the server name requested in
+// hello. It can be used as tls.Config.GetCertificate.
+func (s *CertificateSelector) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if hello != nil && hello.ServerName != "" {
+		for _, r := range s.sni {
+			if cert := r.Certificate(); cert != nil && hello.SupportsCertificate(cert) == nil {
+				return cert, nil
+			}
+		}
+	}
+	return s.def.GetCertificate(hello)
+}
+
+// ParseKeyPairPaths parses a key pair given as "<cert path>:<key path>"
+func ParseKeyPairPaths(keyPair string) (certPath string, keyPath string, err error) {
+	certPath, keyPath, ok := strings.Cut(keyPair, ":")
+	if !ok || certPath == "" || keyPath == "" {
+		return "", "", fmt.Errorf("invalid key pair '%s': must be <cert path>:<key path>", keyPair)
+	}
+	return certPath, keyPath, nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tlsutil
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_CertificateSelector(t *testing.T) {
+	caData, caKeyData, err := GenerateCaCertificate("test", DefaultCACertValidityDays, KeyGenOptions{})
+	require.NoError(t, err)
+	ca, err := tls.X509KeyPair([]byte(caData), []byte(caKeyData))
+	require.NoError(t, err)
+	serverCert := func(name string, dns ...string) *CertificateReloader {
+		certData, keyData, err := GenerateServerCertificate(name, ca.Leaf, ca.PrivateKey, nil, dns, DefaultCACertValidityDays, KeyGenOptions{})
+		require.NoError(t, err)
+		cert, err := tls.X509KeyPair([]byte(certData), []byte(keyData))
+		require.NoError(t, err)
+		return NewCertificateReloader(cert)
+	}
+
+	s := NewCertificateSelector(
+		serverCert("default", "principal.internal"),
+		serverCert("external", "principal.example.com"),
+		serverCert("wildcard", "*.agents.example.com"),
+	)
+	served := func(serverName string) string {
+		cert, err := s.GetCertificate(&tls.ClientHelloInfo{
+			ServerName:        serverName,
+			CipherSuites:      []uint16{tls.TLS_AES_128_GCM_SHA256},
+			SupportedVersions: []uint16{tls.VersionTLS13},
+			SignatureSchemes:  []tls.SignatureScheme{tls.PSSWithSHA256},
+		})
+		require.NoError(t, err)
+		return cert.Leaf.Subject.CommonName
+	}
+
+	assert.Equal(t, "external", served("principal.example.com"))
+	assert.Equal(t, "wildcard", served("eu.agents.example.com"))
+	assert.Equal(t, "default", served("principal.internal"))
+	assert.Equal(t, "default", served("unknown.example.com"))
+	assert.Equal(t, "default", served(""))
+}
+
+func Test_ParseKeyPairPaths(t *testing.T) {
+	certPath, keyPath, err := ParseKeyPairPaths("/etc/tls/tls.crt:/etc/tls/tls.key")
+	require.NoError(t, err)
+	assert.Equal(t, "/etc/tls/tls.crt", certPath)
+	assert.Equal(t, "/etc/tls/tls.key", keyPath)
+
+	for _, kp := range []string{"/etc/tls/tls.crt", ":/etc/tls/tls.key", "/etc/tls/tls.crt:"} {
+		_, _, err := ParseKeyPairPaths(kp)
+		assert.Errorf(t, err, "%s should be invalid", kp)
+	}
+}
@@ -54,7 +54,8 @@ func TLSCertFromFile(certPath string, keyPath string, strict bool) (tls.Certific
 
 // TLSCertFromX509 generates a TLS certificate for the x509 certificate cert
 // and the private key key.
-// This function supports RSA and EC types of private keys.
+// This function supports RSA, EC and Ed25519 types of private keys, as well
+// as any other crypto.Signer.
 func TLSCertFromX509(cert *x509.Certificate, key crypto.PrivateKey) (tls.Certificate, error) {
 	cBytes := &bytes.Buffer{}
 	kBytes := &bytes.Buffer{}
@@ -76,6 +77,11 @@ func TLSCertFromX509(cert *x509.Certificate, key crypto.PrivateKey) (tls.Certifi
 		if err != nil {
 			return tls.Certificate{}, fmt.Errorf("error encoding private key to PEM: %w", err)
 		}
+	case crypto.Signer:
+		// The key cannot be exported, e.g. because it is held in a hardware
+		// security module, so the certificate is built without a PEM round
+		// trip.
+		return tlsCertFromSigner(cert, pk)
 	default:
 		return tls.Certificate{}, fmt.Errorf("unknown private key type: %T", pk)
 	}
@@ -88,6 +94,20 @@ func TLSCertFromX509(cert *x509.Certificate, key crypto.PrivateKey) (tls.Certifi
 	return tlsCert, nil
 }
 
+// tlsCertFromSigner returns a TLS certificate for cert, using signer as the
+// private key after verifying that it belongs to the certificate.
+func tlsCertFromSigner(cert *x509.Certificate, signer crypto.Signer) (tls.Certificate, error) {
+	leaf, err := x509.ParseCertificate(cert.Raw)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("error parsing certificate: %w", err)
+	}
+	pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !pub.Equal(leaf.PublicKey) {
+		return tls.Certificate{}, fmt.Errorf("private key does not match public key in certificate")
+	}
+	return tls.Certificate{Certificate: [][]byte{leaf.Raw}, PrivateKey: signer, Leaf: leaf}, nil
+}
+
 func X509CertPoolFromFile(path string) (*x509.CertPool, error) {
 	b, err := os.ReadFile(path)
 	if err != nil {
@@ -102,6 +122,44 @@ func X509CertPoolFromFile(path string) (*x509.CertPool, error) {
 	return pool, nil
 }
 
+// X509CertsFromFile parses all certificates from the PEM data in the file at
+// path. Like X509CertPoolFromFile, it fails if the file holds no valid
+// certificate.
+func X509CertsFromFile(path string) ([]*x509.Certificate, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	certs := X509CertsFromPEM(b)
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("%s: invalid PEM data", path)
+	}
+	return certs, nil
+}
+
+// X509CertsFromPEM parses all certificates from the PEM data in b. Blocks
+// which are not certificates, or cannot be parsed, are skipped the same way
+// x509.CertPool.AppendCertsFromPEM skips them.
+func X509CertsFromPEM(b []byte) []*x509.Certificate {
+	var certs []*x509.Certificate
+	for len(b) > 0 {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" || len(block.Headers) != 0 {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			continue
+		}
+		certs = append(certs, cert)
+	}
+	return certs
+}
+
 func CertDataToPEM(b []byte) (string, error) {
 	certPem := new(bytes.Buffer)
 	err := pem.Encode(certPem, &pem.Block{
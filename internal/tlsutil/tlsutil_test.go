@@ -15,6 +15,7 @@
 package tlsutil
 
 import (
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/rand"
 	"crypto/rsa"
@@ -113,6 +114,22 @@ func Test_TlsCertFromX509(t *testing.T) {
 		require.NoError(t, err)
 		require.NotNil(t, tlsCert)
 	})
+	t.Run("Non-exportable signer", func(t *testing.T) {
+		key := testcerts.GeneratePrivateKey(t, "ecdsa").(*ecdsa.PrivateKey)
+		raw, err := x509.CreateCertificate(rand.Reader, &testcerts.DefaultCertTempl, &testcerts.DefaultCertTempl, &key.PublicKey, key)
+		require.NoError(t, err)
+		cert := testcerts.DefaultCertTempl
+		cert.Raw = raw
+		// Hides the key's type, so it cannot be marshaled
+		signer := struct{ crypto.Signer }{key}
+		tlsCert, err := TLSCertFromX509(&cert, signer)
+		require.NoError(t, err)
+		assert.Equal(t, signer, tlsCert.PrivateKey)
+
+		other := testcerts.GeneratePrivateKey(t, "ecdsa").(*ecdsa.PrivateKey)
+		_, err = TLSCertFromX509(&cert, struct{ crypto.Signer }{other})
+		assert.ErrorContains(t, err, "does not match")
+	})
 }
 
 func Test_TLSVersionName(t *testing.T) {
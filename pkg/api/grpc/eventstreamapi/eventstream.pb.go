@@ -14,7 +14,7 @@
 
 // Code generated by protoc-gen-go. DO NOT EDIT.
 // versions:
-// 	protoc-gen-go v1.28.1
+// 	protoc-gen-go v1.36.11
 // 	protoc        v4.25.3
 // source: eventstream.proto
 
@@ -28,6 +28,7 @@ import (
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
 	reflect "reflect"
 	sync "sync"
+	unsafe "unsafe"
 )
 
 const (
@@ -39,20 +40,17 @@ const (
 
 // Event describes an event
 type Event struct {
-	state         protoimpl.MessageState
-	sizeCache     protoimpl.SizeCache
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Event         *pb.CloudEvent         `protobuf:"bytes,1,opt,name=event,proto3" json:"event,omitempty"`
 	unknownFields protoimpl.UnknownFields
-
-	Event *pb.CloudEvent `protobuf:"bytes,1,opt,name=event,proto3" json:"event,omitempty"`
+	sizeCache     protoimpl.SizeCache
 }
 
 func (x *Event) Reset() {
 	*x = Event{}
-	if protoimpl.UnsafeEnabled {
-		mi := &file_eventstream_proto_msgTypes[0]
-		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-		ms.StoreMessageInfo(mi)
-	}
+	mi := &file_eventstream_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
 }
 
 func (x *Event) String() string {
@@ -63,7 +61,7 @@ func (*Event) ProtoMessage() {}
 
 func (x *Event) ProtoReflect() protoreflect.Message {
 	mi := &file_eventstream_proto_msgTypes[0]
-	if protoimpl.UnsafeEnabled && x != nil {
+	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
 			ms.StoreMessageInfo(mi)
@@ -86,22 +84,19 @@ func (x *Event) GetEvent() *pb.CloudEvent {
 }
 
 type PushSummary struct {
-	state         protoimpl.MessageState
-	sizeCache     protoimpl.SizeCache
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Result        string                 `protobuf:"bytes,1,opt,name=result,proto3" json:"result,omitempty"`
+	Received      int32                  `protobuf:"varint,2,opt,name=received,proto3" json:"received,omitempty"`
+	Processed     int32                  `protobuf:"varint,3,opt,name=processed,proto3" json:"processed,omitempty"`
 	unknownFields protoimpl.UnknownFields
-
-	Result    string `protobuf:"bytes,1,opt,name=result,proto3" json:"result,omitempty"`
-	Received  int32  `protobuf:"varint,2,opt,name=received,proto3" json:"received,omitempty"`
-	Processed int32  `protobuf:"varint,3,opt,name=processed,proto3" json:"processed,omitempty"`
+	sizeCache     protoimpl.SizeCache
 }
 
 func (x *PushSummary) Reset() {
 	*x = PushSummary{}
-	if protoimpl.UnsafeEnabled {
-		mi := &file_eventstream_proto_msgTypes[1]
-		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-		ms.StoreMessageInfo(mi)
-	}
+	mi := &file_eventstream_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
 }
 
 func (x *PushSummary) String() string {
@@ -112,7 +107,7 @@ func (*PushSummary) ProtoMessage() {}
 
 func (x *PushSummary) ProtoReflect() protoreflect.Message {
 	mi := &file_eventstream_proto_msgTypes[1]
-	if protoimpl.UnsafeEnabled && x != nil {
+	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
 			ms.StoreMessageInfo(mi)
@@ -149,18 +144,16 @@ func (x *PushSummary) GetProcessed() int32 {
 }
 
 type PingRequest struct {
-	state         protoimpl.MessageState
-	sizeCache     protoimpl.SizeCache
+	state         protoimpl.MessageState `protogen:"open.v1"`
 	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
 }
 
 func (x *PingRequest) Reset() {
 	*x = PingRequest{}
-	if protoimpl.UnsafeEnabled {
-		mi := &file_eventstream_proto_msgTypes[2]
-		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-		ms.StoreMessageInfo(mi)
-	}
+	mi := &file_eventstream_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
 }
 
 func (x *PingRequest) String() string {
@@ -171,7 +164,7 @@ func (*PingRequest) ProtoMessage() {}
 
 func (x *PingRequest) ProtoReflect() protoreflect.Message {
 	mi := &file_eventstream_proto_msgTypes[2]
-	if protoimpl.UnsafeEnabled && x != nil {
+	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
 			ms.StoreMessageInfo(mi)
@@ -187,18 +180,16 @@ func (*PingRequest) Descriptor() ([]byte, []int) {
 }
 
 type PongReply struct {
-	state         protoimpl.MessageState
-	sizeCache     protoimpl.SizeCache
+	state         protoimpl.MessageState `protogen:"open.v1"`
 	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
 }
 
 func (x *PongReply) Reset() {
 	*x = PongReply{}
-	if protoimpl.UnsafeEnabled {
-		mi := &file_eventstream_proto_msgTypes[3]
-		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-		ms.StoreMessageInfo(mi)
-	}
+	mi := &file_eventstream_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
 }
 
 func (x *PongReply) String() string {
@@ -209,7 +200,7 @@ func (*PongReply) ProtoMessage() {}
 
 func (x *PongReply) ProtoReflect() protoreflect.Message {
 	mi := &file_eventstream_proto_msgTypes[3]
-	if protoimpl.UnsafeEnabled && x != nil {
+	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
 			ms.StoreMessageInfo(mi)
@@ -224,90 +215,176 @@ func (*PongReply) Descriptor() ([]byte, []int) {
 	return file_eventstream_proto_rawDescGZIP(), []int{3}
 }
 
-var File_eventstream_proto protoreflect.FileDescriptor
+// PayloadChunk is a chunk of a payload that is transferred out of band
+type PayloadChunk struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// handle is the handle of the payload. It is only set when downloading
+	Handle        string `protobuf:"bytes,1,opt,name=handle,proto3" json:"handle,omitempty"`
+	Data          []byte `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PayloadChunk) Reset() {
+	*x = PayloadChunk{}
+	mi := &file_eventstream_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PayloadChunk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PayloadChunk) ProtoMessage() {}
+
+func (x *PayloadChunk) ProtoReflect() protoreflect.Message {
+	mi := &file_eventstream_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PayloadChunk.ProtoReflect.Descriptor instead.
+func (*PayloadChunk) Descriptor() ([]byte, []int) {
+	return file_eventstream_proto_rawDescGZIP(), []int{4}
+}
 
-var file_eventstream_proto_rawDesc = []byte{
-	0x0a, 0x11, 0x65, 0x76, 0x65, 0x6e, 0x74, 0x73, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x2e, 0x70, 0x72,
-	0x6f, 0x74, 0x6f, 0x12, 0x0e, 0x65, 0x76, 0x65, 0x6e, 0x74, 0x73, 0x74, 0x72, 0x65, 0x61, 0x6d,
-	0x61, 0x70, 0x69, 0x1a, 0x1c, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x61, 0x70, 0x69, 0x2f,
-	0x61, 0x6e, 0x6e, 0x6f, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x2e, 0x70, 0x72, 0x6f, 0x74,
-	0x6f, 0x1a, 0x4c, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x61, 0x72,
-	0x67, 0x6f, 0x70, 0x72, 0x6f, 0x6a, 0x2f, 0x61, 0x72, 0x67, 0x6f, 0x2d, 0x63, 0x64, 0x2f, 0x76,
-	0x33, 0x2f, 0x70, 0x6b, 0x67, 0x2f, 0x61, 0x70, 0x69, 0x73, 0x2f, 0x61, 0x70, 0x70, 0x6c, 0x69,
-	0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x2f, 0x76, 0x31, 0x61, 0x6c, 0x70, 0x68, 0x61, 0x31, 0x2f,
-	0x67, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x65, 0x64, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x1a,
-	0x4c, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x63, 0x6c, 0x6f, 0x75,
-	0x64, 0x65, 0x76, 0x65, 0x6e, 0x74, 0x73, 0x2f, 0x73, 0x64, 0x6b, 0x2d, 0x67, 0x6f, 0x2f, 0x62,
-	0x69, 0x6e, 0x64, 0x69, 0x6e, 0x67, 0x2f, 0x66, 0x6f, 0x72, 0x6d, 0x61, 0x74, 0x2f, 0x70, 0x72,
-	0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x76, 0x32, 0x2f, 0x70, 0x62, 0x2f, 0x63, 0x6c, 0x6f,
-	0x75, 0x64, 0x65, 0x76, 0x65, 0x6e, 0x74, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x3c, 0x0a,
-	0x05, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x12, 0x33, 0x0a, 0x05, 0x65, 0x76, 0x65, 0x6e, 0x74, 0x18,
-	0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1d, 0x2e, 0x69, 0x6f, 0x2e, 0x63, 0x6c, 0x6f, 0x75, 0x64,
-	0x65, 0x76, 0x65, 0x6e, 0x74, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x43, 0x6c, 0x6f, 0x75, 0x64, 0x45,
-	0x76, 0x65, 0x6e, 0x74, 0x52, 0x05, 0x65, 0x76, 0x65, 0x6e, 0x74, 0x22, 0x5f, 0x0a, 0x0b, 0x50,
-	0x75, 0x73, 0x68, 0x53, 0x75, 0x6d, 0x6d, 0x61, 0x72, 0x79, 0x12, 0x16, 0x0a, 0x06, 0x72, 0x65,
-	0x73, 0x75, 0x6c, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x72, 0x65, 0x73, 0x75,
-	0x6c, 0x74, 0x12, 0x1a, 0x0a, 0x08, 0x72, 0x65, 0x63, 0x65, 0x69, 0x76, 0x65, 0x64, 0x18, 0x02,
-	0x20, 0x01, 0x28, 0x05, 0x52, 0x08, 0x72, 0x65, 0x63, 0x65, 0x69, 0x76, 0x65, 0x64, 0x12, 0x1c,
-	0x0a, 0x09, 0x70, 0x72, 0x6f, 0x63, 0x65, 0x73, 0x73, 0x65, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28,
-	0x05, 0x52, 0x09, 0x70, 0x72, 0x6f, 0x63, 0x65, 0x73, 0x73, 0x65, 0x64, 0x22, 0x0d, 0x0a, 0x0b,
-	0x50, 0x69, 0x6e, 0x67, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x22, 0x0b, 0x0a, 0x09, 0x50,
-	0x6f, 0x6e, 0x67, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x32, 0x9c, 0x02, 0x0a, 0x0b, 0x45, 0x76, 0x65,
-	0x6e, 0x74, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x12, 0x5c, 0x0a, 0x09, 0x53, 0x75, 0x62, 0x73,
-	0x63, 0x72, 0x69, 0x62, 0x65, 0x12, 0x15, 0x2e, 0x65, 0x76, 0x65, 0x6e, 0x74, 0x73, 0x74, 0x72,
-	0x65, 0x61, 0x6d, 0x61, 0x70, 0x69, 0x2e, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x1a, 0x15, 0x2e, 0x65,
-	0x76, 0x65, 0x6e, 0x74, 0x73, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x61, 0x70, 0x69, 0x2e, 0x45, 0x76,
-	0x65, 0x6e, 0x74, 0x22, 0x1d, 0x82, 0xd3, 0xe4, 0x93, 0x02, 0x17, 0x12, 0x15, 0x2f, 0x61, 0x70,
-	0x69, 0x2f, 0x76, 0x31, 0x2f, 0x65, 0x76, 0x65, 0x6e, 0x74, 0x73, 0x2f, 0x73, 0x74, 0x72, 0x65,
-	0x61, 0x6d, 0x28, 0x01, 0x30, 0x01, 0x12, 0x59, 0x0a, 0x04, 0x50, 0x75, 0x73, 0x68, 0x12, 0x15,
-	0x2e, 0x65, 0x76, 0x65, 0x6e, 0x74, 0x73, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x61, 0x70, 0x69, 0x2e,
-	0x45, 0x76, 0x65, 0x6e, 0x74, 0x1a, 0x1b, 0x2e, 0x65, 0x76, 0x65, 0x6e, 0x74, 0x73, 0x74, 0x72,
-	0x65, 0x61, 0x6d, 0x61, 0x70, 0x69, 0x2e, 0x50, 0x75, 0x73, 0x68, 0x53, 0x75, 0x6d, 0x6d, 0x61,
-	0x72, 0x79, 0x22, 0x1b, 0x82, 0xd3, 0xe4, 0x93, 0x02, 0x15, 0x12, 0x13, 0x2f, 0x61, 0x70, 0x69,
-	0x2f, 0x76, 0x31, 0x2f, 0x65, 0x76, 0x65, 0x6e, 0x74, 0x73, 0x2f, 0x70, 0x75, 0x73, 0x68, 0x28,
-	0x01, 0x12, 0x54, 0x0a, 0x04, 0x50, 0x69, 0x6e, 0x67, 0x12, 0x1b, 0x2e, 0x65, 0x76, 0x65, 0x6e,
-	0x74, 0x73, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x61, 0x70, 0x69, 0x2e, 0x50, 0x69, 0x6e, 0x67, 0x52,
-	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x19, 0x2e, 0x65, 0x76, 0x65, 0x6e, 0x74, 0x73, 0x74,
-	0x72, 0x65, 0x61, 0x6d, 0x61, 0x70, 0x69, 0x2e, 0x50, 0x6f, 0x6e, 0x67, 0x52, 0x65, 0x70, 0x6c,
-	0x79, 0x22, 0x14, 0x82, 0xd3, 0xe4, 0x93, 0x02, 0x0e, 0x12, 0x0c, 0x2f, 0x61, 0x70, 0x69, 0x2f,
-	0x76, 0x31, 0x2f, 0x70, 0x69, 0x6e, 0x67, 0x42, 0x43, 0x5a, 0x41, 0x67, 0x69, 0x74, 0x68, 0x75,
-	0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x61, 0x72, 0x67, 0x6f, 0x70, 0x72, 0x6f, 0x6a, 0x2d, 0x6c,
-	0x61, 0x62, 0x73, 0x2f, 0x61, 0x72, 0x67, 0x6f, 0x63, 0x64, 0x2d, 0x61, 0x67, 0x65, 0x6e, 0x74,
-	0x2f, 0x70, 0x6b, 0x67, 0x2f, 0x61, 0x70, 0x69, 0x2f, 0x67, 0x72, 0x70, 0x63, 0x2f, 0x65, 0x76,
-	0x65, 0x6e, 0x74, 0x73, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x61, 0x70, 0x69, 0x62, 0x06, 0x70, 0x72,
-	0x6f, 0x74, 0x6f, 0x33,
+func (x *PayloadChunk) GetHandle() string {
+	if x != nil {
+		return x.Handle
+	}
+	return ""
+}
+
+func (x *PayloadChunk) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+// PayloadRef references a payload that is transferred out of band
+type PayloadRef struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Handle        string                 `protobuf:"bytes,1,opt,name=handle,proto3" json:"handle,omitempty"`
+	Size          int64                  `protobuf:"varint,2,opt,name=size,proto3" json:"size,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PayloadRef) Reset() {
+	*x = PayloadRef{}
+	mi := &file_eventstream_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PayloadRef) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PayloadRef) ProtoMessage() {}
+
+func (x *PayloadRef) ProtoReflect() protoreflect.Message {
+	mi := &file_eventstream_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PayloadRef.ProtoReflect.Descriptor instead.
+func (*PayloadRef) Descriptor() ([]byte, []int) {
+	return file_eventstream_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *PayloadRef) GetHandle() string {
+	if x != nil {
+		return x.Handle
+	}
+	return ""
+}
+
+func (x *PayloadRef) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
 }
 
+var File_eventstream_proto protoreflect.FileDescriptor
+
+const file_eventstream_proto_rawDesc = "" +
+	"\n" +
+	"\x11eventstream.proto\x12\x0eeventstreamapi\x1a\x1cgoogle/api/annotations.proto\x1aLgithub.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1/generated.proto\x1aLgithub.com/cloudevents/sdk-go/binding/format/protobuf/v2/pb/cloudevent.proto\"<\n" +
+	"\x05Event\x123\n" +
+	"\x05event\x18\x01 \x01(\v2\x1d.io.cloudevents.v1.CloudEventR\x05event\"_\n" +
+	"\vPushSummary\x12\x16\n" +
+	"\x06result\x18\x01 \x01(\tR\x06result\x12\x1a\n" +
+	"\breceived\x18\x02 \x01(\x05R\breceived\x12\x1c\n" +
+	"\tprocessed\x18\x03 \x01(\x05R\tprocessed\"\r\n" +
+	"\vPingRequest\"\v\n" +
+	"\tPongReply\":\n" +
+	"\fPayloadChunk\x12\x16\n" +
+	"\x06handle\x18\x01 \x01(\tR\x06handle\x12\x12\n" +
+	"\x04data\x18\x02 \x01(\fR\x04data\"8\n" +
+	"\n" +
+	"PayloadRef\x12\x16\n" +
+	"\x06handle\x18\x01 \x01(\tR\x06handle\x12\x12\n" +
+	"\x04size\x18\x02 \x01(\x03R\x04size2\xb8\x03\n" +
+	"\vEventStream\x12\\\n" +
+	"\tSubscribe\x12\x15.eventstreamapi.Event\x1a\x15.eventstreamapi.Event\"\x1d\x82\xd3\xe4\x93\x02\x17\x12\x15/api/v1/events/stream(\x010\x01\x12Y\n" +
+	"\x04Push\x12\x15.eventstreamapi.Event\x1a\x1b.eventstreamapi.PushSummary\"\x1b\x82\xd3\xe4\x93\x02\x15\x12\x13/api/v1/events/push(\x01\x12T\n" +
+	"\x04Ping\x12\x1b.eventstreamapi.PingRequest\x1a\x19.eventstreamapi.PongReply\"\x14\x82\xd3\xe4\x93\x02\x0e\x12\f/api/v1/ping\x12K\n" +
+	"\rUploadPayload\x12\x1c.eventstreamapi.PayloadChunk\x1a\x1a.eventstreamapi.PayloadRef(\x01\x12M\n" +
+	"\x0fDownloadPayload\x12\x1a.eventstreamapi.PayloadRef\x1a\x1c.eventstreamapi.PayloadChunk0\x01BCZAgithub.com/argoproj-labs/argocd-agent/pkg/api/grpc/eventstreamapib\x06proto3"
+
 var (
 	file_eventstream_proto_rawDescOnce sync.Once
-	file_eventstream_proto_rawDescData = file_eventstream_proto_rawDesc
+	file_eventstream_proto_rawDescData []byte
 )
 
 func file_eventstream_proto_rawDescGZIP() []byte {
 	file_eventstream_proto_rawDescOnce.Do(func() {
-		file_eventstream_proto_rawDescData = protoimpl.X.CompressGZIP(file_eventstream_proto_rawDescData)
+		file_eventstream_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_eventstream_proto_rawDesc), len(file_eventstream_proto_rawDesc)))
 	})
 	return file_eventstream_proto_rawDescData
 }
 
-var file_eventstream_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
-var file_eventstream_proto_goTypes = []interface{}{
+var file_eventstream_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_eventstream_proto_goTypes = []any{
 	(*Event)(nil),         // 0: eventstreamapi.Event
 	(*PushSummary)(nil),   // 1: eventstreamapi.PushSummary
 	(*PingRequest)(nil),   // 2: eventstreamapi.PingRequest
 	(*PongReply)(nil),     // 3: eventstreamapi.PongReply
-	(*pb.CloudEvent)(nil), // 4: io.cloudevents.v1.CloudEvent
+	(*PayloadChunk)(nil),  // 4: eventstreamapi.PayloadChunk
+	(*PayloadRef)(nil),    // 5: eventstreamapi.PayloadRef
+	(*pb.CloudEvent)(nil), // 6: io.cloudevents.v1.CloudEvent
 }
 var file_eventstream_proto_depIdxs = []int32{
-	4, // 0: eventstreamapi.Event.event:type_name -> io.cloudevents.v1.CloudEvent
+	6, // 0: eventstreamapi.Event.event:type_name -> io.cloudevents.v1.CloudEvent
 	0, // 1: eventstreamapi.EventStream.Subscribe:input_type -> eventstreamapi.Event
 	0, // 2: eventstreamapi.EventStream.Push:input_type -> eventstreamapi.Event
 	2, // 3: eventstreamapi.EventStream.Ping:input_type -> eventstreamapi.PingRequest
-	0, // 4: eventstreamapi.EventStream.Subscribe:output_type -> eventstreamapi.Event
-	1, // 5: eventstreamapi.EventStream.Push:output_type -> eventstreamapi.PushSummary
-	3, // 6: eventstreamapi.EventStream.Ping:output_type -> eventstreamapi.PongReply
-	4, // [4:7] is the sub-list for method output_type
-	1, // [1:4] is the sub-list for method input_type
+	4, // 4: eventstreamapi.EventStream.UploadPayload:input_type -> eventstreamapi.PayloadChunk
+	5, // 5: eventstreamapi.EventStream.DownloadPayload:input_type -> eventstreamapi.PayloadRef
+	0, // 6: eventstreamapi.EventStream.Subscribe:output_type -> eventstreamapi.Event
+	1, // 7: eventstreamapi.EventStream.Push:output_type -> eventstreamapi.PushSummary
+	3, // 8: eventstreamapi.EventStream.Ping:output_type -> eventstreamapi.PongReply
+	5, // 9: eventstreamapi.EventStream.UploadPayload:output_type -> eventstreamapi.PayloadRef
+	4, // 10: eventstreamapi.EventStream.DownloadPayload:output_type -> eventstreamapi.PayloadChunk
+	6, // [6:11] is the sub-list for method output_type
+	1, // [1:6] is the sub-list for method input_type
 	1, // [1:1] is the sub-list for extension type_name
 	1, // [1:1] is the sub-list for extension extendee
 	0, // [0:1] is the sub-list for field type_name
@@ -318,63 +395,13 @@ func file_eventstream_proto_init() {
 	if File_eventstream_proto != nil {
 		return
 	}
-	if !protoimpl.UnsafeEnabled {
-		file_eventstream_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*Event); i {
-			case 0:
-				return &v.state
-			case 1:
-				return &v.sizeCache
-			case 2:
-				return &v.unknownFields
-			default:
-				return nil
-			}
-		}
-		file_eventstream_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*PushSummary); i {
-			case 0:
-				return &v.state
-			case 1:
-				return &v.sizeCache
-			case 2:
-				return &v.unknownFields
-			default:
-				return nil
-			}
-		}
-		file_eventstream_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*PingRequest); i {
-			case 0:
-				return &v.state
-			case 1:
-				return &v.sizeCache
-			case 2:
-				return &v.unknownFields
-			default:
-				return nil
-			}
-		}
-		file_eventstream_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*PongReply); i {
-			case 0:
-				return &v.state
-			case 1:
-				return &v.sizeCache
-			case 2:
-				return &v.unknownFields
-			default:
-				return nil
-			}
-		}
-	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
-			RawDescriptor: file_eventstream_proto_rawDesc,
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_eventstream_proto_rawDesc), len(file_eventstream_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   4,
+			NumMessages:   6,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -383,7 +410,6 @@ func file_eventstream_proto_init() {
 		MessageInfos:      file_eventstream_proto_msgTypes,
 	}.Build()
 	File_eventstream_proto = out.File
-	file_eventstream_proto_rawDesc = nil
 	file_eventstream_proto_goTypes = nil
 	file_eventstream_proto_depIdxs = nil
 }
@@ -25,6 +25,12 @@ type EventStreamClient interface {
 	Subscribe(ctx context.Context, opts ...grpc.CallOption) (EventStream_SubscribeClient, error)
 	Push(ctx context.Context, opts ...grpc.CallOption) (EventStream_PushClient, error)
 	Ping(ctx context.Context, in *PingRequest, opts ...grpc.CallOption) (*PongReply, error)
+	// UploadPayload receives a payload the agent transfers out of band, and
+	// returns the handle the agent references it by in its events
+	UploadPayload(ctx context.Context, opts ...grpc.CallOption) (EventStream_UploadPayloadClient, error)
+	// DownloadPayload sends a payload the principal transferred out of band
+	// to the agent
+	DownloadPayload(ctx context.Context, in *PayloadRef, opts ...grpc.CallOption) (EventStream_DownloadPayloadClient, error)
 }
 
 type eventStreamClient struct {
@@ -109,6 +115,72 @@ func (c *eventStreamClient) Ping(ctx context.Context, in *PingRequest, opts ...g
 	return out, nil
 }
 
+func (c *eventStreamClient) UploadPayload(ctx context.Context, opts ...grpc.CallOption) (EventStream_UploadPayloadClient, error) {
+	stream, err := c.cc.NewStream(ctx, &EventStream_ServiceDesc.Streams[2], "/eventstreamapi.EventStream/UploadPayload", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &eventStreamUploadPayloadClient{stream}
+	return x, nil
+}
+
+type EventStream_UploadPayloadClient interface {
+	Send(*PayloadChunk) error
+	CloseAndRecv() (*PayloadRef, error)
+	grpc.ClientStream
+}
+
+type eventStreamUploadPayloadClient struct {
+	grpc.ClientStream
+}
+
+func (x *eventStreamUploadPayloadClient) Send(m *PayloadChunk) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *eventStreamUploadPayloadClient) CloseAndRecv() (*PayloadRef, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(PayloadRef)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *eventStreamClient) DownloadPayload(ctx context.Context, in *PayloadRef, opts ...grpc.CallOption) (EventStream_DownloadPayloadClient, error) {
+	stream, err := c.cc.NewStream(ctx, &EventStream_ServiceDesc.Streams[3], "/eventstreamapi.EventStream/DownloadPayload", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &eventStreamDownloadPayloadClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type EventStream_DownloadPayloadClient interface {
+	Recv() (*PayloadChunk, error)
+	grpc.ClientStream
+}
+
+type eventStreamDownloadPayloadClient struct {
+	grpc.ClientStream
+}
+
+func (x *eventStreamDownloadPayloadClient) Recv() (*PayloadChunk, error) {
+	m := new(PayloadChunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // EventStreamServer is the server API for EventStream service.
 // All implementations must embed UnimplementedEventStreamServer
 // for forward compatibility
@@ -116,6 +188,12 @@ type EventStreamServer interface {
 	Subscribe(EventStream_SubscribeServer) error
 	Push(EventStream_PushServer) error
 	Ping(context.Context, *PingRequest) (*PongReply, error)
+	// UploadPayload receives a payload the agent transfers out of band, and
+	// returns the handle the agent references it by in its events
+	UploadPayload(EventStream_UploadPayloadServer) error
+	// DownloadPayload sends a payload the principal transferred out of band
+	// to the agent
+	DownloadPayload(*PayloadRef, EventStream_DownloadPayloadServer) error
 	mustEmbedUnimplementedEventStreamServer()
 }
 
@@ -132,6 +210,12 @@ func (UnimplementedEventStreamServer) Push(EventStream_PushServer) error {
 func (UnimplementedEventStreamServer) Ping(context.Context, *PingRequest) (*PongReply, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Ping not implemented")
 }
+func (UnimplementedEventStreamServer) UploadPayload(EventStream_UploadPayloadServer) error {
+	return status.Errorf(codes.Unimplemented, "method UploadPayload not implemented")
+}
+func (UnimplementedEventStreamServer) DownloadPayload(*PayloadRef, EventStream_DownloadPayloadServer) error {
+	return status.Errorf(codes.Unimplemented, "method DownloadPayload not implemented")
+}
 func (UnimplementedEventStreamServer) mustEmbedUnimplementedEventStreamServer() {}
 
 // UnsafeEventStreamServer may be embedded to opt out of forward compatibility for this service.
@@ -215,6 +299,53 @@ func _EventStream_Ping_Handler(srv interface{}, ctx context.Context, dec func(in
 	return interceptor(ctx, in, info, handler)
 }
 
+func _EventStream_UploadPayload_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(EventStreamServer).UploadPayload(&eventStreamUploadPayloadServer{stream})
+}
+
+type EventStream_UploadPayloadServer interface {
+	SendAndClose(*PayloadRef) error
+	Recv() (*PayloadChunk, error)
+	grpc.ServerStream
+}
+
+type eventStreamUploadPayloadServer struct {
+	grpc.ServerStream
+}
+
+func (x *eventStreamUploadPayloadServer) SendAndClose(m *PayloadRef) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *eventStreamUploadPayloadServer) Recv() (*PayloadChunk, error) {
+	m := new(PayloadChunk)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _EventStream_DownloadPayload_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(PayloadRef)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(EventStreamServer).DownloadPayload(m, &eventStreamDownloadPayloadServer{stream})
+}
+
+type EventStream_DownloadPayloadServer interface {
+	Send(*PayloadChunk) error
+	grpc.ServerStream
+}
+
+type eventStreamDownloadPayloadServer struct {
+	grpc.ServerStream
+}
+
+func (x *eventStreamDownloadPayloadServer) Send(m *PayloadChunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 // EventStream_ServiceDesc is the grpc.ServiceDesc for EventStream service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -239,6 +370,16 @@ var EventStream_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _EventStream_Push_Handler,
 			ClientStreams: true,
 		},
+		{
+			StreamName:    "UploadPayload",
+			Handler:       _EventStream_UploadPayload_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "DownloadPayload",
+			Handler:       _EventStream_DownloadPayload_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "eventstream.proto",
 }
@@ -0,0 +1,190 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// proxyDialFunc dials addr, which is in host:port form, through a proxy.
+type proxyDialFunc func(ctx context.Context, addr string) (net.Conn, error)
+
+// WithProxy configures the proxy the agent uses to connect to the principal.
+// proxyURL may use the http, https, socks5 or socks5h scheme and can contain
+// credentials for proxy authentication. noProxy is a comma-separated list of
+// hosts that are reached directly, in the same format as NO_PROXY. Empty
+// values fall back to the HTTPS_PROXY and NO_PROXY environment variables.
+func WithProxy(proxyURL, noProxy string) RemoteOption {
+	return func(r *Remote) error {
+		if proxyURL != "" {
+			u, err := url.Parse(proxyURL)
+			if err != nil {
+				return fmt.Errorf("invalid proxy URL: %w", err)
+			}
+			if _, err := proxyDialer(u); err != nil {
+				return err
+			}
+			r.proxyConfig.HTTPSProxy = proxyURL
+			r.proxyConfigured = true
+		}
+		if noProxy != "" {
+			r.proxyConfig.NoProxy = noProxy
+		}
+		return nil
+	}
+}
+
+// proxyURL returns the URL of the proxy to use for connecting to the
+// principal, or nil if the principal should be dialed directly.
+func (r *Remote) proxyURL() (*url.URL, error) {
+	u, err := r.proxyConfig.ProxyFunc()(&url.URL{Scheme: "https", Host: r.Addr()})
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy configuration: %w", err)
+	}
+	return u, nil
+}
+
+// proxyDialer returns a function that dials through the proxy at proxyURL.
+func proxyDialer(proxyURL *url.URL) (proxyDialFunc, error) {
+	switch proxyURL.Scheme {
+	case "socks5", "socks5h":
+		var auth *proxy.Auth
+		if proxyURL.User != nil {
+			password, _ := proxyURL.User.Password()
+			auth = &proxy.Auth{User: proxyURL.User.Username(), Password: password}
+		}
+		d, err := proxy.SOCKS5("tcp", proxyAddr(proxyURL), auth, &net.Dialer{})
+		if err != nil {
+			return nil, fmt.Errorf("could not create SOCKS5 dialer: %w", err)
+		}
+		cd, ok := d.(proxy.ContextDialer)
+		if !ok {
+			return nil, fmt.Errorf("SOCKS5 dialer does not support contexts")
+		}
+		return func(ctx context.Context, addr string) (net.Conn, error) {
+			return cd.DialContext(ctx, "tcp", addr)
+		}, nil
+	case "http", "https":
+		return func(ctx context.Context, addr string) (net.Conn, error) {
+			return dialHTTPConnect(ctx, proxyURL, addr)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q, must be one of: http, https, socks5, socks5h", proxyURL.Scheme)
+	}
+}
+
+// proxyAddr returns the host:port of the proxy, using the default port for
+// the proxy's scheme if none is given.
+func proxyAddr(proxyURL *url.URL) string {
+	if proxyURL.Port() != "" {
+		return proxyURL.Host
+	}
+	port := "80"
+	switch proxyURL.Scheme {
+	case "https":
+		port = "443"
+	case "socks5", "socks5h":
+		port = "1080"
+	}
+	return net.JoinHostPort(proxyURL.Hostname(), port)
+}
+
+// dialHTTPConnect establishes a tunnel to addr through the HTTP proxy at
+// proxyURL using the CONNECT method. If the proxy URL contains credentials,
+// they are sent using basic authentication.
+func dialHTTPConnect(ctx context.Context, proxyURL *url.URL, addr string) (net.Conn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", proxyAddr(proxyURL))
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to proxy: %w", err)
+	}
+
+	// Abort the handshake with the proxy when ctx is done
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Unix(1, 0))
+	})
+	fail := func(err error) (net.Conn, error) {
+		stop()
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+
+	if proxyURL.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: proxyURL.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return fail(fmt.Errorf("TLS handshake with proxy failed: %w", err))
+		}
+		conn = tlsConn
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+		creds := base64.StdEncoding.EncodeToString([]byte(proxyURL.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+creds)
+	}
+	if err := req.Write(conn); err != nil {
+		return fail(fmt.Errorf("could not send CONNECT request to proxy: %w", err))
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return fail(fmt.Errorf("could not read CONNECT response from proxy: %w", err))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fail(fmt.Errorf("proxy refused to connect to %s: %s", addr, resp.Status))
+	}
+
+	if !stop() {
+		conn.Close()
+		return nil, ctx.Err()
+	}
+
+	// The proxy may have sent data from the remote along with its response
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn is a net.Conn that reads any data left in r before reading
+// from the connection itself.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
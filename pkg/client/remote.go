@@ -19,17 +19,22 @@ import (
 	"crypto"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
 	"math"
+	"net"
 	"os"
+	"strconv"
 	"sync"
 	"time"
 
 	grpcprom "github.com/grpc-ecosystem/go-grpc-middleware/providers/prometheus"
 
 	"github.com/argoproj-labs/argocd-agent/internal/auth"
+	"github.com/argoproj-labs/argocd-agent/internal/event"
 	"github.com/argoproj-labs/argocd-agent/internal/grpcutil"
 	"github.com/argoproj-labs/argocd-agent/internal/logging"
+	"github.com/argoproj-labs/argocd-agent/internal/quictransport"
 	"github.com/argoproj-labs/argocd-agent/internal/tlsutil"
 	"github.com/argoproj-labs/argocd-agent/internal/version"
 	"github.com/argoproj-labs/argocd-agent/pkg/api/grpc/authapi"
@@ -38,6 +43,7 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/sirupsen/logrus"
 	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"golang.org/x/net/http/httpproxy"
 	grpchttp1client "golang.stackrox.io/grpc-http1/client"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -49,7 +55,6 @@ import (
 	"google.golang.org/grpc/status"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/util/retry"
 )
 
 // Time interval left for access token refresh
@@ -79,28 +84,51 @@ func NewToken(tok string) (*token, error) {
 
 // Remote represents a remote argocd-agent server component. Remote is used only by the agent component, and not by principal.
 type Remote struct {
-	hostname          string
-	port              int
-	tlsConfig         *tls.Config
-	tokenMu           sync.Mutex
-	accessToken       *token
-	refreshToken      *token
-	authMethod        string
-	creds             auth.Credentials
-	backoff           wait.Backoff
-	connMu            sync.Mutex
-	conn              *grpc.ClientConn
-	clientID          string
-	clientMode        types.AgentMode
-	timeouts          timeouts
-	enableWebSocket   bool
+	hostname        string
+	port            int
+	tlsConfig       *tls.Config
+	tokenMu         sync.Mutex
+	accessToken     *token
+	refreshToken    *token
+	authMethod      string
+	creds           auth.Credentials
+	authLoader      AuthLoader
+	onAuthHeader    func(header metadata.MD) error
+	backoff         wait.Backoff
+	connMu          sync.Mutex
+	conn            *grpc.ClientConn
+	clientID        string
+	clientMode      types.AgentMode
+	timeouts        timeouts
+	enableWebSocket bool
+	// webSocketFallback makes the remote switch to gRPC over WebSocket when
+	// the principal cannot be reached using HTTP/2, and webSocketActive is
+	// set while the fallback transport is in use.
+	webSocketFallback bool
+	webSocketActive   bool
+	// quicEnabled makes the remote connect over QUIC to quicPort, or to port
+	// if quicPort is 0. quicFailed is set while the remote falls back to TCP
+	// because the principal could not be reached over QUIC.
+	quicEnabled bool
+	quicPort    int
+	quicFailed  bool
+	// proxyConfig determines the proxy used to reach the principal. It is
+	// read from the environment and may be overridden with WithProxy, in
+	// which case proxyConfigured is set.
+	proxyConfig       *httpproxy.Config
+	proxyConfigured   bool
 	enableCompression bool
+	// compressor is the name of the compressor used when compression is
+	// enabled. Defaults to gzip.
+	compressor string
 	// insecurePlaintext disables TLS for the connection. Use when Istio sidecar
 	// handles mTLS termination.
 	insecurePlaintext bool
 
 	// Time interval for agent to principal ping
 	keepAlivePingInterval time.Duration
+	// Time to wait for a ping ack before the connection is considered dead
+	keepAliveTimeout time.Duration
 
 	// The largest GRPC message size supported, configurable via env/param
 	MaxGRPCMessageSize int
@@ -114,8 +142,25 @@ type Remote struct {
 	// grpcClientMetrics holds gRPC client-side Prometheus metrics
 	grpcClientMetrics *grpcprom.ClientMetrics
 
+	// unaryInterceptors and streamInterceptors are run for every gRPC call
+	// after the built-in interceptors
+	unaryInterceptors  []grpc.UnaryClientInterceptor
+	streamInterceptors []grpc.StreamClientInterceptor
+
 	onAuthenticated onAuthenticatedFunc
 	onAuthFailure   func()
+
+	// payloadEncryption is whether a key to encrypt the payload of events
+	// with is negotiated during authentication, using the optional
+	// pre-shared payloadPSK
+	payloadEncryption bool
+	payloadPSK        []byte
+	// payloadCipher is the negotiated cipher, protected by tokenMu
+	payloadCipher *event.PayloadCipher
+
+	// clusterLabels are the labels the agent asks the principal to put on
+	// its cluster secret when it self-registers
+	clusterLabels map[string]string
 }
 
 type RemoteOption func(r *Remote) error
@@ -193,6 +238,36 @@ func WithTLSClientCertFromSecret(kube kubernetes.Interface, namespace, name stri
 	}
 }
 
+// WithTLSFromSecret configures the remote to present the client cert from the
+// TLS secret referred to by namespace and name on every outbound connection.
+// The secret is watched until ctx is done, so that a rotated certificate is
+// used for new connections without restarting the agent.
+func WithTLSFromSecret(ctx context.Context, kube kubernetes.Interface, namespace, name string) RemoteOption {
+	return func(r *Remote) error {
+		c, err := tlsutil.TLSCertFromSecret(ctx, kube, namespace, name)
+		if err != nil {
+			return fmt.Errorf("unable to read TLS client from secret: %w", err)
+		}
+		reloader := tlsutil.NewCertificateReloader(c)
+		if err := reloader.WatchSecret(ctx, kube, namespace, name); err != nil {
+			return fmt.Errorf("unable to watch TLS client secret: %w", err)
+		}
+		r.tlsConfig.GetClientCertificate = reloader.GetClientCertificate
+		return nil
+	}
+}
+
+// WithTLSClientCertReloader configures the remote to present the current
+// certificate of reloader on every outbound connection, so that a renewed
+// client cert is used without restarting the agent. It takes precedence over
+// any client cert configured otherwise.
+func WithTLSClientCertReloader(reloader *tlsutil.CertificateReloader) RemoteOption {
+	return func(r *Remote) error {
+		r.tlsConfig.GetClientCertificate = reloader.GetClientCertificate
+		return nil
+	}
+}
+
 // WithRootAuthorities configures the Remote to use TLS certificate authorities
 // from PEM data in caData for verifying server certificates.
 func WithRootAuthorities(caData []byte) RemoteOption {
@@ -244,6 +319,22 @@ func WithRootAuthoritiesFromSecret(kube kubernetes.Interface, namespace, name st
 	}
 }
 
+// WithServerCertificatePins configures the Remote to only accept server
+// certificate chains that contain a certificate matching at least one of the
+// given pins, in addition to the regular certificate verification. See
+// tlsutil.ParseCertificatePins for the format of pins.
+func WithServerCertificatePins(pins []string) RemoteOption {
+	return func(r *Remote) error {
+		p, err := tlsutil.ParseCertificatePins(pins)
+		if err != nil {
+			return err
+		}
+		r.tlsConfig.VerifyConnection = p.VerifyConnection
+		log().Infof("Pinned %d server certificate(s) or public key(s)", p.Len())
+		return nil
+	}
+}
+
 // WithInsecureSkipTLSVerify configures the Remote to skip verification of the
 // TLS server certificate
 func WithInsecureSkipTLSVerify() RemoteOption {
@@ -275,6 +366,40 @@ func WithWebSocket(enableWebSocket bool) RemoteOption {
 	}
 }
 
+// WithWebSocketFallback makes the agent tunnel its connection over WebSocket
+// (gRPC-Web) when the principal cannot be reached using HTTP/2, e.g. because
+// a corporate proxy blocks it. The principal must have WebSocket enabled for
+// the fallback to succeed. Has no effect if WebSocket is always enabled.
+func WithWebSocketFallback(fallback bool) RemoteOption {
+	return func(r *Remote) error {
+		r.webSocketFallback = fallback
+		return nil
+	}
+}
+
+// WithQUIC makes the agent connect to the principal over QUIC. The principal
+// must have its QUIC listener enabled. If the principal cannot be reached
+// over QUIC, e.g. because UDP is blocked, the agent falls back to TCP, and
+// tries QUIC again once TCP failed, too. This transport is experimental.
+func WithQUIC(enabled bool) RemoteOption {
+	return func(r *Remote) error {
+		r.quicEnabled = enabled
+		return nil
+	}
+}
+
+// WithQUICPort sets the UDP port of the principal's QUIC listener. If not
+// set, the port of the principal's TCP listener is used.
+func WithQUICPort(port int) RemoteOption {
+	return func(r *Remote) error {
+		if port < 0 || port > 65535 {
+			return fmt.Errorf("QUIC port must be between 0 and 65535")
+		}
+		r.quicPort = port
+		return nil
+	}
+}
+
 func WithAuth(method string, creds auth.Credentials) RemoteOption {
 	return func(r *Remote) error {
 		r.authMethod = method
@@ -283,6 +408,75 @@ func WithAuth(method string, creds auth.Credentials) RemoteOption {
 	}
 }
 
+// CredentialsLoader returns the credentials to present to the principal. It is
+// called before each authentication attempt, so that credentials which are
+// rotated on disk (such as projected ServiceAccount tokens) are picked up.
+type CredentialsLoader func() (auth.Credentials, error)
+
+// WithAuthCredentialsLoader configures the remote to use the given auth method
+// with credentials returned by loader. The loader is called before each
+// authentication attempt.
+func WithAuthCredentialsLoader(method string, loader CredentialsLoader) RemoteOption {
+	return func(r *Remote) error {
+		r.authMethod = method
+		r.authLoader = func() (string, auth.Credentials, error) {
+			creds, err := loader()
+			return method, creds, err
+		}
+		return nil
+	}
+}
+
+// AuthLoader returns the auth method and the credentials to present to the
+// principal. Like a CredentialsLoader, it is called before each authentication
+// attempt, but may also switch the auth method between attempts.
+type AuthLoader func() (string, auth.Credentials, error)
+
+// WithAuthLoader configures the remote to use the auth method and credentials
+// returned by loader. The loader is called before each authentication attempt.
+func WithAuthLoader(loader AuthLoader) RemoteOption {
+	return func(r *Remote) error {
+		r.authLoader = loader
+		return nil
+	}
+}
+
+// WithAuthResponseHeaderHandler registers a function that is called with the
+// gRPC response header of each successful authentication. This can be used to
+// receive data the principal passes along with the authentication, such as
+// credentials issued during onboarding.
+func WithAuthResponseHeaderHandler(fn func(header metadata.MD) error) RemoteOption {
+	return func(r *Remote) error {
+		r.onAuthHeader = fn
+		return nil
+	}
+}
+
+// WithPayloadEncryption negotiates a key to encrypt the payload of events
+// with during each authentication. If psk is not empty, it is mixed into the
+// key and must match the pre-shared key of the principal. Authentication
+// fails if the principal does not support payload encryption.
+func WithPayloadEncryption(psk []byte) RemoteOption {
+	return func(r *Remote) error {
+		r.payloadEncryption = true
+		r.payloadPSK = psk
+		return nil
+	}
+}
+
+// WithClusterLabels sends labels with each authentication, for the principal
+// to put on the cluster secret it creates for the agent. The principal only
+// applies the labels it allows agents to set.
+func WithClusterLabels(labels map[string]string) RemoteOption {
+	return func(r *Remote) error {
+		if _, err := auth.ParseClusterLabels(auth.EncodeClusterLabels(labels)); err != nil {
+			return err
+		}
+		r.clusterLabels = labels
+		return nil
+	}
+}
+
 func WithClientMode(mode types.AgentMode) RemoteOption {
 	return func(r *Remote) error {
 		r.clientMode = mode
@@ -297,6 +491,19 @@ func WithKeepAlivePingInterval(interval time.Duration) RemoteOption {
 	}
 }
 
+// WithKeepAliveTimeout sets how long the agent waits for the principal to
+// acknowledge a keepalive ping before closing the connection. It only has an
+// effect when a keepalive ping interval is configured.
+func WithKeepAliveTimeout(timeout time.Duration) RemoteOption {
+	return func(r *Remote) error {
+		if timeout < 0 {
+			return fmt.Errorf("keepalive timeout must not be negative")
+		}
+		r.keepAliveTimeout = timeout
+		return nil
+	}
+}
+
 func WithCompression(flag bool) RemoteOption {
 	return func(r *Remote) error {
 		r.enableCompression = flag
@@ -304,6 +511,20 @@ func WithCompression(flag bool) RemoteOption {
 	}
 }
 
+// WithCompressor sets the compressor used for messages sent to the principal
+// when compression is enabled. Supported compressors are gzip and zstd.
+func WithCompressor(name string) RemoteOption {
+	return func(r *Remote) error {
+		switch name {
+		case grpcutil.CompressionGzip, grpcutil.CompressionZstd:
+			r.compressor = name
+			return nil
+		default:
+			return fmt.Errorf("unsupported compressor %q, must be one of: %s, %s", name, grpcutil.CompressionGzip, grpcutil.CompressionZstd)
+		}
+	}
+}
+
 // WithMaxGRPCMessageSize configures the maximum gRPC message size (in bytes)
 // for both sending and receiving on the agent client connection.
 func WithMaxGRPCMessageSize(size int) RemoteOption {
@@ -344,6 +565,26 @@ func WithGRPCClientMetrics(m *grpcprom.ClientMetrics) RemoteOption {
 	}
 }
 
+// WithUnaryInterceptor adds interceptors to be run for every unary gRPC call
+// to the principal. They are run in the order given, after the built-in
+// authentication and message size interceptors.
+func WithUnaryInterceptor(interceptors ...grpc.UnaryClientInterceptor) RemoteOption {
+	return func(r *Remote) error {
+		r.unaryInterceptors = append(r.unaryInterceptors, interceptors...)
+		return nil
+	}
+}
+
+// WithStreamInterceptor adds interceptors to be run for every streaming gRPC
+// call to the principal. They are run in the order given, after the built-in
+// interceptors.
+func WithStreamInterceptor(interceptors ...grpc.StreamClientInterceptor) RemoteOption {
+	return func(r *Remote) error {
+		r.streamInterceptors = append(r.streamInterceptors, interceptors...)
+		return nil
+	}
+}
+
 // WithMaximumTLSVersion configures the maximum TLS version the client will use.
 func WithMaximumTLSVersion(version string) RemoteOption {
 	return func(r *Remote) error {
@@ -377,19 +618,31 @@ func NewRemote(hostname string, port int, opts ...RemoteOption) (*Remote, error)
 			ServerName: hostname,
 		},
 		backoff: wait.Backoff{
-			Duration: 1 * time.Second,
-			Factor:   2,
-			Cap:      1 * time.Minute,
+			Steps:    math.MaxInt,
+			Duration: DefaultReconnectBackoffInitial,
+			Factor:   DefaultReconnectBackoffFactor,
+			Jitter:   DefaultReconnectBackoffJitter,
+			Cap:      DefaultReconnectBackoffMax,
 		},
 		clientMode:         types.AgentModeAutonomous,
 		MaxGRPCMessageSize: grpcutil.DefaultGRPCMaxMessageSize,
 		agentVersion:       version.New("argocd-agent").Version(),
+		proxyConfig:        httpproxy.FromEnvironment(),
 	}
 	for _, o := range opts {
 		if err := o(r); err != nil {
 			return nil, err
 		}
 	}
+	if r.enableWebSocket && r.proxyConfigured {
+		return nil, fmt.Errorf("an explicit proxy cannot be used with WebSocket")
+	}
+	if r.quicEnabled && r.proxyConfigured {
+		return nil, fmt.Errorf("an explicit proxy cannot be used with QUIC")
+	}
+	if r.quicEnabled && r.insecurePlaintext {
+		return nil, fmt.Errorf("QUIC cannot be used in plaintext mode")
+	}
 
 	// Validate TLS configuration after all options have been applied
 	if err := tlsutil.ValidateTLSConfig(r.tlsConfig.MinVersion, r.tlsConfig.MaxVersion, r.tlsConfig.CipherSuites); err != nil {
@@ -455,15 +708,91 @@ func (r *Remote) streamAuthInterceptor(ctx context.Context, desc *grpc.StreamDes
 	return streamer(nCtx, desc, cc, method, opts...)
 }
 
-func connectBackoff() wait.Backoff {
-	return wait.Backoff{
-		Steps:    math.MaxInt,
-		Duration: 1 * time.Second,
-		Factor:   1.2,
-		Cap:      1 * time.Minute,
+const (
+	// DefaultReconnectBackoffInitial is the default time to wait before the
+	// first reconnect attempt
+	DefaultReconnectBackoffInitial = 1 * time.Second
+	// DefaultReconnectBackoffMax is the default maximum time to wait between
+	// reconnect attempts
+	DefaultReconnectBackoffMax = 1 * time.Minute
+	// DefaultReconnectBackoffFactor is the default factor the time to wait is
+	// multiplied with after each failed attempt
+	DefaultReconnectBackoffFactor = 2.0
+	// DefaultReconnectBackoffJitter is the default jitter added to the time
+	// to wait, as a fraction of that time
+	DefaultReconnectBackoffJitter = 0.2
+)
+
+// ErrRetryBudgetExhausted is returned by Connect when the maximum number of
+// connection attempts has been used up without success.
+var ErrRetryBudgetExhausted = errors.New("retry budget exhausted")
+
+// WithReconnectBackoff configures the exponential backoff between connection
+// attempts. The time to wait starts at initial and is multiplied by factor
+// after each failed attempt, up to max. A random jitter of up to the given
+// fraction of the time to wait is added, so that agents which lost their
+// connection at the same time do not reconnect all at once.
+func WithReconnectBackoff(initial, max time.Duration, factor, jitter float64) RemoteOption {
+	return func(r *Remote) error {
+		if initial <= 0 {
+			return fmt.Errorf("initial backoff must be positive")
+		}
+		if max < initial {
+			return fmt.Errorf("max backoff cannot be less than initial")
+		}
+		if factor < 1.0 {
+			return fmt.Errorf("backoff factor must be at least 1.0")
+		}
+		if jitter < 0 {
+			return fmt.Errorf("backoff jitter must not be negative")
+		}
+		r.backoff.Duration = initial
+		r.backoff.Cap = max
+		r.backoff.Factor = factor
+		r.backoff.Jitter = jitter
+		return nil
+	}
+}
+
+// WithMaxReconnectAttempts limits the number of connection attempts Connect
+// makes before it gives up and returns ErrRetryBudgetExhausted. If attempts
+// is 0, Connect retries until its context is done.
+func WithMaxReconnectAttempts(attempts int) RemoteOption {
+	return func(r *Remote) error {
+		if attempts < 0 {
+			return fmt.Errorf("maximum reconnect attempts must not be negative")
+		}
+		if attempts == 0 {
+			r.backoff.Steps = math.MaxInt
+		} else {
+			r.backoff.Steps = attempts
+		}
+		return nil
 	}
 }
 
+// reconnectDelay returns the time to wait after the given number of failed
+// connection attempts. Unlike wait.Backoff, reaching the maximum backoff does
+// not end the retries.
+func (r *Remote) reconnectDelay(attempts int) time.Duration {
+	factor := r.backoff.Factor
+	if factor < 1 {
+		factor = 1
+	}
+	delay := float64(r.backoff.Duration) * math.Pow(factor, float64(attempts-1))
+	if r.backoff.Cap > 0 && delay > float64(r.backoff.Cap) {
+		delay = float64(r.backoff.Cap)
+	}
+	if delay > math.MaxInt64 {
+		delay = math.MaxInt64
+	}
+	d := time.Duration(delay)
+	if r.backoff.Jitter > 0 {
+		d = wait.Jitter(d, r.backoff.Jitter)
+	}
+	return d
+}
+
 func isAuthMethod(method string) bool {
 	return method == "/authapi.Authentication/Authenticate" ||
 		method == "/authapi.Authentication/RefreshToken"
@@ -540,10 +869,82 @@ func (r *Remote) Disconnect() {
 	}
 }
 
+// useWebSocket returns whether the next connection should be made using gRPC
+// over WebSocket.
+func (r *Remote) useWebSocket() bool {
+	return r.enableWebSocket || r.webSocketActive
+}
+
+// useQUIC returns whether the next connection should be made over QUIC.
+func (r *Remote) useQUIC() bool {
+	return r.quicEnabled && !r.quicFailed
+}
+
+// quicAddr returns the address of the principal's QUIC listener
+func (r *Remote) quicAddr() string {
+	port := r.quicPort
+	if port == 0 {
+		port = r.port
+	}
+	return net.JoinHostPort(r.hostname, strconv.Itoa(port))
+}
+
+// switchTransport switches to the next transport after a connection attempt
+// failed with err, if err indicates that the principal could not be reached
+// using the current transport. QUIC falls back to TCP. On TCP, HTTP/2 and the
+// WebSocket fallback alternate if the fallback is enabled. Once TCP failed,
+// QUIC is tried again. As long as no transport works, attempts cycle through
+// all of them.
+func (r *Remote) switchTransport(err error) {
+	st, ok := status.FromError(err)
+	if !ok {
+		return
+	}
+	switch st.Code() {
+	case codes.Unavailable, codes.Unknown, codes.Internal, codes.Unimplemented:
+	default:
+		return
+	}
+	if r.useQUIC() {
+		r.quicFailed = true
+		log().WithError(err).Warn("Could not reach principal using QUIC, falling back to TCP")
+		return
+	}
+	if !r.webSocketFallback || r.enableWebSocket {
+		r.retryQUIC(err)
+		return
+	}
+	r.webSocketActive = !r.webSocketActive
+	if r.webSocketActive {
+		log().WithError(err).Warn("Could not reach principal using HTTP/2, falling back to gRPC over WebSocket")
+	} else if !r.retryQUIC(err) {
+		log().WithError(err).Warn("Could not reach principal using WebSocket, retrying with HTTP/2")
+	}
+}
+
+// retryQUIC makes the next connection attempt use QUIC again after TCP failed
+// with err, and returns whether QUIC is enabled.
+func (r *Remote) retryQUIC(err error) bool {
+	if !r.quicEnabled {
+		return false
+	}
+	r.quicFailed = false
+	log().WithError(err).Warn("Could not reach principal using TCP, retrying with QUIC")
+	return true
+}
+
 func (r *Remote) newClientConn(ctx context.Context, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
 	var conn *grpc.ClientConn
 	var err error
-	if r.enableWebSocket {
+	if r.useQUIC() {
+		// The QUIC connection is secured by QUIC's own TLS handshake
+		opts = append(opts,
+			grpc.WithTransportCredentials(quictransport.NewClientCredentials()),
+			grpc.WithContextDialer(quictransport.Dialer(r.tlsConfig)),
+			grpc.WithNoProxy(),
+		)
+		conn, err = grpc.NewClient("passthrough:///"+r.quicAddr(), opts...)
+	} else if r.useWebSocket() {
 		grpcHTTP1Opts := []grpchttp1client.ConnectOption{
 			grpchttp1client.UseWebSocket(true),
 			grpchttp1client.DialOpts(opts...),
@@ -554,6 +955,9 @@ func (r *Remote) newClientConn(ctx context.Context, opts ...grpc.DialOption) (*g
 		if !r.insecurePlaintext {
 			tlsCfg = r.tlsConfig
 		}
+		if r.proxyConfigured {
+			log().Warn("Explicit proxy settings are not applied to the WebSocket transport")
+		}
 		conn, err = grpchttp1client.ConnectViaProxy(ctx, r.Addr(), tlsCfg, grpcHTTP1Opts...)
 	} else {
 		// Use insecure credentials for plaintext mode (e.g., behind Istio)
@@ -563,7 +967,25 @@ func (r *Remote) newClientConn(ctx context.Context, opts ...grpc.DialOption) (*g
 			opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(r.tlsConfig)))
 		}
 
-		conn, err = grpc.NewClient(r.Addr(), opts...)
+		target := r.Addr()
+		proxyURL, perr := r.proxyURL()
+		if perr != nil {
+			return nil, perr
+		}
+		if proxyURL != nil {
+			dialer, perr := proxyDialer(proxyURL)
+			if perr != nil {
+				return nil, perr
+			}
+			log().Debugf("Connecting to principal through proxy %s", proxyURL.Redacted())
+			opts = append(opts, grpc.WithContextDialer(dialer))
+			// The passthrough resolver hands the unresolved address to the
+			// dialer, so that the proxy can resolve it.
+			target = "passthrough:///" + target
+		} else {
+			opts = append(opts, grpc.WithNoProxy())
+		}
+		conn, err = grpc.NewClient(target, opts...)
 	}
 	return conn, err
 }
@@ -596,6 +1018,8 @@ func (r *Remote) Connect(ctx context.Context, forceReauth bool) error {
 		r.streamAuthInterceptor,
 		grpcutil.StreamClientMsgSizeInterceptor(r.MaxGRPCMessageSize),
 	}
+	unaryInterceptors = append(unaryInterceptors, r.unaryInterceptors...)
+	streamInterceptors = append(streamInterceptors, r.streamInterceptors...)
 
 	// Prepend gRPC Prometheus interceptors so they observe all RPCs.
 	if r.grpcClientMetrics != nil {
@@ -619,13 +1043,20 @@ func (r *Remote) Connect(ctx context.Context, forceReauth bool) error {
 	}
 
 	if r.enableCompression {
-		log().Debug("gRPC compression is enabled.")
-		opts = append(opts, grpc.WithDefaultCallOptions(grpc.UseCompressor(gzip.Name)))
+		compressor := r.compressor
+		if compressor == "" {
+			compressor = gzip.Name
+		}
+		log().Debugf("gRPC compression is enabled, using %s.", compressor)
+		opts = append(opts, grpc.WithDefaultCallOptions(grpc.UseCompressor(compressor)))
 	}
 
 	if r.keepAlivePingInterval != 0 {
 		log().Debugf("Agent ping to principal is enabled, agent will send a ping event after every %s.", r.keepAlivePingInterval)
-		opts = append(opts, grpc.WithKeepaliveParams(keepalive.ClientParameters{Time: r.keepAlivePingInterval}))
+		opts = append(opts, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:    r.keepAlivePingInterval,
+			Timeout: r.keepAliveTimeout,
+		}))
 	}
 
 	var (
@@ -633,24 +1064,31 @@ func (r *Remote) Connect(ctx context.Context, forceReauth bool) error {
 		err  error
 	)
 	authenticated := false
-	cBackoff := connectBackoff()
+	attempts := 0
 
-	// We try to authenticate to the remote repeatedly, until either of the
-	// following events happen:
-	//
-	// 1) The retry attempts are used up or
-	// 2) The context expires or is canceled
-	err = retry.OnError(cBackoff, r.retriable, func() error {
+	attempt := func() error {
 		select {
 		case <-ctx.Done():
 			return status.Error(codes.Canceled, "context canceled")
 		default:
+			attempts++
 			conn, err = r.newClientConn(ctx, opts...)
 			if err != nil {
 				return err
 			}
 			authC := authapi.NewAuthenticationClient(conn)
 
+			if r.authLoader != nil {
+				method, creds, lerr := r.authLoader()
+				if lerr != nil {
+					conn.Close()
+					logrus.Warnf("Could not load credentials: %v", lerr)
+					return lerr
+				}
+				r.authMethod = method
+				r.creds = creds
+			}
+
 			authReq := &authapi.AuthRequest{
 				Method:         r.authMethod,
 				Credentials:    r.creds,
@@ -658,7 +1096,21 @@ func (r *Remote) Connect(ctx context.Context, forceReauth bool) error {
 				Version:        r.agentVersion,
 				AgentNamespace: r.agentNamespace,
 			}
-			resp, ierr := authC.Authenticate(ctx, authReq)
+			authCtx := ctx
+			if len(r.clusterLabels) > 0 {
+				authCtx = metadata.AppendToOutgoingContext(authCtx, auth.ClusterLabelsHeader, auth.EncodeClusterLabels(r.clusterLabels))
+			}
+			var payloadKey *event.PayloadKeyPair
+			if r.payloadEncryption {
+				payloadKey, err = event.NewPayloadKeyPair()
+				if err != nil {
+					conn.Close()
+					return err
+				}
+				authCtx = metadata.AppendToOutgoingContext(authCtx, event.PayloadKeyHeader, payloadKey.PublicKey())
+			}
+			var header metadata.MD
+			resp, ierr := authC.Authenticate(authCtx, authReq, grpc.Header(&header))
 			defer func() {
 				if ierr != nil {
 					conn.Close()
@@ -668,6 +1120,7 @@ func (r *Remote) Connect(ctx context.Context, forceReauth bool) error {
 				if r.onAuthFailure != nil {
 					r.onAuthFailure()
 				}
+				r.switchTransport(ierr)
 				st, ok := status.FromError(ierr)
 				if ok {
 					if st.Code() == codes.FailedPrecondition {
@@ -679,20 +1132,26 @@ func (r *Remote) Connect(ctx context.Context, forceReauth bool) error {
 						return ierr // preserve gRPC status for retriable() check
 					}
 				}
-				logrus.Warnf("Auth failure: %v (retrying in %v)", ierr, cBackoff.Step())
+				logrus.Warnf("Auth failure: %v", ierr)
 				return ierr
 			}
 
+			if r.onAuthHeader != nil {
+				if herr := r.onAuthHeader(header); herr != nil {
+					log().WithError(herr).Error("Could not process authentication response header")
+				}
+			}
+
 			r.tokenMu.Lock()
 			defer r.tokenMu.Unlock()
 			r.accessToken, ierr = NewToken(resp.AccessToken)
 			if ierr != nil {
-				logrus.Warnf("Auth failure: %v (retrying in %v)", ierr, cBackoff.Step())
+				logrus.Warnf("Auth failure: %v", ierr)
 				return ierr
 			}
 			r.refreshToken, ierr = NewToken(resp.RefreshToken)
 			if ierr != nil {
-				logrus.Warnf("Auth failure: %v (retrying in %v)", ierr, cBackoff.Step())
+				logrus.Warnf("Auth failure: %v", ierr)
 				return ierr
 			}
 			r.clientID, ierr = r.accessToken.Claims.GetSubject()
@@ -700,6 +1159,20 @@ func (r *Remote) Connect(ctx context.Context, forceReauth bool) error {
 				return ierr
 			}
 
+			r.payloadCipher = nil
+			if payloadKey != nil {
+				peerKey := header.Get(event.PayloadKeyHeader)
+				if len(peerKey) == 0 {
+					ierr = status.Error(codes.FailedPrecondition, "principal does not support payload encryption")
+					log().Error(ierr.Error())
+					return ierr
+				}
+				r.payloadCipher, ierr = payloadKey.Derive(peerKey[0], r.payloadPSK, true)
+				if ierr != nil {
+					return ierr
+				}
+			}
+
 			if r.onAuthenticated != nil {
 				r.onAuthenticated(resp.PrincipalNamespace)
 			}
@@ -707,11 +1180,33 @@ func (r *Remote) Connect(ctx context.Context, forceReauth bool) error {
 			authenticated = true
 			return nil
 		}
-	})
-	if err != nil {
-		// Connection is already closed by the defer func in the retry loop
-		// if the loop exits with an error
-		return err
+	}
+
+	// We try to authenticate to the remote repeatedly, until either of the
+	// following events happen:
+	//
+	// 1) The retry attempts are used up or
+	// 2) The context expires or is canceled
+	for {
+		// Connection is already closed by the defer func in attempt if it
+		// returns an error
+		err = attempt()
+		if err == nil {
+			break
+		}
+		if !r.retriable(err) {
+			return err
+		}
+		if attempts >= r.backoff.Steps {
+			return fmt.Errorf("%w after %d attempts: %w", ErrRetryBudgetExhausted, attempts, err)
+		}
+		delay := r.reconnectDelay(attempts)
+		log().Infof("Retrying connection in %v", delay)
+		select {
+		case <-ctx.Done():
+			return status.Error(codes.Canceled, "context canceled")
+		case <-time.After(delay):
+		}
 	}
 
 	// Gotta make sure we went through the retry.OnError loop at least once and
@@ -734,6 +1229,15 @@ func (r *Remote) Connect(ctx context.Context, forceReauth bool) error {
 	return nil
 }
 
+// PayloadCipher returns the cipher negotiated during the last authentication
+// to encrypt the payload of events with, or nil if payload encryption is not
+// enabled.
+func (r *Remote) PayloadCipher() *event.PayloadCipher {
+	r.tokenMu.Lock()
+	defer r.tokenMu.Unlock()
+	return r.payloadCipher
+}
+
 // Conn returns this remote's underlying gRPC connection object. It should
 // be treated as read-only.
 func (r *Remote) Conn() *grpc.ClientConn {
@@ -20,10 +20,12 @@ import (
 	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
+	"math"
 	"math/big"
 	"net"
 	"path"
 	"strconv"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -43,6 +45,8 @@ import (
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/stats"
 	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func Test_Connect(t *testing.T) {
@@ -110,6 +114,73 @@ func Test_Connect(t *testing.T) {
 
 }
 
+// freeUDPPort returns a UDP port that is not in use
+func freeUDPPort(t *testing.T) int {
+	t.Helper()
+	c, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer c.Close()
+	return c.LocalAddr().(*net.UDPAddr).Port
+}
+
+func Test_Connect_QUIC(t *testing.T) {
+	tempDir := t.TempDir()
+	basePath := path.Join(tempDir, "certs")
+	testcerts.WriteSelfSignedCert(t, "rsa", basePath, x509.Certificate{SerialNumber: big.NewInt(1)})
+	quicPort := freeUDPPort(t)
+
+	s, err := principal.NewServer(context.TODO(), kube.NewKubernetesFakeClientWithApps("default"), "default",
+		principal.WithGRPC(true),
+		principal.WithListenerAddress("127.0.0.1"),
+		principal.WithListenerPort(0),
+		principal.WithQUICListener(quicPort),
+		principal.WithTLSKeyPairFromPath(basePath+".crt", basePath+".key"),
+		principal.WithGeneratedTokenSigningKey(),
+	)
+	require.NoError(t, err)
+	am := userpass.NewUserPassAuthentication("")
+	am.UpsertUser("default", "password")
+	s.AuthMethodsForE2EOnly().RegisterMethod("userpass", am)
+	errch := make(chan error)
+	require.NoError(t, s.Start(context.Background(), errch))
+	t.Cleanup(func() {
+		require.NoError(t, s.Shutdown())
+	})
+
+	t.Run("Connect over QUIC", func(t *testing.T) {
+		r, err := NewRemote("127.0.0.1", s.ListenerForE2EOnly().Port(),
+			WithInsecureSkipTLSVerify(),
+			WithAuth("userpass", auth.Credentials{userpass.ClientIDField: "default", userpass.ClientSecretField: "password"}),
+			WithClientMode(types.AgentModeManaged),
+			WithQUIC(true),
+			WithQUICPort(quicPort),
+		)
+		require.NoError(t, err)
+		ctx, cancelFn := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancelFn()
+		require.NoError(t, r.Connect(ctx, false))
+		assert.True(t, r.useQUIC())
+		require.NotNil(t, r.accessToken)
+	})
+
+	t.Run("Fall back to TCP", func(t *testing.T) {
+		r, err := NewRemote("127.0.0.1", s.ListenerForE2EOnly().Port(),
+			WithInsecureSkipTLSVerify(),
+			WithAuth("userpass", auth.Credentials{userpass.ClientIDField: "default", userpass.ClientSecretField: "password"}),
+			WithClientMode(types.AgentModeManaged),
+			WithQUIC(true),
+			WithQUICPort(freeUDPPort(t)),
+			WithReconnectBackoff(100*time.Millisecond, time.Second, 2, 0),
+		)
+		require.NoError(t, err)
+		ctx, cancelFn := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancelFn()
+		require.NoError(t, r.Connect(ctx, false))
+		assert.False(t, r.useQUIC())
+		require.NotNil(t, r.accessToken)
+	})
+}
+
 // grpcConnTracker counts transport connections opened and closed on a gRPC server.
 // Used to assert the agent closes the ClientConn after a failed Authenticate attempt.
 type grpcConnTracker struct {
@@ -212,6 +283,126 @@ func Test_Connect_closesConnOnFailedAuthAttempt_beforeRetry(t *testing.T) {
 	require.NotNil(t, r.Conn())
 }
 
+type failingAuthenticateServer struct {
+	authapi.UnimplementedAuthenticationServer
+	calls atomic.Int32
+}
+
+func (s *failingAuthenticateServer) Authenticate(context.Context, *authapi.AuthRequest) (*authapi.AuthResponse, error) {
+	s.calls.Add(1)
+	return nil, status.Errorf(codes.Unauthenticated, "forced auth failure for test")
+}
+
+func Test_Connect_retryBudget(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	authSrv := &failingAuthenticateServer{}
+	srv := grpc.NewServer()
+	authapi.RegisterAuthenticationServer(srv, authSrv)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	host, portStr, err := net.SplitHostPort(lis.Addr().String())
+	require.NoError(t, err)
+	port, err := strconv.Atoi(portStr)
+	require.NoError(t, err)
+
+	r, err := NewRemote(host, port,
+		WithInsecurePlaintext(),
+		WithAuth("noop", auth.Credentials{}),
+		WithReconnectBackoff(10*time.Millisecond, 20*time.Millisecond, 2, 0.5),
+		WithMaxReconnectAttempts(3),
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err = r.Connect(ctx, false)
+	assert.ErrorIs(t, err, ErrRetryBudgetExhausted)
+	assert.Equal(t, int32(3), authSrv.calls.Load())
+	assert.Nil(t, r.Conn())
+}
+
+func Test_reconnectDelay(t *testing.T) {
+	r, err := NewRemote("localhost", 443, WithReconnectBackoff(time.Second, time.Minute, 2, 0))
+	require.NoError(t, err)
+	assert.Equal(t, time.Second, r.reconnectDelay(1))
+	assert.Equal(t, 4*time.Second, r.reconnectDelay(3))
+	// The delay stays at the maximum without ending the retries
+	assert.Equal(t, time.Minute, r.reconnectDelay(7))
+	assert.Equal(t, time.Minute, r.reconnectDelay(10000))
+	assert.Equal(t, math.MaxInt, r.backoff.Steps)
+}
+
+func Test_WithUnaryInterceptor(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer()
+	authapi.RegisterAuthenticationServer(srv, &failingAuthenticateServer{})
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	host, portStr, err := net.SplitHostPort(lis.Addr().String())
+	require.NoError(t, err)
+	port, err := strconv.Atoi(portStr)
+	require.NoError(t, err)
+
+	var methods []string
+	interceptor := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		methods = append(methods, method)
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	r, err := NewRemote(host, port,
+		WithInsecurePlaintext(),
+		WithAuth("noop", auth.Credentials{}),
+		WithMaxReconnectAttempts(1),
+		WithUnaryInterceptor(interceptor),
+	)
+	require.NoError(t, err)
+	require.Len(t, r.unaryInterceptors, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err = r.Connect(ctx, false)
+	assert.ErrorIs(t, err, ErrRetryBudgetExhausted)
+	assert.Equal(t, []string{"/authapi.Authentication/Authenticate"}, methods)
+}
+
+func Test_WithReconnectBackoff(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		r, err := NewRemote("localhost", 443)
+		require.NoError(t, err)
+		assert.Equal(t, DefaultReconnectBackoffInitial, r.backoff.Duration)
+		assert.Equal(t, DefaultReconnectBackoffMax, r.backoff.Cap)
+		assert.Equal(t, DefaultReconnectBackoffFactor, r.backoff.Factor)
+		assert.Equal(t, DefaultReconnectBackoffJitter, r.backoff.Jitter)
+		assert.Equal(t, math.MaxInt, r.backoff.Steps)
+	})
+	t.Run("Valid settings", func(t *testing.T) {
+		r, err := NewRemote("localhost", 443,
+			WithReconnectBackoff(2*time.Second, 30*time.Second, 1.5, 0.1),
+			WithMaxReconnectAttempts(10))
+		require.NoError(t, err)
+		assert.Equal(t, 2*time.Second, r.backoff.Duration)
+		assert.Equal(t, 30*time.Second, r.backoff.Cap)
+		assert.Equal(t, 1.5, r.backoff.Factor)
+		assert.Equal(t, 0.1, r.backoff.Jitter)
+		assert.Equal(t, 10, r.backoff.Steps)
+	})
+	t.Run("Invalid settings", func(t *testing.T) {
+		for _, opt := range []RemoteOption{
+			WithReconnectBackoff(0, time.Minute, 2, 0),
+			WithReconnectBackoff(time.Minute, time.Second, 2, 0),
+			WithReconnectBackoff(time.Second, time.Minute, 0.5, 0),
+			WithReconnectBackoff(time.Second, time.Minute, 2, -1),
+			WithMaxReconnectAttempts(-1),
+		} {
+			_, err := NewRemote("localhost", 443, opt)
+			assert.Error(t, err)
+		}
+	})
+}
+
 func Test_WithMinimumTLSVersion(t *testing.T) {
 	t.Run("All valid minimum TLS versions", func(t *testing.T) {
 		versions := map[string]uint16{
@@ -288,6 +479,185 @@ func Test_WithTLSCipherSuites(t *testing.T) {
 	})
 }
 
+func Test_WithKeepAliveTimeout(t *testing.T) {
+	t.Run("Valid timeout", func(t *testing.T) {
+		r, err := NewRemote("localhost", 443, WithKeepAlivePingInterval(30*time.Second), WithKeepAliveTimeout(10*time.Second))
+		require.NoError(t, err)
+		assert.Equal(t, 30*time.Second, r.keepAlivePingInterval)
+		assert.Equal(t, 10*time.Second, r.keepAliveTimeout)
+	})
+	t.Run("Negative timeout", func(t *testing.T) {
+		r, err := NewRemote("localhost", 443, WithKeepAliveTimeout(-time.Second))
+		assert.Error(t, err)
+		assert.Nil(t, r)
+	})
+}
+
+func Test_WithClusterLabels(t *testing.T) {
+	t.Run("Valid labels", func(t *testing.T) {
+		r, err := NewRemote("localhost", 443, WithClusterLabels(map[string]string{"region": "eu"}))
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"region": "eu"}, r.clusterLabels)
+	})
+	t.Run("Invalid labels", func(t *testing.T) {
+		r, err := NewRemote("localhost", 443, WithClusterLabels(map[string]string{"region": "eu west"}))
+		assert.Error(t, err)
+		assert.Nil(t, r)
+	})
+}
+
+func Test_WithCompressor(t *testing.T) {
+	for _, c := range []string{"gzip", "zstd"} {
+		r, err := NewRemote("localhost", 443, WithCompression(true), WithCompressor(c))
+		require.NoError(t, err)
+		assert.Equal(t, c, r.compressor)
+	}
+	r, err := NewRemote("localhost", 443, WithCompressor("none"))
+	assert.Error(t, err)
+	assert.Nil(t, r)
+}
+
+func Test_switchTransport(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "connection refused")
+	t.Run("Fallback alternates between transports", func(t *testing.T) {
+		r, err := NewRemote("localhost", 443, WithWebSocketFallback(true))
+		require.NoError(t, err)
+		assert.False(t, r.useWebSocket())
+		r.switchTransport(unavailable)
+		assert.True(t, r.useWebSocket())
+		r.switchTransport(unavailable)
+		assert.False(t, r.useWebSocket())
+	})
+	t.Run("Authentication failures do not switch transport", func(t *testing.T) {
+		r, err := NewRemote("localhost", 443, WithWebSocketFallback(true))
+		require.NoError(t, err)
+		r.switchTransport(status.Error(codes.Unauthenticated, "invalid credentials"))
+		assert.False(t, r.useWebSocket())
+	})
+	t.Run("Fallback disabled", func(t *testing.T) {
+		r, err := NewRemote("localhost", 443)
+		require.NoError(t, err)
+		r.switchTransport(unavailable)
+		assert.False(t, r.useWebSocket())
+	})
+	t.Run("WebSocket always enabled", func(t *testing.T) {
+		r, err := NewRemote("localhost", 443, WithWebSocket(true), WithWebSocketFallback(true))
+		require.NoError(t, err)
+		r.switchTransport(unavailable)
+		assert.True(t, r.useWebSocket())
+	})
+	t.Run("QUIC falls back to TCP and is retried", func(t *testing.T) {
+		r, err := NewRemote("localhost", 443, WithQUIC(true))
+		require.NoError(t, err)
+		assert.True(t, r.useQUIC())
+		r.switchTransport(unavailable)
+		assert.False(t, r.useQUIC())
+		r.switchTransport(unavailable)
+		assert.True(t, r.useQUIC())
+	})
+	t.Run("QUIC with WebSocket fallback", func(t *testing.T) {
+		r, err := NewRemote("localhost", 443, WithQUIC(true), WithWebSocketFallback(true))
+		require.NoError(t, err)
+		r.switchTransport(unavailable)
+		assert.False(t, r.useQUIC())
+		assert.False(t, r.useWebSocket())
+		r.switchTransport(unavailable)
+		assert.False(t, r.useQUIC())
+		assert.True(t, r.useWebSocket())
+		r.switchTransport(unavailable)
+		assert.True(t, r.useQUIC())
+		assert.False(t, r.useWebSocket())
+	})
+}
+
+func Test_WithQUIC(t *testing.T) {
+	t.Run("QUIC port", func(t *testing.T) {
+		r, err := NewRemote("localhost", 443, WithQUIC(true))
+		require.NoError(t, err)
+		assert.Equal(t, "localhost:443", r.quicAddr())
+		r, err = NewRemote("localhost", 443, WithQUIC(true), WithQUICPort(8443))
+		require.NoError(t, err)
+		assert.Equal(t, "localhost:8443", r.quicAddr())
+		_, err = NewRemote("localhost", 443, WithQUICPort(70000))
+		assert.Error(t, err)
+	})
+	t.Run("Explicit proxy", func(t *testing.T) {
+		r, err := NewRemote("localhost", 443, WithQUIC(true), WithProxy("http://proxy:3128", ""))
+		assert.ErrorContains(t, err, "QUIC")
+		assert.Nil(t, r)
+	})
+	t.Run("Plaintext", func(t *testing.T) {
+		r, err := NewRemote("localhost", 443, WithQUIC(true), WithInsecurePlaintext())
+		assert.ErrorContains(t, err, "QUIC")
+		assert.Nil(t, r)
+	})
+}
+
+func Test_WithServerCertificatePins(t *testing.T) {
+	t.Run("Valid pins", func(t *testing.T) {
+		r, err := NewRemote("localhost", 443, WithServerCertificatePins([]string{"sha256/" + strings.Repeat("A", 43) + "="}))
+		assert.NoError(t, err)
+		assert.NotNil(t, r.tlsConfig.VerifyConnection)
+	})
+
+	t.Run("Invalid pins", func(t *testing.T) {
+		r, err := NewRemote("localhost", 443, WithServerCertificatePins([]string{"cowabunga"}))
+		assert.Error(t, err)
+		assert.Nil(t, r)
+	})
+}
+
+func Test_WithTLSFromSecret(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tlsSecret := func(commonName string) *corev1.Secret {
+		templ := testcerts.DefaultCertTempl
+		templ.Subject.CommonName = commonName
+		crt, key := testcerts.CreateSelfSignedCert(t, "rsa", templ)
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "agent-tls", Namespace: "argocd"},
+			Type:       corev1.SecretTypeTLS,
+			Data:       map[string][]byte{corev1.TLSCertKey: crt, corev1.TLSPrivateKeyKey: key},
+		}
+	}
+	commonName := func(r *Remote) string {
+		cert, err := r.tlsConfig.GetClientCertificate(&tls.CertificateRequestInfo{})
+		require.NoError(t, err)
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		require.NoError(t, err)
+		return leaf.Subject.CommonName
+	}
+
+	kcl := kube.NewFakeClientsetWithResources(tlsSecret("first"))
+	r, err := NewRemote("localhost", 443, WithTLSFromSecret(ctx, kcl, "argocd", "agent-tls"))
+	require.NoError(t, err)
+	assert.Equal(t, "first", commonName(r))
+
+	t.Run("Rotated certificate is loaded", func(t *testing.T) {
+		_, err := kcl.CoreV1().Secrets("argocd").Update(ctx, tlsSecret("second"), metav1.UpdateOptions{})
+		require.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			return commonName(r) == "second"
+		}, 2*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Certificate is rotated more than once", func(t *testing.T) {
+		for _, cn := range []string{"third", "fourth"} {
+			_, err := kcl.CoreV1().Secrets("argocd").Update(ctx, tlsSecret(cn), metav1.UpdateOptions{})
+			require.NoError(t, err)
+			assert.Eventually(t, func() bool {
+				return commonName(r) == cn
+			}, 2*time.Second, 10*time.Millisecond)
+		}
+	})
+
+	t.Run("Missing secret", func(t *testing.T) {
+		_, err := NewRemote("localhost", 443, WithTLSFromSecret(ctx, kcl, "argocd", "missing"))
+		assert.ErrorContains(t, err, "unable to read TLS client from secret")
+	})
+}
+
 func Test_validateTLSConfig(t *testing.T) {
 	t.Run("Valid configuration with min < max", func(t *testing.T) {
 		r, err := NewRemote("localhost", 443,
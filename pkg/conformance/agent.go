@@ -0,0 +1,274 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conformance
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/internal/auth"
+	"github.com/argoproj-labs/argocd-agent/internal/event"
+	"github.com/argoproj-labs/argocd-agent/internal/event/targets"
+	"github.com/argoproj-labs/argocd-agent/internal/issuer"
+	"github.com/argoproj-labs/argocd-agent/internal/tlsutil"
+	"github.com/argoproj-labs/argocd-agent/pkg/api/grpc/authapi"
+	"github.com/argoproj-labs/argocd-agent/pkg/api/grpc/eventstreamapi"
+	"github.com/argoproj-labs/argocd-agent/pkg/api/grpc/versionapi"
+	"github.com/argoproj-labs/argocd-agent/pkg/types"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// The identity the principal served by RunAgent gives to the agent
+const (
+	harnessAgentName          = "conformance-agent"
+	harnessPrincipalNamespace = "argocd"
+)
+
+// AgentTarget describes the agent verified by RunAgent
+type AgentTarget struct {
+	// Mode is the mode the agent runs in. It defaults to managed.
+	Mode types.AgentMode
+	// Start starts the agent and has it connect to the principal at
+	// endpoint, with any credentials. The agent must stop when the test
+	// ends, e.g. by a cleanup function registered with t.
+	Start func(t *testing.T, endpoint Endpoint)
+	// Timeout is how long to wait for the agent to respond. It defaults to
+	// DefaultTimeout, and must allow for the agent to retry authentication.
+	Timeout time.Duration
+}
+
+// Endpoint is the address of the principal RunAgent serves to the agent
+type Endpoint struct {
+	Host string
+	Port int
+	// RootCA is the PEM encoded certificate of the CA that issued the TLS
+	// certificate of the principal
+	RootCA []byte
+}
+
+// RunAgent runs the conformance tests against the agent described by target,
+// acting as its principal
+func RunAgent(t *testing.T, target AgentTarget) {
+	if target.Mode == types.AgentModeUnknown {
+		target.Mode = types.AgentModeManaged
+	}
+	if target.Timeout == 0 {
+		target.Timeout = DefaultTimeout
+	}
+	p, endpoint := startHarnessPrincipal(t)
+	target.Start(t, endpoint)
+
+	// The first stream of the agent is used by all tests that follow, since
+	// the agent requests a resync on its first one only.
+	var s *session
+	ok := t.Run("Handshake", func(t *testing.T) {
+		select {
+		case s = <-p.sessions:
+		case <-time.After(target.Timeout):
+			t.Fatalf("Agent did not open an event stream within %v", target.Timeout)
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		assert.True(t, p.versionRequested, "agent must request the version of the principal")
+		assert.Equal(t, target.Mode.String(), p.mode, "agent must authenticate in its mode")
+	})
+	if !ok {
+		return
+	}
+
+	t.Run("Auth", func(t *testing.T) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		assert.GreaterOrEqual(t, p.authAttempts, 2, "agent must retry a rejected authentication")
+		assert.Zero(t, p.unauthorizedStreams, "agent must not open event streams without a valid token")
+	})
+
+	t.Run("Resync", func(t *testing.T) {
+		// The principal is the source of truth for managed agents, which ask
+		// it for the resources they should have. Autonomous agents are the
+		// source of truth, and ask the principal to resync.
+		want := event.SyncedResourceList
+		if target.Mode.IsAutonomous() {
+			want = event.EventRequestResourceResync
+		}
+		s.expect(t, target.Timeout, "request for "+want.String(), isEvent(targets.ResourceResync, want))
+	})
+
+	t.Run("Ack", func(t *testing.T) {
+		require.NoError(t, s.send(s.events.HeartbeatEvent(event.Ping)))
+		s.expect(t, target.Timeout, "answer to heartbeat", isEvent(targets.Heartbeat, event.Pong))
+
+		probe := s.newProbe(uuid.NewString())
+		require.NoError(t, s.send(probe))
+		ack := s.expect(t, target.Timeout, "ACK of invalid event", isAckOf(probe))
+		assert.Equal(t, event.OutcomeRejected, event.OutcomeOf(ack), "invalid events must be rejected")
+		assert.NotEmpty(t, event.RejectionReason(ack), "rejections must carry a reason")
+	})
+
+	t.Run("Ordering", func(t *testing.T) {
+		verifyOrdering(t, s, target.Timeout)
+	})
+}
+
+// harnessPrincipal is the principal RunAgent serves to the agent. It rejects
+// the first authentication of the agent, and records how the agent connects.
+type harnessPrincipal struct {
+	authapi.UnimplementedAuthenticationServer
+	versionapi.UnimplementedVersionServer
+	eventstreamapi.UnimplementedEventStreamServer
+
+	issuer   *issuer.JwtIssuer
+	sessions chan *session
+
+	mu                  sync.Mutex
+	authAttempts        int
+	mode                string
+	versionRequested    bool
+	unauthorizedStreams int
+}
+
+// startHarnessPrincipal starts serving a harnessPrincipal with a TLS
+// certificate of its own until the test ends
+func startHarnessPrincipal(t *testing.T) (*harnessPrincipal, Endpoint) {
+	t.Helper()
+	keyOpts := tlsutil.KeyGenOptions{Algorithm: "ecdsa-p256"}
+	caCertPEM, caKeyPEM, err := tlsutil.GenerateCaCertificate("conformance-ca", 1, keyOpts)
+	require.NoError(t, err)
+	caCerts := tlsutil.X509CertsFromPEM([]byte(caCertPEM))
+	require.Len(t, caCerts, 1)
+	caKey, err := tlsutil.ParsePrivateKeyFromPEM([]byte(caKeyPEM))
+	require.NoError(t, err)
+	certPEM, keyPEM, err := tlsutil.GenerateServerCertificate("conformance-principal", caCerts[0], caKey, []string{"127.0.0.1"}, []string{"localhost"}, 1, keyOpts)
+	require.NoError(t, err)
+	cert, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	require.NoError(t, err)
+
+	signingKey, err := tlsutil.GeneratePrivateKey(keyOpts)
+	require.NoError(t, err)
+	iss, err := issuer.NewIssuer("conformance", issuer.WithPrivateKey(signingKey))
+	require.NoError(t, err)
+	p := &harnessPrincipal{
+		issuer:   iss,
+		sessions: make(chan *session, 1),
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer(grpc.Creds(credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	})))
+	authapi.RegisterAuthenticationServer(srv, p)
+	versionapi.RegisterVersionServer(srv, p)
+	eventstreamapi.RegisterEventStreamServer(srv, p)
+	go func() {
+		_ = srv.Serve(lis)
+	}()
+	t.Cleanup(srv.Stop)
+
+	return p, Endpoint{
+		Host:   "127.0.0.1",
+		Port:   lis.Addr().(*net.TCPAddr).Port,
+		RootCA: []byte(caCertPEM),
+	}
+}
+
+func (p *harnessPrincipal) Authenticate(ctx context.Context, req *authapi.AuthRequest) (*authapi.AuthResponse, error) {
+	p.mu.Lock()
+	p.authAttempts++
+	attempt := p.authAttempts
+	p.mu.Unlock()
+	// Agents must retry, since the principal may be unavailable for a
+	// moment, e.g. while it is restarted
+	if attempt == 1 {
+		return nil, status.Error(codes.Unauthenticated, "authentication failed")
+	}
+
+	sub, err := json.Marshal(auth.AuthSubject{ClientID: harnessAgentName, Mode: req.Mode})
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	accessToken, err := p.issuer.IssueAccessToken(string(sub), time.Hour)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	refreshToken, err := p.issuer.IssueRefreshToken(string(sub), 24*time.Hour)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	p.mu.Lock()
+	p.mode = req.Mode
+	p.mu.Unlock()
+	return &authapi.AuthResponse{
+		AccessToken:        accessToken,
+		RefreshToken:       refreshToken,
+		PrincipalNamespace: harnessPrincipalNamespace,
+	}, nil
+}
+
+func (p *harnessPrincipal) Version(ctx context.Context, req *versionapi.VersionRequest) (*versionapi.VersionResponse, error) {
+	p.mu.Lock()
+	p.versionRequested = true
+	p.mu.Unlock()
+	return &versionapi.VersionResponse{Version: "conformance"}, nil
+}
+
+func (p *harnessPrincipal) Subscribe(subs eventstreamapi.EventStream_SubscribeServer) error {
+	if !p.authorized(subs.Context()) {
+		p.mu.Lock()
+		p.unauthorizedStreams++
+		p.mu.Unlock()
+		return status.Error(codes.Unauthenticated, "invalid access token")
+	}
+	if err := subs.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+	s := newSession(subs, "conformance://principal")
+	select {
+	case p.sessions <- s:
+	default:
+		// Streams the agent opens when it reconnects are served, but not
+		// verified
+	}
+	<-subs.Context().Done()
+	return nil
+}
+
+// authorized returns whether the stream with context ctx was opened with an
+// access token issued by p
+func (p *harnessPrincipal) authorized(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return false
+	}
+	tokens := md.Get("authorization")
+	if len(tokens) != 1 {
+		return false
+	}
+	_, err := p.issuer.ValidateAccessToken(tokens[0])
+	return err == nil
+}
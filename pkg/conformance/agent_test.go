@@ -0,0 +1,54 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conformance
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/agent"
+	"github.com/argoproj-labs/argocd-agent/internal/auth"
+	"github.com/argoproj-labs/argocd-agent/internal/auth/userpass"
+	"github.com/argoproj-labs/argocd-agent/pkg/client"
+	"github.com/argoproj-labs/argocd-agent/pkg/types"
+	"github.com/argoproj-labs/argocd-agent/test/fake/kube"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_RunAgent(t *testing.T) {
+	RunAgent(t, AgentTarget{
+		Mode: types.AgentModeAutonomous,
+		Start: func(t *testing.T, endpoint Endpoint) {
+			remote, err := client.NewRemote(endpoint.Host, endpoint.Port,
+				client.WithRootAuthorities(endpoint.RootCA),
+				client.WithAuth("userpass", auth.Credentials{userpass.ClientIDField: "conformance", userpass.ClientSecretField: "password"}),
+				client.WithReconnectBackoff(100*time.Millisecond, time.Second, 2, 0),
+			)
+			require.NoError(t, err)
+			a, err := agent.NewAgent(context.TODO(), kube.NewKubernetesFakeClientWithApps("argocd"), "argocd",
+				agent.WithRemote(remote),
+				agent.WithMode(types.AgentModeAutonomous.String()),
+				agent.WithCacheRefreshInterval(10*time.Second),
+				agent.WithInformerSyncTimeout(10*time.Second),
+			)
+			require.NoError(t, err)
+			require.NoError(t, a.Start(context.Background()))
+			t.Cleanup(func() {
+				_ = a.Stop()
+			})
+		},
+	})
+}
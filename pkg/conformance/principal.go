@@ -0,0 +1,184 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package conformance verifies that a build of the principal or the agent,
+// such as a fork or an alternative implementation, speaks the protocol of
+// argocd-agent. RunPrincipal verifies a principal by acting as an agent, and
+// RunAgent verifies an agent by acting as a principal. Both are meant to be
+// called from a Go test of the build under test, and cover the handshake,
+// authentication, the resync on the first connection, acknowledgements and
+// the order events are processed in.
+package conformance
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/internal/event"
+	"github.com/argoproj-labs/argocd-agent/internal/event/targets"
+	"github.com/argoproj-labs/argocd-agent/pkg/api/grpc/eventstreamapi"
+	"github.com/argoproj-labs/argocd-agent/pkg/api/grpc/versionapi"
+	"github.com/argoproj-labs/argocd-agent/pkg/client"
+	"github.com/argoproj-labs/argocd-agent/pkg/types"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// DefaultTimeout is how long the suites wait for the build under test to
+// respond, unless configured otherwise
+const DefaultTimeout = 10 * time.Second
+
+// orderedProbes is the number of events sent to verify the order in which
+// events are processed
+const orderedProbes = 10
+
+// PrincipalTarget describes the principal verified by RunPrincipal
+type PrincipalTarget struct {
+	// Host and Port are the address of the principal's gRPC listener
+	Host string
+	Port int
+	// Options configure the connection to the principal, such as its TLS
+	// settings and the credentials of the agent to connect as. The agent
+	// must not have connected to the principal since it was started.
+	Options []client.RemoteOption
+	// InvalidAuth configures credentials the principal must not accept. The
+	// authentication test is skipped if it is nil.
+	InvalidAuth client.RemoteOption
+	// Mode is the mode to connect in. It defaults to managed.
+	Mode types.AgentMode
+	// Timeout is how long to wait for the principal to respond. It defaults
+	// to DefaultTimeout.
+	Timeout time.Duration
+}
+
+// RunPrincipal runs the conformance tests against the principal described
+// by target, acting as an agent
+func RunPrincipal(t *testing.T, target PrincipalTarget) {
+	if target.Mode == types.AgentModeUnknown {
+		target.Mode = types.AgentModeManaged
+	}
+	if target.Timeout == 0 {
+		target.Timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	newRemote := func(t *testing.T, opts ...client.RemoteOption) *client.Remote {
+		opts = append(append([]client.RemoteOption{}, target.Options...), opts...)
+		opts = append(opts, client.WithClientMode(target.Mode))
+		r, err := client.NewRemote(target.Host, target.Port, opts...)
+		require.NoError(t, err)
+		return r
+	}
+
+	// The stream opened by the handshake is used by all tests that follow,
+	// since the principal requests a resync on the first one only.
+	var s *session
+	ok := t.Run("Handshake", func(t *testing.T) {
+		r := newRemote(t)
+		cctx, ccancel := context.WithTimeout(ctx, target.Timeout)
+		defer ccancel()
+		require.NoError(t, r.Connect(cctx, false), "agent must be able to authenticate")
+		go func() {
+			<-ctx.Done()
+			r.Disconnect()
+		}()
+
+		vr, err := versionapi.NewVersionClient(r.Conn()).Version(cctx, &versionapi.VersionRequest{})
+		require.NoError(t, err)
+		assert.NotEmpty(t, vr.Version, "principal must report its version")
+
+		stream, err := eventstreamapi.NewEventStreamClient(r.Conn()).Subscribe(ctx)
+		require.NoError(t, err)
+		// The principal accepts the stream by sending its header
+		header := make(chan error, 1)
+		go func() {
+			_, err := stream.Header()
+			header <- err
+		}()
+		select {
+		case err := <-header:
+			require.NoError(t, err, "principal must accept the event stream")
+		case <-cctx.Done():
+			t.Fatalf("Principal did not accept the event stream within %v", target.Timeout)
+		}
+		s = newSession(stream, "conformance://agent")
+	})
+	if !ok {
+		return
+	}
+
+	t.Run("Auth", func(t *testing.T) {
+		if target.InvalidAuth == nil {
+			t.Skip("No invalid credentials configured")
+		}
+		r := newRemote(t, target.InvalidAuth, client.WithMaxReconnectAttempts(1))
+		cctx, ccancel := context.WithTimeout(ctx, target.Timeout)
+		defer ccancel()
+		assert.Error(t, r.Connect(cctx, false), "principal must not accept invalid credentials")
+		assert.Nil(t, r.Conn())
+	})
+
+	t.Run("Resync", func(t *testing.T) {
+		// The principal is the source of truth for managed agents, and asks
+		// them to resync. It asks autonomous agents for the resources it
+		// should have.
+		want := event.EventRequestResourceResync
+		if target.Mode.IsAutonomous() {
+			want = event.SyncedResourceList
+		}
+		s.expect(t, target.Timeout, "request for "+want.String(), isEvent(targets.ResourceResync, want))
+	})
+
+	t.Run("Ack", func(t *testing.T) {
+		ping := s.events.HeartbeatEvent(event.Ping)
+		require.NoError(t, s.send(ping))
+		ack := s.expect(t, target.Timeout, "ACK of heartbeat", isAckOf(ping))
+		assert.Equal(t, event.OutcomeApplied, event.OutcomeOf(ack), "heartbeats must be applied")
+
+		probe := s.newProbe(uuid.NewString())
+		require.NoError(t, s.send(probe))
+		ack = s.expect(t, target.Timeout, "ACK of invalid event", isAckOf(probe))
+		assert.Equal(t, event.OutcomeRejected, event.OutcomeOf(ack), "invalid events must be rejected")
+		assert.NotEmpty(t, event.RejectionReason(ack), "rejections must carry a reason")
+	})
+
+	t.Run("Ordering", func(t *testing.T) {
+		verifyOrdering(t, s, target.Timeout)
+	})
+}
+
+// verifyOrdering sends events for the same resource on s, and verifies that
+// the peer acknowledges them in the order they were sent
+func verifyOrdering(t *testing.T, s *session, timeout time.Duration) {
+	t.Helper()
+	resourceID := uuid.NewString()
+	probes := make([]*cloudevents.Event, orderedProbes)
+	pending := make(map[string]bool, len(probes))
+	for i := range probes {
+		probes[i] = s.newProbe(resourceID)
+		pending[event.EventID(probes[i])] = true
+		require.NoError(t, s.send(probes[i]))
+	}
+	for i, probe := range probes {
+		ack := s.expect(t, timeout, "ACK of ordered event", func(ev *cloudevents.Event) bool {
+			return event.Target(ev) == targets.EventAck && pending[event.EventID(ev)]
+		})
+		require.Equal(t, event.EventID(probe), event.EventID(ack), "event %d of the same resource must be acknowledged in order", i)
+		delete(pending, event.EventID(ack))
+	}
+}
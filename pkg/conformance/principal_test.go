@@ -0,0 +1,62 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conformance
+
+import (
+	"context"
+	"crypto/x509"
+	"math/big"
+	"path"
+	"testing"
+
+	"github.com/argoproj-labs/argocd-agent/internal/auth"
+	"github.com/argoproj-labs/argocd-agent/internal/auth/userpass"
+	"github.com/argoproj-labs/argocd-agent/pkg/client"
+	"github.com/argoproj-labs/argocd-agent/principal"
+	"github.com/argoproj-labs/argocd-agent/test/fake/kube"
+	"github.com/argoproj-labs/argocd-agent/test/fake/testcerts"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_RunPrincipal(t *testing.T) {
+	basePath := path.Join(t.TempDir(), "certs")
+	testcerts.WriteSelfSignedCert(t, "rsa", basePath, x509.Certificate{SerialNumber: big.NewInt(1)})
+
+	s, err := principal.NewServer(context.TODO(), kube.NewKubernetesFakeClientWithApps("argocd"), "argocd",
+		principal.WithGRPC(true),
+		principal.WithListenerPort(0),
+		principal.WithTLSKeyPairFromPath(basePath+".crt", basePath+".key"),
+		principal.WithGeneratedTokenSigningKey(),
+		principal.WithRedisProxyDisabled(),
+	)
+	require.NoError(t, err)
+	am := userpass.NewUserPassAuthentication("")
+	am.UpsertUser("conformance", "password")
+	require.NoError(t, s.AuthMethodsForE2EOnly().RegisterMethod("userpass", am))
+	require.NoError(t, s.Start(context.Background(), make(chan error)))
+	t.Cleanup(func() {
+		require.NoError(t, s.Shutdown())
+	})
+
+	RunPrincipal(t, PrincipalTarget{
+		Host: "127.0.0.1",
+		Port: s.ListenerForE2EOnly().Port(),
+		Options: []client.RemoteOption{
+			client.WithInsecureSkipTLSVerify(),
+			client.WithAuth("userpass", auth.Credentials{userpass.ClientIDField: "conformance", userpass.ClientSecretField: "password"}),
+		},
+		InvalidAuth: client.WithAuth("userpass", auth.Credentials{userpass.ClientIDField: "conformance", userpass.ClientSecretField: "wrong"}),
+	})
+}
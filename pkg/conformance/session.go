@@ -0,0 +1,169 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conformance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/internal/event"
+	"github.com/argoproj-labs/argocd-agent/internal/event/targets"
+	"github.com/argoproj-labs/argocd-agent/internal/logging"
+	"github.com/argoproj-labs/argocd-agent/pkg/api/grpc/eventstreamapi"
+	format "github.com/cloudevents/sdk-go/binding/format/protobuf/v2"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// The names of the extensions that identify an event on the wire. They are
+// part of the protocol, which the harness builds its probes from.
+const (
+	extEventID    = "eventid"
+	extResourceID = "resourceid"
+)
+
+// probeType is the type of probes, which no peer knows
+const probeType = targets.TypePrefix + ".conformance-probe"
+
+// receiveBuffer is the number of received events a session holds for the
+// tests to look at, before it drops further ones
+const receiveBuffer = 256
+
+func log() *logrus.Entry {
+	return logging.GetDefaultLogger().ModuleLogger("Conformance")
+}
+
+// session is the harness' end of an event stream. It behaves like a
+// well-behaved peer, answering pings with pongs and acknowledging the events
+// it receives, and passes all received events on for the tests to inspect.
+type session struct {
+	stream   *event.ChunkedStream
+	source   string
+	events   *event.EventSource
+	received chan *cloudevents.Event
+	// err is the error the stream ended with. It is valid once received is
+	// closed.
+	err error
+}
+
+func newSession(stream event.EventStream, source string) *session {
+	s := &session{
+		stream:   event.NewChunkedStream(stream, 0, log()),
+		source:   source,
+		events:   event.NewEventSource(source),
+		received: make(chan *cloudevents.Event, receiveBuffer),
+	}
+	go s.receive()
+	return s
+}
+
+// receive receives events from the stream until it ends
+func (s *session) receive() {
+	defer close(s.received)
+	for {
+		rcvd, err := s.stream.Recv()
+		if err != nil {
+			s.err = err
+			return
+		}
+		ev, err := format.FromProto(rcvd.Event)
+		if err != nil {
+			log().WithError(err).Warn("Could not unwrap event")
+			continue
+		}
+		switch target := event.Target(ev); {
+		case target == targets.Heartbeat:
+			if ev.Type() == event.Ping.String() {
+				s.sendOrLog(s.events.HeartbeatEvent(event.Pong))
+			}
+		case !event.FireAndForget(ev):
+			ack := s.events.ProcessedEvent(event.EventProcessed, event.New(ev, target))
+			event.SetOutcome(ack, nil)
+			s.sendOrLog(ack)
+		}
+		select {
+		case s.received <- ev:
+		default:
+			log().WithField("type", ev.Type()).Debug("Dropping event nobody is waiting for")
+		}
+	}
+}
+
+// send sends ev to the peer
+func (s *session) send(ev *cloudevents.Event) error {
+	pev, err := format.ToProto(ev)
+	if err != nil {
+		return err
+	}
+	return s.stream.Send(&eventstreamapi.Event{Event: pev})
+}
+
+func (s *session) sendOrLog(ev *cloudevents.Event) {
+	if err := s.send(ev); err != nil {
+		log().WithError(err).WithField("type", ev.Type()).Warn("Could not send event")
+	}
+}
+
+// newProbe returns an event for the resource resourceID, which is of a type
+// no peer knows. Peers must reject and acknowledge probes without applying
+// them. Probes are about resyncs, whose events all peers acknowledge.
+func (s *session) newProbe(resourceID string) *cloudevents.Event {
+	ev := cloudevents.NewEvent()
+	ev.SetSource(s.source)
+	ev.SetType(probeType)
+	ev.SetDataSchema(targets.ResourceResync.String())
+	ev.SetExtension(extEventID, uuid.NewString())
+	ev.SetExtension(extResourceID, resourceID)
+	return &ev
+}
+
+// expect returns the first event received within timeout that matches, and
+// fails the test if there is none. Received events that do not match are
+// skipped.
+func (s *session) expect(t *testing.T, timeout time.Duration, what string, match func(ev *cloudevents.Event) bool) *cloudevents.Event {
+	t.Helper()
+	deadline := time.After(timeout)
+	for {
+		select {
+		case ev, ok := <-s.received:
+			if !ok {
+				t.Fatalf("Stream ended while waiting for %s: %v", what, s.err)
+				return nil
+			}
+			if match(ev) {
+				return ev
+			}
+		case <-deadline:
+			t.Fatalf("No %s received within %v", what, timeout)
+			return nil
+		}
+	}
+}
+
+// isAckOf returns a matcher for the ACKs of ev
+func isAckOf(ev *cloudevents.Event) func(*cloudevents.Event) bool {
+	id := event.EventID(ev)
+	return func(rcvd *cloudevents.Event) bool {
+		return event.Target(rcvd) == targets.EventAck && event.EventID(rcvd) == id
+	}
+}
+
+// isEvent returns a matcher for events of type evType for target
+func isEvent(target targets.EventTarget, evType event.EventType) func(*cloudevents.Event) bool {
+	return func(rcvd *cloudevents.Event) bool {
+		return event.Target(rcvd) == target && rcvd.Type() == evType.String()
+	}
+}
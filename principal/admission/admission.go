@@ -0,0 +1,140 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package admission implements validation of Applications received from
+// autonomous agents, before they are written to the control plane.
+package admission
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/argoproj-labs/argocd-agent/internal/logging"
+	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/argoproj/argo-cd/v3/util/glob"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// ErrRejected is returned, wrapped, when an Application was rejected by a
+// validator.
+var ErrRejected = errors.New("application rejected by admission")
+
+// Validator validates an Application received from an agent. It returns an
+// error describing the problem if the Application must not be admitted.
+type Validator interface {
+	Validate(ctx context.Context, agentName string, app *v1alpha1.Application) error
+}
+
+// ValidatorFunc adapts a function to the Validator interface
+type ValidatorFunc func(ctx context.Context, agentName string, app *v1alpha1.Application) error
+
+func (f ValidatorFunc) Validate(ctx context.Context, agentName string, app *v1alpha1.Application) error {
+	return f(ctx, agentName, app)
+}
+
+// Controller runs a set of validators in order, and rejects an Application if
+// any of them rejects it. A nil Controller admits all Applications.
+type Controller struct {
+	validators []Validator
+}
+
+// NewController returns a Controller running the given validators.
+func NewController(validators ...Validator) *Controller {
+	return &Controller{validators: validators}
+}
+
+// Validate runs all validators on app. The first rejection is returned as an
+// error wrapping ErrRejected.
+func (c *Controller) Validate(ctx context.Context, agentName string, app *v1alpha1.Application) error {
+	if c == nil {
+		return nil
+	}
+	for _, v := range c.validators {
+		if err := v.Validate(ctx, agentName, app); err != nil {
+			log().WithFields(logrus.Fields{
+				"agent":       agentName,
+				"application": app.QualifiedName(),
+			}).WithError(err).Warn("Rejecting application")
+			return fmt.Errorf("%w: %w", ErrRejected, err)
+		}
+	}
+	return nil
+}
+
+// SchemaValidator returns a validator that checks the structure of an
+// Application the same way the Application CRD's schema and Argo CD would,
+// so that malformed specs are rejected before they reach the API server.
+func SchemaValidator() Validator {
+	return ValidatorFunc(func(_ context.Context, _ string, app *v1alpha1.Application) error {
+		if errs := validation.IsDNS1123Subdomain(app.Name); len(errs) > 0 {
+			return fmt.Errorf("invalid name %q: %s", app.Name, strings.Join(errs, ", "))
+		}
+		if app.Spec.Project == "" {
+			return fmt.Errorf("spec.project is required")
+		}
+		if app.Spec.Destination.Server == "" && app.Spec.Destination.Name == "" {
+			return fmt.Errorf("spec.destination must have either server or name set")
+		}
+		sources := app.Spec.GetSources()
+		if len(sources) == 0 {
+			return fmt.Errorf("spec.source or spec.sources is required")
+		}
+		for i := range sources {
+			if sources[i].RepoURL == "" {
+				return fmt.Errorf("source %d: repoURL is required", i)
+			}
+			if _, err := sources[i].ExplicitType(); err != nil {
+				return fmt.Errorf("source %d: %w", i, err)
+			}
+		}
+		return nil
+	})
+}
+
+// DestinationAllowlist returns a validator that only admits Applications
+// whose destination matches one of patterns. Patterns are matched against
+// "<server>/<namespace>", where server is the destination's server URL or
+// name. Patterns may be globs, or regular expressions enclosed in slashes.
+func DestinationAllowlist(patterns []string) Validator {
+	return ValidatorFunc(func(_ context.Context, _ string, app *v1alpha1.Application) error {
+		server := app.Spec.Destination.Server
+		if server == "" {
+			server = app.Spec.Destination.Name
+		}
+		dest := server + "/" + app.Spec.Destination.Namespace
+		if !glob.MatchStringInList(patterns, dest, glob.REGEXP) {
+			return fmt.Errorf("destination %s is not allowed", dest)
+		}
+		return nil
+	})
+}
+
+// ProjectAllowlist returns a validator that only admits Applications whose
+// project, as named on the agent, matches one of patterns. Patterns may be
+// globs, or regular expressions enclosed in slashes.
+func ProjectAllowlist(patterns []string) Validator {
+	return ValidatorFunc(func(_ context.Context, _ string, app *v1alpha1.Application) error {
+		if !glob.MatchStringInList(patterns, app.Spec.Project, glob.REGEXP) {
+			return fmt.Errorf("project %s is not allowed", app.Spec.Project)
+		}
+		return nil
+	})
+}
+
+func log() *logrus.Entry {
+	return logging.GetDefaultLogger().ComponentLogger("AppAdmission")
+}
@@ -0,0 +1,155 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admission
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func validApp() *v1alpha1.Application {
+	return &v1alpha1.Application{
+		ObjectMeta: metav1.ObjectMeta{Name: "guestbook", Namespace: "argocd"},
+		Spec: v1alpha1.ApplicationSpec{
+			Project: "default",
+			Source: &v1alpha1.ApplicationSource{
+				RepoURL: "https://github.com/argoproj/argocd-example-apps",
+				Path:    "guestbook",
+			},
+			Destination: v1alpha1.ApplicationDestination{
+				Server:    "https://kubernetes.default.svc",
+				Namespace: "guestbook",
+			},
+		},
+	}
+}
+
+func Test_Controller(t *testing.T) {
+	t.Run("Nil controller admits everything", func(t *testing.T) {
+		var c *Controller
+		assert.NoError(t, c.Validate(context.Background(), "agent", validApp()))
+	})
+
+	t.Run("First rejection is returned", func(t *testing.T) {
+		called := false
+		c := NewController(
+			ValidatorFunc(func(context.Context, string, *v1alpha1.Application) error { return errors.New("nope") }),
+			ValidatorFunc(func(context.Context, string, *v1alpha1.Application) error { called = true; return nil }),
+		)
+		err := c.Validate(context.Background(), "agent", validApp())
+		assert.ErrorIs(t, err, ErrRejected)
+		assert.ErrorContains(t, err, "nope")
+		assert.False(t, called)
+	})
+}
+
+func Test_SchemaValidator(t *testing.T) {
+	v := SchemaValidator()
+	tests := []struct {
+		name          string
+		mutate        func(app *v1alpha1.Application)
+		errorContains string
+	}{
+		{"Valid", func(*v1alpha1.Application) {}, ""},
+		{"Invalid name", func(app *v1alpha1.Application) { app.Name = "Guest_Book" }, "invalid name"},
+		{"Missing project", func(app *v1alpha1.Application) { app.Spec.Project = "" }, "spec.project"},
+		{"Missing destination", func(app *v1alpha1.Application) { app.Spec.Destination = v1alpha1.ApplicationDestination{} }, "spec.destination"},
+		{"Missing source", func(app *v1alpha1.Application) { app.Spec.Source = nil }, "spec.source"},
+		{"Missing repoURL", func(app *v1alpha1.Application) { app.Spec.Source.RepoURL = "" }, "repoURL"},
+		{"Multiple source types", func(app *v1alpha1.Application) {
+			app.Spec.Source.Helm = &v1alpha1.ApplicationSourceHelm{}
+			app.Spec.Source.Kustomize = &v1alpha1.ApplicationSourceKustomize{}
+		}, "multiple application sources"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := validApp()
+			tt.mutate(app)
+			err := v.Validate(context.Background(), "agent", app)
+			if tt.errorContains == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.errorContains)
+			}
+		})
+	}
+}
+
+func Test_Allowlists(t *testing.T) {
+	t.Run("Destination", func(t *testing.T) {
+		v := DestinationAllowlist([]string{"https://kubernetes.default.svc/guest*", "/^in-cluster/team-[a-z]+$/"})
+		assert.NoError(t, v.Validate(context.Background(), "agent", validApp()))
+		app := validApp()
+		app.Spec.Destination = v1alpha1.ApplicationDestination{Name: "in-cluster", Namespace: "team-a"}
+		assert.NoError(t, v.Validate(context.Background(), "agent", app))
+		app.Spec.Destination.Namespace = "kube-system"
+		assert.ErrorContains(t, v.Validate(context.Background(), "agent", app), "in-cluster/kube-system is not allowed")
+	})
+
+	t.Run("Project", func(t *testing.T) {
+		v := ProjectAllowlist([]string{"team-*"})
+		assert.ErrorContains(t, v.Validate(context.Background(), "agent", validApp()), "project default is not allowed")
+		app := validApp()
+		app.Spec.Project = "team-a"
+		assert.NoError(t, v.Validate(context.Background(), "agent", app))
+	})
+}
+
+func Test_WebhookValidator(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req WebhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch req.Application.Name {
+		case "allowed":
+			_ = json.NewEncoder(w).Encode(WebhookResponse{Allowed: true})
+		case "denied":
+			_ = json.NewEncoder(w).Encode(WebhookResponse{Allowed: false, Reason: "not on my watch"})
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+
+	v, err := NewWebhookValidator(srv.URL, pool, 0)
+	require.NoError(t, err)
+
+	app := validApp()
+	app.Name = "allowed"
+	assert.NoError(t, v.Validate(context.Background(), "agent", app))
+	app.Name = "denied"
+	assert.ErrorContains(t, v.Validate(context.Background(), "agent", app), "not on my watch")
+	app.Name = "broken"
+	assert.ErrorContains(t, v.Validate(context.Background(), "agent", app), "unexpected status 500")
+
+	t.Run("Plain HTTP is refused", func(t *testing.T) {
+		_, err := NewWebhookValidator("http://example.com", nil, 0)
+		assert.ErrorContains(t, err, "https")
+	})
+}
@@ -0,0 +1,131 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admission
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+)
+
+var _ Validator = &WebhookValidator{}
+
+// DefaultWebhookTimeout is the default timeout for requests to the webhook
+const DefaultWebhookTimeout = 10 * time.Second
+
+// maxResponseSize is the maximum size of a response we read from the webhook
+const maxResponseSize = 64 * 1024
+
+// WebhookRequest is the payload POSTed to the admission webhook.
+type WebhookRequest struct {
+	// Agent is the name of the agent that sent the Application
+	Agent string `json:"agent"`
+	// Application is the Application as received from the agent
+	Application *v1alpha1.Application `json:"application"`
+}
+
+// WebhookResponse is the payload the admission webhook is expected to
+// respond with.
+type WebhookResponse struct {
+	// Allowed indicates whether the Application is admitted
+	Allowed bool `json:"allowed"`
+	// Reason is an optional, human readable reason for the decision. It is
+	// reported back to the agent.
+	Reason string `json:"reason,omitempty"`
+}
+
+// WebhookValidator delegates the admission decision to an external HTTPS
+// webhook provided by the operator.
+//
+// The webhook must respond with HTTP status 200 and a JSON encoded
+// WebhookResponse. Any other status code, or a response that cannot be
+// decoded, results in the Application being rejected.
+type WebhookValidator struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookValidator returns a validator that sends requests to webhookURL.
+// If rootCAs is nil, the system's root CAs are used to verify the webhook's
+// certificate. If timeout is 0, DefaultWebhookTimeout is used.
+func NewWebhookValidator(webhookURL string, rootCAs *x509.CertPool, timeout time.Duration) (*WebhookValidator, error) {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid admission webhook URL: %w", err)
+	}
+	if u.Scheme != "https" {
+		return nil, fmt.Errorf("admission webhook URL must use https scheme")
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("admission webhook URL must have a host")
+	}
+	if timeout == 0 {
+		timeout = DefaultWebhookTimeout
+	}
+	return &WebhookValidator{
+		url: webhookURL,
+		client: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					RootCAs:    rootCAs,
+					MinVersion: tls.VersionTLS12,
+				},
+			},
+		},
+	}, nil
+}
+
+// Validate sends app to the webhook and returns an error unless the webhook
+// admits it.
+func (v *WebhookValidator) Validate(ctx context.Context, agentName string, app *v1alpha1.Application) error {
+	payload, err := json.Marshal(&WebhookRequest{Agent: agentName, Application: app})
+	if err != nil {
+		return fmt.Errorf("could not marshal admission webhook request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("could not create admission webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("admission webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("admission webhook returned unexpected status %d", resp.StatusCode)
+	}
+
+	var result WebhookResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&result); err != nil {
+		return fmt.Errorf("could not decode admission webhook response: %w", err)
+	}
+	if !result.Allowed {
+		return fmt.Errorf("denied by admission webhook: %s", result.Reason)
+	}
+	return nil
+}
@@ -0,0 +1,271 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package agentstore persists the principal's knowledge about agents, such as
+// their operation mode and the namespace they run in, in a Kubernetes Secret.
+// This allows the principal to restart without losing track of the agents
+// that have connected to it.
+//
+// Each key of the Secret is the name of an agent, and each value a JSON
+// encoded Agent. If a KeyWrapper is configured, values are envelope encrypted
+// before they are written.
+package agentstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/internal/envelope"
+	"github.com/argoproj-labs/argocd-agent/internal/informer"
+	"github.com/argoproj-labs/argocd-agent/internal/logging"
+	"github.com/argoproj-labs/argocd-agent/pkg/types"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// syncTimeout is the time to wait for the informer to sync before giving up
+const syncTimeout = 30 * time.Second
+
+// Agent is the persisted state of a single agent
+type Agent struct {
+	// Mode is the operation mode the agent connected with
+	Mode types.AgentMode `json:"mode,omitempty"`
+	// Namespace is the namespace the agent runs in on its workload cluster
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// Store persists agents in a Secret. The zero value is not usable, use
+// NewStore.
+type Store struct {
+	kubeclient kubernetes.Interface
+	namespace  string
+	name       string
+	wrapper    envelope.KeyWrapper
+
+	mu     sync.Mutex
+	agents map[string]Agent
+}
+
+// NewStore returns a Store backed by the Secret of the given name in
+// namespace. If wrapper is not nil, agents are envelope encrypted using it.
+func NewStore(kubeclient kubernetes.Interface, namespace, name string, wrapper envelope.KeyWrapper) *Store {
+	return &Store{
+		kubeclient: kubeclient,
+		namespace:  namespace,
+		name:       name,
+		wrapper:    wrapper,
+		agents:     make(map[string]Agent),
+	}
+}
+
+// Load reads all agents from the Secret. A Secret that does not exist yields
+// no agents.
+func (s *Store) Load(ctx context.Context) (map[string]Agent, error) {
+	secret, err := s.kubeclient.CoreV1().Secrets(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return map[string]Agent{}, nil
+		}
+		return nil, fmt.Errorf("could not get agent store secret: %w", err)
+	}
+	agents := s.decode(ctx, secret.Data)
+	s.mu.Lock()
+	s.agents = agents
+	s.mu.Unlock()
+	return maps.Clone(agents), nil
+}
+
+// Update applies fn to the stored state of agentName and persists the
+// result, unless fn did not change it.
+func (s *Store) Update(ctx context.Context, agentName string, fn func(a *Agent)) error {
+	s.mu.Lock()
+	current := s.agents[agentName]
+	s.mu.Unlock()
+	updated := current
+	fn(&updated)
+	if updated == current {
+		return nil
+	}
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		client := s.kubeclient.CoreV1().Secrets(s.namespace)
+		secret, err := client.Get(ctx, s.name, metav1.GetOptions{})
+		create := apierrors.IsNotFound(err)
+		if err != nil && !create {
+			return err
+		}
+		if create {
+			secret = &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: s.name, Namespace: s.namespace}}
+		}
+		agents := s.decode(ctx, secret.Data)
+		agent := agents[agentName]
+		fn(&agent)
+		value, err := s.encode(ctx, agent)
+		if err != nil {
+			return err
+		}
+		if secret.Data == nil {
+			secret.Data = make(map[string][]byte)
+		}
+		secret.Data[agentName] = value
+		if create {
+			_, err = client.Create(ctx, secret, metav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(err) {
+				return apierrors.NewConflict(corev1.Resource("secrets"), s.name, err)
+			}
+		} else {
+			_, err = client.Update(ctx, secret, metav1.UpdateOptions{})
+		}
+		if err == nil {
+			agents[agentName] = agent
+			s.mu.Lock()
+			s.agents = agents
+			s.mu.Unlock()
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("could not update agent store secret: %w", err)
+	}
+	return nil
+}
+
+// Watch keeps watching the Secret for changes made by others, e.g. by an
+// operator removing an agent or by another replica of the principal. For
+// each agent added or changed, onUpdate is called, and for each agent
+// removed, onDelete is called. Watch starts an informer in the background,
+// which is stopped when ctx is done, and waits for the initial sync before
+// returning.
+func (s *Store) Watch(ctx context.Context, onUpdate func(name string, agent Agent), onDelete func(name string)) error {
+	apply := func(data map[string][]byte) {
+		agents := s.decode(ctx, data)
+		s.mu.Lock()
+		previous := s.agents
+		s.agents = agents
+		s.mu.Unlock()
+		for name, agent := range agents {
+			if old, ok := previous[name]; !ok || old != agent {
+				onUpdate(name, agent)
+			}
+		}
+		for name := range previous {
+			if _, ok := agents[name]; !ok {
+				onDelete(name)
+			}
+		}
+	}
+
+	selector := fields.OneTermEqualSelector("metadata.name", s.name).String()
+	inf, err := informer.NewInformer[*corev1.Secret](ctx,
+		informer.WithListHandler[*corev1.Secret](func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+			opts.FieldSelector = selector
+			return s.kubeclient.CoreV1().Secrets(s.namespace).List(ctx, opts)
+		}),
+		informer.WithWatchHandler[*corev1.Secret](func(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+			opts.FieldSelector = selector
+			return s.kubeclient.CoreV1().Secrets(s.namespace).Watch(ctx, opts)
+		}),
+		informer.WithAddHandler(func(secret *corev1.Secret) {
+			if secret.Name == s.name {
+				apply(secret.Data)
+			}
+		}),
+		informer.WithUpdateHandler(func(_ *corev1.Secret, secret *corev1.Secret) {
+			if secret.Name == s.name {
+				apply(secret.Data)
+			}
+		}),
+		informer.WithDeleteHandler(func(secret *corev1.Secret) {
+			if secret.Name == s.name {
+				apply(nil)
+			}
+		}),
+		informer.WithGroupResource[*corev1.Secret]("", "secrets"),
+	)
+	if err != nil {
+		return fmt.Errorf("could not create agent store informer: %w", err)
+	}
+
+	go func() {
+		if err := inf.Start(ctx); err != nil {
+			log().WithError(err).Error("Could not start agent store informer")
+		}
+	}()
+
+	syncCtx, cancel := context.WithTimeout(ctx, syncTimeout)
+	defer cancel()
+	if err := inf.WaitForSync(syncCtx); err != nil {
+		return fmt.Errorf("agent store informer did not sync: %w", err)
+	}
+	log().Infof("Watching Secret %s/%s for agents", s.namespace, s.name)
+	return nil
+}
+
+// decode decodes the agents stored in data. Values that cannot be decoded
+// are logged and skipped.
+func (s *Store) decode(ctx context.Context, data map[string][]byte) map[string]Agent {
+	agents := make(map[string]Agent, len(data))
+	for name, value := range data {
+		if s.wrapper == nil && envelope.IsSealed(value) {
+			log().WithField("agent", name).Error("Stored agent is encrypted, but no encryption key is configured")
+			continue
+		}
+		if s.wrapper != nil {
+			plain, err := envelope.Open(ctx, s.wrapper, value)
+			if err == nil {
+				value = plain
+			} else if !errors.Is(err, envelope.ErrNotSealed) {
+				log().WithError(err).WithField("agent", name).Error("Could not decrypt stored agent")
+				continue
+			}
+			// Values that are not sealed were written before encryption was
+			// enabled, and are encrypted on their next update.
+		}
+		agent := Agent{}
+		if err := json.Unmarshal(value, &agent); err != nil {
+			log().WithError(err).WithField("agent", name).Error("Could not decode stored agent")
+			continue
+		}
+		agents[name] = agent
+	}
+	return agents
+}
+
+// encode encodes agent, encrypting it if a KeyWrapper is configured
+func (s *Store) encode(ctx context.Context, agent Agent) ([]byte, error) {
+	value, err := json.Marshal(&agent)
+	if err != nil {
+		return nil, err
+	}
+	if s.wrapper == nil {
+		return value, nil
+	}
+	return envelope.Seal(ctx, s.wrapper, value)
+}
+
+func log() *logrus.Entry {
+	return logging.GetDefaultLogger().ComponentLogger("AgentStore")
+}
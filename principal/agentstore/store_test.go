@@ -0,0 +1,151 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package agentstore
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/internal/envelope"
+	"github.com/argoproj-labs/argocd-agent/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+const (
+	testNamespace = "argocd"
+	testSecret    = "argocd-agent-store"
+)
+
+func getSecret(t *testing.T, kubeclient *kubefake.Clientset) *corev1.Secret {
+	t.Helper()
+	secret, err := kubeclient.CoreV1().Secrets(testNamespace).Get(context.Background(), testSecret, metav1.GetOptions{})
+	require.NoError(t, err)
+	return secret
+}
+
+func Test_Store(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Agents survive a new store instance", func(t *testing.T) {
+		kubeclient := kubefake.NewSimpleClientset()
+		s := NewStore(kubeclient, testNamespace, testSecret, nil)
+		agents, err := s.Load(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, agents)
+
+		require.NoError(t, s.Update(ctx, "agent-1", func(a *Agent) { a.Mode = types.AgentModeManaged }))
+		require.NoError(t, s.Update(ctx, "agent-1", func(a *Agent) { a.Namespace = "argocd" }))
+		require.NoError(t, s.Update(ctx, "agent-2", func(a *Agent) { a.Mode = types.AgentModeAutonomous }))
+
+		agents, err = NewStore(kubeclient, testNamespace, testSecret, nil).Load(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]Agent{
+			"agent-1": {Mode: types.AgentModeManaged, Namespace: "argocd"},
+			"agent-2": {Mode: types.AgentModeAutonomous},
+		}, agents)
+	})
+
+	t.Run("Unchanged agents are not written", func(t *testing.T) {
+		kubeclient := kubefake.NewSimpleClientset()
+		s := NewStore(kubeclient, testNamespace, testSecret, nil)
+		require.NoError(t, s.Update(ctx, "agent-1", func(a *Agent) { a.Mode = types.AgentModeManaged }))
+		actions := len(kubeclient.Actions())
+		require.NoError(t, s.Update(ctx, "agent-1", func(a *Agent) { a.Mode = types.AgentModeManaged }))
+		assert.Len(t, kubeclient.Actions(), actions)
+	})
+
+	t.Run("Agents are encrypted with a key wrapper", func(t *testing.T) {
+		kw, err := envelope.NewAESKeyWrapper(bytes.Repeat([]byte{1}, 32))
+		require.NoError(t, err)
+		kubeclient := kubefake.NewSimpleClientset()
+		s := NewStore(kubeclient, testNamespace, testSecret, kw)
+		require.NoError(t, s.Update(ctx, "agent-1", func(a *Agent) { a.Mode = types.AgentModeManaged }))
+
+		assert.NotContains(t, string(getSecret(t, kubeclient).Data["agent-1"]), "managed")
+
+		agents, err := NewStore(kubeclient, testNamespace, testSecret, kw).Load(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, Agent{Mode: types.AgentModeManaged}, agents["agent-1"])
+
+		// Without the key, the agent cannot be read
+		agents, err = NewStore(kubeclient, testNamespace, testSecret, nil).Load(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, agents)
+	})
+
+	t.Run("Plain text agents are encrypted on update", func(t *testing.T) {
+		kubeclient := kubefake.NewSimpleClientset(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: testSecret, Namespace: testNamespace},
+			Data:       map[string][]byte{"agent-1": []byte(`{"mode":"managed"}`)},
+		})
+		kw, err := envelope.NewAESKeyWrapper(bytes.Repeat([]byte{1}, 32))
+		require.NoError(t, err)
+		s := NewStore(kubeclient, testNamespace, testSecret, kw)
+		agents, err := s.Load(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, Agent{Mode: types.AgentModeManaged}, agents["agent-1"])
+
+		require.NoError(t, s.Update(ctx, "agent-1", func(a *Agent) { a.Namespace = "argocd" }))
+		assert.NotContains(t, string(getSecret(t, kubeclient).Data["agent-1"]), "managed")
+	})
+}
+
+func Test_Watch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	kubeclient := kubefake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: testSecret, Namespace: testNamespace},
+		Data:       map[string][]byte{"agent-1": []byte(`{"mode":"managed"}`)},
+	})
+	s := NewStore(kubeclient, testNamespace, testSecret, nil)
+	_, err := s.Load(ctx)
+	require.NoError(t, err)
+
+	mu := sync.Mutex{}
+	updated := map[string]Agent{}
+	deleted := []string{}
+	err = s.Watch(ctx, func(name string, agent Agent) {
+		mu.Lock()
+		defer mu.Unlock()
+		updated[name] = agent
+	}, func(name string) {
+		mu.Lock()
+		defer mu.Unlock()
+		deleted = append(deleted, name)
+	})
+	require.NoError(t, err)
+
+	secret := getSecret(t, kubeclient)
+	secret.Data = map[string][]byte{"agent-2": []byte(`{"mode":"autonomous"}`)}
+	_, err = kubeclient.CoreV1().Secrets(testNamespace).Update(ctx, secret, metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(updated) == 1 && len(deleted) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, Agent{Mode: types.AgentModeAutonomous}, updated["agent-2"])
+	assert.Equal(t, []string{"agent-1"}, deleted)
+}
@@ -17,18 +17,27 @@ package auth
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/argoproj-labs/argocd-agent/internal/audit"
 	"github.com/argoproj-labs/argocd-agent/internal/auth"
+	"github.com/argoproj-labs/argocd-agent/internal/event"
+	"github.com/argoproj-labs/argocd-agent/internal/grpcutil"
 	"github.com/argoproj-labs/argocd-agent/internal/issuer"
 	"github.com/argoproj-labs/argocd-agent/internal/logging"
+	"github.com/argoproj-labs/argocd-agent/internal/metrics"
 	"github.com/argoproj-labs/argocd-agent/internal/queue"
 	"github.com/argoproj-labs/argocd-agent/internal/version"
 	"github.com/argoproj-labs/argocd-agent/pkg/api/grpc/authapi"
 	"github.com/argoproj-labs/argocd-agent/principal/registration"
 	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
@@ -41,6 +50,11 @@ type Server struct {
 
 	agentRegistrationManager *registration.AgentRegistrationManager
 
+	// limiter limits authentication attempts, if configured
+	limiter *attemptLimiter
+	// stormGuard limits authentication attempts after startup, if configured
+	stormGuard *stormGuard
+
 	// principalVersion is the version of the principal, used for handshake validation
 	principalVersion string
 	// namespace is the Kubernetes namespace the principal is running in.
@@ -48,8 +62,15 @@ type Server struct {
 }
 
 const (
-	accessTokenValidity     = 5 * time.Minute
-	refreshTokenValidity    = 24 * time.Hour
+	// DefaultAccessTokenValidity is the default lifetime of access tokens
+	DefaultAccessTokenValidity = 5 * time.Minute
+	// DefaultRefreshTokenValidity is the default lifetime of refresh tokens
+	DefaultRefreshTokenValidity = 24 * time.Hour
+	// MinAccessTokenValidity is the minimum lifetime of access tokens. Agents
+	// start refreshing their access token 30 seconds before it expires, so
+	// shorter lifetimes would cause a refresh on each request.
+	MinAccessTokenValidity = time.Minute
+
 	refreshTokenAutoRefresh = 10 * time.Minute
 )
 
@@ -59,9 +80,26 @@ const (
 
 var errAuthenticationFailed = status.Error(codes.Unauthenticated, authFailedMessage)
 
+var errTooManyAttempts = status.Error(codes.ResourceExhausted, "too many authentication attempts")
+
+var errPrincipalBusy = status.Error(codes.ResourceExhausted, "principal is busy accepting connections, retry later")
+
+var errApprovalPending = status.Error(codes.PermissionDenied, "agent registration is pending approval")
+
 type ServerOptions struct {
 	agentRegistrationManager *registration.AgentRegistrationManager
 	onAuthenticated          func(agentName, agentNamespace string)
+	revocations              issuer.RevocationStore
+	accessTokenValidity      time.Duration
+	refreshTokenValidity     time.Duration
+	rateLimit                *RateLimitConfig
+	stormProtection          *StormProtectionConfig
+	metrics                  *metrics.PrincipalMetrics
+	auditLogger              *audit.Logger
+	approvals                *registration.ApprovalStore
+	tokenScopes              []string
+	payloadKeys              *event.PayloadKeyring
+	payloadPSK               []byte
 }
 
 type ServerOption func(o *ServerOptions) error
@@ -72,7 +110,11 @@ func NewServer(queues *queue.SendRecvQueues, namespace string, authMethods *auth
 	s := &Server{
 		namespace: namespace,
 	}
-	s.options = &ServerOptions{}
+	s.options = &ServerOptions{
+		accessTokenValidity:  DefaultAccessTokenValidity,
+		refreshTokenValidity: DefaultRefreshTokenValidity,
+		tokenScopes:          issuer.DefaultScopes,
+	}
 	if authMethods != nil {
 		s.authMethods = authMethods
 	} else {
@@ -86,27 +128,50 @@ func NewServer(queues *queue.SendRecvQueues, namespace string, authMethods *auth
 			return nil, err
 		}
 	}
+	if s.options.accessTokenValidity >= s.options.refreshTokenValidity {
+		return nil, fmt.Errorf("access token validity (%v) must be shorter than refresh token validity (%v)", s.options.accessTokenValidity, s.options.refreshTokenValidity)
+	}
 
 	s.agentRegistrationManager = s.options.agentRegistrationManager
+	if s.options.rateLimit != nil {
+		s.limiter = newAttemptLimiter(*s.options.rateLimit)
+	}
+	if s.options.stormProtection != nil {
+		s.stormGuard = newStormGuard(*s.options.stormProtection)
+	}
 	s.principalVersion = version.New("argocd-agent").Version()
 	return s, nil
 }
 
-func (s *Server) issueTokens(subject *auth.AuthSubject, refresh bool) (accessToken string, refreshToken string, err error) {
+func (s *Server) issueTokens(ctx context.Context, subject *auth.AuthSubject, refresh bool) (accessToken string, refreshToken string, err error) {
 	subj, err := json.Marshal(subject)
 	if err != nil {
 		return "", "", fmt.Errorf("could not render subject to JSON: %w", err)
 	}
-	accessToken, err = s.issuer.IssueAccessToken(string(subj), accessTokenValidity)
+	// Tokens are bound to the agent and its mode, and only grant the
+	// capabilities currently configured. Scopes are re-evaluated on each
+	// refresh.
+	opts := []issuer.TokenOption{
+		issuer.WithAudience(issuer.AgentAudience(subject.ClientID)),
+		issuer.WithScopes(append([]string{issuer.ModeScope(subject.Mode)}, s.options.tokenScopes...)...),
+	}
+	accessToken, err = s.issuer.IssueAccessToken(string(subj), s.options.accessTokenValidity, opts...)
 	if err != nil {
 		return "", "", status.Error(codes.Internal, "unable to generate a token")
 	}
 	if refresh {
-		refreshToken, err = s.issuer.IssueRefreshToken(string(subj), refreshTokenValidity)
+		refreshToken, err = s.issuer.IssueRefreshToken(string(subj), s.options.refreshTokenValidity, opts...)
 		if err != nil {
 			return "", "", status.Error(codes.Internal, "unable to generate a token")
 		}
 	}
+	s.options.auditLogger.Log(audit.Event{
+		Type:          audit.EventTokenIssued,
+		Actor:         subject.ClientID,
+		Outcome:       audit.OutcomeSuccess,
+		SourceAddress: grpcutil.AddressFromContext(ctx),
+		Details:       map[string]string{"refreshToken": strconv.FormatBool(refresh)},
+	})
 	return accessToken, refreshToken, nil
 }
 
@@ -128,41 +193,110 @@ func (s *Server) Authenticate(ctx context.Context, ar *authapi.AuthRequest) (*au
 	default:
 		return nil, fmt.Errorf("unknown or missing operation mode: '%s'", ar.Mode)
 	}
+	if s.stormGuard != nil && !s.stormGuard.allow() {
+		logCtx.WithField("reason", RejectReasonStormProtection).Debug("Rejecting authentication attempt")
+		if s.options.metrics != nil {
+			s.options.metrics.AuthAttemptsRejected.WithLabelValues(RejectReasonStormProtection).Inc()
+		}
+		s.auditAuthentication(ctx, ar, claimedClientID(ar.Credentials), audit.OutcomeDenied, RejectReasonStormProtection)
+		return nil, errPrincipalBusy
+	}
+	var limitKeys []string
+	if s.limiter != nil {
+		limitKeys = rateLimitKeys(ctx, ar.Credentials)
+		if ok, reason := s.limiter.allow(limitKeys...); !ok {
+			logCtx.WithField("reason", reason).Warn("Rejecting authentication attempt")
+			if s.options.metrics != nil {
+				s.options.metrics.AuthAttemptsRejected.WithLabelValues(reason).Inc()
+			}
+			s.auditAuthentication(ctx, ar, claimedClientID(ar.Credentials), audit.OutcomeDenied, reason)
+			return nil, errTooManyAttempts
+		}
+	}
+
 	am := s.authMethods.Method(ar.Method)
 	if am == nil {
 		logCtx.Info("unknown authentication method")
+		s.authFailed(limitKeys)
+		s.auditAuthentication(ctx, ar, claimedClientID(ar.Credentials), audit.OutcomeFailure, "unknown authentication method")
 		return nil, errAuthenticationFailed
 	}
 	clientID, err := am.Authenticate(ctx, ar.Credentials)
 	if clientID == "" || err != nil {
 		logCtx.WithError(err).WithField("client", clientID).Info("client authentication failed")
+		s.authFailed(limitKeys)
+		if clientID == "" {
+			clientID = claimedClientID(ar.Credentials)
+		}
+		s.auditAuthentication(ctx, ar, clientID, audit.OutcomeFailure, "invalid credentials")
 		return nil, errAuthenticationFailed
 	}
+	if s.limiter != nil {
+		s.limiter.success(limitKeys...)
+	}
 
 	agentVersion := ar.Version
 
 	if agentVersion == "" {
 		logCtx.Warn("Agent did not provide version information")
+		s.auditAuthentication(ctx, ar, clientID, audit.OutcomeDenied, "agent version is required")
 		return nil, status.Error(codes.InvalidArgument, "agent version is required")
 	}
 
 	if agentVersion != s.principalVersion {
 		logCtx.Warnf("Version mismatch: rejecting connection (agent: %s, principal: %s)", agentVersion, s.principalVersion)
+		s.auditAuthentication(ctx, ar, clientID, audit.OutcomeDenied, "version mismatch")
 		return nil, status.Errorf(codes.FailedPrecondition, "version mismatch")
 	}
 
 	logCtx.WithField("client", clientID).WithField("agent_version", agentVersion).Info("client authentication successful")
 
+	if s.options.approvals != nil {
+		if err := s.options.approvals.Check(ctx, clientID, grpcutil.AddressFromContext(ctx)); err != nil {
+			switch {
+			case errors.Is(err, registration.ErrApprovalPending):
+				logCtx.WithField("client", clientID).Info("Rejecting agent pending approval")
+				s.auditAuthentication(ctx, ar, clientID, audit.OutcomeDenied, "registration pending approval")
+				return nil, errApprovalPending
+			case errors.Is(err, registration.ErrApprovalDenied):
+				logCtx.WithField("client", clientID).Warn("Rejecting agent with denied registration")
+				s.auditAuthentication(ctx, ar, clientID, audit.OutcomeDenied, "registration denied")
+				return nil, errAuthenticationFailed
+			default:
+				logCtx.WithError(err).WithField("client", clientID).Error("Could not check agent registration")
+				s.auditAuthentication(ctx, ar, clientID, audit.OutcomeFailure, "registration check failed")
+				return nil, errAuthenticationFailed
+			}
+		}
+	}
+
 	// If self agent registration is enabled, register the agent and create cluster secret if it doesn't exist
 	if s.agentRegistrationManager != nil && s.agentRegistrationManager.IsSelfAgentRegistrationEnabled() {
-		if err := s.agentRegistrationManager.RegisterAgent(ctx, clientID); err != nil {
+		labels, err := requestedClusterLabels(ctx)
+		if err != nil {
+			logCtx.WithError(err).WithField("client", clientID).Warn("Agent requested invalid cluster labels")
+			s.auditAuthentication(ctx, ar, clientID, audit.OutcomeDenied, "invalid cluster labels")
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if err := s.agentRegistrationManager.RegisterAgent(ctx, clientID, labels); err != nil {
 			logCtx.WithError(err).WithField("client", clientID).Error("Failed to register agent")
+			s.auditAuthentication(ctx, ar, clientID, audit.OutcomeFailure, "agent registration failed")
 			return nil, errAuthenticationFailed
 		}
 	}
 
+	if s.options.payloadKeys != nil {
+		if err := s.negotiatePayloadKey(ctx, clientID); err != nil {
+			logCtx.WithError(err).WithField("client", clientID).Warn("Could not negotiate payload key")
+			s.auditAuthentication(ctx, ar, clientID, audit.OutcomeDenied, "payload key negotiation failed")
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+	}
+
+	s.auditAuthentication(ctx, ar, clientID, audit.OutcomeSuccess, "")
+
 	subject := &auth.AuthSubject{ClientID: clientID, Mode: ar.Mode}
-	accessToken, refreshToken, err := s.issueTokens(subject, true)
+	accessToken, refreshToken, err := s.issueTokens(ctx, subject, true)
 	if err != nil {
 		logCtx.WithError(err).Warnf("Unable to generate token")
 		return nil, errAuthenticationFailed
@@ -186,9 +320,45 @@ func (s *Server) Authenticate(ctx context.Context, ar *authapi.AuthRequest) (*au
 	}, nil
 }
 
+// negotiatePayloadKey derives the key the payload of events exchanged with
+// the agent is encrypted with from the public key the agent sent along with
+// its authentication, and sends the principal's public key back.
+func (s *Server) negotiatePayloadKey(ctx context.Context, agentName string) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	agentKey := md.Get(event.PayloadKeyHeader)
+	if len(agentKey) == 0 {
+		return errors.New("payload encryption is required but was not requested by the agent")
+	}
+	kp, err := event.NewPayloadKeyPair()
+	if err != nil {
+		return err
+	}
+	c, err := kp.Derive(agentKey[0], s.options.payloadPSK, false)
+	if err != nil {
+		return err
+	}
+	if err := grpc.SetHeader(ctx, metadata.Pairs(event.PayloadKeyHeader, kp.PublicKey())); err != nil {
+		return fmt.Errorf("could not send payload key: %w", err)
+	}
+	s.options.payloadKeys.Add(agentName, c)
+	return nil
+}
+
+// requestedClusterLabels returns the labels the agent requests on its cluster
+// secret in the metadata of ctx
+func requestedClusterLabels(ctx context.Context) (map[string]string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(auth.ClusterLabelsHeader)
+	if len(values) == 0 {
+		return nil, nil
+	}
+	return auth.ParseClusterLabels(strings.Join(values, ","))
+}
+
 // RefreshToken issues a new access token when the client presents a valid
-// refresh token. If the refresh token is only valid for 10 minutes or less,
-// a new refresh token will be issued as well.
+// refresh token, so that agents can renew their short-lived access tokens
+// without authenticating again. If the refresh token is close to expiry (10
+// minutes or less by default), a new refresh token will be issued as well.
 func (s *Server) RefreshToken(ctx context.Context, r *authapi.RefreshTokenRequest) (*authapi.AuthResponse, error) {
 	logCtx := log().WithField("method", "RefreshToken")
 	if r.RefreshToken == "" {
@@ -214,6 +384,29 @@ func (s *Server) RefreshToken(ctx context.Context, r *authapi.RefreshTokenReques
 		return nil, fmt.Errorf("could not unmarshal subject: %w", err)
 	}
 
+	if s.options.revocations != nil {
+		var issuedAt time.Time
+		if iat, err := c.GetIssuedAt(); err == nil && iat != nil {
+			issuedAt = iat.Time
+		}
+		if s.options.revocations.IsRevoked(issuer.TokenID(c), subject.ClientID, issuedAt) {
+			logCtx.WithField("client", subject.ClientID).Warn("Rejecting revoked refresh token")
+			return nil, errAuthenticationFailed
+		}
+	}
+
+	if s.options.approvals != nil {
+		denied, err := s.options.approvals.IsDenied(ctx, subject.ClientID)
+		if err != nil {
+			logCtx.WithError(err).WithField("client", subject.ClientID).Error("Could not check agent registration")
+			return nil, errAuthenticationFailed
+		}
+		if denied {
+			logCtx.WithField("client", subject.ClientID).Warn("Rejecting refresh token of agent with denied registration")
+			return nil, errAuthenticationFailed
+		}
+	}
+
 	// We only want to issue a new refresh token when the old one is close to
 	// expiry.
 	exp, err := c.GetExpirationTime()
@@ -223,9 +416,9 @@ func (s *Server) RefreshToken(ctx context.Context, r *authapi.RefreshTokenReques
 	}
 
 	// Only issue a new refresh token when the old one is close to expiry
-	refresh := time.Until(exp.Time) < refreshTokenAutoRefresh
+	refresh := time.Until(exp.Time) < s.refreshThreshold()
 
-	accessToken, refreshToken, err := s.issueTokens(subject, refresh)
+	accessToken, refreshToken, err := s.issueTokens(ctx, subject, refresh)
 	if err != nil {
 		logCtx.WithError(err).WithField("refresh", refresh).Warnf("Could not issue a new token")
 		return nil, errAuthenticationFailed
@@ -233,6 +426,36 @@ func (s *Server) RefreshToken(ctx context.Context, r *authapi.RefreshTokenReques
 	return &authapi.AuthResponse{AccessToken: accessToken, RefreshToken: refreshToken}, nil
 }
 
+// auditAuthentication records an authentication attempt in the audit log
+func (s *Server) auditAuthentication(ctx context.Context, ar *authapi.AuthRequest, actor string, outcome audit.Outcome, reason string) {
+	s.options.auditLogger.Log(audit.Event{
+		Type:          audit.EventAuthentication,
+		Actor:         actor,
+		Outcome:       outcome,
+		Reason:        reason,
+		SourceAddress: grpcutil.AddressFromContext(ctx),
+		Details: map[string]string{
+			"method": ar.Method,
+			"mode":   ar.Mode,
+		},
+	})
+}
+
+// authFailed records a failed authentication attempt with the rate limiter
+func (s *Server) authFailed(limitKeys []string) {
+	if s.limiter != nil {
+		s.limiter.failure(limitKeys...)
+	}
+}
+
+// refreshThreshold returns the remaining lifetime of a refresh token below
+// which a new refresh token is issued. For short refresh token lifetimes, this
+// is at most half of the lifetime, so that refresh tokens are not rotated on
+// every refresh.
+func (s *Server) refreshThreshold() time.Duration {
+	return min(refreshTokenAutoRefresh, s.options.refreshTokenValidity/2)
+}
+
 func log() *logrus.Entry {
 	return logging.GetDefaultLogger().ModuleLogger("grpc.AuthenticationServer")
 }
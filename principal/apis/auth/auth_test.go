@@ -15,14 +15,20 @@
 package auth
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
 	"fmt"
 	"testing"
 	"time"
 
+	"github.com/argoproj-labs/argocd-agent/internal/audit"
 	"github.com/argoproj-labs/argocd-agent/internal/auth"
 	authmock "github.com/argoproj-labs/argocd-agent/internal/auth/mocks"
 	"github.com/argoproj-labs/argocd-agent/internal/auth/userpass"
+	"github.com/argoproj-labs/argocd-agent/internal/issuer"
 	issuermock "github.com/argoproj-labs/argocd-agent/internal/issuer/mocks"
 	"github.com/argoproj-labs/argocd-agent/internal/queue"
 	"github.com/argoproj-labs/argocd-agent/internal/version"
@@ -33,6 +39,9 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 func Test_Authenticate(t *testing.T) {
@@ -95,8 +104,8 @@ func Test_Authenticate(t *testing.T) {
 		ams.RegisterMethod("userpass", am)
 
 		iss := issuermock.NewIssuer(t)
-		iss.On("IssueAccessToken", encodedSubject, mock.Anything).Return("access", nil)
-		iss.On("IssueRefreshToken", encodedSubject, mock.Anything).Return("refresh", nil)
+		iss.On("IssueAccessToken", encodedSubject, mock.Anything, mock.Anything, mock.Anything).Return("access", nil)
+		iss.On("IssueRefreshToken", encodedSubject, mock.Anything, mock.Anything, mock.Anything).Return("refresh", nil)
 
 		auths, err := NewServer(queues, "argocd", ams, iss)
 		require.NoError(t, err)
@@ -137,7 +146,7 @@ func Test_Authenticate(t *testing.T) {
 		am.On("Authenticate", mock.Anything, mock.Anything).Return("user1", nil)
 		ams.RegisterMethod("userpass", am)
 		iss := issuermock.NewIssuer(t)
-		iss.On("IssueAccessToken", encodedSubject, mock.Anything).Return("", fmt.Errorf("oops"))
+		iss.On("IssueAccessToken", encodedSubject, mock.Anything, mock.Anything, mock.Anything).Return("", fmt.Errorf("oops"))
 		auths, err := NewServer(queues, "argocd", ams, iss)
 		require.NoError(t, err)
 		_, err = auths.Authenticate(context.TODO(), &authapi.AuthRequest{
@@ -155,8 +164,8 @@ func Test_Authenticate(t *testing.T) {
 		am.On("Authenticate", mock.Anything, mock.Anything).Return("user1", nil)
 		ams.RegisterMethod("userpass", am)
 		iss := issuermock.NewIssuer(t)
-		iss.On("IssueAccessToken", encodedSubject, mock.Anything).Return("access", nil)
-		iss.On("IssueRefreshToken", encodedSubject, mock.Anything).Return("", fmt.Errorf("oops"))
+		iss.On("IssueAccessToken", encodedSubject, mock.Anything, mock.Anything, mock.Anything).Return("access", nil)
+		iss.On("IssueRefreshToken", encodedSubject, mock.Anything, mock.Anything, mock.Anything).Return("", fmt.Errorf("oops"))
 		auths, err := NewServer(queues, "argocd", ams, iss)
 		require.NoError(t, err)
 		_, err = auths.Authenticate(context.TODO(), &authapi.AuthRequest{
@@ -175,8 +184,8 @@ func Test_Authenticate(t *testing.T) {
 		ams.RegisterMethod("userpass", am)
 
 		iss := issuermock.NewIssuer(t)
-		iss.On("IssueAccessToken", encodedSubject, mock.Anything).Return("access", nil)
-		iss.On("IssueRefreshToken", encodedSubject, mock.Anything).Return("refresh", nil)
+		iss.On("IssueAccessToken", encodedSubject, mock.Anything, mock.Anything, mock.Anything).Return("access", nil)
+		iss.On("IssueRefreshToken", encodedSubject, mock.Anything, mock.Anything, mock.Anything).Return("refresh", nil)
 
 		// Create manager with agent registration disabled
 		kubeclient := kube.NewFakeKubeClient("argocd")
@@ -220,6 +229,28 @@ func Test_Authenticate(t *testing.T) {
 		require.ErrorContains(t, err, "authentication failed")
 	})
 
+	t.Run("Authentication fails when agent requests invalid cluster labels", func(t *testing.T) {
+		ams := auth.NewMethods()
+		am := authmock.NewMethod(t)
+		am.On("Authenticate", mock.Anything, mock.Anything).Return("user1", nil)
+		ams.RegisterMethod("userpass", am)
+
+		kubeclient := kube.NewFakeClientsetWithResources()
+		mgr := registration.NewAgentRegistrationManager(true, "argocd", "resource-proxy:8443", "", kubeclient, issuermock.NewIssuer(t))
+
+		auths, err := NewServer(queues, "argocd", ams, nil, WithAgentRegistrationManager(mgr))
+		require.NoError(t, err)
+
+		ctx := metadata.NewIncomingContext(context.TODO(), metadata.Pairs(auth.ClusterLabelsHeader, "region=eu west"))
+		_, err = auths.Authenticate(ctx, &authapi.AuthRequest{
+			Method:      "userpass",
+			Credentials: map[string]string{userpass.ClientIDField: "user1", userpass.ClientSecretField: "password"},
+			Mode:        "managed",
+			Version:     testVersion,
+		})
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
 	t.Run("Authentication successful with nil cluster registration manager", func(t *testing.T) {
 		ams := auth.NewMethods()
 		am := authmock.NewMethod(t)
@@ -227,8 +258,8 @@ func Test_Authenticate(t *testing.T) {
 		ams.RegisterMethod("userpass", am)
 
 		iss := issuermock.NewIssuer(t)
-		iss.On("IssueAccessToken", encodedSubject, mock.Anything).Return("access", nil)
-		iss.On("IssueRefreshToken", encodedSubject, mock.Anything).Return("refresh", nil)
+		iss.On("IssueAccessToken", encodedSubject, mock.Anything, mock.Anything, mock.Anything).Return("access", nil)
+		iss.On("IssueRefreshToken", encodedSubject, mock.Anything, mock.Anything, mock.Anything).Return("refresh", nil)
 
 		// No cluster registration manager provided
 		auths, err := NewServer(queues, "argocd", ams, iss)
@@ -258,7 +289,7 @@ func Test_RefreshToken(t *testing.T) {
 		claims.On("GetExpirationTime").Return(jwt.NewNumericDate(time.Now().Add(1*time.Hour)), nil)
 		issuer := issuermock.NewIssuer(t)
 		issuer.On("ValidateRefreshToken", "refresh").Return(claims, nil)
-		issuer.On("IssueAccessToken", encodedSubject, mock.Anything).Return("access", nil)
+		issuer.On("IssueAccessToken", encodedSubject, mock.Anything, mock.Anything, mock.Anything).Return("access", nil)
 		// issuer.On("IssueRefreshToken", "user1", mock.Anything).Return("refresh", nil)
 
 		auths, err := NewServer(queues, "argocd", methods, issuer)
@@ -277,8 +308,8 @@ func Test_RefreshToken(t *testing.T) {
 		claims.On("GetExpirationTime").Return(jwt.NewNumericDate(time.Now().Add(refreshTokenAutoRefresh-1*time.Minute)), nil)
 		issuer := issuermock.NewIssuer(t)
 		issuer.On("ValidateRefreshToken", "refresh").Return(claims, nil)
-		issuer.On("IssueAccessToken", encodedSubject, mock.Anything).Return("access", nil)
-		issuer.On("IssueRefreshToken", encodedSubject, mock.Anything).Return("refresh", nil)
+		issuer.On("IssueAccessToken", encodedSubject, mock.Anything, mock.Anything, mock.Anything).Return("access", nil)
+		issuer.On("IssueRefreshToken", encodedSubject, mock.Anything, mock.Anything, mock.Anything).Return("refresh", nil)
 
 		auths, err := NewServer(queues, "argocd", methods, issuer)
 		require.NoError(t, err)
@@ -355,7 +386,7 @@ func Test_RefreshToken(t *testing.T) {
 
 		issuer := issuermock.NewIssuer(t)
 		issuer.On("ValidateRefreshToken", "refresh").Return(claims, nil)
-		issuer.On("IssueAccessToken", encodedSubject, mock.Anything).Return("", fmt.Errorf("ooops"))
+		issuer.On("IssueAccessToken", encodedSubject, mock.Anything, mock.Anything, mock.Anything).Return("", fmt.Errorf("ooops"))
 
 		auths, err := NewServer(queues, "argocd", methods, issuer)
 		require.NoError(t, err)
@@ -365,3 +396,219 @@ func Test_RefreshToken(t *testing.T) {
 	})
 
 }
+
+func Test_TokenValidity(t *testing.T) {
+	encodedSubject := `{"clientID":"user1","mode":"managed"}`
+	queues := queue.NewSendRecvQueues()
+
+	t.Run("Configured validity is used for issued tokens", func(t *testing.T) {
+		ams := auth.NewMethods()
+		am := authmock.NewMethod(t)
+		am.On("Authenticate", mock.Anything, mock.Anything).Return("user1", nil)
+		ams.RegisterMethod("userpass", am)
+
+		iss := issuermock.NewIssuer(t)
+		iss.On("IssueAccessToken", encodedSubject, 2*time.Minute, mock.Anything, mock.Anything).Return("access", nil)
+		iss.On("IssueRefreshToken", encodedSubject, time.Hour, mock.Anything, mock.Anything).Return("refresh", nil)
+
+		auths, err := NewServer(queues, "argocd", ams, iss, WithAccessTokenValidity(2*time.Minute), WithRefreshTokenValidity(time.Hour))
+		require.NoError(t, err)
+		r, err := auths.Authenticate(context.TODO(), &authapi.AuthRequest{
+			Method:      "userpass",
+			Credentials: map[string]string{userpass.ClientIDField: "user1", userpass.ClientSecretField: "password"},
+			Mode:        "managed",
+			Version:     version.New("argocd-agent").Version(),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "access", r.AccessToken)
+		assert.Equal(t, "refresh", r.RefreshToken)
+	})
+
+	t.Run("Short-lived refresh tokens are rotated at half of their lifetime", func(t *testing.T) {
+		claims := issuermock.NewClaims(t)
+		claims.On("GetSubject").Return(encodedSubject, nil)
+		claims.On("GetExpirationTime").Return(jwt.NewNumericDate(time.Now().Add(4*time.Minute)), nil)
+		iss := issuermock.NewIssuer(t)
+		iss.On("ValidateRefreshToken", "refresh").Return(claims, nil)
+		iss.On("IssueAccessToken", encodedSubject, mock.Anything, mock.Anything, mock.Anything).Return("access", nil)
+
+		auths, err := NewServer(queues, "argocd", nil, iss, WithRefreshTokenValidity(6*time.Minute))
+		require.NoError(t, err)
+		nr, err := auths.RefreshToken(context.TODO(), &authapi.RefreshTokenRequest{RefreshToken: "refresh"})
+		require.NoError(t, err)
+		assert.Equal(t, "", nr.RefreshToken)
+	})
+
+	t.Run("Invalid validity", func(t *testing.T) {
+		_, err := NewServer(queues, "argocd", nil, nil, WithAccessTokenValidity(10*time.Second))
+		assert.ErrorContains(t, err, "must be at least")
+		_, err = NewServer(queues, "argocd", nil, nil, WithRefreshTokenValidity(0))
+		assert.ErrorContains(t, err, "must be positive")
+		_, err = NewServer(queues, "argocd", nil, nil, WithAccessTokenValidity(time.Hour), WithRefreshTokenValidity(time.Hour))
+		assert.ErrorContains(t, err, "must be shorter")
+	})
+}
+
+func Test_TokenScopes(t *testing.T) {
+	queues := queue.NewSendRecvQueues()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	iss, err := issuer.NewIssuer("server", issuer.WithRSAPrivateKey(key))
+	require.NoError(t, err)
+	ams := auth.NewMethods()
+	am := authmock.NewMethod(t)
+	am.On("Authenticate", mock.Anything, mock.Anything).Return("user1", nil)
+	ams.RegisterMethod("userpass", am)
+
+	t.Run("Tokens are bound to agent, mode and configured scopes", func(t *testing.T) {
+		auths, err := NewServer(queues, "argocd", ams, iss, WithTokenScopes([]string{issuer.ScopeEventStream}))
+		require.NoError(t, err)
+		r, err := auths.Authenticate(context.TODO(), &authapi.AuthRequest{
+			Method:      "userpass",
+			Credentials: map[string]string{userpass.ClientIDField: "user1", userpass.ClientSecretField: "password"},
+			Mode:        "managed",
+			Version:     version.New("argocd-agent").Version(),
+		})
+		require.NoError(t, err)
+		for _, tok := range []string{r.AccessToken, r.RefreshToken} {
+			claims, _, err := jwt.NewParser().ParseUnverified(tok, jwt.MapClaims{})
+			require.NoError(t, err)
+			scopes, ok := issuer.Scopes(claims.Claims)
+			require.True(t, ok)
+			assert.ElementsMatch(t, []string{"mode:managed", issuer.ScopeEventStream}, scopes)
+			assert.Equal(t, "user1", issuer.AgentFromAudience(claims.Claims))
+		}
+	})
+
+	t.Run("Unknown scopes", func(t *testing.T) {
+		_, err := NewServer(queues, "argocd", ams, iss, WithTokenScopes([]string{"stream:everything"}))
+		assert.ErrorContains(t, err, "unknown token scope")
+	})
+}
+
+func Test_AuditLog(t *testing.T) {
+	encodedSubject := `{"clientID":"user1","mode":"managed"}`
+	queues := queue.NewSendRecvQueues()
+
+	readEvents := func(t *testing.T, b *bytes.Buffer) []audit.Event {
+		t.Helper()
+		var events []audit.Event
+		dec := json.NewDecoder(b)
+		for dec.More() {
+			ev := audit.Event{}
+			require.NoError(t, dec.Decode(&ev))
+			events = append(events, ev)
+		}
+		return events
+	}
+
+	t.Run("Successful authentication and token issuance are recorded", func(t *testing.T) {
+		ams := auth.NewMethods()
+		am := authmock.NewMethod(t)
+		am.On("Authenticate", mock.Anything, mock.Anything).Return("user1", nil)
+		ams.RegisterMethod("userpass", am)
+
+		iss := issuermock.NewIssuer(t)
+		iss.On("IssueAccessToken", encodedSubject, mock.Anything, mock.Anything, mock.Anything).Return("access", nil)
+		iss.On("IssueRefreshToken", encodedSubject, mock.Anything, mock.Anything, mock.Anything).Return("refresh", nil)
+
+		b := &bytes.Buffer{}
+		auths, err := NewServer(queues, "argocd", ams, iss, WithAuditLogger(audit.NewLogger(audit.NewWriterSink(b))))
+		require.NoError(t, err)
+		_, err = auths.Authenticate(context.TODO(), &authapi.AuthRequest{
+			Method:      "userpass",
+			Credentials: map[string]string{userpass.ClientIDField: "user1", userpass.ClientSecretField: "password"},
+			Mode:        "managed",
+			Version:     version.New("argocd-agent").Version(),
+		})
+		require.NoError(t, err)
+
+		events := readEvents(t, b)
+		require.Len(t, events, 2)
+		assert.Equal(t, audit.EventAuthentication, events[0].Type)
+		assert.Equal(t, "user1", events[0].Actor)
+		assert.Equal(t, audit.OutcomeSuccess, events[0].Outcome)
+		assert.Equal(t, "userpass", events[0].Details["method"])
+		assert.Equal(t, audit.EventTokenIssued, events[1].Type)
+		assert.Equal(t, "user1", events[1].Actor)
+		assert.Equal(t, "true", events[1].Details["refreshToken"])
+	})
+
+	t.Run("Failed authentication is recorded with the claimed client ID", func(t *testing.T) {
+		ams := auth.NewMethods()
+		am := authmock.NewMethod(t)
+		am.On("Authenticate", mock.Anything, mock.Anything).Return("", fmt.Errorf("invalid"))
+		ams.RegisterMethod("userpass", am)
+
+		b := &bytes.Buffer{}
+		auths, err := NewServer(queues, "argocd", ams, nil, WithAuditLogger(audit.NewLogger(audit.NewWriterSink(b))))
+		require.NoError(t, err)
+		_, err = auths.Authenticate(context.TODO(), &authapi.AuthRequest{
+			Method:      "userpass",
+			Credentials: map[string]string{userpass.ClientIDField: "user1", userpass.ClientSecretField: "wrong"},
+			Mode:        "managed",
+			Version:     version.New("argocd-agent").Version(),
+		})
+		require.Error(t, err)
+
+		events := readEvents(t, b)
+		require.Len(t, events, 1)
+		assert.Equal(t, audit.EventAuthentication, events[0].Type)
+		assert.Equal(t, "user1", events[0].Actor)
+		assert.Equal(t, audit.OutcomeFailure, events[0].Outcome)
+		assert.Equal(t, "invalid credentials", events[0].Reason)
+	})
+}
+
+func Test_RegistrationApproval(t *testing.T) {
+	encodedSubject := `{"clientID":"user1","mode":"managed"}`
+	queues := queue.NewSendRecvQueues()
+	authRequest := &authapi.AuthRequest{
+		Method:      "userpass",
+		Credentials: map[string]string{userpass.ClientIDField: "user1", userpass.ClientSecretField: "password"},
+		Mode:        "managed",
+		Version:     version.New("argocd-agent").Version(),
+	}
+	newMethods := func(t *testing.T) *auth.Methods {
+		ams := auth.NewMethods()
+		am := authmock.NewMethod(t)
+		am.On("Authenticate", mock.Anything, mock.Anything).Return("user1", nil)
+		ams.RegisterMethod("userpass", am)
+		return ams
+	}
+
+	t.Run("Unknown agent is pending until approved", func(t *testing.T) {
+		store := registration.NewApprovalStore(kube.NewFakeClientsetWithResources(), "argocd", registration.DefaultApprovalConfigMapName)
+		iss := issuermock.NewIssuer(t)
+		auths, err := NewServer(queues, "argocd", newMethods(t), iss, WithApprovalStore(store))
+		require.NoError(t, err)
+
+		_, err = auths.Authenticate(context.TODO(), authRequest)
+		assert.ErrorIs(t, err, errApprovalPending)
+		assert.False(t, queues.HasQueuePair("user1"))
+
+		require.NoError(t, store.Approve(context.TODO(), "user1"))
+		iss.On("IssueAccessToken", encodedSubject, mock.Anything, mock.Anything, mock.Anything).Return("access", nil)
+		iss.On("IssueRefreshToken", encodedSubject, mock.Anything, mock.Anything, mock.Anything).Return("refresh", nil)
+		r, err := auths.Authenticate(context.TODO(), authRequest)
+		require.NoError(t, err)
+		assert.Equal(t, "access", r.AccessToken)
+	})
+
+	t.Run("Denied agent can neither authenticate nor refresh", func(t *testing.T) {
+		store := registration.NewApprovalStore(kube.NewFakeClientsetWithResources(), "argocd", registration.DefaultApprovalConfigMapName)
+		require.NoError(t, store.Deny(context.TODO(), "user1"))
+
+		claims := issuermock.NewClaims(t)
+		claims.On("GetSubject").Return(encodedSubject, nil)
+		iss := issuermock.NewIssuer(t)
+		iss.On("ValidateRefreshToken", "refresh").Return(claims, nil)
+		auths, err := NewServer(queues, "argocd", newMethods(t), iss, WithApprovalStore(store))
+		require.NoError(t, err)
+
+		_, err = auths.Authenticate(context.TODO(), authRequest)
+		assert.ErrorIs(t, err, errAuthenticationFailed)
+		_, err = auths.RefreshToken(context.TODO(), &authapi.RefreshTokenRequest{RefreshToken: "refresh"})
+		assert.ErrorIs(t, err, errAuthenticationFailed)
+	})
+}
@@ -14,7 +14,17 @@
 
 package auth
 
-import "github.com/argoproj-labs/argocd-agent/principal/registration"
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/internal/audit"
+	"github.com/argoproj-labs/argocd-agent/internal/event"
+	"github.com/argoproj-labs/argocd-agent/internal/issuer"
+	"github.com/argoproj-labs/argocd-agent/internal/metrics"
+	"github.com/argoproj-labs/argocd-agent/principal/registration"
+)
 
 func WithAgentRegistrationManager(manager *registration.AgentRegistrationManager) ServerOption {
 	return func(o *ServerOptions) error {
@@ -23,6 +33,27 @@ func WithAgentRegistrationManager(manager *registration.AgentRegistrationManager
 	}
 }
 
+// WithApprovalStore requires agents to be approved by an operator before
+// they may connect. Unknown agents are recorded as pending in store.
+func WithApprovalStore(store *registration.ApprovalStore) ServerOption {
+	return func(o *ServerOptions) error {
+		o.approvals = store
+		return nil
+	}
+}
+
+// WithPayloadEncryption requires agents to negotiate a key to encrypt the
+// payload of events with during authentication. The negotiated keys are
+// added to keys. If psk is not empty, it is mixed into the keys and must
+// match the pre-shared key of the agents.
+func WithPayloadEncryption(keys *event.PayloadKeyring, psk []byte) ServerOption {
+	return func(o *ServerOptions) error {
+		o.payloadKeys = keys
+		o.payloadPSK = psk
+		return nil
+	}
+}
+
 // WithOnAuthenticated registers a callback that is invoked after a successful
 // authentication with the agent's clientID and the namespace it reported.
 func WithOnAuthenticated(fn func(name, namespace string)) ServerOption {
@@ -31,3 +62,98 @@ func WithOnAuthenticated(fn func(name, namespace string)) ServerOption {
 		return nil
 	}
 }
+
+// WithRevocationStore configures a store that is consulted to reject refresh
+// tokens which have been revoked before their expiry.
+func WithRevocationStore(store issuer.RevocationStore) ServerOption {
+	return func(o *ServerOptions) error {
+		o.revocations = store
+		return nil
+	}
+}
+
+// WithAccessTokenValidity sets the lifetime of the access tokens issued to
+// agents. It must be at least MinAccessTokenValidity.
+func WithAccessTokenValidity(d time.Duration) ServerOption {
+	return func(o *ServerOptions) error {
+		if d < MinAccessTokenValidity {
+			return fmt.Errorf("access token validity must be at least %v", MinAccessTokenValidity)
+		}
+		o.accessTokenValidity = d
+		return nil
+	}
+}
+
+// WithRefreshTokenValidity sets the lifetime of the refresh tokens issued to
+// agents. It must be longer than the lifetime of access tokens.
+func WithRefreshTokenValidity(d time.Duration) ServerOption {
+	return func(o *ServerOptions) error {
+		if d <= 0 {
+			return fmt.Errorf("refresh token validity must be positive")
+		}
+		o.refreshTokenValidity = d
+		return nil
+	}
+}
+
+// WithRateLimit enables rate limiting and lockouts of authentication attempts
+// according to config.
+func WithRateLimit(config RateLimitConfig) ServerOption {
+	return func(o *ServerOptions) error {
+		if config.MaxAttempts < 0 || config.MaxFailures < 0 {
+			return fmt.Errorf("rate limits must not be negative")
+		}
+		if config.MaxFailures > 0 && config.Lockout <= 0 {
+			return fmt.Errorf("lockout duration must be positive")
+		}
+		o.rateLimit = &config
+		return nil
+	}
+}
+
+// WithStormProtection limits the rate of authentication attempts for a
+// period after startup according to config.
+func WithStormProtection(config StormProtectionConfig) ServerOption {
+	return func(o *ServerOptions) error {
+		if config.Window <= 0 {
+			return fmt.Errorf("storm protection window must be positive")
+		}
+		if config.Rate <= 0 {
+			return fmt.Errorf("storm protection rate must be positive")
+		}
+		o.stormProtection = &config
+		return nil
+	}
+}
+
+// WithMetrics configures the metrics to record rejected authentication
+// attempts in.
+func WithMetrics(m *metrics.PrincipalMetrics) ServerOption {
+	return func(o *ServerOptions) error {
+		o.metrics = m
+		return nil
+	}
+}
+
+// WithAuditLogger configures the audit logger to record authentication
+// attempts and token issuance in.
+func WithAuditLogger(l *audit.Logger) ServerOption {
+	return func(o *ServerOptions) error {
+		o.auditLogger = l
+		return nil
+	}
+}
+
+// WithTokenScopes sets the capability scopes granted to agents in their
+// tokens. By default, agents are granted issuer.DefaultScopes.
+func WithTokenScopes(scopes []string) ServerOption {
+	return func(o *ServerOptions) error {
+		for _, s := range scopes {
+			if !slices.Contains(issuer.DefaultScopes, s) {
+				return fmt.Errorf("unknown token scope: %s", s)
+			}
+		}
+		o.tokenScopes = scopes
+		return nil
+	}
+}
@@ -0,0 +1,214 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/internal/auth"
+	"github.com/argoproj-labs/argocd-agent/internal/auth/psk"
+	"github.com/argoproj-labs/argocd-agent/internal/auth/userpass"
+	"github.com/argoproj-labs/argocd-agent/internal/grpcutil"
+)
+
+const (
+	// RejectReasonRateLimit is the reason for attempts rejected because the
+	// maximum number of attempts per interval was exceeded
+	RejectReasonRateLimit = "rate_limit"
+	// RejectReasonLockout is the reason for attempts rejected because of too
+	// many consecutive failed attempts
+	RejectReasonLockout = "lockout"
+)
+
+// DefaultRateLimitInterval is the default interval MaxAttempts applies to
+const DefaultRateLimitInterval = time.Minute
+
+// RateLimitConfig configures rate limiting of authentication attempts. Limits
+// are applied separately to each source address and to each client ID given
+// in the credentials.
+type RateLimitConfig struct {
+	// MaxAttempts is the maximum number of attempts within Interval. Zero
+	// disables rate limiting.
+	MaxAttempts int
+	// Interval is the interval MaxAttempts applies to. Defaults to
+	// DefaultRateLimitInterval.
+	Interval time.Duration
+	// MaxFailures is the number of consecutive failed attempts after which
+	// further attempts are rejected for the lockout duration. Zero disables
+	// lockouts.
+	MaxFailures int
+	// Lockout is the duration of the first lockout. It doubles with each
+	// subsequent lockout, up to MaxLockout.
+	Lockout time.Duration
+	// MaxLockout is the maximum duration of a lockout.
+	MaxLockout time.Duration
+}
+
+type limiterEntry struct {
+	windowStart time.Time
+	attempts    int
+	failures    int
+	lockouts    int
+	lockedUntil time.Time
+	lastSeen    time.Time
+}
+
+// attemptLimiter keeps track of authentication attempts per key
+type attemptLimiter struct {
+	config    RateLimitConfig
+	mu        sync.Mutex
+	entries   map[string]*limiterEntry
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+func newAttemptLimiter(config RateLimitConfig) *attemptLimiter {
+	if config.Interval <= 0 {
+		config.Interval = DefaultRateLimitInterval
+	}
+	if config.MaxLockout < config.Lockout {
+		config.MaxLockout = config.Lockout
+	}
+	return &attemptLimiter{
+		config:  config,
+		entries: make(map[string]*limiterEntry),
+		now:     time.Now,
+	}
+}
+
+// entry returns the entry for key, creating it if necessary. Must be called
+// with the lock held.
+func (l *attemptLimiter) entry(key string, now time.Time) *limiterEntry {
+	e, ok := l.entries[key]
+	if !ok {
+		e = &limiterEntry{windowStart: now}
+		l.entries[key] = e
+	}
+	e.lastSeen = now
+	return e
+}
+
+// allow records an attempt for all keys and returns whether it may proceed.
+// If not, the reason for the rejection is returned as well.
+func (l *attemptLimiter) allow(keys ...string) (bool, string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.prune(now)
+
+	for _, k := range keys {
+		if e, ok := l.entries[k]; ok && now.Before(e.lockedUntil) {
+			return false, RejectReasonLockout
+		}
+	}
+	if l.config.MaxAttempts > 0 {
+		for _, k := range keys {
+			e := l.entry(k, now)
+			if now.Sub(e.windowStart) >= l.config.Interval {
+				e.windowStart = now
+				e.attempts = 0
+			}
+			if e.attempts >= l.config.MaxAttempts {
+				return false, RejectReasonRateLimit
+			}
+		}
+		for _, k := range keys {
+			l.entries[k].attempts++
+		}
+	}
+	return true, ""
+}
+
+// failure records a failed attempt for all keys and locks out keys that have
+// reached the maximum number of consecutive failures.
+func (l *attemptLimiter) failure(keys ...string) {
+	if l.config.MaxFailures <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	for _, k := range keys {
+		e := l.entry(k, now)
+		e.failures++
+		if e.failures < l.config.MaxFailures {
+			continue
+		}
+		lockout := l.config.Lockout << e.lockouts
+		if lockout <= 0 || lockout > l.config.MaxLockout {
+			lockout = l.config.MaxLockout
+		}
+		e.lockedUntil = now.Add(lockout)
+		e.lockouts++
+		e.failures = 0
+		log().WithField("key", k).Warnf("Too many failed authentication attempts, locking out for %v", lockout)
+	}
+}
+
+// success resets the failure and lockout counters of all keys
+func (l *attemptLimiter) success(keys ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, k := range keys {
+		if e, ok := l.entries[k]; ok {
+			e.failures = 0
+			e.lockouts = 0
+		}
+	}
+}
+
+// prune removes entries that have not been seen for a while, so that the
+// number of entries does not grow without bounds. Must be called with the
+// lock held.
+func (l *attemptLimiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < l.config.Interval {
+		return
+	}
+	l.lastPrune = now
+	idle := max(l.config.Interval, 2*l.config.MaxLockout)
+	for k, e := range l.entries {
+		if now.After(e.lockedUntil) && now.Sub(e.lastSeen) > idle {
+			delete(l.entries, k)
+		}
+	}
+}
+
+// rateLimitKeys returns the keys authentication attempts are tracked by: the
+// source address of the request, and the client ID if given in creds.
+func rateLimitKeys(ctx context.Context, creds auth.Credentials) []string {
+	addr := grpcutil.AddressFromContext(ctx)
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	keys := []string{"addr:" + addr}
+	if id := claimedClientID(creds); id != "" {
+		keys = append(keys, "client:"+id)
+	}
+	return keys
+}
+
+// claimedClientID returns the client ID given in creds, if the auth method
+// uses credentials that contain the client ID.
+func claimedClientID(creds auth.Credentials) string {
+	for _, field := range []string{userpass.ClientIDField, psk.AgentIDField} {
+		if id := creds[field]; id != "" {
+			return id
+		}
+	}
+	return ""
+}
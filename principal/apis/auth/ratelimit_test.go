@@ -0,0 +1,161 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/internal/auth"
+	authmock "github.com/argoproj-labs/argocd-agent/internal/auth/mocks"
+	"github.com/argoproj-labs/argocd-agent/internal/auth/psk"
+	"github.com/argoproj-labs/argocd-agent/internal/auth/userpass"
+	"github.com/argoproj-labs/argocd-agent/internal/queue"
+	"github.com/argoproj-labs/argocd-agent/internal/version"
+	"github.com/argoproj-labs/argocd-agent/pkg/api/grpc/authapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func newTestLimiter(config RateLimitConfig) (*attemptLimiter, *time.Time) {
+	now := time.Now()
+	l := newAttemptLimiter(config)
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func Test_attemptLimiter(t *testing.T) {
+	t.Run("Rate limit per interval", func(t *testing.T) {
+		l, now := newTestLimiter(RateLimitConfig{MaxAttempts: 2})
+		for i := 0; i < 2; i++ {
+			ok, _ := l.allow("addr:a")
+			assert.True(t, ok)
+		}
+		ok, reason := l.allow("addr:a")
+		assert.False(t, ok)
+		assert.Equal(t, RejectReasonRateLimit, reason)
+
+		// Other keys are not affected
+		ok, _ = l.allow("addr:b")
+		assert.True(t, ok)
+
+		*now = now.Add(DefaultRateLimitInterval)
+		ok, _ = l.allow("addr:a")
+		assert.True(t, ok)
+	})
+
+	t.Run("Any exceeded key rejects the attempt", func(t *testing.T) {
+		l, _ := newTestLimiter(RateLimitConfig{MaxAttempts: 1})
+		ok, _ := l.allow("addr:a", "client:agent")
+		assert.True(t, ok)
+		ok, _ = l.allow("addr:b", "client:agent")
+		assert.False(t, ok)
+	})
+
+	t.Run("Exponential lockout", func(t *testing.T) {
+		l, now := newTestLimiter(RateLimitConfig{MaxFailures: 2, Lockout: time.Minute, MaxLockout: 3 * time.Minute})
+		lockout := func() {
+			l.failure("addr:a")
+			l.failure("addr:a")
+		}
+
+		lockout()
+		ok, reason := l.allow("addr:a")
+		assert.False(t, ok)
+		assert.Equal(t, RejectReasonLockout, reason)
+		*now = now.Add(time.Minute)
+		ok, _ = l.allow("addr:a")
+		assert.True(t, ok)
+
+		// Second lockout takes twice as long
+		lockout()
+		*now = now.Add(time.Minute)
+		ok, _ = l.allow("addr:a")
+		assert.False(t, ok)
+		*now = now.Add(time.Minute)
+		ok, _ = l.allow("addr:a")
+		assert.True(t, ok)
+
+		// Third lockout is capped at the maximum
+		lockout()
+		*now = now.Add(3 * time.Minute)
+		ok, _ = l.allow("addr:a")
+		assert.True(t, ok)
+	})
+
+	t.Run("Success resets failures", func(t *testing.T) {
+		l, _ := newTestLimiter(RateLimitConfig{MaxFailures: 2, Lockout: time.Minute})
+		l.failure("client:agent")
+		l.success("client:agent")
+		l.failure("client:agent")
+		ok, _ := l.allow("client:agent")
+		assert.True(t, ok)
+	})
+
+	t.Run("Idle entries are pruned", func(t *testing.T) {
+		l, now := newTestLimiter(RateLimitConfig{MaxAttempts: 5})
+		l.allow("addr:a")
+		require.Len(t, l.entries, 1)
+		*now = now.Add(5 * DefaultRateLimitInterval)
+		l.allow("addr:b")
+		assert.Len(t, l.entries, 1)
+		assert.Contains(t, l.entries, "addr:b")
+	})
+}
+
+func Test_rateLimitKeys(t *testing.T) {
+	ctx := peer.NewContext(context.TODO(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 4711}})
+	assert.Equal(t, []string{"addr:192.0.2.1"}, rateLimitKeys(ctx, auth.Credentials{}))
+	assert.Equal(t, []string{"addr:192.0.2.1", "client:agent"}, rateLimitKeys(ctx, auth.Credentials{userpass.ClientIDField: "agent"}))
+	assert.Equal(t, []string{"addr:192.0.2.1", "client:agent"}, rateLimitKeys(ctx, auth.Credentials{psk.AgentIDField: "agent"}))
+}
+
+func Test_AuthenticateRateLimit(t *testing.T) {
+	ams := auth.NewMethods()
+	am := authmock.NewMethod(t)
+	am.On("Authenticate", mock.Anything, mock.Anything).Return("", assert.AnError)
+	ams.RegisterMethod("userpass", am)
+
+	auths, err := NewServer(queue.NewSendRecvQueues(), "argocd", ams, nil,
+		WithRateLimit(RateLimitConfig{MaxFailures: 2, Lockout: time.Minute}))
+	require.NoError(t, err)
+
+	req := &authapi.AuthRequest{
+		Method:      "userpass",
+		Credentials: map[string]string{userpass.ClientIDField: "user1", userpass.ClientSecretField: "wrong"},
+		Mode:        "managed",
+		Version:     version.New("argocd-agent").Version(),
+	}
+	for i := 0; i < 2; i++ {
+		_, err = auths.Authenticate(context.TODO(), req)
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	}
+	_, err = auths.Authenticate(context.TODO(), req)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	am.AssertNumberOfCalls(t, "Authenticate", 2)
+
+	t.Run("Invalid configuration", func(t *testing.T) {
+		_, err := NewServer(queue.NewSendRecvQueues(), "argocd", nil, nil, WithRateLimit(RateLimitConfig{MaxFailures: 2}))
+		assert.ErrorContains(t, err, "lockout duration")
+		_, err = NewServer(queue.NewSendRecvQueues(), "argocd", nil, nil, WithRateLimit(RateLimitConfig{MaxAttempts: -1}))
+		assert.ErrorContains(t, err, "must not be negative")
+	})
+}
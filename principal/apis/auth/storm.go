@@ -0,0 +1,63 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"math"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// RejectReasonStormProtection is the reason for attempts rejected because
+// too many agents tried to connect right after the principal started
+const RejectReasonStormProtection = "storm_protection"
+
+// StormProtectionConfig limits the rate of authentication attempts for a
+// period after the principal started. This spreads out the reconnects of all
+// agents after a restart of the principal. Unlike RateLimitConfig, the limit
+// applies to all attempts together.
+type StormProtectionConfig struct {
+	// Window is how long after startup the limit applies
+	Window time.Duration
+	// Rate is the maximum number of authentication attempts per second
+	// within Window
+	Rate float64
+}
+
+// stormGuard admits authentication attempts at a limited rate until its
+// window has passed
+type stormGuard struct {
+	until   time.Time
+	limiter *rate.Limiter
+	now     func() time.Time
+}
+
+func newStormGuard(config StormProtectionConfig) *stormGuard {
+	return &stormGuard{
+		until:   time.Now().Add(config.Window),
+		limiter: rate.NewLimiter(rate.Limit(config.Rate), max(1, int(math.Ceil(config.Rate)))),
+		now:     time.Now,
+	}
+}
+
+// allow returns whether an authentication attempt may proceed
+func (g *stormGuard) allow() bool {
+	now := g.now()
+	if !now.Before(g.until) {
+		return true
+	}
+	return g.limiter.AllowN(now, 1)
+}
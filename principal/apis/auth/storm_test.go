@@ -0,0 +1,85 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/internal/auth"
+	authmock "github.com/argoproj-labs/argocd-agent/internal/auth/mocks"
+	"github.com/argoproj-labs/argocd-agent/internal/auth/userpass"
+	"github.com/argoproj-labs/argocd-agent/internal/queue"
+	"github.com/argoproj-labs/argocd-agent/internal/version"
+	"github.com/argoproj-labs/argocd-agent/pkg/api/grpc/authapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func Test_stormGuard(t *testing.T) {
+	now := time.Now()
+	g := newStormGuard(StormProtectionConfig{Window: time.Minute, Rate: 2})
+	g.now = func() time.Time { return now }
+
+	// The burst equals the rate
+	assert.True(t, g.allow())
+	assert.True(t, g.allow())
+	assert.False(t, g.allow())
+
+	// Tokens are replenished at the configured rate
+	now = now.Add(500 * time.Millisecond)
+	assert.True(t, g.allow())
+	assert.False(t, g.allow())
+
+	// No limit after the window has passed
+	now = now.Add(time.Minute)
+	for i := 0; i < 10; i++ {
+		assert.True(t, g.allow())
+	}
+}
+
+func Test_AuthenticateStormProtection(t *testing.T) {
+	ams := auth.NewMethods()
+	am := authmock.NewMethod(t)
+	am.On("Authenticate", mock.Anything, mock.Anything).Return("", assert.AnError)
+	ams.RegisterMethod("userpass", am)
+
+	auths, err := NewServer(queue.NewSendRecvQueues(), "argocd", ams, nil,
+		WithStormProtection(StormProtectionConfig{Window: time.Hour, Rate: 1}))
+	require.NoError(t, err)
+
+	req := &authapi.AuthRequest{
+		Method:      "userpass",
+		Credentials: map[string]string{userpass.ClientIDField: "user1", userpass.ClientSecretField: "wrong"},
+		Mode:        "managed",
+		Version:     version.New("argocd-agent").Version(),
+	}
+	_, err = auths.Authenticate(context.TODO(), req)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = auths.Authenticate(context.TODO(), req)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	am.AssertNumberOfCalls(t, "Authenticate", 1)
+
+	t.Run("Invalid configuration", func(t *testing.T) {
+		_, err := NewServer(queue.NewSendRecvQueues(), "argocd", nil, nil, WithStormProtection(StormProtectionConfig{Rate: 1}))
+		assert.ErrorContains(t, err, "window must be positive")
+		_, err = NewServer(queue.NewSendRecvQueues(), "argocd", nil, nil, WithStormProtection(StormProtectionConfig{Window: time.Minute}))
+		assert.ErrorContains(t, err, "rate must be positive")
+	})
+}
@@ -0,0 +1,112 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package certificate
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/internal/logging"
+	"github.com/argoproj-labs/argocd-agent/internal/session"
+	"github.com/argoproj-labs/argocd-agent/pkg/api/grpc/certificateapi"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultValidity is the lifetime of client certificates issued to agents
+// unless configured otherwise
+const DefaultValidity = 24 * time.Hour
+
+// Server implements the Certificates gRPC service, which issues client
+// certificates to authenticated agents from the certificate signing requests
+// they submit.
+type Server struct {
+	certificateapi.UnimplementedCertificatesServer
+
+	signer   Signer
+	validity time.Duration
+}
+
+// NewServer returns a new Certificates server signing certificates with
+// signer, which are valid for validity. If validity is zero, DefaultValidity
+// is used.
+func NewServer(signer Signer, validity time.Duration) *Server {
+	if validity <= 0 {
+		validity = DefaultValidity
+	}
+	return &Server{
+		signer:   signer,
+		validity: validity,
+	}
+}
+
+// IssueClientCertificate signs the CSR submitted by an authenticated agent.
+// The CSR's subject must name the calling agent, so that an agent can only
+// ever obtain certificates for its own identity.
+func (s *Server) IssueClientCertificate(ctx context.Context, req *certificateapi.CertificateSigningRequest) (*certificateapi.CertificateResponse, error) {
+	agentName, err := session.ClientIDFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "no agent identity in request")
+	}
+	logCtx := log().WithField("client", agentName)
+
+	csr, err := parseCSR(req.GetCsr())
+	if err != nil {
+		logCtx.WithError(err).Warn("Rejecting invalid certificate signing request")
+		return nil, status.Errorf(codes.InvalidArgument, "invalid certificate signing request: %v", err)
+	}
+	if csr.Subject.CommonName != agentName {
+		logCtx.Warnf("Rejecting certificate signing request for foreign identity %q", csr.Subject.CommonName)
+		return nil, status.Errorf(codes.PermissionDenied, "agent %s may not request a certificate for %q", agentName, csr.Subject.CommonName)
+	}
+	if len(csr.DNSNames) > 0 || len(csr.IPAddresses) > 0 || len(csr.EmailAddresses) > 0 || len(csr.URIs) > 0 {
+		return nil, status.Error(codes.InvalidArgument, "client certificates must not have subject alternative names")
+	}
+
+	certPEM, caPEM, err := s.signer.Sign(ctx, csr, s.validity)
+	if err != nil {
+		logCtx.WithError(err).Error("Could not issue client certificate")
+		return nil, status.Error(codes.Internal, "could not issue client certificate")
+	}
+	logCtx.Infof("Issued client certificate valid for %s", s.validity)
+	return &certificateapi.CertificateResponse{
+		Certificate:   certPEM,
+		CaCertificate: caPEM,
+	}, nil
+}
+
+// parseCSR parses a PEM encoded certificate signing request and verifies it
+// has been signed by the private key it requests a certificate for.
+func parseCSR(data []byte) (*x509.CertificateRequest, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, errNoCSR
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, err
+	}
+	return csr, nil
+}
+
+func log() *logrus.Entry {
+	return logging.GetDefaultLogger().ModuleLogger("grpc.CertificatesServer")
+}
@@ -0,0 +1,139 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package certificate
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/internal/session"
+	"github.com/argoproj-labs/argocd-agent/internal/tlsutil"
+	"github.com/argoproj-labs/argocd-agent/pkg/api/grpc/certificateapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func testCA(t *testing.T) tls.Certificate {
+	t.Helper()
+	certPEM, keyPEM, err := tlsutil.GenerateCaCertificate("test-ca", 2, tlsutil.KeyGenOptions{Algorithm: "ecdsa-p256"})
+	require.NoError(t, err)
+	ca, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	require.NoError(t, err)
+	return ca
+}
+
+func testCSR(t *testing.T, templ *x509.CertificateRequest) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, templ, key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+}
+
+func Test_IssueClientCertificate(t *testing.T) {
+	ca := testCA(t)
+	signer, err := NewCASigner(ca)
+	require.NoError(t, err)
+	s := NewServer(signer, 0)
+	ctx := session.ClientInfoToContext(context.Background(), "agent-1", "managed")
+
+	t.Run("Certificate is issued", func(t *testing.T) {
+		resp, err := s.IssueClientCertificate(ctx, &certificateapi.CertificateSigningRequest{
+			Csr: testCSR(t, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "agent-1", Organization: []string{"ignored"}}}),
+		})
+		require.NoError(t, err)
+		certs := tlsutil.X509CertsFromPEM(resp.Certificate)
+		require.Len(t, certs, 1)
+		cert := certs[0]
+		assert.Equal(t, "CN=agent-1", cert.Subject.String())
+		assert.Equal(t, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, cert.ExtKeyUsage)
+		assert.WithinDuration(t, time.Now().Add(DefaultValidity), cert.NotAfter, time.Minute)
+
+		roots := x509.NewCertPool()
+		require.True(t, roots.AppendCertsFromPEM(resp.CaCertificate))
+		_, err = cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+		assert.NoError(t, err)
+	})
+	t.Run("Validity is capped at the CA's expiry", func(t *testing.T) {
+		s := NewServer(signer, 30*24*time.Hour)
+		resp, err := s.IssueClientCertificate(ctx, &certificateapi.CertificateSigningRequest{
+			Csr: testCSR(t, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "agent-1"}}),
+		})
+		require.NoError(t, err)
+		cert := tlsutil.X509CertsFromPEM(resp.Certificate)[0]
+		caCert, err := x509.ParseCertificate(ca.Certificate[0])
+		require.NoError(t, err)
+		assert.Equal(t, caCert.NotAfter, cert.NotAfter)
+	})
+	t.Run("No agent identity", func(t *testing.T) {
+		_, err := s.IssueClientCertificate(context.Background(), &certificateapi.CertificateSigningRequest{
+			Csr: testCSR(t, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "agent-1"}}),
+		})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+	t.Run("Certificate for another agent", func(t *testing.T) {
+		_, err := s.IssueClientCertificate(ctx, &certificateapi.CertificateSigningRequest{
+			Csr: testCSR(t, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "agent-2"}}),
+		})
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	})
+	t.Run("Subject alternative names", func(t *testing.T) {
+		_, err := s.IssueClientCertificate(ctx, &certificateapi.CertificateSigningRequest{
+			Csr: testCSR(t, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "agent-1"}, DNSNames: []string{"principal.example.com"}}),
+		})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+	t.Run("Invalid CSR", func(t *testing.T) {
+		_, err := s.IssueClientCertificate(ctx, &certificateapi.CertificateSigningRequest{Csr: []byte("invalid")})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+	t.Run("Tampered CSR", func(t *testing.T) {
+		csr := testCSR(t, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "agent-1"}})
+		block, _ := pem.Decode(csr)
+		block.Bytes[len(block.Bytes)-1] ^= 0xff
+		_, err := s.IssueClientCertificate(ctx, &certificateapi.CertificateSigningRequest{Csr: pem.EncodeToMemory(block)})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+}
+
+func Test_NewCASigner(t *testing.T) {
+	ca := testCA(t)
+	caCert, err := x509.ParseCertificate(ca.Certificate[0])
+	require.NoError(t, err)
+
+	t.Run("Leaf certificate is not a CA", func(t *testing.T) {
+		certPEM, keyPEM, err := tlsutil.GenerateClientCertificate("agent", caCert, ca.PrivateKey, 1, tlsutil.KeyGenOptions{Algorithm: "ecdsa-p256"})
+		require.NoError(t, err)
+		leaf, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+		require.NoError(t, err)
+		_, err = NewCASigner(leaf)
+		assert.ErrorContains(t, err, "is not a CA certificate")
+	})
+	t.Run("No certificate", func(t *testing.T) {
+		_, err := NewCASigner(tls.Certificate{})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,135 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package certificate
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/internal/certmanager"
+)
+
+var errNoCSR = errors.New("no PEM encoded certificate request found")
+
+// clockSkew is subtracted from the start of a certificate's validity, so
+// that it is accepted by peers whose clocks are slightly behind.
+const clockSkew = time.Minute
+
+// Signer issues client certificates for certificate signing requests that
+// have already been validated by the Server.
+type Signer interface {
+	// Sign returns the PEM encoded certificate issued for csr, which should
+	// be valid for validity, and the PEM encoded certificate of the issuing
+	// CA if it is known.
+	Sign(ctx context.Context, csr *x509.CertificateRequest, validity time.Duration) (certPEM []byte, caPEM []byte, err error)
+}
+
+// caSigner signs certificates with a CA held by the principal
+type caSigner struct {
+	cert  *x509.Certificate
+	key   crypto.Signer
+	caPEM []byte
+}
+
+// NewCASigner returns a Signer that issues certificates signed by the CA
+// certificate and key in ca. Certificates never outlive the CA.
+func NewCASigner(ca tls.Certificate) (Signer, error) {
+	if len(ca.Certificate) == 0 {
+		return nil, errors.New("no CA certificate given")
+	}
+	cert := ca.Leaf
+	if cert == nil {
+		var err error
+		if cert, err = x509.ParseCertificate(ca.Certificate[0]); err != nil {
+			return nil, fmt.Errorf("could not parse CA certificate: %w", err)
+		}
+	}
+	if !cert.IsCA {
+		return nil, fmt.Errorf("certificate %s is not a CA certificate", cert.Subject)
+	}
+	key, ok := ca.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("CA private key cannot be used for signing")
+	}
+	return &caSigner{
+		cert:  cert,
+		key:   key,
+		caPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}),
+	}, nil
+}
+
+// Sign implements Signer
+func (s *caSigner) Sign(_ context.Context, csr *x509.CertificateRequest, validity time.Duration) ([]byte, []byte, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not generate serial number: %w", err)
+	}
+	now := time.Now()
+	notAfter := now.Add(validity)
+	if notAfter.After(s.cert.NotAfter) {
+		notAfter = s.cert.NotAfter
+	}
+	if !notAfter.After(now) {
+		return nil, nil, fmt.Errorf("CA certificate %s has expired", s.cert.Subject)
+	}
+	templ := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: csr.Subject.CommonName},
+		NotBefore:             now.Add(-clockSkew),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, templ, s.cert, csr.PublicKey, s.key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not sign certificate: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), s.caPEM, nil
+}
+
+// certManagerSigner passes certificate signing requests on to cert-manager
+type certManagerSigner struct {
+	requester *certmanager.Requester
+}
+
+// NewCertManagerSigner returns a Signer that has certificates issued by the
+// cert-manager issuer of requester.
+func NewCertManagerSigner(requester *certmanager.Requester) Signer {
+	return &certManagerSigner{requester: requester}
+}
+
+// Sign implements Signer
+func (s *certManagerSigner) Sign(ctx context.Context, csr *x509.CertificateRequest, validity time.Duration) ([]byte, []byte, error) {
+	spec := certmanager.CertificateSpec{
+		Usages:   []string{certmanager.UsageClientAuth},
+		Duration: validity,
+	}
+	csrPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr.Raw})
+	cert, err := s.requester.RequestForCSR(ctx, "agent-"+csr.Subject.CommonName, spec, csrPEM)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert.CertPEM, cert.CAPEM, nil
+}
@@ -0,0 +1,138 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventstream
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/pkg/api/grpc/eventstreamapi"
+	"golang.org/x/time/rate"
+	"google.golang.org/protobuf/proto"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// DefaultBandwidthLimitKey is the key used in ParseBandwidthLimits to set the
+// limit for all agents without a limit of their own.
+const DefaultBandwidthLimitKey = "default"
+
+// BandwidthLimits holds the maximum number of bytes per second sent to each
+// agent on its event stream. A limit of 0 means no limit.
+type BandwidthLimits struct {
+	// Default applies to all agents not in ByAgent
+	Default int
+	// ByAgent holds limits for specific agents
+	ByAgent map[string]int
+}
+
+// ParseBandwidthLimits parses limits of the form <agent>=<rate>, where agent
+// is the name of an agent or "default", and rate is a quantity of bytes per
+// second such as 512Ki or 4Mi.
+func ParseBandwidthLimits(specs []string) (*BandwidthLimits, error) {
+	l := &BandwidthLimits{ByAgent: make(map[string]int)}
+	for _, spec := range specs {
+		name, size, ok := strings.Cut(spec, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid bandwidth limit %q: must be of the form <agent>=<rate>", spec)
+		}
+		q, err := resource.ParseQuantity(size)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bandwidth limit %q: %w", spec, err)
+		}
+		bytes, ok := q.AsInt64()
+		if !ok || bytes < 0 || int64(int(bytes)) != bytes {
+			return nil, fmt.Errorf("invalid bandwidth limit %q: rate out of range", spec)
+		}
+		if name == DefaultBandwidthLimitKey {
+			l.Default = int(bytes)
+			continue
+		}
+		l.ByAgent[name] = int(bytes)
+	}
+	return l, nil
+}
+
+// Limit returns the bandwidth limit for the agent, or 0 if there is none.
+func (l *BandwidthLimits) Limit(agentName string) int {
+	if l == nil {
+		return 0
+	}
+	if limit, ok := l.ByAgent[agentName]; ok {
+		return limit
+	}
+	return l.Default
+}
+
+// throttledSubscribeServer delays sending events until the agent's limiter
+// admits their size in bytes
+type throttledSubscribeServer struct {
+	eventstreamapi.EventStream_SubscribeServer
+	limiter *rate.Limiter
+	// onThrottle is called with the time a send had to wait, if any
+	onThrottle func(time.Duration)
+}
+
+func (s *throttledSubscribeServer) Send(ev *eventstreamapi.Event) error {
+	start := time.Now()
+	// The limiter cannot admit more than its burst at once, so larger
+	// events are admitted in several steps.
+	for n := proto.Size(ev); n > 0; n -= s.limiter.Burst() {
+		if err := s.limiter.WaitN(s.Context(), min(n, s.limiter.Burst())); err != nil {
+			return fmt.Errorf("bandwidth limit: %w", err)
+		}
+	}
+	if waited := time.Since(start); waited > time.Millisecond && s.onThrottle != nil {
+		s.onThrottle(waited)
+	}
+	return s.EventStream_SubscribeServer.Send(ev)
+}
+
+// limiter returns the bandwidth limiter for the agent, or nil if the agent's
+// bandwidth is not limited. The limiter is kept across reconnects, so that
+// reconnecting does not refill the agent's bucket.
+func (s *Server) limiter(agentName string) *rate.Limiter {
+	limit := s.options.bandwidthLimits.Limit(agentName)
+	if limit <= 0 {
+		return nil
+	}
+	s.limitersMu.Lock()
+	defer s.limitersMu.Unlock()
+	l, ok := s.limiters[agentName]
+	if !ok {
+		// Allow up to one second worth of bytes to be sent at once
+		l = rate.NewLimiter(rate.Limit(limit), limit)
+		s.limiters[agentName] = l
+	}
+	return l
+}
+
+// throttle returns target limited to the bandwidth configured for client c,
+// or target itself if the bandwidth is not limited.
+func (s *Server) throttle(c *client, target eventstreamapi.EventStream_SubscribeServer) eventstreamapi.EventStream_SubscribeServer {
+	l := s.limiter(c.agentName)
+	if l == nil {
+		return target
+	}
+	return &throttledSubscribeServer{
+		EventStream_SubscribeServer: target,
+		limiter:                     l,
+		onThrottle: func(waited time.Duration) {
+			if s.metrics != nil {
+				s.metrics.AgentBandwidthThrottled.WithLabelValues(c.agentName).Add(waited.Seconds())
+			}
+		},
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventstream
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/pkg/api/grpc/eventstreamapi"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+
+	format "github.com/cloudevents/sdk-go/binding/format/protobuf/v2"
+)
+
+type countingSubscribeServer struct {
+	grpc.ServerStream
+	ctx  context.Context
+	sent int
+}
+
+func (s *countingSubscribeServer) Context() context.Context {
+	return s.ctx
+}
+
+func (s *countingSubscribeServer) Send(ev *eventstreamapi.Event) error {
+	s.sent += proto.Size(ev)
+	return nil
+}
+
+func (s *countingSubscribeServer) Recv() (*eventstreamapi.Event, error) {
+	return nil, nil
+}
+
+func Test_ParseBandwidthLimits(t *testing.T) {
+	t.Run("Default and per agent limits", func(t *testing.T) {
+		l, err := ParseBandwidthLimits([]string{"default=1Mi", "agent-a=512Ki", "agent-b=0"})
+		require.NoError(t, err)
+		assert.Equal(t, 1024*1024, l.Limit("agent-c"))
+		assert.Equal(t, 512*1024, l.Limit("agent-a"))
+		assert.Equal(t, 0, l.Limit("agent-b"))
+	})
+	t.Run("No default", func(t *testing.T) {
+		l, err := ParseBandwidthLimits([]string{"agent-a=100k"})
+		require.NoError(t, err)
+		assert.Equal(t, 100000, l.Limit("agent-a"))
+		assert.Equal(t, 0, l.Limit("agent-b"))
+	})
+	t.Run("Nil limits", func(t *testing.T) {
+		var l *BandwidthLimits
+		assert.Equal(t, 0, l.Limit("agent-a"))
+	})
+	t.Run("Invalid specs", func(t *testing.T) {
+		for _, spec := range []string{"agent-a", "=1Mi", "agent-a=lots", "agent-a=-1"} {
+			_, err := ParseBandwidthLimits([]string{spec})
+			assert.Error(t, err, spec)
+		}
+	})
+}
+
+func Test_Throttle(t *testing.T) {
+	newEvent := func(t *testing.T, size int) *eventstreamapi.Event {
+		t.Helper()
+		ev := cloudevents.NewEvent()
+		ev.SetID("1")
+		ev.SetSource("test")
+		ev.SetType("test")
+		require.NoError(t, ev.SetData(cloudevents.TextPlain, strings.Repeat("x", size)))
+		pev, err := format.ToProto(&ev)
+		require.NoError(t, err)
+		return &eventstreamapi.Event{Event: pev}
+	}
+
+	s := &Server{
+		options:  &ServerOptions{bandwidthLimits: &BandwidthLimits{ByAgent: map[string]int{"limited": 1000}}},
+		limiters: make(map[string]*rate.Limiter),
+	}
+
+	t.Run("Unlimited agent is not throttled", func(t *testing.T) {
+		target := &countingSubscribeServer{ctx: context.Background()}
+		assert.Same(t, target, s.throttle(&client{agentName: "unlimited"}, target))
+	})
+
+	t.Run("Limiter is kept across reconnects", func(t *testing.T) {
+		assert.Nil(t, s.limiter("unlimited"))
+		assert.Same(t, s.limiter("limited"), s.limiter("limited"))
+	})
+
+	t.Run("Events larger than the burst are delayed", func(t *testing.T) {
+		target := &countingSubscribeServer{ctx: context.Background()}
+		throttled := s.throttle(&client{agentName: "limited"}, target)
+		ev := newEvent(t, 1400)
+		start := time.Now()
+		require.NoError(t, throttled.Send(ev))
+		assert.GreaterOrEqual(t, time.Since(start), 300*time.Millisecond)
+		assert.Equal(t, proto.Size(ev), target.sent)
+	})
+
+	t.Run("Send is aborted when the stream is closed", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		target := &countingSubscribeServer{ctx: ctx}
+		throttled := s.throttle(&client{agentName: "limited"}, target)
+		assert.Error(t, throttled.Send(newEvent(t, 100)))
+		assert.Zero(t, target.sent)
+	})
+}
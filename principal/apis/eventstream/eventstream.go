@@ -20,8 +20,10 @@ import (
 	"fmt"
 	"io"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/argoproj-labs/argocd-agent/internal/audit"
 	"github.com/argoproj-labs/argocd-agent/internal/event"
 	"github.com/argoproj-labs/argocd-agent/internal/event/targets"
 	"github.com/argoproj-labs/argocd-agent/internal/grpcutil"
@@ -32,9 +34,13 @@ import (
 	"github.com/argoproj-labs/argocd-agent/internal/session"
 	"github.com/argoproj-labs/argocd-agent/pkg/api/grpc/eventstreamapi"
 	"github.com/argoproj-labs/argocd-agent/pkg/types"
+	"github.com/argoproj-labs/argocd-agent/principal/journal"
 	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 
 	format "github.com/cloudevents/sdk-go/binding/format/protobuf/v2"
@@ -69,18 +75,50 @@ type Server struct {
 	// Used by DisconnectAll and to guard against stale cleanup races.
 	activeClients   map[string]*client
 	activeClientsMu sync.Mutex
+
+	// lastSeen records when an event was last received from each agent
+	lastSeen   map[string]time.Time
+	lastSeenMu sync.RWMutex
+
+	// limiters holds the bandwidth limiter of each agent
+	limiters   map[string]*rate.Limiter
+	limitersMu sync.Mutex
+
+	// deltas holds the receiver of the deltas of each agent
+	deltas   map[string]*event.DeltaReceiver
+	deltasMu sync.Mutex
+
+	// uploads holds the payloads agents transferred out of band, downloads
+	// those transferred to agents
+	uploads   *event.PayloadStore
+	downloads *event.PayloadStore
 }
 
 // AcceptCheck is called at the start of Subscribe to decide whether to accept
 // the agent connection. Return a non-nil error to reject with that status.
 type AcceptCheck func(agentName string) error
 
+// SendCheck is called for each event before it is sent to an agent. Return a
+// non-nil error to discard the event instead of sending it.
+type SendCheck func(agentName string, ev *cloudevents.Event) error
+
+// drainPollInterval is how often Drain checks for undelivered events
+const drainPollInterval = 100 * time.Millisecond
+
+// streamCloseGracePeriod is how long a closing stream waits for its sender
+// and receiver routines before it is closed with them still running
+const streamCloseGracePeriod = 2 * time.Second
+
 const (
 	eventWriterSendErrorReasonContextCanceled  = "context-canceled"
 	eventWriterSendErrorReasonTransportClosing = "transport-closing"
+	eventWriterSendErrorReasonTimeout          = "timeout"
 	eventWriterSendErrorReasonOther            = "other"
 )
 
+// errSendTimeout is returned for sends that did not complete in time
+var errSendTimeout = status.Error(codes.DeadlineExceeded, "timed out sending event to agent")
+
 type sendErrorObservingSubscribeServer struct {
 	eventstreamapi.EventStream_SubscribeServer
 	onSendError func(error)
@@ -94,10 +132,96 @@ func (s *sendErrorObservingSubscribeServer) Send(ev *eventstreamapi.Event) error
 	return err
 }
 
+// timeoutSubscribeServer fails sends that do not complete within timeout.
+// Once a send has timed out, all further sends fail as well, because the
+// stream must not be written to while the timed out send is still blocked.
+type timeoutSubscribeServer struct {
+	eventstreamapi.EventStream_SubscribeServer
+	timeout   time.Duration
+	onTimeout func()
+	expired   atomic.Bool
+}
+
+func (s *timeoutSubscribeServer) Send(ev *eventstreamapi.Event) error {
+	if s.expired.Load() {
+		return errSendTimeout
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- s.EventStream_SubscribeServer.Send(ev)
+	}()
+	timer := time.NewTimer(s.timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		s.expired.Store(true)
+		s.onTimeout()
+		return errSendTimeout
+	}
+}
+
+// chunkedSubscribeServer sends and receives events in chunks
+type chunkedSubscribeServer struct {
+	eventstreamapi.EventStream_SubscribeServer
+	chunked *event.ChunkedStream
+}
+
+func (s *chunkedSubscribeServer) Send(ev *eventstreamapi.Event) error {
+	return s.chunked.Send(ev)
+}
+
+func (s *chunkedSubscribeServer) Recv() (*eventstreamapi.Event, error) {
+	return s.chunked.Recv()
+}
+
 type ServerOptions struct {
 	MaxStreamDuration time.Duration
 	notifyOnConnect   chan types.Agent
 	acceptCheck       AcceptCheck
+	sendCheck         SendCheck
+	auditLogger       *audit.Logger
+
+	heartbeatInterval time.Duration
+	newHeartbeat      func() *cloudevents.Event
+
+	bandwidthLimits *BandwidthLimits
+
+	// sendTimeout is how long sending a single event may take
+	sendTimeout time.Duration
+
+	// chunkSize is the size of the chunks events are sent in
+	chunkSize int
+
+	// batchSize is the maximum number of events sent in a single message
+	batchSize int
+
+	// batchWindow is how long updates are held back to coalesce them
+	batchWindow time.Duration
+
+	// deltaEvents is whether Application events are sent as deltas to agents
+	// that can resolve them
+	deltaEvents bool
+	// newDeltaRejection returns the ACK for a delta that could not be
+	// resolved. If nil, deltas are not resolved.
+	newDeltaRejection func(ev *cloudevents.Event) *cloudevents.Event
+	// onAck is called with every ACK received from an agent, which reports
+	// the outcome of an event sent to the agent. If nil, outcomes are only
+	// recorded in the journal.
+	onAck func(agentName string, ack *cloudevents.Event)
+
+	// payloadKeys holds the keys the payload of events is encrypted with. If
+	// nil, payloads are not encrypted.
+	payloadKeys *event.PayloadKeyring
+
+	// transferThreshold is the size in bytes above which the payload of
+	// events is transferred out of band to agents that can resolve it. A
+	// threshold of 0 sends all payloads inline.
+	transferThreshold int
+
+	// journal records the events exchanged with agents. It may be nil.
+	journal *journal.Journal
 
 	logger *logging.CentralizedLogger
 }
@@ -115,6 +239,11 @@ type client struct {
 	end            time.Time
 	lock           sync.RWMutex
 	disconnectOnce sync.Once
+	// payload encrypts the data of the events exchanged with the agent, if
+	// not nil
+	payload *event.PayloadCipher
+	// transfer resolves the payloads the agent transferred out of band
+	transfer *event.PayloadTransfer
 }
 
 func WithMaxStreamDuration(d time.Duration) ServerOption {
@@ -135,6 +264,133 @@ func WithAcceptCheck(fn AcceptCheck) ServerOption {
 	}
 }
 
+// deadLetterQueue is implemented by queues that keep the events which could
+// not be sent to an agent.
+type deadLetterQueue interface {
+	DeadLetter(name string, ev *cloudevents.Event, reason string)
+}
+
+// deliveryJournal is implemented by queues that track which events an agent
+// has acknowledged, so that unacknowledged events can be replayed.
+type deliveryJournal interface {
+	Delivered(name string, ev *cloudevents.Event)
+	Acknowledged(name string, ack *cloudevents.Event)
+}
+
+// WithSendCheck configures a check that decides whether an event may be sent
+// to an agent
+func WithSendCheck(fn SendCheck) ServerOption {
+	return func(o *ServerOptions) {
+		o.sendCheck = fn
+	}
+}
+
+// WithAuditLogger configures the audit logger to record agent connections in
+func WithAuditLogger(l *audit.Logger) ServerOption {
+	return func(o *ServerOptions) {
+		o.auditLogger = l
+	}
+}
+
+// WithHeartbeat configures the server to send the event returned by
+// newHeartbeat to every connected agent at the given interval.
+func WithHeartbeat(interval time.Duration, newHeartbeat func() *cloudevents.Event) ServerOption {
+	return func(o *ServerOptions) {
+		o.heartbeatInterval = interval
+		o.newHeartbeat = newHeartbeat
+	}
+}
+
+// WithBandwidthLimits configures the maximum number of bytes per second sent
+// to each agent
+func WithBandwidthLimits(limits *BandwidthLimits) ServerOption {
+	return func(o *ServerOptions) {
+		o.bandwidthLimits = limits
+	}
+}
+
+// WithSendTimeout configures how long sending a single event to an agent may
+// take before the agent is disconnected. A timeout of 0 disables the timeout.
+func WithSendTimeout(timeout time.Duration) ServerOption {
+	return func(o *ServerOptions) {
+		o.sendTimeout = timeout
+	}
+}
+
+// WithChunkSize configures events larger than size bytes to be sent to
+// agents in chunks. A size of 0 disables chunking.
+func WithChunkSize(size int) ServerOption {
+	return func(o *ServerOptions) {
+		o.chunkSize = size
+	}
+}
+
+// WithBatchSize configures up to size events waiting to be sent to an agent
+// to be sent in a single message. A size of 1 or less disables batching.
+func WithBatchSize(size int) ServerOption {
+	return func(o *ServerOptions) {
+		o.batchSize = size
+	}
+}
+
+// WithBatchWindow configures updates to a resource to be held back for window
+// after the first one, so that successive updates are sent as one event.
+func WithBatchWindow(window time.Duration) ServerOption {
+	return func(o *ServerOptions) {
+		o.batchWindow = window
+	}
+}
+
+// WithDeltaEvents configures Application events to be sent as deltas to
+// agents that announce they can resolve them
+func WithDeltaEvents(enabled bool) ServerOption {
+	return func(o *ServerOptions) {
+		o.deltaEvents = enabled
+	}
+}
+
+// WithPayloadEncryption requires the payload of the events exchanged with
+// agents to be encrypted with the key the agent negotiated during
+// authentication, which is looked up in keys.
+func WithPayloadEncryption(keys *event.PayloadKeyring) ServerOption {
+	return func(o *ServerOptions) {
+		o.payloadKeys = keys
+	}
+}
+
+// WithPayloadTransfer configures the payload of events larger than threshold
+// bytes to be transferred out of band to agents that announce they can
+// resolve it. A threshold of 0 sends all payloads inline.
+func WithPayloadTransfer(threshold int) ServerOption {
+	return func(o *ServerOptions) {
+		o.transferThreshold = threshold
+	}
+}
+
+// WithEventJournal records the events sent to and acknowledged by agents in j
+func WithEventJournal(j *journal.Journal) ServerOption {
+	return func(o *ServerOptions) {
+		o.journal = j
+	}
+}
+
+// WithDeltaResolution configures the server to resolve the deltas received
+// from agents. Deltas that cannot be resolved are answered with the event
+// returned by newRejection, so that the agent resends the full object.
+func WithDeltaResolution(newRejection func(ev *cloudevents.Event) *cloudevents.Event) ServerOption {
+	return func(o *ServerOptions) {
+		o.newDeltaRejection = newRejection
+	}
+}
+
+// WithAckHandler configures the server to call onAck with every ACK received
+// from an agent, except for those of deltas that are resent in full.
+func WithAckHandler(onAck func(agentName string, ack *cloudevents.Event)) ServerOption {
+	return func(o *ServerOptions) {
+		o.onAck = onAck
+	}
+}
+
 func WithLogger(logger *logging.CentralizedLogger) ServerOption {
 	return func(o *ServerOptions) {
 		o.logger = logger
@@ -159,6 +415,11 @@ func NewServer(queues queue.QueuePair, eventWriters *event.EventWritersMap, metr
 		metrics:       metrics,
 		clusterMgr:    clusterMgr,
 		activeClients: make(map[string]*client),
+		lastSeen:      make(map[string]time.Time),
+		limiters:      make(map[string]*rate.Limiter),
+		deltas:        make(map[string]*event.DeltaReceiver),
+		uploads:       event.NewPayloadStore(payloadTransferTTL),
+		downloads:     event.NewPayloadStore(payloadTransferTTL),
 	}
 }
 
@@ -173,6 +434,7 @@ func (s *Server) newClientConnection(ctx context.Context, timeout time.Duration)
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 	c.agentName = agentName
+	c.transfer = s.recvTransfer(agentName)
 
 	c.logCtx = logrus.WithFields(logrus.Fields{
 		logfields.Method: "Subscribe",
@@ -200,9 +462,29 @@ func classifyEventWriterSendError(err error) string {
 	if grpcutil.NeedReconnectOnError(err) {
 		return eventWriterSendErrorReasonTransportClosing
 	}
+	if errors.Is(err, errSendTimeout) {
+		return eventWriterSendErrorReasonTimeout
+	}
 	return eventWriterSendErrorReasonOther
 }
 
+// withSendTimeout returns target with sends limited to the configured send
+// timeout, or target itself if sends may take forever. Client c is
+// disconnected when a send times out.
+func (s *Server) withSendTimeout(c *client, target eventstreamapi.EventStream_SubscribeServer) eventstreamapi.EventStream_SubscribeServer {
+	if s.options.sendTimeout <= 0 {
+		return target
+	}
+	return &timeoutSubscribeServer{
+		EventStream_SubscribeServer: target,
+		timeout:                     s.options.sendTimeout,
+		onTimeout: func() {
+			c.logCtx.Warnf("Agent did not accept an event within %v, disconnecting", s.options.sendTimeout)
+			c.cancelFn()
+		},
+	}
+}
+
 func (s *Server) observeSubscribeSendErrors(c *client, subs eventstreamapi.EventStream_SubscribeServer) eventstreamapi.EventStream_SubscribeServer {
 	return &sendErrorObservingSubscribeServer{
 		EventStream_SubscribeServer: subs,
@@ -219,8 +501,16 @@ func (s *Server) observeSubscribeSendErrors(c *client, subs eventstreamapi.Event
 	}
 }
 
-// onDisconnect must be called whenever client c disconnects from the stream
+// onDisconnect must be called by each of the sender and receiver routines of
+// client c when it finishes
 func (s *Server) onDisconnect(c *client) {
+	s.markDisconnected(c)
+	c.wg.Done()
+}
+
+// markDisconnected records that client c disconnected from the stream. Only
+// the first call for a client has an effect.
+func (s *Server) markDisconnected(c *client) {
 	c.disconnectOnce.Do(func() {
 		c.lock.Lock()
 		c.end = time.Now()
@@ -236,8 +526,6 @@ func (s *Server) onDisconnect(c *client) {
 		}
 		s.activeClientsMu.Unlock()
 	})
-
-	c.wg.Done()
 }
 
 // recvFunc retrieves exactly one message from the client c on the event stream
@@ -274,6 +562,7 @@ func (s *Server) recvFunc(c *client, subs eventstreamapi.EventStream_SubscribeSe
 	if streamEvent == nil || streamEvent.Event == nil {
 		return fmt.Errorf("invalid wire transmission")
 	}
+	s.markSeen(c.agentName)
 
 	app := &v1alpha1.Application{}
 	proj := &v1alpha1.AppProject{}
@@ -285,13 +574,36 @@ func (s *Server) recvFunc(c *client, subs eventstreamapi.EventStream_SubscribeSe
 	}
 
 	logCtx = logCtx.WithFields(logrus.Fields{
-		"resource_id":  event.ResourceID(incomingEvent),
-		"event_id":     event.EventID(incomingEvent),
-		"event_target": incomingEvent.DataSchema(),
-		"event_type":   incomingEvent.Type(),
-		"agent_name":   c.agentName,
+		"resource_id":    event.ResourceID(incomingEvent),
+		"event_id":       event.EventID(incomingEvent),
+		"correlation_id": event.CorrelationID(incomingEvent),
+		"event_target":   incomingEvent.DataSchema(),
+		"event_type":     incomingEvent.Type(),
+		"agent_name":     c.agentName,
 	})
 
+	if err := c.transfer.Resolve(incomingEvent); err != nil {
+		logCtx.WithError(err).Error("Dropping event")
+		return nil
+	}
+
+	if c.payload != nil {
+		if err := c.payload.Decrypt(incomingEvent); err != nil {
+			logCtx.WithError(err).Error("Dropping event")
+			return nil
+		}
+	}
+
+	if s.options.newDeltaRejection != nil {
+		if err := s.deltaReceiver(c.agentName).Resolve(incomingEvent); err != nil {
+			logCtx.WithError(err).Debug("Requesting full object from agent")
+			if sendQ := s.queues.SendQ(c.agentName); sendQ != nil {
+				sendQ.Add(s.options.newDeltaRejection(incomingEvent))
+			}
+			return nil
+		}
+	}
+
 	switch event.Target(incomingEvent) {
 	case targets.Application:
 		err = incomingEvent.DataAs(app)
@@ -326,6 +638,17 @@ func (s *Server) recvFunc(c *client, subs eventstreamapi.EventStream_SubscribeSe
 		}
 		eventWriter.Remove(incomingEvent)
 		logCtx.Trace("Removed the ACK from the event writer")
+		s.options.journal.Acknowledge(c.agentName, incomingEvent)
+		// The event will be resent in full
+		if event.IsDeltaRejection(incomingEvent) {
+			return nil
+		}
+		if s.options.onAck != nil {
+			s.options.onAck(c.agentName, incomingEvent)
+		}
+		if journal, ok := s.queues.(deliveryJournal); ok {
+			journal.Acknowledged(c.agentName, incomingEvent)
+		}
 		return nil
 	}
 
@@ -374,6 +697,19 @@ func (s *Server) sendFunc(c *client, subs eventstreamapi.EventStream_SubscribeSe
 		// Only Update events are valid for unmanaged agents
 		if ev.Type() == event.Create.String() || ev.Type() == event.Delete.String() {
 			logCtx.WithField("type", ev.Type()).Debug("Discarding event for unmanaged agent")
+			q.Done(ev)
+			return nil
+		}
+	}
+
+	if s.options.sendCheck != nil {
+		if err := s.options.sendCheck(c.agentName, ev); err != nil {
+			logCtx.WithError(err).WithField("type", ev.Type()).Warn("Discarding event for agent")
+			if dlq, ok := s.queues.(deadLetterQueue); ok {
+				dlq.DeadLetter(c.agentName, ev, err.Error())
+			}
+			s.options.journal.Record(c.agentName, journal.DirectionSend, ev, journal.OutcomeDropped, err.Error())
+			q.Done(ev)
 			return nil
 		}
 	}
@@ -384,11 +720,17 @@ func (s *Server) sendFunc(c *client, subs eventstreamapi.EventStream_SubscribeSe
 	}
 
 	logCtx = logCtx.WithFields(logrus.Fields{
-		"resource_id": event.ResourceID(ev),
-		"event_id":    event.EventID(ev),
+		"resource_id":    event.ResourceID(ev),
+		"event_id":       event.EventID(ev),
+		"correlation_id": event.CorrelationID(ev),
 	})
+	// The event must be journaled before the agent can possibly acknowledge it
+	if journal, ok := s.queues.(deliveryJournal); ok {
+		journal.Delivered(c.agentName, ev)
+	}
 	logCtx.Trace("Adding an event to the event writer")
 	eventWriter.Add(ev)
+	s.options.journal.Record(c.agentName, journal.DirectionSend, ev, journal.OutcomePending, "")
 	logging.LogEventSent(logCtx, ev)
 
 	q.Done(ev)
@@ -408,10 +750,36 @@ func (s *Server) Subscribe(subs eventstreamapi.EventStream_SubscribeServer) erro
 	if err != nil {
 		return err
 	}
+	// Agents may send events in chunks, even if we do not
+	subs = &chunkedSubscribeServer{
+		EventStream_SubscribeServer: subs,
+		chunked:                     event.NewChunkedStream(subs, s.options.chunkSize, c.logCtx),
+	}
+
+	lane, err := laneFromContext(subs.Context())
+	if err != nil {
+		c.cancelFn()
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if lane != "" {
+		return s.subscribeLane(c, lane, subs)
+	}
+
+	if s.options.payloadKeys != nil {
+		id, _ := payloadKeyIDFromContext(subs.Context())
+		if c.payload = s.options.payloadKeys.Get(c.agentName, id); c.payload == nil {
+			// The key may have been lost when the principal restarted, so
+			// make the agent authenticate again
+			c.logCtx.Info("Rejecting agent connection with unknown payload key")
+			c.cancelFn()
+			return status.Error(codes.Unauthenticated, "unknown payload key, authenticate again")
+		}
+	}
 
 	if s.options.acceptCheck != nil {
 		if err := s.options.acceptCheck(c.agentName); err != nil {
 			c.logCtx.WithError(err).Warn("Rejecting agent connection")
+			s.auditConnection(c, audit.EventAgentConnected, audit.OutcomeDenied, err.Error())
 			return status.Errorf(codes.Unavailable, "%s", err)
 		}
 	}
@@ -421,6 +789,7 @@ func (s *Server) Subscribe(subs eventstreamapi.EventStream_SubscribeServer) erro
 	s.activeClientsMu.Unlock()
 
 	s.clusterMgr.SetAgentConnectionStatus(c.agentName, v1alpha1.ConnectionStatusSuccessful, c.start)
+	s.auditConnection(c, audit.EventAgentConnected, audit.OutcomeSuccess, "")
 
 	if s.metrics != nil {
 		// increase counter to track how many agents are currently connected with principal
@@ -433,7 +802,24 @@ func (s *Server) Subscribe(subs eventstreamapi.EventStream_SubscribeServer) erro
 		metrics.SetAgentConnectionTime(c.agentName, c.start)
 	}
 
-	target := s.observeSubscribeSendErrors(c, subs)
+	// Tell the agent which lanes it may open streams of their own for
+	md := metadata.MD{event.LanesHeader: make([]string, 0, len(event.SecondaryLanes))}
+	for _, l := range event.SecondaryLanes {
+		md[event.LanesHeader] = append(md[event.LanesHeader], string(l))
+	}
+	// and that it understands events in the CloudEvents wire format
+	md[event.WireFormatHeader] = []string{string(event.WireFormatCloudEvents)}
+	// and deltas
+	if s.options.newDeltaRejection != nil {
+		md[event.DeltaEncodingHeader] = []string{event.ContentTypeMergePatch, event.ContentTypeJSONPatch}
+	}
+	// and payloads transferred out of band
+	md[event.PayloadTransferHeader] = []string{event.PayloadTransferVersion}
+	if err := subs.SendHeader(md); err != nil {
+		c.logCtx.WithError(err).Debug("Could not send stream header")
+	}
+
+	target := s.throttle(c, s.observeSubscribeSendErrors(c, s.withSendTimeout(c, subs)))
 	eventWriter := s.eventWriters.Get(c.agentName)
 	if eventWriter != nil {
 		eventWriter.UpdateTarget(target)
@@ -447,9 +833,19 @@ func (s *Server) Subscribe(subs eventstreamapi.EventStream_SubscribeServer) erro
 		}
 		s.eventWriters.Add(c.agentName, eventWriter)
 	}
+	eventWriter.SetBatchSize(s.options.batchSize)
+	eventWriter.SetBatchWindow(s.options.batchWindow)
+	eventWriter.SetWireFormat(wireFormatFromContext(subs.Context()))
+	eventWriter.SetDeltaEncoding(s.options.deltaEvents && deltaEncodingFromContext(subs.Context()))
+	eventWriter.SetPayloadCipher(c.payload)
+	eventWriter.SetPayloadTransfer(s.sendTransfer(subs.Context(), c.agentName))
 
 	go eventWriter.SendWaitingEvents(c.ctx)
 
+	if s.options.heartbeatInterval > 0 && s.options.newHeartbeat != nil {
+		go s.sendHeartbeats(c, eventWriter)
+	}
+
 	// Notify to run handlers for the newly connected agent
 	if s.options.notifyOnConnect != nil {
 		mode, err := session.ClientModeFromContext(c.ctx)
@@ -509,8 +905,9 @@ func (s *Server) Subscribe(subs eventstreamapi.EventStream_SubscribeServer) erro
 		}
 	}()
 
-	c.wg.Wait()
+	s.waitForRoutines(c)
 	c.logCtx.Info("Closing EventStream")
+	s.auditConnection(c, audit.EventAgentDisconnected, audit.OutcomeSuccess, "")
 
 	s.activeClientsMu.Lock()
 	if s.activeClients[c.agentName] == c {
@@ -529,6 +926,196 @@ func (s *Server) Subscribe(subs eventstreamapi.EventStream_SubscribeServer) erro
 	return nil
 }
 
+// laneFromContext returns the lane requested in the metadata of a stream, or
+// the empty string for the primary stream
+func laneFromContext(ctx context.Context) (event.Lane, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", nil
+	}
+	names := md.Get(event.LaneHeader)
+	if len(names) == 0 {
+		return "", nil
+	}
+	return event.ParseLane(names[0])
+}
+
+// wireFormatFromContext returns the wire format the agent announced in the
+// metadata of a stream that it understands
+func wireFormatFromContext(ctx context.Context) event.WireFormat {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return event.WireFormatLegacy
+	}
+	return event.ParseWireFormat(md.Get(event.WireFormatHeader))
+}
+
+// deltaEncodingFromContext returns whether the agent announced in the
+// metadata of a stream that it can resolve deltas
+func deltaEncodingFromContext(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return false
+	}
+	return event.ParseDeltaEncoding(md.Get(event.DeltaEncodingHeader))
+}
+
+// payloadKeyIDFromContext returns the ID of the payload key the agent
+// announced in the metadata of its stream.
+func payloadKeyIDFromContext(ctx context.Context) (string, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", false
+	}
+	ids := md.Get(event.PayloadKeyIDHeader)
+	if len(ids) == 0 {
+		return "", false
+	}
+	return ids[0], true
+}
+
+// deltaReceiver returns the receiver of the deltas of agentName
+func (s *Server) deltaReceiver(agentName string) *event.DeltaReceiver {
+	s.deltasMu.Lock()
+	defer s.deltasMu.Unlock()
+	d, ok := s.deltas[agentName]
+	if !ok {
+		d = event.NewDeltaReceiver()
+		s.deltas[agentName] = d
+	}
+	return d
+}
+
+// subscribeLane serves a stream that client c opened in addition to its
+// primary stream, to exchange the events of a single lane. The stream is
+// closed together with the primary stream. Until then, the lane's events
+// are sent on this stream instead of the primary one.
+func (s *Server) subscribeLane(c *client, lane event.Lane, subs eventstreamapi.EventStream_SubscribeServer) error {
+	defer c.cancelFn()
+	c.logCtx = c.logCtx.WithField("lane", lane)
+
+	s.activeClientsMu.Lock()
+	primary := s.activeClients[c.agentName]
+	s.activeClientsMu.Unlock()
+	eventWriter := s.eventWriters.Get(c.agentName)
+	if primary == nil || eventWriter == nil {
+		return status.Errorf(codes.FailedPrecondition, "agent %s has no primary event stream", c.agentName)
+	}
+	c.payload = primary.payload
+	go func() {
+		select {
+		case <-primary.ctx.Done():
+			c.cancelFn()
+		case <-c.ctx.Done():
+		}
+	}()
+
+	target := s.throttle(c, s.observeSubscribeSendErrors(c, s.withSendTimeout(c, subs)))
+	eventWriter.SetLaneTarget(lane, target)
+	defer eventWriter.RemoveLaneTarget(lane, target)
+	go eventWriter.SendWaitingLaneEvents(c.ctx, lane)
+
+	// The receiver runs in a routine of its own, so that a receiver blocked
+	// in Recv does not keep the stream open after the client is done.
+	go func() {
+		defer c.cancelFn()
+		c.logCtx.Info("Starting event receiver routine")
+		for c.ctx.Err() == nil {
+			if err := s.recvFunc(c, subs); err != nil {
+				c.logCtx.Infof("Receiver disconnected: %v", err)
+				return
+			}
+			if s.metrics != nil {
+				s.metrics.EventReceived.Inc()
+			}
+		}
+	}()
+	<-c.ctx.Done()
+	c.logCtx.Info("Closing lane stream")
+	return nil
+}
+
+// waitForRoutines waits for the sender and receiver routines of client c to
+// finish. A receiver blocked in Recv only returns once the stream has been
+// closed, which happens after Subscribe returns. Hence, once the client is
+// done, the routines get a grace period to finish before the stream is closed
+// regardless.
+func (s *Server) waitForRoutines(c *client) {
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return
+	case <-c.ctx.Done():
+	}
+	select {
+	case <-done:
+	case <-time.After(streamCloseGracePeriod):
+		c.logCtx.Debug("Closing stream with routines still running")
+		s.markDisconnected(c)
+	}
+}
+
+// sendHeartbeats sends a heartbeat to client c at the configured interval
+// until the client's stream is closed.
+func (s *Server) sendHeartbeats(c *client, eventWriter *event.EventWriter) {
+	ticker := time.NewTicker(s.options.heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			eventWriter.Add(s.options.newHeartbeat())
+			c.logCtx.Trace("Queued heartbeat ping")
+		}
+	}
+}
+
+// markSeen records that an event has just been received from agentName
+func (s *Server) markSeen(agentName string) {
+	now := time.Now()
+	s.lastSeenMu.Lock()
+	s.lastSeen[agentName] = now
+	s.lastSeenMu.Unlock()
+	if s.metrics != nil {
+		s.metrics.AgentLastSeen.WithLabelValues(agentName).Set(float64(now.Unix()))
+	}
+}
+
+// LastSeen returns the time an event was last received from each agent that
+// has been connected since the server started.
+func (s *Server) LastSeen() map[string]time.Time {
+	s.lastSeenMu.RLock()
+	defer s.lastSeenMu.RUnlock()
+	seen := make(map[string]time.Time, len(s.lastSeen))
+	for name, t := range s.lastSeen {
+		seen[name] = t
+	}
+	return seen
+}
+
+// auditConnection records a change of the agent's connection in the audit log
+func (s *Server) auditConnection(c *client, typ audit.EventType, outcome audit.Outcome, reason string) {
+	if s.options.auditLogger == nil {
+		return
+	}
+	ev := audit.Event{
+		Type:          typ,
+		Actor:         c.agentName,
+		Outcome:       outcome,
+		Reason:        reason,
+		SourceAddress: grpcutil.AddressFromContext(c.ctx),
+	}
+	if typ == audit.EventAgentDisconnected {
+		ev.Details = map[string]string{"duration": time.Since(c.start).Round(time.Second).String()}
+	}
+	s.options.auditLogger.Log(ev)
+}
+
 // ConnectedAgentCount returns the number of currently connected agents.
 func (s *Server) ConnectedAgentCount() int {
 	s.activeClientsMu.Lock()
@@ -536,6 +1123,18 @@ func (s *Server) ConnectedAgentCount() int {
 	return len(s.activeClients)
 }
 
+// Disconnect cancels the active stream of the agent agentName, and returns
+// whether the agent was connected.
+func (s *Server) Disconnect(agentName string) bool {
+	s.activeClientsMu.Lock()
+	c, ok := s.activeClients[agentName]
+	s.activeClientsMu.Unlock()
+	if ok {
+		c.cancelFn()
+	}
+	return ok
+}
+
 // DisconnectAll cancels every active agent stream, forcing all agents to disconnect.
 func (s *Server) DisconnectAll() {
 	s.activeClientsMu.Lock()
@@ -550,6 +1149,80 @@ func (s *Server) DisconnectAll() {
 	}
 }
 
+// Drain tells every connected agent that the principal is going away by
+// sending it the event returned by goAway, and then waits until the events
+// queued for the connected agents have been sent and acknowledged. Agents
+// that disconnect in the meantime are no longer waited for. If ctx is done
+// before all events have been delivered, Drain returns an error.
+func (s *Server) Drain(ctx context.Context, goAway func() *cloudevents.Event) error {
+	s.activeClientsMu.Lock()
+	agents := make([]string, 0, len(s.activeClients))
+	for name := range s.activeClients {
+		agents = append(agents, name)
+	}
+	s.activeClientsMu.Unlock()
+
+	for _, name := range agents {
+		if eventWriter := s.eventWriters.Get(name); eventWriter != nil {
+			s.log().WithField(logfields.Client, name).Debug("Notifying agent about shutdown")
+			eventWriter.Add(goAway())
+		}
+	}
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		pending := 0
+		for _, name := range agents {
+			if s.IsAgentConnected(name) {
+				pending += s.pendingEvents(name)
+			}
+		}
+		if pending == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d events were not delivered to agents: %w", pending, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// Checkpoint adds the events that were handed to the event writer of each
+// agent, but have not been acknowledged by the agent, back to the agent's send
+// queue. It is meant to be called during shutdown after the send queues have
+// been closed, which makes them persist the events instead of sending them.
+// Returns the number of events added back to the send queues.
+func (s *Server) Checkpoint() int {
+	n := 0
+	for _, name := range s.queues.Names() {
+		q := s.queues.SendQ(name)
+		eventWriter := s.eventWriters.Get(name)
+		if q == nil || eventWriter == nil {
+			continue
+		}
+		for _, ev := range eventWriter.Undelivered() {
+			q.Add(ev)
+			n++
+		}
+	}
+	return n
+}
+
+// pendingEvents returns the number of events for agentName that are either
+// queued or waiting to be acknowledged.
+func (s *Server) pendingEvents(agentName string) int {
+	n := 0
+	if q := s.queues.SendQ(agentName); q != nil {
+		n += q.Len()
+	}
+	if eventWriter := s.eventWriters.Get(agentName); eventWriter != nil {
+		n += eventWriter.Pending()
+	}
+	return n
+}
+
 // Push implements a client-side stream to receive updates for the client's
 // Application resources.
 // Push is called by GRPC machinery.
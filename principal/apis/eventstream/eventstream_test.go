@@ -15,9 +15,11 @@
 package eventstream
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -29,6 +31,7 @@ import (
 	"github.com/argoproj-labs/argocd-agent/pkg/types"
 	"github.com/argoproj-labs/argocd-agent/principal/apis/eventstream/mock"
 	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
 	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -246,6 +249,77 @@ func TestSubscribe_SendErrorCancelsSubscribeCtx(t *testing.T) {
 	<-subscribeReturned
 }
 
+func TestSubscribe_SendTimeout(t *testing.T) {
+	clusterMgr := &cluster.Manager{}
+	qs := queue.NewSendRecvQueues()
+	qs.Create("agent-y")
+	s := NewServer(qs, event.NewEventWritersMap(), nil, clusterMgr, WithSendTimeout(50*time.Millisecond))
+
+	st := &mock.MockEventServer{
+		AgentName: "agent-y",
+		AgentMode: string(types.AgentModeManaged),
+	}
+
+	// Simulate an agent that neither reads nor writes its stream
+	gate := make(chan struct{})
+	defer close(gate)
+	st.AddRecvHook(func(_ *mock.MockEventServer) error {
+		<-gate
+		return io.EOF
+	})
+	st.AddSendHook(func(_ *mock.MockEventServer, _ *eventstreamapi.Event) error {
+		<-gate
+		return nil
+	})
+
+	subscribeReturned := make(chan struct{})
+	go func() {
+		_ = s.Subscribe(st)
+		close(subscribeReturned)
+	}()
+
+	require.Eventually(t, func() bool {
+		return s.ConnectedAgentCount() == 1
+	}, time.Second, 10*time.Millisecond)
+
+	emitter := event.NewEventSource("test")
+	qs.SendQ("agent-y").Add(emitter.ApplicationEvent(
+		event.Create,
+		&v1alpha1.Application{ObjectMeta: v1.ObjectMeta{Name: "app", Namespace: "ns"}},
+	))
+
+	select {
+	case <-subscribeReturned:
+	case <-time.After(streamCloseGracePeriod + 3*time.Second):
+		t.Fatal("Subscribe did not return after a send timed out")
+	}
+	assert.False(t, s.IsAgentConnected("agent-y"))
+}
+
+func Test_timeoutSubscribeServer(t *testing.T) {
+	gate := make(chan struct{})
+	defer close(gate)
+	st := &mock.MockEventServer{}
+	st.AddSendHook(func(_ *mock.MockEventServer, _ *eventstreamapi.Event) error {
+		<-gate
+		return nil
+	})
+	timeouts := 0
+	ts := &timeoutSubscribeServer{
+		EventStream_SubscribeServer: st,
+		timeout:                     10 * time.Millisecond,
+		onTimeout:                   func() { timeouts++ },
+	}
+
+	err := ts.Send(&eventstreamapi.Event{})
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	assert.Equal(t, eventWriterSendErrorReasonTimeout, classifyEventWriterSendError(err))
+	// Further sends fail right away
+	err = ts.Send(&eventstreamapi.Event{})
+	assert.ErrorIs(t, err, errSendTimeout)
+	assert.Equal(t, 1, timeouts)
+}
+
 func TestDisconnectAll(t *testing.T) {
 	clusterMgr := &cluster.Manager{}
 
@@ -289,6 +363,122 @@ func TestDisconnectAll(t *testing.T) {
 	})
 }
 
+func TestDisconnect(t *testing.T) {
+	qs := queue.NewSendRecvQueues()
+	qs.Create("agent-a")
+	s := NewServer(qs, event.NewEventWritersMap(), nil, &cluster.Manager{})
+
+	done := make(chan struct{})
+	gate := make(chan struct{})
+	st := &mock.MockEventServer{AgentName: "agent-a"}
+	st.AddRecvHook(func(_ *mock.MockEventServer) error {
+		<-gate
+		return io.EOF
+	})
+	go func() {
+		_ = s.Subscribe(st)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool {
+		return s.ConnectedAgentCount() == 1
+	}, time.Second, 10*time.Millisecond)
+
+	assert.False(t, s.Disconnect("agent-b"))
+	assert.True(t, s.Disconnect("agent-a"))
+	close(gate)
+
+	require.Eventually(t, func() bool {
+		return s.ConnectedAgentCount() == 0
+	}, time.Second, 10*time.Millisecond)
+	<-done
+}
+
+func TestDrain(t *testing.T) {
+	clusterMgr := &cluster.Manager{}
+	es := event.NewEventSource("principal")
+
+	newServer := func() (*Server, *event.EventWriter, *mock.MockEventServer) {
+		qs := queue.NewSendRecvQueues()
+		_ = qs.Create("agent-a")
+		ews := event.NewEventWritersMap()
+		st := &mock.MockEventServer{AgentName: "agent-a"}
+		ew := event.NewEventWriter("agent-a", st, logrus.NewEntry(logrus.New()))
+		ews.Add("agent-a", ew)
+		s := NewServer(qs, ews, nil, clusterMgr)
+		s.MarkConnected("agent-a")
+		return s, ew, st
+	}
+
+	t.Run("sends go away and waits for delivery", func(t *testing.T) {
+		s, ew, st := newServer()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		go ew.SendWaitingEvents(ctx)
+
+		require.NoError(t, s.Drain(ctx, es.GoAwayEvent))
+		assert.Equal(t, uint32(1), st.NumSent.Load())
+		assert.Equal(t, 0, ew.Pending())
+	})
+
+	t.Run("times out when events are not delivered", func(t *testing.T) {
+		s, ew, _ := newServer()
+		ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+		defer cancel()
+
+		err := s.Drain(ctx, es.GoAwayEvent)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Equal(t, 1, ew.Pending())
+	})
+
+	t.Run("does not wait for disconnected agents", func(t *testing.T) {
+		s, _, _ := newServer()
+		s.MarkDisconnected("agent-a")
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		require.NoError(t, s.Drain(ctx, es.GoAwayEvent))
+	})
+}
+
+func TestCheckpoint(t *testing.T) {
+	clusterMgr := &cluster.Manager{}
+	es := event.NewEventSource("principal")
+	app := &v1alpha1.Application{ObjectMeta: v1.ObjectMeta{Name: "app1", Namespace: "argocd", UID: "1234"}}
+
+	newServer := func(dir string) (*Server, *queue.SendRecvQueues, *event.EventWriter) {
+		qs := queue.NewSendRecvQueues(queue.WithStorageDir(dir))
+		require.NoError(t, qs.Create("agent-a"))
+		ews := event.NewEventWritersMap()
+		st := &mock.MockEventServer{AgentName: "agent-a"}
+		ew := event.NewEventWriter("agent-a", st, logrus.NewEntry(logrus.New()))
+		ews.Add("agent-a", ew)
+		return NewServer(qs, ews, nil, clusterMgr), qs, ew
+	}
+
+	t.Run("persists undelivered events", func(t *testing.T) {
+		dir := t.TempDir()
+		s, qs, ew := newServer(dir)
+		ew.Add(es.ApplicationEvent(event.Create, app))
+		ew.Add(es.GoAwayEvent())
+		qs.Close()
+
+		assert.Equal(t, 1, s.Checkpoint())
+		assert.Equal(t, 0, qs.SendQ("agent-a").Len())
+
+		restarted := queue.NewSendRecvQueues(queue.WithStorageDir(dir))
+		require.NoError(t, restarted.Create("agent-a"))
+		require.Equal(t, 1, restarted.SendQ("agent-a").Len())
+		ev, _ := restarted.SendQ("agent-a").Get()
+		assert.Equal(t, event.Create.String(), ev.Type())
+	})
+
+	t.Run("does nothing without undelivered events", func(t *testing.T) {
+		s, qs, _ := newServer(t.TempDir())
+		qs.Close()
+		assert.Equal(t, 0, s.Checkpoint())
+	})
+}
+
 func TestAcceptCheck(t *testing.T) {
 	clusterMgr := &cluster.Manager{}
 
@@ -490,3 +680,108 @@ func TestOnDisconnectConnectionStatus(t *testing.T) {
 func init() {
 	logrus.SetLevel(logrus.TraceLevel)
 }
+
+func TestHeartbeat(t *testing.T) {
+	clusterMgr := &cluster.Manager{}
+	es := event.NewEventSource("principal")
+
+	qs := queue.NewSendRecvQueues()
+	require.NoError(t, qs.Create("agent-a"))
+	s := NewServer(qs, event.NewEventWritersMap(), nil, clusterMgr,
+		WithHeartbeat(50*time.Millisecond, func() *cloudevents.Event {
+			return es.HeartbeatEvent(event.Ping)
+		}))
+	st := &mock.MockEventServer{AgentName: "agent-a"}
+	var pings atomic.Uint32
+	st.AddSendHook(func(_ *mock.MockEventServer, sub *eventstreamapi.Event) error {
+		if sub.Event.Type == event.Ping.String() {
+			pings.Add(1)
+		}
+		return nil
+	})
+	numReceived := 0
+	st.AddRecvHook(func(_ *mock.MockEventServer) error {
+		if numReceived >= 1 {
+			time.Sleep(500 * time.Millisecond)
+			return io.EOF
+		}
+		numReceived++
+		return nil
+	})
+
+	_, ok := s.LastSeen()["agent-a"]
+	assert.False(t, ok)
+
+	start := time.Now()
+	require.NoError(t, s.Subscribe(st))
+	assert.GreaterOrEqual(t, pings.Load(), uint32(2))
+
+	seen, ok := s.LastSeen()["agent-a"]
+	require.True(t, ok)
+	assert.False(t, seen.Before(start))
+}
+
+func TestSubscribeLane(t *testing.T) {
+	clusterMgr := &cluster.Manager{}
+	es := event.NewEventSource("principal")
+
+	t.Run("rejects lane without primary stream", func(t *testing.T) {
+		qs := queue.NewSendRecvQueues()
+		qs.Create("agent-a")
+		s := NewServer(qs, event.NewEventWritersMap(), nil, clusterMgr)
+		err := s.Subscribe(&mock.MockEventServer{AgentName: "agent-a", Lane: string(event.LaneStatus)})
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	})
+
+	t.Run("rejects unknown lane", func(t *testing.T) {
+		qs := queue.NewSendRecvQueues()
+		qs.Create("agent-a")
+		s := NewServer(qs, event.NewEventWritersMap(), nil, clusterMgr)
+		err := s.Subscribe(&mock.MockEventServer{AgentName: "agent-a", Lane: "urgent"})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("sends lane events on the lane stream", func(t *testing.T) {
+		qs := queue.NewSendRecvQueues()
+		qs.Create("agent-a")
+		s := NewServer(qs, event.NewEventWritersMap(), nil, clusterMgr)
+
+		gate := make(chan struct{})
+		primary := &mock.MockEventServer{AgentName: "agent-a", AgentMode: string(types.AgentModeManaged)}
+		primary.AddRecvHook(func(_ *mock.MockEventServer) error {
+			<-gate
+			return io.EOF
+		})
+		primaryDone := make(chan error)
+		go func() {
+			primaryDone <- s.Subscribe(primary)
+		}()
+		// The agent is counted as connected before the header is sent
+		require.Eventually(t, func() bool {
+			return s.ConnectedAgentCount() == 1 && primary.Header() != nil
+		}, 5*time.Second, 10*time.Millisecond)
+		assert.Equal(t, []string{"spec", "status"}, primary.Header().Get(event.LanesHeader))
+
+		lane := &mock.MockEventServer{AgentName: "agent-a", Lane: string(event.LaneStatus)}
+		lane.AddRecvHook(func(_ *mock.MockEventServer) error {
+			<-gate
+			return io.EOF
+		})
+		laneDone := make(chan error)
+		go func() {
+			laneDone <- s.Subscribe(lane)
+		}()
+
+		app := &v1alpha1.Application{ObjectMeta: v1.ObjectMeta{Name: "foo", Namespace: "test", UID: "1"}}
+		require.Eventually(t, func() bool {
+			// The lane stream may not have been registered yet, in which
+			// case the event is sent on the primary stream.
+			qs.SendQ("agent-a").Add(es.ApplicationEvent(event.StatusUpdate, app))
+			return lane.NumSent.Load() > 0
+		}, 5*time.Second, 200*time.Millisecond)
+
+		close(gate)
+		require.NoError(t, <-primaryDone)
+		require.NoError(t, <-laneDone)
+	})
+}
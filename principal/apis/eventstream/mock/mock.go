@@ -16,6 +16,7 @@ package mock
 
 import (
 	"context"
+	"sync"
 	"sync/atomic"
 
 	"github.com/argoproj-labs/argocd-agent/internal/event"
@@ -24,6 +25,7 @@ import (
 	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
 	format "github.com/cloudevents/sdk-go/binding/format/protobuf/v2"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 )
 
 // SendHook is a function that will be executed for the Send call in the mock
@@ -39,11 +41,15 @@ type MockEventServer struct {
 
 	AgentName   string
 	AgentMode   string
+	Lane        string
 	NumSent     atomic.Uint32
 	NumRecv     atomic.Uint32
 	Application v1alpha1.Application
 	RecvHooks   []RecvHook
 	SendHooks   []SendHook
+
+	headerLock sync.Mutex
+	header     metadata.MD
 }
 
 func NewMockEventServer() *MockEventServer {
@@ -69,9 +75,27 @@ func (s *MockEventServer) Context() context.Context {
 		ctx = context.WithValue(ctx, types.ContextAgentMode, s.AgentMode)
 	}
 
+	if s.Lane != "" {
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(event.LaneHeader, s.Lane))
+	}
+
 	return ctx
 }
 
+func (s *MockEventServer) SendHeader(md metadata.MD) error {
+	s.headerLock.Lock()
+	defer s.headerLock.Unlock()
+	s.header = md
+	return nil
+}
+
+// Header returns the header sent by the server, or nil if none was sent yet
+func (s *MockEventServer) Header() metadata.MD {
+	s.headerLock.Lock()
+	defer s.headerLock.Unlock()
+	return s.header
+}
+
 func (s *MockEventServer) Send(sub *eventstreamapi.Event) error {
 	var err error
 	for _, h := range s.SendHooks {
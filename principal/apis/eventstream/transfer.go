@@ -0,0 +1,119 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventstream
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/internal/event"
+	"github.com/argoproj-labs/argocd-agent/internal/session"
+	"github.com/argoproj-labs/argocd-agent/pkg/api/grpc/eventstreamapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// payloadTransferTTL is how long payloads transferred out of band are kept
+// for the event that references them
+const payloadTransferTTL = 5 * time.Minute
+
+// maxPayloadTransferSize is the maximum size in bytes of a single payload an
+// agent may upload
+const maxPayloadTransferSize = 256 * 1024 * 1024
+
+// UploadPayload receives a payload the agent transfers out of band, and keeps
+// it until the event that references it is received.
+//
+// UploadPayload is called by GRPC machinery.
+func (s *Server) UploadPayload(stream eventstreamapi.EventStream_UploadPayloadServer) error {
+	agentName, err := session.ClientIDFromContext(stream.Context())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	var data []byte
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if len(data)+len(chunk.Data) > maxPayloadTransferSize {
+			return status.Errorf(codes.ResourceExhausted, "payload exceeds %d bytes", maxPayloadTransferSize)
+		}
+		data = append(data, chunk.Data...)
+	}
+	handle, err := s.uploads.Put(agentName, data)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	return stream.SendAndClose(&eventstreamapi.PayloadRef{Handle: handle, Size: int64(len(data))})
+}
+
+// DownloadPayload sends a payload that was transferred out of band to the
+// agent. Each payload can be downloaded once only.
+//
+// DownloadPayload is called by GRPC machinery.
+func (s *Server) DownloadPayload(ref *eventstreamapi.PayloadRef, stream eventstreamapi.EventStream_DownloadPayloadServer) error {
+	agentName, err := session.ClientIDFromContext(stream.Context())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	data, err := s.downloads.Take(agentName, ref.Handle)
+	if err != nil {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	for off := 0; off == 0 || off < len(data); off += event.PayloadTransferChunkSize {
+		end := min(off+event.PayloadTransferChunkSize, len(data))
+		if err := stream.Send(&eventstreamapi.PayloadChunk{Handle: ref.Handle, Data: data[off:end]}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendTransfer returns the transfer that offloads the payloads sent to
+// agentName, or nil if they are sent inline. Payloads are only offloaded if
+// the agent announced in the metadata of its stream that it can resolve them.
+func (s *Server) sendTransfer(ctx context.Context, agentName string) *event.PayloadTransfer {
+	if s.options.transferThreshold <= 0 || !payloadTransferFromContext(ctx) {
+		return nil
+	}
+	return event.NewPayloadTransfer(s.options.transferThreshold, func(data []byte) (string, error) {
+		return s.downloads.Put(agentName, data)
+	}, nil)
+}
+
+// recvTransfer returns the transfer that resolves the payloads agentName
+// uploaded
+func (s *Server) recvTransfer(agentName string) *event.PayloadTransfer {
+	return event.NewPayloadTransfer(0, nil, func(handle string) ([]byte, error) {
+		return s.uploads.Take(agentName, handle)
+	})
+}
+
+// payloadTransferFromContext returns whether the agent announced in the
+// metadata of a stream that it can resolve payloads transferred out of band
+func payloadTransferFromContext(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return false
+	}
+	return event.ParsePayloadTransfer(md.Get(event.PayloadTransferHeader))
+}
@@ -0,0 +1,154 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventstream
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/argoproj-labs/argocd-agent/internal/argocd/cluster"
+	"github.com/argoproj-labs/argocd-agent/internal/event"
+	"github.com/argoproj-labs/argocd-agent/internal/queue"
+	"github.com/argoproj-labs/argocd-agent/pkg/api/grpc/eventstreamapi"
+	"github.com/argoproj-labs/argocd-agent/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// fakeUploadStream receives the chunks of a payload uploaded by an agent
+type fakeUploadStream struct {
+	grpc.ServerStream
+	agentName string
+	chunks    []*eventstreamapi.PayloadChunk
+	ref       *eventstreamapi.PayloadRef
+}
+
+func (s *fakeUploadStream) Context() context.Context {
+	return context.WithValue(context.TODO(), types.ContextAgentIdentifier, s.agentName)
+}
+
+func (s *fakeUploadStream) Recv() (*eventstreamapi.PayloadChunk, error) {
+	if len(s.chunks) == 0 {
+		return nil, io.EOF
+	}
+	chunk := s.chunks[0]
+	s.chunks = s.chunks[1:]
+	return chunk, nil
+}
+
+func (s *fakeUploadStream) SendAndClose(ref *eventstreamapi.PayloadRef) error {
+	s.ref = ref
+	return nil
+}
+
+// fakeDownloadStream collects the chunks of a payload downloaded by an agent
+type fakeDownloadStream struct {
+	grpc.ServerStream
+	agentName string
+	data      []byte
+	chunks    int
+}
+
+func (s *fakeDownloadStream) Context() context.Context {
+	return context.WithValue(context.TODO(), types.ContextAgentIdentifier, s.agentName)
+}
+
+func (s *fakeDownloadStream) Send(chunk *eventstreamapi.PayloadChunk) error {
+	s.data = append(s.data, chunk.Data...)
+	s.chunks++
+	return nil
+}
+
+func Test_PayloadTransfer(t *testing.T) {
+	newServer := func(opts ...ServerOption) *Server {
+		qs := queue.NewSendRecvQueues()
+		qs.Create("agent-a")
+		return NewServer(qs, event.NewEventWritersMap(), nil, &cluster.Manager{}, opts...)
+	}
+	payload := bytes.Repeat([]byte("x"), event.PayloadTransferChunkSize+10)
+
+	t.Run("Uploaded payloads resolve events of the agent", func(t *testing.T) {
+		s := newServer()
+		up := &fakeUploadStream{agentName: "agent-a", chunks: []*eventstreamapi.PayloadChunk{
+			{Data: payload[:event.PayloadTransferChunkSize]},
+			{Data: payload[event.PayloadTransferChunkSize:]},
+		}}
+		require.NoError(t, s.UploadPayload(up))
+		require.NotNil(t, up.ref)
+		assert.Equal(t, int64(len(payload)), up.ref.Size)
+
+		// The agent references the payload by its handle
+		ev := event.NewEventSource("test").HeartbeatEvent(event.Ping)
+		require.NoError(t, ev.SetData("application/octet-stream", payload))
+		offloaded, err := event.NewPayloadTransfer(1, func([]byte) (string, error) {
+			return up.ref.Handle, nil
+		}, nil).Offload(ev)
+		require.NoError(t, err)
+
+		// Other agents cannot use the payload
+		other := offloaded.Clone()
+		assert.ErrorIs(t, s.recvTransfer("agent-b").Resolve(&other), event.ErrPayloadUnresolvable)
+		require.NoError(t, s.recvTransfer("agent-a").Resolve(offloaded))
+		assert.Equal(t, payload, offloaded.Data())
+	})
+
+	t.Run("Payloads for the agent are downloaded in chunks", func(t *testing.T) {
+		s := newServer()
+		handle, err := s.downloads.Put("agent-a", payload)
+		require.NoError(t, err)
+
+		err = s.DownloadPayload(&eventstreamapi.PayloadRef{Handle: handle}, &fakeDownloadStream{agentName: "agent-b"})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+
+		down := &fakeDownloadStream{agentName: "agent-a"}
+		require.NoError(t, s.DownloadPayload(&eventstreamapi.PayloadRef{Handle: handle}, down))
+		assert.Equal(t, payload, down.data)
+		assert.Equal(t, 2, down.chunks)
+
+		// Payloads can be downloaded once only
+		err = s.DownloadPayload(&eventstreamapi.PayloadRef{Handle: handle}, &fakeDownloadStream{agentName: "agent-a"})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("Payloads are only offloaded to agents that can resolve them", func(t *testing.T) {
+		announced := metadata.NewIncomingContext(context.TODO(), metadata.Pairs(event.PayloadTransferHeader, event.PayloadTransferVersion))
+		assert.Nil(t, newServer().sendTransfer(announced, "agent-a"))
+		s := newServer(WithPayloadTransfer(1024))
+		assert.Nil(t, s.sendTransfer(context.TODO(), "agent-a"))
+		transfer := s.sendTransfer(announced, "agent-a")
+		require.NotNil(t, transfer)
+
+		ev := event.NewEventSource("test").HeartbeatEvent(event.Ping)
+		require.NoError(t, ev.SetData("application/octet-stream", payload))
+		offloaded, err := transfer.Offload(ev)
+		require.NoError(t, err)
+		assert.Empty(t, offloaded.Data())
+		assert.Equal(t, 1, s.downloads.Len())
+	})
+
+	t.Run("Unauthenticated streams are rejected", func(t *testing.T) {
+		s := newServer()
+		err := s.UploadPayload(&fakeUploadStream{})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		err = s.DownloadPayload(&eventstreamapi.PayloadRef{}, &fakeDownloadStream{})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+}
@@ -0,0 +1,227 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queueadmin
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/internal/event"
+	"github.com/argoproj-labs/argocd-agent/internal/logging"
+	"github.com/argoproj-labs/argocd-agent/internal/queue"
+	"github.com/argoproj-labs/argocd-agent/pkg/api/grpc/queueadminapi"
+	"github.com/argoproj-labs/argocd-agent/principal/journal"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Server implements the QueueAdmin gRPC service
+type Server struct {
+	queueadminapi.UnimplementedQueueAdminServer
+
+	queues *queue.SendRecvQueues
+	// journal holds the last events exchanged with agents, or is nil if the
+	// event journal is disabled
+	journal *journal.Journal
+}
+
+// NewServer creates a new QueueAdmin gRPC server for the given queues and
+// event journal. j may be nil.
+func NewServer(queues *queue.SendRecvQueues, j *journal.Journal) *Server {
+	return &Server{
+		queues:  queues,
+		journal: j,
+	}
+}
+
+// ListQueues returns the number of events in the queues of every agent
+func (s *Server) ListQueues(_ context.Context, _ *queueadminapi.ListQueuesRequest) (*queueadminapi.ListQueuesResponse, error) {
+	names := s.queues.Names()
+	sort.Strings(names)
+	resp := &queueadminapi.ListQueuesResponse{}
+	for _, name := range names {
+		sendq := s.queues.SendQ(name)
+		recvq := s.queues.RecvQ(name)
+		dead, err := s.queues.DeadLetters(name)
+		if sendq == nil || recvq == nil || err != nil {
+			// The queue pair was deleted in the meantime
+			continue
+		}
+		paused, err := s.queues.Paused(name)
+		if err != nil {
+			// The queue pair was deleted in the meantime
+			continue
+		}
+		resp.Queues = append(resp.Queues, &queueadminapi.AgentQueue{
+			Agent:       name,
+			SendLen:     int32(sendq.Len()),
+			RecvLen:     int32(recvq.Len()),
+			DeadLetters: int32(len(dead)),
+			Paused:      paused,
+		})
+	}
+	return resp, nil
+}
+
+// ListEvents returns the events in the queues of an agent, and the events
+// that could not be sent to it
+func (s *Server) ListEvents(_ context.Context, req *queueadminapi.ListEventsRequest) (*queueadminapi.ListEventsResponse, error) {
+	if req.Agent == "" {
+		return nil, status.Error(codes.InvalidArgument, "agent name is required")
+	}
+	send, recv, err := s.queues.Events(req.Agent)
+	if err != nil {
+		return nil, queueError(err)
+	}
+	dead, err := s.queues.DeadLetters(req.Agent)
+	if err != nil {
+		return nil, queueError(err)
+	}
+	now := time.Now()
+	return &queueadminapi.ListEventsResponse{
+		Send:        toQueuedEvents(send, now),
+		Recv:        toQueuedEvents(recv, now),
+		DeadLetters: toQueuedEvents(dead, now),
+	}, nil
+}
+
+// PurgeQueue drops all events waiting to be sent to an agent
+func (s *Server) PurgeQueue(_ context.Context, req *queueadminapi.PurgeQueueRequest) (*queueadminapi.PurgeQueueResponse, error) {
+	if req.Agent == "" {
+		return nil, status.Error(codes.InvalidArgument, "agent name is required")
+	}
+	n, err := s.queues.Purge(req.Agent)
+	if err != nil {
+		return nil, queueError(err)
+	}
+	log().WithField("agent", req.Agent).Infof("Purged %d events from send queue", n)
+	return &queueadminapi.PurgeQueueResponse{Purged: int32(n)}, nil
+}
+
+// RequeueDeadLetters adds events that could not be sent to an agent back to
+// its send queue
+func (s *Server) RequeueDeadLetters(_ context.Context, req *queueadminapi.RequeueDeadLettersRequest) (*queueadminapi.RequeueDeadLettersResponse, error) {
+	if req.Agent == "" {
+		return nil, status.Error(codes.InvalidArgument, "agent name is required")
+	}
+	n, err := s.queues.RequeueDeadLetters(req.Agent, req.Ids...)
+	if err != nil {
+		return nil, queueError(err)
+	}
+	log().WithField("agent", req.Agent).Infof("Requeued %d dead letters", n)
+	return &queueadminapi.RequeueDeadLettersResponse{Requeued: int32(n)}, nil
+}
+
+// PauseQueue holds back the events waiting to be sent to an agent until
+// ResumeQueue is called. New events keep being queued for the agent in the
+// meantime.
+func (s *Server) PauseQueue(_ context.Context, req *queueadminapi.PauseQueueRequest) (*queueadminapi.PauseQueueResponse, error) {
+	if req.Agent == "" {
+		return nil, status.Error(codes.InvalidArgument, "agent name is required")
+	}
+	paused, err := s.queues.Pause(req.Agent)
+	if err != nil {
+		return nil, queueError(err)
+	}
+	if paused {
+		log().WithField("agent", req.Agent).Info("Paused delivery of events")
+	}
+	return &queueadminapi.PauseQueueResponse{Paused: paused}, nil
+}
+
+// ResumeQueue resumes delivery of the events held back by PauseQueue
+func (s *Server) ResumeQueue(_ context.Context, req *queueadminapi.ResumeQueueRequest) (*queueadminapi.ResumeQueueResponse, error) {
+	if req.Agent == "" {
+		return nil, status.Error(codes.InvalidArgument, "agent name is required")
+	}
+	resumed, err := s.queues.Resume(req.Agent)
+	if err != nil {
+		return nil, queueError(err)
+	}
+	resp := &queueadminapi.ResumeQueueResponse{Resumed: resumed}
+	if sendq := s.queues.SendQ(req.Agent); sendq != nil {
+		resp.SendLen = int32(sendq.Len())
+	}
+	if resumed {
+		log().WithField("agent", req.Agent).Infof("Resumed delivery of %d events", resp.SendLen)
+	}
+	return resp, nil
+}
+
+// GetJournal returns the last events exchanged with an agent, and what
+// became of them
+func (s *Server) GetJournal(_ context.Context, req *queueadminapi.GetJournalRequest) (*queueadminapi.GetJournalResponse, error) {
+	if req.Agent == "" {
+		return nil, status.Error(codes.InvalidArgument, "agent name is required")
+	}
+	if !s.journal.Enabled() {
+		return nil, status.Error(codes.FailedPrecondition, "event journal is not enabled on the principal")
+	}
+	entries := s.journal.Entries(req.Agent)
+	resp := &queueadminapi.GetJournalResponse{Entries: make([]*queueadminapi.JournalEntry, 0, len(entries))}
+	for _, e := range entries {
+		je := &queueadminapi.JournalEntry{
+			Time:          e.Time.UnixMilli(),
+			Direction:     string(e.Direction),
+			Id:            e.ID,
+			Type:          e.Type,
+			Target:        e.Target,
+			Subject:       e.Subject,
+			ResourceId:    e.ResourceID,
+			EventId:       e.EventID,
+			CorrelationId: e.CorrelationID,
+			Outcome:       e.Outcome,
+			Reason:        e.Reason,
+		}
+		if !e.Completed.IsZero() {
+			je.Completed = e.Completed.UnixMilli()
+		}
+		resp.Entries = append(resp.Entries, je)
+	}
+	return resp, nil
+}
+
+func toQueuedEvents(events []queue.QueuedEvent, now time.Time) []*queueadminapi.QueuedEvent {
+	result := make([]*queueadminapi.QueuedEvent, 0, len(events))
+	for _, ev := range events {
+		qe := &queueadminapi.QueuedEvent{
+			Id:         ev.Event.ID(),
+			Type:       ev.Event.Type(),
+			Target:     ev.Event.DataSchema(),
+			ResourceId: event.ResourceID(ev.Event),
+			Reason:     ev.Reason,
+		}
+		if !ev.Queued.IsZero() {
+			qe.AgeSeconds = int64(now.Sub(ev.Queued).Seconds())
+		}
+		result = append(result, qe)
+	}
+	return result
+}
+
+// queueError converts an error returned by the queues to a gRPC status
+func queueError(err error) error {
+	if errors.Is(err, queue.ErrQueueNotFound) {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+func log() *logrus.Entry {
+	return logging.GetDefaultLogger().ModuleLogger("grpc.QueueAdminServer")
+}
@@ -0,0 +1,174 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queueadmin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/argoproj-labs/argocd-agent/internal/queue"
+	"github.com/argoproj-labs/argocd-agent/pkg/api/grpc/queueadminapi"
+	"github.com/argoproj-labs/argocd-agent/principal/journal"
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newEvent(id string) *event.Event {
+	ev := event.New()
+	ev.SetID(id)
+	ev.SetSource("test")
+	ev.SetType("test")
+	ev.SetDataSchema("application")
+	ev.SetExtension("resourceid", "app-"+id)
+	return &ev
+}
+
+func newTestQueues(t *testing.T) *queue.SendRecvQueues {
+	t.Helper()
+	qs := queue.NewSendRecvQueues()
+	require.NoError(t, qs.Create("agent-b"))
+	require.NoError(t, qs.Create("agent-a"))
+	qs.SendQ("agent-a").Add(newEvent("1"))
+	qs.SendQ("agent-a").Add(newEvent("2"))
+	qs.RecvQ("agent-a").Add(newEvent("3"))
+	qs.DeadLetter("agent-a", newEvent("4"), "denied by policy")
+	return qs
+}
+
+func TestListQueues(t *testing.T) {
+	srv := NewServer(newTestQueues(t), nil)
+	resp, err := srv.ListQueues(context.Background(), &queueadminapi.ListQueuesRequest{})
+	require.NoError(t, err)
+	require.Len(t, resp.Queues, 2)
+	assert.Equal(t, "agent-a", resp.Queues[0].Agent)
+	assert.Equal(t, int32(2), resp.Queues[0].SendLen)
+	assert.Equal(t, int32(1), resp.Queues[0].RecvLen)
+	assert.Equal(t, int32(1), resp.Queues[0].DeadLetters)
+	assert.Equal(t, "agent-b", resp.Queues[1].Agent)
+	assert.Zero(t, resp.Queues[1].SendLen)
+}
+
+func TestListEvents(t *testing.T) {
+	srv := NewServer(newTestQueues(t), nil)
+
+	t.Run("lists the events of an agent", func(t *testing.T) {
+		resp, err := srv.ListEvents(context.Background(), &queueadminapi.ListEventsRequest{Agent: "agent-a"})
+		require.NoError(t, err)
+		require.Len(t, resp.Send, 2)
+		assert.Equal(t, "1", resp.Send[0].Id)
+		assert.Equal(t, "application", resp.Send[0].Target)
+		assert.Equal(t, "app-1", resp.Send[0].ResourceId)
+		require.Len(t, resp.Recv, 1)
+		require.Len(t, resp.DeadLetters, 1)
+		assert.Equal(t, "denied by policy", resp.DeadLetters[0].Reason)
+	})
+
+	t.Run("unknown agent", func(t *testing.T) {
+		_, err := srv.ListEvents(context.Background(), &queueadminapi.ListEventsRequest{Agent: "agent-c"})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("missing agent", func(t *testing.T) {
+		_, err := srv.ListEvents(context.Background(), &queueadminapi.ListEventsRequest{})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+}
+
+func TestPurgeQueue(t *testing.T) {
+	qs := newTestQueues(t)
+	srv := NewServer(qs, nil)
+	resp, err := srv.PurgeQueue(context.Background(), &queueadminapi.PurgeQueueRequest{Agent: "agent-a"})
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), resp.Purged)
+	assert.Zero(t, qs.SendQ("agent-a").Len())
+	assert.Equal(t, 1, qs.RecvQ("agent-a").Len())
+
+	_, err = srv.PurgeQueue(context.Background(), &queueadminapi.PurgeQueueRequest{Agent: "agent-c"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestRequeueDeadLetters(t *testing.T) {
+	qs := newTestQueues(t)
+	srv := NewServer(qs, nil)
+	resp, err := srv.RequeueDeadLetters(context.Background(), &queueadminapi.RequeueDeadLettersRequest{Agent: "agent-a", Ids: []string{"4"}})
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), resp.Requeued)
+	assert.Equal(t, 3, qs.SendQ("agent-a").Len())
+	dead, err := qs.DeadLetters("agent-a")
+	require.NoError(t, err)
+	assert.Empty(t, dead)
+}
+
+func TestPauseAndResumeQueue(t *testing.T) {
+	qs := newTestQueues(t)
+	srv := NewServer(qs, nil)
+
+	pause, err := srv.PauseQueue(context.Background(), &queueadminapi.PauseQueueRequest{Agent: "agent-a"})
+	require.NoError(t, err)
+	assert.True(t, pause.Paused)
+	pause, err = srv.PauseQueue(context.Background(), &queueadminapi.PauseQueueRequest{Agent: "agent-a"})
+	require.NoError(t, err)
+	assert.False(t, pause.Paused)
+
+	list, err := srv.ListQueues(context.Background(), &queueadminapi.ListQueuesRequest{})
+	require.NoError(t, err)
+	assert.True(t, list.Queues[0].Paused)
+	assert.False(t, list.Queues[1].Paused)
+
+	resume, err := srv.ResumeQueue(context.Background(), &queueadminapi.ResumeQueueRequest{Agent: "agent-a"})
+	require.NoError(t, err)
+	assert.True(t, resume.Resumed)
+	assert.Equal(t, int32(2), resume.SendLen)
+	resume, err = srv.ResumeQueue(context.Background(), &queueadminapi.ResumeQueueRequest{Agent: "agent-a"})
+	require.NoError(t, err)
+	assert.False(t, resume.Resumed)
+
+	_, err = srv.PauseQueue(context.Background(), &queueadminapi.PauseQueueRequest{Agent: "agent-c"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = srv.ResumeQueue(context.Background(), &queueadminapi.ResumeQueueRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGetJournal(t *testing.T) {
+	_, err := NewServer(newTestQueues(t), nil).GetJournal(context.Background(), &queueadminapi.GetJournalRequest{Agent: "agent-a"})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	j := journal.New(10)
+	srv := NewServer(newTestQueues(t), j)
+	j.Record("agent-a", journal.DirectionSend, newEvent("1"), journal.OutcomePending, "")
+	j.Record("agent-a", journal.DirectionRecv, newEvent("2"), "failure", "could not update app")
+
+	resp, err := srv.GetJournal(context.Background(), &queueadminapi.GetJournalRequest{Agent: "agent-a"})
+	require.NoError(t, err)
+	require.Len(t, resp.Entries, 2)
+	assert.Equal(t, "1", resp.Entries[0].Id)
+	assert.Equal(t, "send", resp.Entries[0].Direction)
+	assert.Equal(t, journal.OutcomePending, resp.Entries[0].Outcome)
+	assert.Zero(t, resp.Entries[0].Completed)
+	assert.Equal(t, "app-1", resp.Entries[0].ResourceId)
+	assert.Equal(t, "recv", resp.Entries[1].Direction)
+	assert.Equal(t, "could not update app", resp.Entries[1].Reason)
+	assert.NotZero(t, resp.Entries[1].Completed)
+
+	resp, err = srv.GetJournal(context.Background(), &queueadminapi.GetJournalRequest{Agent: "agent-b"})
+	require.NoError(t, err)
+	assert.Empty(t, resp.Entries)
+
+	_, err = srv.GetJournal(context.Background(), &queueadminapi.GetJournalRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -29,11 +29,14 @@ var unauthenticatedMethods map[string]bool = map[string]bool{
 
 type server struct {
 	versionapi.UnimplementedVersionServer
-	authfunc func(context.Context) (context.Context, error)
+	authfunc func(ctx context.Context, fullMethod string) (context.Context, error)
 	version  *version.Version
 }
 
-func NewServer(authfunc func(context.Context) (context.Context, error)) *server {
+// NewServer returns a new version server. authfunc authenticates calls to
+// methods that require authentication, and is given the full name of the
+// method being called.
+func NewServer(authfunc func(ctx context.Context, fullMethod string) (context.Context, error)) *server {
 	return &server{authfunc: authfunc, version: version.New("argocd-agent")}
 }
 
@@ -47,7 +50,7 @@ func (s *server) AuthFuncOverride(ctx context.Context, fullMethodName string) (c
 		return ctx, nil
 	}
 	if s.authfunc != nil {
-		return s.authfunc(ctx)
+		return s.authfunc(ctx, fullMethodName)
 	}
 	return ctx, status.Error(codes.Unauthenticated, "no session")
 }
@@ -19,11 +19,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/argoproj-labs/argocd-agent/internal/auth"
 	"github.com/argoproj-labs/argocd-agent/internal/grpcutil"
+	"github.com/argoproj-labs/argocd-agent/internal/issuer"
 	"github.com/argoproj-labs/argocd-agent/internal/session"
+	"github.com/argoproj-labs/argocd-agent/pkg/api/grpc/eventstreamapi"
+	"github.com/argoproj-labs/argocd-agent/pkg/api/grpc/logstreamapi"
 	"github.com/argoproj-labs/argocd-agent/pkg/api/grpc/replicationapi"
+	"github.com/argoproj-labs/argocd-agent/pkg/api/grpc/terminalstreamapi"
 	"github.com/argoproj-labs/argocd-agent/pkg/types"
 	middleware "github.com/grpc-ecosystem/go-grpc-middleware/v2"
 	"google.golang.org/grpc"
@@ -68,6 +73,41 @@ func (s *Server) clientCertificateMatches(ctx context.Context, match string) err
 	return nil
 }
 
+// serviceScopes maps gRPC services to the scope an agent's token must carry
+// in order to call them. Services not listed require no particular scope.
+var serviceScopes = map[string]string{
+	eventstreamapi.EventStream_ServiceDesc.ServiceName:              issuer.ScopeEventStream,
+	logstreamapi.LogStreamService_ServiceDesc.ServiceName:           issuer.ScopeLogStream,
+	terminalstreamapi.TerminalStreamService_ServiceDesc.ServiceName: issuer.ScopeTerminalStream,
+}
+
+// serviceFromMethod returns the service part of a full gRPC method name of
+// the form /service/method.
+func serviceFromMethod(fullMethod string) string {
+	service, _, _ := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	return service
+}
+
+// tokenAuthorizes returns an error if the token the claims belong to is not
+// meant to be used by agent in the given mode to call fullMethod. Tokens
+// issued before audiences and scopes were stamped into them are not bound
+// to an agent or a capability set, and are accepted until they expire.
+func tokenAuthorizes(claims issuer.Claims, agent, mode, fullMethod string) error {
+	if aud := issuer.AgentFromAudience(claims); aud != "" && aud != agent {
+		return fmt.Errorf("token was issued to agent %s", aud)
+	}
+	if _, ok := issuer.Scopes(claims); !ok {
+		return nil
+	}
+	if m := issuer.ModeFromScopes(claims); m != mode {
+		return fmt.Errorf("token was issued for mode '%s'", m)
+	}
+	if scope, ok := serviceScopes[serviceFromMethod(fullMethod)]; ok && !issuer.HasScope(claims, scope) {
+		return fmt.Errorf("token lacks scope %s required for %s", scope, fullMethod)
+	}
+	return nil
+}
+
 // unauthenticated is a wrapper function to return a gRPC unauthenticated
 // response to the caller.
 func unauthenticated() (context.Context, error) {
@@ -80,9 +120,12 @@ func unauthenticated() (context.Context, error) {
 // the client, that can later be evaluated by the server's RPC methods and
 // streams.
 //
+// The token must also authorize the client to call fullMethod, i.e. carry
+// the scope required by the method's service.
+//
 // If the request turns out to be unauthenticated, authenticate will
 // return an appropriate error.
-func (s *Server) authenticate(ctx context.Context) (context.Context, error) {
+func (s *Server) authenticate(ctx context.Context, fullMethod string) (context.Context, error) {
 	logCtx := log().WithField("module", "AuthHandler").WithField("client", grpcutil.AddressFromContext(ctx))
 	md, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
@@ -113,6 +156,19 @@ func (s *Server) authenticate(ctx context.Context) (context.Context, error) {
 		return unauthenticated()
 	}
 
+	// Reject tokens that have been revoked before their expiry
+	if s.isTokenRevoked(claims, agentInfo.ClientID) {
+		logCtx.WithField("client", agentInfo.ClientID).Warn("Rejecting revoked token")
+		return unauthenticated()
+	}
+
+	// Reject tokens used outside of the agent and capabilities they were
+	// issued for
+	if err := tokenAuthorizes(claims, agentInfo.ClientID, agentInfo.Mode, fullMethod); err != nil {
+		logCtx.WithField("client", agentInfo.ClientID).Warnf("Rejecting token: %v", err)
+		return nil, status.Error(codes.PermissionDenied, "token does not permit this request")
+	}
+
 	// Reject agents that use the same name as the Argo CD installation namespace
 	if agentInfo.ClientID == s.namespace {
 		logCtx.Warnf("Agent name '%s' is not allowed as it matches the Argo CD installation namespace. Please use a different agent name.", agentInfo.ClientID)
@@ -151,6 +207,19 @@ func (s *Server) authenticate(ctx context.Context) (context.Context, error) {
 	return authCtx, nil
 }
 
+// isTokenRevoked returns true if the token the claims belong to has been
+// revoked for the given agent.
+func (s *Server) isTokenRevoked(claims issuer.Claims, agent string) bool {
+	if s.revocations == nil {
+		return false
+	}
+	var issuedAt time.Time
+	if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+		issuedAt = iat.Time
+	}
+	return s.revocations.IsRevoked(issuer.TokenID(claims), agent, issuedAt)
+}
+
 // isReplicationMethod returns true if the gRPC method belongs to the replication service.
 func isReplicationMethod(fullMethod string) bool {
 	return strings.HasPrefix(fullMethod, fmt.Sprintf("/%s/", replicationapi.Replication_ServiceDesc.ServiceName))
@@ -203,7 +272,7 @@ func (s *Server) unaryAuthInterceptor(ctx context.Context, req any, info *grpc.U
 		}
 		return handler(ctx, req)
 	}
-	newCtx, err := s.authenticate(ctx)
+	newCtx, err := s.authenticate(ctx, info.FullMethod)
 	if err != nil {
 		return nil, err
 	}
@@ -228,7 +297,7 @@ func (s *Server) streamAuthInterceptor(srv any, stream grpc.ServerStream, info *
 		}
 		return handler(srv, stream)
 	}
-	newCtx, err := s.authenticate(stream.Context())
+	newCtx, err := s.authenticate(stream.Context(), info.FullMethod)
 	if err != nil {
 		return err
 	}
@@ -24,6 +24,7 @@ import (
 	"testing"
 
 	"github.com/argoproj-labs/argocd-agent/internal/auth"
+	"github.com/argoproj-labs/argocd-agent/internal/issuer"
 	issuermock "github.com/argoproj-labs/argocd-agent/internal/issuer/mocks"
 	"github.com/argoproj-labs/argocd-agent/internal/queue"
 	"github.com/argoproj-labs/argocd-agent/pkg/types"
@@ -402,6 +403,41 @@ func Test_Server_authenticate(t *testing.T) {
 			expectedError: "invalid authentication data",
 			shouldSucceed: false,
 		},
+		{
+			name: "revoked token",
+			setupServer: func() *Server {
+				agentInfo := auth.AuthSubject{
+					ClientID: "test-agent",
+					Mode:     "managed",
+				}
+				subjectJSON, _ := json.Marshal(agentInfo)
+
+				mockClaims := &jwt.MapClaims{
+					"sub": string(subjectJSON),
+					"jti": "revoked-id",
+				}
+				mockIssuer := issuermock.NewIssuer(t)
+				mockIssuer.On("ValidateAccessToken", "valid-token").Return(mockClaims, nil)
+
+				revocations := issuer.NewRevocationList()
+				revocations.RevokeToken("revoked-id")
+
+				return &Server{
+					issuer:      mockIssuer,
+					revocations: revocations,
+					namespace:   "argocd",
+					options:     &ServerOptions{},
+				}
+			},
+			setupContext: func() context.Context {
+				md := metadata.New(map[string]string{
+					"authorization": "valid-token",
+				})
+				return metadata.NewIncomingContext(context.Background(), md)
+			},
+			expectedError: "invalid authentication data",
+			shouldSucceed: false,
+		},
 		{
 			name: "client cert required but validation fails",
 			setupServer: func() *Server {
@@ -442,7 +478,7 @@ func Test_Server_authenticate(t *testing.T) {
 			server := tt.setupServer()
 			ctx := tt.setupContext()
 
-			newCtx, err := server.authenticate(ctx)
+			newCtx, err := server.authenticate(ctx, "/eventstreamapi.EventStream/Subscribe")
 
 			if tt.shouldSucceed {
 				assert.NoError(t, err)
@@ -461,6 +497,34 @@ func Test_Server_authenticate(t *testing.T) {
 	}
 }
 
+func Test_tokenAuthorizes(t *testing.T) {
+	subscribe := "/eventstreamapi.EventStream/Subscribe"
+	claims := &jwt.MapClaims{
+		"aud":   []any{"server-access", "agent:agent-1"},
+		"scope": "mode:managed stream:events",
+	}
+
+	t.Run("Matching agent, mode and scope", func(t *testing.T) {
+		assert.NoError(t, tokenAuthorizes(claims, "agent-1", "managed", subscribe))
+	})
+	t.Run("Token of another agent", func(t *testing.T) {
+		assert.ErrorContains(t, tokenAuthorizes(claims, "agent-2", "managed", subscribe), "issued to agent agent-1")
+	})
+	t.Run("Token of another mode", func(t *testing.T) {
+		assert.ErrorContains(t, tokenAuthorizes(claims, "agent-1", "autonomous", subscribe), "issued for mode")
+	})
+	t.Run("Missing scope", func(t *testing.T) {
+		err := tokenAuthorizes(claims, "agent-1", "managed", "/principal.apis.logstreamapi.LogStreamService/StreamLogs")
+		assert.ErrorContains(t, err, "lacks scope stream:logs")
+	})
+	t.Run("Methods without scope", func(t *testing.T) {
+		assert.NoError(t, tokenAuthorizes(claims, "agent-1", "managed", "/some.Service/Method"))
+	})
+	t.Run("Tokens without scopes", func(t *testing.T) {
+		assert.NoError(t, tokenAuthorizes(&jwt.MapClaims{"aud": "server-access"}, "agent-1", "managed", subscribe))
+	})
+}
+
 func Test_Server_unaryAuthInterceptor(t *testing.T) {
 	tests := []struct {
 		name           string
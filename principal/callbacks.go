@@ -17,12 +17,14 @@ package principal
 import (
 	"context"
 	"fmt"
+	"reflect"
 	"sync"
 
 	"github.com/argoproj-labs/argocd-agent/internal/event"
 	"github.com/argoproj-labs/argocd-agent/internal/event/targets"
 	"github.com/argoproj-labs/argocd-agent/internal/manager"
 	"github.com/argoproj-labs/argocd-agent/internal/manager/appproject"
+	"github.com/argoproj-labs/argocd-agent/internal/manager/repository"
 	"github.com/argoproj-labs/argocd-agent/internal/resources"
 	"github.com/argoproj-labs/argocd-agent/internal/tracing"
 	"github.com/argoproj-labs/argocd-agent/pkg/replication"
@@ -72,6 +74,11 @@ func (s *Server) newAppCallback(outbound *v1alpha1.Application) {
 		return
 	}
 
+	if !s.syncsAppToAgent(agentName, outbound) {
+		logCtx.Trace("Application does not match the sync label selector of the agent")
+		return
+	}
+
 	s.resources.Add(agentName, resources.NewResourceKeyFromApp(outbound))
 	s.trackAppToAgent(outbound, agentName)
 
@@ -92,7 +99,7 @@ func (s *Server) newAppCallback(outbound *v1alpha1.Application) {
 		logCtx.Errorf("Help! queue pair for agent %s disappeared!", agentName)
 		return
 	}
-	ev := s.events.ApplicationEvent(event.Create, outbound)
+	ev := s.events.ApplicationEvent(event.Create, s.appForAgent(agentName, outbound))
 	// Inject trace context into the event for propagation to agent
 	s.stampEvent(ctx, ev)
 	q.Add(ev)
@@ -130,11 +137,21 @@ func (s *Server) updateAppCallback(old *v1alpha1.Application, new *v1alpha1.Appl
 		return
 	}
 
+	logCtx = logCtx.WithField("queue", agentName)
+
+	// The agent only gets the Applications matching its sync label selector,
+	// which is reevaluated on every change.
+	if !s.syncsAppToAgent(agentName, new) {
+		if s.syncsAppToAgent(agentName, old) {
+			s.unsyncAppFromAgent(ctx, agentName, old, logCtx)
+		}
+		return
+	}
+	created := !s.syncsAppToAgent(agentName, old)
+
 	s.resources.Add(agentName, resources.NewResourceKeyFromApp(new))
 	s.trackAppToAgent(new, agentName)
 
-	logCtx = logCtx.WithField("queue", agentName)
-
 	if s.isResourceFromAutonomousAgent(new) {
 		// Remove finalizers from autonomous agent applications if it is being deleted
 		if new.DeletionTimestamp != nil && len(new.Finalizers) > 0 {
@@ -180,7 +197,9 @@ func (s *Server) updateAppCallback(old *v1alpha1.Application, new *v1alpha1.Appl
 	setOperation := false
 	var ev *cloudevents.Event
 
-	if isTerminateOperation(old, new) {
+	if created {
+		ev = s.events.ApplicationEvent(event.Create, s.appForAgent(agentName, new))
+	} else if isTerminateOperation(old, new) {
 		ev = s.events.ApplicationEvent(event.TerminateOperation, new)
 	} else {
 		// DeepCopy to avoid mutating the informer object.
@@ -188,11 +207,9 @@ func (s *Server) updateAppCallback(old *v1alpha1.Application, new *v1alpha1.Appl
 		// delivered via a dedicated SetOperation event instead.
 		out := new.DeepCopy()
 		out.Operation = nil
-		ev = s.events.ApplicationEvent(event.SpecUpdate, out)
+		ev = s.events.ApplicationEvent(event.SpecUpdate, s.appForAgent(agentName, out))
 
-		if old.Operation == nil && new.Operation != nil {
-			setOperation = true
-		}
+		setOperation = isNewOperation(old, new)
 	}
 
 	// Inject trace context into the event for propagation to agent
@@ -201,8 +218,8 @@ func (s *Server) updateAppCallback(old *v1alpha1.Application, new *v1alpha1.Appl
 	s.ha.ForwardEventForReplication(event.New(ev, targets.Application), agentName, replication.DirectionOutbound)
 	logCtx.WithField("event_type", ev.Type()).Tracef("Added app to send queue, total length now %d", q.Len())
 
-	// When a new operation appears (nil → non-nil), send it as a separate
-	// SetOperation event so that it is not overwritten by the next SpecUpdate.
+	// When a new operation appears, send it as a separate SetOperation event
+	// so that it is not overwritten by the next SpecUpdate.
 	if setOperation {
 		opEv := s.events.ApplicationEvent(event.SetOperation, new)
 		tracing.InjectTraceContext(ctx, opEv)
@@ -233,8 +250,17 @@ func (s *Server) deleteAppCallback(outbound *v1alpha1.Application) {
 		return
 	}
 
+	// The agent never got the Application
+	if !s.syncsAppToAgent(agentName, outbound) {
+		s.untrackAppToAgent(outbound)
+		return
+	}
+
 	s.resources.Remove(agentName, resources.NewResourceKeyFromApp(outbound))
 	s.untrackAppToAgent(outbound)
+	if !s.isResourceFromAutonomousAgent(outbound) {
+		s.tombstones.add(agentName, outbound)
+	}
 
 	ctx, span := s.startSpan(operationdelete, "Application", outbound)
 	defer span.End()
@@ -569,6 +595,12 @@ func (s *Server) newRepositoryCallback(outbound *corev1.Secret) {
 		return
 	}
 
+	repo, err := s.outboundRepository(outbound)
+	if err != nil {
+		logCtx.WithError(err).Error("Could not prepare repository secret for agents")
+		return
+	}
+
 	for agent := range agents {
 		q := s.queues.SendQ(agent)
 		if q == nil {
@@ -577,11 +609,11 @@ func (s *Server) newRepositoryCallback(outbound *corev1.Secret) {
 		}
 		s.resources.Add(agent, resources.NewResourceKeyFromRepository(outbound))
 
-		ev := s.events.RepositoryEvent(event.Create, outbound)
+		ev := s.events.RepositoryEvent(event.Create, repo)
 		// Inject trace context into the event for propagation to agent
 		s.stampEvent(ctx, ev)
 		q.Add(ev)
-		s.ha.ForwardEventForReplication(event.New(ev, targets.Repository), agent, replication.DirectionOutbound)
+		s.replicateRepository(ctx, event.Create, outbound, agent)
 
 		s.repoToAgents.Add(outbound.Name, agent)
 		logCtx.Tracef("Added repository %s to send queue, total length now %d", outbound.Name, q.Len())
@@ -652,6 +684,12 @@ func (s *Server) deleteRepositoryCallback(outbound *corev1.Secret) {
 		return
 	}
 
+	repo, err := s.outboundRepository(outbound)
+	if err != nil {
+		logCtx.WithError(err).Error("Could not prepare repository secret for agents")
+		return
+	}
+
 	for agent := range agents {
 		q := s.queues.SendQ(agent)
 		if q == nil {
@@ -661,11 +699,11 @@ func (s *Server) deleteRepositoryCallback(outbound *corev1.Secret) {
 
 		s.resources.Remove(agent, resources.NewResourceKeyFromRepository(outbound))
 
-		ev := s.events.RepositoryEvent(event.Delete, outbound)
+		ev := s.events.RepositoryEvent(event.Delete, repo)
 		// Inject trace context into the event for propagation to agent
 		s.stampEvent(ctx, ev)
 		q.Add(ev)
-		s.ha.ForwardEventForReplication(event.New(ev, targets.Repository), agent, replication.DirectionOutbound)
+		s.replicateRepository(ctx, event.Delete, outbound, agent)
 
 		s.repoToAgents.Delete(outbound.Name, agent)
 		logCtx.WithField("sendq_len", q.Len()+1).Tracef("Added repository delete event to send queue")
@@ -758,6 +796,184 @@ func (s *Server) syncGPGKeyToManagedAgents(ctx context.Context, cm *corev1.Confi
 	}
 }
 
+func (s *Server) newArgoCDConfigCallback(outbound *corev1.ConfigMap) {
+	ctx, span := s.startSpan(operationcreate, "ArgoCDConfig", outbound)
+	defer span.End()
+
+	logCtx := log().WithFields(logrus.Fields{
+		"component": "EventCallback",
+		"event":     "argocdconfig_create",
+		"configmap": outbound.Name,
+	})
+
+	logCtx.Info("New Argo CD configuration ConfigMap event")
+
+	s.syncArgoCDConfigToManagedAgents(ctx, outbound, event.SpecUpdate, logCtx)
+}
+
+func (s *Server) updateArgoCDConfigCallback(old, new *corev1.ConfigMap) {
+	ctx, span := s.startSpan(operationupdate, "ArgoCDConfig", old)
+	defer span.End()
+
+	logCtx := log().WithFields(logrus.Fields{
+		"component": "EventCallback",
+		"event":     "argocdconfig_update",
+		"configmap": new.Name,
+	})
+
+	keys := s.options.argoCDConfigKeys
+	if reflect.DeepEqual(keys.Filter(old).Data, keys.Filter(new).Data) {
+		logCtx.Trace("No synced keys changed in Argo CD configuration ConfigMap")
+		return
+	}
+
+	logCtx.Info("Update Argo CD configuration ConfigMap event")
+
+	s.syncArgoCDConfigToManagedAgents(ctx, new, event.SpecUpdate, logCtx)
+}
+
+func (s *Server) deleteArgoCDConfigCallback(outbound *corev1.ConfigMap) {
+	ctx, span := s.startSpan(operationdelete, "ArgoCDConfig", outbound)
+	defer span.End()
+
+	logCtx := log().WithFields(logrus.Fields{
+		"component": "EventCallback",
+		"event":     "argocdconfig_delete",
+		"configmap": outbound.Name,
+	})
+
+	logCtx.Info("Delete Argo CD configuration ConfigMap event")
+
+	// The ConfigMaps on the agents are configured locally as well, so they
+	// are not deleted. Only the keys synced to them are removed.
+	s.syncArgoCDConfigToManagedAgents(ctx, outbound, event.Delete, logCtx)
+}
+
+// syncArgoCDConfigToManagedAgents sends the selected keys of the Argo CD
+// configuration ConfigMap cm to all managed agents
+func (s *Server) syncArgoCDConfigToManagedAgents(ctx context.Context, cm *corev1.ConfigMap, evType event.EventType, logCtx *logrus.Entry) {
+	filtered := s.options.argoCDConfigKeys.Filter(cm)
+	if evType == event.Delete {
+		filtered.Data = nil
+	}
+
+	s.clientLock.RLock()
+	defer s.clientLock.RUnlock()
+
+	for agentName, mode := range s.namespaceMap {
+		if mode != types.AgentModeManaged {
+			continue
+		}
+
+		q := s.queues.SendQ(agentName)
+		if q == nil {
+			logCtx.Errorf("Queue pair not found for agent %s", agentName)
+			continue
+		}
+
+		ev := s.events.ArgoCDConfigEvent(evType, filtered)
+		tracing.InjectTraceContext(ctx, ev)
+		q.Add(ev)
+		logCtx.WithField("agent", agentName).Tracef("Added Argo CD configuration event to send queue")
+	}
+}
+
+func (s *Server) newArgoCDSecretCallback(outbound *corev1.Secret) {
+	ctx, span := s.startSpan(operationcreate, "ArgoCDSecret", outbound)
+	defer span.End()
+
+	logCtx := log().WithFields(logrus.Fields{
+		"component": "EventCallback",
+		"event":     "argocdsecret_create",
+		"secret":    outbound.Name,
+	})
+
+	logCtx.Info("New Argo CD Secret event")
+
+	s.syncArgoCDSecretToManagedAgents(ctx, outbound, event.SpecUpdate, logCtx)
+}
+
+func (s *Server) updateArgoCDSecretCallback(old, new *corev1.Secret) {
+	ctx, span := s.startSpan(operationupdate, "ArgoCDSecret", old)
+	defer span.End()
+
+	logCtx := log().WithFields(logrus.Fields{
+		"component": "EventCallback",
+		"event":     "argocdsecret_update",
+		"secret":    new.Name,
+	})
+
+	keys := s.options.argoCDConfigKeys
+	if reflect.DeepEqual(keys.FilterSecret(old).Data, keys.FilterSecret(new).Data) {
+		logCtx.Trace("No synced keys changed in Argo CD Secret")
+		return
+	}
+
+	logCtx.Info("Update Argo CD Secret event")
+
+	s.syncArgoCDSecretToManagedAgents(ctx, new, event.SpecUpdate, logCtx)
+}
+
+func (s *Server) deleteArgoCDSecretCallback(outbound *corev1.Secret) {
+	ctx, span := s.startSpan(operationdelete, "ArgoCDSecret", outbound)
+	defer span.End()
+
+	logCtx := log().WithFields(logrus.Fields{
+		"component": "EventCallback",
+		"event":     "argocdsecret_delete",
+		"secret":    outbound.Name,
+	})
+
+	logCtx.Info("Delete Argo CD Secret event")
+
+	// Like the ConfigMaps, the Secrets on the agents are not deleted. Only
+	// the keys synced to them are removed.
+	s.syncArgoCDSecretToManagedAgents(ctx, outbound, event.Delete, logCtx)
+}
+
+// syncArgoCDSecretToManagedAgents sends the selected keys of the Argo CD
+// Secret secret to all managed agents
+func (s *Server) syncArgoCDSecretToManagedAgents(ctx context.Context, secret *corev1.Secret, evType event.EventType, logCtx *logrus.Entry) {
+	if evType == event.Delete {
+		secret = &corev1.Secret{ObjectMeta: secret.ObjectMeta}
+	}
+	out, err := s.outboundArgoCDSecret(secret)
+	if err != nil {
+		logCtx.WithError(err).Error("Could not prepare Argo CD Secret for agents")
+		return
+	}
+
+	s.clientLock.RLock()
+	defer s.clientLock.RUnlock()
+
+	for agentName, mode := range s.namespaceMap {
+		if mode != types.AgentModeManaged {
+			continue
+		}
+
+		q := s.queues.SendQ(agentName)
+		if q == nil {
+			logCtx.Errorf("Queue pair not found for agent %s", agentName)
+			continue
+		}
+
+		ev := s.events.ArgoCDSecretEvent(evType, out)
+		tracing.InjectTraceContext(ctx, ev)
+		q.Add(ev)
+		logCtx.WithField("agent", agentName).Tracef("Added Argo CD Secret event to send queue")
+	}
+}
+
+// outboundArgoCDSecret returns the selected keys of secret as they are sent
+// to agents, i.e. encrypted if a repository encryption key is configured
+func (s *Server) outboundArgoCDSecret(secret *corev1.Secret) (*corev1.Secret, error) {
+	out := s.options.argoCDConfigKeys.FilterSecret(secret)
+	if s.options.repoCipher == nil {
+		return out, nil
+	}
+	return s.options.repoCipher.Encrypt(out)
+}
+
 // deleteNamespaceCallback is called when the user deletes the agent namespace.
 // Since there is no namespace we can remove the queue associated with this agent.
 func (s *Server) deleteNamespaceCallback(outbound *corev1.Namespace) {
@@ -899,6 +1115,12 @@ func (s *Server) syncRepositoryUpdatesToAgents(ctx context.Context, old, new *co
 		s.projectToRepos.Add(newProject.Name, new.Name)
 	}
 
+	repo, err := s.outboundRepository(new)
+	if err != nil {
+		logCtx.WithError(err).Error("Could not prepare repository secret for agents")
+		return
+	}
+
 	// Delete the repository from agents that no longer match the new project
 	for agent := range oldAgents {
 		// If the agent is still in the newAgents map, it means the repository is still valid for the agent
@@ -912,11 +1134,11 @@ func (s *Server) syncRepositoryUpdatesToAgents(ctx context.Context, old, new *co
 			continue
 		}
 
-		ev := s.events.RepositoryEvent(event.Delete, new)
+		ev := s.events.RepositoryEvent(event.Delete, repo)
 		// Inject trace context into the event for propagation to agent
 		s.stampEvent(ctx, ev)
 		q.Add(ev)
-		s.ha.ForwardEventForReplication(event.New(ev, targets.Repository), agent, replication.DirectionOutbound)
+		s.replicateRepository(ctx, event.Delete, new, agent)
 
 		s.repoToAgents.Delete(new.Name, agent)
 
@@ -932,11 +1154,11 @@ func (s *Server) syncRepositoryUpdatesToAgents(ctx context.Context, old, new *co
 			continue
 		}
 
-		ev := s.events.RepositoryEvent(event.SpecUpdate, new)
+		ev := s.events.RepositoryEvent(event.SpecUpdate, repo)
 		// Inject trace context into the event for propagation to agent
 		s.stampEvent(ctx, ev)
 		q.Add(ev)
-		s.ha.ForwardEventForReplication(event.New(ev, targets.Repository), agent, replication.DirectionOutbound)
+		s.replicateRepository(ctx, event.SpecUpdate, new, agent)
 
 		s.repoToAgents.Add(new.Name, agent)
 
@@ -959,6 +1181,31 @@ func (s *Server) syncRepositoriesForProject(ctx context.Context, projectName, ns
 	}
 }
 
+// outboundRepository returns repo as it is sent to agents, i.e. without the
+// fields excluded from synchronization and with its credentials encrypted if
+// a repository encryption key is configured
+func (s *Server) outboundRepository(repo *corev1.Secret) (*corev1.Secret, error) {
+	if s.options == nil {
+		return repo, nil
+	}
+	out := repository.FilterFields(repo, s.options.repoExcludedFields)
+	if s.options.repoCipher == nil {
+		return out, nil
+	}
+	return s.options.repoCipher.Encrypt(out)
+}
+
+// replicateRepository forwards an event of type evType for repo, as it is on
+// this principal, to the replicas of the principal
+func (s *Server) replicateRepository(ctx context.Context, evType event.EventType, repo *corev1.Secret, agent string) {
+	if s.ha == nil {
+		return
+	}
+	ev := s.events.RepositoryEvent(evType, repo)
+	s.stampEvent(ctx, ev)
+	s.ha.ForwardEventForReplication(event.New(ev, targets.Repository), agent, replication.DirectionOutbound)
+}
+
 // isResourceFromAutonomousAgent checks if a Kubernetes resource was created by an autonomous agent.
 // It requires both the source-uid annotation AND that the namespace maps to an autonomous agent mode,
 // because replicated resources also carry the source-uid annotation.
@@ -996,6 +1243,13 @@ func (s *Server) isAppProjectFromAutonomousAgent(project *v1alpha1.AppProject) b
 	return s.agentMode(project.Spec.SourceNamespaces[0]) == types.AgentModeAutonomous
 }
 
+// isNewOperation returns whether an operation was requested on new that has
+// not been requested on old already. This is the case when the operation is
+// set, or replaced by another one before the agent started the previous one.
+func isNewOperation(old, new *v1alpha1.Application) bool {
+	return new.Operation != nil && !reflect.DeepEqual(old.Operation, new.Operation)
+}
+
 func isTerminateOperation(old, new *v1alpha1.Application) bool {
 	return old.Status.OperationState != nil &&
 		old.Status.OperationState.Phase != synccommon.OperationTerminating &&
@@ -1005,19 +1259,32 @@ func isTerminateOperation(old, new *v1alpha1.Application) bool {
 
 // getAgentNameForApp returns the agent name that should handle the given application.
 // If destination-based mapping is enabled, the agent name is determined from
-// spec.destination.name. Otherwise, the agent name is the application's namespace.
+// its destination. Otherwise, the agent name is the application's namespace.
 func (s *Server) getAgentNameForApp(app *v1alpha1.Application) string {
 	if s.isResourceFromAutonomousAgent(app) {
 		return app.Namespace
 	}
 
 	if s.destinationBasedMapping {
-		// Use destination.name as the agent identifier
-		return app.Spec.Destination.Name
+		return s.destinationAgent(app)
 	}
 	return app.Namespace
 }
 
+// destinationAgent returns the name of the agent the destination of app
+// points to with destination-based mapping. The destination either names the
+// agent, or gives the server URL of the agent's cluster, as Applications
+// generated by the cluster generator of an ApplicationSet commonly do.
+func (s *Server) destinationAgent(app *v1alpha1.Application) string {
+	if app.Spec.Destination.Name != "" || app.Spec.Destination.Server == "" {
+		return app.Spec.Destination.Name
+	}
+	if s.clusterMgr == nil {
+		return ""
+	}
+	return s.clusterMgr.AgentForServer(app.Spec.Destination.Server)
+}
+
 // trackAppToAgent stores the mapping from application qualified name to agent name.
 // This is used by the redis proxy to route requests to the correct agent when
 // destination-based mapping is enabled.
@@ -1057,8 +1324,8 @@ func (s *Server) handleAppAgentChange(ctx context.Context, old, new *v1alpha1.Ap
 		return
 	}
 
-	oldAgentName := old.Spec.Destination.Name
-	newAgentName := new.Spec.Destination.Name
+	oldAgentName := s.destinationAgent(old)
+	newAgentName := s.destinationAgent(new)
 
 	if !s.destinationBasedMapping || (oldAgentName == newAgentName) {
 		return
@@ -20,9 +20,11 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/argoproj-labs/argocd-agent/internal/argocd/settings"
 	"github.com/argoproj-labs/argocd-agent/internal/backend/mocks"
 	"github.com/argoproj-labs/argocd-agent/internal/cache"
 	"github.com/argoproj-labs/argocd-agent/internal/event"
+	"github.com/argoproj-labs/argocd-agent/internal/event/targets"
 	"github.com/argoproj-labs/argocd-agent/internal/kube"
 	"github.com/argoproj-labs/argocd-agent/internal/manager"
 	"github.com/argoproj-labs/argocd-agent/internal/manager/application"
@@ -699,6 +701,60 @@ func TestServer_newRepositoryCallback(t *testing.T) {
 	}
 }
 
+func TestServer_newRepositoryCallback_FiltersAndEncrypts(t *testing.T) {
+	mockProjectBackend := &mocks.AppProject{}
+	project := &v1alpha1.AppProject{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "argocd"},
+		Spec: v1alpha1.AppProjectSpec{
+			Destinations:     []v1alpha1.ApplicationDestination{{Name: "agent1"}},
+			SourceNamespaces: []string{"agent1"},
+		},
+	}
+	mockProjectBackend.On("Get", mock.Anything, "default", "argocd").Return(project, nil)
+	projectManager, err := appproject.NewAppProjectManager(mockProjectBackend, "argocd")
+	require.NoError(t, err)
+
+	cipher, err := repository.NewFieldCipher([]byte("a shared key"))
+	require.NoError(t, err)
+	s := &Server{
+		ctx:            context.Background(),
+		options:        &ServerOptions{repoExcludedFields: []string{"githubAppPrivateKey"}, repoCipher: cipher},
+		queues:         queue.NewSendRecvQueues(),
+		events:         event.NewEventSource("test"),
+		namespaceMap:   map[string]types.AgentMode{"agent1": types.AgentModeManaged},
+		projectManager: projectManager,
+		resources:      resources.NewAgentResources(),
+		repoToAgents:   NewMapToSet(),
+		projectToRepos: NewMapToSet(),
+	}
+	require.NoError(t, s.queues.Create("agent1"))
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "private-repo", Namespace: "argocd", UID: "repo-uid"},
+		Data: map[string][]byte{
+			"project":             []byte("default"),
+			"url":                 []byte("https://github.com/example/private.git"),
+			"password":            []byte("s3cr3t"),
+			"githubAppPrivateKey": []byte("private key"),
+		},
+	}
+	s.newRepositoryCallback(secret)
+
+	q := s.queues.SendQ("agent1")
+	require.Equal(t, 1, q.Len())
+	ev, _ := q.Get()
+	repo, err := event.New(ev, targets.Repository).Repository()
+	require.NoError(t, err)
+	assert.NotContains(t, repo.Data, "githubAppPrivateKey")
+	assert.Equal(t, []string{"password"}, repository.EncryptedFields(repo))
+	assert.NotEqual(t, []byte("s3cr3t"), repo.Data["password"])
+	assert.Equal(t, secret.Data["url"], repo.Data["url"])
+
+	require.NoError(t, cipher.Decrypt(repo))
+	assert.Equal(t, []byte("s3cr3t"), repo.Data["password"])
+	assert.Contains(t, secret.Data, "githubAppPrivateKey", "the secret on the principal must not be modified")
+}
+
 func TestServer_syncRepositoryUpdatesToAgents(t *testing.T) {
 	// Helper to create a secret with project
 	createSecret := func(project string) *corev1.Secret {
@@ -1797,6 +1853,25 @@ func TestServer_updateAppCallback(t *testing.T) {
 		require.NoError(t, err)
 		require.Nil(t, app.Operation, "SpecUpdate must not carry the operation even when non-nil on both old and new")
 		sendQ.Done(ev)
+
+		// Replacing the operation before the agent started it: SetOperation
+		// with the new operation
+		newApp = oldApp.DeepCopy()
+		newApp.Operation.Sync.Revision = "v1.0.0"
+		s.updateAppCallback(oldApp, newApp)
+
+		assert.Equal(t, 2, sendQ.Len())
+		ev, _ = sendQ.Get()
+		assert.Equal(t, event.SpecUpdate.String(), ev.Type())
+		sendQ.Done(ev)
+		ev, _ = sendQ.Get()
+		assert.Equal(t, event.SetOperation.String(), ev.Type())
+		app = &v1alpha1.Application{}
+		err = json.Unmarshal(ev.Data(), app)
+		require.NoError(t, err)
+		require.NotNil(t, app.Operation)
+		assert.Equal(t, "v1.0.0", app.Operation.Sync.Revision)
+		sendQ.Done(ev)
 	})
 
 	t.Run("autonomous agent also receives SetOperation on nil to non-nil transition", func(t *testing.T) {
@@ -2673,6 +2748,138 @@ func TestServer_deleteGPGKeyCallback(t *testing.T) {
 	})
 }
 
+func TestServer_ArgoCDConfigCallbacks(t *testing.T) {
+	newServer := func(t *testing.T) *Server {
+		t.Helper()
+		keys, err := settings.ParseKeySelector([]string{"argocd-cm:resource.*"})
+		require.NoError(t, err)
+		s := &Server{
+			ctx:    context.Background(),
+			queues: queue.NewSendRecvQueues(),
+			events: event.NewEventSource("test"),
+			namespaceMap: map[string]types.AgentMode{
+				"agent1": types.AgentModeManaged,
+				"agent2": types.AgentModeAutonomous,
+			},
+			options: &ServerOptions{argoCDConfigKeys: keys},
+		}
+		s.queues.Create("agent1")
+		s.queues.Create("agent2")
+		return s
+	}
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "argocd-cm", Namespace: "argocd", UID: "1234", ResourceVersion: "1"},
+		Data: map[string]string{
+			"resource.exclusions": "- kinds: [Event]",
+			"url":                 "https://argocd.example.com",
+		},
+	}
+
+	t.Run("Selected keys are sent to managed agents", func(t *testing.T) {
+		s := newServer(t)
+		s.newArgoCDConfigCallback(cm)
+		assert.Equal(t, 0, s.queues.SendQ("agent2").Len())
+		require.Equal(t, 1, s.queues.SendQ("agent1").Len())
+		ev, _ := s.queues.SendQ("agent1").Get()
+		assert.Equal(t, event.SpecUpdate.String(), ev.Type())
+		sent, err := event.New(ev, targets.ArgoCDConfig).ArgoCDConfig()
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"resource.exclusions": "- kinds: [Event]"}, sent.Data)
+	})
+
+	t.Run("Updates of keys that are not selected are not sent", func(t *testing.T) {
+		s := newServer(t)
+		updated := cm.DeepCopy()
+		updated.ResourceVersion = "2"
+		updated.Data["url"] = "https://hub.example.com"
+		s.updateArgoCDConfigCallback(cm, updated)
+		assert.Equal(t, 0, s.queues.SendQ("agent1").Len())
+
+		updated.Data["resource.exclusions"] = "[]"
+		s.updateArgoCDConfigCallback(cm, updated)
+		assert.Equal(t, 1, s.queues.SendQ("agent1").Len())
+	})
+
+	t.Run("Deletion removes the synced keys", func(t *testing.T) {
+		s := newServer(t)
+		s.deleteArgoCDConfigCallback(cm)
+		require.Equal(t, 1, s.queues.SendQ("agent1").Len())
+		ev, _ := s.queues.SendQ("agent1").Get()
+		assert.Equal(t, event.Delete.String(), ev.Type())
+		sent, err := event.New(ev, targets.ArgoCDConfig).ArgoCDConfig()
+		require.NoError(t, err)
+		assert.Empty(t, sent.Data)
+	})
+}
+
+func TestServer_ArgoCDSecretCallbacks(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "argocd-notifications-secret", Namespace: "argocd", UID: "1234", ResourceVersion: "1"},
+		Data:       map[string][]byte{"slack-token": []byte("xoxb")},
+	}
+	newServer := func(t *testing.T, cipher *repository.FieldCipher) *Server {
+		t.Helper()
+		s := &Server{
+			ctx:    context.Background(),
+			queues: queue.NewSendRecvQueues(),
+			events: event.NewEventSource("test"),
+			namespaceMap: map[string]types.AgentMode{
+				"agent1": types.AgentModeManaged,
+				"agent2": types.AgentModeAutonomous,
+			},
+			options: &ServerOptions{repoCipher: cipher},
+		}
+		require.NoError(t, WithArgoCDNotificationsSync(true)(s))
+		s.queues.Create("agent1")
+		s.queues.Create("agent2")
+		return s
+	}
+	sent := func(t *testing.T, s *Server) (*cloudevents.Event, *corev1.Secret) {
+		t.Helper()
+		require.Equal(t, 1, s.queues.SendQ("agent1").Len())
+		assert.Equal(t, 0, s.queues.SendQ("agent2").Len())
+		ev, _ := s.queues.SendQ("agent1").Get()
+		out, err := event.New(ev, targets.ArgoCDSecret).ArgoCDSecret()
+		require.NoError(t, err)
+		return ev, out
+	}
+
+	t.Run("Keys are sent to managed agents", func(t *testing.T) {
+		s := newServer(t, nil)
+		s.newArgoCDSecretCallback(secret)
+		_, out := sent(t, s)
+		assert.Equal(t, secret.Data, out.Data)
+	})
+
+	t.Run("Keys are encrypted with the repository key", func(t *testing.T) {
+		cipher, err := repository.NewFieldCipher([]byte("a shared key"))
+		require.NoError(t, err)
+		s := newServer(t, cipher)
+		s.newArgoCDSecretCallback(secret)
+		_, out := sent(t, s)
+		assert.NotEqual(t, secret.Data["slack-token"], out.Data["slack-token"])
+		require.NoError(t, cipher.Decrypt(out))
+		assert.Equal(t, secret.Data, out.Data)
+	})
+
+	t.Run("Unchanged keys are not sent", func(t *testing.T) {
+		s := newServer(t, nil)
+		updated := secret.DeepCopy()
+		updated.ResourceVersion = "2"
+		updated.Labels = map[string]string{"foo": "bar"}
+		s.updateArgoCDSecretCallback(secret, updated)
+		assert.Equal(t, 0, s.queues.SendQ("agent1").Len())
+	})
+
+	t.Run("Deletion removes the synced keys", func(t *testing.T) {
+		s := newServer(t, nil)
+		s.deleteArgoCDSecretCallback(secret)
+		ev, out := sent(t, s)
+		assert.Equal(t, event.Delete.String(), ev.Type())
+		assert.Empty(t, out.Data)
+	})
+}
+
 func drainQueue(t *testing.T, q workqueue.TypedRateLimitingInterface[*cloudevents.Event]) {
 	for q.Len() > 0 {
 		ev, shutdown := q.Get()
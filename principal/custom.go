@@ -0,0 +1,57 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package principal
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/argoproj-labs/argocd-agent/internal/event"
+	"github.com/argoproj-labs/argocd-agent/internal/event/targets"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+// CustomEventHandler processes a custom event received from the agent
+// agentName. The event is acknowledged to the agent once the handler
+// returns, and is rejected if the handler returns an error.
+type CustomEventHandler func(ctx context.Context, agentName string, ev *cloudevents.Event) error
+
+// SendCustomEvent queues a custom event of type eventType for target, which
+// carries the JSON encoding of data, to be sent to the agent agentName. The
+// target must be registered with WithCustomEvents.
+func (s *Server) SendCustomEvent(ctx context.Context, agentName, target, eventType string, data any) error {
+	ev, err := s.events.CustomEvent(targets.EventTarget(target), eventType, data)
+	if err != nil {
+		return err
+	}
+	q := s.queues.SendQ(agentName)
+	if q == nil {
+		return fmt.Errorf("agent %s is not known", agentName)
+	}
+	s.stampEvent(ctx, ev)
+	q.Add(ev)
+	return nil
+}
+
+// processCustomEvent passes a custom event received from the agent agentName
+// to the handler registered for its target
+func (s *Server) processCustomEvent(ctx context.Context, agentName string, ev *cloudevents.Event) error {
+	target := event.Target(ev)
+	handler, ok := s.options.customEventHandlers[target]
+	if !ok {
+		return fmt.Errorf("no handler for custom event target %s", target)
+	}
+	return handler(ctx, agentName, ev)
+}
@@ -0,0 +1,67 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package principal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/argoproj-labs/argocd-agent/internal/event"
+	"github.com/argoproj-labs/argocd-agent/internal/queue"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_CustomEvents(t *testing.T) {
+	s := &Server{options: defaultOptions(), queues: queue.NewSendRecvQueues(), events: event.NewEventSource("principal")}
+	received := map[string]*cloudevents.Event{}
+	require.NoError(t, WithCustomEvents("telemetry.example.com", func(ctx context.Context, agentName string, ev *cloudevents.Event) error {
+		received[agentName] = ev
+		return nil
+	})(s))
+	require.NoError(t, WithCustomEvents("config.example.com", nil)(s))
+	assert.Error(t, WithCustomEvents("application", nil)(s))
+
+	t.Run("Custom events are queued for the agent", func(t *testing.T) {
+		assert.Error(t, s.SendCustomEvent(context.TODO(), "agent1", "config.example.com", "push", nil))
+		require.NoError(t, s.queues.Create("agent1"))
+		require.NoError(t, s.SendCustomEvent(context.TODO(), "agent1", "config.example.com", "push", map[string]string{"level": "debug"}))
+		assert.Error(t, s.SendCustomEvent(context.TODO(), "agent1", "unknown.example.com", "push", nil))
+		q := s.queues.SendQ("agent1")
+		require.Equal(t, 1, q.Len())
+		ev, _ := q.Get()
+		assert.Equal(t, "config.example.com", ev.DataSchema())
+		assert.Equal(t, "push", ev.Type())
+	})
+
+	t.Run("Custom events are passed to their handler", func(t *testing.T) {
+		es := event.NewEventSource("agent")
+		ev, err := es.CustomEvent("telemetry.example.com", "sample", map[string]int{"cpu": 4})
+		require.NoError(t, err)
+		require.NoError(t, s.processCustomEvent(context.TODO(), "agent1", ev))
+		assert.Equal(t, ev, received["agent1"])
+
+		// Events without a handler are rejected
+		ev, err = es.CustomEvent("config.example.com", "push", nil)
+		require.NoError(t, err)
+		assert.Error(t, s.processCustomEvent(context.TODO(), "agent1", ev))
+	})
+
+	t.Run("Custom events are not replicated", func(t *testing.T) {
+		assert.True(t, skipReplication("telemetry.example.com"))
+		assert.False(t, skipReplication("application"))
+	})
+}
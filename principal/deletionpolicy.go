@@ -0,0 +1,119 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package principal
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+)
+
+// defaultDeletionPolicyKey is the key of the deletion policy of all agents
+// without a policy of their own
+const defaultDeletionPolicyKey = "default"
+
+// appDeletionPolicies holds the deletion policy of the Applications of each
+// managed agent
+type appDeletionPolicies struct {
+	// def is the policy of all agents without a policy of their own. If
+	// empty, the finalizers of their Applications are sent unchanged.
+	def string
+	// key: agent name
+	// value: deletion policy
+	byAgent map[string]string
+}
+
+// parseAppDeletionPolicies parses policies of the form <agent>=<policy>,
+// where agent is the name of an agent or "default", and policy is one of
+// AppDeletionPolicyForeground, AppDeletionPolicyBackground or
+// AppDeletionPolicyOrphan.
+func parseAppDeletionPolicies(specs []string) (*appDeletionPolicies, error) {
+	p := &appDeletionPolicies{byAgent: make(map[string]string)}
+	for _, spec := range specs {
+		agent, policy, ok := strings.Cut(strings.TrimSpace(spec), "=")
+		if !ok || agent == "" {
+			return nil, fmt.Errorf("invalid application deletion policy %q: must be of the form <agent>=<policy>", spec)
+		}
+		switch policy {
+		case AppDeletionPolicyForeground, AppDeletionPolicyBackground, AppDeletionPolicyOrphan:
+		default:
+			return nil, fmt.Errorf("invalid application deletion policy %q: policy must be one of %s, %s, %s", spec, AppDeletionPolicyForeground, AppDeletionPolicyBackground, AppDeletionPolicyOrphan)
+		}
+		if agent == defaultDeletionPolicyKey {
+			p.def = policy
+			continue
+		}
+		p.byAgent[agent] = policy
+	}
+	return p, nil
+}
+
+// For returns the deletion policy of the Applications of agent, or the empty
+// string if there is none
+func (p *appDeletionPolicies) For(agent string) string {
+	if p == nil {
+		return ""
+	}
+	if policy, ok := p.byAgent[agent]; ok {
+		return policy
+	}
+	return p.def
+}
+
+// applyDeletionPolicy returns app with the resources finalizer matching
+// policy, which makes Argo CD on the workload cluster delete the resources of
+// the Application in the foreground or background when the Application is
+// deleted, or orphan them. Other finalizers are kept. If app already matches
+// policy, or policy is empty, app itself is returned. Otherwise, app is not
+// modified.
+func applyDeletionPolicy(app *v1alpha1.Application, policy string) *v1alpha1.Application {
+	var finalizer string
+	switch policy {
+	case AppDeletionPolicyForeground:
+		if current := app.GetPropagationPolicy(); current == v1alpha1.ResourcesFinalizerName || current == v1alpha1.ForegroundPropagationPolicyFinalizer {
+			return app
+		}
+		finalizer = v1alpha1.ResourcesFinalizerName
+	case AppDeletionPolicyBackground:
+		if app.GetPropagationPolicy() == v1alpha1.BackgroundPropagationPolicyFinalizer {
+			return app
+		}
+		finalizer = v1alpha1.BackgroundPropagationPolicyFinalizer
+	case AppDeletionPolicyOrphan:
+		if !app.CascadedDeletion() {
+			return app
+		}
+	default:
+		return app
+	}
+	out := app.DeepCopy()
+	out.UnSetCascadedDeletion()
+	if finalizer != "" {
+		out.SetCascadedDeletion(finalizer)
+	}
+	return out
+}
+
+// appForAgent returns app as it is sent to agentName, with the resources
+// finalizer matching the agent's deletion policy. The Applications of
+// autonomous agents are returned unchanged, as the agent is their source of
+// truth.
+func (s *Server) appForAgent(agentName string, app *v1alpha1.Application) *v1alpha1.Application {
+	if s.options == nil || s.options.appDeletionPolicies == nil || s.isResourceFromAutonomousAgent(app) {
+		return app
+	}
+	return applyDeletionPolicy(app, s.options.appDeletionPolicies.For(agentName))
+}
@@ -0,0 +1,110 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package principal
+
+import (
+	"testing"
+
+	"github.com/argoproj-labs/argocd-agent/internal/manager"
+	"github.com/argoproj-labs/argocd-agent/pkg/types"
+	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_applyDeletionPolicy(t *testing.T) {
+	preDelete := v1alpha1.PreDeleteFinalizerName
+	tests := []struct {
+		name       string
+		finalizers []string
+		policy     string
+		want       []string
+		unchanged  bool
+	}{
+		{
+			name:       "No policy keeps finalizers",
+			finalizers: []string{v1alpha1.BackgroundPropagationPolicyFinalizer},
+			want:       []string{v1alpha1.BackgroundPropagationPolicyFinalizer},
+			unchanged:  true,
+		},
+		{
+			name:   "Foreground adds the resources finalizer",
+			policy: AppDeletionPolicyForeground,
+			want:   []string{v1alpha1.ResourcesFinalizerName},
+		},
+		{
+			name:       "Foreground keeps the explicit foreground finalizer",
+			finalizers: []string{v1alpha1.ForegroundPropagationPolicyFinalizer},
+			policy:     AppDeletionPolicyForeground,
+			want:       []string{v1alpha1.ForegroundPropagationPolicyFinalizer},
+			unchanged:  true,
+		},
+		{
+			name:       "Background replaces the resources finalizer",
+			finalizers: []string{preDelete, v1alpha1.ResourcesFinalizerName},
+			policy:     AppDeletionPolicyBackground,
+			want:       []string{preDelete, v1alpha1.BackgroundPropagationPolicyFinalizer},
+		},
+		{
+			name:       "Orphan removes the resources finalizer",
+			finalizers: []string{v1alpha1.ResourcesFinalizerName, preDelete},
+			policy:     AppDeletionPolicyOrphan,
+			want:       []string{preDelete},
+		},
+		{
+			name:      "Orphan without resources finalizer",
+			policy:    AppDeletionPolicyOrphan,
+			unchanged: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &v1alpha1.Application{ObjectMeta: metav1.ObjectMeta{Finalizers: tt.finalizers}}
+			orig := app.DeepCopy()
+			out := applyDeletionPolicy(app, tt.policy)
+			assert.ElementsMatch(t, tt.want, out.Finalizers)
+			assert.Equal(t, orig, app)
+			if tt.unchanged {
+				assert.Same(t, app, out)
+			}
+		})
+	}
+}
+
+func Test_appForAgent(t *testing.T) {
+	policies, err := parseAppDeletionPolicies([]string{"agent-a=orphan"})
+	require.NoError(t, err)
+	s := &Server{options: defaultOptions(), namespaceMap: map[string]types.AgentMode{}}
+	s.options.appDeletionPolicies = policies
+	app := &v1alpha1.Application{ObjectMeta: metav1.ObjectMeta{
+		Name:       "app",
+		Namespace:  "agent-a",
+		Finalizers: []string{v1alpha1.ResourcesFinalizerName},
+	}}
+
+	t.Run("Policy of the agent is applied", func(t *testing.T) {
+		assert.Empty(t, s.appForAgent("agent-a", app).Finalizers)
+	})
+	t.Run("Agents without policy get the finalizers of the principal", func(t *testing.T) {
+		assert.Same(t, app, s.appForAgent("agent-b", app))
+	})
+	t.Run("Applications of autonomous agents are not changed", func(t *testing.T) {
+		s.setAgentMode("agent-a", types.AgentModeAutonomous)
+		auto := app.DeepCopy()
+		auto.Annotations = map[string]string{manager.SourceUIDAnnotation: "source-uid"}
+		assert.Same(t, auto, s.appForAgent("agent-a", auto))
+	})
+}
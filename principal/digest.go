@@ -0,0 +1,79 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package principal
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/argoproj-labs/argocd-agent/internal/manager"
+	"github.com/argoproj-labs/argocd-agent/internal/resync"
+	"github.com/argoproj-labs/argocd-agent/pkg/types"
+)
+
+// runStateDigests periodically sends a digest of the resources of each
+// connected autonomous agent to the agent until ctx is done, so that the agent
+// can resend the resources that drifted on the principal.
+func (s *Server) runStateDigests(ctx context.Context) {
+	dynClient, err := dynamic.NewForConfig(s.kubeClient.RestConfig)
+	if err != nil {
+		log().WithError(err).Error("Not sending state digests")
+		return
+	}
+
+	log().Infof("Sending state digests to autonomous agents with interval %v", s.options.stateDigestInterval)
+	ticker := time.NewTicker(s.options.stateDigestInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !s.IsActive() {
+				continue
+			}
+			for _, agentName := range s.queues.Names() {
+				if err := s.sendStateDigest(ctx, dynClient, agentName); err != nil {
+					log().WithField("agent", agentName).WithError(err).Error("Failed to send state digest")
+				}
+			}
+		}
+	}
+}
+
+// sendStateDigest sends a digest of the resources of agentName to the agent,
+// if it is a connected autonomous agent that has completed its initial resync.
+func (s *Server) sendStateDigest(ctx context.Context, dynClient dynamic.Interface, agentName string) error {
+	if s.agentMode(agentName) != types.AgentModeAutonomous || !s.isAgentConnected(agentName) || !s.resyncStatus.isResynced(agentName) {
+		return nil
+	}
+	sendQ := s.queues.SendQ(agentName)
+	if sendQ == nil {
+		return nil
+	}
+
+	logCtx := log().WithFields(logrus.Fields{
+		"agent": agentName,
+		"mode":  types.AgentModeAutonomous,
+	})
+	return resync.NewRequestHandler(dynClient, sendQ, s.events, s.resources.Get(agentName), logCtx, manager.ManagerRolePrincipal, s.namespace).
+		WithDestinationBasedMapping(s.destinationBasedMapping).
+		WithPrincipalUID(s.principalUID).
+		WithPeerNamespace(s.agentNamespace(agentName)).
+		SendStateDigest(ctx)
+}
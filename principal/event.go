@@ -17,8 +17,10 @@ package principal
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
+	"github.com/argoproj-labs/argocd-agent/internal/audit"
 	"github.com/argoproj-labs/argocd-agent/internal/backend"
 	"github.com/argoproj-labs/argocd-agent/internal/checkpoint"
 	"github.com/argoproj-labs/argocd-agent/internal/event"
@@ -31,6 +33,8 @@ import (
 	"github.com/argoproj-labs/argocd-agent/internal/tracing"
 	"github.com/argoproj-labs/argocd-agent/pkg/replication"
 	"github.com/argoproj-labs/argocd-agent/pkg/types"
+	"github.com/argoproj-labs/argocd-agent/principal/journal"
+	"github.com/argoproj-labs/argocd-agent/principal/policy"
 	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
 	cloudevents "github.com/cloudevents/sdk-go/v2"
 	"github.com/sirupsen/logrus"
@@ -46,13 +50,38 @@ import (
 
 // skipReplication returns true for event targets that are operational noise and
 // should not be forwarded to HA replicas. Replicas get fresh data from agents
-// on promotion.
+// on promotion. Custom events are processed by the handlers of the active
+// principal only.
 func skipReplication(target targets.EventTarget) bool {
 	switch target {
 	case targets.Heartbeat, targets.ClusterCacheInfoUpdate:
 		return true
 	default:
-		return false
+		return event.IsCustomTarget(target)
+	}
+}
+
+// processEventOutcome records the outcome of an event for an Application,
+// which the agent reported on the ACK for the event, as a condition of the
+// Application. The condition is removed once the agent applies an event for
+// the Application again.
+func (s *Server) processEventOutcome(agentName string, ack *cloudevents.Event) {
+	namespace, name, ok := event.AcknowledgedApplication(ack)
+	if !ok || s.appManager == nil {
+		return
+	}
+	message := ""
+	switch outcome := event.OutcomeOf(ack); {
+	case outcome.IsFailure():
+		message = fmt.Sprintf("Agent %s could not apply the last change (%s): %s", agentName, outcome, event.RejectionReason(ack))
+	case outcome != event.OutcomeApplied:
+		return
+	}
+	if err := s.appManager.SetPropagationCondition(s.ctx, namespace, name, message); err != nil {
+		log().WithError(err).WithFields(logrus.Fields{
+			"agent":       agentName,
+			"application": namespace + "/" + name,
+		}).Warn("Could not record outcome of event on application")
 	}
 }
 
@@ -64,15 +93,17 @@ func (s *Server) processRecvQueue(ctx context.Context, agentName string, q workq
 	ev, _ := q.Get()
 
 	logCtx := s.logGrpcEvent().WithFields(logrus.Fields{
-		"module":       "QueueProcessor",
-		"client":       agentName,
-		"event_target": ev.DataSchema(),
-		"event_type":   ev.Type(),
-		"agent_name":   agentName,
+		"module":         "QueueProcessor",
+		"client":         agentName,
+		"event_target":   ev.DataSchema(),
+		"event_type":     ev.Type(),
+		"agent_name":     agentName,
+		"correlation_id": event.CorrelationID(ev),
 	})
 
 	// Extract trace context from the incoming event
 	ctx = tracing.ExtractTraceContext(ctx, ev)
+	ctx = event.ContextWithCorrelationID(ctx, event.CorrelationID(ev))
 
 	// Create trace span for incoming event processing, continuing the trace from agent
 	spanName := fmt.Sprintf("%s.%s", event.Target(ev), ev.Type())
@@ -92,52 +123,95 @@ func (s *Server) processRecvQueue(ctx context.Context, agentName string, q workq
 
 	var err error
 	target := event.Target(ev)
+	sequences := s.sequences.forAgent(agentName)
 
 	// Start checkpoint step
 	cp.Start(target.String())
 
 	logCtx.Debugf("Processing event %s", target)
 
-	switch target {
-	case targets.Application:
-		err = s.processApplicationEvent(ctx, agentName, ev)
-	case targets.AppProject:
-		err = s.processAppProjectEvent(ctx, agentName, ev)
-	case targets.Resource:
-		err = s.processResourceEventResponse(ctx, agentName, ev)
-	case targets.Redis:
-		resReq := &event.RedisResponse{}
-		err := ev.DataAs(resReq)
-		if err == nil {
-			logCtx.Infof("processRecvQueue %s %v", resReq.ConnectionUUID, resReq)
+	// Events that do not conform to the protocol, that the agent is not
+	// allowed to send by its policy, or that exceed the payload limits, are
+	// rejected before they can have any effect.
+	if err = event.Validate(ev); err != nil {
+		logCtx.WithError(err).Warn("Rejecting invalid event")
+	} else if err = s.policies.Check(agentName, s.agentMode(agentName), policy.Send, ev); err != nil {
+		logCtx.WithError(err).Warn("Rejecting event by agent policy")
+	} else if err = s.options.payloadLimits.Check(ev); err != nil {
+		logCtx.WithError(err).Warn("Rejecting event exceeding payload limit")
+	} else if sequences.Duplicate(ev) {
+		// The agent sent the event again because our ACK got lost
+		err = event.NewEventDiscardedErr("event %s was already applied", event.EventID(ev))
+		logCtx.WithError(err).Debug("Discarding duplicate event")
+		if s.metrics != nil {
+			s.metrics.EventsDuplicate.WithLabelValues(agentName, target.String()).Inc()
+		}
+	} else if sequences.Stale(ev) {
+		// An event must not undo a later change to the same resource
+		err = event.NewEventDiscardedErr("a later event for resource %s was already applied", event.ResourceID(ev))
+		logCtx.WithError(err).Info("Discarding out of order event")
+		if s.metrics != nil {
+			s.metrics.EventsOutOfOrder.WithLabelValues(agentName, target.String()).Inc()
 		}
+	} else {
+		switch target {
+		case targets.Application:
+			err = s.processApplicationEvent(ctx, agentName, ev)
+		case targets.AppProject:
+			err = s.processAppProjectEvent(ctx, agentName, ev)
+		case targets.Resource:
+			err = s.processResourceEventResponse(ctx, agentName, ev)
+		case targets.Redis:
+			resReq := &event.RedisResponse{}
+			err := ev.DataAs(resReq)
+			if err == nil {
+				logCtx.Infof("processRecvQueue %s %v", resReq.ConnectionUUID, resReq)
+			}
 
-		// Process redis responses on their own thread, as they may block
-		go func() {
-			_, redisSpan := tracing.Tracer().Start(ctx, "processRedisEventResponse")
-			defer redisSpan.End()
-			err = s.processRedisEventResponse(ctx, logCtx, agentName, ev)
-			if err != nil {
-				tracing.RecordError(redisSpan, err)
-				logCtx.WithError(err).Error("unable to process redis event response")
+			// Process redis responses on their own thread, as they may block
+			go func() {
+				_, redisSpan := tracing.Tracer().Start(ctx, "processRedisEventResponse")
+				defer redisSpan.End()
+				err = s.processRedisEventResponse(ctx, logCtx, agentName, ev)
+				if err != nil {
+					tracing.RecordError(redisSpan, err)
+					logCtx.WithError(err).Error("unable to process redis event response")
+				} else {
+					tracing.SetSpanOK(redisSpan)
+				}
+			}()
+
+		case targets.ResourceResync:
+			err = s.processIncomingResourceResyncEvent(ctx, agentName, ev)
+		case targets.ClusterCacheInfoUpdate:
+			err = s.processClusterCacheInfoUpdateEvent(agentName, ev)
+		case targets.Heartbeat:
+			err = s.processHeartbeatEvent(agentName, ev)
+		default:
+			if event.IsCustomTarget(target) {
+				err = s.processCustomEvent(ctx, agentName, ev)
 			} else {
-				tracing.SetSpanOK(redisSpan)
+				err = fmt.Errorf("unknown target: '%s'", target)
 			}
-		}()
-
-	case targets.ResourceResync:
-		err = s.processIncomingResourceResyncEvent(ctx, agentName, ev)
-	case targets.ClusterCacheInfoUpdate:
-		err = s.processClusterCacheInfoUpdateEvent(agentName, ev)
-	case targets.Heartbeat:
-		err = s.processHeartbeatEvent(agentName, ev)
-	default:
-		err = fmt.Errorf("unknown target: '%s'", target)
+		}
 	}
 
 	// Mark event as processed
 	q.Done(ev)
 
+	// Events that failed with a retryable error will be sent again, and have
+	// not been applied yet.
+	if (err == nil || !kube.IsRetryableError(err)) && sequences.Applied(ev) {
+		logCtx.WithField("resource_id", event.ResourceID(ev)).Warn("Earlier events for resource were lost")
+		if s.metrics != nil {
+			s.metrics.EventSequenceGaps.WithLabelValues(agentName, target.String()).Inc()
+		}
+	}
+
+	if target == targets.Application || target == targets.AppProject {
+		s.auditResourceEvent(agentName, target, ev, err)
+	}
+
 	// Forward successfully processed events to replicas, skipping operational
 	// noise that replicas don't need. Replicas get fresh data from agents on promotion.
 	if err == nil && s.ha != nil && !skipReplication(target) {
@@ -148,19 +222,27 @@ func (s *Server) processRecvQueue(ctx context.Context, agentName string, q workq
 	cp.End()
 	logCtx.Debug(cp.String())
 
+	reason := ""
+	if err != nil {
+		reason = err.Error()
+		if event.IsInvalidEvent(err) {
+			status = metrics.EventProcessingInvalid
+		} else if event.IsEventNotAllowed(err) {
+			status = metrics.EventProcessingNotAllowed
+		} else {
+			status = metrics.EventProcessingFail
+		}
+	}
+	s.options.eventJournal.Record(agentName, journal.DirectionRecv, ev, string(status), reason)
+
 	if s.metrics != nil {
 		// ignore EventNotAllowed errors for metrics
-		if err != nil {
-			if event.IsEventNotAllowed(err) {
-				status = metrics.EventProcessingNotAllowed
-			} else {
-				status = metrics.EventProcessingFail
-				s.metrics.PrincipalErrors.WithLabelValues(target.String()).Inc()
-			}
+		if status == metrics.EventProcessingFail {
+			s.metrics.PrincipalErrors.WithLabelValues(target.String()).Inc()
 		}
 
 		// store time taken by principal to process event in metrics
-		s.metrics.EventProcessingTime.WithLabelValues(string(status), agentName, target.String()).Observe(cp.Duration().Seconds())
+		metrics.ObserveWithCorrelationID(s.metrics.EventProcessingTime.WithLabelValues(string(status), agentName, target.String()), cp.Duration().Seconds(), event.CorrelationID(ev))
 	}
 
 	if err != nil {
@@ -172,6 +254,112 @@ func (s *Server) processRecvQueue(ctx context.Context, agentName string, q workq
 	return ev, err
 }
 
+// agentSequences holds the sequence tracker of each agent
+type agentSequences struct {
+	mu sync.Mutex
+	// key: agent name
+	trackers map[string]*event.SequenceTracker
+}
+
+func newAgentSequences() *agentSequences {
+	return &agentSequences{
+		trackers: map[string]*event.SequenceTracker{},
+	}
+}
+
+// forAgent returns the sequence tracker of the named agent, creating it if
+// necessary
+func (as *agentSequences) forAgent(agentName string) *event.SequenceTracker {
+	if as == nil {
+		return nil
+	}
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	t, ok := as.trackers[agentName]
+	if !ok {
+		t = event.NewSequenceTracker()
+		as.trackers[agentName] = t
+	}
+	return t
+}
+
+// auditResourceEvent records the outcome of processing an event that mutates
+// a resource on the principal in the audit log. Discarded events did not
+// change anything and are not recorded.
+func (s *Server) auditResourceEvent(agentName string, target targets.EventTarget, ev *cloudevents.Event, err error) {
+	if s.options.auditLogger == nil || event.IsEventDiscarded(err) {
+		return
+	}
+	obj := &v1.PartialObjectMetadata{}
+	_ = ev.DataAs(obj)
+	// Applications of an agent live in the agent's namespace, while its
+	// AppProjects live in the principal's namespace.
+	namespace := agentName
+	if target == targets.AppProject {
+		namespace = s.namespace
+	}
+	ae := audit.Event{
+		Type:      audit.EventResourceMutation,
+		Actor:     agentName,
+		Namespace: namespace,
+		Outcome:   audit.OutcomeSuccess,
+		Details: map[string]string{
+			"kind":      target.String(),
+			"eventType": ev.Type(),
+			"name":      obj.Name,
+		},
+	}
+	if err != nil {
+		ae.Reason = err.Error()
+		if event.IsEventNotAllowed(err) {
+			ae.Outcome = audit.OutcomeDenied
+		} else {
+			ae.Outcome = audit.OutcomeFailure
+		}
+	}
+	s.options.auditLogger.Log(ae)
+}
+
+// checkAppOwnership returns an error if the application on the principal that
+// incoming refers to exists, but is mapped to an agent other than agentName.
+// The owner is the agent the application is tracked for, or the agent its
+// destination maps it to if it is not tracked yet. incoming must already have
+// the namespace of the application on the principal.
+func (s *Server) checkAppOwnership(ctx context.Context, agentName string, incoming *v1alpha1.Application) error {
+	existing, err := s.appManager.Get(ctx, incoming.Name, incoming.Namespace)
+	if err != nil {
+		if kerrors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("could not get application %s: %w", incoming.QualifiedName(), err)
+	}
+	owner := s.GetAgentForApp(existing.Namespace, existing.Name)
+	if owner == "" {
+		owner = s.getAgentNameForApp(existing)
+	}
+	if owner != "" && owner != agentName {
+		return event.NewEventNotAllowedErr("application %s is not mapped to agent %s", incoming.QualifiedName(), agentName)
+	}
+	return nil
+}
+
+// checkOutboundIsolation returns an error if ev is an application event for
+// an application that is not mapped to agentName. This guards against
+// leaking applications to agents they do not belong to.
+func (s *Server) checkOutboundIsolation(agentName string, ev *cloudevents.Event) error {
+	if event.Target(ev) != targets.Application {
+		return nil
+	}
+	app := &v1alpha1.Application{}
+	if err := ev.DataAs(app); err != nil {
+		return event.NewEventNotAllowedErr("could not decode application: %w", err)
+	}
+	if owner := s.getAgentNameForApp(app); owner != agentName {
+		return event.NewEventNotAllowedErr("application %s is mapped to agent %q, not %s", app.QualifiedName(), owner, agentName)
+	}
+	return nil
+}
+
 // processApplicationEvent processes an incoming event that has an application
 // target.
 func (s *Server) processApplicationEvent(ctx context.Context, agentName string, ev *cloudevents.Event) error {
@@ -183,18 +371,25 @@ func (s *Server) processApplicationEvent(ctx context.Context, agentName string,
 	agentMode := s.agentMode(agentName)
 
 	logCtx := s.logGrpcEvent().WithFields(logrus.Fields{
-		"module":      "QueueProcessor",
-		"client":      agentName,
-		"mode":        agentMode.String(),
-		"event":       ev.Type(),
-		"incoming":    incoming.QualifiedName(),
-		"resource_id": event.ResourceID(ev),
-		"event_id":    event.EventID(ev),
+		"module":         "QueueProcessor",
+		"client":         agentName,
+		"mode":           agentMode.String(),
+		"event":          ev.Type(),
+		"incoming":       incoming.QualifiedName(),
+		"resource_id":    event.ResourceID(ev),
+		"event_id":       event.EventID(ev),
+		"correlation_id": event.CorrelationID(ev),
 	})
 
 	// For autonomous agents, we may have to create the appropriate namespace
 	// on the control plane on Create or SpecUpdate events.
 	if agentMode.IsAutonomous() && (ev.Type() == event.Create.String() || ev.Type() == event.SpecUpdate.String()) {
+		// Validate the application as sent by the agent, before we rewrite
+		// any of its fields.
+		if err := s.options.appAdmission.Validate(ctx, agentName, incoming); err != nil {
+			return event.NewEventNotAllowedErr("%w", err)
+		}
+
 		if created, err := s.createNamespaceIfNotExist(ctx, agentName); err != nil {
 			return fmt.Errorf("could not create namespace %s: %w", agentName, err)
 		} else if created {
@@ -240,6 +435,16 @@ func (s *Server) processApplicationEvent(ctx context.Context, agentName string,
 		}
 	}
 
+	// With destination-based mapping, the namespace of an application on the
+	// principal is taken from the incoming payload. Make sure the agent does
+	// not reference an application that belongs to another agent.
+	if s.destinationBasedMapping && agentMode.IsManaged() {
+		if err := s.checkAppOwnership(ctx, agentName, incoming); err != nil {
+			logCtx.WithError(err).Warn("Rejecting cross-namespace application reference")
+			return err
+		}
+	}
+
 	switch ev.Type() {
 
 	// App creation event will only be processed in autonomous mode
@@ -309,6 +514,11 @@ func (s *Server) processApplicationEvent(ctx context.Context, agentName string,
 
 		s.sourceCache.Application.Set(incoming.UID, incoming.Spec)
 
+		if !s.destinationBasedMapping {
+			incoming.SetNamespace(agentName)
+		}
+		s.alignRolloutTimes(ctx, incoming)
+
 		_, err := s.appManager.UpdateStatus(ctx, agentName, incoming)
 		if err != nil {
 			return fmt.Errorf("could not update application status for %s: %w", incoming.QualifiedName(), err)
@@ -395,13 +605,14 @@ func (s *Server) processAppProjectEvent(ctx context.Context, agentName string, e
 	agentMode := s.agentMode(agentName)
 
 	logCtx := s.logGrpcEvent().WithFields(logrus.Fields{
-		"module":      "QueueProcessor",
-		"client":      agentName,
-		"mode":        agentMode.String(),
-		"event":       ev.Type(),
-		"incoming":    incoming.Name,
-		"resource_id": event.ResourceID(ev),
-		"event_id":    event.EventID(ev),
+		"module":         "QueueProcessor",
+		"client":         agentName,
+		"mode":           agentMode.String(),
+		"event":          ev.Type(),
+		"incoming":       incoming.Name,
+		"resource_id":    event.ResourceID(ev),
+		"event_id":       event.EventID(ev),
+		"correlation_id": event.CorrelationID(ev),
 	})
 
 	// AppProjects coming from different autonomous agents could have the same name,
@@ -498,12 +709,13 @@ func (s *Server) processClusterCacheInfoUpdateEvent(agentName string, ev *cloude
 
 	agentMode := s.agentMode(agentName)
 	s.logGrpcEvent().WithFields(logrus.Fields{
-		"module":      "QueueProcessor",
-		"client":      agentName,
-		"mode":        agentMode.String(),
-		"event":       ev.Type(),
-		"resource_id": event.ResourceID(ev),
-		"event_id":    event.EventID(ev),
+		"module":         "QueueProcessor",
+		"client":         agentName,
+		"mode":           agentMode.String(),
+		"event":          ev.Type(),
+		"resource_id":    event.ResourceID(ev),
+		"event_id":       event.EventID(ev),
+		"correlation_id": event.CorrelationID(ev),
 	}).Debug("Processing clusterCacheInfoUpdate event")
 
 	return s.clusterMgr.SetClusterCacheStats(clusterInfo, agentName)
@@ -643,8 +855,9 @@ func safeSendCloudEvent(ctx context.Context, ch chan *cloudevents.Event, ev *clo
 			// Channel was closed by StopTracking() while the response was in-flight.
 			// Dropping the response is fine; crashing the principal is not.
 			log().WithFields(logrus.Fields{
-				"event_id": event.EventID(ev),
-				"panic":    r,
+				"event_id":       event.EventID(ev),
+				"correlation_id": event.CorrelationID(ev),
+				"panic":          r,
 			}).Warn("recovered from panic while sending cloud event, likely due to channel being closed")
 			err = nil
 		}
@@ -661,12 +874,13 @@ func safeSendCloudEvent(ctx context.Context, ch chan *cloudevents.Event, ev *clo
 func (s *Server) processIncomingResourceResyncEvent(ctx context.Context, agentName string, ev *cloudevents.Event) error {
 	agentMode := s.agentMode(agentName)
 	logCtx := s.logGrpcEvent().WithFields(logrus.Fields{
-		"module":      "QueueProcessor",
-		"client":      agentName,
-		"mode":        agentMode.String(),
-		"event":       ev.Type(),
-		"resource_id": event.ResourceID(ev),
-		"event_id":    event.EventID(ev),
+		"module":         "QueueProcessor",
+		"client":         agentName,
+		"mode":           agentMode.String(),
+		"event":          ev.Type(),
+		"resource_id":    event.ResourceID(ev),
+		"event_id":       event.EventID(ev),
+		"correlation_id": event.CorrelationID(ev),
 	})
 
 	dynClient, err := dynamic.NewForConfig(s.kubeClient.RestConfig)
@@ -682,7 +896,12 @@ func (s *Server) processIncomingResourceResyncEvent(ctx context.Context, agentNa
 	resyncHandler := resync.NewRequestHandler(dynClient, sendQ, s.events, s.resources.Get(agentName), logCtx, manager.ManagerRolePrincipal, s.namespace).
 		WithDestinationBasedMapping(s.destinationBasedMapping).
 		WithPrincipalUID(s.principalUID).
-		WithPeerNamespace(s.agentNamespace(agentName))
+		WithPeerNamespace(s.agentNamespace(agentName)).
+		WithApplicationSelector(s.syncSelector(agentName)).
+		WithRepositorySync(s.options.repoExcludedFields, s.options.repoCipher).
+		WithApplicationTransform(func(app *v1alpha1.Application) *v1alpha1.Application {
+			return s.appForAgent(agentName, app)
+		})
 
 	switch ev.Type() {
 	case event.SyncedResourceList.String():
@@ -732,6 +951,28 @@ func (s *Server) processIncomingResourceResyncEvent(ctx context.Context, agentNa
 		}
 
 		return resyncHandler.ProcessRequestUpdateEvent(ctx, agentName, incoming)
+	case event.StateDigestExchange.String():
+		if agentMode != types.AgentModeManaged {
+			return fmt.Errorf("principal can only handle state digest in the managed mode")
+		}
+
+		incoming := &event.StateDigest{}
+		if err := ev.DataAs(incoming); err != nil {
+			return err
+		}
+
+		return resyncHandler.ProcessStateDigest(ctx, agentName, incoming)
+	case event.EventIncrementalResync.String():
+		if agentMode != types.AgentModeManaged {
+			return fmt.Errorf("principal can only handle incremental resync request in the managed mode")
+		}
+
+		incoming := &event.RequestIncrementalResync{}
+		if err := ev.DataAs(incoming); err != nil {
+			return err
+		}
+
+		return s.resyncIncrementally(ctx, agentName, incoming, logCtx)
 	case event.EventRequestResourceResync.String():
 		if agentMode != types.AgentModeAutonomous {
 			return fmt.Errorf("principal can only handle ResourceResync request in autonomous mode")
@@ -758,6 +999,7 @@ func (s *Server) eventProcessor(ctx context.Context) error {
 	queueLock := namedlock.NewNamedLock()
 	baseLogCtx := s.logGrpcEvent().WithField("module", "EventProcessor")
 	for {
+		s.markEventProcessorAlive()
 		queuesProcessed := 0
 		for _, queueName := range s.queues.Names() {
 			select {
@@ -828,13 +1070,17 @@ func (s *Server) eventProcessor(ctx context.Context) error {
 						return
 					}
 					logCtx = logCtx.WithFields(logrus.Fields{
-						"resource_id": event.ResourceID(ev),
-						"event_id":    event.EventID(ev),
-						"type":        ev.Type(),
+						"resource_id":    event.ResourceID(ev),
+						"event_id":       event.EventID(ev),
+						"correlation_id": event.CorrelationID(ev),
+						"type":           ev.Type(),
 					})
 
 					logCtx.Trace("sending an ACK for an event")
-					sendQ.Add(s.events.ProcessedEvent(event.EventProcessed, event.New(ev, targets.EventAck)))
+					ack := s.events.ProcessedEvent(event.EventProcessed, event.New(ev, targets.EventAck))
+					// Let the agent know whether its event was applied, and why not
+					event.SetOutcome(ack, err)
+					sendQ.Add(ack)
 				}(queueName, q, queueLogCtx)
 			}
 		}
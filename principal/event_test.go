@@ -16,6 +16,7 @@ package principal
 
 import (
 	"context"
+	"errors"
 	"strings"
 	"testing"
 	"time"
@@ -23,8 +24,10 @@ import (
 	"github.com/argoproj-labs/argocd-agent/internal/event"
 	"github.com/argoproj-labs/argocd-agent/internal/event/targets"
 	"github.com/argoproj-labs/argocd-agent/internal/manager"
+	"github.com/argoproj-labs/argocd-agent/internal/manager/application"
 	"github.com/argoproj-labs/argocd-agent/internal/resources"
 	"github.com/argoproj-labs/argocd-agent/pkg/types"
+	"github.com/argoproj-labs/argocd-agent/principal/admission"
 	"github.com/argoproj-labs/argocd-agent/principal/resourceproxy"
 	"github.com/argoproj-labs/argocd-agent/test/fake/kube"
 	wqmock "github.com/argoproj-labs/argocd-agent/test/mocks/k8s-workqueue"
@@ -104,7 +107,7 @@ func Test_InvalidEvents(t *testing.T) {
 		s, err := NewServer(context.Background(), kube.NewKubernetesFakeClientWithApps("argocd"), "argocd", WithGeneratedTokenSigningKey(), WithRedisProxyDisabled())
 		require.NoError(t, err)
 		got, err := s.processRecvQueue(context.Background(), "foo", wq)
-		assert.ErrorContains(t, err, "unknown target")
+		assert.True(t, event.IsInvalidEvent(err))
 		assert.Equal(t, ev, *got)
 	})
 
@@ -118,7 +121,8 @@ func Test_InvalidEvents(t *testing.T) {
 		s, err := NewServer(context.Background(), kube.NewKubernetesFakeClientWithApps("argocd"), "argocd", WithGeneratedTokenSigningKey(), WithRedisProxyDisabled())
 		require.NoError(t, err)
 		got, err := s.processRecvQueue(context.Background(), "foo", wq)
-		assert.ErrorContains(t, err, "unable to process event of type application")
+		assert.True(t, event.IsInvalidEvent(err))
+		assert.ErrorContains(t, err, "type is not a known event type")
 		assert.Equal(t, ev, *got)
 	})
 
@@ -133,11 +137,92 @@ func Test_InvalidEvents(t *testing.T) {
 		s, err := NewServer(context.Background(), kube.NewKubernetesFakeClientWithApps("argocd"), "argocd", WithGeneratedTokenSigningKey(), WithRedisProxyDisabled())
 		require.NoError(t, err)
 		got, err := s.processRecvQueue(context.Background(), "foo", wq)
-		assert.ErrorContains(t, err, "failed to unmarshal")
+		assert.True(t, event.IsInvalidEvent(err))
+		assert.ErrorContains(t, err, "data is not a JSON encoded resource")
 		assert.Equal(t, ev, *got)
 	})
 }
 
+func Test_PolicyRejectsEvents(t *testing.T) {
+	ev := cloudevents.NewEvent()
+	ev.SetDataSchema("application")
+	ev.SetType(event.Create.String())
+	wq := wqmock.NewTypedRateLimitingInterface[*cloudevents.Event](t)
+	wq.On("Get").Return(&ev, false)
+	wq.On("Done", &ev)
+	s, err := NewServer(context.Background(), kube.NewKubernetesFakeClientWithApps("argocd"), "argocd", WithGeneratedTokenSigningKey(), WithRedisProxyDisabled())
+	require.NoError(t, err)
+	s.policies.Load(map[string]string{"foo": "send: []"})
+	_, err = s.processRecvQueue(context.Background(), "foo", wq)
+	assert.True(t, event.IsEventNotAllowed(err))
+}
+
+func Test_PayloadLimitRejectsEvents(t *testing.T) {
+	ev := cloudevents.NewEvent()
+	ev.SetDataSchema("application")
+	ev.SetType(event.Create.String())
+	require.NoError(t, ev.SetData(cloudevents.ApplicationJSON, &v1alpha1.Application{
+		ObjectMeta: v1.ObjectMeta{Name: "test", Namespace: "argocd"},
+	}))
+	wq := wqmock.NewTypedRateLimitingInterface[*cloudevents.Event](t)
+	wq.On("Get").Return(&ev, false)
+	wq.On("Done", &ev)
+	limits := &event.PayloadLimits{ByTarget: map[targets.EventTarget]int{targets.Application: 10}}
+	s, err := NewServer(context.Background(), kube.NewKubernetesFakeClientWithApps("argocd"), "argocd", WithGeneratedTokenSigningKey(), WithRedisProxyDisabled(), WithEventPayloadLimits(limits))
+	require.NoError(t, err)
+	_, err = s.processRecvQueue(context.Background(), "foo", wq)
+	assert.ErrorIs(t, err, event.ErrPayloadTooLarge)
+	assert.True(t, event.IsEventNotAllowed(err))
+
+	t.Run("Limit larger than gRPC message size", func(t *testing.T) {
+		limits := &event.PayloadLimits{Default: 2048}
+		_, err := NewServer(context.Background(), kube.NewKubernetesFakeClientWithApps("argocd"), "argocd", WithGeneratedTokenSigningKey(), WithRedisProxyDisabled(), WithMaxGRPCMessageSize(1024), WithEventPayloadLimits(limits))
+		assert.ErrorContains(t, err, "exceeds the maximum gRPC message size")
+	})
+}
+
+func Test_NamespaceIsolation(t *testing.T) {
+	app := &v1alpha1.Application{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      "test",
+			Namespace: "argocd",
+		},
+		Spec: v1alpha1.ApplicationSpec{
+			Destination: v1alpha1.ApplicationDestination{Name: "agent-a"},
+		},
+	}
+	fac := kube.NewKubernetesFakeClientWithApps("argocd", app.DeepCopy())
+	s, err := NewServer(context.Background(), fac, "argocd", WithGeneratedTokenSigningKey(), WithRedisProxyDisabled(), WithDestinationBasedMapping(true))
+	require.NoError(t, err)
+	s.Start(context.Background(), make(chan error))
+
+	t.Run("Outbound events for other agents' applications are rejected", func(t *testing.T) {
+		ev := event.NewEventSource("principal").ApplicationEvent(event.SpecUpdate, app)
+		assert.NoError(t, s.checkOutboundIsolation("agent-a", ev))
+		err := s.checkOutboundIsolation("agent-b", ev)
+		assert.True(t, event.IsEventNotAllowed(err))
+	})
+
+	t.Run("Inbound events for other agents' applications are rejected", func(t *testing.T) {
+		incoming := app.DeepCopy()
+		incoming.Status.Sync.Status = v1alpha1.SyncStatusCodeSynced
+		ev := cloudevents.NewEvent()
+		ev.SetDataSchema("application")
+		ev.SetType(event.StatusUpdate.String())
+		require.NoError(t, ev.SetData(cloudevents.ApplicationJSON, incoming))
+		wq := wqmock.NewTypedRateLimitingInterface[*cloudevents.Event](t)
+		wq.On("Get").Return(&ev, false)
+		wq.On("Done", &ev)
+		s.setAgentMode("agent-b", types.AgentModeManaged)
+		_, err := s.processRecvQueue(context.Background(), "agent-b", wq)
+		assert.True(t, event.IsEventNotAllowed(err))
+
+		napp, err := fac.ApplicationsClientset.ArgoprojV1alpha1().Applications("argocd").Get(context.TODO(), "test", v1.GetOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, napp.Status.Sync.Status)
+	})
+}
+
 func Test_CreateEvents(t *testing.T) {
 	t.Run("Create application in managed mode", func(t *testing.T) {
 		ev := cloudevents.NewEvent()
@@ -200,6 +285,38 @@ func Test_CreateEvents(t *testing.T) {
 		require.Equal(t, app.Spec.Source.TargetRevision, napp.Spec.Source.TargetRevision)
 	})
 
+	t.Run("Create application rejected by admission", func(t *testing.T) {
+		app := &v1alpha1.Application{
+			ObjectMeta: v1.ObjectMeta{
+				Name:      "test",
+				Namespace: "argocd",
+			},
+			Spec: v1alpha1.ApplicationSpec{
+				Project: "default",
+				Source: &v1alpha1.ApplicationSource{
+					RepoURL: "foo",
+				},
+			},
+		}
+		fac := kube.NewKubernetesFakeClientWithApps("argocd")
+		ev := cloudevents.NewEvent()
+		ev.SetDataSchema("application")
+		ev.SetType(event.Create.String())
+		ev.SetData(cloudevents.ApplicationJSON, app)
+		wq := wqmock.NewTypedRateLimitingInterface[*cloudevents.Event](t)
+		wq.On("Get").Return(&ev, false)
+		wq.On("Done", &ev)
+		s, err := NewServer(context.Background(), fac, "argocd", WithGeneratedTokenSigningKey(), WithRedisProxyDisabled(),
+			WithAppAdmission(admission.NewController(admission.ProjectAllowlist([]string{"team-*"}))))
+		require.NoError(t, err)
+		s.setAgentMode("argocd", types.AgentModeAutonomous)
+		_, err = s.processRecvQueue(context.Background(), "argocd", wq)
+		assert.True(t, event.IsEventNotAllowed(err))
+		assert.ErrorIs(t, err, admission.ErrRejected)
+		_, err = fac.ApplicationsClientset.ArgoprojV1alpha1().Applications("argocd").Get(context.TODO(), "test", v1.GetOptions{})
+		assert.True(t, apierrors.IsNotFound(err))
+	})
+
 	t.Run("Create application in autonomous mode", func(t *testing.T) {
 		app := &v1alpha1.Application{
 			ObjectMeta: v1.ObjectMeta{
@@ -513,6 +630,56 @@ func Test_StatusUpdateEvents(t *testing.T) {
 		assert.Equal(t, v1alpha1.SyncStatusCodeSynced, updated.Status.Sync.Status)
 	})
 
+	t.Run("Destination-based mapping rejects applications of other agents", func(t *testing.T) {
+		principalNs := "argocd"
+		agentName := "my-cluster"
+
+		existingApp := &v1alpha1.Application{
+			ObjectMeta: v1.ObjectMeta{
+				Name:      "test",
+				Namespace: principalNs,
+			},
+			Spec: v1alpha1.ApplicationSpec{
+				Destination: v1alpha1.ApplicationDestination{Name: "other-cluster"},
+			},
+			Status: v1alpha1.ApplicationStatus{
+				Sync: v1alpha1.SyncStatus{Status: v1alpha1.SyncStatusCodeOutOfSync},
+			},
+		}
+
+		fac := kube.NewKubernetesFakeClientWithApps(principalNs, existingApp)
+
+		incomingApp := existingApp.DeepCopy()
+		incomingApp.Status.Sync.Status = v1alpha1.SyncStatusCodeSynced
+
+		ev := cloudevents.NewEvent()
+		ev.SetDataSchema("application")
+		ev.SetType(event.StatusUpdate.String())
+		ev.SetData(cloudevents.ApplicationJSON, incomingApp)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		s, err := NewServer(ctx, fac, principalNs,
+			WithGeneratedTokenSigningKey(),
+			WithDestinationBasedMapping(true),
+			WithRedisProxyDisabled(),
+		)
+		require.NoError(t, err)
+		defer func() { _ = s.Shutdown() }()
+		err = s.Start(ctx, make(chan error))
+		require.NoError(t, err)
+
+		s.setAgentMode(agentName, types.AgentModeManaged)
+
+		err = s.processApplicationEvent(ctx, agentName, &ev)
+		assert.True(t, event.IsEventNotAllowed(err))
+
+		updated, err := fac.ApplicationsClientset.ArgoprojV1alpha1().Applications(principalNs).Get(ctx, "test", v1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, v1alpha1.SyncStatusCodeOutOfSync, updated.Status.Sync.Status)
+	})
+
 	t.Run("Destination-based mapping does not remap without annotation", func(t *testing.T) {
 		principalNs := "argocd"
 		agentNs := "argocd-agent"
@@ -1657,3 +1824,39 @@ func Test_processClusterCacheInfoUpdateEvent(t *testing.T) {
 		assert.ErrorContains(t, err, "not mapped to any cluster")
 	})
 }
+
+func Test_EventOutcomes(t *testing.T) {
+	app := &v1alpha1.Application{
+		ObjectMeta: v1.ObjectMeta{Name: "guestbook", Namespace: "my-cluster", UID: "uid"},
+	}
+	fac := kube.NewKubernetesFakeClientWithApps("argocd", app)
+	s, err := NewServer(context.Background(), fac, "argocd", WithGeneratedTokenSigningKey(), WithRedisProxyDisabled())
+	require.NoError(t, err)
+	evs := event.NewEventSource("test")
+	ackFor := func(ev *cloudevents.Event, err error) *cloudevents.Event {
+		ack := evs.ProcessedEvent(event.EventProcessed, event.New(ev, targets.Application))
+		event.SetOutcome(ack, err)
+		return ack
+	}
+	conditions := func() []v1alpha1.ApplicationCondition {
+		got, err := fac.ApplicationsClientset.ArgoprojV1alpha1().Applications("my-cluster").Get(context.TODO(), "guestbook", v1.GetOptions{})
+		require.NoError(t, err)
+		return got.Status.Conditions
+	}
+
+	// Failures of the agent surface as a condition of the Application
+	s.processEventOutcome("my-cluster", ackFor(evs.ApplicationEvent(event.SpecUpdate, app), errors.New("admission webhook denied the request")))
+	got := conditions()
+	require.Len(t, got, 1)
+	assert.Equal(t, application.ApplicationConditionAgentPropagationError, got[0].Type)
+	assert.Contains(t, got[0].Message, "admission webhook denied the request")
+	assert.Contains(t, got[0].Message, "my-cluster")
+
+	// Discarded events leave the condition alone
+	s.processEventOutcome("my-cluster", ackFor(evs.ApplicationEvent(event.SpecUpdate, app), event.NewEventDiscardedErr("duplicate")))
+	assert.Len(t, conditions(), 1)
+
+	// The condition is removed once an event is applied again
+	s.processEventOutcome("my-cluster", ackFor(evs.ApplicationEvent(event.SpecUpdate, app), nil))
+	assert.Empty(t, conditions())
+}
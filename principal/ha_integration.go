@@ -400,13 +400,21 @@ func replicationClientTLSConfig(serverTLSConfig *tls.Config) *tls.Config {
 	if serverTLSConfig == nil {
 		return nil
 	}
-	return &tls.Config{
+	tlsConfig := &tls.Config{
 		Certificates: serverTLSConfig.Certificates,
 		RootCAs:      serverTLSConfig.ClientCAs,
 		MinVersion:   serverTLSConfig.MinVersion,
 		MaxVersion:   serverTLSConfig.MaxVersion,
 		CipherSuites: serverTLSConfig.CipherSuites,
 	}
+	// Present the server's current certificate, which may have been reloaded
+	// since the replication client was created.
+	if serverTLSConfig.GetCertificate != nil {
+		tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return serverTLSConfig.GetCertificate(&tls.ClientHelloInfo{})
+		}
+	}
+	return tlsConfig
 }
 
 // StartHA starts the HA components.
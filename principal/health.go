@@ -0,0 +1,95 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package principal
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/argoproj-labs/argocd-agent/pkg/api/grpc/eventstreamapi"
+)
+
+const (
+	// eventProcessorStallTimeout is the duration after which an event
+	// processor that has not completed a loop is considered wedged.
+	eventProcessorStallTimeout = 30 * time.Second
+
+	// healthCheckInterval is the interval in which the gRPC serving status
+	// is updated.
+	healthCheckInterval = 5 * time.Second
+)
+
+// markEventProcessorAlive records that the event processor is making progress
+func (s *Server) markEventProcessorAlive() {
+	s.eventProcessorSeen.Store(time.Now().UnixNano())
+}
+
+// eventProcessorHealthy returns whether the event processor has completed a
+// loop recently. An event processor that has not yet been started is not
+// healthy.
+func (s *Server) eventProcessorHealthy() bool {
+	seen := s.eventProcessorSeen.Load()
+	if seen == 0 {
+		return false
+	}
+	return time.Since(time.Unix(0, seen)) <= eventProcessorStallTimeout
+}
+
+// servingStatus returns the gRPC serving status of the principal. Like the
+// healthz endpoint, a principal that is not the active one of an HA pair does
+// not report itself as serving.
+func (s *Server) servingStatus() healthpb.HealthCheckResponse_ServingStatus {
+	if !s.eventProcessorHealthy() {
+		return healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	if s.ha != nil && s.ha.Controller != nil && !s.ha.Controller.State().IsHealthy() {
+		return healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	return healthpb.HealthCheckResponse_SERVING
+}
+
+// updateServingStatus sets the serving status of the principal, as well as of
+// the event stream service, on the health server.
+func (s *Server) updateServingStatus() {
+	status := s.servingStatus()
+	s.healthSrv.SetServingStatus("", status)
+	s.healthSrv.SetServingStatus(eventstreamapi.EventStream_ServiceDesc.ServiceName, status)
+}
+
+// runHealthChecks periodically updates the serving status reported through
+// the gRPC health checking protocol until ctx is done.
+func (s *Server) runHealthChecks(ctx context.Context) {
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+	for {
+		s.updateServingStatus()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// newHealthServer returns a health server that reports every service as not
+// serving until the first health check has run.
+func newHealthServer() *health.Server {
+	srv := health.NewServer()
+	srv.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	return srv
+}
@@ -0,0 +1,62 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package principal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func Test_ServingStatus(t *testing.T) {
+	check := func(t *testing.T, s *Server, service string) healthpb.HealthCheckResponse_ServingStatus {
+		t.Helper()
+		resp, err := s.healthSrv.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+		require.NoError(t, err)
+		return resp.Status
+	}
+
+	t.Run("Not serving before the event processor has started", func(t *testing.T) {
+		s := &Server{healthSrv: newHealthServer()}
+		assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, check(t, s, ""))
+		s.updateServingStatus()
+		assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, check(t, s, ""))
+	})
+
+	t.Run("Serving while the event processor makes progress", func(t *testing.T) {
+		s := &Server{healthSrv: newHealthServer()}
+		s.markEventProcessorAlive()
+		s.updateServingStatus()
+		assert.Equal(t, healthpb.HealthCheckResponse_SERVING, check(t, s, ""))
+		assert.Equal(t, healthpb.HealthCheckResponse_SERVING, check(t, s, "eventstreamapi.EventStream"))
+	})
+
+	t.Run("Not serving when the event processor is wedged", func(t *testing.T) {
+		s := &Server{healthSrv: newHealthServer()}
+		s.eventProcessorSeen.Store(time.Now().Add(-2 * eventProcessorStallTimeout).UnixNano())
+		s.updateServingStatus()
+		assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, check(t, s, ""))
+		assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, check(t, s, "eventstreamapi.EventStream"))
+	})
+
+	t.Run("Health checks do not require authentication", func(t *testing.T) {
+		assert.True(t, noAuthEndpoints["/grpc.health.v1.Health/Check"])
+		assert.True(t, noAuthEndpoints["/grpc.health.v1.Health/Watch"])
+	})
+}
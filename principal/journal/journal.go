@@ -0,0 +1,182 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package journal records the last events the principal exchanged with each
+agent, along with when they were exchanged and what became of them. The
+journal is kept in memory only, and is meant to answer what was sent to or
+received from an agent when debugging, not to replay events.
+*/
+package journal
+
+import (
+	"sync"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+
+	"github.com/argoproj-labs/argocd-agent/internal/event"
+	"github.com/argoproj-labs/argocd-agent/internal/event/targets"
+)
+
+// Direction tells whether an event was sent to or received from an agent
+type Direction string
+
+const (
+	DirectionSend Direction = "send"
+	DirectionRecv Direction = "recv"
+)
+
+// Outcomes of events sent to an agent. The outcomes of received events are
+// those of the event processing metrics, e.g. success or failure.
+const (
+	// OutcomePending is the outcome of sent events the agent has not
+	// acknowledged yet
+	OutcomePending = "pending"
+	// OutcomeAcknowledged is the outcome of sent events the agent has
+	// acknowledged
+	OutcomeAcknowledged = "acknowledged"
+	// OutcomeRejected is the outcome of sent events the agent acknowledged
+	// without applying them
+	OutcomeRejected = "rejected"
+	// OutcomeDropped is the outcome of events that were not sent to the
+	// agent at all
+	OutcomeDropped = "dropped"
+)
+
+// Entry is a single event in the journal
+type Entry struct {
+	// Time is when the event was sent or received
+	Time      time.Time
+	Direction Direction
+
+	ID            string
+	Type          string
+	Target        string
+	Subject       string
+	ResourceID    string
+	EventID       string
+	CorrelationID string
+
+	Outcome string
+	// Reason explains the outcome, e.g. why an event was rejected
+	Reason string
+	// Completed is when the final outcome was recorded. It is zero while the
+	// outcome is pending.
+	Completed time.Time
+}
+
+// Journal holds the last events exchanged with each agent. It is safe for
+// concurrent use. All methods of a nil Journal are no-ops, so that callers do
+// not need to check whether journaling is enabled.
+type Journal struct {
+	size int
+
+	mu sync.Mutex
+	// key: agent name
+	// value: the entries of the agent, oldest first
+	entries map[string][]*Entry
+}
+
+// New returns a journal that keeps the last size events per agent
+func New(size int) *Journal {
+	return &Journal{
+		size:    size,
+		entries: make(map[string][]*Entry),
+	}
+}
+
+// Record adds ev, which was exchanged with agent in direction dir, to the
+// journal. Heartbeats are not recorded.
+func (j *Journal) Record(agent string, dir Direction, ev *cloudevents.Event, outcome string, reason string) {
+	if j == nil || event.Target(ev) == targets.Heartbeat {
+		return
+	}
+	now := time.Now()
+	e := &Entry{
+		Time:          now,
+		Direction:     dir,
+		ID:            ev.ID(),
+		Type:          ev.Type(),
+		Target:        ev.DataSchema(),
+		Subject:       ev.Subject(),
+		ResourceID:    event.ResourceID(ev),
+		EventID:       event.EventID(ev),
+		CorrelationID: event.CorrelationID(ev),
+		Outcome:       outcome,
+		Reason:        reason,
+	}
+	if outcome != OutcomePending {
+		e.Completed = now
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	entries := j.entries[agent]
+	if len(entries) >= j.size {
+		// Drop the oldest entries without growing the backing array forever
+		entries = append(entries[:0:0], entries[len(entries)-j.size+1:]...)
+	}
+	j.entries[agent] = append(entries, e)
+}
+
+// Acknowledge records the outcome of the sent event that ack acknowledges.
+// The event is looked up by its correlation ID, or by its event ID if the
+// agent does not send correlation IDs.
+func (j *Journal) Acknowledge(agent string, ack *cloudevents.Event) {
+	if j == nil {
+		return
+	}
+	correlationID := event.CorrelationID(ack)
+	eventID := event.EventID(ack)
+	outcome, reason := OutcomeAcknowledged, ""
+	if reason = event.RejectionReason(ack); reason != "" {
+		outcome = OutcomeRejected
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	entries := j.entries[agent]
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if e.Direction != DirectionSend || e.Outcome != OutcomePending {
+			continue
+		}
+		if (correlationID != "" && e.CorrelationID == correlationID) || (correlationID == "" && e.EventID == eventID) {
+			e.Outcome = outcome
+			e.Reason = reason
+			e.Completed = time.Now()
+			return
+		}
+	}
+}
+
+// Entries returns a copy of the entries of agent, oldest first
+func (j *Journal) Entries(agent string) []Entry {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	result := make([]Entry, 0, len(j.entries[agent]))
+	for _, e := range j.entries[agent] {
+		result = append(result, *e)
+	}
+	return result
+}
+
+// Enabled returns whether events are recorded in j
+func (j *Journal) Enabled() bool {
+	return j != nil
+}
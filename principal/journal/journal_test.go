@@ -0,0 +1,81 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package journal
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/argoproj-labs/argocd-agent/internal/event"
+)
+
+func Test_Journal(t *testing.T) {
+	es := event.NewEventSource("test")
+	app := func(rv int) *v1alpha1.Application {
+		return &v1alpha1.Application{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "argocd", UID: "uid", ResourceVersion: fmt.Sprint(rv)}}
+	}
+
+	t.Run("Only the last events are kept", func(t *testing.T) {
+		j := New(3)
+		for i := range 5 {
+			j.Record("agent", DirectionSend, es.ApplicationEvent(event.SpecUpdate, app(i)), OutcomePending, "")
+		}
+		entries := j.Entries("agent")
+		require.Len(t, entries, 3)
+		assert.Equal(t, "app_uid_2", entries[0].EventID)
+		assert.Equal(t, "app_uid_4", entries[2].EventID)
+		assert.Equal(t, "argocd/app", entries[2].Subject)
+		assert.Empty(t, j.Entries("other-agent"))
+	})
+
+	t.Run("ACKs record the outcome of sent events", func(t *testing.T) {
+		j := New(10)
+		acked := es.ApplicationEvent(event.SpecUpdate, app(1))
+		rejected := es.ApplicationEvent(event.SpecUpdate, app(2))
+		j.Record("agent", DirectionSend, acked, OutcomePending, "")
+		j.Record("agent", DirectionSend, rejected, OutcomePending, "")
+		assert.True(t, j.Entries("agent")[0].Completed.IsZero())
+
+		j.Acknowledge("agent", es.ProcessedEvent(event.EventProcessed, event.New(acked, "")))
+		ack := es.ProcessedEvent(event.EventProcessed, event.New(rejected, ""))
+		event.SetRejectionReason(ack, "denied by policy")
+		j.Acknowledge("agent", ack)
+
+		entries := j.Entries("agent")
+		assert.Equal(t, OutcomeAcknowledged, entries[0].Outcome)
+		assert.False(t, entries[0].Completed.IsZero())
+		assert.Equal(t, OutcomeRejected, entries[1].Outcome)
+		assert.Equal(t, "denied by policy", entries[1].Reason)
+	})
+
+	t.Run("Heartbeats are not recorded", func(t *testing.T) {
+		j := New(10)
+		j.Record("agent", DirectionRecv, es.HeartbeatEvent(event.Ping), "success", "")
+		assert.Empty(t, j.Entries("agent"))
+	})
+
+	t.Run("A nil journal records nothing", func(t *testing.T) {
+		var j *Journal
+		j.Record("agent", DirectionSend, es.ApplicationEvent(event.SpecUpdate, app(1)), OutcomePending, "")
+		j.Acknowledge("agent", es.HeartbeatEvent(event.Pong))
+		assert.Nil(t, j.Entries("agent"))
+		assert.False(t, j.Enabled())
+	})
+}
@@ -16,9 +16,13 @@ package principal
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"math"
 	"net"
 	"net/http"
+	"net/netip"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -27,20 +31,32 @@ import (
 	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/reflection"
 	"k8s.io/apimachinery/pkg/util/wait"
 
+	"github.com/argoproj-labs/argocd-agent/internal/connlimit"
+	"github.com/argoproj-labs/argocd-agent/internal/event"
 	"github.com/argoproj-labs/argocd-agent/internal/grpcutil"
 	"github.com/argoproj-labs/argocd-agent/internal/metrics"
+	"github.com/argoproj-labs/argocd-agent/internal/proxyproto"
+	"github.com/argoproj-labs/argocd-agent/internal/quictransport"
+	"github.com/argoproj-labs/argocd-agent/internal/tlsutil"
 	"github.com/argoproj-labs/argocd-agent/pkg/api/grpc/authapi"
+	"github.com/argoproj-labs/argocd-agent/pkg/api/grpc/certificateapi"
 	"github.com/argoproj-labs/argocd-agent/pkg/api/grpc/eventstreamapi"
 	"github.com/argoproj-labs/argocd-agent/pkg/api/grpc/logstreamapi"
 	"github.com/argoproj-labs/argocd-agent/pkg/api/grpc/replicationapi"
 	"github.com/argoproj-labs/argocd-agent/pkg/api/grpc/terminalstreamapi"
 	"github.com/argoproj-labs/argocd-agent/pkg/api/grpc/versionapi"
 	"github.com/argoproj-labs/argocd-agent/principal/apis/auth"
+	"github.com/argoproj-labs/argocd-agent/principal/apis/certificate"
 	"github.com/argoproj-labs/argocd-agent/principal/apis/eventstream"
 	"github.com/argoproj-labs/argocd-agent/principal/apis/version"
+	"github.com/argoproj-labs/argocd-agent/principal/policy"
+	"github.com/argoproj-labs/argocd-agent/principal/registration"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
 	grpchttp1server "golang.stackrox.io/grpc-http1/server"
 	_ "google.golang.org/grpc/encoding/gzip"
 )
@@ -61,6 +77,43 @@ type Listener struct {
 	l      net.Listener
 	ctx    context.Context
 	cancel context.CancelFunc
+	// reloader holds the keypair served on this listener, if it has its own.
+	// Otherwise, the server's keypair is served.
+	reloader *tlsutil.CertificateReloader
+}
+
+// listenerConn is a connection accepted on a Listener with its own keypair
+type listenerConn struct {
+	net.Conn
+	listener *Listener
+}
+
+// keyPairListener wraps the connections accepted on a Listener with its own
+// keypair, so that the keypair can be selected during the TLS handshake.
+type keyPairListener struct {
+	net.Listener
+	listener *Listener
+}
+
+func (l *keyPairListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &listenerConn{Conn: c, listener: l.listener}, nil
+}
+
+// listenerCertificateFunc returns a function to be used as the
+// GetCertificate callback of the server's TLS config. It serves the keypair
+// of the listener a connection was accepted on, if that listener has its own
+// keypair, and otherwise calls next.
+func listenerCertificateFunc(next func(*tls.ClientHelloInfo) (*tls.Certificate, error)) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		if lc, ok := hello.Conn.(*listenerConn); ok && lc.listener.reloader != nil {
+			return lc.listener.reloader.GetCertificate(hello)
+		}
+		return next(hello)
+	}
 }
 
 func parseAddress(address string) (string, int, error) {
@@ -92,15 +145,54 @@ func addrToListener(l net.Listener) (*Listener, error) {
 	return &Listener{host: host, port: port, l: l}, nil
 }
 
-// Listen configures and starts the server's TCP listener.
+// Listen configures and starts the server's TCP listeners: the main one and
+// any additional listeners.
 func (s *Server) Listen(ctx context.Context, backoff wait.Backoff) error {
+	l, err := s.listen(ctx, backoff, s.options.address, s.options.port)
+	if err != nil {
+		return err
+	}
+	s.listener = l
+	for _, spec := range s.options.additionalListeners {
+		l, err := s.listen(ctx, backoff, spec.address, spec.port)
+		if err != nil {
+			return fmt.Errorf("could not start additional listener on %s: %w", net.JoinHostPort(spec.address, strconv.Itoa(spec.port)), err)
+		}
+		if spec.certPath != "" {
+			if s.options.insecurePlaintext {
+				l.l.Close()
+				return fmt.Errorf("listener %s cannot use a TLS keypair in plaintext mode", l.Address())
+			}
+			cert, err := tlsutil.TLSCertFromFile(spec.certPath, spec.keyPath, false)
+			if err != nil {
+				l.l.Close()
+				return fmt.Errorf("unable to load TLS keypair for listener %s: %w", l.Address(), err)
+			}
+			l.reloader = tlsutil.NewCertificateReloader(cert)
+			l.l = &keyPairListener{Listener: l.l, listener: l}
+		}
+		s.additionalListeners = append(s.additionalListeners, l)
+	}
+	return nil
+}
+
+// listen starts a TCP listener on address and port.
+func (s *Server) listen(ctx context.Context, backoff wait.Backoff, address string, port int) (*Listener, error) {
 	var c net.Listener
 	var err error
 	try := 1
-	bind := fmt.Sprintf("%s:%d", s.options.address, s.options.port)
+	bind := net.JoinHostPort(strings.Trim(address, "[]"), strconv.Itoa(port))
 	// It should not be a fatal failure if the listener could not be started.
 	// Instead, retry with backoff until the context has expired or the
 	// number of maximum retries has been exceeded.
+	if s.options.insecurePlaintext {
+		if !s.options.insecurePlaintextForce {
+			if err := checkPlaintextAddress(ctx, address, net.InterfaceAddrs); err != nil {
+				return nil, err
+			}
+		}
+		s.logGrpcEvent().Warnf("INSECURE: Serving gRPC without TLS (h2c) on %s", bind)
+	}
 	err = wait.ExponentialBackoff(backoff, func() (done bool, err error) {
 		var lerr error
 		if try == 1 {
@@ -124,19 +216,64 @@ func (s *Server) Listen(ctx context.Context, backoff wait.Backoff) error {
 	})
 	// The following condition will probably never be true
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	s.logGrpcEvent().Infof("Now listening on %s", c.Addr().String())
-	s.listener, err = addrToListener(c)
-	if err == nil {
-		if ctx == nil {
-			s.listener.ctx, s.listener.cancel = context.WithCancel(context.Background())
-		} else {
-			s.listener.ctx, s.listener.cancel = context.WithCancel(ctx)
-		}
+	// The PROXY header has to be read before filtering, so that the filter
+	// applies to the agent's address rather than the load balancer's.
+	if s.options.proxyProtocol {
+		c = proxyproto.NewListener(c, s.options.proxyProtocolTrusted, proxyproto.DefaultHeaderTimeout)
 	}
-	return err
+	if s.ipFilter != nil {
+		c = s.ipFilter.Listener(c)
+	}
+	// Connections are limited after filtering, so that rejected connections
+	// do not count against the limit.
+	if s.connLimiter != nil {
+		c = s.connLimiter.Listener(c)
+	}
+	l, err := addrToListener(c)
+	if err != nil {
+		return nil, err
+	}
+	if ctx == nil {
+		l.ctx, l.cancel = context.WithCancel(context.Background())
+	} else {
+		l.ctx, l.cancel = context.WithCancel(ctx)
+	}
+	return l, nil
+}
+
+// listenQUIC starts the QUIC listener on the address of the main listener,
+// serving the keypair of tlsConfig. The IP filter and connection limits apply
+// to it as to the TCP listeners.
+func (s *Server) listenQUIC(tlsConfig *tls.Config) (net.Listener, error) {
+	if tlsConfig == nil {
+		return nil, fmt.Errorf("the QUIC listener cannot be used in plaintext mode")
+	}
+	bind := net.JoinHostPort(strings.Trim(s.options.address, "[]"), strconv.Itoa(s.options.quicPort))
+	ql, err := quictransport.Listen(bind, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	s.logGrpcEvent().Warnf("EXPERIMENTAL: Now listening for QUIC on %s", ql.Addr().String())
+	var l net.Listener = ql
+	if s.ipFilter != nil {
+		l = s.ipFilter.Listener(l)
+	}
+	if s.connLimiter != nil {
+		l = s.connLimiter.Listener(l)
+	}
+	return l, nil
+}
+
+// listeners returns all listeners of the server, starting with the main one
+func (s *Server) listeners() []*Listener {
+	if s.listener == nil {
+		return nil
+	}
+	return append([]*Listener{s.listener}, s.additionalListeners...)
 }
 
 func (s *Server) serveGRPC(ctx context.Context, metrics *metrics.PrincipalMetrics, grpcMetrics *grpcprom.ServerMetrics, errch chan error) error {
@@ -145,16 +282,33 @@ func (s *Server) serveGRPC(ctx context.Context, metrics *metrics.PrincipalMetric
 		return fmt.Errorf("could not start listener: %w", err)
 	}
 
+	if err := s.watchTLSCertificate(ctx); err != nil {
+		return fmt.Errorf("could not watch TLS certificate: %w", err)
+	}
+	s.monitorCertificateExpiry(ctx)
+
 	streamInterceptors := []grpc.StreamServerInterceptor{
 		s.streamRequestLogger(), // logging
 		s.streamAuthInterceptor, // auth
 		grpcutil.StreamServerMsgSizeInterceptor(s.options.maxGRPCMessageSize), // message size warning
 	}
+	if s.options.compression != "" && s.options.compression != grpcutil.CompressionAuto {
+		s.logGrpcEvent().Debugf("Using %s compression for streams", s.options.compression)
+		streamInterceptors = append(streamInterceptors, grpcutil.StreamServerCompressionInterceptor(s.options.compression))
+	}
 	unaryInterceptors := []grpc.UnaryServerInterceptor{
 		s.unaryRequestLogger(), // logging
 		s.unaryAuthInterceptor, // auth
 		grpcutil.UnaryServerMsgSizeInterceptor(s.options.maxGRPCMessageSize), // message size warning
+		grpcutil.UnaryServerTimeoutInterceptor(s.options.unaryTimeout, isReplicationMethod),
 	}
+	// Streams beyond the limit are rejected before doing any work for them
+	if s.streamLimiter != nil {
+		streamInterceptors = append([]grpc.StreamServerInterceptor{s.streamLimiter.StreamServerInterceptor()}, streamInterceptors...)
+		unaryInterceptors = append([]grpc.UnaryServerInterceptor{s.streamLimiter.UnaryServerInterceptor()}, unaryInterceptors...)
+	}
+	streamInterceptors = append(streamInterceptors, s.options.streamInterceptors...)
+	unaryInterceptors = append(unaryInterceptors, s.options.unaryInterceptors...)
 
 	// Prepend gRPC Prometheus interceptors so they observe all RPCs
 	// including those rejected by auth.
@@ -184,14 +338,47 @@ func (s *Server) serveGRPC(ctx context.Context, metrics *metrics.PrincipalMetric
 
 	// Add TLS credentials unless running in plaintext mode (e.g., behind Istio)
 	if tlsConfig != nil {
-		grpcOpts = append(grpcOpts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+		creds := credentials.NewTLS(tlsConfig)
+		// Connections accepted over QUIC are already secured by QUIC
+		if s.options.quicPort != 0 {
+			creds = quictransport.NewServerCredentials(creds)
+		}
+		grpcOpts = append(grpcOpts, grpc.Creds(creds))
 	} else {
 		log().Warn("gRPC server running without TLS - ensure service mesh provides transport security")
 	}
 
-	if s.keepAliveMinimumInterval != 0 {
+	if s.keepAliveMinimumInterval != 0 || s.keepAlivePermitWithoutStream {
 		s.logGrpcEvent().Debugf("Agent ping to principal is enabled, agent should wait at least %s before sending next ping event to principal", s.keepAliveMinimumInterval)
-		grpcOpts = append(grpcOpts, grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{MinTime: s.keepAliveMinimumInterval}))
+		grpcOpts = append(grpcOpts, grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             s.keepAliveMinimumInterval,
+			PermitWithoutStream: s.keepAlivePermitWithoutStream,
+		}))
+	}
+
+	if s.keepAliveTime != 0 {
+		s.logGrpcEvent().Debugf("Principal ping to agent is enabled, principal will ping idle agent connections after %s", s.keepAliveTime)
+		grpcOpts = append(grpcOpts, grpc.KeepaliveParams(keepalive.ServerParameters{
+			Time:    s.keepAliveTime,
+			Timeout: s.keepAliveTimeout,
+		}))
+	}
+
+	if streams := s.advertisedMaxStreams(); streams > 0 {
+		grpcOpts = append(grpcOpts, grpc.MaxConcurrentStreams(streams))
+	}
+	if s.options.http2InitialWindowSize > 0 {
+		grpcOpts = append(grpcOpts, grpc.InitialWindowSize(s.options.http2InitialWindowSize))
+	}
+	if s.options.http2InitialConnWindowSize > 0 {
+		grpcOpts = append(grpcOpts, grpc.InitialConnWindowSize(s.options.http2InitialConnWindowSize))
+	}
+
+	if s.options.quicPort != 0 {
+		s.quicListener, err = s.listenQUIC(tlsConfig)
+		if err != nil {
+			return fmt.Errorf("could not start QUIC listener: %w", err)
+		}
 	}
 
 	// Instantiate server with given opts
@@ -215,32 +402,94 @@ func (s *Server) serveGRPC(ctx context.Context, metrics *metrics.PrincipalMetric
 		downgradingServer := &http.Server{
 			TLSConfig: tlsConfig,
 			Handler:   downgradingHandler,
+			// gRPC's HTTP/2 settings don't apply when the gRPC server is
+			// served through net/http.
+			HTTP2: s.http2Config(),
 		}
 		downgradingServer.Protocols = new(http.Protocols)
 		downgradingServer.Protocols.SetHTTP1(true)
 		downgradingServer.Protocols.SetHTTP2(true)
 		downgradingServer.Protocols.SetUnencryptedHTTP2(true)
 
-		go func() {
-			// Use plaintext HTTP if TLS is disabled (e.g., behind Istio)
-			if tlsConfig != nil {
-				err = downgradingServer.ServeTLS(s.listener.l, s.options.tlsCertPath, s.options.tlsKeyPath)
-			} else {
-				err = downgradingServer.Serve(s.listener.l)
-			}
-			errch <- err
-		}()
+		for _, l := range s.listeners() {
+			go func() {
+				var err error
+				// Use plaintext HTTP if TLS is disabled (e.g., behind Istio)
+				if tlsConfig != nil {
+					// The certificate is provided by tlsConfig
+					err = downgradingServer.ServeTLS(l.l, "", "")
+				} else {
+					err = downgradingServer.Serve(l.l)
+				}
+				errch <- err
+			}()
+		}
 	} else {
-		// The gRPC server lives in its own go routine
+		// The gRPC server lives in its own go routine for each listener
+		for _, l := range s.listeners() {
+			go func() {
+				errch <- s.grpcServer.Serve(l.l)
+			}()
+		}
+	}
+	// Agents connecting over QUIC speak gRPC directly, even if WebSocket is
+	// enabled
+	if s.quicListener != nil {
 		go func() {
-			err = s.grpcServer.Serve(s.listener.l)
-			errch <- err
+			errch <- s.grpcServer.Serve(s.quicListener)
 		}()
 	}
 
 	return nil
 }
 
+// plaintextCIDRs are the ranges considered internal to the cluster in
+// addition to loopback, private and link-local addresses. 100.64.0.0/10 is
+// the shared address space used as pod or service range by some
+// distributions.
+var plaintextCIDRs = []netip.Prefix{
+	netip.MustParsePrefix("100.64.0.0/10"),
+}
+
+// checkPlaintextAddress returns an error if host, which the plaintext gRPC
+// server is going to listen on, is reachable on an address that is neither
+// loopback nor internal to the cluster. For unspecified addresses, the
+// addresses of all interfaces as returned by ifaceAddrs are checked.
+func checkPlaintextAddress(ctx context.Context, host string, ifaceAddrs func() ([]net.Addr, error)) error {
+	var addrs []netip.Addr
+	host = strings.Trim(host, "[]")
+	if ip, err := netip.ParseAddr(host); host == "" || (err == nil && ip.IsUnspecified()) {
+		ias, err := ifaceAddrs()
+		if err != nil {
+			return fmt.Errorf("could not determine interface addresses: %w", err)
+		}
+		for _, ia := range ias {
+			if p, err := netip.ParsePrefix(ia.String()); err == nil {
+				addrs = append(addrs, p.Addr())
+			}
+		}
+	} else if err == nil {
+		addrs = append(addrs, ip)
+	} else {
+		ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		if err != nil {
+			return fmt.Errorf("could not resolve listener address %s: %w", host, err)
+		}
+		addrs = append(addrs, ips...)
+	}
+	for _, addr := range addrs {
+		addr = addr.Unmap()
+		if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() {
+			continue
+		}
+		if slices.ContainsFunc(plaintextCIDRs, func(p netip.Prefix) bool { return p.Contains(addr) }) {
+			continue
+		}
+		return fmt.Errorf("refusing to serve plaintext gRPC on public address %s, plaintext mode must be forced to allow this", addr)
+	}
+	return nil
+}
+
 func (l *Listener) Host() string {
 	return l.host
 }
@@ -253,22 +502,134 @@ func (l *Listener) Address() string {
 	return fmt.Sprintf("%s:%d", l.host, l.port)
 }
 
+// advertisedMaxStreams returns the limit of concurrent streams per connection
+// to announce to agents in the HTTP/2 settings, which makes them wait before
+// opening more streams. When streams beyond the limit are to be rejected, no
+// limit is announced, and the stream limiter rejects them instead.
+func (s *Server) advertisedMaxStreams() uint32 {
+	if s.streamLimiter != nil {
+		return 0
+	}
+	return s.options.http2MaxConcurrentStreams
+}
+
+// connLimitObserver records the connections and streams served by the
+// principal in its metrics
+type connLimitObserver struct {
+	metrics *metrics.PrincipalMetrics
+}
+
+func (o connLimitObserver) Open(connections int) {
+	o.metrics.OpenConnections.Set(float64(connections))
+}
+
+func (o connLimitObserver) Rejected(kind string) {
+	o.metrics.ConnectionsRejected.WithLabelValues(kind).Inc()
+}
+
+func (s *Server) connLimitObserver() connlimit.Observer {
+	if s.metrics == nil {
+		return nil
+	}
+	return connLimitObserver{metrics: s.metrics}
+}
+
+// http2Config returns the HTTP/2 settings of the server for use with
+// net/http, or nil if none have been configured.
+func (s *Server) http2Config() *http.HTTP2Config {
+	if s.advertisedMaxStreams() == 0 && s.options.http2InitialWindowSize == 0 && s.options.http2InitialConnWindowSize == 0 && s.keepAliveTime == 0 {
+		return nil
+	}
+	return &http.HTTP2Config{
+		MaxConcurrentStreams:          int(min(s.advertisedMaxStreams(), math.MaxInt32)),
+		MaxReceiveBufferPerStream:     int(s.options.http2InitialWindowSize),
+		MaxReceiveBufferPerConnection: int(s.options.http2InitialConnWindowSize),
+		SendPingTimeout:               s.keepAliveTime,
+		PingTimeout:                   s.keepAliveTimeout,
+	}
+}
+
 // registerGrpcServices registers all required gRPC services to the server s.
 // This method should be called after the server is configured, and has all
 // required configuration properties set.
 func (s *Server) registerGrpcServices(metrics *metrics.PrincipalMetrics) error {
-	authSrv, err := auth.NewServer(s.queues, s.namespace, s.authMethods, s.issuer,
+	authOpts := []auth.ServerOption{
 		auth.WithAgentRegistrationManager(s.agentRegistrationManager),
-		auth.WithOnAuthenticated(s.setAgentNamespace))
+		auth.WithOnAuthenticated(s.setAgentNamespace),
+		auth.WithRevocationStore(s.revocations),
+		auth.WithAuditLogger(s.options.auditLogger),
+	}
+	if s.options.accessTokenValidity > 0 {
+		authOpts = append(authOpts, auth.WithAccessTokenValidity(s.options.accessTokenValidity))
+	}
+	if s.options.refreshTokenValidity > 0 {
+		authOpts = append(authOpts, auth.WithRefreshTokenValidity(s.options.refreshTokenValidity))
+	}
+	if s.options.tokenScopes != nil {
+		authOpts = append(authOpts, auth.WithTokenScopes(s.options.tokenScopes))
+	}
+	if s.options.authRateLimit != nil {
+		authOpts = append(authOpts, auth.WithRateLimit(*s.options.authRateLimit))
+	}
+	if s.options.stormProtection != nil {
+		authOpts = append(authOpts, auth.WithStormProtection(*s.options.stormProtection))
+	}
+	if metrics != nil {
+		authOpts = append(authOpts, auth.WithMetrics(metrics))
+	}
+	var payloadKeys *event.PayloadKeyring
+	if s.options.payloadEncryption {
+		payloadKeys = event.NewPayloadKeyring()
+		authOpts = append(authOpts, auth.WithPayloadEncryption(payloadKeys, s.options.payloadPSK))
+	}
+	if s.options.approvalConfigMap != "" {
+		approvals := registration.NewApprovalStore(s.kubeClient.Clientset, s.namespace, s.options.approvalConfigMap)
+		authOpts = append(authOpts, auth.WithApprovalStore(approvals))
+	}
+	authSrv, err := auth.NewServer(s.queues, s.namespace, s.authMethods, s.issuer, authOpts...)
 	if err != nil {
 		return fmt.Errorf("could not create new auth server: %w", err)
 	}
 	authapi.RegisterAuthenticationServer(s.grpcServer, authSrv)
 	versionapi.RegisterVersionServer(s.grpcServer, version.NewServer(s.authenticate))
+	healthpb.RegisterHealthServer(s.grpcServer, s.healthSrv)
 
 	opts := []eventstream.ServerOption{}
 	opts = append(opts, eventstream.WithNotifyOnConnect(s.notifyOnConnect))
 	opts = append(opts, eventstream.WithLogger(s.options.grpcEventLogger))
+	opts = append(opts, eventstream.WithAuditLogger(s.options.auditLogger))
+	opts = append(opts, eventstream.WithBandwidthLimits(s.options.bandwidthLimits))
+	opts = append(opts, eventstream.WithSendTimeout(s.options.sendTimeout))
+	opts = append(opts, eventstream.WithChunkSize(s.options.chunkSize))
+	opts = append(opts, eventstream.WithBatchSize(s.options.batchSize))
+	opts = append(opts, eventstream.WithBatchWindow(s.options.batchWindow))
+	opts = append(opts, eventstream.WithDeltaEvents(s.options.deltaEvents))
+	opts = append(opts, eventstream.WithPayloadTransfer(s.options.payloadTransferThreshold))
+	opts = append(opts, eventstream.WithEventJournal(s.options.eventJournal))
+	if payloadKeys != nil {
+		opts = append(opts, eventstream.WithPayloadEncryption(payloadKeys))
+	}
+	opts = append(opts, eventstream.WithSendCheck(func(agentName string, ev *cloudevents.Event) error {
+		if err := event.Validate(ev); err != nil {
+			return err
+		}
+		if err := s.policies.Check(agentName, s.agentMode(agentName), policy.Receive, ev); err != nil {
+			return err
+		}
+		if err := s.checkOutboundIsolation(agentName, ev); err != nil {
+			return err
+		}
+		return s.options.payloadLimits.Check(ev)
+	}))
+	if s.options.heartbeatInterval > 0 && s.events != nil {
+		opts = append(opts, eventstream.WithHeartbeat(s.options.heartbeatInterval, func() *cloudevents.Event {
+			return s.events.HeartbeatEvent(event.Ping)
+		}))
+	}
+	if s.events != nil {
+		opts = append(opts, eventstream.WithDeltaResolution(s.events.DeltaRejectedEvent))
+	}
+	opts = append(opts, eventstream.WithAckHandler(s.processEventOutcome))
 	if s.ha != nil {
 		opts = append(opts, eventstream.WithAcceptCheck(func(agentName string) error {
 			return s.ha.Controller.OnAgentConnect(agentName)
@@ -282,10 +643,21 @@ func (s *Server) registerGrpcServices(metrics *metrics.PrincipalMetrics) error {
 	// Register TerminalStream gRPC service for web terminal sessions
 	terminalstreamapi.RegisterTerminalStreamServiceServer(s.grpcServer, s.terminalStreamServer)
 
+	// Agents may only renew their client certificates if a signer is set up
+	if s.options.agentCertSigner != nil {
+		certificateapi.RegisterCertificatesServer(s.grpcServer, certificate.NewServer(s.options.agentCertSigner, s.options.agentCertValidity))
+	}
+
 	// Register replication service when HA is enabled
 	if s.ha != nil && s.ha.ReplicationServer != nil {
 		replicationapi.RegisterReplicationServer(s.grpcServer, s.ha.ReplicationServer)
 	}
 
+	// Reflection is not in the list of unauthenticated endpoints, so clients
+	// need a valid token to use it
+	if s.options.enableReflection {
+		reflection.Register(s.grpcServer)
+	}
+
 	return nil
 }
@@ -17,7 +17,10 @@ package principal
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509/pkix"
 	"fmt"
+	"math/big"
+	"net"
 	"path"
 	"testing"
 	"time"
@@ -93,6 +96,76 @@ func Test_Listen(t *testing.T) {
 		assert.NotZero(t, s.listener.port)
 	})
 
+	t.Run("Plaintext on loopback address", func(t *testing.T) {
+		s, err := NewServer(context.TODO(), kube.NewKubernetesFakeClientWithApps(testNamespace), testNamespace,
+			WithInsecurePlaintext(),
+			WithListenerPort(0),
+			WithGeneratedTokenSigningKey(),
+			WithListenerAddress("127.0.0.1"),
+		)
+		require.NoError(t, err)
+		err = s.Listen(context.Background(), wait.Backoff{Duration: 100 * time.Millisecond, Steps: 2})
+		require.NoError(t, err)
+		defer s.listener.l.Close()
+	})
+
+	t.Run("Additional listeners with their own keypair", func(t *testing.T) {
+		listenerTempl := certTempl
+		listenerTempl.SerialNumber = big.NewInt(2)
+		listenerTempl.Subject = pkix.Name{CommonName: "listener"}
+		fakecerts.WriteSelfSignedCert(t, "rsa", path.Join(tempDir, "listener-cert"), listenerTempl)
+
+		s, err := NewServer(context.TODO(), kube.NewKubernetesFakeClientWithApps(testNamespace), testNamespace,
+			WithTLSKeyPairFromPath(path.Join(tempDir, "test-cert.crt"), path.Join(tempDir, "test-cert.key")),
+			WithListenerPort(0),
+			WithGeneratedTokenSigningKey(),
+			WithListenerAddress("127.0.0.1"),
+			WithAdditionalListener("127.0.0.1:0", "", ""),
+			WithAdditionalListener("127.0.0.1:0", path.Join(tempDir, "listener-cert.crt"), path.Join(tempDir, "listener-cert.key")),
+		)
+		require.NoError(t, err)
+		err = s.Listen(context.Background(), wait.Backoff{Duration: 100 * time.Millisecond, Steps: 2})
+		require.NoError(t, err)
+		listeners := s.listeners()
+		require.Len(t, listeners, 3)
+		for _, l := range listeners {
+			defer l.l.Close()
+			assert.NotZero(t, l.port)
+		}
+
+		// handshake returns the serial number of the certificate served on l
+		handshake := func(l *Listener) int64 {
+			go func() {
+				c, err := l.l.Accept()
+				if err != nil {
+					return
+				}
+				defer c.Close()
+				_ = tls.Server(c, s.currentTLSConfig()).Handshake()
+			}()
+			c, err := tls.Dial("tcp", l.Address(), &tls.Config{InsecureSkipVerify: true})
+			require.NoError(t, err)
+			defer c.Close()
+			return c.ConnectionState().PeerCertificates[0].SerialNumber.Int64()
+		}
+		assert.Equal(t, int64(1), handshake(listeners[0]))
+		assert.Equal(t, int64(1), handshake(listeners[1]))
+		assert.Equal(t, int64(2), handshake(listeners[2]))
+	})
+
+	t.Run("Additional listener with invalid address", func(t *testing.T) {
+		_, err := NewServer(context.TODO(), kube.NewKubernetesFakeClientWithApps(testNamespace), testNamespace,
+			WithGeneratedTokenSigningKey(),
+			WithAdditionalListener("127.0.0.1", "", ""),
+		)
+		assert.ErrorContains(t, err, "invalid listener address")
+		_, err = NewServer(context.TODO(), kube.NewKubernetesFakeClientWithApps(testNamespace), testNamespace,
+			WithGeneratedTokenSigningKey(),
+			WithAdditionalListener("[::1]:8443", "cert.crt", ""),
+		)
+		assert.ErrorContains(t, err, "both a certificate and a key")
+	})
+
 	t.Run("Listen on privileged port", func(t *testing.T) {
 		s, err := NewServer(context.TODO(), kube.NewKubernetesFakeClientWithApps(testNamespace), testNamespace,
 			WithTLSKeyPairFromPath(path.Join(tempDir, "test-cert.crt"), path.Join(tempDir, "test-cert.key")),
@@ -108,6 +181,51 @@ func Test_Listen(t *testing.T) {
 
 }
 
+func Test_checkPlaintextAddress(t *testing.T) {
+	ifaces := func(addrs ...string) func() ([]net.Addr, error) {
+		return func() ([]net.Addr, error) {
+			res := make([]net.Addr, 0, len(addrs))
+			for _, a := range addrs {
+				ip, ipnet, err := net.ParseCIDR(a)
+				require.NoError(t, err)
+				ipnet.IP = ip
+				res = append(res, ipnet)
+			}
+			return res, nil
+		}
+	}
+	podIfaces := ifaces("127.0.0.1/8", "::1/128", "10.244.1.17/24", "fe80::1/64")
+	publicIfaces := ifaces("127.0.0.1/8", "10.244.1.17/24", "203.0.113.5/24")
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		host    string
+		ifaces  func() ([]net.Addr, error)
+		wantErr bool
+	}{
+		{"Loopback", "127.0.0.1", publicIfaces, false},
+		{"IPv6 loopback", "[::1]", publicIfaces, false},
+		{"Pod address", "10.244.1.17", publicIfaces, false},
+		{"Shared address space", "100.64.3.4", publicIfaces, false},
+		{"Public address", "203.0.113.5", publicIfaces, true},
+		{"All interfaces of a pod", "", podIfaces, false},
+		{"All interfaces with a public address", "0.0.0.0", publicIfaces, true},
+		{"All IPv6 interfaces with a public address", "::", publicIfaces, true},
+		{"Localhost", "localhost", publicIfaces, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkPlaintextAddress(ctx, tt.host, tt.ifaces)
+			if tt.wantErr {
+				assert.ErrorContains(t, err, "refusing to serve plaintext")
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
 func grpcDialer(t *testing.T, s *Server) *grpc.ClientConn {
 	t.Helper()
 	tlsC := &tls.Config{InsecureSkipVerify: true}
@@ -190,3 +308,28 @@ func Test_Serve(t *testing.T) {
 	err = s.Shutdown()
 	assert.NoError(t, err)
 }
+
+func Test_http2Config(t *testing.T) {
+	t.Run("No HTTP/2 settings", func(t *testing.T) {
+		s := &Server{options: &ServerOptions{}}
+		assert.Nil(t, s.http2Config())
+	})
+	t.Run("HTTP/2 settings are passed on", func(t *testing.T) {
+		s := &Server{options: &ServerOptions{}}
+		require.NoError(t, WithHTTP2MaxConcurrentStreams(100)(s))
+		require.NoError(t, WithHTTP2InitialWindowSizes(1<<20, 1<<22)(s))
+		c := s.http2Config()
+		require.NotNil(t, c)
+		assert.Equal(t, 100, c.MaxConcurrentStreams)
+		assert.Equal(t, 1<<20, c.MaxReceiveBufferPerStream)
+		assert.Equal(t, 1<<22, c.MaxReceiveBufferPerConnection)
+	})
+	t.Run("Keepalive settings are passed on", func(t *testing.T) {
+		s := &Server{options: &ServerOptions{}}
+		require.NoError(t, WithKeepAlive(30*time.Second, 10*time.Second)(s))
+		c := s.http2Config()
+		require.NotNil(t, c)
+		assert.Equal(t, 30*time.Second, c.SendPingTimeout)
+		assert.Equal(t, 10*time.Second, c.PingTimeout)
+	})
+}
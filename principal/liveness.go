@@ -0,0 +1,84 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package principal
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// agentLivenessPath is the path the liveness of agents is published at
+const agentLivenessPath = "/agents"
+
+// AgentLiveness describes whether an agent is considered online, based on
+// when the principal last received an event from it.
+type AgentLiveness struct {
+	Name      string    `json:"name"`
+	Connected bool      `json:"connected"`
+	LastSeen  time.Time `json:"lastSeen"`
+	Online    bool      `json:"online"`
+}
+
+// livenessTimeout returns the duration after which an agent that has not sent
+// any event is considered offline. A return value of 0 means agents are
+// considered online for as long as their stream is open.
+func (s *Server) livenessTimeout() time.Duration {
+	if s.options.agentLivenessTimeout > 0 {
+		return s.options.agentLivenessTimeout
+	}
+	return 3 * s.options.heartbeatInterval
+}
+
+// AgentLiveness returns the liveness of every agent that has been connected
+// since the principal started, sorted by agent name.
+func (s *Server) AgentLiveness() []AgentLiveness {
+	if s.eventStreamSrv == nil {
+		return []AgentLiveness{}
+	}
+	timeout := s.livenessTimeout()
+	now := time.Now()
+	lastSeen := s.eventStreamSrv.LastSeen()
+	agents := make([]AgentLiveness, 0, len(lastSeen))
+	for name, seen := range lastSeen {
+		connected := s.eventStreamSrv.IsAgentConnected(name)
+		agents = append(agents, AgentLiveness{
+			Name:      name,
+			Connected: connected,
+			LastSeen:  seen,
+			Online:    connected && (timeout == 0 || now.Sub(seen) <= timeout),
+		})
+	}
+	sort.Slice(agents, func(i, j int) bool {
+		return agents[i].Name < agents[j].Name
+	})
+	return agents
+}
+
+// agentLivenessHandler publishes the liveness of all known agents as JSON
+func (s *Server) agentLivenessHandler(w http.ResponseWriter, r *http.Request) {
+	data, err := json.Marshal(s.AgentLiveness())
+	if err != nil {
+		log().Errorf("Could not marshal agent liveness: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(data); err != nil {
+		log().Errorf("Could not write agent liveness to client: %v", err)
+	}
+}
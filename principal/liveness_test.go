@@ -0,0 +1,94 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package principal
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	eventstreamMock "github.com/argoproj-labs/argocd-agent/principal/apis/eventstream/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_AgentLiveness(t *testing.T) {
+	s := newResourceTestServer(t)
+	s.options.heartbeatInterval = time.Minute
+
+	assert.Empty(t, s.AgentLiveness())
+
+	gate := make(chan struct{})
+	done := make(chan struct{})
+	received := false
+	st := &eventstreamMock.MockEventServer{AgentName: "agent"}
+	st.AddRecvHook(func(_ *eventstreamMock.MockEventServer) error {
+		if !received {
+			received = true
+			return nil
+		}
+		<-gate
+		return io.EOF
+	})
+	go func() {
+		_ = s.eventStreamSrv.Subscribe(st)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool {
+		return len(s.AgentLiveness()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	t.Run("Connected agent is online", func(t *testing.T) {
+		agents := s.AgentLiveness()
+		assert.Equal(t, "agent", agents[0].Name)
+		assert.True(t, agents[0].Connected)
+		assert.True(t, agents[0].Online)
+	})
+
+	t.Run("Agent is offline after liveness timeout", func(t *testing.T) {
+		s.options.agentLivenessTimeout = time.Nanosecond
+		defer func() { s.options.agentLivenessTimeout = 0 }()
+		time.Sleep(time.Millisecond)
+		agents := s.AgentLiveness()
+		assert.True(t, agents[0].Connected)
+		assert.False(t, agents[0].Online)
+	})
+
+	t.Run("Handler publishes liveness as JSON", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		s.agentLivenessHandler(rec, httptest.NewRequest(http.MethodGet, agentLivenessPath, nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+		var agents []AgentLiveness
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &agents))
+		require.Len(t, agents, 1)
+		assert.Equal(t, "agent", agents[0].Name)
+		assert.True(t, agents[0].Online)
+	})
+
+	close(gate)
+	<-done
+
+	t.Run("Disconnected agent is offline", func(t *testing.T) {
+		agents := s.AgentLiveness()
+		require.Len(t, agents, 1)
+		assert.False(t, agents[0].Connected)
+		assert.False(t, agents[0].Online)
+	})
+}
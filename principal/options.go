@@ -15,6 +15,7 @@
 package principal
 
 import (
+	"bytes"
 	"context"
 	"crypto"
 	"crypto/rand"
@@ -29,18 +30,60 @@ import (
 	"net"
 	"os"
 	"regexp"
+	"strconv"
 	"time"
 
+	"github.com/argoproj-labs/argocd-agent/internal/argocd/settings"
+	"github.com/argoproj-labs/argocd-agent/internal/audit"
 	"github.com/argoproj-labs/argocd-agent/internal/auth"
+	"github.com/argoproj-labs/argocd-agent/internal/auth/oidc"
+	"github.com/argoproj-labs/argocd-agent/internal/connlimit"
+	"github.com/argoproj-labs/argocd-agent/internal/envelope"
+	"github.com/argoproj-labs/argocd-agent/internal/event"
+	"github.com/argoproj-labs/argocd-agent/internal/event/targets"
 	"github.com/argoproj-labs/argocd-agent/internal/grpcutil"
+	"github.com/argoproj-labs/argocd-agent/internal/ipfilter"
 	"github.com/argoproj-labs/argocd-agent/internal/logging"
+	"github.com/argoproj-labs/argocd-agent/internal/manager/repository"
+	"github.com/argoproj-labs/argocd-agent/internal/queue"
 	"github.com/argoproj-labs/argocd-agent/internal/tlsutil"
 	"github.com/argoproj-labs/argocd-agent/pkg/ha"
+	"github.com/argoproj-labs/argocd-agent/principal/admission"
+	authserver "github.com/argoproj-labs/argocd-agent/principal/apis/auth"
+	"github.com/argoproj-labs/argocd-agent/principal/apis/certificate"
+	"github.com/argoproj-labs/argocd-agent/principal/apis/eventstream"
+	"github.com/argoproj-labs/argocd-agent/principal/journal"
+	"github.com/argoproj/argo-cd/v3/common"
 	cacheutil "github.com/argoproj/argo-cd/v3/util/cache"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/acme/autocert"
+	"google.golang.org/grpc"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
 )
 
+// listenerSpec describes a listener the server binds in addition to its main
+// listener. If certPath and keyPath are set, the keypair loaded from these
+// files is served on the listener instead of the server's keypair.
+type listenerSpec struct {
+	address  string
+	port     int
+	certPath string
+	keyPath  string
+}
+
+// sniKeyPair is an additional TLS keypair that is either loaded from files,
+// or has been loaded from a Secret
+type sniKeyPair struct {
+	certPath string
+	keyPath  string
+
+	cert      tls.Certificate
+	kube      kubernetes.Interface
+	namespace string
+	name      string
+}
+
 type ServerOptions struct {
 	serverName    string
 	port          int
@@ -48,13 +91,21 @@ type ServerOptions struct {
 	tlsCertPath   string
 	tlsKeyPath    string
 	tlsCert       *x509.Certificate
-	tlsKey        crypto.PrivateKey
+	tlsKey        crypto.Signer
 	tlsCiphers    []uint16
 	tlsMinVersion uint16
 	tlsMaxVersion uint16
 	gracePeriod   time.Duration
 	namespaces    []string
 	signingKey    crypto.PrivateKey
+	// verificationKeys are previous signing keys, which are still accepted
+	// for validating tokens.
+	verificationKeys []crypto.PublicKey
+	// signingKeyGenerated is set when the signing key was generated at
+	// startup instead of being loaded from persistent storage.
+	signingKeyGenerated bool
+	// strictKeyPolicy makes NewServer fail when the signing key is volatile
+	strictKeyPolicy bool
 	// unauthMethods is not currently implemented
 	unauthMethods map[string]bool
 	serveGRPC     bool
@@ -75,9 +126,143 @@ type ServerOptions struct {
 	informerSyncTimeout    time.Duration
 	maxGRPCMessageSize     int
 
+	// unaryInterceptors and streamInterceptors are run for every gRPC call
+	// after the built-in interceptors
+	unaryInterceptors  []grpc.UnaryServerInterceptor
+	streamInterceptors []grpc.StreamServerInterceptor
+
+	// enableReflection registers the gRPC server reflection service
+	enableReflection bool
+
+	// unaryTimeout is the deadline of unary gRPC calls, and sendTimeout is
+	// how long sending a single event to an agent may take. A value of 0
+	// disables the respective timeout.
+	unaryTimeout time.Duration
+	sendTimeout  time.Duration
+
+	// chunkSize is the size of the chunks large events are sent to agents in
+	chunkSize int
+
+	// batchSize is the maximum number of events sent to an agent in a single
+	// message
+	batchSize int
+
+	// batchWindow is how long updates to an Application are held back to
+	// coalesce successive updates into one event
+	batchWindow time.Duration
+
+	// deltaEvents is whether Application events are sent to agents as
+	// deltas, if the agent can resolve them
+	deltaEvents bool
+
+	// payloadTransferThreshold is the size in bytes above which the payload
+	// of events is transferred to agents out of band. 0 disables the transfer.
+	payloadTransferThreshold int
+
+	// payloadEncryption is whether the payload of events is encrypted with
+	// a key negotiated with each agent, using the optional pre-shared
+	// payloadPSK
+	payloadEncryption bool
+	payloadPSK        []byte
+
+	// repoExcludedFields are the data fields stripped from repository
+	// secrets before they are sent to agents
+	repoExcludedFields []string
+	// repoCipher encrypts the credentials in repository secrets sent to
+	// agents. If nil, they are sent as they are.
+	repoCipher *repository.FieldCipher
+
+	// appFilter strips fields from Applications before they are sent to
+	// agents. If nil, Applications are sent as they are.
+	appFilter *event.ApplicationFilter
+
+	// argoCDConfigKeys selects the keys of the Argo CD configuration
+	// ConfigMaps that are pushed to managed agents. If nil, none are.
+	argoCDConfigKeys *settings.KeySelector
+
+	// queueStorageDir is the directory queued events are persisted in. If
+	// empty, queued events are only kept in memory.
+	queueStorageDir string
+	// queueBackend is where the queues of events to send to each agent are
+	// kept, either QueueBackendMemory or QueueBackendRedis
+	queueBackend string
+	// orphanedAppPolicy is what happens to the applications of agents whose
+	// cluster mapping was removed, once orphanedAppGracePeriod passed
+	orphanedAppPolicy      string
+	orphanedAppGracePeriod time.Duration
+	// appDeletionPolicies sets the resources finalizer of the Applications
+	// sent to each managed agent. If nil, finalizers are sent unchanged.
+	appDeletionPolicies *appDeletionPolicies
+	// queueLimits configures the size and overflow policy of the queues of
+	// events to send to each agent
+	queueLimits *queue.Limits
+	// queueTTLs configures the time-to-live of the events in the queues of
+	// events to send to each agent
+	queueTTLs *queue.TTLs
+	// coalesceUpdates makes queued updates of a resource be replaced by
+	// later updates of the same resource
+	coalesceUpdates bool
+	// queueAdminPort is the localhost port the QueueAdmin gRPC service is
+	// served on. A value of 0 disables the service.
+	queueAdminPort int
+	// eventJournal records the last events exchanged with each agent. If
+	// nil, events are not recorded.
+	eventJournal *journal.Journal
+
+	// heartbeatInterval is the interval at which agents are pinged over the
+	// event stream. A value of 0 disables pings.
+	heartbeatInterval time.Duration
+	// agentLivenessTimeout is the time after which an agent that has not sent
+	// any event is considered offline.
+	agentLivenessTimeout time.Duration
+
+	// stateDigestInterval is the interval at which a digest of the resources
+	// of each connected autonomous agent is sent to it. A value of 0 disables
+	// the digest.
+	stateDigestInterval time.Duration
+
 	// insecurePlaintext disables TLS on the gRPC server. Use when Istio sidecar
 	// handles mTLS termination.
 	insecurePlaintext bool
+	// insecurePlaintextForce allows plaintext mode on addresses that are
+	// not loopback or private addresses
+	insecurePlaintextForce bool
+
+	// tlsSecretKube, tlsSecretNamespace and tlsSecretName refer to the
+	// Secret the TLS keypair was loaded from, so it can be watched for changes
+	tlsSecretKube      kubernetes.Interface
+	tlsSecretNamespace string
+	tlsSecretName      string
+
+	// sniKeyPairs are additional TLS keypairs, which are served to clients
+	// requesting one of their names via SNI
+	sniKeyPairs []sniKeyPair
+	// additionalListeners are listeners bound in addition to the main one
+	additionalListeners []listenerSpec
+	// quicPort is the UDP port of the experimental QUIC listener, which is
+	// disabled if 0
+	quicPort int
+
+	// clientCAPath is the path to a dedicated CA bundle for verifying
+	// client certificates of agents, and clientCA the pool loaded from it
+	clientCAPath string
+	clientCA     *x509.CertPool
+
+	// rootCaCerts are the certificates in rootCa, which are kept because a
+	// pool does not expose them, so that their expiry can be monitored
+	rootCaCerts []*x509.Certificate
+
+	// caCertPEM is the CA certificate published on the healthz server for
+	// agents to bootstrap their trust from
+	caCertPEM []byte
+
+	// revocationChecker checks client certificates of agents for
+	// revocation during the TLS handshake
+	revocationChecker *tlsutil.RevocationChecker
+
+	// acmeManager obtains the server's TLS certificates from an ACME server.
+	// If nil, ACME is not used.
+	acmeManager *autocert.Manager
 
 	// redisProxyLogger, resourceProxyLogger, and grpcEventLogger are loggers for various subsystems
 	redisProxyLogger    *logging.CentralizedLogger
@@ -93,9 +278,16 @@ type ServerOptions struct {
 	// will be listed, watched, and processed by the principal.
 	labelSelector string
 
+	// syncLabelSelector restricts the Applications propagated to managed
+	// agents that have no selector of their own
+	syncLabelSelector labels.Selector
+
 	selfAgentRegistrationEnabled bool
 	resourceProxyAddress         string
 	clientCertSecretName         string
+	// selfRegistrationAllowedLabels are the glob patterns of the label keys
+	// agents may request on their self-registered cluster secrets
+	selfRegistrationAllowedLabels []string
 	// Redis TLS configuration
 	redisTLSEnabled             bool
 	redisProxyServerTLSCert     *x509.Certificate
@@ -108,6 +300,101 @@ type ServerOptions struct {
 
 	// haOptions contains HA configuration options
 	haOptions []ha.Option
+
+	// oidcConfig holds the configuration of the oidc auth method. If nil,
+	// the oidc auth method will not be registered.
+	oidcConfig *oidc.Config
+
+	// bootstrapEnabled enables onboarding of agents using bootstrap tokens
+	bootstrapEnabled bool
+	// pskSecretPrefix is the prefix of Secrets holding the agents'
+	// pre-shared keys created during onboarding
+	pskSecretPrefix string
+
+	// revocationConfigMap is the name of the ConfigMap holding the list of
+	// revoked tokens. If empty, token revocation is not watched.
+	revocationConfigMap string
+
+	// policyConfigMap is the name of the ConfigMap holding the agent policies
+	policyConfigMap string
+
+	// approvalConfigMap is the name of the ConfigMap recording the
+	// registration state of agents. If empty, agents need no approval.
+	approvalConfigMap string
+
+	// ipFilterRules filters incoming connections by source address. Nil
+	// accepts connections from all addresses.
+	ipFilterRules *ipfilter.Rules
+	// ipFilterConfigMap is the name of the ConfigMap the IP filter rules are
+	// reloaded from
+	ipFilterConfigMap string
+
+	// proxyProtocol enables reading PROXY protocol headers from connections
+	// from the trusted ranges in proxyProtocolTrusted
+	proxyProtocol        bool
+	proxyProtocolTrusted *ipfilter.Rules
+
+	// agentStoreSecret is the name of the Secret persisting the known agents.
+	// If empty, agents are only kept in memory.
+	agentStoreSecret string
+	// agentStoreKeyWrapper encrypts the agent store. Nil stores plain text.
+	agentStoreKeyWrapper envelope.KeyWrapper
+
+	// accessTokenValidity and refreshTokenValidity are the lifetimes of the
+	// tokens issued to agents. Zero values use the auth server's defaults.
+	accessTokenValidity  time.Duration
+	refreshTokenValidity time.Duration
+	// tokenScopes are the capability scopes granted to agents. Nil uses the
+	// auth server's defaults.
+	tokenScopes []string
+
+	// authRateLimit configures rate limiting of authentication attempts
+	authRateLimit *authserver.RateLimitConfig
+
+	// stormProtection limits the rate of authentication attempts after
+	// startup. Nil disables storm protection.
+	stormProtection *authserver.StormProtectionConfig
+
+	// auditLogger records security relevant events. Nil disables auditing.
+	auditLogger *audit.Logger
+
+	// payloadLimits limits the size of event payloads. Nil means no limits.
+	payloadLimits *event.PayloadLimits
+
+	// bandwidthLimits limits the bytes per second sent to each agent. Nil
+	// means no limits.
+	bandwidthLimits *eventstream.BandwidthLimits
+
+	// appAdmission validates Applications received from autonomous agents.
+	// Nil admits all Applications.
+	appAdmission *admission.Controller
+
+	// agentCertSigner issues client certificates to agents. Nil disables the
+	// Certificates service.
+	agentCertSigner   certificate.Signer
+	agentCertValidity time.Duration
+
+	// http2MaxConcurrentStreams limits the streams per agent connection, and
+	// the window sizes control HTTP/2 flow control. Zero values keep the
+	// defaults.
+	http2MaxConcurrentStreams  uint32
+	http2InitialWindowSize     int32
+	http2InitialConnWindowSize int32
+	// maxConnections limits the number of open agent connections across
+	// all listeners. Zero means no limit.
+	maxConnections int
+	// limitPolicy decides what happens to connections and streams beyond
+	// their limits
+	limitPolicy connlimit.Policy
+	// alpnProtocols are the protocols offered via ALPN, in order of
+	// preference. Nil keeps the defaults.
+	alpnProtocols []string
+	// compression controls how messages sent to agents on streams are
+	// compressed, see grpcutil.ParseCompression.
+	compression string
+	// customEventHandlers process the custom events received from agents,
+	// by their target
+	customEventHandlers map[targets.EventTarget]CustomEventHandler
 }
 
 type ServerOption func(o *Server) error
@@ -123,10 +410,24 @@ func defaultOptions() *ServerOptions {
 		rootCa:               x509.NewCertPool(),
 		informerSyncTimeout:  60 * time.Second,
 		maxGRPCMessageSize:   grpcutil.DefaultGRPCMaxMessageSize,
+		limitPolicy:          connlimit.PolicyQueue,
 		resourceProxyAddress: "argocd-agent-resource-proxy:9090",
+		unaryTimeout:         DefaultUnaryTimeout,
+		sendTimeout:          DefaultSendTimeout,
+		coalesceUpdates:      true,
+		queueBackend:         QueueBackendMemory,
+		orphanedAppPolicy:    OrphanedAppPolicyNone,
 	}
 }
 
+const (
+	// DefaultUnaryTimeout is the default deadline of unary gRPC calls
+	DefaultUnaryTimeout = 30 * time.Second
+	// DefaultSendTimeout is the default time sending an event to an agent
+	// may take
+	DefaultSendTimeout = time.Minute
+)
+
 // WithEventProcessors sets the maximum number of event processors to run
 // concurrently.
 func WithEventProcessors(numProcessors int64) ServerOption {
@@ -139,8 +440,8 @@ func WithEventProcessors(numProcessors int64) ServerOption {
 	}
 }
 
-// WithTokenSigningKey sets the RSA private key to use for signing the tokens
-// issued by the Server
+// WithTokenSigningKey sets the private key to use for signing the tokens
+// issued by the Server. RSA, ECDSA and Ed25519 keys are supported.
 func WithTokenSigningKey(key crypto.PrivateKey) ServerOption {
 	return func(o *Server) error {
 		o.options.signingKey = key
@@ -148,6 +449,19 @@ func WithTokenSigningKey(key crypto.PrivateKey) ServerOption {
 	}
 }
 
+// WithTokenSigner sets an external signer to use for signing the tokens
+// issued by the Server, instead of a private key held in memory. The signer
+// may use an RSA, ECDSA or Ed25519 key.
+func WithTokenSigner(signer crypto.Signer) ServerOption {
+	return func(o *Server) error {
+		if signer == nil {
+			return fmt.Errorf("token signer must not be nil")
+		}
+		o.options.signingKey = signer
+		return nil
+	}
+}
+
 // WithGeneratedTokenSigningKey generates a temporary JWT signing key. Note
 // that this option should only be used for testing.
 //
@@ -160,12 +474,24 @@ func WithGeneratedTokenSigningKey() ServerOption {
 			return fmt.Errorf("could not generate signing key: %w", err)
 		}
 		o.options.signingKey = key
+		o.options.signingKeyGenerated = true
+		return nil
+	}
+}
+
+// WithStrictKeyPolicy makes NewServer fail if the token signing key would be
+// generated at startup instead of being loaded. Tokens signed with a volatile
+// key become invalid on restart and are not accepted by other replicas.
+func WithStrictKeyPolicy(enabled bool) ServerOption {
+	return func(o *Server) error {
+		o.options.strictKeyPolicy = enabled
 		return nil
 	}
 }
 
-// WithTokenSigningKey sets the RSA private key to use for signing the tokens
-// issued by the Server
+// WithTokenSigningKeyFromFile sets the private key to use for signing the
+// tokens issued by the Server. The key is loaded from the PKCS#8 PEM file at
+// path, and may be an RSA, ECDSA or Ed25519 key.
 func WithTokenSigningKeyFromFile(path string) ServerOption {
 	return func(o *Server) error {
 		f, err := os.Open(path)
@@ -182,14 +508,14 @@ func WithTokenSigningKeyFromFile(path string) ServerOption {
 		}
 		key, err := x509.ParsePKCS8PrivateKey(pemBlock.Bytes)
 		if err != nil {
-			return fmt.Errorf("could not parse RSA key: %w", err)
+			return fmt.Errorf("could not parse signing key: %w", err)
 		}
 		o.options.signingKey = key
 		return nil
 	}
 }
 
-// WithTokenSigningKeyFromSecret sets the RSA private key to use for signing the tokens
+// WithTokenSigningKeyFromSecret sets the private key to use for signing the tokens
 // issued by the Server. The key will be loaded from the secret referred to by name and namespace.
 // The secret should contain a JWT signing key in the "jwt.key" field.
 func WithTokenSigningKeyFromSecret(kube kubernetes.Interface, namespace, name string) ServerOption {
@@ -199,6 +525,30 @@ func WithTokenSigningKeyFromSecret(kube kubernetes.Interface, namespace, name st
 			return err
 		}
 		o.options.signingKey = key
+		prevKeys, err := tlsutil.JWTVerificationKeysFromSecret(context.Background(), kube, namespace, name)
+		if err != nil {
+			return err
+		}
+		o.options.verificationKeys = append(o.options.verificationKeys, prevKeys...)
+		return nil
+	}
+}
+
+// WithTokenVerificationKeysFromFile loads previous token signing keys from
+// the PEM encoded file at path. Tokens signed with any of these keys will
+// still be accepted, which allows rotating the signing key without
+// invalidating the sessions of all agents at once.
+func WithTokenVerificationKeysFromFile(path string) ServerOption {
+	return func(o *Server) error {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		keys, err := tlsutil.ParsePublicKeysFromPEM(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		o.options.verificationKeys = append(o.options.verificationKeys, keys...)
 		return nil
 	}
 }
@@ -223,6 +573,48 @@ func WithListenerAddress(host string) ServerOption {
 	}
 }
 
+// WithAdditionalListener makes the server listen on address, given as
+// host:port, in addition to the address and port of its main listener. This
+// allows serving agents on IPv4 and IPv6, or on internal and external
+// interfaces, at the same time. If certPath and keyPath are not empty, the
+// keypair loaded from these files is served on this listener instead of the
+// server's keypair. The files are watched for changes.
+func WithAdditionalListener(address, certPath, keyPath string) ServerOption {
+	return func(o *Server) error {
+		host, portStr, err := net.SplitHostPort(address)
+		if err != nil {
+			return fmt.Errorf("invalid listener address %s: %w", address, err)
+		}
+		port, err := strconv.ParseUint(portStr, 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid port in listener address %s", address)
+		}
+		if (certPath == "") != (keyPath == "") {
+			return fmt.Errorf("listener %s needs both a certificate and a key", address)
+		}
+		o.options.additionalListeners = append(o.options.additionalListeners, listenerSpec{
+			address:  host,
+			port:     int(port),
+			certPath: certPath,
+			keyPath:  keyPath,
+		})
+		return nil
+	}
+}
+
+// WithQUICListener makes the server accept agents connecting over QUIC on the
+// given UDP port, on the address of its main listener. This transport is
+// experimental. A port of 0 disables the QUIC listener.
+func WithQUICListener(port int) ServerOption {
+	return func(o *Server) error {
+		if port < 0 || port > 65535 {
+			return fmt.Errorf("QUIC port must be between 0 and 65535")
+		}
+		o.options.quicPort = port
+		return nil
+	}
+}
+
 // WithClientCertSubjectMatch sets whether the subject of a client certificate
 // presented by the agent must match the agent's name. Has no effect if client
 // certificates are not required.
@@ -245,6 +637,7 @@ func WithTLSRootCaFromFile(caPath string) ServerOption {
 		if !ok {
 			return fmt.Errorf("invalid certificate data in %s", caPath)
 		}
+		o.options.rootCaCerts = append(o.options.rootCaCerts, tlsutil.X509CertsFromPEM(pem)...)
 		return nil
 	}
 }
@@ -256,11 +649,104 @@ func WithTLSRootCaFromFile(caPath string) ServerOption {
 // Secret.
 func WithTLSRootCaFromSecret(kube kubernetes.Interface, namespace, name string, fields ...string) ServerOption {
 	return func(o *Server) error {
-		pool, err := tlsutil.X509CertPoolFromSecret(context.Background(), kube, namespace, name, fields...)
+		certs, err := tlsutil.X509CertsFromSecret(context.Background(), kube, namespace, name, fields...)
 		if err != nil {
 			return err
 		}
+		pool := x509.NewCertPool()
+		for _, cert := range certs {
+			pool.AddCert(cert)
+		}
 		o.options.rootCa = pool
+		o.options.rootCaCerts = certs
+		return nil
+	}
+}
+
+// WithSNIKeyPairFromPath adds a TLS keypair loaded from certPath and keyPath
+// to the server, which is served to clients requesting one of the names in
+// the certificate via SNI. Other clients are served the default keypair. The
+// files are watched for changes.
+func WithSNIKeyPairFromPath(certPath, keyPath string) ServerOption {
+	return func(o *Server) error {
+		o.options.sniKeyPairs = append(o.options.sniKeyPairs, sniKeyPair{certPath: certPath, keyPath: keyPath})
+		return nil
+	}
+}
+
+// WithSNIKeyPairFromSecret adds a TLS keypair loaded from the secret referred
+// to by name and namespace to the server, which is served to clients
+// requesting one of the names in the certificate via SNI. Other clients are
+// served the default keypair. Changes to the secret will be picked up by the
+// running server.
+func WithSNIKeyPairFromSecret(kube kubernetes.Interface, namespace, name string) ServerOption {
+	return func(o *Server) error {
+		c, err := tlsutil.TLSCertFromSecret(context.Background(), kube, namespace, name)
+		if err != nil {
+			return err
+		}
+		o.options.sniKeyPairs = append(o.options.sniKeyPairs, sniKeyPair{cert: c, kube: kube, namespace: namespace, name: name})
+		return nil
+	}
+}
+
+// WithACME configures the server to obtain and renew its TLS certificates
+// from an ACME server, such as Let's Encrypt, instead of using a configured
+// keypair. The account key and certificates are stored in the Secret given
+// in config.
+func WithACME(kube kubernetes.Interface, config tlsutil.ACMEConfig) ServerOption {
+	return func(o *Server) error {
+		m, err := tlsutil.NewACMEManager(kube, config)
+		if err != nil {
+			return err
+		}
+		o.options.acmeManager = m
+		return nil
+	}
+}
+
+// WithClientCACert configures the server to verify client certificates of
+// agents against the CA bundle in the file at caPath, instead of the root
+// CAs. The file is watched for changes, and an updated bundle will be used
+// for new connections.
+func WithClientCACert(caPath string) ServerOption {
+	return func(o *Server) error {
+		pool, err := tlsutil.X509CertPoolFromFile(caPath)
+		if err != nil {
+			return fmt.Errorf("could not load client CA: %w", err)
+		}
+		o.options.clientCAPath = caPath
+		o.options.clientCA = pool
+		return nil
+	}
+}
+
+// WithClientCertRevocation configures the server to reject client
+// certificates of agents which have been revoked, according to the CRLs and
+// OCSP settings in config. The CRLs are loaded immediately and refreshed
+// periodically while the server is running. The checks only apply when
+// client certificates are required.
+func WithClientCertRevocation(config tlsutil.RevocationConfig) ServerOption {
+	return func(o *Server) error {
+		c, err := tlsutil.NewRevocationChecker(context.Background(), config)
+		if err != nil {
+			return fmt.Errorf("could not set up revocation checks: %w", err)
+		}
+		o.options.revocationChecker = c
+		return nil
+	}
+}
+
+// WithCACertEndpoint publishes the PEM encoded CA certificate caPEM on the
+// healthz server, from where agents can fetch it without authentication to
+// bootstrap their trust in the principal. As the endpoint is served without
+// TLS, it is only meant for development and proof of concept deployments.
+func WithCACertEndpoint(caPEM []byte) ServerOption {
+	return func(o *Server) error {
+		if len(caPEM) == 0 {
+			return fmt.Errorf("CA certificate must not be empty")
+		}
+		o.options.caCertPEM = caPEM
 		return nil
 	}
 }
@@ -275,8 +761,9 @@ func WithRequireClientCerts(require bool) ServerOption {
 }
 
 // WithTLSKeyPair configures the TLS certificate and private key to be used by
-// the server. The key must not be passphrase protected.
-func WithTLSKeyPair(cert *x509.Certificate, key *rsa.PrivateKey) ServerOption {
+// the server. The key may be an RSA, ECDSA or Ed25519 key, or any other
+// crypto.Signer such as a key held in a hardware security module.
+func WithTLSKeyPair(cert *x509.Certificate, key crypto.Signer) ServerOption {
 	return func(o *Server) error {
 		o.options.tlsCert = cert
 		o.options.tlsKey = key
@@ -287,7 +774,8 @@ func WithTLSKeyPair(cert *x509.Certificate, key *rsa.PrivateKey) ServerOption {
 // WithTLSKeyPairFromPath configures the TLS certificate and private key to be used by
 // the server. The function will not check whether the files exists, or if they
 // contain valid data because it is assumed that they may be created at a later
-// point in time.
+// point in time. Once loaded, the files are watched for changes and a renewed
+// keypair will be used for new connections.
 func WithTLSKeyPairFromPath(certPath, keyPath string) ServerOption {
 	return func(o *Server) error {
 		o.options.tlsCertPath = certPath
@@ -298,7 +786,8 @@ func WithTLSKeyPairFromPath(certPath, keyPath string) ServerOption {
 
 // WithTLSKeyPairFromSecret configures the TLS certificate and private key to
 // be used by the server. The keypair will be loaded from the secret referred
-// to by name and namespace. The secret must be of type tls.
+// to by name and namespace. The secret must be of type tls. Changes to the
+// secret will be picked up by the running server.
 func WithTLSKeyPairFromSecret(kube kubernetes.Interface, namespace, name string) ServerOption {
 	return func(o *Server) error {
 		c, err := tlsutil.TLSCertFromSecret(context.Background(), kube, namespace, name)
@@ -312,8 +801,15 @@ func WithTLSKeyPairFromSecret(kube kubernetes.Interface, namespace, name string)
 		if err != nil {
 			return fmt.Errorf("could not parse certificate: %w", err)
 		}
+		key, ok := c.PrivateKey.(crypto.Signer)
+		if !ok {
+			return fmt.Errorf("private key in secret %s/%s cannot be used for signing", namespace, name)
+		}
 		o.options.tlsCert = cert
-		o.options.tlsKey = c.PrivateKey
+		o.options.tlsKey = key
+		o.options.tlsSecretKube = kube
+		o.options.tlsSecretNamespace = namespace
+		o.options.tlsSecretName = name
 		return nil
 	}
 }
@@ -403,6 +899,46 @@ func WithShutDownGracePeriod(d time.Duration) ServerOption {
 	}
 }
 
+// WithHeartbeatInterval configures the principal to send a heartbeat ping to
+// each connected agent at the given interval. If d is 0, no heartbeats are
+// sent.
+func WithHeartbeatInterval(d time.Duration) ServerOption {
+	return func(o *Server) error {
+		if d < 0 {
+			return fmt.Errorf("heartbeat interval must not be negative")
+		}
+		o.options.heartbeatInterval = d
+		return nil
+	}
+}
+
+// WithStateDigestInterval configures the principal to send a digest of the
+// spec checksums of the resources of each connected autonomous agent to the
+// agent at the given interval. The agent answers with updates for the
+// resources that drifted only. If d is 0, no digests are sent.
+func WithStateDigestInterval(d time.Duration) ServerOption {
+	return func(o *Server) error {
+		if d < 0 {
+			return fmt.Errorf("state digest interval must not be negative")
+		}
+		o.options.stateDigestInterval = d
+		return nil
+	}
+}
+
+// WithAgentLivenessTimeout sets the duration after which an agent that has
+// not sent any event is reported as offline, even if its stream is still
+// open. If d is 0, three times the heartbeat interval is used.
+func WithAgentLivenessTimeout(d time.Duration) ServerOption {
+	return func(o *Server) error {
+		if d < 0 {
+			return fmt.Errorf("agent liveness timeout must not be negative")
+		}
+		o.options.agentLivenessTimeout = d
+		return nil
+	}
+}
+
 // WithNamespaces sets an
 func WithNamespaces(namespaces ...string) ServerOption {
 	return func(o *Server) error {
@@ -451,6 +987,173 @@ func WithAuthMethods(am *auth.Methods) ServerOption {
 	}
 }
 
+// WithOIDCAuthentication enables the oidc auth method, which authenticates
+// agents using JWTs issued by an external OIDC identity provider.
+func WithOIDCAuthentication(config oidc.Config) ServerOption {
+	return func(o *Server) error {
+		if config.IssuerURL == "" {
+			return fmt.Errorf("oidc issuer URL must not be empty")
+		}
+		if config.Audience == "" {
+			return fmt.Errorf("oidc audience must not be empty")
+		}
+		o.options.oidcConfig = &config
+		return nil
+	}
+}
+
+// WithBootstrapAuthentication enables onboarding of agents using one-time
+// bootstrap tokens. Onboarded agents receive a pre-shared key, which is
+// stored in a Secret named secretPrefix followed by the agent's name, and
+// must use the psk auth method afterwards.
+func WithBootstrapAuthentication(secretPrefix string) ServerOption {
+	return func(o *Server) error {
+		o.options.bootstrapEnabled = true
+		o.options.pskSecretPrefix = secretPrefix
+		return nil
+	}
+}
+
+// WithTokenRevocationConfigMap configures the name of the ConfigMap in the
+// principal's namespace that holds the list of revoked tokens.
+func WithTokenRevocationConfigMap(name string) ServerOption {
+	return func(o *Server) error {
+		o.options.revocationConfigMap = name
+		return nil
+	}
+}
+
+// WithAgentPolicyConfigMap configures the name of the ConfigMap in the
+// principal's namespace that holds the policies restricting which events
+// each agent may send and receive.
+func WithAgentPolicyConfigMap(name string) ServerOption {
+	return func(o *Server) error {
+		o.options.policyConfigMap = name
+		return nil
+	}
+}
+
+// WithAgentApprovalConfigMap requires new agents to be approved by an
+// operator before they may connect. The registration state of agents is
+// recorded in the ConfigMap of the given name in the principal's namespace.
+func WithAgentApprovalConfigMap(name string) ServerOption {
+	return func(o *Server) error {
+		o.options.approvalConfigMap = name
+		return nil
+	}
+}
+
+// WithIPFilter only accepts connections from addresses that are in one of
+// the allowed ranges, if any, and not in any of the denied ranges. Ranges are
+// CIDRs or single IP addresses.
+func WithIPFilter(allow, deny []string) ServerOption {
+	return func(o *Server) error {
+		rules, err := ipfilter.ParseRules(allow, deny)
+		if err != nil {
+			return err
+		}
+		o.options.ipFilterRules = rules
+		return nil
+	}
+}
+
+// WithIPFilterConfigMap configures the name of a ConfigMap in the principal's
+// namespace that, while it exists, replaces the rules set by WithIPFilter.
+func WithIPFilterConfigMap(name string) ServerOption {
+	return func(o *Server) error {
+		o.options.ipFilterConfigMap = name
+		return nil
+	}
+}
+
+// WithProxyProtocol configures the server to expect a PROXY protocol header
+// (version 1 or 2) on connections from load balancers in the trusted ranges,
+// and to use the source address from the header as the agent's address.
+// Ranges are CIDRs or single IP addresses. If no ranges are given, all
+// connections must start with a PROXY header.
+func WithProxyProtocol(trusted []string) ServerOption {
+	return func(o *Server) error {
+		rules, err := ipfilter.ParseRules(trusted, nil)
+		if err != nil {
+			return fmt.Errorf("invalid trusted PROXY protocol range: %w", err)
+		}
+		o.options.proxyProtocol = true
+		o.options.proxyProtocolTrusted = rules
+		return nil
+	}
+}
+
+// WithAgentStore persists the agents known to the principal in the Secret
+// of the given name in the principal's namespace, so that they survive a
+// restart. If wrapper is not nil, the stored agents are envelope encrypted.
+func WithAgentStore(secretName string, wrapper envelope.KeyWrapper) ServerOption {
+	return func(o *Server) error {
+		o.options.agentStoreSecret = secretName
+		o.options.agentStoreKeyWrapper = wrapper
+		return nil
+	}
+}
+
+// WithTokenValidity sets the lifetimes of the access and refresh tokens issued
+// to agents. A zero value keeps the respective default.
+func WithTokenValidity(access, refresh time.Duration) ServerOption {
+	return func(o *Server) error {
+		o.options.accessTokenValidity = access
+		o.options.refreshTokenValidity = refresh
+		return nil
+	}
+}
+
+// WithTokenScopes sets the capability scopes granted to agents in their
+// tokens, limiting the gRPC services agents may use.
+func WithTokenScopes(scopes []string) ServerOption {
+	return func(o *Server) error {
+		o.options.tokenScopes = scopes
+		return nil
+	}
+}
+
+// WithAuthRateLimit enables rate limiting and lockouts of authentication
+// attempts per source address and client ID.
+func WithAuthRateLimit(config authserver.RateLimitConfig) ServerOption {
+	return func(o *Server) error {
+		o.options.authRateLimit = &config
+		return nil
+	}
+}
+
+// WithConnectionStormProtection limits the rate at which agents may
+// authenticate during the given window after startup, so that agents which
+// all reconnect after a restart of the principal are admitted gradually.
+// Attempts over the limit are rejected and retried by the agents with backoff.
+func WithConnectionStormProtection(window time.Duration, rate float64) ServerOption {
+	return func(o *Server) error {
+		if window <= 0 || rate <= 0 {
+			return fmt.Errorf("connection storm protection window and rate must be positive")
+		}
+		o.options.stormProtection = &authserver.StormProtectionConfig{Window: window, Rate: rate}
+		return nil
+	}
+}
+
+// WithAuditLogger sets the logger used to record authentication attempts,
+// token issuance, agent connections and resource mutations in the audit log.
+func WithAuditLogger(l *audit.Logger) ServerOption {
+	return func(o *Server) error {
+		o.options.auditLogger = l
+		return nil
+	}
+}
+
+// WithAppAdmission sets the admission controller that validates Applications
+// received from autonomous agents before they are created or updated.
+func WithAppAdmission(c *admission.Controller) ServerOption {
+	return func(o *Server) error {
+		o.options.appAdmission = c
+		return nil
+	}
+}
+
 func WithAutoNamespaceCreate(enabled bool, pattern string, labels map[string]string) ServerOption {
 	return func(o *Server) error {
 		var err error
@@ -473,6 +1176,16 @@ func WithWebSocket(enableWebSocket bool) ServerOption {
 	}
 }
 
+// WithReflection registers the gRPC server reflection service, so that tools
+// like grpcurl can discover the principal's services. Reflection requests are
+// authenticated like any other request to the agent APIs.
+func WithReflection(enable bool) ServerOption {
+	return func(o *Server) error {
+		o.options.enableReflection = enable
+		return nil
+	}
+}
+
 // WithRedisProxyDisabled disables the Redis proxy for testing.
 func WithRedisProxyDisabled() ServerOption {
 	return func(o *Server) error {
@@ -510,6 +1223,419 @@ func WithKeepAliveMinimumInterval(interval time.Duration) ServerOption {
 	}
 }
 
+// WithKeepAlivePermitWithoutStream configures whether agents may send
+// keepalive pings while no stream is active on the connection. When false,
+// such pings count against the enforcement policy.
+func WithKeepAlivePermitWithoutStream(permit bool) ServerOption {
+	return func(o *Server) error {
+		o.keepAlivePermitWithoutStream = permit
+		return nil
+	}
+}
+
+// WithKeepAlive configures the principal to ping agent connections that have
+// been idle for the given interval, and to close the connection if the ping
+// is not acknowledged within timeout. This lets the principal detect agents
+// whose connection was silently dropped by a NAT gateway or load balancer.
+// An interval of 0 leaves server-side pings disabled.
+func WithKeepAlive(interval, timeout time.Duration) ServerOption {
+	return func(o *Server) error {
+		if interval < 0 {
+			return fmt.Errorf("keepalive interval must not be negative")
+		}
+		if timeout < 0 {
+			return fmt.Errorf("keepalive timeout must not be negative")
+		}
+		if timeout > 0 && interval == 0 {
+			return fmt.Errorf("keepalive timeout requires a keepalive interval")
+		}
+		o.keepAliveTime = interval
+		o.keepAliveTimeout = timeout
+		return nil
+	}
+}
+
+// WithRPCTimeouts sets the deadline of unary gRPC calls like Authenticate and
+// Version, and how long sending a single event on an agent's event stream may
+// take. An agent that does not read its stream within sendTimeout is
+// disconnected, so that it cannot hold resources of the principal forever. A
+// value of 0 disables the respective timeout.
+func WithRPCTimeouts(unaryTimeout, sendTimeout time.Duration) ServerOption {
+	return func(o *Server) error {
+		if unaryTimeout < 0 {
+			return fmt.Errorf("unary timeout must not be negative")
+		}
+		if sendTimeout < 0 {
+			return fmt.Errorf("send timeout must not be negative")
+		}
+		o.options.unaryTimeout = unaryTimeout
+		o.options.sendTimeout = sendTimeout
+		return nil
+	}
+}
+
+// WithEventChunkSize configures events larger than size bytes to be sent to
+// agents in chunks of that size, for agents behind middleboxes that limit the
+// size of HTTP/2 frames or messages. A size of 0 disables chunking. Agents
+// reassemble chunks regardless of their own configuration, as long as they
+// support chunking at all.
+func WithEventChunkSize(size int) ServerOption {
+	return func(o *Server) error {
+		if size < 0 || (size > 0 && size < event.MinChunkSize) {
+			return fmt.Errorf("event chunk size must be 0 or at least %d bytes", event.MinChunkSize)
+		}
+		o.options.chunkSize = size
+		return nil
+	}
+}
+
+// WithPayloadTransferThreshold configures the payload of events larger than
+// size bytes to be transferred to agents out of band, on a stream of its own,
+// so that bulk data does not hold up the events behind it. Only agents that
+// announce they can fetch such payloads are sent them out of band. A size of
+// 0 sends all payloads on the event stream.
+func WithPayloadTransferThreshold(size int) ServerOption {
+	return func(o *Server) error {
+		if size < 0 {
+			return fmt.Errorf("payload transfer threshold must not be negative")
+		}
+		o.options.payloadTransferThreshold = size
+		return nil
+	}
+}
+
+// WithEventBatchSize configures up to size events waiting to be sent to an
+// agent to be sent in a single message, which reduces the overhead of sending
+// a large backlog of events. A size of 1 disables batching. Agents must be
+// able to unpack batches.
+func WithEventBatchSize(size int) ServerOption {
+	return func(o *Server) error {
+		if size < 1 || size > event.MaxBatchSize {
+			return fmt.Errorf("event batch size must be between 1 and %d", event.MaxBatchSize)
+		}
+		o.options.batchSize = size
+		return nil
+	}
+}
+
+// WithEventBatchWindow configures the principal to hold back updates to a
+// resource for window after the first one, so that rapid successive updates,
+// e.g. during a sync storm, are sent to an agent as a single event. A window
+// of 0 disables it.
+func WithEventBatchWindow(window time.Duration) ServerOption {
+	return func(o *Server) error {
+		if window < 0 {
+			return fmt.Errorf("event batch window must not be negative")
+		}
+		o.options.batchWindow = window
+		return nil
+	}
+}
+
+// WithDeltaEvents configures the principal to send Application events to
+// agents as patches against the version the agent acknowledged last, instead
+// of the full object. The principal falls back to the full object for agents
+// that cannot resolve the patch.
+func WithDeltaEvents(enabled bool) ServerOption {
+	return func(o *Server) error {
+		o.options.deltaEvents = enabled
+		return nil
+	}
+}
+
+// WithPayloadEncryption requires agents to negotiate a key during
+// authentication, which the payload of the events exchanged with the agent is
+// encrypted with. Agents that do not support it are rejected.
+func WithPayloadEncryption(enabled bool) ServerOption {
+	return func(o *Server) error {
+		o.options.payloadEncryption = enabled
+		return nil
+	}
+}
+
+// WithRepositoryFieldFilter strips the given data fields from repository and
+// repo-creds secrets before they are sent to agents, e.g. credentials that
+// agents should not have. The url field cannot be stripped.
+func WithRepositoryFieldFilter(fields []string) ServerOption {
+	return func(o *Server) error {
+		if err := repository.ValidateFieldFilter(fields); err != nil {
+			return err
+		}
+		o.options.repoExcludedFields = fields
+		return nil
+	}
+}
+
+// WithRepositoryEncryptionKeyFile encrypts the credentials in repository and
+// repo-creds secrets sent to agents with a key derived from the contents of
+// the file at path. The agents must be configured with the same key.
+func WithRepositoryEncryptionKeyFile(path string) ServerOption {
+	return func(o *Server) error {
+		if path == "" {
+			return nil
+		}
+		c, err := repository.NewFieldCipherFromFile(path)
+		if err != nil {
+			return err
+		}
+		o.options.repoCipher = c
+		return nil
+	}
+}
+
+// WithApplicationFieldFilters strips the annotations, labels and info entries
+// of Applications selected by specs before they are sent to agents. Each spec
+// has the form <field>:<pattern>, see event.ParseApplicationFilter.
+func WithApplicationFieldFilters(specs []string) ServerOption {
+	return func(o *Server) error {
+		if len(specs) == 0 {
+			return nil
+		}
+		f, err := event.ParseApplicationFilter(specs)
+		if err != nil {
+			return err
+		}
+		o.options.appFilter = f
+		return nil
+	}
+}
+
+// WithArgoCDConfigKeys pushes the keys of the Argo CD configuration
+// ConfigMaps selected by specs to managed agents. Each spec has the form
+// <configmap>:<key>, where key may contain glob patterns.
+func WithArgoCDConfigKeys(specs []string) ServerOption {
+	return func(o *Server) error {
+		if len(specs) == 0 {
+			return nil
+		}
+		if o.options.argoCDConfigKeys == nil {
+			o.options.argoCDConfigKeys = settings.NewKeySelector()
+		}
+		return o.options.argoCDConfigKeys.Select(specs)
+	}
+}
+
+// WithArgoCDNotificationsSync pushes all keys of argocd-notifications-cm and
+// argocd-notifications-secret to managed agents, so that the notifications
+// controllers on the workload clusters send the same notifications as on the
+// principal. The keys of the Secret are encrypted with the repository
+// encryption key, if one is configured.
+func WithArgoCDNotificationsSync(enabled bool) ServerOption {
+	return func(o *Server) error {
+		if !enabled {
+			return nil
+		}
+		if o.options.argoCDConfigKeys == nil {
+			o.options.argoCDConfigKeys = settings.NewKeySelector()
+		}
+		return o.options.argoCDConfigKeys.Select([]string{
+			common.ArgoCDNotificationsConfigMapName + ":*",
+			common.ArgoCDNotificationsSecretName + ":*",
+		})
+	}
+}
+
+// WithArgoCDResourceFilterSync pushes the resource inclusions and exclusions
+// of argocd-cm to managed agents, so that Argo CD on the workload clusters
+// tracks the same resources as on the principal. The principal owns these
+// keys, i.e. they are removed on the agents if they are not set on the
+// principal.
+func WithArgoCDResourceFilterSync(enabled bool) ServerOption {
+	return func(o *Server) error {
+		if !enabled {
+			return nil
+		}
+		if o.options.argoCDConfigKeys == nil {
+			o.options.argoCDConfigKeys = settings.NewKeySelector()
+		}
+		o.options.argoCDConfigKeys.Own(common.ArgoCDConfigMapName, settings.ResourceFilterKeys...)
+		return nil
+	}
+}
+
+// WithPayloadEncryptionPSKFile mixes the pre-shared key read from path into
+// the keys negotiated for payload encryption, so that intermediaries that
+// replace the keys exchanged during authentication cannot derive them. The
+// agents must use the same pre-shared key.
+func WithPayloadEncryptionPSKFile(path string) ServerOption {
+	return func(o *Server) error {
+		if path == "" {
+			return nil
+		}
+		psk, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("could not read payload encryption pre-shared key: %w", err)
+		}
+		psk = bytes.TrimSpace(psk)
+		if len(psk) == 0 {
+			return fmt.Errorf("payload encryption pre-shared key in %s is empty", path)
+		}
+		o.options.payloadPSK = psk
+		return nil
+	}
+}
+
+// WithQueueStorageDir configures the principal to persist the events queued
+// for and received from agents in dir, so that events not yet sent to an
+// agent survive a restart of the principal.
+func WithQueueStorageDir(dir string) ServerOption {
+	return func(o *Server) error {
+		o.options.queueStorageDir = dir
+		return nil
+	}
+}
+
+const (
+	// QueueBackendMemory keeps the queues of events to send to each agent in
+	// the memory of the principal
+	QueueBackendMemory = "memory"
+	// QueueBackendRedis keeps the queues of events to send to each agent in
+	// Redis streams, which are shared by all replicas of the principal
+	QueueBackendRedis = "redis"
+)
+
+// WithQueueBackend configures where the queues of events to send to each agent
+// are kept. With QueueBackendRedis, the queues are kept in the principal's
+// Redis and are shared by all principal replicas, so that any replica can
+// serve any agent.
+func WithQueueBackend(backend string) ServerOption {
+	return func(o *Server) error {
+		switch backend {
+		case QueueBackendMemory, QueueBackendRedis:
+			o.options.queueBackend = backend
+			return nil
+		default:
+			return fmt.Errorf("invalid queue backend %q: must be one of %s, %s", backend, QueueBackendMemory, QueueBackendRedis)
+		}
+	}
+}
+
+const (
+	// OrphanedAppPolicyNone keeps the applications of agents whose cluster
+	// mapping was removed
+	OrphanedAppPolicyNone = "none"
+	// OrphanedAppPolicyLabel sets the orphaned label on the applications of
+	// agents whose cluster mapping was removed
+	OrphanedAppPolicyLabel = "label"
+	// OrphanedAppPolicyDelete deletes the applications of agents whose
+	// cluster mapping was removed
+	OrphanedAppPolicyDelete = "delete"
+)
+
+// WithOrphanedAppCleanup configures what happens to the applications in the
+// namespace of an agent whose cluster mapping was removed. Unless the agent is
+// mapped to a cluster again within gracePeriod, its applications are labeled
+// as orphaned or deleted, depending on policy.
+func WithOrphanedAppCleanup(policy string, gracePeriod time.Duration) ServerOption {
+	return func(o *Server) error {
+		switch policy {
+		case OrphanedAppPolicyNone, OrphanedAppPolicyLabel, OrphanedAppPolicyDelete:
+		default:
+			return fmt.Errorf("invalid orphaned application policy %q: must be one of %s, %s, %s", policy, OrphanedAppPolicyNone, OrphanedAppPolicyLabel, OrphanedAppPolicyDelete)
+		}
+		if gracePeriod < 0 {
+			return fmt.Errorf("orphaned application grace period must not be negative")
+		}
+		o.options.orphanedAppPolicy = policy
+		o.options.orphanedAppGracePeriod = gracePeriod
+		return nil
+	}
+}
+
+const (
+	// AppDeletionPolicyForeground makes Argo CD on the workload cluster
+	// delete the resources of an Application before the Application
+	AppDeletionPolicyForeground = "foreground"
+	// AppDeletionPolicyBackground makes Argo CD on the workload cluster
+	// delete the resources of an Application after the Application
+	AppDeletionPolicyBackground = "background"
+	// AppDeletionPolicyOrphan makes Argo CD on the workload cluster keep the
+	// resources of an Application when the Application is deleted
+	AppDeletionPolicyOrphan = "orphan"
+)
+
+// WithAppDeletionPolicies configures what happens to the resources of the
+// Applications of managed agents when the Applications are deleted. Each
+// policy has the form <agent>=<policy>, where agent is the name of an agent
+// or "default" for all agents without a policy of their own. The resources
+// finalizer of the Applications sent to an agent is set according to its
+// policy. Applications of agents without a policy are sent with the
+// finalizers they have on the principal.
+func WithAppDeletionPolicies(policies []string) ServerOption {
+	return func(o *Server) error {
+		if len(policies) == 0 {
+			o.options.appDeletionPolicies = nil
+			return nil
+		}
+		p, err := parseAppDeletionPolicies(policies)
+		if err != nil {
+			return err
+		}
+		o.options.appDeletionPolicies = p
+		return nil
+	}
+}
+
+// WithAgentQueueLimits configures the maximum number of events queued for
+// each agent, and what happens when an agent's queue is full.
+func WithAgentQueueLimits(limits *queue.Limits) ServerOption {
+	return func(o *Server) error {
+		o.options.queueLimits = limits
+		return nil
+	}
+}
+
+// WithAgentQueueTTLs configures the time-to-live of the events queued for
+// each agent by event type. Events that have been queued for longer than their
+// time-to-live are dropped instead of being sent.
+func WithAgentQueueTTLs(ttls *queue.TTLs) ServerOption {
+	return func(o *Server) error {
+		o.options.queueTTLs = ttls
+		return nil
+	}
+}
+
+// WithUpdateCoalescing configures whether a spec or status update queued for
+// an agent replaces an update of the same resource that is still queued, so
+// that agents returning from a long disconnect receive only the latest update
+// of each resource. Enabled by default.
+func WithUpdateCoalescing(enabled bool) ServerOption {
+	return func(o *Server) error {
+		o.options.coalesceUpdates = enabled
+		return nil
+	}
+}
+
+// WithQueueAdminPort serves the QueueAdmin gRPC service, which lets operators
+// inspect and purge the queues of agents, on the given port on localhost. A
+// port of 0 disables the service.
+func WithQueueAdminPort(port int) ServerOption {
+	return func(o *Server) error {
+		if port < 0 || port > 65535 {
+			return fmt.Errorf("invalid port: %d", port)
+		}
+		o.options.queueAdminPort = port
+		return nil
+	}
+}
+
+// WithEventJournalSize records the last size events exchanged with each agent,
+// along with their outcome, in a journal that can be read through the
+// QueueAdmin gRPC service. A size of 0 disables the journal.
+func WithEventJournalSize(size int) ServerOption {
+	return func(o *Server) error {
+		if size < 0 {
+			return fmt.Errorf("event journal size must not be negative")
+		}
+		if size > 0 {
+			o.options.eventJournal = journal.New(size)
+		} else {
+			o.options.eventJournal = nil
+		}
+		return nil
+	}
+}
+
 func WithRedis(redisAddress, redisPassword, redisCompressionTypeStr string) ServerOption {
 	return func(o *Server) error {
 		redisCompressionType, err := cacheutil.CompressionTypeFromString(redisCompressionTypeStr)
@@ -547,6 +1673,126 @@ func WithMaxGRPCMessageSize(size int) ServerOption {
 	}
 }
 
+// WithUnaryInterceptor adds interceptors to be run for every unary gRPC call.
+// They are run in the order given, after the principal's built-in logging,
+// authentication and message size interceptors, so the context passed to
+// them holds the identity of the authenticated agent.
+func WithUnaryInterceptor(interceptors ...grpc.UnaryServerInterceptor) ServerOption {
+	return func(o *Server) error {
+		o.options.unaryInterceptors = append(o.options.unaryInterceptors, interceptors...)
+		return nil
+	}
+}
+
+// WithStreamInterceptor adds interceptors to be run for every streaming gRPC
+// call. They are run in the order given, after the principal's built-in
+// interceptors.
+func WithStreamInterceptor(interceptors ...grpc.StreamServerInterceptor) ServerOption {
+	return func(o *Server) error {
+		o.options.streamInterceptors = append(o.options.streamInterceptors, interceptors...)
+		return nil
+	}
+}
+
+// WithConnectionLimits limits the number of agent connections open at the
+// same time across all listeners, and decides what happens to connections
+// and streams beyond their limits. The streams per connection are limited
+// by WithHTTP2MaxConcurrentStreams. A maxConnections of 0 means no limit.
+func WithConnectionLimits(maxConnections int, policy connlimit.Policy) ServerOption {
+	return func(o *Server) error {
+		if maxConnections < 0 {
+			return fmt.Errorf("maximum number of connections must not be negative")
+		}
+		if _, err := connlimit.ParsePolicy(string(policy)); err != nil {
+			return err
+		}
+		o.options.maxConnections = maxConnections
+		o.options.limitPolicy = policy
+		return nil
+	}
+}
+
+// minHTTP2WindowSize is the smallest HTTP/2 flow control window, as defined
+// by RFC 9113. gRPC ignores smaller window sizes.
+const minHTTP2WindowSize = 65535
+
+// WithHTTP2MaxConcurrentStreams limits the number of concurrent streams, i.e.
+// RPCs, an agent may open on a single connection. Zero keeps the default of
+// no limit.
+func WithHTTP2MaxConcurrentStreams(streams uint32) ServerOption {
+	return func(o *Server) error {
+		o.options.http2MaxConcurrentStreams = streams
+		return nil
+	}
+}
+
+// WithHTTP2InitialWindowSizes sets the initial HTTP/2 flow control window
+// sizes in bytes for each stream and for each connection. Setting a window
+// size disables the dynamic window sizing gRPC performs otherwise. A zero
+// value keeps the respective default.
+func WithHTTP2InitialWindowSizes(stream, conn int32) ServerOption {
+	return func(o *Server) error {
+		if stream != 0 && stream < minHTTP2WindowSize {
+			return fmt.Errorf("HTTP/2 stream window size must be at least %d bytes", minHTTP2WindowSize)
+		}
+		if conn != 0 && conn < minHTTP2WindowSize {
+			return fmt.Errorf("HTTP/2 connection window size must be at least %d bytes", minHTTP2WindowSize)
+		}
+		o.options.http2InitialWindowSize = stream
+		o.options.http2InitialConnWindowSize = conn
+		return nil
+	}
+}
+
+// WithALPNProtocols sets the application protocols offered to agents during
+// the TLS handshake, in order of preference. h2 is always offered, because
+// gRPC requires it.
+func WithALPNProtocols(protocols []string) ServerOption {
+	return func(o *Server) error {
+		for _, p := range protocols {
+			if p == "" || len(p) > 255 {
+				return fmt.Errorf("invalid ALPN protocol %q", p)
+			}
+		}
+		o.options.alpnProtocols = protocols
+		return nil
+	}
+}
+
+// WithCompression configures the compression of messages the principal sends
+// to agents on streams. By default, the principal compresses its messages
+// with the same compressor the agent uses. Mode "none" disables compression,
+// while "gzip" and "zstd" force the respective compressor for all agents that
+// support it.
+func WithCompression(mode string) ServerOption {
+	return func(o *Server) error {
+		c, err := grpcutil.ParseCompression(mode)
+		if err != nil {
+			return err
+		}
+		o.options.compression = c
+		return nil
+	}
+}
+
+// WithEventPayloadLimits configures the maximum size of event payloads
+// exchanged with agents, per event target.
+func WithEventPayloadLimits(limits *event.PayloadLimits) ServerOption {
+	return func(o *Server) error {
+		o.options.payloadLimits = limits
+		return nil
+	}
+}
+
+// WithAgentBandwidthLimits configures the maximum number of bytes per second
+// sent to each agent on its event stream.
+func WithAgentBandwidthLimits(limits *eventstream.BandwidthLimits) ServerOption {
+	return func(o *Server) error {
+		o.options.bandwidthLimits = limits
+		return nil
+	}
+}
+
 // WithInsecurePlaintext disables TLS on the gRPC server. This should only be
 // used when running behind a service mesh (e.g., Istio) that handles mTLS
 // termination at the sidecar level.
@@ -560,6 +1806,18 @@ func WithInsecurePlaintext() ServerOption {
 	}
 }
 
+// WithInsecurePlaintextForce allows the plaintext gRPC server to listen on
+// addresses other than loopback and private addresses, which are refused by
+// default to avoid accidentally exposing it outside the cluster.
+//
+// INSECURE: Do not use this without a service mesh providing transport security.
+func WithInsecurePlaintextForce() ServerOption {
+	return func(o *Server) error {
+		o.options.insecurePlaintextForce = true
+		return nil
+	}
+}
+
 func WithSubsystemLoggers(resourceProxy, redisProxy, grpcEvent *logrus.Logger) ServerOption {
 	return func(o *Server) error {
 		if redisProxy != nil {
@@ -606,6 +1864,26 @@ func WithLabelSelector(selector string) ServerOption {
 	}
 }
 
+// WithSyncLabelSelector configures the principal to only propagate the
+// Applications that match selector to managed agents. Unlike the selector
+// set by WithLabelSelector, it does not restrict which resources the
+// principal watches. Agents can be given a selector of their own in their
+// cluster secret, which takes precedence.
+func WithSyncLabelSelector(selector string) ServerOption {
+	return func(o *Server) error {
+		if selector == "" {
+			o.options.syncLabelSelector = nil
+			return nil
+		}
+		sel, err := labels.Parse(selector)
+		if err != nil {
+			return fmt.Errorf("invalid sync label selector: %w", err)
+		}
+		o.options.syncLabelSelector = sel
+		return nil
+	}
+}
+
 func WithAgentRegistration(enabled bool) ServerOption {
 	return func(o *Server) error {
 		o.options.selfAgentRegistrationEnabled = enabled
@@ -627,6 +1905,21 @@ func WithClientCertSecretName(name string) ServerOption {
 	}
 }
 
+// WithSelfRegistrationAllowedLabels sets the label keys, which may contain
+// glob patterns, that agents may request on the cluster secrets created when
+// they self-register
+func WithSelfRegistrationAllowedLabels(patterns []string) ServerOption {
+	return func(o *Server) error {
+		for _, p := range patterns {
+			if p == "" {
+				return fmt.Errorf("allowed cluster label must not be empty")
+			}
+		}
+		o.options.selfRegistrationAllowedLabels = patterns
+		return nil
+	}
+}
+
 // WithRedisTLSEnabled enables or disables TLS for Redis connections
 func WithRedisTLSEnabled(enabled bool) ServerOption {
 	return func(o *Server) error {
@@ -700,3 +1993,36 @@ func WithHA(opts ...ha.Option) ServerOption {
 		return nil
 	}
 }
+
+// WithAgentCertificateSigner enables the Certificates service, through which
+// agents renew their client certificates. The certificates are issued by
+// signer and are valid for validity, or certificate.DefaultValidity if zero.
+func WithAgentCertificateSigner(signer certificate.Signer, validity time.Duration) ServerOption {
+	return func(o *Server) error {
+		o.options.agentCertSigner = signer
+		o.options.agentCertValidity = validity
+		return nil
+	}
+}
+
+// WithCustomEvents registers target as the target of custom events exchanged
+// with agents, and handler as the function processing the events for target
+// received from agents. The name of target must be a domain qualified name,
+// such as telemetry.example.com, and agents must register the same target. A
+// nil handler allows sending events for target with SendCustomEvent only.
+func WithCustomEvents(target string, handler CustomEventHandler) ServerOption {
+	return func(o *Server) error {
+		t := targets.EventTarget(target)
+		if err := event.RegisterCustomTarget(t); err != nil {
+			return err
+		}
+		if handler == nil {
+			return nil
+		}
+		if o.options.customEventHandlers == nil {
+			o.options.customEventHandlers = make(map[targets.EventTarget]CustomEventHandler)
+		}
+		o.options.customEventHandlers[t] = handler
+		return nil
+	}
+}
@@ -15,11 +15,19 @@
 package principal
 
 import (
+	"context"
 	"crypto/tls"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/argoproj-labs/argocd-agent/internal/auth/oidc"
+	"github.com/argoproj-labs/argocd-agent/internal/connlimit"
+	"github.com/argoproj-labs/argocd-agent/internal/queue"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
 )
 
 func Test_WithInformerSyncTimeout(t *testing.T) {
@@ -54,6 +62,15 @@ func Test_WithPort(t *testing.T) {
 	}
 }
 
+func Test_WithQUICListener(t *testing.T) {
+	s := &Server{options: &ServerOptions{}}
+	require.NoError(t, WithQUICListener(8443)(s))
+	assert.Equal(t, 8443, s.options.quicPort)
+	assert.Error(t, WithQUICListener(-1)(s))
+	assert.Error(t, WithQUICListener(65536)(s))
+	assert.Equal(t, 8443, s.options.quicPort)
+}
+
 func Test_WithListenerAddress(t *testing.T) {
 	s := &Server{options: &ServerOptions{}}
 	err := WithListenerAddress("127.0.0.1")(s)
@@ -158,3 +175,296 @@ func Test_WithRedisProxyDisabled(t *testing.T) {
 	assert.NoError(t, err)
 	assert.True(t, s.options.redisProxyDisabled)
 }
+
+func Test_WithOIDCAuthentication(t *testing.T) {
+	t.Run("Valid configuration", func(t *testing.T) {
+		s := &Server{options: &ServerOptions{}}
+		err := WithOIDCAuthentication(oidc.Config{IssuerURL: "https://idp.example.com", Audience: "argocd-agent"})(s)
+		assert.NoError(t, err)
+		assert.NotNil(t, s.options.oidcConfig)
+		assert.Equal(t, "https://idp.example.com", s.options.oidcConfig.IssuerURL)
+	})
+	t.Run("Missing issuer", func(t *testing.T) {
+		s := &Server{options: &ServerOptions{}}
+		err := WithOIDCAuthentication(oidc.Config{Audience: "argocd-agent"})(s)
+		assert.Error(t, err)
+		assert.Nil(t, s.options.oidcConfig)
+	})
+	t.Run("Missing audience", func(t *testing.T) {
+		s := &Server{options: &ServerOptions{}}
+		err := WithOIDCAuthentication(oidc.Config{IssuerURL: "https://idp.example.com"})(s)
+		assert.Error(t, err)
+		assert.Nil(t, s.options.oidcConfig)
+	})
+}
+
+func Test_WithHTTP2InitialWindowSizes(t *testing.T) {
+	t.Run("Valid window sizes", func(t *testing.T) {
+		s := &Server{options: &ServerOptions{}}
+		err := WithHTTP2InitialWindowSizes(1<<20, 0)(s)
+		assert.NoError(t, err)
+		assert.Equal(t, int32(1<<20), s.options.http2InitialWindowSize)
+		assert.Equal(t, int32(0), s.options.http2InitialConnWindowSize)
+	})
+	t.Run("Window sizes below the HTTP/2 minimum", func(t *testing.T) {
+		s := &Server{options: &ServerOptions{}}
+		assert.ErrorContains(t, WithHTTP2InitialWindowSizes(1024, 0)(s), "stream window size")
+		assert.ErrorContains(t, WithHTTP2InitialWindowSizes(0, 1024)(s), "connection window size")
+	})
+}
+
+func Test_WithALPNProtocols(t *testing.T) {
+	t.Run("Valid protocols", func(t *testing.T) {
+		s := &Server{options: &ServerOptions{}}
+		err := WithALPNProtocols([]string{"h2", "http/1.1"})(s)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"h2", "http/1.1"}, s.options.alpnProtocols)
+	})
+	t.Run("Empty protocol", func(t *testing.T) {
+		s := &Server{options: &ServerOptions{}}
+		err := WithALPNProtocols([]string{"h2", ""})(s)
+		assert.Error(t, err)
+		assert.Nil(t, s.options.alpnProtocols)
+	})
+}
+
+func Test_WithKeepAlive(t *testing.T) {
+	t.Run("Valid keepalive settings", func(t *testing.T) {
+		s := &Server{options: &ServerOptions{}}
+		err := WithKeepAlive(2*time.Minute, 20*time.Second)(s)
+		assert.NoError(t, err)
+		assert.Equal(t, 2*time.Minute, s.keepAliveTime)
+		assert.Equal(t, 20*time.Second, s.keepAliveTimeout)
+	})
+	t.Run("Negative values", func(t *testing.T) {
+		s := &Server{options: &ServerOptions{}}
+		assert.ErrorContains(t, WithKeepAlive(-time.Second, 0)(s), "interval")
+		assert.ErrorContains(t, WithKeepAlive(time.Second, -time.Second)(s), "timeout")
+	})
+	t.Run("Timeout without interval", func(t *testing.T) {
+		s := &Server{options: &ServerOptions{}}
+		assert.Error(t, WithKeepAlive(0, 20*time.Second)(s))
+	})
+}
+
+func Test_WithCompression(t *testing.T) {
+	t.Run("Valid compression modes", func(t *testing.T) {
+		for _, m := range []string{"auto", "none", "gzip", "zstd"} {
+			s := &Server{options: &ServerOptions{}}
+			assert.NoError(t, WithCompression(m)(s))
+			assert.Equal(t, m, s.options.compression)
+		}
+	})
+	t.Run("Invalid compression mode", func(t *testing.T) {
+		s := &Server{options: &ServerOptions{}}
+		assert.Error(t, WithCompression("brotli")(s))
+		assert.Empty(t, s.options.compression)
+	})
+}
+
+func Test_WithHeartbeatInterval(t *testing.T) {
+	s := &Server{options: &ServerOptions{}}
+	assert.NoError(t, WithHeartbeatInterval(30*time.Second)(s))
+	assert.Equal(t, 30*time.Second, s.options.heartbeatInterval)
+	assert.Equal(t, 90*time.Second, s.livenessTimeout())
+	assert.Error(t, WithHeartbeatInterval(-time.Second)(s))
+
+	assert.NoError(t, WithAgentLivenessTimeout(time.Minute)(s))
+	assert.Equal(t, time.Minute, s.livenessTimeout())
+	assert.Error(t, WithAgentLivenessTimeout(-time.Second)(s))
+}
+
+func Test_WithConnectionStormProtection(t *testing.T) {
+	s := &Server{options: &ServerOptions{}}
+	assert.NoError(t, WithConnectionStormProtection(time.Minute, 5)(s))
+	require.NotNil(t, s.options.stormProtection)
+	assert.Equal(t, time.Minute, s.options.stormProtection.Window)
+	assert.Equal(t, 5.0, s.options.stormProtection.Rate)
+
+	s = &Server{options: &ServerOptions{}}
+	assert.Error(t, WithConnectionStormProtection(0, 5)(s))
+	assert.Error(t, WithConnectionStormProtection(time.Minute, 0)(s))
+	assert.Nil(t, s.options.stormProtection)
+}
+
+func Test_WithInterceptors(t *testing.T) {
+	s := &Server{options: &ServerOptions{}}
+	unary := func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		return handler(ctx, req)
+	}
+	stream := func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, ss)
+	}
+	require.NoError(t, WithUnaryInterceptor(unary)(s))
+	require.NoError(t, WithUnaryInterceptor(unary, unary)(s))
+	require.NoError(t, WithStreamInterceptor(stream)(s))
+	assert.Len(t, s.options.unaryInterceptors, 3)
+	assert.Len(t, s.options.streamInterceptors, 1)
+}
+
+func Test_WithReflection(t *testing.T) {
+	s := &Server{options: defaultOptions()}
+	assert.False(t, s.options.enableReflection)
+	require.NoError(t, WithReflection(true)(s))
+	assert.True(t, s.options.enableReflection)
+	// Reflection must never be available without authentication
+	for method := range noAuthEndpoints {
+		assert.NotContains(t, method, "grpc.reflection")
+	}
+}
+
+func Test_WithRPCTimeouts(t *testing.T) {
+	s := &Server{options: defaultOptions()}
+	assert.Equal(t, DefaultUnaryTimeout, s.options.unaryTimeout)
+	assert.Equal(t, DefaultSendTimeout, s.options.sendTimeout)
+	require.NoError(t, WithRPCTimeouts(10*time.Second, 0)(s))
+	assert.Equal(t, 10*time.Second, s.options.unaryTimeout)
+	assert.Equal(t, time.Duration(0), s.options.sendTimeout)
+	assert.Error(t, WithRPCTimeouts(-1, 0)(s))
+	assert.Error(t, WithRPCTimeouts(0, -1)(s))
+}
+
+func Test_WithEventChunkSize(t *testing.T) {
+	s := &Server{options: defaultOptions()}
+	assert.Equal(t, 0, s.options.chunkSize)
+	require.NoError(t, WithEventChunkSize(64*1024)(s))
+	assert.Equal(t, 64*1024, s.options.chunkSize)
+	assert.Error(t, WithEventChunkSize(100)(s))
+	assert.Error(t, WithEventChunkSize(-1)(s))
+}
+
+func Test_WithPayloadTransferThreshold(t *testing.T) {
+	s := &Server{options: defaultOptions()}
+	assert.Equal(t, 0, s.options.payloadTransferThreshold)
+	require.NoError(t, WithPayloadTransferThreshold(1024*1024)(s))
+	assert.Equal(t, 1024*1024, s.options.payloadTransferThreshold)
+	assert.Error(t, WithPayloadTransferThreshold(-1)(s))
+}
+
+func Test_WithEventBatchSize(t *testing.T) {
+	s := &Server{options: defaultOptions()}
+	require.NoError(t, WithEventBatchSize(100)(s))
+	assert.Equal(t, 100, s.options.batchSize)
+	assert.Error(t, WithEventBatchSize(0)(s))
+	assert.Error(t, WithEventBatchSize(1001)(s))
+}
+
+func Test_WithAgentQueueLimits(t *testing.T) {
+	s := &Server{options: defaultOptions()}
+	assert.Nil(t, s.options.queueLimits)
+	limits, err := queue.ParseLimits([]string{"agent-a=10:coalesce"})
+	require.NoError(t, err)
+	require.NoError(t, WithAgentQueueLimits(limits)(s))
+	assert.Equal(t, queue.Limit{Size: 10, Policy: queue.OverflowCoalesce}, s.options.queueLimits.For("agent-a"))
+}
+
+func Test_WithUpdateCoalescing(t *testing.T) {
+	s := &Server{options: defaultOptions()}
+	assert.True(t, s.options.coalesceUpdates)
+	require.NoError(t, WithUpdateCoalescing(false)(s))
+	assert.False(t, s.options.coalesceUpdates)
+}
+
+func Test_WithQueueAdminPort(t *testing.T) {
+	s := &Server{options: defaultOptions()}
+	assert.Zero(t, s.options.queueAdminPort)
+	require.NoError(t, WithQueueAdminPort(8406)(s))
+	assert.Equal(t, 8406, s.options.queueAdminPort)
+	assert.Error(t, WithQueueAdminPort(-1)(s))
+	assert.Error(t, WithQueueAdminPort(70000)(s))
+}
+
+func Test_WithQueueBackend(t *testing.T) {
+	s := &Server{options: defaultOptions()}
+	assert.Equal(t, QueueBackendMemory, s.options.queueBackend)
+	require.NoError(t, WithQueueBackend(QueueBackendRedis)(s))
+	assert.Equal(t, QueueBackendRedis, s.options.queueBackend)
+	assert.Error(t, WithQueueBackend("etcd")(s))
+}
+
+func Test_WithAppDeletionPolicies(t *testing.T) {
+	s := &Server{options: defaultOptions()}
+	assert.Nil(t, s.options.appDeletionPolicies)
+	require.NoError(t, WithAppDeletionPolicies([]string{"default=foreground", "agent-a=orphan"})(s))
+	assert.Equal(t, AppDeletionPolicyOrphan, s.options.appDeletionPolicies.For("agent-a"))
+	assert.Equal(t, AppDeletionPolicyForeground, s.options.appDeletionPolicies.For("agent-b"))
+	assert.Error(t, WithAppDeletionPolicies([]string{"agent-a=cascade"})(s))
+	assert.Error(t, WithAppDeletionPolicies([]string{"orphan"})(s))
+	require.NoError(t, WithAppDeletionPolicies(nil)(s))
+	assert.Nil(t, s.options.appDeletionPolicies)
+}
+
+func Test_WithOrphanedAppCleanup(t *testing.T) {
+	s := &Server{options: defaultOptions()}
+	assert.Equal(t, OrphanedAppPolicyNone, s.options.orphanedAppPolicy)
+	require.NoError(t, WithOrphanedAppCleanup(OrphanedAppPolicyDelete, time.Minute)(s))
+	assert.Equal(t, OrphanedAppPolicyDelete, s.options.orphanedAppPolicy)
+	assert.Equal(t, time.Minute, s.options.orphanedAppGracePeriod)
+	assert.Error(t, WithOrphanedAppCleanup("archive", time.Minute)(s))
+	assert.Error(t, WithOrphanedAppCleanup(OrphanedAppPolicyLabel, -time.Minute)(s))
+	assert.Equal(t, OrphanedAppPolicyDelete, s.options.orphanedAppPolicy)
+}
+
+func Test_WithRepositoryFieldFilter(t *testing.T) {
+	s := &Server{options: defaultOptions()}
+	assert.Empty(t, s.options.repoExcludedFields)
+	require.NoError(t, WithRepositoryFieldFilter([]string{"githubAppPrivateKey"})(s))
+	assert.Equal(t, []string{"githubAppPrivateKey"}, s.options.repoExcludedFields)
+	assert.Error(t, WithRepositoryFieldFilter([]string{"url"})(s))
+}
+
+func Test_WithRepositoryEncryptionKeyFile(t *testing.T) {
+	s := &Server{options: defaultOptions()}
+	require.NoError(t, WithRepositoryEncryptionKeyFile("")(s))
+	assert.Nil(t, s.options.repoCipher)
+
+	path := filepath.Join(t.TempDir(), "key")
+	require.NoError(t, os.WriteFile(path, []byte("a shared key"), 0600))
+	require.NoError(t, WithRepositoryEncryptionKeyFile(path)(s))
+	assert.NotNil(t, s.options.repoCipher)
+	assert.Error(t, WithRepositoryEncryptionKeyFile(path+".missing")(s))
+}
+
+func Test_WithApplicationFieldFilters(t *testing.T) {
+	s := &Server{options: defaultOptions()}
+	require.NoError(t, WithApplicationFieldFilters(nil)(s))
+	assert.Nil(t, s.options.appFilter)
+	assert.Error(t, WithApplicationFieldFilters([]string{"spec:project"})(s))
+	require.NoError(t, WithApplicationFieldFilters([]string{"annotation:notifications.argoproj.io/*"})(s))
+	assert.NotNil(t, s.options.appFilter)
+}
+
+func Test_WithArgoCDConfigKeys(t *testing.T) {
+	s := &Server{options: defaultOptions()}
+	require.NoError(t, WithArgoCDConfigKeys(nil)(s))
+	assert.Nil(t, s.options.argoCDConfigKeys)
+	assert.Error(t, WithArgoCDConfigKeys([]string{"argocd-secret:admin.password"})(s))
+
+	require.NoError(t, WithArgoCDConfigKeys([]string{"argocd-rbac-cm:policy.csv"})(s))
+	require.NoError(t, WithArgoCDResourceFilterSync(true)(s))
+	assert.Equal(t, []string{"argocd-cm", "argocd-rbac-cm"}, s.options.argoCDConfigKeys.ConfigMaps())
+	assert.True(t, s.options.argoCDConfigKeys.Selects("argocd-rbac-cm", "policy.csv"))
+	assert.True(t, s.options.argoCDConfigKeys.Selects("argocd-cm", "resource.exclusions"))
+
+	require.NoError(t, WithArgoCDNotificationsSync(true)(s))
+	assert.Equal(t, []string{"argocd-cm", "argocd-notifications-cm", "argocd-rbac-cm"}, s.options.argoCDConfigKeys.ConfigMaps())
+	assert.Equal(t, []string{"argocd-notifications-secret"}, s.options.argoCDConfigKeys.Secrets())
+}
+
+func Test_WithConnectionLimits(t *testing.T) {
+	s := &Server{options: defaultOptions()}
+	assert.Equal(t, connlimit.PolicyQueue, s.options.limitPolicy)
+	require.NoError(t, WithConnectionLimits(100, connlimit.PolicyReject)(s))
+	assert.Equal(t, 100, s.options.maxConnections)
+	assert.Equal(t, connlimit.PolicyReject, s.options.limitPolicy)
+	assert.Error(t, WithConnectionLimits(-1, connlimit.PolicyQueue)(s))
+	assert.Error(t, WithConnectionLimits(10, "drop")(s))
+}
+
+func Test_advertisedMaxStreams(t *testing.T) {
+	s := &Server{options: defaultOptions()}
+	require.NoError(t, WithHTTP2MaxConcurrentStreams(10)(s))
+	assert.Equal(t, uint32(10), s.advertisedMaxStreams())
+	s.streamLimiter = connlimit.NewStreamLimiter(10, nil)
+	assert.Equal(t, uint32(0), s.advertisedMaxStreams())
+}
@@ -0,0 +1,264 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package principal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/internal/backend"
+	"github.com/argoproj-labs/argocd-agent/internal/config"
+	"github.com/argoproj-labs/argocd-agent/internal/manager"
+	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/argoproj/argo-cd/v3/util/glob"
+	"github.com/sirupsen/logrus"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ktypes "k8s.io/apimachinery/pkg/types"
+)
+
+// orphanCleanup tracks the agents whose cluster mapping was removed, until
+// their applications are cleaned up after the grace period
+type orphanCleanup struct {
+	mu sync.Mutex
+	// key: agent name
+	// value: timer cleaning up the agent's applications
+	timers map[string]*time.Timer
+}
+
+// scheduleOrphanCleanup cleans up the applications of agent once the grace
+// period passed, unless the agent is mapped to a cluster again before. It is
+// called by the cluster manager when the mapping of agent was removed. The
+// time of the removal is recorded on the applications, so that the cleanup
+// can be resumed after a restart.
+func (s *Server) scheduleOrphanCleanup(agent string) {
+	since := time.Now()
+	s.scheduleOrphanCleanupAt(agent, since)
+	// The cluster manager holds its lock while calling us
+	go func() {
+		if err := s.markOrphanedApps(s.ctx, agent, since); err != nil {
+			log().WithField("agent", agent).WithError(err).Error("Could not record removal of cluster mapping on applications")
+		}
+	}()
+}
+
+// scheduleOrphanCleanupAt cleans up the applications of agent once the grace
+// period passed since the mapping of agent was removed at since.
+func (s *Server) scheduleOrphanCleanupAt(agent string, since time.Time) {
+	delay := max(time.Until(since.Add(s.options.orphanedAppGracePeriod)), 0)
+	s.orphans.mu.Lock()
+	defer s.orphans.mu.Unlock()
+	if s.orphans.timers == nil {
+		s.orphans.timers = make(map[string]*time.Timer)
+	}
+	if t, ok := s.orphans.timers[agent]; ok {
+		t.Stop()
+	}
+	log().WithField("agent", agent).Infof("Agent is no longer mapped to a cluster, cleaning up its applications in %v", delay.Round(time.Second))
+	s.orphans.timers[agent] = time.AfterFunc(delay, func() {
+		s.orphans.mu.Lock()
+		delete(s.orphans.timers, agent)
+		s.orphans.mu.Unlock()
+		if err := s.cleanupOrphanedApps(s.ctx, agent); err != nil {
+			log().WithField("agent", agent).WithError(err).Error("Could not clean up orphaned applications")
+		}
+	})
+}
+
+// cancelOrphanCleanup stops the pending cleanup of the applications of agent,
+// and removes the orphaned label and annotation from them. It is called by
+// the cluster manager when agent was mapped to a cluster.
+func (s *Server) cancelOrphanCleanup(agent string) {
+	s.orphans.mu.Lock()
+	if t, ok := s.orphans.timers[agent]; ok {
+		t.Stop()
+		delete(s.orphans.timers, agent)
+		log().WithField("agent", agent).Info("Agent was mapped to a cluster again, not cleaning up its applications")
+	}
+	s.orphans.mu.Unlock()
+
+	// The cluster manager holds its lock while calling us
+	go func() {
+		if err := s.unmarkOrphanedApps(s.ctx, agent); err != nil {
+			log().WithField("agent", agent).WithError(err).Error("Could not remove orphaned label and annotation from applications")
+		}
+	}()
+}
+
+// resumeOrphanCleanups schedules the cleanup of the applications of all
+// agents that are not mapped to a cluster when the principal starts. It must
+// be called once the cluster manager has been started. For agents whose
+// mapping was removed before a restart, the grace period counts from the time
+// recorded on their applications. Agents whose mapping was removed while the
+// principal was down are treated as if it was removed now.
+func (s *Server) resumeOrphanCleanups(ctx context.Context) error {
+	apps, err := s.kubeClient.ApplicationsClientset.ArgoprojV1alpha1().Applications("").List(ctx, v1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("could not list applications: %w", err)
+	}
+	now := time.Now()
+	// key: agent name
+	// value: time the mapping of the agent was removed
+	orphanedSince := make(map[string]time.Time)
+	for i := range apps.Items {
+		app := &apps.Items[i]
+		agent := app.Namespace
+		if agent == s.namespace || !glob.MatchStringInList(s.options.namespaces, agent, glob.REGEXP) {
+			continue
+		}
+		if s.clusterMgr != nil && s.clusterMgr.HasMapping(agent) {
+			continue
+		}
+		since, ok := orphanedSince[agent]
+		if !ok {
+			since = now
+		}
+		if t, err := time.Parse(time.RFC3339, app.Annotations[config.OrphanedSinceAnnotation]); err == nil && t.Before(since) {
+			since = t
+		}
+		orphanedSince[agent] = since
+	}
+	for agent, since := range orphanedSince {
+		s.scheduleOrphanCleanupAt(agent, since)
+		if err := s.markOrphanedApps(ctx, agent, since); err != nil {
+			log().WithField("agent", agent).WithError(err).Error("Could not record removal of cluster mapping on applications")
+		}
+	}
+	return nil
+}
+
+// cleanupOrphanedApps deletes or labels the applications in the namespace of
+// agent, according to the orphaned application policy. Nothing is cleaned up
+// if the agent is mapped to a cluster again, or if this replica of the
+// principal is not active.
+func (s *Server) cleanupOrphanedApps(ctx context.Context, agent string) error {
+	logCtx := log().WithFields(logrus.Fields{"agent": agent, "policy": s.options.orphanedAppPolicy})
+	if !s.IsActive() {
+		logCtx.Debug("Not cleaning up orphaned applications on passive principal")
+		return nil
+	}
+	if s.clusterMgr != nil && s.clusterMgr.HasMapping(agent) {
+		logCtx.Debug("Agent is mapped to a cluster again, not cleaning up its applications")
+		return nil
+	}
+
+	apps, err := s.kubeClient.ApplicationsClientset.ArgoprojV1alpha1().Applications(agent).List(ctx, v1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("could not list applications of agent %s: %w", agent, err)
+	}
+	cleaned := 0
+	for i := range apps.Items {
+		app := &apps.Items[i]
+		switch s.options.orphanedAppPolicy {
+		case OrphanedAppPolicyDelete:
+			err = s.deleteOrphanedApp(ctx, app)
+		case OrphanedAppPolicyLabel:
+			if app.Labels[config.OrphanedLabel] == "true" {
+				continue
+			}
+			label := "true"
+			err = s.patchOrphanedApp(ctx, app, map[string]*string{config.OrphanedLabel: &label}, nil)
+		}
+		if err != nil && !kerrors.IsNotFound(err) {
+			logCtx.WithError(err).Errorf("Could not clean up orphaned application %s", app.QualifiedName())
+			continue
+		}
+		cleaned++
+	}
+	logCtx.Infof("Cleaned up %d orphaned applications", cleaned)
+	return nil
+}
+
+func (s *Server) deleteOrphanedApp(ctx context.Context, app *v1alpha1.Application) error {
+	// The deletion of an application of an autonomous agent is reverted,
+	// unless it is expected
+	if s.deletions != nil && s.isResourceFromAutonomousAgent(app) {
+		s.deletions.MarkExpected(ktypes.UID(app.Annotations[manager.SourceUIDAnnotation]))
+	}
+	deletionPropagation := backend.DeletePropagationBackground
+	return s.appManager.Delete(ctx, app.Namespace, app, &deletionPropagation)
+}
+
+// markOrphanedApps records since as the time the mapping of agent was removed
+// on the applications in the namespace of agent that do not have it yet
+func (s *Server) markOrphanedApps(ctx context.Context, agent string, since time.Time) error {
+	if !s.IsActive() {
+		return nil
+	}
+	apps, err := s.kubeClient.ApplicationsClientset.ArgoprojV1alpha1().Applications(agent).List(ctx, v1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("could not list applications of agent %s: %w", agent, err)
+	}
+	value := since.UTC().Format(time.RFC3339)
+	for i := range apps.Items {
+		app := &apps.Items[i]
+		if _, ok := app.Annotations[config.OrphanedSinceAnnotation]; ok {
+			continue
+		}
+		err := s.patchOrphanedApp(ctx, app, nil, map[string]*string{config.OrphanedSinceAnnotation: &value})
+		if err != nil && !kerrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// unmarkOrphanedApps removes the orphaned label and annotation from the
+// applications in the namespace of agent
+func (s *Server) unmarkOrphanedApps(ctx context.Context, agent string) error {
+	if !s.IsActive() {
+		return nil
+	}
+	apps, err := s.kubeClient.ApplicationsClientset.ArgoprojV1alpha1().Applications(agent).List(ctx, v1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("could not list orphaned applications of agent %s: %w", agent, err)
+	}
+	for i := range apps.Items {
+		app := &apps.Items[i]
+		_, labeled := app.Labels[config.OrphanedLabel]
+		_, annotated := app.Annotations[config.OrphanedSinceAnnotation]
+		if !labeled && !annotated {
+			continue
+		}
+		err := s.patchOrphanedApp(ctx, app,
+			map[string]*string{config.OrphanedLabel: nil},
+			map[string]*string{config.OrphanedSinceAnnotation: nil})
+		if err != nil && !kerrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// patchOrphanedApp sets the given labels and annotations of app, removing
+// those with a nil value
+func (s *Server) patchOrphanedApp(ctx context.Context, app *v1alpha1.Application, labels, annotations map[string]*string) error {
+	metadata := make(map[string]any)
+	if len(labels) > 0 {
+		metadata["labels"] = labels
+	}
+	if len(annotations) > 0 {
+		metadata["annotations"] = annotations
+	}
+	patch, err := json.Marshal(map[string]any{"metadata": metadata})
+	if err != nil {
+		return err
+	}
+	_, err = s.kubeClient.ApplicationsClientset.ArgoprojV1alpha1().Applications(app.Namespace).Patch(ctx, app.Name, ktypes.MergePatchType, patch, v1.PatchOptions{})
+	return err
+}
@@ -0,0 +1,227 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package principal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/internal/backend/mocks"
+	"github.com/argoproj-labs/argocd-agent/internal/config"
+	"github.com/argoproj-labs/argocd-agent/internal/kube"
+	"github.com/argoproj-labs/argocd-agent/internal/manager"
+	"github.com/argoproj-labs/argocd-agent/pkg/types"
+	fakekube "github.com/argoproj-labs/argocd-agent/test/fake/kube"
+	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	fakeappclient "github.com/argoproj/argo-cd/v3/pkg/client/clientset/versioned/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+)
+
+func newOrphanTestServer(policy string, apps ...*v1alpha1.Application) (*Server, *mocks.Application) {
+	mockBackend := &mocks.Application{}
+	s := newAppTestServer(mockBackend)
+	s.options = defaultOptions()
+	s.options.orphanedAppPolicy = policy
+	s.deletions = manager.NewDeletionTracker()
+	clientset := fakeappclient.NewSimpleClientset()
+	for _, app := range apps {
+		_ = clientset.Tracker().Add(app)
+	}
+	s.kubeClient = &kube.KubernetesClient{ApplicationsClientset: clientset}
+	return s, mockBackend
+}
+
+func orphanTestApp(namespace, name string) *v1alpha1.Application {
+	return &v1alpha1.Application{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+	}
+}
+
+func Test_cleanupOrphanedApps(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Label and unlabel applications of the agent", func(t *testing.T) {
+		s, _ := newOrphanTestServer(OrphanedAppPolicyLabel,
+			orphanTestApp("agent1", "app1"),
+			orphanTestApp("agent1", "app2"),
+			orphanTestApp("agent2", "app3"))
+		require.NoError(t, s.cleanupOrphanedApps(ctx, "agent1"))
+
+		apps := s.kubeClient.ApplicationsClientset.ArgoprojV1alpha1()
+		for _, name := range []string{"app1", "app2"} {
+			app, err := apps.Applications("agent1").Get(ctx, name, metav1.GetOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, "true", app.Labels[config.OrphanedLabel])
+		}
+		app, err := apps.Applications("agent2").Get(ctx, "app3", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.NotContains(t, app.Labels, config.OrphanedLabel)
+
+		require.NoError(t, s.unmarkOrphanedApps(ctx, "agent1"))
+		for _, name := range []string{"app1", "app2"} {
+			app, err := apps.Applications("agent1").Get(ctx, name, metav1.GetOptions{})
+			require.NoError(t, err)
+			assert.NotContains(t, app.Labels, config.OrphanedLabel)
+		}
+	})
+
+	t.Run("Delete applications of the agent", func(t *testing.T) {
+		s, mockBackend := newOrphanTestServer(OrphanedAppPolicyDelete,
+			orphanTestApp("agent1", "app1"),
+			orphanTestApp("agent2", "app2"))
+		mockBackend.On("Delete", mock.Anything, "app1", "agent1", mock.Anything).Return(nil)
+		require.NoError(t, s.cleanupOrphanedApps(ctx, "agent1"))
+		mockBackend.AssertNumberOfCalls(t, "Delete", 1)
+	})
+
+	t.Run("Deletion of applications of autonomous agents is expected", func(t *testing.T) {
+		app := orphanTestApp("agent1", "app1")
+		app.Annotations = map[string]string{manager.SourceUIDAnnotation: "source-uid"}
+		s, mockBackend := newOrphanTestServer(OrphanedAppPolicyDelete, app)
+		s.setAgentMode("agent1", types.AgentModeAutonomous)
+		mockBackend.On("Delete", mock.Anything, "app1", "agent1", mock.Anything).Return(nil)
+		require.NoError(t, s.cleanupOrphanedApps(ctx, "agent1"))
+		assert.True(t, s.deletions.RemoveExpected(k8stypes.UID("source-uid")))
+	})
+}
+
+func Test_OrphanedAppPolicyWithDestinationBasedMapping(t *testing.T) {
+	_, err := NewServer(context.Background(), fakekube.NewKubernetesFakeClientWithApps("argocd"), "argocd",
+		WithGeneratedTokenSigningKey(), WithRedisProxyDisabled(),
+		WithDestinationBasedMapping(true), WithOrphanedAppCleanup(OrphanedAppPolicyLabel, time.Hour))
+	assert.ErrorContains(t, err, "cannot be used with destination-based mapping")
+
+	_, err = NewServer(context.Background(), fakekube.NewKubernetesFakeClientWithApps("argocd"), "argocd",
+		WithGeneratedTokenSigningKey(), WithRedisProxyDisabled(),
+		WithDestinationBasedMapping(true), WithOrphanedAppCleanup(OrphanedAppPolicyNone, time.Hour))
+	assert.NoError(t, err)
+}
+
+func Test_scheduleOrphanCleanup(t *testing.T) {
+	t.Run("Cleanup runs after the grace period", func(t *testing.T) {
+		s, _ := newOrphanTestServer(OrphanedAppPolicyLabel, orphanTestApp("agent1", "app1"))
+		s.options.orphanedAppGracePeriod = 10 * time.Millisecond
+		s.scheduleOrphanCleanup("agent1")
+		assert.Eventually(t, func() bool {
+			app, err := s.kubeClient.ApplicationsClientset.ArgoprojV1alpha1().Applications("agent1").Get(context.Background(), "app1", metav1.GetOptions{})
+			return err == nil && app.Labels[config.OrphanedLabel] == "true"
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Cleanup is cancelled when the agent is mapped again", func(t *testing.T) {
+		s, _ := newOrphanTestServer(OrphanedAppPolicyDelete, orphanTestApp("agent1", "app1"))
+		s.options.orphanedAppGracePeriod = time.Hour
+		s.scheduleOrphanCleanup("agent1")
+		assert.Contains(t, s.orphans.timers, "agent1")
+		require.Eventually(t, func() bool {
+			_, ok := getOrphanTestApp(t, s, "agent1", "app1").Annotations[config.OrphanedSinceAnnotation]
+			return ok
+		}, time.Second, 10*time.Millisecond)
+		s.cancelOrphanCleanup("agent1")
+		assert.NotContains(t, s.orphans.timers, "agent1")
+		assert.Eventually(t, func() bool {
+			_, ok := getOrphanTestApp(t, s, "agent1", "app1").Annotations[config.OrphanedSinceAnnotation]
+			return !ok
+		}, time.Second, 10*time.Millisecond)
+	})
+}
+
+func getOrphanTestApp(t *testing.T, s *Server, namespace, name string) *v1alpha1.Application {
+	t.Helper()
+	app, err := s.kubeClient.ApplicationsClientset.ArgoprojV1alpha1().Applications(namespace).Get(context.Background(), name, metav1.GetOptions{})
+	require.NoError(t, err)
+	return app
+}
+
+// restartOrphanTestServer returns a server on the same cluster as s, as if
+// the principal was restarted
+func restartOrphanTestServer(s *Server) *Server {
+	s.orphans.mu.Lock()
+	for _, t := range s.orphans.timers {
+		t.Stop()
+	}
+	s.orphans.mu.Unlock()
+	restarted, _ := newOrphanTestServer(s.options.orphanedAppPolicy)
+	restarted.options.orphanedAppGracePeriod = s.options.orphanedAppGracePeriod
+	restarted.options.namespaces = s.options.namespaces
+	restarted.kubeClient = s.kubeClient
+	return restarted
+}
+
+func Test_resumeOrphanCleanups(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Cleanup survives a restart", func(t *testing.T) {
+		s, _ := newOrphanTestServer(OrphanedAppPolicyLabel, orphanTestApp("agent1", "app1"))
+		s.options.namespaces = []string{"agent*"}
+		s.options.orphanedAppGracePeriod = 200 * time.Millisecond
+		s.scheduleOrphanCleanup("agent1")
+		require.Eventually(t, func() bool {
+			_, ok := getOrphanTestApp(t, s, "agent1", "app1").Annotations[config.OrphanedSinceAnnotation]
+			return ok
+		}, time.Second, 10*time.Millisecond)
+
+		restarted := restartOrphanTestServer(s)
+		assert.NotContains(t, getOrphanTestApp(t, restarted, "agent1", "app1").Labels, config.OrphanedLabel)
+		require.NoError(t, restarted.resumeOrphanCleanups(ctx))
+		assert.Eventually(t, func() bool {
+			return getOrphanTestApp(t, restarted, "agent1", "app1").Labels[config.OrphanedLabel] == "true"
+		}, 2*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Grace period counts from the recorded removal", func(t *testing.T) {
+		expired := orphanTestApp("agent1", "app1")
+		expired.Annotations = map[string]string{config.OrphanedSinceAnnotation: time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339)}
+		pending := orphanTestApp("agent2", "app2")
+		pending.Annotations = map[string]string{config.OrphanedSinceAnnotation: time.Now().Add(-10 * time.Minute).UTC().Format(time.RFC3339)}
+		s, _ := newOrphanTestServer(OrphanedAppPolicyLabel,
+			expired, pending,
+			orphanTestApp("agent3", "app3"),
+			orphanTestApp("agent4", "app4"),
+			orphanTestApp("other", "app5"))
+		s.options.namespaces = []string{"agent*"}
+		s.options.orphanedAppGracePeriod = time.Hour
+		s.clusterMgr = makeClusterMgr(t)
+		require.NoError(t, s.clusterMgr.MapCluster("agent4", &v1alpha1.Cluster{Name: "agent4", Server: "https://agent4"}))
+
+		require.NoError(t, s.resumeOrphanCleanups(ctx))
+		assert.Eventually(t, func() bool {
+			return getOrphanTestApp(t, s, "agent1", "app1").Labels[config.OrphanedLabel] == "true"
+		}, time.Second, 10*time.Millisecond)
+
+		s.orphans.mu.Lock()
+		assert.NotContains(t, s.orphans.timers, "agent1")
+		assert.Contains(t, s.orphans.timers, "agent2")
+		assert.Contains(t, s.orphans.timers, "agent3")
+		assert.NotContains(t, s.orphans.timers, "agent4")
+		assert.NotContains(t, s.orphans.timers, "other")
+		for _, t := range s.orphans.timers {
+			t.Stop()
+		}
+		s.orphans.mu.Unlock()
+
+		// The removal of the mapping of agent3 happened while the principal
+		// was down, and is recorded now
+		assert.NotContains(t, getOrphanTestApp(t, s, "agent2", "app2").Labels, config.OrphanedLabel)
+		assert.Contains(t, getOrphanTestApp(t, s, "agent3", "app3").Annotations, config.OrphanedSinceAnnotation)
+		assert.NotContains(t, getOrphanTestApp(t, s, "agent4", "app4").Annotations, config.OrphanedSinceAnnotation)
+		assert.NotContains(t, getOrphanTestApp(t, s, "other", "app5").Annotations, config.OrphanedSinceAnnotation)
+	})
+}
@@ -0,0 +1,326 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package policy implements per-agent policies restricting which events for
+// synced resources an agent may send to, or receive from, the principal.
+//
+// Policies are declared in a ConfigMap. Each key holds the policy for the
+// agent of the same name. Agents without a policy of their own use the policy
+// for their mode, held in the keys ManagedPolicyKey and AutonomousPolicyKey,
+// and finally the policy in the key DefaultPolicyKey. A policy is a YAML
+// document:
+//
+//	send:
+//	- kinds: [application]
+//	  events: [status]
+//	receive:
+//	- kinds: ["*"]
+//	  events: ["*"]
+//	deny:
+//	- kinds: ["*"]
+//	  events: [delete]
+//
+// Rules in "send" apply to events the agent sends to the principal, rules in
+// "receive" apply to events the principal sends to the agent. An event is
+// allowed if any rule of its direction matches both its kind and its type,
+// and no rule in "deny" does. Rules in "deny" apply to both directions. If a
+// direction is omitted, all events in that direction that are not denied are
+// allowed. If no policy applies to an agent, all events are allowed.
+//
+// Besides event types, rules may name classes of event types, e.g. spec for
+// all events changing the spec of a resource.
+package policy
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/internal/event"
+	"github.com/argoproj-labs/argocd-agent/internal/event/targets"
+	"github.com/argoproj-labs/argocd-agent/internal/informer"
+	"github.com/argoproj-labs/argocd-agent/internal/logging"
+	"github.com/argoproj-labs/argocd-agent/pkg/types"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+// DefaultPolicyKey is the key in the policy ConfigMap holding the policy for
+// agents without a policy of their own. Agent names are valid namespace
+// names, which cannot contain underscores, so it cannot clash with an agent.
+const DefaultPolicyKey = "_default"
+
+// ManagedPolicyKey and AutonomousPolicyKey are the keys in the policy
+// ConfigMap holding the policies for managed and autonomous agents without a
+// policy of their own. They take precedence over the default policy.
+const (
+	ManagedPolicyKey    = "_managed"
+	AutonomousPolicyKey = "_autonomous"
+)
+
+// Wildcard matches any kind or event type in a rule
+const Wildcard = "*"
+
+// syncTimeout is the time to wait for the policy informer to sync before
+// giving up.
+const syncTimeout = 30 * time.Second
+
+// Direction is the direction of an event, as seen from the agent
+type Direction string
+
+const (
+	// Send is the direction of events sent by the agent to the principal
+	Send Direction = "send"
+	// Receive is the direction of events sent by the principal to the agent
+	Receive Direction = "receive"
+)
+
+// governedTargets are the event targets subject to policies. Events for all
+// other targets, such as heartbeats, ACKs or resource proxy requests, are
+// required for the agent to operate and are always allowed.
+var governedTargets = []targets.EventTarget{
+	targets.Application,
+	targets.AppProject,
+	targets.ApplicationSet,
+	targets.Repository,
+	targets.GPGKey,
+	targets.ArgoCDConfig,
+	targets.ArgoCDSecret,
+}
+
+// eventClasses are the names of classes of event types that can be used in
+// the events of a rule, and the event types they contain.
+var eventClasses = map[string][]event.EventType{
+	"spec":      {event.Create, event.SpecUpdate},
+	"status":    {event.StatusUpdate},
+	"operation": {event.SetOperation, event.TerminateOperation},
+}
+
+// Rule allows events of the given types for the given kinds
+type Rule struct {
+	// Kinds are the event targets the rule applies to, e.g. application
+	Kinds []string `yaml:"kinds"`
+	// Events are the event types the rule applies to, without the common
+	// prefix, e.g. spec-update, or classes of event types, e.g. spec
+	Events []string `yaml:"events"`
+}
+
+// Policy restricts the events an agent may send and receive
+type Policy struct {
+	Send    []Rule `yaml:"send"`
+	Receive []Rule `yaml:"receive"`
+	// Deny holds rules for events that are not allowed in either direction,
+	// regardless of the rules in Send and Receive
+	Deny []Rule `yaml:"deny"`
+}
+
+// Parse parses a single policy document
+func Parse(data string) (*Policy, error) {
+	p := &Policy{}
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(p); err != nil {
+		return nil, fmt.Errorf("invalid policy: %w", err)
+	}
+	for _, r := range slices.Concat(p.Send, p.Receive, p.Deny) {
+		if len(r.Kinds) == 0 || len(r.Events) == 0 {
+			return nil, fmt.Errorf("invalid policy: each rule must have at least one kind and one event")
+		}
+	}
+	return p, nil
+}
+
+// Allows returns true if the policy allows an event of the given kind and
+// type in direction dir.
+func (p *Policy) Allows(dir Direction, kind targets.EventTarget, evType string) bool {
+	if matchesAny(p.Deny, kind, evType) {
+		return false
+	}
+	rules := p.Send
+	if dir == Receive {
+		rules = p.Receive
+	}
+	return rules == nil || matchesAny(rules, kind, evType)
+}
+
+// matchesAny returns true if any of rules matches both kind and evType
+func matchesAny(rules []Rule, kind targets.EventTarget, evType string) bool {
+	for _, r := range rules {
+		if matches(r.Kinds, kind.String()) && matchesEvent(r.Events, evType) {
+			return true
+		}
+	}
+	return false
+}
+
+func matches(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if p == Wildcard || strings.EqualFold(p, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesEvent is like matches, but also matches event types by their class
+func matchesEvent(patterns []string, evType string) bool {
+	if matches(patterns, strings.TrimPrefix(evType, targets.TypePrefix+".")) {
+		return true
+	}
+	for _, p := range patterns {
+		if slices.Contains(eventClasses[strings.ToLower(p)], event.EventType(evType)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Store holds the policies of all agents. It can be kept in sync with a
+// ConfigMap at runtime using WatchConfigMap. The zero value is not usable,
+// use NewStore.
+type Store struct {
+	mu       sync.RWMutex
+	policies map[string]*Policy
+}
+
+// NewStore returns a new Store without any policies, i.e. one that allows
+// all events.
+func NewStore() *Store {
+	return &Store{policies: make(map[string]*Policy)}
+}
+
+// Set sets the policy for agent. A nil policy removes the agent's policy.
+func (s *Store) Set(agent string, p *Policy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p == nil {
+		delete(s.policies, agent)
+	} else {
+		s.policies[agent] = p
+	}
+}
+
+// Check returns an error if the policy for agentName, which runs in mode, does
+// not allow ev in direction dir. The returned error satisfies
+// event.IsEventNotAllowed.
+func (s *Store) Check(agentName string, mode types.AgentMode, dir Direction, ev *cloudevents.Event) error {
+	if s == nil {
+		return nil
+	}
+	target := event.Target(ev)
+	if !slices.Contains(governedTargets, target) {
+		return nil
+	}
+	s.mu.RLock()
+	p, ok := s.policies[agentName]
+	if !ok && mode == types.AgentModeManaged {
+		p, ok = s.policies[ManagedPolicyKey]
+	} else if !ok && mode == types.AgentModeAutonomous {
+		p, ok = s.policies[AutonomousPolicyKey]
+	}
+	if !ok {
+		p, ok = s.policies[DefaultPolicyKey]
+	}
+	s.mu.RUnlock()
+	if !ok || p.Allows(dir, target, ev.Type()) {
+		return nil
+	}
+	return event.NewEventNotAllowedErr("policy of agent %s does not allow to %s %s events for %s", agentName, dir, ev.Type(), target)
+}
+
+// Load replaces all policies in the store with those parsed from data, which
+// is expected to be the data of a policy ConfigMap. Invalid policies are
+// logged, and the agent is denied all governed events until its policy is
+// fixed, rather than silently falling back to a more permissive policy.
+func (s *Store) Load(data map[string]string) {
+	policies := make(map[string]*Policy, len(data))
+	for agent, v := range data {
+		p, err := Parse(v)
+		if err != nil {
+			log().WithError(err).Errorf("Denying all events for %s due to invalid policy", agent)
+			p = &Policy{Send: []Rule{}, Receive: []Rule{}}
+		}
+		policies[agent] = p
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.policies = policies
+	log().WithField("policies", len(policies)).Info("Loaded agent policies")
+}
+
+// WatchConfigMap keeps the store in sync with the ConfigMap of the given name
+// in namespace. It starts an informer in the background, which is stopped
+// when ctx is done, and waits for the initial sync before returning.
+//
+// A ConfigMap that does not exist, or is deleted, results in an empty store.
+func (s *Store) WatchConfigMap(ctx context.Context, kubeclient kubernetes.Interface, namespace, name string) error {
+	selector := fields.OneTermEqualSelector("metadata.name", name).String()
+	inf, err := informer.NewInformer[*corev1.ConfigMap](ctx,
+		informer.WithListHandler[*corev1.ConfigMap](func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+			opts.FieldSelector = selector
+			return kubeclient.CoreV1().ConfigMaps(namespace).List(ctx, opts)
+		}),
+		informer.WithWatchHandler[*corev1.ConfigMap](func(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+			opts.FieldSelector = selector
+			return kubeclient.CoreV1().ConfigMaps(namespace).Watch(ctx, opts)
+		}),
+		informer.WithAddHandler(func(cm *corev1.ConfigMap) {
+			if cm.Name == name {
+				s.Load(cm.Data)
+			}
+		}),
+		informer.WithUpdateHandler(func(_ *corev1.ConfigMap, cm *corev1.ConfigMap) {
+			if cm.Name == name {
+				s.Load(cm.Data)
+			}
+		}),
+		informer.WithDeleteHandler(func(cm *corev1.ConfigMap) {
+			if cm.Name == name {
+				s.Load(nil)
+			}
+		}),
+		informer.WithGroupResource[*corev1.ConfigMap]("", "configmaps"),
+	)
+	if err != nil {
+		return fmt.Errorf("could not create policy informer: %w", err)
+	}
+
+	go func() {
+		if err := inf.Start(ctx); err != nil {
+			log().WithError(err).Error("Could not start policy informer")
+		}
+	}()
+
+	syncCtx, cancel := context.WithTimeout(ctx, syncTimeout)
+	defer cancel()
+	if err := inf.WaitForSync(syncCtx); err != nil {
+		return fmt.Errorf("policy informer did not sync: %w", err)
+	}
+	log().Infof("Watching ConfigMap %s/%s for agent policies", namespace, name)
+	return nil
+}
+
+func log() *logrus.Entry {
+	return logging.GetDefaultLogger().ComponentLogger("AgentPolicy")
+}
@@ -0,0 +1,171 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/internal/event"
+	"github.com/argoproj-labs/argocd-agent/internal/event/targets"
+	"github.com/argoproj-labs/argocd-agent/pkg/types"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+const statusOnly = `
+send:
+- kinds: [application]
+  events: [status-update]
+`
+
+func newEvent(target targets.EventTarget, typ event.EventType) *cloudevents.Event {
+	ev := cloudevents.NewEvent()
+	ev.SetDataSchema(target.String())
+	ev.SetType(typ.String())
+	return &ev
+}
+
+func Test_Parse(t *testing.T) {
+	t.Run("Valid policy", func(t *testing.T) {
+		p, err := Parse(statusOnly)
+		require.NoError(t, err)
+		require.Len(t, p.Send, 1)
+		assert.Equal(t, []string{"application"}, p.Send[0].Kinds)
+		assert.Nil(t, p.Receive)
+	})
+	t.Run("Unknown field", func(t *testing.T) {
+		_, err := Parse("sned: []")
+		assert.ErrorContains(t, err, "invalid policy")
+	})
+	t.Run("Rule without events", func(t *testing.T) {
+		_, err := Parse("receive:\n- kinds: [application]\n")
+		assert.ErrorContains(t, err, "at least one kind and one event")
+	})
+}
+
+func Test_Policy_Allows(t *testing.T) {
+	p, err := Parse(statusOnly + `
+receive:
+- kinds: ["*"]
+  events: [spec-update, delete]
+`)
+	require.NoError(t, err)
+	assert.True(t, p.Allows(Send, targets.Application, event.StatusUpdate.String()))
+	assert.False(t, p.Allows(Send, targets.Application, event.SpecUpdate.String()))
+	assert.False(t, p.Allows(Send, targets.AppProject, event.StatusUpdate.String()))
+	assert.True(t, p.Allows(Receive, targets.AppProject, event.Delete.String()))
+	assert.False(t, p.Allows(Receive, targets.Application, event.Create.String()))
+
+	t.Run("Omitted direction allows everything", func(t *testing.T) {
+		p, err := Parse(statusOnly)
+		require.NoError(t, err)
+		assert.True(t, p.Allows(Receive, targets.Application, event.Create.String()))
+	})
+	t.Run("Empty direction allows nothing", func(t *testing.T) {
+		p, err := Parse("receive: []")
+		require.NoError(t, err)
+		assert.False(t, p.Allows(Receive, targets.Application, event.Create.String()))
+	})
+	t.Run("Classes match their event types", func(t *testing.T) {
+		p, err := Parse("receive:\n- kinds: [\"*\"]\n  events: [spec, Operation]\n")
+		require.NoError(t, err)
+		assert.True(t, p.Allows(Receive, targets.Application, event.Create.String()))
+		assert.True(t, p.Allows(Receive, targets.Application, event.SpecUpdate.String()))
+		assert.True(t, p.Allows(Receive, targets.Application, event.TerminateOperation.String()))
+		assert.False(t, p.Allows(Receive, targets.Application, event.StatusUpdate.String()))
+		assert.False(t, p.Allows(Receive, targets.Application, event.Delete.String()))
+	})
+	t.Run("Deny rules apply to both directions", func(t *testing.T) {
+		p, err := Parse(statusOnly + "deny:\n- kinds: [\"*\"]\n  events: [delete]\n")
+		require.NoError(t, err)
+		assert.False(t, p.Allows(Receive, targets.AppProject, event.Delete.String()))
+		assert.True(t, p.Allows(Receive, targets.AppProject, event.Create.String()))
+		assert.False(t, p.Allows(Send, targets.Application, event.Delete.String()))
+		assert.True(t, p.Allows(Send, targets.Application, event.StatusUpdate.String()))
+	})
+}
+
+func Test_Store_Check(t *testing.T) {
+	t.Run("Nil and empty store allow everything", func(t *testing.T) {
+		var s *Store
+		assert.NoError(t, s.Check("agent", types.AgentModeUnknown, Send, newEvent(targets.Application, event.Create)))
+		assert.NoError(t, NewStore().Check("agent", types.AgentModeUnknown, Send, newEvent(targets.Application, event.Create)))
+	})
+
+	s := NewStore()
+	s.Load(map[string]string{
+		"agent-1":        statusOnly,
+		DefaultPolicyKey: "send: []",
+		"agent-2":        "not: [valid",
+	})
+
+	t.Run("Agent policy is used", func(t *testing.T) {
+		assert.NoError(t, s.Check("agent-1", types.AgentModeUnknown, Send, newEvent(targets.Application, event.StatusUpdate)))
+		err := s.Check("agent-1", types.AgentModeUnknown, Send, newEvent(targets.Application, event.Create))
+		assert.True(t, event.IsEventNotAllowed(err))
+	})
+	t.Run("Default policy is used", func(t *testing.T) {
+		assert.Error(t, s.Check("agent-3", types.AgentModeUnknown, Send, newEvent(targets.Application, event.StatusUpdate)))
+		assert.NoError(t, s.Check("agent-3", types.AgentModeUnknown, Receive, newEvent(targets.Application, event.Create)))
+	})
+	t.Run("Mode policy is used", func(t *testing.T) {
+		s := NewStore()
+		s.Load(map[string]string{
+			ManagedPolicyKey:    "receive:\n- kinds: [\"*\"]\n  events: [spec]\n",
+			AutonomousPolicyKey: statusOnly,
+			DefaultPolicyKey:    "send: []",
+		})
+		assert.NoError(t, s.Check("agent", types.AgentModeManaged, Receive, newEvent(targets.Application, event.SpecUpdate)))
+		assert.Error(t, s.Check("agent", types.AgentModeManaged, Receive, newEvent(targets.Application, event.Delete)))
+		assert.NoError(t, s.Check("agent", types.AgentModeManaged, Send, newEvent(targets.Application, event.StatusUpdate)))
+		assert.NoError(t, s.Check("agent", types.AgentModeAutonomous, Send, newEvent(targets.Application, event.StatusUpdate)))
+		assert.Error(t, s.Check("agent", types.AgentModeAutonomous, Send, newEvent(targets.Application, event.SpecUpdate)))
+		assert.Error(t, s.Check("agent", types.AgentModeUnknown, Send, newEvent(targets.Application, event.StatusUpdate)))
+	})
+	t.Run("Invalid policy denies everything", func(t *testing.T) {
+		assert.Error(t, s.Check("agent-2", types.AgentModeUnknown, Send, newEvent(targets.Application, event.StatusUpdate)))
+		assert.Error(t, s.Check("agent-2", types.AgentModeUnknown, Receive, newEvent(targets.AppProject, event.Create)))
+	})
+	t.Run("Ungoverned targets are always allowed", func(t *testing.T) {
+		assert.NoError(t, s.Check("agent-2", types.AgentModeUnknown, Send, newEvent(targets.Heartbeat, event.Ping)))
+		assert.NoError(t, s.Check("agent-2", types.AgentModeUnknown, Receive, newEvent(targets.EventAck, event.EventProcessed)))
+	})
+}
+
+func Test_WatchConfigMap(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	kubeclient := kubefake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "policies", Namespace: "argocd"},
+		Data:       map[string]string{"agent-1": statusOnly},
+	})
+	s := NewStore()
+	require.NoError(t, s.WatchConfigMap(ctx, kubeclient, "argocd", "policies"))
+	assert.Error(t, s.Check("agent-1", types.AgentModeUnknown, Send, newEvent(targets.Application, event.Create)))
+
+	t.Run("Delete clears the policies", func(t *testing.T) {
+		err := kubeclient.CoreV1().ConfigMaps("argocd").Delete(ctx, "policies", metav1.DeleteOptions{})
+		require.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			return s.Check("agent-1", types.AgentModeUnknown, Send, newEvent(targets.Application, event.Create)) == nil
+		}, 2*time.Second, 10*time.Millisecond)
+	})
+}
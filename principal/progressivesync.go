@@ -0,0 +1,137 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package principal
+
+import (
+	"context"
+	"time"
+
+	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// applicationSetInitiator is the user the ApplicationSet controller initiates
+// the syncs of a RollingSync progressive sync as
+const applicationSetInitiator = "applicationset-controller"
+
+// The ApplicationSet controller moves an Application of a RollingSync from
+// Pending to Progressing once the Application was reconciled and started to
+// sync after the Application became Pending. These times are reported by the
+// agent, and the time the Application became Pending is taken by the
+// ApplicationSet controller on the principal. If the clock of the agent lags
+// behind, the Application would stay Pending. Times reported by the agent that
+// precede the transition to Pending are therefore moved to the time the
+// principal receives them.
+
+// alignRolloutTimes aligns the times in the status of incoming, as reported by
+// a managed agent, with the progressive sync of the ApplicationSet that owns
+// the application on the principal. incoming must already have the namespace
+// of the application on the principal.
+func (s *Server) alignRolloutTimes(ctx context.Context, incoming *v1alpha1.Application) {
+	if s.appSetManager == nil {
+		return
+	}
+	existing, err := s.appManager.Get(ctx, incoming.Name, incoming.Namespace)
+	if err != nil {
+		return
+	}
+	owner := applicationSetOwner(existing)
+	if owner == "" || !rolloutTimesChanged(existing, incoming) {
+		return
+	}
+	appSet, err := s.appSetManager.Get(ctx, owner, existing.Namespace)
+	if err != nil {
+		log().WithError(err).WithField("applicationset", owner).Debug("Could not get ApplicationSet of application")
+		return
+	}
+	for i := range appSet.Status.ApplicationStatus {
+		if st := &appSet.Status.ApplicationStatus[i]; st.Application == existing.Name {
+			alignRolloutTimes(existing, incoming, st, time.Now())
+			return
+		}
+	}
+}
+
+// applicationSetOwner returns the name of the ApplicationSet that owns app, or
+// the empty string if app is not owned by an ApplicationSet
+func applicationSetOwner(app *v1alpha1.Application) string {
+	for _, ref := range app.OwnerReferences {
+		if ref.Kind == "ApplicationSet" && ref.Controller != nil && *ref.Controller {
+			return ref.Name
+		}
+	}
+	return ""
+}
+
+// rolloutTimesChanged returns whether incoming reports other times relevant
+// to progressive syncs than existing
+func rolloutTimesChanged(existing, incoming *v1alpha1.Application) bool {
+	if !timeEqual(existing.Status.ReconciledAt, incoming.Status.ReconciledAt) {
+		return true
+	}
+	if incoming.Status.OperationState == nil {
+		return false
+	}
+	return existing.Status.OperationState == nil ||
+		!existing.Status.OperationState.StartedAt.Equal(&incoming.Status.OperationState.StartedAt)
+}
+
+// alignRolloutTimes moves the times reported in incoming that precede the
+// transition of the application to Pending in status to now. Times already
+// aligned in existing are kept, so that they do not change with every update
+// from the agent.
+func alignRolloutTimes(existing, incoming *v1alpha1.Application, status *v1alpha1.ApplicationSetApplicationStatus, now time.Time) {
+	if status.Status != v1alpha1.ProgressiveSyncPending || status.LastTransitionTime == nil {
+		return
+	}
+	pendingSince := status.LastTransitionTime.Time
+
+	if r := incoming.Status.ReconciledAt; r != nil && !r.After(pendingSince) {
+		incoming.Status.ReconciledAt = alignedTime(existing.Status.ReconciledAt, r, pendingSince, now)
+	}
+
+	op := incoming.Status.OperationState
+	if op == nil || op.Operation.InitiatedBy.Username != applicationSetInitiator || op.StartedAt.After(pendingSince) {
+		return
+	}
+	// Only the syncs the ApplicationSet controller triggered for the
+	// progressive sync can have started after the transition to Pending
+	var existingStartedAt *metav1.Time
+	if existing.Status.OperationState != nil {
+		existingStartedAt = &existing.Status.OperationState.StartedAt
+	}
+	op.StartedAt = *alignedTime(existingStartedAt, &op.StartedAt, pendingSince, now)
+}
+
+// alignedTime returns the time to record for reported, which precedes
+// pendingSince. If the time recorded before does not precede pendingSince, it
+// has already been aligned and is returned. Otherwise, reported is new and now
+// is returned, unless reported did not change.
+func alignedTime(recorded, reported *metav1.Time, pendingSince, now time.Time) *metav1.Time {
+	if recorded != nil && recorded.After(pendingSince) {
+		return recorded.DeepCopy()
+	}
+	if recorded != nil && recorded.Equal(reported) {
+		return reported
+	}
+	return &metav1.Time{Time: now}
+}
+
+func timeEqual(a, b *metav1.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(b)
+}
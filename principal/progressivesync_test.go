@@ -0,0 +1,125 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package principal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+func Test_applicationSetOwner(t *testing.T) {
+	app := &v1alpha1.Application{}
+	assert.Equal(t, "", applicationSetOwner(app))
+	app.OwnerReferences = []metav1.OwnerReference{
+		{Kind: "ConfigMap", Name: "cm", Controller: ptr.To(true)},
+		{Kind: "ApplicationSet", Name: "guestbook", Controller: ptr.To(true)},
+	}
+	assert.Equal(t, "guestbook", applicationSetOwner(app))
+}
+
+func Test_alignRolloutTimes(t *testing.T) {
+	pendingSince := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	now := pendingSince.Add(10 * time.Second)
+	pending := &v1alpha1.ApplicationSetApplicationStatus{
+		Application:        "guestbook",
+		Status:             v1alpha1.ProgressiveSyncPending,
+		LastTransitionTime: &metav1.Time{Time: pendingSince},
+	}
+	at := func(d time.Duration) *metav1.Time {
+		return &metav1.Time{Time: pendingSince.Add(d)}
+	}
+	appWith := func(reconciledAt *metav1.Time, startedAt *metav1.Time, initiator string) *v1alpha1.Application {
+		app := &v1alpha1.Application{Status: v1alpha1.ApplicationStatus{ReconciledAt: reconciledAt}}
+		if startedAt != nil {
+			app.Status.OperationState = &v1alpha1.OperationState{
+				Operation: v1alpha1.Operation{InitiatedBy: v1alpha1.OperationInitiator{Username: initiator}},
+				StartedAt: *startedAt,
+			}
+		}
+		return app
+	}
+
+	t.Run("Lagging times of a new sync are moved to now", func(t *testing.T) {
+		existing := appWith(at(-time.Minute), at(-time.Hour), applicationSetInitiator)
+		incoming := appWith(at(-5*time.Second), at(-6*time.Second), applicationSetInitiator)
+		alignRolloutTimes(existing, incoming, pending, now)
+		assert.True(t, incoming.Status.ReconciledAt.Equal(&metav1.Time{Time: now}))
+		assert.True(t, incoming.Status.OperationState.StartedAt.Equal(&metav1.Time{Time: now}))
+	})
+
+	t.Run("Aligned times are kept", func(t *testing.T) {
+		existing := appWith(at(5*time.Second), at(5*time.Second), applicationSetInitiator)
+		incoming := appWith(at(-5*time.Second), at(-6*time.Second), applicationSetInitiator)
+		alignRolloutTimes(existing, incoming, pending, now)
+		assert.True(t, incoming.Status.ReconciledAt.Equal(at(5*time.Second)))
+		assert.True(t, incoming.Status.OperationState.StartedAt.Equal(at(5*time.Second)))
+	})
+
+	t.Run("Unchanged times are not moved", func(t *testing.T) {
+		existing := appWith(at(-time.Minute), at(-time.Hour), applicationSetInitiator)
+		incoming := appWith(at(-time.Minute), at(-time.Hour), applicationSetInitiator)
+		alignRolloutTimes(existing, incoming, pending, now)
+		assert.True(t, incoming.Status.ReconciledAt.Equal(at(-time.Minute)))
+		assert.True(t, incoming.Status.OperationState.StartedAt.Equal(at(-time.Hour)))
+	})
+
+	t.Run("Syncs not triggered by the ApplicationSet controller are not moved", func(t *testing.T) {
+		existing := appWith(nil, nil, "")
+		incoming := appWith(nil, at(-6*time.Second), "admin")
+		alignRolloutTimes(existing, incoming, pending, now)
+		assert.True(t, incoming.Status.OperationState.StartedAt.Equal(at(-6*time.Second)))
+	})
+
+	t.Run("Times after the transition are not moved", func(t *testing.T) {
+		existing := appWith(nil, nil, "")
+		incoming := appWith(at(time.Second), at(2*time.Second), applicationSetInitiator)
+		alignRolloutTimes(existing, incoming, pending, now)
+		assert.True(t, incoming.Status.ReconciledAt.Equal(at(time.Second)))
+		assert.True(t, incoming.Status.OperationState.StartedAt.Equal(at(2*time.Second)))
+	})
+
+	t.Run("Applications that are not Pending are not changed", func(t *testing.T) {
+		progressing := pending.DeepCopy()
+		progressing.Status = v1alpha1.ProgressiveSyncProgressing
+		existing := appWith(nil, nil, "")
+		incoming := appWith(at(-5*time.Second), at(-6*time.Second), applicationSetInitiator)
+		alignRolloutTimes(existing, incoming, progressing, now)
+		assert.True(t, incoming.Status.ReconciledAt.Equal(at(-5*time.Second)))
+		assert.True(t, incoming.Status.OperationState.StartedAt.Equal(at(-6*time.Second)))
+	})
+}
+
+func Test_rolloutTimesChanged(t *testing.T) {
+	t1 := &metav1.Time{Time: time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)}
+	t2 := &metav1.Time{Time: t1.Add(time.Second)}
+	assert.False(t, rolloutTimesChanged(&v1alpha1.Application{}, &v1alpha1.Application{}))
+	assert.True(t, rolloutTimesChanged(
+		&v1alpha1.Application{Status: v1alpha1.ApplicationStatus{ReconciledAt: t1}},
+		&v1alpha1.Application{Status: v1alpha1.ApplicationStatus{ReconciledAt: t2}},
+	))
+	assert.True(t, rolloutTimesChanged(
+		&v1alpha1.Application{},
+		&v1alpha1.Application{Status: v1alpha1.ApplicationStatus{OperationState: &v1alpha1.OperationState{StartedAt: *t1}}},
+	))
+	assert.False(t, rolloutTimesChanged(
+		&v1alpha1.Application{Status: v1alpha1.ApplicationStatus{ReconciledAt: t1, OperationState: &v1alpha1.OperationState{StartedAt: *t2}}},
+		&v1alpha1.Application{Status: v1alpha1.ApplicationStatus{ReconciledAt: t1.DeepCopy(), OperationState: &v1alpha1.OperationState{StartedAt: *t2}}},
+	))
+}
@@ -0,0 +1,258 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/argoproj-labs/argocd-agent/internal/argocd/cluster"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// DefaultApprovalConfigMapName is the name of the ConfigMap recording the
+// registration state of agents that is suggested in the documentation.
+const DefaultApprovalConfigMapName = "argocd-agent-registrations"
+
+// ApprovalState is the state of an agent's registration
+type ApprovalState string
+
+const (
+	// ApprovalPending is the state of agents waiting for an operator's decision
+	ApprovalPending ApprovalState = "pending"
+	// ApprovalApproved is the state of agents allowed to connect
+	ApprovalApproved ApprovalState = "approved"
+	// ApprovalDenied is the state of agents not allowed to connect
+	ApprovalDenied ApprovalState = "denied"
+)
+
+var (
+	// ErrApprovalPending is returned for agents whose registration has not
+	// been approved yet.
+	ErrApprovalPending = errors.New("agent registration is pending approval")
+	// ErrApprovalDenied is returned for agents whose registration was denied
+	ErrApprovalDenied = errors.New("agent registration was denied")
+)
+
+// Registration is the registration record of a single agent
+type Registration struct {
+	// State is the current state of the registration
+	State ApprovalState `json:"state"`
+	// RequestedAt is the time the agent first tried to connect
+	RequestedAt time.Time `json:"requestedAt,omitempty"`
+	// DecidedAt is the time an operator approved or denied the agent
+	DecidedAt *time.Time `json:"decidedAt,omitempty"`
+	// Address is the source address of the agent's first connection attempt
+	Address string `json:"address,omitempty"`
+}
+
+// ApprovalStore records the registration state of agents in a ConfigMap. Each
+// key of the ConfigMap is the name of an agent, each value a JSON encoded
+// Registration.
+//
+// Agents that are not yet known to the principal are recorded as pending when
+// they first try to connect, and are only allowed to connect once an operator
+// approved them. Agents with an existing cluster secret are considered
+// approved, so that enabling approvals does not lock out existing agents.
+type ApprovalStore struct {
+	kubeclient kubernetes.Interface
+	namespace  string
+	name       string
+	now        func() time.Time
+}
+
+// NewApprovalStore returns an ApprovalStore backed by the ConfigMap of the
+// given name in namespace. The ConfigMap is created if it does not exist.
+func NewApprovalStore(kubeclient kubernetes.Interface, namespace, name string) *ApprovalStore {
+	return &ApprovalStore{
+		kubeclient: kubeclient,
+		namespace:  namespace,
+		name:       name,
+		now:        time.Now,
+	}
+}
+
+// Get returns the registration of agentName, or nil if there is none.
+func (s *ApprovalStore) Get(ctx context.Context, agentName string) (*Registration, error) {
+	regs, err := s.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return regs[agentName], nil
+}
+
+// List returns the registrations of all agents, keyed by agent name.
+func (s *ApprovalStore) List(ctx context.Context) (map[string]*Registration, error) {
+	cm, err := s.kubeclient.CoreV1().ConfigMaps(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return map[string]*Registration{}, nil
+		}
+		return nil, fmt.Errorf("could not get registration ConfigMap: %w", err)
+	}
+	return decodeRegistrations(cm.Data), nil
+}
+
+// Check returns nil if agentName may connect. Agents without a registration
+// are recorded as pending, unless a cluster secret exists for them, in which
+// case they are recorded as approved. The returned error is ErrApprovalPending
+// or ErrApprovalDenied if the agent may not connect.
+func (s *ApprovalStore) Check(ctx context.Context, agentName, address string) error {
+	reg, err := s.Get(ctx, agentName)
+	if err != nil {
+		return err
+	}
+	if reg == nil {
+		secret, err := cluster.GetClusterSecret(ctx, s.kubeclient, s.namespace, agentName)
+		if err != nil {
+			return fmt.Errorf("could not get cluster secret: %w", err)
+		}
+		state := ApprovalPending
+		if secret != nil {
+			state = ApprovalApproved
+		}
+		reg, err = s.request(ctx, agentName, address, state)
+		if err != nil {
+			return err
+		}
+		if reg.State == ApprovalPending {
+			log().WithField("agent", agentName).WithField("address", address).Info("New agent is waiting for approval")
+		}
+	}
+	switch reg.State {
+	case ApprovalApproved:
+		return nil
+	case ApprovalDenied:
+		return ErrApprovalDenied
+	default:
+		return ErrApprovalPending
+	}
+}
+
+// IsDenied returns true if the registration of agentName was denied.
+func (s *ApprovalStore) IsDenied(ctx context.Context, agentName string) (bool, error) {
+	reg, err := s.Get(ctx, agentName)
+	if err != nil {
+		return false, err
+	}
+	return reg != nil && reg.State == ApprovalDenied, nil
+}
+
+// Approve allows agentName to connect. Agents can be approved before they
+// first try to connect.
+func (s *ApprovalStore) Approve(ctx context.Context, agentName string) error {
+	return s.decide(ctx, agentName, ApprovalApproved)
+}
+
+// Deny prevents agentName from connecting or refreshing its tokens.
+func (s *ApprovalStore) Deny(ctx context.Context, agentName string) error {
+	return s.decide(ctx, agentName, ApprovalDenied)
+}
+
+// request records a new registration for agentName in the given state, unless
+// one has been recorded concurrently, and returns the recorded registration.
+func (s *ApprovalStore) request(ctx context.Context, agentName, address string, state ApprovalState) (*Registration, error) {
+	var reg *Registration
+	err := s.update(ctx, func(regs map[string]*Registration) bool {
+		if reg = regs[agentName]; reg != nil {
+			return false
+		}
+		reg = &Registration{State: state, RequestedAt: s.now().UTC(), Address: address}
+		regs[agentName] = reg
+		return true
+	})
+	return reg, err
+}
+
+func (s *ApprovalStore) decide(ctx context.Context, agentName string, state ApprovalState) error {
+	return s.update(ctx, func(regs map[string]*Registration) bool {
+		now := s.now().UTC()
+		reg := regs[agentName]
+		if reg == nil {
+			reg = &Registration{}
+			regs[agentName] = reg
+		}
+		reg.State = state
+		reg.DecidedAt = &now
+		return true
+	})
+}
+
+// update applies fn to the registrations stored in the ConfigMap and writes
+// them back if fn returns true, creating the ConfigMap if necessary. Updates
+// are retried on conflicts.
+func (s *ApprovalStore) update(ctx context.Context, fn func(regs map[string]*Registration) bool) error {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		client := s.kubeclient.CoreV1().ConfigMaps(s.namespace)
+		cm, err := client.Get(ctx, s.name, metav1.GetOptions{})
+		create := apierrors.IsNotFound(err)
+		if err != nil && !create {
+			return err
+		}
+		if create {
+			cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: s.name, Namespace: s.namespace}}
+		}
+		regs := decodeRegistrations(cm.Data)
+		if !fn(regs) {
+			return nil
+		}
+		cm.Data = make(map[string]string, len(regs))
+		for agent, reg := range regs {
+			data, err := json.Marshal(reg)
+			if err != nil {
+				return err
+			}
+			cm.Data[agent] = string(data)
+		}
+		if create {
+			_, err = client.Create(ctx, cm, metav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(err) {
+				// Treat a concurrent creation like a conflicting update, so
+				// that we retry with the existing ConfigMap.
+				return apierrors.NewConflict(corev1.Resource("configmaps"), s.name, err)
+			}
+		} else {
+			_, err = client.Update(ctx, cm, metav1.UpdateOptions{})
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("could not update registration ConfigMap: %w", err)
+	}
+	return nil
+}
+
+// decodeRegistrations decodes the registrations in data. Values that cannot
+// be decoded are treated as pending registrations, so that they have to be
+// approved (again) by an operator.
+func decodeRegistrations(data map[string]string) map[string]*Registration {
+	regs := make(map[string]*Registration, len(data))
+	for agent, v := range data {
+		reg := &Registration{}
+		if err := json.Unmarshal([]byte(v), reg); err != nil {
+			log().WithError(err).WithField("agent", agent).Warn("Invalid registration record, treating as pending")
+			reg = &Registration{State: ApprovalPending}
+		}
+		regs[agent] = reg
+	}
+	return regs
+}
@@ -0,0 +1,140 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registration
+
+import (
+	"context"
+	"testing"
+
+	"github.com/argoproj-labs/argocd-agent/internal/argocd/cluster"
+	"github.com/argoproj-labs/argocd-agent/test/fake/kube"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_ApprovalStore(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Unknown agent is recorded as pending", func(t *testing.T) {
+		kubeclient := kube.NewFakeClientsetWithResources()
+		store := NewApprovalStore(kubeclient, testNamespace, DefaultApprovalConfigMapName)
+
+		err := store.Check(ctx, testAgentName, "192.0.2.1")
+		assert.ErrorIs(t, err, ErrApprovalPending)
+
+		reg, err := store.Get(ctx, testAgentName)
+		require.NoError(t, err)
+		require.NotNil(t, reg)
+		assert.Equal(t, ApprovalPending, reg.State)
+		assert.Equal(t, "192.0.2.1", reg.Address)
+		assert.False(t, reg.RequestedAt.IsZero())
+		assert.Nil(t, reg.DecidedAt)
+
+		// Subsequent attempts keep the original record
+		err = store.Check(ctx, testAgentName, "192.0.2.2")
+		assert.ErrorIs(t, err, ErrApprovalPending)
+		reg, err = store.Get(ctx, testAgentName)
+		require.NoError(t, err)
+		assert.Equal(t, "192.0.2.1", reg.Address)
+	})
+
+	t.Run("Approved agent may connect", func(t *testing.T) {
+		kubeclient := kube.NewFakeClientsetWithResources()
+		store := NewApprovalStore(kubeclient, testNamespace, DefaultApprovalConfigMapName)
+
+		assert.ErrorIs(t, store.Check(ctx, testAgentName, ""), ErrApprovalPending)
+		require.NoError(t, store.Approve(ctx, testAgentName))
+		assert.NoError(t, store.Check(ctx, testAgentName, ""))
+
+		reg, err := store.Get(ctx, testAgentName)
+		require.NoError(t, err)
+		assert.Equal(t, ApprovalApproved, reg.State)
+		assert.NotNil(t, reg.DecidedAt)
+		assert.False(t, reg.RequestedAt.IsZero())
+	})
+
+	t.Run("Agent can be approved before it connects", func(t *testing.T) {
+		kubeclient := kube.NewFakeClientsetWithResources()
+		store := NewApprovalStore(kubeclient, testNamespace, DefaultApprovalConfigMapName)
+
+		require.NoError(t, store.Approve(ctx, testAgentName))
+		assert.NoError(t, store.Check(ctx, testAgentName, ""))
+	})
+
+	t.Run("Denied agent may not connect", func(t *testing.T) {
+		kubeclient := kube.NewFakeClientsetWithResources()
+		store := NewApprovalStore(kubeclient, testNamespace, DefaultApprovalConfigMapName)
+
+		require.NoError(t, store.Approve(ctx, testAgentName))
+		require.NoError(t, store.Deny(ctx, testAgentName))
+		assert.ErrorIs(t, store.Check(ctx, testAgentName, ""), ErrApprovalDenied)
+		denied, err := store.IsDenied(ctx, testAgentName)
+		require.NoError(t, err)
+		assert.True(t, denied)
+
+		denied, err = store.IsDenied(ctx, "other-agent")
+		require.NoError(t, err)
+		assert.False(t, denied)
+	})
+
+	t.Run("Agent with existing cluster secret is approved", func(t *testing.T) {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      cluster.GetClusterSecretName(testAgentName),
+				Namespace: testNamespace,
+			},
+		}
+		kubeclient := kube.NewFakeClientsetWithResources(secret)
+		store := NewApprovalStore(kubeclient, testNamespace, DefaultApprovalConfigMapName)
+
+		assert.NoError(t, store.Check(ctx, testAgentName, ""))
+		reg, err := store.Get(ctx, testAgentName)
+		require.NoError(t, err)
+		assert.Equal(t, ApprovalApproved, reg.State)
+	})
+
+	t.Run("Invalid records are treated as pending", func(t *testing.T) {
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: DefaultApprovalConfigMapName, Namespace: testNamespace},
+			Data:       map[string]string{testAgentName: "approved"},
+		}
+		kubeclient := kube.NewFakeClientsetWithResources(cm)
+		store := NewApprovalStore(kubeclient, testNamespace, DefaultApprovalConfigMapName)
+
+		assert.ErrorIs(t, store.Check(ctx, testAgentName, ""), ErrApprovalPending)
+	})
+
+	t.Run("List returns all registrations", func(t *testing.T) {
+		kubeclient := kube.NewFakeClientsetWithResources()
+		store := NewApprovalStore(kubeclient, testNamespace, DefaultApprovalConfigMapName)
+
+		regs, err := store.List(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, regs)
+
+		_ = store.Check(ctx, "agent-1", "")
+		require.NoError(t, store.Approve(ctx, "agent-2"))
+		require.NoError(t, store.Deny(ctx, "agent-3"))
+
+		regs, err = store.List(ctx)
+		require.NoError(t, err)
+		require.Len(t, regs, 3)
+		assert.Equal(t, ApprovalPending, regs["agent-1"].State)
+		assert.Equal(t, ApprovalApproved, regs["agent-2"].State)
+		assert.Equal(t, ApprovalDenied, regs["agent-3"].State)
+	})
+}
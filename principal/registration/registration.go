@@ -21,6 +21,7 @@ import (
 	"github.com/argoproj-labs/argocd-agent/internal/argocd/cluster"
 	"github.com/argoproj-labs/argocd-agent/internal/issuer"
 	"github.com/argoproj-labs/argocd-agent/internal/logging"
+	"github.com/argoproj/argo-cd/v3/util/glob"
 	"github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes"
@@ -33,6 +34,9 @@ type AgentRegistrationManager struct {
 	clientCertSecretName         string
 	kubeclient                   kubernetes.Interface
 	issuer                       issuer.Issuer
+	// allowedLabels are the glob patterns of the label keys agents may
+	// request on their cluster secrets
+	allowedLabels []string
 }
 
 func NewAgentRegistrationManager(selfAgentRegistrationEnabled bool, namespace, resourceProxyAddress, clientCertSecretName string,
@@ -47,14 +51,23 @@ func NewAgentRegistrationManager(selfAgentRegistrationEnabled bool, namespace, r
 	}
 }
 
+// WithAllowedLabels sets the glob patterns of the label keys agents may
+// request on their cluster secrets. By default, agents cannot request any.
+func (mgr *AgentRegistrationManager) WithAllowedLabels(patterns []string) *AgentRegistrationManager {
+	mgr.allowedLabels = patterns
+	return mgr
+}
+
 // RegisterAgent checks if a cluster secret exists for the agent and creates/updates if needed.
 // If the secret exists but the token is invalid (e.g., signing key rotated), it will be refreshed.
-func (mgr *AgentRegistrationManager) RegisterAgent(ctx context.Context, agentName string) error {
+// The labels requested by the agent are applied to the secret as far as they are allowed.
+func (mgr *AgentRegistrationManager) RegisterAgent(ctx context.Context, agentName string, labels map[string]string) error {
 	if !mgr.selfAgentRegistrationEnabled {
 		return nil
 	}
 
 	logCtx := log().WithField("agent", agentName)
+	labels = mgr.allowedAgentLabels(logCtx, labels)
 
 	// Get cluster secret if it exists
 	existingSecret, err := cluster.GetClusterSecret(ctx, mgr.kubeclient, mgr.namespace, agentName)
@@ -90,7 +103,7 @@ func (mgr *AgentRegistrationManager) RegisterAgent(ctx context.Context, agentNam
 				logCtx.Info("Cluster TLS data refreshed successfully")
 			}
 			logCtx.Debug("Cluster secret already exists with valid token")
-			return nil
+			return mgr.updateAgentLabels(ctx, agentName, labels)
 		}
 
 		// Token is invalid, update it
@@ -113,19 +126,55 @@ func (mgr *AgentRegistrationManager) RegisterAgent(ctx context.Context, agentNam
 		}
 
 		logCtx.Info("Cluster bearer token refreshed successfully")
-		return nil
+		return mgr.updateAgentLabels(ctx, agentName, labels)
 	}
 
 	// Create new cluster secret
 	logCtx.Info("Creating self-registered cluster secret for agent")
 
-	if err := cluster.CreateClusterWithBearerToken(ctx, mgr.kubeclient, mgr.namespace, agentName, mgr.resourceProxyAddress, mgr.issuer, mgr.clientCertSecretName); err != nil {
+	if err := cluster.CreateClusterWithBearerToken(ctx, mgr.kubeclient, mgr.namespace, agentName, mgr.resourceProxyAddress, mgr.issuer, mgr.clientCertSecretName, labels); err != nil {
 		return fmt.Errorf("failed to create self-registered cluster secret: %w", err)
 	}
 
 	return nil
 }
 
+// updateAgentLabels brings the labels requested by the agent on its existing
+// cluster secret up to date
+func (mgr *AgentRegistrationManager) updateAgentLabels(ctx context.Context, agentName string, labels map[string]string) error {
+	// Previous updates change the resource version of the secret, so the
+	// latest one must be used
+	secret, err := cluster.GetClusterSecret(ctx, mgr.kubeclient, mgr.namespace, agentName)
+	if err != nil {
+		return fmt.Errorf("could not get cluster secret: %w", err)
+	}
+	if secret == nil {
+		return fmt.Errorf("cluster secret disappeared during registration")
+	}
+	updated, err := cluster.UpdateClusterAgentLabelsFromSecret(ctx, mgr.kubeclient, mgr.namespace, agentName, secret, labels)
+	if err != nil {
+		return fmt.Errorf("failed to update cluster labels: %w", err)
+	}
+	if updated {
+		log().WithField("agent", agentName).Info("Cluster labels updated successfully")
+	}
+	return nil
+}
+
+// allowedAgentLabels returns the labels requested by an agent that it may
+// set on its cluster secret
+func (mgr *AgentRegistrationManager) allowedAgentLabels(logCtx *logrus.Entry, labels map[string]string) map[string]string {
+	allowed := make(map[string]string, len(labels))
+	for k, v := range labels {
+		if cluster.IsReservedLabel(k) || !glob.MatchStringInList(mgr.allowedLabels, k, glob.GLOB) {
+			logCtx.WithField("label", k).Warn("Ignoring cluster label the agent is not allowed to set")
+			continue
+		}
+		allowed[k] = v
+	}
+	return allowed
+}
+
 // validateClusterTokenFromSecret checks if the cluster secret has a valid bearer token.
 func (mgr *AgentRegistrationManager) validateClusterTokenFromSecret(secret *corev1.Secret, agentName string) (bool, error) {
 	token, err := cluster.GetBearerTokenFromSecret(secret)
@@ -130,7 +130,7 @@ func Test_RegisterAgent(t *testing.T) {
 		iss := createMockIssuer(t)
 		mgr := NewAgentRegistrationManager(false, testNamespace, testResourceProxyAddr, "", kubeclient, iss)
 
-		err := mgr.RegisterAgent(context.Background(), testAgentName)
+		err := mgr.RegisterAgent(context.Background(), testAgentName, nil)
 
 		assert.NoError(t, err)
 
@@ -152,7 +152,7 @@ func Test_RegisterAgent(t *testing.T) {
 
 		mgr := NewAgentRegistrationManager(true, testNamespace, testResourceProxyAddr, clientCertSecretName, kubeclient, iss)
 
-		err := mgr.RegisterAgent(context.Background(), testAgentName)
+		err := mgr.RegisterAgent(context.Background(), testAgentName, nil)
 
 		require.NoError(t, err)
 
@@ -175,7 +175,7 @@ func Test_RegisterAgent(t *testing.T) {
 
 		mgr := NewAgentRegistrationManager(true, testNamespace, testResourceProxyAddr, "nonexistent-secret", kubeclient, iss)
 
-		err := mgr.RegisterAgent(context.Background(), testAgentName)
+		err := mgr.RegisterAgent(context.Background(), testAgentName, nil)
 
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "failed to create self-registered cluster secret")
@@ -191,7 +191,7 @@ func Test_RegisterAgent(t *testing.T) {
 
 		mgr := NewAgentRegistrationManager(true, testNamespace, testResourceProxyAddr, clientCertSecretName, kubeclient, iss)
 
-		err := mgr.RegisterAgent(context.Background(), agentName)
+		err := mgr.RegisterAgent(context.Background(), agentName, nil)
 
 		require.NoError(t, err)
 
@@ -226,7 +226,7 @@ func Test_RegisterAgent(t *testing.T) {
 
 		mgr := NewAgentRegistrationManager(true, testNamespace, testResourceProxyAddr, clientCertSecretName, kubeclient, iss)
 
-		err := mgr.RegisterAgent(context.Background(), testAgentName)
+		err := mgr.RegisterAgent(context.Background(), testAgentName, nil)
 
 		require.NoError(t, err)
 
@@ -275,11 +275,11 @@ func Test_RegisterCluster_TokenValidation(t *testing.T) {
 		mgr := NewAgentRegistrationManager(true, testNamespace, testResourceProxyAddr, clientCertSecretName, kubeclient, iss)
 
 		// First registration - creates secret
-		err := mgr.RegisterAgent(context.Background(), testAgentName)
+		err := mgr.RegisterAgent(context.Background(), testAgentName, nil)
 		require.NoError(t, err)
 
 		// Second registration - should skip because token is valid
-		err = mgr.RegisterAgent(context.Background(), testAgentName)
+		err = mgr.RegisterAgent(context.Background(), testAgentName, nil)
 		require.NoError(t, err)
 	})
 
@@ -296,7 +296,7 @@ func Test_RegisterCluster_TokenValidation(t *testing.T) {
 
 		mgr := NewAgentRegistrationManager(true, testNamespace, testResourceProxyAddr, clientCertSecretName, kubeclient, iss)
 
-		err := mgr.RegisterAgent(context.Background(), testAgentName)
+		err := mgr.RegisterAgent(context.Background(), testAgentName, nil)
 		require.NoError(t, err)
 
 		tlsSecret, err := kubeclient.CoreV1().Secrets(testNamespace).Get(context.Background(), clientCertSecretName, metav1.GetOptions{})
@@ -307,7 +307,7 @@ func Test_RegisterCluster_TokenValidation(t *testing.T) {
 		_, err = kubeclient.CoreV1().Secrets(testNamespace).Update(context.Background(), tlsSecret, metav1.UpdateOptions{})
 		require.NoError(t, err)
 
-		err = mgr.RegisterAgent(context.Background(), testAgentName)
+		err = mgr.RegisterAgent(context.Background(), testAgentName, nil)
 		require.NoError(t, err)
 
 		secret, err := kubeclient.CoreV1().Secrets(testNamespace).Get(context.Background(), cluster.GetClusterSecretName(testAgentName), metav1.GetOptions{})
@@ -335,11 +335,11 @@ func Test_RegisterCluster_TokenValidation(t *testing.T) {
 		mgr := NewAgentRegistrationManager(true, testNamespace, testResourceProxyAddr, clientCertSecretName, kubeclient, iss)
 
 		// First registration - creates secret
-		err := mgr.RegisterAgent(context.Background(), testAgentName)
+		err := mgr.RegisterAgent(context.Background(), testAgentName, nil)
 		require.NoError(t, err)
 
 		// Second registration - token validation fails, should refresh
-		err = mgr.RegisterAgent(context.Background(), testAgentName)
+		err = mgr.RegisterAgent(context.Background(), testAgentName, nil)
 		require.NoError(t, err)
 	})
 
@@ -353,7 +353,7 @@ func Test_RegisterCluster_TokenValidation(t *testing.T) {
 
 		mgr := NewAgentRegistrationManager(true, testNamespace, testResourceProxyAddr, clientCertSecretName, kubeclient, iss)
 
-		err := mgr.RegisterAgent(context.Background(), testAgentName)
+		err := mgr.RegisterAgent(context.Background(), testAgentName, nil)
 		require.NoError(t, err)
 
 		tlsSecret, err := kubeclient.CoreV1().Secrets(testNamespace).Get(context.Background(), clientCertSecretName, metav1.GetOptions{})
@@ -405,7 +405,7 @@ func Test_RegisterCluster_TokenValidation(t *testing.T) {
 			}
 		})
 
-		err = mgr.RegisterAgent(context.Background(), testAgentName)
+		err = mgr.RegisterAgent(context.Background(), testAgentName, nil)
 		require.NoError(t, err)
 		assert.Equal(t, 2, updateCount)
 	})
@@ -426,11 +426,83 @@ func Test_RegisterCluster_TokenValidation(t *testing.T) {
 		mgr := NewAgentRegistrationManager(true, testNamespace, testResourceProxyAddr, clientCertSecretName, kubeclient, iss)
 
 		// First registration - creates secret
-		err := mgr.RegisterAgent(context.Background(), testAgentName)
+		err := mgr.RegisterAgent(context.Background(), testAgentName, nil)
 		require.NoError(t, err)
 
 		// Second registration - subject mismatch, should refresh
-		err = mgr.RegisterAgent(context.Background(), testAgentName)
+		err = mgr.RegisterAgent(context.Background(), testAgentName, nil)
 		require.NoError(t, err)
 	})
 }
+
+func Test_RegisterAgentLabels(t *testing.T) {
+	getSecret := func(t *testing.T, kubeclient kubernetes.Interface) *corev1.Secret {
+		t.Helper()
+		secret, err := kubeclient.CoreV1().Secrets(testNamespace).Get(context.Background(), cluster.GetClusterSecretName(testAgentName), metav1.GetOptions{})
+		require.NoError(t, err)
+		return secret
+	}
+	newManager := func(t *testing.T) (*AgentRegistrationManager, kubernetes.Interface) {
+		t.Helper()
+		kubeclient := kube.NewFakeClientsetWithResources()
+		clientCertSecretName := createTestClientCertSecret(t, kubeclient)
+		iss := issuermocks.NewIssuer(t)
+		iss.On("IssueResourceProxyToken", testAgentName).Return("valid-token", nil)
+		mockClaims := issuermocks.NewClaims(t)
+		mockClaims.On("GetSubject").Return(testAgentName, nil).Maybe()
+		iss.On("ValidateResourceProxyToken", "valid-token").Return(mockClaims, nil).Maybe()
+		mgr := NewAgentRegistrationManager(true, testNamespace, testResourceProxyAddr, clientCertSecretName, kubeclient, iss).
+			WithAllowedLabels([]string{"region", "example.com/*", "argocd-agent.argoproj-labs.io/*"})
+		return mgr, kubeclient
+	}
+
+	t.Run("Only allowed labels are applied on creation", func(t *testing.T) {
+		mgr, kubeclient := newManager(t)
+		err := mgr.RegisterAgent(context.Background(), testAgentName, map[string]string{
+			"region":                            "eu",
+			"example.com/tier":                  "prod",
+			"team":                              "platform",
+			cluster.LabelKeyClusterAgentMapping: "other-agent",
+		})
+		require.NoError(t, err)
+
+		secret := getSecret(t, kubeclient)
+		assert.Equal(t, "eu", secret.Labels["region"])
+		assert.Equal(t, "prod", secret.Labels["example.com/tier"])
+		assert.NotContains(t, secret.Labels, "team")
+		assert.Equal(t, testAgentName, secret.Labels[cluster.LabelKeyClusterAgentMapping])
+		assert.Equal(t, "true", secret.Labels[cluster.LabelKeySelfRegisteredCluster])
+		assert.Equal(t, "example.com/tier,region", secret.Annotations[cluster.AnnotationKeyAgentLabels])
+	})
+
+	t.Run("Labels are updated on registration of existing secret", func(t *testing.T) {
+		mgr, kubeclient := newManager(t)
+		require.NoError(t, mgr.RegisterAgent(context.Background(), testAgentName, map[string]string{"region": "eu", "example.com/tier": "prod"}))
+
+		// Labels set by others are left alone
+		secret := getSecret(t, kubeclient)
+		secret.Labels["owner"] = "admin"
+		_, err := kubeclient.CoreV1().Secrets(testNamespace).Update(context.Background(), secret, metav1.UpdateOptions{})
+		require.NoError(t, err)
+
+		require.NoError(t, mgr.RegisterAgent(context.Background(), testAgentName, map[string]string{"region": "us"}))
+		secret = getSecret(t, kubeclient)
+		assert.Equal(t, "us", secret.Labels["region"])
+		assert.NotContains(t, secret.Labels, "example.com/tier")
+		assert.Equal(t, "admin", secret.Labels["owner"])
+		assert.Equal(t, "region", secret.Annotations[cluster.AnnotationKeyAgentLabels])
+
+		require.NoError(t, mgr.RegisterAgent(context.Background(), testAgentName, nil))
+		secret = getSecret(t, kubeclient)
+		assert.NotContains(t, secret.Labels, "region")
+		assert.NotContains(t, secret.Annotations, cluster.AnnotationKeyAgentLabels)
+		assert.Equal(t, "true", secret.Labels[cluster.LabelKeySelfRegisteredCluster])
+	})
+
+	t.Run("No labels are allowed by default", func(t *testing.T) {
+		mgr, kubeclient := newManager(t)
+		mgr.WithAllowedLabels(nil)
+		require.NoError(t, mgr.RegisterAgent(context.Background(), testAgentName, map[string]string{"region": "eu"}))
+		assert.NotContains(t, getSecret(t, kubeclient).Labels, "region")
+	})
+}
@@ -17,19 +17,29 @@ package principal
 import (
 	context "context"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"net"
 	"net/http"
+	"os"
 	"regexp"
 	goruntime "runtime"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	cloudevents "github.com/cloudevents/sdk-go/v2"
 	grpcprom "github.com/grpc-ecosystem/go-grpc-middleware/providers/prometheus"
 
 	"github.com/argoproj-labs/argocd-agent/internal/argocd/cluster"
 	"github.com/argoproj-labs/argocd-agent/internal/auth"
+	"github.com/argoproj-labs/argocd-agent/internal/auth/bootstrap"
+	"github.com/argoproj-labs/argocd-agent/internal/auth/oidc"
+	"github.com/argoproj-labs/argocd-agent/internal/auth/psk"
 	"github.com/argoproj-labs/argocd-agent/internal/backend"
 	kubeapp "github.com/argoproj-labs/argocd-agent/internal/backend/kubernetes/application"
 	kubeappset "github.com/argoproj-labs/argocd-agent/internal/backend/kubernetes/applicationset"
@@ -39,9 +49,11 @@ import (
 	kuberepository "github.com/argoproj-labs/argocd-agent/internal/backend/kubernetes/repository"
 	"github.com/argoproj-labs/argocd-agent/internal/cache"
 	"github.com/argoproj-labs/argocd-agent/internal/config"
+	"github.com/argoproj-labs/argocd-agent/internal/connlimit"
 	"github.com/argoproj-labs/argocd-agent/internal/event"
 	"github.com/argoproj-labs/argocd-agent/internal/filter"
 	"github.com/argoproj-labs/argocd-agent/internal/informer"
+	"github.com/argoproj-labs/argocd-agent/internal/ipfilter"
 	"github.com/argoproj-labs/argocd-agent/internal/issuer"
 	"github.com/argoproj-labs/argocd-agent/internal/kube"
 	"github.com/argoproj-labs/argocd-agent/internal/logging"
@@ -58,11 +70,15 @@ import (
 	"github.com/argoproj-labs/argocd-agent/internal/tlsutil"
 	"github.com/argoproj-labs/argocd-agent/internal/tracing"
 	"github.com/argoproj-labs/argocd-agent/internal/version"
+	"github.com/argoproj-labs/argocd-agent/pkg/api/grpc/queueadminapi"
 	principalIdentity "github.com/argoproj-labs/argocd-agent/pkg/principal"
 	"github.com/argoproj-labs/argocd-agent/pkg/types"
+	"github.com/argoproj-labs/argocd-agent/principal/agentstore"
 	"github.com/argoproj-labs/argocd-agent/principal/apis/eventstream"
 	logstream "github.com/argoproj-labs/argocd-agent/principal/apis/logstreamapi"
+	"github.com/argoproj-labs/argocd-agent/principal/apis/queueadmin"
 	"github.com/argoproj-labs/argocd-agent/principal/apis/terminalstream"
+	"github.com/argoproj-labs/argocd-agent/principal/policy"
 	"github.com/argoproj-labs/argocd-agent/principal/redisproxy"
 	"github.com/argoproj-labs/argocd-agent/principal/registration"
 	"github.com/argoproj-labs/argocd-agent/principal/resourceproxy"
@@ -70,9 +86,13 @@ import (
 	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
 	"github.com/argoproj/argo-cd/v3/util/glob"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+	"github.com/redis/go-redis/v9/maintnotifications"
 	"github.com/sirupsen/logrus"
 	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/crypto/acme"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -80,14 +100,27 @@ import (
 	k8stypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
 )
 
 type Server struct {
 	options     *ServerOptions
 	tlsConfig   *tls.Config
 	tlsConfigMu sync.RWMutex
+	// tlsReloader holds the server's TLS certificate, which may be replaced
+	// while the server is running
+	tlsReloader *tlsutil.CertificateReloader
+	// sniReloaders hold the additional certificates selected by SNI, in the
+	// order of options.sniKeyPairs
+	sniReloaders []*tlsutil.CertificateReloader
+	// clientCAReloader holds the dedicated client CA pool, if configured
+	clientCAReloader *tlsutil.CertPoolReloader
 	// listener contains GRPC server listener
 	listener *Listener
+	// additionalListeners are the listeners bound in addition to listener
+	additionalListeners []*Listener
+	// quicListener accepts agents connecting over QUIC, if enabled
+	quicListener net.Listener
 	// server is not currently used
 	server      *http.Server
 	grpcServer  *grpc.Server
@@ -98,6 +131,8 @@ type Server struct {
 	// namespace is the namespace the server will use for configuration. Set only when running out of cluster.
 	namespace      string
 	issuer         issuer.Issuer
+	revocations    *issuer.RevocationList
+	policies       *policy.Store
 	noauth         map[string]bool // noauth contains endpoints accessible without authentication
 	ctx            context.Context
 	ctxCancel      context.CancelFunc
@@ -115,10 +150,14 @@ type Server struct {
 
 	repoManager   *repository.RepositoryManager
 	gpgKeyManager *gpgkey.GPGKeyManager
+	// argoCDConfigInformer watches the Argo CD configuration ConfigMaps with
+	// keys to push to managed agents. It is nil if no keys are pushed.
+	argoCDConfigInformer *informer.Informer[*corev1.ConfigMap]
+	// argoCDSecretInformer watches the Argo CD Secrets with keys to push to
+	// managed agents. It is nil if no keys are pushed.
+	argoCDSecretInformer *informer.Informer[*corev1.Secret]
 	// At present, 'watchLock' is only acquired on calls to 'updateAppCallback'. This behaviour was added as a short-term attempt to preserve update event ordering. However, this is known to be problematic due to the potential for race conditions, both within itself, and between other event processors like deleteAppCallback.
 	watchLock sync.RWMutex
-	// clientMap is not currently used
-	clientMap map[string]string
 	// namespaceMap keeps track of which local namespaces are managed by agents using which mode
 	// The key of namespaceMap is the client id which the agent used to authenticate with principal, via AuthSubject.ClientID (which, it is also assumed here, corresponds to a control plane namespace of the same name)
 	// NOTE: clientLock should be owned before accessing namespaceMap
@@ -128,6 +167,18 @@ type Server struct {
 	agentNamespaces map[string]string
 	// clientLock should be owned before accessing namespaceMap or agentNamespaces
 	clientLock sync.RWMutex
+	// agentStore persists namespaceMap and agentNamespaces, if configured
+	agentStore *agentstore.Store
+	// ipFilter filters incoming connections by source address, if configured
+	ipFilter *ipfilter.Filter
+	// connLimiter limits the number of open agent connections, if configured
+	connLimiter *connlimit.Limiter
+	// streamLimiter rejects streams beyond the limit per connection, if
+	// configured to do so
+	streamLimiter *connlimit.StreamLimiter
+	// sequences tracks the sequence numbers of the events received from each
+	// agent
+	sequences *agentSequences
 	// events is used to construct events to pass on the wire to connected agents.
 	events     *event.EventSource
 	version    *version.Version
@@ -166,6 +217,14 @@ type Server struct {
 	// Minimum time duration for agent to wait before sending next keepalive ping to principal
 	// if agent sends ping more often than specified interval then connection will be dropped
 	keepAliveMinimumInterval time.Duration
+	// keepAlivePermitWithoutStream allows agents to send keepalive pings even
+	// when there are no active streams on the connection
+	keepAlivePermitWithoutStream bool
+	// keepAliveTime is the interval after which the principal pings an idle
+	// agent connection, and keepAliveTimeout is how long it waits for the ack
+	// before closing the connection
+	keepAliveTime    time.Duration
+	keepAliveTimeout time.Duration
 	// resources is a map of all resource keys for each agent
 	resources *resources.AgentResources
 	// resyncStatus indicates whether an agent has been resyned after the principal restarts
@@ -184,6 +243,11 @@ type Server struct {
 	// deletions tracks valid deletions from the source.
 	// This is used to differentiate between valid and invalid deletions
 	deletions *manager.DeletionTracker
+	// tombstones remembers the deleted Applications for incremental resyncs
+	tombstones *appTombstones
+	// orphans tracks the pending cleanups of the applications of agents whose
+	// cluster mapping was removed
+	orphans   orphanCleanup
 	logStream *logstream.Server
 
 	// terminalStreamServer handles bidirectional streaming for web terminal sessions
@@ -211,6 +275,14 @@ type Server struct {
 	// detect principal transitions without relying on annotations that AppSet
 	// may wipe.
 	principalUID string
+
+	// healthSrv serves the gRPC health checking protocol
+	healthSrv *health.Server
+	// queueAdminServer is the localhost-only gRPC server for QueueAdmin
+	queueAdminServer *grpc.Server
+	// eventProcessorSeen is the time in nanoseconds the event processor last
+	// completed a loop
+	eventProcessorSeen atomic.Int64
 }
 
 type handlersOnConnect func(agent types.Agent) error
@@ -221,6 +293,9 @@ var noAuthEndpoints = map[string]bool{
 	"/versionapi.Version/Version":          true,
 	"/authapi.Authentication/Authenticate": true,
 	"/authapi.Authentication/RefreshToken": true,
+	"/grpc.health.v1.Health/Check":         true,
+	"/grpc.health.v1.Health/List":          true,
+	"/grpc.health.v1.Health/Watch":         true,
 }
 
 var metricsRegistered sync.Once
@@ -236,12 +311,12 @@ const defaultRedisProxyListenerAddr = "0.0.0.0:6379"
 func NewServer(ctx context.Context, kubeClient *kube.KubernetesClient, namespace string, opts ...ServerOption) (*Server, error) {
 	s := &Server{
 		options:         defaultOptions(),
-		queues:          queue.NewSendRecvQueues(),
 		namespace:       namespace,
 		noauth:          noAuthEndpoints,
 		version:         version.New("argocd-agent"),
 		kubeClient:      kubeClient,
 		resyncStatus:    newResyncStatus(),
+		sequences:       newAgentSequences(),
 		resources:       resources.NewAgentResources(),
 		notifyOnConnect: make(chan types.Agent),
 		eventWriters:    event.NewEventWritersMap(),
@@ -249,8 +324,10 @@ func NewServer(ctx context.Context, kubeClient *kube.KubernetesClient, namespace
 		projectToRepos:  NewMapToSet(),
 		sourceCache:     cache.NewSourceCache(),
 		deletions:       manager.NewDeletionTracker(),
+		tombstones:      newAppTombstones(),
 		appToAgent:      newConcurrentStringMap(),
 		agentNamespaces: make(map[string]string),
+		healthSrv:       newHealthServer(),
 	}
 
 	s.ctx, s.ctxCancel = context.WithCancel(ctx)
@@ -272,6 +349,31 @@ func NewServer(ctx context.Context, kubeClient *kube.KubernetesClient, namespace
 		})
 	}
 
+	queueOpts := []queue.SendRecvQueuesOption{
+		queue.WithLimits(s.options.queueLimits),
+		queue.WithUpdateCoalescing(s.options.coalesceUpdates),
+		queue.WithOverflowHandler(s.onQueueOverflow),
+		queue.WithTTLs(s.options.queueTTLs),
+		queue.WithExpiryHandler(s.onQueueExpiry),
+	}
+	if s.metrics != nil {
+		queueOpts = append(queueOpts, queue.WithObserver(s.metrics.AgentQueues))
+	}
+	if s.options.queueStorageDir != "" {
+		queueOpts = append(queueOpts, queue.WithStorageDir(s.options.queueStorageDir))
+	}
+	if s.options.queueBackend == QueueBackendRedis {
+		if s.options.queueStorageDir != "" {
+			return nil, fmt.Errorf("queue storage directory cannot be used with the %s queue backend", QueueBackendRedis)
+		}
+		redisOpt, err := s.newQueueRedisOption()
+		if err != nil {
+			return nil, err
+		}
+		queueOpts = append(queueOpts, redisOpt)
+	}
+	s.queues = queue.NewSendRecvQueues(queueOpts...)
+
 	if s.options.resourceProxyLogger == nil {
 		s.options.resourceProxyLogger = logging.GetDefaultLogger()
 	}
@@ -284,6 +386,18 @@ func NewServer(ctx context.Context, kubeClient *kube.KubernetesClient, namespace
 		s.options.grpcEventLogger = logging.GetDefaultLogger()
 	}
 
+	// Events larger than the gRPC message size are rejected by gRPC before
+	// they reach us, so larger payload limits would never take effect.
+	if limit := s.options.payloadLimits.Max(); limit > s.options.maxGRPCMessageSize {
+		return nil, fmt.Errorf("event payload limit of %d bytes exceeds the maximum gRPC message size of %d bytes", limit, s.options.maxGRPCMessageSize)
+	}
+
+	// Orphaned applications are looked up in the namespace of their agent,
+	// which is not where they live with destination-based mapping.
+	if s.options.orphanedAppPolicy != OrphanedAppPolicyNone && s.options.destinationBasedMapping {
+		return nil, fmt.Errorf("orphaned application policy %s cannot be used with destination-based mapping", s.options.orphanedAppPolicy)
+	}
+
 	// Validate TLS options after all options have been applied
 	if err := tlsutil.ValidateTLSConfig(s.options.tlsMinVersion, s.options.tlsMaxVersion, s.options.tlsCiphers); err != nil {
 		return nil, err
@@ -299,16 +413,55 @@ func NewServer(ctx context.Context, kubeClient *kube.KubernetesClient, namespace
 		s.authMethods = auth.NewMethods()
 	}
 
+	if s.options.oidcConfig != nil {
+		oidcAuth := oidc.NewOIDCAuthentication(*s.options.oidcConfig)
+		if err := oidcAuth.Init(); err != nil {
+			return nil, fmt.Errorf("could not initialize oidc auth method: %w", err)
+		}
+		if err := s.authMethods.RegisterMethod("oidc", oidcAuth); err != nil {
+			return nil, err
+		}
+	}
+
 	var err error
 
 	if s.options.signingKey == nil {
 		return nil, fmt.Errorf("unexpected missing JWT signing key")
 	}
+	if s.options.signingKeyGenerated {
+		if s.options.strictKeyPolicy {
+			return nil, fmt.Errorf("refusing to use a volatile JWT signing key: a persistent signing key is required")
+		}
+		if s.metrics != nil {
+			s.metrics.VolatileSigningKey.Set(1)
+		}
+	}
 
-	s.issuer, err = issuer.NewIssuer("argocd-agent-server", issuer.WithRSAPrivateKey(s.options.signingKey))
+	s.issuer, err = issuer.NewIssuer(issuer.PrincipalIssuerName,
+		issuer.WithPrivateKey(s.options.signingKey),
+		issuer.WithVerificationKeys(s.options.verificationKeys...))
 	if err != nil {
 		return nil, err
 	}
+	s.revocations = issuer.NewRevocationList()
+	s.policies = policy.NewStore()
+	if s.options.ipFilterRules != nil || s.options.ipFilterConfigMap != "" {
+		s.ipFilter = ipfilter.NewFilter(s.options.ipFilterRules)
+	}
+	s.connLimiter = connlimit.NewLimiter(s.options.maxConnections, s.options.limitPolicy, s.connLimitObserver())
+	if s.options.limitPolicy == connlimit.PolicyReject {
+		s.streamLimiter = connlimit.NewStreamLimiter(int(min(s.options.http2MaxConcurrentStreams, math.MaxInt32)), s.connLimitObserver())
+	}
+	if s.options.agentStoreSecret != "" {
+		s.agentStore = agentstore.NewStore(kubeClient.Clientset, s.namespace, s.options.agentStoreSecret, s.options.agentStoreKeyWrapper)
+	}
+
+	// Bootstrap authentication needs the issuer to validate bootstrap tokens
+	if s.options.bootstrapEnabled {
+		if err := s.registerBootstrapAuth(kubeClient.Clientset); err != nil {
+			return nil, err
+		}
+	}
 
 	appFilters := s.defaultAppFilterChain()
 	appInformerOpts := []informer.InformerOption[*v1alpha1.Application]{
@@ -480,9 +633,54 @@ func NewServer(ctx context.Context, kubeClient *kube.KubernetesClient, namespace
 	gpgKeyBackend := kubegpgkey.NewKubernetesBackend(kubeClient.Clientset, namespace, gpgKeyInformer)
 	s.gpgKeyManager = gpgkey.NewManager(gpgKeyBackend, namespace)
 
-	s.clientMap = map[string]string{
-		`{"clientID":"argocd","mode":"autonomous"}`: "argocd",
+	if names := s.options.argoCDConfigKeys.ConfigMaps(); len(names) > 0 {
+		// The Argo CD ConfigMaps are not selected by the principal's label
+		// selector, but only by their names
+		configFilter := filter.NewFilterChain[*corev1.ConfigMap]()
+		configFilter.AppendAdmitFilter(func(cm *corev1.ConfigMap) bool {
+			return cm.Namespace == namespace && slices.Contains(names, cm.Name)
+		})
+		s.argoCDConfigInformer, err = informer.NewInformer(ctx,
+			informer.WithListHandler[*corev1.ConfigMap](func(ctx context.Context, opts v1.ListOptions) (runtime.Object, error) {
+				return kubeClient.Clientset.CoreV1().ConfigMaps(namespace).List(ctx, opts)
+			}),
+			informer.WithWatchHandler[*corev1.ConfigMap](func(ctx context.Context, opts v1.ListOptions) (watch.Interface, error) {
+				return kubeClient.Clientset.CoreV1().ConfigMaps(namespace).Watch(ctx, opts)
+			}),
+			informer.WithAddHandler[*corev1.ConfigMap](s.newArgoCDConfigCallback),
+			informer.WithUpdateHandler[*corev1.ConfigMap](s.updateArgoCDConfigCallback),
+			informer.WithDeleteHandler[*corev1.ConfigMap](s.deleteArgoCDConfigCallback),
+			informer.WithFilters(configFilter),
+			informer.WithGroupResource[*corev1.ConfigMap]("", "configmaps"),
+		)
+		if err != nil {
+			return nil, err
+		}
 	}
+
+	if names := s.options.argoCDConfigKeys.Secrets(); len(names) > 0 {
+		secretFilter := filter.NewFilterChain[*corev1.Secret]()
+		secretFilter.AppendAdmitFilter(func(secret *corev1.Secret) bool {
+			return secret.Namespace == namespace && slices.Contains(names, secret.Name)
+		})
+		s.argoCDSecretInformer, err = informer.NewInformer(ctx,
+			informer.WithListHandler[*corev1.Secret](func(ctx context.Context, opts v1.ListOptions) (runtime.Object, error) {
+				return kubeClient.Clientset.CoreV1().Secrets(namespace).List(ctx, opts)
+			}),
+			informer.WithWatchHandler[*corev1.Secret](func(ctx context.Context, opts v1.ListOptions) (watch.Interface, error) {
+				return kubeClient.Clientset.CoreV1().Secrets(namespace).Watch(ctx, opts)
+			}),
+			informer.WithAddHandler[*corev1.Secret](s.newArgoCDSecretCallback),
+			informer.WithUpdateHandler[*corev1.Secret](s.updateArgoCDSecretCallback),
+			informer.WithDeleteHandler[*corev1.Secret](s.deleteArgoCDSecretCallback),
+			informer.WithFilters(secretFilter),
+			informer.WithGroupResource[*corev1.Secret]("", "secrets"),
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	s.namespaceMap = map[string]types.AgentMode{
 		"argocd": types.AgentModeAutonomous,
 	}
@@ -566,29 +764,9 @@ func NewServer(ctx context.Context, kubeClient *kube.KubernetesClient, namespace
 	// Instantiate the cluster manager to handle Argo CD cluster secrets for
 	// agents.
 	// Create TLS config for cluster manager Redis connection
-	var clusterMgrRedisTLSConfig *tls.Config
-	if s.options.redisTLSEnabled {
-		serverName, _, err := net.SplitHostPort(s.options.redisAddress)
-		if err != nil {
-			serverName = s.options.redisAddress
-		}
-		clusterMgrRedisTLSConfig = &tls.Config{
-			ServerName: serverName,
-		}
-		if s.options.redisTLSInsecure {
-			clusterMgrRedisTLSConfig.InsecureSkipVerify = true
-			logrus.Warn("INSECURE: cluster manager not verifying Redis TLS certificate")
-		} else if s.options.redisTLSCA != nil {
-			clusterMgrRedisTLSConfig.RootCAs = s.options.redisTLSCA
-		} else if s.options.redisTLSCAPath != "" {
-			caPool, err := tlsutil.X509CertPoolFromFile(s.options.redisTLSCAPath)
-			if err != nil {
-				return nil, fmt.Errorf("failed to load Redis CA certificate: %w", err)
-			}
-			clusterMgrRedisTLSConfig.RootCAs = caPool
-		} else {
-			return nil, fmt.Errorf("redis TLS enabled but no CA certificate configured for cluster manager")
-		}
+	clusterMgrRedisTLSConfig, err := s.redisTLSConfig("cluster manager")
+	if err != nil {
+		return nil, err
 	}
 
 	s.clusterMgr, err = cluster.NewManager(s.ctx, s.namespace, s.options.redisAddress, s.options.redisPassword, s.options.redisCompressionType, s.kubeClient.Clientset, clusterMgrRedisTLSConfig)
@@ -608,7 +786,7 @@ func NewServer(ctx context.Context, kubeClient *kube.KubernetesClient, namespace
 		s.options.clientCertSecretName,
 		kubeClient.Clientset,
 		s.issuer,
-	)
+	).WithAllowedLabels(s.options.selfRegistrationAllowedLabels)
 
 	// Initialize HA components if HA options are configured
 	if len(s.options.haOptions) > 0 {
@@ -688,6 +866,34 @@ func (s *Server) Start(ctx context.Context, errch chan error) error {
 	s.principalUID = uid
 	log().Infof("Principal identity: %s", uid)
 
+	// The IP filter must be in place before we start listening
+	if s.options.ipFilterConfigMap != "" {
+		if err := s.ipFilter.WatchConfigMap(s.ctx, s.kubeClient.Clientset, s.namespace, s.options.ipFilterConfigMap); err != nil {
+			return fmt.Errorf("could not watch IP filter: %w", err)
+		}
+	}
+
+	// Restore the agents known before the last restart
+	if s.agentStore != nil {
+		if err := s.restoreAgents(s.ctx); err != nil {
+			return fmt.Errorf("could not restore agents: %w", err)
+		}
+	}
+
+	// Revocations must be known before we accept the first agent connection
+	if s.options.revocationConfigMap != "" {
+		if err := s.revocations.WatchConfigMap(s.ctx, s.kubeClient.Clientset, s.namespace, s.options.revocationConfigMap); err != nil {
+			return fmt.Errorf("could not watch token revocation list: %w", err)
+		}
+	}
+
+	// Likewise, agent policies must be known before we process any events
+	if s.options.policyConfigMap != "" {
+		if err := s.policies.WatchConfigMap(s.ctx, s.kubeClient.Clientset, s.namespace, s.options.policyConfigMap); err != nil {
+			return fmt.Errorf("could not watch agent policies: %w", err)
+		}
+	}
+
 	// We need to maintain a cache to keep resources in sync with last known state of
 	// autonomous-agent in case it is disconnected with agent or resources on the control-plane are modified.
 	if err := s.populateSourceCache(ctx); err != nil {
@@ -704,7 +910,8 @@ func (s *Server) Start(ctx context.Context, errch chan error) error {
 	}
 
 	if s.options.metricsPort > 0 {
-		metrics.StartMetricsServer(metrics.WithListener("", s.options.metricsPort))
+		metrics.StartMetricsServer(metrics.WithListener("", s.options.metricsPort),
+			metrics.WithHandler(agentLivenessPath, http.HandlerFunc(s.agentLivenessHandler)))
 
 		// A goroutine is started which calculates average connection time of all agents
 		// to export in metrics after every 3 minutes
@@ -721,13 +928,37 @@ func (s *Server) Start(ctx context.Context, errch chan error) error {
 	if err = s.StartEventProcessor(s.ctx); err != nil {
 		return err
 	}
+	go s.runHealthChecks(s.ctx)
+	if s.options.stateDigestInterval > 0 {
+		go s.runStateDigests(s.ctx)
+	}
 
 	s.events = event.NewEventSource(s.options.serverName)
+	s.events.SetApplicationFilter(s.options.appFilter)
 
 	if s.options.labelSelector != "" {
 		log().Infof("Principal informers are using the label selector: %s", s.options.labelSelector)
 	}
 
+	if s.options.orphanedAppPolicy != OrphanedAppPolicyNone {
+		s.clusterMgr.SetMappingHandlers(s.cancelOrphanCleanup, s.scheduleOrphanCleanup)
+	}
+
+	// With destination-based mapping, Applications may be routed to agents
+	// by the server URL of their cluster, so the clusters must be known
+	// before the first Application is seen.
+	if err := s.clusterMgr.Start(); err != nil {
+		return fmt.Errorf("unable to start cluster manager: %w", err)
+	}
+
+	// Pending cleanups of orphaned applications are lost on restart, so they
+	// are rescheduled once the mappings are known.
+	if s.options.orphanedAppPolicy != OrphanedAppPolicyNone {
+		if err := s.resumeOrphanCleanups(s.ctx); err != nil {
+			log().WithError(err).Error("Could not resume cleanup of orphaned applications")
+		}
+	}
+
 	// The application informer lives in its own go routine
 	go func() {
 		if err := s.appManager.StartBackend(s.ctx); err != nil {
@@ -790,6 +1021,26 @@ func (s *Server) Start(ctx context.Context, errch chan error) error {
 		}
 	}()
 
+	// The Argo CD configuration informer lives in its own go routine
+	if s.argoCDConfigInformer != nil {
+		go func() {
+			if err := s.argoCDConfigInformer.Start(s.ctx); err != nil {
+				log().WithError(err).Error("Argo CD configuration informer has exited non-successfully")
+			} else {
+				log().Info("Argo CD configuration informer has exited")
+			}
+		}()
+	}
+	if s.argoCDSecretInformer != nil {
+		go func() {
+			if err := s.argoCDSecretInformer.Start(s.ctx); err != nil {
+				log().WithError(err).Error("Argo CD secret informer has exited non-successfully")
+			} else {
+				log().Info("Argo CD secret informer has exited")
+			}
+		}()
+	}
+
 	syncTimeout := s.options.informerSyncTimeout
 	if syncTimeout == 0 {
 		syncTimeout = waitForSyncedDuration
@@ -800,6 +1051,14 @@ func (s *Server) Start(ctx context.Context, errch chan error) error {
 	}
 	log().Infof("Application informer synced and ready")
 
+	// Deletions are remembered from now on, so agents that have seen this
+	// version can be resynced incrementally.
+	if apps, err := s.kubeClient.ApplicationsClientset.ArgoprojV1alpha1().Applications("").List(ctx, v1.ListOptions{Limit: 1}); err != nil {
+		log().WithError(err).Warn("Agents will not be resynced incrementally")
+	} else if err := s.tombstones.setFloor(apps.ResourceVersion); err != nil {
+		log().WithError(err).Warn("Agents will not be resynced incrementally")
+	}
+
 	if err := s.projectManager.EnsureSynced(syncTimeout); err != nil {
 		return fmt.Errorf("unable to sync AppProject informer: %w", err)
 	}
@@ -822,6 +1081,26 @@ func (s *Server) Start(ctx context.Context, errch chan error) error {
 	}
 	log().Infof("GPG key informer synced and ready")
 
+	if s.argoCDConfigInformer != nil {
+		syncCtx, cancel := context.WithTimeout(s.ctx, syncTimeout)
+		err := s.argoCDConfigInformer.WaitForSync(syncCtx)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("unable to sync Argo CD configuration informer: %w", err)
+		}
+		log().Infof("Argo CD configuration informer synced and ready")
+	}
+
+	if s.argoCDSecretInformer != nil {
+		syncCtx, cancel := context.WithTimeout(s.ctx, syncTimeout)
+		err := s.argoCDSecretInformer.WaitForSync(syncCtx)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("unable to sync Argo CD secret informer: %w", err)
+		}
+		log().Infof("Argo CD secret informer synced and ready")
+	}
+
 	// Start resource proxy if it is enabled
 	if s.resourceProxy != nil {
 		_, err = s.resourceProxy.Start(s.ctx)
@@ -833,9 +1112,6 @@ func (s *Server) Start(ctx context.Context, errch chan error) error {
 		log().Infof("Resource proxy is disabled")
 	}
 
-	if err := s.clusterMgr.Start(); err != nil {
-		return fmt.Errorf("unable to start cluster manager with informer sync timeout %v: %w", syncTimeout, err)
-	}
 	if err := s.namespaceManager.EnsureSynced(syncTimeout); err != nil {
 		return fmt.Errorf("unable to sync Namespace informer: %w", err)
 	}
@@ -849,6 +1125,12 @@ func (s *Server) Start(ctx context.Context, errch chan error) error {
 			healthzHandler = s.ha.HAHealthzHandler(s.healthzHandler)
 		}
 		http.HandleFunc("/healthz", healthzHandler)
+		// Publish the keys tokens can be validated with
+		http.HandleFunc(jwksPath, s.jwksHandler)
+		if len(s.options.caCertPEM) > 0 {
+			// Publish the CA certificate for agents to bootstrap from
+			http.HandleFunc(caCertPath, s.caCertHandler)
+		}
 		healthzAddr := fmt.Sprintf(":%d", s.options.healthzPort)
 
 		log().Infof("Starting healthz server on %s", healthzAddr)
@@ -856,6 +1138,12 @@ func (s *Server) Start(ctx context.Context, errch chan error) error {
 		go http.ListenAndServe(healthzAddr, nil)
 	}
 
+	if s.options.queueAdminPort > 0 {
+		if err := s.serveQueueAdmin(); err != nil {
+			return err
+		}
+	}
+
 	// Finally, start accepting connections from agents
 	if s.options.serveGRPC {
 		if err := s.serveGRPC(ctx, s.metrics, s.grpcServerMetrics, errch); err != nil {
@@ -895,6 +1183,14 @@ func (rs *resyncStatus) resynced(agentName string) {
 	rs.resync[agentName] = true
 }
 
+// reset makes the agent be resynced the next time it connects
+func (rs *resyncStatus) reset(agentName string) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	delete(rs.resync, agentName)
+}
+
 // RunHandlersOnConnect runs the registered handlers when an agent connects to the principal
 func (s *Server) RunHandlersOnConnect(ctx context.Context) {
 	for {
@@ -992,8 +1288,18 @@ func (s *Server) handleResyncOnConnect(agent types.Agent) error {
 			return fmt.Errorf("failed to send current state to agent: %w", err)
 		}
 
-		// In managed mode, principal is the source of truth and the it should request resource resync
-		ev, err := s.events.RequestResourceResyncEvent()
+		// If the delivery cursor of the agent survived the restart, the events
+		// the agent missed are replayed from the queue storage and there is no
+		// need for a full resync.
+		if cursor, resumed, err := s.queues.Cursor(agent.Name()); err == nil && resumed {
+			logCtx.WithField("cursor", cursor).Info("Replaying missed events instead of requesting a resource resync")
+			s.resyncStatus.resynced(agent.Name())
+			return nil
+		}
+
+		// In managed mode, principal is the source of truth and the it should request resource resync.
+		// Agents that know which changes they have applied may resync incrementally.
+		ev, err := s.events.IncrementalResourceResyncEvent()
 		if err != nil {
 			return fmt.Errorf("failed to create ResourceResync event: %w", err)
 		}
@@ -1081,10 +1387,15 @@ func (s *Server) sendCurrentStateToAgent(agent string) error {
 				continue
 			}
 
+			repo, err := s.outboundRepository(&repository)
+			if err != nil {
+				return fmt.Errorf("failed to prepare repository %s: %w", repository.Name, err)
+			}
+
 			s.projectToRepos.Add(projectName, repository.Name)
 			s.repoToAgents.Add(repository.Name, agent)
 
-			ev := s.events.RepositoryEvent(event.SpecUpdate, &repository)
+			ev := s.events.RepositoryEvent(event.SpecUpdate, repo)
 			tracing.PopulateSpanFromObject(span, &repository)
 			tracing.InjectTraceContext(ctx, ev)
 			sendQ.Add(ev)
@@ -1104,6 +1415,42 @@ func (s *Server) sendCurrentStateToAgent(agent string) error {
 		sendQ.Add(ev)
 	}
 
+	// Send the selected keys of the Argo CD configuration ConfigMaps and
+	// Secrets. Missing ones are sent without keys, so that keys synced before
+	// are removed.
+	if s.argoCDConfigInformer != nil {
+		for _, name := range s.options.argoCDConfigKeys.ConfigMaps() {
+			cm := &corev1.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: name, Namespace: s.namespace}}
+			obj, err := s.argoCDConfigInformer.Lister().ByNamespace(s.namespace).Get(name)
+			if err != nil && !apierrors.IsNotFound(err) {
+				return fmt.Errorf("failed to get ConfigMap %s: %w", name, err)
+			} else if err == nil {
+				cm = obj.(*corev1.ConfigMap)
+			}
+			ev := s.events.ArgoCDConfigEvent(event.SpecUpdate, s.options.argoCDConfigKeys.Filter(cm))
+			tracing.InjectTraceContext(ctx, ev)
+			sendQ.Add(ev)
+		}
+	}
+	if s.argoCDSecretInformer != nil {
+		for _, name := range s.options.argoCDConfigKeys.Secrets() {
+			secret := &corev1.Secret{ObjectMeta: v1.ObjectMeta{Name: name, Namespace: s.namespace}}
+			obj, err := s.argoCDSecretInformer.Lister().ByNamespace(s.namespace).Get(name)
+			if err != nil && !apierrors.IsNotFound(err) {
+				return fmt.Errorf("failed to get Secret %s: %w", name, err)
+			} else if err == nil {
+				secret = obj.(*corev1.Secret)
+			}
+			out, err := s.outboundArgoCDSecret(secret)
+			if err != nil {
+				return fmt.Errorf("failed to prepare Secret %s: %w", name, err)
+			}
+			ev := s.events.ArgoCDSecretEvent(event.SpecUpdate, out)
+			tracing.InjectTraceContext(ctx, ev)
+			sendQ.Add(ev)
+		}
+	}
+
 	return nil
 }
 
@@ -1123,6 +1470,21 @@ func hasSkipSyncLabel(labels map[string]string) bool {
 func (s *Server) Shutdown() error {
 	var err error
 
+	// Stop load balancers from sending new connections our way
+	if s.healthSrv != nil {
+		s.healthSrv.Shutdown()
+	}
+
+	// Stop queueing new events for agents, so that draining the queues can
+	// complete
+	s.queues.Close()
+
+	// Let agents know we are going away while everything is still running
+	s.drainAgents()
+
+	// Keep whatever could not be delivered for after the restart
+	s.checkpointEvents()
+
 	// Shutdown HA components first
 	if s.ha != nil {
 		if err = s.ha.ShutdownHA(s.ctx); err != nil {
@@ -1169,9 +1531,160 @@ func (s *Server) Shutdown() error {
 	} else {
 		return fmt.Errorf("no server running")
 	}
+
+	if s.queueAdminServer != nil {
+		s.queueAdminServer.GracefulStop()
+		s.queueAdminServer = nil
+	}
+
+	if aerr := s.options.auditLogger.Close(); aerr != nil {
+		log().WithError(aerr).Warn("Could not close audit log")
+	}
 	return err
 }
 
+// drainAgents tells all connected agents that the principal is shutting down,
+// and waits for the events queued for them to be delivered before the server
+// is stopped. It waits at most for the configured grace period, and does
+// nothing if no grace period is configured.
+func (s *Server) drainAgents() {
+	if s.eventStreamSrv == nil || s.events == nil || s.options.gracePeriod <= 0 {
+		return
+	}
+	log().Infof("Draining agent connections for up to %v", s.options.gracePeriod)
+	ctx, cancel := context.WithTimeout(context.Background(), s.options.gracePeriod)
+	defer cancel()
+	if err := s.eventStreamSrv.Drain(ctx, s.events.GoAwayEvent); err != nil {
+		log().WithError(err).Warn("Could not drain all agent connections")
+		return
+	}
+	log().Info("All agent connections drained")
+}
+
+// serveQueueAdmin starts the localhost-only gRPC server for the QueueAdmin
+// service.
+func (s *Server) serveQueueAdmin() error {
+	addr := fmt.Sprintf("127.0.0.1:%d", s.options.queueAdminPort)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on queue admin port %s: %w", addr, err)
+	}
+	s.queueAdminServer = grpc.NewServer()
+	queueadminapi.RegisterQueueAdminServer(s.queueAdminServer, queueadmin.NewServer(s.queues, s.options.eventJournal))
+	log().WithField("addr", addr).Info("Starting queue admin gRPC server")
+	go func() {
+		if err := s.queueAdminServer.Serve(listener); err != nil {
+			log().WithError(err).Error("Queue admin gRPC server error")
+		}
+	}()
+	return nil
+}
+
+// checkpointEvents persists the events that were sent to agents, but not yet
+// acknowledged by them, if the queues are persistent. Events that are still
+// in the send queues have been persisted when they were queued.
+func (s *Server) checkpointEvents() {
+	if s.eventStreamSrv == nil {
+		return
+	}
+	n := s.eventStreamSrv.Checkpoint()
+	if n == 0 {
+		return
+	}
+	if s.options.queueStorageDir == "" && s.options.queueBackend != QueueBackendRedis {
+		log().Warnf("Discarding %d events that were not delivered to agents", n)
+		return
+	}
+	log().Infof("Persisted %d events that were not delivered to agents", n)
+}
+
+// onQueueOverflow is called whenever an event is added to the full send queue
+// of an agent. With OverflowDisconnect, the agent is disconnected and resynced
+// when it reconnects, since events meant for it were dropped.
+func (s *Server) onQueueOverflow(agentName string, policy queue.OverflowPolicy) {
+	if s.metrics != nil {
+		s.metrics.AgentQueueOverflows.WithLabelValues(agentName, string(policy)).Inc()
+	}
+	logCtx := log().WithFields(logrus.Fields{
+		"agent":  agentName,
+		"policy": policy,
+	})
+	switch policy {
+	case queue.OverflowDisconnect:
+		s.resyncStatus.reset(agentName)
+		if s.eventStreamSrv != nil && s.eventStreamSrv.Disconnect(agentName) {
+			logCtx.Warn("Disconnecting agent whose queue exceeds its limit")
+		}
+	case queue.OverflowAlert:
+		logCtx.Warn("Queue of agent exceeds its limit")
+	}
+}
+
+// onQueueExpiry is called whenever an event queued for an agent was dropped
+// because it expired.
+func (s *Server) onQueueExpiry(agentName string, ev *cloudevents.Event) {
+	if s.metrics != nil {
+		s.metrics.AgentQueueExpired.WithLabelValues(agentName, ev.Type()).Inc()
+	}
+}
+
+// queueRedisKeyPrefix is the prefix of the Redis streams the queues of events
+// to send to agents are kept in
+const queueRedisKeyPrefix = "argocd-agent:queue"
+
+// newQueueRedisOption returns the option that makes the send queues of agents
+// use the principal's Redis as shared backend. Each replica reads from the
+// queues as a consumer named after its host name.
+func (s *Server) newQueueRedisOption() (queue.SendRecvQueuesOption, error) {
+	tlsConfig, err := s.redisTLSConfig("queue backend")
+	if err != nil {
+		return nil, err
+	}
+	consumer, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("could not determine queue consumer name: %w", err)
+	}
+	client := redis.NewClient(&redis.Options{
+		Addr:     s.options.redisAddress,
+		Password: s.options.redisPassword,
+		MaintNotificationsConfig: &maintnotifications.Config{
+			Mode: maintnotifications.ModeDisabled,
+		},
+		TLSConfig: tlsConfig,
+	})
+	return queue.WithRedis(client, queueRedisKeyPrefix, consumer), nil
+}
+
+// redisTLSConfig returns the TLS configuration for connections of component
+// to the principal's Redis, or nil if Redis TLS is not enabled.
+func (s *Server) redisTLSConfig(component string) (*tls.Config, error) {
+	if !s.options.redisTLSEnabled {
+		return nil, nil
+	}
+	serverName, _, err := net.SplitHostPort(s.options.redisAddress)
+	if err != nil {
+		serverName = s.options.redisAddress
+	}
+	tlsConfig := &tls.Config{
+		ServerName: serverName,
+	}
+	if s.options.redisTLSInsecure {
+		tlsConfig.InsecureSkipVerify = true
+		logrus.Warnf("INSECURE: %s not verifying Redis TLS certificate", component)
+	} else if s.options.redisTLSCA != nil {
+		tlsConfig.RootCAs = s.options.redisTLSCA
+	} else if s.options.redisTLSCAPath != "" {
+		caPool, err := tlsutil.X509CertPoolFromFile(s.options.redisTLSCAPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load Redis CA certificate: %w", err)
+		}
+		tlsConfig.RootCAs = caPool
+	} else {
+		return nil, fmt.Errorf("redis TLS enabled but no CA certificate configured for %s", component)
+	}
+	return tlsConfig, nil
+}
+
 // loadTLSConfig will configure and return a tls.Config object that can be
 // used by the server's listener. It will use options set in the server for
 // configuring the returned object. Returns nil if insecurePlaintext mode is
@@ -1183,25 +1696,62 @@ func (s *Server) loadTLSConfig() (*tls.Config, error) {
 		return nil, nil
 	}
 
-	var cert tls.Certificate
-	var err error
-
-	if s.options.tlsCertPath != "" && s.options.tlsKeyPath != "" {
-		cert, err = tlsutil.TLSCertFromFile(s.options.tlsCertPath, s.options.tlsKeyPath, false)
-	} else if s.options.tlsCert != nil && s.options.tlsKey != nil {
-		cert, err = tlsutil.TLSCertFromX509(s.options.tlsCert, s.options.tlsKey)
-	}
-	if err != nil {
-		return nil, fmt.Errorf("unable to load TLS config: %w", err)
-	}
-
 	tlsConfig := &tls.Config{
-		Certificates: []tls.Certificate{cert},
 		MinVersion:   s.options.tlsMinVersion,
 		MaxVersion:   s.options.tlsMaxVersion,
 		CipherSuites: s.options.tlsCiphers,
 	}
 
+	if s.options.acmeManager != nil {
+		// Certificates are obtained from the ACME server on demand. The ACME
+		// protocol must be offered to answer TLS-ALPN-01 challenges.
+		tlsConfig.GetCertificate = s.options.acmeManager.GetCertificate
+		tlsConfig.NextProtos = []string{acme.ALPNProto}
+	} else {
+		var cert tls.Certificate
+		var err error
+
+		if s.options.tlsCertPath != "" && s.options.tlsKeyPath != "" {
+			cert, err = tlsutil.TLSCertFromFile(s.options.tlsCertPath, s.options.tlsKeyPath, false)
+		} else if s.options.tlsCert != nil && s.options.tlsKey != nil {
+			cert, err = tlsutil.TLSCertFromX509(s.options.tlsCert, s.options.tlsKey)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to load TLS config: %w", err)
+		}
+
+		// The certificate is served through GetCertificate, so that it can be
+		// reloaded without restarting the server.
+		s.tlsReloader = tlsutil.NewCertificateReloader(cert)
+		tlsConfig.GetCertificate = s.tlsReloader.GetCertificate
+
+		// Additional certificates are selected by the server name requested
+		// by the client, with the above certificate being the fallback.
+		if len(s.options.sniKeyPairs) > 0 {
+			s.sniReloaders = make([]*tlsutil.CertificateReloader, 0, len(s.options.sniKeyPairs))
+			for _, kp := range s.options.sniKeyPairs {
+				cert := kp.cert
+				if kp.certPath != "" {
+					cert, err = tlsutil.TLSCertFromFile(kp.certPath, kp.keyPath, false)
+					if err != nil {
+						return nil, fmt.Errorf("unable to load SNI certificate: %w", err)
+					}
+				}
+				s.sniReloaders = append(s.sniReloaders, tlsutil.NewCertificateReloader(cert))
+			}
+			tlsConfig.GetCertificate = tlsutil.NewCertificateSelector(s.tlsReloader, s.sniReloaders...).GetCertificate
+		}
+	}
+
+	// Listeners with their own keypair serve it instead of the above.
+	if slices.ContainsFunc(s.options.additionalListeners, func(l listenerSpec) bool { return l.certPath != "" }) {
+		tlsConfig.GetCertificate = listenerCertificateFunc(tlsConfig.GetCertificate)
+	}
+
+	// Protocols offered in addition to, or in preference to h2, e.g. to let
+	// proxies in front of agents negotiate HTTP/1.1 for WebSockets.
+	tlsConfig.NextProtos = append(tlsConfig.NextProtos, s.options.alpnProtocols...)
+
 	// If the server is configured to require client certificates, set up the
 	// TLS config accordingly. On verification, we store the common name of
 	// the validated certificate in the server's context, so we can access it
@@ -1210,11 +1760,176 @@ func (s *Server) loadTLSConfig() (*tls.Config, error) {
 		log().Infof("This server will require TLS client certs as part of authentication")
 		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
 		tlsConfig.ClientCAs = s.options.rootCa
+		if s.options.clientCA != nil {
+			s.clientCAReloader = tlsutil.NewCertPoolReloader(s.options.clientCA)
+			tlsConfig.GetConfigForClient = s.clientCAConfigFunc(tlsConfig)
+		}
+		if s.options.revocationChecker != nil {
+			log().Infof("Client certificates will be checked for revocation")
+			tlsConfig.VerifyConnection = s.verifyClientCertRevocation
+		}
 	}
 
 	return tlsConfig, nil
 }
 
+// clientCAConfigFunc returns a function to be used as the GetConfigForClient
+// callback of tlsConfig, which verifies client certificates against the
+// current dedicated client CA pool. The root CAs in tlsConfig.ClientCAs are
+// kept for other uses of the configuration, such as HA replication.
+func (s *Server) clientCAConfigFunc(tlsConfig *tls.Config) func(*tls.ClientHelloInfo) (*tls.Config, error) {
+	return func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		c := tlsConfig.Clone()
+		c.GetConfigForClient = nil
+		c.ClientCAs = s.clientCAReloader.Pool()
+		return c, nil
+	}
+}
+
+// verifyClientCertRevocation is used as tls.Config.VerifyConnection and
+// rejects client certificates which have been revoked, recording the
+// outcome in the principal's metrics.
+func (s *Server) verifyClientCertRevocation(cs tls.ConnectionState) error {
+	err := s.options.revocationChecker.VerifyConnection(cs)
+	if err == nil {
+		return nil
+	}
+	var revokedErr *tlsutil.RevokedError
+	var checkErr *tlsutil.RevocationCheckError
+	switch {
+	case errors.As(err, &revokedErr):
+		log().WithError(err).Warn("Rejecting revoked client certificate")
+		if s.metrics != nil {
+			s.metrics.ClientCertsRevoked.WithLabelValues(revokedErr.Source).Inc()
+		}
+	case errors.As(err, &checkErr):
+		log().WithError(err).Warn("Rejecting client certificate with unknown revocation status")
+		if s.metrics != nil {
+			s.metrics.RevocationCheckErrors.WithLabelValues(checkErr.Source).Inc()
+		}
+	}
+	return err
+}
+
+// watchTLSCertificate starts watching the sources of the server's TLS
+// certificates and the dedicated client CA bundle for changes, so that
+// renewed certificates are used for new connections. Certificates not loaded
+// from files or a Secret are not watched.
+func (s *Server) watchTLSCertificate(ctx context.Context) error {
+	s.tlsConfigMu.RLock()
+	reloader := s.tlsReloader
+	sniReloaders := s.sniReloaders
+	caReloader := s.clientCAReloader
+	s.tlsConfigMu.RUnlock()
+	if caReloader != nil {
+		caReloader.WatchFile(ctx, s.options.clientCAPath, tlsutil.DefaultReloadInterval)
+	}
+	if s.options.requireClientCerts && s.options.revocationChecker != nil {
+		s.options.revocationChecker.WatchCRLs(ctx)
+	}
+	for i, l := range s.additionalListeners {
+		if l.reloader != nil {
+			spec := s.options.additionalListeners[i]
+			l.reloader.WatchFiles(ctx, spec.certPath, spec.keyPath, tlsutil.DefaultReloadInterval)
+		}
+	}
+	if reloader == nil {
+		return nil
+	}
+	if s.options.tlsCertPath != "" && s.options.tlsKeyPath != "" {
+		reloader.WatchFiles(ctx, s.options.tlsCertPath, s.options.tlsKeyPath, tlsutil.DefaultReloadInterval)
+	} else if s.options.tlsSecretKube != nil {
+		if err := reloader.WatchSecret(ctx, s.options.tlsSecretKube, s.options.tlsSecretNamespace, s.options.tlsSecretName); err != nil {
+			return err
+		}
+	}
+	for i, kp := range s.options.sniKeyPairs {
+		if kp.certPath != "" {
+			sniReloaders[i].WatchFiles(ctx, kp.certPath, kp.keyPath, tlsutil.DefaultReloadInterval)
+		} else if err := sniReloaders[i].WatchSecret(ctx, kp.kube, kp.namespace, kp.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// monitorCertificateExpiry starts periodically checking the expiry of the
+// server's TLS certificates and of the CAs used to verify client
+// certificates. The remaining validity is exported as a metric, and
+// warnings are logged as certificates approach their expiry. Certificates
+// obtained via ACME are renewed automatically and not monitored.
+func (s *Server) monitorCertificateExpiry(ctx context.Context) {
+	s.tlsConfigMu.RLock()
+	reloader := s.tlsReloader
+	sniReloaders := s.sniReloaders
+	s.tlsConfigMu.RUnlock()
+
+	m := tlsutil.NewExpiryMonitor(func(name string, remaining time.Duration) {
+		if s.metrics != nil {
+			s.metrics.CertificateExpiryDays.WithLabelValues(name).Set(remaining.Hours() / 24)
+		}
+	})
+	if reloader != nil {
+		m.AddSource("serving", reloaderCertificates(reloader))
+	}
+	for _, r := range sniReloaders {
+		m.AddSource("sni/"+certificateName(r.Certificate()), reloaderCertificates(r))
+	}
+	for _, l := range s.additionalListeners {
+		if l.reloader != nil {
+			m.AddSource("listener/"+l.Address(), reloaderCertificates(l.reloader))
+		}
+	}
+	if s.options.requireClientCerts {
+		if s.options.clientCAPath != "" {
+			m.AddSource("client-ca", func() ([]*x509.Certificate, error) {
+				return tlsutil.X509CertsFromFile(s.options.clientCAPath)
+			})
+		} else if len(s.options.rootCaCerts) > 0 {
+			m.AddSource("root-ca", func() ([]*x509.Certificate, error) {
+				return s.options.rootCaCerts, nil
+			})
+		}
+	}
+	m.Run(ctx, tlsutil.DefaultExpiryCheckInterval)
+}
+
+// reloaderCertificates returns an ExpirySource for the leaf certificate
+// currently held by r
+func reloaderCertificates(r *tlsutil.CertificateReloader) tlsutil.ExpirySource {
+	return func() ([]*x509.Certificate, error) {
+		leaf, err := leafCertificate(r.Certificate())
+		if err != nil {
+			return nil, err
+		}
+		return []*x509.Certificate{leaf}, nil
+	}
+}
+
+// leafCertificate returns the parsed leaf of cert
+func leafCertificate(cert *tls.Certificate) (*x509.Certificate, error) {
+	if cert == nil || len(cert.Certificate) == 0 {
+		return nil, fmt.Errorf("no certificate loaded")
+	}
+	if cert.Leaf != nil {
+		return cert.Leaf, nil
+	}
+	return x509.ParseCertificate(cert.Certificate[0])
+}
+
+// certificateName returns the first DNS name of cert, or its common name if
+// it has none
+func certificateName(cert *tls.Certificate) string {
+	leaf, err := leafCertificate(cert)
+	if err != nil {
+		return "unknown"
+	}
+	if len(leaf.DNSNames) > 0 {
+		return leaf.DNSNames[0]
+	}
+	return leaf.Subject.CommonName
+}
+
 func (s *Server) currentTLSConfig() *tls.Config {
 	s.tlsConfigMu.RLock()
 	defer s.tlsConfigMu.RUnlock()
@@ -1262,12 +1977,12 @@ func (s *Server) defaultAppFilterChain() *filter.Chain[*v1alpha1.Application] {
 		}
 		return true
 	})
-	// In destination-based mapping mode, apps without a destination name
-	// (e.g. in-cluster apps using destination.server) cannot be routed to
-	// any agent, so filter them out.
+	// In destination-based mapping mode, apps whose destination is not an
+	// agent (e.g. in-cluster apps) cannot be routed to any agent, so filter
+	// them out.
 	if s.options.destinationBasedMapping {
 		c.AppendAdmitFilter(func(res *v1alpha1.Application) bool {
-			name := res.Spec.Destination.Name
+			name := s.destinationAgent(res)
 			return name != "" && name != "in-cluster"
 		})
 	}
@@ -1324,8 +2039,12 @@ func (s *Server) agentMode(namespace string) types.AgentMode {
 
 func (s *Server) setAgentMode(namespace string, mode types.AgentMode) {
 	s.clientLock.Lock()
-	defer s.clientLock.Unlock()
+	changed := s.namespaceMap[namespace] != mode
 	s.namespaceMap[namespace] = mode
+	s.clientLock.Unlock()
+	if changed {
+		s.persistAgent(namespace, func(a *agentstore.Agent) { a.Mode = mode })
+	}
 }
 
 func (s *Server) agentNamespace(agentName string) string {
@@ -1336,8 +2055,61 @@ func (s *Server) agentNamespace(agentName string) string {
 
 func (s *Server) setAgentNamespace(agentName, namespace string) {
 	s.clientLock.Lock()
-	defer s.clientLock.Unlock()
+	changed := s.agentNamespaces[agentName] != namespace
 	s.agentNamespaces[agentName] = namespace
+	s.clientLock.Unlock()
+	if changed {
+		s.persistAgent(agentName, func(a *agentstore.Agent) { a.Namespace = namespace })
+	}
+}
+
+// persistAgent applies fn to the stored state of agentName, if an agent store
+// is configured. Failures are logged, but do not affect the agent.
+func (s *Server) persistAgent(agentName string, fn func(a *agentstore.Agent)) {
+	if s.agentStore == nil {
+		return
+	}
+	if err := s.agentStore.Update(s.ctx, agentName, fn); err != nil {
+		log().WithError(err).WithField("agent", agentName).Error("Could not persist agent")
+	}
+}
+
+// restoreAgents loads the agents from the agent store, and keeps watching it
+// for agents added or removed by others. Agents already known to this
+// instance take precedence over the store, because their state is derived
+// from their live connections.
+func (s *Server) restoreAgents(ctx context.Context) error {
+	agents, err := s.agentStore.Load(ctx)
+	if err != nil {
+		return err
+	}
+	for name, agent := range agents {
+		s.restoreAgent(name, agent)
+	}
+	log().WithField("agents", len(agents)).Info("Restored agents from agent store")
+	return s.agentStore.Watch(ctx, s.restoreAgent, func(name string) {
+		s.clientLock.Lock()
+		defer s.clientLock.Unlock()
+		delete(s.namespaceMap, name)
+		delete(s.agentNamespaces, name)
+		log().WithField("agent", name).Info("Agent was removed from agent store")
+	})
+}
+
+func (s *Server) restoreAgent(name string, agent agentstore.Agent) {
+	s.clientLock.Lock()
+	if _, ok := s.namespaceMap[name]; !ok && agent.Mode != types.AgentModeUnknown {
+		s.namespaceMap[name] = agent.Mode
+	}
+	if _, ok := s.agentNamespaces[name]; !ok && agent.Namespace != "" {
+		s.agentNamespaces[name] = agent.Namespace
+	}
+	s.clientLock.Unlock()
+	if !s.queues.HasQueuePair(name) {
+		if err := s.queues.Create(name); err != nil {
+			log().WithError(err).WithField("agent", name).Warn("Could not create queue pair for restored agent")
+		}
+	}
 }
 
 func (s *Server) healthzHandler(w http.ResponseWriter, r *http.Request) {
@@ -1345,6 +2117,70 @@ func (s *Server) healthzHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// registerBootstrapAuth registers the bootstrap auth method, as well as the
+// psk auth method onboarded agents use afterwards, unless it has already been
+// configured.
+func (s *Server) registerBootstrapAuth(kubeclient kubernetes.Interface) error {
+	validator, ok := s.issuer.(bootstrap.TokenValidator)
+	if !ok {
+		return fmt.Errorf("token issuer does not support bootstrap tokens")
+	}
+	bootstrapAuth := bootstrap.NewBootstrapAuthentication(validator, kubeclient, s.namespace, s.options.pskSecretPrefix)
+	if err := bootstrapAuth.Init(); err != nil {
+		return fmt.Errorf("could not initialize bootstrap auth method: %w", err)
+	}
+	if err := s.authMethods.RegisterMethod("bootstrap", bootstrapAuth); err != nil {
+		return err
+	}
+	if s.authMethods.Method("psk") == nil {
+		pskAuth := psk.NewPSKAuthentication(kubeclient, s.namespace, s.options.pskSecretPrefix)
+		if err := pskAuth.Init(); err != nil {
+			return fmt.Errorf("could not initialize psk auth method: %w", err)
+		}
+		if err := s.authMethods.RegisterMethod("psk", pskAuth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// jwksPath is the path the token validation keys are published at
+const jwksPath = "/.well-known/jwks.json"
+
+// jwksHandler publishes the public keys that tokens issued by the principal
+// can be validated with as a JSON Web Key Set.
+func (s *Server) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	ks, ok := s.issuer.(issuer.KeySetProvider)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	data, err := json.Marshal(ks.JWKS())
+	if err != nil {
+		log().Errorf("Could not marshal JWKS: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(data); err != nil {
+		log().Errorf("Could not write JWKS to client: %v", err)
+	}
+}
+
+// caCertPath is the path the CA certificate is published at
+const caCertPath = "/ca.crt"
+
+// caCertHandler publishes the PEM encoded CA certificate configured with
+// WithCACertEndpoint.
+func (s *Server) caCertHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(s.options.caCertPEM); err != nil {
+		log().Errorf("Could not write CA certificate to client: %v", err)
+	}
+}
+
 func (s *Server) populateSourceCache(ctx context.Context) error {
 	log().Infof("Recreating application spec cache from existing resources on cluster")
 	appList, err := s.appManager.List(ctx, backend.ApplicationSelector{Namespaces: []string{s.namespace}})
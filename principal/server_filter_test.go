@@ -21,6 +21,7 @@ import (
 	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -405,6 +406,24 @@ func TestServer_DefaultAppFilterChain_DestinationBasedMapping(t *testing.T) {
 		}
 		assert.False(t, fc.Admit(inClusterApp))
 	})
+
+	t.Run("destination-based mapping enabled: app with server of an agent's cluster is admitted and routed", func(t *testing.T) {
+		clusterMgr := makeClusterMgr(t)
+		require.NoError(t, clusterMgr.MapCluster("agent-prod", &v1alpha1.Cluster{Name: "agent-prod", Server: "https://proxy:8443?agentName=agent-prod"}))
+		server := &Server{
+			options:                 &ServerOptions{namespaces: []string{"argocd"}, destinationBasedMapping: true},
+			destinationBasedMapping: true,
+			clusterMgr:              clusterMgr,
+		}
+		fc := server.defaultAppFilterChain()
+		generated := &v1alpha1.Application{
+			ObjectMeta: metav1.ObjectMeta{Name: "guestbook-agent-prod", Namespace: "argocd"},
+			Spec:       v1alpha1.ApplicationSpec{Destination: v1alpha1.ApplicationDestination{Server: "https://proxy:8443?agentName=agent-prod"}},
+		}
+		assert.True(t, fc.Admit(generated))
+		assert.Equal(t, "agent-prod", server.getAgentNameForApp(generated))
+		assert.False(t, fc.Admit(withoutDestName))
+	})
 }
 
 func init() {
@@ -16,6 +16,9 @@ package principal
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
 	"crypto/x509"
 	"math/big"
 	"os"
@@ -99,6 +102,58 @@ func Test_ServerWithTLSConfig(t *testing.T) {
 		assert.ErrorContains(t, err, "failed to find any PEM data")
 		assert.Nil(t, tlsConfig)
 	})
+
+	t.Run("Dedicated client CA", func(t *testing.T) {
+		templ := certTempl
+		fakecerts.WriteSelfSignedCert(t, "rsa", path.Join(tempDir, "client-ca"), templ)
+		s, err := NewServer(context.TODO(), kube.NewKubernetesFakeClientWithApps(testNamespace), testNamespace,
+			WithTLSKeyPairFromPath(path.Join(tempDir, "client-ca.crt"), path.Join(tempDir, "client-ca.key")),
+			WithClientCACert(path.Join(tempDir, "client-ca.crt")),
+			WithRequireClientCerts(true),
+			WithGeneratedTokenSigningKey(),
+			WithRedisProxyDisabled(),
+		)
+		require.NoError(t, err)
+		tlsConfig, err := s.loadTLSConfig()
+		require.NoError(t, err)
+		require.NotNil(t, tlsConfig.GetConfigForClient)
+		assert.Same(t, s.options.rootCa, tlsConfig.ClientCAs)
+
+		clientConfig, err := tlsConfig.GetConfigForClient(nil)
+		require.NoError(t, err)
+		assert.Same(t, s.options.clientCA, clientConfig.ClientCAs)
+		assert.Equal(t, tls.RequireAndVerifyClientCert, clientConfig.ClientAuth)
+
+		pool := x509.NewCertPool()
+		s.clientCAReloader.Set(pool)
+		clientConfig, err = tlsConfig.GetConfigForClient(nil)
+		require.NoError(t, err)
+		assert.Same(t, pool, clientConfig.ClientCAs)
+	})
+
+	t.Run("ALPN protocols", func(t *testing.T) {
+		templ := certTempl
+		fakecerts.WriteSelfSignedCert(t, "rsa", path.Join(tempDir, "alpn"), templ)
+		s, err := NewServer(context.TODO(), kube.NewKubernetesFakeClientWithApps(testNamespace), testNamespace,
+			WithTLSKeyPairFromPath(path.Join(tempDir, "alpn.crt"), path.Join(tempDir, "alpn.key")),
+			WithALPNProtocols([]string{"h2", "http/1.1"}),
+			WithGeneratedTokenSigningKey(),
+			WithRedisProxyDisabled(),
+		)
+		require.NoError(t, err)
+		tlsConfig, err := s.loadTLSConfig()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"h2", "http/1.1"}, tlsConfig.NextProtos)
+	})
+
+	t.Run("Invalid client CA", func(t *testing.T) {
+		_, err := NewServer(context.TODO(), kube.NewKubernetesFakeClientWithApps(testNamespace), testNamespace,
+			WithClientCACert("server_test.go"),
+			WithGeneratedTokenSigningKey(),
+			WithRedisProxyDisabled(),
+		)
+		assert.ErrorContains(t, err, "could not load client CA")
+	})
 }
 
 func Test_NewServer(t *testing.T) {
@@ -185,6 +240,29 @@ func Test_NewServer(t *testing.T) {
 		assert.NotNil(t, s)
 		assert.Equal(t, "custom-proxy:8443", s.options.resourceProxyAddress)
 	})
+
+	t.Run("Strict key policy rejects a volatile signing key", func(t *testing.T) {
+		s, err := NewServer(context.TODO(), kube.NewKubernetesFakeClientWithApps(testNamespace), testNamespace,
+			WithGeneratedTokenSigningKey(),
+			WithRedisProxyDisabled(),
+			WithStrictKeyPolicy(true),
+		)
+		assert.ErrorContains(t, err, "volatile JWT signing key")
+		assert.Nil(t, s)
+	})
+
+	t.Run("Strict key policy accepts a persistent signing key", func(t *testing.T) {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		s, err := NewServer(context.TODO(), kube.NewKubernetesFakeClientWithApps(testNamespace), testNamespace,
+			WithTokenSigner(key),
+			WithRedisProxyDisabled(),
+			WithStrictKeyPolicy(true),
+		)
+		assert.NoError(t, err)
+		assert.NotNil(t, s)
+		assert.False(t, s.options.signingKeyGenerated)
+	})
 }
 
 func Test_handleResyncOnConnect(t *testing.T) {
@@ -238,6 +316,33 @@ func Test_handleResyncOnConnect(t *testing.T) {
 		assert.False(t, shutdown)
 		assert.Equal(t, event.EventRequestResourceResync.String(), ev.Type())
 	})
+
+	t.Run("replay missed events in managed mode if the delivery cursor was resumed", func(t *testing.T) {
+		agent = types.NewAgent("test", types.AgentModeManaged.String())
+		s.resyncStatus = newResyncStatus()
+		dir := t.TempDir()
+		require.NoError(t, queue.NewSendRecvQueues(queue.WithStorageDir(dir)).Create(agent.Name()))
+		s.queues = queue.NewSendRecvQueues(queue.WithStorageDir(dir))
+		require.NoError(t, s.queues.Create(agent.Name()))
+
+		err = s.handleResyncOnConnect(agent)
+		assert.Nil(t, err)
+
+		assert.Zero(t, s.queues.SendQ(agent.Name()).Len())
+		assert.True(t, s.resyncStatus.isResynced(agent.Name()))
+	})
+}
+
+func Test_onQueueOverflow(t *testing.T) {
+	s := &Server{options: defaultOptions(), resyncStatus: newResyncStatus()}
+	s.resyncStatus.resynced("agent-a")
+	s.resyncStatus.resynced("agent-b")
+
+	s.onQueueOverflow("agent-a", queue.OverflowAlert)
+	assert.True(t, s.resyncStatus.isResynced("agent-a"))
+
+	s.onQueueOverflow("agent-b", queue.OverflowDisconnect)
+	assert.False(t, s.resyncStatus.isResynced("agent-b"))
 }
 
 func Test_RunHandlersOnConnect(t *testing.T) {
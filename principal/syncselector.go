@@ -0,0 +1,88 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package principal
+
+import (
+	"context"
+
+	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/argoproj-labs/argocd-agent/internal/argocd/cluster"
+	"github.com/argoproj-labs/argocd-agent/internal/event"
+	"github.com/argoproj-labs/argocd-agent/internal/event/targets"
+	"github.com/argoproj-labs/argocd-agent/internal/resources"
+	"github.com/argoproj-labs/argocd-agent/pkg/replication"
+)
+
+// syncSelector returns the label selector the Applications propagated to
+// agentName must match, or nil if all Applications are propagated. The
+// selector in the agent's cluster secret takes precedence over the one of the
+// principal. An invalid selector in the cluster secret is ignored.
+func (s *Server) syncSelector(agentName string) labels.Selector {
+	var sel labels.Selector
+	if s.options != nil {
+		sel = s.options.syncLabelSelector
+	}
+	if s.clusterMgr == nil {
+		return sel
+	}
+	c := s.clusterMgr.Mapping(agentName)
+	if c == nil {
+		return sel
+	}
+	value, ok := c.Annotations[cluster.AnnotationKeySyncLabelSelector]
+	if !ok {
+		return sel
+	}
+	if value == "" {
+		return nil
+	}
+	agentSel, err := labels.Parse(value)
+	if err != nil {
+		log().WithError(err).WithField("agent", agentName).Error("Ignoring invalid sync label selector of agent")
+		return sel
+	}
+	return agentSel
+}
+
+// syncsAppToAgent returns whether app is propagated to agentName. The
+// Applications of autonomous agents are not subject to a selector.
+func (s *Server) syncsAppToAgent(agentName string, app *v1alpha1.Application) bool {
+	if s.isResourceFromAutonomousAgent(app) {
+		return true
+	}
+	sel := s.syncSelector(agentName)
+	return sel == nil || sel.Matches(labels.Set(app.Labels))
+}
+
+// unsyncAppFromAgent deletes app from agentName after it stopped matching the
+// agent's sync label selector.
+func (s *Server) unsyncAppFromAgent(ctx context.Context, agentName string, app *v1alpha1.Application, logCtx *logrus.Entry) {
+	s.resources.Remove(agentName, resources.NewResourceKeyFromApp(app))
+	if s.tombstones != nil {
+		s.tombstones.add(agentName, app)
+	}
+	q := s.queues.SendQ(agentName)
+	if q == nil {
+		return
+	}
+	ev := s.events.ApplicationEvent(event.Delete, app)
+	s.stampEvent(ctx, ev)
+	q.Add(ev)
+	s.ha.ForwardEventForReplication(event.New(ev, targets.Application), agentName, replication.DirectionOutbound)
+	logCtx.Debug("Application no longer matches the sync label selector of the agent, deleting it from the agent")
+}
@@ -0,0 +1,104 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package principal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/argoproj-labs/argocd-agent/internal/backend/mocks"
+	"github.com/argoproj-labs/argocd-agent/internal/event"
+	"github.com/argoproj-labs/argocd-agent/internal/manager/application"
+	"github.com/argoproj-labs/argocd-agent/internal/queue"
+	"github.com/argoproj-labs/argocd-agent/internal/resources"
+	"github.com/argoproj-labs/argocd-agent/pkg/types"
+)
+
+func Test_SyncLabelSelector(t *testing.T) {
+	newServer := func(t *testing.T, selector string) *Server {
+		t.Helper()
+		appManager, err := application.NewApplicationManager(&mocks.Application{}, "argocd")
+		require.NoError(t, err)
+		s := &Server{
+			ctx:          context.Background(),
+			queues:       queue.NewSendRecvQueues(),
+			events:       event.NewEventSource("test"),
+			namespaceMap: map[string]types.AgentMode{"managed-agent": types.AgentModeManaged},
+			appManager:   appManager,
+			resources:    resources.NewAgentResources(),
+			appToAgent:   newConcurrentStringMap(),
+			options:      &ServerOptions{},
+		}
+		require.NoError(t, WithSyncLabelSelector(selector)(s))
+		require.NoError(t, s.queues.Create("managed-agent"))
+		return s
+	}
+	app := func(rv string, lbls map[string]string) *v1alpha1.Application {
+		return &v1alpha1.Application{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-app", Namespace: "managed-agent", ResourceVersion: rv, Labels: lbls},
+			Spec:       v1alpha1.ApplicationSpec{Project: "default"},
+		}
+	}
+
+	t.Run("Invalid selectors are rejected", func(t *testing.T) {
+		s := &Server{options: &ServerOptions{}}
+		assert.Error(t, WithSyncLabelSelector("env in (")(s))
+	})
+
+	t.Run("Applications not matching the selector are not sent", func(t *testing.T) {
+		s := newServer(t, "env!=test")
+		s.newAppCallback(app("1", map[string]string{"env": "test"}))
+		assert.Equal(t, 0, s.queues.SendQ("managed-agent").Len())
+
+		s.newAppCallback(app("1", map[string]string{"env": "prod"}))
+		assert.Equal(t, 1, s.queues.SendQ("managed-agent").Len())
+	})
+
+	t.Run("Applications that stop matching are deleted from the agent", func(t *testing.T) {
+		s := newServer(t, "env!=test")
+		s.updateAppCallback(app("1", nil), app("2", map[string]string{"env": "test"}))
+		sendQ := s.queues.SendQ("managed-agent")
+		require.Equal(t, 1, sendQ.Len())
+		ev, _ := sendQ.Get()
+		sendQ.Done(ev)
+		assert.Equal(t, event.Delete.String(), ev.Type())
+		assert.Empty(t, s.resources.GetAllResources("managed-agent"))
+
+		// Further updates are not sent
+		s.updateAppCallback(app("2", map[string]string{"env": "test"}), app("3", map[string]string{"env": "test"}))
+		assert.Equal(t, 0, sendQ.Len())
+	})
+
+	t.Run("Applications that start matching are created on the agent", func(t *testing.T) {
+		s := newServer(t, "env!=test")
+		s.updateAppCallback(app("1", map[string]string{"env": "test"}), app("2", nil))
+		sendQ := s.queues.SendQ("managed-agent")
+		require.Equal(t, 1, sendQ.Len())
+		ev, _ := sendQ.Get()
+		sendQ.Done(ev)
+		assert.Equal(t, event.Create.String(), ev.Type())
+	})
+
+	t.Run("Without a selector all Applications are sent", func(t *testing.T) {
+		s := newServer(t, "")
+		assert.Nil(t, s.syncSelector("managed-agent"))
+		assert.True(t, s.syncsAppToAgent("managed-agent", app("1", map[string]string{"env": "test"})))
+	})
+}
@@ -0,0 +1,184 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package principal
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/argoproj-labs/argocd-agent/internal/event"
+)
+
+// maxTombstones is the number of deleted Applications remembered per agent.
+// Agents whose watermark is older than the oldest remembered deletion are
+// resynced in full.
+const maxTombstones = 1024
+
+type tombstone struct {
+	app *v1alpha1.Application
+	rv  uint64
+}
+
+// appTombstones remembers the Applications deleted on the principal, so that
+// the deletions can be replayed to agents that resync incrementally.
+type appTombstones struct {
+	mu sync.Mutex
+	// floor is the resource version since which deletions are remembered.
+	// As long as it is 0, no agent can be resynced incrementally.
+	floor uint64
+	// agentFloor is the floor of agents whose oldest tombstones were evicted
+	agentFloor map[string]uint64
+	byAgent    map[string][]tombstone
+}
+
+func newAppTombstones() *appTombstones {
+	return &appTombstones{
+		agentFloor: map[string]uint64{},
+		byAgent:    map[string][]tombstone{},
+	}
+}
+
+// setFloor sets the resource version since which deletions are remembered.
+func (t *appTombstones) setFloor(resourceVersion string) error {
+	rv, err := strconv.ParseUint(resourceVersion, 10, 64)
+	if err != nil {
+		return fmt.Errorf("resource version %q is not numeric", resourceVersion)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.floor = rv
+	return nil
+}
+
+// add remembers the deletion of app, which was sent to agentName.
+func (t *appTombstones) add(agentName string, app *v1alpha1.Application) {
+	rv, err := strconv.ParseUint(app.ResourceVersion, 10, 64)
+	if err != nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stones := append(t.byAgent[agentName], tombstone{app: app.DeepCopy(), rv: rv})
+	if len(stones) > maxTombstones {
+		// Deletions up to the evicted one can no longer be replayed
+		if evicted := stones[0].rv + 1; evicted > t.agentFloor[agentName] {
+			t.agentFloor[agentName] = evicted
+		}
+		stones = stones[1:]
+	}
+	t.byAgent[agentName] = stones
+}
+
+// since returns the Applications deleted in the namespaces of watermarks
+// whose last resource version is at least the watermark of their namespace.
+// It returns false if deletions after any of the watermarks may have been
+// forgotten.
+func (t *appTombstones) since(agentName string, watermarks map[string]uint64) ([]*v1alpha1.Application, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.floor == 0 {
+		return nil, false
+	}
+	for _, wm := range watermarks {
+		if wm < t.floor || wm < t.agentFloor[agentName] {
+			return nil, false
+		}
+	}
+	var deleted []*v1alpha1.Application
+	for _, ts := range t.byAgent[agentName] {
+		// The agent may have seen the last version of the Application, but
+		// not its deletion
+		if wm, ok := watermarks[ts.app.Namespace]; ok && ts.rv >= wm {
+			deleted = append(deleted, ts.app)
+		}
+	}
+	return deleted, true
+}
+
+// resyncIncrementally sends the changes to the Applications of agentName
+// made after the watermarks the agent reported. If the principal cannot tell
+// all the changes after a watermark, it requests a full resync instead.
+func (s *Server) resyncIncrementally(ctx context.Context, agentName string, req *event.RequestIncrementalResync, logCtx *logrus.Entry) error {
+	sendQ := s.queues.SendQ(agentName)
+	if sendQ == nil {
+		return fmt.Errorf("queue not found for agent: %s", agentName)
+	}
+
+	watermarks := make(map[string]uint64, len(req.Watermarks))
+	for ns, v := range req.Watermarks {
+		rv, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			// Zero is older than any floor
+			rv = 0
+		}
+		watermarks[ns] = rv
+	}
+
+	deleted, ok := s.tombstones.since(agentName, watermarks)
+	if !ok {
+		logCtx.Info("Watermark of the agent is too old, requesting a full resync")
+		ev, err := s.events.RequestResourceResyncEvent()
+		if err != nil {
+			return fmt.Errorf("failed to create ResourceResync event: %w", err)
+		}
+		s.stampEvent(ctx, ev)
+		sendQ.Add(ev)
+		return nil
+	}
+
+	// Deletions go first, in case an Application was recreated
+	for _, app := range deleted {
+		ev := s.events.ApplicationEvent(event.Delete, app)
+		s.stampEvent(ctx, ev)
+		sendQ.Add(ev)
+	}
+
+	updated := 0
+	for _, key := range s.resources.GetAllResources(agentName) {
+		if key.Kind != "Application" {
+			continue
+		}
+		app, err := s.appManager.Get(ctx, key.Name, key.Namespace)
+		if err != nil {
+			if !apierrors.IsNotFound(err) {
+				logCtx.WithError(err).WithField("app", key.Namespace+"/"+key.Name).Error("Failed to get application for incremental resync")
+			}
+			continue
+		}
+		if wm, ok := watermarks[app.Namespace]; ok {
+			if rv, err := strconv.ParseUint(app.ResourceVersion, 10, 64); err == nil && rv <= wm {
+				continue
+			}
+		}
+		out := app.DeepCopy()
+		out.Operation = nil
+		ev := s.events.ApplicationEvent(event.SpecUpdate, s.appForAgent(agentName, out))
+		s.stampEvent(ctx, ev)
+		sendQ.Add(ev)
+		updated++
+	}
+
+	logCtx.WithFields(logrus.Fields{
+		"deleted": len(deleted),
+		"updated": updated,
+	}).Info("Resynced agent incrementally")
+	return nil
+}
@@ -0,0 +1,135 @@
+// Copyright 2025 The argocd-agent Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package principal
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+
+	"github.com/argoproj-labs/argocd-agent/internal/event"
+	"github.com/argoproj-labs/argocd-agent/internal/event/targets"
+	"github.com/argoproj-labs/argocd-agent/internal/resources"
+	"github.com/argoproj-labs/argocd-agent/test/fake/kube"
+)
+
+func watermarkApp(name, namespace, rv string) *v1alpha1.Application {
+	return &v1alpha1.Application{ObjectMeta: metav1.ObjectMeta{
+		Name:            name,
+		Namespace:       namespace,
+		UID:             k8stypes.UID("uid-" + name),
+		ResourceVersion: rv,
+	}}
+}
+
+func Test_appTombstones(t *testing.T) {
+	t.Run("Unknown floor rejects every watermark", func(t *testing.T) {
+		ts := newAppTombstones()
+		_, ok := ts.since("agent", map[string]uint64{"agent": 100})
+		assert.False(t, ok)
+	})
+
+	t.Run("Deletions at or after the watermark are returned", func(t *testing.T) {
+		ts := newAppTombstones()
+		require.NoError(t, ts.setFloor("50"))
+		ts.add("agent", watermarkApp("old", "agent", "60"))
+		ts.add("agent", watermarkApp("seen", "agent", "70"))
+		ts.add("agent", watermarkApp("new", "agent", "80"))
+		ts.add("agent", watermarkApp("elsewhere", "other", "90"))
+
+		deleted, ok := ts.since("agent", map[string]uint64{"agent": 70})
+		require.True(t, ok)
+		names := []string{}
+		for _, app := range deleted {
+			names = append(names, app.Name)
+		}
+		assert.Equal(t, []string{"seen", "new"}, names)
+
+		_, ok = ts.since("agent", map[string]uint64{"agent": 40})
+		assert.False(t, ok)
+	})
+
+	t.Run("Evicted deletions raise the floor of the agent", func(t *testing.T) {
+		ts := newAppTombstones()
+		require.NoError(t, ts.setFloor("1"))
+		for i := 0; i <= maxTombstones; i++ {
+			ts.add("agent", watermarkApp(fmt.Sprintf("app-%d", i), "agent", fmt.Sprintf("%d", 10+i)))
+		}
+		_, ok := ts.since("agent", map[string]uint64{"agent": 10})
+		assert.False(t, ok)
+		deleted, ok := ts.since("agent", map[string]uint64{"agent": 11})
+		require.True(t, ok)
+		assert.Len(t, deleted, maxTombstones)
+		_, ok = ts.since("other-agent", map[string]uint64{"agent": 10})
+		assert.True(t, ok)
+	})
+}
+
+func Test_resyncIncrementally(t *testing.T) {
+	ctx := context.Background()
+	agentName := "agent"
+	unchanged := watermarkApp("unchanged", agentName, "90")
+	changed := watermarkApp("changed", agentName, "110")
+
+	s, err := NewServer(ctx, kube.NewKubernetesFakeClientWithApps(testNamespace, unchanged, changed), testNamespace,
+		WithGeneratedTokenSigningKey(),
+		WithRedisProxyDisabled(),
+	)
+	require.NoError(t, err)
+	s.events = event.NewEventSource("test")
+	require.NoError(t, s.queues.Create(agentName))
+	s.resources.Add(agentName, resources.NewResourceKeyFromApp(unchanged))
+	s.resources.Add(agentName, resources.NewResourceKeyFromApp(changed))
+	logCtx := logrus.NewEntry(logrus.StandardLogger())
+	sendQ := s.queues.SendQ(agentName)
+
+	t.Run("Full resync if the watermark is too old", func(t *testing.T) {
+		err := s.resyncIncrementally(ctx, agentName, &event.RequestIncrementalResync{Watermarks: map[string]string{agentName: "100"}}, logCtx)
+		require.NoError(t, err)
+		require.Equal(t, 1, sendQ.Len())
+		ev, _ := sendQ.Get()
+		sendQ.Done(ev)
+		assert.Equal(t, event.EventRequestResourceResync.String(), ev.Type())
+	})
+
+	t.Run("Only changes after the watermark are sent", func(t *testing.T) {
+		require.NoError(t, s.tombstones.setFloor("95"))
+		s.tombstones.add(agentName, watermarkApp("deleted", agentName, "105"))
+
+		err := s.resyncIncrementally(ctx, agentName, &event.RequestIncrementalResync{Watermarks: map[string]string{agentName: "100"}}, logCtx)
+		require.NoError(t, err)
+		require.Equal(t, 2, sendQ.Len())
+
+		sent := map[string]string{}
+		for sendQ.Len() > 0 {
+			ev, _ := sendQ.Get()
+			sendQ.Done(ev)
+			app, err := event.New(ev, targets.Application).Application()
+			require.NoError(t, err)
+			sent[app.Name] = ev.Type()
+		}
+		assert.Equal(t, map[string]string{
+			"deleted": event.Delete.String(),
+			"changed": event.SpecUpdate.String(),
+		}, sent)
+	})
+}